@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package cmd
 
 import (
@@ -35,18 +37,27 @@ type Config struct {
 	IgnoreInboundInvs bool
 	MaxInboundPeers   uint32
 	OneInboundPerIp   bool
+	PeerAllowlist     []string
+	PeerDenylist      []string
+
+	// Peer rate limits
+	PeerRateLimits             []string
+	PeerRateLimitMaxViolations uint64
 
 	// NetworkingManager config
 	PeerConnectionRefreshIntervalMillis uint64
 
 	// Snapshot
-	HyperSync                 bool
-	ForceChecksum             bool
-	SyncType                  lib.NodeSyncType
-	MaxSyncBlockHeight        uint32
-	SnapshotBlockHeightPeriod uint64
-	DisableEncoderMigrations  bool
-	HypersyncMaxQueueSize     uint32
+	HyperSync                   bool
+	ForceChecksum               bool
+	SyncType                    lib.NodeSyncType
+	MaxSyncBlockHeight          uint32
+	SnapshotBlockHeightPeriod   uint64
+	DisableEncoderMigrations    bool
+	DualEncodeValidationWindow  uint64
+	HypersyncMaxQueueSize       uint32
+	HypersyncMaxPeers           int
+	HypersyncMaxRequestsPerPeer int
 
 	// PoS Validator
 	PosValidatorSeed string
@@ -86,6 +97,91 @@ type Config struct {
 
 	// PoS Checkpoint Syncing
 	CheckpointSyncingProviders []string
+
+	// Telemetry
+	TelemetryCollectorURLs   []string
+	TelemetryIntervalSeconds uint64
+
+	// Notification Server
+	NotificationServerListenAddress string
+	NotificationServerBufferSize    int
+
+	// Fork Backups
+	ForkBackupDirectory        string
+	ForkBackupBlocksBeforeFork uint64
+	ForkBackupRetention        int
+
+	// Relay Policy
+	RelayPolicyDeniedPublicKeys     []string
+	RelayPolicyDeniedPublicKeysFile string
+
+	// Block Assembly Policy
+	BlockAssemblyLanes []string
+
+	// DAO Coin Candles
+	DAOCoinCandleIndex bool
+
+	// DESO Balance History
+	DeSoBalanceHistoryIndex bool
+
+	// Emission
+	EmissionIndex bool
+
+	// Txn Labels
+	TxnLabelStore bool
+
+	// Block Index Cache
+	BlockIndexCache bool
+
+	// State Attestations
+	StateAttestationSeed string
+
+	// Mempool Sync
+	MempoolSyncOnConnect bool
+
+	// Mempool Replace By Fee
+	MempoolReplaceByFee                              bool
+	MempoolReplaceByFeeMinFeeRateIncreaseBasisPoints uint64
+	MempoolReplaceByFeeMaxEvictedTxns                uint64
+
+	// Mempool Journal
+	MempoolJournalFile string
+
+	// Mempool Metrics
+	MempoolMetricsExpvar bool
+
+	// UtxoView Change Log
+	UtxoViewChangeLogFile string
+
+	// Storage Backend
+	StorageBackend        string
+	StorageBackendOptions string
+
+	// UtxoOps Pruning
+	PruneMode         lib.PruneMode
+	UtxoOpsPruneDepth uint64
+
+	// Mempool Decisions
+	MempoolDecisionLogFile    string
+	MempoolDecisionReplayFile string
+
+	// Invariant Checker
+	InvariantChecker                bool
+	InvariantCheckerIntervalSeconds uint64
+	InvariantCheckerBatchSize       uint64
+	InvariantCheckerAlertURLs       []string
+
+	// NFT Bid Archive
+	NFTBidArchiveDepth uint64
+
+	// Snapshot Publisher
+	SnapshotPublisherEndpoint        string
+	SnapshotPublisherRegion          string
+	SnapshotPublisherBucket          string
+	SnapshotPublisherKeyPrefix       string
+	SnapshotPublisherAccessKeyID     string
+	SnapshotPublisherSecretAccessKey string
+	SnapshotPublisherIntervalSeconds uint64
 }
 
 // Viper doesn't work when you have environment variables. This is the
@@ -135,7 +231,10 @@ func LoadConfig() *Config {
 	config.MaxSyncBlockHeight = viper.GetUint32("max-sync-block-height")
 	config.SnapshotBlockHeightPeriod = viper.GetUint64("snapshot-block-height-period")
 	config.DisableEncoderMigrations = viper.GetBool("disable-encoder-migrations")
+	config.DualEncodeValidationWindow = viper.GetUint64("dual-encode-validation-window")
 	config.HypersyncMaxQueueSize = viper.GetUint32("hypersync-max-queue-size")
+	config.HypersyncMaxPeers = viper.GetInt("hypersync-max-peers")
+	config.HypersyncMaxRequestsPerPeer = viper.GetInt("hypersync-max-requests-per-peer")
 
 	// PoS Validator
 	config.PosValidatorSeed = viper.GetString("pos-validator-seed")
@@ -160,6 +259,12 @@ func LoadConfig() *Config {
 	config.IgnoreInboundInvs = viper.GetBool("ignore-inbound-invs")
 	config.MaxInboundPeers = viper.GetUint32("max-inbound-peers")
 	config.OneInboundPerIp = viper.GetBool("one-inbound-per-ip")
+	config.PeerAllowlist = GetStringSliceWorkaround("peer-allowlist")
+	config.PeerDenylist = GetStringSliceWorkaround("peer-denylist")
+
+	// Peer rate limits
+	config.PeerRateLimits = GetStringSliceWorkaround("peer-rate-limits")
+	config.PeerRateLimitMaxViolations = viper.GetUint64("peer-rate-limit-max-violations")
 
 	// NetworkManager config
 	config.PeerConnectionRefreshIntervalMillis = viper.GetUint64("peer-connection-refresh-interval-millis")
@@ -220,6 +325,102 @@ func LoadConfig() *Config {
 			" on all blocks, which may be slow. Consider specifying a checkpoint syncing provider.")
 	}
 
+	// Telemetry
+	config.TelemetryCollectorURLs = GetStringSliceWorkaround("telemetry-collector-urls")
+	for _, collectorURL := range config.TelemetryCollectorURLs {
+		if _, err := url.ParseRequestURI(collectorURL); err != nil {
+			glog.Fatalf("Invalid telemetry collector URL: %v", collectorURL)
+		}
+	}
+	config.TelemetryIntervalSeconds = viper.GetUint64("telemetry-interval-seconds")
+
+	// Notification Server
+	config.NotificationServerListenAddress = viper.GetString("notification-server-listen-address")
+	config.NotificationServerBufferSize = viper.GetInt("notification-server-buffer-size")
+
+	// Fork Backups
+	config.ForkBackupDirectory = viper.GetString("fork-backup-dir")
+	config.ForkBackupBlocksBeforeFork = viper.GetUint64("fork-backup-blocks-before-fork")
+	config.ForkBackupRetention = viper.GetInt("fork-backup-retention")
+
+	// Relay Policy
+	config.RelayPolicyDeniedPublicKeys = GetStringSliceWorkaround("relay-policy-denied-public-keys")
+	config.RelayPolicyDeniedPublicKeysFile = viper.GetString("relay-policy-denied-public-keys-file")
+
+	// Block Assembly Policy
+	config.BlockAssemblyLanes = GetStringSliceWorkaround("block-assembly-lanes")
+
+	// DAO Coin Candles
+	config.DAOCoinCandleIndex = viper.GetBool("dao-coin-candle-index")
+
+	// DESO Balance History
+	config.DeSoBalanceHistoryIndex = viper.GetBool("deso-balance-history-index")
+
+	// Emission
+	config.EmissionIndex = viper.GetBool("emission-index")
+
+	// Txn Labels
+	config.TxnLabelStore = viper.GetBool("txn-label-store")
+
+	// Block Index Cache
+	config.BlockIndexCache = viper.GetBool("block-index-cache")
+
+	// State Attestations
+	config.StateAttestationSeed = viper.GetString("state-attestation-seed")
+
+	// Mempool Sync
+	config.MempoolSyncOnConnect = viper.GetBool("mempool-sync-on-connect")
+
+	// Mempool Replace By Fee
+	config.MempoolReplaceByFee = viper.GetBool("mempool-replace-by-fee")
+	config.MempoolReplaceByFeeMinFeeRateIncreaseBasisPoints = viper.GetUint64(
+		"mempool-replace-by-fee-min-fee-rate-increase-basis-points")
+	config.MempoolReplaceByFeeMaxEvictedTxns = viper.GetUint64("mempool-replace-by-fee-max-evicted-txns")
+
+	// Mempool Journal
+	config.MempoolJournalFile = viper.GetString("mempool-journal-file")
+
+	// Mempool Metrics
+	config.MempoolMetricsExpvar = viper.GetBool("mempool-metrics-expvar")
+
+	// UtxoView Change Log
+	config.UtxoViewChangeLogFile = viper.GetString("utxo-view-change-log-file")
+
+	// Storage Backend
+	config.StorageBackend = viper.GetString("storage-backend")
+	config.StorageBackendOptions = viper.GetString("storage-backend-options")
+
+	// UtxoOps Pruning
+	config.PruneMode = lib.PruneMode(viper.GetString("prune-mode"))
+	config.UtxoOpsPruneDepth = viper.GetUint64("utxo-ops-prune-depth")
+
+	// Mempool Decisions
+	config.MempoolDecisionLogFile = viper.GetString("mempool-decision-log-file")
+	config.MempoolDecisionReplayFile = viper.GetString("mempool-decision-replay-file")
+
+	// Invariant Checker
+	config.InvariantChecker = viper.GetBool("invariant-checker")
+	config.InvariantCheckerIntervalSeconds = viper.GetUint64("invariant-checker-interval-seconds")
+	config.InvariantCheckerBatchSize = viper.GetUint64("invariant-checker-batch-size")
+	config.InvariantCheckerAlertURLs = GetStringSliceWorkaround("invariant-checker-alert-urls")
+	for _, alertURL := range config.InvariantCheckerAlertURLs {
+		if _, err := url.ParseRequestURI(alertURL); err != nil {
+			glog.Fatalf("Invalid invariant checker alert URL: %v", alertURL)
+		}
+	}
+
+	// NFT Bid Archive
+	config.NFTBidArchiveDepth = viper.GetUint64("nft-bid-archive-depth")
+
+	// Snapshot Publisher
+	config.SnapshotPublisherEndpoint = viper.GetString("snapshot-publisher-endpoint")
+	config.SnapshotPublisherRegion = viper.GetString("snapshot-publisher-region")
+	config.SnapshotPublisherBucket = viper.GetString("snapshot-publisher-bucket")
+	config.SnapshotPublisherKeyPrefix = viper.GetString("snapshot-publisher-key-prefix")
+	config.SnapshotPublisherAccessKeyID = viper.GetString("snapshot-publisher-access-key-id")
+	config.SnapshotPublisherSecretAccessKey = viper.GetString("snapshot-publisher-secret-access-key")
+	config.SnapshotPublisherIntervalSeconds = viper.GetUint64("snapshot-publisher-interval-seconds")
+
 	return &config
 }
 
@@ -299,4 +500,96 @@ func (config *Config) Print() {
 
 	glog.Infof("Rate Limit Feerate: %d", config.RateLimitFeerate)
 	glog.Infof("Min Feerate: %d", config.MinFeerate)
+
+	if len(config.TelemetryCollectorURLs) > 0 {
+		glog.Infof("Telemetry Collectors: %s", config.TelemetryCollectorURLs)
+	}
+
+	if config.NotificationServerListenAddress != "" {
+		glog.Infof("Notification Server: %s", config.NotificationServerListenAddress)
+	}
+
+	if config.ForkBackupDirectory != "" {
+		glog.Infof("Fork Backup Directory: %s (retaining %d)", config.ForkBackupDirectory, config.ForkBackupRetention)
+	}
+
+	if len(config.RelayPolicyDeniedPublicKeys) > 0 || config.RelayPolicyDeniedPublicKeysFile != "" {
+		glog.Infof("Relay Policy: %d denied public keys, denied public keys file: %s",
+			len(config.RelayPolicyDeniedPublicKeys), config.RelayPolicyDeniedPublicKeysFile)
+	}
+
+	if len(config.BlockAssemblyLanes) > 0 {
+		glog.Infof("Block Assembly Lanes: %v", config.BlockAssemblyLanes)
+	}
+
+	if config.DAOCoinCandleIndex {
+		glog.Infof("DAO Coin Candle Index: ON")
+	}
+
+	if config.DeSoBalanceHistoryIndex {
+		glog.Infof("DESO Balance History Index: ON")
+	}
+
+	if config.EmissionIndex {
+		glog.Infof("Emission Index: ON")
+	}
+
+	if config.TxnLabelStore {
+		glog.Infof("Txn Label Store: ON")
+	}
+
+	if config.BlockIndexCache {
+		glog.Infof("Block Index Cache: ON")
+	}
+
+	if config.StateAttestationSeed != "" {
+		glog.Infof("State Attestations: ON")
+	}
+
+	if config.MempoolSyncOnConnect {
+		glog.Infof("Mempool Sync On Connect: ON")
+	}
+
+	if config.MempoolReplaceByFee {
+		glog.Infof("Mempool Replace By Fee: ON (min fee rate increase: %d basis points, max evicted txns: %d)",
+			config.MempoolReplaceByFeeMinFeeRateIncreaseBasisPoints, config.MempoolReplaceByFeeMaxEvictedTxns)
+	}
+
+	if config.MempoolJournalFile != "" {
+		glog.Infof("Mempool Journal File: %s", config.MempoolJournalFile)
+	}
+
+	if config.MempoolMetricsExpvar {
+		glog.Infof("Mempool Metrics Expvar: ON")
+	}
+
+	if config.UtxoViewChangeLogFile != "" {
+		glog.Infof("UtxoView Change Log File: %s", config.UtxoViewChangeLogFile)
+	}
+
+	if config.StorageBackend != "" {
+		glog.Infof("Storage Backend: %s", config.StorageBackend)
+	}
+
+	if config.PruneMode != lib.PruneModeNone {
+		glog.Infof("Prune Mode: %v", config.PruneMode)
+		glog.Infof("UtxoOps Prune Depth: %d", config.UtxoOpsPruneDepth)
+	}
+
+	if config.MempoolDecisionLogFile != "" {
+		glog.Infof("Mempool Decision Log File: %s", config.MempoolDecisionLogFile)
+	}
+
+	if config.InvariantChecker {
+		glog.Infof("Invariant Checker: ON (alert URLs: %s)", config.InvariantCheckerAlertURLs)
+	}
+
+	if config.NFTBidArchiveDepth > 0 {
+		glog.Infof("NFT Bid Archive: ON (depth: %d)", config.NFTBidArchiveDepth)
+	}
+
+	if config.SnapshotPublisherEndpoint != "" {
+		glog.Infof("Snapshot Publisher: ON (endpoint: %s, bucket: %s)",
+			config.SnapshotPublisherEndpoint, config.SnapshotPublisherBucket)
+	}
 }
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package cmd
 
 import (
@@ -30,10 +32,34 @@ type Node struct {
 	Server    *lib.Server
 	ChainDB   *badger.DB
 	TXIndex   *lib.TXIndex
-	Params    *lib.DeSoParams
-	Config    *Config
-	Postgres  *lib.Postgres
-	Listeners []net.Listener
+	Telemetry *lib.TelemetryBeacon
+	// NotificationServer is set when block and mempool notifications are being served.
+	NotificationServer *lib.NotificationServer
+	// ForkBackup is set when pre-fork backups are enabled.
+	ForkBackup *lib.ForkBackupManager
+	// DAOCoinCandleIndex is set when the DAO coin candle index is enabled.
+	DAOCoinCandleIndex *lib.DAOCoinCandleIndex
+	// DeSoBalanceHistoryIndex is set when the DESO balance history index is enabled.
+	DeSoBalanceHistoryIndex *lib.DeSoBalanceHistoryIndex
+	// EmissionIndex is set when the emission index is enabled.
+	EmissionIndex *lib.EmissionIndex
+	// TxnLabelStore is set when the txn label store is enabled.
+	TxnLabelStore *lib.TxnLabelStore
+	// InvariantChecker is set when the invariant checker is enabled.
+	InvariantChecker *lib.InvariantChecker
+	// SnapshotPublisher is set when snapshots are published to object storage.
+	SnapshotPublisher *lib.SnapshotPublisher
+	Params            *lib.DeSoParams
+	Config            *Config
+	Postgres          *lib.Postgres
+	Listeners         []net.Listener
+
+	// MempoolDecisionRecorder is set when mempool decisions are being recorded.
+	MempoolDecisionRecorder *lib.MempoolDecisionRecorder
+	// MempoolJournal is set when the mempool's txns are persisted across restarts.
+	MempoolJournal *lib.MempoolJournal
+	// UtxoViewChangeLog is set when the node's state changes are logged for downstream services.
+	UtxoViewChangeLog *lib.UtxoViewChangeLog
 
 	// IsRunning is false when a NewNode is created, set to true on Start(), set to false
 	// after Stop() is called. Mainly used in testing.
@@ -93,6 +119,13 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 	// schema without requiring a resync. GlobalDeSoParams is used so that encoders know if we're on mainnet or testnet.
 	lib.GlobalDeSoParams = *node.Params
 
+	// Validate encodings around encoder migrations if requested.
+	if node.Config.DualEncodeValidationWindow > 0 {
+		glog.Infof(lib.CLog(lib.Yellow, fmt.Sprintf("Start: Dual-encode validation enabled within %d blocks "+
+			"of encoder migrations", node.Config.DualEncodeValidationWindow)))
+		lib.EnableDualEncodeValidation(node.Params, node.Config.DualEncodeValidationWindow)
+	}
+
 	// Setup Datadog span tracer and profiler
 	if node.Config.DatadogProfiler {
 		tracer.Start()
@@ -106,6 +139,8 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		lib.Mode = lib.EnableTimer
 	}
 
+	lib.NFTBidArchiveDepth = node.Config.NFTBidArchiveDepth
+
 	// Setup statsd
 	statsdClient, err := statsd.New(fmt.Sprintf("%s:%d", os.Getenv("DD_AGENT_HOST"), 8125))
 	if err != nil {
@@ -148,6 +183,16 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		panic(err)
 	}
 
+	// Setup a third-party storage backend, which is passed to the server below.
+	var storageBackend lib.StorageBackend
+	if node.Config.StorageBackend != "" {
+		storageBackend, err = lib.NewStorageBackend(node.Config.StorageBackend, node.ChainDB,
+			node.Config.StorageBackendOptions)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// Setup snapshot logger
 	if node.Config.LogDBSummarySnapshots {
 		lib.StartDBSummarySnapshots(node.ChainDB)
@@ -156,6 +201,13 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 	// Validate that we weren't passed incompatible Hypersync flags
 	lib.ValidateHyperSyncFlags(node.Config.HyperSync, node.Config.SyncType)
 
+	// Validate that we weren't passed incompatible pruning flags
+	producesBlocks := len(node.Config.MinerPublicKeys) > 0 || node.Config.PosValidatorSeed != ""
+	if err := lib.ValidatePruneFlags(
+		node.Config.PruneMode, node.Config.UtxoOpsPruneDepth, node.Config.SyncType, producesBlocks); err != nil {
+		glog.Fatal(err)
+	}
+
 	// Setup postgres using a remote URI. Postgres is not currently supported when we're in hypersync mode.
 	if node.Config.HyperSync && node.Config.PostgresURI != "" {
 		glog.Fatal("--postgres-uri is not supported when --hypersync=true. We're " +
@@ -206,6 +258,7 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		node.Config.ConnectIPs,
 		node.ChainDB,
 		node.Postgres,
+		storageBackend,
 		node.Config.TargetOutboundPeers,
 		node.Config.MaxInboundPeers,
 		node.Config.MinerPublicKeys,
@@ -244,6 +297,7 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		node.Config.TransactionValidationRefreshIntervalMillis,
 		node.Config.StateSyncerMempoolTxnSyncLimit,
 		node.Config.CheckpointSyncingProviders,
+		node.Config.MempoolSyncOnConnect,
 	)
 	if err != nil {
 		// shouldRestart can be true if, on the previous run, we did not finish flushing all ancestral
@@ -259,6 +313,194 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 	}
 
 	if !shouldRestart {
+		// Setup pre-fork backups. The handler is registered before the server starts so
+		// that it's in place before any blocks are committed.
+		if node.Config.ForkBackupDirectory != "" {
+			node.ForkBackup, err = lib.NewForkBackupManager(node.Server.GetBlockchain(),
+				node.Config.ForkBackupDirectory, node.Config.ForkBackupBlocksBeforeFork,
+				node.Config.ForkBackupRetention)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			eventManager.OnBlockCommitted(node.ForkBackup.HandleBlockCommitted)
+		}
+
+		// Setup the DAO coin candle index. Like the fork backups, its handlers are registered
+		// before the server starts so that no committed blocks are missed.
+		if node.Config.DAOCoinCandleIndex {
+			node.DAOCoinCandleIndex = lib.NewDAOCoinCandleIndex(node.ChainDB)
+			eventManager.OnBlockCommitted(node.DAOCoinCandleIndex.HandleBlockCommitted)
+			eventManager.OnBlockDisconnected(node.DAOCoinCandleIndex.HandleBlockDisconnected)
+			node.Server.DAOCoinCandleIndex = node.DAOCoinCandleIndex
+		}
+
+		// Setup the DESO balance history index. The running balances it records are only
+		// consistent if it sees every block committed after the first one it indexes.
+		if node.Config.DeSoBalanceHistoryIndex {
+			if node.Postgres != nil {
+				glog.Fatal("DESO balance history index is not supported with Postgres")
+			}
+			node.DeSoBalanceHistoryIndex = lib.NewDeSoBalanceHistoryIndex(node.ChainDB)
+			eventManager.OnBlockCommitted(node.DeSoBalanceHistoryIndex.HandleBlockCommitted)
+			eventManager.OnBlockDisconnected(node.DeSoBalanceHistoryIndex.HandleBlockDisconnected)
+		}
+
+		// Setup the emission index. Its running totals start from the first block it sees, so
+		// the emission schedule only reports figures for blocks committed while it's enabled.
+		if node.Config.EmissionIndex {
+			if node.Postgres != nil {
+				glog.Fatal("Emission index is not supported with Postgres")
+			}
+			node.EmissionIndex = lib.NewEmissionIndex(node.ChainDB, node.Params)
+			eventManager.OnBlockCommitted(node.EmissionIndex.HandleBlockCommitted)
+			eventManager.OnBlockDisconnected(node.EmissionIndex.HandleBlockDisconnected)
+			node.Server.EmissionIndex = node.EmissionIndex
+		}
+
+		// Setup the notification server. Its handlers are registered before the server starts so
+		// that subscribers see every block from the first one the node connects.
+		if node.Config.NotificationServerListenAddress != "" {
+			node.NotificationServer = lib.NewNotificationServer(node.Config.NotificationServerListenAddress,
+				node.Config.NotificationServerBufferSize)
+			eventManager.OnBlockConnected(node.NotificationServer.HandleBlockConnected)
+			eventManager.OnBlockDisconnected(node.NotificationServer.HandleBlockDisconnected)
+			eventManager.OnBlockCommitted(node.NotificationServer.HandleBlockCommitted)
+			node.Server.RegisterTransactionEventListener(node.NotificationServer.HandleTransactionEvent)
+			if err = node.NotificationServer.Start(); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		// Setup the txn label store. It doesn't follow the chain, so it only needs the db.
+		if node.Config.TxnLabelStore {
+			node.TxnLabelStore = lib.NewTxnLabelStore(node.ChainDB)
+			node.Server.TxnLabelStore = node.TxnLabelStore
+		}
+
+		// Setup the state attestor, which signs the state checksum with the operator's key.
+		if node.Config.StateAttestationSeed != "" {
+			node.Server.StateAttestor, err = lib.NewStateAttestor(node.Server.GetBlockchain(),
+				node.Config.StateAttestationSeed, node.Params)
+			if err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		// Restrict the peers we connect to, if the node is part of a private deployment.
+		if err = node.Server.GetNetworkManager().SetPeerFilterRules(node.Config.PeerAllowlist,
+			node.Config.PeerDenylist); err != nil {
+			glog.Fatal(err)
+		}
+
+		// Keep any single peer from making us thrash our disk with expensive requests.
+		peerRateLimits, err := lib.ParsePeerRateLimits(node.Config.PeerRateLimits)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if err = node.Server.SetPeerRateLimits(peerRateLimits, node.Config.PeerRateLimitMaxViolations); err != nil {
+			glog.Fatal(err)
+		}
+
+		// Spread the snapshot download across peers during hypersync.
+		if err = node.Server.SetHyperSyncPeerLimits(node.Config.HypersyncMaxPeers,
+			node.Config.HypersyncMaxRequestsPerPeer); err != nil {
+			glog.Fatal(err)
+		}
+
+		// Let txns that pay a higher fee rate replace the txns they conflict with.
+		if node.Config.MempoolReplaceByFee {
+			node.Server.SetMempoolReplaceByFeePolicy(&lib.ReplaceByFeePolicy{
+				MinFeeRateIncreaseBasisPoints: node.Config.MempoolReplaceByFeeMinFeeRateIncreaseBasisPoints,
+				MaxEvictedTxns:                node.Config.MempoolReplaceByFeeMaxEvictedTxns,
+			})
+		}
+
+		// Publish the mempool's metrics so operators can see why txns are dropped.
+		if node.Config.MempoolMetricsExpvar {
+			node.Server.PublishMempoolMetricsExpvar()
+		}
+
+		// Replay the txns that were in the mempool when the node stopped and keep persisting
+		// the txns it accepts.
+		if node.Config.MempoolJournalFile != "" {
+			node.MempoolJournal, err = lib.NewMempoolJournal(node.Config.MempoolJournalFile)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			if err = node.Server.LoadMempoolJournal(node.MempoolJournal); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		// Log the node's state changes so downstream services can follow them. Postgres nodes
+		// don't flush to badger, so there's nothing to log.
+		if node.Config.UtxoViewChangeLogFile != "" && node.Postgres == nil {
+			node.UtxoViewChangeLog, err = lib.NewUtxoViewChangeLog(node.Config.UtxoViewChangeLogFile)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			if err = node.Server.EnableUtxoViewChangeLog(node.UtxoViewChangeLog); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		// Prune the UtxoOperations of old blocks. A node that doesn't prune has to have every
+		// block's UtxoOperations.
+		if node.Config.PruneMode == lib.PruneModeNone {
+			if err = lib.CheckUtxoOpsNotPruned(node.ChainDB); err != nil {
+				glog.Fatal(err)
+			}
+		} else {
+			if err = node.Server.EnableUtxoOpsPruning(node.Config.UtxoOpsPruneDepth); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		// Replay recorded mempool decisions against this version before it processes any
+		// txns of its own, then start recording this version's decisions.
+		if node.Config.MempoolDecisionReplayFile != "" {
+			node.replayMempoolDecisions()
+		}
+		if node.Config.MempoolDecisionLogFile != "" {
+			node.MempoolDecisionRecorder, err = lib.NewMempoolDecisionRecorder(node.Config.MempoolDecisionLogFile)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			node.Server.SetMempoolDecisionRecorder(node.MempoolDecisionRecorder)
+		}
+
+		// Setup the operator relay policy. It's not a consensus rule, so it only affects
+		// which txns this node relays and includes in the blocks it produces.
+		if len(node.Config.RelayPolicyDeniedPublicKeys) > 0 || node.Config.RelayPolicyDeniedPublicKeysFile != "" {
+			deniedPublicKeys := node.Config.RelayPolicyDeniedPublicKeys
+			if node.Config.RelayPolicyDeniedPublicKeysFile != "" {
+				filePublicKeys, err := lib.LoadRelayPolicyPublicKeysFile(node.Config.RelayPolicyDeniedPublicKeysFile)
+				if err != nil {
+					glog.Fatal(err)
+				}
+				deniedPublicKeys = append(append([]string{}, deniedPublicKeys...), filePublicKeys...)
+			}
+			if err = node.Server.GetRelayPolicy().SetDeniedPublicKeys(deniedPublicKeys); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		// Setup the operator block assembly policy. Like the relay policy, it only affects
+		// the blocks this node produces.
+		if len(node.Config.BlockAssemblyLanes) > 0 {
+			var lanes []*lib.BlockAssemblyLane
+			for _, laneString := range node.Config.BlockAssemblyLanes {
+				lane, err := lib.ParseBlockAssemblyLane(laneString)
+				if err != nil {
+					glog.Fatal(err)
+				}
+				lanes = append(lanes, lane)
+			}
+			if err = node.Server.GetBlockAssemblyPolicy().SetLanes(lanes); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
 		node.Server.Start()
 
 		// Setup TXIndex - not compatible with postgres
@@ -272,6 +514,45 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 				node.TXIndex.Start()
 			}
 		}
+
+		// Setup telemetry, which is opt-in and only runs when collectors are configured.
+		if len(node.Config.TelemetryCollectorURLs) > 0 {
+			node.Telemetry, err = lib.NewTelemetryBeacon(node.Server, node.Params,
+				node.Config.TelemetryCollectorURLs, node.Config.TelemetryIntervalSeconds)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			node.Telemetry.Start()
+		}
+
+		// Setup the invariant checker - not compatible with postgres
+		if node.Config.InvariantChecker && node.Postgres == nil {
+			node.InvariantChecker = lib.NewInvariantChecker(node.Server.GetBlockchain(),
+				lib.DefaultInvariantChecks(), node.Config.InvariantCheckerIntervalSeconds,
+				node.Config.InvariantCheckerBatchSize, node.Config.InvariantCheckerAlertURLs)
+			node.InvariantChecker.Start()
+		}
+
+		// Setup the snapshot publisher, which uploads each snapshot epoch to object storage.
+		if node.Config.SnapshotPublisherEndpoint != "" {
+			objectStore, err := lib.NewS3ObjectStore(lib.S3ObjectStoreConfig{
+				Endpoint:        node.Config.SnapshotPublisherEndpoint,
+				Region:          node.Config.SnapshotPublisherRegion,
+				Bucket:          node.Config.SnapshotPublisherBucket,
+				AccessKeyID:     node.Config.SnapshotPublisherAccessKeyID,
+				SecretAccessKey: node.Config.SnapshotPublisherSecretAccessKey,
+			})
+			if err != nil {
+				glog.Fatal(err)
+			}
+			node.SnapshotPublisher, err = lib.NewSnapshotPublisher(node.Server.GetBlockchain().Snapshot(),
+				node.Params, objectStore, node.Config.SnapshotPublisherKeyPrefix,
+				node.Config.SnapshotPublisherIntervalSeconds)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			node.SnapshotPublisher.Start()
+		}
 	}
 	node.IsRunning = true
 
@@ -317,11 +598,77 @@ func (node *Node) Stop() {
 	glog.Infof(lib.CLog(lib.Yellow, "Node is shutting down. This might take a minute. Please don't "+
 		"close the node now or else you might corrupt the state."))
 
+	// Telemetry
+	if node.Telemetry != nil {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping telemetry..."))
+		node.Telemetry.Stop()
+		node.Telemetry = nil
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Telemetry successfully stopped."))
+	}
+
+	// Notification Server
+	if node.NotificationServer != nil {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping notification server..."))
+		node.NotificationServer.Stop()
+		node.NotificationServer = nil
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Notification server successfully stopped."))
+	}
+
+	// Invariant Checker
+	if node.InvariantChecker != nil {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping invariant checker..."))
+		node.InvariantChecker.Stop()
+		node.InvariantChecker = nil
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Invariant checker successfully stopped."))
+	}
+
+	// Snapshot Publisher
+	if node.SnapshotPublisher != nil {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping snapshot publisher..."))
+		node.SnapshotPublisher.Stop()
+		node.SnapshotPublisher = nil
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Snapshot publisher successfully stopped."))
+	}
+
 	// Server
 	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping server..."))
 	node.Server.Stop()
 	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Server successfully stopped."))
 
+	// Block Index Cache
+	if node.Config.BlockIndexCache && node.Config.PostgresURI == "" {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Saving block index..."))
+		if err := node.Server.GetBlockchain().SaveBlockIndexCache(); err != nil {
+			glog.Errorf("Node.Stop: Problem saving block index: %v", err)
+		} else {
+			glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Block index successfully saved."))
+		}
+	}
+
+	// Mempool decisions
+	if node.MempoolDecisionRecorder != nil {
+		if err := node.MempoolDecisionRecorder.Close(); err != nil {
+			glog.Errorf("Node.Stop: Problem closing mempool decision log: %v", err)
+		}
+		node.MempoolDecisionRecorder = nil
+	}
+
+	// Mempool journal
+	if node.MempoolJournal != nil {
+		if err := node.MempoolJournal.Close(); err != nil {
+			glog.Errorf("Node.Stop: Problem closing mempool journal: %v", err)
+		}
+		node.MempoolJournal = nil
+	}
+
+	// UtxoView change log
+	if node.UtxoViewChangeLog != nil {
+		if err := node.UtxoViewChangeLog.Close(); err != nil {
+			glog.Errorf("Node.Stop: Problem closing UtxoView change log: %v", err)
+		}
+		node.UtxoViewChangeLog = nil
+	}
+
 	// Snapshot
 	snap := node.Server.GetBlockchain().Snapshot()
 	if snap != nil {
@@ -338,6 +685,14 @@ func (node *Node) Stop() {
 		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: TXIndex successfully stopped."))
 	}
 
+	// Fork backups
+	if node.ForkBackup != nil {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Waiting for fork backup..."))
+		node.ForkBackup.Stop()
+		node.ForkBackup = nil
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Fork backup successfully stopped."))
+	}
+
 	// Databases
 	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Closing all databases..."))
 	node.closeDb(node.ChainDB, "chain")
@@ -366,6 +721,25 @@ func (node *Node) closeDb(db *badger.DB, dbName string) {
 	}()
 }
 
+// replayMempoolDecisions replays the decisions recorded in the MempoolDecisionReplayFile and
+// logs every txn this version decides differently.
+func (node *Node) replayMempoolDecisions() {
+	decisions, err := lib.LoadMempoolDecisions(node.Config.MempoolDecisionReplayFile)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	report, err := node.Server.ReplayMempoolDecisions(decisions)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	for _, mismatch := range report.Mismatches {
+		glog.Infof(lib.CLog(lib.Red, fmt.Sprintf("Node.replayMempoolDecisions: Decision changed: %v", mismatch)))
+	}
+	glog.Infof("Node.replayMempoolDecisions: Replayed %d decisions: %d matched, %d changed, %d recorded "+
+		"against a different tip", report.NumDecisions, report.NumMatches, len(report.Mismatches),
+		report.NumTipMismatches)
+}
+
 // listenToNodeMessages listens to the communication from the engine through the nodeMessageChan. There are currently
 // two main operations that the engine can request. These are a regular node restart, and a restart with a database
 // erase. The latter may seem a little harsh, but it is only triggered when the node is really broken and there's
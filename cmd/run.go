@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package cmd
 
 import (
@@ -75,8 +77,16 @@ func SetupRunFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().Bool("archival-mode", true, "Download all historical blocks after finishing hypersync.")
 	// Disable encoder migrations
 	cmd.PersistentFlags().Bool("disable-encoder-migrations", false, "Disable badgerDB encoder migrations")
+	// Dual-encode validation
+	cmd.PersistentFlags().Uint64("dual-encode-validation-window", 0, "When set, entries encoded within this many "+
+		"blocks of an encoder migration are also encoded with the previous encoder version, and any mismatch "+
+		"between the two is logged. Useful for catching migration bugs on live data. Disabled when 0.")
 	// Semephore cap that limits the number of snapshot chunks stored in the OperationChannel during hypersync.
 	cmd.PersistentFlags().Uint32("hypersync-max-queue-size", lib.HypersyncDefaultMaxQueueSize, "Limit number of snapshot chunks stored in the OperationChannel during hypersync.")
+	cmd.PersistentFlags().Int("hypersync-max-peers", lib.DefaultHyperSyncMaxPeers, "Max number of peers "+
+		"the snapshot is downloaded from at once during hypersync. Set to 1 to download from a single peer.")
+	cmd.PersistentFlags().Int("hypersync-max-requests-per-peer", lib.DefaultHyperSyncMaxRequestsPerPeer,
+		"Max number of state prefixes downloaded from each peer at once during hypersync.")
 	// Disable slow sync
 	cmd.PersistentFlags().String("sync-type", "any", `We have the following options for SyncType:
 		- any: Will sync with a node no matter what kind of syncing it supports.
@@ -136,6 +146,22 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"our connections and potentially make onerous requests as well. Useful to "+
 			"disable this flag when testing locally to allow multiple inbound connections "+
 			"from test servers")
+	cmd.PersistentFlags().StringSlice("peer-allowlist", []string{},
+		"A comma-separated list of IP ranges in CIDR notation, IP addresses, and validator BLS public keys. "+
+			"If set, the node only connects to, and accepts connections from, peers whose IP address or "+
+			"public key matches an entry. This is useful for private and consortium deployments.")
+	cmd.PersistentFlags().StringSlice("peer-denylist", []string{},
+		"A comma-separated list of IP ranges in CIDR notation, IP addresses, and validator BLS public keys. "+
+			"The node doesn't connect to, or accept connections from, peers whose IP address or public key "+
+			"matches an entry, even if they're on the peer-allowlist.")
+	cmd.PersistentFlags().StringSlice("peer-rate-limits", []string{},
+		"A comma-separated list of per-peer budgets for expensive requests, each formatted as "+
+			"<MESSAGE_TYPE>:<requests per second>:<burst>, e.g. GET_SNAPSHOT:20:100. GET_SNAPSHOT, "+
+			"GET_BLOCKS, and GET_HEADERS can be limited, and GET_BLOCKS budgets count blocks rather than "+
+			"messages. Message types that aren't listed keep their default budgets, and a rate of 0 "+
+			"removes the limit.")
+	cmd.PersistentFlags().Uint64("peer-rate-limit-max-violations", lib.DefaultPeerRateLimitMaxViolations,
+		"The number of requests over budget, in a row, the node drops before disconnecting the peer.")
 
 	cmd.PersistentFlags().Uint64("peer-connection-refresh-interval-millis", 10000,
 		"The frequency in milliseconds with which the node will refresh its peer connections. This applies to"+
@@ -231,6 +257,175 @@ func SetupRunFlags(cmd *cobra.Command) {
 		"supports the committed tip block info endpoint to be used for checkpoint syncing. "+
 		"If unset, the field will default to %v on mainnet and %v on testnet",
 		lib.DefaultMainnetCheckpointProvider, lib.DefaultTestnetCheckpointProvider))
+
+	// Telemetry
+	cmd.PersistentFlags().StringSlice("telemetry-collector-urls", []string{}, "Opt-in: a comma-separated list "+
+		"of telemetry collector URLs. When set, the node periodically publishes anonymized stats (version, sync "+
+		"height, peer count) to each collector and logs the aggregate network health they report. Unset by default.")
+	cmd.PersistentFlags().Uint64("telemetry-interval-seconds", lib.DefaultTelemetryIntervalSeconds,
+		"How often to publish telemetry when telemetry-collector-urls is set.")
+
+	// Notification Server
+	cmd.PersistentFlags().String("notification-server-listen-address", "", "When set, the node serves "+
+		"a stream of notifications for new block headers, chain reorgs, committed blocks, and mempool txn "+
+		"hashes on this address, e.g. 127.0.0.1:17002, so that services don't have to poll the node. "+
+		"Subscribers connect with a GET on "+lib.RoutePathNotifications+" and get server-sent events.")
+	cmd.PersistentFlags().Int("notification-server-buffer-size", lib.DefaultNotificationSubscriptionBufferSize,
+		"The number of notifications a subscriber can fall behind by before it's disconnected. Used with "+
+			"--notification-server-listen-address.")
+
+	// Fork Backups
+	cmd.PersistentFlags().String("fork-backup-dir", "", "When set, the node backs up its db to this "+
+		"directory shortly before each scheduled fork height, so it can be rolled back if the upgrade misbehaves.")
+	cmd.PersistentFlags().Uint64("fork-backup-blocks-before-fork", lib.DefaultForkBackupBlocksBeforeFork,
+		"How many blocks before a fork height to take the pre-fork backup.")
+	cmd.PersistentFlags().Int("fork-backup-retention", lib.DefaultForkBackupRetention,
+		"The number of pre-fork backups to keep.")
+
+	// Relay Policy
+	cmd.PersistentFlags().StringSlice("relay-policy-denied-public-keys", []string{}, "Operator policy, "+
+		"not a consensus rule: a comma-separated list of public keys. The node refuses to relay or add to its "+
+		"mempool any txn that touches one of them, and leaves such txns out of the blocks it produces. Blocks "+
+		"produced by other nodes are still accepted.")
+	cmd.PersistentFlags().String("relay-policy-denied-public-keys-file", "", "A file listing additional "+
+		"public keys for relay-policy-denied-public-keys, one per line. Lines starting with # are ignored.")
+
+	// Block Assembly Policy
+	cmd.PersistentFlags().StringSlice("block-assembly-lanes", []string{}, "Operator policy, not a "+
+		"consensus rule: a comma-separated list of lanes of the form TXN_TYPE|TXN_TYPE:RESERVED_BASIS_POINTS, "+
+		"e.g. AUTHORIZE_DERIVED_KEY|UPDATE_GLOBAL_PARAMS:500. The blocks this node produces put the txns of a "+
+		"lane's types first until they fill the lane's share of the block, so they aren't crowded out by "+
+		"other txns. Unused reserved space goes to other txns.")
+
+	// DAO Coin Candles
+	cmd.PersistentFlags().Bool("dao-coin-candle-index", false, "When set, the node indexes every DAO coin "+
+		"limit order fill in committed blocks and aggregates the fills into OHLCV candles per coin pair for "+
+		"charting. Only blocks committed while the index is enabled are indexed.")
+
+	// DESO Balance History
+	cmd.PersistentFlags().Bool("deso-balance-history-index", false, "When set, the node records every "+
+		"change to a public key's DESO balance in committed blocks, along with the resulting balance, so "+
+		"balance histories can be exported without replaying the chain. Only blocks committed while the "+
+		"index is enabled are indexed. Not supported with Postgres.")
+
+	// Emission
+	cmd.PersistentFlags().Bool("emission-index", false, "When set, the node records the PoS staking "+
+		"rewards, creator coin founder rewards, and burns of every committed block, so the emission "+
+		"schedule can report them per interval. Only blocks committed while the index is enabled are "+
+		"indexed. Not supported with Postgres.")
+
+	// Txn Labels
+	cmd.PersistentFlags().Bool("txn-label-store", false, "When set, the node keeps a local store of labels, "+
+		"memos and categories for txns in its data directory, which operator tooling can read, write, export "+
+		"and import. The labels are never shared with other nodes.")
+
+	// Block Index Cache
+	cmd.PersistentFlags().Bool("block-index-cache", false, "When set, the node saves its block index to the db "+
+		"when it shuts down cleanly, so that the next start can load it in one pass instead of re-reading every "+
+		"block node. Block nodes stored after the save are journaled, so the saved index is still used after an "+
+		"unclean shutdown. It's only used if it matches its checksum and the db's best hash and number of block "+
+		"nodes.")
+
+	// State Attestations
+	cmd.PersistentFlags().String("state-attestation-seed", "", "When set, the node can sign attestations "+
+		"of its state checksum and of selected account records with the key derived from this seed, so that "+
+		"third parties can check them against the operator's public key. Can be a seed phrase or a hex "+
+		"private key prefixed with 0x. Requires hypersync or an archival node.")
+
+	// Mempool Sync
+	cmd.PersistentFlags().Bool("mempool-sync-on-connect", false, "When set, the node sends each peer it "+
+		"connects to a compact list of the txns already in its mempool, and the peer replies with invs for "+
+		"the txns in its own mempool that are missing from the list. This repopulates the mempool right "+
+		"after a restart instead of waiting for new txns to be relayed. Peers that don't support it are sent "+
+		"the usual mempool request. Only nodes that set this answer their peers' mempool sync requests.")
+
+	// Mempool Replace By Fee
+	cmd.PersistentFlags().Bool("mempool-replace-by-fee", false, "When set, a txn that spends the same "+
+		"inputs as a txn in the PoW mempool, or has the same transactor and nonce, replaces it if it pays a "+
+		"higher fee rate, so users can bump the fee of a stuck txn. The txns that depended on the replaced txn "+
+		"are evicted with it. The PoS mempool always allows such replacements.")
+	cmd.PersistentFlags().Uint64("mempool-replace-by-fee-min-fee-rate-increase-basis-points", 1000,
+		"How much higher than the fee rate of the txn it replaces a replacement's fee rate has to be, in "+
+			"basis points. Used with --mempool-replace-by-fee.")
+	cmd.PersistentFlags().Uint64("mempool-replace-by-fee-max-evicted-txns", 100, "The max number of "+
+		"txns a replacement can evict from the mempool, including the txns that depended on the txns it "+
+		"replaces. Zero means there's no max. Used with --mempool-replace-by-fee.")
+
+	// Mempool Journal
+	cmd.PersistentFlags().String("mempool-journal-file", "", "When set, every txn accepted by the PoW "+
+		"mempool is appended to this file, and the txns in it are replayed into the mempool on startup so "+
+		"that unconfirmed txns survive a restart. Corrupted records are skipped.")
+
+	// Mempool Metrics
+	cmd.PersistentFlags().Bool("mempool-metrics-expvar", false, "When set, the PoW mempool's metrics, "+
+		"including its size, txn counts by type, min fee rate, and counts of rejected and evicted txns by "+
+		"reason, are published through expvar as deso_mempool. They're served on /debug/vars by any HTTP "+
+		"server in the process that uses http.DefaultServeMux.")
+
+	// UtxoView Change Log
+	cmd.PersistentFlags().String("utxo-view-change-log-file", "", "When set, the keys set and deleted by "+
+		"every UtxoView flush, along with the values they were set to, are appended to this file in order, one "+
+		"batch per flush, so that services can tail the node's state changes instead of running a node with "+
+		"Postgres. Not supported with Postgres.")
+
+	// Storage Backend
+	cmd.PersistentFlags().String("storage-backend", "", "When set, entries that aren't in the UtxoView are "+
+		"read from the storage backend registered under this name instead of from badger or Postgres. The "+
+		"backend must be registered with lib.RegisterStorageBackend by a package linked into the node.")
+	cmd.PersistentFlags().String("storage-backend-options", "", "Options passed to the storage backend "+
+		"set with --storage-backend, e.g. a connection string.")
+
+	// UtxoOps Pruning
+	cmd.PersistentFlags().String("prune-mode", string(lib.PruneModeNone), "What the node keeps of the blocks "+
+		"below --utxo-ops-prune-depth. none: every block's UtxoOperations are kept. pruned: the UtxoOperations "+
+		"of those blocks are deleted, which drops the spent UTXOs they hold and saves a lot of disk on nodes "+
+		"that have synced from genesis. Blocks and the current state are kept, but the node can't reorg more "+
+		"blocks than the depth. archive: a read-only archive node that prunes like pruned, but requires an "+
+		"archival --sync-type and can't mine or validate blocks. Once a node has pruned, it can't go back to none.")
+	cmd.PersistentFlags().Uint64("utxo-ops-prune-depth", 0, "The number of blocks below the tip whose "+
+		"UtxoOperations are kept when --prune-mode is pruned or archive. Must be at least 100.")
+
+	// Mempool Decisions
+	cmd.PersistentFlags().String("mempool-decision-log-file", "", "Debug only. When set, every mempool "+
+		"acceptance decision is appended to this file along with the inputs needed to reproduce it.")
+	cmd.PersistentFlags().String("mempool-decision-replay-file", "", "When set, the decisions recorded in "+
+		"this file by --mempool-decision-log-file are replayed against this version's mempool at startup, and "+
+		"every txn that's decided differently is logged. Run it on a node synced to the height the decisions "+
+		"were recorded at to validate relay policy changes before deploying them.")
+
+	// Invariant Checker
+	cmd.PersistentFlags().Bool("invariant-checker", false, "When set, the node continuously checks that "+
+		"state entries maintained separately still agree, e.g. coin supplies against balances, and logs an "+
+		"alert for every violation it finds. Not supported with Postgres.")
+	cmd.PersistentFlags().Uint64("invariant-checker-interval-seconds", lib.DefaultInvariantCheckerIntervalSeconds,
+		"How often the invariant checker checks its next batch of entries.")
+	cmd.PersistentFlags().Uint64("invariant-checker-batch-size", lib.DefaultInvariantCheckerBatchSize,
+		"The number of entries the invariant checker checks per invariant in each batch.")
+	cmd.PersistentFlags().StringSlice("invariant-checker-alert-urls", []string{}, "A comma-separated list of "+
+		"URLs the invariant checker POSTs each violation to as JSON, in addition to logging it.")
+
+	// NFT Bid Archive
+	cmd.PersistentFlags().Uint64("nft-bid-archive-depth", 0, "When set, the bids on an NFT are archived "+
+		"when it's sold so that past bids can be looked up, keeping at most this many bids per NFT. Only "+
+		"sales connected while the archive is enabled are archived. Zero disables the archive.")
+
+	// Snapshot Publisher
+	cmd.PersistentFlags().String("snapshot-publisher-endpoint", "", "When set, the node uploads the chunks "+
+		"and a manifest of each snapshot epoch it completes to this S3-compatible storage endpoint, e.g. "+
+		"https://s3.us-east-1.amazonaws.com, so that other nodes can hypersync from it. Requires hypersync "+
+		"or an archival node.")
+	cmd.PersistentFlags().String("snapshot-publisher-region", "us-east-1", "The region requests to "+
+		"the snapshot publisher endpoint are signed for.")
+	cmd.PersistentFlags().String("snapshot-publisher-bucket", "", "The bucket snapshots are published to.")
+	cmd.PersistentFlags().String("snapshot-publisher-key-prefix", "", "The prefix of the keys of the "+
+		"objects snapshots are published to.")
+	cmd.PersistentFlags().String("snapshot-publisher-access-key-id", "", "The access key ID for the "+
+		"snapshot publisher endpoint.")
+	cmd.PersistentFlags().String("snapshot-publisher-secret-access-key", "", "The secret access key for the "+
+		"snapshot publisher endpoint. Prefer setting it with the SNAPSHOT_PUBLISHER_SECRET_ACCESS_KEY "+
+		"environment variable.")
+	cmd.PersistentFlags().Uint64("snapshot-publisher-interval-seconds", lib.DefaultSnapshotPublisherIntervalSeconds,
+		"How often the snapshot publisher checks whether the node has completed a new snapshot epoch.")
 	cmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
 		viper.BindPFlag(flag.Name, flag)
 	})
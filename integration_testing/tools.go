@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package integration_testing
 
 import (
@@ -95,6 +97,9 @@ func _generateConfig(t *testing.T, config *cmd.Config, port uint32, dataDir stri
 	config.SnapshotBlockHeightPeriod = HyperSyncSnapshotPeriod
 	config.MaxSyncBlockHeight = MaxSyncBlockHeight
 	config.SyncType = lib.NodeSyncTypeBlockSync
+	config.PruneMode = lib.PruneModeNone
+	config.HypersyncMaxPeers = lib.DefaultHyperSyncMaxPeers
+	config.HypersyncMaxRequestsPerPeer = lib.DefaultHyperSyncMaxRequestsPerPeer
 	config.MempoolBackupIntervalMillis = 30000
 	config.MempoolMaxValidationViewConnects = 10000
 	config.TransactionValidationRefreshIntervalMillis = 10
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Accounts without a profile have no username, so query results can only identify them by
+// their public key. The helpers below derive a short fingerprint and a readable placeholder
+// handle from a public key so that every consumer of the library renders these accounts the
+// same way. Both are derived from the SHA-256 of the compressed public key, so they don't
+// change with the network the key is encoded for.
+//
+// Placeholder handles contain hyphens, which UsernameRegex doesn't allow, so a placeholder
+// can never be mistaken for a registered username.
+
+// PublicKeyFingerprintLenBytes is the number of bytes of the public key's hash a fingerprint
+// shows.
+const PublicKeyFingerprintLenBytes = 4
+
+var pseudonymousHandleAdjectives = [64]string{
+	"amber", "ancient", "azure", "bold", "brave", "bright", "calm", "clever",
+	"cobalt", "cosmic", "crimson", "crisp", "curious", "daring", "dawn", "deep",
+	"eager", "early", "electric", "emerald", "fabled", "fierce", "gentle", "gilded",
+	"golden", "hidden", "hollow", "humble", "icy", "indigo", "ivory", "jade",
+	"jolly", "keen", "lively", "lucky", "lunar", "misty", "mellow", "noble",
+	"olive", "onyx", "polar", "proud", "quiet", "rapid", "rustic", "scarlet",
+	"silent", "silver", "sleek", "solar", "stellar", "stormy", "sunny", "swift",
+	"tidal", "twilight", "velvet", "vivid", "wandering", "wild", "windy", "zesty",
+}
+
+var pseudonymousHandleNouns = [64]string{
+	"badger", "bear", "beacon", "bison", "canyon", "cedar", "comet", "condor",
+	"coral", "crane", "delta", "dolphin", "eagle", "ember", "falcon", "fern",
+	"finch", "fjord", "fox", "glacier", "grove", "harbor", "hawk", "heron",
+	"ibis", "island", "jaguar", "kestrel", "koala", "lagoon", "lark", "lynx",
+	"maple", "meadow", "mesa", "moose", "nebula", "oak", "orca", "otter",
+	"owl", "panda", "pebble", "pine", "prairie", "quail", "raven", "reef",
+	"ridge", "river", "sparrow", "spruce", "summit", "swan", "thicket", "tiger",
+	"tundra", "valley", "walrus", "willow", "wolf", "wren", "yak", "zephyr",
+}
+
+// PublicKeyFingerprint returns a short hex fingerprint of the public key, e.g. "3f9c01ab".
+func PublicKeyFingerprint(publicKey []byte) string {
+	publicKeyHash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(publicKeyHash[:PublicKeyFingerprintLenBytes])
+}
+
+// PseudonymousHandleForPublicKey returns a placeholder handle for the public key of the form
+// adjective-noun-xxxx, e.g. "amber-falcon-3f9c", where xxxx is the start of the key's
+// fingerprint. The words and the fingerprint come from different bytes of the key's hash.
+func PseudonymousHandleForPublicKey(publicKey []byte) string {
+	publicKeyHash := sha256.Sum256(publicKey)
+	adjective := pseudonymousHandleAdjectives[publicKeyHash[PublicKeyFingerprintLenBytes]%64]
+	noun := pseudonymousHandleNouns[publicKeyHash[PublicKeyFingerprintLenBytes+1]%64]
+	return fmt.Sprintf("%s-%s-%s", adjective, noun, hex.EncodeToString(publicKeyHash[:2]))
+}
+
+// GetDisplayHandleForPublicKey returns the username of the public key's profile, or its
+// placeholder handle if it has no profile or its profile has no username.
+func (bav *UtxoView) GetDisplayHandleForPublicKey(publicKey []byte) string {
+	profileEntry := bav.GetProfileEntryForPublicKey(publicKey)
+	if profileEntry != nil && !profileEntry.isDeleted && len(profileEntry.Username) > 0 {
+		return string(profileEntry.Username)
+	}
+	return PseudonymousHandleForPublicKey(publicKey)
+}
@@ -0,0 +1,30 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPseudonymousHandleForPublicKey(t *testing.T) {
+	require := require.New(t)
+
+	publicKey, _, err := Base58CheckDecode(m0Pub)
+	require.NoError(err)
+	otherPublicKey, _, err := Base58CheckDecode(m1Pub)
+	require.NoError(err)
+
+	// Handles and fingerprints are stable and differ between keys.
+	handle := PseudonymousHandleForPublicKey(publicKey)
+	require.Equal(handle, PseudonymousHandleForPublicKey(publicKey))
+	require.NotEqual(handle, PseudonymousHandleForPublicKey(otherPublicKey))
+	fingerprint := PublicKeyFingerprint(publicKey)
+	require.Len(fingerprint, 2*PublicKeyFingerprintLenBytes)
+	require.NotEqual(fingerprint, PublicKeyFingerprint(otherPublicKey))
+
+	// A handle ends with the start of the fingerprint and can't be a username.
+	require.Equal(fingerprint[:4], handle[len(handle)-4:])
+	require.False(UsernameRegex.MatchString(handle))
+}
@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Block producers fill blocks with mempool txns in fee-time order under PoS and in the order
+// they were added under PoW. During a spike in trading, DAO coin limit orders can fill every
+// block, and txns that keep the network running, like AuthorizeDerivedKey or
+// UpdateGlobalParams, wait until the spike is over.
+//
+// A BlockAssemblyPolicy lets an operator reserve part of each block this node produces for
+// lanes of txn types. The txns in a lane are moved to the front of the block, in their usual
+// order and along with the txns they depend on, until they fill the lane's reservation. Any that don't fit compete for the rest of
+// the block as usual, and space a lane doesn't use goes to other txns.
+//
+// Like the RelayPolicy, the policy is NOT a consensus rule. It only changes which valid txns
+// this node puts in the blocks it produces.
+
+// BlockAssemblyLane reserves part of each block for txns of the lane's types.
+type BlockAssemblyLane struct {
+	TxnTypes []TxnType
+	// ReservedBasisPoints is the part of the block's max size reserved for the lane.
+	ReservedBasisPoints uint64
+}
+
+func (lane *BlockAssemblyLane) String() string {
+	txnTypeStrings := make([]string, 0, len(lane.TxnTypes))
+	for _, txnType := range lane.TxnTypes {
+		txnTypeStrings = append(txnTypeStrings, txnType.String())
+	}
+	return fmt.Sprintf("%s:%d", strings.Join(txnTypeStrings, "|"), lane.ReservedBasisPoints)
+}
+
+// ParseBlockAssemblyLane parses a lane of the form TXN_TYPE|TXN_TYPE:RESERVED_BASIS_POINTS,
+// e.g. AUTHORIZE_DERIVED_KEY|UPDATE_GLOBAL_PARAMS:500.
+func ParseBlockAssemblyLane(laneString string) (*BlockAssemblyLane, error) {
+	txnTypesString, reservedString, found := strings.Cut(strings.TrimSpace(laneString), ":")
+	if !found {
+		return nil, fmt.Errorf("ParseBlockAssemblyLane: Lane %v is missing its reserved basis points", laneString)
+	}
+	reservedBasisPoints, err := strconv.ParseUint(reservedString, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ParseBlockAssemblyLane: Problem parsing reserved basis points of lane %v: ",
+			laneString)
+	}
+	lane := &BlockAssemblyLane{ReservedBasisPoints: reservedBasisPoints}
+	for _, txnTypeString := range strings.Split(txnTypesString, "|") {
+		txnType := GetTxnTypeFromString(TxnString(strings.TrimSpace(txnTypeString)))
+		if txnType == TxnTypeUnset {
+			return nil, fmt.Errorf("ParseBlockAssemblyLane: Unknown txn type %v in lane %v", txnTypeString, laneString)
+		}
+		lane.TxnTypes = append(lane.TxnTypes, txnType)
+	}
+	return lane, nil
+}
+
+// BlockAssemblyPolicyStats are the counters a BlockAssemblyPolicy exposes.
+type BlockAssemblyPolicyStats struct {
+	NumLanes uint64
+	// The number of txns that were moved to the front of a block by a lane, including the
+	// txns they depend on.
+	NumTxnsPrioritized uint64
+}
+
+type BlockAssemblyPolicy struct {
+	mtx   sync.RWMutex
+	lanes []*BlockAssemblyLane
+	// laneIndexByTxnType maps each txn type in a lane to the lane's index.
+	laneIndexByTxnType map[TxnType]int
+
+	numTxnsPrioritized uint64
+}
+
+// NewBlockAssemblyPolicy returns a policy without any lanes, which leaves the order of txns
+// in a block as it is.
+func NewBlockAssemblyPolicy() *BlockAssemblyPolicy {
+	return &BlockAssemblyPolicy{
+		laneIndexByTxnType: make(map[TxnType]int),
+	}
+}
+
+// SetLanes replaces the policy's lanes. A txn type can only be in one lane, and the lanes
+// can't reserve more than the whole block. The lanes can be replaced while the node is
+// running, and apply to blocks produced from then on.
+func (policy *BlockAssemblyPolicy) SetLanes(lanes []*BlockAssemblyLane) error {
+	laneIndexByTxnType := make(map[TxnType]int)
+	totalReservedBasisPoints := uint64(0)
+	for ii, lane := range lanes {
+		if len(lane.TxnTypes) == 0 {
+			return fmt.Errorf("BlockAssemblyPolicy.SetLanes: Lane %d has no txn types", ii)
+		}
+		for _, txnType := range lane.TxnTypes {
+			if txnType == TxnTypeBlockReward {
+				return fmt.Errorf("BlockAssemblyPolicy.SetLanes: Lane %d can't contain %v", ii, txnType)
+			}
+			if _, exists := laneIndexByTxnType[txnType]; exists {
+				return fmt.Errorf("BlockAssemblyPolicy.SetLanes: Txn type %v is in more than one lane", txnType)
+			}
+			laneIndexByTxnType[txnType] = ii
+		}
+		totalReservedBasisPoints += lane.ReservedBasisPoints
+		if totalReservedBasisPoints > MaxBasisPoints {
+			return fmt.Errorf("BlockAssemblyPolicy.SetLanes: Lanes reserve more than %d basis points",
+				MaxBasisPoints)
+		}
+	}
+
+	policy.mtx.Lock()
+	defer policy.mtx.Unlock()
+	policy.lanes = lanes
+	policy.laneIndexByTxnType = laneIndexByTxnType
+	for _, lane := range lanes {
+		glog.Infof("BlockAssemblyPolicy.SetLanes: Reserving block space for lane %v", lane)
+	}
+	return nil
+}
+
+func (policy *BlockAssemblyPolicy) GetLanes() []*BlockAssemblyLane {
+	policy.mtx.RLock()
+	defer policy.mtx.RUnlock()
+
+	return policy.lanes
+}
+
+// OrderTxnsForBlock returns the txns in the order a block producer should try to add them
+// to a block with the given max size: the txns that fit in their lane's reservation first,
+// then the rest. Both groups keep the order the txns were passed in. A lane txn is moved
+// along with the earlier txns it depends on, so it's only moved if they all fit in the
+// lane's reservation together. A nil policy leaves the order as it is.
+func (policy *BlockAssemblyPolicy) OrderTxnsForBlock(txns []*MempoolTx, maxBlockSizeBytes uint64) []*MempoolTx {
+	if policy == nil {
+		return txns
+	}
+	policy.mtx.RLock()
+	defer policy.mtx.RUnlock()
+
+	if len(policy.lanes) == 0 {
+		return txns
+	}
+
+	remainingLaneBytes := make([]uint64, len(policy.lanes))
+	for ii, lane := range policy.lanes {
+		remainingLaneBytes[ii] = maxBlockSizeBytes * lane.ReservedBasisPoints / MaxBasisPoints
+	}
+	parentIndexes := getMempoolTxParentIndexes(txns)
+	isPrioritized := make([]bool, len(txns))
+	prioritizedTxns := []*MempoolTx{}
+	for ii, mempoolTx := range txns {
+		laneIndex, inLane := policy.laneIndexByTxnType[mempoolTx.Tx.TxnMeta.GetTxnType()]
+		if !inLane {
+			continue
+		}
+		// The txn is moved along with every earlier txn it depends on that isn't moved yet.
+		txnIndexes := getUnprioritizedAncestorIndexes(ii, parentIndexes, isPrioritized)
+		txnsSizeBytes := uint64(0)
+		for _, txnIndex := range txnIndexes {
+			txnsSizeBytes += txns[txnIndex].TxSizeBytes
+		}
+		if txnsSizeBytes > remainingLaneBytes[laneIndex] {
+			continue
+		}
+		remainingLaneBytes[laneIndex] -= txnsSizeBytes
+		for _, txnIndex := range txnIndexes {
+			isPrioritized[txnIndex] = true
+			prioritizedTxns = append(prioritizedTxns, txns[txnIndex])
+		}
+	}
+	orderedTxns := make([]*MempoolTx, 0, len(txns))
+	orderedTxns = append(orderedTxns, prioritizedTxns...)
+	for ii, mempoolTx := range txns {
+		if !isPrioritized[ii] {
+			orderedTxns = append(orderedTxns, mempoolTx)
+		}
+	}
+	atomic.AddUint64(&policy.numTxnsPrioritized, uint64(len(prioritizedTxns)))
+	return orderedTxns
+}
+
+// getMempoolTxParentIndexes returns, for every txn, the indexes of the earlier txns it depends
+// on directly: the txns whose outputs it spends, and the last txn before it with the same
+// transactor, since its balance and nonces may depend on that txn.
+func getMempoolTxParentIndexes(txns []*MempoolTx) [][]int {
+	indexByHash := make(map[BlockHash]int, len(txns))
+	lastIndexByPublicKey := make(map[PkMapKey]int)
+	parentIndexes := make([][]int, len(txns))
+	for ii, mempoolTx := range txns {
+		for _, txInput := range mempoolTx.Tx.TxInputs {
+			if parentIndex, exists := indexByHash[txInput.TxID]; exists {
+				parentIndexes[ii] = append(parentIndexes[ii], parentIndex)
+			}
+		}
+		publicKey := MakePkMapKey(mempoolTx.Tx.PublicKey)
+		if parentIndex, exists := lastIndexByPublicKey[publicKey]; exists {
+			parentIndexes[ii] = append(parentIndexes[ii], parentIndex)
+		}
+		lastIndexByPublicKey[publicKey] = ii
+
+		txnHash := mempoolTx.Hash
+		if txnHash == nil {
+			txnHash = mempoolTx.Tx.Hash()
+		}
+		if txnHash != nil {
+			indexByHash[*txnHash] = ii
+		}
+	}
+	return parentIndexes
+}
+
+// getUnprioritizedAncestorIndexes returns the index of the txn and the indexes of all the
+// earlier txns it depends on, directly or not, that aren't prioritized yet, in order.
+func getUnprioritizedAncestorIndexes(txnIndex int, parentIndexes [][]int, isPrioritized []bool) []int {
+	isAncestor := map[int]bool{txnIndex: true}
+	ancestorIndexes := []int{txnIndex}
+	for ii := 0; ii < len(ancestorIndexes); ii++ {
+		for _, parentIndex := range parentIndexes[ancestorIndexes[ii]] {
+			if isPrioritized[parentIndex] || isAncestor[parentIndex] {
+				continue
+			}
+			isAncestor[parentIndex] = true
+			ancestorIndexes = append(ancestorIndexes, parentIndex)
+		}
+	}
+	sort.Ints(ancestorIndexes)
+	return ancestorIndexes
+}
+
+func (policy *BlockAssemblyPolicy) GetStats() *BlockAssemblyPolicyStats {
+	policy.mtx.RLock()
+	defer policy.mtx.RUnlock()
+
+	return &BlockAssemblyPolicyStats{
+		NumLanes:           uint64(len(policy.lanes)),
+		NumTxnsPrioritized: atomic.LoadUint64(&policy.numTxnsPrioritized),
+	}
+}
@@ -0,0 +1,104 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockAssemblyPolicyOrderTxnsForBlock(t *testing.T) {
+	require := require.New(t)
+
+	newMempoolTx := func(publicKey []byte, txnMeta DeSoTxnMetadata, sizeBytes uint64, inputs ...*BlockHash) *MempoolTx {
+		txn := &MsgDeSoTxn{PublicKey: publicKey, TxnMeta: txnMeta}
+		for _, input := range inputs {
+			txn.TxInputs = append(txn.TxInputs, &DeSoInput{TxID: *input, Index: 0})
+		}
+		return &MempoolTx{Tx: txn, Hash: NewBlockHash(RandomBytes(HashSizeBytes)), TxSizeBytes: sizeBytes}
+	}
+	requireOrder := func(orderedTxns []*MempoolTx, expectedTxns ...*MempoolTx) {
+		require.Len(orderedTxns, len(expectedTxns))
+		for ii := range expectedTxns {
+			require.Same(expectedTxns[ii], orderedTxns[ii], "txn %d", ii)
+		}
+	}
+	maxBlockSizeBytes := uint64(10000)
+
+	// A nil policy and a policy without lanes leave the order as it is.
+	basicTransfer := newMempoolTx(m0PkBytes, &BasicTransferMetadata{}, 400)
+	authorize := newMempoolTx(m1PkBytes, &AuthorizeDerivedKeyMetadata{}, 600)
+	var nilPolicy *BlockAssemblyPolicy
+	requireOrder(nilPolicy.OrderTxnsForBlock([]*MempoolTx{basicTransfer, authorize}, maxBlockSizeBytes),
+		basicTransfer, authorize)
+	policy := NewBlockAssemblyPolicy()
+	requireOrder(policy.OrderTxnsForBlock([]*MempoolTx{basicTransfer, authorize}, maxBlockSizeBytes),
+		basicTransfer, authorize)
+
+	// Lanes can't share a txn type, contain block rewards, or reserve more than the whole block.
+	require.Error(policy.SetLanes([]*BlockAssemblyLane{
+		{TxnTypes: []TxnType{TxnTypeAuthorizeDerivedKey}, ReservedBasisPoints: 500},
+		{TxnTypes: []TxnType{TxnTypeAuthorizeDerivedKey}, ReservedBasisPoints: 500},
+	}))
+	require.Error(policy.SetLanes([]*BlockAssemblyLane{
+		{TxnTypes: []TxnType{TxnTypeBlockReward}, ReservedBasisPoints: 500},
+	}))
+	require.Error(policy.SetLanes([]*BlockAssemblyLane{
+		{TxnTypes: []TxnType{TxnTypeAuthorizeDerivedKey}, ReservedBasisPoints: 6000},
+		{TxnTypes: []TxnType{TxnTypeUpdateGlobalParams}, ReservedBasisPoints: 5000},
+	}))
+
+	// The lane reserves 10% of the block, i.e. 1000 bytes. The first two derived key txns fit
+	// in it and the third doesn't, so it keeps its place.
+	lane, err := ParseBlockAssemblyLane("AUTHORIZE_DERIVED_KEY|UPDATE_GLOBAL_PARAMS:1000")
+	require.NoError(err)
+	require.NoError(policy.SetLanes([]*BlockAssemblyLane{lane}))
+	secondAuthorize := newMempoolTx(m2PkBytes, &AuthorizeDerivedKeyMetadata{}, 300)
+	thirdAuthorize := newMempoolTx(m3PkBytes, &AuthorizeDerivedKeyMetadata{}, 200)
+	limitOrder := newMempoolTx(m4PkBytes, &DAOCoinLimitOrderMetadata{}, 100)
+	requireOrder(policy.OrderTxnsForBlock(
+		[]*MempoolTx{basicTransfer, authorize, secondAuthorize, thirdAuthorize, limitOrder}, maxBlockSizeBytes),
+		authorize, secondAuthorize, basicTransfer, thirdAuthorize, limitOrder)
+	require.Equal(uint64(2), policy.GetStats().NumTxnsPrioritized)
+
+	// The reservation is a share of the max block size that's passed in.
+	requireOrder(policy.OrderTxnsForBlock(
+		[]*MempoolTx{basicTransfer, authorize, secondAuthorize}, 2*maxBlockSizeBytes),
+		authorize, secondAuthorize, basicTransfer)
+	requireOrder(policy.OrderTxnsForBlock(
+		[]*MempoolTx{basicTransfer, authorize, secondAuthorize}, maxBlockSizeBytes/2),
+		secondAuthorize, basicTransfer, authorize)
+	require.Equal(uint64(5), policy.GetStats().NumTxnsPrioritized)
+
+	// A lane txn that spends an earlier txn's output is moved along with it, and so is the
+	// earlier txn's own parent.
+	fundingTransfer := newMempoolTx(m0PkBytes, &BasicTransferMetadata{}, 100)
+	spendingTransfer := newMempoolTx(m2PkBytes, &BasicTransferMetadata{}, 100, fundingTransfer.Hash)
+	dependentAuthorize := newMempoolTx(m1PkBytes, &AuthorizeDerivedKeyMetadata{}, 300, spendingTransfer.Hash)
+	requireOrder(policy.OrderTxnsForBlock(
+		[]*MempoolTx{fundingTransfer, limitOrder, spendingTransfer, dependentAuthorize}, maxBlockSizeBytes),
+		fundingTransfer, spendingTransfer, dependentAuthorize, limitOrder)
+
+	// The txns it depends on count against the lane's reservation, so if they don't fit with
+	// it, the lane txn keeps its place behind them.
+	largeFundingTransfer := newMempoolTx(m0PkBytes, &BasicTransferMetadata{}, 800)
+	dependentAuthorize = newMempoolTx(m1PkBytes, &AuthorizeDerivedKeyMetadata{}, 300, largeFundingTransfer.Hash)
+	requireOrder(policy.OrderTxnsForBlock(
+		[]*MempoolTx{largeFundingTransfer, limitOrder, dependentAuthorize}, maxBlockSizeBytes),
+		largeFundingTransfer, limitOrder, dependentAuthorize)
+
+	// A lane txn depends on the earlier txns with the same transactor.
+	sameTransactorOrder := newMempoolTx(m1PkBytes, &DAOCoinLimitOrderMetadata{}, 100)
+	sameTransactorAuthorize := newMempoolTx(m1PkBytes, &AuthorizeDerivedKeyMetadata{}, 300)
+	requireOrder(policy.OrderTxnsForBlock(
+		[]*MempoolTx{basicTransfer, sameTransactorOrder, limitOrder, sameTransactorAuthorize}, maxBlockSizeBytes),
+		sameTransactorOrder, sameTransactorAuthorize, basicTransfer, limitOrder)
+
+	// Txns that were already moved by an earlier lane txn aren't moved or counted again.
+	firstAuthorize := newMempoolTx(m1PkBytes, &AuthorizeDerivedKeyMetadata{}, 500)
+	lastAuthorize := newMempoolTx(m1PkBytes, &AuthorizeDerivedKeyMetadata{}, 500)
+	requireOrder(policy.OrderTxnsForBlock(
+		[]*MempoolTx{basicTransfer, firstAuthorize, limitOrder, lastAuthorize}, maxBlockSizeBytes),
+		firstAuthorize, lastAuthorize, basicTransfer, limitOrder)
+}
@@ -0,0 +1,400 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Reading the block index at startup means iterating over every block node in the db and
+// deserializing each one in turn, which takes minutes on a long chain. A node can instead
+// save its in-memory block index when it shuts down cleanly, as a handful of large chunks
+// that the next start reads in one pass and deserializes in parallel. The best chain is
+// then re-derived in memory by walking back from the tip, which doesn't touch the db.
+//
+// While a saved index exists, every block node that's stored or deleted is also recorded in
+// a journal, in the same txn as the block node itself. Loading the index applies the journal
+// on top of the saved chunks, so a node that crashes still starts from the saved index plus
+// the handful of block nodes that changed since, and the next clean shutdown saves a fresh
+// index and clears the journal. The loaded index is only used if the chunks match the
+// checksum they were saved with, every node's parent is in the index, the db's best hash is
+// in the index, and the index has as many nodes as the db. Anything that doesn't check out
+// is logged, the saved index is deleted, and the index is rebuilt the usual way.
+
+// BlockIndexCacheNodesPerChunk is the number of block nodes stored in each chunk of the
+// saved block index. Each chunk is deserialized in its own goroutine.
+const BlockIndexCacheNodesPerChunk = 10000
+
+// BlockIndexCacheMetadata describes the block index saved by DBPutBlockIndexCache.
+type BlockIndexCacheMetadata struct {
+	NumNodes  uint64
+	NumChunks uint64
+	// The sha256 of the chunks, in order.
+	Checksum [32]byte
+}
+
+func (metadata *BlockIndexCacheMetadata) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(metadata.NumNodes)...)
+	data = append(data, UintToBuf(metadata.NumChunks)...)
+	data = append(data, metadata.Checksum[:]...)
+	return data
+}
+
+func (metadata *BlockIndexCacheMetadata) FromBytes(rr *bytes.Reader) error {
+	var err error
+	if metadata.NumNodes, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BlockIndexCacheMetadata.FromBytes: Problem reading NumNodes: ")
+	}
+	if metadata.NumChunks, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BlockIndexCacheMetadata.FromBytes: Problem reading NumChunks: ")
+	}
+	if _, err = io.ReadFull(rr, metadata.Checksum[:]); err != nil {
+		return errors.Wrapf(err, "BlockIndexCacheMetadata.FromBytes: Problem reading Checksum: ")
+	}
+	return nil
+}
+
+func _dbKeyForBlockIndexCacheChunk(chunkIndex uint64) []byte {
+	key := append([]byte{}, Prefixes.PrefixBlockIndexCacheChunk...)
+	chunkIndexBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(chunkIndexBytes, chunkIndex)
+	return append(key, chunkIndexBytes...)
+}
+
+func _dbKeyForBlockIndexCacheJournal(height uint32, hash *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixBlockIndexCacheJournal...)
+	heightBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(heightBytes, height)
+	key = append(key, heightBytes...)
+	return append(key, hash[:]...)
+}
+
+// DBPutBlockIndexCacheJournalWithTxn records that the block node at (height, hash) was stored
+// or deleted after the cached block index was saved. It's a no-op if there's no cached index.
+func DBPutBlockIndexCacheJournalWithTxn(txn *badger.Txn, height uint32, hash *BlockHash) error {
+	_, err := txn.Get(Prefixes.PrefixBlockIndexCacheMetadata)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "DBPutBlockIndexCacheJournalWithTxn: Problem getting metadata: ")
+	}
+	return txn.Set(_dbKeyForBlockIndexCacheJournal(height, hash), []byte{})
+}
+
+// DBPutBlockIndexCache saves the block nodes as the cached block index, replacing the
+// previous one and its journal. The chunks are written before the metadata, so a save
+// that's interrupted leaves no cache.
+func DBPutBlockIndexCache(handle *badger.DB, blockNodes []*BlockNode) error {
+	if err := DBDeleteBlockIndexCache(handle); err != nil {
+		return errors.Wrapf(err, "DBPutBlockIndexCache: ")
+	}
+
+	// Order the nodes like the (height, hash) index so that parents come before children.
+	sortedBlockNodes := append([]*BlockNode{}, blockNodes...)
+	sort.Slice(sortedBlockNodes, func(ii, jj int) bool {
+		if sortedBlockNodes[ii].Height != sortedBlockNodes[jj].Height {
+			return sortedBlockNodes[ii].Height < sortedBlockNodes[jj].Height
+		}
+		return bytes.Compare(sortedBlockNodes[ii].Hash[:], sortedBlockNodes[jj].Hash[:]) < 0
+	})
+
+	checksum := sha256.New()
+	numChunks := uint64(0)
+	for start := 0; start < len(sortedBlockNodes); start += BlockIndexCacheNodesPerChunk {
+		end := start + BlockIndexCacheNodesPerChunk
+		if end > len(sortedBlockNodes) {
+			end = len(sortedBlockNodes)
+		}
+		var chunk []byte
+		chunk = append(chunk, UintToBuf(uint64(end-start))...)
+		for _, blockNode := range sortedBlockNodes[start:end] {
+			blockNodeBytes, err := SerializeBlockNode(blockNode)
+			if err != nil {
+				return errors.Wrapf(err, "DBPutBlockIndexCache: Problem serializing block node: ")
+			}
+			chunk = append(chunk, EncodeByteArray(blockNodeBytes)...)
+		}
+		checksum.Write(chunk)
+		err := handle.Update(func(txn *badger.Txn) error {
+			return txn.Set(_dbKeyForBlockIndexCacheChunk(numChunks), chunk)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "DBPutBlockIndexCache: Problem storing chunk %d: ", numChunks)
+		}
+		numChunks++
+	}
+
+	metadata := &BlockIndexCacheMetadata{
+		NumNodes:  uint64(len(sortedBlockNodes)),
+		NumChunks: numChunks,
+	}
+	copy(metadata.Checksum[:], checksum.Sum(nil))
+	return handle.Update(func(txn *badger.Txn) error {
+		return txn.Set(Prefixes.PrefixBlockIndexCacheMetadata, metadata.ToBytes())
+	})
+}
+
+// DBDeleteBlockIndexCache deletes the cached block index and its journal, if there is one.
+// The metadata is deleted first so that the cache is never read without all of its chunks,
+// and so that nothing is added to the journal while it's being deleted.
+func DBDeleteBlockIndexCache(handle *badger.DB) error {
+	err := handle.Update(func(txn *badger.Txn) error {
+		return txn.Delete(Prefixes.PrefixBlockIndexCacheMetadata)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DBDeleteBlockIndexCache: Problem deleting metadata: ")
+	}
+
+	var keys [][]byte
+	err = handle.View(func(txn *badger.Txn) error {
+		for _, prefix := range [][]byte{Prefixes.PrefixBlockIndexCacheChunk, Prefixes.PrefixBlockIndexCacheJournal} {
+			keys = append(keys, _dbKeysForBlockIndexCachePrefixWithTxn(txn, prefix)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DBDeleteBlockIndexCache: Problem finding chunks and journal: ")
+	}
+	for _, key := range keys {
+		err = handle.Update(func(txn *badger.Txn) error {
+			return txn.Delete(key)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "DBDeleteBlockIndexCache: Problem deleting key: ")
+		}
+	}
+	return nil
+}
+
+func _dbKeysForBlockIndexCachePrefixWithTxn(txn *badger.Txn, prefix []byte) [][]byte {
+	var keys [][]byte
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+	for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+		keys = append(keys, iterator.Item().KeyCopy(nil))
+	}
+	return keys
+}
+
+// DBGetBlockIndexCacheMetadata returns the metadata of the cached block index, or nil if
+// there isn't one.
+func DBGetBlockIndexCacheMetadata(handle *badger.DB) (*BlockIndexCacheMetadata, error) {
+	var metadata *BlockIndexCacheMetadata
+	err := handle.View(func(txn *badger.Txn) error {
+		metadataBytes, err := DBGetWithTxn(txn, nil, Prefixes.PrefixBlockIndexCacheMetadata)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		metadata = &BlockIndexCacheMetadata{}
+		return metadata.FromBytes(bytes.NewReader(metadataBytes))
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetBlockIndexCacheMetadata: ")
+	}
+	return metadata, nil
+}
+
+// DBCountBlockNodes returns the number of block nodes in the (height, hash) index without
+// reading any of them.
+func DBCountBlockNodes(handle *badger.DB) (uint64, error) {
+	numBlockNodes := uint64(0)
+	err := handle.View(func(txn *badger.Txn) error {
+		prefix := _heightHashToNodeIndexPrefix(false /*bitcoinNodes*/)
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			numBlockNodes++
+		}
+		return nil
+	})
+	return numBlockNodes, err
+}
+
+// LoadBlockIndexCache returns the saved block index with its journal applied, or nil if
+// there isn't one. If the saved index can't be used, it's deleted so that the next start
+// doesn't try it again.
+func LoadBlockIndexCache(handle *badger.DB, bestBlockHash *BlockHash, params *DeSoParams) (
+	map[BlockHash]*BlockNode, error) {
+
+	metadata, err := DBGetBlockIndexCacheMetadata(handle)
+	if err != nil || metadata == nil {
+		return nil, err
+	}
+	blockIndex, err := _loadBlockIndexCache(handle, metadata, bestBlockHash, params)
+	if err != nil {
+		if deleteErr := DBDeleteBlockIndexCache(handle); deleteErr != nil {
+			glog.Errorf("LoadBlockIndexCache: Problem deleting saved block index: %v", deleteErr)
+		}
+		return nil, errors.Wrapf(err, "LoadBlockIndexCache: ")
+	}
+	return blockIndex, nil
+}
+
+func _loadBlockIndexCache(handle *badger.DB, metadata *BlockIndexCacheMetadata,
+	bestBlockHash *BlockHash, params *DeSoParams) (map[BlockHash]*BlockNode, error) {
+
+	// Read the chunks, and the current version of every block node in the journal. A journaled
+	// block node that's no longer in the db was deleted after the index was saved.
+	chunks := make([][]byte, metadata.NumChunks)
+	journalBlockNodes := make(map[BlockHash]*BlockNode)
+	err := handle.View(func(txn *badger.Txn) error {
+		for ii := range chunks {
+			chunk, err := DBGetWithTxn(txn, nil, _dbKeyForBlockIndexCacheChunk(uint64(ii)))
+			if err != nil {
+				return errors.Wrapf(err, "Problem getting chunk %d: ", ii)
+			}
+			chunks[ii] = chunk
+		}
+		prefixLen := len(Prefixes.PrefixBlockIndexCacheJournal)
+		for _, journalKey := range _dbKeysForBlockIndexCachePrefixWithTxn(txn, Prefixes.PrefixBlockIndexCacheJournal) {
+			if len(journalKey) != prefixLen+4+HashSizeBytes {
+				return fmt.Errorf("Invalid journal key length %d", len(journalKey))
+			}
+			height := binary.BigEndian.Uint32(journalKey[prefixLen : prefixLen+4])
+			hash := NewBlockHash(journalKey[prefixLen+4:])
+			blockNodeBytes, err := DBGetWithTxn(txn, nil, _heightHashToNodeIndexKey(height, hash, false /*bitcoinNodes*/))
+			if err == badger.ErrKeyNotFound {
+				journalBlockNodes[*hash] = nil
+				continue
+			} else if err != nil {
+				return errors.Wrapf(err, "Problem getting journaled block node %v: ", hash)
+			}
+			if journalBlockNodes[*hash], err = DeserializeBlockNode(blockNodeBytes); err != nil {
+				return errors.Wrapf(err, "Problem deserializing journaled block node %v: ", hash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.New()
+	for _, chunk := range chunks {
+		checksum.Write(chunk)
+	}
+	if !bytes.Equal(checksum.Sum(nil), metadata.Checksum[:]) {
+		return nil, fmt.Errorf("Chunks don't match the saved checksum")
+	}
+
+	// Deserialize the chunks in parallel.
+	blockNodesByChunk := make([][]*BlockNode, len(chunks))
+	chunkErrs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	for ii := range chunks {
+		wg.Add(1)
+		go func(chunkIndex int) {
+			defer wg.Done()
+			blockNodesByChunk[chunkIndex], chunkErrs[chunkIndex] = _deserializeBlockIndexCacheChunk(chunks[chunkIndex])
+		}(ii)
+	}
+	wg.Wait()
+
+	blockIndex := make(map[BlockHash]*BlockNode, metadata.NumNodes)
+	for ii, blockNodes := range blockNodesByChunk {
+		if chunkErrs[ii] != nil {
+			return nil, errors.Wrapf(chunkErrs[ii], "Chunk %d: ", ii)
+		}
+		for _, blockNode := range blockNodes {
+			blockIndex[*blockNode.Hash] = blockNode
+		}
+	}
+	if uint64(len(blockIndex)) != metadata.NumNodes {
+		return nil, fmt.Errorf("Expected %d block nodes but read %d", metadata.NumNodes, len(blockIndex))
+	}
+
+	// Apply the journal, then link every node to its parent the same way GetBlockIndex does.
+	for hash, blockNode := range journalBlockNodes {
+		if blockNode == nil {
+			delete(blockIndex, hash)
+		} else {
+			blockIndex[hash] = blockNode
+		}
+	}
+	for _, blockNode := range blockIndex {
+		if blockNode.Height == 0 || (*blockNode.Header.PrevBlockHash == BlockHash{}) {
+			continue
+		}
+		if parent, ok := blockIndex[*blockNode.Header.PrevBlockHash]; ok {
+			blockNode.Parent = parent
+		} else if !params.IsPoSBlockHeight(uint64(blockNode.Height)) {
+			return nil, fmt.Errorf("Could not find parent for blockNode: %+v", blockNode)
+		}
+	}
+
+	if bestBlockHash == nil || blockIndex[*bestBlockHash] == nil {
+		return nil, fmt.Errorf("Best hash %v isn't in the saved index", bestBlockHash)
+	}
+	numBlockNodes, err := DBCountBlockNodes(handle)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem counting block nodes: ")
+	}
+	if numBlockNodes != uint64(len(blockIndex)) {
+		return nil, fmt.Errorf("Loaded %d block nodes but the db has %d", len(blockIndex), numBlockNodes)
+	}
+	glog.Infof("LoadBlockIndexCache: Loaded %d block nodes from the saved block index after applying "+
+		"%d journaled changes", len(blockIndex), len(journalBlockNodes))
+	return blockIndex, nil
+}
+
+func _deserializeBlockIndexCacheChunk(chunk []byte) ([]*BlockNode, error) {
+	rr := bytes.NewReader(chunk)
+	numBlockNodes, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem reading number of block nodes: ")
+	}
+	if numBlockNodes > BlockIndexCacheNodesPerChunk {
+		return nil, fmt.Errorf("Chunk has %d block nodes, more than %d",
+			numBlockNodes, BlockIndexCacheNodesPerChunk)
+	}
+	blockNodes := make([]*BlockNode, 0, numBlockNodes)
+	for ii := uint64(0); ii < numBlockNodes; ii++ {
+		blockNodeBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Problem reading block node %d: ", ii)
+		}
+		blockNode, err := DeserializeBlockNode(blockNodeBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Problem deserializing block node %d: ", ii)
+		}
+		blockNodes = append(blockNodes, blockNode)
+	}
+	return blockNodes, nil
+}
+
+// SaveBlockIndexCache saves the block index so that the next start can load it quickly.
+// It should only be called once the node has stopped processing blocks, since block nodes
+// stored while the index is being saved aren't journaled.
+func (bc *Blockchain) SaveBlockIndexCache() error {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	if bc.postgres != nil {
+		return fmt.Errorf("SaveBlockIndexCache: The block index isn't cached for postgres nodes")
+	}
+	blockNodes := make([]*BlockNode, 0, len(bc.blockIndexByHash))
+	for _, blockNode := range bc.blockIndexByHash {
+		blockNodes = append(blockNodes, blockNode)
+	}
+	if err := DBPutBlockIndexCache(bc.db, blockNodes); err != nil {
+		return errors.Wrapf(err, "SaveBlockIndexCache: ")
+	}
+	glog.Infof("SaveBlockIndexCache: Saved %d block nodes", len(blockNodes))
+	return nil
+}
@@ -0,0 +1,137 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockIndexCache(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	// b1 -> b2 -> b3
+	//    \ -> b4
+	b1 := _GetTestBlockNode()
+	b1.Height = 0
+	b2 := _GetTestBlockNode()
+	b2.Hash[0] = 0x99
+	b2.Header.PrevBlockHash = b1.Hash
+	b2.Height = 1
+	b3 := _GetTestBlockNode()
+	b3.Hash[0] = 0x03
+	b3.Header.PrevBlockHash = b2.Hash
+	b3.Height = 2
+	b4 := _GetTestBlockNode()
+	b4.Hash[0] = 0x04
+	b4.Header.PrevBlockHash = b1.Hash
+	b4.Height = 1
+	blockNodes := []*BlockNode{b3, b1, b4, b2}
+	for _, blockNode := range blockNodes {
+		require.NoError(PutHeightHashToNodeInfo(db, nil, blockNode, false /*bitcoinNodes*/, nil))
+	}
+	requireMatchesDb := func(blockIndex map[BlockHash]*BlockNode) {
+		dbBlockIndex, err := GetBlockIndex(db, false /*bitcoinNodes*/, &DeSoTestnetParams)
+		require.NoError(err)
+		require.Len(blockIndex, len(dbBlockIndex))
+		for hash, dbBlockNode := range dbBlockIndex {
+			blockNode := blockIndex[hash]
+			require.NotNil(blockNode)
+			require.Equal(dbBlockNode.Status, blockNode.Status)
+			if dbBlockNode.Parent == nil {
+				require.Nil(blockNode.Parent)
+			} else {
+				require.Equal(*dbBlockNode.Parent.Hash, *blockNode.Parent.Hash)
+			}
+		}
+	}
+
+	// Without a saved index there's nothing to load, and nothing is journaled.
+	blockIndex, err := LoadBlockIndexCache(db, b3.Hash, &DeSoTestnetParams)
+	require.NoError(err)
+	require.Nil(blockIndex)
+	require.NoError(db.View(func(txn *badger.Txn) error {
+		require.Empty(_dbKeysForBlockIndexCachePrefixWithTxn(txn, Prefixes.PrefixBlockIndexCacheJournal))
+		return nil
+	}))
+
+	// The saved index loads with every node linked to its parent, and can be loaded again.
+	require.NoError(DBPutBlockIndexCache(db, blockNodes))
+	for ii := 0; ii < 2; ii++ {
+		blockIndex, err = LoadBlockIndexCache(db, b3.Hash, &DeSoTestnetParams)
+		require.NoError(err)
+		require.Len(blockIndex, 4)
+		require.Nil(blockIndex[*b1.Hash].Parent)
+		require.Equal(blockIndex[*b1.Hash], blockIndex[*b2.Hash].Parent)
+		require.Equal(blockIndex[*b2.Hash], blockIndex[*b3.Hash].Parent)
+		require.Equal(blockIndex[*b1.Hash], blockIndex[*b4.Hash].Parent)
+		requireMatchesDb(blockIndex)
+	}
+
+	// If the node crashes after storing more block nodes, the next start applies the journal
+	// on top of the saved index: a new tip b5, a status change on b4, and a deleted b3.
+	b5 := _GetTestBlockNode()
+	b5.Hash[0] = 0x05
+	b5.Header.PrevBlockHash = b4.Hash
+	b5.Height = 2
+	require.NoError(PutHeightHashToNodeInfo(db, nil, b5, false /*bitcoinNodes*/, nil))
+	updatedB4 := *b4
+	updatedB4.Status |= StatusBlockStored
+	require.NoError(PutHeightHashToNodeInfo(db, nil, &updatedB4, false /*bitcoinNodes*/, nil))
+	require.NoError(DbBulkDeleteHeightHashToNodeInfo(db, nil, []*BlockNode{b3}, false /*bitcoinNodes*/, nil, true))
+	blockIndex, err = LoadBlockIndexCache(db, b5.Hash, &DeSoTestnetParams)
+	require.NoError(err)
+	require.Len(blockIndex, 4)
+	require.Nil(blockIndex[*b3.Hash])
+	require.Equal(blockIndex[*b4.Hash], blockIndex[*b5.Hash].Parent)
+	require.Equal(updatedB4.Status, blockIndex[*b4.Hash].Status)
+	requireMatchesDb(blockIndex)
+
+	// Saving the index again clears the journal.
+	require.NoError(DBPutBlockIndexCache(db, []*BlockNode{b1, b2, &updatedB4, b5}))
+	require.NoError(db.View(func(txn *badger.Txn) error {
+		require.Empty(_dbKeysForBlockIndexCachePrefixWithTxn(txn, Prefixes.PrefixBlockIndexCacheJournal))
+		return nil
+	}))
+	blockIndex, err = LoadBlockIndexCache(db, b5.Hash, &DeSoTestnetParams)
+	require.NoError(err)
+	requireMatchesDb(blockIndex)
+
+	// An index whose best hash isn't in the index isn't used, and is deleted.
+	_, err = LoadBlockIndexCache(db, b3.Hash, &DeSoTestnetParams)
+	require.Error(err)
+	metadata, err := DBGetBlockIndexCacheMetadata(db)
+	require.NoError(err)
+	require.Nil(metadata)
+
+	// Neither is an index that's missing a block node that wasn't journaled.
+	require.NoError(DBPutBlockIndexCache(db, []*BlockNode{b1, b2, &updatedB4}))
+	_, err = LoadBlockIndexCache(db, b2.Hash, &DeSoTestnetParams)
+	require.Error(err)
+	metadata, err = DBGetBlockIndexCacheMetadata(db)
+	require.NoError(err)
+	require.Nil(metadata)
+
+	// Nor is an index whose chunks don't match the checksum.
+	require.NoError(DBPutBlockIndexCache(db, []*BlockNode{b1, b2, &updatedB4, b5}))
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		chunkKey := _dbKeyForBlockIndexCacheChunk(0)
+		chunk, err := DBGetWithTxn(txn, nil, chunkKey)
+		if err != nil {
+			return err
+		}
+		chunk[len(chunk)-1] ^= 0xFF
+		return txn.Set(chunkKey, chunk)
+	}))
+	_, err = LoadBlockIndexCache(db, b5.Hash, &DeSoTestnetParams)
+	require.Error(err)
+	require.Contains(err.Error(), "checksum")
+	metadata, err = DBGetBlockIndexCacheMetadata(db)
+	require.NoError(err)
+	require.Nil(metadata)
+}
@@ -1,16 +1,16 @@
+//go:build !deso_lean
+
 package lib
 
 import (
 	"encoding/hex"
 	"fmt"
 	"math"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/wire"
-	"github.com/tyler-smith/go-bip39"
 
 	"github.com/deso-protocol/go-deadlock"
 
@@ -46,6 +46,12 @@ type DeSoBlockProducer struct {
 	params   *DeSoParams
 	postgres *Postgres
 
+	// relayPolicy is the operator's policy for leaving txns out of blocks. It can be nil.
+	relayPolicy *RelayPolicy
+	// blockAssemblyPolicy is the operator's policy for reserving block space for certain txn
+	// types. It can be nil.
+	blockAssemblyPolicy *BlockAssemblyPolicy
+
 	// producerWaitGroup allows us to wait until the producer has properly closed.
 	producerWaitGroup sync.WaitGroup
 	// exit is used to signal that DeSoBlockProducer routines should be terminated.
@@ -82,25 +88,10 @@ func NewDeSoBlockProducer(
 	var privKey *btcec.PrivateKey
 	if blockProducerSeed != "" {
 		// If a blockProducerSeed is provided then we use it to generate a private key.
-		// If the block producer seed beings with 0x, we treat it as a hex seed. Otherwise,
-		// we treat it as a seed phrase.
-		if strings.HasPrefix(blockProducerSeed, "0x") {
-			privKeyBytes, err := hex.DecodeString(blockProducerSeed[2:])
-			if err != nil {
-				return nil, fmt.Errorf("NewDeSoBlockProducer: Error decoding hex seed: %+v", err)
-			}
-			privKey, _ = btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes)
-		} else {
-			seedBytes, err := bip39.NewSeedWithErrorChecking(blockProducerSeed, "")
-			if err != nil {
-				return nil, fmt.Errorf("NewDeSoBlockProducer: Error converting mnemonic: %+v", err)
-			}
-
-			_, privKey, _, err = ComputeKeysFromSeed(seedBytes, 0, params)
-			if err != nil {
-				return nil, fmt.Errorf(
-					"NewDeSoBlockProducer: Error computing keys from seed: %+v", err)
-			}
+		var err error
+		privKey, err = ParsePrivateKeySeed(blockProducerSeed, params)
+		if err != nil {
+			return nil, fmt.Errorf("NewDeSoBlockProducer: %+v", err)
 		}
 	}
 
@@ -193,6 +184,9 @@ func (desoBlockProducer *DeSoBlockProducer) _getBlockTemplate(publicKey []byte)
 		if err != nil {
 			return nil, nil, nil, errors.Wrapf(err, "DeSoBlockProducer._getBlockTemplate: Problem getting mempool transactions: ")
 		}
+		// Move the txns the operator reserved block space for to the front.
+		txnsOrderedByTimeAdded = desoBlockProducer.blockAssemblyPolicy.OrderTxnsForBlock(
+			txnsOrderedByTimeAdded, desoBlockProducer.params.MinerMaxBlockSizeBytes)
 
 		// Now keep
 		// adding transactions to the block until the block is full.
@@ -214,8 +208,8 @@ func (desoBlockProducer *DeSoBlockProducer) _getBlockTemplate(publicKey []byte)
 		currentBlockSize := uint64(len(blockBytes) + MaxVarintLen64)
 
 		// Create a new view object.
-		utxoView := NewUtxoView(desoBlockProducer.chain.db, desoBlockProducer.params,
-			desoBlockProducer.postgres, desoBlockProducer.chain.snapshot, nil)
+		utxoView := NewUtxoViewWithStorageBackend(desoBlockProducer.chain.db, desoBlockProducer.params,
+			desoBlockProducer.postgres, desoBlockProducer.chain.snapshot, nil, desoBlockProducer.chain.storageBackend)
 
 		txnsAddedToBlock := make(map[BlockHash]bool)
 		for ii, mempoolTx := range txnsOrderedByTimeAdded {
@@ -224,6 +218,11 @@ func (desoBlockProducer *DeSoBlockProducer) _getBlockTemplate(publicKey []byte)
 				break
 			}
 
+			// Skip txns the operator's relay policy excludes from blocks.
+			if desoBlockProducer.relayPolicy.ShouldExcludeTransactionFromBlock(mempoolTx.Tx, desoBlockProducer.params) {
+				continue
+			}
+
 			// Try to apply the transaction to the view with the strictest possible checks.
 			// Make a copy of the view in order to test applying the txn without compromising the
 			// integrity of the view.
@@ -282,8 +281,8 @@ func (desoBlockProducer *DeSoBlockProducer) _getBlockTemplate(publicKey []byte)
 
 	// Compute the total fee the BlockProducer should get.
 	totalFeeNanos := uint64(0)
-	feesUtxoView := NewUtxoView(desoBlockProducer.chain.db, desoBlockProducer.params,
-		desoBlockProducer.postgres, desoBlockProducer.chain.snapshot, nil)
+	feesUtxoView := NewUtxoViewWithStorageBackend(desoBlockProducer.chain.db, desoBlockProducer.params,
+		desoBlockProducer.postgres, desoBlockProducer.chain.snapshot, nil, desoBlockProducer.chain.storageBackend)
 
 	// Parse the public key that should be used for the block reward.
 	blockRewardOutputPublicKey, err := btcec.ParsePubKey(blockRewardOutput.PublicKey, btcec.S256())
@@ -0,0 +1,363 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_producer_attestation.go standardizes how a block producer identifies itself. A
+// producer puts a short human-readable tag, its public key, and a signature over the tag
+// in the ExtraData of the block reward transaction. The signature commits to the block's
+// height, its parent, and its transactions so that a tag can't be copied onto another
+// producer's block.
+//
+// Tags are validated against an optional on-chain registry maintained by the
+// ParamUpdater through UpdateGlobalParams. If a producer's public key is registered,
+// the tag in its blocks must match the registered tag. Unregistered producers may still
+// attest, and explorers can surface the attestation as unverified.
+
+//
+// TYPES: BlockProducerRegistryEntry
+//
+
+type BlockProducerRegistryEntry struct {
+	// PublicKey is the public key the block producer signs its attestations with.
+	PublicKey []byte
+	// Tag is the name the block producer is registered under, e.g. the name of a pool.
+	Tag []byte
+
+	isDeleted bool
+}
+
+func (entry *BlockProducerRegistryEntry) Copy() *BlockProducerRegistryEntry {
+	return &BlockProducerRegistryEntry{
+		PublicKey: append([]byte{}, entry.PublicKey...),
+		Tag:       append([]byte{}, entry.Tag...),
+		isDeleted: entry.isDeleted,
+	}
+}
+
+func (entry *BlockProducerRegistryEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeByteArray(entry.PublicKey)...)
+	data = append(data, EncodeByteArray(entry.Tag)...)
+	return data
+}
+
+func (entry *BlockProducerRegistryEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// PublicKey
+	entry.PublicKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockProducerRegistryEntry.Decode: Problem reading PublicKey: ")
+	}
+
+	// Tag
+	entry.Tag, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockProducerRegistryEntry.Decode: Problem reading Tag: ")
+	}
+
+	return nil
+}
+
+func (entry *BlockProducerRegistryEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *BlockProducerRegistryEntry) GetEncoderType() EncoderType {
+	return EncoderTypeBlockProducerRegistryEntry
+}
+
+// BlockProducerAttestation is the parsed block producer tag of a block.
+type BlockProducerAttestation struct {
+	PublicKey []byte
+	Tag       []byte
+	// IsRegistered is true if the PublicKey is in the on-chain block producer registry,
+	// in which case Tag is guaranteed to match the registered tag.
+	IsRegistered bool
+}
+
+// BlockProducerAttestationHash returns the hash a block producer signs to attest to the
+// block. It covers the block's height, its parent, and the merkle root of its transactions.
+// The attestation itself lives in the block reward transaction, so the merkle root is
+// computed with the attestation removed from the block reward's ExtraData.
+func BlockProducerAttestationHash(block *MsgDeSoBlock, tag []byte) (*BlockHash, error) {
+	if len(block.Txns) == 0 {
+		return nil, errors.New("BlockProducerAttestationHash: block has no transactions")
+	}
+	blockRewardTxn := *block.Txns[0]
+	blockRewardTxn.ExtraData = nil
+	for key, value := range block.Txns[0].ExtraData {
+		if key == BlockProducerTagKey || key == BlockProducerPublicKeyKey || key == BlockProducerSignatureKey {
+			continue
+		}
+		if blockRewardTxn.ExtraData == nil {
+			blockRewardTxn.ExtraData = make(map[string][]byte)
+		}
+		blockRewardTxn.ExtraData[key] = value
+	}
+	txns := append([]*MsgDeSoTxn{&blockRewardTxn}, block.Txns[1:]...)
+	merkleRoot, _, err := ComputeMerkleRoot(txns)
+	if err != nil {
+		return nil, errors.Wrapf(err, "BlockProducerAttestationHash: problem computing merkle root: ")
+	}
+
+	var data []byte
+	data = append(data, []byte("BlockProducerAttestation")...)
+	data = append(data, UintToBuf(block.Header.Height)...)
+	data = append(data, block.Header.PrevBlockHash[:]...)
+	data = append(data, merkleRoot[:]...)
+	data = append(data, EncodeByteArray(tag)...)
+	return Sha256DoubleHash(data), nil
+}
+
+// SignBlockProducerAttestation sets the block producer tag on a block's block reward
+// transaction. It must be called once the block's transactions are final, since the
+// signature commits to them, but before the block's merkle root is computed, since the
+// tag is part of the block reward transaction.
+func SignBlockProducerAttestation(block *MsgDeSoBlock, tag []byte, privateKey *btcec.PrivateKey) error {
+	if len(block.Txns) == 0 || block.Txns[0].TxnMeta.GetTxnType() != TxnTypeBlockReward {
+		return errors.New("SignBlockProducerAttestation: block has no block reward transaction")
+	}
+	if len(tag) == 0 || len(tag) > MaxBlockProducerTagLength {
+		return errors.Wrapf(RuleErrorBlockProducerTagInvalidLength, "SignBlockProducerAttestation: ")
+	}
+	hash, err := BlockProducerAttestationHash(block, tag)
+	if err != nil {
+		return errors.Wrapf(err, "SignBlockProducerAttestation: ")
+	}
+	signature, err := privateKey.Sign(hash[:])
+	if err != nil {
+		return errors.Wrapf(err, "SignBlockProducerAttestation: problem signing attestation: ")
+	}
+
+	blockRewardTxn := block.Txns[0]
+	if blockRewardTxn.ExtraData == nil {
+		blockRewardTxn.ExtraData = make(map[string][]byte)
+	}
+	blockRewardTxn.ExtraData[BlockProducerTagKey] = tag
+	blockRewardTxn.ExtraData[BlockProducerPublicKeyKey] = privateKey.PubKey().SerializeCompressed()
+	blockRewardTxn.ExtraData[BlockProducerSignatureKey] = signature.Serialize()
+	return nil
+}
+
+// GetBlockProducerAttestation parses and validates the block producer tag in a block's block
+// reward transaction. It returns nil if the block doesn't carry a tag, and an error if the
+// tag is malformed, its signature is invalid, or it doesn't match the producer's registered tag.
+func (bav *UtxoView) GetBlockProducerAttestation(block *MsgDeSoBlock) (*BlockProducerAttestation, error) {
+	if len(block.Txns) == 0 || block.Txns[0].TxnMeta.GetTxnType() != TxnTypeBlockReward {
+		return nil, nil
+	}
+	extraData := block.Txns[0].ExtraData
+	tag, hasTag := extraData[BlockProducerTagKey]
+	publicKey, hasPublicKey := extraData[BlockProducerPublicKeyKey]
+	signatureBytes, hasSignature := extraData[BlockProducerSignatureKey]
+	if !hasTag && !hasPublicKey && !hasSignature {
+		return nil, nil
+	}
+	if !hasTag || !hasPublicKey || !hasSignature {
+		return nil, errors.Wrapf(RuleErrorBlockProducerAttestationIncomplete, "GetBlockProducerAttestation: ")
+	}
+	if len(tag) == 0 || len(tag) > MaxBlockProducerTagLength {
+		return nil, errors.Wrapf(RuleErrorBlockProducerTagInvalidLength, "GetBlockProducerAttestation: ")
+	}
+
+	// Verify the signature.
+	if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+		return nil, errors.Wrapf(RuleErrorBlockProducerAttestationInvalidPublicKey, "GetBlockProducerAttestation: ")
+	}
+	pkObj, err := btcec.ParsePubKey(publicKey, btcec.S256())
+	if err != nil {
+		return nil, errors.Wrapf(RuleErrorBlockProducerAttestationInvalidPublicKey, "GetBlockProducerAttestation: %v", err)
+	}
+	signature, err := btcec.ParseDERSignature(signatureBytes, btcec.S256())
+	if err != nil {
+		return nil, errors.Wrapf(RuleErrorBlockProducerAttestationInvalidSignature, "GetBlockProducerAttestation: %v", err)
+	}
+	hash, err := BlockProducerAttestationHash(block, tag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetBlockProducerAttestation: ")
+	}
+	if !signature.Verify(hash[:], pkObj) {
+		return nil, errors.Wrapf(RuleErrorBlockProducerAttestationInvalidSignature, "GetBlockProducerAttestation: ")
+	}
+
+	// Check the tag against the registry.
+	registryEntry, err := bav.GetBlockProducerRegistryEntry(publicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetBlockProducerAttestation: ")
+	}
+	if registryEntry != nil && !bytes.Equal(registryEntry.Tag, tag) {
+		return nil, errors.Wrapf(RuleErrorBlockProducerTagDoesNotMatchRegistry,
+			"GetBlockProducerAttestation: tag %q does not match registered tag %q", tag, registryEntry.Tag)
+	}
+
+	return &BlockProducerAttestation{
+		PublicKey:    publicKey,
+		Tag:          tag,
+		IsRegistered: registryEntry != nil,
+	}, nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForBlockProducerRegistryEntry(publicKey []byte) []byte {
+	key := append([]byte{}, Prefixes.PrefixBlockProducerRegistryEntryByPublicKey...)
+	key = append(key, publicKey...)
+	return key
+}
+
+func DBGetBlockProducerRegistryEntry(handle *badger.DB, snap *Snapshot, publicKey []byte) (*BlockProducerRegistryEntry, error) {
+	var ret *BlockProducerRegistryEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetBlockProducerRegistryEntryWithTxn(txn, snap, publicKey)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetBlockProducerRegistryEntryWithTxn(txn *badger.Txn, snap *Snapshot, publicKey []byte) (*BlockProducerRegistryEntry, error) {
+	// Retrieve BlockProducerRegistryEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForBlockProducerRegistryEntry(publicKey))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetBlockProducerRegistryEntry: problem retrieving BlockProducerRegistryEntry: ")
+	}
+
+	// Decode BlockProducerRegistryEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&BlockProducerRegistryEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetBlockProducerRegistryEntry: problem decoding BlockProducerRegistryEntry: ")
+	}
+	return entry, nil
+}
+
+func DBPutBlockProducerRegistryEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *BlockProducerRegistryEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForBlockProducerRegistryEntry(entry.PublicKey)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutBlockProducerRegistryEntryWithTxn: problem storing BlockProducerRegistryEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteBlockProducerRegistryEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *BlockProducerRegistryEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForBlockProducerRegistryEntry(entry.PublicKey)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteBlockProducerRegistryEntryWithTxn: problem deleting BlockProducerRegistryEntry: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetBlockProducerRegistryEntry returns the registry entry for the public key, or nil
+// if the public key isn't registered.
+func (bav *UtxoView) GetBlockProducerRegistryEntry(publicKey []byte) (*BlockProducerRegistryEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.BlockProducerPublicKeyToRegistryEntry[MakePkMapKey(publicKey)]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetBlockProducerRegistryEntry(publicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetBlockProducerRegistryEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the BlockProducerRegistryEntry from the db in the UtxoView.
+		bav._setBlockProducerRegistryEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+func (bav *UtxoView) _setBlockProducerRegistryEntryMappings(entry *BlockProducerRegistryEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setBlockProducerRegistryEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.BlockProducerPublicKeyToRegistryEntry[MakePkMapKey(entry.PublicKey)] = entry
+}
+
+func (bav *UtxoView) _deleteBlockProducerRegistryEntryMappings(entry *BlockProducerRegistryEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteBlockProducerRegistryEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setBlockProducerRegistryEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushBlockProducerRegistryEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.BlockProducerPublicKeyToRegistryEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if MakePkMapKey(entry.PublicKey) != mapKey {
+			return fmt.Errorf(
+				"_flushBlockProducerRegistryEntriesToDbWithTxn: BlockProducerRegistryEntry public key %v doesn't match MapKey %v",
+				PkToStringBoth(entry.PublicKey),
+				PkToStringBoth(mapKey[:]),
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteBlockProducerRegistryEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushBlockProducerRegistryEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutBlockProducerRegistryEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushBlockProducerRegistryEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockProducerAttestation(t *testing.T) {
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+
+	privateKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	publicKey := privateKey.PubKey().SerializeCompressed()
+
+	newBlock := func() *MsgDeSoBlock {
+		block := NewMessage(MsgTypeBlock).(*MsgDeSoBlock)
+		block.Header.Height = 10
+		block.Header.PrevBlockHash = &BlockHash{0x01}
+		blockRewardTxn := NewMessage(MsgTypeTxn).(*MsgDeSoTxn)
+		blockRewardTxn.TxnMeta = &BlockRewardMetadataa{ExtraData: UintToBuf(0)}
+		block.Txns = append(block.Txns, blockRewardTxn)
+		return block
+	}
+
+	// A block without a tag has no attestation.
+	block := newBlock()
+	attestation, err := utxoView.GetBlockProducerAttestation(block)
+	require.NoError(t, err)
+	require.Nil(t, attestation)
+
+	// An unregistered block producer can attest to its blocks.
+	require.NoError(t, SignBlockProducerAttestation(block, []byte("pool"), privateKey))
+	attestation, err = utxoView.GetBlockProducerAttestation(block)
+	require.NoError(t, err)
+	require.Equal(t, publicKey, attestation.PublicKey)
+	require.Equal(t, []byte("pool"), attestation.Tag)
+	require.False(t, attestation.IsRegistered)
+
+	// Once registered, the tag must match the registry.
+	utxoView._setBlockProducerRegistryEntryMappings(&BlockProducerRegistryEntry{PublicKey: publicKey, Tag: []byte("pool")})
+	attestation, err = utxoView.GetBlockProducerAttestation(block)
+	require.NoError(t, err)
+	require.True(t, attestation.IsRegistered)
+
+	utxoView._setBlockProducerRegistryEntryMappings(&BlockProducerRegistryEntry{PublicKey: publicKey, Tag: []byte("other")})
+	_, err = utxoView.GetBlockProducerAttestation(block)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorBlockProducerTagDoesNotMatchRegistry)
+
+	// The signature commits to the block's height, so it can't be copied onto another block.
+	utxoView._deleteBlockProducerRegistryEntryMappings(&BlockProducerRegistryEntry{PublicKey: publicKey})
+	block.Header.Height = 11
+	_, err = utxoView.GetBlockProducerAttestation(block)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorBlockProducerAttestationInvalidSignature)
+
+	// It also commits to the block's transactions, including the rest of the block reward.
+	block = newBlock()
+	require.NoError(t, SignBlockProducerAttestation(block, []byte("pool"), privateKey))
+	block.Txns = append(block.Txns, &MsgDeSoTxn{TxnMeta: &BasicTransferMetadata{}})
+	_, err = utxoView.GetBlockProducerAttestation(block)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorBlockProducerAttestationInvalidSignature)
+
+	block = newBlock()
+	require.NoError(t, SignBlockProducerAttestation(block, []byte("pool"), privateKey))
+	block.Txns[0].TxOutputs = append(block.Txns[0].TxOutputs, &DeSoOutput{PublicKey: publicKey, AmountNanos: 1})
+	_, err = utxoView.GetBlockProducerAttestation(block)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorBlockProducerAttestationInvalidSignature)
+
+	// Other ExtraData on the block reward is signed alongside the attestation.
+	block = newBlock()
+	block.Txns[0].ExtraData = map[string][]byte{"note": []byte("hello")}
+	require.NoError(t, SignBlockProducerAttestation(block, []byte("pool"), privateKey))
+	_, err = utxoView.GetBlockProducerAttestation(block)
+	require.NoError(t, err)
+	block.Txns[0].ExtraData["note"] = []byte("bye")
+	_, err = utxoView.GetBlockProducerAttestation(block)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorBlockProducerAttestationInvalidSignature)
+
+	// A tag without a signature is rejected.
+	block = newBlock()
+	block.Txns[0].ExtraData = map[string][]byte{BlockProducerTagKey: []byte("pool")}
+	_, err = utxoView.GetBlockProducerAttestation(block)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorBlockProducerAttestationIncomplete)
+
+	// Tags longer than MaxBlockProducerTagLength can't be signed.
+	block = newBlock()
+	err = SignBlockProducerAttestation(block, make([]byte, MaxBlockProducerTagLength+1), privateKey)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorBlockProducerTagInvalidLength)
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Block rewards can't be spent until BlockRewardMaturity has passed since the block that
+// paid them. Wallets that only look at a miner's total balance build txns that fail with
+// RuleErrorInputSpendsImmatureBlockReward, so the functions below split the balance into
+// the part that's spendable in the next block and the part that's still maturing.
+
+// ImmatureBlockReward is a block reward output that can't be spent yet.
+type ImmatureBlockReward struct {
+	// UtxoKey is nil after the BalanceModelBlockHeight, when block rewards are paid to
+	// balances rather than to utxos.
+	UtxoKey     *UtxoKey
+	AmountNanos uint64
+	// BlockHeight is the height of the block that paid the reward.
+	BlockHeight uint32
+	// MaturityBlockHeight is the height of the first block the reward can be spent in.
+	MaturityBlockHeight uint32
+}
+
+// BlockRewardMaturityBalance is a public key's DESO balance split by the maturity of its
+// block rewards.
+type BlockRewardMaturityBalance struct {
+	SpendableBalanceNanos uint64
+	ImmatureBalanceNanos  uint64
+	// ImmatureBlockRewards are sorted by MaturityBlockHeight. They're only listed before the
+	// BalanceModelBlockHeight.
+	ImmatureBlockRewards []*ImmatureBlockReward
+}
+
+// GetBlockRewardMaturityBlockHeight returns the height of the first block that can spend a
+// block reward paid at rewardBlockHeight, matching the check in _isEntryImmatureBlockReward.
+func GetBlockRewardMaturityBlockHeight(rewardBlockHeight uint32, params *DeSoParams) uint32 {
+	if params.TimeBetweenBlocks <= 0 || params.BlockRewardMaturity <= 0 {
+		return rewardBlockHeight
+	}
+	maturityBlocks := params.BlockRewardMaturity / params.TimeBetweenBlocks
+	if params.BlockRewardMaturity%params.TimeBetweenBlocks != 0 {
+		maturityBlocks++
+	}
+	return rewardBlockHeight + uint32(maturityBlocks)
+}
+
+// GetBlockRewardMaturityBalanceForPublicKey returns the public key's balance split into what
+// can be spent in the next block and the block rewards that are still maturing. Like
+// GetSpendableUtxosForPublicKey, it factors in the mempool if one is passed.
+func (bc *Blockchain) GetBlockRewardMaturityBalanceForPublicKey(
+	publicKeyBytes []byte, mempool Mempool, referenceUtxoView *UtxoView) (*BlockRewardMaturityBalance, error) {
+
+	tipHeight := bc.blockTip().Height
+	blockHeight := tipHeight + 1
+	utxoView, err := bc.getUtxoViewForPublicKey(publicKeyBytes, mempool, referenceUtxoView)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Blockchain.GetBlockRewardMaturityBalanceForPublicKey: ")
+	}
+
+	if blockHeight >= bc.params.ForkHeights.BalanceModelBlockHeight {
+		balanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(publicKeyBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Blockchain.GetBlockRewardMaturityBalanceForPublicKey: ")
+		}
+		spendableBalanceNanos, err := utxoView.GetSpendableDeSoBalanceNanosForPublicKey(publicKeyBytes, tipHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Blockchain.GetBlockRewardMaturityBalanceForPublicKey: ")
+		}
+		immatureBalanceNanos, err := SafeUint64().Sub(balanceNanos, spendableBalanceNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Blockchain.GetBlockRewardMaturityBalanceForPublicKey: "+
+				"Spendable balance %d exceeds balance %d", spendableBalanceNanos, balanceNanos)
+		}
+		return &BlockRewardMaturityBalance{
+			SpendableBalanceNanos: spendableBalanceNanos,
+			ImmatureBalanceNanos:  immatureBalanceNanos,
+		}, nil
+	}
+
+	utxoEntries, err := utxoView.GetUnspentUtxoEntrysForPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Blockchain.GetBlockRewardMaturityBalanceForPublicKey: ")
+	}
+	maturityBalance := &BlockRewardMaturityBalance{}
+	for _, utxoEntry := range utxoEntries {
+		// Utxos the mempool has already spent don't count towards either balance.
+		if !isInterfaceValueNil(mempool) && mempool.CheckSpend(*utxoEntry.UtxoKey) != nil {
+			continue
+		}
+		if !_isEntryImmatureBlockReward(utxoEntry, blockHeight, bc.params) {
+			maturityBalance.SpendableBalanceNanos, err = SafeUint64().Add(
+				maturityBalance.SpendableBalanceNanos, utxoEntry.AmountNanos)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Blockchain.GetBlockRewardMaturityBalanceForPublicKey: ")
+			}
+			continue
+		}
+		maturityBalance.ImmatureBalanceNanos, err = SafeUint64().Add(
+			maturityBalance.ImmatureBalanceNanos, utxoEntry.AmountNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Blockchain.GetBlockRewardMaturityBalanceForPublicKey: ")
+		}
+		utxoKey := *utxoEntry.UtxoKey
+		maturityBalance.ImmatureBlockRewards = append(maturityBalance.ImmatureBlockRewards, &ImmatureBlockReward{
+			UtxoKey:             &utxoKey,
+			AmountNanos:         utxoEntry.AmountNanos,
+			BlockHeight:         utxoEntry.BlockHeight,
+			MaturityBlockHeight: GetBlockRewardMaturityBlockHeight(utxoEntry.BlockHeight, bc.params),
+		})
+	}
+	sort.Slice(maturityBalance.ImmatureBlockRewards, func(ii, jj int) bool {
+		return maturityBalance.ImmatureBlockRewards[ii].MaturityBlockHeight <
+			maturityBalance.ImmatureBlockRewards[jj].MaturityBlockHeight
+	})
+	return maturityBalance, nil
+}
+
+// _describeImmatureBlockRewards explains why a txn couldn't be funded when part of the
+// public key's balance is still maturing. It returns an empty string otherwise.
+func (bc *Blockchain) _describeImmatureBlockRewards(publicKeyBytes []byte, mempool Mempool) string {
+	maturityBalance, err := bc.GetBlockRewardMaturityBalanceForPublicKey(publicKeyBytes, mempool, nil)
+	if err != nil || maturityBalance.ImmatureBalanceNanos == 0 {
+		return ""
+	}
+	description := fmt.Sprintf(" Note that %d nanos of the balance are immature block rewards",
+		maturityBalance.ImmatureBalanceNanos)
+	if len(maturityBalance.ImmatureBlockRewards) > 0 {
+		description += fmt.Sprintf(", the first of which can be spent at block height %d",
+			maturityBalance.ImmatureBlockRewards[0].MaturityBlockHeight)
+	}
+	return description + "."
+}
@@ -0,0 +1,28 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBlockRewardMaturityBlockHeight(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.TimeBetweenBlocks = time.Minute
+	rewardUtxo := &UtxoEntry{UtxoType: UtxoTypeBlockReward, BlockHeight: 100}
+
+	// The maturity height is the first height at which the reward isn't immature.
+	for _, maturity := range []time.Duration{0, time.Minute, 5 * time.Minute, 90 * time.Second} {
+		params.BlockRewardMaturity = maturity
+		maturityBlockHeight := GetBlockRewardMaturityBlockHeight(rewardUtxo.BlockHeight, &params)
+		require.False(_isEntryImmatureBlockReward(rewardUtxo, maturityBlockHeight, &params))
+		if maturityBlockHeight > rewardUtxo.BlockHeight {
+			require.True(_isEntryImmatureBlockReward(rewardUtxo, maturityBlockHeight-1, &params))
+		}
+	}
+	params.BlockRewardMaturity = 90 * time.Second
+	require.Equal(uint32(102), GetBlockRewardMaturityBlockHeight(100, &params))
+}
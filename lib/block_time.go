@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"sort"
+)
+
+// block_time.go holds helpers for a block time that is resistant to manipulation by a single
+// block producer. A producer can set its block's timestamp anywhere between its parent's
+// timestamp and the allowed drift into the future, so features that depend on time, such as
+// expirations and auctions, shouldn't rely on the timestamp of a single block. Instead they
+// should use the median time past: the median timestamp of the last MedianTimePastNumBlocks
+// blocks, which only moves forward when most recent producers agree that time has passed.
+
+// CalcMedianTimePastNanoSecs returns the median timestamp of the numBlocks blocks ending at
+// blockNode, walking back through its parents. If there are fewer than numBlocks blocks,
+// the median of all of them is returned. It returns zero if blockNode is nil.
+func CalcMedianTimePastNanoSecs(blockNode *BlockNode, numBlocks int) int64 {
+	var timestamps []int64
+	for node := blockNode; node != nil && len(timestamps) < numBlocks; node = node.Parent {
+		timestamps = append(timestamps, node.Header.TstampNanoSecs)
+	}
+	if len(timestamps) == 0 {
+		return 0
+	}
+	sort.Slice(timestamps, func(ii, jj int) bool {
+		return timestamps[ii] < timestamps[jj]
+	})
+	return timestamps[len(timestamps)/2]
+}
+
+// GetMedianTimePastNanoSecs returns the median time past of the chain ending at blockNode.
+func (bc *Blockchain) GetMedianTimePastNanoSecs(blockNode *BlockNode) int64 {
+	return CalcMedianTimePastNanoSecs(blockNode, bc.params.MedianTimePastNumBlocks)
+}
+
+// getMaxBlockTimestampDriftNanoSecs returns how far into the future a PoS block's timestamp
+// can be, given the drift set in the global params. After the median time past fork, the
+// drift is bounded by MaxBlockTimestampDriftNanoSecs.
+func (params *DeSoParams) getMaxBlockTimestampDriftNanoSecs(
+	blockTimestampDriftNanoSecs int64, blockHeight uint64) int64 {
+
+	if blockHeight < uint64(params.ForkHeights.BlockTimestampMedianTimePastBlockHeight) {
+		return blockTimestampDriftNanoSecs
+	}
+	if blockTimestampDriftNanoSecs > params.MaxBlockTimestampDriftNanoSecs {
+		return params.MaxBlockTimestampDriftNanoSecs
+	}
+	return blockTimestampDriftNanoSecs
+}
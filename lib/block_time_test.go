@@ -0,0 +1,147 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stretchr/testify/require"
+)
+
+// _newMedianTimePastTestChain returns a chain of 11 blocks where blocks 0 through 9 are
+// 1000 nanoseconds apart, and the tip at height 10 rolls its timestamp back to block 2's.
+func _newMedianTimePastTestChain() []*BlockNode {
+	var blockNodes []*BlockNode
+	var parent *BlockNode
+	for ii := 0; ii <= 10; ii++ {
+		tstampNanoSecs := int64(ii+1) * 1000
+		if ii == 10 {
+			tstampNanoSecs = 3000
+		}
+		parent = &BlockNode{
+			Parent: parent,
+			Hash:   NewBlockHash(RandomBytes(32)),
+			Height: uint32(ii),
+			Header: &MsgDeSoHeader{Height: uint64(ii), TstampNanoSecs: tstampNanoSecs},
+		}
+		blockNodes = append(blockNodes, parent)
+	}
+	return blockNodes
+}
+
+func TestCalcMedianTimePastNanoSecs(t *testing.T) {
+	require := require.New(t)
+
+	blockNodes := _newMedianTimePastTestChain()
+	tip := blockNodes[10]
+
+	require.Equal(int64(0), CalcMedianTimePastNanoSecs(nil, 11))
+	require.Equal(int64(1000), CalcMedianTimePastNanoSecs(blockNodes[0], 11))
+	// With fewer blocks than the window, the median is taken over all of them.
+	require.Equal(int64(2000), CalcMedianTimePastNanoSecs(blockNodes[1], 11))
+	// The window only covers the most recent blocks.
+	require.Equal(int64(9000), CalcMedianTimePastNanoSecs(tip, 3))
+	// A single block that rolls its timestamp back doesn't move the median.
+	require.Equal(int64(5000), CalcMedianTimePastNanoSecs(tip, 11))
+	require.Equal(int64(6000), CalcMedianTimePastNanoSecs(blockNodes[9], 11))
+}
+
+func TestIsBlockTimestampValidRelativeToMedianTimePast(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.MedianTimePastNumBlocks = 11
+	params.ForkHeights.BlockTimestampMedianTimePastBlockHeight = 11
+	bc := &Blockchain{
+		params:           &params,
+		blockIndexByHash: make(map[BlockHash]*BlockNode),
+	}
+
+	blockNodes := _newMedianTimePastTestChain()
+	for _, blockNode := range blockNodes {
+		bc.blockIndexByHash[*blockNode.Hash] = blockNode
+	}
+	tip := blockNodes[10]
+	require.Equal(int64(5000), bc.GetMedianTimePastNanoSecs(tip))
+	header := &MsgDeSoHeader{PrevBlockHash: tip.Hash, Height: 11}
+
+	// The timestamp can't be before the parent's.
+	header.TstampNanoSecs = 2999
+	require.Equal(RuleErrorPoSBlockTstampNanoSecsTooOld, bc.isBlockTimestampValidRelativeToParentPoS(header))
+
+	// After the parent's but not after the median time past is rejected.
+	header.TstampNanoSecs = 3000
+	require.Equal(RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast,
+		bc.isBlockTimestampValidRelativeToParentPoS(header))
+	header.TstampNanoSecs = 5000
+	require.Equal(RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast,
+		bc.isBlockTimestampValidRelativeToParentPoS(header))
+	header.TstampNanoSecs = 5001
+	require.NoError(bc.isBlockTimestampValidRelativeToParentPoS(header))
+
+	// Before the fork, only the parent's timestamp matters.
+	params.ForkHeights.BlockTimestampMedianTimePastBlockHeight = 12
+	header.TstampNanoSecs = 3000
+	require.NoError(bc.isBlockTimestampValidRelativeToParentPoS(header))
+}
+
+func TestMaxBlockTimestampDriftNanoSecs(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.BlockTimestampMedianTimePastBlockHeight = 10
+	maxDrift := params.MaxBlockTimestampDriftNanoSecs
+
+	// Before the fork, the global param is used as is.
+	require.Equal(maxDrift+1, params.getMaxBlockTimestampDriftNanoSecs(maxDrift+1, 9))
+	// After the fork, it's capped at the max.
+	require.Equal(maxDrift-1, params.getMaxBlockTimestampDriftNanoSecs(maxDrift-1, 10))
+	require.Equal(maxDrift, params.getMaxBlockTimestampDriftNanoSecs(maxDrift, 10))
+	require.Equal(maxDrift, params.getMaxBlockTimestampDriftNanoSecs(maxDrift+1, 10))
+}
+
+func TestUpdateGlobalParamsBlockTimestampDrift(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.BlockTimestampMedianTimePastBlockHeight = 10
+	paramUpdaterPriv, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+	paramUpdaterPkBytes := paramUpdaterPriv.PubKey().SerializeCompressed()
+	params.ExtraRegtestParamUpdaterKeys = map[PkMapKey]bool{MakePkMapKey(paramUpdaterPkBytes): true}
+	maxDrift := params.MaxBlockTimestampDriftNanoSecs
+
+	updateDrift := func(driftNanoSecs int64, blockHeight uint32) (*UtxoView, error) {
+		utxoView := NewUtxoView(db, &params, nil, nil, nil)
+		txn := &MsgDeSoTxn{
+			PublicKey: paramUpdaterPkBytes,
+			TxnMeta:   &UpdateGlobalParamsMetadata{},
+			ExtraData: map[string][]byte{
+				// The fee bucket check rejects updates that leave the min network fee at zero.
+				MinNetworkFeeNanosPerKBKey:     UintToBuf(1000),
+				BlockTimestampDriftNanoSecsKey: IntToBuf(driftNanoSecs),
+			},
+		}
+		_, _, _, err := utxoView._connectUpdateGlobalParams(txn, txn.Hash(), blockHeight, false)
+		return utxoView, err
+	}
+
+	// Before the fork, the drift isn't capped.
+	utxoView, err := updateDrift(maxDrift+1, 9)
+	require.NoError(err)
+	require.Equal(maxDrift+1, utxoView.GetCurrentGlobalParamsEntry().BlockTimestampDriftNanoSecs)
+
+	// After the fork, the drift can be set up to the max but not past it.
+	utxoView, err = updateDrift(maxDrift, 10)
+	require.NoError(err)
+	require.Equal(maxDrift, utxoView.GetCurrentGlobalParamsEntry().BlockTimestampDriftNanoSecs)
+	_, err = updateDrift(maxDrift+1, 10)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorBlockTimestampDriftNanoSecsTooHigh)
+}
@@ -49,6 +49,9 @@ type UtxoView struct {
 	// Forbidden block signature pubkeys
 	ForbiddenPubKeyToForbiddenPubKeyEntry map[PkMapKey]*ForbiddenPubKeyEntry
 
+	// Block producer registry mappings
+	BlockProducerPublicKeyToRegistryEntry map[PkMapKey]*BlockProducerRegistryEntry
+
 	// Messages data
 	MessageKeyToMessageEntry map[MessageKey]*MessageEntry
 
@@ -110,6 +113,53 @@ type UtxoView struct {
 	// DAO coin limit order entry mapping.
 	DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry
 
+	// DAO coin last trade price mapping. Map key is the directed coin pair.
+	DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry map[DAOCoinPairMapKey]*DAOCoinLastTradePriceEntry
+
+	// DAO coin metadata mapping. Map key is the coin's creator PKID.
+	DAOCoinCreatorPKIDToDAOCoinMetadataEntry map[PKID]*DAOCoinMetadataEntry
+
+	// External header anchoring mappings
+	ExternalHeaderRelayerPublicKeyToEntry     map[PkMapKey]*ExternalHeaderRelayerEntry
+	ExternalHeaderMapKeyToExternalHeaderEntry map[ExternalHeaderMapKey]*ExternalHeaderEntry
+
+	// Exchange rate feed mapping. Map key is the feed's public key.
+	ExchangeRateFeedPublicKeyToEntry map[PkMapKey]*ExchangeRateFeedEntry
+
+	// Profile pics offloaded from ProfileEntries. Map key is the sha256 hash of the pic.
+	ProfilePicBlobHashToBlob map[BlockHash][]byte
+
+	// Dead key registry mapping. Map key is the dead public key.
+	DeadKeyPublicKeyToEntry map[PkMapKey]*DeadKeyEntry
+
+	// Multisig mapping. Map key is the owner's PKID.
+	MultisigOwnerPKIDToEntry map[PKID]*MultisigEntry
+
+	// DAO coin stream mapping. Map key is the StreamID.
+	DAOCoinStreamIDToEntry map[BlockHash]*DAOCoinStreamEntry
+
+	// Governance mappings. Map keys are the ProposalID and the ProposalID and VoterPKID.
+	ProposalIDToProposalEntry map[BlockHash]*ProposalEntry
+	VoteMapKeyToVoteEntry     map[VoteMapKey]*VoteEntry
+
+	// Royalty split mapping. Map key is the RoyaltySplitID.
+	RoyaltySplitIDToRoyaltySplitEntry map[BlockHash]*RoyaltySplitEntry
+
+	// NFT bundle mapping. Map key is the BundleID.
+	NFTBundleIDToNFTBundleEntry map[BlockHash]*NFTBundleEntry
+
+	// NFT swap mapping. Map key is the SwapID.
+	NFTSwapIDToNFTSwapEntry map[BlockHash]*NFTSwapEntry
+
+	// Escrow mapping. Map key is the EscrowID.
+	EscrowIDToEscrowEntry map[BlockHash]*EscrowEntry
+
+	// Bids archived when NFTs are sold. Only populated if NFTBidArchiveDepth is set.
+	NFTBidArchiveKeyToNFTBidEntry map[NFTBidArchiveKey]*NFTBidEntry
+
+	// DAO coin limit order fill mapping
+	DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry map[DAOCoinLimitOrderFillMapKey]*DAOCoinLimitOrderFillEntry
+
 	// Association mappings
 	AssociationMapKeyToUserAssociationEntry map[AssociationMapKey]*UserAssociationEntry
 	AssociationMapKeyToPostAssociationEntry map[AssociationMapKey]*PostAssociationEntry
@@ -129,6 +179,14 @@ type UtxoView struct {
 	// Locked stake mappings
 	LockedStakeMapKeyToLockedStakeEntry map[LockedStakeMapKey]*LockedStakeEntry
 
+	// Validator reward index mappings
+	ValidatorPKIDToValidatorRewardIndexEntry map[PKID]*ValidatorRewardIndexEntry
+	// Validator reward index as of the end of an epoch in which stake was added
+	ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry map[ValidatorRewardIndexAtEpochEndMapKey]*ValidatorRewardIndexEntry
+
+	// Validator epoch performance mappings
+	ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry map[ValidatorEpochPerformanceMapKey]*ValidatorEpochPerformanceEntry
+
 	// Locked DAO coin and locked DESO balance entry mapping.
 	// NOTE: See comment on LockedBalanceEntryKey before altering.
 	LockedBalanceEntryKeyToLockedBalanceEntry map[LockedBalanceEntryKey]*LockedBalanceEntry
@@ -196,26 +254,34 @@ type UtxoView struct {
 	Snapshot *Snapshot
 	// EventManager is used to emit callbacks when certain actions are triggered.
 	EventManager *EventManager
+	// StorageBackend is the third-party backend the view reads entries that aren't in it from.
+	// It's nil if the view reads from the built-in badger and Postgres backends.
+	StorageBackend StorageBackend
 }
 
 // Assumes the db Handle is already set on the view, but otherwise the
 // initialization is full.
 func (bav *UtxoView) _ResetViewMappingsAfterFlush() {
+	dbAdapter := bav.GetDbAdapter()
+
 	// Utxo data
 	bav.UtxoKeyToUtxoEntry = make(map[UtxoKey]*UtxoEntry)
 	// TODO: Deprecate this value
-	bav.NumUtxoEntries = GetUtxoNumEntries(bav.Handle, bav.Snapshot)
+	bav.NumUtxoEntries = dbAdapter.GetUtxoNumEntries()
 	bav.PublicKeyToDeSoBalanceNanos = make(map[PublicKey]uint64)
 
 	// BitcoinExchange data
-	bav.NanosPurchased = DbGetNanosPurchased(bav.Handle, bav.Snapshot)
-	bav.USDCentsPerBitcoin = DbGetUSDCentsPerBitcoinExchangeRate(bav.Handle, bav.Snapshot)
-	bav.GlobalParamsEntry = DbGetGlobalParamsEntry(bav.Handle, bav.Snapshot)
+	bav.NanosPurchased = dbAdapter.GetNanosPurchased()
+	bav.USDCentsPerBitcoin = dbAdapter.GetUSDCentsPerBitcoinExchangeRate()
+	bav.GlobalParamsEntry = dbAdapter.GetGlobalParamsEntry()
 	bav.BitcoinBurnTxIDs = make(map[BlockHash]bool)
 
 	// Forbidden block signature pub key info.
 	bav.ForbiddenPubKeyToForbiddenPubKeyEntry = make(map[PkMapKey]*ForbiddenPubKeyEntry)
 
+	// Block producer registry entries
+	bav.BlockProducerPublicKeyToRegistryEntry = make(map[PkMapKey]*BlockProducerRegistryEntry)
+
 	// Post and profile data
 	bav.PostHashToPostEntry = make(map[BlockHash]*PostEntry)
 	bav.PublicKeyToPKIDEntry = make(map[PkMapKey]*PKIDEntry)
@@ -270,6 +336,52 @@ func (bav *UtxoView) _ResetViewMappingsAfterFlush() {
 	// DAO Coin Limit Order Entries
 	bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry = make(map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry)
 
+	// DAO Coin Last Trade Price Entries
+	bav.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry = make(map[DAOCoinPairMapKey]*DAOCoinLastTradePriceEntry)
+
+	// DAO Coin Metadata Entries
+	bav.DAOCoinCreatorPKIDToDAOCoinMetadataEntry = make(map[PKID]*DAOCoinMetadataEntry)
+
+	// External header anchoring entries
+	bav.ExternalHeaderRelayerPublicKeyToEntry = make(map[PkMapKey]*ExternalHeaderRelayerEntry)
+	bav.ExternalHeaderMapKeyToExternalHeaderEntry = make(map[ExternalHeaderMapKey]*ExternalHeaderEntry)
+
+	// Exchange rate feed entries
+	bav.ExchangeRateFeedPublicKeyToEntry = make(map[PkMapKey]*ExchangeRateFeedEntry)
+
+	// Profile pic blobs
+	bav.ProfilePicBlobHashToBlob = make(map[BlockHash][]byte)
+
+	// Dead key entries
+	bav.DeadKeyPublicKeyToEntry = make(map[PkMapKey]*DeadKeyEntry)
+
+	// Multisig entries
+	bav.MultisigOwnerPKIDToEntry = make(map[PKID]*MultisigEntry)
+
+	// DAO coin stream entries
+	bav.DAOCoinStreamIDToEntry = make(map[BlockHash]*DAOCoinStreamEntry)
+
+	// Governance entries
+	bav.ProposalIDToProposalEntry = make(map[BlockHash]*ProposalEntry)
+	bav.VoteMapKeyToVoteEntry = make(map[VoteMapKey]*VoteEntry)
+
+	// Royalty split entries
+	bav.RoyaltySplitIDToRoyaltySplitEntry = make(map[BlockHash]*RoyaltySplitEntry)
+
+	// NFT bundle entries
+	bav.NFTBundleIDToNFTBundleEntry = make(map[BlockHash]*NFTBundleEntry)
+
+	// NFT swap entries
+	bav.NFTSwapIDToNFTSwapEntry = make(map[BlockHash]*NFTSwapEntry)
+
+	// Escrow entries
+	bav.EscrowIDToEscrowEntry = make(map[BlockHash]*EscrowEntry)
+	bav.NFTBidArchiveKeyToNFTBidEntry = make(map[NFTBidArchiveKey]*NFTBidEntry)
+
+	// DAO coin limit order fill entries
+	bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry = make(
+		map[DAOCoinLimitOrderFillMapKey]*DAOCoinLimitOrderFillEntry)
+
 	// Association entries
 	bav.AssociationMapKeyToUserAssociationEntry = make(map[AssociationMapKey]*UserAssociationEntry)
 	bav.AssociationMapKeyToPostAssociationEntry = make(map[AssociationMapKey]*PostAssociationEntry)
@@ -294,6 +406,17 @@ func (bav *UtxoView) _ResetViewMappingsAfterFlush() {
 	// LockedStakeEntries
 	bav.LockedStakeMapKeyToLockedStakeEntry = make(map[LockedStakeMapKey]*LockedStakeEntry)
 
+	// ValidatorRewardIndexEntries
+	bav.ValidatorPKIDToValidatorRewardIndexEntry = make(map[PKID]*ValidatorRewardIndexEntry)
+	bav.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry = make(
+		map[ValidatorRewardIndexAtEpochEndMapKey]*ValidatorRewardIndexEntry,
+	)
+
+	// ValidatorEpochPerformanceEntries
+	bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry = make(
+		map[ValidatorEpochPerformanceMapKey]*ValidatorEpochPerformanceEntry,
+	)
+
 	// CurrentEpochEntry
 	bav.CurrentEpochEntry = nil
 
@@ -316,7 +439,8 @@ func (bav *UtxoView) _ResetViewMappingsAfterFlush() {
 }
 
 func (bav *UtxoView) CopyUtxoView() *UtxoView {
-	newView := initNewUtxoView(bav.Handle, bav.Params, bav.Postgres, bav.Snapshot, bav.EventManager)
+	newView := initNewUtxoView(bav.Handle, bav.Params, bav.Postgres, bav.Snapshot, bav.EventManager,
+		bav.StorageBackend)
 
 	newView.TipHash = bav.TipHash.NewBlockHash()
 	// Handle items loaded from DB with _ResetViewMappingsAfterFlush
@@ -363,6 +487,13 @@ func (bav *UtxoView) CopyUtxoView() *UtxoView {
 		newView.ForbiddenPubKeyToForbiddenPubKeyEntry[pkMapKey] = forbiddenPubKeyEntry.Copy()
 	}
 
+	// Copy the block producer registry map
+	newView.BlockProducerPublicKeyToRegistryEntry = make(
+		map[PkMapKey]*BlockProducerRegistryEntry, len(bav.BlockProducerPublicKeyToRegistryEntry))
+	for pkMapKey, registryEntry := range bav.BlockProducerPublicKeyToRegistryEntry {
+		newView.BlockProducerPublicKeyToRegistryEntry[pkMapKey] = registryEntry.Copy()
+	}
+
 	// Copy the post data
 	newView.PostHashToPostEntry = make(map[BlockHash]*PostEntry, len(bav.PostHashToPostEntry))
 	for postHash, postEntry := range bav.PostHashToPostEntry {
@@ -559,6 +690,117 @@ func (bav *UtxoView) CopyUtxoView() *UtxoView {
 		newView.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[entryKey] = &newEntry
 	}
 
+	// Copy the DAO Coin Last Trade Price Entries
+	newView.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry = make(map[DAOCoinPairMapKey]*DAOCoinLastTradePriceEntry,
+		len(bav.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry))
+	for entryKey, entry := range bav.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry {
+		newView.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry[entryKey] = entry.Copy()
+	}
+
+	// Copy the DAO Coin Metadata Entries
+	newView.DAOCoinCreatorPKIDToDAOCoinMetadataEntry = make(map[PKID]*DAOCoinMetadataEntry,
+		len(bav.DAOCoinCreatorPKIDToDAOCoinMetadataEntry))
+	for creatorPKID, entry := range bav.DAOCoinCreatorPKIDToDAOCoinMetadataEntry {
+		newView.DAOCoinCreatorPKIDToDAOCoinMetadataEntry[creatorPKID] = entry.Copy()
+	}
+
+	// Copy the external header anchoring entries
+	newView.ExternalHeaderRelayerPublicKeyToEntry = make(map[PkMapKey]*ExternalHeaderRelayerEntry,
+		len(bav.ExternalHeaderRelayerPublicKeyToEntry))
+	for pkMapKey, entry := range bav.ExternalHeaderRelayerPublicKeyToEntry {
+		newView.ExternalHeaderRelayerPublicKeyToEntry[pkMapKey] = entry.Copy()
+	}
+	newView.ExternalHeaderMapKeyToExternalHeaderEntry = make(map[ExternalHeaderMapKey]*ExternalHeaderEntry,
+		len(bav.ExternalHeaderMapKeyToExternalHeaderEntry))
+	for mapKey, entry := range bav.ExternalHeaderMapKeyToExternalHeaderEntry {
+		newView.ExternalHeaderMapKeyToExternalHeaderEntry[mapKey] = entry.Copy()
+	}
+
+	// Copy the exchange rate feed entries
+	newView.ExchangeRateFeedPublicKeyToEntry = make(map[PkMapKey]*ExchangeRateFeedEntry,
+		len(bav.ExchangeRateFeedPublicKeyToEntry))
+	for pkMapKey, entry := range bav.ExchangeRateFeedPublicKeyToEntry {
+		newView.ExchangeRateFeedPublicKeyToEntry[pkMapKey] = entry.Copy()
+	}
+
+	// Copy the profile pic blobs. Blobs are never modified once they're added, so
+	// they're shared between the views.
+	newView.ProfilePicBlobHashToBlob = make(map[BlockHash][]byte, len(bav.ProfilePicBlobHashToBlob))
+	for blobHash, blob := range bav.ProfilePicBlobHashToBlob {
+		newView.ProfilePicBlobHashToBlob[blobHash] = blob
+	}
+
+	// Copy the dead key entries
+	newView.DeadKeyPublicKeyToEntry = make(map[PkMapKey]*DeadKeyEntry, len(bav.DeadKeyPublicKeyToEntry))
+	for pkMapKey, entry := range bav.DeadKeyPublicKeyToEntry {
+		newView.DeadKeyPublicKeyToEntry[pkMapKey] = entry.Copy()
+	}
+
+	// Copy the multisig entries
+	newView.MultisigOwnerPKIDToEntry = make(map[PKID]*MultisigEntry, len(bav.MultisigOwnerPKIDToEntry))
+	for pkid, entry := range bav.MultisigOwnerPKIDToEntry {
+		newView.MultisigOwnerPKIDToEntry[pkid] = entry.Copy()
+	}
+
+	// Copy the DAO coin stream entries
+	newView.DAOCoinStreamIDToEntry = make(map[BlockHash]*DAOCoinStreamEntry, len(bav.DAOCoinStreamIDToEntry))
+	for streamID, entry := range bav.DAOCoinStreamIDToEntry {
+		newView.DAOCoinStreamIDToEntry[streamID] = entry.Copy()
+	}
+
+	// Copy the governance entries
+	newView.ProposalIDToProposalEntry = make(map[BlockHash]*ProposalEntry, len(bav.ProposalIDToProposalEntry))
+	for proposalID, entry := range bav.ProposalIDToProposalEntry {
+		newView.ProposalIDToProposalEntry[proposalID] = entry.Copy()
+	}
+	newView.VoteMapKeyToVoteEntry = make(map[VoteMapKey]*VoteEntry, len(bav.VoteMapKeyToVoteEntry))
+	for mapKey, entry := range bav.VoteMapKeyToVoteEntry {
+		newView.VoteMapKeyToVoteEntry[mapKey] = entry.Copy()
+	}
+
+	// Copy the royalty split entries
+	newView.RoyaltySplitIDToRoyaltySplitEntry = make(map[BlockHash]*RoyaltySplitEntry,
+		len(bav.RoyaltySplitIDToRoyaltySplitEntry))
+	for royaltySplitID, entry := range bav.RoyaltySplitIDToRoyaltySplitEntry {
+		newView.RoyaltySplitIDToRoyaltySplitEntry[royaltySplitID] = entry.Copy()
+	}
+
+	// Copy the NFT bundle entries
+	newView.NFTBundleIDToNFTBundleEntry = make(map[BlockHash]*NFTBundleEntry,
+		len(bav.NFTBundleIDToNFTBundleEntry))
+	for bundleID, entry := range bav.NFTBundleIDToNFTBundleEntry {
+		newView.NFTBundleIDToNFTBundleEntry[bundleID] = entry.Copy()
+	}
+
+	// Copy the NFT swap entries
+	newView.NFTSwapIDToNFTSwapEntry = make(map[BlockHash]*NFTSwapEntry,
+		len(bav.NFTSwapIDToNFTSwapEntry))
+	for swapID, entry := range bav.NFTSwapIDToNFTSwapEntry {
+		newView.NFTSwapIDToNFTSwapEntry[swapID] = entry.Copy()
+	}
+
+	// Copy the escrow entries
+	newView.EscrowIDToEscrowEntry = make(map[BlockHash]*EscrowEntry,
+		len(bav.EscrowIDToEscrowEntry))
+	for escrowID, entry := range bav.EscrowIDToEscrowEntry {
+		newView.EscrowIDToEscrowEntry[escrowID] = entry.Copy()
+	}
+
+	// Copy the archived NFT bids
+	newView.NFTBidArchiveKeyToNFTBidEntry = make(map[NFTBidArchiveKey]*NFTBidEntry,
+		len(bav.NFTBidArchiveKeyToNFTBidEntry))
+	for archiveKey, entry := range bav.NFTBidArchiveKeyToNFTBidEntry {
+		newView.NFTBidArchiveKeyToNFTBidEntry[archiveKey] = entry.Copy()
+	}
+
+	// Copy the DAO coin limit order fill entries
+	newView.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry = make(
+		map[DAOCoinLimitOrderFillMapKey]*DAOCoinLimitOrderFillEntry,
+		len(bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry))
+	for mapKey, entry := range bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry {
+		newView.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry[mapKey] = entry.Copy()
+	}
+
 	// Copy the Association entries
 	newView.AssociationMapKeyToUserAssociationEntry = make(map[AssociationMapKey]*UserAssociationEntry, len(bav.AssociationMapKeyToUserAssociationEntry))
 	for entryKey, entry := range bav.AssociationMapKeyToUserAssociationEntry {
@@ -626,6 +868,30 @@ func (bav *UtxoView) CopyUtxoView() *UtxoView {
 		newView.LockedStakeMapKeyToLockedStakeEntry[entryKey] = entry.Copy()
 	}
 
+	// Copy the ValidatorRewardIndexEntries
+	newView.ValidatorPKIDToValidatorRewardIndexEntry = make(
+		map[PKID]*ValidatorRewardIndexEntry, len(bav.ValidatorPKIDToValidatorRewardIndexEntry),
+	)
+	for entryKey, entry := range bav.ValidatorPKIDToValidatorRewardIndexEntry {
+		newView.ValidatorPKIDToValidatorRewardIndexEntry[entryKey] = entry.Copy()
+	}
+	newView.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry = make(
+		map[ValidatorRewardIndexAtEpochEndMapKey]*ValidatorRewardIndexEntry,
+		len(bav.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry),
+	)
+	for entryKey, entry := range bav.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry {
+		newView.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry[entryKey] = entry.Copy()
+	}
+
+	// Copy the ValidatorEpochPerformanceEntries
+	newView.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry = make(
+		map[ValidatorEpochPerformanceMapKey]*ValidatorEpochPerformanceEntry,
+		len(bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry),
+	)
+	for entryKey, entry := range bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry {
+		newView.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry[entryKey] = entry.Copy()
+	}
+
 	// Copy the CurrentEpochEntry
 	if bav.CurrentEpochEntry != nil {
 		newView.CurrentEpochEntry = bav.CurrentEpochEntry.Copy()
@@ -688,9 +954,10 @@ func NewUtxoViewWithSnapshotCache(
 	_postgres *Postgres,
 	_snapshot *Snapshot,
 	_eventManager *EventManager,
+	_storageBackend StorageBackend,
 	_snapshotCache *SnapshotCache,
 ) *UtxoView {
-	utxoView := NewUtxoView(_handle, _params, _postgres, _snapshot, _eventManager)
+	utxoView := NewUtxoViewWithStorageBackend(_handle, _params, _postgres, _snapshot, _eventManager, _storageBackend)
 	if _snapshotCache != nil {
 		allValidatorSetEntries := _snapshotCache.GetAllCachedSnapshotValidatorSetEntries()
 		for snapshotAtEpochNumber, validatorSetEntries := range allValidatorSetEntries {
@@ -727,13 +994,15 @@ func initNewUtxoView(
 	_postgres *Postgres,
 	_snapshot *Snapshot,
 	_eventManager *EventManager,
+	_storageBackend StorageBackend,
 ) *UtxoView {
 	return &UtxoView{
-		Handle:       _handle,
-		Params:       _params,
-		Postgres:     _postgres,
-		Snapshot:     _snapshot,
-		EventManager: _eventManager,
+		Handle:         _handle,
+		Params:         _params,
+		Postgres:       _postgres,
+		Snapshot:       _snapshot,
+		EventManager:   _eventManager,
+		StorageBackend: _storageBackend,
 		// Set everything else in _ResetViewMappings()
 	}
 }
@@ -745,8 +1014,21 @@ func NewUtxoView(
 	_snapshot *Snapshot,
 	_eventManager *EventManager,
 ) *UtxoView {
+	return NewUtxoViewWithStorageBackend(_handle, _params, _postgres, _snapshot, _eventManager, nil)
+}
+
+// NewUtxoViewWithStorageBackend returns a view that reads the entries that aren't in it from
+// the storage backend, or from the built-in backends if it's nil.
+func NewUtxoViewWithStorageBackend(
+	_handle *badger.DB,
+	_params *DeSoParams,
+	_postgres *Postgres,
+	_snapshot *Snapshot,
+	_eventManager *EventManager,
+	_storageBackend StorageBackend,
+) *UtxoView {
 
-	view := initNewUtxoView(_handle, _params, _postgres, _snapshot, _eventManager)
+	view := initNewUtxoView(_handle, _params, _postgres, _snapshot, _eventManager, _storageBackend)
 
 	// Note that the TipHash does not get reset as part of
 	// _ResetViewMappingsAfterFlush because it is not something that is affected by a
@@ -754,14 +1036,7 @@ func NewUtxoView(
 	// whether or not the view is flushed or not. Additionally the utxo view does
 	// not concern itself with the header chain (see comment on GetBestHash for more
 	// info on that).
-	if view.Postgres != nil {
-		pgChain := view.Postgres.GetChain(MAIN_CHAIN)
-		if pgChain != nil {
-			view.TipHash = view.Postgres.GetChain(MAIN_CHAIN).TipHash
-		}
-	} else {
-		view.TipHash = DbGetBestHash(view.Handle, view.Snapshot, ChainTypeDeSoBlock /* don't get the header chain */)
-	}
+	view.TipHash = view.GetDbAdapter().GetBestHash(ChainTypeDeSoBlock /* don't get the header chain */)
 
 	// This function is generally used to reset the view after a flush has been performed
 	// but we can use it here to initialize the mappings.
@@ -810,11 +1085,7 @@ func (bav *UtxoView) GetUtxoEntryForUtxoKey(utxoKeyArg *UtxoKey) *UtxoEntry {
 	// If the utxo entry isn't in our in-memory data structure, fetch it from the
 	// db.
 	if !ok {
-		if bav.Postgres != nil {
-			utxoEntry = bav.Postgres.GetUtxoEntryForUtxoKey(utxoKey)
-		} else {
-			utxoEntry = DbGetUtxoEntryForUtxoKey(bav.Handle, bav.Snapshot, utxoKey)
-		}
+		utxoEntry = bav.GetDbAdapter().GetUtxoEntryForUtxoKey(utxoKey)
 		if utxoEntry == nil {
 			// This means the utxo is neither in our map nor in the db so
 			// it doesn't exist. Return nil to signal that in this case.
@@ -1248,6 +1519,14 @@ func (bav *UtxoView) _disconnectBasicTransfer(currentTxn *MsgDeSoTxn, txnHash *B
 		operationIndex--
 	}
 
+	// Next, check whether the fee was paid in a DAO coin. The conversion is reverted after the
+	// transactor's balance is unspent below, since the transactor spent the DESO it received.
+	var daoCoinFeeOperation *UtxoOperation
+	if operationIndex >= 0 && utxoOpsForTxn[operationIndex].Type == OperationTypeDAOCoinFee {
+		daoCoinFeeOperation = utxoOpsForTxn[operationIndex]
+		operationIndex--
+	}
+
 	// If this is a balance model basic transfer, the disconnect is simplified.  We first
 	// loop over the outputs and subtract the amounts from each recipient's balance, then
 	// we add the spent DESO + txn fees back to the sender's balance. In the balance model
@@ -1275,6 +1554,11 @@ func (bav *UtxoView) _disconnectBasicTransfer(currentTxn *MsgDeSoTxn, txnHash *B
 				}
 			}
 		}
+		if daoCoinFeeOperation != nil {
+			if err := bav._disconnectDAOCoinFee(currentTxn, daoCoinFeeOperation); err != nil {
+				return errors.Wrapf(err, "_disconnectBasicTransfer: ")
+			}
+		}
 		return nil
 	}
 	// If this is a UTXO model basic transfer, then loop through the transaction's
@@ -1423,6 +1707,38 @@ func (bav *UtxoView) _disconnectUpdateGlobalParams(
 		bav.ForbiddenPubKeyToForbiddenPubKeyEntry[pkMapKey] = operationData.PrevForbiddenPubKeyEntry
 	}
 
+	// Reset the block producer registry entry if the txn modified it. If the public key
+	// wasn't registered before the txn, then we delete its entry.
+	if blockProducerRegistryPubKey, exists := currentTxn.ExtraData[BlockProducerRegistryPublicKeyKey]; exists {
+		if operationData.PrevBlockProducerRegistryEntry != nil {
+			bav._setBlockProducerRegistryEntryMappings(operationData.PrevBlockProducerRegistryEntry)
+		} else {
+			bav._deleteBlockProducerRegistryEntryMappings(
+				&BlockProducerRegistryEntry{PublicKey: blockProducerRegistryPubKey},
+			)
+		}
+	}
+
+	// Reset the external header relayer registry entry if the txn modified it. If the public
+	// key wasn't registered before the txn, then we delete its entry.
+	if relayerPubKey, exists := currentTxn.ExtraData[ExternalHeaderRelayerPublicKeyKey]; exists {
+		if operationData.PrevExternalHeaderRelayerEntry != nil {
+			bav._setExternalHeaderRelayerEntryMappings(operationData.PrevExternalHeaderRelayerEntry)
+		} else {
+			bav._deleteExternalHeaderRelayerEntryMappings(&ExternalHeaderRelayerEntry{PublicKey: relayerPubKey})
+		}
+	}
+
+	// Reset the exchange rate feed entry if the txn modified it. If the public key wasn't a
+	// registered feed before the txn, then we delete its entry.
+	if feedPubKey, exists := currentTxn.ExtraData[ExchangeRateFeedPublicKeyKey]; exists {
+		if operationData.PrevExchangeRateFeedEntry != nil {
+			bav._setExchangeRateFeedEntryMappings(operationData.PrevExchangeRateFeedEntry)
+		} else {
+			bav._deleteExchangeRateFeedEntryMappings(&ExchangeRateFeedEntry{PublicKey: feedPubKey})
+		}
+	}
+
 	// Now revert the basic transfer with the remaining operations. Cut off
 	// the UpdateGlobalParams operation at the end since we just reverted it.
 	return bav._disconnectBasicTransfer(
@@ -1522,6 +1838,10 @@ func (bav *UtxoView) DisconnectTransaction(currentTxn *MsgDeSoTxn, txnHash *Bloc
 		return bav._disconnectDAOCoinLimitOrder(
 			OperationTypeDAOCoinLimitOrder, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
 
+	case TxnTypeDAOCoinLimitOrderBatch:
+		return bav._disconnectDAOCoinLimitOrderBatch(
+			OperationTypeDAOCoinLimitOrderBatch, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
 	case TxnTypeSwapIdentity:
 		return bav._disconnectSwapIdentity(
 			OperationTypeSwapIdentity, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
@@ -1619,6 +1939,43 @@ func (bav *UtxoView) DisconnectTransaction(currentTxn *MsgDeSoTxn, txnHash *Bloc
 			OperationTypeCoinLockupTransfer, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
 	case TxnTypeCoinUnlock:
 		return bav._disconnectCoinUnlock(OperationTypeCoinUnlock, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeAnchorExternalHeaders:
+		return bav._disconnectAnchorExternalHeaders(
+			OperationTypeAnchorExternalHeaders, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeRegisterMultisig:
+		return bav._disconnectRegisterMultisig(
+			OperationTypeRegisterMultisig, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeDAOCoinStream:
+		return bav._disconnectDAOCoinStream(
+			OperationTypeDAOCoinStream, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeCreateProposal:
+		return bav._disconnectCreateProposal(
+			OperationTypeCreateProposal, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeCastVote:
+		return bav._disconnectCastVote(
+			OperationTypeCastVote, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeDAOCoinMultiTransfer:
+		return bav._disconnectDAOCoinMultiTransfer(
+			OperationTypeDAOCoinMultiTransfer, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeRoyaltySplit:
+		return bav._disconnectRoyaltySplit(
+			OperationTypeRoyaltySplit, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeLeaseNFT:
+		return bav._disconnectNFTLease(
+			OperationTypeLeaseNFT, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeEndNFTLease:
+		return bav._disconnectNFTLease(
+			OperationTypeEndNFTLease, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeNFTBundle:
+		return bav._disconnectNFTBundle(
+			OperationTypeNFTBundle, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+	case TxnTypeNFTSwap:
+		return bav._disconnectNFTSwap(
+			OperationTypeNFTSwap, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
+	case TxnTypeSlashValidator:
+		return bav._disconnectSlashValidator(
+			OperationTypeSlashValidator, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
 
 	}
 
@@ -1765,13 +2122,18 @@ func (bav *UtxoView) DisconnectBlock(
 					return fmt.Errorf("DisconnectBlock: Found add balance operation in block %d that is not the end "+
 						"of an epoch", desoBlock.Header.Height)
 				}
-				if len(utxoOp.PrevStakeEntries) != 1 {
-					return fmt.Errorf("DisconnectBlock: Expected exactly one prev stake entry for stake distribution op")
-				}
 				if utxoOp.PrevValidatorEntry == nil {
 					return fmt.Errorf("DisconnectBlock: Expected prev validator entry for stake distribution op")
 				}
-				bav._setStakeEntryMappings(utxoOp.PrevStakeEntries[0])
+				// Delegators' restaked rewards are added to the validator's stake and reward index
+				// entry rather than to a StakeEntry.
+				if utxoOp.PrevValidatorRewardIndexEntry != nil {
+					bav._setValidatorRewardIndexEntryMappings(utxoOp.PrevValidatorRewardIndexEntry)
+				} else if len(utxoOp.PrevStakeEntries) != 1 {
+					return fmt.Errorf("DisconnectBlock: Expected exactly one prev stake entry for stake distribution op")
+				} else {
+					bav._setStakeEntryMappings(utxoOp.PrevStakeEntries[0])
+				}
 				bav._setValidatorEntryMappings(utxoOp.PrevValidatorEntry)
 			case OperationTypeSetValidatorLastActiveAtEpoch:
 				if utxoOp.PrevValidatorEntry == nil {
@@ -1779,6 +2141,24 @@ func (bav *UtxoView) DisconnectBlock(
 						"at epoch op")
 				}
 				bav._setValidatorEntryMappings(utxoOp.PrevValidatorEntry)
+			case OperationTypeUpdateValidatorEpochPerformance:
+				// An empty previous entry means the block created the entry, so we delete it.
+				for _, prevPerformanceEntry := range utxoOp.PrevValidatorEpochPerformanceEntries {
+					if prevPerformanceEntry.IsEmpty() {
+						bav._deleteValidatorEpochPerformanceEntryMappings(prevPerformanceEntry)
+					} else {
+						bav._setValidatorEpochPerformanceEntryMappings(prevPerformanceEntry)
+					}
+				}
+			case OperationTypeRegisterDeadKeys:
+				// The block added these entries to the registry, so we remove them.
+				for _, deadKeyEntry := range utxoOp.RegisteredDeadKeyEntries {
+					bav._deleteDeadKeyEntryMappings(deadKeyEntry)
+				}
+			case OperationTypeSettleNFTAuctions:
+				if err = bav._disconnectNFTAuctionSettlements(utxoOp, uint32(desoBlock.Header.Height)); err != nil {
+					return errors.Wrapf(err, "DisconnectBlock: ")
+				}
 			}
 		}
 	}
@@ -2154,10 +2534,18 @@ func (bav *UtxoView) _connectBasicTransferWithExtraSpend(
 	// the output from the transactor's balance before adding it to the recipient's
 	// balance. This ensures we never enter situations where we are calling _addDeSo
 	// before we call _spendBalance to verify that the transactor has the coins.
+	var daoCoinFeeUtxoOp *UtxoOperation
 	if blockHeight >= bav.Params.ForkHeights.BalanceModelBlockHeight &&
 		txn.TxnMeta.GetTxnType() != TxnTypeBlockReward {
 
+		// If the fee is paid in a DAO coin, convert it to DESO in the transactor's balance
+		// first so that the fee is spent below like any other.
 		var err error
+		daoCoinFeeUtxoOp, err = bav._connectDAOCoinFee(txn, blockHeight)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectBasicTransferWithExtraSpend ")
+		}
+
 		feePlusExtraSpend := txn.TxnFeeNanos
 		if err != nil {
 			return 0, 0, nil, errors.Wrapf(err, "_connectBasicTransferWithExtraSpend Problem adding txn fee and total output")
@@ -2199,6 +2587,12 @@ func (bav *UtxoView) _connectBasicTransferWithExtraSpend(
 		utxoOpsForTxn = append(utxoOpsForTxn, newUtxoOp)
 	}
 
+	// The DAO coin fee op goes after the outputs so that _disconnectBasicTransfer can find it
+	// right before the diamond and spending limit ops.
+	if daoCoinFeeUtxoOp != nil {
+		utxoOpsForTxn = append(utxoOpsForTxn, daoCoinFeeUtxoOp)
+	}
+
 	// Now that we have computed the outputs, we can finish processing diamonds if need be.
 	diamondPostHashBytes, hasDiamondPostHash := txn.ExtraData[DiamondPostHashKey]
 	diamondPostHash := &BlockHash{}
@@ -2346,6 +2740,10 @@ func (bav *UtxoView) _verifyTxnSignature(txn *MsgDeSoTxn, blockHeight uint32) er
 		if _, err := bav._verifySignature(txn, blockHeight); err != nil {
 			return errors.Wrapf(err, "_connectBasicTransferWithExtraSpend Problem verifying txn signature: ")
 		}
+		// An account with a multisig also needs its co-signers' signatures.
+		if err := bav._verifyMultisigSignatures(txn, blockHeight); err != nil {
+			return errors.Wrapf(err, "_connectBasicTransferWithExtraSpend Problem verifying multisig signatures: ")
+		}
 	}
 	return nil
 }
@@ -2367,8 +2765,24 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 		return utxoOpsForTxn, errors.Wrap(RuleErrorDerivedKeyNotAuthorized,
 			"_checkAndUpdateDerivedKeySpendingLimit: TransactionSpendingLimitTracker is nil")
 	}
+
+	// If the txn carries a derived key nonce, it must match the derived key's nonce, which then
+	// moves on so that the txn can't be replayed. This applies to unlimited keys too.
+	usedNonce, err := bav._checkAndIncrementDerivedKeyNonce(txn, &derivedKeyEntry, blockHeight)
+	if err != nil {
+		return utxoOpsForTxn, err
+	}
+
 	// If the derived key is an unlimited key, we don't need to further check nor update the spending limits whatsoever.
 	if derivedKeyEntry.TransactionSpendingLimitTracker.IsUnlimited {
+		if !usedNonce {
+			return utxoOpsForTxn, nil
+		}
+		bav._setDerivedKeyMapping(&derivedKeyEntry)
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type:                OperationTypeSpendingLimitAccounting,
+			PrevDerivedKeyEntry: prevDerivedKeyEntry,
+		})
 		return utxoOpsForTxn, nil
 	}
 
@@ -2417,9 +2831,54 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 	// Decrement the global limit by the spend amount
 	derivedKeyEntry.TransactionSpendingLimitTracker.GlobalDESOLimit -= spendAmount
 
+	// If the derived key has a recipient whitelist, every DESO output that doesn't go back
+	// to the owner must go to a whitelisted public key.
+	for _, utxoOp := range utxoOpsForTxn {
+		var recipientPublicKey []byte
+		if utxoOp.Type == OperationTypeAddUtxo && utxoOp.Entry.UtxoType == UtxoTypeOutput {
+			recipientPublicKey = utxoOp.Entry.PublicKey
+		} else if utxoOp.Type == OperationTypeAddBalance {
+			recipientPublicKey = utxoOp.BalancePublicKey
+		} else {
+			continue
+		}
+		if err := _checkDerivedKeyRecipientWhitelist(&derivedKeyEntry, txn.PublicKey, recipientPublicKey); err != nil {
+			return utxoOpsForTxn, err
+		}
+	}
+	// DAO coin streams and NFT swaps are only limited by their txn count, so the recipients
+	// of the coins and NFTs they move are checked here. Other txns that transfer to a
+	// recipient check it along with their limits below.
+	switch txnMeta := txn.TxnMeta.(type) {
+	case *DAOCoinStreamMetadata:
+		if txnMeta.OperationType == DAOCoinStreamOperationTypeCreate {
+			if err := _checkDerivedKeyRecipientWhitelist(
+				&derivedKeyEntry, txn.PublicKey, txnMeta.PayeePublicKey.ToBytes()); err != nil {
+				return utxoOpsForTxn, err
+			}
+		}
+	case *NFTSwapMetadata:
+		// Proposing a swap offers the proposer's NFT to the counterparty, and accepting it
+		// sends the counterparty's NFT to the proposer.
+		var recipientPublicKey []byte
+		if txnMeta.OperationType == NFTSwapOperationTypePropose {
+			recipientPublicKey = txnMeta.CounterpartyPublicKey
+		} else if txnMeta.OperationType == NFTSwapOperationTypeAccept {
+			for _, utxoOp := range utxoOpsForTxn {
+				if utxoOp.Type == OperationTypeNFTSwap && utxoOp.PrevNFTSwapEntry != nil {
+					recipientPublicKey = bav.GetPublicKeyForPKID(utxoOp.PrevNFTSwapEntry.ProposerPKID)
+				}
+			}
+		}
+		if recipientPublicKey != nil {
+			if err := _checkDerivedKeyRecipientWhitelist(&derivedKeyEntry, txn.PublicKey, recipientPublicKey); err != nil {
+				return utxoOpsForTxn, err
+			}
+		}
+	}
+
 	txnType := txn.TxnMeta.GetTxnType()
 
-	var err error
 	// Okay now we've validated that we can do the op. Decrement the special counters if applicable
 	switch txnType {
 	case TxnTypeCreatorCoin:
@@ -2440,12 +2899,26 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			derivedKeyEntry, txnMeta.ProfilePublicKey, creatorCoinLimitOperation); err != nil {
 			return utxoOpsForTxn, err
 		}
+		if creatorCoinLimitOperation == SellCreatorCoinOperation {
+			if derivedKeyEntry, err = bav._checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry(
+				derivedKeyEntry, txnMeta.ProfilePublicKey, txnMeta.CreatorCoinToSellNanos); err != nil {
+				return utxoOpsForTxn, err
+			}
+		}
 	case TxnTypeCreatorCoinTransfer:
 		txnMeta := txn.TxnMeta.(*CreatorCoinTransferMetadataa)
 		if derivedKeyEntry, err = bav._checkCreatorCoinLimitAndUpdateDerivedKeyEntry(
 			derivedKeyEntry, txnMeta.ProfilePublicKey, TransferCreatorCoinOperation); err != nil {
 			return utxoOpsForTxn, err
 		}
+		if derivedKeyEntry, err = bav._checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry(
+			derivedKeyEntry, txnMeta.ProfilePublicKey, txnMeta.CreatorCoinToTransferNanos); err != nil {
+			return utxoOpsForTxn, err
+		}
+		if err = _checkDerivedKeyRecipientWhitelist(
+			&derivedKeyEntry, txn.PublicKey, txnMeta.ReceiverPublicKey); err != nil {
+			return utxoOpsForTxn, err
+		}
 	case TxnTypeDAOCoin:
 		txnMeta := txn.TxnMeta.(*DAOCoinMetadata)
 		var daoCoinLimitOperation DAOCoinLimitOperation
@@ -2458,6 +2931,12 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			daoCoinLimitOperation = DisableMintingDAOCoinOperation
 		case DAOCoinOperationTypeUpdateTransferRestrictionStatus:
 			daoCoinLimitOperation = UpdateTransferRestrictionStatusDAOCoinOperation
+		case DAOCoinOperationTypeUpdateDecimals:
+			daoCoinLimitOperation = UpdateDecimalsDAOCoinOperation
+		case DAOCoinOperationTypeUpdateMetadata:
+			daoCoinLimitOperation = UpdateMetadataDAOCoinOperation
+		case DAOCoinOperationTypeUpdateLimitOrderRestriction:
+			daoCoinLimitOperation = UpdateLimitOrderRestrictionDAOCoinOperation
 		default:
 			return utxoOpsForTxn, errors.Wrapf(
 				RuleErrorDerivedKeyInvalidDAOCoinLimitOperation,
@@ -2474,10 +2953,49 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			derivedKeyEntry, txnMeta.ProfilePublicKey, TransferDAOCoinOperation); err != nil {
 			return utxoOpsForTxn, err
 		}
+		if derivedKeyEntry, err = bav._checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry(
+			derivedKeyEntry, txnMeta.ProfilePublicKey, &txnMeta.DAOCoinToTransferNanos); err != nil {
+			return utxoOpsForTxn, err
+		}
+		if err = _checkDerivedKeyRecipientWhitelist(
+			&derivedKeyEntry, txn.PublicKey, txnMeta.ReceiverPublicKey); err != nil {
+			return utxoOpsForTxn, err
+		}
+	case TxnTypeDAOCoinMultiTransfer:
+		// A multi-transfer counts as one transfer operation, and its total counts
+		// against the amount limit. Every recipient has to be whitelisted.
+		txnMeta := txn.TxnMeta.(*DAOCoinMultiTransferMetadata)
+		if derivedKeyEntry, err = bav._checkDAOCoinLimitAndUpdateDerivedKeyEntry(
+			derivedKeyEntry, txnMeta.ProfilePublicKey, TransferDAOCoinOperation); err != nil {
+			return utxoOpsForTxn, err
+		}
+		totalNanos, err := txnMeta.GetTotalDAOCoinToTransferNanos()
+		if err != nil {
+			return utxoOpsForTxn, errors.Wrapf(err, "_checkAndUpdateDerivedKeySpendingLimit: ")
+		}
+		if derivedKeyEntry, err = bav._checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry(
+			derivedKeyEntry, txnMeta.ProfilePublicKey, totalNanos); err != nil {
+			return utxoOpsForTxn, err
+		}
+		for _, recipient := range txnMeta.Recipients {
+			if err = _checkDerivedKeyRecipientWhitelist(
+				&derivedKeyEntry, txn.PublicKey, recipient.ReceiverPublicKey); err != nil {
+				return utxoOpsForTxn, err
+			}
+		}
 	case TxnTypeDAOCoinLimitOrder:
 		txnMeta := txn.TxnMeta.(*DAOCoinLimitOrderMetadata)
 		var buyingCoinPublicKey []byte
 		var sellingCoinPublicKey []byte
+		if txnMeta.CancelAll == DAOCoinLimitOrderCancelAllOrders {
+			// Cancelling all orders requires the limit for the pair of every order
+			// that's cancelled. We check each pair once.
+			if derivedKeyEntry, err = bav._checkDAOCoinLimitOrderCancelAllLimitAndUpdateDerivedKeyEntry(
+				derivedKeyEntry, txn.PublicKey, txnMeta); err != nil {
+				return utxoOpsForTxn, err
+			}
+			break
+		}
 		if txnMeta.CancelOrderID != nil {
 			orderEntry, err := bav.GetDAOCoinLimitOrderEntry(txnMeta.CancelOrderID)
 			if err != nil || orderEntry == nil {
@@ -2496,6 +3014,20 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			derivedKeyEntry, buyingCoinPublicKey, sellingCoinPublicKey); err != nil {
 			return utxoOpsForTxn, err
 		}
+		// Replacing an order also places a new one. If the new order is for a
+		// different pair than the cancelled one, it needs that pair's limit too.
+		if txnMeta.CancelOrderID != nil && txnMeta.ReplaceCancelledOrder &&
+			(!bytes.Equal(buyingCoinPublicKey, txnMeta.BuyingDAOCoinCreatorPublicKey.ToBytes()) ||
+				!bytes.Equal(sellingCoinPublicKey, txnMeta.SellingDAOCoinCreatorPublicKey.ToBytes())) {
+			if derivedKeyEntry, err = bav._checkDAOCoinLimitOrderLimitAndUpdateDerivedKeyEntry(
+				derivedKeyEntry, txnMeta.BuyingDAOCoinCreatorPublicKey.ToBytes(),
+				txnMeta.SellingDAOCoinCreatorPublicKey.ToBytes()); err != nil {
+				return utxoOpsForTxn, err
+			}
+		}
+	case TxnTypeDAOCoinLimitOrderBatch:
+		// Each order in the batch is checked against the DAO coin limit order limits
+		// as it's connected in _connectDAOCoinLimitOrderBatch.
 	case TxnTypeUpdateNFT:
 		txnMeta := txn.TxnMeta.(*UpdateNFTMetadata)
 		if derivedKeyEntry, err = _checkNFTLimitAndUpdateDerivedKeyEntry(
@@ -2526,6 +3058,10 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			derivedKeyEntry, txnMeta.NFTPostHash, txnMeta.SerialNumber, TransferNFTOperation); err != nil {
 			return utxoOpsForTxn, err
 		}
+		if err = _checkDerivedKeyRecipientWhitelist(
+			&derivedKeyEntry, txn.PublicKey, txnMeta.ReceiverPublicKey); err != nil {
+			return utxoOpsForTxn, err
+		}
 	case TxnTypeBurnNFT:
 		txnMeta := txn.TxnMeta.(*BurnNFTMetadata)
 		if derivedKeyEntry, err = _checkNFTLimitAndUpdateDerivedKeyEntry(
@@ -2618,6 +3154,10 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			derivedKeyEntry, txnMeta.ProfilePublicKey, CoinLockupOperation); err != nil {
 			return utxoOpsForTxn, err
 		}
+		if err = _checkDerivedKeyRecipientWhitelist(
+			&derivedKeyEntry, txn.PublicKey, txnMeta.RecipientPublicKey.ToBytes()); err != nil {
+			return utxoOpsForTxn, err
+		}
 	case TxnTypeUpdateCoinLockupParams:
 		txnUpdatesYieldCurve := false
 		txnUpdatesTransferRestrictions := false
@@ -2658,6 +3198,10 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			derivedKeyEntry, txnMeta.ProfilePublicKey, CoinLockupTransferOperation); err != nil {
 			return utxoOpsForTxn, err
 		}
+		if err = _checkDerivedKeyRecipientWhitelist(
+			&derivedKeyEntry, txn.PublicKey, txnMeta.RecipientPublicKey.ToBytes()); err != nil {
+			return utxoOpsForTxn, err
+		}
 	case TxnTypeCoinUnlock:
 		txnMeta := txn.TxnMeta.(*CoinUnlockMetadata)
 		if derivedKeyEntry, err = bav._checkLockupTxnSpendingLimitAndUpdateDerivedKey(
@@ -2682,6 +3226,26 @@ func (bav *UtxoView) _checkAndUpdateDerivedKeySpendingLimit(
 			derivedKeyEntry, txnMeta); err != nil {
 			return utxoOpsForTxn, err
 		}
+	case TxnTypeCreateProposal:
+		txnMeta := txn.TxnMeta.(*CreateProposalMetadata)
+		if derivedKeyEntry, err = bav._checkGovernanceLimitAndUpdateDerivedKeyEntry(
+			derivedKeyEntry, txnMeta.ProfilePublicKey.ToBytes(), CreateProposalGovernanceOperation); err != nil {
+			return utxoOpsForTxn, err
+		}
+	case TxnTypeCastVote:
+		txnMeta := txn.TxnMeta.(*CastVoteMetadata)
+		proposalEntry, err := bav.GetProposalEntry(txnMeta.ProposalID)
+		if err != nil {
+			return utxoOpsForTxn, errors.Wrapf(err, "_checkAndUpdateDerivedKeySpendingLimit: ")
+		}
+		if proposalEntry == nil {
+			return utxoOpsForTxn, errors.Wrapf(RuleErrorGovernanceProposalNotFound,
+				"_checkAndUpdateDerivedKeySpendingLimit: %v", txnMeta.ProposalID)
+		}
+		if derivedKeyEntry, err = bav._checkGovernanceLimitAndUpdateDerivedKeyEntry(
+			derivedKeyEntry, bav.GetPublicKeyForPKID(proposalEntry.ProfilePKID), CastVoteGovernanceOperation); err != nil {
+			return utxoOpsForTxn, err
+		}
 	default:
 		// If we get here, it means we're dealing with a txn that doesn't have any special
 		// granular limits to deal with. This means we just check whether we have
@@ -2924,6 +3488,111 @@ func (bav *UtxoView) _checkDAOCoinLimitAndUpdateDerivedKeyEntry(
 	return derivedKeyEntry, RuleErrorDerivedKeyDAOCoinOperationNotAuthorized
 }
 
+// _checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry checks that transferring the amount of the
+// creator's DAO coin is within the derived key's DAOCoinTransferLimitMap, and deducts it from the
+// limit. Both the limit for the creator and the limit for any DAO coin apply if they're present.
+// The limits aren't deleted when they run out, since a coin with no limit can be transferred freely.
+func (bav *UtxoView) _checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry(
+	derivedKeyEntry DerivedKeyEntry, creatorPublicKey []byte, amountBaseUnits *uint256.Int) (
+	_derivedKeyEntry DerivedKeyEntry, _err error) {
+
+	transferLimitMap := derivedKeyEntry.TransactionSpendingLimitTracker.DAOCoinTransferLimitMap
+	if len(transferLimitMap) == 0 {
+		return derivedKeyEntry, nil
+	}
+	pkidEntry := bav.GetPKIDForPublicKey(creatorPublicKey)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return derivedKeyEntry, fmt.Errorf("_checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry: creator pkid is deleted")
+	}
+	for _, creatorPKID := range []PKID{*pkidEntry.PKID, ZeroPKID} {
+		transferLimitBaseUnits, exists := transferLimitMap[creatorPKID]
+		if !exists {
+			continue
+		}
+		if amountBaseUnits.Gt(transferLimitBaseUnits) {
+			return derivedKeyEntry, errors.Wrapf(RuleErrorDerivedKeyDAOCoinTransferExceedsAmountLimit,
+				"_checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry: transfer of %v base units exceeds "+
+					"remaining limit of %v for creator %v", amountBaseUnits, transferLimitBaseUnits, creatorPKID)
+		}
+		transferLimitMap[creatorPKID] = uint256.NewInt().Sub(transferLimitBaseUnits, amountBaseUnits)
+	}
+	return derivedKeyEntry, nil
+}
+
+// _checkAndIncrementDerivedKeyNonce checks the nonce in the txn's ExtraData against the derived
+// key's nonce and increments the derived key's nonce if they match. It returns false if the txn
+// doesn't carry a nonce, in which case the derived key entry isn't modified.
+func (bav *UtxoView) _checkAndIncrementDerivedKeyNonce(
+	txn *MsgDeSoTxn, derivedKeyEntry *DerivedKeyEntry, blockHeight uint32) (_usedNonce bool, _err error) {
+
+	if blockHeight < bav.Params.ForkHeights.DerivedKeyNonceBlockHeight {
+		return false, nil
+	}
+	nonceBytes, exists := txn.ExtraData[DerivedKeyNonceKey]
+	if !exists {
+		return false, nil
+	}
+	expectedNonce, bytesRead := Uvarint(nonceBytes)
+	if bytesRead <= 0 || bytesRead != len(nonceBytes) {
+		return false, errors.Wrapf(RuleErrorDerivedKeyInvalidNonce,
+			"_checkAndIncrementDerivedKeyNonce: Problem decoding nonce %v", nonceBytes)
+	}
+	if expectedNonce != derivedKeyEntry.Nonce {
+		return false, errors.Wrapf(RuleErrorDerivedKeyNonceMismatch,
+			"_checkAndIncrementDerivedKeyNonce: Txn nonce %d doesn't match derived key nonce %d",
+			expectedNonce, derivedKeyEntry.Nonce)
+	}
+	derivedKeyEntry.Nonce++
+	return true, nil
+}
+
+// _checkDerivedKeyRecipientWhitelist checks that the derived key is allowed to send to the
+// recipient. Sending back to the owner is always allowed, as is sending to anyone when the
+// derived key doesn't have a recipient whitelist.
+func _checkDerivedKeyRecipientWhitelist(
+	derivedKeyEntry *DerivedKeyEntry, ownerPublicKey []byte, recipientPublicKey []byte) error {
+
+	recipientWhitelist := derivedKeyEntry.TransactionSpendingLimitTracker.RecipientWhitelist
+	if len(recipientWhitelist) == 0 || bytes.Equal(recipientPublicKey, ownerPublicKey) {
+		return nil
+	}
+	if len(recipientPublicKey) != btcec.PubKeyBytesLenCompressed || !recipientWhitelist[*NewPublicKey(recipientPublicKey)] {
+		return errors.Wrapf(RuleErrorDerivedKeyRecipientNotWhitelisted,
+			"_checkDerivedKeyRecipientWhitelist: recipient %v", PkToStringBoth(recipientPublicKey))
+	}
+	return nil
+}
+
+// _checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry checks that selling or transferring the
+// amount of the creator's coin is within the derived key's CreatorCoinSpendingLimitMap, and deducts
+// it from the limit. It follows the same rules as _checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry.
+func (bav *UtxoView) _checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry(
+	derivedKeyEntry DerivedKeyEntry, creatorPublicKey []byte, amountNanos uint64) (
+	_derivedKeyEntry DerivedKeyEntry, _err error) {
+
+	spendingLimitMap := derivedKeyEntry.TransactionSpendingLimitTracker.CreatorCoinSpendingLimitMap
+	if len(spendingLimitMap) == 0 {
+		return derivedKeyEntry, nil
+	}
+	pkidEntry := bav.GetPKIDForPublicKey(creatorPublicKey)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return derivedKeyEntry, fmt.Errorf("_checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry: creator pkid is deleted")
+	}
+	for _, creatorPKID := range []PKID{*pkidEntry.PKID, ZeroPKID} {
+		spendingLimitNanos, exists := spendingLimitMap[creatorPKID]
+		if !exists {
+			continue
+		}
+		if amountNanos > spendingLimitNanos {
+			return derivedKeyEntry, errors.Wrapf(RuleErrorDerivedKeyCreatorCoinSpendExceedsAmountLimit,
+				"_checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry: spend of %v nanos exceeds "+
+					"remaining limit of %v for creator %v", amountNanos, spendingLimitNanos, creatorPKID)
+		}
+		spendingLimitMap[creatorPKID] = spendingLimitNanos - amountNanos
+	}
+	return derivedKeyEntry, nil
+}
+
 // _checkDAOCoinLimitOrderLimitKeyAndUpdateDerivedKeyEntry checks if the DAOCoinLimitOrderLimitKey is present
 // in the DerivedKeyEntry's TransactionSpendingLimitTracker's DAOCoinLimitOrderLimitMap.
 // If the key is present, the operation is allowed and we decrement the number of operations remaining.
@@ -2965,6 +3634,39 @@ func _checkDAOCoinLimitOrderLimitKeyAndUpdateDerivedKeyEntry(
 // specified explicitly. There is no way to specify "any" DAO coins in the spending limit
 // because ZeroPKID, which we use to specify "any" in other spending limits, corresponds
 // to DESO for order book operations. We should fix this down the road.
+// _checkDAOCoinLimitOrderCancelAllLimitAndUpdateDerivedKeyEntry checks the derived key's DAO coin
+// limit order limit for every coin pair that a txn cancelling all of the transactor's orders cancels
+// orders of.
+func (bav *UtxoView) _checkDAOCoinLimitOrderCancelAllLimitAndUpdateDerivedKeyEntry(
+	derivedKeyEntry DerivedKeyEntry, transactorPublicKey []byte, txnMeta *DAOCoinLimitOrderMetadata) (
+	_derivedKeyEntry DerivedKeyEntry, _err error) {
+
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(transactorPublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return derivedKeyEntry, fmt.Errorf(
+			"_checkDAOCoinLimitOrderCancelAllLimitAndUpdateDerivedKeyEntry: transactor pkid is deleted")
+	}
+	ordersToCancel, err := bav.GetDAOCoinLimitOrdersToCancelAll(transactorPKIDEntry.PKID, txnMeta)
+	if err != nil {
+		return derivedKeyEntry, errors.Wrapf(err, "_checkDAOCoinLimitOrderCancelAllLimitAndUpdateDerivedKeyEntry: ")
+	}
+	checkedPairs := make(map[DAOCoinLimitOrderLimitKey]bool)
+	for _, order := range ordersToCancel {
+		pairKey := MakeDAOCoinLimitOrderLimitKey(*order.BuyingDAOCoinCreatorPKID, *order.SellingDAOCoinCreatorPKID)
+		if checkedPairs[pairKey] {
+			continue
+		}
+		checkedPairs[pairKey] = true
+		if derivedKeyEntry, err = bav._checkDAOCoinLimitOrderLimitAndUpdateDerivedKeyEntry(
+			derivedKeyEntry,
+			bav.GetPublicKeyForPKID(order.BuyingDAOCoinCreatorPKID),
+			bav.GetPublicKeyForPKID(order.SellingDAOCoinCreatorPKID)); err != nil {
+			return derivedKeyEntry, err
+		}
+	}
+	return derivedKeyEntry, nil
+}
+
 func (bav *UtxoView) _checkDAOCoinLimitOrderLimitAndUpdateDerivedKeyEntry(
 	derivedKeyEntry DerivedKeyEntry, buyingDAOCoinCreatorPublicKey []byte, sellingDAOCoinCreatorPublicKey []byte) (
 	_derivedKeyEntry DerivedKeyEntry, _err error) {
@@ -3416,6 +4118,12 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 					"_connectUpdateGlobalParams: BlockTimestampDriftNanoSecs must be >= 0",
 				)
 			}
+			if blockHeight >= bav.Params.ForkHeights.BlockTimestampMedianTimePastBlockHeight &&
+				val > bav.Params.MaxBlockTimestampDriftNanoSecs {
+				return 0, 0, nil, errors.Wrapf(RuleErrorBlockTimestampDriftNanoSecsTooHigh,
+					"_connectUpdateGlobalParams: BlockTimestampDriftNanoSecs %d exceeds max %d",
+					val, bav.Params.MaxBlockTimestampDriftNanoSecs)
+			}
 			newGlobalParamsEntry.BlockTimestampDriftNanoSecs = val
 		}
 		if len(extraData[MempoolMaxSizeBytesKey]) > 0 {
@@ -3628,6 +4336,224 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 		}
 	}
 
+	if len(extraData[JailMissedSlotsThresholdKey]) > 0 {
+		// The threshold is only enforced once validator performance is being tracked.
+		if blockHeight < bav.Params.ForkHeights.ValidatorPerformanceTrackingBlockHeight {
+			return 0, 0, nil, RuleErrorJailMissedSlotsThresholdBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[JailMissedSlotsThresholdKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode JailMissedSlotsThreshold as uint64",
+			)
+		}
+		if val < MinJailMissedSlotsThreshold {
+			return 0, 0, nil, RuleErrorJailMissedSlotsThresholdTooLow
+		}
+		newGlobalParamsEntry.JailMissedSlotsThreshold = val
+	}
+
+	if len(extraData[ValidatorSlashBasisPointsKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.ValidatorSlashingBlockHeight {
+			return 0, 0, nil, RuleErrorValidatorSlashBasisPointsBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[ValidatorSlashBasisPointsKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode ValidatorSlashBasisPoints as uint64",
+			)
+		}
+		if val > MaxBasisPoints {
+			return 0, 0, nil, RuleErrorValidatorSlashBasisPointsTooHigh
+		}
+		newGlobalParamsEntry.ValidatorSlashBasisPoints = val
+	}
+
+	if len(extraData[DAOCoinLimitOrderMakerFeeBasisPointsKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderTradingFeesBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderTradingFeesBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[DAOCoinLimitOrderMakerFeeBasisPointsKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode DAOCoinLimitOrderMakerFeeBasisPoints as uint64",
+			)
+		}
+		if val > MaxDAOCoinLimitOrderFeeBasisPoints {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderFeeBasisPointsTooHigh
+		}
+		newGlobalParamsEntry.DAOCoinLimitOrderMakerFeeBasisPoints = val
+	}
+
+	if len(extraData[DAOCoinLimitOrderTakerFeeBasisPointsKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderTradingFeesBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderTradingFeesBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[DAOCoinLimitOrderTakerFeeBasisPointsKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode DAOCoinLimitOrderTakerFeeBasisPoints as uint64",
+			)
+		}
+		if val > MaxDAOCoinLimitOrderFeeBasisPoints {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderFeeBasisPointsTooHigh
+		}
+		newGlobalParamsEntry.DAOCoinLimitOrderTakerFeeBasisPoints = val
+	}
+
+	// An empty fee recipient public key unsets the recipient, which turns off trading fees.
+	if feeRecipientPubKey, exists := extraData[DAOCoinLimitOrderFeeRecipientPublicKeyKey]; exists {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderTradingFeesBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderTradingFeesBeforeBlockHeight
+		}
+		if len(feeRecipientPubKey) == 0 {
+			newGlobalParamsEntry.DAOCoinLimitOrderFeeRecipientPKID = nil
+		} else {
+			if len(feeRecipientPubKey) != btcec.PubKeyBytesLenCompressed {
+				return 0, 0, nil, RuleErrorDAOCoinLimitOrderFeeRecipientPubKeyLength
+			}
+			feeRecipientPKIDEntry := bav.GetPKIDForPublicKey(feeRecipientPubKey)
+			if feeRecipientPKIDEntry == nil || feeRecipientPKIDEntry.isDeleted {
+				return 0, 0, nil, fmt.Errorf(
+					"_connectUpdateGlobalParams: fee recipient PKID entry is deleted: %v",
+					spew.Sdump(feeRecipientPKIDEntry))
+			}
+			newGlobalParamsEntry.DAOCoinLimitOrderFeeRecipientPKID = feeRecipientPKIDEntry.PKID.NewPKID()
+		}
+	}
+
+	if len(extraData[ExchangeRateFeedMaxAgeBlocksKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.ExchangeRateFeedBlockHeight {
+			return 0, 0, nil, RuleErrorExchangeRateFeedBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[ExchangeRateFeedMaxAgeBlocksKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode ExchangeRateFeedMaxAgeBlocks as uint64",
+			)
+		}
+		if val == 0 {
+			return 0, 0, nil, RuleErrorExchangeRateFeedMaxAgeBlocksTooLow
+		}
+		newGlobalParamsEntry.ExchangeRateFeedMaxAgeBlocks = val
+	}
+
+	if len(extraData[ExchangeRateFeedMaxDeviationBasisPointsKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.ExchangeRateFeedBlockHeight {
+			return 0, 0, nil, RuleErrorExchangeRateFeedBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[ExchangeRateFeedMaxDeviationBasisPointsKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode ExchangeRateFeedMaxDeviationBasisPoints as uint64",
+			)
+		}
+		if val > MaxBasisPoints {
+			return 0, 0, nil, RuleErrorExchangeRateFeedMaxDeviationTooHigh
+		}
+		newGlobalParamsEntry.ExchangeRateFeedMaxDeviationBasisPoints = val
+	}
+
+	if len(extraData[ExchangeRateFeedMinSubmissionsKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.ExchangeRateFeedBlockHeight {
+			return 0, 0, nil, RuleErrorExchangeRateFeedBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[ExchangeRateFeedMinSubmissionsKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode ExchangeRateFeedMinSubmissions as uint64",
+			)
+		}
+		if val == 0 {
+			return 0, 0, nil, RuleErrorExchangeRateFeedMinSubmissionsTooLow
+		}
+		newGlobalParamsEntry.ExchangeRateFeedMinSubmissions = val
+	}
+
+	// Whitelist a DAO coin for paying txn fees, or remove it from the whitelist if
+	// RemoveDAOCoinFeeKey is also set. The whitelist is rebuilt rather than modified in
+	// place since it's shared with the previous GlobalParamsEntry.
+	if daoCoinFeePubKey, exists := extraData[DAOCoinFeePublicKeyKey]; exists {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinFeeBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinFeeBeforeBlockHeight
+		}
+		if len(daoCoinFeePubKey) != btcec.PubKeyBytesLenCompressed {
+			return 0, 0, nil, RuleErrorDAOCoinFeePubKeyLength
+		}
+		daoCoinFeePKIDEntry := bav.GetPKIDForPublicKey(daoCoinFeePubKey)
+		if daoCoinFeePKIDEntry == nil || daoCoinFeePKIDEntry.isDeleted {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: DAO coin fee PKID entry is deleted: %v",
+				spew.Sdump(daoCoinFeePKIDEntry))
+		}
+		isWhitelisted := newGlobalParamsEntry.IsDAOCoinFeeWhitelisted(daoCoinFeePKIDEntry.PKID)
+		var newWhitelist []*PKID
+		if len(extraData[RemoveDAOCoinFeeKey]) > 0 {
+			if !isWhitelisted {
+				return 0, 0, nil, RuleErrorDAOCoinFeeCoinNotWhitelisted
+			}
+			for _, pkid := range newGlobalParamsEntry.DAOCoinFeeWhitelistPKIDs {
+				if !pkid.Eq(daoCoinFeePKIDEntry.PKID) {
+					newWhitelist = append(newWhitelist, pkid.NewPKID())
+				}
+			}
+		} else {
+			if isWhitelisted {
+				return 0, 0, nil, RuleErrorDAOCoinFeeCoinAlreadyWhitelisted
+			}
+			profileEntry := bav.GetProfileEntryForPKID(daoCoinFeePKIDEntry.PKID)
+			if profileEntry == nil || profileEntry.isDeleted {
+				return 0, 0, nil, RuleErrorDAOCoinFeeProfileDoesNotExist
+			}
+			newWhitelist = append(
+				copyPKIDs(newGlobalParamsEntry.DAOCoinFeeWhitelistPKIDs), daoCoinFeePKIDEntry.PKID.NewPKID())
+		}
+		newGlobalParamsEntry.DAOCoinFeeWhitelistPKIDs = newWhitelist
+	}
+
+	if len(extraData[DAOCoinFeeHaircutBasisPointsKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinFeeBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinFeeBeforeBlockHeight
+		}
+		val, bytesRead := Uvarint(extraData[DAOCoinFeeHaircutBasisPointsKey])
+		if bytesRead <= 0 {
+			return 0, 0, nil, fmt.Errorf(
+				"_connectUpdateGlobalParams: unable to decode DAOCoinFeeHaircutBasisPoints as uint64",
+			)
+		}
+		if val > MaxBasisPoints {
+			return 0, 0, nil, RuleErrorDAOCoinFeeHaircutTooHigh
+		}
+		newGlobalParamsEntry.DAOCoinFeeHaircutBasisPoints = val
+	}
+
+	// Set the minimum fee rate of a txn type, or remove it if it's zero. The map is rebuilt
+	// rather than modified in place since it's shared with the previous GlobalParamsEntry.
+	if len(extraData[TxnTypeMinimumNetworkFeeNanosPerKBKey]) > 0 {
+		if blockHeight < bav.Params.ForkHeights.TxnTypeMinimumNetworkFeeBlockHeight {
+			return 0, 0, nil, RuleErrorTxnTypeMinimumNetworkFeeBeforeBlockHeight
+		}
+		txnType, feeNanosPerKB, err := DecodeTxnTypeMinimumNetworkFee(
+			extraData[TxnTypeMinimumNetworkFeeNanosPerKBKey])
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
+		}
+		if !IsValidTxnTypeForMinimumNetworkFee(txnType) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorTxnTypeMinimumNetworkFeeInvalidTxnType,
+				"_connectUpdateGlobalParams: %v", txnType)
+		}
+		newFees := copyTxnTypeMinimumNetworkFees(newGlobalParamsEntry.TxnTypeMinimumNetworkFeeNanosPerKB)
+		if newFees == nil {
+			newFees = make(map[TxnType]uint64)
+		}
+		if feeNanosPerKB == 0 {
+			delete(newFees, txnType)
+		} else {
+			newFees[txnType] = feeNanosPerKB
+		}
+		newGlobalParamsEntry.TxnTypeMinimumNetworkFeeNanosPerKB = newFees
+	}
+
 	var newForbiddenPubKeyEntry *ForbiddenPubKeyEntry
 	var prevForbiddenPubKeyEntry *ForbiddenPubKeyEntry
 	var forbiddenPubKey []byte
@@ -3648,6 +4574,68 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 		}
 	}
 
+	// Register, update, or remove a block producer in the block producer registry. An empty
+	// or missing tag removes the block producer from the registry.
+	var prevBlockProducerRegistryEntry *BlockProducerRegistryEntry
+	var blockProducerRegistryPubKey []byte
+	var blockProducerRegistryTag []byte
+	if _, exists := extraData[BlockProducerRegistryPublicKeyKey]; exists {
+		if blockHeight < bav.Params.ForkHeights.BlockProducerAttestationBlockHeight {
+			return 0, 0, nil, RuleErrorBlockProducerRegistryBeforeBlockHeight
+		}
+		blockProducerRegistryPubKey = extraData[BlockProducerRegistryPublicKeyKey]
+		if len(blockProducerRegistryPubKey) != btcec.PubKeyBytesLenCompressed {
+			return 0, 0, nil, RuleErrorBlockProducerRegistryPubKeyLength
+		}
+		blockProducerRegistryTag = extraData[BlockProducerRegistryTagKey]
+		if len(blockProducerRegistryTag) > MaxBlockProducerTagLength {
+			return 0, 0, nil, RuleErrorBlockProducerTagInvalidLength
+		}
+		var err error
+		prevBlockProducerRegistryEntry, err = bav.GetBlockProducerRegistryEntry(blockProducerRegistryPubKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
+		}
+	}
+
+	// Register or remove an external header relayer. The relayer is removed if
+	// RemoveExternalHeaderRelayerKey is set to a non-empty value.
+	var prevExternalHeaderRelayerEntry *ExternalHeaderRelayerEntry
+	var externalHeaderRelayerPubKey []byte
+	if _, exists := extraData[ExternalHeaderRelayerPublicKeyKey]; exists {
+		if blockHeight < bav.Params.ForkHeights.ExternalHeaderAnchoringBlockHeight {
+			return 0, 0, nil, RuleErrorAnchorExternalHeadersBeforeBlockHeight
+		}
+		externalHeaderRelayerPubKey = extraData[ExternalHeaderRelayerPublicKeyKey]
+		if len(externalHeaderRelayerPubKey) != btcec.PubKeyBytesLenCompressed {
+			return 0, 0, nil, RuleErrorExternalHeaderRelayerPubKeyLength
+		}
+		var err error
+		prevExternalHeaderRelayerEntry, err = bav.GetExternalHeaderRelayerEntry(externalHeaderRelayerPubKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
+		}
+	}
+
+	// Register or remove an exchange rate feed. The feed is removed if RemoveExchangeRateFeedKey
+	// is set to a non-empty value. Re-registering a feed keeps its last submission.
+	var prevExchangeRateFeedEntry *ExchangeRateFeedEntry
+	var exchangeRateFeedPubKey []byte
+	if _, exists := extraData[ExchangeRateFeedPublicKeyKey]; exists {
+		if blockHeight < bav.Params.ForkHeights.ExchangeRateFeedBlockHeight {
+			return 0, 0, nil, RuleErrorExchangeRateFeedBeforeBlockHeight
+		}
+		exchangeRateFeedPubKey = extraData[ExchangeRateFeedPublicKeyKey]
+		if len(exchangeRateFeedPubKey) != btcec.PubKeyBytesLenCompressed {
+			return 0, 0, nil, RuleErrorExchangeRateFeedPubKeyLength
+		}
+		var err error
+		prevExchangeRateFeedEntry, err = bav.GetExchangeRateFeedEntry(exchangeRateFeedPubKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
+		}
+	}
+
 	// Connect basic txn to get the total input and the total output without
 	// considering the transaction metadata.
 	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
@@ -3674,12 +4662,59 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 		bav.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(forbiddenPubKey)] = newForbiddenPubKeyEntry
 	}
 
+	// Update the block producer registry on the view, if we have an entry to update.
+	if blockProducerRegistryPubKey != nil {
+		newBlockProducerRegistryEntry := &BlockProducerRegistryEntry{
+			PublicKey: blockProducerRegistryPubKey,
+			Tag:       blockProducerRegistryTag,
+		}
+		if len(blockProducerRegistryTag) == 0 {
+			bav._deleteBlockProducerRegistryEntryMappings(newBlockProducerRegistryEntry)
+		} else {
+			bav._setBlockProducerRegistryEntryMappings(newBlockProducerRegistryEntry)
+		}
+	}
+
+	// Update the external header relayer registry on the view, if we have an entry to update.
+	if externalHeaderRelayerPubKey != nil {
+		newExternalHeaderRelayerEntry := &ExternalHeaderRelayerEntry{PublicKey: externalHeaderRelayerPubKey}
+		if len(extraData[RemoveExternalHeaderRelayerKey]) > 0 {
+			bav._deleteExternalHeaderRelayerEntryMappings(newExternalHeaderRelayerEntry)
+		} else {
+			bav._setExternalHeaderRelayerEntryMappings(newExternalHeaderRelayerEntry)
+		}
+	}
+
+	// Update the exchange rate feed registry on the view, if we have an entry to update.
+	if exchangeRateFeedPubKey != nil {
+		if len(extraData[RemoveExchangeRateFeedKey]) > 0 {
+			bav._deleteExchangeRateFeedEntryMappings(&ExchangeRateFeedEntry{PublicKey: exchangeRateFeedPubKey})
+		} else if prevExchangeRateFeedEntry == nil {
+			bav._setExchangeRateFeedEntryMappings(&ExchangeRateFeedEntry{PublicKey: exchangeRateFeedPubKey})
+		}
+	}
+
 	// Save a UtxoOperation of type OperationTypeUpdateGlobalParams that will allow
 	// us to easily revert when we disconnect the transaction.
+	var prevBlockProducerRegistryEntryCopy *BlockProducerRegistryEntry
+	if prevBlockProducerRegistryEntry != nil {
+		prevBlockProducerRegistryEntryCopy = prevBlockProducerRegistryEntry.Copy()
+	}
+	var prevExternalHeaderRelayerEntryCopy *ExternalHeaderRelayerEntry
+	if prevExternalHeaderRelayerEntry != nil {
+		prevExternalHeaderRelayerEntryCopy = prevExternalHeaderRelayerEntry.Copy()
+	}
+	var prevExchangeRateFeedEntryCopy *ExchangeRateFeedEntry
+	if prevExchangeRateFeedEntry != nil {
+		prevExchangeRateFeedEntryCopy = prevExchangeRateFeedEntry.Copy()
+	}
 	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
-		Type:                     OperationTypeUpdateGlobalParams,
-		PrevGlobalParamsEntry:    prevGlobalParamsEntry,
-		PrevForbiddenPubKeyEntry: prevForbiddenPubKeyEntry,
+		Type:                           OperationTypeUpdateGlobalParams,
+		PrevGlobalParamsEntry:          prevGlobalParamsEntry,
+		PrevForbiddenPubKeyEntry:       prevForbiddenPubKeyEntry,
+		PrevBlockProducerRegistryEntry: prevBlockProducerRegistryEntryCopy,
+		PrevExternalHeaderRelayerEntry: prevExternalHeaderRelayerEntryCopy,
+		PrevExchangeRateFeedEntry:      prevExchangeRateFeedEntryCopy,
 	})
 
 	return totalInput, totalOutput, utxoOpsForTxn, nil
@@ -3886,7 +4921,11 @@ func (bav *UtxoView) _connectSingleTxn(
 					"public key: %v", PkToString(postEntry.PosterPublicKey, bav.Params))
 			}
 			nftCreatorCoinRoyaltyEntriesSnapshot[*(pkidEntry.PKID)] = nftCreatorProfileEntry.CreatorCoinEntry.Copy()
-			for pkid := range postEntry.AdditionalNFTRoyaltiesToCoinsBasisPoints {
+			_, additionalCoinRoyaltiesBasisPoints, err := bav.GetNFTAdditionalRoyalties(postEntry)
+			if err != nil {
+				return nil, 0, 0, 0, errors.Wrapf(err, "_connectTransaction: ")
+			}
+			for pkid := range additionalCoinRoyaltiesBasisPoints {
 				profileEntry := bav.GetProfileEntryForPKID(&pkid)
 				if profileEntry == nil || profileEntry.IsDeleted() {
 					return nil, 0, 0, 0, fmt.Errorf("_connectTransaction: Profile not found for "+
@@ -3973,6 +5012,11 @@ func (bav *UtxoView) _connectSingleTxn(
 			bav._connectDAOCoinLimitOrder(
 				txn, txHash, blockHeight, verifySignatures)
 
+	case TxnTypeDAOCoinLimitOrderBatch:
+		totalInput, totalOutput, utxoOpsForTxn, err =
+			bav._connectDAOCoinLimitOrderBatch(
+				txn, txHash, blockHeight, verifySignatures)
+
 	case TxnTypeSwapIdentity:
 		totalInput, totalOutput, utxoOpsForTxn, err =
 			bav._connectSwapIdentity(
@@ -4070,6 +5114,31 @@ func (bav *UtxoView) _connectSingleTxn(
 		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectCoinLockupTransfer(txn, txHash, blockHeight, verifySignatures)
 	case TxnTypeCoinUnlock:
 		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectCoinUnlock(txn, txHash, blockHeight, blockTimestampNanoSecs, verifySignatures)
+	case TxnTypeAnchorExternalHeaders:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectAnchorExternalHeaders(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeRegisterMultisig:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectRegisterMultisig(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeDAOCoinStream:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectDAOCoinStream(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeCreateProposal:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectCreateProposal(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeCastVote:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectCastVote(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeDAOCoinMultiTransfer:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectDAOCoinMultiTransfer(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeRoyaltySplit:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectRoyaltySplit(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeLeaseNFT:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectLeaseNFT(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeEndNFTLease:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectEndNFTLease(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeNFTBundle:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectNFTBundle(txn, txHash, blockHeight, verifySignatures)
+	case TxnTypeNFTSwap:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectNFTSwap(txn, txHash, blockHeight, verifySignatures)
+
+	case TxnTypeSlashValidator:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectSlashValidator(txn, txHash, blockHeight, verifySignatures)
 
 	default:
 		err = fmt.Errorf("ConnectTransaction: Unimplemented txn type %v", txn.TxnMeta.GetTxnType().String())
@@ -4109,13 +5178,15 @@ func (bav *UtxoView) _connectSingleTxn(
 	// If the current minimum network fee per kb is set to 0, that indicates we should not assess a minimum fee.
 	// Similarly, BlockReward transactions do not require a fee.
 	isFeeExempt := txn.TxnMeta.GetTxnType() == TxnTypeBitcoinExchange || txn.TxnMeta.GetTxnType() == TxnTypeBlockReward
-	if !isFeeExempt && txnSizeBytes != 0 && bav.GetCurrentGlobalParamsEntry().MinimumNetworkFeeNanosPerKB != 0 {
+	// The minimum depends on the txn's type if the ParamUpdater has set one for it.
+	minNetworkFeeNanosPerKB := bav.GetCurrentGlobalParamsEntry().GetMinimumNetworkFeeNanosPerKBForTxn(txn)
+	if !isFeeExempt && txnSizeBytes != 0 && minNetworkFeeNanosPerKB != 0 {
 		// Make sure there isn't overflow in the fee.
 		if fees != ((fees * 1000) / 1000) {
 			return nil, 0, 0, 0, RuleErrorOverflowDetectedInFeeRateCalculation
 		}
 		// If the fee is less than the minimum network fee per KB, return an error.
-		if (fees*1000)/uint64(txnSizeBytes) < bav.GetCurrentGlobalParamsEntry().MinimumNetworkFeeNanosPerKB {
+		if (fees*1000)/uint64(txnSizeBytes) < minNetworkFeeNanosPerKB {
 			return nil, 0, 0, 0, RuleErrorTxnFeeBelowNetworkMinimum
 		}
 	}
@@ -4234,6 +5305,15 @@ func (bav *UtxoView) _connectSingleTxn(
 		})
 	}
 
+	// Record the fee paid by the transaction on its last UtxoOperation.
+	if blockHeight >= bav.Params.ForkHeights.TxnFeeReceiptsBlockHeight && len(utxoOpsForTxn) > 0 {
+		feeReceipt, err := NewTxnFeeReceipt(txn, txnSizeBytes, fees)
+		if err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(err, "ConnectTransaction: ")
+		}
+		utxoOpsForTxn[len(utxoOpsForTxn)-1].FeeReceipt = feeReceipt
+	}
+
 	return utxoOpsForTxn, totalInput, totalOutput, fees, nil
 }
 
@@ -4345,6 +5425,14 @@ func (bav *UtxoView) ConnectBlock(
 		bav._setCurrentRandomSeedHash(randomSeedHash)
 	}
 
+	// If the block producer attested to the block in the block reward's ExtraData, make sure the
+	// attestation is well-formed, correctly signed, and consistent with the block producer registry.
+	if blockHeight >= uint64(bav.Params.ForkHeights.BlockProducerAttestationBlockHeight) {
+		if _, err := bav.GetBlockProducerAttestation(desoBlock); err != nil {
+			return nil, errors.Wrapf(err, "ConnectBlock: ")
+		}
+	}
+
 	blockHeader := desoBlock.Header
 	var blockRewardOutputPublicKey *btcec.PublicKey
 	// If the block height is greater than or equal to the block reward patch height,
@@ -4514,6 +5602,30 @@ func (bav *UtxoView) ConnectBlock(
 	// are always the last utxo operation in a given block.
 	var blockLevelUtxoOps []*UtxoOperation
 
+	// Once the dead key registry is enabled, record any provably-unspendable public
+	// keys that received DESO in this block.
+	if blockHeight >= uint64(bav.Params.ForkHeights.DeadKeyRegistryBlockHeight) {
+		deadKeyUtxoOp, err := bav.registerDeadKeysInBlock(desoBlock, blockHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ConnectBlock: error registering dead keys")
+		}
+		if deadKeyUtxoOp != nil {
+			blockLevelUtxoOps = append(blockLevelUtxoOps, deadKeyUtxoOp)
+		}
+	}
+
+	// Settle the NFT auctions that end at this block, now that the block's bids have been
+	// connected.
+	if blockHeight >= uint64(bav.Params.ForkHeights.NFTAuctionBlockHeight) {
+		auctionUtxoOp, err := bav.settleNFTAuctionsInBlock(blockHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ConnectBlock: error settling NFT auctions")
+		}
+		if auctionUtxoOp != nil {
+			blockLevelUtxoOps = append(blockLevelUtxoOps, auctionUtxoOp)
+		}
+	}
+
 	// TODO: To prevent the state from bloating, we should delete nonces periodically.
 	// We used to do that here but it was causing badger seeks to be slow due to a bug
 	// in badger whereby deleting keys slows down seeks. Eventually, we should go back
@@ -4568,6 +5680,18 @@ func (bav *UtxoView) ConnectBlock(
 				bav._setValidatorEntryMappings(validatorEntry)
 			}
 		}
+
+		// Once validator performance tracking is enabled, record the block's proposer,
+		// missed leader slots, and votes in the validators' ValidatorEpochPerformanceEntries.
+		if blockHeight >= uint64(bav.Params.ForkHeights.ValidatorPerformanceTrackingBlockHeight) {
+			performanceUtxoOp, err := bav.updateValidatorEpochPerformance(
+				desoBlock.Header, signersList, allSnapshotValidators,
+			)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ConnectBlock: error updating validator epoch performance")
+			}
+			blockLevelUtxoOps = append(blockLevelUtxoOps, performanceUtxoOp)
+		}
 	}
 
 	// If we're past the PoS Setup Fork Height, check if we should run the end of epoch hook.
@@ -4875,7 +5999,7 @@ func (bav *UtxoView) GetTransactorNonceEntry(nonce *DeSoNonce, pkid *PKID) (*Tra
 		return nonceEntry, nil
 	}
 	var err error
-	nonceEntry, err = DbGetTransactorNonceEntry(bav.Handle, bav.Snapshot, nonce, pkid)
+	nonceEntry, err = bav.GetDbAdapter().GetTransactorNonceEntry(nonce, pkid)
 	if err != nil {
 		return nil, err
 	}
@@ -4909,7 +6033,7 @@ func (bav *UtxoView) DeleteTransactorNonceEntry(nonceEntry *TransactorNonceEntry
 }
 
 func (bav *UtxoView) GetTransactorNonceEntriesToDeleteAtBlockHeight(blockHeight uint64) []*TransactorNonceEntry {
-	dbExpiredNonceEntries, err := DbGetTransactorNonceEntriesToExpireAtBlockHeight(bav.Handle, blockHeight)
+	dbExpiredNonceEntries, err := bav.GetDbAdapter().GetTransactorNonceEntriesToExpireAtBlockHeight(blockHeight)
 	if err != nil {
 		glog.Errorf("GetTransactorNonceEntriesToDeleteAtBlockHeight: Error fetching expired nonce entries: %v", err)
 		return nil
@@ -4997,13 +6121,7 @@ func (bav *UtxoView) ConstructNonceForPKID(pkid *PKID, blockHeight uint64) (*DeS
 func (bav *UtxoView) GetUnspentUtxoEntrysForPublicKey(pkBytes []byte) ([]*UtxoEntry, error) {
 	// Fetch the relevant utxos for this public key from the db. We do this because
 	// the db could contain utxos that are not currently loaded into the view.
-	var utxoEntriesForPublicKey []*UtxoEntry
-	var err error
-	if bav.Postgres != nil {
-		utxoEntriesForPublicKey = bav.Postgres.GetUtxoEntriesForPublicKey(pkBytes)
-	} else {
-		utxoEntriesForPublicKey, err = DbGetUtxosForPubKey(pkBytes, bav.Handle, bav.Snapshot)
-	}
+	utxoEntriesForPublicKey, err := bav.GetDbAdapter().GetUtxoEntriesForPublicKey(pkBytes)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetUnspentUtxoEntrysForPublicKey: Problem fetching "+
 			"utxos for public key %s", PkToString(pkBytes, bav.Params))
@@ -5090,13 +6208,13 @@ func (bav *UtxoView) GetSpendableDeSoBalanceNanosForPublicKey(pkBytes []byte,
 				break
 			}
 
-			blockNode := GetHeightHashToNodeInfo(bav.Handle, bav.Snapshot, tipHeight, nextBlockHash, false)
+			blockNode := bav.GetDbAdapter().GetBlockNodeForHeightHash(tipHeight, nextBlockHash, false)
 			if blockNode == nil {
 				return 0, fmt.Errorf(
 					"GetSpendableDeSoBalanceNanosForPublicKey: Problem getting block for blockhash %s",
 					nextBlockHash.String())
 			}
-			blockRewardForPK, err := DbGetBlockRewardForPublicKeyBlockHash(bav.Handle, bav.Snapshot, pkBytes, nextBlockHash)
+			blockRewardForPK, err := bav.GetDbAdapter().GetBlockRewardForPublicKeyBlockHash(pkBytes, nextBlockHash)
 			if err != nil {
 				return 0, errors.Wrapf(
 					err, "GetSpendableDeSoBalanceNanosForPublicKey: Problem getting block reward for "+
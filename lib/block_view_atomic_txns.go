@@ -303,13 +303,14 @@ func (bav *UtxoView) _verifyAtomicTxnsSize(txn *MsgDeSoTxn, blockHeight uint64)
 	// cover the atomic transactions AS WELL AS the wrapper. We validate this
 	// here to ensure we can test for these edge cases as they're also logically caught
 	// by _verifyAtomicTxnsWrapper.
-	if txnSizeBytes != 0 && bav.GetCurrentGlobalParamsEntry().MinimumNetworkFeeNanosPerKB != 0 {
+	minNetworkFeeNanosPerKB := bav.GetCurrentGlobalParamsEntry().GetMinimumNetworkFeeNanosPerKBForTxn(txn)
+	if txnSizeBytes != 0 && minNetworkFeeNanosPerKB != 0 {
 		// Make sure there isn't overflow in the fee.
 		if txn.TxnFeeNanos != ((txn.TxnFeeNanos * 1000) / 1000) {
 			return RuleErrorOverflowDetectedInFeeRateCalculation
 		}
 		// If the fee is less than the minimum network fee per KB, return an error.
-		if (txn.TxnFeeNanos*1000)/txnSizeBytes < bav.GetCurrentGlobalParamsEntry().MinimumNetworkFeeNanosPerKB {
+		if (txn.TxnFeeNanos*1000)/txnSizeBytes < minNetworkFeeNanosPerKB {
 			return RuleErrorTxnFeeBelowNetworkMinimum
 		}
 	}
@@ -22,12 +22,7 @@ func (bav *UtxoView) _getBalanceEntryForHODLerPKIDAndCreatorPKID(
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
-	var balanceEntry *BalanceEntry
-	if bav.Postgres != nil {
-		balanceEntry = bav.GetBalanceEntry(hodlerPKID, creatorPKID, isDAOCoin)
-	} else {
-		balanceEntry = DBGetBalanceEntryForHODLerAndCreatorPKIDs(bav.Handle, bav.Snapshot, hodlerPKID, creatorPKID, isDAOCoin)
-	}
+	balanceEntry := bav.GetDbAdapter().GetBalanceEntry(hodlerPKID, creatorPKID, isDAOCoin)
 	if balanceEntry != nil {
 		bav._setBalanceEntryMappingsWithPKIDs(balanceEntry, hodlerPKID, creatorPKID, isDAOCoin)
 	}
@@ -92,15 +87,9 @@ func (bav *UtxoView) _deleteBalanceEntryMappings(
 
 func (bav *UtxoView) GetHoldings(pkid *PKID, fetchProfiles bool, isDAOCoin bool) (
 	[]*BalanceEntry, []*ProfileEntry, error) {
-	var entriesYouHold []*BalanceEntry
-	if bav.Postgres != nil {
-		entriesYouHold = bav.GetBalanceEntryHoldings(pkid, isDAOCoin)
-	} else {
-		holdings, err := DbGetBalanceEntriesYouHold(bav.Handle, bav.Snapshot, pkid, true, isDAOCoin)
-		if err != nil {
-			return nil, nil, err
-		}
-		entriesYouHold = holdings
+	entriesYouHold, err := bav.GetDbAdapter().GetBalanceEntriesYouHold(pkid, isDAOCoin)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	holdingsMap := make(map[PKID]*BalanceEntry)
@@ -136,15 +125,9 @@ func (bav *UtxoView) GetHoldings(pkid *PKID, fetchProfiles bool, isDAOCoin bool)
 
 func (bav *UtxoView) GetHolders(pkid *PKID, fetchProfiles bool, isDAOCoin bool) (
 	[]*BalanceEntry, []*ProfileEntry, error) {
-	var holderEntries []*BalanceEntry
-	if bav.Postgres != nil {
-		holderEntries = bav.GetBalanceEntryHolders(pkid, isDAOCoin)
-	} else {
-		holders, err := DbGetBalanceEntriesHodlingYou(bav.Handle, bav.Snapshot, pkid, true, isDAOCoin)
-		if err != nil {
-			return nil, nil, err
-		}
-		holderEntries = holders
+	holderEntries, err := bav.GetDbAdapter().GetBalanceEntriesHodlingYou(pkid, isDAOCoin)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	holdersMap := make(map[PKID]*BalanceEntry)
@@ -33,7 +33,7 @@ func (bav *UtxoView) _existsBitcoinTxIDMapping(bitcoinBurnTxID *BlockHash) bool
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return true. If not, return
 	// false. Either way, save the value to the in-memory view mapping got later.
-	dbHasMapping := DbExistsBitcoinBurnTxID(bav.Handle, bav.Snapshot, bitcoinBurnTxID)
+	dbHasMapping := bav.GetDbAdapter().ExistsBitcoinBurnTxID(bitcoinBurnTxID)
 	bav.BitcoinBurnTxIDs[*bitcoinBurnTxID] = dbHasMapping
 	return dbHasMapping
 }
@@ -337,6 +337,18 @@ func (bav *UtxoView) _connectUpdateBitcoinUSDExchangeRate(
 		return 0, 0, nil, RuleErrorExchangeRateTooHigh
 	}
 
+	// Once exchange rate feeds are enabled, a txn from a registered feed key is a submission
+	// that gets aggregated with the other feeds' rather than setting the exchange rate directly.
+	if blockHeight >= bav.Params.ForkHeights.ExchangeRateFeedBlockHeight {
+		feedEntry, err := bav.GetExchangeRateFeedEntry(txn.PublicKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateBitcoinUSDExchangeRate: ")
+		}
+		if feedEntry != nil {
+			return bav._connectExchangeRateFeedSubmission(txn, txHash, blockHeight, verifySignatures, feedEntry)
+		}
+	}
+
 	// Validate the public key. Only a paramUpdater is allowed to trigger this.
 	_, updaterIsParamUpdater := GetParamUpdaterPublicKeys(blockHeight, bav.Params)[MakePkMapKey(txn.PublicKey)]
 	if !updaterIsParamUpdater {
@@ -458,6 +470,15 @@ func (bav *UtxoView) _disconnectUpdateBitcoinUSDExchangeRate(
 	prevUSDCentsPerBitcoin := operationData.PrevUSDCentsPerBitcoin
 	bav.USDCentsPerBitcoin = prevUSDCentsPerBitcoin
 
+	// If the txn was a submission from an exchange rate feed, reset the feed's entry and
+	// the exchange rate that was aggregated from it.
+	if operationData.PrevExchangeRateFeedEntry != nil {
+		bav._setExchangeRateFeedEntryMappings(operationData.PrevExchangeRateFeedEntry)
+		if operationData.PrevGlobalParamsEntry != nil {
+			bav.GlobalParamsEntry = operationData.PrevGlobalParamsEntry
+		}
+	}
+
 	// Now revert the basic transfer with the remaining operations. Cut off
 	// the UpdateBitcoinUSDExchangeRate operation at the end since we just reverted it.
 	return bav._disconnectBasicTransfer(
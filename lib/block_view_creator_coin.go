@@ -1038,6 +1038,8 @@ func (bav *UtxoView) HelpConnectCreatorCoinBuy(
 			"desoLockedNanosDiff: Missing profile")
 	}
 	desoLockedNanosDiff := int64(existingProfileEntry.CreatorCoinEntry.DeSoLockedNanos) - int64(prevCoinEntry.DeSoLockedNanos)
+	creatorCoinNanosDiff := int64(existingProfileEntry.CreatorCoinEntry.CoinsInCirculationNanos.Uint64()) -
+		int64(prevCoinEntry.CoinsInCirculationNanos.Uint64())
 
 	// Add a CreatorCoinStateChangeMetadata to the UtxoOperation to track the state change.
 	stateChangeMetadata := &CreatorCoinStateChangeMetadata{
@@ -1054,6 +1056,7 @@ func (bav *UtxoView) HelpConnectCreatorCoinBuy(
 		PrevCreatorBalanceEntry:        &prevCreatorBalanceEntry,
 		FounderRewardUtxoKey:           outputKey,
 		CreatorCoinDESOLockedNanosDiff: desoLockedNanosDiff,
+		CreatorCoinNanosDiff:           creatorCoinNanosDiff,
 		StateChangeMetadata:            stateChangeMetadata,
 	})
 
@@ -1353,6 +1356,8 @@ func (bav *UtxoView) HelpConnectCreatorCoinSell(
 				"desoLockedNanosDiff: Missing profile")
 	}
 	desoLockedNanosDiff := int64(existingProfileEntry.CreatorCoinEntry.DeSoLockedNanos) - int64(prevCoinEntry.DeSoLockedNanos)
+	creatorCoinNanosDiff := int64(existingProfileEntry.CreatorCoinEntry.CoinsInCirculationNanos.Uint64()) -
+		int64(prevCoinEntry.CoinsInCirculationNanos.Uint64())
 
 	// Add a CreatorCoinStateChangeMetadata to the UtxoOperation to track the state change.
 	stateChangeMetadata := &CreatorCoinStateChangeMetadata{
@@ -1368,6 +1373,7 @@ func (bav *UtxoView) HelpConnectCreatorCoinSell(
 		PrevTransactorBalanceEntry:     &prevTransactorBalanceEntry,
 		PrevCreatorBalanceEntry:        nil,
 		CreatorCoinDESOLockedNanosDiff: desoLockedNanosDiff,
+		CreatorCoinNanosDiff:           creatorCoinNanosDiff,
 		StateChangeMetadata:            stateChangeMetadata,
 	})
 
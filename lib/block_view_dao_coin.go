@@ -5,7 +5,9 @@ import (
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/holiman/uint256"
 	"github.com/pkg/errors"
+	"math/big"
 	"reflect"
+	"strings"
 )
 
 func (bav *UtxoView) GetDAOCoinBalanceEntryForHODLerPubKeyAndCreatorPubKey(
@@ -158,6 +160,43 @@ func (bav *UtxoView) _disconnectDAOCoin(
 			return fmt.Errorf("_disconnectDAOCoin: Disabling minting on a CreatorCoinEntry that already has minting " +
 				"disabled; this should never happen")
 		}
+	} else if txMeta.OperationType == DAOCoinOperationTypeUpdateDecimals {
+		// Sanity checks
+		// transactor and profile match
+		if !reflect.DeepEqual(txMeta.ProfilePublicKey, currentTxn.PublicKey) {
+			return fmt.Errorf("_disconnectDAOCoin: Updating decimals by transactor public key "+
+				"that does not match ProfilePublicKey: %v, %v; this should never happen",
+				currentTxn.PublicKey, txMeta.ProfilePublicKey)
+		}
+		if existingProfileEntry.DAOCoinEntry.Decimals != txMeta.Decimals {
+			return fmt.Errorf("_disconnectDAOCoin: Current Decimals %v doesn't match txMeta.Decimals %v; "+
+				"this should never happen", existingProfileEntry.DAOCoinEntry.Decimals, txMeta.Decimals)
+		}
+	} else if txMeta.OperationType == DAOCoinOperationTypeUpdateLimitOrderRestriction {
+		// Sanity checks
+		// transactor and profile match
+		if !reflect.DeepEqual(txMeta.ProfilePublicKey, currentTxn.PublicKey) {
+			return fmt.Errorf("_disconnectDAOCoin: Updating limit order restriction by transactor public key "+
+				"that does not match ProfilePublicKey: %v, %v; this should never happen",
+				currentTxn.PublicKey, txMeta.ProfilePublicKey)
+		}
+		if existingProfileEntry.DAOCoinEntry.DAOCoinLimitOrderRestriction != txMeta.DAOCoinLimitOrderRestriction {
+			return fmt.Errorf("_disconnectDAOCoin: Current DAOCoinLimitOrderRestriction %v doesn't match "+
+				"txMeta.DAOCoinLimitOrderRestriction %v; this should never happen",
+				existingProfileEntry.DAOCoinEntry.DAOCoinLimitOrderRestriction, txMeta.DAOCoinLimitOrderRestriction)
+		}
+	} else if txMeta.OperationType == DAOCoinOperationTypeUpdateMetadata {
+		// Sanity checks
+		// transactor and profile match
+		if !reflect.DeepEqual(txMeta.ProfilePublicKey, currentTxn.PublicKey) {
+			return fmt.Errorf("_disconnectDAOCoin: Updating metadata by transactor public key "+
+				"that does not match ProfilePublicKey: %v, %v; this should never happen",
+				currentTxn.PublicKey, txMeta.ProfilePublicKey)
+		}
+		// Restore the previous metadata entry.
+		if err := bav._disconnectDAOCoinUpdateMetadata(creatorPKID, operationData); err != nil {
+			return errors.Wrapf(err, "_disconnectDAOCoin: ")
+		}
 	} else if txMeta.OperationType == DAOCoinOperationTypeUpdateTransferRestrictionStatus {
 		// Sanity checks
 		// transactor and profile match
@@ -627,6 +666,109 @@ func (bav *UtxoView) HelpConnectUpdateTransferRestrictionStatus(
 	return totalInput, totalOutput, utxoOpsForTxn, err
 }
 
+func (bav *UtxoView) HelpConnectDAOCoinUpdateDecimals(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	if blockHeight < bav.Params.ForkHeights.DAOCoinDecimalsBlockHeight {
+		return 0, 0, nil, RuleErrorDAOCoinDecimalsBeforeBlockHeight
+	}
+
+	totalInput, totalOutput, utxoOpsForTxn, creatorProfileEntry, err := bav.HelpConnectDAOCoinInitialization(
+		txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	txMeta := txn.TxnMeta.(*DAOCoinMetadata)
+
+	// First, only the profile associated with the DAO coin can update its decimals.
+	if !reflect.DeepEqual(txMeta.ProfilePublicKey, txn.PublicKey) {
+		return 0, 0, nil, RuleErrorOnlyProfileOwnerCanUpdateDAOCoinDecimals
+	}
+
+	// Verify that we're setting Decimals to a valid value.
+	if txMeta.Decimals == 0 || txMeta.Decimals > MaxDAOCoinDecimals {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinInvalidDecimals,
+			"HelpConnectDAOCoinUpdateDecimals: Decimals %d must be between 1 and %d",
+			txMeta.Decimals, MaxDAOCoinDecimals)
+	}
+
+	// We can't update to the same decimals.
+	if creatorProfileEntry.DAOCoinEntry.Decimals == txMeta.Decimals {
+		return 0, 0, nil, RuleErrorDAOCoinCannotUpdateDecimalsToCurrentDecimals
+	}
+
+	prevCoinEntry := creatorProfileEntry.DAOCoinEntry
+	creatorProfileEntry.DAOCoinEntry.Decimals = txMeta.Decimals
+
+	bav._setProfileEntryMappings(creatorProfileEntry)
+
+	// Add state change metadata.
+	stateChangeMetadata := &DAOCoinStateChangeMetadata{
+		CreatorProfileEntry: creatorProfileEntry,
+	}
+
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                OperationTypeDAOCoin,
+		PrevCoinEntry:       &prevCoinEntry,
+		StateChangeMetadata: stateChangeMetadata,
+	})
+
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) HelpConnectDAOCoinUpdateLimitOrderRestriction(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderRestrictionBlockHeight {
+		return 0, 0, nil, RuleErrorDAOCoinLimitOrderRestrictionBeforeBlockHeight
+	}
+
+	totalInput, totalOutput, utxoOpsForTxn, creatorProfileEntry, err := bav.HelpConnectDAOCoinInitialization(
+		txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	txMeta := txn.TxnMeta.(*DAOCoinMetadata)
+
+	// First, only the profile associated with the DAO coin can update its limit order restriction.
+	if !reflect.DeepEqual(txMeta.ProfilePublicKey, txn.PublicKey) {
+		return 0, 0, nil, RuleErrorOnlyProfileOwnerCanUpdateDAOCoinLimitOrderRestriction
+	}
+
+	// Verify that we're setting DAOCoinLimitOrderRestriction to a valid value.
+	if !txMeta.DAOCoinLimitOrderRestriction.IsValid() {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinInvalidLimitOrderRestriction,
+			"HelpConnectDAOCoinUpdateLimitOrderRestriction: %v", txMeta.DAOCoinLimitOrderRestriction)
+	}
+
+	// We can't update to the same restriction.
+	if creatorProfileEntry.DAOCoinEntry.DAOCoinLimitOrderRestriction == txMeta.DAOCoinLimitOrderRestriction {
+		return 0, 0, nil, RuleErrorDAOCoinCannotUpdateLimitOrderRestrictionToCurrent
+	}
+
+	prevCoinEntry := creatorProfileEntry.DAOCoinEntry
+	creatorProfileEntry.DAOCoinEntry.DAOCoinLimitOrderRestriction = txMeta.DAOCoinLimitOrderRestriction
+
+	bav._setProfileEntryMappings(creatorProfileEntry)
+
+	// Add state change metadata.
+	stateChangeMetadata := &DAOCoinStateChangeMetadata{
+		CreatorProfileEntry: creatorProfileEntry,
+	}
+
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                OperationTypeDAOCoin,
+		PrevCoinEntry:       &prevCoinEntry,
+		StateChangeMetadata: stateChangeMetadata,
+	})
+
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
 func (bav *UtxoView) _connectDAOCoin(
 	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
 	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
@@ -650,6 +792,15 @@ func (bav *UtxoView) _connectDAOCoin(
 
 	case DAOCoinOperationTypeUpdateTransferRestrictionStatus:
 		return bav.HelpConnectUpdateTransferRestrictionStatus(txn, txHash, blockHeight, verifySignatures)
+
+	case DAOCoinOperationTypeUpdateDecimals:
+		return bav.HelpConnectDAOCoinUpdateDecimals(txn, txHash, blockHeight, verifySignatures)
+
+	case DAOCoinOperationTypeUpdateMetadata:
+		return bav.HelpConnectDAOCoinUpdateMetadata(txn, txHash, blockHeight, verifySignatures)
+
+	case DAOCoinOperationTypeUpdateLimitOrderRestriction:
+		return bav.HelpConnectDAOCoinUpdateLimitOrderRestriction(txn, txHash, blockHeight, verifySignatures)
 	}
 
 	return 0, 0, nil, fmt.Errorf("_connectDAOCoin: Unrecognized DAOCoin "+
@@ -705,3 +856,44 @@ func (bav *UtxoView) IsValidDAOCoinTransfer(
 
 	return nil
 }
+
+// GetCoinDecimalsForPKID returns the number of decimals used to display the coin
+// created by creatorPKID, where the ZeroPKID denotes $DESO. Clients should use this
+// along with ConvertBaseUnitsToDisplayAmount and ConvertDisplayAmountToBaseUnits
+// rather than assuming a number of decimals.
+func (bav *UtxoView) GetCoinDecimalsForPKID(creatorPKID *PKID) (uint8, error) {
+	if creatorPKID == nil {
+		return 0, fmt.Errorf("GetCoinDecimalsForPKID: Called with nil creatorPKID")
+	}
+	if creatorPKID.IsZeroPKID() {
+		return DeSoDecimals, nil
+	}
+	profileEntry := bav.GetProfileEntryForPKID(creatorPKID)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return 0, fmt.Errorf("GetCoinDecimalsForPKID: No profile found for PKID %v", creatorPKID)
+	}
+	return profileEntry.DAOCoinEntry.GetDecimals(), nil
+}
+
+// ConvertDisplayAmountToBaseUnits converts a decimal string like "1.5" into base
+// units for a coin with the given number of decimals. Digits beyond the coin's
+// decimals are truncated.
+func ConvertDisplayAmountToBaseUnits(amountStr string, decimals uint8) (*uint256.Int, error) {
+	return ScaleFloatFormatStringToUint256(amountStr, baseUnitsPerDisplayUnit(decimals))
+}
+
+// ConvertBaseUnitsToDisplayAmount converts base units into a decimal string for a
+// coin with the given number of decimals, without trailing zeros.
+func ConvertBaseUnitsToDisplayAmount(baseUnits *uint256.Int, decimals uint8) string {
+	wholePart, decimalPart := big.NewInt(0).QuoRem(
+		baseUnits.ToBig(), baseUnitsPerDisplayUnit(decimals).ToBig(), big.NewInt(0))
+	if decimalPart.Sign() == 0 {
+		return wholePart.String()
+	}
+	decimalPartStr := fmt.Sprintf("%0*s", int(decimals), decimalPart.String())
+	return wholePart.String() + "." + strings.TrimRight(decimalPartStr, "0")
+}
+
+func baseUnitsPerDisplayUnit(decimals uint8) *uint256.Int {
+	return uint256.NewInt().Exp(uint256.NewInt().SetUint64(10), uint256.NewInt().SetUint64(uint64(decimals)))
+}
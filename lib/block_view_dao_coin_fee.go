@@ -0,0 +1,245 @@
+package lib
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// A txn can pay its fee in a DAO coin instead of DESO by setting FeeDAOCoinPublicKeyKey in
+// its ExtraData to the public key of a coin whitelisted in GlobalParams. The fee is still
+// denominated in DESO: when the txn's basic transfer is connected, the coin's creator
+// sponsors the fee by sending TxnFeeNanos DESO to the transactor, and the transactor pays
+// the creator back in the creator's coin at the coin's time-weighted price against DESO,
+// marked up by DAOCoinFeeHaircutBasisPoints. The rest of the txn then connects as if the
+// transactor had paid the fee in DESO, so the block producer is always paid in DESO.
+//
+// Since the creator's DESO balance funds the conversion, the creator has to opt in by
+// setting a sponsorship budget under DAOCoinFeeSponsorshipBudgetNanosKey in their profile's
+// ExtraData. Each sponsored fee is deducted from the budget, and fees that exceed what's
+// left of it are rejected, so whitelisting a coin never spends more of its creator's DESO
+// than they signed off on. The time-weighted price keeps a single trade at an outlying
+// price from making fees cheap to pay in the coin.
+
+// GetDAOCoinFeeSponsorshipBudgetNanos returns the number of DESO nanos the owner of
+// profileEntry has left to sponsor fees paid in their DAO coin, or zero if they haven't
+// set a budget.
+func GetDAOCoinFeeSponsorshipBudgetNanos(profileEntry *ProfileEntry) uint64 {
+	budgetBytes, exists := profileEntry.ExtraData[DAOCoinFeeSponsorshipBudgetNanosKey]
+	if !exists {
+		return 0
+	}
+	budgetNanos, bytesRead := Uvarint(budgetBytes)
+	if bytesRead <= 0 {
+		return 0
+	}
+	return budgetNanos
+}
+
+// IsDAOCoinFeeWhitelisted returns true if txn fees can be paid in the DAO coin created by
+// creatorPKID.
+func (gp *GlobalParamsEntry) IsDAOCoinFeeWhitelisted(creatorPKID *PKID) bool {
+	for _, pkid := range gp.DAOCoinFeeWhitelistPKIDs {
+		if pkid.Eq(creatorPKID) {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputeDAOCoinFeeBaseUnits converts a fee in DESO nanos to the DAO coin base units the
+// transactor pays for it. scaledPrice is the coin's last trade price in coin base units per
+// DESO nano, scaled by 1e38, and the result is marked up by haircutBasisPoints and rounded
+// up so that the conversion never favors the transactor.
+func ComputeDAOCoinFeeBaseUnits(
+	scaledPrice *uint256.Int, feeNanos uint64, haircutBasisPoints uint64) (*uint256.Int, error) {
+
+	if scaledPrice == nil || scaledPrice.IsZero() {
+		return nil, RuleErrorDAOCoinFeeNoPrice
+	}
+
+	// coins = ceil(scaledPrice * feeNanos * (MaxBasisPoints + haircut) / (1e38 * MaxBasisPoints))
+	numerator := big.NewInt(0).Mul(scaledPrice.ToBig(), big.NewInt(0).SetUint64(feeNanos))
+	numerator.Mul(numerator, big.NewInt(0).SetUint64(MaxBasisPoints+haircutBasisPoints))
+	denominator := big.NewInt(0).Mul(OneE38.ToBig(), big.NewInt(0).SetUint64(MaxBasisPoints))
+	numerator.Add(numerator, denominator)
+	numerator.Sub(numerator, big.NewInt(1))
+	coinBaseUnits := numerator.Div(numerator, denominator)
+
+	// We check for overflow manually for the same reason as ComputeBaseUnitsToSellUint256.
+	if coinBaseUnits.Cmp(MaxUint256.ToBig()) > 0 {
+		return nil, fmt.Errorf("ComputeDAOCoinFeeBaseUnits: fee of %d nanos at price %v overflows uint256",
+			feeNanos, scaledPrice.Hex())
+	}
+	coinBaseUnitsUint256, _ := uint256.FromBig(coinBaseUnits)
+	return coinBaseUnitsUint256, nil
+}
+
+// _connectDAOCoinFee converts the txn's fee from the DAO coin in its ExtraData, if any. It
+// must run before the transactor's balance is spent, and it returns nil if the txn pays its
+// fee in DESO.
+func (bav *UtxoView) _connectDAOCoinFee(txn *MsgDeSoTxn, blockHeight uint32) (*UtxoOperation, error) {
+	feeDAOCoinPubKey, exists := txn.ExtraData[FeeDAOCoinPublicKeyKey]
+	if !exists || blockHeight < bav.Params.ForkHeights.DAOCoinFeeBlockHeight {
+		return nil, nil
+	}
+	if len(feeDAOCoinPubKey) != btcec.PubKeyBytesLenCompressed {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeePubKeyLength, "_connectDAOCoinFee: ")
+	}
+	if txn.TxnFeeNanos == 0 {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeeZeroFee, "_connectDAOCoinFee: ")
+	}
+
+	// The coin must be whitelisted and its creator must still have a profile.
+	creatorPKIDEntry := bav.GetPKIDForPublicKey(feeDAOCoinPubKey)
+	if creatorPKIDEntry == nil || creatorPKIDEntry.isDeleted {
+		return nil, fmt.Errorf("_connectDAOCoinFee: Found nil or deleted PKID for DAO coin %v",
+			PkToStringBoth(feeDAOCoinPubKey))
+	}
+	creatorPKID := creatorPKIDEntry.PKID
+	globalParamsEntry := bav.GetCurrentGlobalParamsEntry()
+	if !globalParamsEntry.IsDAOCoinFeeWhitelisted(creatorPKID) {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeeCoinNotWhitelisted,
+			"_connectDAOCoinFee: DAO coin %v", PkToStringBoth(feeDAOCoinPubKey))
+	}
+	profileEntry := bav.GetProfileEntryForPKID(creatorPKID)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeeProfileDoesNotExist,
+			"_connectDAOCoinFee: DAO coin %v", PkToStringBoth(feeDAOCoinPubKey))
+	}
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return nil, fmt.Errorf("_connectDAOCoinFee: Found nil or deleted PKID for transactor %v",
+			PkToStringBoth(txn.PublicKey))
+	}
+	transactorPKID := transactorPKIDEntry.PKID
+	if transactorPKID.Eq(creatorPKID) {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeeTransactorIsCoinCreator, "_connectDAOCoinFee: ")
+	}
+
+	// The creator must have agreed to sponsor the fee.
+	sponsorshipBudgetNanos := GetDAOCoinFeeSponsorshipBudgetNanos(profileEntry)
+	if txn.TxnFeeNanos > sponsorshipBudgetNanos {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeeSponsorshipBudgetExceeded,
+			"_connectDAOCoinFee: Fee of %d nanos exceeds the remaining budget of %d nanos for DAO coin %v",
+			txn.TxnFeeNanos, sponsorshipBudgetNanos, PkToStringBoth(feeDAOCoinPubKey))
+	}
+
+	// Price the fee using the time-weighted price of trades that bought DESO with the coin.
+	lastTradePriceEntry, err := bav.GetDAOCoinLastTradePriceEntry(&ZeroPKID, creatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_connectDAOCoinFee: ")
+	}
+	if lastTradePriceEntry == nil {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeeNoPrice,
+			"_connectDAOCoinFee: DAO coin %v", PkToStringBoth(feeDAOCoinPubKey))
+	}
+	scaledPrice := lastTradePriceEntry.GetTimeWeightedScaledExchangeRate(blockHeight)
+	coinFeeBaseUnits, err := ComputeDAOCoinFeeBaseUnits(
+		scaledPrice, txn.TxnFeeNanos, globalParamsEntry.DAOCoinFeeHaircutBasisPoints)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_connectDAOCoinFee: ")
+	}
+
+	transactorBalanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(transactorPKID, creatorPKID, true)
+	if transactorBalanceEntry == nil || transactorBalanceEntry.isDeleted ||
+		coinFeeBaseUnits.Gt(&transactorBalanceEntry.BalanceNanos) {
+		return nil, errors.Wrapf(RuleErrorDAOCoinFeeInsufficientCoins,
+			"_connectDAOCoinFee: Fee of %v coin base units exceeds transactor's balance", coinFeeBaseUnits)
+	}
+	creatorBalanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(creatorPKID, creatorPKID, true)
+	if creatorBalanceEntry == nil || creatorBalanceEntry.isDeleted {
+		creatorBalanceEntry = &BalanceEntry{
+			HODLerPKID:   creatorPKID.NewPKID(),
+			CreatorPKID:  creatorPKID.NewPKID(),
+			BalanceNanos: *uint256.NewInt(),
+		}
+	}
+
+	// The creator sponsors the fee in DESO. This fails if the creator can't cover it.
+	if _, err = bav._spendBalance(txn.TxnFeeNanos, profileEntry.PublicKey, blockHeight-1); err != nil {
+		return nil, errors.Wrapf(err, "_connectDAOCoinFee: Problem spending the creator's balance: ")
+	}
+	if _, err = bav._addBalance(txn.TxnFeeNanos, txn.PublicKey); err != nil {
+		return nil, errors.Wrapf(err, "_connectDAOCoinFee: Problem adding the fee to the transactor's balance: ")
+	}
+
+	// The transactor pays the creator back in the coin. The previous profile and balances are
+	// saved so that the conversion can be disconnected. A creator who didn't hold their own coin
+	// is saved with a zero balance.
+	prevProfileEntry := *profileEntry
+	prevProfileEntry.ExtraData = copyExtraData(profileEntry.ExtraData)
+	newProfileEntry := *profileEntry
+	newProfileEntry.ExtraData = copyExtraData(profileEntry.ExtraData)
+	newProfileEntry.ExtraData[DAOCoinFeeSponsorshipBudgetNanosKey] = UintToBuf(
+		sponsorshipBudgetNanos - txn.TxnFeeNanos)
+	prevBalances := map[PKID]map[PKID]*BalanceEntry{
+		*transactorPKID: {*creatorPKID: transactorBalanceEntry.Copy()},
+		*creatorPKID:    {*creatorPKID: creatorBalanceEntry.Copy()},
+	}
+
+	newTransactorBalanceEntry := transactorBalanceEntry.Copy()
+	newTransactorBalanceEntry.BalanceNanos = *uint256.NewInt().Sub(
+		&transactorBalanceEntry.BalanceNanos, coinFeeBaseUnits)
+	if newTransactorBalanceEntry.BalanceNanos.IsZero() {
+		bav._deleteBalanceEntryMappingsWithPKIDs(newTransactorBalanceEntry, transactorPKID, creatorPKID, true)
+		newProfileEntry.DAOCoinEntry.NumberOfHolders--
+	} else {
+		bav._setDAOCoinBalanceEntryMappings(newTransactorBalanceEntry)
+	}
+
+	newCreatorBalanceEntry := creatorBalanceEntry.Copy()
+	if creatorBalanceEntry.BalanceNanos.IsZero() {
+		newProfileEntry.DAOCoinEntry.NumberOfHolders++
+	}
+	newCreatorBalanceEntry.BalanceNanos = *uint256.NewInt().Add(&creatorBalanceEntry.BalanceNanos, coinFeeBaseUnits)
+	bav._setDAOCoinBalanceEntryMappings(newCreatorBalanceEntry)
+	bav._setProfileEntryMappings(&newProfileEntry)
+
+	return &UtxoOperation{
+		Type:               OperationTypeDAOCoinFee,
+		PrevProfileEntry:   &prevProfileEntry,
+		PrevBalanceEntries: prevBalances,
+		BalancePublicKey:   profileEntry.PublicKey,
+		BalanceAmountNanos: txn.TxnFeeNanos,
+	}, nil
+}
+
+// _disconnectDAOCoinFee reverts the conversion recorded by _connectDAOCoinFee. It must run
+// after the transactor's balance has been unspent.
+func (bav *UtxoView) _disconnectDAOCoinFee(currentTxn *MsgDeSoTxn, operationData *UtxoOperation) error {
+	if operationData.Type != OperationTypeDAOCoinFee {
+		return fmt.Errorf("_disconnectDAOCoinFee: trying to revert %v but found %v",
+			OperationTypeDAOCoinFee, operationData.Type)
+	}
+
+	// Return the DESO to the creator.
+	if err := bav._unAddBalance(operationData.BalanceAmountNanos, currentTxn.PublicKey); err != nil {
+		return errors.Wrapf(err, "_disconnectDAOCoinFee: Problem unAdding the fee from the transactor: ")
+	}
+	if err := bav._unSpendBalance(operationData.BalanceAmountNanos, operationData.BalancePublicKey); err != nil {
+		return errors.Wrapf(err, "_disconnectDAOCoinFee: Problem unSpending the creator's balance: ")
+	}
+
+	// Revert the coin balances. A creator who didn't hold their own coin before is deleted.
+	for _, creatorPKIDToBalanceEntry := range operationData.PrevBalanceEntries {
+		for _, balanceEntry := range creatorPKIDToBalanceEntry {
+			if balanceEntry.BalanceNanos.IsZero() {
+				bav._deleteBalanceEntryMappingsWithPKIDs(
+					balanceEntry, balanceEntry.HODLerPKID, balanceEntry.CreatorPKID, true)
+			} else {
+				bav._setDAOCoinBalanceEntryMappings(balanceEntry)
+			}
+		}
+	}
+
+	// Revert the profile, which restores the coin entry and the sponsorship budget.
+	if operationData.PrevProfileEntry == nil {
+		return fmt.Errorf("_disconnectDAOCoinFee: missing the previous profile entry")
+	}
+	bav._setProfileEntryMappings(operationData.PrevProfileEntry)
+	return nil
+}
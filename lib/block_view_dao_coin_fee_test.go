@@ -0,0 +1,172 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeDAOCoinFeeBaseUnits(t *testing.T) {
+	require := require.New(t)
+
+	// At a price of 3 coin base units per nano, a 1000 nano fee costs 3000 base units.
+	scaledPrice := uint256.NewInt().Mul(OneE38, uint256.NewInt().SetUint64(3))
+	coinFee, err := ComputeDAOCoinFeeBaseUnits(scaledPrice, 1000, 0)
+	require.NoError(err)
+	require.Equal(uint64(3000), coinFee.Uint64())
+
+	// A 2.5% haircut marks the fee up to 3075 base units.
+	coinFee, err = ComputeDAOCoinFeeBaseUnits(scaledPrice, 1000, 250)
+	require.NoError(err)
+	require.Equal(uint64(3075), coinFee.Uint64())
+
+	// Fractional base units are rounded up, so a fee is never free.
+	scaledPrice = uint256.NewInt().Div(OneE38, uint256.NewInt().SetUint64(1000))
+	coinFee, err = ComputeDAOCoinFeeBaseUnits(scaledPrice, 1, 0)
+	require.NoError(err)
+	require.Equal(uint64(1), coinFee.Uint64())
+
+	_, err = ComputeDAOCoinFeeBaseUnits(uint256.NewInt(), 1000, 0)
+	require.Error(err)
+
+	// Since prices are scaled by 1e38, even the max price converts without overflowing.
+	coinFee, err = ComputeDAOCoinFeeBaseUnits(MaxUint256, 1000, 0)
+	require.NoError(err)
+	maxPricePerNano := uint256.NewInt().Div(MaxUint256, OneE38)
+	require.True(coinFee.Gt(uint256.NewInt().Mul(maxPricePerNano, uint256.NewInt().SetUint64(1000))))
+}
+
+func TestGlobalParamsEntryDAOCoinFeeWhitelist(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.DAOCoinFeeBlockHeight = 0
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+
+	globalParamsEntry := &GlobalParamsEntry{
+		DAOCoinFeeWhitelistPKIDs:     []*PKID{NewPKID(m0PkBytes), NewPKID(m1PkBytes)},
+		DAOCoinFeeHaircutBasisPoints: 150,
+	}
+	require.True(globalParamsEntry.IsDAOCoinFeeWhitelisted(NewPKID(m1PkBytes)))
+	require.False(globalParamsEntry.IsDAOCoinFeeWhitelisted(NewPKID(m2PkBytes)))
+
+	// The whitelist survives encoding and copies don't share it.
+	decodedEntry, err := DecodeDeSoEncoder(&GlobalParamsEntry{}, bytes.NewReader(EncodeToBytes(0, globalParamsEntry)))
+	require.NoError(err)
+	require.Equal(globalParamsEntry.DAOCoinFeeWhitelistPKIDs, decodedEntry.DAOCoinFeeWhitelistPKIDs)
+	require.Equal(globalParamsEntry.DAOCoinFeeHaircutBasisPoints, decodedEntry.DAOCoinFeeHaircutBasisPoints)
+
+	copiedEntry := globalParamsEntry.Copy()
+	copiedEntry.DAOCoinFeeWhitelistPKIDs[0] = NewPKID(m2PkBytes)
+	require.True(globalParamsEntry.IsDAOCoinFeeWhitelisted(NewPKID(m0PkBytes)))
+}
+
+func TestConnectDAOCoinFee(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.DAOCoinFeeBlockHeight = 0
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	blockHeight := uint32(10)
+
+	// m1 pays fees in m0's coin, which trades at 3 coin base units per DESO nano.
+	creatorPKID, transactorPKID := NewPKID(m0PkBytes), NewPKID(m1PkBytes)
+	globalParamsEntry := utxoView.GetCurrentGlobalParamsEntry().Copy()
+	globalParamsEntry.DAOCoinFeeWhitelistPKIDs = []*PKID{creatorPKID}
+	utxoView.GlobalParamsEntry = globalParamsEntry
+	setProfile := func(budgetNanos *uint64) {
+		profileEntry := &ProfileEntry{
+			PublicKey:    m0PkBytes,
+			Username:     []byte("m0"),
+			DAOCoinEntry: CoinEntry{NumberOfHolders: 1},
+			ExtraData:    map[string][]byte{},
+		}
+		if budgetNanos != nil {
+			profileEntry.ExtraData[DAOCoinFeeSponsorshipBudgetNanosKey] = UintToBuf(*budgetNanos)
+		}
+		utxoView._setProfileEntryMappings(profileEntry)
+	}
+	setProfile(nil)
+	_, err := utxoView._addBalance(10000, m0PkBytes)
+	require.NoError(err)
+	utxoView._setDAOCoinBalanceEntryMappings(&BalanceEntry{
+		HODLerPKID:   transactorPKID,
+		CreatorPKID:  creatorPKID,
+		BalanceNanos: *uint256.NewInt().SetUint64(5000),
+		HasPurchased: true,
+	})
+	scaledPrice := uint256.NewInt().Mul(OneE38, uint256.NewInt().SetUint64(3))
+	_, err = utxoView._setDAOCoinLastTradePrices(&ZeroPKID, creatorPKID, scaledPrice, 1)
+	require.NoError(err)
+
+	txn := &MsgDeSoTxn{
+		PublicKey:   m1PkBytes,
+		TxnFeeNanos: 1000,
+		ExtraData:   map[string][]byte{FeeDAOCoinPublicKeyKey: m0PkBytes},
+	}
+	requireState := func(
+		creatorDESONanos uint64, transactorDESONanos uint64, creatorCoins uint64, transactorCoins uint64,
+		numHolders uint64, budgetNanos uint64) {
+
+		desoBalanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+		require.NoError(err)
+		require.Equal(creatorDESONanos, desoBalanceNanos)
+		desoBalanceNanos, err = utxoView.GetDeSoBalanceNanosForPublicKey(m1PkBytes)
+		require.NoError(err)
+		require.Equal(transactorDESONanos, desoBalanceNanos)
+		for hodlerPKID, expectedCoins := range map[*PKID]uint64{
+			creatorPKID: creatorCoins, transactorPKID: transactorCoins} {
+			balanceEntry := utxoView._getBalanceEntryForHODLerPKIDAndCreatorPKID(hodlerPKID, creatorPKID, true)
+			if expectedCoins == 0 {
+				require.True(balanceEntry == nil || balanceEntry.isDeleted || balanceEntry.BalanceNanos.IsZero())
+				continue
+			}
+			require.Equal(expectedCoins, balanceEntry.BalanceNanos.Uint64())
+		}
+		profileEntry := utxoView.GetProfileEntryForPKID(creatorPKID)
+		require.Equal(numHolders, profileEntry.DAOCoinEntry.NumberOfHolders)
+		require.Equal(budgetNanos, GetDAOCoinFeeSponsorshipBudgetNanos(profileEntry))
+	}
+
+	// The creator hasn't agreed to sponsor fees, so the fee is rejected.
+	_, err = utxoView._connectDAOCoinFee(txn, blockHeight)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinFeeSponsorshipBudgetExceeded)
+	requireState(10000, 0, 0, 5000, 1, 0)
+
+	// With a budget, the creator sponsors the fee and the transactor pays 3000 coins for it.
+	budgetNanos := uint64(1500)
+	setProfile(&budgetNanos)
+	utxoOp, err := utxoView._connectDAOCoinFee(txn, blockHeight)
+	require.NoError(err)
+	requireState(9000, 1000, 3000, 2000, 2, 500)
+
+	// A second fee exceeds what's left of the budget.
+	_, err = utxoView._connectDAOCoinFee(txn, blockHeight)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinFeeSponsorshipBudgetExceeded)
+
+	// Disconnecting restores the balances, the coin entry, and the budget.
+	require.NoError(utxoView._disconnectDAOCoinFee(txn, utxoOp))
+	requireState(10000, 0, 0, 5000, 1, 1500)
+
+	// A trade at an outlying price doesn't change the fee until the time-weighted price
+	// catches up with it.
+	_, err = utxoView._setDAOCoinLastTradePrices(&ZeroPKID, creatorPKID, OneE38.Clone(), blockHeight)
+	require.NoError(err)
+	_, err = utxoView._connectDAOCoinFee(txn, blockHeight)
+	require.NoError(err)
+	requireState(9000, 1000, 3000, 2000, 2, 500)
+}
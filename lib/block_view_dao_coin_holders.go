@@ -0,0 +1,368 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_dao_coin_holders.go enumerates the holders of a DAO coin sorted by balance.
+// Listing them used to mean loading every balance entry of the coin and sorting them, which
+// doesn't scale to coins with many holders. Instead, we keep an index of each coin's holders
+// keyed by balance, along with the number of holders, and update it whenever a DAO coin
+// balance entry is put or deleted in the db. A page of holders is then a single prefix scan.
+//
+// The index is derived from the balance entries, so it isn't part of state. It's built from
+// the balance entries the first time a node starts with it, and rebuilt after a hypersync
+// since snapshot chunks are written to the db directly. Only holders with a non-zero balance
+// are included in the index and the count.
+
+// MaxDAOCoinHoldersPerQuery bounds the number of holders a single query returns.
+const MaxDAOCoinHoldersPerQuery = 1000
+
+// GetDAOCoinHoldersPaginated returns up to limit holders of the DAO coin with a non-zero
+// balance, largest balance first, along with the total number of such holders. Holders with
+// the same balance are sorted by PKID. To get the next page, pass the last holder of the
+// previous page as lastHolder. Balances modified in the view take precedence over the db.
+func (bav *UtxoView) GetDAOCoinHoldersPaginated(creatorPKID *PKID, lastHolder *BalanceEntry, limit int) (
+	_holders []*BalanceEntry, _numHolders uint64, _err error) {
+
+	if creatorPKID == nil {
+		return nil, 0, fmt.Errorf("GetDAOCoinHoldersPaginated: Called with nil creatorPKID")
+	}
+	if limit <= 0 || limit > MaxDAOCoinHoldersPerQuery {
+		return nil, 0, fmt.Errorf("GetDAOCoinHoldersPaginated: Limit %v must be between 1 and %v",
+			limit, MaxDAOCoinHoldersPerQuery)
+	}
+
+	// Find the coin's balance entries that were modified in the view. Their db entries are
+	// stale, so we skip them below and use the view's instead.
+	var viewHolders []*BalanceEntry
+	viewBalanceEntryKeys := NewSet([]BalanceEntryMapKey{})
+	for balanceEntryKey, balanceEntry := range bav.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry {
+		if balanceEntry == nil || !balanceEntry.CreatorPKID.Eq(creatorPKID) {
+			continue
+		}
+		viewBalanceEntryKeys.Add(balanceEntryKey)
+		if !balanceEntry.isDeleted && !balanceEntry.BalanceNanos.IsZero() {
+			viewHolders = append(viewHolders, balanceEntry)
+		}
+	}
+
+	// Start from the db's count, and account for the holders the view added or removed.
+	dbAdapter := bav.GetDbAdapter()
+	numHolders, err := dbAdapter.GetDAOCoinHolderCount(creatorPKID)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "GetDAOCoinHoldersPaginated: Problem getting number of holders: ")
+	}
+	for _, balanceEntryKey := range viewBalanceEntryKeys.ToSlice() {
+		viewBalanceEntry := bav.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry[balanceEntryKey]
+		dbBalanceEntry := dbAdapter.GetBalanceEntry(&balanceEntryKey.HODLerPKID, creatorPKID, true)
+		isHolderInDb := dbBalanceEntry != nil && !dbBalanceEntry.BalanceNanos.IsZero()
+		isHolderInView := !viewBalanceEntry.isDeleted && !viewBalanceEntry.BalanceNanos.IsZero()
+		if isHolderInView && !isHolderInDb {
+			numHolders++
+		} else if !isHolderInView && isHolderInDb && numHolders > 0 {
+			numHolders--
+		}
+	}
+
+	// Fetch enough holders from the db to fill the page even if all of the view's entries
+	// are among them.
+	dbHolders, err := dbAdapter.GetDAOCoinHoldersByBalance(
+		creatorPKID, lastHolder, limit+viewBalanceEntryKeys.Size())
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "GetDAOCoinHoldersPaginated: Problem getting holders from db: ")
+	}
+	var holders []*BalanceEntry
+	for _, dbHolder := range dbHolders {
+		if viewBalanceEntryKeys.Includes(MakeBalanceEntryKey(dbHolder.HODLerPKID, dbHolder.CreatorPKID)) {
+			continue
+		}
+		holders = append(holders, dbHolder)
+	}
+	for _, viewHolder := range viewHolders {
+		if lastHolder == nil || _isDAOCoinHolderBefore(lastHolder, viewHolder) {
+			holders = append(holders, viewHolder.Copy())
+		}
+	}
+
+	sort.Slice(holders, func(ii, jj int) bool {
+		return _isDAOCoinHolderBefore(holders[ii], holders[jj])
+	})
+	if len(holders) > limit {
+		holders = holders[:limit]
+	}
+	return holders, numHolders, nil
+}
+
+// _isDAOCoinHolderBefore returns whether holder comes before otherHolder when sorting holders
+// by balance, largest first, and then by PKID.
+func _isDAOCoinHolderBefore(holder *BalanceEntry, otherHolder *BalanceEntry) bool {
+	if cmp := holder.BalanceNanos.Cmp(&otherHolder.BalanceNanos); cmp != 0 {
+		return cmp > 0
+	}
+	return bytes.Compare(holder.HODLerPKID[:], otherHolder.HODLerPKID[:]) < 0
+}
+
+//
+// DB UTILS
+//
+
+func _dbKeyForDAOCoinHolderByCreatorPKIDAndBalance(creatorPKID *PKID, balanceNanos *uint256.Int, hodlerPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinHolderByCreatorPKIDAndBalance...)
+	key = append(key, creatorPKID[:]...)
+	// Invert the balance so that larger balances sort first.
+	balanceBytes := balanceNanos.Bytes32()
+	for ii := range balanceBytes {
+		balanceBytes[ii] = ^balanceBytes[ii]
+	}
+	key = append(key, balanceBytes[:]...)
+	key = append(key, hodlerPKID[:]...)
+	return key
+}
+
+func _dbKeyForDAOCoinHolderCountByCreatorPKID(creatorPKID *PKID) []byte {
+	return append(append([]byte{}, Prefixes.PrefixDAOCoinHolderCountByCreatorPKID...), creatorPKID[:]...)
+}
+
+// _dbPutDAOCoinHolderIndexEntryWithTxn adds the holder of a DAO coin balance entry that was
+// just put in the db to the holder index.
+func _dbPutDAOCoinHolderIndexEntryWithTxn(txn *badger.Txn, balanceEntry *BalanceEntry) error {
+	if balanceEntry.BalanceNanos.IsZero() {
+		return nil
+	}
+	key := _dbKeyForDAOCoinHolderByCreatorPKIDAndBalance(
+		balanceEntry.CreatorPKID, &balanceEntry.BalanceNanos, balanceEntry.HODLerPKID)
+	if _, err := txn.Get(key); err == nil {
+		return nil
+	} else if err != badger.ErrKeyNotFound {
+		return errors.Wrapf(err, "_dbPutDAOCoinHolderIndexEntryWithTxn: Problem checking holder: ")
+	}
+	if err := DBSetWithTxn(txn, nil, key, []byte{}, nil); err != nil {
+		return errors.Wrapf(err, "_dbPutDAOCoinHolderIndexEntryWithTxn: Problem adding holder: ")
+	}
+	return _dbAddToDAOCoinHolderCountWithTxn(txn, balanceEntry.CreatorPKID, 1)
+}
+
+// _dbDeleteDAOCoinHolderIndexEntryWithTxn removes the holder of a DAO coin balance entry
+// that's about to be deleted from the db from the holder index.
+func _dbDeleteDAOCoinHolderIndexEntryWithTxn(txn *badger.Txn, balanceEntry *BalanceEntry) error {
+	if balanceEntry.BalanceNanos.IsZero() {
+		return nil
+	}
+	key := _dbKeyForDAOCoinHolderByCreatorPKIDAndBalance(
+		balanceEntry.CreatorPKID, &balanceEntry.BalanceNanos, balanceEntry.HODLerPKID)
+	if _, err := txn.Get(key); err == badger.ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "_dbDeleteDAOCoinHolderIndexEntryWithTxn: Problem checking holder: ")
+	}
+	if err := DBDeleteWithTxn(txn, nil, key, nil, true); err != nil {
+		return errors.Wrapf(err, "_dbDeleteDAOCoinHolderIndexEntryWithTxn: Problem deleting holder: ")
+	}
+	return _dbAddToDAOCoinHolderCountWithTxn(txn, balanceEntry.CreatorPKID, -1)
+}
+
+func _dbAddToDAOCoinHolderCountWithTxn(txn *badger.Txn, creatorPKID *PKID, delta int64) error {
+	numHolders, err := DBGetDAOCoinHolderCountWithTxn(txn, creatorPKID)
+	if err != nil {
+		return err
+	}
+	if delta < 0 && uint64(-delta) > numHolders {
+		return fmt.Errorf("_dbAddToDAOCoinHolderCountWithTxn: Removing %v holders from DAO coin %v "+
+			"with %v holders", -delta, PkToStringBoth(creatorPKID[:]), numHolders)
+	}
+	numHolders = uint64(int64(numHolders) + delta)
+
+	key := _dbKeyForDAOCoinHolderCountByCreatorPKID(creatorPKID)
+	if numHolders == 0 {
+		return DBDeleteWithTxn(txn, nil, key, nil, true)
+	}
+	return DBSetWithTxn(txn, nil, key, EncodeUint64(numHolders), nil)
+}
+
+// DBGetDAOCoinHolderCountWithTxn returns the number of holders of the DAO coin with a
+// non-zero balance.
+func DBGetDAOCoinHolderCountWithTxn(txn *badger.Txn, creatorPKID *PKID) (uint64, error) {
+	numHoldersBytes, err := DBGetWithTxn(txn, nil, _dbKeyForDAOCoinHolderCountByCreatorPKID(creatorPKID))
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "DBGetDAOCoinHolderCountWithTxn: Problem getting number of holders: ")
+	}
+	return DecodeUint64(numHoldersBytes), nil
+}
+
+func DBGetDAOCoinHolderCount(handle *badger.DB, creatorPKID *PKID) (uint64, error) {
+	var numHolders uint64
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		numHolders, err = DBGetDAOCoinHolderCountWithTxn(txn, creatorPKID)
+		return err
+	})
+	return numHolders, err
+}
+
+// DBGetDAOCoinHoldersByBalanceWithTxn returns up to limit balance entries of the DAO coin's
+// holders with a non-zero balance, largest balance first. If lastHolder is set, the holders
+// start right after it.
+func DBGetDAOCoinHoldersByBalanceWithTxn(txn *badger.Txn, snap *Snapshot, creatorPKID *PKID,
+	lastHolder *BalanceEntry, limit int) ([]*BalanceEntry, error) {
+
+	prefix := append(append([]byte{}, Prefixes.PrefixDAOCoinHolderByCreatorPKIDAndBalance...), creatorPKID[:]...)
+	startKey := prefix
+	var lastKey []byte
+	if lastHolder != nil {
+		lastKey = _dbKeyForDAOCoinHolderByCreatorPKIDAndBalance(
+			creatorPKID, &lastHolder.BalanceNanos, lastHolder.HODLerPKID)
+		startKey = lastKey
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	var holders []*BalanceEntry
+	for iterator.Seek(startKey); iterator.ValidForPrefix(prefix) && len(holders) < limit; iterator.Next() {
+		key := iterator.Item().Key()
+		if lastKey != nil && bytes.Equal(key, lastKey) {
+			continue
+		}
+		hodlerPKID := NewPKID(key[len(key)-PublicKeyLenCompressed:])
+		balanceEntry := DBGetBalanceEntryForCreatorPKIDAndHODLerPubKeyWithTxn(txn, snap, creatorPKID, hodlerPKID, true)
+		if balanceEntry == nil {
+			return nil, fmt.Errorf("DBGetDAOCoinHoldersByBalanceWithTxn: Missing balance entry for holder %v "+
+				"of DAO coin %v", PkToStringBoth(hodlerPKID[:]), PkToStringBoth(creatorPKID[:]))
+		}
+		holders = append(holders, balanceEntry)
+	}
+	return holders, nil
+}
+
+func DBGetDAOCoinHoldersByBalance(handle *badger.DB, snap *Snapshot, creatorPKID *PKID,
+	lastHolder *BalanceEntry, limit int) ([]*BalanceEntry, error) {
+
+	var holders []*BalanceEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		holders, err = DBGetDAOCoinHoldersByBalanceWithTxn(txn, snap, creatorPKID, lastHolder, limit)
+		return err
+	})
+	return holders, err
+}
+
+// DbBuildDAOCoinHolderIndexIfMissing builds the DAO coin holder index if it hasn't been built
+// yet, e.g. because the db was created before the index existed.
+func DbBuildDAOCoinHolderIndexIfMissing(handle *badger.DB) error {
+	isBuilt := false
+	err := handle.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(Prefixes.PrefixDAOCoinHolderIndexBuilt)
+		if err == nil {
+			isBuilt = true
+			return nil
+		} else if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbBuildDAOCoinHolderIndexIfMissing: Problem checking index: ")
+	}
+	if isBuilt {
+		return nil
+	}
+	return DbRebuildDAOCoinHolderIndex(handle)
+}
+
+// DbRebuildDAOCoinHolderIndex clears the DAO coin holder index and builds it again from the
+// DAO coin balance entries in the db.
+func DbRebuildDAOCoinHolderIndex(handle *badger.DB) error {
+	glog.Infof("DbRebuildDAOCoinHolderIndex: Building DAO coin holder index")
+
+	// Clear the existing index, starting with the marker so that the index is rebuilt if
+	// we're interrupted.
+	var keysToDelete [][]byte
+	err := handle.View(func(txn *badger.Txn) error {
+		for _, prefix := range [][]byte{
+			Prefixes.PrefixDAOCoinHolderIndexBuilt,
+			Prefixes.PrefixDAOCoinHolderByCreatorPKIDAndBalance,
+			Prefixes.PrefixDAOCoinHolderCountByCreatorPKID,
+		} {
+			keysToDelete = append(keysToDelete, _enumerateKeysOnlyForPrefixWithTxn(txn, prefix)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbRebuildDAOCoinHolderIndex: Problem enumerating index: ")
+	}
+	deleteBatch := handle.NewWriteBatch()
+	defer deleteBatch.Cancel()
+	for _, key := range keysToDelete {
+		if err = deleteBatch.Delete(key); err != nil {
+			return errors.Wrapf(err, "DbRebuildDAOCoinHolderIndex: Problem deleting index: ")
+		}
+	}
+	if err = deleteBatch.Flush(); err != nil {
+		return errors.Wrapf(err, "DbRebuildDAOCoinHolderIndex: Problem deleting index: ")
+	}
+
+	// Index every holder with a non-zero balance, and count the holders of each coin.
+	writeBatch := handle.NewWriteBatch()
+	defer writeBatch.Cancel()
+	numHoldersByCreatorPKID := make(map[PKID]uint64)
+	err = handle.View(func(txn *badger.Txn) error {
+		prefix := Prefixes.PrefixCreatorPKIDHODLerPKIDToDAOCoinBalanceEntry
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			balanceEntryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			balanceEntry := &BalanceEntry{}
+			if exists, err := DecodeFromBytes(balanceEntry, bytes.NewReader(balanceEntryBytes)); err != nil {
+				return errors.Wrapf(err, "Problem decoding balance entry: ")
+			} else if !exists {
+				continue
+			}
+			if balanceEntry.BalanceNanos.IsZero() {
+				continue
+			}
+			key := _dbKeyForDAOCoinHolderByCreatorPKIDAndBalance(
+				balanceEntry.CreatorPKID, &balanceEntry.BalanceNanos, balanceEntry.HODLerPKID)
+			if err = writeBatch.Set(key, []byte{}); err != nil {
+				return err
+			}
+			numHoldersByCreatorPKID[*balanceEntry.CreatorPKID]++
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbRebuildDAOCoinHolderIndex: Problem indexing holders: ")
+	}
+	for creatorPKID, numHolders := range numHoldersByCreatorPKID {
+		creatorPKIDCopy := creatorPKID
+		if err = writeBatch.Set(_dbKeyForDAOCoinHolderCountByCreatorPKID(&creatorPKIDCopy), EncodeUint64(numHolders)); err != nil {
+			return errors.Wrapf(err, "DbRebuildDAOCoinHolderIndex: Problem setting number of holders: ")
+		}
+	}
+	if err = writeBatch.Set(Prefixes.PrefixDAOCoinHolderIndexBuilt, []byte{}); err != nil {
+		return errors.Wrapf(err, "DbRebuildDAOCoinHolderIndex: Problem marking index as built: ")
+	}
+	if err = writeBatch.Flush(); err != nil {
+		return errors.Wrapf(err, "DbRebuildDAOCoinHolderIndex: Problem writing index: ")
+	}
+
+	glog.Infof("DbRebuildDAOCoinHolderIndex: Indexed holders of %v DAO coins", len(numHoldersByCreatorPKID))
+	return nil
+}
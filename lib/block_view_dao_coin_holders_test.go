@@ -0,0 +1,96 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinHolders(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+
+	creatorPKID := NewPKID(m0PkBytes)
+	m1PKID, m2PKID, m3PKID, m4PKID := NewPKID(m1PkBytes), NewPKID(m2PkBytes), NewPKID(m3PkBytes), NewPKID(m4PkBytes)
+	makeBalanceEntry := func(hodlerPKID *PKID, balanceNanos uint64) *BalanceEntry {
+		return &BalanceEntry{
+			HODLerPKID:   hodlerPKID,
+			CreatorPKID:  creatorPKID,
+			BalanceNanos: *uint256.NewInt().SetUint64(balanceNanos),
+			HasPurchased: true,
+		}
+	}
+	putBalanceEntry := func(balanceEntry *BalanceEntry) {
+		require.NoError(DBDeleteBalanceEntryMappings(
+			db, nil, balanceEntry.HODLerPKID, balanceEntry.CreatorPKID, true, nil, false))
+		require.NoError(DBPutBalanceEntryMappings(db, nil, 0, balanceEntry, true, nil))
+	}
+	getHolderPKIDs := func(holders []*BalanceEntry) []*PKID {
+		var hodlerPKIDs []*PKID
+		for _, holder := range holders {
+			hodlerPKIDs = append(hodlerPKIDs, holder.HODLerPKID)
+		}
+		return hodlerPKIDs
+	}
+	// m1 and m3 hold the same balance, so they're sorted by PKID.
+	firstPKID, secondPKID := m1PKID, m3PKID
+	if bytes.Compare(m3PKID[:], m1PKID[:]) < 0 {
+		firstPKID, secondPKID = m3PKID, m1PKID
+	}
+
+	// Holders are sorted by balance, and holders with a zero balance aren't counted.
+	putBalanceEntry(makeBalanceEntry(m1PKID, 100))
+	putBalanceEntry(makeBalanceEntry(m2PKID, 300))
+	putBalanceEntry(makeBalanceEntry(m3PKID, 100))
+	putBalanceEntry(makeBalanceEntry(m4PKID, 0))
+	numHolders, err := DBGetDAOCoinHolderCount(db, creatorPKID)
+	require.NoError(err)
+	require.Equal(uint64(3), numHolders)
+	holders, err := DBGetDAOCoinHoldersByBalance(db, nil, creatorPKID, nil, 2)
+	require.NoError(err)
+	require.Equal([]*PKID{m2PKID, firstPKID}, getHolderPKIDs(holders))
+	holders, err = DBGetDAOCoinHoldersByBalance(db, nil, creatorPKID, holders[1], 2)
+	require.NoError(err)
+	require.Equal([]*PKID{secondPKID}, getHolderPKIDs(holders))
+
+	// Updating and deleting balance entries keeps the index and count in sync.
+	putBalanceEntry(makeBalanceEntry(m2PKID, 50))
+	require.NoError(DBDeleteBalanceEntryMappings(db, nil, m3PKID, creatorPKID, true, nil, true))
+	holders, err = DBGetDAOCoinHoldersByBalance(db, nil, creatorPKID, nil, 10)
+	require.NoError(err)
+	require.Equal([]*PKID{m1PKID, m2PKID}, getHolderPKIDs(holders))
+	require.Equal(uint64(50), holders[1].BalanceNanos.Uint64())
+	numHolders, err = DBGetDAOCoinHolderCount(db, creatorPKID)
+	require.NoError(err)
+	require.Equal(uint64(2), numHolders)
+
+	// Rebuilding the index from the balance entries gives the same result.
+	require.NoError(DbRebuildDAOCoinHolderIndex(db))
+	rebuiltHolders, err := DBGetDAOCoinHoldersByBalance(db, nil, creatorPKID, nil, 10)
+	require.NoError(err)
+	require.Equal(holders, rebuiltHolders)
+	numHolders, err = DBGetDAOCoinHolderCount(db, creatorPKID)
+	require.NoError(err)
+	require.Equal(uint64(2), numHolders)
+
+	// Balances modified in the view take precedence over the db.
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	utxoView._setDAOCoinBalanceEntryMappings(makeBalanceEntry(m4PKID, 500))
+	utxoView._deleteBalanceEntryMappingsWithPKIDs(makeBalanceEntry(m1PKID, 100), m1PKID, creatorPKID, true)
+	holders, numHolders, err = utxoView.GetDAOCoinHoldersPaginated(creatorPKID, nil, 1)
+	require.NoError(err)
+	require.Equal([]*PKID{m4PKID}, getHolderPKIDs(holders))
+	require.Equal(uint64(2), numHolders)
+	holders, numHolders, err = utxoView.GetDAOCoinHoldersPaginated(creatorPKID, holders[0], 1)
+	require.NoError(err)
+	require.Equal([]*PKID{m2PKID}, getHolderPKIDs(holders))
+	_, _, err = utxoView.GetDAOCoinHoldersPaginated(creatorPKID, nil, MaxDAOCoinHoldersPerQuery+1)
+	require.Error(err)
+}
@@ -0,0 +1,421 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_dao_coin_last_trade_price.go tracks the price of the last trade between
+// each pair of DAO coins. Stop-limit orders rest in the order book dormant until the
+// last trade price of their pair reaches their StopTriggerScaledPrice.
+//
+// The price is stored once for each direction of the pair, expressed like the
+// ScaledExchangeRateCoinsToSellPerCoinToBuy of an order buying the first coin and
+// selling the second, so that an order can be compared against the entry for its
+// own direction without converting between the two.
+//
+// Each entry also tracks a time-weighted price that moves linearly from its previous
+// value toward the last trade price over DAOCoinTimeWeightedPriceWindowBlocks. A single
+// trade at an outlying price only moves it by the fraction of the window that passes
+// before the next trade, so it's used wherever a price needs to be hard to manipulate,
+// e.g. to convert DAO coin fees.
+
+// DAOCoinTimeWeightedPriceWindowBlocks is the number of blocks it takes the time-weighted
+// price of a pair to fully converge to the last trade price, roughly a day on mainnet.
+const DAOCoinTimeWeightedPriceWindowBlocks = 288
+
+//
+// TYPES: DAOCoinLastTradePriceEntry
+//
+
+type DAOCoinLastTradePriceEntry struct {
+	// The coin an order in this direction of the pair is buying.
+	BuyingDAOCoinCreatorPKID *PKID
+	// The coin an order in this direction of the pair is selling.
+	SellingDAOCoinCreatorPKID *PKID
+	// The price of the last trade, in coins to sell per coin to buy.
+	ScaledExchangeRateCoinsToSellPerCoinToBuy *uint256.Int
+	// The time-weighted price at the height of the last trade, before the last trade is
+	// taken into account. Use GetTimeWeightedScaledExchangeRate to get its current value.
+	TimeWeightedScaledExchangeRate *uint256.Int
+	// The block height of the last trade.
+	BlockHeight uint32
+
+	isDeleted bool
+}
+
+type DAOCoinPairMapKey struct {
+	BuyingDAOCoinCreatorPKID  PKID
+	SellingDAOCoinCreatorPKID PKID
+}
+
+func MakeDAOCoinPairMapKey(buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID) DAOCoinPairMapKey {
+	return DAOCoinPairMapKey{
+		BuyingDAOCoinCreatorPKID:  *buyingDAOCoinCreatorPKID,
+		SellingDAOCoinCreatorPKID: *sellingDAOCoinCreatorPKID,
+	}
+}
+
+func (entry *DAOCoinLastTradePriceEntry) ToMapKey() DAOCoinPairMapKey {
+	return MakeDAOCoinPairMapKey(entry.BuyingDAOCoinCreatorPKID, entry.SellingDAOCoinCreatorPKID)
+}
+
+func (entry *DAOCoinLastTradePriceEntry) Copy() *DAOCoinLastTradePriceEntry {
+	// Tombstones created on disconnect only carry the pair.
+	var scaledPrice, timeWeightedScaledPrice *uint256.Int
+	if entry.ScaledExchangeRateCoinsToSellPerCoinToBuy != nil {
+		scaledPrice = entry.ScaledExchangeRateCoinsToSellPerCoinToBuy.Clone()
+	}
+	if entry.TimeWeightedScaledExchangeRate != nil {
+		timeWeightedScaledPrice = entry.TimeWeightedScaledExchangeRate.Clone()
+	}
+	return &DAOCoinLastTradePriceEntry{
+		BuyingDAOCoinCreatorPKID:                  entry.BuyingDAOCoinCreatorPKID.NewPKID(),
+		SellingDAOCoinCreatorPKID:                 entry.SellingDAOCoinCreatorPKID.NewPKID(),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice,
+		TimeWeightedScaledExchangeRate:            timeWeightedScaledPrice,
+		BlockHeight:                               entry.BlockHeight,
+		isDeleted:                                 entry.isDeleted,
+	}
+}
+
+func (entry *DAOCoinLastTradePriceEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.BuyingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.SellingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, VariableEncodeUint256(entry.ScaledExchangeRateCoinsToSellPerCoinToBuy)...)
+	data = append(data, VariableEncodeUint256(entry.TimeWeightedScaledExchangeRate)...)
+	data = append(data, UintToBuf(uint64(entry.BlockHeight))...)
+	return data
+}
+
+func (entry *DAOCoinLastTradePriceEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// BuyingDAOCoinCreatorPKID
+	entry.BuyingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLastTradePriceEntry.Decode: Problem reading BuyingDAOCoinCreatorPKID: ")
+	}
+
+	// SellingDAOCoinCreatorPKID
+	entry.SellingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLastTradePriceEntry.Decode: Problem reading SellingDAOCoinCreatorPKID: ")
+	}
+
+	// ScaledExchangeRateCoinsToSellPerCoinToBuy
+	entry.ScaledExchangeRateCoinsToSellPerCoinToBuy, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLastTradePriceEntry.Decode: Problem reading ScaledExchangeRateCoinsToSellPerCoinToBuy: ")
+	}
+
+	// TimeWeightedScaledExchangeRate
+	entry.TimeWeightedScaledExchangeRate, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLastTradePriceEntry.Decode: Problem reading TimeWeightedScaledExchangeRate: ")
+	}
+
+	// BlockHeight
+	entryBlockHeight, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLastTradePriceEntry.Decode: Problem reading BlockHeight: ")
+	}
+	if entryBlockHeight > uint64(math.MaxUint32) {
+		return fmt.Errorf("DAOCoinLastTradePriceEntry.Decode: Invalid BlockHeight %d: Greater than max uint32",
+			entryBlockHeight)
+	}
+	entry.BlockHeight = uint32(entryBlockHeight)
+
+	return nil
+}
+
+func (entry *DAOCoinLastTradePriceEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DAOCoinLastTradePriceEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDAOCoinLastTradePriceEntry
+}
+
+// GetTimeWeightedScaledExchangeRate returns the time-weighted price of the pair at
+// blockHeight. It moves linearly from TimeWeightedScaledExchangeRate toward the last
+// trade price, reaching it DAOCoinTimeWeightedPriceWindowBlocks after the last trade.
+func (entry *DAOCoinLastTradePriceEntry) GetTimeWeightedScaledExchangeRate(blockHeight uint32) *uint256.Int {
+	lastPrice := entry.ScaledExchangeRateCoinsToSellPerCoinToBuy
+	timeWeightedPrice := entry.TimeWeightedScaledExchangeRate
+	if timeWeightedPrice == nil {
+		return lastPrice.Clone()
+	}
+	elapsedBlocks := uint64(0)
+	if blockHeight > entry.BlockHeight {
+		elapsedBlocks = uint64(blockHeight - entry.BlockHeight)
+	}
+	if elapsedBlocks >= DAOCoinTimeWeightedPriceWindowBlocks {
+		return lastPrice.Clone()
+	}
+
+	// twap + (lastPrice - twap) * elapsed / window. The difference may be negative, so
+	// we compute it with big.Ints. The result always lies between the two prices, so it
+	// fits in a uint256.
+	diff := big.NewInt(0).Sub(lastPrice.ToBig(), timeWeightedPrice.ToBig())
+	diff.Mul(diff, big.NewInt(0).SetUint64(elapsedBlocks))
+	diff.Quo(diff, big.NewInt(DAOCoinTimeWeightedPriceWindowBlocks))
+	result, _ := uint256.FromBig(diff.Add(diff, timeWeightedPrice.ToBig()))
+	return result
+}
+
+// InvertScaledExchangeRate converts a scaled exchange rate in coins to sell per coin to
+// buy into the rate for the opposite direction of the pair, i.e. 1e38 * 1e38 / rate.
+func InvertScaledExchangeRate(scaledExchangeRate *uint256.Int) (*uint256.Int, error) {
+	if scaledExchangeRate == nil || scaledExchangeRate.IsZero() {
+		return nil, fmt.Errorf("InvertScaledExchangeRate: Exchange rate must be non-zero")
+	}
+	// 1e76 fits comfortably within a uint256, so this can't overflow.
+	scaledOne := uint256.NewInt().Mul(OneE38, OneE38)
+	return uint256.NewInt().Div(scaledOne, scaledExchangeRate), nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForDAOCoinLastTradePriceEntry(buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinLastTradePriceByPair...)
+	key = append(key, buyingDAOCoinCreatorPKID.ToBytes()...)
+	key = append(key, sellingDAOCoinCreatorPKID.ToBytes()...)
+	return key
+}
+
+func DBGetDAOCoinLastTradePriceEntry(
+	handle *badger.DB,
+	snap *Snapshot,
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+) (*DAOCoinLastTradePriceEntry, error) {
+	var ret *DAOCoinLastTradePriceEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetDAOCoinLastTradePriceEntryWithTxn(
+			txn, snap, buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetDAOCoinLastTradePriceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+) (*DAOCoinLastTradePriceEntry, error) {
+	// Retrieve DAOCoinLastTradePriceEntry from db.
+	key := DBKeyForDAOCoinLastTradePriceEntry(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+	entryBytes, err := DBGetWithTxn(txn, snap, key)
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetDAOCoinLastTradePriceEntry: problem retrieving DAOCoinLastTradePriceEntry: ")
+	}
+
+	// Decode DAOCoinLastTradePriceEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&DAOCoinLastTradePriceEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDAOCoinLastTradePriceEntry: problem decoding DAOCoinLastTradePriceEntry: ")
+	}
+	return entry, nil
+}
+
+func DBPutDAOCoinLastTradePriceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinLastTradePriceEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinLastTradePriceEntry(entry.BuyingDAOCoinCreatorPKID, entry.SellingDAOCoinCreatorPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutDAOCoinLastTradePriceEntryWithTxn: problem storing DAOCoinLastTradePriceEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteDAOCoinLastTradePriceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinLastTradePriceEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinLastTradePriceEntry(entry.BuyingDAOCoinCreatorPKID, entry.SellingDAOCoinCreatorPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteDAOCoinLastTradePriceEntryWithTxn: problem deleting DAOCoinLastTradePriceEntry: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetDAOCoinLastTradePriceEntry returns the last trade price for the direction of the
+// pair that buys buyingDAOCoinCreatorPKID and sells sellingDAOCoinCreatorPKID, or nil
+// if the pair hasn't traded since the stop-limit fork.
+func (bav *UtxoView) GetDAOCoinLastTradePriceEntry(
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+) (*DAOCoinLastTradePriceEntry, error) {
+	// First check the UtxoView.
+	mapKey := MakeDAOCoinPairMapKey(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+	if entry, exists := bav.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetDAOCoinLastTradePriceEntry(
+		buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDAOCoinLastTradePriceEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the DAOCoinLastTradePriceEntry from the db in the UtxoView.
+		bav._setDAOCoinLastTradePriceEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetDAOCoinLastTradePrice is a convenience wrapper around GetDAOCoinLastTradePriceEntry
+// that returns just the price, or nil if the pair hasn't traded.
+func (bav *UtxoView) GetDAOCoinLastTradePrice(
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+) (*uint256.Int, error) {
+	entry, err := bav.GetDAOCoinLastTradePriceEntry(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry.ScaledExchangeRateCoinsToSellPerCoinToBuy, nil
+}
+
+// _setDAOCoinLastTradePrices records a trade at scaledPrice, expressed for the direction
+// of the pair that buys buyingDAOCoinCreatorPKID and sells sellingDAOCoinCreatorPKID, on
+// both directions of the pair. The time-weighted price of each direction carries over
+// from the entry it replaces, or starts at the trade price if the pair hasn't traded. It
+// returns the entries it replaced so that they can be restored on disconnect.
+func (bav *UtxoView) _setDAOCoinLastTradePrices(
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+	scaledPrice *uint256.Int,
+	blockHeight uint32,
+) ([]*DAOCoinLastTradePriceEntry, error) {
+	invertedScaledPrice, err := InvertScaledExchangeRate(scaledPrice)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_setDAOCoinLastTradePrices: ")
+	}
+
+	newEntries := []*DAOCoinLastTradePriceEntry{
+		{
+			BuyingDAOCoinCreatorPKID:                  buyingDAOCoinCreatorPKID.NewPKID(),
+			SellingDAOCoinCreatorPKID:                 sellingDAOCoinCreatorPKID.NewPKID(),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice.Clone(),
+			BlockHeight: blockHeight,
+		},
+		{
+			BuyingDAOCoinCreatorPKID:                  sellingDAOCoinCreatorPKID.NewPKID(),
+			SellingDAOCoinCreatorPKID:                 buyingDAOCoinCreatorPKID.NewPKID(),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: invertedScaledPrice,
+			BlockHeight: blockHeight,
+		},
+	}
+
+	var prevEntries []*DAOCoinLastTradePriceEntry
+	for _, newEntry := range newEntries {
+		prevEntry, err := bav.GetDAOCoinLastTradePriceEntry(
+			newEntry.BuyingDAOCoinCreatorPKID, newEntry.SellingDAOCoinCreatorPKID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "_setDAOCoinLastTradePrices: ")
+		}
+		if prevEntry != nil {
+			prevEntries = append(prevEntries, prevEntry.Copy())
+			newEntry.TimeWeightedScaledExchangeRate = prevEntry.GetTimeWeightedScaledExchangeRate(blockHeight)
+		} else {
+			newEntry.TimeWeightedScaledExchangeRate = newEntry.ScaledExchangeRateCoinsToSellPerCoinToBuy.Clone()
+		}
+		bav._setDAOCoinLastTradePriceEntryMappings(newEntry)
+	}
+	return prevEntries, nil
+}
+
+func (bav *UtxoView) _setDAOCoinLastTradePriceEntryMappings(entry *DAOCoinLastTradePriceEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setDAOCoinLastTradePriceEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteDAOCoinLastTradePriceEntryMappings(entry *DAOCoinLastTradePriceEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteDAOCoinLastTradePriceEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setDAOCoinLastTradePriceEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushDAOCoinLastTradePriceEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushDAOCoinLastTradePriceEntriesToDbWithTxn: DAOCoinLastTradePriceEntry pair %v, %v "+
+					"doesn't match MapKey %v",
+				entry.BuyingDAOCoinCreatorPKID, entry.SellingDAOCoinCreatorPKID, mapKey,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteDAOCoinLastTradePriceEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDAOCoinLastTradePriceEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutDAOCoinLastTradePriceEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDAOCoinLastTradePriceEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
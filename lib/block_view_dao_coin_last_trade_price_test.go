@@ -0,0 +1,174 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinLimitOrderStopLimit(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.DAOCoinLimitOrderStopLimitBlockHeight = 0
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+
+	// The trigger is encoded as the third optional field.
+	triggerScaledPrice, err := CalculateScaledExchangeRateFromString("2")
+	require.NoError(err)
+	metadata := &DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: triggerScaledPrice.Clone(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		FeeNanos:                                  1000,
+		StopTriggerScaledPrice:                    triggerScaledPrice.Clone(),
+	}
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Nil(decodedMetadata.MaxSlippageScaledPrice)
+	require.True(decodedMetadata.StopTriggerScaledPrice.Eq(triggerScaledPrice))
+
+	// A stop order is dormant until the last trade price reaches its trigger.
+	daoCoinPKID := NewPKID(m0PkBytes)
+	stopAsk := &DAOCoinLimitOrderEntry{
+		OrderID:                   NewBlockHash(uint256.NewInt().SetUint64(1).Bytes()),
+		TransactorPKID:            NewPKID(m1PkBytes),
+		BuyingDAOCoinCreatorPKID:  &ZeroPKID,
+		SellingDAOCoinCreatorPKID: daoCoinPKID,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: triggerScaledPrice.Clone(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		BlockHeight:                               1,
+		StopTriggerScaledPrice:                    triggerScaledPrice.Clone(),
+	}
+	require.True(stopAsk.IsDormantStopOrder(nil))
+	require.True(stopAsk.IsDormantStopOrder(OneE38))
+	require.False(stopAsk.IsDormantStopOrder(triggerScaledPrice))
+	regularAsk := stopAsk.Copy()
+	regularAsk.StopTriggerScaledPrice = nil
+	require.False(regularAsk.IsDormantStopOrder(nil))
+
+	// Inverting 0.5 gives 2.
+	halfScaledPrice, err := CalculateScaledExchangeRateFromString("0.5")
+	require.NoError(err)
+	invertedScaledPrice, err := InvertScaledExchangeRate(halfScaledPrice)
+	require.NoError(err)
+	require.True(invertedScaledPrice.Eq(triggerScaledPrice))
+	_, err = InvertScaledExchangeRate(uint256.NewInt())
+	require.Error(err)
+
+	// A trade sets the price in both directions and returns nothing to restore
+	// for a pair that hasn't traded before.
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	prevEntries, err := utxoView._setDAOCoinLastTradePrices(daoCoinPKID, &ZeroPKID, halfScaledPrice, 1)
+	require.NoError(err)
+	require.Empty(prevEntries)
+	utxoView._setDAOCoinLimitOrderEntryMappings(stopAsk)
+	require.NoError(utxoView.FlushToDb(1))
+
+	// The prices and the stop order's trigger are read back from the db.
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+	lastTradePrice, err := utxoView.GetDAOCoinLastTradePrice(&ZeroPKID, daoCoinPKID)
+	require.NoError(err)
+	require.True(lastTradePrice.Eq(triggerScaledPrice))
+	lastTradePrice, err = utxoView.GetDAOCoinLastTradePrice(daoCoinPKID, &ZeroPKID)
+	require.NoError(err)
+	require.True(lastTradePrice.Eq(halfScaledPrice))
+	dbOrder, err := utxoView.GetDbAdapter().GetDAOCoinLimitOrder(stopAsk.OrderID)
+	require.NoError(err)
+	require.True(dbOrder.StopTriggerScaledPrice.Eq(triggerScaledPrice))
+
+	// A bid matching the stop ask only finds it once the ask's trigger is reached.
+	bid := &DAOCoinLimitOrderEntry{
+		OrderID:                   NewBlockHash(uint256.NewInt().SetUint64(2).Bytes()),
+		TransactorPKID:            NewPKID(m2PkBytes),
+		BuyingDAOCoinCreatorPKID:  daoCoinPKID,
+		SellingDAOCoinCreatorPKID: &ZeroPKID,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: halfScaledPrice.Clone(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		BlockHeight:                               2,
+	}
+	getMatchingOrders := func(lastTradePrice *uint256.Int) []*DAOCoinLimitOrderEntry {
+		var matchingOrders []*DAOCoinLimitOrderEntry
+		require.NoError(db.View(func(txn *badger.Txn) error {
+			var err error
+			matchingOrders, err = DBGetMatchingDAOCoinLimitOrders(txn, bid, nil, nil, lastTradePrice)
+			return err
+		}))
+		return matchingOrders
+	}
+	require.Empty(getMatchingOrders(halfScaledPrice))
+	require.Len(getMatchingOrders(triggerScaledPrice), 1)
+
+	// A later trade returns the entries it replaced.
+	prevEntries, err = utxoView._setDAOCoinLastTradePrices(&ZeroPKID, daoCoinPKID, triggerScaledPrice, 2)
+	require.NoError(err)
+	require.Len(prevEntries, 2)
+	require.True(prevEntries[0].ScaledExchangeRateCoinsToSellPerCoinToBuy.Eq(triggerScaledPrice))
+	require.Equal(uint32(1), prevEntries[0].BlockHeight)
+}
+
+func TestDAOCoinTimeWeightedPrice(t *testing.T) {
+	require := require.New(t)
+
+	// The time-weighted price moves linearly from 1 to the last trade price of 3 over the window.
+	oneScaled := OneE38.Clone()
+	threeScaled := uint256.NewInt().Mul(OneE38, uint256.NewInt().SetUint64(3))
+	twoScaled := uint256.NewInt().Mul(OneE38, uint256.NewInt().SetUint64(2))
+	entry := &DAOCoinLastTradePriceEntry{
+		BuyingDAOCoinCreatorPKID:                  &ZeroPKID,
+		SellingDAOCoinCreatorPKID:                 NewPKID(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: threeScaled,
+		TimeWeightedScaledExchangeRate:            oneScaled,
+		BlockHeight:                               100,
+	}
+	require.True(entry.GetTimeWeightedScaledExchangeRate(100).Eq(oneScaled))
+	require.True(entry.GetTimeWeightedScaledExchangeRate(100 + DAOCoinTimeWeightedPriceWindowBlocks/2).Eq(twoScaled))
+	require.True(entry.GetTimeWeightedScaledExchangeRate(100 + DAOCoinTimeWeightedPriceWindowBlocks).Eq(threeScaled))
+	require.True(entry.GetTimeWeightedScaledExchangeRate(100 + 2*DAOCoinTimeWeightedPriceWindowBlocks).Eq(threeScaled))
+
+	// It also moves down toward a lower price.
+	entry.ScaledExchangeRateCoinsToSellPerCoinToBuy, entry.TimeWeightedScaledExchangeRate = oneScaled, threeScaled
+	require.True(entry.GetTimeWeightedScaledExchangeRate(100 + DAOCoinTimeWeightedPriceWindowBlocks/2).Eq(twoScaled))
+
+	// The time-weighted price survives encoding.
+	decodedEntry, err := DecodeDeSoEncoder(&DAOCoinLastTradePriceEntry{}, bytes.NewReader(EncodeToBytes(0, entry)))
+	require.NoError(err)
+	require.True(decodedEntry.TimeWeightedScaledExchangeRate.Eq(threeScaled))
+
+	// A pair's first trade starts the time-weighted price at the trade price, and later
+	// trades carry it forward from the entry they replace.
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	daoCoinPKID := NewPKID(m0PkBytes)
+	_, err = utxoView._setDAOCoinLastTradePrices(&ZeroPKID, daoCoinPKID, oneScaled, 100)
+	require.NoError(err)
+	_, err = utxoView._setDAOCoinLastTradePrices(&ZeroPKID, daoCoinPKID, threeScaled, 100)
+	require.NoError(err)
+	lastTradePriceEntry, err := utxoView.GetDAOCoinLastTradePriceEntry(&ZeroPKID, daoCoinPKID)
+	require.NoError(err)
+	require.True(lastTradePriceEntry.TimeWeightedScaledExchangeRate.Eq(oneScaled))
+	require.True(lastTradePriceEntry.GetTimeWeightedScaledExchangeRate(
+		100 + DAOCoinTimeWeightedPriceWindowBlocks/2).Eq(twoScaled))
+}
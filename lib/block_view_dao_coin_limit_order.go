@@ -31,9 +31,10 @@ func adjustBalance(
 	return ret, nil
 }
 
-// Should never go below zero. The caller should make sure of that.
+// Should never go below zero. The caller should make sure of that. isDAOCoin is
+// false if daoCoinPKID's coin is a creator coin, and is ignored for DESO.
 func (bav *UtxoView) getAdjustedDAOCoinBalanceForUserInBaseUnits(
-	userPKID *PKID, daoCoinPKID *PKID,
+	userPKID *PKID, daoCoinPKID *PKID, isDAOCoin bool,
 	balanceDeltas map[PKID]map[PKID]*big.Int) (*uint256.Int, error) {
 
 	delta := big.NewInt(0)
@@ -57,9 +58,9 @@ func (bav *UtxoView) getAdjustedDAOCoinBalanceForUserInBaseUnits(
 			uint256.NewInt().SetUint64(transactorDESOBalanceNanos), delta)
 	}
 
-	// If we get here, we know we're dealing with a DAO coin now.
+	// If we get here, we know we're dealing with a DAO or creator coin now.
 	transactorBalanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(
-		userPKID, daoCoinPKID, true)
+		userPKID, daoCoinPKID, isDAOCoin)
 
 	// If the balance entry doesn't exist or is deleted then return zero
 	if transactorBalanceEntry == nil || transactorBalanceEntry.isDeleted {
@@ -72,7 +73,7 @@ func (bav *UtxoView) getAdjustedDAOCoinBalanceForUserInBaseUnits(
 }
 
 func (bav *UtxoView) balanceChange(
-	userPKID *PKID, daoCoinPKID *PKID, val *big.Int,
+	userPKID *PKID, daoCoinPKID *PKID, isDAOCoin bool, val *big.Int,
 	deltasMap map[PKID]map[PKID]*big.Int,
 	prevBalances map[PKID]map[PKID]*BalanceEntry) {
 
@@ -103,7 +104,7 @@ func (bav *UtxoView) balanceChange(
 		// this map yet.
 		if _, innerExists := prevBalances[*userPKID][*daoCoinPKID]; !innerExists {
 			oldBalance, err := bav.getAdjustedDAOCoinBalanceForUserInBaseUnits(
-				userPKID, daoCoinPKID, nil)
+				userPKID, daoCoinPKID, isDAOCoin, nil)
 			if err != nil {
 				glog.Error(err)
 				return
@@ -120,7 +121,7 @@ func (bav *UtxoView) balanceChange(
 				}
 			} else {
 				oldBalanceEntry = bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(
-					userPKID, daoCoinPKID, true)
+					userPKID, daoCoinPKID, isDAOCoin)
 				if oldBalanceEntry == nil || oldBalanceEntry.isDeleted {
 					// In this case, we create a dummy balance entry, so
 					// we can credit the user their money. Otherwise,
@@ -145,7 +146,7 @@ func (bav *UtxoView) balanceChange(
 }
 
 func (bav *UtxoView) _sanityCheckLimitOrderMoneyPrinting(
-	prevBalances map[PKID]map[PKID]*BalanceEntry) error {
+	transactorOrder *DAOCoinLimitOrderEntry, prevBalances map[PKID]map[PKID]*BalanceEntry) error {
 
 	// We include a more hardcore balance check to make sure that we are not printing money.
 	// For each item in our prevBalance map, we go through it and verify that the new balance
@@ -162,7 +163,7 @@ func (bav *UtxoView) _sanityCheckLimitOrderMoneyPrinting(
 		for creatorPKID, prevBalanceBaseUnits := range prevBalancesPerCreatorPKID {
 			// Calculate new balance in base units for this userPKID, creatorPKID.
 			newBalanceBaseUnits, err := bav.getAdjustedDAOCoinBalanceForUserInBaseUnits(
-				&userPKID, &creatorPKID, nil)
+				&userPKID, &creatorPKID, transactorOrder.IsDAOCoin(&creatorPKID), nil)
 			if err != nil {
 				return errors.Wrapf(err, "_sanityCheckLimitOrderMoneyPrinting: ")
 			}
@@ -201,6 +202,16 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
 	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
 
+	return bav._connectDAOCoinLimitOrderWithFeeCheck(txn, txHash, blockHeight, verifySignatures, true)
+}
+
+// _connectDAOCoinLimitOrderWithFeeCheck connects a DAO coin limit order. If checkFeeNanos
+// is false, the order's FeeNanos isn't required to meet the minimum network fee. This is
+// the case for orders in a DAOCoinLimitOrderBatch txn, whose fee is paid by the batch.
+func (bav *UtxoView) _connectDAOCoinLimitOrderWithFeeCheck(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool, checkFeeNanos bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
 	if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderBlockHeight {
 		return 0, 0, nil, RuleErrorDAOCoinLimitOrderBeforeBlockHeight
 	}
@@ -214,12 +225,140 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	// Grab the txn metadata.
 	txMeta := txn.TxnMeta.(*DAOCoinLimitOrderMetadata)
 
+	// Validate ReplaceCancelledOrder. A replace cancels a specific order, so it
+	// requires CancelOrderID.
+	if txMeta.ReplaceCancelledOrder {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderReplaceBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderReplaceBeforeBlockHeight
+		}
+		if txMeta.CancelOrderID == nil {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderReplaceRequiresCancelOrderID
+		}
+	}
+
 	// Validate txn metadata.
-	err := bav.IsValidDAOCoinLimitOrderMetadata(txn.PublicKey, txMeta)
+	var err error
+	if checkFeeNanos {
+		err = bav.IsValidDAOCoinLimitOrderMetadata(txn.PublicKey, txMeta)
+	} else {
+		err = bav._isValidDAOCoinLimitOrderMetadataIgnoringFee(txn.PublicKey, txMeta)
+	}
 	if err != nil {
 		return 0, 0, nil, err
 	}
 
+	// Validate CancelAll. It can't be combined with cancelling a specific order, and
+	// cancelling all orders for a pair requires the pair.
+	if txMeta.CancelAll != DAOCoinLimitOrderCancelAllNone {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderCancelAllBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderCancelAllBeforeBlockHeight
+		}
+		if txMeta.CancelOrderID != nil {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinLimitOrderInvalidCancelAll,
+				"_connectDAOCoinLimitOrder: CancelAll can't be set with CancelOrderID")
+		}
+		if txMeta.CancelAll != DAOCoinLimitOrderCancelAllOrders && txMeta.CancelAll != DAOCoinLimitOrderCancelAllForPair {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinLimitOrderInvalidCancelAll,
+				"_connectDAOCoinLimitOrder: Invalid CancelAll %v", txMeta.CancelAll)
+		}
+		if txMeta.CancelAll == DAOCoinLimitOrderCancelAllForPair &&
+			(txMeta.BuyingDAOCoinCreatorPublicKey == nil || txMeta.SellingDAOCoinCreatorPublicKey == nil) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinLimitOrderInvalidCancelAll,
+				"_connectDAOCoinLimitOrder: CancelAll for a pair requires the pair")
+		}
+	}
+
+	// Validate the PostOnly fill type, which is only valid after its fork.
+	if txMeta.PlacesOrder() && txMeta.FillType == DAOCoinLimitOrderFillTypePostOnly &&
+		blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderPostOnlyBlockHeight {
+		return 0, 0, nil, RuleErrorDAOCoinLimitOrderPostOnlyBeforeBlockHeight
+	}
+
+	// Validate ExpirationBlockHeight. Only orders that are stored in the order
+	// book, i.e. GoodTillCancelled and PostOnly orders, can expire, and they must
+	// expire after the block they're placed in.
+	if txMeta.ExpirationBlockHeight != 0 {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderExpirationBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderExpirationBeforeBlockHeight
+		}
+		if txMeta.PlacesOrder() && txMeta.FillType != DAOCoinLimitOrderFillTypeGoodTillCancelled &&
+			txMeta.FillType != DAOCoinLimitOrderFillTypePostOnly {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderExpirationRequiresGoodTillCancelled
+		}
+		if txMeta.ExpirationBlockHeight <= blockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderExpirationBlockHeightNotInFuture
+		}
+	}
+
+	// Validate MaxSlippageScaledPrice. Only market orders can set it, since
+	// limit orders already have a worst acceptable price.
+	if txMeta.MaxSlippageScaledPrice != nil {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderMaxSlippageBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderMaxSlippageBeforeBlockHeight
+		}
+		if txMeta.PlacesOrder() {
+			if txMeta.ScaledExchangeRateCoinsToSellPerCoinToBuy == nil ||
+				!txMeta.ScaledExchangeRateCoinsToSellPerCoinToBuy.IsZero() ||
+				txMeta.FillType == DAOCoinLimitOrderFillTypeGoodTillCancelled {
+				return 0, 0, nil, RuleErrorDAOCoinLimitOrderMaxSlippageRequiresMarketOrder
+			}
+		}
+		if txMeta.MaxSlippageScaledPrice.IsZero() {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderInvalidMaxSlippageScaledPrice
+		}
+	}
+
+	// Validate StopTriggerScaledPrice. A stop-limit order may have to wait in the
+	// order book for its trigger, so it must be GoodTillCancelled.
+	if txMeta.StopTriggerScaledPrice != nil {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderStopLimitBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderStopLimitBeforeBlockHeight
+		}
+		if txMeta.PlacesOrder() && txMeta.FillType != DAOCoinLimitOrderFillTypeGoodTillCancelled {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderStopLimitRequiresGoodTillCancelled
+		}
+		if txMeta.StopTriggerScaledPrice.IsZero() {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderInvalidStopTriggerScaledPrice
+		}
+	}
+
+	// Validate MinQuantityToFillInBaseUnits. It must be possible to fill the order
+	// in a single match at the minimum.
+	if txMeta.MinQuantityToFillInBaseUnits != nil {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderMinFillQuantityBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderMinFillQuantityBeforeBlockHeight
+		}
+		if txMeta.PlacesOrder() {
+			if txMeta.MinQuantityToFillInBaseUnits.IsZero() ||
+				txMeta.QuantityToFillInBaseUnits == nil ||
+				txMeta.MinQuantityToFillInBaseUnits.Gt(txMeta.QuantityToFillInBaseUnits) {
+				return 0, 0, nil, RuleErrorDAOCoinLimitOrderInvalidMinQuantityToFill
+			}
+		}
+	}
+
+	// Validate QuantityDenomination.
+	if txMeta.QuantityDenomination != DAOCoinLimitOrderQuantityDenominationDefault {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderQuantityDenominationBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderQuantityDenominationBeforeBlockHeight
+		}
+		if txMeta.QuantityDenomination != DAOCoinLimitOrderQuantityDenominationBuyingCoin &&
+			txMeta.QuantityDenomination != DAOCoinLimitOrderQuantityDenominationSellingCoin {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderInvalidQuantityDenomination
+		}
+	}
+
+	// Validate the creator coin flags. Creator coin pairs don't track a last
+	// trade price, so they can't have stop-limit orders.
+	if txMeta.BuyingCoinIsCreatorCoin || txMeta.SellingCoinIsCreatorCoin {
+		if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderCreatorCoinsBlockHeight {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderCreatorCoinsBeforeBlockHeight
+		}
+		if txMeta.StopTriggerScaledPrice != nil {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderCreatorCoinStopLimitNotSupported
+		}
+	}
+
 	// Get the transactor PKID and validate it.
 	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
 	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
@@ -238,7 +377,7 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	// other bookkeeping maps. This makes it easy to sanity-check and revert things in
 	// disconnect.
 	prevBalances := make(map[PKID]map[PKID]*BalanceEntry)
-	bav.balanceChange(transactorPKIDEntry.PKID, &ZeroPKID, big.NewInt(0), nil, prevBalances)
+	bav.balanceChange(transactorPKIDEntry.PKID, &ZeroPKID, true, big.NewInt(0), nil, prevBalances)
 	for _, txOutput := range txn.TxOutputs {
 		pkidEntry := bav.GetPKIDForPublicKey(txOutput.PublicKey)
 		if pkidEntry == nil || pkidEntry.isDeleted {
@@ -246,7 +385,7 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				"_connectDAOCoinLimitOrder: outputPKIDEntry is deleted: %v",
 				spew.Sdump(pkidEntry))
 		}
-		bav.balanceChange(pkidEntry.PKID, &ZeroPKID, big.NewInt(0), nil, prevBalances)
+		bav.balanceChange(pkidEntry.PKID, &ZeroPKID, true, big.NewInt(0), nil, prevBalances)
 	}
 	// Get balances for all bidders as well.
 	for _, inputsByTransactor := range txMeta.BidderInputs {
@@ -256,7 +395,7 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				"_connectDAOCoinLimitOrder: bidderPKIDEntry is deleted: %v",
 				spew.Sdump(pkidEntry))
 		}
-		bav.balanceChange(pkidEntry.PKID, &ZeroPKID, big.NewInt(0), nil, prevBalances)
+		bav.balanceChange(pkidEntry.PKID, &ZeroPKID, true, big.NewInt(0), nil, prevBalances)
 	}
 
 	if verifySignatures {
@@ -266,21 +405,23 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	}
 
 	// Validate FeeNanos is a valid value, and is more than the minimum fee rate allowed
-	txnBytes, err := txn.ToBytes(false)
-	if err != nil {
-		return 0, 0, nil, err
-	}
-	if (txMeta.FeeNanos * 1000) <= txMeta.FeeNanos {
-		return 0, 0, nil, RuleErrorDAOCoinLimitOrderFeeNanosOverflow
-	}
-	if (txMeta.FeeNanos*1000)/uint64(len(txnBytes)) < bav.GetCurrentGlobalParamsEntry().MinimumNetworkFeeNanosPerKB ||
-		txMeta.FeeNanos == 0 {
-		return 0, 0, nil, RuleErrorDAOCoinLimitOrderFeeNanosBelowMinTxFee
+	if checkFeeNanos {
+		txnBytes, err := txn.ToBytes(false)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if (txMeta.FeeNanos * 1000) <= txMeta.FeeNanos {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderFeeNanosOverflow
+		}
+		if (txMeta.FeeNanos*1000)/uint64(len(txnBytes)) < bav.GetCurrentGlobalParamsEntry().MinimumNetworkFeeNanosPerKB ||
+			txMeta.FeeNanos == 0 {
+			return 0, 0, nil, RuleErrorDAOCoinLimitOrderFeeNanosBelowMinTxFee
+		}
 	}
 
 	// If the transactor just wants to cancel an
 	// existing order, find and delete by OrderID.
-	if txMeta.CancelOrderID != nil {
+	if txMeta.CancelOrderID != nil && !txMeta.ReplaceCancelledOrder {
 		// Connect basic txn to get the total input and the total output without
 		// considering the transaction metadata.
 		totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
@@ -289,16 +430,11 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 		}
 
 		// Search for an existing order by OrderID.
-		existingTransactorOrder, err := bav.GetDAOCoinLimitOrderEntry(txMeta.CancelOrderID)
+		existingTransactorOrder, err := bav._getDAOCoinLimitOrderToCancel(
+			transactorPKIDEntry.PKID, txMeta.CancelOrderID, blockHeight)
 		if err != nil {
 			return 0, 0, nil, err
 		}
-		if existingTransactorOrder == nil || (blockHeight >= bav.Params.ForkHeights.AssociationsAndAccessGroupsBlockHeight && existingTransactorOrder.isDeleted) {
-			return 0, 0, nil, RuleErrorDAOCoinLimitOrderToCancelNotFound
-		}
-		if !transactorPKIDEntry.PKID.Eq(existingTransactorOrder.TransactorPKID) {
-			return 0, 0, nil, RuleErrorDAOCoinLimitOrderToCancelNotYours
-		}
 
 		// Save the existing order in case we need to revert.
 		prevTransactorOrder := existingTransactorOrder.Copy()
@@ -315,6 +451,50 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 		return totalInput, totalOutput, utxoOpsForTxn, nil
 	}
 
+	// If the transactor wants to cancel all of their orders, or all of
+	// them for a pair, find and delete them all.
+	if txMeta.CancelAll != DAOCoinLimitOrderCancelAllNone {
+		totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrder")
+		}
+
+		ordersToCancel, err := bav.GetDAOCoinLimitOrdersToCancelAll(transactorPKIDEntry.PKID, txMeta)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrder: ")
+		}
+
+		// Save the cancelled orders in case we need to revert, then delete them.
+		var prevCancelledOrders []*DAOCoinLimitOrderEntry
+		for _, orderToCancel := range ordersToCancel {
+			prevCancelledOrders = append(prevCancelledOrders, orderToCancel.Copy())
+			bav._deleteDAOCoinLimitOrderEntryMappings(orderToCancel)
+		}
+
+		// The cancelled orders are restored like matching orders on disconnect.
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type:                OperationTypeDAOCoinLimitOrder,
+			PrevMatchingOrders:  prevCancelledOrders,
+			StateChangeMetadata: &DAOCoinLimitOrderStateChangeMetadata{},
+		})
+
+		return totalInput, totalOutput, utxoOpsForTxn, nil
+	}
+
+	// If the transactor is replacing an existing order, delete it before the new
+	// order is matched. This frees up the balance the old order was quoting, and
+	// keeps the new order from matching against it.
+	var prevTransactorOrder *DAOCoinLimitOrderEntry
+	if txMeta.CancelOrderID != nil && txMeta.ReplaceCancelledOrder {
+		existingTransactorOrder, err := bav._getDAOCoinLimitOrderToCancel(
+			transactorPKIDEntry.PKID, txMeta.CancelOrderID, blockHeight)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		prevTransactorOrder = existingTransactorOrder.Copy()
+		bav._deleteDAOCoinLimitOrderEntryMappings(existingTransactorOrder)
+	}
+
 	// Extract the buyCoin and sellCoin PKIDs from the txn's public keys.
 	// Note that if any of these are ZeroPublicKey, then GetPKIDForPublicKey will
 	// return ZeroPKID back to us, which is what we want. Recall that ZeroPKID
@@ -344,7 +524,15 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 		OperationType:                             txMeta.OperationType,
 		FillType:                                  txMeta.FillType,
 		BlockHeight:                               blockHeight,
+		ExpirationBlockHeight:                     txMeta.ExpirationBlockHeight,
+		StopTriggerScaledPrice:                    txMeta.StopTriggerScaledPrice,
+		MinQuantityToFillInBaseUnits:              txMeta.MinQuantityToFillInBaseUnits,
+		QuantityDenomination:                      txMeta.QuantityDenomination,
+		BuyingCoinIsCreatorCoin:                   txMeta.BuyingCoinIsCreatorCoin,
+		SellingCoinIsCreatorCoin:                  txMeta.SellingCoinIsCreatorCoin,
 	}
+	buyCoinIsDAOCoin := !transactorOrder.BuyingCoinIsCreatorCoin
+	sellCoinIsDAOCoin := !transactorOrder.SellingCoinIsCreatorCoin
 
 	// These maps contain all of the balance changes that this transaction
 	// demands, including DESO ones. We update these balance changes as we
@@ -368,10 +556,25 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	//
 	// Fetch all the orders, and copy them over into a new list so that we can revert in
 	// the disconnect case.
-	matchingOrders, err := bav.GetNextLimitOrdersToFill(transactorOrder, nil, blockHeight)
-	if err != nil {
-		return 0, 0, nil, errors.Wrapf(
-			err, "Error getting next limit orders to fill: ")
+	//
+	// A stop-limit order whose trigger hasn't been reached skips matching entirely and
+	// rests in the order book until a later trade reaches the trigger.
+	var matchingOrders []*DAOCoinLimitOrderEntry
+	transactorOrderIsDormant := false
+	if transactorOrder.StopTriggerScaledPrice != nil {
+		lastTradePrice, err := bav.GetDAOCoinLastTradePrice(
+			transactorOrder.BuyingDAOCoinCreatorPKID, transactorOrder.SellingDAOCoinCreatorPKID)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrder: Error getting last trade price: ")
+		}
+		transactorOrderIsDormant = transactorOrder.IsDormantStopOrder(lastTradePrice)
+	}
+	if !transactorOrderIsDormant {
+		matchingOrders, err = bav.GetNextLimitOrdersToFill(transactorOrder, nil, blockHeight)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(
+				err, "Error getting next limit orders to fill: ")
+		}
 	}
 	prevMatchingOrders := []*DAOCoinLimitOrderEntry{}
 	// We track a lastSeenOrder in order to fetch more orders to iterate over. This is
@@ -387,7 +590,16 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	// transaction is connected to index the appropriate fields. But we keep it as-is
 	// for now.
 	filledOrders := []*FilledDAOCoinLimitOrder{}
-	orderFilled := false
+	// Every match is also recorded as a DAOCoinLimitOrderFillEntry so that past trades
+	// can be enumerated once the fill history fork is active.
+	var fillEntries []*DAOCoinLimitOrderFillEntry
+	// Matching stops once the transactor's order is filled or, for an ImmediateOrCancel
+	// market order, once the book reaches its max slippage price. Either way, whatever
+	// is left of the order is handled by its FillType below.
+	doneMatching := false
+	// Track the price of the last trade, expressed like the matching orders' exchange
+	// rate, so that we can update the pair's last trade price once matching is done.
+	var lastTradeScaledPrice *uint256.Int
 	for len(matchingOrders) > 0 {
 		// 1-by-1 match existing orders to the transactor's order.
 		for _, matchingOrder := range matchingOrders {
@@ -412,6 +624,31 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				continue
 			}
 
+			// Orders for a DAO coin whose creator has disabled trading stay on the book
+			// so they can be matched once trading is re-enabled, but they can't be
+			// matched in the meantime.
+			if err = bav.ValidateDAOCoinLimitOrderTradingEnabled(matchingOrder); err != nil {
+				return 0, 0, nil, err
+			}
+
+			// Matching orders are sorted best price first, so if this order's price is
+			// worse than the market order's max slippage, the rest of the book is too.
+			// A FillOrKill order fails outright, while an ImmediateOrCancel order stops
+			// matching as if the book had run out, keeping the fills it got.
+			if !IsWithinMaxSlippage(txMeta.MaxSlippageScaledPrice, transactorOrder, matchingOrder) {
+				if txMeta.FillType == DAOCoinLimitOrderFillTypeFillOrKill {
+					return 0, 0, nil, RuleErrorDAOCoinLimitOrderMaxSlippageExceeded
+				}
+				doneMatching = true
+				break
+			}
+
+			// If we get here, the order crosses the book. A PostOnly order must not
+			// take liquidity, so it fails instead.
+			if transactorOrder.FillType == DAOCoinLimitOrderFillTypePostOnly {
+				return 0, 0, nil, RuleErrorDAOCoinLimitOrderPostOnlyWouldCross
+			}
+
 			// Since we don't have bidder inputs in the balance model, we add the transactor
 			// to the prev balances map if it doesn't exist and the matching order is buying
 			// DESO.
@@ -419,7 +656,7 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				transactorOrder.SellingDAOCoinCreatorPKID.IsZeroPKID() {
 
 				if _, exists := prevBalances[*matchingOrder.TransactorPKID][ZeroPKID]; !exists {
-					bav.balanceChange(matchingOrder.TransactorPKID, &ZeroPKID, big.NewInt(0), nil, prevBalances)
+					bav.balanceChange(matchingOrder.TransactorPKID, &ZeroPKID, true, big.NewInt(0), nil, prevBalances)
 				}
 			}
 
@@ -430,16 +667,26 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				coinBaseUnitsBoughtByTransactor,
 				coinBaseUnitsSoldByTransactor,
 				err := _calculateDAOCoinsTransferredInLimitOrderMatch(
-				matchingOrder, transactorOrder.OperationType, transactorOrder.QuantityToFillInBaseUnits)
+				matchingOrder, transactorOrder.GetQuantityOperationType(), transactorOrder.QuantityToFillInBaseUnits)
 			if err != nil {
 				return 0, 0, nil, err
 			}
 
+			// Skip counterparties that would fill either order for less than its
+			// minimum. The matching order stays in the book for larger orders.
+			if transactorOrder.IsBelowMinFillQuantity(
+				transactorOrder.QuantityToFillInBaseUnits, updatedTransactorOrderQuantityToFill) ||
+				matchingOrder.IsBelowMinFillQuantity(
+					matchingOrder.QuantityToFillInBaseUnits, updatedMatchingOrderQuantityToFill) {
+				continue
+			}
+
 			// Compute the amount of the buyCoin that the seller currently has. Factor in
 			// all balance increases and decreases that we've applied.
 			sellerBuyCoinBalanceBaseUnits, err := bav.getAdjustedDAOCoinBalanceForUserInBaseUnits(
 				matchingOrder.TransactorPKID,
 				buyCoinPKIDEntry.PKID,
+				buyCoinIsDAOCoin,
 				balanceDeltas)
 			if err != nil {
 				return 0, 0, nil, fmt.Errorf(
@@ -461,6 +708,7 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 			transactorSellCoinBalanceBaseUnits, err := bav.getAdjustedDAOCoinBalanceForUserInBaseUnits(
 				transactorPKIDEntry.PKID,
 				sellCoinPKIDEntry.PKID,
+				sellCoinIsDAOCoin,
 				balanceDeltas)
 			if err != nil {
 				return 0, 0, nil, fmt.Errorf(
@@ -473,6 +721,12 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 					sellCoinPKIDEntry.PKID)
 			}
 
+			// The transactor is the taker and pays the taker fee, if any, out of the
+			// buyCoins they receive. The matching order is the maker and pays the maker
+			// fee out of the sellCoins it receives.
+			takerFeeBaseUnits, makerFeeBaseUnits, feeRecipientPKID := bav.GetDAOCoinLimitOrderTradingFees(
+				coinBaseUnitsBoughtByTransactor, coinBaseUnitsSoldByTransactor, blockHeight)
+
 			// Update quantity for transactor's order.
 			transactorOrderFilledOrder := &FilledDAOCoinLimitOrder{
 				OrderID:                       transactorOrder.OrderID,
@@ -481,11 +735,14 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				SellingDAOCoinCreatorPKID:     transactorOrder.SellingDAOCoinCreatorPKID,
 				CoinQuantityInBaseUnitsBought: coinBaseUnitsBoughtByTransactor,
 				CoinQuantityInBaseUnitsSold:   coinBaseUnitsSoldByTransactor,
+				FeeInBaseUnitsPaid:            takerFeeBaseUnits,
+				BuyingCoinIsCreatorCoin:       transactorOrder.BuyingCoinIsCreatorCoin,
+				SellingCoinIsCreatorCoin:      transactorOrder.SellingCoinIsCreatorCoin,
 			}
 			if updatedTransactorOrderQuantityToFill.IsZero() {
 				// Transactor's order was fully filled.
 				transactorOrder.QuantityToFillInBaseUnits = uint256.NewInt()
-				orderFilled = true
+				doneMatching = true
 				transactorOrderFilledOrder.IsFulfilled = true
 			} else {
 				// Transactor's order is incomplete. Note we don't store the
@@ -504,6 +761,9 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				SellingDAOCoinCreatorPKID:     matchingOrder.SellingDAOCoinCreatorPKID,
 				CoinQuantityInBaseUnitsBought: coinBaseUnitsSoldByTransactor,
 				CoinQuantityInBaseUnitsSold:   coinBaseUnitsBoughtByTransactor,
+				FeeInBaseUnitsPaid:            makerFeeBaseUnits,
+				BuyingCoinIsCreatorCoin:       matchingOrder.BuyingCoinIsCreatorCoin,
+				SellingCoinIsCreatorCoin:      matchingOrder.SellingCoinIsCreatorCoin,
 			}
 			matchingOrder.QuantityToFillInBaseUnits = updatedMatchingOrderQuantityToFill
 			remainingUnitsToBuy, err := matchingOrder.BaseUnitsToBuyUint256()
@@ -533,33 +793,69 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				// Matching order is incomplete. Update remaining quantity to fill.
 				matchingOrderFilledOrder.IsFulfilled = false
 
+				// A stop-limit order that has traded stays matchable, even if
+				// the price moves back past its trigger.
+				matchingOrder.StopTriggerScaledPrice = nil
+
 				// Set the updated matching order in the db.
 				// It should replace the existing order.
 				bav._setDAOCoinLimitOrderEntryMappings(matchingOrder)
 			}
 			filledOrders = append(filledOrders, matchingOrderFilledOrder)
+			lastTradeScaledPrice = matchingOrder.ScaledExchangeRateCoinsToSellPerCoinToBuy
+			fillEntries = append(fillEntries, &DAOCoinLimitOrderFillEntry{
+				TxnHash:                   txHash,
+				FillIndex:                 uint32(len(fillEntries)),
+				BlockHeight:               uint64(blockHeight),
+				TakerOrderID:              transactorOrder.OrderID,
+				MakerOrderID:              matchingOrder.OrderID,
+				TakerPKID:                 transactorOrder.TransactorPKID,
+				MakerPKID:                 matchingOrder.TransactorPKID,
+				BuyingDAOCoinCreatorPKID:  transactorOrder.BuyingDAOCoinCreatorPKID,
+				SellingDAOCoinCreatorPKID: transactorOrder.SellingDAOCoinCreatorPKID,
+				MakerScaledExchangeRateCoinsToSellPerCoinToBuy: cloneOptionalUint256(
+					matchingOrder.ScaledExchangeRateCoinsToSellPerCoinToBuy),
+				CoinQuantityInBaseUnitsBought: coinBaseUnitsBoughtByTransactor,
+				CoinQuantityInBaseUnitsSold:   coinBaseUnitsSoldByTransactor,
+				TakerFeeInBaseUnits:           cloneOptionalUint256(takerFeeBaseUnits),
+				MakerFeeInBaseUnits:           cloneOptionalUint256(makerFeeBaseUnits),
+			})
 
 			// Now adjust the balances in our maps to reflect the coins that just changed hands.
 			// Transactor got buyCoins
-			bav.balanceChange(transactorPKIDEntry.PKID, buyCoinPKIDEntry.PKID,
+			bav.balanceChange(transactorPKIDEntry.PKID, buyCoinPKIDEntry.PKID, buyCoinIsDAOCoin,
 				coinBaseUnitsBoughtByTransactor.ToBig(), balanceDeltas, prevBalances)
 			// Seller lost buyCoins
-			bav.balanceChange(matchingOrder.TransactorPKID, buyCoinPKIDEntry.PKID,
+			bav.balanceChange(matchingOrder.TransactorPKID, buyCoinPKIDEntry.PKID, buyCoinIsDAOCoin,
 				big.NewInt(0).Neg(coinBaseUnitsBoughtByTransactor.ToBig()),
 				balanceDeltas, prevBalances)
 			// Seller got sellCoins
-			bav.balanceChange(matchingOrder.TransactorPKID, sellCoinPKIDEntry.PKID,
+			bav.balanceChange(matchingOrder.TransactorPKID, sellCoinPKIDEntry.PKID, sellCoinIsDAOCoin,
 				coinBaseUnitsSoldByTransactor.ToBig(), balanceDeltas, prevBalances)
 			// Transactor lost sellCoins
-			bav.balanceChange(transactorPKIDEntry.PKID, sellCoinPKIDEntry.PKID,
+			bav.balanceChange(transactorPKIDEntry.PKID, sellCoinPKIDEntry.PKID, sellCoinIsDAOCoin,
 				big.NewInt(0).Neg(coinBaseUnitsSoldByTransactor.ToBig()),
 				balanceDeltas, prevBalances)
+			// Transactor paid the taker fee in buyCoins
+			if takerFeeBaseUnits != nil && !takerFeeBaseUnits.IsZero() {
+				bav.balanceChange(transactorPKIDEntry.PKID, buyCoinPKIDEntry.PKID, buyCoinIsDAOCoin,
+					big.NewInt(0).Neg(takerFeeBaseUnits.ToBig()), balanceDeltas, prevBalances)
+				bav.balanceChange(feeRecipientPKID, buyCoinPKIDEntry.PKID, buyCoinIsDAOCoin,
+					takerFeeBaseUnits.ToBig(), balanceDeltas, prevBalances)
+			}
+			// Seller paid the maker fee in sellCoins
+			if makerFeeBaseUnits != nil && !makerFeeBaseUnits.IsZero() {
+				bav.balanceChange(matchingOrder.TransactorPKID, sellCoinPKIDEntry.PKID, sellCoinIsDAOCoin,
+					big.NewInt(0).Neg(makerFeeBaseUnits.ToBig()), balanceDeltas, prevBalances)
+				bav.balanceChange(feeRecipientPKID, sellCoinPKIDEntry.PKID, sellCoinIsDAOCoin,
+					makerFeeBaseUnits.ToBig(), balanceDeltas, prevBalances)
+			}
 
-			if orderFilled {
+			if doneMatching {
 				break
 			}
 		}
-		if orderFilled {
+		if doneMatching {
 			break
 		}
 		lastSeenOrder = prevMatchingOrders[len(prevMatchingOrders)-1]
@@ -571,7 +867,8 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	}
 
 	// By the time we get here, we've either fully filled the order OR we've exhausted
-	// the matching orders on "the book" that this order can fill against.
+	// the matching orders on "the book" that this order can fill against, which for a
+	// market order with a max slippage price ends at that price.
 
 	// After iterating through all potential matching orders, if transactor's order
 	// is still not fully fulfilled, their quantity to fill will be > zero. What
@@ -585,16 +882,41 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 		} else if txMeta.FillType == DAOCoinLimitOrderFillTypeImmediateOrCancel {
 			// If this is an ImmediateOrCancel order, then we should
 			// do nothing with the remaining quantity of this order.
-		} else if txMeta.FillType == DAOCoinLimitOrderFillTypeGoodTillCancelled {
-			// If this is a GoodTilCancelled order, then we should store
-			// whatever is left-over of this order in the database. This
-			// is the default case.
+		} else if txMeta.FillType == DAOCoinLimitOrderFillTypeGoodTillCancelled ||
+			txMeta.FillType == DAOCoinLimitOrderFillTypePostOnly {
+			// If this is a GoodTilCancelled or PostOnly order, then we should
+			// store whatever is left-over of this order in the database. This
+			// is the default case. As with matching orders, a stop-limit
+			// order that has traded stays matchable.
+			if lastTradeScaledPrice != nil {
+				transactorOrder.StopTriggerScaledPrice = nil
+			}
 			bav._setDAOCoinLimitOrderEntryMappings(transactorOrder)
 		} else {
 			return 0, 0, nil, RuleErrorDAOCoinLimitOrderInvalidFillType
 		}
 	}
 
+	// Record the price of the last trade on both directions of the coin pair so that
+	// stop-limit orders can be triggered by it. Last trade prices are keyed by creator
+	// PKID, so they're only recorded for DAO coin pairs.
+	var prevLastTradePriceEntries []*DAOCoinLastTradePriceEntry
+	if lastTradeScaledPrice != nil && blockHeight >= bav.Params.ForkHeights.DAOCoinLimitOrderStopLimitBlockHeight &&
+		!transactorOrder.IsCreatorCoinOrder() {
+		prevLastTradePriceEntries, err = bav._setDAOCoinLastTradePrices(
+			sellCoinPKIDEntry.PKID, buyCoinPKIDEntry.PKID, lastTradeScaledPrice, blockHeight)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrder: ")
+		}
+	}
+
+	// Persist the fills so that they can be enumerated by transactor and by coin pair.
+	if blockHeight >= bav.Params.ForkHeights.DAOCoinLimitOrderFillHistoryBlockHeight {
+		for _, fillEntry := range fillEntries {
+			bav._setDAOCoinLimitOrderFillEntryMappings(fillEntry)
+		}
+	}
+
 	var extraSpend uint64
 	if txMeta.SellingDAOCoinCreatorPublicKey.IsZeroPublicKey() {
 		desoDelta := balanceDeltas[*transactorPKIDEntry.PKID][ZeroPKID]
@@ -657,7 +979,7 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 		// balanceChange is smart, and only saves the prevBalance the FIRST time we call it
 		// for a particular pkid.
 		pkid := bav.GetPKIDForPublicKey(publicKey.ToBytes())
-		bav.balanceChange(pkid.PKID, &ZeroPKID, big.NewInt(0), nil, prevBalances)
+		bav.balanceChange(pkid.PKID, &ZeroPKID, true, big.NewInt(0), nil, prevBalances)
 
 		// If no balance recorded so far, initialize to zero.
 		if _, exists := desoAllowedToSpendByPublicKey[publicKey]; !exists {
@@ -898,10 +1220,11 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				}
 
 			} else {
-				// In this case we're dealing with a DAO coin so simply
+				// In this case we're dealing with a DAO or creator coin so simply
 				// update the value in the DB and call it a day.
+				isDAOCoin := transactorOrder.IsDAOCoin(&daoCoinPKID)
 				prevBalanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(
-					&userPKID, &daoCoinPKID, true)
+					&userPKID, &daoCoinPKID, isDAOCoin)
 				var newBalanceEntry *BalanceEntry
 				// If the user doesn't have a balance entry, we need to create one.
 				// If the delta is negative, this is an error since the user can't
@@ -935,38 +1258,22 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 				// overflow. Set it in the db without fear.
 				newBalanceUint256, _ := uint256.FromBig(newBalance)
 				newBalanceEntry.BalanceNanos = *newBalanceUint256
-				bav._setDAOCoinBalanceEntryMappings(newBalanceEntry)
+				// Buying a creator coin on the order book counts as purchasing it.
+				if !isDAOCoin && delta.Sign() > 0 {
+					newBalanceEntry.HasPurchased = true
+				}
+				bav._setBalanceEntryMappings(newBalanceEntry, isDAOCoin)
 			}
 		}
 	}
 
-	if err = bav._sanityCheckLimitOrderMoneyPrinting(prevBalances); err != nil {
+	if err = bav._sanityCheckLimitOrderMoneyPrinting(transactorOrder, prevBalances); err != nil {
 		return 0, 0, nil, err
 	}
 
-	//  TransactorPublicKeyBase58Check            string
-	//	BuyingDAOCoinCreatorPublicKeyBase58Check  string
-	//	SellingDAOCoinCreatorPublicKeyBase58Check string
-	//	UniqueFilledOrderPublicKeys               []string
-
-	fulfilledOrderMetadata := []*FilledDAOCoinLimitOrderMetadata{}
-	for _, filledOrder := range filledOrders {
-		fulfilledOrderMetadata = append(fulfilledOrderMetadata, &FilledDAOCoinLimitOrderMetadata{
-			TransactorPublicKeyBase58Check: PkToString(
-				bav.GetPublicKeyForPKID(filledOrder.TransactorPKID), bav.Params),
-			BuyingDAOCoinCreatorPublicKey: PkToString(
-				bav.GetPublicKeyForPKID(filledOrder.BuyingDAOCoinCreatorPKID), bav.Params),
-			SellingDAOCoinCreatorPublicKey: PkToString(
-				bav.GetPublicKeyForPKID(filledOrder.SellingDAOCoinCreatorPKID), bav.Params),
-			CoinQuantityInBaseUnitsBought: filledOrder.CoinQuantityInBaseUnitsBought,
-			CoinQuantityInBaseUnitsSold:   filledOrder.CoinQuantityInBaseUnitsSold,
-			IsFulfilled:                   filledOrder.IsFulfilled,
-		})
-	}
-
 	// Track state changes for the transaction.
 	stateChangeMetadata := &DAOCoinLimitOrderStateChangeMetadata{
-		FilledDAOCoinLimitOrdersMetadata: fulfilledOrderMetadata,
+		FilledDAOCoinLimitOrdersMetadata: bav.GetFilledDAOCoinLimitOrdersMetadata(filledOrders),
 	}
 
 	// We included the transactor in the slices of the prev balance entries
@@ -974,11 +1281,12 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 	// a separate place, but here it makes sense.
 	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
 		Type:                                 OperationTypeDAOCoinLimitOrder,
-		PrevTransactorDAOCoinLimitOrderEntry: nil, // prevTransactorOrder is only used in cancelling an order.
+		PrevTransactorDAOCoinLimitOrderEntry: prevTransactorOrder, // Only set if this txn replaced an order.
 		PrevBalanceEntries:                   prevBalances,
 		PrevMatchingOrders:                   prevMatchingOrders,
 		FilledDAOCoinLimitOrders:             filledOrders,
 		StateChangeMetadata:                  stateChangeMetadata,
+		PrevDAOCoinLastTradePriceEntries:     prevLastTradePriceEntries,
 	})
 
 	outputAndSpendAmount, err := SafeUint64().Add(totalOutput, transactorDESOSpendAmount)
@@ -1020,8 +1328,21 @@ func (bav *UtxoView) GetNextLimitOrdersToFill(
 		}
 	}
 
+	// Stop-limit orders are dormant until the last trade price for their direction of
+	// the pair, which is the reverse of the transactor's, reaches their trigger.
+	var matchingOrderLastTradePrice *uint256.Int
+	if blockHeight >= bav.Params.ForkHeights.DAOCoinLimitOrderStopLimitBlockHeight {
+		var err error
+		matchingOrderLastTradePrice, err = bav.GetDAOCoinLastTradePrice(
+			transactorOrder.SellingDAOCoinCreatorPKID, transactorOrder.BuyingDAOCoinCreatorPKID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Get matching limit order entries from database.
-	matchingOrders, err := bav.GetDbAdapter().GetMatchingDAOCoinLimitOrders(transactorOrder, lastSeenOrder, orderEntriesInView)
+	matchingOrders, err := bav.GetDbAdapter().GetMatchingDAOCoinLimitOrders(
+		transactorOrder, lastSeenOrder, orderEntriesInView, matchingOrderLastTradePrice)
 	if err != nil {
 		return nil, err
 	}
@@ -1038,6 +1359,12 @@ func (bav *UtxoView) GetNextLimitOrdersToFill(
 
 	// Aggregate matching orders.
 	for _, matchingOrder := range bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry {
+		// Expired orders have fallen out of the order book. They're skipped rather
+		// than deleted so that disconnecting back below their expiration restores them.
+		if matchingOrder.IsExpired(blockHeight) {
+			continue
+		}
+
 		// This doesn't mean that the matching order is invalid and should be deleted.
 		// It just means that the matching order isn't actually a viable match.
 		err := bav.IsValidDAOCoinLimitOrderMatch(transactorOrder, matchingOrder)
@@ -1050,6 +1377,11 @@ func (bav *UtxoView) GetNextLimitOrdersToFill(
 			continue
 		}
 
+		// Dormant stop-limit orders aren't matchable yet.
+		if matchingOrder.IsDormantStopOrder(matchingOrderLastTradePrice) {
+			continue
+		}
+
 		// We should have seen this order already.
 		if lastSeenOrder != nil && !lastSeenOrder.IsBetterMatchingOrderThan(matchingOrder) {
 			continue
@@ -1074,7 +1406,7 @@ func (bav *UtxoView) GetNextLimitOrdersToFill(
 		// Calculate transactor's updated quantity
 		// to fill after matching with this order.
 		transactorOrderQuantityToFill, _, _, _, err = _calculateDAOCoinsTransferredInLimitOrderMatch(
-			matchingOrder, transactorOrder.OperationType, transactorOrderQuantityToFill)
+			matchingOrder, transactorOrder.GetQuantityOperationType(), transactorOrderQuantityToFill)
 		if err != nil {
 			return nil, err
 		}
@@ -1108,7 +1440,10 @@ func (bav *UtxoView) _disconnectDAOCoinLimitOrder(
 
 	transactorPKID := bav.GetPKIDForPublicKey(currentTxn.PublicKey).PKID
 
-	if txMeta.CancelOrderID == nil {
+	if txMeta.CancelAll != DAOCoinLimitOrderCancelAllNone {
+		// This txn didn't create an order. The orders it cancelled are
+		// restored with the previous matching orders below.
+	} else if txMeta.PlacesOrder() {
 		// Delete the order created by this txn.
 		bav._deleteDAOCoinLimitOrderEntryMappings(&DAOCoinLimitOrderEntry{
 			OrderID:                   txnHash,
@@ -1118,19 +1453,28 @@ func (bav *UtxoView) _disconnectDAOCoinLimitOrder(
 			ScaledExchangeRateCoinsToSellPerCoinToBuy: txMeta.ScaledExchangeRateCoinsToSellPerCoinToBuy,
 			QuantityToFillInBaseUnits:                 txMeta.QuantityToFillInBaseUnits,
 			BlockHeight:                               blockHeight,
+			ExpirationBlockHeight:                     txMeta.ExpirationBlockHeight,
 		})
-	} else {
+	}
+	if txMeta.CancelOrderID != nil {
 		// Replace the order cancelled by this txn. Note:
 		// PrevTransactorDAOCoinLimitOrderEntry is only set
 		// if this transaction cancelled an existing order.
 		bav._setDAOCoinLimitOrderEntryMappings(operationData.PrevTransactorDAOCoinLimitOrderEntry)
 	}
 
-	// Revert DAO Coin balance entries
+	// Revert DAO Coin balance entries. Balances of a creator coin this txn traded
+	// are reverted as creator coin balance entries.
 	if len(operationData.PrevBalanceEntries) != 0 {
+		txnOrder := &DAOCoinLimitOrderEntry{
+			BuyingDAOCoinCreatorPKID:  bav.GetPKIDForPublicKey(txMeta.BuyingDAOCoinCreatorPublicKey.ToBytes()).PKID,
+			SellingDAOCoinCreatorPKID: bav.GetPKIDForPublicKey(txMeta.SellingDAOCoinCreatorPublicKey.ToBytes()).PKID,
+			BuyingCoinIsCreatorCoin:   txMeta.BuyingCoinIsCreatorCoin,
+			SellingCoinIsCreatorCoin:  txMeta.SellingCoinIsCreatorCoin,
+		}
 		for _, daoCoinPKIDToBalanceEntryMap := range operationData.PrevBalanceEntries {
-			for _, balanceEntry := range daoCoinPKIDToBalanceEntryMap {
-				bav._setDAOCoinBalanceEntryMappings(balanceEntry)
+			for creatorPKID, balanceEntry := range daoCoinPKIDToBalanceEntryMap {
+				bav._setBalanceEntryMappings(balanceEntry, txnOrder.IsDAOCoin(&creatorPKID))
 			}
 		}
 	}
@@ -1142,6 +1486,33 @@ func (bav *UtxoView) _disconnectDAOCoinLimitOrder(
 		}
 	}
 
+	// Revert the last trade prices of the coin pair if this txn traded.
+	if blockHeight >= bav.Params.ForkHeights.DAOCoinLimitOrderStopLimitBlockHeight &&
+		len(operationData.FilledDAOCoinLimitOrders) != 0 &&
+		!txMeta.BuyingCoinIsCreatorCoin && !txMeta.SellingCoinIsCreatorCoin {
+		buyingPKID := bav.GetPKIDForPublicKey(txMeta.BuyingDAOCoinCreatorPublicKey.ToBytes()).PKID
+		sellingPKID := bav.GetPKIDForPublicKey(txMeta.SellingDAOCoinCreatorPublicKey.ToBytes()).PKID
+		bav._deleteDAOCoinLastTradePriceEntryMappings(&DAOCoinLastTradePriceEntry{
+			BuyingDAOCoinCreatorPKID:  buyingPKID,
+			SellingDAOCoinCreatorPKID: sellingPKID,
+		})
+		bav._deleteDAOCoinLastTradePriceEntryMappings(&DAOCoinLastTradePriceEntry{
+			BuyingDAOCoinCreatorPKID:  sellingPKID,
+			SellingDAOCoinCreatorPKID: buyingPKID,
+		})
+		for _, prevLastTradePriceEntry := range operationData.PrevDAOCoinLastTradePriceEntries {
+			bav._setDAOCoinLastTradePriceEntryMappings(prevLastTradePriceEntry)
+		}
+	}
+
+	// Delete the fills this txn recorded.
+	if blockHeight >= bav.Params.ForkHeights.DAOCoinLimitOrderFillHistoryBlockHeight {
+		if err := bav._deleteDAOCoinLimitOrderFillEntriesForTxn(
+			txnHash, operationData.FilledDAOCoinLimitOrders); err != nil {
+			return errors.Wrapf(err, "_disconnectDAOCoinLimitOrder: ")
+		}
+	}
+
 	// We sometimes have some extra AddUtxo operations we need to remove
 	// These are "implicit" outputs that always occur at the end of the
 	// list of UtxoOperations. The number of implicit outputs is equal to
@@ -1238,7 +1609,7 @@ func _calculateDAOCoinsTransferredInLimitOrderMatch(
 	// Note: we assume that the input orders are a valid match, and we validate this below.
 
 	if transactorOrderOperationType == DAOCoinLimitOrderOperationTypeASK &&
-		matchingOrder.OperationType == DAOCoinLimitOrderOperationTypeASK {
+		matchingOrder.GetQuantityOperationType() == DAOCoinLimitOrderOperationTypeASK {
 		// The transactor quantity specifies the amount of coin they want to sell.
 		// The matching order's quantity specifies the amount of coin they want to sell.
 		// Since the transactor is selling the coin that the matching order is buying,
@@ -1322,7 +1693,7 @@ func _calculateDAOCoinsTransferredInLimitOrderMatch(
 	}
 
 	if transactorOrderOperationType == DAOCoinLimitOrderOperationTypeBID &&
-		matchingOrder.OperationType == DAOCoinLimitOrderOperationTypeBID {
+		matchingOrder.GetQuantityOperationType() == DAOCoinLimitOrderOperationTypeBID {
 		// The transactor quantity specifies the amount of coin they want to buy.
 		// The matching order's quantity specifies the amount of coin they want to buy.
 		// Since the transactor is buying the coin that the matching order is selling,
@@ -1455,7 +1826,7 @@ func _calculateDAOCoinsTransferredInLimitOrderMatch(
 		return nil, nil, nil, nil, err
 	}
 
-	if matchingOrder.OperationType == DAOCoinLimitOrderOperationTypeASK {
+	if matchingOrder.GetQuantityOperationType() == DAOCoinLimitOrderOperationTypeASK {
 		// The matching order's quantity represents their selling coin.
 		// Which is equivalent to the transactor's buying coin.
 		transactorBuyingCoinBaseUnitsTransferred := matchingOrder.QuantityToFillInBaseUnits.Clone()
@@ -1574,8 +1945,9 @@ func (bav *UtxoView) GetAllDAOCoinLimitOrdersForThisDAOCoinPair(
 	//   + BuyingDAOCoinCreatorPKID should match.
 	//   + SellingDAOCoincreatorPKID should match.
 	//   + orderEntry is not deleted.
+	//   + orderEntry doesn't trade creator coins, which have their own order books.
 	for _, orderEntry := range bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry {
-		if !orderEntry.isDeleted &&
+		if !orderEntry.isDeleted && !orderEntry.IsCreatorCoinOrder() &&
 			orderEntry.BuyingDAOCoinCreatorPKID.Eq(buyingDAOCoinCreatorPKID) &&
 			orderEntry.SellingDAOCoinCreatorPKID.Eq(sellingDAOCoinCreatorPKID) {
 			outputEntries = append(outputEntries, orderEntry)
@@ -1637,6 +2009,65 @@ func (bav *UtxoView) GetAllDAOCoinLimitOrdersForThisTransactor(
 	return outputEntries, nil
 }
 
+// _getDAOCoinLimitOrderToCancel looks up the order a txn with CancelOrderID set would
+// cancel, and errors if it doesn't exist or doesn't belong to the transactor.
+func (bav *UtxoView) _getDAOCoinLimitOrderToCancel(
+	transactorPKID *PKID, orderID *BlockHash, blockHeight uint32) (*DAOCoinLimitOrderEntry, error) {
+
+	existingTransactorOrder, err := bav.GetDAOCoinLimitOrderEntry(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if existingTransactorOrder == nil || (blockHeight >= bav.Params.ForkHeights.AssociationsAndAccessGroupsBlockHeight && existingTransactorOrder.isDeleted) {
+		return nil, RuleErrorDAOCoinLimitOrderToCancelNotFound
+	}
+	if !transactorPKID.Eq(existingTransactorOrder.TransactorPKID) {
+		return nil, RuleErrorDAOCoinLimitOrderToCancelNotYours
+	}
+	return existingTransactorOrder, nil
+}
+
+// GetDAOCoinLimitOrdersToCancelAll returns the open orders of the transactor that a txn
+// with CancelAll set would cancel, sorted by OrderID so that connecting is deterministic.
+func (bav *UtxoView) GetDAOCoinLimitOrdersToCancelAll(
+	transactorPKID *PKID, metadata *DAOCoinLimitOrderMetadata) ([]*DAOCoinLimitOrderEntry, error) {
+
+	var buyingCoinPKID, sellingCoinPKID *PKID
+	if metadata.CancelAll == DAOCoinLimitOrderCancelAllForPair {
+		buyingCoinPKIDEntry := bav.GetPKIDForPublicKey(metadata.BuyingDAOCoinCreatorPublicKey.ToBytes())
+		if buyingCoinPKIDEntry == nil || buyingCoinPKIDEntry.isDeleted {
+			return nil, RuleErrorDAOCoinLimitOrderInvalidBuyingDAOCoinCreatorPKID
+		}
+		sellingCoinPKIDEntry := bav.GetPKIDForPublicKey(metadata.SellingDAOCoinCreatorPublicKey.ToBytes())
+		if sellingCoinPKIDEntry == nil || sellingCoinPKIDEntry.isDeleted {
+			return nil, RuleErrorDAOCoinLimitOrderInvalidSellingDAOCoinCreatorPKID
+		}
+		buyingCoinPKID = buyingCoinPKIDEntry.PKID
+		sellingCoinPKID = sellingCoinPKIDEntry.PKID
+	}
+
+	orders, err := bav.GetAllDAOCoinLimitOrdersForThisTransactor(transactorPKID, buyingCoinPKID, sellingCoinPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinLimitOrdersToCancelAll: ")
+	}
+	// A creator's creator coin and DAO coin share a PKID, so the pair's coin types
+	// have to be matched as well.
+	if metadata.CancelAll == DAOCoinLimitOrderCancelAllForPair {
+		var pairOrders []*DAOCoinLimitOrderEntry
+		for _, order := range orders {
+			if order.BuyingCoinIsCreatorCoin == metadata.BuyingCoinIsCreatorCoin &&
+				order.SellingCoinIsCreatorCoin == metadata.SellingCoinIsCreatorCoin {
+				pairOrders = append(pairOrders, order)
+			}
+		}
+		orders = pairOrders
+	}
+	sort.Slice(orders, func(ii, jj int) bool {
+		return bytes.Compare(orders[ii].OrderID.ToBytes(), orders[jj].OrderID.ToBytes()) < 0
+	})
+	return orders, nil
+}
+
 // ###########################
 // ## VALIDATIONS
 // ###########################
@@ -1649,9 +2080,17 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrderMetadata(transactorPK []byte, metad
 		return RuleErrorDAOCoinLimitOrderFeeNanosBelowMinTxFee
 	}
 
-	// If the transactor is just cancelling an order,
+	return bav._isValidDAOCoinLimitOrderMetadataIgnoringFee(transactorPK, metadata)
+}
+
+// _isValidDAOCoinLimitOrderMetadataIgnoringFee validates everything but the order's FeeNanos,
+// which is zero for orders in a DAOCoinLimitOrderBatch txn.
+func (bav *UtxoView) _isValidDAOCoinLimitOrderMetadataIgnoringFee(
+	transactorPK []byte, metadata *DAOCoinLimitOrderMetadata) error {
+
+	// If the transactor is just cancelling orders,
 	// then the below validations do not apply.
-	if metadata.CancelOrderID != nil {
+	if !metadata.PlacesOrder() {
 		return nil
 	}
 
@@ -1682,12 +2121,46 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrderMetadata(transactorPK []byte, metad
 		QuantityToFillInBaseUnits:                 metadata.QuantityToFillInBaseUnits,
 		OperationType:                             metadata.OperationType,
 		FillType:                                  metadata.FillType,
+		BuyingCoinIsCreatorCoin:                   metadata.BuyingCoinIsCreatorCoin,
+		SellingCoinIsCreatorCoin:                  metadata.SellingCoinIsCreatorCoin,
+	}
+
+	// New orders can't be placed for a DAO coin whose creator has disabled trading.
+	if err := bav.ValidateDAOCoinLimitOrderTradingEnabled(order); err != nil {
+		return err
 	}
 
 	// Validate order entry.
 	return bav.IsValidDAOCoinLimitOrder(order)
 }
 
+// ValidateDAOCoinLimitOrderTradingEnabled returns an error if either side of the
+// order is a DAO coin whose creator has disabled order book trading. $DESO and
+// creator coins can't be restricted.
+func (bav *UtxoView) ValidateDAOCoinLimitOrderTradingEnabled(order *DAOCoinLimitOrderEntry) error {
+	for _, coin := range []struct {
+		creatorPKID   *PKID
+		isCreatorCoin bool
+	}{
+		{order.BuyingDAOCoinCreatorPKID, order.BuyingCoinIsCreatorCoin},
+		{order.SellingDAOCoinCreatorPKID, order.SellingCoinIsCreatorCoin},
+	} {
+		if coin.creatorPKID == nil || coin.creatorPKID.IsZeroPKID() || coin.isCreatorCoin {
+			continue
+		}
+		profileEntry := bav.GetProfileEntryForPKID(coin.creatorPKID)
+		if profileEntry == nil || profileEntry.isDeleted {
+			continue
+		}
+		if profileEntry.DAOCoinEntry.DAOCoinLimitOrderRestriction == DAOCoinLimitOrderRestrictionTradingDisabled {
+			return errors.Wrapf(RuleErrorDAOCoinLimitOrderTradingDisabled,
+				"ValidateDAOCoinLimitOrderTradingEnabled: Trading is disabled for DAO coin %v",
+				PkToStringBoth(profileEntry.PublicKey))
+		}
+	}
+	return nil
+}
+
 func (bav *UtxoView) IsValidDAOCoinLimitOrder(order *DAOCoinLimitOrderEntry) error {
 	// Returns an error if the input order is invalid. Otherwise returns nil.
 
@@ -1709,11 +2182,18 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrder(order *DAOCoinLimitOrderEntry) err
 		return RuleErrorDAOCoinLimitOrderInvalidSellingDAOCoinCreatorPKID
 	}
 
-	// Validate not buying and selling the same coin.
+	// Validate not buying and selling the same coin. Note that this also rules
+	// out trading a creator's creator coin for their own DAO coin.
 	if order.BuyingDAOCoinCreatorPKID.Eq(order.SellingDAOCoinCreatorPKID) {
 		return RuleErrorDAOCoinLimitOrderCannotBuyAndSellSameCoin
 	}
 
+	// Validate $DESO isn't flagged as a creator coin.
+	if (order.BuyingCoinIsCreatorCoin && order.BuyingDAOCoinCreatorPKID.IsZeroPKID()) ||
+		(order.SellingCoinIsCreatorCoin && order.SellingDAOCoinCreatorPKID.IsZeroPKID()) {
+		return RuleErrorDAOCoinLimitOrderCreatorCoinCannotBeDESO
+	}
+
 	// Validate OperationType.
 	if order.OperationType != DAOCoinLimitOrderOperationTypeASK &&
 		order.OperationType != DAOCoinLimitOrderOperationTypeBID {
@@ -1725,7 +2205,8 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrder(order *DAOCoinLimitOrderEntry) err
 	// Validate FillType.
 	if order.FillType != DAOCoinLimitOrderFillTypeGoodTillCancelled &&
 		order.FillType != DAOCoinLimitOrderFillTypeImmediateOrCancel &&
-		order.FillType != DAOCoinLimitOrderFillTypeFillOrKill {
+		order.FillType != DAOCoinLimitOrderFillTypeFillOrKill &&
+		order.FillType != DAOCoinLimitOrderFillTypePostOnly {
 		return RuleErrorDAOCoinLimitOrderInvalidFillType
 	}
 
@@ -1809,9 +2290,9 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrder(order *DAOCoinLimitOrderEntry) err
 	}
 
 	// If selling $DESO, make sure the transactor has enough $DESO to execute the txn.
-	// If selling DAO coins, make sure the transactor has enough DAO coins to execute the txn.
+	// If selling DAO or creator coins, make sure the transactor has enough of them to execute the txn.
 	transactorBalanceBaseUnits, err := bav.getAdjustedDAOCoinBalanceForUserInBaseUnits(
-		order.TransactorPKID, order.SellingDAOCoinCreatorPKID, nil)
+		order.TransactorPKID, order.SellingDAOCoinCreatorPKID, !order.SellingCoinIsCreatorCoin, nil)
 	if err != nil {
 		return err
 	}
@@ -1868,6 +2349,52 @@ func (order *DAOCoinLimitOrderEntry) IsValidMatchingOrderPrice(matchingOrder *DA
 	return true
 }
 
+// IsWithinMaxSlippage returns true if the matching order's price is no worse than the
+// transactor's max slippage price. A nil maxSlippageScaledPrice accepts any price.
+func IsWithinMaxSlippage(
+	maxSlippageScaledPrice *uint256.Int, transactorOrder *DAOCoinLimitOrderEntry,
+	matchingOrder *DAOCoinLimitOrderEntry) bool {
+
+	if maxSlippageScaledPrice == nil {
+		return true
+	}
+	// The max slippage price is checked the same way as a limit order's price.
+	slippageOrder := *transactorOrder
+	slippageOrder.ScaledExchangeRateCoinsToSellPerCoinToBuy = maxSlippageScaledPrice
+	return slippageOrder.IsValidMatchingOrderPrice(matchingOrder)
+}
+
+// GetDAOCoinLimitOrderTradingFees returns the fees charged on a fill in which the taker
+// receives takerBaseUnitsBought and the maker receives makerBaseUnitsBought, along with
+// the PKID the fees are paid to. Each fee is denominated in the coin its payer receives
+// and is rounded down. The fees are nil if trading fees aren't active.
+func (bav *UtxoView) GetDAOCoinLimitOrderTradingFees(
+	takerBaseUnitsBought *uint256.Int, makerBaseUnitsBought *uint256.Int, blockHeight uint32) (
+	_takerFeeBaseUnits *uint256.Int, _makerFeeBaseUnits *uint256.Int, _feeRecipientPKID *PKID) {
+
+	if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderTradingFeesBlockHeight {
+		return nil, nil, nil
+	}
+	globalParamsEntry := bav.GetCurrentGlobalParamsEntry()
+	if globalParamsEntry.DAOCoinLimitOrderFeeRecipientPKID == nil {
+		return nil, nil, nil
+	}
+	takerFeeBaseUnits := calculateDAOCoinLimitOrderFee(
+		takerBaseUnitsBought, globalParamsEntry.DAOCoinLimitOrderTakerFeeBasisPoints)
+	makerFeeBaseUnits := calculateDAOCoinLimitOrderFee(
+		makerBaseUnitsBought, globalParamsEntry.DAOCoinLimitOrderMakerFeeBasisPoints)
+	return takerFeeBaseUnits, makerFeeBaseUnits, globalParamsEntry.DAOCoinLimitOrderFeeRecipientPKID
+}
+
+func calculateDAOCoinLimitOrderFee(baseUnits *uint256.Int, feeBasisPoints uint64) *uint256.Int {
+	// The fee can't exceed the base units since feeBasisPoints is capped well below
+	// MaxBasisPoints, so it always fits in a uint256.
+	feeBig := big.NewInt(0).Mul(baseUnits.ToBig(), big.NewInt(0).SetUint64(feeBasisPoints))
+	feeBig.Div(feeBig, big.NewInt(0).SetUint64(MaxBasisPoints))
+	fee, _ := uint256.FromBig(feeBig)
+	return fee
+}
+
 func (bav *UtxoView) IsValidDAOCoinLimitOrderMatch(
 	transactorOrder *DAOCoinLimitOrderEntry, matchingOrder *DAOCoinLimitOrderEntry) error {
 	// Returns an error if the input order is invalid. Otherwise returns nil.
@@ -1886,6 +2413,13 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrderMatch(
 		return RuleErrorDAOCoinLimitOrderMatchingOrderBuyingDifferentCoins
 	}
 
+	// Validate the coin types match too, since a creator's creator coin and DAO coin
+	// share a PKID.
+	if transactorOrder.BuyingCoinIsCreatorCoin != matchingOrder.SellingCoinIsCreatorCoin ||
+		transactorOrder.SellingCoinIsCreatorCoin != matchingOrder.BuyingCoinIsCreatorCoin {
+		return RuleErrorDAOCoinLimitOrderMatchingOrderDifferentCoinTypes
+	}
+
 	// Validate price.
 	if !transactorOrder.IsValidMatchingOrderPrice(matchingOrder) {
 		return RuleErrorDAOCoinLimitOrderInvalidExchangeRate
@@ -1896,7 +2430,8 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrderMatch(
 	transactorPublicKey := bav.GetPublicKeyForPKID(transactorOrder.TransactorPKID)
 	matchingOrderTransactorPublicKey := bav.GetPublicKeyForPKID(matchingOrder.TransactorPKID)
 
-	if !transactorOrder.BuyingDAOCoinCreatorPKID.IsZeroPKID() {
+	// Creator coins have no transfer restrictions.
+	if !transactorOrder.BuyingDAOCoinCreatorPKID.IsZeroPKID() && !transactorOrder.BuyingCoinIsCreatorCoin {
 		// The matching order is selling DAO coin(s) to the transactor.
 		buyCoinCreatorProfileEntry := bav.GetProfileEntryForPKID(transactorOrder.BuyingDAOCoinCreatorPKID)
 
@@ -1912,7 +2447,7 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrderMatch(
 		}
 	}
 
-	if !transactorOrder.SellingDAOCoinCreatorPKID.IsZeroPKID() {
+	if !transactorOrder.SellingDAOCoinCreatorPKID.IsZeroPKID() && !transactorOrder.SellingCoinIsCreatorCoin {
 		// The transactor is selling DAO coin(s) to the matching order.
 		sellCoinCreatorProfileEntry := bav.GetProfileEntryForPKID(transactorOrder.SellingDAOCoinCreatorPKID)
 
@@ -1938,6 +2473,87 @@ func (bav *UtxoView) IsValidDAOCoinLimitOrderMatch(
 	return nil
 }
 
+// GetFilledDAOCoinLimitOrdersMetadata converts the orders filled by a DAOCoinLimitOrder txn
+// into the metadata we index for it. The fills are recorded in pairs: the transactor's side
+// of each fill, followed by the side of the resting order it matched, so each side's
+// counterparty is the other order in its pair.
+func (bav *UtxoView) GetFilledDAOCoinLimitOrdersMetadata(
+	filledOrders []*FilledDAOCoinLimitOrder) []*FilledDAOCoinLimitOrderMetadata {
+
+	filledOrdersMetadata := []*FilledDAOCoinLimitOrderMetadata{}
+	for ii, filledOrder := range filledOrders {
+		isTransactorOrder := ii%2 == 0
+		counterpartyIndex := ii - 1
+		if isTransactorOrder {
+			counterpartyIndex = ii + 1
+		}
+		counterpartyPublicKeyBase58Check := ""
+		if counterpartyIndex < len(filledOrders) {
+			counterpartyPublicKeyBase58Check = PkToString(
+				bav.GetPublicKeyForPKID(filledOrders[counterpartyIndex].TransactorPKID), bav.Params)
+		}
+		orderIDHex := ""
+		if filledOrder.OrderID != nil {
+			orderIDHex = filledOrder.OrderID.String()
+		}
+
+		filledOrdersMetadata = append(filledOrdersMetadata, &FilledDAOCoinLimitOrderMetadata{
+			TransactorPublicKeyBase58Check: PkToString(
+				bav.GetPublicKeyForPKID(filledOrder.TransactorPKID), bav.Params),
+			BuyingDAOCoinCreatorPublicKey: PkToString(
+				bav.GetPublicKeyForPKID(filledOrder.BuyingDAOCoinCreatorPKID), bav.Params),
+			SellingDAOCoinCreatorPublicKey: PkToString(
+				bav.GetPublicKeyForPKID(filledOrder.SellingDAOCoinCreatorPKID), bav.Params),
+			CoinQuantityInBaseUnitsBought:    filledOrder.CoinQuantityInBaseUnitsBought,
+			CoinQuantityInBaseUnitsSold:      filledOrder.CoinQuantityInBaseUnitsSold,
+			IsFulfilled:                      filledOrder.IsFulfilled,
+			OrderIDHex:                       orderIDHex,
+			IsTransactorOrder:                isTransactorOrder,
+			CounterpartyPublicKeyBase58Check: counterpartyPublicKeyBase58Check,
+			ScaledPriceCoinsSoldPerCoinBought: ComputeFilledDAOCoinLimitOrderScaledPrice(
+				filledOrder.CoinQuantityInBaseUnitsSold, filledOrder.CoinQuantityInBaseUnitsBought),
+			FeeInBaseUnitsPaid: filledOrder.FeeInBaseUnitsPaid,
+		})
+	}
+	return filledOrdersMetadata
+}
+
+// GetDAOCoinLimitOrderMakerPKIDs returns the transactors of the resting orders a
+// DAOCoinLimitOrder txn matched, i.e. the second order in each pair of fills, in the order
+// they were first filled and without duplicates.
+func GetDAOCoinLimitOrderMakerPKIDs(filledOrders []*FilledDAOCoinLimitOrder) []*PKID {
+	makerPKIDs := []*PKID{}
+	seenMakerPKIDs := make(map[PKID]bool)
+	for ii := 1; ii < len(filledOrders); ii += 2 {
+		makerPKID := filledOrders[ii].TransactorPKID
+		if makerPKID == nil || seenMakerPKIDs[*makerPKID] {
+			continue
+		}
+		seenMakerPKIDs[*makerPKID] = true
+		makerPKIDs = append(makerPKIDs, makerPKID)
+	}
+	return makerPKIDs
+}
+
+// ComputeFilledDAOCoinLimitOrderScaledPrice returns the price a fill executed at, in coins
+// sold per coin bought scaled by 1e38. It returns nil if nothing was bought or if the price
+// doesn't fit in a uint256.
+func ComputeFilledDAOCoinLimitOrderScaledPrice(
+	coinQuantityInBaseUnitsSold *uint256.Int, coinQuantityInBaseUnitsBought *uint256.Int) *uint256.Int {
+
+	if coinQuantityInBaseUnitsSold == nil || coinQuantityInBaseUnitsBought == nil ||
+		coinQuantityInBaseUnitsBought.IsZero() {
+		return nil
+	}
+	scaledPriceBig := big.NewInt(0).Mul(coinQuantityInBaseUnitsSold.ToBig(), OneE38.ToBig())
+	scaledPriceBig.Div(scaledPriceBig, coinQuantityInBaseUnitsBought.ToBig())
+	scaledPrice, overflow := uint256.FromBig(scaledPriceBig)
+	if overflow {
+		return nil
+	}
+	return scaledPrice
+}
+
 func CalculateScaledExchangeRateFromString(priceStr string) (*uint256.Int, error) {
 	return ScaleFloatFormatStringToUint256(priceStr, OneE38)
 }
@@ -2030,9 +2646,10 @@ func (bav *UtxoView) GetDESONanosToFillOrder(transactorOrder *DAOCoinLimitOrderE
 			lastSeenOrder = matchingOrder
 
 			matchingOrderBalanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(
-				matchingOrder.TransactorPKID, matchingOrder.SellingDAOCoinCreatorPKID, true)
+				matchingOrder.TransactorPKID, matchingOrder.SellingDAOCoinCreatorPKID,
+				!matchingOrder.SellingCoinIsCreatorCoin)
 
-			// Skip if matching order doesn't own any of the DAO coins they're selling.
+			// Skip if matching order doesn't own any of the coins they're selling.
 			if matchingOrderBalanceEntry == nil || matchingOrderBalanceEntry.isDeleted {
 				continue
 			}
@@ -2042,16 +2659,25 @@ func (bav *UtxoView) GetDESONanosToFillOrder(transactorOrder *DAOCoinLimitOrderE
 			var daoCoinNanosExchanged *uint256.Int
 			var desoNanosExchanged *uint256.Int
 
+			var updatedMatchingOrderQuantityToFill *uint256.Int
+
 			updatedTransactorQuantityToFill,
-				_, // matching order updated quantity, not used here
+				updatedMatchingOrderQuantityToFill,
 				daoCoinNanosExchanged,
 				desoNanosExchanged,
 				err = _calculateDAOCoinsTransferredInLimitOrderMatch(
-				matchingOrder, transactorOrder.OperationType, transactorQuantityToFill)
+				matchingOrder, transactorOrder.GetQuantityOperationType(), transactorQuantityToFill)
 			if err != nil {
 				return 0, errors.Wrapf(err, "GetDESONanosToFillOrder: ")
 			}
 
+			// Skip if the match would be below either order's minimum fill quantity.
+			if transactorOrder.IsBelowMinFillQuantity(transactorQuantityToFill, updatedTransactorQuantityToFill) ||
+				matchingOrder.IsBelowMinFillQuantity(
+					matchingOrder.QuantityToFillInBaseUnits, updatedMatchingOrderQuantityToFill) {
+				continue
+			}
+
 			// Skip if matching order doesn't own enough of the DAO coins they're selling.
 			if matchingOrderBalanceEntry.BalanceNanos.Lt(daoCoinNanosExchanged) {
 				continue
@@ -2102,5 +2728,26 @@ func (bav *UtxoView) ConvertTxnToDAOCoinLimitOrderEntry(txn *MsgDeSoTxn, blockHe
 		OperationType:                             metadata.OperationType,
 		FillType:                                  metadata.FillType,
 		BlockHeight:                               blockHeight,
+		ExpirationBlockHeight:                     metadata.ExpirationBlockHeight,
+		StopTriggerScaledPrice:                    metadata.StopTriggerScaledPrice,
+		MinQuantityToFillInBaseUnits:              metadata.MinQuantityToFillInBaseUnits,
+		QuantityDenomination:                      metadata.QuantityDenomination,
+		BuyingCoinIsCreatorCoin:                   metadata.BuyingCoinIsCreatorCoin,
+		SellingCoinIsCreatorCoin:                  metadata.SellingCoinIsCreatorCoin,
 	}, nil
 }
+
+// FilterExpiredDAOCoinLimitOrders returns the orders that haven't expired as of
+// blockHeight. The GetAllDAOCoinLimitOrders* functions return every order in the
+// order book, so the API uses this to hide orders that can no longer be matched.
+func FilterExpiredDAOCoinLimitOrders(
+	orders []*DAOCoinLimitOrderEntry, blockHeight uint32) []*DAOCoinLimitOrderEntry {
+
+	unexpiredOrders := []*DAOCoinLimitOrderEntry{}
+	for _, order := range orders {
+		if !order.IsExpired(blockHeight) {
+			unexpiredOrders = append(unexpiredOrders, order)
+		}
+	}
+	return unexpiredOrders
+}
@@ -0,0 +1,231 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+//
+// TYPES: DAOCoinLimitOrderBatchMetadata
+//
+
+// DAOCoinLimitOrderBatchMetadata represents the transaction structure for the
+// TxnTypeDAOCoinLimitOrderBatch transaction type. The orders in Orders are connected
+// in-order as if each were its own DAOCoinLimitOrder txn, and either all of them
+// succeed or the whole txn fails. This lets a market maker cancel and replace their
+// quotes atomically in a single txn.
+//
+// The batch pays the txn fee, so each order's FeeNanos must be zero. Batches are only
+// valid after the balance model fork, so orders can't specify BidderInputs. An order
+// placed by a batch gets the OrderID returned by GetDAOCoinLimitOrderBatchOrderID, which
+// lets a later order in the same batch cancel it.
+type DAOCoinLimitOrderBatchMetadata struct {
+	Orders []*DAOCoinLimitOrderMetadata
+}
+
+func (txnData *DAOCoinLimitOrderBatchMetadata) GetTxnType() TxnType {
+	return TxnTypeDAOCoinLimitOrderBatch
+}
+
+func (txnData *DAOCoinLimitOrderBatchMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(txnData.Orders)))...)
+	for _, order := range txnData.Orders {
+		orderBytes, err := order.ToBytes(preSignature)
+		if err != nil {
+			return nil, errors.Wrap(err, "DAOCoinLimitOrderBatchMetadata.ToBytes: Problem serializing order")
+		}
+		data = append(data, EncodeByteArray(orderBytes)...)
+	}
+	return data, nil
+}
+
+func (txnData *DAOCoinLimitOrderBatchMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	numOrders, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrap(err, "DAOCoinLimitOrderBatchMetadata.FromBytes: Problem reading numOrders")
+	}
+	txnData.Orders, err = SafeMakeSliceWithLength[*DAOCoinLimitOrderMetadata](numOrders)
+	if err != nil {
+		return errors.Wrap(err, "DAOCoinLimitOrderBatchMetadata.FromBytes: Problem allocating Orders")
+	}
+	for ii := range txnData.Orders {
+		orderBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrap(err, "DAOCoinLimitOrderBatchMetadata.FromBytes: Problem reading order bytes")
+		}
+		txnData.Orders[ii] = &DAOCoinLimitOrderMetadata{}
+		if err = txnData.Orders[ii].FromBytes(orderBytes); err != nil {
+			return errors.Wrap(err, "DAOCoinLimitOrderBatchMetadata.FromBytes: Problem parsing order")
+		}
+	}
+	return nil
+}
+
+func (txnData *DAOCoinLimitOrderBatchMetadata) New() DeSoTxnMetadata {
+	return &DAOCoinLimitOrderBatchMetadata{}
+}
+
+// GetDAOCoinLimitOrderBatchOrderID returns the OrderID of the order at the given index
+// of a DAOCoinLimitOrderBatch txn.
+func GetDAOCoinLimitOrderBatchOrderID(txHash *BlockHash, orderIndex uint64) *BlockHash {
+	return Sha256DoubleHash(append(txHash.ToBytes(), UintToBuf(orderIndex)...))
+}
+
+// getDAOCoinLimitOrderBatchInnerTxn returns the txn that the order at the given index of a
+// DAOCoinLimitOrderBatch txn is connected and disconnected as.
+func getDAOCoinLimitOrderBatchInnerTxn(txn *MsgDeSoTxn, orderIndex int) *MsgDeSoTxn {
+	return &MsgDeSoTxn{
+		TxnVersion: txn.TxnVersion,
+		PublicKey:  txn.PublicKey,
+		TxnMeta:    txn.TxnMeta.(*DAOCoinLimitOrderBatchMetadata).Orders[orderIndex],
+	}
+}
+
+//
+// Connect and Disconnect DAOCoinLimitOrderBatch Logic
+//
+
+func (bav *UtxoView) _connectDAOCoinLimitOrderBatch(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	if blockHeight < bav.Params.ForkHeights.DAOCoinLimitOrderBatchBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight {
+		return 0, 0, nil, RuleErrorDAOCoinLimitOrderBatchBeforeBlockHeight
+	}
+
+	// Check that the transaction has the right TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeDAOCoinLimitOrderBatch {
+		return 0, 0, nil, fmt.Errorf("_connectDAOCoinLimitOrderBatch: called with bad TxnType %s",
+			txn.TxnMeta.GetTxnType().String())
+	}
+	txMeta := txn.TxnMeta.(*DAOCoinLimitOrderBatchMetadata)
+
+	// Validate the orders. The remaining validation happens as each order is connected.
+	if len(txMeta.Orders) == 0 {
+		return 0, 0, nil, RuleErrorDAOCoinLimitOrderBatchEmpty
+	}
+	if len(txMeta.Orders) > MaxDAOCoinLimitOrdersPerBatch {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinLimitOrderBatchTooManyOrders,
+			"_connectDAOCoinLimitOrderBatch: %d orders exceeds max %d", len(txMeta.Orders), MaxDAOCoinLimitOrdersPerBatch)
+	}
+	for ii, order := range txMeta.Orders {
+		if order == nil || order.FeeNanos != 0 || len(order.BidderInputs) != 0 {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinLimitOrderBatchInvalidOrder,
+				"_connectDAOCoinLimitOrderBatch: order %d must have zero FeeNanos and no BidderInputs", ii)
+		}
+	}
+
+	// Connect a basic transfer to pay the fee and verify the signature.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrderBatch: ")
+	}
+
+	// If the batch is signed by a derived key, each order counts against the derived
+	// key's spending limits as if it were its own DAOCoinLimitOrder txn.
+	var derivedPkBytes []byte
+	isDerived := false
+	if blockHeight >= bav.Params.ForkHeights.DerivedKeyTrackSpendingLimitsBlockHeight {
+		derivedPkBytes, isDerived, err = IsDerivedSignature(txn, blockHeight)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrderBatch: ")
+		}
+	}
+
+	// Connect the orders. The fee was paid by the batch, so the orders' FeeNanos aren't checked.
+	var innerUtxoOps [][]*UtxoOperation
+	for ii := range txMeta.Orders {
+		innerTxn := getDAOCoinLimitOrderBatchInnerTxn(txn, ii)
+		orderID := GetDAOCoinLimitOrderBatchOrderID(txHash, uint64(ii))
+		orderInput, orderOutput, orderUtxoOps, err := bav._connectDAOCoinLimitOrderWithFeeCheck(
+			innerTxn, orderID, blockHeight, false, false)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrderBatch: Problem connecting order %d: ", ii)
+		}
+		if isDerived {
+			orderUtxoOps, err = bav._checkAndUpdateDerivedKeySpendingLimit(
+				innerTxn, derivedPkBytes, orderInput, orderUtxoOps, blockHeight)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrderBatch: Problem with order %d: ", ii)
+			}
+		}
+		innerUtxoOps = append(innerUtxoOps, orderUtxoOps)
+
+		totalInput, err = SafeUint64().Add(totalInput, orderInput)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrderBatch: ")
+		}
+		totalOutput, err = SafeUint64().Add(totalOutput, orderOutput)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinLimitOrderBatch: ")
+		}
+	}
+
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                   OperationTypeDAOCoinLimitOrderBatch,
+		AtomicTxnsInnerUtxoOps: innerUtxoOps,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectDAOCoinLimitOrderBatch(
+	operationType OperationType, currentTxn *MsgDeSoTxn, txnHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation, blockHeight uint32) error {
+
+	// Verify that the last operation is a DAOCoinLimitOrderBatch operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectDAOCoinLimitOrderBatch: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeDAOCoinLimitOrderBatch {
+		return fmt.Errorf("_disconnectDAOCoinLimitOrderBatch: Trying to revert "+
+			"OperationTypeDAOCoinLimitOrderBatch but found type %v", operationData.Type)
+	}
+	txMeta := currentTxn.TxnMeta.(*DAOCoinLimitOrderBatchMetadata)
+	if len(operationData.AtomicTxnsInnerUtxoOps) != len(txMeta.Orders) {
+		return fmt.Errorf("_disconnectDAOCoinLimitOrderBatch: Found %d UtxoOps for %d orders",
+			len(operationData.AtomicTxnsInnerUtxoOps), len(txMeta.Orders))
+	}
+
+	// Disconnect the orders in reverse.
+	for ii := len(txMeta.Orders) - 1; ii >= 0; ii-- {
+		innerTxn := getDAOCoinLimitOrderBatchInnerTxn(currentTxn, ii)
+		orderID := GetDAOCoinLimitOrderBatchOrderID(txnHash, uint64(ii))
+		orderUtxoOps := operationData.AtomicTxnsInnerUtxoOps[ii]
+
+		// Revert the order's spending limit accounting, if the batch was signed by a derived key.
+		if len(orderUtxoOps) > 0 && orderUtxoOps[len(orderUtxoOps)-1].Type == OperationTypeSpendingLimitAccounting {
+			derivedPkBytes, isDerived, err := IsDerivedSignature(currentTxn, blockHeight)
+			if !isDerived || err != nil {
+				return fmt.Errorf("_disconnectDAOCoinLimitOrderBatch: Found Spending Limit Accounting op with "+
+					"non-derived key signature or got an error %v", err)
+			}
+			derivedKeyEntry := bav.GetDerivedKeyMappingForOwner(currentTxn.PublicKey, derivedPkBytes)
+			if derivedKeyEntry == nil || derivedKeyEntry.isDeleted {
+				return fmt.Errorf("_disconnectDAOCoinLimitOrderBatch: could not find derived key entry")
+			}
+			bav._deleteDerivedKeyMapping(derivedKeyEntry)
+			if prevDerivedKeyEntry := orderUtxoOps[len(orderUtxoOps)-1].PrevDerivedKeyEntry; prevDerivedKeyEntry != nil {
+				bav._setDerivedKeyMapping(prevDerivedKeyEntry)
+			}
+			orderUtxoOps = orderUtxoOps[:len(orderUtxoOps)-1]
+		}
+
+		if err := bav._disconnectDAOCoinLimitOrder(
+			OperationTypeDAOCoinLimitOrder, innerTxn, orderID, orderUtxoOps, blockHeight); err != nil {
+			return errors.Wrapf(err, "_disconnectDAOCoinLimitOrderBatch: Problem disconnecting order %d: ", ii)
+		}
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txnHash, utxoOpsForTxn[:operationIndex], blockHeight)
+}
@@ -0,0 +1,376 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinLimitOrderBatchMetadataEncoding(t *testing.T) {
+	require := require.New(t)
+
+	txMeta := &DAOCoinLimitOrderBatchMetadata{
+		Orders: []*DAOCoinLimitOrderMetadata{
+			{
+				CancelOrderID: NewBlockHash(RandomBytes(HashSizeBytes)),
+			},
+			{
+				BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+				SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+				ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt().SetUint64(100),
+				QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(10),
+				OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+				FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+				ExpirationBlockHeight:                     100,
+			},
+		},
+	}
+	txMetaBytes, err := txMeta.ToBytes(false)
+	require.NoError(err)
+	decodedTxMeta, err := NewTxnMetadata(TxnTypeDAOCoinLimitOrderBatch)
+	require.NoError(err)
+	require.NoError(decodedTxMeta.FromBytes(txMetaBytes))
+	require.Equal(txMeta, decodedTxMeta)
+
+	// Each order in a batch gets its own OrderID.
+	txHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	require.NotEqual(GetDAOCoinLimitOrderBatchOrderID(txHash, 0), GetDAOCoinLimitOrderBatchOrderID(txHash, 1))
+	require.NotEqual(txHash, GetDAOCoinLimitOrderBatchOrderID(txHash, 0))
+}
+
+func TestDAOCoinLimitOrderBatchConnectAndDisconnect(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(100)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBatchBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	// The orders' utxo ops are stored in AtomicTxnsInnerUtxoOps, which are only encoded once the
+	// PoS state setup migration is triggered.
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e5)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+
+	// Create a profile for m0 and mint some of its DAO coins.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1e6),
+	})
+
+	// newAskMetadata returns an order from m0 to sell its DAO coin for $DESO at a price in m0
+	// DAO coin base units per $DESO nano.
+	newAskMetadata := func(price string, quantity uint64) *DAOCoinLimitOrderMetadata {
+		scaledPrice, err := CalculateScaledExchangeRateFromString(price)
+		require.NoError(err)
+		return &DAOCoinLimitOrderMetadata{
+			BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+			SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice,
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(quantity),
+			OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		}
+	}
+	// getBook returns the quantity of each of the orders to sell m0's DAO coin for $DESO.
+	getBook := func(utxoView *UtxoView) map[BlockHash]uint64 {
+		if utxoView == nil {
+			utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		}
+		orders, err := utxoView.GetAllDAOCoinLimitOrdersForThisDAOCoinPair(&ZeroPKID, m0PKID)
+		require.NoError(err)
+		book := make(map[BlockHash]uint64)
+		for _, order := range orders {
+			book[*order.OrderID] = order.QuantityToFillInBaseUnits.Uint64()
+		}
+		return book
+	}
+	getDAOCoinBalance := func(utxoView *UtxoView, holderPKID *PKID) uint64 {
+		if utxoView == nil {
+			utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		}
+		balanceEntry := utxoView._getBalanceEntryForHODLerPKIDAndCreatorPKID(holderPKID, m0PKID, true)
+		if balanceEntry == nil || balanceEntry.isDeleted {
+			return 0
+		}
+		return balanceEntry.BalanceNanos.Uint64()
+	}
+
+	// m0 quotes two asks with individual orders.
+	ask1Metadata := newAskMetadata("10", 1e5)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, *ask1Metadata)
+	ask1OrderID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	ask2Metadata := newAskMetadata("20", 1e5)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, *ask2Metadata)
+	ask2OrderID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	bookBeforeBatch := getBook(nil)
+	require.Equal(map[BlockHash]uint64{*ask1OrderID: 1e5, *ask2OrderID: 1e5}, bookBeforeBatch)
+
+	// m0 replaces both asks with three new ones in a single batch.
+	_doDAOCoinLimitOrderBatchTxnWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv,
+		&DAOCoinLimitOrderBatchMetadata{Orders: []*DAOCoinLimitOrderMetadata{
+			{CancelOrderID: ask1OrderID},
+			{CancelOrderID: ask2OrderID},
+			newAskMetadata("5", 1e5),
+			newAskMetadata("8", 2e5),
+			newAskMetadata("10", 3e5),
+		}})
+	batchTxnHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	bookAfterBatch := getBook(nil)
+	require.Equal(map[BlockHash]uint64{
+		*GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 2): 1e5,
+		*GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 3): 2e5,
+		*GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 4): 3e5,
+	}, bookAfterBatch)
+	m0DESOBalanceAfterBatch := _getBalance(t, chain, nil, m0Pub)
+
+	// If any order in a batch fails, the whole batch is rejected and none of its other orders
+	// change the book.
+	failingBatches := []struct {
+		publicKey  string
+		privateKey string
+		orders     []*DAOCoinLimitOrderMetadata
+		err        RuleError
+	}{
+		{
+			// The last order cancels an order that doesn't exist.
+			publicKey:  m0Pub,
+			privateKey: m0Priv,
+			orders: []*DAOCoinLimitOrderMetadata{
+				{CancelOrderID: GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 2)},
+				newAskMetadata("6", 1e5),
+				{CancelOrderID: ask1OrderID},
+			},
+			err: RuleErrorDAOCoinLimitOrderToCancelNotFound,
+		},
+		{
+			// The last order sells more DAO coins than m0 has.
+			publicKey:  m0Pub,
+			privateKey: m0Priv,
+			orders: []*DAOCoinLimitOrderMetadata{
+				{CancelOrderID: GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 3)},
+				newAskMetadata("6", 1e5),
+				newAskMetadata("6", 1e7),
+			},
+			err: RuleErrorDAOCoinLimitOrderInsufficientDAOCoinsToOpenOrder,
+		},
+		{
+			// m1 can't cancel m0's order.
+			publicKey:  m1Pub,
+			privateKey: m1Priv,
+			orders: []*DAOCoinLimitOrderMetadata{
+				{CancelOrderID: GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 4)},
+			},
+			err: RuleErrorDAOCoinLimitOrderToCancelNotYours,
+		},
+	}
+	for _, failingBatch := range failingBatches {
+		_, _, err := _doDAOCoinLimitOrderBatchTxn(t, chain, db, params, feeRateNanosPerKB,
+			failingBatch.publicKey, failingBatch.privateKey,
+			&DAOCoinLimitOrderBatchMetadata{Orders: failingBatch.orders})
+		require.Error(err)
+		require.Contains(err.Error(), failingBatch.err)
+		require.Equal(bookAfterBatch, getBook(nil))
+		require.Equal(m0DESOBalanceAfterBatch, _getBalance(t, chain, nil, m0Pub))
+	}
+
+	// m1 buys part of m0's cheapest ask and places a bid below the rest in one batch.
+	bidPrice, err := CalculateScaledExchangeRateFromString("0.1")
+	require.NoError(err)
+	lowBidPrice, err := CalculateScaledExchangeRateFromString("0.05")
+	require.NoError(err)
+	_doDAOCoinLimitOrderBatchTxnWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv,
+		&DAOCoinLimitOrderBatchMetadata{Orders: []*DAOCoinLimitOrderMetadata{
+			{
+				BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+				SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+				ScaledExchangeRateCoinsToSellPerCoinToBuy: bidPrice,
+				QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+				OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+				FillType:                                  DAOCoinLimitOrderFillTypeFillOrKill,
+			},
+			{
+				BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+				SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+				ScaledExchangeRateCoinsToSellPerCoinToBuy: lowBidPrice,
+				QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+				OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+				FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+			},
+		}})
+	m1BatchTxnHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	require.Equal(map[BlockHash]uint64{
+		*GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 2): 1e5,
+		*GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 3): 2e5,
+		*GetDAOCoinLimitOrderBatchOrderID(batchTxnHash, 4): 2e5,
+	}, getBook(nil))
+	require.Equal(uint64(1e5), getDAOCoinBalance(nil, m1PKID))
+	require.Equal(uint64(9e5), getDAOCoinBalance(nil, m0PKID))
+	// m0 sold 1e5 base units at 10 per $DESO nano.
+	require.Equal(m0DESOBalanceAfterBatch+1e4, _getBalance(t, chain, nil, m0Pub))
+	m1BidOrder, err := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil).
+		GetDAOCoinLimitOrderEntry(GetDAOCoinLimitOrderBatchOrderID(m1BatchTxnHash, 1))
+	require.NoError(err)
+	require.NotNil(m1BidOrder)
+	require.Equal(m1PKID, m1BidOrder.TransactorPKID)
+
+	// Disconnecting the batches restores the book as it was before them.
+	{
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		for ii := len(testMeta.txns) - 1; ii >= len(testMeta.txns)-2; ii-- {
+			txn := testMeta.txns[ii]
+			require.NoError(utxoView.DisconnectTransaction(
+				txn, txn.Hash(), testMeta.txnOps[ii], testMeta.savedHeight))
+		}
+		require.Equal(bookBeforeBatch, getBook(utxoView))
+		m1BidOrder, err := utxoView.GetDAOCoinLimitOrderEntry(GetDAOCoinLimitOrderBatchOrderID(m1BatchTxnHash, 1))
+		require.NoError(err)
+		require.True(m1BidOrder == nil || m1BidOrder.isDeleted)
+		require.Zero(getDAOCoinBalance(utxoView, m1PKID))
+		require.Equal(uint64(1e6), getDAOCoinBalance(utxoView, m0PKID))
+	}
+
+	_executeAllTestRollbackAndFlush(testMeta)
+	require.Empty(getBook(nil))
+}
+
+//
+// ----- HELPERS
+//
+
+func _createDAOCoinLimitOrderBatchTxn(
+	chain *Blockchain,
+	transactorPublicKey []byte,
+	metadata *DAOCoinLimitOrderBatchMetadata,
+	minFeeRateNanosPerKB uint64, mempool Mempool) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: []*DeSoOutput{},
+	}
+
+	// Add inputs and change for a standard pay per KB transaction. Any $DESO the orders spend
+	// is taken from the transactor's balance as they're connected.
+	totalInput, _, changeAmount, fees, err := chain.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "_createDAOCoinLimitOrderBatchTxn: Problem adding inputs: ")
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+// No error expected.
+func _doDAOCoinLimitOrderBatchTxnWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	TransactorPublicKeyBase58Check string,
+	TransactorPrivateKeyBase58Check string,
+	metadata *DAOCoinLimitOrderBatchMetadata) {
+
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, TransactorPublicKeyBase58Check))
+
+	currentOps, currentTxn, err := _doDAOCoinLimitOrderBatchTxn(testMeta.t, testMeta.chain, testMeta.db,
+		testMeta.params, feeRateNanosPerKB, TransactorPublicKeyBase58Check, TransactorPrivateKeyBase58Check, metadata)
+
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+// Error expected.
+func _doDAOCoinLimitOrderBatchTxn(t *testing.T, chain *Blockchain, db *badger.DB,
+	params *DeSoParams, feeRateNanosPerKB uint64,
+	TransactorPublicKeyBase58Check string,
+	TransactorPrivateKeyBase58Check string,
+	metadata *DAOCoinLimitOrderBatchMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(TransactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+
+	txn, totalInputMake, _, _, err := _createDAOCoinLimitOrderBatchTxn(
+		chain, transactorPkBytes, metadata, feeRateNanosPerKB, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(t, txn, TransactorPrivateKeyBase58Check)
+
+	// Always use height+1 for validation since it's assumed the transaction will
+	// get mined into the next block.
+	blockHeight := chain.blockTip().Height + 1
+	utxoOps, totalInput, totalOutput, fees, err :=
+		utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	require.Equal(totalInput, totalOutput+fees)
+	// Total input will be greater than totalInputMake if the orders spend $DESO.
+	require.True(totalInput >= totalInputMake)
+	require.Equal(OperationTypeDAOCoinLimitOrderBatch, utxoOps[len(utxoOps)-1].Type)
+	require.Len(utxoOps[len(utxoOps)-1].AtomicTxnsInnerUtxoOps, len(metadata.Orders))
+
+	require.NoError(utxoView.FlushToDb(0))
+
+	return utxoOps, txn, nil
+}
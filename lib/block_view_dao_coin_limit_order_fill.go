@@ -0,0 +1,579 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_dao_coin_limit_order_fill.go persists a DAOCoinLimitOrderFillEntry for every
+// match between a DAO coin limit order and an order resting in the book, so that past
+// trades can be enumerated by the PKID of either side or by the coin pair. Fill entries
+// are part of state: they're written when a DAOCoinLimitOrder txn connects, included in
+// snapshots, and deleted when the txn is disconnected.
+
+//
+// TYPES: DAOCoinLimitOrderFillEntry
+//
+
+type DAOCoinLimitOrderFillEntry struct {
+	// TxnHash is the hash of the DAOCoinLimitOrder txn that matched, and FillIndex is the
+	// position of the match among the txn's matches.
+	TxnHash   *BlockHash
+	FillIndex uint32
+	// BlockHeight is the height of the block the txn was connected in.
+	BlockHeight uint64
+
+	// The taker is the order placed by the txn, and the maker is the order resting in the
+	// book that it matched against.
+	TakerOrderID *BlockHash
+	MakerOrderID *BlockHash
+	TakerPKID    *PKID
+	MakerPKID    *PKID
+
+	// The coin the taker bought and the coin the taker sold. The maker traded the other way.
+	BuyingDAOCoinCreatorPKID  *PKID
+	SellingDAOCoinCreatorPKID *PKID
+	// The price the match executed at, which is the maker's price, expressed like the maker's
+	// ScaledExchangeRateCoinsToSellPerCoinToBuy.
+	MakerScaledExchangeRateCoinsToSellPerCoinToBuy *uint256.Int
+	// The quantities the taker bought and sold. Fees are included in the quantities.
+	CoinQuantityInBaseUnitsBought *uint256.Int
+	CoinQuantityInBaseUnitsSold   *uint256.Int
+	// The fees each side paid, in the coin it received.
+	TakerFeeInBaseUnits *uint256.Int
+	MakerFeeInBaseUnits *uint256.Int
+
+	isDeleted bool
+}
+
+type DAOCoinLimitOrderFillMapKey struct {
+	TxnHash   BlockHash
+	FillIndex uint32
+}
+
+func MakeDAOCoinLimitOrderFillMapKey(txnHash *BlockHash, fillIndex uint32) DAOCoinLimitOrderFillMapKey {
+	return DAOCoinLimitOrderFillMapKey{
+		TxnHash:   *txnHash,
+		FillIndex: fillIndex,
+	}
+}
+
+func (entry *DAOCoinLimitOrderFillEntry) ToMapKey() DAOCoinLimitOrderFillMapKey {
+	return MakeDAOCoinLimitOrderFillMapKey(entry.TxnHash, entry.FillIndex)
+}
+
+func (entry *DAOCoinLimitOrderFillEntry) Copy() *DAOCoinLimitOrderFillEntry {
+	return &DAOCoinLimitOrderFillEntry{
+		TxnHash:                   entry.TxnHash.NewBlockHash(),
+		FillIndex:                 entry.FillIndex,
+		BlockHeight:               entry.BlockHeight,
+		TakerOrderID:              entry.TakerOrderID.NewBlockHash(),
+		MakerOrderID:              entry.MakerOrderID.NewBlockHash(),
+		TakerPKID:                 entry.TakerPKID.NewPKID(),
+		MakerPKID:                 entry.MakerPKID.NewPKID(),
+		BuyingDAOCoinCreatorPKID:  entry.BuyingDAOCoinCreatorPKID.NewPKID(),
+		SellingDAOCoinCreatorPKID: entry.SellingDAOCoinCreatorPKID.NewPKID(),
+		MakerScaledExchangeRateCoinsToSellPerCoinToBuy: cloneOptionalUint256(
+			entry.MakerScaledExchangeRateCoinsToSellPerCoinToBuy),
+		CoinQuantityInBaseUnitsBought: cloneOptionalUint256(entry.CoinQuantityInBaseUnitsBought),
+		CoinQuantityInBaseUnitsSold:   cloneOptionalUint256(entry.CoinQuantityInBaseUnitsSold),
+		TakerFeeInBaseUnits:           cloneOptionalUint256(entry.TakerFeeInBaseUnits),
+		MakerFeeInBaseUnits:           cloneOptionalUint256(entry.MakerFeeInBaseUnits),
+		isDeleted:                     entry.isDeleted,
+	}
+}
+
+func (entry *DAOCoinLimitOrderFillEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.TxnHash, skipMetadata...)...)
+	data = append(data, UintToBuf(uint64(entry.FillIndex))...)
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.TakerOrderID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.MakerOrderID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.TakerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.MakerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.BuyingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.SellingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, VariableEncodeUint256(entry.MakerScaledExchangeRateCoinsToSellPerCoinToBuy)...)
+	data = append(data, VariableEncodeUint256(entry.CoinQuantityInBaseUnitsBought)...)
+	data = append(data, VariableEncodeUint256(entry.CoinQuantityInBaseUnitsSold)...)
+	data = append(data, VariableEncodeUint256(entry.TakerFeeInBaseUnits)...)
+	data = append(data, VariableEncodeUint256(entry.MakerFeeInBaseUnits)...)
+	return data
+}
+
+func (entry *DAOCoinLimitOrderFillEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// TxnHash
+	entry.TxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading TxnHash: ")
+	}
+
+	// FillIndex
+	fillIndex, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading FillIndex: ")
+	}
+	entry.FillIndex = uint32(fillIndex)
+
+	// BlockHeight
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading BlockHeight: ")
+	}
+
+	// TakerOrderID
+	entry.TakerOrderID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading TakerOrderID: ")
+	}
+
+	// MakerOrderID
+	entry.MakerOrderID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading MakerOrderID: ")
+	}
+
+	// TakerPKID
+	entry.TakerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading TakerPKID: ")
+	}
+
+	// MakerPKID
+	entry.MakerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading MakerPKID: ")
+	}
+
+	// BuyingDAOCoinCreatorPKID
+	entry.BuyingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading BuyingDAOCoinCreatorPKID: ")
+	}
+
+	// SellingDAOCoinCreatorPKID
+	entry.SellingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading SellingDAOCoinCreatorPKID: ")
+	}
+
+	// MakerScaledExchangeRateCoinsToSellPerCoinToBuy
+	entry.MakerScaledExchangeRateCoinsToSellPerCoinToBuy, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading MakerScaledExchangeRateCoinsToSellPerCoinToBuy: ")
+	}
+
+	// CoinQuantityInBaseUnitsBought
+	entry.CoinQuantityInBaseUnitsBought, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading CoinQuantityInBaseUnitsBought: ")
+	}
+
+	// CoinQuantityInBaseUnitsSold
+	entry.CoinQuantityInBaseUnitsSold, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading CoinQuantityInBaseUnitsSold: ")
+	}
+
+	// TakerFeeInBaseUnits
+	entry.TakerFeeInBaseUnits, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading TakerFeeInBaseUnits: ")
+	}
+
+	// MakerFeeInBaseUnits
+	entry.MakerFeeInBaseUnits, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinLimitOrderFillEntry.Decode: Problem reading MakerFeeInBaseUnits: ")
+	}
+
+	return nil
+}
+
+func (entry *DAOCoinLimitOrderFillEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DAOCoinLimitOrderFillEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDAOCoinLimitOrderFillEntry
+}
+
+// _sortDAOCoinLimitOrderFillEntries sorts fills from the most recent to the least recent.
+// Fills in the same block are ordered by txn hash, and fills in the same txn by FillIndex.
+func _sortDAOCoinLimitOrderFillEntries(entries []*DAOCoinLimitOrderFillEntry) {
+	sort.Slice(entries, func(ii, jj int) bool {
+		if entries[ii].BlockHeight != entries[jj].BlockHeight {
+			return entries[ii].BlockHeight > entries[jj].BlockHeight
+		}
+		if cmp := bytes.Compare(entries[ii].TxnHash[:], entries[jj].TxnHash[:]); cmp != 0 {
+			return cmp > 0
+		}
+		return entries[ii].FillIndex > entries[jj].FillIndex
+	})
+}
+
+// _orderedDAOCoinPair returns the PKIDs of a coin pair in a canonical order, so that the
+// fills of both directions of a pair are indexed together.
+func _orderedDAOCoinPair(pkid1 *PKID, pkid2 *PKID) (*PKID, *PKID) {
+	if bytes.Compare(pkid1[:], pkid2[:]) <= 0 {
+		return pkid1, pkid2
+	}
+	return pkid2, pkid1
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForDAOCoinLimitOrderFillEntry(txnHash *BlockHash, fillIndex uint32) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinLimitOrderFillByTxnHashAndIndex...)
+	key = append(key, txnHash[:]...)
+	key = append(key, _EncodeUint32(fillIndex)...)
+	return key
+}
+
+func DBPrefixKeyForDAOCoinLimitOrderFillsByTransactor(transactorPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinLimitOrderFillByTransactorPKID...)
+	key = append(key, transactorPKID[:]...)
+	return key
+}
+
+func DBKeyForDAOCoinLimitOrderFillByTransactor(transactorPKID *PKID, entry *DAOCoinLimitOrderFillEntry) []byte {
+	key := DBPrefixKeyForDAOCoinLimitOrderFillsByTransactor(transactorPKID)
+	key = append(key, EncodeUint64(entry.BlockHeight)...)
+	key = append(key, entry.TxnHash[:]...)
+	key = append(key, _EncodeUint32(entry.FillIndex)...)
+	return key
+}
+
+func DBPrefixKeyForDAOCoinLimitOrderFillsByCoinPair(coinPKID1 *PKID, coinPKID2 *PKID) []byte {
+	lowerPKID, higherPKID := _orderedDAOCoinPair(coinPKID1, coinPKID2)
+	key := append([]byte{}, Prefixes.PrefixDAOCoinLimitOrderFillByCoinPair...)
+	key = append(key, lowerPKID[:]...)
+	key = append(key, higherPKID[:]...)
+	return key
+}
+
+func DBKeyForDAOCoinLimitOrderFillByCoinPair(entry *DAOCoinLimitOrderFillEntry) []byte {
+	key := DBPrefixKeyForDAOCoinLimitOrderFillsByCoinPair(
+		entry.BuyingDAOCoinCreatorPKID, entry.SellingDAOCoinCreatorPKID)
+	key = append(key, EncodeUint64(entry.BlockHeight)...)
+	key = append(key, entry.TxnHash[:]...)
+	key = append(key, _EncodeUint32(entry.FillIndex)...)
+	return key
+}
+
+// _getDAOCoinLimitOrderFillMapKeyFromIndexKey parses the TxnHash and FillIndex that end
+// every fill index key.
+func _getDAOCoinLimitOrderFillMapKeyFromIndexKey(key []byte) (DAOCoinLimitOrderFillMapKey, error) {
+	if len(key) < HashSizeBytes+4 {
+		return DAOCoinLimitOrderFillMapKey{}, fmt.Errorf(
+			"_getDAOCoinLimitOrderFillMapKeyFromIndexKey: Key has %d bytes", len(key))
+	}
+	txnHashStart := len(key) - HashSizeBytes - 4
+	return MakeDAOCoinLimitOrderFillMapKey(
+		NewBlockHash(key[txnHashStart:txnHashStart+HashSizeBytes]),
+		DecodeUint32(key[len(key)-4:]),
+	), nil
+}
+
+func DBGetDAOCoinLimitOrderFillEntry(
+	handle *badger.DB, snap *Snapshot, txnHash *BlockHash, fillIndex uint32) (*DAOCoinLimitOrderFillEntry, error) {
+
+	var ret *DAOCoinLimitOrderFillEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetDAOCoinLimitOrderFillEntryWithTxn(txn, snap, txnHash, fillIndex)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetDAOCoinLimitOrderFillEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, txnHash *BlockHash, fillIndex uint32) (*DAOCoinLimitOrderFillEntry, error) {
+
+	// Retrieve DAOCoinLimitOrderFillEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForDAOCoinLimitOrderFillEntry(txnHash, fillIndex))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetDAOCoinLimitOrderFillEntry: problem retrieving DAOCoinLimitOrderFillEntry: ")
+	}
+
+	// Decode DAOCoinLimitOrderFillEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&DAOCoinLimitOrderFillEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDAOCoinLimitOrderFillEntry: problem decoding DAOCoinLimitOrderFillEntry: ")
+	}
+	return entry, nil
+}
+
+// _dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix returns the fills under an index prefix,
+// most recent first. A limit of zero returns every fill.
+func _dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix(
+	handle *badger.DB, snap *Snapshot, prefix []byte, limit int) ([]*DAOCoinLimitOrderFillEntry, error) {
+
+	keysFound, _, err := EnumerateKeysForPrefixWithLimitOffsetOrder(
+		handle, prefix, limit, nil, true, NewSet([]string{}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "_dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix: ")
+	}
+	var entries []*DAOCoinLimitOrderFillEntry
+	for _, key := range keysFound {
+		mapKey, err := _getDAOCoinLimitOrderFillMapKeyFromIndexKey(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "_dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix: ")
+		}
+		entry, err := DBGetDAOCoinLimitOrderFillEntry(handle, snap, &mapKey.TxnHash, mapKey.FillIndex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "_dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix: ")
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("_dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix: "+
+				"fill %v:%d is indexed but doesn't exist", mapKey.TxnHash, mapKey.FillIndex)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// DBGetDAOCoinLimitOrderFillEntriesForTransactor returns the fills in which the PKID was
+// the taker or the maker, most recent first. A limit of zero returns every fill.
+func DBGetDAOCoinLimitOrderFillEntriesForTransactor(
+	handle *badger.DB, snap *Snapshot, transactorPKID *PKID, limit int) ([]*DAOCoinLimitOrderFillEntry, error) {
+
+	return _dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix(
+		handle, snap, DBPrefixKeyForDAOCoinLimitOrderFillsByTransactor(transactorPKID), limit)
+}
+
+// DBGetDAOCoinLimitOrderFillEntriesForCoinPair returns the fills between two coins in
+// either direction, most recent first. A limit of zero returns every fill.
+func DBGetDAOCoinLimitOrderFillEntriesForCoinPair(
+	handle *badger.DB, snap *Snapshot, coinPKID1 *PKID, coinPKID2 *PKID, limit int) ([]*DAOCoinLimitOrderFillEntry, error) {
+
+	return _dbGetDAOCoinLimitOrderFillEntriesForIndexPrefix(
+		handle, snap, DBPrefixKeyForDAOCoinLimitOrderFillsByCoinPair(coinPKID1, coinPKID2), limit)
+}
+
+func DBPutDAOCoinLimitOrderFillEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinLimitOrderFillEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinLimitOrderFillEntry(entry.TxnHash, entry.FillIndex)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutDAOCoinLimitOrderFillEntryWithTxn: problem storing DAOCoinLimitOrderFillEntry: ")
+	}
+
+	// Index the fill under both sides and under the coin pair. A self-trade is only
+	// indexed once under its transactor.
+	for _, indexKey := range _dbIndexKeysForDAOCoinLimitOrderFillEntry(entry) {
+		if err := DBSetWithTxn(txn, snap, indexKey, []byte{}, eventManager); err != nil {
+			return errors.Wrapf(err, "DBPutDAOCoinLimitOrderFillEntryWithTxn: problem storing fill index: ")
+		}
+	}
+	return nil
+}
+
+func DBDeleteDAOCoinLimitOrderFillEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinLimitOrderFillEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinLimitOrderFillEntry(entry.TxnHash, entry.FillIndex)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteDAOCoinLimitOrderFillEntryWithTxn: problem deleting DAOCoinLimitOrderFillEntry: ")
+	}
+	for _, indexKey := range _dbIndexKeysForDAOCoinLimitOrderFillEntry(entry) {
+		if err := DBDeleteWithTxn(txn, snap, indexKey, eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(err, "DBDeleteDAOCoinLimitOrderFillEntryWithTxn: problem deleting fill index: ")
+		}
+	}
+	return nil
+}
+
+func _dbIndexKeysForDAOCoinLimitOrderFillEntry(entry *DAOCoinLimitOrderFillEntry) [][]byte {
+	indexKeys := [][]byte{DBKeyForDAOCoinLimitOrderFillByTransactor(entry.TakerPKID, entry)}
+	if !entry.MakerPKID.Eq(entry.TakerPKID) {
+		indexKeys = append(indexKeys, DBKeyForDAOCoinLimitOrderFillByTransactor(entry.MakerPKID, entry))
+	}
+	return append(indexKeys, DBKeyForDAOCoinLimitOrderFillByCoinPair(entry))
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetDAOCoinLimitOrderFillEntry returns the fill, or nil if it doesn't exist.
+func (bav *UtxoView) GetDAOCoinLimitOrderFillEntry(txnHash *BlockHash, fillIndex uint32) (
+	*DAOCoinLimitOrderFillEntry, error) {
+
+	// First check the UtxoView.
+	mapKey := MakeDAOCoinLimitOrderFillMapKey(txnHash, fillIndex)
+	if entry, exists := bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetDAOCoinLimitOrderFillEntry(txnHash, fillIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDAOCoinLimitOrderFillEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the DAOCoinLimitOrderFillEntry from the db in the UtxoView.
+		bav._setDAOCoinLimitOrderFillEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetDAOCoinLimitOrderFillEntriesForTransactor returns every fill in which the PKID was the
+// taker or the maker, most recent first, including the fills in the view.
+func (bav *UtxoView) GetDAOCoinLimitOrderFillEntriesForTransactor(transactorPKID *PKID) (
+	[]*DAOCoinLimitOrderFillEntry, error) {
+
+	dbEntries, err := bav.GetDbAdapter().GetDAOCoinLimitOrderFillsForTransactor(transactorPKID, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDAOCoinLimitOrderFillEntriesForTransactor: ")
+	}
+	return bav._mergeDAOCoinLimitOrderFillEntriesWithView(dbEntries, func(entry *DAOCoinLimitOrderFillEntry) bool {
+		return entry.TakerPKID.Eq(transactorPKID) || entry.MakerPKID.Eq(transactorPKID)
+	}), nil
+}
+
+// GetDAOCoinLimitOrderFillEntriesForCoinPair returns every fill between two coins in either
+// direction, most recent first, including the fills in the view.
+func (bav *UtxoView) GetDAOCoinLimitOrderFillEntriesForCoinPair(coinPKID1 *PKID, coinPKID2 *PKID) (
+	[]*DAOCoinLimitOrderFillEntry, error) {
+
+	dbEntries, err := bav.GetDbAdapter().GetDAOCoinLimitOrderFillsForCoinPair(coinPKID1, coinPKID2, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDAOCoinLimitOrderFillEntriesForCoinPair: ")
+	}
+	lowerPKID, higherPKID := _orderedDAOCoinPair(coinPKID1, coinPKID2)
+	return bav._mergeDAOCoinLimitOrderFillEntriesWithView(dbEntries, func(entry *DAOCoinLimitOrderFillEntry) bool {
+		entryLowerPKID, entryHigherPKID := _orderedDAOCoinPair(
+			entry.BuyingDAOCoinCreatorPKID, entry.SellingDAOCoinCreatorPKID)
+		return entryLowerPKID.Eq(lowerPKID) && entryHigherPKID.Eq(higherPKID)
+	}), nil
+}
+
+func (bav *UtxoView) _mergeDAOCoinLimitOrderFillEntriesWithView(
+	dbEntries []*DAOCoinLimitOrderFillEntry, matchesQuery func(*DAOCoinLimitOrderFillEntry) bool,
+) []*DAOCoinLimitOrderFillEntry {
+
+	// Cache the db entries without overwriting the entries the view has already modified.
+	for _, dbEntry := range dbEntries {
+		if _, exists := bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry[dbEntry.ToMapKey()]; !exists {
+			bav._setDAOCoinLimitOrderFillEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*DAOCoinLimitOrderFillEntry
+	for _, entry := range bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry {
+		if entry.isDeleted || !matchesQuery(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	_sortDAOCoinLimitOrderFillEntries(entries)
+	return entries
+}
+
+func (bav *UtxoView) _setDAOCoinLimitOrderFillEntryMappings(entry *DAOCoinLimitOrderFillEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setDAOCoinLimitOrderFillEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteDAOCoinLimitOrderFillEntryMappings(entry *DAOCoinLimitOrderFillEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteDAOCoinLimitOrderFillEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setDAOCoinLimitOrderFillEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushDAOCoinLimitOrderFillEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.DAOCoinLimitOrderFillMapKeyToDAOCoinLimitOrderFillEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushDAOCoinLimitOrderFillEntriesToDbWithTxn: DAOCoinLimitOrderFillEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(), mapKey,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteDAOCoinLimitOrderFillEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDAOCoinLimitOrderFillEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutDAOCoinLimitOrderFillEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDAOCoinLimitOrderFillEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+// _deleteDAOCoinLimitOrderFillEntriesForTxn deletes the fills a DAOCoinLimitOrder txn
+// recorded when it's disconnected. The txn's FilledDAOCoinLimitOrders hold the taker's
+// and the maker's side of each match, so the txn recorded half as many fills.
+func (bav *UtxoView) _deleteDAOCoinLimitOrderFillEntriesForTxn(
+	txnHash *BlockHash, filledOrders []*FilledDAOCoinLimitOrder) error {
+
+	for fillIndex := uint32(0); fillIndex < uint32(len(filledOrders)/2); fillIndex++ {
+		fillEntry, err := bav.GetDAOCoinLimitOrderFillEntry(txnHash, fillIndex)
+		if err != nil {
+			return errors.Wrapf(err, "_deleteDAOCoinLimitOrderFillEntriesForTxn: ")
+		}
+		if fillEntry == nil {
+			return fmt.Errorf("_deleteDAOCoinLimitOrderFillEntriesForTxn: fill %v:%d doesn't exist",
+				txnHash, fillIndex)
+		}
+		bav._deleteDAOCoinLimitOrderFillEntryMappings(fillEntry)
+	}
+	return nil
+}
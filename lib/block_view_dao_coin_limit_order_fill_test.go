@@ -0,0 +1,246 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinLimitOrderFillHistory(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderTradingFeesBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderFillHistoryBlockHeight = uint32(0)
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 100)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+	m3PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m3PkBytes).PKID
+
+	// Charge takers 1% and makers 0.5%, paid to m2.
+	_updateGlobalParamsEntryWithExtraData(testMeta, feeRateNanosPerKb, paramUpdaterPub, paramUpdaterPriv,
+		map[string][]byte{
+			DAOCoinLimitOrderTakerFeeBasisPointsKey:   UintToBuf(100),
+			DAOCoinLimitOrderMakerFeeBasisPointsKey:   UintToBuf(50),
+			DAOCoinLimitOrderFeeRecipientPublicKeyKey: m2PkBytes,
+		})
+
+	// Create a profile for m0, mint some of its DAO coins, and give some of them to m3.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1e6),
+	})
+	_daoCoinTransferTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinTransferMetadata{
+		ProfilePublicKey:       m0PkBytes,
+		DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(1e5),
+		ReceiverPublicKey:      m3PkBytes,
+	})
+
+	// m0 asks to sell 100000 DAO coin base units for 10000 $DESO nanos, and m3 asks to sell
+	// the same amount for 5000 $DESO nanos. Resting orders don't record any fills.
+	askPrice, err := CalculateScaledExchangeRateFromString("10")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+		SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: askPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+	})
+	m0OrderID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	cheaperAskPrice, err := CalculateScaledExchangeRateFromString("20")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m3Pub, m3Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+		SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: cheaperAskPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+	})
+	m3OrderID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	fills, err := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil).
+		GetDAOCoinLimitOrderFillEntriesForCoinPair(m0PKID, &ZeroPKID)
+	require.NoError(err)
+	require.Empty(fills)
+
+	// m1 takes both asks, m3's cheaper one first.
+	bidPrice, err := CalculateScaledExchangeRateFromString("0.1")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: bidPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(2e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeFillOrKill,
+	})
+	m1Txn := testMeta.txns[len(testMeta.txns)-1]
+	m1TxnOps := testMeta.txnOps[len(testMeta.txnOps)-1]
+	m1TxnHeight := uint64(chain.blockTip().Height) + 1
+
+	// The txn records one fill per match, in the order it matched. m1 pays 1% of the DAO
+	// coins it buys and each maker pays 0.5% of the $DESO it receives.
+	requireFill := func(fill *DAOCoinLimitOrderFillEntry, fillIndex uint32, makerOrderID *BlockHash,
+		makerPKID *PKID, makerPrice *uint256.Int, sold uint64, makerFee uint64) {
+
+		require.NotNil(fill)
+		require.Equal(m1Txn.Hash(), fill.TxnHash)
+		require.Equal(fillIndex, fill.FillIndex)
+		require.Equal(m1TxnHeight, fill.BlockHeight)
+		require.Equal(m1Txn.Hash(), fill.TakerOrderID)
+		require.Equal(makerOrderID, fill.MakerOrderID)
+		require.Equal(m1PKID, fill.TakerPKID)
+		require.Equal(makerPKID, fill.MakerPKID)
+		require.Equal(m0PKID, fill.BuyingDAOCoinCreatorPKID)
+		require.Equal(&ZeroPKID, fill.SellingDAOCoinCreatorPKID)
+		require.Equal(makerPrice, fill.MakerScaledExchangeRateCoinsToSellPerCoinToBuy)
+		require.Equal(uint64(1e5), fill.CoinQuantityInBaseUnitsBought.Uint64())
+		require.Equal(sold, fill.CoinQuantityInBaseUnitsSold.Uint64())
+		require.Equal(uint64(1000), fill.TakerFeeInBaseUnits.Uint64())
+		require.Equal(makerFee, fill.MakerFeeInBaseUnits.Uint64())
+	}
+	// Fills are returned most recent first, so the later match comes first.
+	requireFills := func(fills []*DAOCoinLimitOrderFillEntry) {
+		require.Len(fills, 2)
+		requireFill(fills[0], 1, m0OrderID, m0PKID, askPrice, 1e4, 50)
+		requireFill(fills[1], 0, m3OrderID, m3PKID, cheaperAskPrice, 5000, 25)
+	}
+
+	// The view reads the fills from the db by transactor and by coin pair, in either order.
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	fill, err := utxoView.GetDAOCoinLimitOrderFillEntry(m1Txn.Hash(), 0)
+	require.NoError(err)
+	requireFill(fill, 0, m3OrderID, m3PKID, cheaperAskPrice, 5000, 25)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForTransactor(m1PKID)
+	require.NoError(err)
+	requireFills(fills)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForCoinPair(m0PKID, &ZeroPKID)
+	require.NoError(err)
+	requireFills(fills)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForCoinPair(&ZeroPKID, m0PKID)
+	require.NoError(err)
+	requireFills(fills)
+
+	// Each maker only sees its own fill, and the fee recipient and other pairs see none.
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForTransactor(m0PKID)
+	require.NoError(err)
+	require.Len(fills, 1)
+	requireFill(fills[0], 1, m0OrderID, m0PKID, askPrice, 1e4, 50)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForTransactor(m3PKID)
+	require.NoError(err)
+	require.Len(fills, 1)
+	requireFill(fills[0], 0, m3OrderID, m3PKID, cheaperAskPrice, 5000, 25)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForTransactor(m2PKID)
+	require.NoError(err)
+	require.Empty(fills)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForCoinPair(m3PKID, &ZeroPKID)
+	require.NoError(err)
+	require.Empty(fills)
+
+	// The DbAdapter getters return the same fills and respect the limit.
+	dbAdapter := chain.NewDbAdapter()
+	fills, err = dbAdapter.GetDAOCoinLimitOrderFillsForTransactor(m1PKID, 0)
+	require.NoError(err)
+	requireFills(fills)
+	fills, err = dbAdapter.GetDAOCoinLimitOrderFillsForTransactor(m1PKID, 1)
+	require.NoError(err)
+	require.Len(fills, 1)
+	requireFill(fills[0], 1, m0OrderID, m0PKID, askPrice, 1e4, 50)
+	fills, err = dbAdapter.GetDAOCoinLimitOrderFillsForCoinPair(&ZeroPKID, m0PKID, 0)
+	require.NoError(err)
+	requireFills(fills)
+
+	// Disconnecting m1's txn deletes its fills from the view, and the view no longer returns
+	// them even though they're still in the db.
+	utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	require.NoError(utxoView.DisconnectTransaction(m1Txn, m1Txn.Hash(), m1TxnOps, uint32(m1TxnHeight)))
+	fill, err = utxoView.GetDAOCoinLimitOrderFillEntry(m1Txn.Hash(), 0)
+	require.NoError(err)
+	require.Nil(fill)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForTransactor(m1PKID)
+	require.NoError(err)
+	require.Empty(fills)
+	fills, err = utxoView.GetDAOCoinLimitOrderFillEntriesForCoinPair(m0PKID, &ZeroPKID)
+	require.NoError(err)
+	require.Empty(fills)
+	fills, err = dbAdapter.GetDAOCoinLimitOrderFillsForTransactor(m1PKID, 0)
+	require.NoError(err)
+	requireFills(fills)
+
+	// Rolling back every txn and flushing removes the fills and their indexes from the db.
+	_executeAllTestRollbackAndFlush(testMeta)
+	for _, pkid := range []*PKID{m0PKID, m1PKID, m3PKID} {
+		fills, err = dbAdapter.GetDAOCoinLimitOrderFillsForTransactor(pkid, 0)
+		require.NoError(err)
+		require.Empty(fills)
+	}
+	fills, err = dbAdapter.GetDAOCoinLimitOrderFillsForCoinPair(m0PKID, &ZeroPKID, 0)
+	require.NoError(err)
+	require.Empty(fills)
+	fill, err = dbAdapter.GetDAOCoinLimitOrderFillEntry(m1Txn.Hash(), 0)
+	require.NoError(err)
+	require.Nil(fill)
+}
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -5,6 +7,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"sort"
 	"testing"
 	"time"
 
@@ -1067,7 +1070,7 @@ func TestDAOCoinLimitOrder(t *testing.T) {
 
 		// Confirm 1 matching limit orders exists.
 		orderEntryM1 := metadataM1.ToEntry(m1PKID.PKID, savedHeight, toPKID)
-		orderEntries, err = dbAdapter.GetMatchingDAOCoinLimitOrders(orderEntryM1, nil, nil)
+		orderEntries, err = dbAdapter.GetMatchingDAOCoinLimitOrders(orderEntryM1, nil, nil, nil)
 
 		require.NoError(err)
 		require.Equal(len(orderEntries), 1)
@@ -1177,7 +1180,7 @@ func TestDAOCoinLimitOrder(t *testing.T) {
 
 		// Confirm matching limit orders exist.
 		orderEntries, err = dbAdapter.GetMatchingDAOCoinLimitOrders(
-			metadataM0.ToEntry(m0PKID.PKID, savedHeight, toPKID), nil, nil)
+			metadataM0.ToEntry(m0PKID.PKID, savedHeight, toPKID), nil, nil, nil)
 
 		require.NoError(err)
 		require.Equal(len(orderEntries), 3)
@@ -2291,7 +2294,7 @@ func TestDAOCoinLimitOrder(t *testing.T) {
 
 		// Confirm would match to m0.
 		orderEntries, err = dbAdapter.GetMatchingDAOCoinLimitOrders(
-			metadataM1.ToEntry(m1PKID.PKID, savedHeight, toPKID), nil, nil)
+			metadataM1.ToEntry(m1PKID.PKID, savedHeight, toPKID), nil, nil, nil)
 		require.NoError(err)
 		require.Equal(len(orderEntries), 1)
 
@@ -4252,6 +4255,10 @@ func (txnData *DAOCoinLimitOrderMetadata) ToEntry(
 		OperationType:                             txnData.OperationType,
 		FillType:                                  txnData.FillType,
 		BlockHeight:                               blockHeight,
+		ExpirationBlockHeight:                     txnData.ExpirationBlockHeight,
+		StopTriggerScaledPrice:                    txnData.StopTriggerScaledPrice,
+		MinQuantityToFillInBaseUnits:              txnData.MinQuantityToFillInBaseUnits,
+		QuantityDenomination:                      txnData.QuantityDenomination,
 	}
 }
 
@@ -4463,3 +4470,1219 @@ func TestFlushingDAOCoinLimitOrders(t *testing.T) {
 		require.Equal(t, orderEntries[0].QuantityToFillInBaseUnits.Uint64(), uint64(200))
 	}
 }
+
+func TestDAOCoinLimitOrderExpiration(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.DAOCoinLimitOrderExpirationBlockHeight = 1000
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+
+	metadata := &DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt().SetUint64(1),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		FeeNanos:                                  1000,
+	}
+
+	// Orders without an expiration keep their original encoding.
+	unexpiringBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+
+	// Orders with an expiration round-trip.
+	metadata.ExpirationBlockHeight = 1100
+	expiringBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	require.Len(expiringBytes, len(unexpiringBytes)+len(UintToBuf(1100)))
+	decodedMetadata := &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(expiringBytes))
+	require.Equal(uint32(1100), decodedMetadata.ExpirationBlockHeight)
+
+	// An explicit zero expiration is rejected since it wouldn't round-trip.
+	require.Error(decodedMetadata.FromBytes(append(unexpiringBytes, UintToBuf(0)...)))
+
+	// The entry only encodes the expiration after the migration.
+	order := &DAOCoinLimitOrderEntry{
+		OrderID:                   NewBlockHash(uint256.NewInt().SetUint64(1).Bytes()),
+		TransactorPKID:            NewPKID(m1PkBytes),
+		BuyingDAOCoinCreatorPKID:  NewPKID(m0PkBytes),
+		SellingDAOCoinCreatorPKID: &ZeroPKID,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt().SetUint64(1),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		BlockHeight:                               1000,
+		ExpirationBlockHeight:                     1100,
+	}
+	decodedOrder := &DAOCoinLimitOrderEntry{}
+	_, err = DecodeFromBytes(decodedOrder, bytes.NewReader(EncodeToBytes(1000, order)))
+	require.NoError(err)
+	require.Equal(order, decodedOrder)
+	decodedOrder = &DAOCoinLimitOrderEntry{}
+	_, err = DecodeFromBytes(decodedOrder, bytes.NewReader(EncodeToBytes(999, order)))
+	require.NoError(err)
+	require.Zero(decodedOrder.ExpirationBlockHeight)
+
+	// Orders expire once their ExpirationBlockHeight is reached.
+	require.False(order.IsExpired(1099))
+	require.True(order.IsExpired(1100))
+	unexpiringOrder := order.Copy()
+	unexpiringOrder.OrderID = NewBlockHash(uint256.NewInt().SetUint64(2).Bytes())
+	unexpiringOrder.ExpirationBlockHeight = 0
+	require.False(unexpiringOrder.IsExpired(math.MaxUint32))
+	require.Len(FilterExpiredDAOCoinLimitOrders([]*DAOCoinLimitOrderEntry{order, unexpiringOrder}, 1099), 2)
+	require.Len(FilterExpiredDAOCoinLimitOrders([]*DAOCoinLimitOrderEntry{order, unexpiringOrder}, 1100), 1)
+
+	// The matching order scan skips expired orders.
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		if err := DBPutDAOCoinLimitOrderWithTxn(txn, nil, order, 1000, nil); err != nil {
+			return err
+		}
+		return DBPutDAOCoinLimitOrderWithTxn(txn, nil, unexpiringOrder, 1000, nil)
+	}))
+	transactorOrder := &DAOCoinLimitOrderEntry{
+		OrderID:                   NewBlockHash(uint256.NewInt().SetUint64(3).Bytes()),
+		TransactorPKID:            NewPKID(m2PkBytes),
+		BuyingDAOCoinCreatorPKID:  &ZeroPKID,
+		SellingDAOCoinCreatorPKID: NewPKID(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt().SetUint64(0),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1000),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeImmediateOrCancel,
+	}
+	getMatchingOrders := func(blockHeight uint32) []*DAOCoinLimitOrderEntry {
+		transactorOrder.BlockHeight = blockHeight
+		var matchingOrders []*DAOCoinLimitOrderEntry
+		require.NoError(db.View(func(txn *badger.Txn) error {
+			var err error
+			matchingOrders, err = DBGetMatchingDAOCoinLimitOrders(txn, transactorOrder, nil, nil, nil)
+			return err
+		}))
+		return matchingOrders
+	}
+	require.Len(getMatchingOrders(1099), 2)
+	matchingOrders := getMatchingOrders(1100)
+	require.Len(matchingOrders, 1)
+	require.Equal(unexpiringOrder.OrderID, matchingOrders[0].OrderID)
+}
+
+func TestDAOCoinLimitOrderMaxSlippage(t *testing.T) {
+	require := require.New(t)
+
+	metadata := &DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeFillOrKill,
+		FeeNanos:                                  1000,
+	}
+
+	// Setting MaxSlippageScaledPrice without ExpirationBlockHeight encodes a zero
+	// expiration before it, and both round-trip.
+	metadata.MaxSlippageScaledPrice = OneE38.Clone()
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Zero(decodedMetadata.ExpirationBlockHeight)
+	require.True(decodedMetadata.MaxSlippageScaledPrice.Eq(OneE38))
+	reEncodedBytes, err := decodedMetadata.ToBytes(false)
+	require.NoError(err)
+	require.Equal(metadataBytes, reEncodedBytes)
+
+	// A market order buying a DAO coin with DESO at a max of 2 DESO per coin accepts
+	// asks at 2 DESO per coin or better, which are asks for 0.5 coins per DESO or more.
+	transactorOrder := &DAOCoinLimitOrderEntry{
+		BuyingDAOCoinCreatorPKID:                  NewPKID(m0PkBytes),
+		SellingDAOCoinCreatorPKID:                 &ZeroPKID,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt(),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeFillOrKill,
+	}
+	maxSlippageScaledPrice, err := CalculateScaledExchangeRateFromString("2")
+	require.NoError(err)
+	newAsk := func(price string) *DAOCoinLimitOrderEntry {
+		scaledPrice, err := CalculateScaledExchangeRateFromString(price)
+		require.NoError(err)
+		return &DAOCoinLimitOrderEntry{
+			BuyingDAOCoinCreatorPKID:                  &ZeroPKID,
+			SellingDAOCoinCreatorPKID:                 NewPKID(m0PkBytes),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice,
+			OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		}
+	}
+	require.True(IsWithinMaxSlippage(nil, transactorOrder, newAsk("0.01")))
+	require.True(IsWithinMaxSlippage(maxSlippageScaledPrice, transactorOrder, newAsk("1")))
+	require.True(IsWithinMaxSlippage(maxSlippageScaledPrice, transactorOrder, newAsk("0.5")))
+	require.False(IsWithinMaxSlippage(maxSlippageScaledPrice, transactorOrder, newAsk("0.25")))
+}
+
+func TestDAOCoinLimitOrderMaxSlippageFills(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderMaxSlippageBlockHeight = math.MaxUint32
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 100)
+
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+	_updateGlobalParamsEntryWithTestMeta(
+		testMeta, feeRateNanosPerKb, paramUpdaterPub,
+		paramUpdaterPriv, -1, int64(feeRateNanosPerKb), -1, -1, -1,
+	)
+
+	// Create a profile for m0 and mint some of its DAO coins.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1e6),
+	})
+
+	// m0 asks to sell 100 DAO coin base units @ 0.1 $DESO / DAO coin and another
+	// 100 @ 0.2 $DESO / DAO coin.
+	newAsk := func(price string) DAOCoinLimitOrderMetadata {
+		scaledPrice, err := CalculateScaledExchangeRateFromString(price)
+		require.NoError(err)
+		return DAOCoinLimitOrderMetadata{
+			BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+			SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice,
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+			OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		}
+	}
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, newAsk("10"))
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, newAsk("5"))
+
+	// m1 places market bids for 200 DAO coin base units.
+	newMarketBid := func(fillType DAOCoinLimitOrderFillType, maxSlippagePrice string) DAOCoinLimitOrderMetadata {
+		maxSlippageScaledPrice, err := CalculateScaledExchangeRateFromString(maxSlippagePrice)
+		require.NoError(err)
+		return DAOCoinLimitOrderMetadata{
+			BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+			SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt(),
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(200),
+			OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+			FillType:                                  fillType,
+			MaxSlippageScaledPrice:                    maxSlippageScaledPrice,
+		}
+	}
+	requireM1Coins := func(expectedBaseUnits uint64) {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		balanceEntry, _, _ := utxoView.GetBalanceEntryForHODLerPubKeyAndCreatorPubKey(m1PkBytes, m0PkBytes, true)
+		if expectedBaseUnits == 0 {
+			require.True(balanceEntry == nil || balanceEntry.BalanceNanos.IsZero())
+			return
+		}
+		require.Equal(expectedBaseUnits, balanceEntry.BalanceNanos.Uint64())
+	}
+	requireAsks := func(expectedQuantities ...uint64) {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		orderEntries, err := utxoView.GetDbAdapter().GetAllDAOCoinLimitOrders()
+		require.NoError(err)
+		require.Len(orderEntries, len(expectedQuantities))
+		sort.Slice(orderEntries, func(ii, jj int) bool {
+			return orderEntries[ii].IsBetterMatchingOrderThan(orderEntries[jj])
+		})
+		for ii, orderEntry := range orderEntries {
+			require.Equal(DAOCoinLimitOrderOperationTypeASK, orderEntry.OperationType)
+			require.Equal(expectedQuantities[ii], orderEntry.QuantityToFillInBaseUnits.Uint64())
+		}
+	}
+
+	// A max slippage price can't be set before its fork.
+	_, _, _, err = _doDAOCoinLimitOrderTxn(t, chain, db, params, feeRateNanosPerKb, m1Pub, m1Priv,
+		newMarketBid(DAOCoinLimitOrderFillTypeImmediateOrCancel, "0.1"))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinLimitOrderMaxSlippageBeforeBlockHeight)
+	params.ForkHeights.DAOCoinLimitOrderMaxSlippageBlockHeight = uint32(0)
+
+	// A FillOrKill bid fails once it reaches an ask past its max slippage price.
+	_, _, _, err = _doDAOCoinLimitOrderTxn(t, chain, db, params, feeRateNanosPerKb, m1Pub, m1Priv,
+		newMarketBid(DAOCoinLimitOrderFillTypeFillOrKill, "0.1"))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinLimitOrderMaxSlippageExceeded)
+	requireM1Coins(0)
+	requireAsks(100, 100)
+
+	// An ImmediateOrCancel bid fills the ask right at its max slippage price and
+	// cancels the rest, leaving the ask past it untouched.
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv,
+		newMarketBid(DAOCoinLimitOrderFillTypeImmediateOrCancel, "0.1"))
+	requireM1Coins(100)
+	requireAsks(100)
+
+	// With a higher max slippage price, the next bid fills the remaining ask.
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv,
+		newMarketBid(DAOCoinLimitOrderFillTypeImmediateOrCancel, "0.2"))
+	requireM1Coins(200)
+	requireAsks()
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func TestDAOCoinLimitOrderPostOnly(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderExpirationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderPostOnlyBlockHeight = math.MaxUint32
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 100)
+
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+	_updateGlobalParamsEntryWithTestMeta(
+		testMeta, feeRateNanosPerKb, paramUpdaterPub,
+		paramUpdaterPriv, -1, int64(feeRateNanosPerKb), -1, -1, -1,
+	)
+
+	// Create a profile for m0 and mint some of its DAO coins.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1e6),
+	})
+
+	newAsk := func(price string, fillType DAOCoinLimitOrderFillType) DAOCoinLimitOrderMetadata {
+		scaledPrice, err := CalculateScaledExchangeRateFromString(price)
+		require.NoError(err)
+		return DAOCoinLimitOrderMetadata{
+			BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+			SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice,
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+			OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+			FillType:                                  fillType,
+		}
+	}
+	newBid := func(price string, fillType DAOCoinLimitOrderFillType) DAOCoinLimitOrderMetadata {
+		scaledPrice, err := CalculateScaledExchangeRateFromString(price)
+		require.NoError(err)
+		return DAOCoinLimitOrderMetadata{
+			BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+			SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice,
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+			OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+			FillType:                                  fillType,
+		}
+	}
+	getOrders := func(transactorPkBytes []byte) []*DAOCoinLimitOrderEntry {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		orderEntries, err := utxoView.GetAllDAOCoinLimitOrdersForThisTransactor(NewPKID(transactorPkBytes), nil, nil)
+		require.NoError(err)
+		return orderEntries
+	}
+	requireError := func(transactorPub string, transactorPriv string, metadata DAOCoinLimitOrderMetadata, ruleError RuleError) {
+		_, _, _, err := _doDAOCoinLimitOrderTxn(t, chain, db, params, feeRateNanosPerKb, transactorPub, transactorPriv, metadata)
+		require.Error(err)
+		require.Contains(err.Error(), ruleError)
+	}
+
+	// PostOnly orders can't be placed before their fork.
+	requireError(m1Pub, m1Priv, newBid("0.05", DAOCoinLimitOrderFillTypePostOnly),
+		RuleErrorDAOCoinLimitOrderPostOnlyBeforeBlockHeight)
+	params.ForkHeights.DAOCoinLimitOrderPostOnlyBlockHeight = uint32(0)
+
+	// m0 asks to sell 100 DAO coin base units @ 0.1 $DESO / DAO coin.
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv,
+		newAsk("10", DAOCoinLimitOrderFillTypeGoodTillCancelled))
+	require.Len(getOrders(m0PkBytes), 1)
+
+	// A PostOnly bid that would fill against the ask fails, even if only part of it would.
+	requireError(m1Pub, m1Priv, newBid("0.1", DAOCoinLimitOrderFillTypePostOnly),
+		RuleErrorDAOCoinLimitOrderPostOnlyWouldCross)
+	partialCrossingBid := newBid("0.1", DAOCoinLimitOrderFillTypePostOnly)
+	partialCrossingBid.QuantityToFillInBaseUnits = uint256.NewInt().SetUint64(200)
+	requireError(m1Pub, m1Priv, partialCrossingBid, RuleErrorDAOCoinLimitOrderPostOnlyWouldCross)
+	require.Empty(getOrders(m1PkBytes))
+
+	// A PostOnly bid below the ask rests in the book, and it can expire like a
+	// GoodTillCancelled order.
+	expirationBlockHeight := chain.blockTip().Height + 100
+	restingBid := newBid("0.05", DAOCoinLimitOrderFillTypePostOnly)
+	restingBid.ExpirationBlockHeight = expirationBlockHeight
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv, restingBid)
+	m1Orders := getOrders(m1PkBytes)
+	require.Len(m1Orders, 1)
+	require.Equal(DAOCoinLimitOrderFillTypePostOnly, m1Orders[0].FillType)
+	require.Equal(expirationBlockHeight, m1Orders[0].ExpirationBlockHeight)
+	require.Equal(uint64(100), m1Orders[0].QuantityToFillInBaseUnits.Uint64())
+
+	// Orders that don't rest in the book still can't expire.
+	expiringIOCBid := newBid("0.05", DAOCoinLimitOrderFillTypeImmediateOrCancel)
+	expiringIOCBid.ExpirationBlockHeight = expirationBlockHeight
+	requireError(m1Pub, m1Priv, expiringIOCBid, RuleErrorDAOCoinLimitOrderExpirationRequiresGoodTillCancelled)
+
+	// A PostOnly ask that would fill against m1's bid fails too.
+	requireError(m0Pub, m0Priv, newAsk("20", DAOCoinLimitOrderFillTypePostOnly),
+		RuleErrorDAOCoinLimitOrderPostOnlyWouldCross)
+
+	// Once resting, the PostOnly bid is filled as a maker like any other order.
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv,
+		newAsk("20", DAOCoinLimitOrderFillTypeImmediateOrCancel))
+	require.Empty(getOrders(m1PkBytes))
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	balanceEntry, _, _ := utxoView.GetBalanceEntryForHODLerPubKeyAndCreatorPubKey(m1PkBytes, m0PkBytes, true)
+	require.Equal(uint64(100), balanceEntry.BalanceNanos.Uint64())
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func TestDAOCoinLimitOrderMinFillQuantity(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderMinFillQuantityBlockHeight = uint32(0)
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 100)
+
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+	_updateGlobalParamsEntryWithTestMeta(
+		testMeta, feeRateNanosPerKb, paramUpdaterPub,
+		paramUpdaterPriv, -1, int64(feeRateNanosPerKb), -1, -1, -1,
+	)
+
+	// Create a profile for m0 and mint some of its DAO coins.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1e6),
+	})
+
+	askPrice, err := CalculateScaledExchangeRateFromString("10")
+	require.NoError(err)
+	bidPrice, err := CalculateScaledExchangeRateFromString("0.1")
+	require.NoError(err)
+	newBid := func(quantity uint64) DAOCoinLimitOrderMetadata {
+		return DAOCoinLimitOrderMetadata{
+			BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+			SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: bidPrice.Clone(),
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(quantity),
+			OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		}
+	}
+
+	// m0 asks to sell 1000 DAO coin base units for $DESO, at least 500 per match.
+	askMetadata := DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+		SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: askPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1000),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		MinQuantityToFillInBaseUnits:              uint256.NewInt().SetUint64(1001),
+	}
+
+	// The minimum can't exceed the order's quantity.
+	_, _, _, err = _doDAOCoinLimitOrderTxn(t, chain, db, params, feeRateNanosPerKb, m0Pub, m0Priv, askMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinLimitOrderInvalidMinQuantityToFill)
+
+	askMetadata.MinQuantityToFillInBaseUnits = uint256.NewInt().SetUint64(500)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, askMetadata)
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	orderEntries, err := utxoView.GetDbAdapter().GetAllDAOCoinLimitOrders()
+	require.NoError(err)
+	require.Len(orderEntries, 1)
+	askOrderID := orderEntries[0].OrderID
+	require.True(orderEntries[0].MinQuantityToFillInBaseUnits.Eq(uint256.NewInt().SetUint64(500)))
+
+	// A bid for 100 base units would be a dust fill for m0, so it rests in the book.
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv, newBid(100))
+	utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	orderEntries, err = utxoView.GetDbAdapter().GetAllDAOCoinLimitOrders()
+	require.NoError(err)
+	require.Len(orderEntries, 2)
+
+	// A bid for 600 base units fills, leaving 400 on m0's ask.
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m2Pub, m2Priv, newBid(600))
+	utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	askOrder, err := utxoView.GetDAOCoinLimitOrderEntry(askOrderID)
+	require.NoError(err)
+	require.Equal(uint64(400), askOrder.QuantityToFillInBaseUnits.Uint64())
+	orderEntries, err = utxoView.GetDbAdapter().GetAllDAOCoinLimitOrders()
+	require.NoError(err)
+	require.Len(orderEntries, 2)
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func TestDAOCoinLimitOrderQuantityDenomination(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.DAOCoinLimitOrderQuantityDenominationBlockHeight = 1000
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	bidPrice, err := CalculateScaledExchangeRateFromString("0.1")
+	require.NoError(err)
+	askPrice, err := CalculateScaledExchangeRateFromString("10")
+	require.NoError(err)
+
+	// The denomination is encoded as the fifth optional field.
+	metadata := &DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: bidPrice.Clone(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		FeeNanos:                                  1000,
+		QuantityDenomination:                      DAOCoinLimitOrderQuantityDenominationSellingCoin,
+	}
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Nil(decodedMetadata.MinQuantityToFillInBaseUnits)
+	require.Equal(DAOCoinLimitOrderQuantityDenominationSellingCoin, decodedMetadata.QuantityDenomination)
+
+	// m0 bids to spend exactly 100 $DESO nanos on DAO coins @ 0.1 $DESO / DAO coin.
+	m0Order := &DAOCoinLimitOrderEntry{
+		OrderID:                   NewBlockHash(uint256.NewInt().SetUint64(1).Bytes()),
+		TransactorPKID:            m0PKID,
+		BuyingDAOCoinCreatorPKID:  m0PKID,
+		SellingDAOCoinCreatorPKID: &ZeroPKID,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: bidPrice.Clone(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		BlockHeight:                               1000,
+		QuantityDenomination:                      DAOCoinLimitOrderQuantityDenominationSellingCoin,
+	}
+	require.Equal(DAOCoinLimitOrderOperationTypeASK, m0Order.GetQuantityOperationType())
+	baseUnitsToBuy, err := m0Order.BaseUnitsToBuyUint256()
+	require.NoError(err)
+	require.Equal(uint64(1000), baseUnitsToBuy.Uint64())
+	baseUnitsToSell, err := m0Order.BaseUnitsToSellUint256()
+	require.NoError(err)
+	require.Equal(uint64(100), baseUnitsToSell.Uint64())
+
+	// The entry only encodes the denomination after the migration.
+	decodedOrder := &DAOCoinLimitOrderEntry{}
+	_, err = DecodeFromBytes(decodedOrder, bytes.NewReader(EncodeToBytes(1000, m0Order)))
+	require.NoError(err)
+	require.Equal(m0Order, decodedOrder)
+	decodedOrder = &DAOCoinLimitOrderEntry{}
+	_, err = DecodeFromBytes(decodedOrder, bytes.NewReader(EncodeToBytes(999, m0Order)))
+	require.NoError(err)
+	require.Equal(DAOCoinLimitOrderQuantityDenominationDefault, decodedOrder.QuantityDenomination)
+
+	// m1 asks to sell 2000 DAO coin base units @ 10 DAO coins / $DESO.
+	m1Order := &DAOCoinLimitOrderEntry{
+		OrderID:                   NewBlockHash(uint256.NewInt().SetUint64(2).Bytes()),
+		TransactorPKID:            m1PKID,
+		BuyingDAOCoinCreatorPKID:  &ZeroPKID,
+		SellingDAOCoinCreatorPKID: m0PKID,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: askPrice.Clone(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(2000),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		BlockHeight:                               1000,
+	}
+
+	// m0 = transactor, m1 = matching order. m0 spends exactly 100 $DESO nanos.
+	updatedTransactorQuantityToFillInBaseUnits,
+		updatedMatchingQuantityToFillInBaseUnits,
+		transactorBuyingCoinBaseUnitsTransferred,
+		transactorSellingCoinBaseUnitsTransferred,
+		err := _calculateDAOCoinsTransferredInLimitOrderMatch(
+		m1Order, m0Order.GetQuantityOperationType(), m0Order.QuantityToFillInBaseUnits)
+	require.NoError(err)
+	require.Equal(uint256.NewInt(), updatedTransactorQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt().SetUint64(1000), updatedMatchingQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt().SetUint64(1000), transactorBuyingCoinBaseUnitsTransferred)
+	require.Equal(uint256.NewInt().SetUint64(100), transactorSellingCoinBaseUnitsTransferred)
+
+	// m1 = transactor, m0 = matching order. m0's remaining quantity is in $DESO.
+	updatedTransactorQuantityToFillInBaseUnits,
+		updatedMatchingQuantityToFillInBaseUnits,
+		transactorBuyingCoinBaseUnitsTransferred,
+		transactorSellingCoinBaseUnitsTransferred,
+		err = _calculateDAOCoinsTransferredInLimitOrderMatch(
+		m0Order, m1Order.GetQuantityOperationType(), m1Order.QuantityToFillInBaseUnits)
+	require.NoError(err)
+	require.Equal(uint256.NewInt().SetUint64(1000), updatedTransactorQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt(), updatedMatchingQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt().SetUint64(100), transactorBuyingCoinBaseUnitsTransferred)
+	require.Equal(uint256.NewInt().SetUint64(1000), transactorSellingCoinBaseUnitsTransferred)
+
+	// Mixed: m1 asks to receive exactly 50 $DESO nanos and m0 bids for 1000 DAO
+	// coin base units, the default denomination.
+	m1Order.QuantityToFillInBaseUnits = uint256.NewInt().SetUint64(50)
+	m1Order.QuantityDenomination = DAOCoinLimitOrderQuantityDenominationBuyingCoin
+	m0Order.QuantityToFillInBaseUnits = uint256.NewInt().SetUint64(1000)
+	m0Order.QuantityDenomination = DAOCoinLimitOrderQuantityDenominationDefault
+	updatedTransactorQuantityToFillInBaseUnits,
+		updatedMatchingQuantityToFillInBaseUnits,
+		transactorBuyingCoinBaseUnitsTransferred,
+		transactorSellingCoinBaseUnitsTransferred,
+		err = _calculateDAOCoinsTransferredInLimitOrderMatch(
+		m1Order, m0Order.GetQuantityOperationType(), m0Order.QuantityToFillInBaseUnits)
+	require.NoError(err)
+	require.Equal(uint256.NewInt().SetUint64(500), updatedTransactorQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt(), updatedMatchingQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt().SetUint64(500), transactorBuyingCoinBaseUnitsTransferred)
+	require.Equal(uint256.NewInt().SetUint64(50), transactorSellingCoinBaseUnitsTransferred)
+
+	// Both denominated in $DESO: m0 spends exactly 100 $DESO nanos, which covers
+	// the 50 $DESO nanos m1 asks for.
+	m0Order.QuantityToFillInBaseUnits = uint256.NewInt().SetUint64(100)
+	m0Order.QuantityDenomination = DAOCoinLimitOrderQuantityDenominationSellingCoin
+	updatedTransactorQuantityToFillInBaseUnits,
+		updatedMatchingQuantityToFillInBaseUnits,
+		transactorBuyingCoinBaseUnitsTransferred,
+		transactorSellingCoinBaseUnitsTransferred,
+		err = _calculateDAOCoinsTransferredInLimitOrderMatch(
+		m1Order, m0Order.GetQuantityOperationType(), m0Order.QuantityToFillInBaseUnits)
+	require.NoError(err)
+	require.Equal(uint256.NewInt().SetUint64(50), updatedTransactorQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt(), updatedMatchingQuantityToFillInBaseUnits)
+	require.Equal(uint256.NewInt().SetUint64(500), transactorBuyingCoinBaseUnitsTransferred)
+	require.Equal(uint256.NewInt().SetUint64(50), transactorSellingCoinBaseUnitsTransferred)
+}
+
+func TestDAOCoinLimitOrderTradingFees(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderTradingFeesBlockHeight = uint32(0)
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 100)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+
+	// Fees can't be set above the max.
+	_, _, _, err = _updateGlobalParamsEntryWithMempool(
+		t, chain, db, params, feeRateNanosPerKb, paramUpdaterPub, paramUpdaterPriv, -1, -1, -1, -1, -1, -1,
+		map[string][]byte{
+			DAOCoinLimitOrderTakerFeeBasisPointsKey: UintToBuf(MaxDAOCoinLimitOrderFeeBasisPoints + 1),
+		},
+		true, mempool)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinLimitOrderFeeBasisPointsTooHigh)
+
+	// Charge takers 1% and makers 0.5%, paid to m2.
+	_updateGlobalParamsEntryWithExtraData(testMeta, feeRateNanosPerKb, paramUpdaterPub, paramUpdaterPriv,
+		map[string][]byte{
+			DAOCoinLimitOrderTakerFeeBasisPointsKey:   UintToBuf(100),
+			DAOCoinLimitOrderMakerFeeBasisPointsKey:   UintToBuf(50),
+			DAOCoinLimitOrderFeeRecipientPublicKeyKey: m2PkBytes,
+		})
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	m2PKID := utxoView.GetPKIDForPublicKey(m2PkBytes).PKID
+	require.True(utxoView.GetCurrentGlobalParamsEntry().DAOCoinLimitOrderFeeRecipientPKID.Eq(m2PKID))
+
+	// Create a profile for m0 and mint some of its DAO coins.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1e6),
+	})
+
+	// m0 asks to sell 100000 DAO coin base units for 10000 $DESO nanos.
+	askPrice, err := CalculateScaledExchangeRateFromString("10")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+		SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: askPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+	})
+
+	// m1 takes the whole ask. m1 pays a 1000 base unit taker fee out of the DAO coins
+	// they receive, and m0 pays a 50 nano maker fee out of the $DESO it receives.
+	m0DESOBalanceBefore := _getBalance(t, chain, nil, m0Pub)
+	m2DESOBalanceBefore := _getBalance(t, chain, nil, m2Pub)
+	bidPrice, err := CalculateScaledExchangeRateFromString("0.1")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: bidPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeFillOrKill,
+	})
+	require.Equal(m0DESOBalanceBefore+9950, _getBalance(t, chain, nil, m0Pub))
+	require.Equal(m2DESOBalanceBefore+50, _getBalance(t, chain, nil, m2Pub))
+	utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	m1BalanceEntry, _, _ := utxoView.GetBalanceEntryForHODLerPubKeyAndCreatorPubKey(m1PkBytes, m0PkBytes, true)
+	require.Equal(uint64(99000), m1BalanceEntry.BalanceNanos.Uint64())
+	m2BalanceEntry, _, _ := utxoView.GetBalanceEntryForHODLerPubKeyAndCreatorPubKey(m2PkBytes, m0PkBytes, true)
+	require.Equal(uint64(1000), m2BalanceEntry.BalanceNanos.Uint64())
+
+	// The fees are recorded on the filled orders.
+	lastTxnOps := testMeta.txnOps[len(testMeta.txnOps)-1]
+	filledOrders := lastTxnOps[len(lastTxnOps)-1].FilledDAOCoinLimitOrders
+	require.Len(filledOrders, 2)
+	require.Equal(uint64(1000), filledOrders[0].FeeInBaseUnitsPaid.Uint64())
+	require.Equal(uint64(50), filledOrders[1].FeeInBaseUnitsPaid.Uint64())
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func TestDAOCoinLimitOrderCancelAllEncoding(t *testing.T) {
+	require := require.New(t)
+
+	// A cancel-all for a pair only sets the pair and the CancelAll field, and every
+	// earlier optional field is encoded as its zero value.
+	metadata := &DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt(),
+		QuantityToFillInBaseUnits:                 uint256.NewInt(),
+		CancelAll:                                 DAOCoinLimitOrderCancelAllForPair,
+	}
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(DAOCoinLimitOrderCancelAllForPair, decodedMetadata.CancelAll)
+	require.Zero(decodedMetadata.ExpirationBlockHeight)
+	require.Equal(metadata.BuyingDAOCoinCreatorPublicKey, decodedMetadata.BuyingDAOCoinCreatorPublicKey)
+	reEncodedBytes, err := decodedMetadata.ToBytes(false)
+	require.NoError(err)
+	require.Equal(metadataBytes, reEncodedBytes)
+
+	// Metadata without CancelAll encodes exactly as it did before the field existed.
+	metadata.CancelAll = DAOCoinLimitOrderCancelAllNone
+	metadataBytes, err = metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata = &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(DAOCoinLimitOrderCancelAllNone, decodedMetadata.CancelAll)
+}
+
+func TestDAOCoinLimitOrderReplaceEncoding(t *testing.T) {
+	require := require.New(t)
+
+	cancelOrderID := NewBlockHash(RandomBytes(HashSizeBytes))
+	metadata := &DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt().SetUint64(100),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(10),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		CancelOrderID:                             cancelOrderID,
+	}
+
+	// Without ReplaceCancelledOrder, the txn only cancels.
+	require.False(metadata.PlacesOrder())
+
+	// A replace cancels the order and places the new one.
+	metadata.ReplaceCancelledOrder = true
+	require.True(metadata.PlacesOrder())
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.True(decodedMetadata.ReplaceCancelledOrder)
+	require.Equal(cancelOrderID, decodedMetadata.CancelOrderID)
+	require.Equal(DAOCoinLimitOrderCancelAllNone, decodedMetadata.CancelAll)
+	require.True(decodedMetadata.PlacesOrder())
+}
+
+func TestDAOCoinLimitOrderCreatorCoinFlags(t *testing.T) {
+	require := require.New(t)
+
+	// The creator coin flags round-trip through the metadata encoding.
+	metadata := &DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            NewPublicKey(m1PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt().SetUint64(100),
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(10),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		BuyingCoinIsCreatorCoin:                   true,
+	}
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinLimitOrderMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.True(decodedMetadata.BuyingCoinIsCreatorCoin)
+	require.False(decodedMetadata.SellingCoinIsCreatorCoin)
+
+	// An order buying m0's creator coin with m1's DAO coin.
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	order := &DAOCoinLimitOrderEntry{
+		BuyingDAOCoinCreatorPKID:  m0PKID,
+		SellingDAOCoinCreatorPKID: m1PKID,
+		BuyingCoinIsCreatorCoin:   true,
+	}
+	require.True(order.IsCreatorCoinOrder())
+	require.False(order.IsDAOCoin(m0PKID))
+	require.True(order.IsDAOCoin(m1PKID))
+	require.True(order.IsDAOCoin(&ZeroPKID))
+
+	// It's kept in a different order book than the same pair of DAO coins, and
+	// matches against orders with the reversed coin types.
+	daoCoinOrder := &DAOCoinLimitOrderEntry{
+		BuyingDAOCoinCreatorPKID:  m0PKID,
+		SellingDAOCoinCreatorPKID: m1PKID,
+	}
+	require.False(daoCoinOrder.IsCreatorCoinOrder())
+	require.NotEqual(DBPrefixKeyForDAOCoinLimitOrder(order), DBPrefixKeyForDAOCoinLimitOrder(daoCoinOrder))
+	matchingOrder := &DAOCoinLimitOrderEntry{
+		BuyingDAOCoinCreatorPKID:  m1PKID,
+		SellingDAOCoinCreatorPKID: m0PKID,
+		SellingCoinIsCreatorCoin:  true,
+	}
+	require.True(bytes.HasPrefix(
+		DBPrefixKeyForDAOCoinLimitOrder(matchingOrder), Prefixes.PrefixDAOCoinLimitOrderWithCreatorCoins))
+}
+
+func TestGetDAOCoinLimitOrderMakerPKIDs(t *testing.T) {
+	require := require.New(t)
+
+	takerPKID := NewPKID(RandomBytes(33))
+	makerPKID1 := NewPKID(RandomBytes(33))
+	makerPKID2 := NewPKID(RandomBytes(33))
+	fill := func(transactorPKID *PKID, bought uint64, sold uint64) *FilledDAOCoinLimitOrder {
+		return &FilledDAOCoinLimitOrder{
+			TransactorPKID:                transactorPKID,
+			CoinQuantityInBaseUnitsBought: uint256.NewInt().SetUint64(bought),
+			CoinQuantityInBaseUnitsSold:   uint256.NewInt().SetUint64(sold),
+		}
+	}
+
+	// The taker's side of each fill comes first, and each maker is only returned once.
+	filledOrders := []*FilledDAOCoinLimitOrder{
+		fill(takerPKID, 10, 20), fill(makerPKID1, 20, 10),
+		fill(takerPKID, 5, 10), fill(makerPKID2, 10, 5),
+		fill(takerPKID, 1, 2), fill(makerPKID1, 2, 1),
+	}
+	require.Equal([]*PKID{makerPKID1, makerPKID2}, GetDAOCoinLimitOrderMakerPKIDs(filledOrders))
+	require.Empty(GetDAOCoinLimitOrderMakerPKIDs(nil))
+
+	// Prices are in coins sold per coin bought, scaled by 1e38.
+	scaledPrice := ComputeFilledDAOCoinLimitOrderScaledPrice(
+		filledOrders[0].CoinQuantityInBaseUnitsSold, filledOrders[0].CoinQuantityInBaseUnitsBought)
+	require.Equal(uint256.NewInt().Mul(OneE38, uint256.NewInt().SetUint64(2)), scaledPrice)
+	require.Nil(ComputeFilledDAOCoinLimitOrderScaledPrice(uint256.NewInt().SetUint64(1), uint256.NewInt()))
+}
+
+func TestDAOCoinLimitOrderTxindexMetadata(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderTradingFeesBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderTxindexBlockHeight = uint32(0)
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 100)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+
+	// Charge takers 1% and makers 0.5%, paid to m2.
+	_updateGlobalParamsEntryWithExtraData(testMeta, feeRateNanosPerKb, paramUpdaterPub, paramUpdaterPriv,
+		map[string][]byte{
+			DAOCoinLimitOrderTakerFeeBasisPointsKey:   UintToBuf(100),
+			DAOCoinLimitOrderMakerFeeBasisPointsKey:   UintToBuf(50),
+			DAOCoinLimitOrderFeeRecipientPublicKeyKey: m2PkBytes,
+		})
+
+	// Create a profile for m0, mint some of its DAO coins, and give some of them to m3.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1e6),
+	})
+	_daoCoinTransferTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinTransferMetadata{
+		ProfilePublicKey:       m0PkBytes,
+		DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(1e5),
+		ReceiverPublicKey:      m3PkBytes,
+	})
+
+	// m0 asks to sell 100000 DAO coin base units for 10000 $DESO nanos, and m3 asks to sell
+	// the same amount for 5000 $DESO nanos.
+	askPrice, err := CalculateScaledExchangeRateFromString("10")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+		SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: askPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+	})
+	m0OrderID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	cheaperAskPrice, err := CalculateScaledExchangeRateFromString("20")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m3Pub, m3Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             &ZeroPublicKey,
+		SellingDAOCoinCreatorPublicKey:            NewPublicKey(m0PkBytes),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: cheaperAskPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(1e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+	})
+	m3OrderID := testMeta.txns[len(testMeta.txns)-1].Hash()
+
+	// m1 takes both asks, m3's cheaper one first.
+	bidPrice, err := CalculateScaledExchangeRateFromString("0.1")
+	require.NoError(err)
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv, DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: bidPrice,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(2e5),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeFillOrKill,
+	})
+	m1Txn := testMeta.txns[len(testMeta.txns)-1]
+	m1TxnOps := testMeta.txnOps[len(testMeta.txnOps)-1]
+
+	scaledPrice := func(priceStr string) *uint256.Int {
+		price, err := CalculateScaledExchangeRateFromString(priceStr)
+		require.NoError(err)
+		return price
+	}
+	requireFill := func(
+		fill *FilledDAOCoinLimitOrderMetadata, transactorPub string, counterpartyPub string, orderID *BlockHash,
+		isTransactorOrder bool, bought uint64, sold uint64, fee uint64, price *uint256.Int) {
+
+		require.Equal(transactorPub, fill.TransactorPublicKeyBase58Check)
+		require.Equal(counterpartyPub, fill.CounterpartyPublicKeyBase58Check)
+		require.Equal(orderID.String(), fill.OrderIDHex)
+		require.Equal(isTransactorOrder, fill.IsTransactorOrder)
+		require.Equal(bought, fill.CoinQuantityInBaseUnitsBought.Uint64())
+		require.Equal(sold, fill.CoinQuantityInBaseUnitsSold.Uint64())
+		require.Equal(fee, fill.FeeInBaseUnitsPaid.Uint64())
+		require.Equal(price, fill.ScaledPriceCoinsSoldPerCoinBought)
+	}
+	// Each of m1's fills is followed by the maker's side of it. m1 pays 1% of the DAO coins
+	// it buys and each maker pays 0.5% of the $DESO it receives.
+	requireFills := func(fills []*FilledDAOCoinLimitOrderMetadata) {
+		require.Len(fills, 4)
+		requireFill(fills[0], m1Pub, m3Pub, m1Txn.Hash(), true, 1e5, 5000, 1000, scaledPrice("0.05"))
+		requireFill(fills[1], m3Pub, m1Pub, m3OrderID, false, 5000, 1e5, 25, scaledPrice("20"))
+		requireFill(fills[2], m1Pub, m0Pub, m1Txn.Hash(), true, 1e5, 1e4, 1000, scaledPrice("0.1"))
+		requireFill(fills[3], m0Pub, m1Pub, m0OrderID, false, 1e4, 1e5, 50, scaledPrice("10"))
+		for _, fill := range fills {
+			require.Equal(m1Pub == fill.TransactorPublicKeyBase58Check, fill.BuyingDAOCoinCreatorPublicKey == m0Pub)
+		}
+	}
+
+	// The state change metadata and the txindex metadata have the same fills.
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	m1Op := m1TxnOps[len(m1TxnOps)-1]
+	requireFills(utxoView.GetFilledDAOCoinLimitOrdersMetadata(m1Op.FilledDAOCoinLimitOrders))
+	requireFills(m1Op.StateChangeMetadata.(*DAOCoinLimitOrderStateChangeMetadata).FilledDAOCoinLimitOrdersMetadata)
+
+	blockHeight := uint64(chain.blockTip().Height) + 1
+	txnMeta := ComputeTransactionMetadata(
+		m1Txn, utxoView, nil, 0, 0, 0, 0, 0, 0, m1TxnOps, blockHeight)
+	daoCoinLimitOrderMeta := txnMeta.DAOCoinLimitOrderTxindexMetadata
+	requireFills(daoCoinLimitOrderMeta.FilledDAOCoinLimitOrdersMetadata)
+
+	// The totals only count m1's side of the fills.
+	require.Equal(uint64(2e5), daoCoinLimitOrderMeta.CoinQuantityInBaseUnitsBought.Uint64())
+	require.Equal(uint64(15000), daoCoinLimitOrderMeta.CoinQuantityInBaseUnitsSold.Uint64())
+	require.Equal(uint64(2000), daoCoinLimitOrderMeta.FeeInBaseUnitsPaid.Uint64())
+	require.Equal([]string{m3Pub, m0Pub}, daoCoinLimitOrderMeta.CounterpartyPublicKeysBase58Check)
+
+	// The new fields are encoded after the migration, and dropped before it.
+	decodedMeta := &DAOCoinLimitOrderTxindexMetadata{}
+	exists, err := DecodeFromBytes(decodedMeta, bytes.NewReader(EncodeToBytes(blockHeight, daoCoinLimitOrderMeta)))
+	require.NoError(err)
+	require.True(exists)
+	require.Equal(daoCoinLimitOrderMeta.CounterpartyPublicKeysBase58Check, decodedMeta.CounterpartyPublicKeysBase58Check)
+	require.Equal(daoCoinLimitOrderMeta.FeeInBaseUnitsPaid, decodedMeta.FeeInBaseUnitsPaid)
+	requireFills(decodedMeta.FilledDAOCoinLimitOrdersMetadata)
+
+	params.ForkHeights.DAOCoinLimitOrderTxindexBlockHeight = uint32(blockHeight + 1)
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	decodedMeta = &DAOCoinLimitOrderTxindexMetadata{}
+	exists, err = DecodeFromBytes(decodedMeta, bytes.NewReader(EncodeToBytes(blockHeight, daoCoinLimitOrderMeta)))
+	require.NoError(err)
+	require.True(exists)
+	require.Nil(decodedMeta.CoinQuantityInBaseUnitsBought)
+	require.Empty(decodedMeta.CounterpartyPublicKeysBase58Check)
+	require.Len(decodedMeta.FilledDAOCoinLimitOrdersMetadata, 4)
+	require.Empty(decodedMeta.FilledDAOCoinLimitOrdersMetadata[0].CounterpartyPublicKeyBase58Check)
+	params.ForkHeights.DAOCoinLimitOrderTxindexBlockHeight = uint32(0)
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
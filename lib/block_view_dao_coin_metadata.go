@@ -0,0 +1,397 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_view_dao_coin_metadata.go stores the display metadata of each DAO coin, i.e. its
+// icon, description, and links, separately from the creator's profile. Token lists can
+// look the metadata up by the creator's PKID instead of scraping it out of profiles.
+//
+// The metadata is set by a DAOCoin txn with OperationType DAOCoinOperationTypeUpdateMetadata,
+// which carries the new values in its ExtraData under DAOCoinMetadataIconHashKey,
+// DAOCoinMetadataDescriptionKey, and DAOCoinMetadataLinksKey. Each update replaces the
+// entire entry, and an update with no values deletes it. Sizes are bounded, and the txn
+// pays the usual per-KB fee for the bytes it stores.
+
+//
+// TYPES: DAOCoinMetadataEntry
+//
+
+type DAOCoinMetadataEntry struct {
+	// The PKID of the profile that created the DAO coin.
+	CreatorPKID *PKID
+	// A hash or content identifier of the coin's icon.
+	IconHash []byte
+	// A human-readable description of the coin.
+	Description []byte
+	// Links to the coin's website, socials, etc.
+	Links [][]byte
+
+	isDeleted bool
+}
+
+func (entry *DAOCoinMetadataEntry) Copy() *DAOCoinMetadataEntry {
+	links := make([][]byte, 0, len(entry.Links))
+	for _, link := range entry.Links {
+		links = append(links, append([]byte{}, link...))
+	}
+	return &DAOCoinMetadataEntry{
+		CreatorPKID: entry.CreatorPKID.NewPKID(),
+		IconHash:    append([]byte{}, entry.IconHash...),
+		Description: append([]byte{}, entry.Description...),
+		Links:       links,
+		isDeleted:   entry.isDeleted,
+	}
+}
+
+func (entry *DAOCoinMetadataEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.CreatorPKID, skipMetadata...)...)
+	data = append(data, EncodeByteArray(entry.IconHash)...)
+	data = append(data, EncodeByteArray(entry.Description)...)
+	data = append(data, UintToBuf(uint64(len(entry.Links)))...)
+	for _, link := range entry.Links {
+		data = append(data, EncodeByteArray(link)...)
+	}
+	return data
+}
+
+func (entry *DAOCoinMetadataEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// CreatorPKID
+	entry.CreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinMetadataEntry.Decode: Problem reading CreatorPKID: ")
+	}
+
+	// IconHash
+	entry.IconHash, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinMetadataEntry.Decode: Problem reading IconHash: ")
+	}
+
+	// Description
+	entry.Description, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinMetadataEntry.Decode: Problem reading Description: ")
+	}
+
+	// Links
+	numLinks, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinMetadataEntry.Decode: Problem reading len(Links): ")
+	}
+	if numLinks > MaxDAOCoinNumLinks {
+		return fmt.Errorf("DAOCoinMetadataEntry.Decode: Invalid len(Links) %d: Greater than max %d",
+			numLinks, MaxDAOCoinNumLinks)
+	}
+	entry.Links = nil
+	for ii := uint64(0); ii < numLinks; ii++ {
+		link, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinMetadataEntry.Decode: Problem reading Link: ")
+		}
+		entry.Links = append(entry.Links, link)
+	}
+
+	return nil
+}
+
+func (entry *DAOCoinMetadataEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DAOCoinMetadataEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDAOCoinMetadataEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForDAOCoinMetadataEntry(creatorPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinMetadataEntryByCreatorPKID...)
+	key = append(key, creatorPKID.ToBytes()...)
+	return key
+}
+
+func DBGetDAOCoinMetadataEntry(handle *badger.DB, snap *Snapshot, creatorPKID *PKID) (*DAOCoinMetadataEntry, error) {
+	var ret *DAOCoinMetadataEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetDAOCoinMetadataEntryWithTxn(txn, snap, creatorPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetDAOCoinMetadataEntryWithTxn(txn *badger.Txn, snap *Snapshot, creatorPKID *PKID) (*DAOCoinMetadataEntry, error) {
+	// Retrieve DAOCoinMetadataEntry from db.
+	key := DBKeyForDAOCoinMetadataEntry(creatorPKID)
+	entryBytes, err := DBGetWithTxn(txn, snap, key)
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetDAOCoinMetadataEntry: problem retrieving DAOCoinMetadataEntry: ")
+	}
+
+	// Decode DAOCoinMetadataEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&DAOCoinMetadataEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDAOCoinMetadataEntry: problem decoding DAOCoinMetadataEntry: ")
+	}
+	return entry, nil
+}
+
+func DBPutDAOCoinMetadataEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinMetadataEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinMetadataEntry(entry.CreatorPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutDAOCoinMetadataEntryWithTxn: problem storing DAOCoinMetadataEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteDAOCoinMetadataEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinMetadataEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinMetadataEntry(entry.CreatorPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteDAOCoinMetadataEntryWithTxn: problem deleting DAOCoinMetadataEntry: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetDAOCoinMetadataEntry returns the display metadata of the DAO coin created by
+// creatorPKID, or nil if the creator hasn't set any.
+func (bav *UtxoView) GetDAOCoinMetadataEntry(creatorPKID *PKID) (*DAOCoinMetadataEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.DAOCoinCreatorPKIDToDAOCoinMetadataEntry[*creatorPKID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetDAOCoinMetadataEntry(creatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDAOCoinMetadataEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the DAOCoinMetadataEntry from the db in the UtxoView.
+		bav._setDAOCoinMetadataEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+func (bav *UtxoView) _setDAOCoinMetadataEntryMappings(entry *DAOCoinMetadataEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setDAOCoinMetadataEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.DAOCoinCreatorPKIDToDAOCoinMetadataEntry[*entry.CreatorPKID] = entry
+}
+
+func (bav *UtxoView) _deleteDAOCoinMetadataEntryMappings(entry *DAOCoinMetadataEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteDAOCoinMetadataEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setDAOCoinMetadataEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushDAOCoinMetadataEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for creatorPKIDIter, entryIter := range bav.DAOCoinCreatorPKIDToDAOCoinMetadataEntry {
+		// Make a copy of the iterators since we make references to them below.
+		creatorPKID := creatorPKIDIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.CreatorPKID.Eq(&creatorPKID) {
+			return fmt.Errorf(
+				"_flushDAOCoinMetadataEntriesToDbWithTxn: DAOCoinMetadataEntry CreatorPKID %v "+
+					"doesn't match MapKey %v", entry.CreatorPKID, &creatorPKID,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteDAOCoinMetadataEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDAOCoinMetadataEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutDAOCoinMetadataEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDAOCoinMetadataEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// CONNECT LOGIC
+//
+
+// ParseDAOCoinMetadataExtraData builds the DAOCoinMetadataEntry described by a DAOCoin
+// txn's ExtraData and validates its sizes. It returns nil if the ExtraData holds no
+// metadata at all. The entry copies the values so that it doesn't share them with the txn.
+func ParseDAOCoinMetadataExtraData(creatorPKID *PKID, extraData map[string][]byte) (*DAOCoinMetadataEntry, error) {
+	entry := &DAOCoinMetadataEntry{
+		CreatorPKID: creatorPKID.NewPKID(),
+		IconHash:    append([]byte(nil), extraData[DAOCoinMetadataIconHashKey]...),
+		Description: append([]byte(nil), extraData[DAOCoinMetadataDescriptionKey]...),
+	}
+	if len(entry.IconHash) > MaxDAOCoinIconHashLength {
+		return nil, errors.Wrapf(RuleErrorDAOCoinMetadataIconHashTooLong,
+			"ParseDAOCoinMetadataExtraData: IconHash has length %d, max is %d",
+			len(entry.IconHash), MaxDAOCoinIconHashLength)
+	}
+	if len(entry.Description) > MaxDAOCoinDescriptionLength {
+		return nil, errors.Wrapf(RuleErrorDAOCoinMetadataDescriptionTooLong,
+			"ParseDAOCoinMetadataExtraData: Description has length %d, max is %d",
+			len(entry.Description), MaxDAOCoinDescriptionLength)
+	}
+
+	if linksBytes := extraData[DAOCoinMetadataLinksKey]; len(linksBytes) > 0 {
+		links := strings.Split(string(linksBytes), "\n")
+		if len(links) > MaxDAOCoinNumLinks {
+			return nil, errors.Wrapf(RuleErrorDAOCoinMetadataTooManyLinks,
+				"ParseDAOCoinMetadataExtraData: %d links, max is %d", len(links), MaxDAOCoinNumLinks)
+		}
+		for _, link := range links {
+			if len(link) == 0 || len(link) > MaxDAOCoinLinkLength {
+				return nil, errors.Wrapf(RuleErrorDAOCoinMetadataInvalidLink,
+					"ParseDAOCoinMetadataExtraData: Link has length %d, must be between 1 and %d",
+					len(link), MaxDAOCoinLinkLength)
+			}
+			entry.Links = append(entry.Links, []byte(link))
+		}
+	}
+
+	if len(entry.IconHash) == 0 && len(entry.Description) == 0 && len(entry.Links) == 0 {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+func (bav *UtxoView) HelpConnectDAOCoinUpdateMetadata(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	if blockHeight < bav.Params.ForkHeights.DAOCoinMetadataBlockHeight {
+		return 0, 0, nil, RuleErrorDAOCoinMetadataBeforeBlockHeight
+	}
+
+	totalInput, totalOutput, utxoOpsForTxn, creatorProfileEntry, err := bav.HelpConnectDAOCoinInitialization(
+		txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	txMeta := txn.TxnMeta.(*DAOCoinMetadata)
+
+	// Only the profile associated with the DAO coin can update its metadata.
+	if !reflect.DeepEqual(txMeta.ProfilePublicKey, txn.PublicKey) {
+		return 0, 0, nil, RuleErrorOnlyProfileOwnerCanUpdateDAOCoinMetadata
+	}
+
+	creatorPKIDEntry := bav.GetPKIDForPublicKey(txMeta.ProfilePublicKey)
+	if creatorPKIDEntry == nil || creatorPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf(
+			"HelpConnectDAOCoinUpdateMetadata: No PKID found for public key %v; this should never happen",
+			PkToStringBoth(txMeta.ProfilePublicKey))
+	}
+	newEntry, err := ParseDAOCoinMetadataExtraData(creatorPKIDEntry.PKID, txn.ExtraData)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "HelpConnectDAOCoinUpdateMetadata: ")
+	}
+
+	// Save the previous entry so it can be restored on disconnect.
+	var prevEntry *DAOCoinMetadataEntry
+	existingEntry, err := bav.GetDAOCoinMetadataEntry(creatorPKIDEntry.PKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "HelpConnectDAOCoinUpdateMetadata: ")
+	}
+	if existingEntry != nil {
+		prevEntry = existingEntry.Copy()
+		bav._deleteDAOCoinMetadataEntryMappings(existingEntry)
+	}
+	if newEntry != nil {
+		bav._setDAOCoinMetadataEntryMappings(newEntry)
+	}
+
+	// The coin entry itself doesn't change, but disconnect always restores it.
+	prevCoinEntry := creatorProfileEntry.DAOCoinEntry
+
+	// Add state change metadata.
+	stateChangeMetadata := &DAOCoinStateChangeMetadata{
+		CreatorProfileEntry: creatorProfileEntry,
+	}
+
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                     OperationTypeDAOCoin,
+		PrevCoinEntry:            &prevCoinEntry,
+		PrevDAOCoinMetadataEntry: prevEntry,
+		StateChangeMetadata:      stateChangeMetadata,
+	})
+
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+// _disconnectDAOCoinUpdateMetadata restores the metadata entry a
+// DAOCoinOperationTypeUpdateMetadata operation replaced.
+func (bav *UtxoView) _disconnectDAOCoinUpdateMetadata(creatorPKID *PKID, operationData *UtxoOperation) error {
+	currentEntry, err := bav.GetDAOCoinMetadataEntry(creatorPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDAOCoinUpdateMetadata: ")
+	}
+	if currentEntry != nil {
+		bav._deleteDAOCoinMetadataEntryMappings(currentEntry)
+	}
+	if operationData.PrevDAOCoinMetadataEntry != nil {
+		bav._setDAOCoinMetadataEntryMappings(operationData.PrevDAOCoinMetadataEntry.Copy())
+	}
+	return nil
+}
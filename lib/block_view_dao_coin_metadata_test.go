@@ -0,0 +1,170 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinUpdateMetadata(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.DAOCoinBlockHeight = 0
+	params.ForkHeights.DAOCoinMetadataBlockHeight = 0
+	prevGlobalDeSoParams := GlobalDeSoParams
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams = prevGlobalDeSoParams
+	}()
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	// The db has no best chain, so give the view a tip that CopyUtxoView can copy.
+	utxoView.TipHash = &BlockHash{}
+	blockHeight := uint32(10)
+
+	// m0 has a profile and so a DAO coin, and everyone has nanos to pay fees.
+	m0PKID := NewPKID(m0PkBytes)
+	utxoView._setProfileEntryMappings(&ProfileEntry{PublicKey: m0PkBytes, Username: []byte("m0")})
+	for _, publicKey := range [][]byte{m0PkBytes, m1PkBytes} {
+		_, err := utxoView._addBalance(1000, publicKey)
+		require.NoError(err)
+	}
+
+	nextPartialID := uint64(0)
+	makeTxn := func(publicKey []byte, extraData map[string][]byte) *MsgDeSoTxn {
+		nextPartialID++
+		return &MsgDeSoTxn{
+			TxnVersion: DeSoTxnVersion1,
+			TxnMeta: &DAOCoinMetadata{
+				ProfilePublicKey: m0PkBytes,
+				OperationType:    DAOCoinOperationTypeUpdateMetadata,
+			},
+			PublicKey:   publicKey,
+			ExtraData:   extraData,
+			TxnFeeNanos: 10,
+			TxnNonce:    &DeSoNonce{ExpirationBlockHeight: 100, PartialID: nextPartialID},
+		}
+	}
+	makeExtraData := func(iconHash string, description string, links string) map[string][]byte {
+		return map[string][]byte{
+			DAOCoinMetadataIconHashKey:    []byte(iconHash),
+			DAOCoinMetadataDescriptionKey: []byte(description),
+			DAOCoinMetadataLinksKey:       []byte(links),
+		}
+	}
+	connect := func(txn *MsgDeSoTxn) []*UtxoOperation {
+		_, _, utxoOps, err := utxoView._connectDAOCoin(txn, txn.Hash(), blockHeight, false)
+		require.NoError(err)
+		return utxoOps
+	}
+	// A failed connect leaves the view dirty, so it's tried on a copy.
+	requireConnectError := func(view *UtxoView, txn *MsgDeSoTxn, ruleError RuleError) {
+		_, _, _, err := view.CopyUtxoView()._connectDAOCoin(txn, txn.Hash(), blockHeight, false)
+		require.Error(err)
+		require.Contains(err.Error(), ruleError)
+	}
+	disconnect := func(txn *MsgDeSoTxn, utxoOps []*UtxoOperation) {
+		require.NoError(utxoView._disconnectDAOCoin(OperationTypeDAOCoin, txn, txn.Hash(), utxoOps, blockHeight))
+	}
+	requireMetadata := func(view *UtxoView, iconHash string, description string, links ...string) {
+		entry, err := view.GetDAOCoinMetadataEntry(m0PKID)
+		require.NoError(err)
+		require.NotNil(entry)
+		require.Equal(m0PKID, entry.CreatorPKID)
+		require.Equal(iconHash, string(entry.IconHash))
+		require.Equal(description, string(entry.Description))
+		var entryLinks []string
+		for _, link := range entry.Links {
+			entryLinks = append(entryLinks, string(link))
+		}
+		require.Equal(links, entryLinks)
+	}
+	requireNoMetadata := func() {
+		entry, err := utxoView.GetDAOCoinMetadataEntry(m0PKID)
+		require.NoError(err)
+		require.Nil(entry)
+	}
+	requireNoMetadata()
+
+	// Metadata can't be set before the fork height or by anyone but the coin's creator.
+	beforeForkParams := params
+	beforeForkParams.ForkHeights.DAOCoinMetadataBlockHeight = blockHeight + 1
+	beforeForkView := NewUtxoView(db, &beforeForkParams, nil, nil, nil)
+	beforeForkView.TipHash = &BlockHash{}
+	beforeForkView._setProfileEntryMappings(&ProfileEntry{PublicKey: m0PkBytes, Username: []byte("m0")})
+	requireConnectError(beforeForkView, makeTxn(m0PkBytes, makeExtraData("icon", "", "")),
+		RuleErrorDAOCoinMetadataBeforeBlockHeight)
+	requireConnectError(utxoView, makeTxn(m1PkBytes, makeExtraData("icon", "", "")),
+		RuleErrorOnlyProfileOwnerCanUpdateDAOCoinMetadata)
+
+	// Each value has a size limit, and links can't be empty.
+	requireConnectError(utxoView, makeTxn(m0PkBytes, makeExtraData(
+		strings.Repeat("i", MaxDAOCoinIconHashLength+1), "", "")), RuleErrorDAOCoinMetadataIconHashTooLong)
+	requireConnectError(utxoView, makeTxn(m0PkBytes, makeExtraData(
+		"", strings.Repeat("d", MaxDAOCoinDescriptionLength+1), "")), RuleErrorDAOCoinMetadataDescriptionTooLong)
+	tooManyLinks := strings.TrimSuffix(strings.Repeat("link\n", MaxDAOCoinNumLinks+1), "\n")
+	requireConnectError(utxoView, makeTxn(m0PkBytes, makeExtraData("", "", tooManyLinks)),
+		RuleErrorDAOCoinMetadataTooManyLinks)
+	requireConnectError(utxoView, makeTxn(m0PkBytes, makeExtraData("", "", "link1\n\nlink2")),
+		RuleErrorDAOCoinMetadataInvalidLink)
+	requireConnectError(utxoView, makeTxn(m0PkBytes, makeExtraData(
+		"", "", strings.Repeat("l", MaxDAOCoinLinkLength+1))), RuleErrorDAOCoinMetadataInvalidLink)
+	requireNoMetadata()
+
+	// Values right at the limits are fine.
+	maxLinks := strings.TrimSuffix(strings.Repeat(strings.Repeat("l", MaxDAOCoinLinkLength)+"\n", MaxDAOCoinNumLinks), "\n")
+	maxTxn := makeTxn(m0PkBytes, makeExtraData(
+		strings.Repeat("i", MaxDAOCoinIconHashLength), strings.Repeat("d", MaxDAOCoinDescriptionLength), maxLinks))
+	_, _, _, err := utxoView.CopyUtxoView()._connectDAOCoin(maxTxn, maxTxn.Hash(), blockHeight, false)
+	require.NoError(err)
+
+	// m0 sets the metadata. The entry doesn't share its bytes with the txn.
+	setTxn := makeTxn(m0PkBytes, makeExtraData("icon", "description", "link1\nlink2"))
+	setUtxoOps := connect(setTxn)
+	requireMetadata(utxoView, "icon", "description", "link1", "link2")
+	setTxn.ExtraData[DAOCoinMetadataIconHashKey][0] = 'X'
+	setTxn.ExtraData[DAOCoinMetadataDescriptionKey][0] = 'X'
+	requireMetadata(utxoView, "icon", "description", "link1", "link2")
+	setTxn.ExtraData = makeExtraData("icon", "description", "link1\nlink2")
+
+	// An update replaces the whole entry.
+	updateTxn := makeTxn(m0PkBytes, makeExtraData("", "new description", ""))
+	updateUtxoOps := connect(updateTxn)
+	requireMetadata(utxoView, "", "new description")
+
+	// An update with no values deletes the entry.
+	deleteTxn := makeTxn(m0PkBytes, nil)
+	deleteUtxoOps := connect(deleteTxn)
+	requireNoMetadata()
+
+	// Disconnecting each txn restores the entry it replaced.
+	disconnect(deleteTxn, deleteUtxoOps)
+	requireMetadata(utxoView, "", "new description")
+	disconnect(updateTxn, updateUtxoOps)
+	requireMetadata(utxoView, "icon", "description", "link1", "link2")
+	disconnect(setTxn, setUtxoOps)
+	requireNoMetadata()
+
+	// The entry makes it to the db.
+	connect(setTxn)
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+	requireMetadata(NewUtxoView(db, &params, nil, nil, nil), "icon", "description", "link1", "link2")
+	dbEntry, err := DBGetDAOCoinMetadataEntry(db, nil, m0PKID)
+	require.NoError(err)
+	require.Equal("icon", string(dbEntry.IconHash))
+
+	// As does its deletion.
+	connect(makeTxn(m0PkBytes, nil))
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+	dbEntry, err = DBGetDAOCoinMetadataEntry(db, nil, m0PKID)
+	require.NoError(err)
+	require.Nil(dbEntry)
+}
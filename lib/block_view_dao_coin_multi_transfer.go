@@ -0,0 +1,334 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// MaxDAOCoinMultiTransferRecipients caps the number of recipients in a single
+// DAOCoinMultiTransfer txn so that one txn can't touch an unbounded number of
+// balance entries.
+const MaxDAOCoinMultiTransferRecipients = 500
+
+//
+// TYPES: DAOCoinMultiTransferMetadata
+//
+
+// DAOCoinMultiTransferRecipient is a single recipient of a DAOCoinMultiTransfer
+// and the amount of the DAO coin they receive.
+type DAOCoinMultiTransferRecipient struct {
+	ReceiverPublicKey      []byte
+	DAOCoinToTransferNanos uint256.Int
+}
+
+// DAOCoinMultiTransferMetadata transfers the DAO coin of a single profile from the
+// transactor to many recipients at once, e.g. for an airdrop. It follows the same
+// rules as a DAOCoinTransfer to each recipient, but the sender's balance is only
+// debited once.
+type DAOCoinMultiTransferMetadata struct {
+	// ProfilePublicKey is the public key of the profile that owns the DAO coin
+	// being transferred.
+	ProfilePublicKey []byte
+
+	Recipients []*DAOCoinMultiTransferRecipient
+}
+
+func (txnData *DAOCoinMultiTransferMetadata) GetTxnType() TxnType {
+	return TxnTypeDAOCoinMultiTransfer
+}
+
+func (txnData *DAOCoinMultiTransferMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, EncodeByteArray(txnData.ProfilePublicKey)...)
+	data = append(data, UintToBuf(uint64(len(txnData.Recipients)))...)
+	for _, recipient := range txnData.Recipients {
+		data = append(data, EncodeByteArray(recipient.ReceiverPublicKey)...)
+		data = append(data, VariableEncodeUint256(&recipient.DAOCoinToTransferNanos)...)
+	}
+	return data, nil
+}
+
+func (txnData *DAOCoinMultiTransferMetadata) FromBytes(data []byte) error {
+	ret := DAOCoinMultiTransferMetadata{}
+	rr := bytes.NewReader(data)
+
+	// ProfilePublicKey
+	var err error
+	ret.ProfilePublicKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinMultiTransferMetadata.FromBytes: Problem reading ProfilePublicKey: ")
+	}
+
+	// Recipients
+	numRecipients, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinMultiTransferMetadata.FromBytes: Problem reading number of recipients: ")
+	}
+	if numRecipients > MaxDAOCoinMultiTransferRecipients {
+		return fmt.Errorf("DAOCoinMultiTransferMetadata.FromBytes: %d recipients exceeds the max of %d",
+			numRecipients, MaxDAOCoinMultiTransferRecipients)
+	}
+	for ii := uint64(0); ii < numRecipients; ii++ {
+		recipient := &DAOCoinMultiTransferRecipient{}
+		recipient.ReceiverPublicKey, err = DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinMultiTransferMetadata.FromBytes: Problem reading ReceiverPublicKey: ")
+		}
+		amount, err := VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinMultiTransferMetadata.FromBytes: Problem reading DAOCoinToTransferNanos: ")
+		}
+		if amount == nil {
+			return fmt.Errorf("DAOCoinMultiTransferMetadata.FromBytes: DAOCoinToTransferNanos is missing")
+		}
+		recipient.DAOCoinToTransferNanos = *amount
+		ret.Recipients = append(ret.Recipients, recipient)
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *DAOCoinMultiTransferMetadata) New() DeSoTxnMetadata {
+	return &DAOCoinMultiTransferMetadata{}
+}
+
+// GetTotalDAOCoinToTransferNanos returns the sum of the amounts sent to all recipients.
+func (txnData *DAOCoinMultiTransferMetadata) GetTotalDAOCoinToTransferNanos() (*uint256.Int, error) {
+	totalNanos := uint256.NewInt()
+	for _, recipient := range txnData.Recipients {
+		if totalNanos.AddOverflow(totalNanos, &recipient.DAOCoinToTransferNanos) {
+			return nil, RuleErrorDAOCoinMultiTransferTotalOverflow
+		}
+	}
+	return totalNanos, nil
+}
+
+// ValidateDAOCoinMultiTransferMetadata checks the parts of the txn that don't depend on
+// the view: the public keys, the number of recipients, and that every recipient is
+// distinct, isn't the sender, and receives a nonzero amount.
+func ValidateDAOCoinMultiTransferMetadata(txMeta *DAOCoinMultiTransferMetadata, senderPublicKey []byte) error {
+	if len(txMeta.ProfilePublicKey) != btcec.PubKeyBytesLenCompressed {
+		return RuleErrorCoinTransferInvalidProfilePubKeySize
+	}
+	if _, err := btcec.ParsePubKey(txMeta.ProfilePublicKey, btcec.S256()); err != nil {
+		return errors.Wrap(RuleErrorCoinTransferInvalidProfilePubKey, err.Error())
+	}
+	if len(txMeta.Recipients) == 0 || len(txMeta.Recipients) > MaxDAOCoinMultiTransferRecipients {
+		return errors.Wrapf(RuleErrorDAOCoinMultiTransferInvalidNumRecipients,
+			"%d recipients isn't between 1 and %d", len(txMeta.Recipients), MaxDAOCoinMultiTransferRecipients)
+	}
+	seenReceivers := make(map[PublicKey]struct{}, len(txMeta.Recipients))
+	for _, recipient := range txMeta.Recipients {
+		if len(recipient.ReceiverPublicKey) != btcec.PubKeyBytesLenCompressed {
+			return RuleErrorCoinTransferInvalidReceiverPubKeySize
+		}
+		if _, err := btcec.ParsePubKey(recipient.ReceiverPublicKey, btcec.S256()); err != nil {
+			return errors.Wrap(RuleErrorCoinTransferInvalidReceiverPubKey, err.Error())
+		}
+		if reflect.DeepEqual(senderPublicKey, recipient.ReceiverPublicKey) {
+			return RuleErrorCoinTransferCannotTransferToSelf
+		}
+		receiverKey := *NewPublicKey(recipient.ReceiverPublicKey)
+		if _, exists := seenReceivers[receiverKey]; exists {
+			return errors.Wrapf(RuleErrorDAOCoinMultiTransferDuplicateRecipient,
+				"%v", PkToStringBoth(recipient.ReceiverPublicKey))
+		}
+		seenReceivers[receiverKey] = struct{}{}
+		if recipient.DAOCoinToTransferNanos.IsZero() {
+			return errors.Wrapf(RuleErrorDAOCoinMultiTransferZeroAmount,
+				"%v", PkToStringBoth(recipient.ReceiverPublicKey))
+		}
+	}
+	if _, err := txMeta.GetTotalDAOCoinToTransferNanos(); err != nil {
+		return err
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectDAOCoinMultiTransfer(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.DAOCoinMultiTransferBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinMultiTransferBeforeBlockHeight, "_connectDAOCoinMultiTransfer: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeDAOCoinMultiTransfer {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectDAOCoinMultiTransfer: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String())
+	}
+	txMeta := txn.TxnMeta.(*DAOCoinMultiTransferMetadata)
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinMultiTransfer: ")
+	}
+
+	if err = ValidateDAOCoinMultiTransferMetadata(txMeta, txn.PublicKey); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinMultiTransfer: ")
+	}
+
+	// Dig up the profile. It must exist for the user to be able to transfer its coin.
+	profileEntry := bav.GetProfileEntryForPublicKey(txMeta.ProfilePublicKey)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorCoinTransferOnNonexistentProfile,
+			"_connectDAOCoinMultiTransfer: Profile pub key: %v", PkToStringBoth(txMeta.ProfilePublicKey))
+	}
+	creatorPKID := bav.GetPKIDForPublicKey(txMeta.ProfilePublicKey)
+	senderPKID := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if creatorPKID == nil || creatorPKID.isDeleted || senderPKID == nil || senderPKID.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectDAOCoinMultiTransfer: Found nil or deleted PKID for sender or " +
+			"creator, this should never happen")
+	}
+
+	// The sender must hold enough of the coin to cover every recipient.
+	senderBalanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(senderPKID.PKID, creatorPKID.PKID, true)
+	if senderBalanceEntry == nil || senderBalanceEntry.isDeleted {
+		return 0, 0, nil, RuleErrorCoinTransferBalanceEntryDoesNotExist
+	}
+	totalNanos, err := txMeta.GetTotalDAOCoinToTransferNanos()
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinMultiTransfer: ")
+	}
+	if totalNanos.Gt(&senderBalanceEntry.BalanceNanos) {
+		return 0, 0, nil, errors.Wrapf(RuleErrorCoinTransferInsufficientCoins,
+			"_connectDAOCoinMultiTransfer: Coin nanos being transferred %v exceeds user's coin balance %v",
+			totalNanos, &senderBalanceEntry.BalanceNanos)
+	}
+
+	// Every recipient has to satisfy the coin's transfer restrictions.
+	for _, recipient := range txMeta.Recipients {
+		if err = bav.IsValidDAOCoinTransfer(profileEntry, txn.PublicKey, recipient.ReceiverPublicKey); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinMultiTransfer: ")
+		}
+	}
+
+	// Now that we have validated this transaction, build the new balances. The previous
+	// balances are saved so that the txn can be disconnected. A recipient who didn't have a
+	// balance is saved with a zero balance.
+	prevCoinEntry := profileEntry.DAOCoinEntry.Copy()
+	prevBalances := make(map[PKID]map[PKID]*BalanceEntry)
+	savePrevBalance := func(balanceEntry *BalanceEntry) {
+		prevBalances[*balanceEntry.HODLerPKID] = map[PKID]*BalanceEntry{
+			*balanceEntry.CreatorPKID: balanceEntry.Copy(),
+		}
+	}
+
+	// Debit the sender once for the total.
+	savePrevBalance(senderBalanceEntry)
+	newSenderBalanceEntry := senderBalanceEntry.Copy()
+	newSenderBalanceEntry.BalanceNanos = *uint256.NewInt().Sub(&senderBalanceEntry.BalanceNanos, totalNanos)
+	if newSenderBalanceEntry.BalanceNanos.IsZero() {
+		bav._deleteBalanceEntryMappingsWithPKIDs(newSenderBalanceEntry, senderPKID.PKID, creatorPKID.PKID, true)
+		profileEntry.DAOCoinEntry.NumberOfHolders--
+	} else {
+		bav._setDAOCoinBalanceEntryMappings(newSenderBalanceEntry)
+	}
+
+	// Credit each recipient.
+	for _, recipient := range txMeta.Recipients {
+		receiverPKID := bav.GetPKIDForPublicKey(recipient.ReceiverPublicKey)
+		if receiverPKID == nil || receiverPKID.isDeleted {
+			return 0, 0, nil, fmt.Errorf("_connectDAOCoinMultiTransfer: Found nil or deleted PKID for "+
+				"receiver %v, this should never happen", PkToStringBoth(recipient.ReceiverPublicKey))
+		}
+		receiverBalanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(receiverPKID.PKID, creatorPKID.PKID, true)
+		if receiverBalanceEntry == nil || receiverBalanceEntry.isDeleted {
+			receiverBalanceEntry = &BalanceEntry{
+				HODLerPKID:   receiverPKID.PKID.NewPKID(),
+				CreatorPKID:  creatorPKID.PKID.NewPKID(),
+				BalanceNanos: *uint256.NewInt(),
+			}
+		}
+		savePrevBalance(receiverBalanceEntry)
+		if receiverBalanceEntry.BalanceNanos.IsZero() {
+			profileEntry.DAOCoinEntry.NumberOfHolders++
+		}
+		newReceiverBalanceEntry := receiverBalanceEntry.Copy()
+		newReceiverBalanceEntry.BalanceNanos = *uint256.NewInt().Add(
+			&receiverBalanceEntry.BalanceNanos, &recipient.DAOCoinToTransferNanos)
+		bav._setDAOCoinBalanceEntryMappings(newReceiverBalanceEntry)
+	}
+
+	// Update and set the new profile entry.
+	bav._setProfileEntryMappings(profileEntry)
+
+	// Add a UTXO operation.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:               OperationTypeDAOCoinMultiTransfer,
+		PrevCoinEntry:      prevCoinEntry,
+		PrevBalanceEntries: prevBalances,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectDAOCoinMultiTransfer(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.DAOCoinMultiTransferBlockHeight {
+		return errors.Wrapf(RuleErrorDAOCoinMultiTransferBeforeBlockHeight, "_disconnectDAOCoinMultiTransfer: ")
+	}
+
+	// Validate the last operation is a DAOCoinMultiTransfer operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectDAOCoinMultiTransfer: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeDAOCoinMultiTransfer {
+		return fmt.Errorf(
+			"_disconnectDAOCoinMultiTransfer: trying to revert %v but found %v",
+			OperationTypeDAOCoinMultiTransfer,
+			operationData.Type,
+		)
+	}
+	txMeta := currentTxn.TxnMeta.(*DAOCoinMultiTransferMetadata)
+
+	// Revert the balances. A recipient who didn't have a balance before the txn is deleted.
+	for _, creatorPKIDToBalanceEntry := range operationData.PrevBalanceEntries {
+		for _, balanceEntry := range creatorPKIDToBalanceEntry {
+			if balanceEntry.BalanceNanos.IsZero() {
+				bav._deleteBalanceEntryMappingsWithPKIDs(
+					balanceEntry, balanceEntry.HODLerPKID, balanceEntry.CreatorPKID, true)
+			} else {
+				bav._setDAOCoinBalanceEntryMappings(balanceEntry)
+			}
+		}
+	}
+
+	// Revert the coin entry.
+	if operationData.PrevCoinEntry == nil {
+		return fmt.Errorf("_disconnectDAOCoinMultiTransfer: missing the previous coin entry")
+	}
+	profileEntry := bav.GetProfileEntryForPublicKey(txMeta.ProfilePublicKey)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return fmt.Errorf("_disconnectDAOCoinMultiTransfer: profile for public key %v doesn't exist; "+
+			"this should never happen", PkToStringBoth(txMeta.ProfilePublicKey))
+	}
+	profileEntry.DAOCoinEntry = *operationData.PrevCoinEntry
+	bav._setProfileEntryMappings(profileEntry)
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
@@ -0,0 +1,301 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinMultiTransferMetadata(t *testing.T) {
+	require := require.New(t)
+
+	newMetadata := func() *DAOCoinMultiTransferMetadata {
+		return &DAOCoinMultiTransferMetadata{
+			ProfilePublicKey: m0PkBytes,
+			Recipients: []*DAOCoinMultiTransferRecipient{
+				{ReceiverPublicKey: m1PkBytes, DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(100)},
+				{ReceiverPublicKey: m2PkBytes, DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(250)},
+			},
+		}
+	}
+
+	// Round-trip the metadata.
+	metadata := newMetadata()
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinMultiTransferMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(metadata, decodedMetadata)
+
+	totalNanos, err := metadata.GetTotalDAOCoinToTransferNanos()
+	require.NoError(err)
+	require.Equal(uint256.NewInt().SetUint64(350), totalNanos)
+	require.NoError(ValidateDAOCoinMultiTransferMetadata(metadata, m0PkBytes))
+
+	for expectedErr, mutate := range map[RuleError]func(*DAOCoinMultiTransferMetadata){
+		RuleErrorDAOCoinMultiTransferInvalidNumRecipients: func(metadata *DAOCoinMultiTransferMetadata) {
+			metadata.Recipients = nil
+		},
+		RuleErrorDAOCoinMultiTransferDuplicateRecipient: func(metadata *DAOCoinMultiTransferMetadata) {
+			metadata.Recipients[1].ReceiverPublicKey = m1PkBytes
+		},
+		RuleErrorDAOCoinMultiTransferZeroAmount: func(metadata *DAOCoinMultiTransferMetadata) {
+			metadata.Recipients[1].DAOCoinToTransferNanos = *uint256.NewInt()
+		},
+		RuleErrorDAOCoinMultiTransferTotalOverflow: func(metadata *DAOCoinMultiTransferMetadata) {
+			metadata.Recipients[1].DAOCoinToTransferNanos = *MaxUint256.Clone()
+		},
+		RuleErrorCoinTransferCannotTransferToSelf: func(metadata *DAOCoinMultiTransferMetadata) {
+			metadata.Recipients[0].ReceiverPublicKey = m0PkBytes
+		},
+		RuleErrorCoinTransferInvalidReceiverPubKeySize: func(metadata *DAOCoinMultiTransferMetadata) {
+			metadata.Recipients[0].ReceiverPublicKey = []byte{2}
+		},
+	} {
+		metadata := newMetadata()
+		mutate(metadata)
+		err := ValidateDAOCoinMultiTransferMetadata(metadata, m0PkBytes)
+		require.Error(err)
+		require.Contains(err.Error(), string(expectedErr))
+	}
+}
+
+func TestDAOCoinMultiTransferConnectAndDisconnect(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(101)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinMultiTransferBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e4)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+	m3PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m3PkBytes).PKID
+
+	// m0 mints 1000 of its DAO coin and gives 100 of them to m1.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,         /*updaterPkBase58Check*/
+		m0Priv,        /*updaterPrivBase58Check*/
+		[]byte{},      /*profilePubKey*/
+		"m0",          /*newUsername*/
+		"i am the m0", /*newDescription*/
+		shortPic,      /*newProfilePic*/
+		10*100,        /*newCreatorBasisPoints*/
+		1.25*100*100,  /*newStakeMultipleBasisPoints*/
+		false /*isHidden*/)
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1000),
+	})
+	_daoCoinTransferTxnWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, DAOCoinTransferMetadata{
+		ProfilePublicKey:       m0PkBytes,
+		DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(100),
+		ReceiverPublicKey:      m1PkBytes,
+	})
+
+	type coinState struct {
+		balances        []uint64
+		numberOfHolders uint64
+	}
+	// getCoinState returns the balances of m0's DAO coin held by m0, m1, m2 and m3, and its
+	// number of holders. A holder without a balance entry gets back an empty entry.
+	getCoinState := func(utxoView *UtxoView) *coinState {
+		if utxoView == nil {
+			utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		}
+		state := &coinState{
+			numberOfHolders: utxoView.GetProfileEntryForPKID(m0PKID).DAOCoinEntry.NumberOfHolders,
+		}
+		for _, holderPKID := range []*PKID{m0PKID, m1PKID, m2PKID, m3PKID} {
+			balanceEntry := utxoView._getBalanceEntryForHODLerPKIDAndCreatorPKID(holderPKID, m0PKID, true)
+			if balanceEntry == nil || balanceEntry.isDeleted {
+				state.balances = append(state.balances, 0)
+				continue
+			}
+			state.balances = append(state.balances, balanceEntry.BalanceNanos.Uint64())
+		}
+		return state
+	}
+	newRecipient := func(receiverPkBytes []byte, amount uint64) *DAOCoinMultiTransferRecipient {
+		return &DAOCoinMultiTransferRecipient{
+			ReceiverPublicKey:      receiverPkBytes,
+			DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(amount),
+		}
+	}
+	stateBeforeMultiTransfer := getCoinState(nil)
+	require.Equal(&coinState{balances: []uint64{900, 100, 0, 0}, numberOfHolders: 2}, stateBeforeMultiTransfer)
+
+	// m1 sends its whole balance to m0, who already holds the coin, and to m2 and m3, who
+	// don't. m1 stops being a holder, and m2 and m3 become holders.
+	_daoCoinMultiTransferWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv, &DAOCoinMultiTransferMetadata{
+		ProfilePublicKey: m0PkBytes,
+		Recipients: []*DAOCoinMultiTransferRecipient{
+			newRecipient(m0PkBytes, 30),
+			newRecipient(m2PkBytes, 50),
+			newRecipient(m3PkBytes, 20),
+		},
+	})
+	stateAfterMultiTransfer := getCoinState(nil)
+	require.Equal(&coinState{balances: []uint64{930, 0, 50, 20}, numberOfHolders: 3}, stateAfterMultiTransfer)
+
+	// Disconnecting the multi-transfer restores every balance and the number of holders.
+	{
+		lastTxn := testMeta.txns[len(testMeta.txns)-1]
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(
+			lastTxn, lastTxn.Hash(), testMeta.txnOps[len(testMeta.txnOps)-1], testMeta.savedHeight))
+		require.Equal(stateBeforeMultiTransfer, getCoinState(utxoView))
+	}
+
+	// A receiver can't be listed twice.
+	_, _, err := _daoCoinMultiTransfer(t, chain, db, params, feeRateNanosPerKB, m0Pub, m0Priv,
+		&DAOCoinMultiTransferMetadata{
+			ProfilePublicKey: m0PkBytes,
+			Recipients: []*DAOCoinMultiTransferRecipient{
+				newRecipient(m2PkBytes, 10),
+				newRecipient(m3PkBytes, 10),
+				newRecipient(m2PkBytes, 10),
+			},
+		})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinMultiTransferDuplicateRecipient)
+	require.Equal(stateAfterMultiTransfer, getCoinState(nil))
+
+	// The total has to be covered by the sender's balance even though each amount is.
+	_, _, err = _daoCoinMultiTransfer(t, chain, db, params, feeRateNanosPerKB, m2Pub, m2Priv,
+		&DAOCoinMultiTransferMetadata{
+			ProfilePublicKey: m0PkBytes,
+			Recipients: []*DAOCoinMultiTransferRecipient{
+				newRecipient(m1PkBytes, 30),
+				newRecipient(m3PkBytes, 30),
+			},
+		})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinTransferInsufficientCoins)
+	require.Equal(stateAfterMultiTransfer, getCoinState(nil))
+
+	// A sender that's been drained can't send any.
+	_, _, err = _daoCoinMultiTransfer(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv,
+		&DAOCoinMultiTransferMetadata{
+			ProfilePublicKey: m0PkBytes,
+			Recipients:       []*DAOCoinMultiTransferRecipient{newRecipient(m2PkBytes, 1)},
+		})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinTransferInsufficientCoins)
+
+	// m2 sends part of its balance back to m1, who becomes a holder again.
+	_daoCoinMultiTransferWithTestMeta(testMeta, feeRateNanosPerKB, m2Pub, m2Priv, &DAOCoinMultiTransferMetadata{
+		ProfilePublicKey: m0PkBytes,
+		Recipients: []*DAOCoinMultiTransferRecipient{
+			newRecipient(m1PkBytes, 40),
+			newRecipient(m3PkBytes, 5),
+		},
+	})
+	require.Equal(&coinState{balances: []uint64{930, 40, 5, 25}, numberOfHolders: 4}, getCoinState(nil))
+
+	_executeAllTestRollbackAndFlush(testMeta)
+	require.Nil(DBGetProfileEntryForPKID(db, chain.snapshot, m0PKID))
+	for _, holderPKID := range []*PKID{m0PKID, m1PKID, m2PKID, m3PKID} {
+		require.True(DbGetBalanceEntry(db, chain.snapshot, holderPKID, m0PKID, true).BalanceNanos.IsZero())
+	}
+}
+
+//
+// ----- HELPERS
+//
+
+func _daoCoinMultiTransferWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *DAOCoinMultiTransferMetadata,
+) {
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check))
+	currentOps, currentTxn, err := _daoCoinMultiTransfer(
+		testMeta.t, testMeta.chain, testMeta.db, testMeta.params, feeRateNanosPerKB,
+		transactorPublicKeyBase58Check, transactorPrivateKeyBase58Check, metadata)
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+func _daoCoinMultiTransfer(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoParams,
+	feeRateNanosPerKB uint64, transactorPublicKeyBase58Check string, transactorPrivateKeyBase58Check string,
+	metadata *DAOCoinMultiTransferMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+
+	txn, totalInputMake, _, feesMake, err := chain.CreateDAOCoinMultiTransferTxn(
+		transactorPkBytes, metadata, nil, feeRateNanosPerKB, nil, []*DeSoOutput{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(t, txn, transactorPrivateKeyBase58Check)
+
+	// Always use height+1 for validation since it's assumed the transaction will
+	// get mined into the next block.
+	blockHeight := chain.blockTip().Height + 1
+	utxoOps, totalInput, totalOutput, fees, err :=
+		utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	require.Equal(totalInput, totalOutput+fees)
+	require.Equal(totalInputMake, totalInput)
+	require.Equal(feesMake, fees)
+	require.Equal(OperationTypeSpendBalance, utxoOps[0].Type)
+	require.Equal(OperationTypeDAOCoinMultiTransfer, utxoOps[len(utxoOps)-1].Type)
+
+	require.NoError(utxoView.FlushToDb(0))
+
+	return utxoOps, txn, nil
+}
@@ -0,0 +1,862 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_dao_coin_stream.go implements DAO coin streams, which pay a payee a fixed amount
+// of a DAO coin per block, e.g. for payroll. The payer creates a stream with the DAOCoinStream
+// txn, which escrows the stream's total, RatePerBlockBaseUnits * (EndBlockHeight -
+// StartBlockHeight), out of the payer's balance. Nothing happens while the stream runs. Instead,
+// the amount that has accrued to the payee is computed when the payee withdraws it or when the
+// payer cancels the stream, which pays the payee what has accrued and refunds the rest.
+//
+// Like locked balances, escrowed coins don't count towards the coin's CoinsInCirculationNanos
+// until they're paid out or refunded.
+
+//
+// TYPES: DAOCoinStreamEntry
+//
+
+type DAOCoinStreamEntry struct {
+	// StreamID is the hash of the txn that created the stream.
+	StreamID              *BlockHash
+	PayerPKID             *PKID
+	PayeePKID             *PKID
+	ProfilePKID           *PKID
+	RatePerBlockBaseUnits *uint256.Int
+	// The stream pays for the blocks from StartBlockHeight up to but not including
+	// EndBlockHeight.
+	StartBlockHeight   uint64
+	EndBlockHeight     uint64
+	WithdrawnBaseUnits *uint256.Int
+
+	isDeleted bool
+}
+
+func (entry *DAOCoinStreamEntry) Copy() *DAOCoinStreamEntry {
+	return &DAOCoinStreamEntry{
+		StreamID:              entry.StreamID.NewBlockHash(),
+		PayerPKID:             entry.PayerPKID.NewPKID(),
+		PayeePKID:             entry.PayeePKID.NewPKID(),
+		ProfilePKID:           entry.ProfilePKID.NewPKID(),
+		RatePerBlockBaseUnits: entry.RatePerBlockBaseUnits.Clone(),
+		StartBlockHeight:      entry.StartBlockHeight,
+		EndBlockHeight:        entry.EndBlockHeight,
+		WithdrawnBaseUnits:    entry.WithdrawnBaseUnits.Clone(),
+		isDeleted:             entry.isDeleted,
+	}
+}
+
+// GetTotalBaseUnits returns the amount the stream pays over its whole duration.
+func (entry *DAOCoinStreamEntry) GetTotalBaseUnits() (*uint256.Int, error) {
+	return _computeDAOCoinStreamAmount(entry.RatePerBlockBaseUnits, entry.EndBlockHeight-entry.StartBlockHeight)
+}
+
+// GetAccruedBaseUnits returns the amount that has accrued to the payee by the block at
+// blockHeight and hasn't been withdrawn.
+func (entry *DAOCoinStreamEntry) GetAccruedBaseUnits(blockHeight uint64) (*uint256.Int, error) {
+	if blockHeight <= entry.StartBlockHeight {
+		return uint256.NewInt(), nil
+	}
+	numBlocks := blockHeight - entry.StartBlockHeight
+	if blockHeight > entry.EndBlockHeight {
+		numBlocks = entry.EndBlockHeight - entry.StartBlockHeight
+	}
+	accruedBaseUnits, err := _computeDAOCoinStreamAmount(entry.RatePerBlockBaseUnits, numBlocks)
+	if err != nil {
+		return nil, err
+	}
+	if accruedBaseUnits.Lt(entry.WithdrawnBaseUnits) {
+		return nil, fmt.Errorf("GetAccruedBaseUnits: withdrawn %v exceeds accrued %v",
+			entry.WithdrawnBaseUnits, accruedBaseUnits)
+	}
+	return uint256.NewInt().Sub(accruedBaseUnits, entry.WithdrawnBaseUnits), nil
+}
+
+func _computeDAOCoinStreamAmount(ratePerBlockBaseUnits *uint256.Int, numBlocks uint64) (*uint256.Int, error) {
+	amount := uint256.NewInt()
+	if amount.MulOverflow(ratePerBlockBaseUnits, uint256.NewInt().SetUint64(numBlocks)) {
+		return nil, RuleErrorDAOCoinStreamTotalOverflow
+	}
+	return amount, nil
+}
+
+func (entry *DAOCoinStreamEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.StreamID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.PayerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.PayeePKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ProfilePKID, skipMetadata...)...)
+	data = append(data, VariableEncodeUint256(entry.RatePerBlockBaseUnits)...)
+	data = append(data, UintToBuf(entry.StartBlockHeight)...)
+	data = append(data, UintToBuf(entry.EndBlockHeight)...)
+	data = append(data, VariableEncodeUint256(entry.WithdrawnBaseUnits)...)
+	return data
+}
+
+func (entry *DAOCoinStreamEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// StreamID
+	entry.StreamID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading StreamID: ")
+	}
+
+	// PayerPKID
+	entry.PayerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading PayerPKID: ")
+	}
+
+	// PayeePKID
+	entry.PayeePKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading PayeePKID: ")
+	}
+
+	// ProfilePKID
+	entry.ProfilePKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading ProfilePKID: ")
+	}
+
+	// RatePerBlockBaseUnits
+	entry.RatePerBlockBaseUnits, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading RatePerBlockBaseUnits: ")
+	}
+
+	// StartBlockHeight
+	entry.StartBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading StartBlockHeight: ")
+	}
+
+	// EndBlockHeight
+	entry.EndBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading EndBlockHeight: ")
+	}
+
+	// WithdrawnBaseUnits
+	entry.WithdrawnBaseUnits, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamEntry.Decode: Problem reading WithdrawnBaseUnits: ")
+	}
+
+	return nil
+}
+
+func (entry *DAOCoinStreamEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DAOCoinStreamEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDAOCoinStreamEntry
+}
+
+//
+// TYPES: DAOCoinStreamMetadata
+//
+
+type DAOCoinStreamOperationType uint8
+
+const (
+	DAOCoinStreamOperationTypeCreate   DAOCoinStreamOperationType = 0
+	DAOCoinStreamOperationTypeWithdraw DAOCoinStreamOperationType = 1
+	DAOCoinStreamOperationTypeCancel   DAOCoinStreamOperationType = 2
+)
+
+func (operationType DAOCoinStreamOperationType) String() string {
+	switch operationType {
+	case DAOCoinStreamOperationTypeCreate:
+		return "Create"
+	case DAOCoinStreamOperationTypeWithdraw:
+		return "Withdraw"
+	case DAOCoinStreamOperationTypeCancel:
+		return "Cancel"
+	default:
+		return "Unknown"
+	}
+}
+
+type DAOCoinStreamMetadata struct {
+	OperationType DAOCoinStreamOperationType
+
+	// The following fields are only set when creating a stream.
+	ProfilePublicKey      *PublicKey
+	PayeePublicKey        *PublicKey
+	RatePerBlockBaseUnits *uint256.Int
+	StartBlockHeight      uint64
+	EndBlockHeight        uint64
+
+	// StreamID is only set when withdrawing from or cancelling a stream.
+	StreamID *BlockHash
+}
+
+func (txnData *DAOCoinStreamMetadata) GetTxnType() TxnType {
+	return TxnTypeDAOCoinStream
+}
+
+func (txnData *DAOCoinStreamMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, byte(txnData.OperationType))
+	switch txnData.OperationType {
+	case DAOCoinStreamOperationTypeCreate:
+		if txnData.ProfilePublicKey == nil || txnData.PayeePublicKey == nil || txnData.RatePerBlockBaseUnits == nil {
+			return nil, fmt.Errorf("DAOCoinStreamMetadata.ToBytes: Create is missing a field")
+		}
+		data = append(data, EncodeByteArray(txnData.ProfilePublicKey.ToBytes())...)
+		data = append(data, EncodeByteArray(txnData.PayeePublicKey.ToBytes())...)
+		data = append(data, VariableEncodeUint256(txnData.RatePerBlockBaseUnits)...)
+		data = append(data, UintToBuf(txnData.StartBlockHeight)...)
+		data = append(data, UintToBuf(txnData.EndBlockHeight)...)
+	case DAOCoinStreamOperationTypeWithdraw, DAOCoinStreamOperationTypeCancel:
+		if txnData.StreamID == nil {
+			return nil, fmt.Errorf("DAOCoinStreamMetadata.ToBytes: %v is missing the StreamID",
+				txnData.OperationType)
+		}
+		data = append(data, txnData.StreamID[:]...)
+	default:
+		return nil, errors.Wrapf(RuleErrorDAOCoinStreamInvalidOperationType,
+			"DAOCoinStreamMetadata.ToBytes: %d", txnData.OperationType)
+	}
+	return data, nil
+}
+
+func (txnData *DAOCoinStreamMetadata) FromBytes(data []byte) error {
+	ret := DAOCoinStreamMetadata{}
+	rr := bytes.NewReader(data)
+
+	// OperationType
+	operationType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinStreamMetadata.FromBytes: Problem reading OperationType: ")
+	}
+	ret.OperationType = DAOCoinStreamOperationType(operationType)
+
+	switch ret.OperationType {
+	case DAOCoinStreamOperationTypeCreate:
+		profilePublicKeyBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinStreamMetadata.FromBytes: Problem reading ProfilePublicKey: ")
+		}
+		ret.ProfilePublicKey = NewPublicKey(profilePublicKeyBytes)
+
+		payeePublicKeyBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinStreamMetadata.FromBytes: Problem reading PayeePublicKey: ")
+		}
+		ret.PayeePublicKey = NewPublicKey(payeePublicKeyBytes)
+
+		ret.RatePerBlockBaseUnits, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinStreamMetadata.FromBytes: Problem reading RatePerBlockBaseUnits: ")
+		}
+
+		ret.StartBlockHeight, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinStreamMetadata.FromBytes: Problem reading StartBlockHeight: ")
+		}
+
+		ret.EndBlockHeight, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinStreamMetadata.FromBytes: Problem reading EndBlockHeight: ")
+		}
+	case DAOCoinStreamOperationTypeWithdraw, DAOCoinStreamOperationTypeCancel:
+		ret.StreamID = &BlockHash{}
+		if _, err = io.ReadFull(rr, ret.StreamID[:]); err != nil {
+			return errors.Wrapf(err, "DAOCoinStreamMetadata.FromBytes: Problem reading StreamID: ")
+		}
+	default:
+		return errors.Wrapf(RuleErrorDAOCoinStreamInvalidOperationType,
+			"DAOCoinStreamMetadata.FromBytes: %d", ret.OperationType)
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *DAOCoinStreamMetadata) New() DeSoTxnMetadata {
+	return &DAOCoinStreamMetadata{}
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForDAOCoinStreamEntry(streamID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinStreamByStreamID...)
+	key = append(key, streamID[:]...)
+	return key
+}
+
+func DBKeyForDAOCoinStreamByPayer(payerPKID *PKID, streamID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinStreamIDByPayerPKID...)
+	key = append(key, payerPKID.ToBytes()...)
+	key = append(key, streamID[:]...)
+	return key
+}
+
+func DBKeyForDAOCoinStreamByPayee(payeePKID *PKID, streamID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixDAOCoinStreamIDByPayeePKID...)
+	key = append(key, payeePKID.ToBytes()...)
+	key = append(key, streamID[:]...)
+	return key
+}
+
+func DBGetDAOCoinStreamEntry(handle *badger.DB, snap *Snapshot, streamID *BlockHash) (*DAOCoinStreamEntry, error) {
+	var ret *DAOCoinStreamEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetDAOCoinStreamEntryWithTxn(txn, snap, streamID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetDAOCoinStreamEntryWithTxn(txn *badger.Txn, snap *Snapshot, streamID *BlockHash) (*DAOCoinStreamEntry, error) {
+	// Retrieve DAOCoinStreamEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForDAOCoinStreamEntry(streamID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetDAOCoinStreamEntry: problem retrieving DAOCoinStreamEntry: ")
+	}
+
+	// Decode DAOCoinStreamEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&DAOCoinStreamEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDAOCoinStreamEntry: problem decoding DAOCoinStreamEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetDAOCoinStreamEntriesForPKID returns the streams the PKID pays, or the streams that pay
+// the PKID if asPayee is set.
+func DBGetDAOCoinStreamEntriesForPKID(
+	handle *badger.DB, snap *Snapshot, pkid *PKID, asPayee bool) ([]*DAOCoinStreamEntry, error) {
+
+	prefix := append([]byte{}, Prefixes.PrefixDAOCoinStreamIDByPayerPKID...)
+	if asPayee {
+		prefix = append([]byte{}, Prefixes.PrefixDAOCoinStreamIDByPayeePKID...)
+	}
+	prefix = append(prefix, pkid.ToBytes()...)
+	keysFound, _ := EnumerateKeysForPrefix(handle, prefix, true)
+
+	var entries []*DAOCoinStreamEntry
+	for _, key := range keysFound {
+		if len(key) != len(prefix)+HashSizeBytes {
+			return nil, fmt.Errorf("DBGetDAOCoinStreamEntriesForPKID: invalid index key length %d", len(key))
+		}
+		streamID := NewBlockHash(key[len(prefix):])
+		entry, err := DBGetDAOCoinStreamEntry(handle, snap, streamID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDAOCoinStreamEntriesForPKID: ")
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("DBGetDAOCoinStreamEntriesForPKID: stream %v is indexed but doesn't exist",
+				streamID)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutDAOCoinStreamEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinStreamEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinStreamEntry(entry.StreamID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutDAOCoinStreamEntryWithTxn: problem storing DAOCoinStreamEntry: ")
+	}
+	for _, indexKey := range _dbIndexKeysForDAOCoinStreamEntry(entry) {
+		if err := DBSetWithTxn(txn, snap, indexKey, []byte{}, eventManager); err != nil {
+			return errors.Wrapf(err, "DBPutDAOCoinStreamEntryWithTxn: problem storing stream index: ")
+		}
+	}
+	return nil
+}
+
+func DBDeleteDAOCoinStreamEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinStreamEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDAOCoinStreamEntry(entry.StreamID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteDAOCoinStreamEntryWithTxn: problem deleting DAOCoinStreamEntry: ")
+	}
+	for _, indexKey := range _dbIndexKeysForDAOCoinStreamEntry(entry) {
+		if err := DBDeleteWithTxn(txn, snap, indexKey, eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(err, "DBDeleteDAOCoinStreamEntryWithTxn: problem deleting stream index: ")
+		}
+	}
+	return nil
+}
+
+func _dbIndexKeysForDAOCoinStreamEntry(entry *DAOCoinStreamEntry) [][]byte {
+	return [][]byte{
+		DBKeyForDAOCoinStreamByPayer(entry.PayerPKID, entry.StreamID),
+		DBKeyForDAOCoinStreamByPayee(entry.PayeePKID, entry.StreamID),
+	}
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetDAOCoinStreamEntry returns the stream, or nil if it doesn't exist.
+func (bav *UtxoView) GetDAOCoinStreamEntry(streamID *BlockHash) (*DAOCoinStreamEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.DAOCoinStreamIDToEntry[*streamID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetDAOCoinStreamEntry(streamID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDAOCoinStreamEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the DAOCoinStreamEntry from the db in the UtxoView.
+		bav._setDAOCoinStreamEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetDAOCoinStreamEntriesForPKID returns the streams the PKID pays, or the streams that pay
+// the PKID if asPayee is set, including the streams in the view. They're sorted by
+// StartBlockHeight.
+func (bav *UtxoView) GetDAOCoinStreamEntriesForPKID(pkid *PKID, asPayee bool) ([]*DAOCoinStreamEntry, error) {
+	dbEntries, err := bav.GetDbAdapter().GetDAOCoinStreamEntriesForPKID(pkid, asPayee)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDAOCoinStreamEntriesForPKID: ")
+	}
+	for _, dbEntry := range dbEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		if _, exists := bav.DAOCoinStreamIDToEntry[*dbEntry.StreamID]; !exists {
+			bav._setDAOCoinStreamEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*DAOCoinStreamEntry
+	for _, entry := range bav.DAOCoinStreamIDToEntry {
+		entryPKID := entry.PayerPKID
+		if asPayee {
+			entryPKID = entry.PayeePKID
+		}
+		if !entry.isDeleted && entryPKID.Eq(pkid) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		if entries[ii].StartBlockHeight != entries[jj].StartBlockHeight {
+			return entries[ii].StartBlockHeight < entries[jj].StartBlockHeight
+		}
+		return bytes.Compare(entries[ii].StreamID[:], entries[jj].StreamID[:]) < 0
+	})
+	return entries, nil
+}
+
+func (bav *UtxoView) _setDAOCoinStreamEntryMappings(entry *DAOCoinStreamEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setDAOCoinStreamEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.DAOCoinStreamIDToEntry[*entry.StreamID] = entry
+}
+
+func (bav *UtxoView) _deleteDAOCoinStreamEntryMappings(entry *DAOCoinStreamEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteDAOCoinStreamEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setDAOCoinStreamEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushDAOCoinStreamEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Delete every entry in the view first, since a stream's indexes have to be removed
+	// along with it. The entries that aren't deleted are put back below.
+	for mapKeyIter, entryIter := range bav.DAOCoinStreamIDToEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.StreamID.IsEqual(&mapKey) {
+			return fmt.Errorf("_flushDAOCoinStreamEntriesToDbWithTxn: DAOCoinStreamEntry StreamID %v doesn't "+
+				"match MapKey %v", entry.StreamID, &mapKey)
+		}
+
+		if err := DBDeleteDAOCoinStreamEntryWithTxn(
+			txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+		); err != nil {
+			return errors.Wrapf(err, "_flushDAOCoinStreamEntriesToDbWithTxn: ")
+		}
+	}
+	for _, entryIter := range bav.DAOCoinStreamIDToEntry {
+		entry := *entryIter
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutDAOCoinStreamEntryWithTxn(
+			txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushDAOCoinStreamEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectDAOCoinStream(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.DAOCoinStreamBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamBeforeBlockHeight, "_connectDAOCoinStream: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeDAOCoinStream {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectDAOCoinStream: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*DAOCoinStreamMetadata)
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+	}
+
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectDAOCoinStream: PKID for transactor %v not found",
+			PkToStringBoth(txn.PublicKey))
+	}
+	transactorPKID := transactorPKIDEntry.PKID
+
+	var streamEntry *DAOCoinStreamEntry
+	var prevStreamEntry *DAOCoinStreamEntry
+	switch txMeta.OperationType {
+	case DAOCoinStreamOperationTypeCreate:
+		if len(txMeta.ProfilePublicKey.ToBytes()) != btcec.PubKeyBytesLenCompressed {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamInvalidProfilePublicKey, "_connectDAOCoinStream: ")
+		}
+		if _, err = btcec.ParsePubKey(txMeta.PayeePublicKey.ToBytes(), btcec.S256()); err != nil {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamInvalidPayeePublicKey, "_connectDAOCoinStream: %v", err)
+		}
+		if bytes.Equal(txMeta.PayeePublicKey.ToBytes(), txn.PublicKey) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamCannotStreamToSelf, "_connectDAOCoinStream: ")
+		}
+		if txMeta.RatePerBlockBaseUnits == nil || txMeta.RatePerBlockBaseUnits.IsZero() {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamInvalidRate, "_connectDAOCoinStream: ")
+		}
+		// A stream can't start in the past, since it would pay for blocks before it existed.
+		if txMeta.StartBlockHeight < uint64(blockHeight) || txMeta.EndBlockHeight <= txMeta.StartBlockHeight {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamInvalidBlockHeights,
+				"_connectDAOCoinStream: start %d, end %d, current %d",
+				txMeta.StartBlockHeight, txMeta.EndBlockHeight, blockHeight)
+		}
+		profileEntry := bav.GetProfileEntryForPublicKey(txMeta.ProfilePublicKey.ToBytes())
+		if profileEntry == nil || profileEntry.isDeleted {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamOnNonexistentProfile, "_connectDAOCoinStream: ")
+		}
+		if err = bav.IsValidDAOCoinTransfer(profileEntry, txn.PublicKey, txMeta.PayeePublicKey.ToBytes()); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+		}
+		payeePKIDEntry := bav.GetPKIDForPublicKey(txMeta.PayeePublicKey.ToBytes())
+		profilePKIDEntry := bav.GetPKIDForPublicKey(txMeta.ProfilePublicKey.ToBytes())
+		if payeePKIDEntry == nil || payeePKIDEntry.isDeleted || profilePKIDEntry == nil || profilePKIDEntry.isDeleted {
+			return 0, 0, nil, fmt.Errorf("_connectDAOCoinStream: PKID for payee or profile not found")
+		}
+
+		streamEntry = &DAOCoinStreamEntry{
+			StreamID:              txHash.NewBlockHash(),
+			PayerPKID:             transactorPKID.NewPKID(),
+			PayeePKID:             payeePKIDEntry.PKID.NewPKID(),
+			ProfilePKID:           profilePKIDEntry.PKID.NewPKID(),
+			RatePerBlockBaseUnits: txMeta.RatePerBlockBaseUnits.Clone(),
+			StartBlockHeight:      txMeta.StartBlockHeight,
+			EndBlockHeight:        txMeta.EndBlockHeight,
+			WithdrawnBaseUnits:    uint256.NewInt(),
+		}
+	case DAOCoinStreamOperationTypeWithdraw, DAOCoinStreamOperationTypeCancel:
+		existingStreamEntry, err := bav.GetDAOCoinStreamEntry(txMeta.StreamID)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+		}
+		if existingStreamEntry == nil {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamNotFound, "_connectDAOCoinStream: %v", txMeta.StreamID)
+		}
+		if txMeta.OperationType == DAOCoinStreamOperationTypeWithdraw && !existingStreamEntry.PayeePKID.Eq(transactorPKID) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamWithdrawByNonPayee, "_connectDAOCoinStream: ")
+		}
+		if txMeta.OperationType == DAOCoinStreamOperationTypeCancel && !existingStreamEntry.PayerPKID.Eq(transactorPKID) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamCancelByNonPayer, "_connectDAOCoinStream: ")
+		}
+		prevStreamEntry = existingStreamEntry.Copy()
+		streamEntry = existingStreamEntry.Copy()
+	default:
+		return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamInvalidOperationType,
+			"_connectDAOCoinStream: %d", txMeta.OperationType)
+	}
+
+	profileEntry := bav.GetProfileEntryForPKID(streamEntry.ProfilePKID)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamOnNonexistentProfile, "_connectDAOCoinStream: ")
+	}
+	prevCoinEntry := profileEntry.DAOCoinEntry.Copy()
+	prevBalances := make(map[PKID]map[PKID]*BalanceEntry)
+
+	totalBaseUnits, err := streamEntry.GetTotalBaseUnits()
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+	}
+	switch txMeta.OperationType {
+	case DAOCoinStreamOperationTypeCreate:
+		// Escrow the stream's total out of the payer's balance.
+		if err = bav._adjustDAOCoinStreamBalance(
+			streamEntry.PayerPKID, profileEntry, totalBaseUnits, false, prevBalances); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+		}
+		bav._setDAOCoinStreamEntryMappings(streamEntry)
+	case DAOCoinStreamOperationTypeWithdraw:
+		accruedBaseUnits, err := streamEntry.GetAccruedBaseUnits(uint64(blockHeight))
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+		}
+		if accruedBaseUnits.IsZero() {
+			return 0, 0, nil, errors.Wrapf(RuleErrorDAOCoinStreamNothingToWithdraw, "_connectDAOCoinStream: ")
+		}
+		if err = bav._adjustDAOCoinStreamBalance(
+			streamEntry.PayeePKID, profileEntry, accruedBaseUnits, true, prevBalances); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+		}
+		streamEntry.WithdrawnBaseUnits = uint256.NewInt().Add(streamEntry.WithdrawnBaseUnits, accruedBaseUnits)
+		// A stream that has paid out its total is finished.
+		if streamEntry.WithdrawnBaseUnits.Eq(totalBaseUnits) {
+			bav._deleteDAOCoinStreamEntryMappings(prevStreamEntry)
+		} else {
+			bav._setDAOCoinStreamEntryMappings(streamEntry)
+		}
+	case DAOCoinStreamOperationTypeCancel:
+		// Pay the payee what has accrued and refund the rest to the payer.
+		accruedBaseUnits, err := streamEntry.GetAccruedBaseUnits(uint64(blockHeight))
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+		}
+		refundBaseUnits := uint256.NewInt().Sub(totalBaseUnits, streamEntry.WithdrawnBaseUnits)
+		refundBaseUnits = uint256.NewInt().Sub(refundBaseUnits, accruedBaseUnits)
+		if !accruedBaseUnits.IsZero() {
+			if err = bav._adjustDAOCoinStreamBalance(
+				streamEntry.PayeePKID, profileEntry, accruedBaseUnits, true, prevBalances); err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+			}
+		}
+		if !refundBaseUnits.IsZero() {
+			if err = bav._adjustDAOCoinStreamBalance(
+				streamEntry.PayerPKID, profileEntry, refundBaseUnits, true, prevBalances); err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectDAOCoinStream: ")
+			}
+		}
+		bav._deleteDAOCoinStreamEntryMappings(prevStreamEntry)
+	}
+	bav._setProfileEntryMappings(profileEntry)
+
+	// Add a UTXO operation.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                   OperationTypeDAOCoinStream,
+		PrevDAOCoinStreamEntry: prevStreamEntry,
+		PrevCoinEntry:          prevCoinEntry,
+		PrevBalanceEntries:     prevBalances,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+// _adjustDAOCoinStreamBalance credits or debits a HODLer's balance of the profile's DAO coin,
+// saving its previous balance in prevBalances. The coins move into or out of escrow, so the
+// profile's CoinsInCirculationNanos moves with them.
+func (bav *UtxoView) _adjustDAOCoinStreamBalance(
+	hodlerPKID *PKID,
+	profileEntry *ProfileEntry,
+	amountBaseUnits *uint256.Int,
+	isCredit bool,
+	prevBalances map[PKID]map[PKID]*BalanceEntry,
+) error {
+	creatorPKID := bav.GetPKIDForPublicKey(profileEntry.PublicKey)
+	if creatorPKID == nil || creatorPKID.isDeleted {
+		return fmt.Errorf("_adjustDAOCoinStreamBalance: PKID for profile %v not found",
+			PkToStringBoth(profileEntry.PublicKey))
+	}
+	balanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(hodlerPKID, creatorPKID.PKID, true)
+	if balanceEntry == nil || balanceEntry.isDeleted {
+		balanceEntry = &BalanceEntry{
+			HODLerPKID:   hodlerPKID.NewPKID(),
+			CreatorPKID:  creatorPKID.PKID.NewPKID(),
+			BalanceNanos: *uint256.NewInt(),
+		}
+	}
+	if _, exists := prevBalances[*hodlerPKID]; !exists {
+		prevBalances[*hodlerPKID] = make(map[PKID]*BalanceEntry)
+	}
+	if _, exists := prevBalances[*hodlerPKID][*creatorPKID.PKID]; !exists {
+		prevBalances[*hodlerPKID][*creatorPKID.PKID] = balanceEntry.Copy()
+	}
+
+	newBalanceEntry := balanceEntry.Copy()
+	coinEntry := &profileEntry.DAOCoinEntry
+	if isCredit {
+		newBalanceEntry.BalanceNanos = *uint256.NewInt().Add(&balanceEntry.BalanceNanos, amountBaseUnits)
+		coinEntry.CoinsInCirculationNanos = *uint256.NewInt().Add(&coinEntry.CoinsInCirculationNanos, amountBaseUnits)
+		if balanceEntry.BalanceNanos.IsZero() {
+			coinEntry.NumberOfHolders++
+		}
+	} else {
+		if amountBaseUnits.Gt(&balanceEntry.BalanceNanos) {
+			return errors.Wrapf(RuleErrorDAOCoinStreamInsufficientCoins,
+				"_adjustDAOCoinStreamBalance: %v exceeds balance %v", amountBaseUnits, &balanceEntry.BalanceNanos)
+		}
+		if amountBaseUnits.Gt(&coinEntry.CoinsInCirculationNanos) {
+			return fmt.Errorf("_adjustDAOCoinStreamBalance: %v exceeds coins in circulation %v",
+				amountBaseUnits, &coinEntry.CoinsInCirculationNanos)
+		}
+		newBalanceEntry.BalanceNanos = *uint256.NewInt().Sub(&balanceEntry.BalanceNanos, amountBaseUnits)
+		coinEntry.CoinsInCirculationNanos = *uint256.NewInt().Sub(&coinEntry.CoinsInCirculationNanos, amountBaseUnits)
+		if newBalanceEntry.BalanceNanos.IsZero() && !balanceEntry.BalanceNanos.IsZero() {
+			coinEntry.NumberOfHolders--
+		}
+	}
+	bav._setDAOCoinBalanceEntryMappings(newBalanceEntry)
+	return nil
+}
+
+func (bav *UtxoView) _disconnectDAOCoinStream(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.DAOCoinStreamBlockHeight {
+		return errors.Wrapf(RuleErrorDAOCoinStreamBeforeBlockHeight, "_disconnectDAOCoinStream: ")
+	}
+
+	// Validate the last operation is a DAOCoinStream operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectDAOCoinStream: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeDAOCoinStream {
+		return fmt.Errorf(
+			"_disconnectDAOCoinStream: trying to revert %v but found %v",
+			OperationTypeDAOCoinStream,
+			operationData.Type,
+		)
+	}
+	txMeta := currentTxn.TxnMeta.(*DAOCoinStreamMetadata)
+
+	// Revert the stream. A created stream is deleted and a withdrawn or cancelled stream is
+	// restored.
+	if txMeta.OperationType == DAOCoinStreamOperationTypeCreate {
+		streamEntry, err := bav.GetDAOCoinStreamEntry(txHash)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectDAOCoinStream: ")
+		}
+		if streamEntry == nil {
+			return fmt.Errorf("_disconnectDAOCoinStream: created stream %v not found", txHash)
+		}
+		bav._deleteDAOCoinStreamEntryMappings(streamEntry)
+	} else {
+		if operationData.PrevDAOCoinStreamEntry == nil {
+			return fmt.Errorf("_disconnectDAOCoinStream: missing the previous stream entry")
+		}
+		bav._setDAOCoinStreamEntryMappings(operationData.PrevDAOCoinStreamEntry)
+	}
+
+	// Revert the balances.
+	for _, creatorPKIDToBalanceEntry := range operationData.PrevBalanceEntries {
+		for _, balanceEntry := range creatorPKIDToBalanceEntry {
+			bav._setDAOCoinBalanceEntryMappings(balanceEntry)
+		}
+	}
+
+	// Revert the coin entry.
+	if operationData.PrevCoinEntry == nil {
+		return fmt.Errorf("_disconnectDAOCoinStream: missing the previous coin entry")
+	}
+	var profilePKID *PKID
+	if operationData.PrevDAOCoinStreamEntry != nil {
+		profilePKID = operationData.PrevDAOCoinStreamEntry.ProfilePKID
+	} else {
+		profilePKIDEntry := bav.GetPKIDForPublicKey(txMeta.ProfilePublicKey.ToBytes())
+		if profilePKIDEntry == nil || profilePKIDEntry.isDeleted {
+			return fmt.Errorf("_disconnectDAOCoinStream: PKID for profile not found")
+		}
+		profilePKID = profilePKIDEntry.PKID
+	}
+	profileEntry := bav.GetProfileEntryForPKID(profilePKID)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return fmt.Errorf("_disconnectDAOCoinStream: profile %v not found", profilePKID)
+	}
+	profileEntry.DAOCoinEntry = *operationData.PrevCoinEntry
+	bav._setProfileEntryMappings(profileEntry)
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
@@ -0,0 +1,457 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinStreamAccrual(t *testing.T) {
+	require := require.New(t)
+
+	streamEntry := &DAOCoinStreamEntry{
+		RatePerBlockBaseUnits: uint256.NewInt().SetUint64(10),
+		StartBlockHeight:      100,
+		EndBlockHeight:        110,
+		WithdrawnBaseUnits:    uint256.NewInt(),
+	}
+	totalBaseUnits, err := streamEntry.GetTotalBaseUnits()
+	require.NoError(err)
+	require.Equal(uint64(100), totalBaseUnits.Uint64())
+
+	// Nothing accrues before the stream starts, and nothing more accrues after it ends.
+	for blockHeight, expectedBaseUnits := range map[uint64]uint64{
+		50:  0,
+		100: 0,
+		101: 10,
+		105: 50,
+		110: 100,
+		200: 100,
+	} {
+		accruedBaseUnits, err := streamEntry.GetAccruedBaseUnits(blockHeight)
+		require.NoError(err)
+		require.Equal(expectedBaseUnits, accruedBaseUnits.Uint64(), blockHeight)
+	}
+
+	// Withdrawn coins no longer accrue.
+	streamEntry.WithdrawnBaseUnits = uint256.NewInt().SetUint64(50)
+	accruedBaseUnits, err := streamEntry.GetAccruedBaseUnits(107)
+	require.NoError(err)
+	require.Equal(uint64(20), accruedBaseUnits.Uint64())
+
+	// A total that doesn't fit in a uint256 is rejected.
+	streamEntry.RatePerBlockBaseUnits = MaxUint256.Clone()
+	_, err = streamEntry.GetTotalBaseUnits()
+	require.Contains(err.Error(), string(RuleErrorDAOCoinStreamTotalOverflow))
+}
+
+func TestDAOCoinStreamMetadataEncoding(t *testing.T) {
+	require := require.New(t)
+
+	for _, metadata := range []*DAOCoinStreamMetadata{
+		{
+			OperationType:         DAOCoinStreamOperationTypeCreate,
+			ProfilePublicKey:      NewPublicKey(m0PkBytes),
+			PayeePublicKey:        NewPublicKey(m1PkBytes),
+			RatePerBlockBaseUnits: uint256.NewInt().SetUint64(1e9),
+			StartBlockHeight:      100,
+			EndBlockHeight:        200,
+		},
+		{
+			OperationType: DAOCoinStreamOperationTypeWithdraw,
+			StreamID:      NewBlockHash(RandomBytes(HashSizeBytes)),
+		},
+		{
+			OperationType: DAOCoinStreamOperationTypeCancel,
+			StreamID:      NewBlockHash(RandomBytes(HashSizeBytes)),
+		},
+	} {
+		metadataBytes, err := metadata.ToBytes(false)
+		require.NoError(err)
+		decodedMetadata := &DAOCoinStreamMetadata{}
+		require.NoError(decodedMetadata.FromBytes(metadataBytes))
+		require.Equal(metadata, decodedMetadata)
+	}
+
+	_, err := (&DAOCoinStreamMetadata{OperationType: 3}).ToBytes(false)
+	require.Error(err)
+}
+
+func TestDAOCoinStreamConnectAndDisconnect(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(101)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	// The stream migration can't come before the balance model migration, since an encoder's
+	// version byte is decoded as the height of the newest migration it was encoded with.
+	params.ForkHeights.DAOCoinStreamBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// The holders and the streams that accrue are set up with their own testMeta, which isn't
+	// rolled back, so that blocks can be mined while the streams run.
+	setupTestMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+	_registerOrTransferWithTestMeta(setupTestMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(setupTestMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(setupTestMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(setupTestMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e4)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+	m3PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m3PkBytes).PKID
+
+	// m0 mints 1000 of its DAO coin and gives 500 of them to m1, who pays the streams.
+	_updateProfileWithTestMeta(
+		setupTestMeta,
+		feeRateNanosPerKB,
+		m0Pub,         /*updaterPkBase58Check*/
+		m0Priv,        /*updaterPrivBase58Check*/
+		[]byte{},      /*profilePubKey*/
+		"m0",          /*newUsername*/
+		"i am the m0", /*newDescription*/
+		shortPic,      /*newProfilePic*/
+		10*100,        /*newCreatorBasisPoints*/
+		1.25*100*100,  /*newStakeMultipleBasisPoints*/
+		false /*isHidden*/)
+	_daoCoinTxnWithTestMeta(setupTestMeta, feeRateNanosPerKB, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1000),
+	})
+	_daoCoinTransferTxnWithTestMeta(setupTestMeta, feeRateNanosPerKB, m0Pub, m0Priv, DAOCoinTransferMetadata{
+		ProfilePublicKey:       m0PkBytes,
+		DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(500),
+		ReceiverPublicKey:      m1PkBytes,
+	})
+	newCreateMetadata := func(payeePkBytes []byte, ratePerBlock uint64, start uint64, end uint64,
+	) *DAOCoinStreamMetadata {
+		return &DAOCoinStreamMetadata{
+			OperationType:         DAOCoinStreamOperationTypeCreate,
+			ProfilePublicKey:      NewPublicKey(m0PkBytes),
+			PayeePublicKey:        NewPublicKey(payeePkBytes),
+			RatePerBlockBaseUnits: uint256.NewInt().SetUint64(ratePerBlock),
+			StartBlockHeight:      start,
+			EndBlockHeight:        end,
+		}
+	}
+
+	// m1 streams 10 coins per block for 10 blocks to m2 twice: one stream is withdrawn from
+	// and the other is cancelled. Each escrows its total of 100 out of m1's balance.
+	streamStartBlockHeight := uint64(chain.blockTip().Height) + 2
+	_daoCoinStreamWithTestMeta(setupTestMeta, feeRateNanosPerKB, m1Pub, m1Priv,
+		newCreateMetadata(m2PkBytes, 10, streamStartBlockHeight, streamStartBlockHeight+10))
+	withdrawnStreamID := setupTestMeta.txns[len(setupTestMeta.txns)-1].Hash()
+	_daoCoinStreamWithTestMeta(setupTestMeta, feeRateNanosPerKB, m1Pub, m1Priv,
+		newCreateMetadata(m2PkBytes, 10, streamStartBlockHeight, streamStartBlockHeight+10))
+	cancelledStreamID := setupTestMeta.txns[len(setupTestMeta.txns)-1].Hash()
+	for uint64(chain.blockTip().Height)+1 < streamStartBlockHeight+4 {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	// The txns below are connected at the stream's fourth block, by which 40 has accrued.
+	require.Equal(streamStartBlockHeight+4, uint64(chain.blockTip().Height)+1)
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	type streamState struct {
+		// The balances of m0's DAO coin held by m1, m2 and m3.
+		balances                []uint64
+		coinsInCirculationNanos uint64
+		numberOfHolders         uint64
+		streamEntries           []*DAOCoinStreamEntry
+	}
+	// getStreamState returns the balances, the coin entry and the streams that a txn changes.
+	// A stream that doesn't exist is nil.
+	getStreamState := func(utxoView *UtxoView, streamIDs ...*BlockHash) *streamState {
+		if utxoView == nil {
+			utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		}
+		coinEntry := utxoView.GetProfileEntryForPKID(m0PKID).DAOCoinEntry
+		state := &streamState{
+			coinsInCirculationNanos: coinEntry.CoinsInCirculationNanos.Uint64(),
+			numberOfHolders:         coinEntry.NumberOfHolders,
+		}
+		for _, holderPKID := range []*PKID{m1PKID, m2PKID, m3PKID} {
+			balanceEntry := utxoView._getBalanceEntryForHODLerPKIDAndCreatorPKID(holderPKID, m0PKID, true)
+			if balanceEntry == nil || balanceEntry.isDeleted {
+				state.balances = append(state.balances, 0)
+				continue
+			}
+			state.balances = append(state.balances, balanceEntry.BalanceNanos.Uint64())
+		}
+		for _, streamID := range streamIDs {
+			streamEntry, err := utxoView.GetDAOCoinStreamEntry(streamID)
+			require.NoError(err)
+			if streamEntry != nil {
+				streamEntry = streamEntry.Copy()
+			}
+			state.streamEntries = append(state.streamEntries, streamEntry)
+		}
+		return state
+	}
+	// requireDisconnectRestores disconnects the last txn in a view and checks that it puts
+	// back exactly the state from before it was connected.
+	requireDisconnectRestores := func(expectedState *streamState, streamIDs ...*BlockHash) {
+		lastTxn := testMeta.txns[len(testMeta.txns)-1]
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(
+			lastTxn, lastTxn.Hash(), testMeta.txnOps[len(testMeta.txnOps)-1], chain.blockTip().Height+1))
+		require.Equal(expectedState, getStreamState(utxoView, streamIDs...))
+	}
+	blockHeight := uint64(chain.blockTip().Height) + 1
+	escrowedStreamEntry := &DAOCoinStreamEntry{
+		StreamID:              withdrawnStreamID,
+		PayerPKID:             m1PKID,
+		PayeePKID:             m2PKID,
+		ProfilePKID:           m0PKID,
+		RatePerBlockBaseUnits: uint256.NewInt().SetUint64(10),
+		StartBlockHeight:      streamStartBlockHeight,
+		EndBlockHeight:        streamStartBlockHeight + 10,
+		WithdrawnBaseUnits:    uint256.NewInt(),
+	}
+	cancelledStreamEntry := escrowedStreamEntry.Copy()
+	cancelledStreamEntry.StreamID = cancelledStreamID
+	stateBeforeStreams := getStreamState(nil, withdrawnStreamID, cancelledStreamID)
+	require.Equal(&streamState{
+		balances:                []uint64{300, 0, 0},
+		coinsInCirculationNanos: 800,
+		numberOfHolders:         2,
+		streamEntries:           []*DAOCoinStreamEntry{escrowedStreamEntry, cancelledStreamEntry},
+	}, stateBeforeStreams)
+
+	// Invalid streams are rejected.
+	for expectedErr, metadata := range map[RuleError]*DAOCoinStreamMetadata{
+		RuleErrorDAOCoinStreamCannotStreamToSelf:  newCreateMetadata(m1PkBytes, 10, blockHeight, blockHeight+10),
+		RuleErrorDAOCoinStreamInvalidRate:         newCreateMetadata(m3PkBytes, 0, blockHeight, blockHeight+10),
+		RuleErrorDAOCoinStreamInvalidBlockHeights: newCreateMetadata(m3PkBytes, 10, blockHeight-1, blockHeight+10),
+		RuleErrorDAOCoinStreamInsufficientCoins:   newCreateMetadata(m3PkBytes, 31, blockHeight, blockHeight+10),
+	} {
+		_, _, err := _daoCoinStream(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv, metadata)
+		require.Error(err)
+		require.Contains(err.Error(), expectedErr)
+	}
+
+	// m1 streams 5 coins per block for 20 blocks to m3, starting at this block. The total of
+	// 100 is escrowed, so it leaves m1's balance and the coins in circulation.
+	_daoCoinStreamWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv,
+		newCreateMetadata(m3PkBytes, 5, blockHeight, blockHeight+20))
+	createdStreamID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	createdStreamEntry := &DAOCoinStreamEntry{
+		StreamID:              createdStreamID,
+		PayerPKID:             m1PKID,
+		PayeePKID:             m3PKID,
+		ProfilePKID:           m0PKID,
+		RatePerBlockBaseUnits: uint256.NewInt().SetUint64(5),
+		StartBlockHeight:      blockHeight,
+		EndBlockHeight:        blockHeight + 20,
+		WithdrawnBaseUnits:    uint256.NewInt(),
+	}
+	require.Equal(&streamState{
+		balances:                []uint64{200, 0, 0},
+		coinsInCirculationNanos: 700,
+		numberOfHolders:         2,
+		streamEntries:           []*DAOCoinStreamEntry{createdStreamEntry},
+	}, getStreamState(nil, createdStreamID))
+	stateBeforeCreate := &streamState{
+		balances:                []uint64{300, 0, 0},
+		coinsInCirculationNanos: 800,
+		numberOfHolders:         2,
+		streamEntries:           []*DAOCoinStreamEntry{nil},
+	}
+	requireDisconnectRestores(stateBeforeCreate, createdStreamID)
+
+	// Only the payee can withdraw from a stream, only the payer can cancel it, and a stream
+	// that doesn't exist can't be either.
+	for _, testCase := range []struct {
+		publicKey   string
+		privateKey  string
+		metadata    *DAOCoinStreamMetadata
+		expectedErr RuleError
+	}{
+		{m3Pub, m3Priv, &DAOCoinStreamMetadata{
+			OperationType: DAOCoinStreamOperationTypeWithdraw, StreamID: withdrawnStreamID,
+		}, RuleErrorDAOCoinStreamWithdrawByNonPayee},
+		{m2Pub, m2Priv, &DAOCoinStreamMetadata{
+			OperationType: DAOCoinStreamOperationTypeCancel, StreamID: cancelledStreamID,
+		}, RuleErrorDAOCoinStreamCancelByNonPayer},
+		{m2Pub, m2Priv, &DAOCoinStreamMetadata{
+			OperationType: DAOCoinStreamOperationTypeWithdraw, StreamID: NewBlockHash(RandomBytes(HashSizeBytes)),
+		}, RuleErrorDAOCoinStreamNotFound},
+		// Nothing has accrued on a stream that starts at this block.
+		{m3Pub, m3Priv, &DAOCoinStreamMetadata{
+			OperationType: DAOCoinStreamOperationTypeWithdraw, StreamID: createdStreamID,
+		}, RuleErrorDAOCoinStreamNothingToWithdraw},
+	} {
+		_, _, err := _daoCoinStream(
+			t, chain, db, params, feeRateNanosPerKB, testCase.publicKey, testCase.privateKey, testCase.metadata)
+		require.Error(err)
+		require.Contains(err.Error(), testCase.expectedErr)
+	}
+
+	// m2 withdraws the 40 that has accrued on the first stream and becomes a holder.
+	stateBeforeWithdraw := getStreamState(nil, withdrawnStreamID)
+	_daoCoinStreamWithTestMeta(testMeta, feeRateNanosPerKB, m2Pub, m2Priv, &DAOCoinStreamMetadata{
+		OperationType: DAOCoinStreamOperationTypeWithdraw,
+		StreamID:      withdrawnStreamID,
+	})
+	withdrawnStreamEntry := escrowedStreamEntry.Copy()
+	withdrawnStreamEntry.WithdrawnBaseUnits = uint256.NewInt().SetUint64(40)
+	require.Equal(&streamState{
+		balances:                []uint64{200, 40, 0},
+		coinsInCirculationNanos: 740,
+		numberOfHolders:         3,
+		streamEntries:           []*DAOCoinStreamEntry{withdrawnStreamEntry},
+	}, getStreamState(nil, withdrawnStreamID))
+	requireDisconnectRestores(stateBeforeWithdraw, withdrawnStreamID)
+
+	// What was just withdrawn can't be withdrawn again.
+	_, _, err := _daoCoinStream(t, chain, db, params, feeRateNanosPerKB, m2Pub, m2Priv, &DAOCoinStreamMetadata{
+		OperationType: DAOCoinStreamOperationTypeWithdraw,
+		StreamID:      withdrawnStreamID,
+	})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinStreamNothingToWithdraw)
+
+	// m1 cancels the second stream. m2 is paid the 40 that has accrued on it, and the 60 that
+	// hasn't vested is refunded to m1. The stream is deleted.
+	stateBeforeCancel := getStreamState(nil, cancelledStreamID)
+	_daoCoinStreamWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv, &DAOCoinStreamMetadata{
+		OperationType: DAOCoinStreamOperationTypeCancel,
+		StreamID:      cancelledStreamID,
+	})
+	require.Equal(&streamState{
+		balances:                []uint64{260, 80, 0},
+		coinsInCirculationNanos: 840,
+		numberOfHolders:         3,
+		streamEntries:           []*DAOCoinStreamEntry{nil},
+	}, getStreamState(nil, cancelledStreamID))
+	requireDisconnectRestores(stateBeforeCancel, cancelledStreamID)
+
+	// Cancelling the stream that starts at this block refunds all of it to m1.
+	_daoCoinStreamWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv, &DAOCoinStreamMetadata{
+		OperationType: DAOCoinStreamOperationTypeCancel,
+		StreamID:      createdStreamID,
+	})
+	require.Equal(&streamState{
+		balances:                []uint64{360, 80, 0},
+		coinsInCirculationNanos: 940,
+		numberOfHolders:         3,
+		streamEntries:           []*DAOCoinStreamEntry{nil},
+	}, getStreamState(nil, createdStreamID))
+
+	// Rolling everything back restores the streams from the setup exactly, and deletes the
+	// stream that was created.
+	_executeAllTestRollbackAndFlush(testMeta)
+	require.Equal(stateBeforeStreams, getStreamState(nil, withdrawnStreamID, cancelledStreamID))
+	for streamID, expectedStreamEntry := range map[*BlockHash]*DAOCoinStreamEntry{
+		withdrawnStreamID: escrowedStreamEntry,
+		cancelledStreamID: cancelledStreamEntry,
+		createdStreamID:   nil,
+	} {
+		dbStreamEntry, err := DBGetDAOCoinStreamEntry(db, chain.snapshot, streamID)
+		require.NoError(err)
+		require.Equal(expectedStreamEntry, dbStreamEntry)
+	}
+	payerStreamEntries, err := DBGetDAOCoinStreamEntriesForPKID(db, chain.snapshot, m1PKID, false)
+	require.NoError(err)
+	require.Len(payerStreamEntries, 2)
+	payeeStreamEntries, err := DBGetDAOCoinStreamEntriesForPKID(db, chain.snapshot, m3PKID, true)
+	require.NoError(err)
+	require.Empty(payeeStreamEntries)
+}
+
+//
+// ----- HELPERS
+//
+
+func _daoCoinStreamWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *DAOCoinStreamMetadata,
+) {
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check))
+	currentOps, currentTxn, err := _daoCoinStream(
+		testMeta.t, testMeta.chain, testMeta.db, testMeta.params, feeRateNanosPerKB,
+		transactorPublicKeyBase58Check, transactorPrivateKeyBase58Check, metadata)
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+func _daoCoinStream(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoParams,
+	feeRateNanosPerKB uint64, transactorPublicKeyBase58Check string, transactorPrivateKeyBase58Check string,
+	metadata *DAOCoinStreamMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	txn, totalInputMake, _, feesMake, err := chain.CreateDAOCoinStreamTxn(
+		transactorPkBytes, metadata, nil, feeRateNanosPerKB, nil, []*DeSoOutput{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(t, txn, transactorPrivateKeyBase58Check)
+
+	// Always use height+1 for validation since it's assumed the transaction will
+	// get mined into the next block.
+	blockHeight := chain.blockTip().Height + 1
+	utxoOps, totalInput, totalOutput, fees, err :=
+		utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	require.Equal(totalInput, totalOutput+fees)
+	require.Equal(totalInputMake, totalInput)
+	require.Equal(feesMake, fees)
+	require.Equal(OperationTypeSpendBalance, utxoOps[0].Type)
+	require.Equal(OperationTypeDAOCoinStream, utxoOps[len(utxoOps)-1].Type)
+
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+
+	return utxoOps, txn, nil
+}
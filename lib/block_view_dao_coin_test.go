@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -1208,3 +1210,226 @@ func TestDAOCoinBasic(t *testing.T) {
 	_disconnectTestMetaTxnsFromViewAndFlush(testMeta)
 	_connectBlockThenDisconnectBlockAndFlush(testMeta)
 }
+
+func TestDAOCoinDecimals(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinDecimalsBlockHeight = uint32(0)
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	getDecimals := func(pkid *PKID) uint8 {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		decimals, err := utxoView.GetCoinDecimalsForPKID(pkid)
+		require.NoError(err)
+		return decimals
+	}
+	require.Equal(DeSoDecimals, getDecimals(&ZeroPKID))
+	require.Equal(DefaultDAOCoinDecimals, getDecimals(m0PKID))
+
+	updateDecimalsMetadata := DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeUpdateDecimals,
+		Decimals:         9,
+	}
+
+	// The decimals are only encoded when set.
+	metadataBytes, err := updateDecimalsMetadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(uint8(9), decodedMetadata.Decimals)
+	require.Error(decodedMetadata.FromBytes(append(metadataBytes[:len(metadataBytes)-1], 0)))
+
+	// Only the creator can update the decimals.
+	_, _, _, err = _daoCoinTxn(t, chain, db, params, feeRateNanosPerKb, m1Pub, m1Priv, updateDecimalsMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorOnlyProfileOwnerCanUpdateDAOCoinDecimals)
+
+	// The decimals can't exceed MaxDAOCoinDecimals.
+	updateDecimalsMetadata.Decimals = MaxDAOCoinDecimals + 1
+	_, _, _, err = _daoCoinTxn(t, chain, db, params, feeRateNanosPerKb, m0Pub, m0Priv, updateDecimalsMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinInvalidDecimals)
+
+	// m0 sets its DAO coin's decimals to 9.
+	updateDecimalsMetadata.Decimals = 9
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, updateDecimalsMetadata)
+	require.Equal(uint8(9), getDecimals(m0PKID))
+
+	// The decimals can't be updated to their current value.
+	_, _, _, err = _daoCoinTxn(t, chain, db, params, feeRateNanosPerKb, m0Pub, m0Priv, updateDecimalsMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinCannotUpdateDecimalsToCurrentDecimals)
+
+	// Base units convert to and from display amounts using the decimals.
+	baseUnits, err := ConvertDisplayAmountToBaseUnits("1.5", getDecimals(m0PKID))
+	require.NoError(err)
+	require.Equal(uint64(1500000000), baseUnits.Uint64())
+	require.Equal("1.5", ConvertBaseUnitsToDisplayAmount(baseUnits, 9))
+	require.Equal("0.000000005", ConvertBaseUnitsToDisplayAmount(uint256.NewInt().SetUint64(5), 9))
+	require.Equal("2", ConvertBaseUnitsToDisplayAmount(BaseUnitsPerCoin.Clone().Mul(BaseUnitsPerCoin, uint256.NewInt().SetUint64(2)), 18))
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func TestDAOCoinLimitOrderRestriction(t *testing.T) {
+	// Test constants
+	const feeRateNanosPerKb = uint64(101)
+	var err error
+
+	// Initialize test chain and miner.
+	require := require.New(t)
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderBlockHeight = uint32(0)
+	params.ForkHeights.DAOCoinLimitOrderRestrictionBlockHeight = uint32(0)
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKb, /*feeRateNanosPerKB*/
+		m0Pub,             /*updaterPkBase58Check*/
+		m0Priv,            /*updaterPrivBase58Check*/
+		[]byte{},          /*profilePubKey*/
+		"m0",              /*newUsername*/
+		"i am the m0",     /*newDescription*/
+		shortPic,          /*newProfilePic*/
+		10*100,            /*newCreatorBasisPoints*/
+		1.25*100*100,      /*newStakeMultipleBasisPoints*/
+		false,             /*isHidden*/
+	)
+
+	getRestriction := func() DAOCoinLimitOrderRestriction {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		return utxoView.GetProfileEntryForPublicKey(m0PkBytes).DAOCoinEntry.DAOCoinLimitOrderRestriction
+	}
+
+	updateRestrictionMetadata := DAOCoinMetadata{
+		ProfilePublicKey:             m0PkBytes,
+		OperationType:                DAOCoinOperationTypeUpdateLimitOrderRestriction,
+		DAOCoinLimitOrderRestriction: DAOCoinLimitOrderRestrictionTradingDisabled,
+	}
+
+	// The restriction round-trips through the metadata encoding, with or without decimals.
+	metadataBytes, err := updateRestrictionMetadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &DAOCoinMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(uint8(0), decodedMetadata.Decimals)
+	require.Equal(DAOCoinLimitOrderRestrictionTradingDisabled, decodedMetadata.DAOCoinLimitOrderRestriction)
+	require.Error(decodedMetadata.FromBytes(append(metadataBytes[:len(metadataBytes)-1], 0)))
+
+	// Only the creator can update the restriction.
+	_, _, _, err = _daoCoinTxn(t, chain, db, params, feeRateNanosPerKb, m1Pub, m1Priv, updateRestrictionMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorOnlyProfileOwnerCanUpdateDAOCoinLimitOrderRestriction)
+
+	// m0 disables trading of its DAO coin.
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, updateRestrictionMetadata)
+	require.Equal(DAOCoinLimitOrderRestrictionTradingDisabled, getRestriction())
+
+	// The restriction can't be updated to its current value.
+	_, _, _, err = _daoCoinTxn(t, chain, db, params, feeRateNanosPerKb, m0Pub, m0Priv, updateRestrictionMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinCannotUpdateLimitOrderRestrictionToCurrent)
+
+	// No one can place an order for m0's DAO coin while trading is disabled.
+	exchangeRate, err := CalculateScaledExchangeRate(1.0)
+	require.NoError(err)
+	bidMetadata := DAOCoinLimitOrderMetadata{
+		BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m0PkBytes),
+		SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: exchangeRate,
+		QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(100),
+		OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+		FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+	}
+	_, _, _, err = _doDAOCoinLimitOrderTxn(t, chain, db, params, feeRateNanosPerKb, m1Pub, m1Priv, bidMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDAOCoinLimitOrderTradingDisabled)
+
+	// m0 re-enables trading, after which orders can be placed again.
+	updateRestrictionMetadata.DAOCoinLimitOrderRestriction = DAOCoinLimitOrderRestrictionUnrestricted
+	_daoCoinTxnWithTestMeta(testMeta, feeRateNanosPerKb, m0Pub, m0Priv, updateRestrictionMetadata)
+	require.Equal(DAOCoinLimitOrderRestrictionUnrestricted, getRestriction())
+	_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv, bidMetadata)
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
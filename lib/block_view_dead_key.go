@@ -0,0 +1,438 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_view_dead_key.go keeps a registry of public keys that provably can't spend the
+// DESO sent to them. Outputs are only length-checked when a txn is connected, so DESO can
+// be sent to keys that no one can ever sign for, e.g. an all-zero key or a key that isn't
+// a point on the curve. Once the DeadKeyRegistryBlockHeight is reached, every block
+// registers the dead keys its outputs pay, so supply calculations can exclude the DESO
+// they hold without having to scan the chain.
+//
+// Only keys that are dead by construction are registered. A valid key whose private key
+// was lost can't be told apart from any other key, so it's never registered.
+
+//
+// TYPES: DeadKeyReason
+//
+
+// DeadKeyReason describes why a public key can't spend the DESO sent to it.
+type DeadKeyReason uint8
+
+const (
+	DeadKeyReasonNone DeadKeyReason = 0
+	// DeadKeyReasonAllZero is set for a public key made up entirely of zero bytes.
+	DeadKeyReasonAllZero DeadKeyReason = 1
+	// DeadKeyReasonInvalidPoint is set for a public key that doesn't parse as a point
+	// on the secp256k1 curve, so no signature can ever verify against it.
+	DeadKeyReasonInvalidPoint DeadKeyReason = 2
+	// DeadKeyReasonBitcoinBurn is set for the public key that corresponds to the
+	// BitcoinBurnAddress.
+	DeadKeyReasonBitcoinBurn DeadKeyReason = 3
+)
+
+func (reason DeadKeyReason) String() string {
+	switch reason {
+	case DeadKeyReasonNone:
+		return "None"
+	case DeadKeyReasonAllZero:
+		return "AllZero"
+	case DeadKeyReasonInvalidPoint:
+		return "InvalidPoint"
+	case DeadKeyReasonBitcoinBurn:
+		return "BitcoinBurn"
+	default:
+		return fmt.Sprintf("DeadKeyReason(%d)", uint8(reason))
+	}
+}
+
+var bitcoinBurnPublicKey = MustBase58CheckDecode(BurnPubKeyBase58Check)
+
+// GetDeadKeyReason returns why the public key can't spend the DESO sent to it, or
+// DeadKeyReasonNone if nothing about the key rules out spending.
+func GetDeadKeyReason(publicKey []byte) DeadKeyReason {
+	if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+		return DeadKeyReasonNone
+	}
+	if bytes.Equal(publicKey, ZeroPublicKey.ToBytes()) {
+		return DeadKeyReasonAllZero
+	}
+	if bytes.Equal(publicKey, bitcoinBurnPublicKey) {
+		return DeadKeyReasonBitcoinBurn
+	}
+	if _, err := btcec.ParsePubKey(publicKey, btcec.S256()); err != nil {
+		return DeadKeyReasonInvalidPoint
+	}
+	return DeadKeyReasonNone
+}
+
+// IsDeadPublicKey returns true if the public key provably can't spend the DESO sent to it.
+func IsDeadPublicKey(publicKey []byte) bool {
+	return GetDeadKeyReason(publicKey) != DeadKeyReasonNone
+}
+
+//
+// TYPES: DeadKeyEntry
+//
+
+type DeadKeyEntry struct {
+	PublicKey []byte
+	Reason    DeadKeyReason
+	// RegisteredAtBlockHeight is the height of the first block after the fork that paid
+	// an output to the key.
+	RegisteredAtBlockHeight uint64
+
+	isDeleted bool
+}
+
+func (entry *DeadKeyEntry) Copy() *DeadKeyEntry {
+	return &DeadKeyEntry{
+		PublicKey:               append([]byte{}, entry.PublicKey...),
+		Reason:                  entry.Reason,
+		RegisteredAtBlockHeight: entry.RegisteredAtBlockHeight,
+		isDeleted:               entry.isDeleted,
+	}
+}
+
+func (entry *DeadKeyEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeByteArray(entry.PublicKey)...)
+	data = append(data, byte(entry.Reason))
+	data = append(data, UintToBuf(entry.RegisteredAtBlockHeight)...)
+	return data
+}
+
+func (entry *DeadKeyEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// PublicKey
+	entry.PublicKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeadKeyEntry.Decode: Problem reading PublicKey: ")
+	}
+
+	// Reason
+	reason, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "DeadKeyEntry.Decode: Problem reading Reason: ")
+	}
+	entry.Reason = DeadKeyReason(reason)
+
+	// RegisteredAtBlockHeight
+	entry.RegisteredAtBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeadKeyEntry.Decode: Problem reading RegisteredAtBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (entry *DeadKeyEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DeadKeyEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDeadKeyEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForDeadKeyEntry(publicKey []byte) []byte {
+	key := append([]byte{}, Prefixes.PrefixDeadKeyEntryByPublicKey...)
+	key = append(key, publicKey...)
+	return key
+}
+
+func DBGetDeadKeyEntry(handle *badger.DB, snap *Snapshot, publicKey []byte) (*DeadKeyEntry, error) {
+	var ret *DeadKeyEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetDeadKeyEntryWithTxn(txn, snap, publicKey)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetDeadKeyEntryWithTxn(txn *badger.Txn, snap *Snapshot, publicKey []byte) (*DeadKeyEntry, error) {
+	// Retrieve DeadKeyEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForDeadKeyEntry(publicKey))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetDeadKeyEntry: problem retrieving DeadKeyEntry: ")
+	}
+
+	// Decode DeadKeyEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&DeadKeyEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDeadKeyEntry: problem decoding DeadKeyEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetAllDeadKeyEntries returns every registered dead key. Dead keys are rare since
+// each one is paid deliberately, so we don't bother paginating.
+func DBGetAllDeadKeyEntries(handle *badger.DB) ([]*DeadKeyEntry, error) {
+	_, valsFound := EnumerateKeysForPrefix(handle, Prefixes.PrefixDeadKeyEntryByPublicKey, false)
+	var entries []*DeadKeyEntry
+	for _, entryBytes := range valsFound {
+		entry, err := DecodeDeSoEncoder(&DeadKeyEntry{}, bytes.NewReader(entryBytes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetAllDeadKeyEntries: problem decoding DeadKeyEntry: ")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutDeadKeyEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DeadKeyEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDeadKeyEntry(entry.PublicKey)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutDeadKeyEntryWithTxn: problem storing DeadKeyEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteDeadKeyEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DeadKeyEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForDeadKeyEntry(entry.PublicKey)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteDeadKeyEntryWithTxn: problem deleting DeadKeyEntry: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetDeadKeyEntry returns the registry entry for the public key, or nil if the public key
+// isn't registered.
+func (bav *UtxoView) GetDeadKeyEntry(publicKey []byte) (*DeadKeyEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.DeadKeyPublicKeyToEntry[MakePkMapKey(publicKey)]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetDeadKeyEntry(publicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDeadKeyEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the DeadKeyEntry from the db in the UtxoView.
+		bav._setDeadKeyEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetAllDeadKeyEntries returns every registered dead key, sorted by public key so that
+// the result doesn't depend on map iteration order.
+func (bav *UtxoView) GetAllDeadKeyEntries() ([]*DeadKeyEntry, error) {
+	// Load the entries from the db into the view without overwriting the entries the view
+	// has already modified.
+	dbEntries, err := bav.GetDbAdapter().GetAllDeadKeyEntries()
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetAllDeadKeyEntries: ")
+	}
+	for _, dbEntry := range dbEntries {
+		if _, exists := bav.DeadKeyPublicKeyToEntry[MakePkMapKey(dbEntry.PublicKey)]; !exists {
+			bav._setDeadKeyEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*DeadKeyEntry
+	for _, entry := range bav.DeadKeyPublicKeyToEntry {
+		if entry.isDeleted {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		return bytes.Compare(entries[ii].PublicKey, entries[jj].PublicKey) < 0
+	})
+	return entries, nil
+}
+
+// GetDeadKeyBalanceNanos returns the total DESO held by registered dead keys.
+func (bav *UtxoView) GetDeadKeyBalanceNanos() (uint64, error) {
+	deadKeyEntries, err := bav.GetAllDeadKeyEntries()
+	if err != nil {
+		return 0, errors.Wrapf(err, "UtxoView.GetDeadKeyBalanceNanos: ")
+	}
+	totalBalanceNanos := uint64(0)
+	for _, deadKeyEntry := range deadKeyEntries {
+		balanceNanos, err := bav.GetDeSoBalanceNanosForPublicKey(deadKeyEntry.PublicKey)
+		if err != nil {
+			return 0, errors.Wrapf(err, "UtxoView.GetDeadKeyBalanceNanos: problem getting balance for %v: ",
+				PkToStringBoth(deadKeyEntry.PublicKey))
+		}
+		totalBalanceNanos, err = SafeUint64().Add(totalBalanceNanos, balanceNanos)
+		if err != nil {
+			return 0, errors.Wrapf(err, "UtxoView.GetDeadKeyBalanceNanos: ")
+		}
+	}
+	return totalBalanceNanos, nil
+}
+
+// GetCirculatingSupplyNanos returns totalSupplyNanos less the DESO held by registered
+// dead keys, since that DESO can never move again.
+func (bav *UtxoView) GetCirculatingSupplyNanos(totalSupplyNanos uint64) (uint64, error) {
+	deadKeyBalanceNanos, err := bav.GetDeadKeyBalanceNanos()
+	if err != nil {
+		return 0, errors.Wrapf(err, "UtxoView.GetCirculatingSupplyNanos: ")
+	}
+	circulatingSupplyNanos, err := SafeUint64().Sub(totalSupplyNanos, deadKeyBalanceNanos)
+	if err != nil {
+		return 0, errors.Wrapf(err, "UtxoView.GetCirculatingSupplyNanos: dead key balance %d exceeds "+
+			"total supply %d", deadKeyBalanceNanos, totalSupplyNanos)
+	}
+	return circulatingSupplyNanos, nil
+}
+
+func (bav *UtxoView) _setDeadKeyEntryMappings(entry *DeadKeyEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setDeadKeyEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.DeadKeyPublicKeyToEntry[MakePkMapKey(entry.PublicKey)] = entry
+}
+
+func (bav *UtxoView) _deleteDeadKeyEntryMappings(entry *DeadKeyEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteDeadKeyEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setDeadKeyEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushDeadKeyEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.DeadKeyPublicKeyToEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if MakePkMapKey(entry.PublicKey) != mapKey {
+			return fmt.Errorf(
+				"_flushDeadKeyEntriesToDbWithTxn: DeadKeyEntry public key %v doesn't match MapKey %v",
+				PkToStringBoth(entry.PublicKey),
+				PkToStringBoth(mapKey[:]),
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteDeadKeyEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDeadKeyEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutDeadKeyEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDeadKeyEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// BLOCK CONNECTION
+//
+
+// GetDeadKeyOutputsInBlock returns the outputs in the block that pay a dead key, in the
+// order they appear. The outputs of txns wrapped in an atomic txn are included. This is
+// also useful for scanning blocks connected before the registry was enabled.
+func GetDeadKeyOutputsInBlock(desoBlock *MsgDeSoBlock) []*DeSoOutput {
+	var deadKeyOutputs []*DeSoOutput
+	var appendDeadKeyOutputs func(txn *MsgDeSoTxn)
+	appendDeadKeyOutputs = func(txn *MsgDeSoTxn) {
+		for _, output := range txn.TxOutputs {
+			if IsDeadPublicKey(output.PublicKey) {
+				deadKeyOutputs = append(deadKeyOutputs, output)
+			}
+		}
+		if txnMeta, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata); ok {
+			for _, innerTxn := range txnMeta.Txns {
+				appendDeadKeyOutputs(innerTxn)
+			}
+		}
+	}
+	for _, txn := range desoBlock.Txns {
+		appendDeadKeyOutputs(txn)
+	}
+	return deadKeyOutputs
+}
+
+// registerDeadKeysInBlock adds every dead key paid by the block that isn't already in the
+// registry. It returns a block-level UtxoOperation that records the new entries, or nil if
+// the block didn't register any.
+func (bav *UtxoView) registerDeadKeysInBlock(desoBlock *MsgDeSoBlock, blockHeight uint64) (*UtxoOperation, error) {
+	var registeredDeadKeyEntries []*DeadKeyEntry
+	for _, output := range GetDeadKeyOutputsInBlock(desoBlock) {
+		deadKeyEntry, err := bav.GetDeadKeyEntry(output.PublicKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "registerDeadKeysInBlock: ")
+		}
+		if deadKeyEntry != nil {
+			continue
+		}
+		deadKeyEntry = &DeadKeyEntry{
+			PublicKey:               append([]byte{}, output.PublicKey...),
+			Reason:                  GetDeadKeyReason(output.PublicKey),
+			RegisteredAtBlockHeight: blockHeight,
+		}
+		bav._setDeadKeyEntryMappings(deadKeyEntry)
+		registeredDeadKeyEntries = append(registeredDeadKeyEntries, deadKeyEntry.Copy())
+	}
+	if len(registeredDeadKeyEntries) == 0 {
+		return nil, nil
+	}
+	return &UtxoOperation{
+		Type:                     OperationTypeRegisterDeadKeys,
+		RegisteredDeadKeyEntries: registeredDeadKeyEntries,
+	}, nil
+}
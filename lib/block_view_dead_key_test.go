@@ -0,0 +1,204 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadKeyReason(t *testing.T) {
+	require := require.New(t)
+
+	// A valid key isn't dead.
+	require.Equal(DeadKeyReasonNone, GetDeadKeyReason(m0PkBytes))
+	require.False(IsDeadPublicKey(m0PkBytes))
+
+	// Neither is a key with the wrong length, since it can't be paid.
+	require.Equal(DeadKeyReasonNone, GetDeadKeyReason(m0PkBytes[:10]))
+
+	require.Equal(DeadKeyReasonAllZero, GetDeadKeyReason(ZeroPublicKey.ToBytes()))
+	require.Equal(DeadKeyReasonBitcoinBurn, GetDeadKeyReason(MustBase58CheckDecode(BurnPubKeyBase58Check)))
+
+	// A key with an invalid format byte isn't a point on the curve.
+	invalidPointPublicKey := append([]byte{0x05}, m0PkBytes[1:]...)
+	require.Equal(DeadKeyReasonInvalidPoint, GetDeadKeyReason(invalidPointPublicKey))
+	require.True(IsDeadPublicKey(invalidPointPublicKey))
+
+	// Only the outputs paying dead keys are returned, including those of wrapped txns.
+	wrappedTxn := &MsgDeSoTxn{
+		TxOutputs: []*DeSoOutput{{PublicKey: invalidPointPublicKey, AmountNanos: 2}},
+		TxnMeta:   &BasicTransferMetadata{},
+	}
+	desoBlock := &MsgDeSoBlock{
+		Txns: []*MsgDeSoTxn{
+			{
+				TxOutputs: []*DeSoOutput{
+					{PublicKey: m0PkBytes, AmountNanos: 1},
+					{PublicKey: ZeroPublicKey.ToBytes(), AmountNanos: 1},
+				},
+				TxnMeta: &BasicTransferMetadata{},
+			},
+			{
+				TxnMeta: &AtomicTxnsWrapperMetadata{Txns: []*MsgDeSoTxn{wrappedTxn}},
+			},
+		},
+	}
+	deadKeyOutputs := GetDeadKeyOutputsInBlock(desoBlock)
+	require.Len(deadKeyOutputs, 2)
+	require.Equal(ZeroPublicKey.ToBytes(), deadKeyOutputs[0].PublicKey)
+	require.Equal(invalidPointPublicKey, deadKeyOutputs[1].PublicKey)
+
+	// DeadKeyEntries round-trip through their encoding.
+	deadKeyEntry := &DeadKeyEntry{
+		PublicKey:               invalidPointPublicKey,
+		Reason:                  DeadKeyReasonInvalidPoint,
+		RegisteredAtBlockHeight: 123,
+	}
+	decodedEntry, err := DecodeDeSoEncoder(&DeadKeyEntry{}, bytes.NewReader(EncodeToBytes(0, deadKeyEntry)))
+	require.NoError(err)
+	require.Equal(deadKeyEntry, decodedEntry)
+}
+
+func TestDeadKeyRegistryConnectAndDisconnectBlock(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(100)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	// The dead key migration can't come before the balance model migration, since an encoder's
+	// version byte is decoded as the height of the newest migration it was encoded with.
+	params.ForkHeights.DeadKeyRegistryBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 4; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	zeroPublicKey := ZeroPublicKey.ToBytes()
+	invalidPointPublicKey := append([]byte{0x05}, m0PkBytes[1:]...)
+	burnPublicKey := MustBase58CheckDecode(BurnPubKeyBase58Check)
+
+	// mineBlockPaying sends a txn that pays the outputs to the mempool and mines it into a
+	// block, which is returned along with its utxo ops.
+	mineBlockPaying := func(outputs ...*DeSoOutput) (*MsgDeSoBlock, [][]*UtxoOperation) {
+		txn := &MsgDeSoTxn{
+			TxInputs:  []*DeSoInput{},
+			TxOutputs: outputs,
+			PublicKey: senderPkBytes,
+			TxnMeta:   &BasicTransferMetadata{},
+		}
+		_, _, _, _, err := chain.AddInputsAndChangeToTransaction(txn, feeRateNanosPerKB, mempool)
+		require.NoError(err)
+		_signTxn(t, txn, senderPrivString)
+		_, err = mempool.ProcessTransaction(txn, false, false, 0, true)
+		require.NoError(err)
+
+		block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+		require.Len(block.Txns, 2)
+		blockHash, err := block.Header.Hash()
+		require.NoError(err)
+		utxoOps, err := GetUtxoOperationsForBlock(db, chain.snapshot, blockHash)
+		require.NoError(err)
+		return block, utxoOps
+	}
+	// getRegisterDeadKeysUtxoOp returns the block-level utxo op that registered dead keys, or
+	// nil if the block didn't register any.
+	getRegisterDeadKeysUtxoOp := func(utxoOps [][]*UtxoOperation) *UtxoOperation {
+		require.Len(utxoOps, 3)
+		for _, utxoOp := range utxoOps[len(utxoOps)-1] {
+			if utxoOp.Type == OperationTypeRegisterDeadKeys {
+				return utxoOp
+			}
+		}
+		return nil
+	}
+	requireDeadKeyBalanceNanos := func(expectedBalanceNanos uint64) {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		deadKeyBalanceNanos, err := utxoView.GetDeadKeyBalanceNanos()
+		require.NoError(err)
+		require.Equal(expectedBalanceNanos, deadKeyBalanceNanos)
+		// The dead keys' DESO isn't part of the circulating supply.
+		circulatingSupplyNanos, err := utxoView.GetCirculatingSupplyNanos(1e12)
+		require.NoError(err)
+		require.Equal(1e12-expectedBalanceNanos, circulatingSupplyNanos)
+	}
+	requireDeadKeyBalanceNanos(0)
+
+	// A block that pays each kind of dead key, and the all-zero key twice, registers each key
+	// exactly once at the block's height. The valid key it pays isn't registered.
+	firstBlock, firstBlockUtxoOps := mineBlockPaying(
+		&DeSoOutput{PublicKey: zeroPublicKey, AmountNanos: 100},
+		&DeSoOutput{PublicKey: invalidPointPublicKey, AmountNanos: 200},
+		&DeSoOutput{PublicKey: burnPublicKey, AmountNanos: 300},
+		&DeSoOutput{PublicKey: zeroPublicKey, AmountNanos: 400},
+		&DeSoOutput{PublicKey: m0PkBytes, AmountNanos: 500},
+	)
+	registeredDeadKeyEntries := []*DeadKeyEntry{
+		{PublicKey: zeroPublicKey, Reason: DeadKeyReasonAllZero, RegisteredAtBlockHeight: firstBlock.Header.Height},
+		{PublicKey: invalidPointPublicKey, Reason: DeadKeyReasonInvalidPoint,
+			RegisteredAtBlockHeight: firstBlock.Header.Height},
+		{PublicKey: burnPublicKey, Reason: DeadKeyReasonBitcoinBurn, RegisteredAtBlockHeight: firstBlock.Header.Height},
+	}
+	registerUtxoOp := getRegisterDeadKeysUtxoOp(firstBlockUtxoOps)
+	require.NotNil(registerUtxoOp)
+	require.Equal(registeredDeadKeyEntries, registerUtxoOp.RegisteredDeadKeyEntries)
+	dbDeadKeyEntries, err := DBGetAllDeadKeyEntries(db)
+	require.NoError(err)
+	require.ElementsMatch(registeredDeadKeyEntries, dbDeadKeyEntries)
+	requireDeadKeyBalanceNanos(1000)
+
+	// A later block that pays a registered key again doesn't register it again, so the key
+	// keeps the height it was first registered at.
+	secondBlock, secondBlockUtxoOps := mineBlockPaying(&DeSoOutput{PublicKey: zeroPublicKey, AmountNanos: 50})
+	require.Nil(getRegisterDeadKeysUtxoOp(secondBlockUtxoOps))
+	dbDeadKeyEntries, err = DBGetAllDeadKeyEntries(db)
+	require.NoError(err)
+	require.ElementsMatch(registeredDeadKeyEntries, dbDeadKeyEntries)
+	requireDeadKeyBalanceNanos(1050)
+
+	// Disconnecting the later block leaves the registry alone, and disconnecting the block
+	// that registered the keys removes them. The blocks are disconnected in one view, which
+	// tracks the tip as it moves back.
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	disconnectBlock := func(block *MsgDeSoBlock, utxoOps [][]*UtxoOperation) {
+		txHashes, err := ComputeTransactionHashes(block.Txns)
+		require.NoError(err)
+		require.NoError(utxoView.DisconnectBlock(block, txHashes, utxoOps, block.Header.Height))
+		require.NoError(utxoView.FlushToDb(block.Header.Height))
+	}
+	disconnectBlock(secondBlock, secondBlockUtxoOps)
+	dbDeadKeyEntries, err = DBGetAllDeadKeyEntries(db)
+	require.NoError(err)
+	require.ElementsMatch(registeredDeadKeyEntries, dbDeadKeyEntries)
+	requireDeadKeyBalanceNanos(1000)
+
+	disconnectBlock(firstBlock, firstBlockUtxoOps)
+	dbDeadKeyEntries, err = DBGetAllDeadKeyEntries(db)
+	require.NoError(err)
+	require.Empty(dbDeadKeyEntries)
+	for _, publicKey := range [][]byte{zeroPublicKey, invalidPointPublicKey, burnPublicKey} {
+		dbDeadKeyEntry, err := DBGetDeadKeyEntry(db, chain.snapshot, publicKey)
+		require.NoError(err)
+		require.Nil(dbDeadKeyEntry)
+	}
+	requireDeadKeyBalanceNanos(0)
+}
@@ -112,8 +112,13 @@ func (bav *UtxoView) _connectAuthorizeDerivedKey(
 	txMeta := txn.TxnMeta.(*AuthorizeDerivedKeyMetadata)
 
 	// Validate the operation type.
+	if txMeta.OperationType == AuthorizeDerivedKeyOperationExtend &&
+		blockHeight < bav.Params.ForkHeights.DerivedKeyExtensionBlockHeight {
+		return 0, 0, nil, RuleErrorAuthorizeDerivedKeyExtendBeforeBlockHeight
+	}
 	if txMeta.OperationType != AuthorizeDerivedKeyOperationValid &&
-		txMeta.OperationType != AuthorizeDerivedKeyOperationNotValid {
+		txMeta.OperationType != AuthorizeDerivedKeyOperationNotValid &&
+		txMeta.OperationType != AuthorizeDerivedKeyOperationExtend {
 		return 0, 0, nil, fmt.Errorf(
 			"_connectAuthorizeDerivedKey: called with bad OperationType %s",
 			txn.TxnMeta.GetTxnType().String())
@@ -155,6 +160,10 @@ func (bav *UtxoView) _connectAuthorizeDerivedKey(
 		}
 	}
 
+	if txMeta.OperationType == AuthorizeDerivedKeyOperationExtend {
+		return bav._connectExtendDerivedKey(txn, txHash, blockHeight, verifySignatures, prevDerivedKeyEntry)
+	}
+
 	var extraData map[string][]byte
 	if blockHeight >= bav.Params.ForkHeights.ExtraDataOnEntriesBlockHeight {
 		var prevExtraData map[string][]byte
@@ -193,6 +202,10 @@ func (bav *UtxoView) _connectAuthorizeDerivedKey(
 			StakeLimitMap:                make(map[StakeLimitKey]*uint256.Int),
 			UnstakeLimitMap:              make(map[StakeLimitKey]*uint256.Int),
 			UnlockStakeLimitMap:          make(map[StakeLimitKey]uint64),
+			DAOCoinTransferLimitMap:      make(map[PKID]*uint256.Int),
+			CreatorCoinSpendingLimitMap:  make(map[PKID]uint64),
+			RecipientWhitelist:           make(map[PublicKey]bool),
+			GovernanceLimitMap:           make(map[GovernanceLimitKey]uint64),
 		}
 		if prevDerivedKeyEntry != nil && !prevDerivedKeyEntry.isDeleted {
 			// Copy the existing transaction spending limit.
@@ -362,6 +375,72 @@ func (bav *UtxoView) _connectAuthorizeDerivedKey(
 							}
 						}
 					}
+
+					// ====== Derived Key Coin Amount Limits Fork ======
+					// A zero limit removes the cap on the coin rather than disallowing its transfers,
+					// which are still limited by the DAO coin and creator coin operation limits.
+					if blockHeight >= bav.Params.ForkHeights.DerivedKeyCoinAmountLimitsBlockHeight {
+						// Keys authorized before the fork won't have these maps.
+						if newTransactionSpendingLimit.DAOCoinTransferLimitMap == nil {
+							newTransactionSpendingLimit.DAOCoinTransferLimitMap = make(map[PKID]*uint256.Int)
+						}
+						if newTransactionSpendingLimit.CreatorCoinSpendingLimitMap == nil {
+							newTransactionSpendingLimit.CreatorCoinSpendingLimitMap = make(map[PKID]uint64)
+						}
+						for creatorPKID, transferLimitBaseUnits := range transactionSpendingLimit.DAOCoinTransferLimitMap {
+							if transferLimitBaseUnits.IsZero() {
+								delete(newTransactionSpendingLimit.DAOCoinTransferLimitMap, creatorPKID)
+							} else {
+								newTransactionSpendingLimit.DAOCoinTransferLimitMap[creatorPKID] = transferLimitBaseUnits
+							}
+						}
+						for creatorPKID, spendingLimitNanos := range transactionSpendingLimit.CreatorCoinSpendingLimitMap {
+							if spendingLimitNanos == 0 {
+								delete(newTransactionSpendingLimit.CreatorCoinSpendingLimitMap, creatorPKID)
+							} else {
+								newTransactionSpendingLimit.CreatorCoinSpendingLimitMap[creatorPKID] = spendingLimitNanos
+							}
+						}
+					}
+
+					// ====== Derived Key Recipient Whitelist Fork ======
+					if blockHeight >= bav.Params.ForkHeights.DerivedKeyRecipientWhitelistBlockHeight {
+						// Keys authorized before the fork won't have a whitelist. The whitelist is copied
+						// so that the previous entry, which shares the tracker's maps, is left as it was.
+						isRecipientRestricted := len(newTransactionSpendingLimit.RecipientWhitelist) > 0
+						recipientWhitelist := make(map[PublicKey]bool)
+						for recipientPublicKey := range newTransactionSpendingLimit.RecipientWhitelist {
+							recipientWhitelist[recipientPublicKey] = true
+						}
+						newTransactionSpendingLimit.RecipientWhitelist = recipientWhitelist
+						for recipientPublicKey, isWhitelisted := range transactionSpendingLimit.RecipientWhitelist {
+							if !isWhitelisted {
+								delete(newTransactionSpendingLimit.RecipientWhitelist, recipientPublicKey)
+							} else {
+								newTransactionSpendingLimit.RecipientWhitelist[recipientPublicKey] = true
+							}
+						}
+						// An empty whitelist allows any recipient, so removing the last whitelisted
+						// recipient would lift the restriction rather than tighten it.
+						if isRecipientRestricted && len(newTransactionSpendingLimit.RecipientWhitelist) == 0 {
+							return 0, 0, nil, RuleErrorDerivedKeyRecipientWhitelistCannotBeEmptied
+						}
+					}
+
+					// ====== Governance Fork ======
+					if blockHeight >= bav.Params.ForkHeights.GovernanceBlockHeight {
+						// Keys authorized before the fork won't have a governance limit map.
+						if newTransactionSpendingLimit.GovernanceLimitMap == nil {
+							newTransactionSpendingLimit.GovernanceLimitMap = make(map[GovernanceLimitKey]uint64)
+						}
+						for governanceLimitKey, transactionCount := range transactionSpendingLimit.GovernanceLimitMap {
+							if transactionCount == 0 {
+								delete(newTransactionSpendingLimit.GovernanceLimitMap, governanceLimitKey)
+							} else {
+								newTransactionSpendingLimit.GovernanceLimitMap[governanceLimitKey] = transactionCount
+							}
+						}
+					}
 				}
 			}
 		}
@@ -407,6 +486,13 @@ func (bav *UtxoView) _connectAuthorizeDerivedKey(
 	// generate a derived key, you can use it to sign any transaction offline, including authorize
 	// transactions. It also resolves issues in situations where the owner account has insufficient
 	// balance to submit an authorize transaction.
+	//
+	// The derived key's nonce carries over when the key is re-authorized, so that txns it signed
+	// before can't be replayed.
+	var nonce uint64
+	if prevDerivedKeyEntry != nil && !prevDerivedKeyEntry.isDeleted {
+		nonce = prevDerivedKeyEntry.Nonce
+	}
 	derivedKeyEntry := DerivedKeyEntry{
 		OwnerPublicKey:   *NewPublicKey(ownerPublicKey),
 		DerivedPublicKey: *NewPublicKey(derivedPublicKey),
@@ -416,6 +502,7 @@ func (bav *UtxoView) _connectAuthorizeDerivedKey(
 		TransactionSpendingLimitTracker: newTransactionSpendingLimit,
 		Memo:                            memo,
 		ExtraData:                       extraData,
+		Nonce:                           nonce,
 		isDeleted:                       false,
 	}
 	bav._setDerivedKeyMapping(&derivedKeyEntry)
@@ -466,6 +553,102 @@ func (bav *UtxoView) _connectAuthorizeDerivedKey(
 	return totalInput, totalOutput, utxoOpsForTxn, nil
 }
 
+// AssembleDerivedKeyExtensionAccessBytes returns the bytes the owner signs to extend a derived
+// key from its current expiration block to a new one. They're Metamask-compatible like Access
+// Bytes Encoding 2.0, but can't be mistaken for the access bytes of an authorization.
+//
+// Binding the signature to the key's current expiration block means it can only be used
+// once: after the extension the key expires at the new block, so replaying the signature
+// fails, even if the owner later re-authorizes the key with an earlier expiration block.
+func AssembleDerivedKeyExtensionAccessBytes(derivedPublicKey []byte, prevExpirationBlock uint64,
+	expirationBlock uint64, params *DeSoParams) []byte {
+
+	encodingString := "DECENTRALIZED SOCIAL\n\n"
+	encodingString += "Extend your derived public key: " + Base58CheckEncode(derivedPublicKey, false, params) + "\n\n"
+	encodingString += "The current expiration block of your key: " + strconv.FormatUint(prevExpirationBlock, 10) + "\n\n"
+	encodingString += "The new expiration block of your key: " + strconv.FormatUint(expirationBlock, 10) + "\n\n"
+	return []byte(encodingString)
+}
+
+// _verifyDerivedKeyExtensionAccessSignature verifies that the accessSignature is the owner's
+// signature of the extension access bytes for the derived key, its current expiration block,
+// and its new expiration block.
+func _verifyDerivedKeyExtensionAccessSignature(ownerPublicKey []byte, derivedPublicKey []byte,
+	prevExpirationBlock uint64, expirationBlock uint64, accessSignature []byte, blockHeight uint32,
+	params *DeSoParams) error {
+
+	if err := IsByteArrayValidPublicKey(ownerPublicKey); err != nil {
+		return errors.Wrapf(err, "_verifyDerivedKeyExtensionAccessSignature: Problem parsing owner public key")
+	}
+	if err := IsByteArrayValidPublicKey(derivedPublicKey); err != nil {
+		return errors.Wrapf(err, "_verifyDerivedKeyExtensionAccessSignature: Problem parsing derived public key")
+	}
+	accessBytes := AssembleDerivedKeyExtensionAccessBytes(derivedPublicKey, prevExpirationBlock, expirationBlock, params)
+	return _verifyBytesSignature(ownerPublicKey, accessBytes, accessSignature, blockHeight, params)
+}
+
+// _connectExtendDerivedKey moves the ExpirationBlock of an existing derived key to a later
+// block. Unlike re-authorizing the key, it leaves the key's spending limit tracker, memo, and
+// ExtraData as they are, so the limits the key has already used up stay used up.
+func (bav *UtxoView) _connectExtendDerivedKey(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool,
+	prevDerivedKeyEntry *DerivedKeyEntry) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	txMeta := txn.TxnMeta.(*AuthorizeDerivedKeyMetadata)
+	ownerPublicKey := txn.PublicKey
+	derivedPublicKey := txMeta.DerivedPublicKey
+
+	// Only a key that's currently authorized can be extended. The caller has already
+	// rejected keys that were de-authorized.
+	if prevDerivedKeyEntry == nil || prevDerivedKeyEntry.isDeleted {
+		return 0, 0, nil, RuleErrorAuthorizeDerivedKeyExtendNonExistentDerivedKey
+	}
+	if txMeta.ExpirationBlock <= prevDerivedKeyEntry.ExpirationBlock {
+		return 0, 0, nil, errors.Wrapf(RuleErrorAuthorizeDerivedKeyExtendMustIncreaseExpiration,
+			"_connectExtendDerivedKey: New expiration block %d isn't after current expiration block %d",
+			txMeta.ExpirationBlock, prevDerivedKeyEntry.ExpirationBlock)
+	}
+	if _, exists := txn.ExtraData[TransactionSpendingLimitKey]; exists {
+		return 0, 0, nil, RuleErrorAuthorizeDerivedKeyExtendCannotSetSpendingLimit
+	}
+
+	// As with authorizations, we skip verifying the access signature if the transaction is
+	// signed by the owner.
+	_, isDerived, err := IsDerivedSignature(txn, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectExtendDerivedKey: "+
+			"It looks like this transaction was signed with a derived key, but the signature is malformed: ")
+	}
+	if isDerived {
+		if err = _verifyDerivedKeyExtensionAccessSignature(ownerPublicKey, derivedPublicKey,
+			prevDerivedKeyEntry.ExpirationBlock, txMeta.ExpirationBlock, txMeta.AccessSignature,
+			blockHeight, bav.Params); err != nil {
+			return 0, 0, nil, errors.Wrap(RuleErrorAuthorizeDerivedKeyAccessSignatureNotValid, err.Error())
+		}
+	}
+
+	// Set the extended entry before connecting the basic transfer so that a derived key can
+	// sign its own extension, even if it has already expired. See the comment in
+	// _connectAuthorizeDerivedKey for why this is done before the txn is fully validated.
+	derivedKeyEntry := prevDerivedKeyEntry.Copy()
+	derivedKeyEntry.ExpirationBlock = txMeta.ExpirationBlock
+	bav._setDerivedKeyMapping(derivedKeyEntry)
+
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		bav._deleteDerivedKeyMapping(derivedKeyEntry)
+		bav._setDerivedKeyMapping(prevDerivedKeyEntry)
+		return 0, 0, nil, errors.Wrapf(err, "_connectExtendDerivedKey: ")
+	}
+
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                OperationTypeAuthorizeDerivedKey,
+		PrevDerivedKeyEntry: prevDerivedKeyEntry,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
 func (bav *UtxoView) _disconnectAuthorizeDerivedKey(
 	operationType OperationType, currentTxn *MsgDeSoTxn, txnHash *BlockHash,
 	utxoOpsForTxn []*UtxoOperation, blockHeight uint32) error {
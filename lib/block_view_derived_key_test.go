@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -119,7 +121,7 @@ func _derivedKeyVerifyTest(t *testing.T, db *badger.DB, chain *Blockchain, trans
 	// If we removed the derivedKeyEntry from utxoView altogether, it'll be nil.
 	// To pass the tests, we initialize it to a default struct.
 	if derivedKeyEntry == nil || derivedKeyEntry.isDeleted {
-		derivedKeyEntry = &DerivedKeyEntry{*NewPublicKey(senderPkBytes), *NewPublicKey(derivedPublicKey), 0, AuthorizeDerivedKeyOperationValid, nil, transactionSpendingLimit, nil, false}
+		derivedKeyEntry = &DerivedKeyEntry{*NewPublicKey(senderPkBytes), *NewPublicKey(derivedPublicKey), 0, AuthorizeDerivedKeyOperationValid, nil, transactionSpendingLimit, nil, 0, false}
 	}
 	require.Equal(derivedKeyEntry.ExpirationBlock, expirationBlockExpected)
 	require.Equal(derivedKeyEntry.OperationType, operationTypeExpected)
@@ -4190,3 +4192,433 @@ func _createSignedAuthorizeDerivedKeyTransaction(t *testing.T, chain *Blockchain
 	}
 	return txn, nil
 }
+
+func TestDerivedKeyCoinAmountLimits(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer db.Close()
+
+	params := DeSoTestnetParams
+	params.ForkHeights.DerivedKeyCoinAmountLimitsBlockHeight = 0
+	prevGlobalDeSoParams := GlobalDeSoParams
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams = prevGlobalDeSoParams
+	}()
+
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+
+	// The limits round-trip through their encoding.
+	tsl := &TransactionSpendingLimit{
+		TransactionCountLimitMap:     make(map[TxnType]uint64),
+		CreatorCoinOperationLimitMap: make(map[CreatorCoinOperationLimitKey]uint64),
+		DAOCoinOperationLimitMap:     make(map[DAOCoinOperationLimitKey]uint64),
+		NFTOperationLimitMap:         make(map[NFTOperationLimitKey]uint64),
+		DAOCoinLimitOrderLimitMap:    make(map[DAOCoinLimitOrderLimitKey]uint64),
+		DAOCoinTransferLimitMap: map[PKID]*uint256.Int{
+			*m0PKID:  uint256.NewInt().SetUint64(100),
+			ZeroPKID: uint256.NewInt().SetUint64(150),
+		},
+		CreatorCoinSpendingLimitMap: map[PKID]uint64{
+			*m1PKID: 50,
+		},
+	}
+	tslBytes, err := tsl.ToBytes(1)
+	require.NoError(err)
+	decodedTSL := &TransactionSpendingLimit{}
+	require.NoError(decodedTSL.FromBytes(1, bytes.NewReader(tslBytes)))
+	require.Equal(tsl.DAOCoinTransferLimitMap, decodedTSL.DAOCoinTransferLimitMap)
+	require.Equal(tsl.CreatorCoinSpendingLimitMap, decodedTSL.CreatorCoinSpendingLimitMap)
+
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	derivedKeyEntry := DerivedKeyEntry{TransactionSpendingLimitTracker: tsl.Copy()}
+
+	// Transfers of m0's DAO coin are deducted from both its limit and the limit for any DAO coin.
+	derivedKeyEntry, err = utxoView._checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry(
+		derivedKeyEntry, m0PkBytes, uint256.NewInt().SetUint64(60))
+	require.NoError(err)
+	require.Equal(uint256.NewInt().SetUint64(40), derivedKeyEntry.TransactionSpendingLimitTracker.DAOCoinTransferLimitMap[*m0PKID])
+	require.Equal(uint256.NewInt().SetUint64(90), derivedKeyEntry.TransactionSpendingLimitTracker.DAOCoinTransferLimitMap[ZeroPKID])
+
+	// m1's DAO coin is only limited by the limit for any DAO coin.
+	_, err = utxoView._checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry(
+		derivedKeyEntry, m1PkBytes, uint256.NewInt().SetUint64(91))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDerivedKeyDAOCoinTransferExceedsAmountLimit)
+	_, err = utxoView._checkDAOCoinTransferLimitAndUpdateDerivedKeyEntry(
+		derivedKeyEntry, m0PkBytes, uint256.NewInt().SetUint64(41))
+	require.Error(err)
+
+	// Creator coins without a limit can be spent freely, and limits that run out stay in place.
+	derivedKeyEntry, err = utxoView._checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry(
+		derivedKeyEntry, m0PkBytes, 1000)
+	require.NoError(err)
+	derivedKeyEntry, err = utxoView._checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry(
+		derivedKeyEntry, m1PkBytes, 50)
+	require.NoError(err)
+	require.Equal(uint64(0), derivedKeyEntry.TransactionSpendingLimitTracker.CreatorCoinSpendingLimitMap[*m1PKID])
+	_, err = utxoView._checkCreatorCoinSpendingLimitAndUpdateDerivedKeyEntry(derivedKeyEntry, m1PkBytes, 1)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDerivedKeyCreatorCoinSpendExceedsAmountLimit)
+}
+
+func TestDerivedKeyNonce(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer db.Close()
+
+	params := DeSoTestnetParams
+	params.ForkHeights.DerivedKeyNonceBlockHeight = 0
+	prevGlobalDeSoParams := GlobalDeSoParams
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams = prevGlobalDeSoParams
+	}()
+
+	// The nonce round-trips through the DerivedKeyEntry encoding.
+	derivedKeyEntry := &DerivedKeyEntry{
+		OwnerPublicKey:   *NewPublicKey(m0PkBytes),
+		DerivedPublicKey: *NewPublicKey(m1PkBytes),
+		ExpirationBlock:  100,
+		OperationType:    AuthorizeDerivedKeyOperationValid,
+		ExtraData:        map[string][]byte{},
+		Memo:             []byte{},
+		Nonce:            7,
+	}
+	decodedEntry := &DerivedKeyEntry{}
+	exists, err := DecodeFromBytes(decodedEntry, bytes.NewReader(EncodeToBytes(1, derivedKeyEntry)))
+	require.True(exists)
+	require.NoError(err)
+	require.Equal(uint64(7), decodedEntry.Nonce)
+
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	makeTxn := func(nonceBytes []byte) *MsgDeSoTxn {
+		txn := &MsgDeSoTxn{TxnMeta: &BasicTransferMetadata{}}
+		if nonceBytes != nil {
+			txn.ExtraData = map[string][]byte{DerivedKeyNonceKey: nonceBytes}
+		}
+		return txn
+	}
+
+	// Txns without a nonce leave the derived key's nonce alone.
+	usedNonce, err := utxoView._checkAndIncrementDerivedKeyNonce(makeTxn(nil), derivedKeyEntry, 1)
+	require.NoError(err)
+	require.False(usedNonce)
+	require.Equal(uint64(7), derivedKeyEntry.Nonce)
+
+	// A txn with the current nonce moves it on, after which the same txn is a replay.
+	usedNonce, err = utxoView._checkAndIncrementDerivedKeyNonce(makeTxn(UintToBuf(7)), derivedKeyEntry, 1)
+	require.NoError(err)
+	require.True(usedNonce)
+	require.Equal(uint64(8), derivedKeyEntry.Nonce)
+	_, err = utxoView._checkAndIncrementDerivedKeyNonce(makeTxn(UintToBuf(7)), derivedKeyEntry, 1)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDerivedKeyNonceMismatch)
+
+	// Nonces with trailing bytes are rejected.
+	_, err = utxoView._checkAndIncrementDerivedKeyNonce(makeTxn(append(UintToBuf(8), 0)), derivedKeyEntry, 1)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDerivedKeyInvalidNonce)
+}
+
+func TestExtendDerivedKey(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.NFTTransferOrBurnAndDerivedKeysBlockHeight = 0
+	params.ForkHeights.DerivedKeyTrackSpendingLimitsBlockHeight = 0
+	params.ForkHeights.DerivedKeyExtensionBlockHeight = 0
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	blockHeight := uint32(10)
+
+	// m0 has an unlimited derived key that expires at block 100.
+	ownerPrivBytes, _, err := Base58CheckDecode(m0Priv)
+	require.NoError(err)
+	ownerPriv, _ := btcec.PrivKeyFromBytes(btcec.S256(), ownerPrivBytes)
+	derivedPriv, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+	derivedPublicKey := derivedPriv.PubKey().SerializeCompressed()
+	utxoView._setDerivedKeyMapping(&DerivedKeyEntry{
+		OwnerPublicKey:                  *NewPublicKey(m0PkBytes),
+		DerivedPublicKey:                *NewPublicKey(derivedPublicKey),
+		ExpirationBlock:                 100,
+		OperationType:                   AuthorizeDerivedKeyOperationValid,
+		TransactionSpendingLimitTracker: &TransactionSpendingLimit{IsUnlimited: true},
+		ExtraData:                       map[string][]byte{},
+	})
+	_, err = utxoView._addBalance(1000, m0PkBytes)
+	require.NoError(err)
+
+	signExtension := func(prevExpirationBlock uint64, expirationBlock uint64) []byte {
+		accessBytes := AssembleDerivedKeyExtensionAccessBytes(
+			derivedPublicKey, prevExpirationBlock, expirationBlock, &params)
+		signature, err := ownerPriv.Sign(Sha256DoubleHash(accessBytes)[:])
+		require.NoError(err)
+		return signature.Serialize()
+	}
+	makeExtendTxn := func(expirationBlock uint64, accessSignature []byte) *MsgDeSoTxn {
+		return &MsgDeSoTxn{
+			PublicKey: m0PkBytes,
+			TxnMeta: &AuthorizeDerivedKeyMetadata{
+				DerivedPublicKey: derivedPublicKey,
+				ExpirationBlock:  expirationBlock,
+				OperationType:    AuthorizeDerivedKeyOperationExtend,
+				AccessSignature:  accessSignature,
+			},
+			TxnFeeNanos: 10,
+			// The txn is signed by the derived key.
+			ExtraData: map[string][]byte{DerivedPublicKey: derivedPublicKey},
+		}
+	}
+	connectTxn := func(txn *MsgDeSoTxn) ([]*UtxoOperation, error) {
+		_, _, utxoOps, err := utxoView._connectAuthorizeDerivedKey(txn, txn.Hash(), blockHeight, false)
+		return utxoOps, err
+	}
+	requireExpirationBlock := func(expirationBlock uint64) {
+		derivedKeyEntry := utxoView.GetDerivedKeyMappingForOwner(m0PkBytes, derivedPublicKey)
+		require.Equal(expirationBlock, derivedKeyEntry.ExpirationBlock)
+		require.True(derivedKeyEntry.TransactionSpendingLimitTracker.IsUnlimited)
+	}
+
+	// A signature that isn't bound to the key's current expiration block is rejected.
+	_, err = connectTxn(makeExtendTxn(200, signExtension(50, 200)))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorAuthorizeDerivedKeyAccessSignatureNotValid)
+	requireExpirationBlock(100)
+
+	// Extending the key from block 100 to block 200 keeps its limits.
+	extendTxn := makeExtendTxn(200, signExtension(100, 200))
+	utxoOps, err := connectTxn(extendTxn)
+	require.NoError(err)
+	requireExpirationBlock(200)
+
+	// The same extension can't be replayed.
+	_, err = connectTxn(extendTxn)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorAuthorizeDerivedKeyExtendMustIncreaseExpiration)
+
+	// Disconnecting the extension restores the expiration block and the owner's balance.
+	require.NoError(utxoView._disconnectAuthorizeDerivedKey(
+		OperationTypeAuthorizeDerivedKey, extendTxn, extendTxn.Hash(), utxoOps, blockHeight))
+	requireExpirationBlock(100)
+	balanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(1000), balanceNanos)
+
+	// Once the extension is reconnected and the owner re-authorizes the key with an earlier
+	// expiration block, the extension can't be replayed to undo it.
+	_, err = connectTxn(extendTxn)
+	require.NoError(err)
+	shortenedEntry := utxoView.GetDerivedKeyMappingForOwner(m0PkBytes, derivedPublicKey).Copy()
+	shortenedEntry.ExpirationBlock = 150
+	utxoView._setDerivedKeyMapping(shortenedEntry)
+	_, err = connectTxn(extendTxn)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorAuthorizeDerivedKeyAccessSignatureNotValid)
+	requireExpirationBlock(150)
+}
+
+func TestDerivedKeyRecipientWhitelist(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.NFTTransferOrBurnAndDerivedKeysBlockHeight = 0
+	params.ForkHeights.DerivedKeySetSpendingLimitsBlockHeight = 0
+	params.ForkHeights.DerivedKeyTrackSpendingLimitsBlockHeight = 0
+	params.ForkHeights.DerivedKeyRecipientWhitelistBlockHeight = 0
+	prevGlobalDeSoParams := GlobalDeSoParams
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams = prevGlobalDeSoParams
+	}()
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	blockHeight := uint32(10)
+	_, err := utxoView._addBalance(1000, m0PkBytes)
+	require.NoError(err)
+
+	derivedPriv, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+	derivedPublicKey := derivedPriv.PubKey().SerializeCompressed()
+	makeAuthorizeTxn := func(recipientWhitelist map[PublicKey]bool) *MsgDeSoTxn {
+		tsl := &TransactionSpendingLimit{
+			GlobalDESOLimit:          100,
+			TransactionCountLimitMap: map[TxnType]uint64{TxnTypeBasicTransfer: 10},
+			RecipientWhitelist:       recipientWhitelist,
+		}
+		tslBytes, err := tsl.ToBytes(uint64(blockHeight))
+		require.NoError(err)
+		// The txn is signed by the owner, so it doesn't need an access signature.
+		return &MsgDeSoTxn{
+			PublicKey: m0PkBytes,
+			TxnMeta: &AuthorizeDerivedKeyMetadata{
+				DerivedPublicKey: derivedPublicKey,
+				ExpirationBlock:  100,
+				OperationType:    AuthorizeDerivedKeyOperationValid,
+			},
+			TxnFeeNanos: 10,
+			ExtraData:   map[string][]byte{TransactionSpendingLimitKey: tslBytes},
+		}
+	}
+	connectAuthorizeTxn := func(txn *MsgDeSoTxn) ([]*UtxoOperation, error) {
+		_, _, utxoOps, err := utxoView._connectAuthorizeDerivedKey(txn, txn.Hash(), blockHeight, false)
+		return utxoOps, err
+	}
+	requireWhitelist := func(publicKeys ...[]byte) {
+		expectedWhitelist := make(map[PublicKey]bool)
+		for _, publicKey := range publicKeys {
+			expectedWhitelist[*NewPublicKey(publicKey)] = true
+		}
+		derivedKeyEntry := utxoView.GetDerivedKeyMappingForOwner(m0PkBytes, derivedPublicKey)
+		require.Equal(expectedWhitelist, derivedKeyEntry.TransactionSpendingLimitTracker.RecipientWhitelist)
+	}
+
+	// Authorizing the key with m2 and m3 whitelisted restricts it to them.
+	_, err = connectAuthorizeTxn(makeAuthorizeTxn(map[PublicKey]bool{
+		*NewPublicKey(m2PkBytes): true,
+		*NewPublicKey(m3PkBytes): true,
+	}))
+	require.NoError(err)
+	requireWhitelist(m2PkBytes, m3PkBytes)
+
+	// Removing m2 leaves m3, and disconnecting the removal puts m2 back.
+	removeTxn := makeAuthorizeTxn(map[PublicKey]bool{*NewPublicKey(m2PkBytes): false})
+	removeUtxoOps, err := connectAuthorizeTxn(removeTxn)
+	require.NoError(err)
+	requireWhitelist(m3PkBytes)
+	require.NoError(utxoView._disconnectAuthorizeDerivedKey(
+		OperationTypeAuthorizeDerivedKey, removeTxn, removeTxn.Hash(), removeUtxoOps, blockHeight))
+	requireWhitelist(m2PkBytes, m3PkBytes)
+	_, err = connectAuthorizeTxn(removeTxn)
+	require.NoError(err)
+
+	// Removing the last whitelisted recipient would let the key send to anyone, so it's rejected.
+	_, err = connectAuthorizeTxn(makeAuthorizeTxn(map[PublicKey]bool{*NewPublicKey(m3PkBytes): false}))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDerivedKeyRecipientWhitelistCannotBeEmptied)
+	requireWhitelist(m3PkBytes)
+
+	// Every txn that transfers to a recipient is checked against the whitelist. The key has
+	// enough of each limit for the txns below, so only the recipient decides whether they pass.
+	nftPostHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	utxoView._setDerivedKeyMapping(&DerivedKeyEntry{
+		OwnerPublicKey:   *NewPublicKey(m0PkBytes),
+		DerivedPublicKey: *NewPublicKey(derivedPublicKey),
+		ExpirationBlock:  100,
+		OperationType:    AuthorizeDerivedKeyOperationValid,
+		TransactionSpendingLimitTracker: &TransactionSpendingLimit{
+			GlobalDESOLimit: 1000,
+			TransactionCountLimitMap: map[TxnType]uint64{
+				TxnTypeBasicTransfer: 10,
+				TxnTypeDAOCoinStream: 10,
+				TxnTypeNFTSwap:       10,
+			},
+			CreatorCoinOperationLimitMap: map[CreatorCoinOperationLimitKey]uint64{
+				MakeCreatorCoinOperationLimitKey(ZeroPKID, TransferCreatorCoinOperation): 10,
+			},
+			DAOCoinOperationLimitMap: map[DAOCoinOperationLimitKey]uint64{
+				MakeDAOCoinOperationLimitKey(ZeroPKID, TransferDAOCoinOperation): 10,
+			},
+			NFTOperationLimitMap: map[NFTOperationLimitKey]uint64{
+				MakeNFTOperationLimitKey(*nftPostHash, 1, TransferNFTOperation): 10,
+			},
+			LockupLimitMap: map[LockupLimitKey]uint64{
+				MakeLockupLimitKey(ZeroPKID, LockupLimitScopeTypeAnyCoins, AnyLockupOperation): 10,
+			},
+			RecipientWhitelist: map[PublicKey]bool{*NewPublicKey(m3PkBytes): true},
+		},
+		ExtraData: map[string][]byte{},
+	})
+	profilePublicKey := NewPublicKey(m1PkBytes)
+	txnMetasForRecipient := func(recipientPublicKey []byte) []DeSoTxnMetadata {
+		return []DeSoTxnMetadata{
+			&CreatorCoinTransferMetadataa{
+				ProfilePublicKey:           m1PkBytes,
+				CreatorCoinToTransferNanos: 1,
+				ReceiverPublicKey:          recipientPublicKey,
+			},
+			&DAOCoinTransferMetadata{
+				ProfilePublicKey:       m1PkBytes,
+				DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(1),
+				ReceiverPublicKey:      recipientPublicKey,
+			},
+			&DAOCoinMultiTransferMetadata{
+				ProfilePublicKey: m1PkBytes,
+				Recipients: []*DAOCoinMultiTransferRecipient{
+					{ReceiverPublicKey: m3PkBytes, DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(1)},
+					{ReceiverPublicKey: recipientPublicKey, DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(1)},
+				},
+			},
+			&CoinLockupMetadata{
+				ProfilePublicKey:   profilePublicKey,
+				RecipientPublicKey: NewPublicKey(recipientPublicKey),
+			},
+			&CoinLockupTransferMetadata{
+				ProfilePublicKey:   profilePublicKey,
+				RecipientPublicKey: NewPublicKey(recipientPublicKey),
+			},
+			&DAOCoinStreamMetadata{
+				OperationType:    DAOCoinStreamOperationTypeCreate,
+				ProfilePublicKey: profilePublicKey,
+				PayeePublicKey:   NewPublicKey(recipientPublicKey),
+			},
+			&NFTTransferMetadata{
+				NFTPostHash:       nftPostHash,
+				SerialNumber:      1,
+				ReceiverPublicKey: recipientPublicKey,
+			},
+			&NFTSwapMetadata{
+				OperationType:         NFTSwapOperationTypePropose,
+				CounterpartyPublicKey: recipientPublicKey,
+			},
+		}
+	}
+	checkSpendingLimit := func(txnMeta DeSoTxnMetadata, utxoOps []*UtxoOperation) error {
+		txn := &MsgDeSoTxn{PublicKey: m0PkBytes, TxnMeta: txnMeta}
+		_, err := utxoView._checkAndUpdateDerivedKeySpendingLimit(txn, derivedPublicKey, 0, utxoOps, blockHeight)
+		return err
+	}
+	for _, recipientPublicKey := range [][]byte{m3PkBytes, m0PkBytes} {
+		for _, txnMeta := range txnMetasForRecipient(recipientPublicKey) {
+			require.NoError(checkSpendingLimit(txnMeta, nil), "%v", txnMeta.GetTxnType())
+		}
+	}
+	for _, txnMeta := range txnMetasForRecipient(m4PkBytes) {
+		err = checkSpendingLimit(txnMeta, nil)
+		require.Error(err, "%v", txnMeta.GetTxnType())
+		require.Contains(err.Error(), RuleErrorDerivedKeyRecipientNotWhitelisted)
+	}
+
+	// DESO sent to a recipient and NFTs sent to the proposer of an accepted swap are checked too.
+	basicTransferUtxoOps := func(recipientPublicKey []byte) []*UtxoOperation {
+		return []*UtxoOperation{{Type: OperationTypeAddBalance, BalancePublicKey: recipientPublicKey}}
+	}
+	acceptSwapUtxoOps := func(proposerPublicKey []byte) []*UtxoOperation {
+		return []*UtxoOperation{{
+			Type:             OperationTypeNFTSwap,
+			PrevNFTSwapEntry: &NFTSwapEntry{ProposerPKID: NewPKID(proposerPublicKey)},
+		}}
+	}
+	acceptSwapMeta := &NFTSwapMetadata{OperationType: NFTSwapOperationTypeAccept}
+	require.NoError(checkSpendingLimit(&BasicTransferMetadata{}, basicTransferUtxoOps(m3PkBytes)))
+	require.NoError(checkSpendingLimit(acceptSwapMeta, acceptSwapUtxoOps(m3PkBytes)))
+	err = checkSpendingLimit(&BasicTransferMetadata{}, basicTransferUtxoOps(m4PkBytes))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDerivedKeyRecipientNotWhitelisted)
+	err = checkSpendingLimit(acceptSwapMeta, acceptSwapUtxoOps(m4PkBytes))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorDerivedKeyRecipientNotWhitelisted)
+}
@@ -0,0 +1,680 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_escrow.go implements EscrowEntries, which hold DESO or a DAO coin on behalf of
+// their owner until they're released to a beneficiary or refunded. Features that escrow funds
+// lock them in an EscrowEntry instead of moving balances themselves, so the accounting, and
+// reverting it, is the same for all of them:
+//
+//   - _lockEscrow takes the escrow's amount out of its owner's balance and creates the escrow.
+//   - _releaseEscrow pays some or all of what's escrowed to its beneficiary, or to a recipient
+//     the feature chooses if the escrow doesn't have one, e.g. the user who fills an open offer.
+//     The escrow is removed once all of it is released.
+//   - _refundEscrow returns what's left in the escrow to its owner and removes the escrow.
+//
+// Each of them returns an OperationTypeEscrow UtxoOperation, which the feature adds to the
+// txn's UtxoOperations before its own. When the feature's txn is disconnected, it reverts
+// its own operation first and then passes the remaining UtxoOperations to
+// _disconnectEscrowOperations, which reverts the escrow operations at the end of them.
+//
+// The feature decides who can release or refund an escrow, since that depends on what the
+// escrow backs. The escrow only enforces its own release conditions: it can only be released
+// through its ExpirationBlockHeight, and it can only be refunded before then if it's
+// RefundableBeforeExpiration.
+//
+// Like locked balances, escrowed DAO coins don't count towards the coin's
+// CoinsInCirculationNanos until they're released or refunded. DAO coin streams predate
+// EscrowEntries and escrow their totals themselves, since what they pay out accrues per block.
+//
+// NFT swaps are the only feature that escrows funds so far. NFT bids and DAO coin limit orders
+// don't hold anything: the bidder's or the transactor's balance is only checked when the bid
+// is accepted or the order is matched, and an order that can't be paid for is removed then.
+// Escrowing them would change what placing a bid or an order commits the user to, so moving
+// them onto EscrowEntries needs its own fork height rather than being a refactor.
+
+//
+// TYPES: EscrowEntry
+//
+
+type EscrowEntry struct {
+	// EscrowID is usually the hash of the txn that created what the escrow backs, like a
+	// swap's SwapID, so that the escrow can be found from it.
+	EscrowID  *BlockHash
+	OwnerPKID *PKID
+	// BeneficiaryPKID is the only user the escrow can be released to. If it's nil, the escrow
+	// can be released to anyone the feature chooses.
+	BeneficiaryPKID *PKID
+	// AssetCreatorPKID is the PKID of the profile whose DAO coin is escrowed, or ZeroPKID if
+	// DESO is escrowed.
+	AssetCreatorPKID *PKID
+	// AmountBaseUnits is the amount that's still escrowed, in nanos for DESO.
+	AmountBaseUnits *uint256.Int
+
+	// ExpirationBlockHeight is the last block height at which the escrow can be released.
+	// Zero means the escrow doesn't expire.
+	ExpirationBlockHeight uint64
+	// RefundableBeforeExpiration allows the escrow to be refunded before it expires.
+	// Otherwise, its owner is committed to it through ExpirationBlockHeight.
+	RefundableBeforeExpiration bool
+
+	isDeleted bool
+}
+
+func (entry *EscrowEntry) Copy() *EscrowEntry {
+	var beneficiaryPKID *PKID
+	if entry.BeneficiaryPKID != nil {
+		beneficiaryPKID = entry.BeneficiaryPKID.NewPKID()
+	}
+	return &EscrowEntry{
+		EscrowID:                   entry.EscrowID.NewBlockHash(),
+		OwnerPKID:                  entry.OwnerPKID.NewPKID(),
+		BeneficiaryPKID:            beneficiaryPKID,
+		AssetCreatorPKID:           entry.AssetCreatorPKID.NewPKID(),
+		AmountBaseUnits:            entry.AmountBaseUnits.Clone(),
+		ExpirationBlockHeight:      entry.ExpirationBlockHeight,
+		RefundableBeforeExpiration: entry.RefundableBeforeExpiration,
+		isDeleted:                  entry.isDeleted,
+	}
+}
+
+// IsDESO returns true if the escrow holds DESO rather than a DAO coin.
+func (entry *EscrowEntry) IsDESO() bool {
+	return entry.AssetCreatorPKID.IsZeroPKID()
+}
+
+// IsExpired returns true if the escrow can no longer be released at blockHeight.
+func (entry *EscrowEntry) IsExpired(blockHeight uint64) bool {
+	return entry.ExpirationBlockHeight != 0 && blockHeight > entry.ExpirationBlockHeight
+}
+
+// CanRefund returns true if the escrow can be refunded to its owner at blockHeight.
+func (entry *EscrowEntry) CanRefund(blockHeight uint64) bool {
+	return entry.RefundableBeforeExpiration || entry.IsExpired(blockHeight)
+}
+
+func (entry *EscrowEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.EscrowID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.OwnerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.BeneficiaryPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.AssetCreatorPKID, skipMetadata...)...)
+	data = append(data, VariableEncodeUint256(entry.AmountBaseUnits)...)
+	data = append(data, UintToBuf(entry.ExpirationBlockHeight)...)
+	data = append(data, BoolToByte(entry.RefundableBeforeExpiration))
+	return data
+}
+
+func (entry *EscrowEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// EscrowID
+	entry.EscrowID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "EscrowEntry.Decode: Problem reading EscrowID: ")
+	}
+
+	// OwnerPKID
+	entry.OwnerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "EscrowEntry.Decode: Problem reading OwnerPKID: ")
+	}
+
+	// BeneficiaryPKID
+	entry.BeneficiaryPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "EscrowEntry.Decode: Problem reading BeneficiaryPKID: ")
+	}
+
+	// AssetCreatorPKID
+	entry.AssetCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "EscrowEntry.Decode: Problem reading AssetCreatorPKID: ")
+	}
+
+	// AmountBaseUnits
+	entry.AmountBaseUnits, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EscrowEntry.Decode: Problem reading AmountBaseUnits: ")
+	}
+
+	// ExpirationBlockHeight
+	entry.ExpirationBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EscrowEntry.Decode: Problem reading ExpirationBlockHeight: ")
+	}
+
+	// RefundableBeforeExpiration
+	entry.RefundableBeforeExpiration, err = ReadBoolByte(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EscrowEntry.Decode: Problem reading RefundableBeforeExpiration: ")
+	}
+
+	return nil
+}
+
+func (entry *EscrowEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *EscrowEntry) GetEncoderType() EncoderType {
+	return EncoderTypeEscrowEntry
+}
+
+type EscrowOperationType uint8
+
+const (
+	EscrowOperationTypeLock    EscrowOperationType = 0
+	EscrowOperationTypeRelease EscrowOperationType = 1
+	EscrowOperationTypeRefund  EscrowOperationType = 2
+)
+
+//
+// DB UTILS
+//
+
+func DBKeyForEscrowEntry(escrowID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixEscrowByID...)
+	key = append(key, escrowID[:]...)
+	return key
+}
+
+func DBKeyForEscrowByOwnerPKID(ownerPKID *PKID, escrowID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixEscrowIDByOwnerPKID...)
+	key = append(key, ownerPKID.ToBytes()...)
+	key = append(key, escrowID[:]...)
+	return key
+}
+
+func DBGetEscrowEntry(handle *badger.DB, snap *Snapshot, escrowID *BlockHash) (*EscrowEntry, error) {
+	var ret *EscrowEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetEscrowEntryWithTxn(txn, snap, escrowID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetEscrowEntryWithTxn(txn *badger.Txn, snap *Snapshot, escrowID *BlockHash) (*EscrowEntry, error) {
+	// Retrieve EscrowEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForEscrowEntry(escrowID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetEscrowEntry: problem retrieving EscrowEntry: ")
+	}
+
+	// Decode EscrowEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&EscrowEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetEscrowEntry: problem decoding EscrowEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetEscrowEntriesForOwnerPKID returns the escrows the user owns.
+func DBGetEscrowEntriesForOwnerPKID(handle *badger.DB, snap *Snapshot, ownerPKID *PKID) ([]*EscrowEntry, error) {
+	prefix := append([]byte{}, Prefixes.PrefixEscrowIDByOwnerPKID...)
+	prefix = append(prefix, ownerPKID.ToBytes()...)
+	keysFound, _ := EnumerateKeysForPrefix(handle, prefix, true)
+
+	var entries []*EscrowEntry
+	for _, key := range keysFound {
+		if len(key) != len(prefix)+HashSizeBytes {
+			return nil, fmt.Errorf("DBGetEscrowEntriesForOwnerPKID: invalid index key length %d", len(key))
+		}
+		escrowID := NewBlockHash(key[len(prefix):])
+		entry, err := DBGetEscrowEntry(handle, snap, escrowID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetEscrowEntriesForOwnerPKID: ")
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("DBGetEscrowEntriesForOwnerPKID: escrow %v is indexed but "+
+				"doesn't exist", escrowID)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutEscrowEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *EscrowEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForEscrowEntry(entry.EscrowID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutEscrowEntryWithTxn: problem storing EscrowEntry: ")
+	}
+	indexKey := DBKeyForEscrowByOwnerPKID(entry.OwnerPKID, entry.EscrowID)
+	if err := DBSetWithTxn(txn, snap, indexKey, []byte{}, eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutEscrowEntryWithTxn: problem storing escrow index: ")
+	}
+	return nil
+}
+
+func DBDeleteEscrowEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *EscrowEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForEscrowEntry(entry.EscrowID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteEscrowEntryWithTxn: problem deleting EscrowEntry: ")
+	}
+	indexKey := DBKeyForEscrowByOwnerPKID(entry.OwnerPKID, entry.EscrowID)
+	if err := DBDeleteWithTxn(txn, snap, indexKey, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteEscrowEntryWithTxn: problem deleting escrow index: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetEscrowEntry returns the escrow, or nil if it doesn't exist.
+func (bav *UtxoView) GetEscrowEntry(escrowID *BlockHash) (*EscrowEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.EscrowIDToEscrowEntry[*escrowID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetEscrowEntry(escrowID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetEscrowEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the EscrowEntry from the db in the UtxoView.
+		bav._setEscrowEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetEscrowEntriesForOwnerPKID returns the escrows the user owns, including the escrows in
+// the view.
+func (bav *UtxoView) GetEscrowEntriesForOwnerPKID(ownerPKID *PKID) ([]*EscrowEntry, error) {
+	dbEntries, err := bav.GetDbAdapter().GetEscrowEntriesForOwnerPKID(ownerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetEscrowEntriesForOwnerPKID: ")
+	}
+	for _, dbEntry := range dbEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		if _, exists := bav.EscrowIDToEscrowEntry[*dbEntry.EscrowID]; !exists {
+			bav._setEscrowEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*EscrowEntry
+	for _, entry := range bav.EscrowIDToEscrowEntry {
+		if !entry.isDeleted && entry.OwnerPKID.Eq(ownerPKID) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (bav *UtxoView) _setEscrowEntryMappings(entry *EscrowEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setEscrowEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.EscrowIDToEscrowEntry[*entry.EscrowID] = entry
+}
+
+func (bav *UtxoView) _deleteEscrowEntryMappings(entry *EscrowEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteEscrowEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setEscrowEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushEscrowEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Delete every escrow in the view first, since an escrow's index has to be removed along
+	// with it. The escrows that aren't deleted are put back below.
+	for mapKeyIter, entryIter := range bav.EscrowIDToEscrowEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.EscrowID.IsEqual(&mapKey) {
+			return fmt.Errorf("_flushEscrowEntriesToDbWithTxn: EscrowEntry EscrowID %v "+
+				"doesn't match MapKey %v", entry.EscrowID, &mapKey)
+		}
+
+		if err := DBDeleteEscrowEntryWithTxn(
+			txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+		); err != nil {
+			return errors.Wrapf(err, "_flushEscrowEntriesToDbWithTxn: ")
+		}
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutEscrowEntryWithTxn(
+			txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushEscrowEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+// _lockEscrow takes the escrow's AmountBaseUnits out of its owner's balance and creates it.
+func (bav *UtxoView) _lockEscrow(entry *EscrowEntry, blockHeight uint32) (*UtxoOperation, error) {
+	if entry.EscrowID == nil || entry.OwnerPKID == nil || entry.AssetCreatorPKID == nil ||
+		entry.AmountBaseUnits == nil {
+		return nil, fmt.Errorf("_lockEscrow: EscrowID, OwnerPKID, AssetCreatorPKID, and " +
+			"AmountBaseUnits must be set")
+	}
+	if entry.AmountBaseUnits.IsZero() {
+		return nil, RuleErrorEscrowZeroAmount
+	}
+	if entry.ExpirationBlockHeight != 0 && entry.ExpirationBlockHeight < uint64(blockHeight) {
+		return nil, errors.Wrapf(RuleErrorEscrowExpirationInPast,
+			"_lockEscrow: expiration %d < block height %d", entry.ExpirationBlockHeight, blockHeight)
+	}
+	// An escrow that can't be refunded before it expires has to expire, or its funds could
+	// be stuck in it forever.
+	if entry.ExpirationBlockHeight == 0 && !entry.RefundableBeforeExpiration {
+		return nil, RuleErrorEscrowNeverRefundable
+	}
+	existingEntry, err := bav.GetEscrowEntry(entry.EscrowID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_lockEscrow: ")
+	}
+	if existingEntry != nil {
+		return nil, errors.Wrapf(RuleErrorEscrowAlreadyExists, "_lockEscrow: %v", entry.EscrowID)
+	}
+
+	newEntry := entry.Copy()
+	newEntry.isDeleted = false
+	utxoOp := &UtxoOperation{
+		Type:                  OperationTypeEscrow,
+		EscrowOperationType:   EscrowOperationTypeLock,
+		PrevEscrowEntry:       newEntry.Copy(),
+		EscrowAmountBaseUnits: newEntry.AmountBaseUnits.Clone(),
+	}
+	if err = bav._moveEscrowedFunds(newEntry, newEntry.OwnerPKID, newEntry.AmountBaseUnits,
+		false, blockHeight, utxoOp); err != nil {
+		return nil, errors.Wrapf(err, "_lockEscrow: ")
+	}
+	bav._setEscrowEntryMappings(newEntry)
+	return utxoOp, nil
+}
+
+// _releaseEscrow pays amountBaseUnits of the escrow to the recipient. The recipient has to be
+// the escrow's beneficiary if it has one.
+func (bav *UtxoView) _releaseEscrow(escrowID *BlockHash, recipientPKID *PKID, amountBaseUnits *uint256.Int,
+	blockHeight uint32) (*UtxoOperation, error) {
+
+	entry, err := bav._getEscrowEntryForOperation(escrowID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_releaseEscrow: ")
+	}
+	if entry.IsExpired(uint64(blockHeight)) {
+		return nil, errors.Wrapf(RuleErrorEscrowExpired,
+			"_releaseEscrow: block height %d > expiration %d", blockHeight, entry.ExpirationBlockHeight)
+	}
+	if recipientPKID == nil || (entry.BeneficiaryPKID != nil && !entry.BeneficiaryPKID.Eq(recipientPKID)) {
+		return nil, RuleErrorEscrowInvalidRecipient
+	}
+	if amountBaseUnits == nil || amountBaseUnits.IsZero() {
+		return nil, RuleErrorEscrowZeroAmount
+	}
+	if amountBaseUnits.Gt(entry.AmountBaseUnits) {
+		return nil, errors.Wrapf(RuleErrorEscrowReleaseExceedsAmount,
+			"_releaseEscrow: %v > escrowed %v", amountBaseUnits, entry.AmountBaseUnits)
+	}
+
+	utxoOp := &UtxoOperation{
+		Type:                  OperationTypeEscrow,
+		EscrowOperationType:   EscrowOperationTypeRelease,
+		PrevEscrowEntry:       entry.Copy(),
+		EscrowRecipientPKID:   recipientPKID.NewPKID(),
+		EscrowAmountBaseUnits: amountBaseUnits.Clone(),
+	}
+	if err = bav._moveEscrowedFunds(entry, recipientPKID, amountBaseUnits, true, blockHeight, utxoOp); err != nil {
+		return nil, errors.Wrapf(err, "_releaseEscrow: ")
+	}
+
+	// The escrow is finished once all of it is released.
+	newEntry := entry.Copy()
+	newEntry.AmountBaseUnits = uint256.NewInt().Sub(entry.AmountBaseUnits, amountBaseUnits)
+	if newEntry.AmountBaseUnits.IsZero() {
+		bav._deleteEscrowEntryMappings(entry)
+	} else {
+		bav._setEscrowEntryMappings(newEntry)
+	}
+	return utxoOp, nil
+}
+
+// _refundEscrow returns what's left in the escrow to its owner and removes the escrow.
+func (bav *UtxoView) _refundEscrow(escrowID *BlockHash, blockHeight uint32) (*UtxoOperation, error) {
+	entry, err := bav._getEscrowEntryForOperation(escrowID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_refundEscrow: ")
+	}
+	if !entry.CanRefund(uint64(blockHeight)) {
+		return nil, errors.Wrapf(RuleErrorEscrowNotRefundable,
+			"_refundEscrow: block height %d <= expiration %d", blockHeight, entry.ExpirationBlockHeight)
+	}
+
+	utxoOp := &UtxoOperation{
+		Type:                  OperationTypeEscrow,
+		EscrowOperationType:   EscrowOperationTypeRefund,
+		PrevEscrowEntry:       entry.Copy(),
+		EscrowRecipientPKID:   entry.OwnerPKID.NewPKID(),
+		EscrowAmountBaseUnits: entry.AmountBaseUnits.Clone(),
+	}
+	if err = bav._moveEscrowedFunds(entry, entry.OwnerPKID, entry.AmountBaseUnits, true, blockHeight, utxoOp); err != nil {
+		return nil, errors.Wrapf(err, "_refundEscrow: ")
+	}
+	bav._deleteEscrowEntryMappings(entry)
+	return utxoOp, nil
+}
+
+func (bav *UtxoView) _getEscrowEntryForOperation(escrowID *BlockHash) (*EscrowEntry, error) {
+	if escrowID == nil {
+		return nil, errors.Wrapf(RuleErrorEscrowNotFound, "_getEscrowEntryForOperation: EscrowID is unset")
+	}
+	entry, err := bav.GetEscrowEntry(escrowID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getEscrowEntryForOperation: ")
+	}
+	if entry == nil {
+		return nil, errors.Wrapf(RuleErrorEscrowNotFound, "_getEscrowEntryForOperation: %v", escrowID)
+	}
+	return entry, nil
+}
+
+// _moveEscrowedFunds credits the escrow's asset to a user when it leaves the escrow, or debits
+// it from them when it enters the escrow. The DAO coin balance and coin entry prior to the
+// move are saved in the utxoOp so that it can be reverted.
+func (bav *UtxoView) _moveEscrowedFunds(entry *EscrowEntry, userPKID *PKID, amountBaseUnits *uint256.Int,
+	isCredit bool, blockHeight uint32, utxoOp *UtxoOperation) error {
+
+	if entry.IsDESO() {
+		if !amountBaseUnits.IsUint64() {
+			return errors.Wrapf(RuleErrorEscrowAmountTooLarge, "_moveEscrowedFunds: %v", amountBaseUnits)
+		}
+		publicKey := bav.GetPublicKeyForPKID(userPKID)
+		if isCredit {
+			if _, err := bav._addBalance(amountBaseUnits.Uint64(), publicKey); err != nil {
+				return errors.Wrapf(err, "_moveEscrowedFunds: ")
+			}
+			return nil
+		}
+		// We assume the tip is right before the block in which this txn is about to be applied.
+		spendableBalanceNanos, err := bav.GetSpendableDeSoBalanceNanosForPublicKey(publicKey, blockHeight-1)
+		if err != nil {
+			return errors.Wrapf(err, "_moveEscrowedFunds: Problem getting balance: ")
+		}
+		if spendableBalanceNanos < amountBaseUnits.Uint64() {
+			return errors.Wrapf(RuleErrorEscrowInsufficientBalance,
+				"_moveEscrowedFunds: balance %d < amount %v", spendableBalanceNanos, amountBaseUnits)
+		}
+		if _, err = bav._spendBalance(amountBaseUnits.Uint64(), publicKey, blockHeight-1); err != nil {
+			return errors.Wrapf(err, "_moveEscrowedFunds: ")
+		}
+		return nil
+	}
+
+	profileEntry := bav.GetProfileEntryForPKID(entry.AssetCreatorPKID)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return errors.Wrapf(RuleErrorEscrowOnNonexistentProfile, "_moveEscrowedFunds: %v", entry.AssetCreatorPKID)
+	}
+	balanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(userPKID, entry.AssetCreatorPKID, true)
+	if balanceEntry == nil || balanceEntry.isDeleted {
+		balanceEntry = &BalanceEntry{
+			HODLerPKID:   userPKID.NewPKID(),
+			CreatorPKID:  entry.AssetCreatorPKID.NewPKID(),
+			BalanceNanos: *uint256.NewInt(),
+		}
+	}
+	utxoOp.PrevCoinEntry = profileEntry.DAOCoinEntry.Copy()
+	utxoOp.PrevBalanceEntries = map[PKID]map[PKID]*BalanceEntry{
+		*userPKID: {*entry.AssetCreatorPKID: balanceEntry.Copy()},
+	}
+
+	newBalanceEntry := balanceEntry.Copy()
+	coinEntry := &profileEntry.DAOCoinEntry
+	if isCredit {
+		newBalanceEntry.BalanceNanos = *uint256.NewInt().Add(&balanceEntry.BalanceNanos, amountBaseUnits)
+		coinEntry.CoinsInCirculationNanos = *uint256.NewInt().Add(&coinEntry.CoinsInCirculationNanos, amountBaseUnits)
+		if balanceEntry.BalanceNanos.IsZero() {
+			coinEntry.NumberOfHolders++
+		}
+	} else {
+		if amountBaseUnits.Gt(&balanceEntry.BalanceNanos) {
+			return errors.Wrapf(RuleErrorEscrowInsufficientBalance,
+				"_moveEscrowedFunds: %v exceeds balance %v", amountBaseUnits, &balanceEntry.BalanceNanos)
+		}
+		if amountBaseUnits.Gt(&coinEntry.CoinsInCirculationNanos) {
+			return fmt.Errorf("_moveEscrowedFunds: %v exceeds coins in circulation %v",
+				amountBaseUnits, &coinEntry.CoinsInCirculationNanos)
+		}
+		newBalanceEntry.BalanceNanos = *uint256.NewInt().Sub(&balanceEntry.BalanceNanos, amountBaseUnits)
+		coinEntry.CoinsInCirculationNanos = *uint256.NewInt().Sub(&coinEntry.CoinsInCirculationNanos, amountBaseUnits)
+		if newBalanceEntry.BalanceNanos.IsZero() && !balanceEntry.BalanceNanos.IsZero() {
+			coinEntry.NumberOfHolders--
+		}
+	}
+	bav._setDAOCoinBalanceEntryMappings(newBalanceEntry)
+	bav._setProfileEntryMappings(profileEntry)
+	return nil
+}
+
+// _disconnectEscrowOperations reverts the escrow operations at the end of utxoOpsForTxn and
+// returns the UtxoOperations before them.
+func (bav *UtxoView) _disconnectEscrowOperations(utxoOpsForTxn []*UtxoOperation) ([]*UtxoOperation, error) {
+	for len(utxoOpsForTxn) > 0 && utxoOpsForTxn[len(utxoOpsForTxn)-1].Type == OperationTypeEscrow {
+		if err := bav._disconnectEscrowOperation(utxoOpsForTxn[len(utxoOpsForTxn)-1]); err != nil {
+			return nil, errors.Wrapf(err, "_disconnectEscrowOperations: ")
+		}
+		utxoOpsForTxn = utxoOpsForTxn[:len(utxoOpsForTxn)-1]
+	}
+	return utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectEscrowOperation(utxoOp *UtxoOperation) error {
+	prevEntry := utxoOp.PrevEscrowEntry
+	if prevEntry == nil || utxoOp.EscrowAmountBaseUnits == nil {
+		return fmt.Errorf("_disconnectEscrowOperation: escrow entry or amount is missing; " +
+			"this should never happen")
+	}
+
+	// Revert the escrow. A lock created it, so it's removed, and a release or refund changed
+	// or removed it, so the escrow prior to the operation is put back.
+	var userPKID *PKID
+	switch utxoOp.EscrowOperationType {
+	case EscrowOperationTypeLock:
+		entry, err := bav.GetEscrowEntry(prevEntry.EscrowID)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectEscrowOperation: ")
+		}
+		if entry == nil {
+			return fmt.Errorf("_disconnectEscrowOperation: locked escrow %v not found", prevEntry.EscrowID)
+		}
+		bav._deleteEscrowEntryMappings(entry)
+		userPKID = prevEntry.OwnerPKID
+	case EscrowOperationTypeRelease, EscrowOperationTypeRefund:
+		if utxoOp.EscrowRecipientPKID == nil {
+			return fmt.Errorf("_disconnectEscrowOperation: recipient is missing; this should never happen")
+		}
+		bav._setEscrowEntryMappings(prevEntry.Copy())
+		userPKID = utxoOp.EscrowRecipientPKID
+	default:
+		return fmt.Errorf("_disconnectEscrowOperation: invalid operation type %d", utxoOp.EscrowOperationType)
+	}
+
+	// Revert the funds.
+	if prevEntry.IsDESO() {
+		if !utxoOp.EscrowAmountBaseUnits.IsUint64() {
+			return fmt.Errorf("_disconnectEscrowOperation: DESO amount %v overflows", utxoOp.EscrowAmountBaseUnits)
+		}
+		publicKey := bav.GetPublicKeyForPKID(userPKID)
+		if utxoOp.EscrowOperationType == EscrowOperationTypeLock {
+			return bav._unSpendBalance(utxoOp.EscrowAmountBaseUnits.Uint64(), publicKey)
+		}
+		return bav._unAddBalance(utxoOp.EscrowAmountBaseUnits.Uint64(), publicKey)
+	}
+
+	// A user who didn't have a balance before the operation is deleted.
+	for _, creatorPKIDToBalanceEntry := range utxoOp.PrevBalanceEntries {
+		for _, balanceEntry := range creatorPKIDToBalanceEntry {
+			if balanceEntry.BalanceNanos.IsZero() {
+				bav._deleteBalanceEntryMappingsWithPKIDs(
+					balanceEntry, balanceEntry.HODLerPKID, balanceEntry.CreatorPKID, true)
+			} else {
+				bav._setDAOCoinBalanceEntryMappings(balanceEntry)
+			}
+		}
+	}
+	if utxoOp.PrevCoinEntry == nil {
+		return fmt.Errorf("_disconnectEscrowOperation: missing the previous coin entry")
+	}
+	profileEntry := bav.GetProfileEntryForPKID(prevEntry.AssetCreatorPKID)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return fmt.Errorf("_disconnectEscrowOperation: profile %v not found", prevEntry.AssetCreatorPKID)
+	}
+	profileEntry.DAOCoinEntry = *utxoOp.PrevCoinEntry
+	bav._setProfileEntryMappings(profileEntry)
+	return nil
+}
@@ -0,0 +1,121 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscrowEntry(t *testing.T) {
+	require := require.New(t)
+
+	entry := &EscrowEntry{
+		EscrowID:              NewBlockHash(RandomBytes(HashSizeBytes)),
+		OwnerPKID:             NewPKID(m0PkBytes),
+		AssetCreatorPKID:      &ZeroPKID,
+		AmountBaseUnits:       uint256.NewInt().SetUint64(1000),
+		ExpirationBlockHeight: 10,
+	}
+	require.True(entry.IsDESO())
+	require.False(entry.IsExpired(10))
+	require.True(entry.IsExpired(11))
+	// An escrow that isn't RefundableBeforeExpiration can only be refunded once it expires.
+	require.False(entry.CanRefund(10))
+	require.True(entry.CanRefund(11))
+	entry.RefundableBeforeExpiration = true
+	require.True(entry.CanRefund(10))
+
+	// The entry round-trips with and without a beneficiary.
+	for _, beneficiaryPKID := range []*PKID{nil, NewPKID(m1PkBytes)} {
+		entry.BeneficiaryPKID = beneficiaryPKID
+		decodedEntry, err := DecodeDeSoEncoder(&EscrowEntry{}, bytes.NewReader(EncodeToBytes(0, entry)))
+		require.NoError(err)
+		require.Equal(entry, decodedEntry)
+		require.Equal(entry, entry.Copy())
+	}
+}
+
+func TestEscrowLockReleaseAndRefund(t *testing.T) {
+	require := require.New(t)
+
+	_, params, db := NewLowDifficultyBlockchain(t)
+	utxoView := NewUtxoView(db, params, nil, nil, nil)
+	utxoView.PublicKeyToDeSoBalanceNanos[*NewPublicKey(m0PkBytes)] = 1000
+	getBalance := func(publicKey []byte) uint64 {
+		balanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(publicKey)
+		require.NoError(err)
+		return balanceNanos
+	}
+
+	ownerPKID := NewPKID(m0PkBytes)
+	beneficiaryPKID := NewPKID(m1PkBytes)
+	escrowID := NewBlockHash(RandomBytes(HashSizeBytes))
+	blockHeight := uint32(1)
+	var utxoOps []*UtxoOperation
+
+	// The owner can't escrow more than they hold.
+	_, err := utxoView._lockEscrow(&EscrowEntry{
+		EscrowID:                   escrowID,
+		OwnerPKID:                  ownerPKID,
+		BeneficiaryPKID:            beneficiaryPKID,
+		AssetCreatorPKID:           &ZeroPKID,
+		AmountBaseUnits:            uint256.NewInt().SetUint64(1001),
+		RefundableBeforeExpiration: true,
+	}, blockHeight)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorEscrowInsufficientBalance)
+
+	utxoOp, err := utxoView._lockEscrow(&EscrowEntry{
+		EscrowID:                   escrowID,
+		OwnerPKID:                  ownerPKID,
+		BeneficiaryPKID:            beneficiaryPKID,
+		AssetCreatorPKID:           &ZeroPKID,
+		AmountBaseUnits:            uint256.NewInt().SetUint64(600),
+		RefundableBeforeExpiration: true,
+	}, blockHeight)
+	require.NoError(err)
+	utxoOps = append(utxoOps, utxoOp)
+	require.Equal(uint64(400), getBalance(m0PkBytes))
+	ownedEntries, err := utxoView.GetEscrowEntriesForOwnerPKID(ownerPKID)
+	require.NoError(err)
+	require.Len(ownedEntries, 1)
+
+	// Only the beneficiary can be paid, and only up to what's escrowed.
+	_, err = utxoView._releaseEscrow(escrowID, ownerPKID, uint256.NewInt().SetUint64(100), blockHeight)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorEscrowInvalidRecipient)
+	_, err = utxoView._releaseEscrow(escrowID, beneficiaryPKID, uint256.NewInt().SetUint64(601), blockHeight)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorEscrowReleaseExceedsAmount)
+
+	// Release part of the escrow and refund the rest.
+	utxoOp, err = utxoView._releaseEscrow(escrowID, beneficiaryPKID, uint256.NewInt().SetUint64(250), blockHeight)
+	require.NoError(err)
+	utxoOps = append(utxoOps, utxoOp)
+	require.Equal(uint64(250), getBalance(m1PkBytes))
+	entry, err := utxoView.GetEscrowEntry(escrowID)
+	require.NoError(err)
+	require.Equal(uint256.NewInt().SetUint64(350), entry.AmountBaseUnits)
+
+	utxoOp, err = utxoView._refundEscrow(escrowID, blockHeight)
+	require.NoError(err)
+	utxoOps = append(utxoOps, utxoOp)
+	require.Equal(uint64(750), getBalance(m0PkBytes))
+	entry, err = utxoView.GetEscrowEntry(escrowID)
+	require.NoError(err)
+	require.Nil(entry)
+
+	// Disconnecting the operations restores the balances and removes the escrow.
+	remainingUtxoOps, err := utxoView._disconnectEscrowOperations(utxoOps)
+	require.NoError(err)
+	require.Empty(remainingUtxoOps)
+	require.Equal(uint64(1000), getBalance(m0PkBytes))
+	require.Equal(uint64(0), getBalance(m1PkBytes))
+	entry, err = utxoView.GetEscrowEntry(escrowID)
+	require.NoError(err)
+	require.Nil(entry)
+}
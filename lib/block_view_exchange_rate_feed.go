@@ -0,0 +1,405 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_view_exchange_rate_feed.go lets the USDCentsPerBitcoin exchange rate be fed by
+// several independent keys instead of a single updater. The ParamUpdater registers feed
+// keys through UpdateGlobalParams, and each feed key submits its own rate with an
+// UpdateBitcoinUSDExchangeRate txn. Whenever a feed key submits, the exchange rate in the
+// GlobalParamsEntry is set to the median of the fresh submissions that agree with each
+// other, so a single stale or misbehaving feed can't move the price on its own.
+//
+// Note that submissions are only aggregated when a feed key submits. If every feed stops
+// submitting, the exchange rate stays at the last aggregated value. The ParamUpdater can
+// still override the exchange rate with an UpdateGlobalParams txn.
+
+//
+// TYPES: ExchangeRateFeedEntry
+//
+
+type ExchangeRateFeedEntry struct {
+	// PublicKey is the public key the feed signs its UpdateBitcoinUSDExchangeRate txns with.
+	PublicKey []byte
+	// USDCentsPerBitcoin is the last rate the feed submitted, or zero if it hasn't
+	// submitted a rate since it was registered.
+	USDCentsPerBitcoin uint64
+	// SubmittedAtBlockHeight is the height of the block the last rate was submitted in.
+	SubmittedAtBlockHeight uint64
+
+	isDeleted bool
+}
+
+func (entry *ExchangeRateFeedEntry) Copy() *ExchangeRateFeedEntry {
+	return &ExchangeRateFeedEntry{
+		PublicKey:              append([]byte{}, entry.PublicKey...),
+		USDCentsPerBitcoin:     entry.USDCentsPerBitcoin,
+		SubmittedAtBlockHeight: entry.SubmittedAtBlockHeight,
+		isDeleted:              entry.isDeleted,
+	}
+}
+
+func (entry *ExchangeRateFeedEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeByteArray(entry.PublicKey)...)
+	data = append(data, UintToBuf(entry.USDCentsPerBitcoin)...)
+	data = append(data, UintToBuf(entry.SubmittedAtBlockHeight)...)
+	return data
+}
+
+func (entry *ExchangeRateFeedEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// PublicKey
+	entry.PublicKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ExchangeRateFeedEntry.Decode: Problem reading PublicKey: ")
+	}
+
+	// USDCentsPerBitcoin
+	entry.USDCentsPerBitcoin, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ExchangeRateFeedEntry.Decode: Problem reading USDCentsPerBitcoin: ")
+	}
+
+	// SubmittedAtBlockHeight
+	entry.SubmittedAtBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ExchangeRateFeedEntry.Decode: Problem reading SubmittedAtBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (entry *ExchangeRateFeedEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *ExchangeRateFeedEntry) GetEncoderType() EncoderType {
+	return EncoderTypeExchangeRateFeedEntry
+}
+
+//
+// AGGREGATION
+//
+
+// ComputeExchangeRateFeedMedian aggregates the rates submitted by the feeds at the given
+// block height. Submissions older than ExchangeRateFeedMaxAgeBlocks are ignored. The median
+// of the remaining submissions is computed, the submissions that deviate from it by more
+// than ExchangeRateFeedMaxDeviationBasisPoints are discarded, and the median of the
+// submissions that are left is returned. If fewer than ExchangeRateFeedMinSubmissions
+// submissions are fresh, or fewer than that agree with each other, false is returned and
+// the exchange rate shouldn't be updated.
+func ComputeExchangeRateFeedMedian(
+	feedEntries []*ExchangeRateFeedEntry,
+	blockHeight uint64,
+	globalParamsEntry *GlobalParamsEntry,
+) (_usdCentsPerBitcoin uint64, _ok bool) {
+
+	var freshRates []uint64
+	for _, feedEntry := range feedEntries {
+		if feedEntry.USDCentsPerBitcoin == 0 || feedEntry.SubmittedAtBlockHeight > blockHeight {
+			continue
+		}
+		if blockHeight-feedEntry.SubmittedAtBlockHeight > globalParamsEntry.ExchangeRateFeedMaxAgeBlocks {
+			continue
+		}
+		freshRates = append(freshRates, feedEntry.USDCentsPerBitcoin)
+	}
+	if uint64(len(freshRates)) < globalParamsEntry.ExchangeRateFeedMinSubmissions || len(freshRates) == 0 {
+		return 0, false
+	}
+	freshMedian := _medianOfUint64s(freshRates)
+
+	// Rates are capped at MaxUSDCentsPerBitcoin, so multiplying by MaxBasisPoints can't overflow.
+	var agreeingRates []uint64
+	for _, rate := range freshRates {
+		deviation := rate - freshMedian
+		if rate < freshMedian {
+			deviation = freshMedian - rate
+		}
+		if deviation*MaxBasisPoints > freshMedian*globalParamsEntry.ExchangeRateFeedMaxDeviationBasisPoints {
+			continue
+		}
+		agreeingRates = append(agreeingRates, rate)
+	}
+	if uint64(len(agreeingRates)) < globalParamsEntry.ExchangeRateFeedMinSubmissions || len(agreeingRates) == 0 {
+		return 0, false
+	}
+	return _medianOfUint64s(agreeingRates), true
+}
+
+// _medianOfUint64s returns the median of a non-empty slice, rounding down the mean of the
+// two middle values when the slice has an even length. The slice is sorted in place, and
+// its values must be small enough that adding two of them can't overflow.
+func _medianOfUint64s(vals []uint64) uint64 {
+	sort.Slice(vals, func(ii, jj int) bool {
+		return vals[ii] < vals[jj]
+	})
+	mid := len(vals) / 2
+	if len(vals)%2 == 1 {
+		return vals[mid]
+	}
+	return (vals[mid-1] + vals[mid]) / 2
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForExchangeRateFeedEntry(publicKey []byte) []byte {
+	key := append([]byte{}, Prefixes.PrefixExchangeRateFeedEntryByPublicKey...)
+	key = append(key, publicKey...)
+	return key
+}
+
+func DBGetExchangeRateFeedEntry(handle *badger.DB, snap *Snapshot, publicKey []byte) (*ExchangeRateFeedEntry, error) {
+	var ret *ExchangeRateFeedEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetExchangeRateFeedEntryWithTxn(txn, snap, publicKey)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetExchangeRateFeedEntryWithTxn(txn *badger.Txn, snap *Snapshot, publicKey []byte) (*ExchangeRateFeedEntry, error) {
+	// Retrieve ExchangeRateFeedEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForExchangeRateFeedEntry(publicKey))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetExchangeRateFeedEntry: problem retrieving ExchangeRateFeedEntry: ")
+	}
+
+	// Decode ExchangeRateFeedEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&ExchangeRateFeedEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetExchangeRateFeedEntry: problem decoding ExchangeRateFeedEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetAllExchangeRateFeedEntries returns every registered exchange rate feed. There are
+// only ever a handful of feeds, so we don't bother paginating.
+func DBGetAllExchangeRateFeedEntries(handle *badger.DB) ([]*ExchangeRateFeedEntry, error) {
+	_, valsFound := EnumerateKeysForPrefix(handle, Prefixes.PrefixExchangeRateFeedEntryByPublicKey, false)
+	var entries []*ExchangeRateFeedEntry
+	for _, entryBytes := range valsFound {
+		entry, err := DecodeDeSoEncoder(&ExchangeRateFeedEntry{}, bytes.NewReader(entryBytes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetAllExchangeRateFeedEntries: problem decoding ExchangeRateFeedEntry: ")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutExchangeRateFeedEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ExchangeRateFeedEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForExchangeRateFeedEntry(entry.PublicKey)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutExchangeRateFeedEntryWithTxn: problem storing ExchangeRateFeedEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteExchangeRateFeedEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ExchangeRateFeedEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForExchangeRateFeedEntry(entry.PublicKey)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteExchangeRateFeedEntryWithTxn: problem deleting ExchangeRateFeedEntry: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetExchangeRateFeedEntry returns the entry for the public key, or nil if the public key
+// isn't a registered exchange rate feed.
+func (bav *UtxoView) GetExchangeRateFeedEntry(publicKey []byte) (*ExchangeRateFeedEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.ExchangeRateFeedPublicKeyToEntry[MakePkMapKey(publicKey)]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetExchangeRateFeedEntry(publicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetExchangeRateFeedEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the ExchangeRateFeedEntry from the db in the UtxoView.
+		bav._setExchangeRateFeedEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetAllExchangeRateFeedEntries returns every registered exchange rate feed, sorted by
+// public key so that the result doesn't depend on map iteration order.
+func (bav *UtxoView) GetAllExchangeRateFeedEntries() ([]*ExchangeRateFeedEntry, error) {
+	// Load the entries from the db into the view without overwriting the entries the view
+	// has already modified.
+	dbEntries, err := bav.GetDbAdapter().GetAllExchangeRateFeedEntries()
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetAllExchangeRateFeedEntries: ")
+	}
+	for _, dbEntry := range dbEntries {
+		if _, exists := bav.ExchangeRateFeedPublicKeyToEntry[MakePkMapKey(dbEntry.PublicKey)]; !exists {
+			bav._setExchangeRateFeedEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*ExchangeRateFeedEntry
+	for _, entry := range bav.ExchangeRateFeedPublicKeyToEntry {
+		if entry.isDeleted {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		return bytes.Compare(entries[ii].PublicKey, entries[jj].PublicKey) < 0
+	})
+	return entries, nil
+}
+
+func (bav *UtxoView) _setExchangeRateFeedEntryMappings(entry *ExchangeRateFeedEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setExchangeRateFeedEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ExchangeRateFeedPublicKeyToEntry[MakePkMapKey(entry.PublicKey)] = entry
+}
+
+func (bav *UtxoView) _deleteExchangeRateFeedEntryMappings(entry *ExchangeRateFeedEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteExchangeRateFeedEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setExchangeRateFeedEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushExchangeRateFeedEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.ExchangeRateFeedPublicKeyToEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if MakePkMapKey(entry.PublicKey) != mapKey {
+			return fmt.Errorf(
+				"_flushExchangeRateFeedEntriesToDbWithTxn: ExchangeRateFeedEntry public key %v doesn't match MapKey %v",
+				PkToStringBoth(entry.PublicKey),
+				PkToStringBoth(mapKey[:]),
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteExchangeRateFeedEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushExchangeRateFeedEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutExchangeRateFeedEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushExchangeRateFeedEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// CONNECT LOGIC
+//
+
+// _connectExchangeRateFeedSubmission records the rate submitted by a registered feed key
+// in an UpdateBitcoinUSDExchangeRate txn, and then re-aggregates the exchange rate from all
+// of the feeds' fresh submissions.
+func (bav *UtxoView) _connectExchangeRateFeedSubmission(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool,
+	prevFeedEntry *ExchangeRateFeedEntry) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	txMeta := txn.TxnMeta.(*UpdateBitcoinUSDExchangeRateMetadataa)
+
+	// Connect basic txn to get the total input and the total output without
+	// considering the transaction metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectExchangeRateFeedSubmission: ")
+	}
+
+	// Record the feed's submission. Save the previous entry so it can be easily reverted.
+	prevFeedEntryCopy := prevFeedEntry.Copy()
+	newFeedEntry := prevFeedEntry.Copy()
+	newFeedEntry.USDCentsPerBitcoin = txMeta.USDCentsPerBitcoin
+	newFeedEntry.SubmittedAtBlockHeight = uint64(blockHeight)
+	bav._setExchangeRateFeedEntryMappings(newFeedEntry)
+
+	// Re-aggregate the exchange rate now that the feed's submission has changed. If the
+	// feeds don't agree, the exchange rate is left as it was.
+	feedEntries, err := bav.GetAllExchangeRateFeedEntries()
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectExchangeRateFeedSubmission: ")
+	}
+	prevGlobalParamsEntry := bav.GlobalParamsEntry
+	medianUSDCentsPerBitcoin, ok := ComputeExchangeRateFeedMedian(
+		feedEntries, uint64(blockHeight), bav.GetCurrentGlobalParamsEntry())
+	if ok {
+		newGlobalParamsEntry := *prevGlobalParamsEntry
+		newGlobalParamsEntry.USDCentsPerBitcoin = medianUSDCentsPerBitcoin
+		bav.GlobalParamsEntry = &newGlobalParamsEntry
+	}
+
+	// Save a UtxoOperation of type OperationTypeUpdateBitcoinUSDExchangeRate that will allow
+	// us to easily revert when we disconnect the transaction.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                      OperationTypeUpdateBitcoinUSDExchangeRate,
+		PrevUSDCentsPerBitcoin:    bav.USDCentsPerBitcoin,
+		PrevGlobalParamsEntry:     prevGlobalParamsEntry,
+		PrevExchangeRateFeedEntry: prevFeedEntryCopy,
+	})
+
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
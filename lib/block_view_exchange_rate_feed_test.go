@@ -0,0 +1,82 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeRateFeedMedian(t *testing.T) {
+	require := require.New(t)
+
+	globalParamsEntry := &GlobalParamsEntry{
+		ExchangeRateFeedMaxAgeBlocks:            10,
+		ExchangeRateFeedMaxDeviationBasisPoints: 500,
+		ExchangeRateFeedMinSubmissions:          3,
+	}
+	feedEntry := func(publicKey []byte, usdCentsPerBitcoin uint64, submittedAtBlockHeight uint64) *ExchangeRateFeedEntry {
+		return &ExchangeRateFeedEntry{
+			PublicKey:              publicKey,
+			USDCentsPerBitcoin:     usdCentsPerBitcoin,
+			SubmittedAtBlockHeight: submittedAtBlockHeight,
+		}
+	}
+
+	// Three fresh feeds that agree produce their median.
+	feedEntries := []*ExchangeRateFeedEntry{
+		feedEntry(m0PkBytes, 3000000, 100),
+		feedEntry(m1PkBytes, 3010000, 101),
+		feedEntry(m2PkBytes, 2990000, 102),
+	}
+	median, ok := ComputeExchangeRateFeedMedian(feedEntries, 105, globalParamsEntry)
+	require.True(ok)
+	require.Equal(uint64(3000000), median)
+
+	// A single bad feed is discarded as an outlier rather than moving the median.
+	feedEntries = append(feedEntries, feedEntry(m3PkBytes, 100000000, 103))
+	median, ok = ComputeExchangeRateFeedMedian(feedEntries, 105, globalParamsEntry)
+	require.True(ok)
+	require.Equal(uint64(3000000), median)
+
+	// Stale submissions and feeds that never submitted don't count.
+	feedEntries = append(feedEntries, feedEntry(m4PkBytes, 0, 0))
+	_, ok = ComputeExchangeRateFeedMedian(feedEntries, 111, globalParamsEntry)
+	require.False(ok)
+	median, ok = ComputeExchangeRateFeedMedian(feedEntries, 110, globalParamsEntry)
+	require.True(ok)
+	require.Equal(uint64(3000000), median)
+
+	// An even number of agreeing feeds produces the mean of the middle two.
+	globalParamsEntry.ExchangeRateFeedMinSubmissions = 2
+	median, ok = ComputeExchangeRateFeedMedian(feedEntries, 111, globalParamsEntry)
+	require.True(ok)
+	require.Equal(uint64(3000000), median)
+
+	// The feed registry is read back from the db sorted by public key, and deleting a feed
+	// in the view takes precedence over the db.
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	for _, entry := range feedEntries[:3] {
+		utxoView._setExchangeRateFeedEntryMappings(entry)
+	}
+	require.NoError(utxoView.FlushToDb(1))
+
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+	utxoView._deleteExchangeRateFeedEntryMappings(feedEntry(m1PkBytes, 0, 0))
+	dbFeedEntries, err := utxoView.GetAllExchangeRateFeedEntries()
+	require.NoError(err)
+	require.Len(dbFeedEntries, 2)
+	require.Equal(-1, bytes.Compare(dbFeedEntries[0].PublicKey, dbFeedEntries[1].PublicKey))
+	feedEntryFromDb, err := utxoView.GetExchangeRateFeedEntry(m2PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(2990000), feedEntryFromDb.USDCentsPerBitcoin)
+	require.Equal(uint64(102), feedEntryFromDb.SubmittedAtBlockHeight)
+	feedEntryFromDb, err = utxoView.GetExchangeRateFeedEntry(m1PkBytes)
+	require.NoError(err)
+	require.Nil(feedEntryFromDb)
+}
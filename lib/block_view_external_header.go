@@ -0,0 +1,1173 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	btcdchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_view_external_header.go lets registered relayers anchor the block headers of
+// external chains into DeSo state with the AnchorExternalHeaders txn. Anchored headers
+// are the foundation for cross-chain proofs: a bridge or exchange-rate feature can prove
+// that an external txn was included in a block by checking a merkle proof against the
+// anchored header, and can require a number of confirmations on top of it.
+//
+// Relayers are registered and removed by the ParamUpdater through UpdateGlobalParams.
+// Each chain has its own validation rules:
+//   - Bitcoin headers are the 80-byte serialized header. Their proof of work must meet
+//     the target in their own bits, and the target can't be easier than the network's
+//     PoW limit. Difficulty adjustments aren't re-derived, so relayers are trusted to
+//     anchor headers from the chain with the most work.
+//   - Ethereum headers are the RLP-encoded header, and their hash is the keccak256 hash
+//     of the encoding. Their number must match the height they're anchored at and their
+//     timestamp must be after their parent's.
+//
+// The first header anchored for a chain is a checkpoint and can be at any height. Every
+// header after that must extend a header that's already anchored. Headers on competing
+// forks of the external chain can all be anchored, and the tip of an external chain is
+// its highest anchored header.
+
+type ExternalChain uint8
+
+const (
+	ExternalChainUnset    ExternalChain = 0
+	ExternalChainBitcoin  ExternalChain = 1
+	ExternalChainEthereum ExternalChain = 2
+)
+
+func (externalChain ExternalChain) String() string {
+	switch externalChain {
+	case ExternalChainBitcoin:
+		return "Bitcoin"
+	case ExternalChainEthereum:
+		return "Ethereum"
+	default:
+		return "Unset"
+	}
+}
+
+//
+// TYPES: AnchorExternalHeadersMetadata
+//
+
+type AnchorExternalHeadersMetadata struct {
+	ExternalChain ExternalChain
+	// StartHeight is the height of the first header on the external chain. The remaining
+	// headers follow at consecutive heights.
+	StartHeight uint64
+	// Headers are the encoded external chain headers, in order. Each header must extend
+	// the one before it.
+	Headers [][]byte
+}
+
+func (txnData *AnchorExternalHeadersMetadata) GetTxnType() TxnType {
+	return TxnTypeAnchorExternalHeaders
+}
+
+func (txnData *AnchorExternalHeadersMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, byte(txnData.ExternalChain))
+	data = append(data, UintToBuf(txnData.StartHeight)...)
+	data = append(data, UintToBuf(uint64(len(txnData.Headers)))...)
+	for _, header := range txnData.Headers {
+		data = append(data, EncodeByteArray(header)...)
+	}
+	return data, nil
+}
+
+func (txnData *AnchorExternalHeadersMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	// ExternalChain
+	externalChain, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "AnchorExternalHeadersMetadata.FromBytes: Problem reading ExternalChain: ")
+	}
+	txnData.ExternalChain = ExternalChain(externalChain)
+
+	// StartHeight
+	txnData.StartHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "AnchorExternalHeadersMetadata.FromBytes: Problem reading StartHeight: ")
+	}
+
+	// Headers
+	numHeaders, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "AnchorExternalHeadersMetadata.FromBytes: Problem reading number of Headers: ")
+	}
+	if numHeaders > MaxExternalHeadersPerTxn {
+		return errors.Wrapf(RuleErrorExternalHeadersInvalidCount,
+			"AnchorExternalHeadersMetadata.FromBytes: %d headers exceeds the max of %d", numHeaders, MaxExternalHeadersPerTxn)
+	}
+	txnData.Headers = nil
+	for ii := uint64(0); ii < numHeaders; ii++ {
+		header, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "AnchorExternalHeadersMetadata.FromBytes: Problem reading Header: ")
+		}
+		txnData.Headers = append(txnData.Headers, header)
+	}
+
+	return nil
+}
+
+func (txnData *AnchorExternalHeadersMetadata) New() DeSoTxnMetadata {
+	return &AnchorExternalHeadersMetadata{}
+}
+
+//
+// TYPES: ExternalHeaderRelayerEntry
+//
+
+type ExternalHeaderRelayerEntry struct {
+	// PublicKey is the public key the relayer signs its AnchorExternalHeaders txns with.
+	PublicKey []byte
+
+	isDeleted bool
+}
+
+func (entry *ExternalHeaderRelayerEntry) Copy() *ExternalHeaderRelayerEntry {
+	return &ExternalHeaderRelayerEntry{
+		PublicKey: append([]byte{}, entry.PublicKey...),
+		isDeleted: entry.isDeleted,
+	}
+}
+
+func (entry *ExternalHeaderRelayerEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	return EncodeByteArray(entry.PublicKey)
+}
+
+func (entry *ExternalHeaderRelayerEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// PublicKey
+	entry.PublicKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ExternalHeaderRelayerEntry.Decode: Problem reading PublicKey: ")
+	}
+
+	return nil
+}
+
+func (entry *ExternalHeaderRelayerEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *ExternalHeaderRelayerEntry) GetEncoderType() EncoderType {
+	return EncoderTypeExternalHeaderRelayerEntry
+}
+
+//
+// TYPES: ExternalHeaderEntry
+//
+
+type ExternalHeaderEntry struct {
+	ExternalChain ExternalChain
+	// BlockHash and PrevBlockHash are in the external chain's serialization order. For
+	// Bitcoin, this is the reverse of the order block explorers display hashes in.
+	BlockHash     *BlockHash
+	PrevBlockHash *BlockHash
+	Height        uint64
+	TimestampSecs uint64
+	// HeaderBytes is the header as it was anchored, so that proofs can be checked against
+	// any of its fields, e.g. a Bitcoin merkle root or an Ethereum receipts root.
+	HeaderBytes []byte
+
+	RelayerPKID           *PKID
+	AnchoredAtBlockHeight uint64
+
+	isDeleted bool
+}
+
+type ExternalHeaderMapKey struct {
+	ExternalChain ExternalChain
+	BlockHash     BlockHash
+}
+
+func (entry *ExternalHeaderEntry) ToMapKey() ExternalHeaderMapKey {
+	return ExternalHeaderMapKey{
+		ExternalChain: entry.ExternalChain,
+		BlockHash:     *entry.BlockHash,
+	}
+}
+
+func (entry *ExternalHeaderEntry) Copy() *ExternalHeaderEntry {
+	return &ExternalHeaderEntry{
+		ExternalChain:         entry.ExternalChain,
+		BlockHash:             entry.BlockHash.NewBlockHash(),
+		PrevBlockHash:         entry.PrevBlockHash.NewBlockHash(),
+		Height:                entry.Height,
+		TimestampSecs:         entry.TimestampSecs,
+		HeaderBytes:           append([]byte{}, entry.HeaderBytes...),
+		RelayerPKID:           entry.RelayerPKID.NewPKID(),
+		AnchoredAtBlockHeight: entry.AnchoredAtBlockHeight,
+		isDeleted:             entry.isDeleted,
+	}
+}
+
+func (entry *ExternalHeaderEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, byte(entry.ExternalChain))
+	data = append(data, EncodeToBytes(blockHeight, entry.BlockHash, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.PrevBlockHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.Height)...)
+	data = append(data, UintToBuf(entry.TimestampSecs)...)
+	data = append(data, EncodeByteArray(entry.HeaderBytes)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.RelayerPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.AnchoredAtBlockHeight)...)
+	return data
+}
+
+func (entry *ExternalHeaderEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// ExternalChain
+	externalChain, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading ExternalChain: ")
+	}
+	entry.ExternalChain = ExternalChain(externalChain)
+
+	// BlockHash
+	if entry.BlockHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading BlockHash: ")
+	}
+
+	// PrevBlockHash
+	if entry.PrevBlockHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading PrevBlockHash: ")
+	}
+
+	// Height
+	if entry.Height, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading Height: ")
+	}
+
+	// TimestampSecs
+	if entry.TimestampSecs, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading TimestampSecs: ")
+	}
+
+	// HeaderBytes
+	if entry.HeaderBytes, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading HeaderBytes: ")
+	}
+
+	// RelayerPKID
+	if entry.RelayerPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading RelayerPKID: ")
+	}
+
+	// AnchoredAtBlockHeight
+	if entry.AnchoredAtBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "ExternalHeaderEntry.Decode: Problem reading AnchoredAtBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (entry *ExternalHeaderEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *ExternalHeaderEntry) GetEncoderType() EncoderType {
+	return EncoderTypeExternalHeaderEntry
+}
+
+// _isHigherExternalHeaderEntry orders headers by height, breaking ties by hash. This is
+// the same order the PrefixExternalHeaderByChainAndHeight index sorts headers in.
+func _isHigherExternalHeaderEntry(entry *ExternalHeaderEntry, other *ExternalHeaderEntry) bool {
+	if entry.Height != other.Height {
+		return entry.Height > other.Height
+	}
+	return bytes.Compare(entry.BlockHash[:], other.BlockHash[:]) > 0
+}
+
+//
+// HEADER PARSING
+//
+
+// ParseExternalHeader validates an encoded external chain header against the rules that
+// can be checked without its parent, and returns an ExternalHeaderEntry with its hash,
+// parent hash, and timestamp. The height is only set for chains that encode it in their
+// headers.
+func ParseExternalHeader(externalChain ExternalChain, headerBytes []byte, params *DeSoParams) (
+	*ExternalHeaderEntry, error) {
+
+	if len(headerBytes) > MaxExternalHeaderLength {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderTooLong, "ParseExternalHeader: Header has %d bytes",
+			len(headerBytes))
+	}
+	switch externalChain {
+	case ExternalChainBitcoin:
+		return _parseBitcoinHeader(headerBytes, params)
+	case ExternalChainEthereum:
+		return _parseEthereumHeader(headerBytes)
+	default:
+		return nil, errors.Wrapf(RuleErrorExternalHeaderInvalidChain, "ParseExternalHeader: %d", externalChain)
+	}
+}
+
+func _parseBitcoinHeader(headerBytes []byte, params *DeSoParams) (*ExternalHeaderEntry, error) {
+	if len(headerBytes) != wire.MaxBlockHeaderPayload {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderMalformed,
+			"_parseBitcoinHeader: Header has %d bytes but should have %d", len(headerBytes), wire.MaxBlockHeaderPayload)
+	}
+	header := &wire.BlockHeader{}
+	if err := header.Deserialize(bytes.NewReader(headerBytes)); err != nil {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderMalformed, "_parseBitcoinHeader: %v", err)
+	}
+
+	// The header's hash must meet the target in its bits, and the target can't be easier
+	// than the network allows.
+	blockHash := header.BlockHash()
+	target := btcdchain.CompactToBig(header.Bits)
+	if target.Sign() <= 0 || target.Cmp(params.BitcoinBtcdParams.PowLimit) > 0 {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderInsufficientWork,
+			"_parseBitcoinHeader: Target %064x is outside the allowed range", target)
+	}
+	if btcdchain.HashToBig(&blockHash).Cmp(target) > 0 {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderInsufficientWork,
+			"_parseBitcoinHeader: Hash %v is above target %064x", blockHash, target)
+	}
+
+	return &ExternalHeaderEntry{
+		ExternalChain: ExternalChainBitcoin,
+		BlockHash:     NewBlockHash(blockHash[:]),
+		PrevBlockHash: NewBlockHash(header.PrevBlock[:]),
+		TimestampSecs: uint64(header.Timestamp.Unix()),
+		HeaderBytes:   headerBytes,
+	}, nil
+}
+
+// Positions of the fields we read from an RLP-encoded Ethereum header. Forks append new
+// fields to the end of the header, which doesn't move these.
+const (
+	ethereumHeaderParentHashIndex = 0
+	ethereumHeaderNumberIndex     = 8
+	ethereumHeaderTimestampIndex  = 11
+)
+
+func _parseEthereumHeader(headerBytes []byte) (*ExternalHeaderEntry, error) {
+	fieldsBytes, rest, err := rlp.SplitList(headerBytes)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderMalformed, "_parseEthereumHeader: Header isn't an RLP list")
+	}
+	var fields [][]byte
+	for len(fieldsBytes) > 0 && len(fields) <= ethereumHeaderTimestampIndex {
+		var kind rlp.Kind
+		var field []byte
+		kind, field, fieldsBytes, err = rlp.Split(fieldsBytes)
+		if err != nil || kind == rlp.List {
+			return nil, errors.Wrapf(RuleErrorExternalHeaderMalformed, "_parseEthereumHeader: Problem reading field %d",
+				len(fields))
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) <= ethereumHeaderTimestampIndex {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderMalformed, "_parseEthereumHeader: Header only has %d fields",
+			len(fields))
+	}
+
+	parentHash := fields[ethereumHeaderParentHashIndex]
+	if len(parentHash) != HashSizeBytes {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderMalformed, "_parseEthereumHeader: Parent hash has %d bytes",
+			len(parentHash))
+	}
+	number, err := _decodeRLPUint64(fields[ethereumHeaderNumberIndex])
+	if err != nil {
+		return nil, errors.Wrapf(err, "_parseEthereumHeader: Problem reading number: ")
+	}
+	timestamp, err := _decodeRLPUint64(fields[ethereumHeaderTimestampIndex])
+	if err != nil {
+		return nil, errors.Wrapf(err, "_parseEthereumHeader: Problem reading timestamp: ")
+	}
+
+	return &ExternalHeaderEntry{
+		ExternalChain: ExternalChainEthereum,
+		BlockHash:     NewBlockHash(crypto.Keccak256(headerBytes)),
+		PrevBlockHash: NewBlockHash(parentHash),
+		Height:        number,
+		TimestampSecs: timestamp,
+		HeaderBytes:   headerBytes,
+	}, nil
+}
+
+// _decodeRLPUint64 decodes the content of an RLP integer, which is big-endian without
+// leading zeros.
+func _decodeRLPUint64(content []byte) (uint64, error) {
+	if len(content) > 8 || (len(content) > 0 && content[0] == 0) {
+		return 0, errors.Wrapf(RuleErrorExternalHeaderMalformed, "_decodeRLPUint64: Invalid integer %x", content)
+	}
+	var value uint64
+	for _, b := range content {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForExternalHeaderRelayerEntry(publicKey []byte) []byte {
+	key := append([]byte{}, Prefixes.PrefixExternalHeaderRelayerByPublicKey...)
+	key = append(key, publicKey...)
+	return key
+}
+
+func DBGetExternalHeaderRelayerEntry(handle *badger.DB, snap *Snapshot, publicKey []byte) (*ExternalHeaderRelayerEntry, error) {
+	var ret *ExternalHeaderRelayerEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetExternalHeaderRelayerEntryWithTxn(txn, snap, publicKey)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetExternalHeaderRelayerEntryWithTxn(txn *badger.Txn, snap *Snapshot, publicKey []byte) (*ExternalHeaderRelayerEntry, error) {
+	// Retrieve ExternalHeaderRelayerEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForExternalHeaderRelayerEntry(publicKey))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetExternalHeaderRelayerEntry: problem retrieving ExternalHeaderRelayerEntry: ")
+	}
+
+	// Decode ExternalHeaderRelayerEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&ExternalHeaderRelayerEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetExternalHeaderRelayerEntry: problem decoding ExternalHeaderRelayerEntry: ")
+	}
+	return entry, nil
+}
+
+func DBPutExternalHeaderRelayerEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ExternalHeaderRelayerEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForExternalHeaderRelayerEntry(entry.PublicKey)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutExternalHeaderRelayerEntryWithTxn: problem storing ExternalHeaderRelayerEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteExternalHeaderRelayerEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ExternalHeaderRelayerEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForExternalHeaderRelayerEntry(entry.PublicKey)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteExternalHeaderRelayerEntryWithTxn: problem deleting ExternalHeaderRelayerEntry: ")
+	}
+	return nil
+}
+
+func DBKeyForExternalHeaderByChainAndHash(externalChain ExternalChain, blockHash *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixExternalHeaderByChainAndHash...)
+	key = append(key, EncodeUint8(uint8(externalChain))...)
+	key = append(key, blockHash[:]...)
+	return key
+}
+
+func DBKeyForExternalHeaderByChainAndHeight(entry *ExternalHeaderEntry) []byte {
+	key := DBPrefixKeyForExternalHeaderByChainAndHeight(entry.ExternalChain)
+	key = append(key, EncodeUint64(entry.Height)...)
+	key = append(key, entry.BlockHash[:]...)
+	return key
+}
+
+func DBPrefixKeyForExternalHeaderByChainAndHeight(externalChain ExternalChain) []byte {
+	key := append([]byte{}, Prefixes.PrefixExternalHeaderByChainAndHeight...)
+	key = append(key, EncodeUint8(uint8(externalChain))...)
+	return key
+}
+
+func GetBlockHashFromDBKeyForExternalHeaderByChainAndHeight(key []byte) (*BlockHash, error) {
+	if len(key) < HashSizeBytes {
+		return nil, fmt.Errorf("GetBlockHashFromDBKeyForExternalHeaderByChainAndHeight: Key has %d bytes", len(key))
+	}
+	return NewBlockHash(key[len(key)-HashSizeBytes:]), nil
+}
+
+func DBGetExternalHeaderEntry(
+	handle *badger.DB,
+	snap *Snapshot,
+	externalChain ExternalChain,
+	blockHash *BlockHash,
+) (*ExternalHeaderEntry, error) {
+	var ret *ExternalHeaderEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetExternalHeaderEntryWithTxn(txn, snap, externalChain, blockHash)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetExternalHeaderEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	externalChain ExternalChain,
+	blockHash *BlockHash,
+) (*ExternalHeaderEntry, error) {
+	// Retrieve ExternalHeaderEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForExternalHeaderByChainAndHash(externalChain, blockHash))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetExternalHeaderEntry: problem retrieving ExternalHeaderEntry: ")
+	}
+
+	// Decode ExternalHeaderEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&ExternalHeaderEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetExternalHeaderEntry: problem decoding ExternalHeaderEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetTopExternalHeaderEntry returns the highest header anchored for the external chain
+// in the db, skipping the headers whose hashes are in blockHashesToSkip.
+func DBGetTopExternalHeaderEntry(
+	handle *badger.DB,
+	snap *Snapshot,
+	externalChain ExternalChain,
+	blockHashesToSkip *Set[BlockHash],
+) (*ExternalHeaderEntry, error) {
+	canSkipHeaderInBadgerSeek := func(badgerKey []byte) bool {
+		blockHash, err := GetBlockHashFromDBKeyForExternalHeaderByChainAndHeight(badgerKey)
+		if err != nil {
+			// We return false here to be safe. Any failure parsing the key is returned below.
+			return false
+		}
+		return blockHashesToSkip.Includes(*blockHash)
+	}
+	keysFound, err := EnumerateKeysOnlyForPrefixWithLimitOffsetOrderAndSkipFunc(
+		handle, DBPrefixKeyForExternalHeaderByChainAndHeight(externalChain), 1, nil, true, canSkipHeaderInBadgerSeek,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetTopExternalHeaderEntry: problem retrieving top header: ")
+	}
+	if len(keysFound) == 0 {
+		return nil, nil
+	}
+	blockHash, err := GetBlockHashFromDBKeyForExternalHeaderByChainAndHeight(keysFound[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetTopExternalHeaderEntry: ")
+	}
+	entry, err := DBGetExternalHeaderEntry(handle, snap, externalChain, blockHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetTopExternalHeaderEntry: ")
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("DBGetTopExternalHeaderEntry: found index key for missing header %v", blockHash)
+	}
+	return entry, nil
+}
+
+func DBPutExternalHeaderEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ExternalHeaderEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+
+	// Set ExternalHeaderEntry in PrefixExternalHeaderByChainAndHash.
+	key := DBKeyForExternalHeaderByChainAndHash(entry.ExternalChain, entry.BlockHash)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutExternalHeaderEntryWithTxn: problem storing ExternalHeaderEntry in index PrefixExternalHeaderByChainAndHash: ",
+		)
+	}
+
+	// Set ExternalHeaderEntry key in PrefixExternalHeaderByChainAndHeight. The value should be nil.
+	// We parse the BlockHash from the key for this index.
+	key = DBKeyForExternalHeaderByChainAndHeight(entry)
+	if err := DBSetWithTxn(txn, snap, key, nil, eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutExternalHeaderEntryWithTxn: problem storing ExternalHeaderEntry in index PrefixExternalHeaderByChainAndHeight: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteExternalHeaderEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ExternalHeaderEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+
+	// Delete ExternalHeaderEntry from PrefixExternalHeaderByChainAndHash.
+	key := DBKeyForExternalHeaderByChainAndHash(entry.ExternalChain, entry.BlockHash)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteExternalHeaderEntryWithTxn: problem deleting ExternalHeaderEntry from index PrefixExternalHeaderByChainAndHash: ",
+		)
+	}
+
+	// Delete ExternalHeaderEntry key from PrefixExternalHeaderByChainAndHeight.
+	key = DBKeyForExternalHeaderByChainAndHeight(entry)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteExternalHeaderEntryWithTxn: problem deleting ExternalHeaderEntry from index PrefixExternalHeaderByChainAndHeight: ",
+		)
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetExternalHeaderRelayerEntry returns the registry entry for the public key, or nil if
+// the public key isn't a registered relayer.
+func (bav *UtxoView) GetExternalHeaderRelayerEntry(publicKey []byte) (*ExternalHeaderRelayerEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.ExternalHeaderRelayerPublicKeyToEntry[MakePkMapKey(publicKey)]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetExternalHeaderRelayerEntry(publicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetExternalHeaderRelayerEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the ExternalHeaderRelayerEntry from the db in the UtxoView.
+		bav._setExternalHeaderRelayerEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+func (bav *UtxoView) _setExternalHeaderRelayerEntryMappings(entry *ExternalHeaderRelayerEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setExternalHeaderRelayerEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ExternalHeaderRelayerPublicKeyToEntry[MakePkMapKey(entry.PublicKey)] = entry
+}
+
+func (bav *UtxoView) _deleteExternalHeaderRelayerEntryMappings(entry *ExternalHeaderRelayerEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteExternalHeaderRelayerEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setExternalHeaderRelayerEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushExternalHeaderRelayerEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.ExternalHeaderRelayerPublicKeyToEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if MakePkMapKey(entry.PublicKey) != mapKey {
+			return fmt.Errorf(
+				"_flushExternalHeaderRelayerEntriesToDbWithTxn: ExternalHeaderRelayerEntry public key %v doesn't match MapKey %v",
+				PkToStringBoth(entry.PublicKey),
+				PkToStringBoth(mapKey[:]),
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteExternalHeaderRelayerEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushExternalHeaderRelayerEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutExternalHeaderRelayerEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushExternalHeaderRelayerEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+// GetExternalHeaderEntry returns the anchored header with the given hash, or nil if it
+// hasn't been anchored.
+func (bav *UtxoView) GetExternalHeaderEntry(externalChain ExternalChain, blockHash *BlockHash) (*ExternalHeaderEntry, error) {
+	// First check the UtxoView.
+	mapKey := ExternalHeaderMapKey{ExternalChain: externalChain, BlockHash: *blockHash}
+	if entry, exists := bav.ExternalHeaderMapKeyToExternalHeaderEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetExternalHeaderEntry(externalChain, blockHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetExternalHeaderEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the ExternalHeaderEntry from the db in the UtxoView.
+		bav._setExternalHeaderEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetExternalChainTip returns the highest header anchored for the external chain, or nil
+// if no headers have been anchored for it.
+func (bav *UtxoView) GetExternalChainTip(externalChain ExternalChain) (*ExternalHeaderEntry, error) {
+	// The headers in the UtxoView take precedence over the db, so we skip them while
+	// seeking through the db and consider the ones that aren't deleted separately.
+	var tipEntry *ExternalHeaderEntry
+	blockHashesToSkip := NewSet([]BlockHash{})
+	for mapKey, entry := range bav.ExternalHeaderMapKeyToExternalHeaderEntry {
+		if mapKey.ExternalChain != externalChain {
+			continue
+		}
+		blockHashesToSkip.Add(mapKey.BlockHash)
+		if !entry.isDeleted && (tipEntry == nil || _isHigherExternalHeaderEntry(entry, tipEntry)) {
+			tipEntry = entry
+		}
+	}
+
+	dbTipEntry, err := bav.GetDbAdapter().GetTopExternalHeaderEntry(externalChain, blockHashesToSkip)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetExternalChainTip: ")
+	}
+	if dbTipEntry != nil && (tipEntry == nil || _isHigherExternalHeaderEntry(dbTipEntry, tipEntry)) {
+		tipEntry = dbTipEntry
+	}
+	return tipEntry, nil
+}
+
+// GetExternalHeaderConfirmations returns the number of confirmations the anchored header
+// has on the external chain's tip, counting the header itself. It returns zero if the
+// header isn't anchored or isn't an ancestor of the tip. It walks back from the tip, so
+// its cost is proportional to the header's depth.
+func (bav *UtxoView) GetExternalHeaderConfirmations(externalChain ExternalChain, blockHash *BlockHash) (uint64, error) {
+	entry, err := bav.GetExternalHeaderEntry(externalChain, blockHash)
+	if err != nil {
+		return 0, errors.Wrapf(err, "UtxoView.GetExternalHeaderConfirmations: ")
+	}
+	if entry == nil {
+		return 0, nil
+	}
+	tipEntry, err := bav.GetExternalChainTip(externalChain)
+	if err != nil {
+		return 0, errors.Wrapf(err, "UtxoView.GetExternalHeaderConfirmations: ")
+	}
+
+	currentEntry := tipEntry
+	for currentEntry != nil && currentEntry.Height > entry.Height {
+		currentEntry, err = bav.GetExternalHeaderEntry(externalChain, currentEntry.PrevBlockHash)
+		if err != nil {
+			return 0, errors.Wrapf(err, "UtxoView.GetExternalHeaderConfirmations: ")
+		}
+	}
+	if currentEntry == nil || !currentEntry.BlockHash.IsEqual(entry.BlockHash) {
+		return 0, nil
+	}
+	return tipEntry.Height - entry.Height + 1, nil
+}
+
+func (bav *UtxoView) _setExternalHeaderEntryMappings(entry *ExternalHeaderEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setExternalHeaderEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ExternalHeaderMapKeyToExternalHeaderEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteExternalHeaderEntryMappings(entry *ExternalHeaderEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteExternalHeaderEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setExternalHeaderEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushExternalHeaderEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't. An anchored header never changes, so its index
+	// keys are the same in the view and in the db.
+	for mapKeyIter, entryIter := range bav.ExternalHeaderMapKeyToExternalHeaderEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushExternalHeaderEntriesToDbWithTxn: ExternalHeaderEntry %v doesn't match MapKey %v",
+				entry.BlockHash, mapKey.BlockHash,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteExternalHeaderEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushExternalHeaderEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutExternalHeaderEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushExternalHeaderEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectAnchorExternalHeaders(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.ExternalHeaderAnchoringBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorAnchorExternalHeadersBeforeBlockHeight, "_connectAnchorExternalHeaders: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeAnchorExternalHeaders {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectAnchorExternalHeaders: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*AnchorExternalHeadersMetadata)
+
+	// Connect a basic transfer to get the total input and the
+	// total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorExternalHeaders: ")
+	}
+
+	// Only registered relayers can anchor headers.
+	relayerEntry, err := bav.GetExternalHeaderRelayerEntry(txn.PublicKey)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorExternalHeaders: ")
+	}
+	if relayerEntry == nil {
+		return 0, 0, nil, errors.Wrapf(RuleErrorExternalHeaderRelayerNotRegistered, "_connectAnchorExternalHeaders: ")
+	}
+	relayerPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if relayerPKIDEntry == nil || relayerPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectAnchorExternalHeaders: PKID for relayer %v not found",
+			PkToStringBoth(txn.PublicKey))
+	}
+
+	// Validate the headers and anchor them.
+	externalHeaderEntries, err := bav.IsValidAnchorExternalHeadersMetadata(
+		txMeta, relayerPKIDEntry.PKID, uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorExternalHeaders: ")
+	}
+	for _, externalHeaderEntry := range externalHeaderEntries {
+		bav._setExternalHeaderEntryMappings(externalHeaderEntry)
+	}
+
+	// Add a UTXO operation. A header can only be anchored once, so disconnecting the txn
+	// just deletes the headers and there's nothing to restore.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type: OperationTypeAnchorExternalHeaders,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectAnchorExternalHeaders(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.ExternalHeaderAnchoringBlockHeight {
+		return errors.Wrapf(RuleErrorAnchorExternalHeadersBeforeBlockHeight, "_disconnectAnchorExternalHeaders: ")
+	}
+
+	// Validate the last operation is an AnchorExternalHeaders operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectAnchorExternalHeaders: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeAnchorExternalHeaders {
+		return fmt.Errorf(
+			"_disconnectAnchorExternalHeaders: trying to revert %v but found %v",
+			OperationTypeAnchorExternalHeaders,
+			operationData.Type,
+		)
+	}
+
+	// Delete the headers the txn anchored.
+	txMeta := currentTxn.TxnMeta.(*AnchorExternalHeadersMetadata)
+	for _, headerBytes := range txMeta.Headers {
+		parsedEntry, err := ParseExternalHeader(txMeta.ExternalChain, headerBytes, bav.Params)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectAnchorExternalHeaders: ")
+		}
+		externalHeaderEntry, err := bav.GetExternalHeaderEntry(txMeta.ExternalChain, parsedEntry.BlockHash)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectAnchorExternalHeaders: ")
+		}
+		if externalHeaderEntry == nil {
+			return fmt.Errorf("_disconnectAnchorExternalHeaders: header %v not found", parsedEntry.BlockHash)
+		}
+		bav._deleteExternalHeaderEntryMappings(externalHeaderEntry)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// IsValidAnchorExternalHeadersMetadata validates the headers in an AnchorExternalHeaders
+// txn and returns the ExternalHeaderEntries that anchoring them creates.
+func (bav *UtxoView) IsValidAnchorExternalHeadersMetadata(
+	metadata *AnchorExternalHeadersMetadata,
+	relayerPKID *PKID,
+	blockHeight uint64,
+) ([]*ExternalHeaderEntry, error) {
+	// Validate ExternalChain.
+	if metadata.ExternalChain != ExternalChainBitcoin && metadata.ExternalChain != ExternalChainEthereum {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderInvalidChain, "UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+	}
+
+	// Validate the number of headers, and that their heights don't overflow.
+	numHeaders := uint64(len(metadata.Headers))
+	if numHeaders == 0 || numHeaders > MaxExternalHeadersPerTxn {
+		return nil, errors.Wrapf(RuleErrorExternalHeadersInvalidCount, "UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+	}
+	if metadata.StartHeight > math.MaxUint64-numHeaders {
+		return nil, errors.Wrapf(RuleErrorExternalHeaderHeightMismatch, "UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+	}
+
+	var externalHeaderEntries []*ExternalHeaderEntry
+	for ii, headerBytes := range metadata.Headers {
+		externalHeaderEntry, err := ParseExternalHeader(metadata.ExternalChain, headerBytes, bav.Params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+		}
+
+		// Chains that encode the height in their headers must match the height the header
+		// is anchored at.
+		height := metadata.StartHeight + uint64(ii)
+		if metadata.ExternalChain == ExternalChainEthereum && externalHeaderEntry.Height != height {
+			return nil, errors.Wrapf(RuleErrorExternalHeaderHeightMismatch,
+				"UtxoView.IsValidAnchorExternalHeadersMetadata: Header has height %d but is anchored at %d",
+				externalHeaderEntry.Height, height)
+		}
+		externalHeaderEntry.Height = height
+
+		// A header can only be anchored once.
+		existingEntry, err := bav.GetExternalHeaderEntry(metadata.ExternalChain, externalHeaderEntry.BlockHash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+		}
+		if existingEntry != nil {
+			return nil, errors.Wrapf(RuleErrorExternalHeaderAlreadyAnchored,
+				"UtxoView.IsValidAnchorExternalHeadersMetadata: %v", externalHeaderEntry.BlockHash)
+		}
+
+		// Find the header's parent. The first header in the txn extends an anchored header,
+		// unless nothing has been anchored for the chain yet. Each header after that extends
+		// the one before it.
+		var parentEntry *ExternalHeaderEntry
+		if ii == 0 {
+			parentEntry, err = bav.GetExternalHeaderEntry(metadata.ExternalChain, externalHeaderEntry.PrevBlockHash)
+			if err != nil {
+				return nil, errors.Wrapf(err, "UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+			}
+			if parentEntry == nil {
+				tipEntry, err := bav.GetExternalChainTip(metadata.ExternalChain)
+				if err != nil {
+					return nil, errors.Wrapf(err, "UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+				}
+				if tipEntry != nil {
+					return nil, errors.Wrapf(RuleErrorExternalHeaderParentNotAnchored,
+						"UtxoView.IsValidAnchorExternalHeadersMetadata: %v", externalHeaderEntry.PrevBlockHash)
+				}
+			}
+		} else {
+			parentEntry = externalHeaderEntries[ii-1]
+			if !parentEntry.BlockHash.IsEqual(externalHeaderEntry.PrevBlockHash) {
+				return nil, errors.Wrapf(RuleErrorExternalHeaderParentNotAnchored,
+					"UtxoView.IsValidAnchorExternalHeadersMetadata: Header %d doesn't extend the header before it", ii)
+			}
+		}
+
+		// Validate the header against its parent.
+		if parentEntry != nil {
+			if parentEntry.Height+1 != externalHeaderEntry.Height {
+				return nil, errors.Wrapf(RuleErrorExternalHeaderHeightMismatch,
+					"UtxoView.IsValidAnchorExternalHeadersMetadata: Header has height %d but its parent has height %d",
+					externalHeaderEntry.Height, parentEntry.Height)
+			}
+			// Bitcoin only requires timestamps to be after the median of the last eleven
+			// blocks, so a header can be earlier than its parent.
+			if metadata.ExternalChain == ExternalChainEthereum &&
+				externalHeaderEntry.TimestampSecs <= parentEntry.TimestampSecs {
+				return nil, errors.Wrapf(RuleErrorExternalHeaderTimestampTooEarly,
+					"UtxoView.IsValidAnchorExternalHeadersMetadata: ")
+			}
+		}
+
+		externalHeaderEntry.RelayerPKID = relayerPKID.NewPKID()
+		externalHeaderEntry.AnchoredAtBlockHeight = blockHeight
+		externalHeaderEntries = append(externalHeaderEntries, externalHeaderEntry)
+	}
+	return externalHeaderEntries, nil
+}
+
+//
+// TXN CONSTRUCTION
+//
+
+func (bc *Blockchain) CreateAnchorExternalHeadersTxn(
+	transactorPublicKey []byte,
+	metadata *AnchorExternalHeadersMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the AnchorExternalHeaders fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Create a new UtxoView. If we have access to a mempool object, use
+	// it to get an augmented view that factors in pending transactions.
+	utxoView := bc.NewUtxoView()
+	if !isInterfaceValueNil(mempool) {
+		var err error
+		utxoView, err = mempool.GetAugmentedUniversalView()
+		if err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(
+				err, "Blockchain.CreateAnchorExternalHeadersTxn: problem getting augmented utxo view from mempool: ",
+			)
+		}
+	}
+
+	// Validate the transactor and the txn metadata.
+	relayerEntry, err := utxoView.GetExternalHeaderRelayerEntry(transactorPublicKey)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateAnchorExternalHeadersTxn: ")
+	}
+	if relayerEntry == nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			RuleErrorExternalHeaderRelayerNotRegistered, "Blockchain.CreateAnchorExternalHeadersTxn: ",
+		)
+	}
+	transactorPKIDEntry := utxoView.GetPKIDForPublicKey(transactorPublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return nil, 0, 0, 0, errors.New("Blockchain.CreateAnchorExternalHeadersTxn: transactor PKID not found")
+	}
+	if _, err = utxoView.IsValidAnchorExternalHeadersMetadata(
+		metadata, transactorPKIDEntry.PKID, uint64(bc.blockTip().Height)+1,
+	); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateAnchorExternalHeadersTxn: invalid txn metadata: ",
+		)
+	}
+
+	// We don't need to make any tweaks to the amount because
+	// it's basically a standard "pay per kilobyte" transaction.
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateAnchorExternalHeadersTxn: problem adding inputs: ",
+		)
+	}
+
+	// Sanity-check that the spendAmount is zero.
+	if spendAmount != 0 {
+		return nil, 0, 0, 0, fmt.Errorf(
+			"Blockchain.CreateAnchorExternalHeadersTxn: spend amount is non-zero: %d", spendAmount,
+		)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
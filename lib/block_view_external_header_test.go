@@ -0,0 +1,399 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	btcdchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalHeaderAnchoring(t *testing.T) {
+	require := require.New(t)
+
+	// The Bitcoin genesis header parses, and its hash matches the well-known one.
+	genesisHeaderBytes, err := hex.DecodeString("01000000000000000000000000000000000000000000000000000000000000000000" +
+		"00003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c")
+	require.NoError(err)
+	genesisEntry, err := ParseExternalHeader(ExternalChainBitcoin, genesisHeaderBytes, &DeSoMainnetParams)
+	require.NoError(err)
+	require.Equal(chaincfg.MainNetParams.GenesisHash[:], genesisEntry.BlockHash[:])
+	require.Equal(uint64(1231006505), genesisEntry.TimestampSecs)
+
+	// Changing the nonce invalidates the proof of work.
+	tamperedHeaderBytes := append([]byte{}, genesisHeaderBytes...)
+	tamperedHeaderBytes[len(tamperedHeaderBytes)-1]++
+	_, err = ParseExternalHeader(ExternalChainBitcoin, tamperedHeaderBytes, &DeSoMainnetParams)
+	require.Error(err)
+	require.Contains(err.Error(), string(RuleErrorExternalHeaderInsufficientWork))
+	_, err = ParseExternalHeader(ExternalChainBitcoin, genesisHeaderBytes[:40], &DeSoMainnetParams)
+	require.Contains(err.Error(), string(RuleErrorExternalHeaderMalformed))
+
+	// Mine headers against the regtest PoW limit so the test runs quickly.
+	params := DeSoTestnetParams
+	params.BitcoinBtcdParams = &chaincfg.RegressionNetParams
+	header0, hash0 := _mineBitcoinHeader(t, &chainhash.Hash{}, 1700000000)
+	header1, hash1 := _mineBitcoinHeader(t, hash0, 1700000600)
+	header2, _ := _mineBitcoinHeader(t, hash1, 1700001200)
+	orphanHeader, _ := _mineBitcoinHeader(t, &chainhash.Hash{1}, 1700000000)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	relayerPKID := NewPKID(m0PkBytes)
+	anchorHeaders := func(utxoView *UtxoView, externalChain ExternalChain, startHeight uint64, headers ...[]byte) error {
+		entries, err := utxoView.IsValidAnchorExternalHeadersMetadata(&AnchorExternalHeadersMetadata{
+			ExternalChain: externalChain,
+			StartHeight:   startHeight,
+			Headers:       headers,
+		}, relayerPKID, 1)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			utxoView._setExternalHeaderEntryMappings(entry)
+		}
+		return nil
+	}
+
+	// The first headers for a chain are a checkpoint at any height.
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	require.NoError(anchorHeaders(utxoView, ExternalChainBitcoin, 100, header0, header1))
+	require.NoError(utxoView.FlushToDb(1))
+
+	// Once a chain has headers, new headers must extend them at the next height.
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+	tipEntry, err := utxoView.GetExternalChainTip(ExternalChainBitcoin)
+	require.NoError(err)
+	require.Equal(hash1[:], tipEntry.BlockHash[:])
+	require.Equal(uint64(101), tipEntry.Height)
+	err = anchorHeaders(utxoView, ExternalChainBitcoin, 102, orphanHeader)
+	require.Contains(err.Error(), string(RuleErrorExternalHeaderParentNotAnchored))
+	err = anchorHeaders(utxoView, ExternalChainBitcoin, 101, header1)
+	require.Contains(err.Error(), string(RuleErrorExternalHeaderAlreadyAnchored))
+	err = anchorHeaders(utxoView, ExternalChainBitcoin, 105, header2)
+	require.Contains(err.Error(), string(RuleErrorExternalHeaderHeightMismatch))
+	require.NoError(anchorHeaders(utxoView, ExternalChainBitcoin, 102, header2))
+
+	// Confirmations count the header itself and every header on top of it.
+	confirmations, err := utxoView.GetExternalHeaderConfirmations(ExternalChainBitcoin, NewBlockHash(hash0[:]))
+	require.NoError(err)
+	require.Equal(uint64(3), confirmations)
+
+	// Deleting a header in the view takes precedence over the db.
+	header1Entry, err := utxoView.GetExternalHeaderEntry(ExternalChainBitcoin, NewBlockHash(hash1[:]))
+	require.NoError(err)
+	header2Entry, err := utxoView.GetExternalChainTip(ExternalChainBitcoin)
+	require.NoError(err)
+	utxoView._deleteExternalHeaderEntryMappings(header2Entry)
+	utxoView._deleteExternalHeaderEntryMappings(header1Entry)
+	tipEntry, err = utxoView.GetExternalChainTip(ExternalChainBitcoin)
+	require.NoError(err)
+	require.Equal(hash0[:], tipEntry.BlockHash[:])
+	require.NoError(utxoView.FlushToDb(2))
+	tipEntry, err = NewUtxoView(db, &params, nil, nil, nil).GetExternalChainTip(ExternalChainBitcoin)
+	require.NoError(err)
+	require.Equal(uint64(100), tipEntry.Height)
+
+	// Ethereum headers encode their number and must be after their parent.
+	encodeEthereumHeader := func(parentHash []byte, number uint64, timestamp uint64) []byte {
+		fields := []interface{}{parentHash}
+		for len(fields) < ethereumHeaderNumberIndex {
+			fields = append(fields, []byte{})
+		}
+		fields = append(fields, number, uint64(30000000), uint64(0), timestamp, []byte{}, []byte{}, []byte{})
+		headerBytes, err := rlp.EncodeToBytes(fields)
+		require.NoError(err)
+		return headerBytes
+	}
+	ethereumHeader0 := encodeEthereumHeader(make([]byte, HashSizeBytes), 5, 1000)
+	ethereumEntry0, err := ParseExternalHeader(ExternalChainEthereum, ethereumHeader0, &params)
+	require.NoError(err)
+	require.Equal(uint64(5), ethereumEntry0.Height)
+	require.Equal(uint64(1000), ethereumEntry0.TimestampSecs)
+
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+	err = anchorHeaders(utxoView, ExternalChainEthereum, 6, ethereumHeader0)
+	require.Contains(err.Error(), string(RuleErrorExternalHeaderHeightMismatch))
+	require.NoError(anchorHeaders(utxoView, ExternalChainEthereum, 5, ethereumHeader0))
+	err = anchorHeaders(utxoView, ExternalChainEthereum, 6, encodeEthereumHeader(ethereumEntry0.BlockHash[:], 6, 1000))
+	require.Contains(err.Error(), string(RuleErrorExternalHeaderTimestampTooEarly))
+	require.NoError(anchorHeaders(utxoView, ExternalChainEthereum, 6, encodeEthereumHeader(ethereumEntry0.BlockHash[:], 6, 1012)))
+
+	// Headers of one chain don't affect the other.
+	tipEntry, err = utxoView.GetExternalChainTip(ExternalChainEthereum)
+	require.NoError(err)
+	require.Equal(uint64(6), tipEntry.Height)
+	tipEntry, err = utxoView.GetExternalChainTip(ExternalChainBitcoin)
+	require.NoError(err)
+	require.Equal(uint64(100), tipEntry.Height)
+
+	// The metadata round-trips.
+	metadata := &AnchorExternalHeadersMetadata{
+		ExternalChain: ExternalChainBitcoin,
+		StartHeight:   100,
+		Headers:       [][]byte{header0, header1},
+	}
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &AnchorExternalHeadersMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(metadata, decodedMetadata)
+}
+
+func TestAnchorExternalHeadersConnectAndDisconnect(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(101)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	// Mine headers against the regtest PoW limit so the test runs quickly.
+	params.BitcoinBtcdParams = &chaincfg.RegressionNetParams
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(m4PkBytes)] = true
+	// The anchoring migration can't come before the balance model migration, since an
+	// encoder's version byte is decoded as the height of the newest migration it was encoded with.
+	params.ForkHeights.ExternalHeaderAnchoringBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m4", senderPkString, m4Pub, senderPrivString, 1e4)
+
+	header0, hash0 := _mineBitcoinHeader(t, &chainhash.Hash{}, 1700000000)
+	header1, hash1 := _mineBitcoinHeader(t, hash0, 1700000600)
+	header2, hash2 := _mineBitcoinHeader(t, hash1, 1700001200)
+	header3, _ := _mineBitcoinHeader(t, hash2, 1700001800)
+	orphanHeader, _ := _mineBitcoinHeader(t, &chainhash.Hash{1}, 1700000000)
+	newMetadata := func(startHeight uint64, headers ...[]byte) *AnchorExternalHeadersMetadata {
+		return &AnchorExternalHeadersMetadata{
+			ExternalChain: ExternalChainBitcoin,
+			StartHeight:   startHeight,
+			Headers:       headers,
+		}
+	}
+	requireTip := func(utxoView *UtxoView, expectedHash *chainhash.Hash, expectedHeight uint64) {
+		if utxoView == nil {
+			utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		}
+		tipEntry, err := utxoView.GetExternalChainTip(ExternalChainBitcoin)
+		require.NoError(err)
+		require.NotNil(tipEntry)
+		require.Equal(expectedHash[:], tipEntry.BlockHash[:])
+		require.Equal(expectedHeight, tipEntry.Height)
+	}
+
+	// Anchoring is limited to the relayers on the allow-list. The constructor won't build a
+	// txn for anyone else, and a txn built around it is rejected when it's connected.
+	_, _, err := _anchorExternalHeaders(t, chain, db, params, feeRateNanosPerKB, m0Pub, m0Priv,
+		newMetadata(100, header0))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorExternalHeaderRelayerNotRegistered)
+	unregisteredTxn := &MsgDeSoTxn{
+		PublicKey: m1PkBytes,
+		TxnMeta:   newMetadata(100, header0),
+		TxOutputs: []*DeSoOutput{},
+	}
+	_, _, _, _, err = chain.AddInputsAndChangeToTransaction(unregisteredTxn, feeRateNanosPerKB, nil)
+	require.NoError(err)
+	_signTxn(t, unregisteredTxn, m1Priv)
+	_, _, _, _, err = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil).ConnectTransaction(
+		unregisteredTxn, unregisteredTxn.Hash(), chain.blockTip().Height+1, 0, true, false)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorExternalHeaderRelayerNotRegistered)
+
+	// m4 puts m0 on the allow-list, and m0 anchors the first two headers as a checkpoint.
+	_updateGlobalParamsEntryWithExtraData(testMeta, feeRateNanosPerKB, m4Pub, m4Priv, map[string][]byte{
+		ExternalHeaderRelayerPublicKeyKey: m0PkBytes,
+	})
+	_anchorExternalHeadersWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv,
+		newMetadata(100, header0, header1))
+	requireTip(nil, hash1, 101)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	header0Entry, err := DBGetExternalHeaderEntry(db, chain.snapshot, ExternalChainBitcoin, NewBlockHash(hash0[:]))
+	require.NoError(err)
+	require.Equal(uint64(100), header0Entry.Height)
+	require.Equal(m0PKID, header0Entry.RelayerPKID)
+
+	// Putting m0 on the allow-list doesn't let anyone else anchor.
+	_, _, _, _, err = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil).ConnectTransaction(
+		unregisteredTxn, unregisteredTxn.Hash(), chain.blockTip().Height+1, 0, true, false)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorExternalHeaderRelayerNotRegistered)
+
+	// Once the chain has headers, a header that doesn't link to them is rejected, whether it
+	// links to nothing anchored or it's anchored at the wrong height.
+	for expectedErr, metadata := range map[RuleError]*AnchorExternalHeadersMetadata{
+		RuleErrorExternalHeaderParentNotAnchored: newMetadata(102, orphanHeader),
+		RuleErrorExternalHeaderHeightMismatch:    newMetadata(103, header2),
+		RuleErrorExternalHeaderAlreadyAnchored:   newMetadata(101, header1),
+	} {
+		_, _, err = _anchorExternalHeaders(t, chain, db, params, feeRateNanosPerKB, m0Pub, m0Priv, metadata)
+		require.Error(err)
+		require.Contains(err.Error(), expectedErr)
+	}
+	// The same holds for a txn built around the constructor's checks.
+	orphanTxn := &MsgDeSoTxn{
+		PublicKey: m0PkBytes,
+		TxnMeta:   newMetadata(102, orphanHeader),
+		TxOutputs: []*DeSoOutput{},
+	}
+	_, _, _, _, err = chain.AddInputsAndChangeToTransaction(orphanTxn, feeRateNanosPerKB, nil)
+	require.NoError(err)
+	_signTxn(t, orphanTxn, m0Priv)
+	_, _, _, _, err = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil).ConnectTransaction(
+		orphanTxn, orphanTxn.Hash(), chain.blockTip().Height+1, 0, true, false)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorExternalHeaderParentNotAnchored)
+
+	// m0 extends the chain, and disconnecting the txn in a view deletes the header it
+	// anchored and puts the tip back.
+	_anchorExternalHeadersWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, newMetadata(102, header2))
+	requireTip(nil, hash2, 102)
+	lastTxn := testMeta.txns[len(testMeta.txns)-1]
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	require.NoError(utxoView.DisconnectTransaction(
+		lastTxn, lastTxn.Hash(), testMeta.txnOps[len(testMeta.txnOps)-1], chain.blockTip().Height+1))
+	header2Entry, err := utxoView.GetExternalHeaderEntry(ExternalChainBitcoin, NewBlockHash(hash2[:]))
+	require.NoError(err)
+	require.Nil(header2Entry)
+	requireTip(utxoView, hash1, 101)
+
+	// m4 takes m0 off the allow-list, so m0 can't anchor any more headers.
+	_updateGlobalParamsEntryWithExtraData(testMeta, feeRateNanosPerKB, m4Pub, m4Priv, map[string][]byte{
+		ExternalHeaderRelayerPublicKeyKey: m0PkBytes,
+		RemoveExternalHeaderRelayerKey:    {1},
+	})
+	_, _, err = _anchorExternalHeaders(t, chain, db, params, feeRateNanosPerKB, m0Pub, m0Priv,
+		newMetadata(103, header3))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorExternalHeaderRelayerNotRegistered)
+	requireTip(nil, hash2, 102)
+
+	// Rolling everything back deletes the headers and takes m0 off the allow-list.
+	_executeAllTestRollbackAndFlush(testMeta)
+	for _, blockHash := range []*chainhash.Hash{hash0, hash1, hash2} {
+		externalHeaderEntry, err := DBGetExternalHeaderEntry(
+			db, chain.snapshot, ExternalChainBitcoin, NewBlockHash(blockHash[:]))
+		require.NoError(err)
+		require.Nil(externalHeaderEntry)
+	}
+	tipEntry, err := DBGetTopExternalHeaderEntry(db, chain.snapshot, ExternalChainBitcoin, nil)
+	require.NoError(err)
+	require.Nil(tipEntry)
+	relayerEntry, err := DBGetExternalHeaderRelayerEntry(db, chain.snapshot, m0PkBytes)
+	require.NoError(err)
+	require.Nil(relayerEntry)
+}
+
+//
+// ----- HELPERS
+//
+
+// _mineBitcoinHeader mines a Bitcoin header against the regtest PoW limit and returns its
+// bytes and its hash.
+func _mineBitcoinHeader(t *testing.T, prevBlock *chainhash.Hash, timestampSecs int64) ([]byte, *chainhash.Hash) {
+	header := &wire.BlockHeader{
+		Version:   1,
+		PrevBlock: *prevBlock,
+		Timestamp: time.Unix(timestampSecs, 0),
+		Bits:      0x207fffff,
+	}
+	target := btcdchain.CompactToBig(header.Bits)
+	for {
+		blockHash := header.BlockHash()
+		if btcdchain.HashToBig(&blockHash).Cmp(target) <= 0 {
+			buf := bytes.NewBuffer(nil)
+			require.NoError(t, header.Serialize(buf))
+			return buf.Bytes(), &blockHash
+		}
+		header.Nonce++
+	}
+}
+
+func _anchorExternalHeadersWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *AnchorExternalHeadersMetadata,
+) {
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check))
+	currentOps, currentTxn, err := _anchorExternalHeaders(
+		testMeta.t, testMeta.chain, testMeta.db, testMeta.params, feeRateNanosPerKB,
+		transactorPublicKeyBase58Check, transactorPrivateKeyBase58Check, metadata)
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+func _anchorExternalHeaders(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoParams,
+	feeRateNanosPerKB uint64, transactorPublicKeyBase58Check string, transactorPrivateKeyBase58Check string,
+	metadata *AnchorExternalHeadersMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	txn, totalInputMake, _, feesMake, err := chain.CreateAnchorExternalHeadersTxn(
+		transactorPkBytes, metadata, nil, feeRateNanosPerKB, nil, []*DeSoOutput{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(t, txn, transactorPrivateKeyBase58Check)
+
+	// Always use height+1 for validation since it's assumed the transaction will
+	// get mined into the next block.
+	blockHeight := chain.blockTip().Height + 1
+	utxoOps, totalInput, totalOutput, fees, err :=
+		utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	require.Equal(totalInput, totalOutput+fees)
+	require.Equal(totalInputMake, totalInput)
+	require.Equal(feesMake, fees)
+	require.Equal(OperationTypeSpendBalance, utxoOps[0].Type)
+	require.Equal(OperationTypeAnchorExternalHeaders, utxoOps[len(utxoOps)-1].Type)
+
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+
+	return utxoOps, txn, nil
+}
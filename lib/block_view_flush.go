@@ -26,6 +26,8 @@ func (bav *UtxoView) FlushToDb(blockHeight uint64) error {
 	if err != nil {
 		return err
 	}
+	// Now that the flush has committed, let the flush hooks know.
+	bav.EventManager.utxoViewFlushCommitted()
 
 	// After a successful flush, reset the in-memory mappings for the view
 	// so that it can be re-used if desired.
@@ -67,6 +69,8 @@ func (bav *UtxoView) FlushToDbWithTxn(txn *badger.Txn, blockHeight uint64) error
 // view within a badger transaction that itself calls PrepareAncestralRecordsFlush
 // and defer StartAncestralRecordsFlush.
 func (bav *UtxoView) FlushToDBWithoutAncestralRecordsFlushWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Track the prefixes this flush modifies for the flush hooks, if any are registered.
+	bav.EventManager.beginUtxoViewFlush()
 
 	// Only flush to BadgerDB if Postgres is disabled
 	if bav.Postgres == nil {
@@ -106,6 +110,9 @@ func (bav *UtxoView) FlushToDBWithoutAncestralRecordsFlushWithTxn(txn *badger.Tx
 		if err := bav._flushForbiddenPubKeyEntriesToDbWithTxn(txn); err != nil {
 			return err
 		}
+		if err := bav._flushBlockProducerRegistryEntriesToDbWithTxn(txn, blockHeight); err != nil {
+			return err
+		}
 		if err := bav._flushNFTEntriesToDbWithTxn(txn, blockHeight); err != nil {
 			return err
 		}
@@ -156,6 +163,56 @@ func (bav *UtxoView) FlushToDBWithoutAncestralRecordsFlushWithTxn(txn *badger.Tx
 	if err := bav._flushDAOCoinLimitOrderEntriesToDbWithTxn(txn, blockHeight); err != nil {
 		return err
 	}
+	// Last trade prices are read alongside limit orders when matching, so they
+	// live in badger as well.
+	if err := bav._flushDAOCoinLastTradePriceEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushDAOCoinMetadataEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushExternalHeaderRelayerEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushExternalHeaderEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushExchangeRateFeedEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushProfilePicBlobsToDbWithTxn(txn); err != nil {
+		return err
+	}
+	if err := bav._flushDeadKeyEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushMultisigEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushDAOCoinStreamEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushGovernanceEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushRoyaltySplitEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushNFTBundleEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushNFTSwapEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushEscrowEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushArchivedNFTBidsToDbWithTxn(txn); err != nil {
+		return err
+	}
+	if err := bav._flushDAOCoinLimitOrderFillEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
 	if err := bav._flushNonceEntriesToDbWithTxn(txn); err != nil {
 		return err
 	}
@@ -177,6 +234,15 @@ func (bav *UtxoView) FlushToDBWithoutAncestralRecordsFlushWithTxn(txn *badger.Tx
 	if err := bav._flushLockedStakeEntriesToDbWithTxn(txn, blockHeight); err != nil {
 		return err
 	}
+	if err := bav._flushValidatorRewardIndexEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushValidatorRewardIndexAtEpochEndEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
+	if err := bav._flushValidatorEpochPerformanceEntriesToDbWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
 	// TODO: We may want to move this into a new FlushToDb function that only flushes
 	// entries set in the OnEpochEndHook. No sense in wasting a bunch of cycles flushing
 	// all the other entries which will always be nil/empty in the OnEpochEndHook.
@@ -201,6 +267,10 @@ func (bav *UtxoView) FlushToDBWithoutAncestralRecordsFlushWithTxn(txn *badger.Tx
 	if err := bav._flushSnapshotValidatorBLSPublicKeyPKIDPairEntryToDbWithTxn(txn, blockHeight); err != nil {
 		return err
 	}
+	// Persist the flush cursor in the same transaction as the flush.
+	if err := bav.EventManager.finishUtxoViewFlushWithTxn(txn, blockHeight); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -531,6 +601,16 @@ func (bav *UtxoView) _flushFollowEntriesToDbWithTxn(txn *badger.Txn) error {
 }
 
 func (bav *UtxoView) _flushNFTEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// The owner index is backfilled from the db before any entries are flushed at the
+	// NFTOwnerIndexBlockHeight so that the flush below keeps it up-to-date.
+	if blockHeight == uint64(bav.Params.ForkHeights.NFTOwnerIndexBlockHeight) {
+		if err := DBBackfillNFTOwnerIndexWithTxn(txn, bav.Snapshot, bav.EventManager); err != nil {
+			return errors.Wrapf(err, "_flushNFTEntriesToDbWithTxn: ")
+		}
+	}
+	isOwnerIndexEnabled := blockHeight >= uint64(bav.Params.ForkHeights.NFTOwnerIndexBlockHeight)
+	// There are no leases before the NFTLeaseBlockHeight, so the lessee index doesn't need a backfill.
+	isLesseeIndexEnabled := blockHeight >= uint64(bav.Params.ForkHeights.NFTLeaseBlockHeight)
 
 	// Go through and delete all the entries so they can be added back fresh.
 	for nftKeyIter, nftEntry := range bav.NFTKeyToNFTEntry {
@@ -547,7 +627,18 @@ func (bav *UtxoView) _flushNFTEntriesToDbWithTxn(txn *badger.Txn, blockHeight ui
 		}
 
 		// Delete the existing mappings in the db for this NFTKey. They will be re-added
-		// if the corresponding entry in memory has isDeleted=false.
+		// if the corresponding entry in memory has isDeleted=false. The owner and lessee
+		// indexes are deleted first since they're looked up from the NFTEntry in the db.
+		if isOwnerIndexEnabled {
+			if err := DBDeleteNFTOwnerIndexWithTxn(txn, bav.Snapshot, nftEntry.NFTPostHash, nftEntry.SerialNumber, bav.EventManager, nftEntry.isDeleted); err != nil {
+				return errors.Wrapf(err, "_flushNFTEntriesToDbWithTxn: ")
+			}
+		}
+		if isLesseeIndexEnabled {
+			if err := DBDeleteNFTLesseeIndexWithTxn(txn, bav.Snapshot, nftEntry.NFTPostHash, nftEntry.SerialNumber, bav.EventManager, nftEntry.isDeleted); err != nil {
+				return errors.Wrapf(err, "_flushNFTEntriesToDbWithTxn: ")
+			}
+		}
 		if err := DBDeleteNFTMappingsWithTxn(txn, bav.Snapshot, nftEntry.NFTPostHash, nftEntry.SerialNumber, bav.EventManager, nftEntry.isDeleted); err != nil {
 
 			return errors.Wrapf(
@@ -567,6 +658,16 @@ func (bav *UtxoView) _flushNFTEntriesToDbWithTxn(txn *badger.Txn, blockHeight ui
 			if err := DBPutNFTEntryMappingsWithTxn(txn, bav.Snapshot, blockHeight, nftEntry, bav.EventManager); err != nil {
 				return err
 			}
+			if isOwnerIndexEnabled {
+				if err := DBPutNFTOwnerIndexWithTxn(txn, bav.Snapshot, nftEntry, bav.EventManager); err != nil {
+					return errors.Wrapf(err, "_flushNFTEntriesToDbWithTxn: ")
+				}
+			}
+			if isLesseeIndexEnabled {
+				if err := DBPutNFTLesseeIndexWithTxn(txn, bav.Snapshot, nftEntry, bav.EventManager); err != nil {
+					return errors.Wrapf(err, "_flushNFTEntriesToDbWithTxn: ")
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// block_view_flush_hooks.go lets downstream indexers follow UtxoView flushes exactly once.
+// Handlers registered with EventManager.OnUtxoViewFlushed are called after a flush commits,
+// with the block height it was flushed at and the prefixes it modified. Alongside the flush,
+// in the same badger transaction, we persist a UtxoViewFlushCursor describing it. Since the
+// cursor commits atomically with the flush, an indexer that records the SequenceNumber of
+// the last event it processed can compare it against DBGetUtxoViewFlushCursor on startup:
+// if the cursor is ahead, the node crashed between committing the flush and delivering the
+// event, and the indexer can re-process the cursor's height and prefixes.
+//
+// Prefixes are only tracked, and the cursor only written, while at least one handler is
+// registered, so nodes that don't use flush hooks are unaffected. The mutations themselves
+// are only recorded, in the order they were written, once EnableUtxoViewFlushMutations has
+// been called, since holding them costs as much memory as the flush itself.
+
+// UtxoViewFlushCursor describes the last committed UtxoView flush.
+type UtxoViewFlushCursor struct {
+	// SequenceNumber is incremented by every flush that writes the cursor. It survives
+	// restarts, so it can be used to order flushes and to detect missed events.
+	SequenceNumber uint64
+	// BlockHeight is the block height the view was flushed at.
+	BlockHeight uint64
+	// ModifiedPrefixes holds the prefixes that the flush set or deleted keys under, in
+	// ascending order. Each prefix is MaxPrefixLen bytes long.
+	ModifiedPrefixes [][]byte
+}
+
+// UtxoViewFlushMutation is a single key set or deleted by a UtxoView flush.
+type UtxoViewFlushMutation struct {
+	// OperationType is either DbOperationTypeUpsert or DbOperationTypeDelete.
+	OperationType StateSyncerOperationType
+	KeyBytes      []byte
+	// EncoderBytes is the value the key was set to. It's nil for deletes.
+	EncoderBytes []byte
+}
+
+// ModifiedPrefix returns true if the flush modified keys under the given prefix.
+func (cursor *UtxoViewFlushCursor) ModifiedPrefix(prefix []byte) bool {
+	for _, modifiedPrefix := range cursor.ModifiedPrefixes {
+		if bytes.Equal(modifiedPrefix, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cursor *UtxoViewFlushCursor) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(cursor.SequenceNumber)...)
+	data = append(data, UintToBuf(cursor.BlockHeight)...)
+	data = append(data, UintToBuf(uint64(len(cursor.ModifiedPrefixes)))...)
+	for _, prefix := range cursor.ModifiedPrefixes {
+		data = append(data, EncodeByteArray(prefix)...)
+	}
+	return data
+}
+
+func (cursor *UtxoViewFlushCursor) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	cursor.SequenceNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewFlushCursor.FromBytes: Problem reading SequenceNumber: ")
+	}
+	cursor.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewFlushCursor.FromBytes: Problem reading BlockHeight: ")
+	}
+	numPrefixes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewFlushCursor.FromBytes: Problem reading number of ModifiedPrefixes: ")
+	}
+	cursor.ModifiedPrefixes, err = SafeMakeSliceWithLength[[]byte](numPrefixes)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewFlushCursor.FromBytes: Problem creating ModifiedPrefixes slice: ")
+	}
+	for ii := range cursor.ModifiedPrefixes {
+		cursor.ModifiedPrefixes[ii], err = DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "UtxoViewFlushCursor.FromBytes: Problem reading ModifiedPrefix: ")
+		}
+	}
+	return nil
+}
+
+//
+// DB UTILS
+//
+
+func DBGetUtxoViewFlushCursor(handle *badger.DB) (*UtxoViewFlushCursor, error) {
+	var ret *UtxoViewFlushCursor
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetUtxoViewFlushCursorWithTxn(txn)
+		return innerErr
+	})
+	return ret, err
+}
+
+// DBGetUtxoViewFlushCursorWithTxn returns the cursor of the last committed flush, or nil if
+// no flush has written one yet.
+func DBGetUtxoViewFlushCursorWithTxn(txn *badger.Txn) (*UtxoViewFlushCursor, error) {
+	cursorBytes, err := DBGetWithTxn(txn, nil, Prefixes.PrefixUtxoViewFlushCursor)
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetUtxoViewFlushCursorWithTxn: problem retrieving cursor: ")
+	}
+	cursor := &UtxoViewFlushCursor{}
+	if err = cursor.FromBytes(cursorBytes); err != nil {
+		return nil, errors.Wrapf(err, "DBGetUtxoViewFlushCursorWithTxn: problem decoding cursor: ")
+	}
+	return cursor, nil
+}
+
+func DBPutUtxoViewFlushCursorWithTxn(txn *badger.Txn, cursor *UtxoViewFlushCursor) error {
+	// The cursor isn't state, so we don't pass the snapshot, and we don't pass the event
+	// manager so that writing it isn't tracked as a modification.
+	if err := DBSetWithTxn(txn, nil, Prefixes.PrefixUtxoViewFlushCursor, cursor.ToBytes(), nil); err != nil {
+		return errors.Wrapf(err, "DBPutUtxoViewFlushCursorWithTxn: problem storing cursor: ")
+	}
+	return nil
+}
+
+//
+// FLUSH TRACKING
+//
+
+// utxoViewFlushTracker accumulates the prefixes modified by the UtxoView flush in progress,
+// and holds the event for the flush until its badger transaction commits.
+type utxoViewFlushTracker struct {
+	mtx sync.Mutex
+	// modifiedPrefixes is nil while no flush is in progress.
+	modifiedPrefixes map[byte]struct{}
+	// pendingEvent is set once the flush has written its cursor, and is consumed by
+	// utxoViewFlushCommitted.
+	pendingEvent *UtxoViewFlushedEvent
+	// recordMutations is set by EnableUtxoViewFlushMutations, in which case mutations holds
+	// the keys modified by the flush in progress in the order they were modified.
+	recordMutations bool
+	mutations       []*UtxoViewFlushMutation
+}
+
+// isTrackingUtxoViewFlushes returns true if the flush hooks need to track flushes through
+// this event manager.
+func (em *EventManager) isTrackingUtxoViewFlushes() bool {
+	return em != nil && !em.isMempoolManager && len(em.utxoViewFlushedHandlers) > 0
+}
+
+// beginUtxoViewFlush starts tracking the keys modified through this event manager. Any
+// event pending from a flush whose transaction never committed is dropped.
+func (em *EventManager) beginUtxoViewFlush() {
+	if !em.isTrackingUtxoViewFlushes() {
+		return
+	}
+	em.utxoViewFlushTracker.mtx.Lock()
+	defer em.utxoViewFlushTracker.mtx.Unlock()
+	em.utxoViewFlushTracker.modifiedPrefixes = make(map[byte]struct{})
+	em.utxoViewFlushTracker.mutations = nil
+	em.utxoViewFlushTracker.pendingEvent = nil
+}
+
+// recordModifiedKey is called by DBSetWithTxn and DBDeleteWithTxn for every key they modify.
+// The value is nil for deletes.
+func (em *EventManager) recordModifiedKey(operationType StateSyncerOperationType, key []byte, value []byte) {
+	if !em.isTrackingUtxoViewFlushes() || len(key) < MaxPrefixLen {
+		return
+	}
+	em.utxoViewFlushTracker.mtx.Lock()
+	defer em.utxoViewFlushTracker.mtx.Unlock()
+	if em.utxoViewFlushTracker.modifiedPrefixes == nil {
+		return
+	}
+	em.utxoViewFlushTracker.modifiedPrefixes[key[0]] = struct{}{}
+	if em.utxoViewFlushTracker.recordMutations {
+		em.utxoViewFlushTracker.mutations = append(em.utxoViewFlushTracker.mutations, &UtxoViewFlushMutation{
+			OperationType: operationType,
+			KeyBytes:      key,
+			EncoderBytes:  value,
+		})
+	}
+}
+
+// finishUtxoViewFlushWithTxn writes the cursor for the flush in progress to the flush's badger
+// transaction, and holds the flush's event until utxoViewFlushCommitted is called.
+func (em *EventManager) finishUtxoViewFlushWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	if !em.isTrackingUtxoViewFlushes() {
+		return nil
+	}
+	em.utxoViewFlushTracker.mtx.Lock()
+	defer em.utxoViewFlushTracker.mtx.Unlock()
+	if em.utxoViewFlushTracker.modifiedPrefixes == nil {
+		return nil
+	}
+
+	prevCursor, err := DBGetUtxoViewFlushCursorWithTxn(txn)
+	if err != nil {
+		return errors.Wrapf(err, "finishUtxoViewFlushWithTxn: ")
+	}
+	cursor := &UtxoViewFlushCursor{
+		BlockHeight: blockHeight,
+	}
+	if prevCursor != nil {
+		cursor.SequenceNumber = prevCursor.SequenceNumber + 1
+	}
+	for prefix := range em.utxoViewFlushTracker.modifiedPrefixes {
+		cursor.ModifiedPrefixes = append(cursor.ModifiedPrefixes, []byte{prefix})
+	}
+	sort.Slice(cursor.ModifiedPrefixes, func(ii, jj int) bool {
+		return cursor.ModifiedPrefixes[ii][0] < cursor.ModifiedPrefixes[jj][0]
+	})
+	if err = DBPutUtxoViewFlushCursorWithTxn(txn, cursor); err != nil {
+		return errors.Wrapf(err, "finishUtxoViewFlushWithTxn: ")
+	}
+
+	em.utxoViewFlushTracker.pendingEvent = &UtxoViewFlushedEvent{
+		Cursor:    cursor,
+		Mutations: em.utxoViewFlushTracker.mutations,
+	}
+	em.utxoViewFlushTracker.modifiedPrefixes = nil
+	em.utxoViewFlushTracker.mutations = nil
+	return nil
+}
+
+// utxoViewFlushCommitted fires the event of the last flush once its badger transaction has
+// committed. Callers that flush a view within their own transaction must call it after the
+// transaction commits.
+func (em *EventManager) utxoViewFlushCommitted() {
+	if !em.isTrackingUtxoViewFlushes() {
+		return
+	}
+	em.utxoViewFlushTracker.mtx.Lock()
+	event := em.utxoViewFlushTracker.pendingEvent
+	em.utxoViewFlushTracker.pendingEvent = nil
+	em.utxoViewFlushTracker.mtx.Unlock()
+	if event == nil {
+		return
+	}
+	em.utxoViewFlushed(event)
+}
@@ -0,0 +1,64 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUtxoViewFlushHooks(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+
+	eventManager := NewEventManager()
+	var feedEvents, allEvents []*UtxoViewFlushedEvent
+	eventManager.OnUtxoViewFlushed([][]byte{Prefixes.PrefixExchangeRateFeedEntryByPublicKey}, func(event *UtxoViewFlushedEvent) {
+		feedEvents = append(feedEvents, event)
+	})
+	eventManager.OnUtxoViewFlushed(nil, func(event *UtxoViewFlushedEvent) {
+		allEvents = append(allEvents, event)
+	})
+
+	// A flush that modifies a prefix notifies the hooks registered for it, and persists
+	// a cursor describing the flush.
+	utxoView := NewUtxoView(db, &params, nil, nil, eventManager)
+	utxoView._setExchangeRateFeedEntryMappings(&ExchangeRateFeedEntry{PublicKey: m0PkBytes})
+	require.NoError(utxoView.FlushToDb(5))
+	require.Len(feedEvents, 1)
+	require.Len(allEvents, 1)
+	require.Equal(uint64(0), feedEvents[0].Cursor.SequenceNumber)
+	require.Equal(uint64(5), feedEvents[0].Cursor.BlockHeight)
+	require.True(feedEvents[0].Cursor.ModifiedPrefix(Prefixes.PrefixExchangeRateFeedEntryByPublicKey))
+	require.False(feedEvents[0].Cursor.ModifiedPrefix(Prefixes.PrefixExternalHeaderRelayerByPublicKey))
+	cursor, err := DBGetUtxoViewFlushCursor(db)
+	require.NoError(err)
+	require.Equal(feedEvents[0].Cursor, cursor)
+
+	// A flush that doesn't modify the prefix only notifies the hooks registered without
+	// prefixes, and the sequence number keeps increasing.
+	utxoView = NewUtxoView(db, &params, nil, nil, eventManager)
+	utxoView._setExternalHeaderRelayerEntryMappings(&ExternalHeaderRelayerEntry{PublicKey: m1PkBytes})
+	require.NoError(utxoView.FlushToDb(6))
+	require.Len(feedEvents, 1)
+	require.Len(allEvents, 2)
+	require.Equal(uint64(1), allEvents[1].Cursor.SequenceNumber)
+	require.Equal(uint64(6), allEvents[1].Cursor.BlockHeight)
+	require.True(allEvents[1].Cursor.ModifiedPrefix(Prefixes.PrefixExternalHeaderRelayerByPublicKey))
+	require.False(allEvents[1].Cursor.ModifiedPrefix(Prefixes.PrefixExchangeRateFeedEntryByPublicKey))
+	cursor, err = DBGetUtxoViewFlushCursor(db)
+	require.NoError(err)
+	require.Equal(uint64(1), cursor.SequenceNumber)
+
+	// Without registered hooks, flushes don't touch the cursor.
+	utxoView = NewUtxoView(db, &params, nil, nil, NewEventManager())
+	utxoView._deleteExchangeRateFeedEntryMappings(&ExchangeRateFeedEntry{PublicKey: m0PkBytes})
+	require.NoError(utxoView.FlushToDb(7))
+	cursor, err = DBGetUtxoViewFlushCursor(db)
+	require.NoError(err)
+	require.Equal(uint64(1), cursor.SequenceNumber)
+}
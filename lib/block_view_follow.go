@@ -30,23 +30,11 @@ func (bav *UtxoView) _getFollowEntryForFollowKey(followKey *FollowKey) *FollowEn
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil. Either way, save the value to the in-memory view mapping got later.
-	followExists := false
-	if bav.Postgres != nil {
-		followExists = bav.Postgres.GetFollow(&followKey.FollowerPKID, &followKey.FollowedPKID) != nil
-	} else {
-		followExists = DbGetFollowerToFollowedMapping(bav.Handle, bav.Snapshot, &followKey.FollowerPKID, &followKey.FollowedPKID) != nil
-	}
-
-	if followExists {
-		followEntry := FollowEntry{
-			FollowerPKID: &followKey.FollowerPKID,
-			FollowedPKID: &followKey.FollowedPKID,
-		}
-		bav._setFollowEntryMappings(&followEntry)
-		return &followEntry
+	followEntry := bav.GetDbAdapter().GetFollowEntry(&followKey.FollowerPKID, &followKey.FollowedPKID)
+	if followEntry != nil {
+		bav._setFollowEntryMappings(followEntry)
 	}
-
-	return nil
+	return followEntry
 }
 
 // Make sure that follows are loaded into the view before calling this
@@ -118,45 +106,19 @@ func (bav *UtxoView) GetFollowEntriesForPublicKey(publicKey []byte, getEntriesFo
 	}
 
 	// Start by fetching all the follows we have in the db.
-	if bav.Postgres != nil {
-		var follows []*PGFollow
-		if getEntriesFollowingPublicKey {
-			follows = bav.Postgres.GetFollowers(pkidForPublicKey.PKID)
-		} else {
-			follows = bav.Postgres.GetFollowing(pkidForPublicKey.PKID)
-		}
-
-		for _, follow := range follows {
-			if _, exists := bav.FollowKeyToFollowEntry[MakeFollowKey(follow.FollowerPKID, follow.FollowedPKID)]; !exists {
-				bav._setFollowEntryMappings(follow.NewFollowEntry())
-			}
-		}
-	} else {
-		var dbPKIDs []*PKID
-		var err error
-		if getEntriesFollowingPublicKey {
-			dbPKIDs, err = DbGetPKIDsFollowingYou(bav.Handle, pkidForPublicKey.PKID)
-		} else {
-			dbPKIDs, err = DbGetPKIDsYouFollow(bav.Handle, pkidForPublicKey.PKID)
-		}
-		if err != nil {
-			return nil, errors.Wrapf(err, "GetFollowsForUser: Problem fetching FollowEntrys from db: ")
-		}
+	dbFollowEntries, err := bav.GetDbAdapter().GetFollowEntriesForPKID(
+		pkidForPublicKey.PKID, getEntriesFollowingPublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetFollowsForUser: Problem fetching FollowEntrys from db: ")
+	}
 
-		// Iterate through the entries found in the db and force the view to load them.
-		// This fills in any gaps in the view so that, after this, the view should contain
-		// the union of what it had before plus what was in the db.
-		for _, dbPKID := range dbPKIDs {
-			var followKey FollowKey
-			if getEntriesFollowingPublicKey {
-				// publicKey is the followed public key
-				followKey = MakeFollowKey(dbPKID, pkidForPublicKey.PKID)
-			} else {
-				// publicKey is the follower public key
-				followKey = MakeFollowKey(pkidForPublicKey.PKID, dbPKID)
-			}
-
-			bav._getFollowEntryForFollowKey(&followKey)
+	// Iterate through the entries found in the db and load the ones the view doesn't have.
+	// This fills in any gaps in the view so that, after this, the view should contain
+	// the union of what it had before plus what was in the db.
+	for _, dbFollowEntry := range dbFollowEntries {
+		followKey := MakeFollowKey(dbFollowEntry.FollowerPKID, dbFollowEntry.FollowedPKID)
+		if _, exists := bav.FollowKeyToFollowEntry[followKey]; !exists {
+			bav._setFollowEntryMappings(dbFollowEntry)
 		}
 	}
 
@@ -0,0 +1,1299 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_governance.go implements on-chain governance for DAO coins. Anyone who holds a
+// DAO coin, or the coin's creator, can put a proposal with a few options to the coin's holders
+// with the CreateProposal txn, and the holders vote on it with the CastVote txn until the
+// proposal's VotingEndBlockHeight.
+//
+// A holder's voting power is their balance of the DAO coin at the block the proposal was
+// created in. The chain doesn't keep a history of balances, so the balances are snapshotted
+// when the proposal is created: a VoteEntry is created for every holder with their balance as
+// its VotingPower and no option. Coins that move after the proposal is created don't change
+// anyone's voting power, so coins can't be used to vote twice. Locked balances and coins
+// escrowed in streams aren't part of the snapshot. Snapshotting every holder is bounded by
+// MaxProposalSnapshotHolders.
+//
+// The chain only tallies the votes. What a proposal's outcome means, e.g. whether it needs a
+// quorum, is up to the DAO.
+
+const (
+	// MaxProposalDescriptionLengthBytes bounds the description of a proposal.
+	MaxProposalDescriptionLengthBytes = 10000
+	// MinProposalOptions and MaxProposalOptions bound the number of options a proposal has.
+	MinProposalOptions = 2
+	MaxProposalOptions = 16
+	// MaxProposalOptionLengthBytes bounds each of a proposal's options.
+	MaxProposalOptionLengthBytes = 256
+	// MaxProposalSnapshotHolders bounds the number of holders a DAO coin can have for a
+	// proposal to be created for it, since creating a proposal snapshots every holder.
+	MaxProposalSnapshotHolders = 5000
+
+	// ProposalVoteOptionNone is the OptionIndex of a holder who hasn't voted.
+	ProposalVoteOptionNone = uint64(math.MaxUint64)
+)
+
+//
+// TYPES: ProposalEntry
+//
+
+type ProposalEntry struct {
+	// ProposalID is the hash of the txn that created the proposal.
+	ProposalID   *BlockHash
+	ProposerPKID *PKID
+	// ProfilePKID is the PKID of the DAO coin whose holders vote on the proposal.
+	ProfilePKID *PKID
+	Description []byte
+	Options     [][]byte
+	// SnapshotBlockHeight is the height of the block the proposal was created in, whose
+	// balances are the holders' voting power.
+	SnapshotBlockHeight uint64
+	// Votes can be cast in the blocks before VotingEndBlockHeight.
+	VotingEndBlockHeight uint64
+	// OptionVotingPowers is the voting power that has been cast for each option.
+	OptionVotingPowers []*uint256.Int
+	// TotalVotingPower is the voting power of every holder in the snapshot, whether or not
+	// they've voted.
+	TotalVotingPower *uint256.Int
+
+	isDeleted bool
+}
+
+func (entry *ProposalEntry) Copy() *ProposalEntry {
+	options := make([][]byte, 0, len(entry.Options))
+	for _, option := range entry.Options {
+		options = append(options, append([]byte{}, option...))
+	}
+	optionVotingPowers := make([]*uint256.Int, 0, len(entry.OptionVotingPowers))
+	for _, votingPower := range entry.OptionVotingPowers {
+		optionVotingPowers = append(optionVotingPowers, votingPower.Clone())
+	}
+	return &ProposalEntry{
+		ProposalID:           entry.ProposalID.NewBlockHash(),
+		ProposerPKID:         entry.ProposerPKID.NewPKID(),
+		ProfilePKID:          entry.ProfilePKID.NewPKID(),
+		Description:          append([]byte{}, entry.Description...),
+		Options:              options,
+		SnapshotBlockHeight:  entry.SnapshotBlockHeight,
+		VotingEndBlockHeight: entry.VotingEndBlockHeight,
+		OptionVotingPowers:   optionVotingPowers,
+		TotalVotingPower:     entry.TotalVotingPower.Clone(),
+		isDeleted:            entry.isDeleted,
+	}
+}
+
+func (entry *ProposalEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.ProposalID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ProposerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ProfilePKID, skipMetadata...)...)
+	data = append(data, EncodeByteArray(entry.Description)...)
+	data = append(data, UintToBuf(uint64(len(entry.Options)))...)
+	for _, option := range entry.Options {
+		data = append(data, EncodeByteArray(option)...)
+	}
+	data = append(data, UintToBuf(entry.SnapshotBlockHeight)...)
+	data = append(data, UintToBuf(entry.VotingEndBlockHeight)...)
+	data = append(data, UintToBuf(uint64(len(entry.OptionVotingPowers)))...)
+	for _, votingPower := range entry.OptionVotingPowers {
+		data = append(data, VariableEncodeUint256(votingPower)...)
+	}
+	data = append(data, VariableEncodeUint256(entry.TotalVotingPower)...)
+	return data
+}
+
+func (entry *ProposalEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// ProposalID
+	entry.ProposalID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading ProposalID: ")
+	}
+
+	// ProposerPKID
+	entry.ProposerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading ProposerPKID: ")
+	}
+
+	// ProfilePKID
+	entry.ProfilePKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading ProfilePKID: ")
+	}
+
+	// Description
+	entry.Description, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading Description: ")
+	}
+
+	// Options
+	entry.Options, err = _decodeProposalOptions(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: ")
+	}
+
+	// SnapshotBlockHeight
+	entry.SnapshotBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading SnapshotBlockHeight: ")
+	}
+
+	// VotingEndBlockHeight
+	entry.VotingEndBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading VotingEndBlockHeight: ")
+	}
+
+	// OptionVotingPowers
+	numOptionVotingPowers, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading number of OptionVotingPowers: ")
+	}
+	if numOptionVotingPowers > MaxProposalOptions {
+		return fmt.Errorf("ProposalEntry.Decode: %d OptionVotingPowers exceeds the max of %d",
+			numOptionVotingPowers, MaxProposalOptions)
+	}
+	entry.OptionVotingPowers = make([]*uint256.Int, 0, numOptionVotingPowers)
+	for ii := uint64(0); ii < numOptionVotingPowers; ii++ {
+		votingPower, err := VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading OptionVotingPowers: ")
+		}
+		entry.OptionVotingPowers = append(entry.OptionVotingPowers, votingPower)
+	}
+
+	// TotalVotingPower
+	entry.TotalVotingPower, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ProposalEntry.Decode: Problem reading TotalVotingPower: ")
+	}
+
+	return nil
+}
+
+func (entry *ProposalEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *ProposalEntry) GetEncoderType() EncoderType {
+	return EncoderTypeProposalEntry
+}
+
+func _decodeProposalOptions(rr *bytes.Reader) ([][]byte, error) {
+	numOptions, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem reading number of Options: ")
+	}
+	if numOptions > MaxProposalOptions {
+		return nil, fmt.Errorf("%d Options exceeds the max of %d", numOptions, MaxProposalOptions)
+	}
+	options := make([][]byte, 0, numOptions)
+	for ii := uint64(0); ii < numOptions; ii++ {
+		option, err := DecodeByteArray(rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Problem reading Options: ")
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+//
+// TYPES: VoteEntry
+//
+
+type VoteMapKey struct {
+	ProposalID BlockHash
+	VoterPKID  PKID
+}
+
+type VoteEntry struct {
+	ProposalID *BlockHash
+	VoterPKID  *PKID
+	// VotingPower is the voter's balance of the DAO coin when the proposal was created.
+	VotingPower *uint256.Int
+	// OptionIndex is the index of the option the voter voted for, or ProposalVoteOptionNone
+	// if they haven't voted.
+	OptionIndex uint64
+
+	isDeleted bool
+}
+
+func (entry *VoteEntry) Copy() *VoteEntry {
+	return &VoteEntry{
+		ProposalID:  entry.ProposalID.NewBlockHash(),
+		VoterPKID:   entry.VoterPKID.NewPKID(),
+		VotingPower: entry.VotingPower.Clone(),
+		OptionIndex: entry.OptionIndex,
+		isDeleted:   entry.isDeleted,
+	}
+}
+
+func (entry *VoteEntry) ToMapKey() VoteMapKey {
+	return VoteMapKey{
+		ProposalID: *entry.ProposalID,
+		VoterPKID:  *entry.VoterPKID,
+	}
+}
+
+// HasVoted returns true if the voter has cast their vote.
+func (entry *VoteEntry) HasVoted() bool {
+	return entry.OptionIndex != ProposalVoteOptionNone
+}
+
+func (entry *VoteEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.ProposalID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.VoterPKID, skipMetadata...)...)
+	data = append(data, VariableEncodeUint256(entry.VotingPower)...)
+	data = append(data, UintToBuf(entry.OptionIndex)...)
+	return data
+}
+
+func (entry *VoteEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// ProposalID
+	entry.ProposalID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "VoteEntry.Decode: Problem reading ProposalID: ")
+	}
+
+	// VoterPKID
+	entry.VoterPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "VoteEntry.Decode: Problem reading VoterPKID: ")
+	}
+
+	// VotingPower
+	entry.VotingPower, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "VoteEntry.Decode: Problem reading VotingPower: ")
+	}
+
+	// OptionIndex
+	entry.OptionIndex, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "VoteEntry.Decode: Problem reading OptionIndex: ")
+	}
+
+	return nil
+}
+
+func (entry *VoteEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *VoteEntry) GetEncoderType() EncoderType {
+	return EncoderTypeVoteEntry
+}
+
+//
+// TYPES: CreateProposalMetadata
+//
+
+type CreateProposalMetadata struct {
+	// ProfilePublicKey is the public key of the DAO coin whose holders vote on the proposal.
+	ProfilePublicKey     *PublicKey
+	Description          []byte
+	Options              [][]byte
+	VotingEndBlockHeight uint64
+}
+
+func (txnData *CreateProposalMetadata) GetTxnType() TxnType {
+	return TxnTypeCreateProposal
+}
+
+func (txnData *CreateProposalMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	if txnData.ProfilePublicKey == nil {
+		return nil, fmt.Errorf("CreateProposalMetadata.ToBytes: ProfilePublicKey is missing")
+	}
+	var data []byte
+	data = append(data, EncodeByteArray(txnData.ProfilePublicKey.ToBytes())...)
+	data = append(data, EncodeByteArray(txnData.Description)...)
+	data = append(data, UintToBuf(uint64(len(txnData.Options)))...)
+	for _, option := range txnData.Options {
+		data = append(data, EncodeByteArray(option)...)
+	}
+	data = append(data, UintToBuf(txnData.VotingEndBlockHeight)...)
+	return data, nil
+}
+
+func (txnData *CreateProposalMetadata) FromBytes(data []byte) error {
+	ret := CreateProposalMetadata{}
+	rr := bytes.NewReader(data)
+
+	// ProfilePublicKey
+	profilePublicKeyBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "CreateProposalMetadata.FromBytes: Problem reading ProfilePublicKey: ")
+	}
+	ret.ProfilePublicKey = NewPublicKey(profilePublicKeyBytes)
+
+	// Description
+	ret.Description, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "CreateProposalMetadata.FromBytes: Problem reading Description: ")
+	}
+
+	// Options
+	ret.Options, err = _decodeProposalOptions(rr)
+	if err != nil {
+		return errors.Wrapf(err, "CreateProposalMetadata.FromBytes: ")
+	}
+
+	// VotingEndBlockHeight
+	ret.VotingEndBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "CreateProposalMetadata.FromBytes: Problem reading VotingEndBlockHeight: ")
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *CreateProposalMetadata) New() DeSoTxnMetadata {
+	return &CreateProposalMetadata{}
+}
+
+// ValidateCreateProposalMetadata checks the proposal's fields against the limits above and
+// that voting ends after the block at blockHeight.
+func ValidateCreateProposalMetadata(txMeta *CreateProposalMetadata, blockHeight uint64) error {
+	if txMeta.ProfilePublicKey == nil || len(txMeta.ProfilePublicKey.ToBytes()) != btcec.PubKeyBytesLenCompressed {
+		return RuleErrorGovernanceInvalidProfilePublicKey
+	}
+	if len(txMeta.Description) > MaxProposalDescriptionLengthBytes {
+		return errors.Wrapf(RuleErrorGovernanceDescriptionTooLong, "%d bytes exceeds the max of %d",
+			len(txMeta.Description), MaxProposalDescriptionLengthBytes)
+	}
+	if len(txMeta.Options) < MinProposalOptions || len(txMeta.Options) > MaxProposalOptions {
+		return errors.Wrapf(RuleErrorGovernanceInvalidNumOptions, "%d options isn't between %d and %d",
+			len(txMeta.Options), MinProposalOptions, MaxProposalOptions)
+	}
+	for ii, option := range txMeta.Options {
+		if len(option) == 0 || len(option) > MaxProposalOptionLengthBytes {
+			return errors.Wrapf(RuleErrorGovernanceInvalidOption, "option %d has length %d", ii, len(option))
+		}
+	}
+	if txMeta.VotingEndBlockHeight <= blockHeight {
+		return errors.Wrapf(RuleErrorGovernanceInvalidVotingEndBlockHeight,
+			"voting end %d isn't after the current height %d", txMeta.VotingEndBlockHeight, blockHeight)
+	}
+	return nil
+}
+
+//
+// TYPES: CastVoteMetadata
+//
+
+type CastVoteMetadata struct {
+	ProposalID  *BlockHash
+	OptionIndex uint64
+}
+
+func (txnData *CastVoteMetadata) GetTxnType() TxnType {
+	return TxnTypeCastVote
+}
+
+func (txnData *CastVoteMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	if txnData.ProposalID == nil {
+		return nil, fmt.Errorf("CastVoteMetadata.ToBytes: ProposalID is missing")
+	}
+	var data []byte
+	data = append(data, txnData.ProposalID[:]...)
+	data = append(data, UintToBuf(txnData.OptionIndex)...)
+	return data, nil
+}
+
+func (txnData *CastVoteMetadata) FromBytes(data []byte) error {
+	ret := CastVoteMetadata{}
+	rr := bytes.NewReader(data)
+
+	// ProposalID
+	ret.ProposalID = &BlockHash{}
+	if _, err := io.ReadFull(rr, ret.ProposalID[:]); err != nil {
+		return errors.Wrapf(err, "CastVoteMetadata.FromBytes: Problem reading ProposalID: ")
+	}
+
+	// OptionIndex
+	optionIndex, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "CastVoteMetadata.FromBytes: Problem reading OptionIndex: ")
+	}
+	ret.OptionIndex = optionIndex
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *CastVoteMetadata) New() DeSoTxnMetadata {
+	return &CastVoteMetadata{}
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForProposalEntry(proposalID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixProposalByProposalID...)
+	key = append(key, proposalID[:]...)
+	return key
+}
+
+func DBKeyForProposalByProfile(profilePKID *PKID, proposalID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixProposalIDByProfilePKID...)
+	key = append(key, profilePKID.ToBytes()...)
+	key = append(key, proposalID[:]...)
+	return key
+}
+
+func DBKeyForVoteEntry(proposalID *BlockHash, voterPKID *PKID) []byte {
+	key := DBPrefixForVoteEntriesForProposal(proposalID)
+	key = append(key, voterPKID.ToBytes()...)
+	return key
+}
+
+func DBPrefixForVoteEntriesForProposal(proposalID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixVoteByProposalIDVoterPKID...)
+	key = append(key, proposalID[:]...)
+	return key
+}
+
+func DBGetProposalEntry(handle *badger.DB, snap *Snapshot, proposalID *BlockHash) (*ProposalEntry, error) {
+	var ret *ProposalEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetProposalEntryWithTxn(txn, snap, proposalID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetProposalEntryWithTxn(txn *badger.Txn, snap *Snapshot, proposalID *BlockHash) (*ProposalEntry, error) {
+	// Retrieve ProposalEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForProposalEntry(proposalID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetProposalEntry: problem retrieving ProposalEntry: ")
+	}
+
+	// Decode ProposalEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&ProposalEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetProposalEntry: problem decoding ProposalEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetProposalEntriesForProfile returns the proposals for the DAO coin.
+func DBGetProposalEntriesForProfile(handle *badger.DB, snap *Snapshot, profilePKID *PKID) ([]*ProposalEntry, error) {
+	prefix := append([]byte{}, Prefixes.PrefixProposalIDByProfilePKID...)
+	prefix = append(prefix, profilePKID.ToBytes()...)
+	keysFound, _ := EnumerateKeysForPrefix(handle, prefix, true)
+
+	var entries []*ProposalEntry
+	for _, key := range keysFound {
+		if len(key) != len(prefix)+HashSizeBytes {
+			return nil, fmt.Errorf("DBGetProposalEntriesForProfile: invalid index key length %d", len(key))
+		}
+		proposalID := NewBlockHash(key[len(prefix):])
+		entry, err := DBGetProposalEntry(handle, snap, proposalID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetProposalEntriesForProfile: ")
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("DBGetProposalEntriesForProfile: proposal %v is indexed but doesn't exist",
+				proposalID)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutProposalEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ProposalEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForProposalEntry(entry.ProposalID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutProposalEntryWithTxn: problem storing ProposalEntry: ")
+	}
+	indexKey := DBKeyForProposalByProfile(entry.ProfilePKID, entry.ProposalID)
+	if err := DBSetWithTxn(txn, snap, indexKey, []byte{}, eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutProposalEntryWithTxn: problem storing proposal index: ")
+	}
+	return nil
+}
+
+func DBDeleteProposalEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ProposalEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForProposalEntry(entry.ProposalID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteProposalEntryWithTxn: problem deleting ProposalEntry: ")
+	}
+	indexKey := DBKeyForProposalByProfile(entry.ProfilePKID, entry.ProposalID)
+	if err := DBDeleteWithTxn(txn, snap, indexKey, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteProposalEntryWithTxn: problem deleting proposal index: ")
+	}
+	return nil
+}
+
+func DBGetVoteEntry(handle *badger.DB, snap *Snapshot, proposalID *BlockHash, voterPKID *PKID) (*VoteEntry, error) {
+	var ret *VoteEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetVoteEntryWithTxn(txn, snap, proposalID, voterPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetVoteEntryWithTxn(txn *badger.Txn, snap *Snapshot, proposalID *BlockHash, voterPKID *PKID) (*VoteEntry, error) {
+	// Retrieve VoteEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForVoteEntry(proposalID, voterPKID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetVoteEntry: problem retrieving VoteEntry: ")
+	}
+
+	// Decode VoteEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&VoteEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetVoteEntry: problem decoding VoteEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetVoteEntriesForProposal returns the vote of every holder in the proposal's snapshot.
+func DBGetVoteEntriesForProposal(handle *badger.DB, proposalID *BlockHash) ([]*VoteEntry, error) {
+	_, valsFound := EnumerateKeysForPrefix(handle, DBPrefixForVoteEntriesForProposal(proposalID), false)
+
+	entries := make([]*VoteEntry, 0, len(valsFound))
+	for _, entryBytes := range valsFound {
+		entry, err := DecodeDeSoEncoder(&VoteEntry{}, bytes.NewReader(entryBytes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetVoteEntriesForProposal: problem decoding VoteEntry: ")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutVoteEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *VoteEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForVoteEntry(entry.ProposalID, entry.VoterPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutVoteEntryWithTxn: problem storing VoteEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteVoteEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *VoteEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForVoteEntry(entry.ProposalID, entry.VoterPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteVoteEntryWithTxn: problem deleting VoteEntry: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetProposalEntry returns the proposal, or nil if it doesn't exist.
+func (bav *UtxoView) GetProposalEntry(proposalID *BlockHash) (*ProposalEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.ProposalIDToProposalEntry[*proposalID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetProposalEntry(proposalID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetProposalEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the ProposalEntry from the db in the UtxoView.
+		bav._setProposalEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetProposalEntriesForProfile returns the proposals for the DAO coin, including the
+// proposals in the view. They're sorted by SnapshotBlockHeight.
+func (bav *UtxoView) GetProposalEntriesForProfile(profilePKID *PKID) ([]*ProposalEntry, error) {
+	dbEntries, err := bav.GetDbAdapter().GetProposalEntriesForProfile(profilePKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetProposalEntriesForProfile: ")
+	}
+	for _, dbEntry := range dbEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		if _, exists := bav.ProposalIDToProposalEntry[*dbEntry.ProposalID]; !exists {
+			bav._setProposalEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*ProposalEntry
+	for _, entry := range bav.ProposalIDToProposalEntry {
+		if !entry.isDeleted && entry.ProfilePKID.Eq(profilePKID) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		if entries[ii].SnapshotBlockHeight != entries[jj].SnapshotBlockHeight {
+			return entries[ii].SnapshotBlockHeight < entries[jj].SnapshotBlockHeight
+		}
+		return bytes.Compare(entries[ii].ProposalID[:], entries[jj].ProposalID[:]) < 0
+	})
+	return entries, nil
+}
+
+// GetVoteEntry returns the voter's vote on the proposal, or nil if the voter wasn't a holder
+// when the proposal was created.
+func (bav *UtxoView) GetVoteEntry(proposalID *BlockHash, voterPKID *PKID) (*VoteEntry, error) {
+	// First check the UtxoView.
+	mapKey := VoteMapKey{ProposalID: *proposalID, VoterPKID: *voterPKID}
+	if entry, exists := bav.VoteMapKeyToVoteEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetVoteEntry(proposalID, voterPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetVoteEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the VoteEntry from the db in the UtxoView.
+		bav._setVoteEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetVoteEntriesForProposal returns the vote of every holder in the proposal's snapshot,
+// including the votes in the view. They're sorted by VoterPKID.
+func (bav *UtxoView) GetVoteEntriesForProposal(proposalID *BlockHash) ([]*VoteEntry, error) {
+	dbEntries, err := bav.GetDbAdapter().GetVoteEntriesForProposal(proposalID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetVoteEntriesForProposal: ")
+	}
+	for _, dbEntry := range dbEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		if _, exists := bav.VoteMapKeyToVoteEntry[dbEntry.ToMapKey()]; !exists {
+			bav._setVoteEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*VoteEntry
+	for _, entry := range bav.VoteMapKeyToVoteEntry {
+		if !entry.isDeleted && entry.ProposalID.IsEqual(proposalID) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		return bytes.Compare(entries[ii].VoterPKID[:], entries[jj].VoterPKID[:]) < 0
+	})
+	return entries, nil
+}
+
+func (bav *UtxoView) _setProposalEntryMappings(entry *ProposalEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setProposalEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ProposalIDToProposalEntry[*entry.ProposalID] = entry
+}
+
+func (bav *UtxoView) _deleteProposalEntryMappings(entry *ProposalEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteProposalEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setProposalEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _setVoteEntryMappings(entry *VoteEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setVoteEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.VoteMapKeyToVoteEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteVoteEntryMappings(entry *VoteEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteVoteEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setVoteEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushGovernanceEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Delete every proposal in the view first, since a proposal's index has to be removed
+	// along with it. The proposals that aren't deleted are put back below.
+	for mapKeyIter, entryIter := range bav.ProposalIDToProposalEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.ProposalID.IsEqual(&mapKey) {
+			return fmt.Errorf("_flushGovernanceEntriesToDbWithTxn: ProposalEntry ProposalID %v doesn't "+
+				"match MapKey %v", entry.ProposalID, &mapKey)
+		}
+
+		if err := DBDeleteProposalEntryWithTxn(
+			txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+		); err != nil {
+			return errors.Wrapf(err, "_flushGovernanceEntriesToDbWithTxn: ")
+		}
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutProposalEntryWithTxn(
+			txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushGovernanceEntriesToDbWithTxn: ")
+		}
+	}
+
+	for mapKeyIter, entryIter := range bav.VoteMapKeyToVoteEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf("_flushGovernanceEntriesToDbWithTxn: VoteEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(), mapKey)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteVoteEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushGovernanceEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutVoteEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushGovernanceEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectCreateProposal(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.GovernanceBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceBeforeBlockHeight, "_connectCreateProposal: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeCreateProposal {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectCreateProposal: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*CreateProposalMetadata)
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCreateProposal: ")
+	}
+
+	if err = ValidateCreateProposalMetadata(txMeta, uint64(blockHeight)); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCreateProposal: ")
+	}
+	profileEntry := bav.GetProfileEntryForPublicKey(txMeta.ProfilePublicKey.ToBytes())
+	if profileEntry == nil || profileEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceOnNonexistentProfile, "_connectCreateProposal: ")
+	}
+	profilePKIDEntry := bav.GetPKIDForPublicKey(txMeta.ProfilePublicKey.ToBytes())
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if profilePKIDEntry == nil || profilePKIDEntry.isDeleted || transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectCreateProposal: PKID for profile or transactor not found")
+	}
+	profilePKID := profilePKIDEntry.PKID
+	transactorPKID := transactorPKIDEntry.PKID
+
+	// Only the coin's creator and its holders can put proposals to its holders.
+	if !transactorPKID.Eq(profilePKID) {
+		balanceEntry := bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(transactorPKID, profilePKID, true)
+		if balanceEntry == nil || balanceEntry.isDeleted || balanceEntry.BalanceNanos.IsZero() {
+			return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceProposerIsNotHolder, "_connectCreateProposal: ")
+		}
+	}
+	if profileEntry.DAOCoinEntry.NumberOfHolders > MaxProposalSnapshotHolders {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceTooManyHolders,
+			"_connectCreateProposal: %d holders exceeds the max of %d",
+			profileEntry.DAOCoinEntry.NumberOfHolders, MaxProposalSnapshotHolders)
+	}
+
+	// Snapshot the holders' balances.
+	holders, _, err := bav.GetHolders(profilePKID, false, true)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCreateProposal: ")
+	}
+	totalVotingPower := uint256.NewInt()
+	var voteEntries []*VoteEntry
+	for _, balanceEntry := range holders {
+		if balanceEntry.isDeleted || balanceEntry.BalanceNanos.IsZero() {
+			continue
+		}
+		voteEntries = append(voteEntries, &VoteEntry{
+			ProposalID:  txHash.NewBlockHash(),
+			VoterPKID:   balanceEntry.HODLerPKID.NewPKID(),
+			VotingPower: balanceEntry.BalanceNanos.Clone(),
+			OptionIndex: ProposalVoteOptionNone,
+		})
+		totalVotingPower = uint256.NewInt().Add(totalVotingPower, &balanceEntry.BalanceNanos)
+	}
+	if len(voteEntries) == 0 {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceNoHolders, "_connectCreateProposal: ")
+	}
+	if len(voteEntries) > MaxProposalSnapshotHolders {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceTooManyHolders,
+			"_connectCreateProposal: %d holders exceeds the max of %d", len(voteEntries), MaxProposalSnapshotHolders)
+	}
+
+	optionVotingPowers := make([]*uint256.Int, 0, len(txMeta.Options))
+	options := make([][]byte, 0, len(txMeta.Options))
+	for _, option := range txMeta.Options {
+		optionVotingPowers = append(optionVotingPowers, uint256.NewInt())
+		options = append(options, append([]byte{}, option...))
+	}
+	bav._setProposalEntryMappings(&ProposalEntry{
+		ProposalID:           txHash.NewBlockHash(),
+		ProposerPKID:         transactorPKID.NewPKID(),
+		ProfilePKID:          profilePKID.NewPKID(),
+		Description:          append([]byte{}, txMeta.Description...),
+		Options:              options,
+		SnapshotBlockHeight:  uint64(blockHeight),
+		VotingEndBlockHeight: txMeta.VotingEndBlockHeight,
+		OptionVotingPowers:   optionVotingPowers,
+		TotalVotingPower:     totalVotingPower,
+	})
+	for _, voteEntry := range voteEntries {
+		bav._setVoteEntryMappings(voteEntry)
+	}
+
+	// Add a UTXO operation.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type: OperationTypeCreateProposal,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectCreateProposal(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.GovernanceBlockHeight {
+		return errors.Wrapf(RuleErrorGovernanceBeforeBlockHeight, "_disconnectCreateProposal: ")
+	}
+
+	// Validate the last operation is a CreateProposal operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectCreateProposal: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeCreateProposal {
+		return fmt.Errorf(
+			"_disconnectCreateProposal: trying to revert %v but found %v",
+			OperationTypeCreateProposal,
+			utxoOpsForTxn[operationIndex].Type,
+		)
+	}
+
+	// Delete the proposal and its snapshot. Votes can't have been cast on it yet, since
+	// they'd have been disconnected first.
+	proposalEntry, err := bav.GetProposalEntry(txHash)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCreateProposal: ")
+	}
+	if proposalEntry == nil {
+		return fmt.Errorf("_disconnectCreateProposal: created proposal %v not found", txHash)
+	}
+	voteEntries, err := bav.GetVoteEntriesForProposal(txHash)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCreateProposal: ")
+	}
+	for _, voteEntry := range voteEntries {
+		bav._deleteVoteEntryMappings(voteEntry)
+	}
+	bav._deleteProposalEntryMappings(proposalEntry)
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+func (bav *UtxoView) _connectCastVote(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.GovernanceBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceBeforeBlockHeight, "_connectCastVote: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeCastVote {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectCastVote: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*CastVoteMetadata)
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCastVote: ")
+	}
+
+	proposalEntry, err := bav.GetProposalEntry(txMeta.ProposalID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCastVote: ")
+	}
+	if proposalEntry == nil {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceProposalNotFound, "_connectCastVote: %v", txMeta.ProposalID)
+	}
+	if uint64(blockHeight) >= proposalEntry.VotingEndBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceVotingClosed,
+			"_connectCastVote: voting ended at height %d", proposalEntry.VotingEndBlockHeight)
+	}
+	if txMeta.OptionIndex >= uint64(len(proposalEntry.Options)) {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceInvalidOptionIndex,
+			"_connectCastVote: option %d of %d", txMeta.OptionIndex, len(proposalEntry.Options))
+	}
+
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectCastVote: PKID for transactor %v not found",
+			PkToStringBoth(txn.PublicKey))
+	}
+	voteEntry, err := bav.GetVoteEntry(txMeta.ProposalID, transactorPKIDEntry.PKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCastVote: ")
+	}
+	if voteEntry == nil || voteEntry.VotingPower.IsZero() {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceNoVotingPower, "_connectCastVote: ")
+	}
+	if voteEntry.OptionIndex == txMeta.OptionIndex {
+		return 0, 0, nil, errors.Wrapf(RuleErrorGovernanceVoteUnchanged, "_connectCastVote: ")
+	}
+
+	// Move the voter's voting power to the new option.
+	prevProposalEntry := proposalEntry.Copy()
+	prevVoteEntry := voteEntry.Copy()
+	newProposalEntry := proposalEntry.Copy()
+	if voteEntry.HasVoted() {
+		prevOptionVotingPower := newProposalEntry.OptionVotingPowers[voteEntry.OptionIndex]
+		if prevOptionVotingPower.Lt(voteEntry.VotingPower) {
+			return 0, 0, nil, fmt.Errorf("_connectCastVote: voting power %v exceeds option %d's tally %v",
+				voteEntry.VotingPower, voteEntry.OptionIndex, prevOptionVotingPower)
+		}
+		newProposalEntry.OptionVotingPowers[voteEntry.OptionIndex] =
+			uint256.NewInt().Sub(prevOptionVotingPower, voteEntry.VotingPower)
+	}
+	newProposalEntry.OptionVotingPowers[txMeta.OptionIndex] =
+		uint256.NewInt().Add(newProposalEntry.OptionVotingPowers[txMeta.OptionIndex], voteEntry.VotingPower)
+	newVoteEntry := voteEntry.Copy()
+	newVoteEntry.OptionIndex = txMeta.OptionIndex
+	bav._setProposalEntryMappings(newProposalEntry)
+	bav._setVoteEntryMappings(newVoteEntry)
+
+	// Add a UTXO operation.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:              OperationTypeCastVote,
+		PrevProposalEntry: prevProposalEntry,
+		PrevVoteEntry:     prevVoteEntry,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectCastVote(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.GovernanceBlockHeight {
+		return errors.Wrapf(RuleErrorGovernanceBeforeBlockHeight, "_disconnectCastVote: ")
+	}
+
+	// Validate the last operation is a CastVote operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectCastVote: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeCastVote {
+		return fmt.Errorf(
+			"_disconnectCastVote: trying to revert %v but found %v",
+			OperationTypeCastVote,
+			operationData.Type,
+		)
+	}
+
+	// Restore the proposal and the vote.
+	if operationData.PrevProposalEntry == nil || operationData.PrevVoteEntry == nil {
+		return fmt.Errorf("_disconnectCastVote: missing the previous proposal or vote entry")
+	}
+	bav._setProposalEntryMappings(operationData.PrevProposalEntry)
+	bav._setVoteEntryMappings(operationData.PrevVoteEntry)
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+//
+// Derived Key Transactional Limits
+//
+
+type GovernanceLimitOperation uint8
+type GovernanceLimitOperationString string
+
+const (
+	AnyGovernanceOperation            GovernanceLimitOperation = 0
+	CreateProposalGovernanceOperation GovernanceLimitOperation = 1
+	CastVoteGovernanceOperation       GovernanceLimitOperation = 2
+	UndefinedGovernanceOperation      GovernanceLimitOperation = 3
+)
+
+const (
+	AnyGovernanceOperationString            GovernanceLimitOperationString = "any"
+	CreateProposalGovernanceOperationString GovernanceLimitOperationString = "create_proposal"
+	CastVoteGovernanceOperationString       GovernanceLimitOperationString = "cast_vote"
+	UndefinedGovernanceOperationString      GovernanceLimitOperationString = "undefined"
+)
+
+func (governanceLimitOperation GovernanceLimitOperation) ToString() string {
+	return string(governanceLimitOperation.ToOperationString())
+}
+
+func (governanceLimitOperation GovernanceLimitOperation) ToOperationString() GovernanceLimitOperationString {
+	switch governanceLimitOperation {
+	case AnyGovernanceOperation:
+		return AnyGovernanceOperationString
+	case CreateProposalGovernanceOperation:
+		return CreateProposalGovernanceOperationString
+	case CastVoteGovernanceOperation:
+		return CastVoteGovernanceOperationString
+	default:
+		return UndefinedGovernanceOperationString
+	}
+}
+
+func (governanceLimitOperationString GovernanceLimitOperationString) ToOperationType() GovernanceLimitOperation {
+	switch governanceLimitOperationString {
+	case AnyGovernanceOperationString:
+		return AnyGovernanceOperation
+	case CreateProposalGovernanceOperationString:
+		return CreateProposalGovernanceOperation
+	case CastVoteGovernanceOperationString:
+		return CastVoteGovernanceOperation
+	default:
+		return UndefinedGovernanceOperation
+	}
+}
+
+// GovernanceLimitKey limits the number of governance txns a derived key can perform for a
+// DAO coin. The ZeroPKID applies to any DAO coin.
+type GovernanceLimitKey struct {
+	ProfilePKID PKID
+	Operation   GovernanceLimitOperation
+}
+
+func MakeGovernanceLimitKey(profilePKID PKID, operation GovernanceLimitOperation) GovernanceLimitKey {
+	return GovernanceLimitKey{
+		ProfilePKID: profilePKID,
+		Operation:   operation,
+	}
+}
+
+func (governanceLimitKey *GovernanceLimitKey) Encode() []byte {
+	var data []byte
+	data = append(data, governanceLimitKey.ProfilePKID.ToBytes()...)
+	data = append(data, byte(governanceLimitKey.Operation))
+	return data
+}
+
+func (governanceLimitKey *GovernanceLimitKey) Decode(rr *bytes.Reader) error {
+	// ProfilePKID
+	profilePKID := &PKID{}
+	if err := profilePKID.FromBytes(rr); err != nil {
+		return errors.Wrap(err, "GovernanceLimitKey.Decode: Problem reading ProfilePKID: ")
+	}
+	governanceLimitKey.ProfilePKID = *profilePKID
+
+	// Operation
+	operationByte, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrap(err, "GovernanceLimitKey.Decode: Problem reading Operation: ")
+	}
+	governanceLimitKey.Operation = GovernanceLimitOperation(operationByte)
+
+	return nil
+}
+
+// _checkGovernanceLimitAndUpdateDerivedKeyEntry checks that the derived key can perform the
+// governance operation for the profile's DAO coin, and decrements the first matching limit.
+func (bav *UtxoView) _checkGovernanceLimitAndUpdateDerivedKeyEntry(
+	derivedKeyEntry DerivedKeyEntry,
+	profilePublicKey []byte,
+	operation GovernanceLimitOperation,
+) (DerivedKeyEntry, error) {
+	profilePKIDEntry := bav.GetPKIDForPublicKey(profilePublicKey)
+	if profilePKIDEntry == nil || profilePKIDEntry.isDeleted {
+		return derivedKeyEntry, fmt.Errorf("_checkGovernanceLimitAndUpdateDerivedKeyEntry: profile pkid is deleted")
+	}
+
+	// Check the (profile PKID || operation), (profile PKID || any operation),
+	// (any profile PKID || operation), and (any profile PKID || any operation) keys in order.
+	for _, limitKey := range []GovernanceLimitKey{
+		MakeGovernanceLimitKey(*profilePKIDEntry.PKID, operation),
+		MakeGovernanceLimitKey(*profilePKIDEntry.PKID, AnyGovernanceOperation),
+		MakeGovernanceLimitKey(ZeroPKID, operation),
+		MakeGovernanceLimitKey(ZeroPKID, AnyGovernanceOperation),
+	} {
+		if _checkGovernanceLimitKeyAndUpdateDerivedKeyEntry(limitKey, derivedKeyEntry) {
+			return derivedKeyEntry, nil
+		}
+	}
+	return derivedKeyEntry, errors.Wrapf(RuleErrorDerivedKeyGovernanceOperationNotAuthorized,
+		"_checkGovernanceLimitAndUpdateDerivedKeyEntry: governance operation %s not authorized: ",
+		operation.ToString())
+}
+
+func _checkGovernanceLimitKeyAndUpdateDerivedKeyEntry(key GovernanceLimitKey, derivedKeyEntry DerivedKeyEntry) bool {
+	if derivedKeyEntry.TransactionSpendingLimitTracker == nil ||
+		derivedKeyEntry.TransactionSpendingLimitTracker.GovernanceLimitMap == nil {
+		return false
+	}
+	// If the key is present in the GovernanceLimitMap...
+	governanceOperationLimit, governanceOperationLimitExists :=
+		derivedKeyEntry.TransactionSpendingLimitTracker.GovernanceLimitMap[key]
+	if !governanceOperationLimitExists || governanceOperationLimit <= 0 {
+		return false
+	}
+	// If this is the last operation allowed for this key, we delete the key from the map.
+	if governanceOperationLimit == 1 {
+		delete(derivedKeyEntry.TransactionSpendingLimitTracker.GovernanceLimitMap, key)
+	} else {
+		// Otherwise we decrement the number of operations remaining for this key
+		derivedKeyEntry.TransactionSpendingLimitTracker.GovernanceLimitMap[key]--
+	}
+	// Return true because we found the key and decremented the remaining operations
+	return true
+}
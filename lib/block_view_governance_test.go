@@ -0,0 +1,427 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func _createProposalWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *CreateProposalMetadata,
+) {
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check))
+
+	currentOps, currentTxn, _, err := _createProposal(testMeta.t, testMeta.chain, testMeta.db, testMeta.params,
+		feeRateNanosPerKB, transactorPublicKeyBase58Check, transactorPrivateKeyBase58Check, metadata)
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+func _createProposal(t *testing.T, chain *Blockchain, db *badger.DB,
+	params *DeSoParams, feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *CreateProposalMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _height uint32, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	txn, totalInputMake, changeAmountMake, feesMake, err := chain.CreateCreateProposalTxn(
+		transactorPkBytes, metadata, nil, feeRateNanosPerKB, nil, []*DeSoOutput{})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	require.Equal(totalInputMake, changeAmountMake+feesMake)
+
+	return _connectGovernanceTxnAndFlush(
+		t, chain, db, params, txn, transactorPrivateKeyBase58Check, totalInputMake, OperationTypeCreateProposal)
+}
+
+func _castVoteWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *CastVoteMetadata,
+) {
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check))
+
+	currentOps, currentTxn, _, err := _castVote(testMeta.t, testMeta.chain, testMeta.db, testMeta.params,
+		feeRateNanosPerKB, transactorPublicKeyBase58Check, transactorPrivateKeyBase58Check, metadata)
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+func _castVote(t *testing.T, chain *Blockchain, db *badger.DB,
+	params *DeSoParams, feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *CastVoteMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _height uint32, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	txn, totalInputMake, changeAmountMake, feesMake, err := chain.CreateCastVoteTxn(
+		transactorPkBytes, metadata, nil, feeRateNanosPerKB, nil, []*DeSoOutput{})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	require.Equal(totalInputMake, changeAmountMake+feesMake)
+
+	return _connectGovernanceTxnAndFlush(
+		t, chain, db, params, txn, transactorPrivateKeyBase58Check, totalInputMake, OperationTypeCastVote)
+}
+
+// _connectGovernanceTxnAndFlush signs the txn, connects it at the next block height, and
+// flushes it to the db.
+func _connectGovernanceTxnAndFlush(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoParams,
+	txn *MsgDeSoTxn, transactorPrivateKeyBase58Check string, totalInputMake uint64, operationType OperationType,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _height uint32, _err error) {
+	require := require.New(t)
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(t, txn, transactorPrivateKeyBase58Check)
+
+	txHash := txn.Hash()
+	// Always use height+1 for validation since it's assumed the transaction will
+	// get mined into the next block.
+	blockHeight := chain.blockTip().Height + 1
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	utxoOps, totalInput, totalOutput, fees, err :=
+		utxoView.ConnectTransaction(txn, txHash, blockHeight, 0, true, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	require.Equal(totalInput, totalOutput+fees)
+	require.Equal(totalInput, totalInputMake)
+	require.Equal(OperationTypeSpendBalance, utxoOps[0].Type)
+	require.Equal(operationType, utxoOps[len(utxoOps)-1].Type)
+
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+
+	return utxoOps, txn, blockHeight, nil
+}
+
+func TestValidateCreateProposalMetadata(t *testing.T) {
+	require := require.New(t)
+
+	newMetadata := func() *CreateProposalMetadata {
+		return &CreateProposalMetadata{
+			ProfilePublicKey:     NewPublicKey(m0PkBytes),
+			Description:          []byte("Fund the grants program?"),
+			Options:              [][]byte{[]byte("Yes"), []byte("No")},
+			VotingEndBlockHeight: 200,
+		}
+	}
+	require.NoError(ValidateCreateProposalMetadata(newMetadata(), 100))
+
+	for expectedErr, mutate := range map[RuleError]func(*CreateProposalMetadata){
+		RuleErrorGovernanceInvalidProfilePublicKey: func(metadata *CreateProposalMetadata) {
+			metadata.ProfilePublicKey = NewPublicKey([]byte{2})
+		},
+		RuleErrorGovernanceDescriptionTooLong: func(metadata *CreateProposalMetadata) {
+			metadata.Description = bytes.Repeat([]byte{'a'}, MaxProposalDescriptionLengthBytes+1)
+		},
+		RuleErrorGovernanceInvalidNumOptions: func(metadata *CreateProposalMetadata) {
+			metadata.Options = metadata.Options[:1]
+		},
+		RuleErrorGovernanceInvalidOption: func(metadata *CreateProposalMetadata) {
+			metadata.Options[1] = []byte{}
+		},
+		RuleErrorGovernanceInvalidVotingEndBlockHeight: func(metadata *CreateProposalMetadata) {
+			metadata.VotingEndBlockHeight = 100
+		},
+	} {
+		metadata := newMetadata()
+		mutate(metadata)
+		err := ValidateCreateProposalMetadata(metadata, 100)
+		require.Error(err, expectedErr)
+		require.Contains(err.Error(), string(expectedErr))
+	}
+}
+
+func TestGovernanceEncoding(t *testing.T) {
+	require := require.New(t)
+
+	createMetadata := &CreateProposalMetadata{
+		ProfilePublicKey:     NewPublicKey(m0PkBytes),
+		Description:          []byte("Which chain should we bridge to next?"),
+		Options:              [][]byte{[]byte("A"), []byte("B"), []byte("C")},
+		VotingEndBlockHeight: 1000,
+	}
+	metadataBytes, err := createMetadata.ToBytes(false)
+	require.NoError(err)
+	decodedCreateMetadata := &CreateProposalMetadata{}
+	require.NoError(decodedCreateMetadata.FromBytes(metadataBytes))
+	require.Equal(createMetadata, decodedCreateMetadata)
+
+	proposalID := NewBlockHash(RandomBytes(HashSizeBytes))
+	castVoteMetadata := &CastVoteMetadata{ProposalID: proposalID, OptionIndex: 2}
+	metadataBytes, err = castVoteMetadata.ToBytes(false)
+	require.NoError(err)
+	decodedCastVoteMetadata := &CastVoteMetadata{}
+	require.NoError(decodedCastVoteMetadata.FromBytes(metadataBytes))
+	require.Equal(castVoteMetadata, decodedCastVoteMetadata)
+
+	proposalEntry := &ProposalEntry{
+		ProposalID:           proposalID,
+		ProposerPKID:         NewPKID(m1PkBytes),
+		ProfilePKID:          NewPKID(m0PkBytes),
+		Description:          createMetadata.Description,
+		Options:              createMetadata.Options,
+		SnapshotBlockHeight:  500,
+		VotingEndBlockHeight: 1000,
+		OptionVotingPowers:   []*uint256.Int{uint256.NewInt(), uint256.NewInt().SetUint64(7), uint256.NewInt()},
+		TotalVotingPower:     uint256.NewInt().SetUint64(10),
+	}
+	decodedProposalEntry, err := DecodeDeSoEncoder(&ProposalEntry{}, bytes.NewReader(EncodeToBytes(0, proposalEntry)))
+	require.NoError(err)
+	require.Equal(proposalEntry, decodedProposalEntry)
+	require.Equal(proposalEntry, proposalEntry.Copy())
+
+	for _, optionIndex := range []uint64{ProposalVoteOptionNone, 1} {
+		voteEntry := &VoteEntry{
+			ProposalID:  proposalID,
+			VoterPKID:   NewPKID(m1PkBytes),
+			VotingPower: uint256.NewInt().SetUint64(7),
+			OptionIndex: optionIndex,
+		}
+		decodedVoteEntry, err := DecodeDeSoEncoder(&VoteEntry{}, bytes.NewReader(EncodeToBytes(0, voteEntry)))
+		require.NoError(err)
+		require.Equal(voteEntry, decodedVoteEntry)
+		require.Equal(optionIndex != ProposalVoteOptionNone, decodedVoteEntry.HasVoted())
+	}
+}
+
+func TestGovernanceConnectAndDisconnect(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(101)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	// The governance migration can't come before the balance model migration, since an encoder's
+	// version byte is decoded as the height of the newest migration it was encoded with.
+	params.ForkHeights.GovernanceBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// The holders are set up with their own testMeta, which isn't rolled back, so that blocks
+	// can be mined to close a proposal before the proposals under test are created.
+	setupTestMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+	_registerOrTransferWithTestMeta(setupTestMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(setupTestMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(setupTestMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(setupTestMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e4)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+
+	// m0 mints 1000 of its DAO coin and gives 300 to m1 and 100 to m2.
+	_updateProfileWithTestMeta(
+		setupTestMeta,
+		feeRateNanosPerKB,
+		m0Pub,         /*updaterPkBase58Check*/
+		m0Priv,        /*updaterPrivBase58Check*/
+		[]byte{},      /*profilePubKey*/
+		"m0",          /*newUsername*/
+		"i am the m0", /*newDescription*/
+		shortPic,      /*newProfilePic*/
+		10*100,        /*newCreatorBasisPoints*/
+		1.25*100*100,  /*newStakeMultipleBasisPoints*/
+		false /*isHidden*/)
+	_daoCoinTxnWithTestMeta(setupTestMeta, feeRateNanosPerKB, m0Pub, m0Priv, DAOCoinMetadata{
+		ProfilePublicKey: m0PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt().SetUint64(1000),
+	})
+	transferDAOCoin := func(testMeta *TestMeta, receiverPkBytes []byte, amount uint64) {
+		_daoCoinTransferTxnWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, DAOCoinTransferMetadata{
+			ProfilePublicKey:       m0PkBytes,
+			DAOCoinToTransferNanos: *uint256.NewInt().SetUint64(amount),
+			ReceiverPublicKey:      receiverPkBytes,
+		})
+	}
+	transferDAOCoin(setupTestMeta, m1PkBytes, 300)
+	transferDAOCoin(setupTestMeta, m2PkBytes, 100)
+	newProposalMetadata := func(votingEndBlockHeight uint64) *CreateProposalMetadata {
+		return &CreateProposalMetadata{
+			ProfilePublicKey:     NewPublicKey(m0PkBytes),
+			Description:          []byte("Fund the grants program?"),
+			Options:              [][]byte{[]byte("Yes"), []byte("No")},
+			VotingEndBlockHeight: votingEndBlockHeight,
+		}
+	}
+
+	// Votes are rejected once a proposal's voting has closed at its VotingEndBlockHeight.
+	{
+		votingEndBlockHeight := uint64(chain.blockTip().Height) + 2
+		_, closedProposalTxn, _, err := _createProposal(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv,
+			newProposalMetadata(votingEndBlockHeight))
+		require.NoError(err)
+		for uint64(chain.blockTip().Height) <= votingEndBlockHeight {
+			_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+			require.NoError(err)
+			_, _, _, err = _castVote(t, chain, db, params, feeRateNanosPerKB, m2Pub, m2Priv,
+				&CastVoteMetadata{ProposalID: closedProposalTxn.Hash(), OptionIndex: 0})
+			require.Error(err)
+			require.Contains(err.Error(), RuleErrorGovernanceVotingClosed)
+		}
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	// Only the coin's creator and its holders can create proposals.
+	proposalMetadata := newProposalMetadata(uint64(chain.blockTip().Height) + 3)
+	_, _, _, err := _createProposal(t, chain, db, params, feeRateNanosPerKB, m3Pub, m3Priv, proposalMetadata)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorGovernanceProposerIsNotHolder)
+
+	// m1 puts a proposal to the holders, which snapshots their balances as voting power.
+	_createProposalWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv, proposalMetadata)
+	proposalID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	getProposalEntry := func() *ProposalEntry {
+		proposalEntry, err := DBGetProposalEntry(db, chain.snapshot, proposalID)
+		require.NoError(err)
+		return proposalEntry
+	}
+	requireTally := func(expectedTally ...uint64) {
+		proposalEntry := getProposalEntry()
+		require.NotNil(proposalEntry)
+		require.Len(proposalEntry.OptionVotingPowers, len(expectedTally))
+		for ii, expectedVotingPower := range expectedTally {
+			require.Equal(expectedVotingPower, proposalEntry.OptionVotingPowers[ii].Uint64())
+		}
+	}
+	requireVote := func(voterPKID *PKID, expectedVotingPower uint64, expectedOptionIndex uint64) {
+		voteEntry, err := DBGetVoteEntry(db, chain.snapshot, proposalID, voterPKID)
+		require.NoError(err)
+		require.NotNil(voteEntry)
+		require.Equal(expectedVotingPower, voteEntry.VotingPower.Uint64())
+		require.Equal(expectedOptionIndex, voteEntry.OptionIndex)
+	}
+	proposalEntry := getProposalEntry()
+	require.Equal(m1PKID, proposalEntry.ProposerPKID)
+	require.Equal(m0PKID, proposalEntry.ProfilePKID)
+	require.Equal(uint64(chain.blockTip().Height)+1, proposalEntry.SnapshotBlockHeight)
+	require.Equal(uint64(1000), proposalEntry.TotalVotingPower.Uint64())
+	requireTally(0, 0)
+	requireVote(m0PKID, 600, ProposalVoteOptionNone)
+	requireVote(m1PKID, 300, ProposalVoteOptionNone)
+	requireVote(m2PKID, 100, ProposalVoteOptionNone)
+
+	// Coins that move after the snapshot don't change anyone's voting power, so m3, who
+	// wasn't a holder at the snapshot, can't vote.
+	transferDAOCoin(testMeta, m2PkBytes, 200)
+	transferDAOCoin(testMeta, m3PkBytes, 50)
+	_, _, _, err = _castVote(t, chain, db, params, feeRateNanosPerKB, m3Pub, m3Priv,
+		&CastVoteMetadata{ProposalID: proposalID, OptionIndex: 0})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorGovernanceNoVotingPower)
+
+	// Each vote adds the voter's snapshot balance to the option they vote for.
+	_castVoteWithTestMeta(testMeta, feeRateNanosPerKB, m2Pub, m2Priv,
+		&CastVoteMetadata{ProposalID: proposalID, OptionIndex: 0})
+	requireTally(100, 0)
+	requireVote(m2PKID, 100, 0)
+	_castVoteWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv,
+		&CastVoteMetadata{ProposalID: proposalID, OptionIndex: 1})
+	requireTally(100, 300)
+	_castVoteWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv,
+		&CastVoteMetadata{ProposalID: proposalID, OptionIndex: 1})
+	requireTally(100, 900)
+
+	// Voting for the same option again is rejected, so it can't count twice.
+	_, _, _, err = _castVote(t, chain, db, params, feeRateNanosPerKB, m2Pub, m2Priv,
+		&CastVoteMetadata{ProposalID: proposalID, OptionIndex: 0})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorGovernanceVoteUnchanged)
+	requireTally(100, 900)
+
+	// Changing a vote moves the voter's voting power rather than adding it again.
+	proposalEntryBeforeChange := getProposalEntry()
+	_castVoteWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv,
+		&CastVoteMetadata{ProposalID: proposalID, OptionIndex: 0})
+	requireTally(400, 600)
+	requireVote(m1PKID, 300, 0)
+
+	// Votes for an option or a proposal that doesn't exist are rejected.
+	_, _, _, err = _castVote(t, chain, db, params, feeRateNanosPerKB, m2Pub, m2Priv,
+		&CastVoteMetadata{ProposalID: proposalID, OptionIndex: 2})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorGovernanceInvalidOptionIndex)
+	_, _, _, err = _castVote(t, chain, db, params, feeRateNanosPerKB, m2Pub, m2Priv,
+		&CastVoteMetadata{ProposalID: NewBlockHash(RandomBytes(HashSizeBytes)), OptionIndex: 0})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorGovernanceProposalNotFound)
+
+	// Disconnecting the changed vote puts the tally and the vote back.
+	{
+		lastTxn := testMeta.txns[len(testMeta.txns)-1]
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(
+			lastTxn, lastTxn.Hash(), testMeta.txnOps[len(testMeta.txnOps)-1], chain.blockTip().Height+1))
+		proposalEntry, err := utxoView.GetProposalEntry(proposalID)
+		require.NoError(err)
+		require.Equal(proposalEntryBeforeChange, proposalEntry)
+		voteEntry, err := utxoView.GetVoteEntry(proposalID, m1PKID)
+		require.NoError(err)
+		require.Equal(uint64(1), voteEntry.OptionIndex)
+	}
+
+	_executeAllTestRollbackAndFlush(testMeta)
+
+	// Rolling everything back deletes the proposal and its snapshot.
+	require.Nil(getProposalEntry())
+	voteEntries, err := DBGetVoteEntriesForProposal(db, proposalID)
+	require.NoError(err)
+	require.Empty(voteEntries)
+}
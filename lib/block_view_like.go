@@ -2,7 +2,6 @@ package lib
 
 import (
 	"fmt"
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
 	"reflect"
@@ -18,24 +17,11 @@ func (bav *UtxoView) _getLikeEntryForLikeKey(likeKey *LikeKey) *LikeEntry {
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil. Either way, save the value to the in-memory view mapping got later.
-	likeExists := false
-	if bav.Postgres != nil {
-		likeExists = nil != bav.Postgres.GetLike(likeKey.LikerPubKey[:], &likeKey.LikedPostHash)
-	} else {
-		likeExists = nil != DbGetLikerPubKeyToLikedPostHashMapping(bav.Handle, bav.Snapshot,
-			likeKey.LikerPubKey[:], likeKey.LikedPostHash)
-	}
-
-	if likeExists {
-		likeEntry := LikeEntry{
-			LikerPubKey:   likeKey.LikerPubKey[:],
-			LikedPostHash: &likeKey.LikedPostHash,
-		}
-		bav._setLikeEntryMappings(&likeEntry)
-		return &likeEntry
+	likeEntry := bav.GetDbAdapter().GetLikeEntry(likeKey.LikerPubKey[:], &likeKey.LikedPostHash)
+	if likeEntry != nil {
+		bav._setLikeEntryMappings(likeEntry)
 	}
-
-	return nil
+	return likeEntry
 }
 
 func (bav *UtxoView) _setLikeEntryMappings(likeEntry *LikeEntry) {
@@ -68,33 +54,16 @@ func (bav *UtxoView) GetLikedByReader(readerPK []byte, postHash *BlockHash) bool
 }
 
 func (bav *UtxoView) GetLikesForPostHash(postHash *BlockHash) (_likerPubKeys [][]byte, _err error) {
-	if bav.Postgres != nil {
-		likes := bav.Postgres.GetLikesForPost(postHash)
-		for _, like := range likes {
-			bav._setLikeEntryMappings(like.NewLikeEntry())
-		}
-	} else {
-		handle := bav.Handle
-		dbPrefix := append([]byte{}, Prefixes.PrefixLikedPostHashToLikerPubKey...)
-		dbPrefix = append(dbPrefix, postHash[:]...)
-		keysFound, _ := EnumerateKeysForPrefix(handle, dbPrefix, true)
-
-		// Iterate over all the db keys & values and load them into the view.
-		expectedKeyLength := 1 + HashSizeBytes + btcec.PubKeyBytesLenCompressed
-		for _, key := range keysFound {
-			// Sanity check that this is a reasonable key.
-			if len(key) != expectedKeyLength {
-				return nil, fmt.Errorf("UtxoView.GetLikesForPostHash: Invalid key length found: %d", len(key))
-			}
-
-			likerPubKey := key[1+HashSizeBytes:]
-
-			likeKey := &LikeKey{
-				LikerPubKey:   MakePkMapKey(likerPubKey),
-				LikedPostHash: *postHash,
-			}
-
-			bav._getLikeEntryForLikeKey(likeKey)
+	dbLikeEntries, err := bav.GetDbAdapter().GetLikeEntriesForPostHash(postHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetLikesForPostHash: ")
+	}
+
+	// Load the db entries the view doesn't have yet into the view.
+	for _, dbLikeEntry := range dbLikeEntries {
+		likeKey := MakeLikeKey(dbLikeEntry.LikerPubKey, *dbLikeEntry.LikedPostHash)
+		if _, exists := bav.LikeKeyToLikeEntry[likeKey]; !exists {
+			bav._setLikeEntryMappings(dbLikeEntry)
 		}
 	}
 
@@ -239,7 +239,7 @@ func (bav *UtxoView) GetAllLockedBalanceEntriesForHodlerPKID(
 	_err error,
 ) {
 	// Pull entries from db.
-	dbLockedBalanceEntries, err := DBGetAllLockedBalanceEntriesForHodlerPKID(bav.Handle, hodlerPKID)
+	dbLockedBalanceEntries, err := bav.GetDbAdapter().GetAllLockedBalanceEntriesForHodlerPKID(hodlerPKID)
 	if err != nil {
 		return nil,
 			errors.Wrap(err, "GetLockedBalanceEntryForLockedBalanceEntryKey")
@@ -285,8 +285,8 @@ func (bav *UtxoView) GetLockedBalanceEntryForLockedBalanceEntryKey(
 	}
 
 	// No mapping exists in the view, check for an entry in the db.
-	lockedBalanceEntry, err := DBGetLockedBalanceEntryForLockedBalanceEntryKey(
-		bav.Handle, bav.Snapshot, lockedBalanceEntryKey)
+	lockedBalanceEntry, err := bav.GetDbAdapter().GetLockedBalanceEntryForLockedBalanceEntryKey(
+		lockedBalanceEntryKey)
 	if err != nil {
 		return nil,
 			errors.Wrap(err, "GetLockedBalanceEntryForLockedBalanceEntryKey")
@@ -319,8 +319,7 @@ func (bav *UtxoView) GetLimitedVestedLockedBalanceEntriesOverTimeInterval(
 	//		   Also note, we read a limited number of entries based on the passed limitToFetch
 	//         to prevent excessive reads to the db. We explicitly check if the error occurs
 	//		   as a result of over-reading the db or from other db errors.
-	vestedLockedBalanceEntries, err := DBGetLimitedVestedLockedBalanceEntries(
-		bav.Handle,
+	vestedLockedBalanceEntries, err := bav.GetDbAdapter().GetLimitedVestedLockedBalanceEntries(
 		hodlerPKID,
 		profilePKID,
 		unlockTimestampNanoSecs,
@@ -412,7 +411,7 @@ func (bav *UtxoView) GetLockedBalanceEntryForHODLerPKIDProfilePKIDUnlockTimestam
 
 	// No mapping exists in the view, check for an entry in the DB.
 	lockedBalanceEntry, err :=
-		DBGetLockedBalanceEntryForLockedBalanceEntryKey(bav.Handle, bav.Snapshot, lockedBalanceEntryKey)
+		bav.GetDbAdapter().GetLockedBalanceEntryForLockedBalanceEntryKey(lockedBalanceEntryKey)
 	if err != nil {
 		return nil,
 			errors.Wrap(err,
@@ -448,7 +447,7 @@ func (bav *UtxoView) GetUnlockableLockedBalanceEntries(
 
 	// First, pull unlockable LockedBalanceEntries from the db and cache them in the UtxoView.
 	dbUnvestedUnlockableLockedBalanceEntries, dbVestedUnlockableLockedBalanceEntries, err :=
-		DBGetUnlockableLockedBalanceEntries(bav.Handle, hodlerPKID, profilePKID, currentTimestampNanoSecs)
+		bav.GetDbAdapter().GetUnlockableLockedBalanceEntries(hodlerPKID, profilePKID, currentTimestampNanoSecs)
 	if err != nil {
 		return nil, nil,
 			errors.Wrap(err, "UtxoView.GetUnlockableLockedBalanceEntries")
@@ -638,8 +637,7 @@ func (bav *UtxoView) GetYieldCurvePointByProfilePKIDAndDurationNanoSecs(profileP
 	}
 
 	// No mapping exists in the view, check for an entry in the DB.
-	lockupYieldCurvePoint, err = DBGetYieldCurvePointsByProfilePKIDAndDurationNanoSecs(bav.GetDbAdapter().badgerDb,
-		bav.Snapshot, profilePKID, lockupDurationNanoSecs)
+	lockupYieldCurvePoint, err = bav.GetDbAdapter().GetYieldCurvePointsByProfilePKIDAndDurationNanoSecs(profilePKID, lockupDurationNanoSecs)
 	if err != nil {
 		return nil, errors.Wrap(err, "GetYieldCurvePointByProfilePKIDAndDurationNanoSecs")
 	}
@@ -669,8 +667,8 @@ func (bav *UtxoView) GetLocalYieldCurvePoints(profilePKID *PKID, lockupDuration
 	var rightLockupPoint *LockupYieldCurvePoint
 
 	// Fetch all yield curve points in the db.
-	dbYieldCurvePoints, err := DBGetAllYieldCurvePointsByProfilePKID(
-		bav.GetDbAdapter().badgerDb, bav.Snapshot, profilePKID)
+	dbYieldCurvePoints, err := bav.GetDbAdapter().GetAllYieldCurvePointsByProfilePKID(
+		profilePKID)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "GetLocalYieldCurvePoints")
 	}
@@ -734,8 +732,8 @@ func (bav *UtxoView) GetAllYieldCurvePoints(
 	error,
 ) {
 	// Fetch all yield curve points in the db.
-	dbYieldCurvePoints, err := DBGetAllYieldCurvePointsByProfilePKID(
-		bav.GetDbAdapter().badgerDb, bav.Snapshot, profilePKID)
+	dbYieldCurvePoints, err := bav.GetDbAdapter().GetAllYieldCurvePointsByProfilePKID(
+		profilePKID)
 	if err != nil {
 		return nil, errors.Wrap(err, "GetLocalYieldCurvePoints")
 	}
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -2625,6 +2627,98 @@ func TestCoinLockupIndirectRecipients(t *testing.T) {
 	require.True(t, m0LockedBalanceEntry == nil)
 }
 
+func TestCoinLockupAndUnlockConnectAndDisconnect(t *testing.T) {
+	// Initialize test chain, miner, and testMeta
+	testMeta := _setUpMinerAndTestMetaForTimestampBasedLockupTests(t)
+
+	// Initialize m0, m1, m2, m3, m4, and paramUpdater
+	_setUpProfilesAndMintM0M1DAOCoins(testMeta)
+
+	unlockTimestampNanoSecs := int64(365 * 24 * 60 * 60 * 1e9)
+	lockedBalanceEntryKey := func(utxoView *UtxoView) LockedBalanceEntryKey {
+		return LockedBalanceEntryKey{
+			HODLerPKID:                  *utxoView.GetPKIDForPublicKey(m2PkBytes).PKID,
+			ProfilePKID:                 *utxoView.GetPKIDForPublicKey(m0PkBytes).PKID,
+			UnlockTimestampNanoSecs:     unlockTimestampNanoSecs,
+			VestingEndTimestampNanoSecs: unlockTimestampNanoSecs,
+		}
+	}
+	// requireBalances checks m0's and m2's unlocked m0 DAO coins and m2's locked m0 DAO coins
+	// in the db.
+	requireBalances := func(m0Balance uint64, m2Balance uint64, m2LockedBalance uint64) {
+		utxoView := NewUtxoView(
+			testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		balanceEntry, _, _ := utxoView.GetBalanceEntryForHODLerPubKeyAndCreatorPubKey(m0PkBytes, m0PkBytes, true)
+		require.Equal(t, *uint256.NewInt().SetUint64(m0Balance), balanceEntry.BalanceNanos)
+		balanceEntry, _, _ = utxoView.GetBalanceEntryForHODLerPubKeyAndCreatorPubKey(m2PkBytes, m0PkBytes, true)
+		require.Equal(t, *uint256.NewInt().SetUint64(m2Balance), balanceEntry.BalanceNanos)
+		lockedBalanceEntry, err := utxoView.GetLockedBalanceEntryForLockedBalanceEntryKey(
+			lockedBalanceEntryKey(utxoView))
+		require.NoError(t, err)
+		if m2LockedBalance == 0 {
+			require.Nil(t, lockedBalanceEntry)
+			return
+		}
+		require.NotNil(t, lockedBalanceEntry)
+		require.Equal(t, *uint256.NewInt().SetUint64(m2LockedBalance), lockedBalanceEntry.BalanceBaseUnits)
+	}
+	requireBalances(1e6, 0, 0)
+
+	// m0 locks up 1000 of its DAO coins for m2 for a year.
+	lockupUtxoOps, lockupTxn, lockupBlockHeight, err := _coinLockupWithConnectTimestamp(
+		t, testMeta.chain, testMeta.db, testMeta.params, testMeta.feeRateNanosPerKb,
+		m0Pub, m0Priv, m0Pub, m2Pub,
+		unlockTimestampNanoSecs,
+		unlockTimestampNanoSecs,
+		uint256.NewInt().SetUint64(1000),
+		0)
+	require.NoError(t, err)
+	requireBalances(1e6-1000, 0, 1000)
+
+	// m2 can't unlock the coins before or at the unlock timestamp.
+	// (This should fail -- RuleErrorCoinUnlockNoUnlockableCoinsFound)
+	for _, connectTimestamp := range []int64{0, unlockTimestampNanoSecs - 1, unlockTimestampNanoSecs} {
+		_, _, _, err = _coinUnlockWithConnectTimestamp(
+			t, testMeta.chain, testMeta.db, testMeta.params, testMeta.feeRateNanosPerKb,
+			m2Pub, m2Priv, m0Pub,
+			connectTimestamp)
+		require.Contains(t, err.Error(), RuleErrorCoinUnlockNoUnlockableCoinsFound)
+		requireBalances(1e6-1000, 0, 1000)
+	}
+
+	// m2 unlocks the coins once the unlock timestamp has passed.
+	unlockUtxoOps, unlockTxn, unlockBlockHeight, err := _coinUnlockWithConnectTimestamp(
+		t, testMeta.chain, testMeta.db, testMeta.params, testMeta.feeRateNanosPerKb,
+		m2Pub, m2Priv, m0Pub,
+		unlockTimestampNanoSecs+1)
+	require.NoError(t, err)
+	requireBalances(1e6-1000, 1000, 0)
+
+	// There's nothing left for m2 to unlock.
+	// (This should fail -- RuleErrorCoinUnlockNoUnlockableCoinsFound)
+	{
+		_, _, _, err = _coinUnlockWithConnectTimestamp(
+			t, testMeta.chain, testMeta.db, testMeta.params, testMeta.feeRateNanosPerKb,
+			m2Pub, m2Priv, m0Pub,
+			unlockTimestampNanoSecs+1)
+		require.Contains(t, err.Error(), RuleErrorCoinUnlockNoUnlockableCoinsFound)
+	}
+
+	// Disconnecting the unlock locks the coins again.
+	utxoView := NewUtxoView(
+		testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	require.NoError(t, utxoView.DisconnectTransaction(unlockTxn, unlockTxn.Hash(), unlockUtxoOps, unlockBlockHeight))
+	require.NoError(t, utxoView.FlushToDb(uint64(unlockBlockHeight)))
+	requireBalances(1e6-1000, 0, 1000)
+
+	// Disconnecting the lockup returns the coins to m0.
+	utxoView = NewUtxoView(
+		testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	require.NoError(t, utxoView.DisconnectTransaction(lockupTxn, lockupTxn.Hash(), lockupUtxoOps, lockupBlockHeight))
+	require.NoError(t, utxoView.FlushToDb(uint64(lockupBlockHeight)))
+	requireBalances(1e6, 0, 0)
+}
+
 func TestSimpleVestedLockup(t *testing.T) {
 	// Initialize test chain, miner, and testMeta
 	testMeta := _setUpMinerAndTestMetaForTimestampBasedLockupTests(t)
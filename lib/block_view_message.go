@@ -24,7 +24,7 @@ func (bav *UtxoView) _getMessageEntryForMessageKey(messageKey *MessageKey) *Mess
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil. Either way, save the value to the in-memory view mapping got later.
-	dbMessageEntry := DBGetMessageEntry(bav.Handle, bav.Snapshot, messageKey.PublicKey[:], messageKey.TstampNanos)
+	dbMessageEntry := bav.GetDbAdapter().GetMessageEntry(messageKey.PublicKey[:], messageKey.TstampNanos)
 	if dbMessageEntry != nil {
 		bav._setMessageEntryMappings(dbMessageEntry)
 	}
@@ -110,7 +110,7 @@ func (bav *UtxoView) GetMessagingGroupKeyToMessagingGroupEntryMapping(
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil. Either way, save the value to the in-memory UtxoView mapping.
-	messagingGroupEntry := DBGetMessagingGroupEntry(bav.Handle, bav.Snapshot, messagingGroupKey)
+	messagingGroupEntry := bav.GetDbAdapter().GetMessagingGroupEntry(messagingGroupKey)
 	if messagingGroupEntry != nil {
 		bav._setMessagingGroupKeyToMessagingGroupEntryMapping(&messagingGroupKey.OwnerPublicKey, messagingGroupEntry)
 	}
@@ -206,7 +206,7 @@ func (bav *UtxoView) GetMessagingGroupEntriesForUser(ownerPublicKey []byte) (
 	}
 
 	// We fetched all the entries from the UtxoView, so we move to the DB.
-	dbMessagingKeys, err := DBGetAllUserGroupEntries(bav.Handle, ownerPublicKey)
+	dbMessagingKeys, err := bav.GetDbAdapter().GetAllUserGroupEntries(ownerPublicKey)
 	if err != nil {
 		return nil, errors.Wrapf(err, "GetUserMessagingKeys: problem getting "+
 			"messaging keys from the DB")
@@ -271,7 +271,7 @@ func (bav *UtxoView) GetLimitedMessagesForUser(ownerPublicKey []byte, limit uint
 	}
 
 	// We fetched all UtxoView entries, so now look for messages in the DB.
-	dbMessageEntries, err := DBGetLimitedMessageForMessagingKeys(bav.Handle, messagingGroupEntries, limit)
+	dbMessageEntries, err := bav.GetDbAdapter().GetLimitedMessageForMessagingKeys(messagingGroupEntries, limit)
 
 	if err != nil {
 		return nil, nil, errors.Wrapf(err, "GetMessagesForUser: Problem fetching MessageEntries from db: ")
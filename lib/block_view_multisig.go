@@ -0,0 +1,643 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_view_multisig.go lets an account require m-of-n co-signer signatures on its txns,
+// which protects high-value accounts like DAO treasuries against the loss of a single key.
+// The owner registers its co-signer public keys and a threshold with the RegisterMultisig
+// txn. From then on, every txn the account submits must carry exactly threshold valid
+// co-signer signatures in its MultisigSignatures, in addition to its usual signature. This
+// includes txns signed with the account's derived keys, and the RegisterMultisig txns that
+// change or remove the multisig.
+//
+// The co-signatures are part of the txn's hash, so they must be canonical: sorted by signer
+// public key, in low-S DER form, and no more than the threshold. Otherwise anyone relaying
+// the txn could change its hash by reordering, re-encoding, or adding co-signatures.
+//
+// The multisig is keyed by the owner's PKID, so it follows the account through a
+// SwapIdentity. Co-signatures are checked along with the txn's signature, so like it they
+// aren't checked when a block is connected without verifying signatures.
+
+//
+// TYPES: MultisigSignature
+//
+
+// MultisigSignature is a co-signer's signature of a txn. Like the txn's Signature, it signs
+// the double-sha256 hash of the txn's bytes without any signatures.
+type MultisigSignature struct {
+	SignerPublicKey *PublicKey
+	// Signature is DER-encoded.
+	Signature []byte
+}
+
+func (multisigSignature *MultisigSignature) ToBytes() []byte {
+	var data []byte
+	data = append(data, EncodeByteArray(multisigSignature.SignerPublicKey.ToBytes())...)
+	data = append(data, EncodeByteArray(multisigSignature.Signature)...)
+	return data
+}
+
+func (multisigSignature *MultisigSignature) FromBytes(rr io.Reader) error {
+	signerPublicKeyBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MultisigSignature.FromBytes: Problem reading SignerPublicKey: ")
+	}
+	if len(signerPublicKeyBytes) != btcec.PubKeyBytesLenCompressed {
+		return fmt.Errorf("MultisigSignature.FromBytes: Invalid SignerPublicKey length %d",
+			len(signerPublicKeyBytes))
+	}
+	multisigSignature.SignerPublicKey = NewPublicKey(signerPublicKeyBytes)
+
+	multisigSignature.Signature, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MultisigSignature.FromBytes: Problem reading Signature: ")
+	}
+	return nil
+}
+
+// AddMultisigSignature signs the txn with a co-signer's private key and adds the signature
+// to its MultisigSignatures, keeping them sorted by signer public key. Since co-signers
+// sign the txn without any signatures, they can sign before or after the owner.
+func (msg *MsgDeSoTxn) AddMultisigSignature(privKey *btcec.PrivateKey) error {
+	txnBytes, err := msg.ToBytes(true /*preSignature*/)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoTxn.AddMultisigSignature: ")
+	}
+	txnSignatureHash := Sha256DoubleHash(txnBytes)
+	signature, err := privKey.Sign(txnSignatureHash[:])
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoTxn.AddMultisigSignature: ")
+	}
+	signerPublicKeyBytes := privKey.PubKey().SerializeCompressed()
+	insertIndex := sort.Search(len(msg.MultisigSignatures), func(ii int) bool {
+		return bytes.Compare(msg.MultisigSignatures[ii].SignerPublicKey.ToBytes(), signerPublicKeyBytes) >= 0
+	})
+	msg.MultisigSignatures = append(msg.MultisigSignatures, nil)
+	copy(msg.MultisigSignatures[insertIndex+1:], msg.MultisigSignatures[insertIndex:])
+	msg.MultisigSignatures[insertIndex] = &MultisigSignature{
+		SignerPublicKey: NewPublicKey(signerPublicKeyBytes),
+		Signature:       signature.Serialize(),
+	}
+	return nil
+}
+
+//
+// TYPES: RegisterMultisigMetadata
+//
+
+type RegisterMultisigMetadata struct {
+	CoSignerPublicKeys []*PublicKey
+	// Threshold is the number of co-signer signatures each of the account's txns must carry.
+	// Registering no co-signers with a zero threshold removes the account's multisig.
+	Threshold uint64
+}
+
+func (txnData *RegisterMultisigMetadata) GetTxnType() TxnType {
+	return TxnTypeRegisterMultisig
+}
+
+func (txnData *RegisterMultisigMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(txnData.CoSignerPublicKeys)))...)
+	for _, coSignerPublicKey := range txnData.CoSignerPublicKeys {
+		data = append(data, EncodeByteArray(coSignerPublicKey.ToBytes())...)
+	}
+	data = append(data, UintToBuf(txnData.Threshold)...)
+	return data, nil
+}
+
+func (txnData *RegisterMultisigMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	// CoSignerPublicKeys
+	numCoSigners, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RegisterMultisigMetadata.FromBytes: Problem reading number of CoSignerPublicKeys: ")
+	}
+	if numCoSigners > MaxMultisigCoSigners {
+		return errors.Wrapf(RuleErrorMultisigTooManyCoSigners,
+			"RegisterMultisigMetadata.FromBytes: %d co-signers exceeds the max of %d", numCoSigners, MaxMultisigCoSigners)
+	}
+	txnData.CoSignerPublicKeys = nil
+	for ii := uint64(0); ii < numCoSigners; ii++ {
+		coSignerPublicKeyBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "RegisterMultisigMetadata.FromBytes: Problem reading CoSignerPublicKey: ")
+		}
+		txnData.CoSignerPublicKeys = append(txnData.CoSignerPublicKeys, NewPublicKey(coSignerPublicKeyBytes))
+	}
+
+	// Threshold
+	txnData.Threshold, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RegisterMultisigMetadata.FromBytes: Problem reading Threshold: ")
+	}
+	return nil
+}
+
+func (txnData *RegisterMultisigMetadata) New() DeSoTxnMetadata {
+	return &RegisterMultisigMetadata{}
+}
+
+//
+// TYPES: MultisigEntry
+//
+
+type MultisigEntry struct {
+	OwnerPKID          *PKID
+	CoSignerPublicKeys []*PublicKey
+	Threshold          uint64
+
+	isDeleted bool
+}
+
+func (entry *MultisigEntry) Copy() *MultisigEntry {
+	coSignerPublicKeys := make([]*PublicKey, 0, len(entry.CoSignerPublicKeys))
+	for _, coSignerPublicKey := range entry.CoSignerPublicKeys {
+		coSignerPublicKeys = append(coSignerPublicKeys, NewPublicKey(coSignerPublicKey.ToBytes()))
+	}
+	return &MultisigEntry{
+		OwnerPKID:          entry.OwnerPKID.NewPKID(),
+		CoSignerPublicKeys: coSignerPublicKeys,
+		Threshold:          entry.Threshold,
+		isDeleted:          entry.isDeleted,
+	}
+}
+
+// IsCoSigner returns true if the public key is one of the entry's co-signers.
+func (entry *MultisigEntry) IsCoSigner(publicKey *PublicKey) bool {
+	for _, coSignerPublicKey := range entry.CoSignerPublicKeys {
+		if *coSignerPublicKey == *publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+func (entry *MultisigEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.OwnerPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(uint64(len(entry.CoSignerPublicKeys)))...)
+	for _, coSignerPublicKey := range entry.CoSignerPublicKeys {
+		data = append(data, EncodeByteArray(coSignerPublicKey.ToBytes())...)
+	}
+	data = append(data, UintToBuf(entry.Threshold)...)
+	return data
+}
+
+func (entry *MultisigEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// OwnerPKID
+	entry.OwnerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "MultisigEntry.Decode: Problem reading OwnerPKID: ")
+	}
+
+	// CoSignerPublicKeys
+	numCoSigners, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MultisigEntry.Decode: Problem reading number of CoSignerPublicKeys: ")
+	}
+	if numCoSigners > MaxMultisigCoSigners {
+		return fmt.Errorf("MultisigEntry.Decode: %d co-signers exceeds the max of %d",
+			numCoSigners, MaxMultisigCoSigners)
+	}
+	entry.CoSignerPublicKeys = nil
+	for ii := uint64(0); ii < numCoSigners; ii++ {
+		coSignerPublicKeyBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MultisigEntry.Decode: Problem reading CoSignerPublicKey: ")
+		}
+		entry.CoSignerPublicKeys = append(entry.CoSignerPublicKeys, NewPublicKey(coSignerPublicKeyBytes))
+	}
+
+	// Threshold
+	entry.Threshold, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MultisigEntry.Decode: Problem reading Threshold: ")
+	}
+
+	return nil
+}
+
+func (entry *MultisigEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *MultisigEntry) GetEncoderType() EncoderType {
+	return EncoderTypeMultisigEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForMultisigEntry(ownerPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixMultisigEntryByOwnerPKID...)
+	key = append(key, ownerPKID.ToBytes()...)
+	return key
+}
+
+func DBGetMultisigEntry(handle *badger.DB, snap *Snapshot, ownerPKID *PKID) (*MultisigEntry, error) {
+	var ret *MultisigEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetMultisigEntryWithTxn(txn, snap, ownerPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetMultisigEntryWithTxn(txn *badger.Txn, snap *Snapshot, ownerPKID *PKID) (*MultisigEntry, error) {
+	// Retrieve MultisigEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForMultisigEntry(ownerPKID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetMultisigEntry: problem retrieving MultisigEntry: ")
+	}
+
+	// Decode MultisigEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&MultisigEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetMultisigEntry: problem decoding MultisigEntry: ")
+	}
+	return entry, nil
+}
+
+func DBPutMultisigEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *MultisigEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForMultisigEntry(entry.OwnerPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutMultisigEntryWithTxn: problem storing MultisigEntry: ")
+	}
+	return nil
+}
+
+func DBDeleteMultisigEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *MultisigEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForMultisigEntry(entry.OwnerPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteMultisigEntryWithTxn: problem deleting MultisigEntry: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetMultisigEntry returns the multisig registered by the owner, or nil if it hasn't
+// registered one.
+func (bav *UtxoView) GetMultisigEntry(ownerPKID *PKID) (*MultisigEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.MultisigOwnerPKIDToEntry[*ownerPKID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetMultisigEntry(ownerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetMultisigEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the MultisigEntry from the db in the UtxoView.
+		bav._setMultisigEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetMultisigEntryForPublicKey returns the multisig registered by the account with the
+// public key, or nil if it hasn't registered one.
+func (bav *UtxoView) GetMultisigEntryForPublicKey(publicKey []byte) (*MultisigEntry, error) {
+	pkidEntry := bav.GetPKIDForPublicKey(publicKey)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return nil, nil
+	}
+	return bav.GetMultisigEntry(pkidEntry.PKID)
+}
+
+func (bav *UtxoView) _setMultisigEntryMappings(entry *MultisigEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setMultisigEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.MultisigOwnerPKIDToEntry[*entry.OwnerPKID] = entry
+}
+
+func (bav *UtxoView) _deleteMultisigEntryMappings(entry *MultisigEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteMultisigEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setMultisigEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushMultisigEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.MultisigOwnerPKIDToEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.OwnerPKID.Eq(&mapKey) {
+			return fmt.Errorf("_flushMultisigEntriesToDbWithTxn: MultisigEntry owner PKID %v doesn't "+
+				"match MapKey %v", entry.OwnerPKID, &mapKey)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteMultisigEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushMultisigEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutMultisigEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushMultisigEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// SIGNATURE VERIFICATION
+//
+
+// _verifyMultisigSignatures checks that a txn from an account with a multisig carries
+// exactly the multisig's threshold of valid co-signer signatures in canonical form. It's
+// called once the txn's own signature has been verified.
+func (bav *UtxoView) _verifyMultisigSignatures(txn *MsgDeSoTxn, blockHeight uint32) error {
+	if blockHeight < bav.Params.ForkHeights.MultisigBlockHeight {
+		if len(txn.MultisigSignatures) > 0 {
+			return errors.Wrapf(RuleErrorMultisigSignaturesBeforeBlockHeight, "_verifyMultisigSignatures: ")
+		}
+		return nil
+	}
+
+	multisigEntry, err := bav.GetMultisigEntryForPublicKey(txn.PublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "_verifyMultisigSignatures: ")
+	}
+	if multisigEntry == nil {
+		// Signatures that no one requires would only make the txn's hash malleable.
+		if len(txn.MultisigSignatures) > 0 {
+			return errors.Wrapf(RuleErrorMultisigSignaturesWithoutRegistration, "_verifyMultisigSignatures: ")
+		}
+		return nil
+	}
+	// Extra signatures aren't needed and would make the txn's hash malleable.
+	if uint64(len(txn.MultisigSignatures)) > multisigEntry.Threshold {
+		return errors.Wrapf(RuleErrorMultisigTooManySignatures, "_verifyMultisigSignatures: "+
+			"%d co-signer signatures exceeds the threshold of %d", len(txn.MultisigSignatures), multisigEntry.Threshold)
+	}
+
+	txnBytes, err := txn.ToBytes(true /*preSignature*/)
+	if err != nil {
+		return errors.Wrapf(err, "_verifyMultisigSignatures: Problem serializing txn without signatures: ")
+	}
+	txnSignatureHash := Sha256DoubleHash(txnBytes)
+
+	signers := make(map[PublicKey]bool)
+	for ii, multisigSignature := range txn.MultisigSignatures {
+		if !multisigEntry.IsCoSigner(multisigSignature.SignerPublicKey) {
+			return errors.Wrapf(RuleErrorMultisigSignerNotCoSigner, "_verifyMultisigSignatures: %v",
+				PkToStringBoth(multisigSignature.SignerPublicKey.ToBytes()))
+		}
+		if signers[*multisigSignature.SignerPublicKey] {
+			return errors.Wrapf(RuleErrorMultisigDuplicateSignature, "_verifyMultisigSignatures: %v",
+				PkToStringBoth(multisigSignature.SignerPublicKey.ToBytes()))
+		}
+		if ii > 0 && bytes.Compare(txn.MultisigSignatures[ii-1].SignerPublicKey.ToBytes(),
+			multisigSignature.SignerPublicKey.ToBytes()) > 0 {
+			return errors.Wrapf(RuleErrorMultisigSignaturesNotSorted, "_verifyMultisigSignatures: %v",
+				PkToStringBoth(multisigSignature.SignerPublicKey.ToBytes()))
+		}
+		signerPublicKey, err := btcec.ParsePubKey(multisigSignature.SignerPublicKey.ToBytes(), btcec.S256())
+		if err != nil {
+			return errors.Wrapf(RuleErrorMultisigInvalidSignature, "_verifyMultisigSignatures: %v", err)
+		}
+		signature, err := btcec.ParseDERSignature(multisigSignature.Signature, btcec.S256())
+		if err != nil {
+			return errors.Wrapf(RuleErrorMultisigInvalidSignature, "_verifyMultisigSignatures: %v", err)
+		}
+		// Serialize always gives the low-S DER encoding, so this rejects high-S signatures
+		// and any other encoding of the same signature.
+		if !bytes.Equal(signature.Serialize(), multisigSignature.Signature) {
+			return errors.Wrapf(RuleErrorMultisigNonCanonicalSignature, "_verifyMultisigSignatures: %v",
+				PkToStringBoth(multisigSignature.SignerPublicKey.ToBytes()))
+		}
+		if !signature.Verify(txnSignatureHash[:], signerPublicKey) {
+			return errors.Wrapf(RuleErrorMultisigInvalidSignature, "_verifyMultisigSignatures: %v",
+				PkToStringBoth(multisigSignature.SignerPublicKey.ToBytes()))
+		}
+		signers[*multisigSignature.SignerPublicKey] = true
+	}
+	if uint64(len(signers)) < multisigEntry.Threshold {
+		return errors.Wrapf(RuleErrorMultisigInsufficientSignatures, "_verifyMultisigSignatures: "+
+			"%d of the required %d co-signer signatures", len(signers), multisigEntry.Threshold)
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectRegisterMultisig(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.MultisigBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorRegisterMultisigBeforeBlockHeight, "_connectRegisterMultisig: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeRegisterMultisig {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectRegisterMultisig: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*RegisterMultisigMetadata)
+
+	// A derived key can't change which keys must co-sign the owner's txns.
+	if _, isDerived, err := IsDerivedSignature(txn, blockHeight); err != nil || isDerived {
+		return 0, 0, nil, errors.Wrapf(RuleErrorRegisterMultisigMustBeSignedByOwner, "_connectRegisterMultisig: ")
+	}
+
+	// Validate the metadata.
+	if err := ValidateRegisterMultisigMetadata(txMeta, txn.PublicKey); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRegisterMultisig: ")
+	}
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata. This verifies the co-signatures of the existing
+	// multisig, so changing or removing it requires the current co-signers.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRegisterMultisig: ")
+	}
+
+	ownerPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if ownerPKIDEntry == nil || ownerPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectRegisterMultisig: PKID for owner %v not found",
+			PkToStringBoth(txn.PublicKey))
+	}
+	prevMultisigEntry, err := bav.GetMultisigEntry(ownerPKIDEntry.PKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRegisterMultisig: ")
+	}
+	if prevMultisigEntry != nil {
+		prevMultisigEntry = prevMultisigEntry.Copy()
+		bav._deleteMultisigEntryMappings(prevMultisigEntry)
+	}
+	if len(txMeta.CoSignerPublicKeys) > 0 {
+		bav._setMultisigEntryMappings(&MultisigEntry{
+			OwnerPKID:          ownerPKIDEntry.PKID.NewPKID(),
+			CoSignerPublicKeys: txMeta.CoSignerPublicKeys,
+			Threshold:          txMeta.Threshold,
+		})
+	}
+
+	// Add a UTXO operation.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:              OperationTypeRegisterMultisig,
+		PrevMultisigEntry: prevMultisigEntry,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectRegisterMultisig(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.MultisigBlockHeight {
+		return errors.Wrapf(RuleErrorRegisterMultisigBeforeBlockHeight, "_disconnectRegisterMultisig: ")
+	}
+
+	// Validate the last operation is a RegisterMultisig operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectRegisterMultisig: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeRegisterMultisig {
+		return fmt.Errorf(
+			"_disconnectRegisterMultisig: trying to revert %v but found %v",
+			OperationTypeRegisterMultisig,
+			operationData.Type,
+		)
+	}
+
+	// Delete the multisig the txn registered and restore the previous one.
+	ownerPKIDEntry := bav.GetPKIDForPublicKey(currentTxn.PublicKey)
+	if ownerPKIDEntry == nil || ownerPKIDEntry.isDeleted {
+		return fmt.Errorf("_disconnectRegisterMultisig: PKID for owner %v not found",
+			PkToStringBoth(currentTxn.PublicKey))
+	}
+	multisigEntry, err := bav.GetMultisigEntry(ownerPKIDEntry.PKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectRegisterMultisig: ")
+	}
+	if multisigEntry != nil {
+		bav._deleteMultisigEntryMappings(multisigEntry)
+	}
+	if operationData.PrevMultisigEntry != nil {
+		bav._setMultisigEntryMappings(operationData.PrevMultisigEntry)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// ValidateRegisterMultisigMetadata checks that the co-signers are valid, distinct public
+// keys other than the owner's and that the threshold can be met. Registering no co-signers
+// with a zero threshold is valid and removes the multisig.
+func ValidateRegisterMultisigMetadata(metadata *RegisterMultisigMetadata, ownerPublicKey []byte) error {
+	if len(metadata.CoSignerPublicKeys) == 0 {
+		if metadata.Threshold != 0 {
+			return errors.Wrapf(RuleErrorMultisigInvalidThreshold, "ValidateRegisterMultisigMetadata: ")
+		}
+		return nil
+	}
+	if len(metadata.CoSignerPublicKeys) > MaxMultisigCoSigners {
+		return errors.Wrapf(RuleErrorMultisigTooManyCoSigners, "ValidateRegisterMultisigMetadata: ")
+	}
+	if metadata.Threshold == 0 || metadata.Threshold > uint64(len(metadata.CoSignerPublicKeys)) {
+		return errors.Wrapf(RuleErrorMultisigInvalidThreshold, "ValidateRegisterMultisigMetadata: "+
+			"threshold %d with %d co-signers", metadata.Threshold, len(metadata.CoSignerPublicKeys))
+	}
+	coSigners := make(map[PublicKey]bool)
+	for _, coSignerPublicKey := range metadata.CoSignerPublicKeys {
+		if coSignerPublicKey == nil || bytes.Equal(coSignerPublicKey.ToBytes(), ownerPublicKey) {
+			return errors.Wrapf(RuleErrorMultisigInvalidCoSignerPublicKey, "ValidateRegisterMultisigMetadata: ")
+		}
+		if _, err := btcec.ParsePubKey(coSignerPublicKey.ToBytes(), btcec.S256()); err != nil {
+			return errors.Wrapf(RuleErrorMultisigInvalidCoSignerPublicKey, "ValidateRegisterMultisigMetadata: %v", err)
+		}
+		if coSigners[*coSignerPublicKey] {
+			return errors.Wrapf(RuleErrorMultisigDuplicateCoSigner, "ValidateRegisterMultisigMetadata: %v",
+				PkToStringBoth(coSignerPublicKey.ToBytes()))
+		}
+		coSigners[*coSignerPublicKey] = true
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultisigSignatureEncoding(t *testing.T) {
+	require := require.New(t)
+
+	ownerPrivKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+	coSignerPrivKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+
+	txn := &MsgDeSoTxn{
+		TxnVersion:  DeSoTxnVersion1,
+		TxnMeta:     &BasicTransferMetadata{},
+		PublicKey:   ownerPrivKey.PubKey().SerializeCompressed(),
+		TxnFeeNanos: 100,
+		TxnNonce: &DeSoNonce{
+			ExpirationBlockHeight: 10,
+			PartialID:             1,
+		},
+	}
+	txnSignature, err := txn.Sign(ownerPrivKey)
+	require.NoError(err)
+	txn.Signature.SetSignature(txnSignature)
+
+	// A txn without multisig signatures keeps its bytes and hash.
+	txnBytes, err := txn.ToBytes(false)
+	require.NoError(err)
+	txnHash := txn.Hash()
+
+	require.NoError(txn.AddMultisigSignature(coSignerPrivKey))
+	require.Len(txn.MultisigSignatures, 1)
+	multisigTxnBytes, err := txn.ToBytes(false)
+	require.NoError(err)
+	require.Equal(txnBytes, multisigTxnBytes[:len(txnBytes)])
+	require.NotEqual(*txnHash, *txn.Hash())
+
+	// The co-signer signs the same bytes as the owner.
+	preSignatureBytes, err := txn.ToBytes(true)
+	require.NoError(err)
+	txn.MultisigSignatures = nil
+	ownerPreSignatureBytes, err := txn.ToBytes(true)
+	require.NoError(err)
+	require.Equal(ownerPreSignatureBytes, preSignatureBytes)
+
+	decodedTxn := &MsgDeSoTxn{}
+	require.NoError(decodedTxn.FromBytes(multisigTxnBytes))
+	require.Len(decodedTxn.MultisigSignatures, 1)
+	require.Equal(coSignerPrivKey.PubKey().SerializeCompressed(),
+		decodedTxn.MultisigSignatures[0].SignerPublicKey.ToBytes())
+	reencodedTxnBytes, err := decodedTxn.ToBytes(false)
+	require.NoError(err)
+	require.Equal(multisigTxnBytes, reencodedTxnBytes)
+
+	// Multisig signatures can't be added to V0 txns.
+	decodedTxn.TxnVersion = DeSoTxnVersion0
+	_, err = decodedTxn.ToBytes(false)
+	require.Error(err)
+}
+
+func TestValidateRegisterMultisigMetadata(t *testing.T) {
+	require := require.New(t)
+
+	newPublicKey := func() *PublicKey {
+		privKey, err := btcec.NewPrivateKey(btcec.S256())
+		require.NoError(err)
+		return NewPublicKey(privKey.PubKey().SerializeCompressed())
+	}
+	ownerPublicKey := newPublicKey().ToBytes()
+	coSignerPublicKeys := []*PublicKey{newPublicKey(), newPublicKey()}
+
+	// 2-of-2 and 1-of-2 are valid.
+	require.NoError(ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{
+		CoSignerPublicKeys: coSignerPublicKeys, Threshold: 2}, ownerPublicKey))
+	require.NoError(ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{
+		CoSignerPublicKeys: coSignerPublicKeys, Threshold: 1}, ownerPublicKey))
+	// Removing the multisig is valid.
+	require.NoError(ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{}, ownerPublicKey))
+
+	// The threshold must be between one and the number of co-signers.
+	err := ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{
+		CoSignerPublicKeys: coSignerPublicKeys, Threshold: 3}, ownerPublicKey)
+	require.Contains(err.Error(), string(RuleErrorMultisigInvalidThreshold))
+	err = ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{
+		CoSignerPublicKeys: coSignerPublicKeys, Threshold: 0}, ownerPublicKey)
+	require.Contains(err.Error(), string(RuleErrorMultisigInvalidThreshold))
+	err = ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{Threshold: 1}, ownerPublicKey)
+	require.Contains(err.Error(), string(RuleErrorMultisigInvalidThreshold))
+
+	// The owner can't be a co-signer and co-signers can't repeat.
+	err = ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{
+		CoSignerPublicKeys: []*PublicKey{NewPublicKey(ownerPublicKey)}, Threshold: 1}, ownerPublicKey)
+	require.Contains(err.Error(), string(RuleErrorMultisigInvalidCoSignerPublicKey))
+	err = ValidateRegisterMultisigMetadata(&RegisterMultisigMetadata{
+		CoSignerPublicKeys: []*PublicKey{coSignerPublicKeys[0], coSignerPublicKeys[0]}, Threshold: 1},
+		ownerPublicKey)
+	require.Contains(err.Error(), string(RuleErrorMultisigDuplicateCoSigner))
+
+	// The metadata round-trips.
+	metadata := &RegisterMultisigMetadata{CoSignerPublicKeys: coSignerPublicKeys, Threshold: 2}
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(err)
+	decodedMetadata := &RegisterMultisigMetadata{}
+	require.NoError(decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(metadata, decodedMetadata)
+}
+
+func TestVerifyMultisigSignatures(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.MultisigBlockHeight = 0
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	// The db has no best chain, so give the view a tip that CopyUtxoView can copy.
+	utxoView.TipHash = &BlockHash{}
+	blockHeight := uint32(10)
+
+	ownerPrivBytes, _, err := Base58CheckDecode(m0Priv)
+	require.NoError(err)
+	ownerPriv, _ := btcec.PrivKeyFromBytes(btcec.S256(), ownerPrivBytes)
+	_, err = utxoView._addBalance(1000, m0PkBytes)
+	require.NoError(err)
+	var coSignerPrivs []*btcec.PrivateKey
+	var coSignerPublicKeys []*PublicKey
+	for ii := 0; ii < 3; ii++ {
+		coSignerPriv, err := btcec.NewPrivateKey(btcec.S256())
+		require.NoError(err)
+		coSignerPrivs = append(coSignerPrivs, coSignerPriv)
+		coSignerPublicKeys = append(coSignerPublicKeys, NewPublicKey(coSignerPriv.PubKey().SerializeCompressed()))
+	}
+	otherPriv, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+
+	nextPartialID := uint64(0)
+	makeTxn := func(txnMeta DeSoTxnMetadata) *MsgDeSoTxn {
+		nextPartialID++
+		return &MsgDeSoTxn{
+			TxnVersion:  DeSoTxnVersion1,
+			TxnMeta:     txnMeta,
+			PublicKey:   m0PkBytes,
+			TxnFeeNanos: 10,
+			TxnNonce:    &DeSoNonce{ExpirationBlockHeight: 100, PartialID: nextPartialID},
+		}
+	}
+	signTxn := func(txn *MsgDeSoTxn, coSignerPrivs ...*btcec.PrivateKey) {
+		signature, err := txn.Sign(ownerPriv)
+		require.NoError(err)
+		txn.Signature.SetSignature(signature)
+		for _, coSignerPriv := range coSignerPrivs {
+			require.NoError(txn.AddMultisigSignature(coSignerPriv))
+		}
+	}
+	requireVerifyError := func(txn *MsgDeSoTxn, ruleError RuleError) {
+		err := utxoView._verifyMultisigSignatures(txn, blockHeight)
+		require.Error(err)
+		require.Contains(err.Error(), ruleError)
+	}
+	requireThreshold := func(threshold uint64) {
+		multisigEntry, err := utxoView.GetMultisigEntryForPublicKey(m0PkBytes)
+		require.NoError(err)
+		if threshold == 0 {
+			require.Nil(multisigEntry)
+			return
+		}
+		require.NotNil(multisigEntry)
+		require.Equal(threshold, multisigEntry.Threshold)
+	}
+
+	// m0 registers a 2-of-3 multisig, which doesn't need co-signatures yet.
+	registerTxn := makeTxn(&RegisterMultisigMetadata{CoSignerPublicKeys: coSignerPublicKeys, Threshold: 2})
+	signTxn(registerTxn)
+	_, _, registerUtxoOps, err := utxoView._connectRegisterMultisig(
+		registerTxn, registerTxn.Hash(), blockHeight, true)
+	require.NoError(err)
+	requireThreshold(2)
+
+	// Co-signatures are added in sorted order, so any two co-signers can sign in any order.
+	transferTxn := makeTxn(&BasicTransferMetadata{})
+	signTxn(transferTxn, coSignerPrivs[2], coSignerPrivs[0])
+	require.Len(transferTxn.MultisigSignatures, 2)
+	require.True(bytes.Compare(transferTxn.MultisigSignatures[0].SignerPublicKey.ToBytes(),
+		transferTxn.MultisigSignatures[1].SignerPublicKey.ToBytes()) < 0)
+	require.NoError(utxoView._verifyMultisigSignatures(transferTxn, blockHeight))
+
+	// The threshold must be met.
+	insufficientTxn := makeTxn(&BasicTransferMetadata{})
+	signTxn(insufficientTxn, coSignerPrivs[1])
+	requireVerifyError(insufficientTxn, RuleErrorMultisigInsufficientSignatures)
+
+	// Signatures from keys that aren't co-signers don't count.
+	nonCoSignerTxn := makeTxn(&BasicTransferMetadata{})
+	signTxn(nonCoSignerTxn, coSignerPrivs[0], otherPriv)
+	requireVerifyError(nonCoSignerTxn, RuleErrorMultisigSignerNotCoSigner)
+
+	// A co-signer can't sign twice.
+	duplicateTxn := makeTxn(&BasicTransferMetadata{})
+	signTxn(duplicateTxn, coSignerPrivs[0])
+	duplicateTxn.MultisigSignatures = append(duplicateTxn.MultisigSignatures, duplicateTxn.MultisigSignatures[0])
+	requireVerifyError(duplicateTxn, RuleErrorMultisigDuplicateSignature)
+
+	// Reordering the co-signatures would change the txn's hash, so it's rejected.
+	unsortedTxn := makeTxn(&BasicTransferMetadata{})
+	signTxn(unsortedTxn, coSignerPrivs[0], coSignerPrivs[1])
+	unsortedHash := *unsortedTxn.Hash()
+	unsortedTxn.MultisigSignatures[0], unsortedTxn.MultisigSignatures[1] =
+		unsortedTxn.MultisigSignatures[1], unsortedTxn.MultisigSignatures[0]
+	require.NotEqual(unsortedHash, *unsortedTxn.Hash())
+	requireVerifyError(unsortedTxn, RuleErrorMultisigSignaturesNotSorted)
+
+	// So would adding a co-signature beyond the threshold.
+	tooManyTxn := makeTxn(&BasicTransferMetadata{})
+	signTxn(tooManyTxn, coSignerPrivs...)
+	requireVerifyError(tooManyTxn, RuleErrorMultisigTooManySignatures)
+
+	// So would swapping a co-signature for its high-S twin, even though it's still valid.
+	highSTxn := makeTxn(&BasicTransferMetadata{})
+	signTxn(highSTxn, coSignerPrivs[0], coSignerPrivs[1])
+	lowSSignature, err := btcec.ParseDERSignature(highSTxn.MultisigSignatures[0].Signature, btcec.S256())
+	require.NoError(err)
+	highS := new(big.Int).Sub(btcec.S256().N, lowSSignature.S)
+	encodeDERInt := func(val *big.Int) []byte {
+		valBytes := val.Bytes()
+		if valBytes[0]&0x80 != 0 {
+			valBytes = append([]byte{0x00}, valBytes...)
+		}
+		return append([]byte{0x02, byte(len(valBytes))}, valBytes...)
+	}
+	highSSignature := append(encodeDERInt(lowSSignature.R), encodeDERInt(highS)...)
+	highSSignature = append([]byte{0x30, byte(len(highSSignature))}, highSSignature...)
+	highSTxn.MultisigSignatures[0].Signature = highSSignature
+	requireVerifyError(highSTxn, RuleErrorMultisigNonCanonicalSignature)
+
+	// Removing the multisig needs the current co-signers, and disconnecting restores it.
+	removeTxn := makeTxn(&RegisterMultisigMetadata{})
+	signTxn(removeTxn, coSignerPrivs[1])
+	// A failed connect leaves the view dirty, so it's tried on a copy.
+	_, _, _, err = utxoView.CopyUtxoView()._connectRegisterMultisig(removeTxn, removeTxn.Hash(), blockHeight, true)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorMultisigInsufficientSignatures)
+	requireThreshold(2)
+	require.NoError(removeTxn.AddMultisigSignature(coSignerPrivs[2]))
+	_, _, removeUtxoOps, err := utxoView._connectRegisterMultisig(
+		removeTxn, removeTxn.Hash(), blockHeight, true)
+	require.NoError(err)
+	requireThreshold(0)
+	require.NoError(utxoView._disconnectRegisterMultisig(
+		OperationTypeRegisterMultisig, removeTxn, removeTxn.Hash(), removeUtxoOps, blockHeight))
+	requireThreshold(2)
+	require.NoError(utxoView._disconnectRegisterMultisig(
+		OperationTypeRegisterMultisig, registerTxn, registerTxn.Hash(), registerUtxoOps, blockHeight))
+	requireThreshold(0)
+	balance, err := utxoView.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(1000), balance)
+}
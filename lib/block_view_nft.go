@@ -45,17 +45,7 @@ func (bav *UtxoView) GetNFTEntryForNFTKey(nftKey *NFTKey) *NFTEntry {
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
-	var nftEntry *NFTEntry
-	if bav.Postgres != nil {
-		nft := bav.Postgres.GetNFT(&nftKey.NFTPostHash, nftKey.SerialNumber)
-		if nft != nil {
-			nftEntry = nft.NewNFTEntry()
-		}
-	} else {
-		nftEntry = DBGetNFTEntryByPostHashSerialNumber(bav.Handle, bav.Snapshot,
-			&nftKey.NFTPostHash, nftKey.SerialNumber)
-	}
-
+	nftEntry := bav.GetDbAdapter().GetNFTEntry(&nftKey.NFTPostHash, nftKey.SerialNumber)
 	if nftEntry != nil {
 		bav._setNFTEntryMappings(nftEntry)
 	}
@@ -64,15 +54,7 @@ func (bav *UtxoView) GetNFTEntryForNFTKey(nftKey *NFTKey) *NFTEntry {
 
 func (bav *UtxoView) GetNFTEntriesForPostHash(nftPostHash *BlockHash) []*NFTEntry {
 	// Get all the entries in the DB.
-	var dbNFTEntries []*NFTEntry
-	if bav.Postgres != nil {
-		nfts := bav.Postgres.GetNFTsForPostHash(nftPostHash)
-		for _, nft := range nfts {
-			dbNFTEntries = append(dbNFTEntries, nft.NewNFTEntry())
-		}
-	} else {
-		dbNFTEntries = DBGetNFTEntriesForPostHash(bav.Handle, nftPostHash)
-	}
+	dbNFTEntries := bav.GetDbAdapter().GetNFTEntriesForPostHash(nftPostHash)
 
 	// Make sure all of the DB entries are loaded in the view.
 	for _, dbNFTEntry := range dbNFTEntries {
@@ -95,15 +77,7 @@ func (bav *UtxoView) GetNFTEntriesForPostHash(nftPostHash *BlockHash) []*NFTEntr
 }
 
 func (bav *UtxoView) GetNFTEntriesForPKID(ownerPKID *PKID) []*NFTEntry {
-	var dbNFTEntries []*NFTEntry
-	if bav.Postgres != nil {
-		nfts := bav.Postgres.GetNFTsForPKID(ownerPKID)
-		for _, nft := range nfts {
-			dbNFTEntries = append(dbNFTEntries, nft.NewNFTEntry())
-		}
-	} else {
-		dbNFTEntries = DBGetNFTEntriesForPKID(bav.Handle, ownerPKID)
-	}
+	dbNFTEntries := bav.GetDbAdapter().GetNFTEntriesForPKID(ownerPKID)
 
 	// Make sure all of the DB entries are loaded in the view.
 	for _, dbNFTEntry := range dbNFTEntries {
@@ -125,17 +99,78 @@ func (bav *UtxoView) GetNFTEntriesForPKID(ownerPKID *PKID) []*NFTEntry {
 	return nftEntries
 }
 
-func (bav *UtxoView) GetNFTBidEntriesForPKID(bidderPKID *PKID) (_nftBidEntries []*NFTBidEntry) {
-	var dbNFTBidEntries []*NFTBidEntry
-	if bav.Postgres != nil {
-		bids := bav.Postgres.GetNFTBidsForPKID(bidderPKID)
-		for _, bid := range bids {
-			dbNFTBidEntries = append(dbNFTBidEntries, bid.NewNFTBidEntry())
+// GetNFTsOwnedByPublicKey returns up to limit of the NFTs owned by publicKey, sorted by
+// post hash and serial number and starting after startingNFTKey. Pass nil to start from
+// the first NFT, and the key of the last NFT returned to fetch the next page. On badger it
+// relies on the owner index, so it only sees NFTs in the db once the NFTOwnerIndexBlockHeight
+// has been connected.
+func (bav *UtxoView) GetNFTsOwnedByPublicKey(publicKey []byte, startingNFTKey *NFTKey, limit uint32) (
+	_nftEntries []*NFTEntry, _err error) {
+
+	pkidEntry := bav.GetPKIDForPublicKey(publicKey)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return nil, fmt.Errorf("GetNFTsOwnedByPublicKey: no PKID found for public key %v",
+			PkToStringBoth(publicKey))
+	}
+	ownerPKID := pkidEntry.PKID
+
+	// Any of the NFTs in the view may have changed hands, so we fetch enough
+	// from the db to fill the page even if none of them belong to the owner anymore.
+	numToFetch := limit
+	if uint64(limit)+uint64(len(bav.NFTKeyToNFTEntry)) < math.MaxUint32 {
+		numToFetch = limit + uint32(len(bav.NFTKeyToNFTEntry))
+	}
+	dbNFTEntries, err := bav.GetDbAdapter().GetPaginatedNFTEntriesForOwnerPKID(ownerPKID, startingNFTKey, numToFetch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetNFTsOwnedByPublicKey: ")
+	}
+
+	// Make sure all of the DB entries are loaded in the view.
+	for _, dbNFTEntry := range dbNFTEntries {
+		nftKey := MakeNFTKey(dbNFTEntry.NFTPostHash, dbNFTEntry.SerialNumber)
+		if _, ok := bav.NFTKeyToNFTEntry[nftKey]; !ok {
+			bav._setNFTEntryMappings(dbNFTEntry)
 		}
-	} else {
-		dbNFTBidEntries = DBGetNFTBidEntriesForPKID(bav.Handle, bidderPKID)
 	}
 
+	// Loop over the view and return the page of the owner's NFTs in order.
+	var nftEntries []*NFTEntry
+	for nftKey, nftEntry := range bav.NFTKeyToNFTEntry {
+		if nftEntry.isDeleted || !nftEntry.OwnerPKID.Eq(ownerPKID) {
+			continue
+		}
+		if startingNFTKey != nil && compareNFTKeys(&nftKey, startingNFTKey) <= 0 {
+			continue
+		}
+		nftEntries = append(nftEntries, nftEntry)
+	}
+	sort.Slice(nftEntries, func(ii, jj int) bool {
+		nftKeyII := MakeNFTKey(nftEntries[ii].NFTPostHash, nftEntries[ii].SerialNumber)
+		nftKeyJJ := MakeNFTKey(nftEntries[jj].NFTPostHash, nftEntries[jj].SerialNumber)
+		return compareNFTKeys(&nftKeyII, &nftKeyJJ) < 0
+	})
+	if uint32(len(nftEntries)) > limit {
+		nftEntries = nftEntries[:limit]
+	}
+	return nftEntries, nil
+}
+
+// compareNFTKeys orders NFTKeys the same way they're ordered in the owner index.
+func compareNFTKeys(nftKey1 *NFTKey, nftKey2 *NFTKey) int {
+	if cmp := bytes.Compare(nftKey1.NFTPostHash[:], nftKey2.NFTPostHash[:]); cmp != 0 {
+		return cmp
+	}
+	if nftKey1.SerialNumber < nftKey2.SerialNumber {
+		return -1
+	} else if nftKey1.SerialNumber > nftKey2.SerialNumber {
+		return 1
+	}
+	return 0
+}
+
+func (bav *UtxoView) GetNFTBidEntriesForPKID(bidderPKID *PKID) (_nftBidEntries []*NFTBidEntry) {
+	dbNFTBidEntries := bav.GetDbAdapter().GetNFTBidEntriesForPKID(bidderPKID)
+
 	// Make sure all of the DB entries are loaded in the view.
 	for _, dbNFTBidEntry := range dbNFTBidEntries {
 		nftBidKey := MakeNFTBidKey(bidderPKID, dbNFTBidEntry.NFTPostHash, dbNFTBidEntry.SerialNumber)
@@ -257,8 +292,8 @@ func (bav *UtxoView) GetDBHighAndLowBidEntriesForNFT(
 
 	// Loop until we find the highest bid in the database that hasn't been deleted in the view.
 	exitLoop := false
-	highBidEntries := DBGetNFTBidEntriesPaginated(
-		bav.Handle, nftHash, serialNumber, nil, numPerDBFetch, true)
+	highBidEntries := bav.GetDbAdapter().GetNFTBidEntriesPaginated(
+		nftHash, serialNumber, nil, numPerDBFetch, true)
 	for _, bidEntry := range highBidEntries {
 		bidEntryKey := MakeNFTBidKey(bidEntry.BidderPKID, bidEntry.NFTPostHash, bidEntry.SerialNumber)
 		if _, exists := bav.NFTBidKeyToNFTBidEntry[bidEntryKey]; !exists {
@@ -287,16 +322,16 @@ func (bav *UtxoView) GetDBHighAndLowBidEntriesForNFT(
 			break
 		} else {
 			nextStartEntry := highBidEntries[len(highBidEntries)-1]
-			highBidEntries = DBGetNFTBidEntriesPaginated(
-				bav.Handle, nftHash, serialNumber, nextStartEntry, numPerDBFetch, true,
+			highBidEntries = bav.GetDbAdapter().GetNFTBidEntriesPaginated(
+				nftHash, serialNumber, nextStartEntry, numPerDBFetch, true,
 			)
 		}
 	}
 
 	// Loop until we find the lowest bid in the database that hasn't been deleted in the view.
 	exitLoop = false
-	lowBidEntries := DBGetNFTBidEntriesPaginated(
-		bav.Handle, nftHash, serialNumber, nil, numPerDBFetch, false)
+	lowBidEntries := bav.GetDbAdapter().GetNFTBidEntriesPaginated(
+		nftHash, serialNumber, nil, numPerDBFetch, false)
 	for _, bidEntry := range lowBidEntries {
 		bidEntryKey := MakeNFTBidKey(bidEntry.BidderPKID, bidEntry.NFTPostHash, bidEntry.SerialNumber)
 		if _, exists := bav.NFTBidKeyToNFTBidEntry[bidEntryKey]; !exists {
@@ -325,8 +360,8 @@ func (bav *UtxoView) GetDBHighAndLowBidEntriesForNFT(
 			break
 		} else {
 			nextStartEntry := lowBidEntries[len(lowBidEntries)-1]
-			lowBidEntries = DBGetNFTBidEntriesPaginated(
-				bav.Handle, nftHash, serialNumber, nextStartEntry, numPerDBFetch, false,
+			lowBidEntries = bav.GetDbAdapter().GetNFTBidEntriesPaginated(
+				nftHash, serialNumber, nextStartEntry, numPerDBFetch, false,
 			)
 		}
 	}
@@ -355,8 +390,8 @@ func (bav *UtxoView) GetAcceptNFTBidHistoryForNFTKey(nftKey *NFTKey) *[]*NFTBidE
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
-	dbNFTBidEntries := DBGetAcceptedNFTBidEntriesByPostHashSerialNumber(
-		bav.Handle, bav.Snapshot, &nftKey.NFTPostHash, nftKey.SerialNumber)
+	dbNFTBidEntries := bav.GetDbAdapter().GetAcceptedNFTBidEntriesByPostHashSerialNumber(
+		&nftKey.NFTPostHash, nftKey.SerialNumber)
 	if dbNFTBidEntries != nil {
 		bav._setAcceptNFTBidHistoryMappings(*nftKey, dbNFTBidEntries)
 		return dbNFTBidEntries
@@ -397,16 +432,7 @@ func (bav *UtxoView) GetNFTBidEntryForNFTBidKey(nftBidKey *NFTBidKey) *NFTBidEnt
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
-	var dbNFTBidEntry *NFTBidEntry
-	if bav.Postgres != nil {
-		bidEntry := bav.Postgres.GetNFTBid(&nftBidKey.NFTPostHash, &nftBidKey.BidderPKID, nftBidKey.SerialNumber)
-		if bidEntry != nil {
-			dbNFTBidEntry = bidEntry.NewNFTBidEntry()
-		}
-	} else {
-		dbNFTBidEntry = DBGetNFTBidEntryForNFTBidKey(bav.Handle, bav.Snapshot, nftBidKey)
-	}
-
+	dbNFTBidEntry := bav.GetDbAdapter().GetNFTBidEntry(nftBidKey)
 	if dbNFTBidEntry != nil {
 		bav._setNFTBidEntryMappings(dbNFTBidEntry)
 	}
@@ -416,15 +442,7 @@ func (bav *UtxoView) GetNFTBidEntryForNFTBidKey(nftBidKey *NFTBidKey) *NFTBidEnt
 
 func (bav *UtxoView) GetAllNFTBidEntries(nftPostHash *BlockHash, serialNumber uint64) []*NFTBidEntry {
 	// Get all the entries in the DB.
-	var dbEntries []*NFTBidEntry
-	if bav.Postgres != nil {
-		bids := bav.Postgres.GetNFTBidsForSerial(nftPostHash, serialNumber)
-		for _, bid := range bids {
-			dbEntries = append(dbEntries, bid.NewNFTBidEntry())
-		}
-	} else {
-		dbEntries = DBGetNFTBidEntries(bav.Handle, nftPostHash, serialNumber)
-	}
+	dbEntries := bav.GetDbAdapter().GetNFTBidEntriesForSerialNumber(nftPostHash, serialNumber)
 
 	// Make sure all of the DB entries are loaded in the view.
 	for _, dbEntry := range dbEntries {
@@ -489,49 +507,59 @@ func (bav *UtxoView) extractAdditionalRoyaltyMap(
 	key string, extraData map[string][]byte, blockHeight uint32) (
 	_additionalRoyaltiesMap map[PKID]uint64, _additionalRoyaltyBasisPoints uint64, _err error) {
 
-	additionalRoyalties := make(map[PKID]uint64)
-	additionalRoyaltiesBasisPoints := uint64(0)
 	if mapBytes, exists := extraData[key]; exists &&
 		blockHeight >= bav.Params.ForkHeights.BuyNowAndNFTSplitsBlockHeight {
 
-		var err error
 		additionalRoyaltiesByPubKey, err := DeserializePubKeyToUint64Map(mapBytes)
 		if err != nil {
 			return nil, 0, errors.Wrap(err,
 				"Problem reading bytes for additional royalties: ")
 		}
-		// Check that public keys are valid and sum basis points
-		for pkBytesIter, bps := range additionalRoyaltiesByPubKey {
-			// Make a copy of the iterator
-			pkBytess := pkBytesIter
+		return bav._getPKIDRoyaltyMapForPubKeyRoyaltyMap(additionalRoyaltiesByPubKey, key == CoinRoyaltiesMapKey)
+	}
+	return make(map[PKID]uint64), 0, nil
+}
 
-			// Validate the public key
-			if _, err = btcec.ParsePubKey(pkBytess[:], btcec.S256()); err != nil {
-				return nil, 0, errors.Wrapf(
-					RuleErrorAdditionalRoyaltyPubKeyMustBeValid,
-					"Error parsing public key: %v, %v", PkToStringBoth(pkBytess[:]), err)
-			}
-			// Set the PKID on the map
-			pkid := bav.GetPKIDForPublicKey(pkBytess[:])
-			additionalRoyalties[*pkid.PKID] = bps
+// _getPKIDRoyaltyMapForPubKeyRoyaltyMap converts a map of public keys to royalty basis points
+// to a map keyed by PKID and sums the basis points. If the royalties are coin royalties, every
+// recipient must have a profile.
+func (bav *UtxoView) _getPKIDRoyaltyMapForPubKeyRoyaltyMap(
+	additionalRoyaltiesByPubKey map[PublicKey]uint64, isCoinRoyalties bool) (
+	_additionalRoyaltiesMap map[PKID]uint64, _additionalRoyaltyBasisPoints uint64, _err error) {
 
-			// Check for overflow when summing the bps
-			if additionalRoyaltiesBasisPoints > math.MaxUint64-bps {
+	additionalRoyalties := make(map[PKID]uint64)
+	additionalRoyaltiesBasisPoints := uint64(0)
+	// Check that public keys are valid and sum basis points
+	for pkBytesIter, bps := range additionalRoyaltiesByPubKey {
+		// Make a copy of the iterator
+		pkBytess := pkBytesIter
+
+		// Validate the public key
+		if _, err := btcec.ParsePubKey(pkBytess[:], btcec.S256()); err != nil {
+			return nil, 0, errors.Wrapf(
+				RuleErrorAdditionalRoyaltyPubKeyMustBeValid,
+				"Error parsing public key: %v, %v", PkToStringBoth(pkBytess[:]), err)
+		}
+		// Set the PKID on the map
+		pkid := bav.GetPKIDForPublicKey(pkBytess[:])
+		additionalRoyalties[*pkid.PKID] = bps
+
+		// Check for overflow when summing the bps
+		if additionalRoyaltiesBasisPoints > math.MaxUint64-bps {
+			return nil, 0, errors.Wrapf(
+				RuleErrorAdditionalCoinRoyaltyOverflow,
+				"additionalRoyaltiesBasisPoints: %v, bps: %v", additionalRoyaltiesBasisPoints, bps)
+		}
+		// Add the bps to our total
+		additionalRoyaltiesBasisPoints += bps
+
+		if isCoinRoyalties {
+			existingProfileEntry := bav.GetProfileEntryForPublicKey(pkBytess[:])
+			if existingProfileEntry == nil || existingProfileEntry.isDeleted {
 				return nil, 0, errors.Wrapf(
-					RuleErrorAdditionalCoinRoyaltyOverflow,
-					"additionalRoyaltiesBasisPoints: %v, bps: %v", additionalRoyaltiesBasisPoints, bps)
-			}
-			// Add the bps to our total
-			additionalRoyaltiesBasisPoints += bps
-
-			if key == CoinRoyaltiesMapKey {
-				existingProfileEntry := bav.GetProfileEntryForPublicKey(pkBytess[:])
-				if existingProfileEntry == nil || existingProfileEntry.isDeleted {
-					return nil, 0, errors.Wrapf(
-						RuleErrorAdditionalCoinRoyaltyMustHaveProfile,
-						"Profile missing for additional Coin NFT royalty pub key: %v",
-						PkToStringBoth(pkBytess[:]))
-				}
+					RuleErrorAdditionalCoinRoyaltyMustHaveProfile,
+					"Profile missing for additional Coin NFT royalty pub key: %v",
+					PkToStringBoth(pkBytess[:]))
 			}
 		}
 	}
@@ -557,6 +585,27 @@ func (bav *UtxoView) _connectCreateNFT(
 		return 0, 0, nil, errors.Wrapf(err, "_connectCreateNFT: ")
 	}
 
+	auctionEndBlockHeight, err := bav._getNFTAuctionExtraData(txn, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCreateNFT: ")
+	}
+	if auctionEndBlockHeight != 0 {
+		if err = ValidateNFTAuction(txMeta.IsForSale, isBuyNow, txMeta.HasUnlockable); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectCreateNFT: ")
+		}
+	}
+
+	buyNowEndPrice, buyNowPriceDecayStartBlockHeight, buyNowPriceDecayEndBlockHeight, buyNowPriceDecayStepBlocks, err :=
+		bav._getNFTDutchAuctionExtraData(txn, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCreateNFT: ")
+	}
+	if buyNowPriceDecayEndBlockHeight != 0 {
+		if err = ValidateNFTDutchAuction(isBuyNow, buyNowPrice, buyNowEndPrice, txMeta.MinBidAmountNanos); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectCreateNFT: ")
+		}
+	}
+
 	// Extract additional DESO royalties
 	additionalDESONFTRoyalties, additionalDESONFTRoyaltiesBasisPoints, err := bav.extractAdditionalRoyaltyMap(
 		DESORoyaltiesMapKey, txn.ExtraData, blockHeight)
@@ -573,6 +622,31 @@ func (bav *UtxoView) _connectCreateNFT(
 			"_connectCreateNFT: Problem extract additional Coin Royalties: ")
 	}
 
+	// If the NFT references a royalty split, the split's recipients are its additional royalties.
+	royaltySplitEntry, err := bav._getRoyaltySplitForExtraData(txn.ExtraData, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCreateNFT: ")
+	}
+	if royaltySplitEntry != nil {
+		if len(additionalDESONFTRoyalties) > 0 || len(additionalCoinNFTRoyalties) > 0 {
+			return 0, 0, nil, errors.Wrapf(RuleErrorRoyaltySplitCombinedWithRoyaltyMaps, "_connectCreateNFT: ")
+		}
+		transactorPKID := bav.GetPKIDForPublicKey(txn.PublicKey)
+		if transactorPKID == nil || transactorPKID.isDeleted || !royaltySplitEntry.CreatorPKID.Eq(transactorPKID.PKID) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorRoyaltySplitNotOwnedByTransactor, "_connectCreateNFT: ")
+		}
+		additionalDESONFTRoyalties = _copyRoyaltyBasisPointsMap(royaltySplitEntry.DESORoyaltiesBasisPoints)
+		additionalCoinNFTRoyalties = _copyRoyaltyBasisPointsMap(royaltySplitEntry.CoinRoyaltiesBasisPoints)
+		additionalDESONFTRoyaltiesBasisPoints = 0
+		for _, bps := range additionalDESONFTRoyalties {
+			additionalDESONFTRoyaltiesBasisPoints += bps
+		}
+		additionalCoinNFTRoyaltiesBasisPoints = 0
+		for _, bps := range additionalCoinNFTRoyalties {
+			additionalCoinNFTRoyaltiesBasisPoints += bps
+		}
+	}
+
 	// Validate the txMeta.
 	if txMeta.NumCopies > bav.GetCurrentGlobalParamsEntry().MaxCopiesPerNFT {
 		return 0, 0, nil, RuleErrorTooManyNFTCopies
@@ -710,6 +784,9 @@ func (bav *UtxoView) _connectCreateNFT(
 	postEntry.NFTRoyaltyToCoinBasisPoints = txMeta.NFTRoyaltyToCoinBasisPoints
 	postEntry.AdditionalNFTRoyaltiesToCreatorsBasisPoints = additionalDESONFTRoyalties
 	postEntry.AdditionalNFTRoyaltiesToCoinsBasisPoints = additionalCoinNFTRoyalties
+	if royaltySplitEntry != nil {
+		postEntry.RoyaltySplitID = royaltySplitEntry.RoyaltySplitID.NewBlockHash()
+	}
 	bav._setPostEntryMappings(postEntry)
 
 	var extraData map[string][]byte
@@ -730,6 +807,13 @@ func (bav *UtxoView) _connectCreateNFT(
 			IsBuyNow:          isBuyNow,
 			BuyNowPriceNanos:  buyNowPrice,
 			ExtraData:         extraData,
+
+			AuctionEndBlockHeight: auctionEndBlockHeight,
+
+			BuyNowEndPriceNanos:              buyNowEndPrice,
+			BuyNowPriceDecayStartBlockHeight: buyNowPriceDecayStartBlockHeight,
+			BuyNowPriceDecayEndBlockHeight:   buyNowPriceDecayEndBlockHeight,
+			BuyNowPriceDecayStepBlocks:       buyNowPriceDecayStepBlocks,
 		}
 		bav._setNFTEntryMappings(nftEntry)
 	}
@@ -773,6 +857,22 @@ func (bav *UtxoView) _connectUpdateNFT(
 		return 0, 0, nil, errors.Wrapf(err, "_connectUpdateNFT: ")
 	}
 
+	auctionEndBlockHeight, err := bav._getNFTAuctionExtraData(txn, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUpdateNFT: ")
+	}
+
+	buyNowEndPrice, buyNowPriceDecayStartBlockHeight, buyNowPriceDecayEndBlockHeight, buyNowPriceDecayStepBlocks, err :=
+		bav._getNFTDutchAuctionExtraData(txn, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUpdateNFT: ")
+	}
+	if buyNowPriceDecayEndBlockHeight != 0 {
+		if err = ValidateNFTDutchAuction(isBuyNow, buyNowPrice, buyNowEndPrice, txMeta.MinBidAmountNanos); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateNFT: ")
+		}
+	}
+
 	// Verify the NFT entry exists.
 	nftKey := MakeNFTKey(txMeta.NFTPostHash, txMeta.SerialNumber)
 	prevNFTEntry := bav.GetNFTEntryForNFTKey(&nftKey)
@@ -785,6 +885,17 @@ func (bav *UtxoView) _connectUpdateNFT(
 		return 0, 0, nil, RuleErrorCannotUpdatePendingNFTTransfer
 	}
 
+	// Verify the NFT is not leased. A leased NFT is never for sale, so this stops it from
+	// being put up for sale until the lease expires.
+	if prevNFTEntry.IsLeaseActive(uint64(blockHeight)) {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTIsLeased, "_connectUpdateNFT: ")
+	}
+
+	// Verify the NFT isn't being auctioned. An auction can't be called off once it's open.
+	if prevNFTEntry.IsAuction() {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTAuctionIsOpen, "_connectUpdateNFT: ")
+	}
+
 	// Get the postEntry so we can update the number of NFT copies for sale.
 	postEntry := bav.GetPostEntryForPostHash(txMeta.NFTPostHash)
 	if postEntry == nil || postEntry.isDeleted {
@@ -802,6 +913,12 @@ func (bav *UtxoView) _connectUpdateNFT(
 		return 0, 0, nil, errors.Wrapf(RuleErrorCannotHaveBuyNowPriceBelowMinBidAmountNanos, "_connectUpdateNFT: ")
 	}
 
+	if auctionEndBlockHeight != 0 {
+		if err = ValidateNFTAuction(txMeta.IsForSale, isBuyNow, postEntry.HasUnlockable); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateNFT: ")
+		}
+	}
+
 	// Verify that the updater is the owner of the NFT.
 	updaterPKID := bav.GetPKIDForPublicKey(txn.PublicKey)
 	if updaterPKID == nil || updaterPKID.isDeleted {
@@ -867,6 +984,13 @@ func (bav *UtxoView) _connectUpdateNFT(
 		// We do this because you're not allowed to update the ExtraData on an
 		// NFTEntry.
 		ExtraData: prevNFTEntry.ExtraData,
+
+		AuctionEndBlockHeight: auctionEndBlockHeight,
+
+		BuyNowEndPriceNanos:              buyNowEndPrice,
+		BuyNowPriceDecayStartBlockHeight: buyNowPriceDecayStartBlockHeight,
+		BuyNowPriceDecayEndBlockHeight:   buyNowPriceDecayEndBlockHeight,
+		BuyNowPriceDecayStepBlocks:       buyNowPriceDecayStepBlocks,
 	}
 	bav._setNFTEntryMappings(newNFTEntry)
 
@@ -950,6 +1074,11 @@ func (bav *UtxoView) _connectAcceptNFTBid(
 		return 0, 0, nil, RuleErrorCannotAcceptBidForPendingNFTTransfer
 	}
 
+	// Auctions are settled automatically when they end, so their bids can't be accepted.
+	if prevNFTEntry.IsAuction() {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTAuctionCannotAcceptBid, "_connectAcceptNFTBid: ")
+	}
+
 	// Verify that the updater is the owner of the NFT.
 	updaterPKID := bav.GetPKIDForPublicKey(txn.PublicKey)
 	if updaterPKID == nil || updaterPKID.isDeleted {
@@ -1039,10 +1168,17 @@ func (bav *UtxoView) _helpConnectNFTSold(args HelpConnectNFTSoldStruct) (
 	// a direct copy is OK.
 	prevCoinEntry := existingProfileEntry.CreatorCoinEntry
 
+	// Get the additional royalties, which come from the NFT's royalty split if it has one.
+	additionalDESORoyaltiesBasisPoints, additionalCoinRoyaltiesBasisPoints, err :=
+		bav.GetNFTAdditionalRoyalties(nftPostEntry)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_helpConnectNFTSold: ")
+	}
+
 	// Additionally save all the other previous coin entries
 	prevAdditionalCoinEntries := make(map[PKID]CoinEntry)
 	profileEntriesMap := make(map[PKID]ProfileEntry)
-	for pkidIter := range nftPostEntry.AdditionalNFTRoyaltiesToCoinsBasisPoints {
+	for pkidIter := range additionalCoinRoyaltiesBasisPoints {
 		pkid := pkidIter
 		pkBytes := bav.GetPublicKeyForPKID(&pkid)
 		existingAdditionalProfileEntry := bav.GetProfileEntryForPublicKey(pkBytes)
@@ -1111,7 +1247,7 @@ func (bav *UtxoView) _helpConnectNFTSold(args HelpConnectNFTSoldStruct) (
 			PkToStringBoth(nftPostEntry.PosterPublicKey))
 	}
 	desoRoyaltiesBalancesBefore := make(map[PKID]uint64)
-	for pkidIter := range nftPostEntry.AdditionalNFTRoyaltiesToCreatorsBasisPoints {
+	for pkidIter := range additionalDESORoyaltiesBasisPoints {
 		pkid := pkidIter
 		pkBytes := bav.GetPublicKeyForPKID(&pkid)
 		balanceBefore, err := bav.GetSpendableDeSoBalanceNanosForPublicKey(pkBytes, tipHeight)
@@ -1317,14 +1453,14 @@ func (bav *UtxoView) _helpConnectNFTSold(args HelpConnectNFTSoldStruct) (
 	}
 
 	additionalDESORoyaltiesNanos, additionalDESORoyalties, err := constructRoyalties(
-		nftPostEntry.AdditionalNFTRoyaltiesToCreatorsBasisPoints)
+		additionalDESORoyaltiesBasisPoints)
 	if err != nil {
 		return 0, 0, nil, errors.Wrapf(err,
 			"_helpConnectNFTSold: Error constructing royalties for additional creator royalties: ")
 	}
 
 	additionalCoinRoyaltyNanos, additionalCoinRoyalties, err := constructRoyalties(
-		nftPostEntry.AdditionalNFTRoyaltiesToCoinsBasisPoints)
+		additionalCoinRoyaltiesBasisPoints)
 	if err != nil {
 		return 0, 0, nil, errors.Wrapf(err,
 			"_helpConnectNFTSold: Error constructing royalties for additional coin royalties: ")
@@ -1398,6 +1534,7 @@ func (bav *UtxoView) _helpConnectNFTSold(args HelpConnectNFTSoldStruct) (
 		deletedBidEntries = append(deletedBidEntries, nftBidEntry)
 		bav._deleteNFTBidEntryMappings(nftBidEntry)
 	}
+	bav._archiveNFTBidEntries(nftKey, args.BlockHeight, deletedBidEntries, args.BidderPKID)
 
 	nftPaymentUtxoKeys := []*UtxoKey{}
 	// This may start negative but that's OK because the first thing we do is increment it
@@ -1730,6 +1867,24 @@ func (bav *UtxoView) _connectNFTBid(
 			return 0, 0, nil, RuleErrorCannotBidForPendingNFTTransfer
 		}
 
+		// If the NFT is being auctioned, verify the auction hasn't closed and that a new bid
+		// beats the highest standing bid. Bids can't be withdrawn after the auction closes.
+		if nftEntry.IsAuction() {
+			if uint64(blockHeight) >= nftEntry.AuctionEndBlockHeight {
+				return 0, 0, nil, errors.Wrapf(RuleErrorNFTBidAfterAuctionClose,
+					"_connectNFTBid: Auction ended at block height %d", nftEntry.AuctionEndBlockHeight)
+			}
+			if txMeta.BidAmountNanos != 0 {
+				for _, bidEntry := range bav.GetAllNFTBidEntries(txMeta.NFTPostHash, txMeta.SerialNumber) {
+					if txMeta.BidAmountNanos <= bidEntry.BidAmountNanos {
+						return 0, 0, nil, errors.Wrapf(RuleErrorNFTAuctionBidTooLow,
+							"_connectNFTBid: Bid of %d nanos doesn't beat standing bid of %d nanos",
+							txMeta.BidAmountNanos, bidEntry.BidAmountNanos)
+					}
+				}
+			}
+		}
+
 		// Verify that the bidder is not the current owner of the NFT.
 		if reflect.DeepEqual(nftEntry.OwnerPKID, bidderPKID.PKID) {
 			return 0, 0, nil, RuleErrorNFTOwnerCannotBidOnOwnedNFT
@@ -1749,8 +1904,9 @@ func (bav *UtxoView) _connectNFTBid(
 		// If the NFT is a Buy Now NFT and the bid amount is greater than the Buy Now Price, we treat this bid as a
 		// a purchase. We also make sure that the Bid Amount is greater than 0. A bid amount of 0 would signify the
 		// cancellation of a previous bid. It is possible to have the Buy Now Price be 0 nanos, but it would require
-		// a bid of at least 1 nano.
-		if nftEntry.IsBuyNow && txMeta.BidAmountNanos >= nftEntry.BuyNowPriceNanos && txMeta.BidAmountNanos > 0 {
+		// a bid of at least 1 nano. If the NFT is a Dutch auction, the Buy Now Price is the price at this block.
+		if nftEntry.IsBuyNow && txMeta.BidAmountNanos >= nftEntry.GetBuyNowPriceNanos(uint64(blockHeight)) &&
+			txMeta.BidAmountNanos > 0 {
 			isBuyNowBid = true
 		}
 	}
@@ -1914,6 +2070,11 @@ func (bav *UtxoView) _connectNFTTransfer(
 		return 0, 0, nil, RuleErrorCannotTransferForSaleNFT
 	}
 
+	// Make sure that the NFT entry is not leased.
+	if prevNFTEntry.IsLeaseActive(uint64(blockHeight)) {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTIsLeased, "_connectNFTTransfer: ")
+	}
+
 	// Sanity check that the NFT entry is correct.
 	if !reflect.DeepEqual(prevNFTEntry.NFTPostHash, txMeta.NFTPostHash) ||
 		!reflect.DeepEqual(prevNFTEntry.SerialNumber, txMeta.SerialNumber) {
@@ -2105,6 +2266,11 @@ func (bav *UtxoView) _connectBurnNFT(
 		return 0, 0, nil, RuleErrorCannotBurnNFTThatIsForSale
 	}
 
+	// Verify that the NFT is not leased.
+	if nftEntry.IsLeaseActive(uint64(blockHeight)) {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTIsLeased, "_connectBurnNFT: ")
+	}
+
 	// Sanity check that the NFT entry is correct.
 	if !reflect.DeepEqual(nftEntry.NFTPostHash, txMeta.NFTPostHash) ||
 		!reflect.DeepEqual(nftEntry.SerialNumber, txMeta.SerialNumber) {
@@ -2369,6 +2535,8 @@ func (bav *UtxoView) _helpDisconnectNFTSold(operationData *UtxoOperation, nftPos
 	for _, nftBid := range operationData.DeletedNFTBidEntries {
 		bav._setNFTBidEntryMappings(nftBid)
 	}
+	bav._unarchiveNFTBidEntries(MakeNFTKey(prevNFTEntry.NFTPostHash, prevNFTEntry.SerialNumber),
+		blockHeight, operationData.DeletedNFTBidEntries)
 
 	// Steps (3)/(4) are skipped for balance model. See note above.
 	if blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight {
@@ -0,0 +1,266 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// An NFT can be put up for sale as an English auction by setting NFTAuctionEndBlockHeightKey
+// in the ExtraData of the CreateNFT or UpdateNFT txn that puts it up for sale. While the
+// auction is open, each new bid must beat the highest standing bid, and the owner can't
+// accept a bid or take the NFT off sale. Bids are rejected once the auction's end height is
+// reached, and when the block at that height is connected the highest bid whose bidder can
+// still pay for it is accepted on the owner's behalf. If there's no such bid, the NFT is
+// taken off sale.
+//
+// Settlement reuses the AcceptNFTBid logic by connecting an unsigned, zero-fee AcceptNFTBid
+// txn from the owner, so royalties are paid exactly as if the owner had accepted the bid.
+// Blanket bids on serial number zero aren't considered when an auction is settled.
+
+// _getNFTAuctionExtraData returns the auction end height set in the txn's ExtraData, or zero
+// if the txn doesn't put the NFT up for auction.
+func (bav *UtxoView) _getNFTAuctionExtraData(txn *MsgDeSoTxn, blockHeight uint32) (
+	_auctionEndBlockHeight uint64, _err error) {
+
+	val, exists := txn.ExtraData[NFTAuctionEndBlockHeightKey]
+	if !exists {
+		return 0, nil
+	}
+	if blockHeight < bav.Params.ForkHeights.NFTAuctionBlockHeight {
+		return 0, errors.Wrapf(RuleErrorNFTAuctionBeforeBlockHeight, "_getNFTAuctionExtraData: ")
+	}
+	auctionEndBlockHeight, bytesRead := Uvarint(val)
+	if bytesRead <= 0 || auctionEndBlockHeight == 0 {
+		return 0, errors.Wrapf(RuleErrorNFTAuctionInvalidEndBlockHeight,
+			"_getNFTAuctionExtraData: Problem reading bytes for AuctionEndBlockHeight")
+	}
+	if auctionEndBlockHeight <= uint64(blockHeight) {
+		return 0, errors.Wrapf(RuleErrorNFTAuctionEndNotInFuture,
+			"_getNFTAuctionExtraData: AuctionEndBlockHeight %d must be after block height %d",
+			auctionEndBlockHeight, blockHeight)
+	}
+	return auctionEndBlockHeight, nil
+}
+
+// ValidateNFTAuction checks that an NFT with the given sale settings can be auctioned. Buy
+// Now NFTs can't be auctioned, and neither can unlockable NFTs since settlement can't
+// encrypt the unlockable text for the winning bidder.
+func ValidateNFTAuction(isForSale bool, isBuyNow bool, hasUnlockable bool) error {
+	if !isForSale {
+		return RuleErrorNFTAuctionNFTNotForSale
+	}
+	if isBuyNow {
+		return RuleErrorNFTAuctionCannotBeBuyNow
+	}
+	if hasUnlockable {
+		return RuleErrorNFTAuctionCannotHaveUnlockable
+	}
+	return nil
+}
+
+// IsAuction returns true if the NFT is for sale as an English auction.
+func (nft *NFTEntry) IsAuction() bool {
+	return nft.AuctionEndBlockHeight != 0
+}
+
+// GetNFTAuctionsEndingAtBlockHeight returns the NFTs whose auctions end at blockHeight,
+// including the auctions in the view, sorted by post hash and serial number.
+func (bav *UtxoView) GetNFTAuctionsEndingAtBlockHeight(blockHeight uint64) ([]*NFTEntry, error) {
+	dbNFTKeys, err := bav.GetDbAdapter().GetNFTKeysForAuctionsEndingAtBlockHeight(blockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetNFTAuctionsEndingAtBlockHeight: ")
+	}
+	// Make sure all of the DB entries are loaded in the view.
+	for ii := range dbNFTKeys {
+		bav.GetNFTEntryForNFTKey(&dbNFTKeys[ii])
+	}
+
+	var nftEntries []*NFTEntry
+	for _, nftEntry := range bav.NFTKeyToNFTEntry {
+		if !nftEntry.isDeleted && nftEntry.AuctionEndBlockHeight == blockHeight {
+			nftEntries = append(nftEntries, nftEntry)
+		}
+	}
+	sort.Slice(nftEntries, func(ii, jj int) bool {
+		nftKeyII := MakeNFTKey(nftEntries[ii].NFTPostHash, nftEntries[ii].SerialNumber)
+		nftKeyJJ := MakeNFTKey(nftEntries[jj].NFTPostHash, nftEntries[jj].SerialNumber)
+		return compareNFTKeys(&nftKeyII, &nftKeyJJ) < 0
+	})
+	return nftEntries, nil
+}
+
+// getNFTAuctionWinningBid returns the highest bid on the NFT that meets its min bid amount
+// and whose bidder can pay for it, or nil if there isn't one. Ties go to the bid that sorts
+// first by BidderPKID.
+func (bav *UtxoView) getNFTAuctionWinningBid(nftEntry *NFTEntry, blockHeight uint64) (*NFTBidEntry, error) {
+	var winningBid *NFTBidEntry
+	for _, bidEntry := range bav.GetAllNFTBidEntries(nftEntry.NFTPostHash, nftEntry.SerialNumber) {
+		if bidEntry.BidAmountNanos < nftEntry.MinBidAmountNanos ||
+			(winningBid != nil && bidEntry.BidAmountNanos <= winningBid.BidAmountNanos) {
+			continue
+		}
+		// We assume the tip is right before the block being connected.
+		spendableBalance, err := bav.GetSpendableDeSoBalanceNanosForPublicKey(
+			bav.GetPublicKeyForPKID(bidEntry.BidderPKID), uint32(blockHeight-1))
+		if err != nil {
+			return nil, errors.Wrapf(err, "getNFTAuctionWinningBid: Problem getting bidder balance: ")
+		}
+		if spendableBalance < bidEntry.BidAmountNanos {
+			continue
+		}
+		winningBid = bidEntry
+	}
+	return winningBid, nil
+}
+
+// makeNFTAuctionSettlementTxn returns the AcceptNFTBid txn that settles an auction on the
+// owner's behalf. It's never signed or broadcast, and it's rebuilt from the NFT's entries
+// when the settlement is disconnected.
+func makeNFTAuctionSettlementTxn(ownerPublicKey []byte, nftPostHash *BlockHash, serialNumber uint64,
+	bidderPKID *PKID, bidAmountNanos uint64) *MsgDeSoTxn {
+
+	return &MsgDeSoTxn{
+		TxnVersion: DeSoTxnVersion0,
+		PublicKey:  ownerPublicKey,
+		TxnMeta: &AcceptNFTBidMetadata{
+			NFTPostHash:    nftPostHash,
+			SerialNumber:   serialNumber,
+			BidderPKID:     bidderPKID,
+			BidAmountNanos: bidAmountNanos,
+		},
+	}
+}
+
+// settleNFTAuctionsInBlock settles the auctions that end at blockHeight. It returns a
+// block-level UtxoOperation that holds the UtxoOperations of each settlement, or nil if no
+// auctions ended.
+func (bav *UtxoView) settleNFTAuctionsInBlock(blockHeight uint64) (*UtxoOperation, error) {
+	nftEntries, err := bav.GetNFTAuctionsEndingAtBlockHeight(blockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "settleNFTAuctionsInBlock: ")
+	}
+	if len(nftEntries) == 0 {
+		return nil, nil
+	}
+
+	var settlementUtxoOps [][]*UtxoOperation
+	for _, nftEntry := range nftEntries {
+		postEntry := bav.GetPostEntryForPostHash(nftEntry.NFTPostHash)
+		if postEntry == nil || postEntry.isDeleted {
+			return nil, fmt.Errorf("settleNFTAuctionsInBlock: non-existent postEntry for NFTPostHash: %v; "+
+				"this should never happen", nftEntry.NFTPostHash)
+		}
+		winningBid, err := bav.getNFTAuctionWinningBid(nftEntry, blockHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "settleNFTAuctionsInBlock: ")
+		}
+
+		// If there's a winning bid, accept it. The new NFTEntry isn't for sale or auctioned.
+		if winningBid != nil {
+			txn := makeNFTAuctionSettlementTxn(bav.GetPublicKeyForPKID(nftEntry.OwnerPKID),
+				nftEntry.NFTPostHash, nftEntry.SerialNumber, winningBid.BidderPKID, winningBid.BidAmountNanos)
+			_, _, utxoOps, err := bav._helpConnectNFTSold(HelpConnectNFTSoldStruct{
+				NFTPostHash:    nftEntry.NFTPostHash,
+				SerialNumber:   nftEntry.SerialNumber,
+				BidderPKID:     winningBid.BidderPKID,
+				BidAmountNanos: winningBid.BidAmountNanos,
+
+				BlockHeight:      uint32(blockHeight),
+				Txn:              txn,
+				TxHash:           txn.Hash(),
+				VerifySignatures: false,
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "settleNFTAuctionsInBlock: Problem settling auction for "+
+					"post hash %v serial number %d: ", nftEntry.NFTPostHash, nftEntry.SerialNumber)
+			}
+			settlementUtxoOps = append(settlementUtxoOps, utxoOps)
+			continue
+		}
+
+		// Otherwise, take the NFT off sale and delete any bids that couldn't be paid.
+		newNFTEntry := *nftEntry
+		newNFTEntry.IsForSale = false
+		newNFTEntry.AuctionEndBlockHeight = 0
+		bav._setNFTEntryMappings(&newNFTEntry)
+
+		var deletedBidEntries []*NFTBidEntry
+		for _, bidEntry := range bav.GetAllNFTBidEntries(nftEntry.NFTPostHash, nftEntry.SerialNumber) {
+			deletedBidEntries = append(deletedBidEntries, bidEntry)
+			bav._deleteNFTBidEntryMappings(bidEntry)
+		}
+
+		prevPostEntry := &PostEntry{}
+		*prevPostEntry = *postEntry
+		postEntry.NumNFTCopiesForSale--
+		bav._setPostEntryMappings(postEntry)
+
+		settlementUtxoOps = append(settlementUtxoOps, []*UtxoOperation{{
+			Type:                 OperationTypeUpdateNFT,
+			PrevNFTEntry:         nftEntry,
+			PrevPostEntry:        prevPostEntry,
+			DeletedNFTBidEntries: deletedBidEntries,
+		}})
+	}
+
+	return &UtxoOperation{
+		Type:                   OperationTypeSettleNFTAuctions,
+		AtomicTxnsInnerUtxoOps: settlementUtxoOps,
+	}, nil
+}
+
+// _disconnectNFTAuctionSettlements reverts the settlements recorded by settleNFTAuctionsInBlock.
+func (bav *UtxoView) _disconnectNFTAuctionSettlements(operationData *UtxoOperation, blockHeight uint32) error {
+	if operationData.Type != OperationTypeSettleNFTAuctions {
+		return fmt.Errorf("_disconnectNFTAuctionSettlements: Trying to revert "+
+			"OperationTypeSettleNFTAuctions but found type %v", operationData.Type)
+	}
+
+	// Disconnect the settlements in reverse.
+	for ii := len(operationData.AtomicTxnsInnerUtxoOps) - 1; ii >= 0; ii-- {
+		utxoOps := operationData.AtomicTxnsInnerUtxoOps[ii]
+		if len(utxoOps) == 0 {
+			return fmt.Errorf("_disconnectNFTAuctionSettlements: utxoOperations are missing for settlement %d", ii)
+		}
+		settlementOp := utxoOps[len(utxoOps)-1]
+		prevNFTEntry := settlementOp.PrevNFTEntry
+		if prevNFTEntry == nil || prevNFTEntry.isDeleted {
+			return fmt.Errorf("_disconnectNFTAuctionSettlements: prev NFT entry doesn't exist for "+
+				"settlement %d; this should never happen", ii)
+		}
+
+		switch settlementOp.Type {
+		case OperationTypeAcceptNFTBid:
+			// The winning bidder owns the NFT now, so its entry holds the accepted bid.
+			nftKey := MakeNFTKey(prevNFTEntry.NFTPostHash, prevNFTEntry.SerialNumber)
+			soldNFTEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+			if soldNFTEntry == nil || soldNFTEntry.isDeleted {
+				return fmt.Errorf("_disconnectNFTAuctionSettlements: NFT entry doesn't exist for "+
+					"settlement %d; this should never happen", ii)
+			}
+			txn := makeNFTAuctionSettlementTxn(bav.GetPublicKeyForPKID(prevNFTEntry.OwnerPKID),
+				prevNFTEntry.NFTPostHash, prevNFTEntry.SerialNumber,
+				soldNFTEntry.OwnerPKID, soldNFTEntry.LastAcceptedBidAmountNanos)
+			if err := bav._disconnectAcceptNFTBid(
+				OperationTypeAcceptNFTBid, txn, txn.Hash(), utxoOps, blockHeight); err != nil {
+				return errors.Wrapf(err, "_disconnectNFTAuctionSettlements: Problem disconnecting settlement %d: ", ii)
+			}
+		case OperationTypeUpdateNFT:
+			bav._setNFTEntryMappings(prevNFTEntry)
+			for _, nftBid := range settlementOp.DeletedNFTBidEntries {
+				bav._setNFTBidEntryMappings(nftBid)
+			}
+			if settlementOp.PrevPostEntry == nil {
+				return fmt.Errorf("_disconnectNFTAuctionSettlements: prev post entry doesn't exist for "+
+					"settlement %d; this should never happen", ii)
+			}
+			bav._setPostEntryMappings(settlementOp.PrevPostEntry)
+		default:
+			return fmt.Errorf("_disconnectNFTAuctionSettlements: found unexpected operation type %v "+
+				"for settlement %d", settlementOp.Type, ii)
+		}
+	}
+	return nil
+}
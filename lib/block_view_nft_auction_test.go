@@ -0,0 +1,312 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTAuctionExtraData(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.NFTLeaseBlockHeight = 0
+	params.ForkHeights.NFTAuctionBlockHeight = 10
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+	bav := &UtxoView{Params: &params}
+
+	newTxn := func(auctionEndBlockHeight []byte) *MsgDeSoTxn {
+		return &MsgDeSoTxn{ExtraData: map[string][]byte{NFTAuctionEndBlockHeightKey: auctionEndBlockHeight}}
+	}
+
+	// A txn without the key doesn't start an auction.
+	auctionEndBlockHeight, err := bav._getNFTAuctionExtraData(&MsgDeSoTxn{}, 5)
+	require.NoError(err)
+	require.Zero(auctionEndBlockHeight)
+
+	auctionEndBlockHeight, err = bav._getNFTAuctionExtraData(newTxn(UintToBuf(100)), 50)
+	require.NoError(err)
+	require.Equal(uint64(100), auctionEndBlockHeight)
+
+	for expectedErr, testCase := range map[RuleError]struct {
+		auctionEndBlockHeight []byte
+		blockHeight           uint32
+	}{
+		RuleErrorNFTAuctionBeforeBlockHeight:     {UintToBuf(100), 5},
+		RuleErrorNFTAuctionInvalidEndBlockHeight: {UintToBuf(0), 50},
+		RuleErrorNFTAuctionEndNotInFuture:        {UintToBuf(50), 50},
+	} {
+		_, err = bav._getNFTAuctionExtraData(newTxn(testCase.auctionEndBlockHeight), testCase.blockHeight)
+		require.Error(err)
+		require.Contains(err.Error(), string(expectedErr))
+	}
+
+	require.NoError(ValidateNFTAuction(true, false, false))
+	require.Equal(RuleErrorNFTAuctionNFTNotForSale, ValidateNFTAuction(false, false, false))
+	require.Equal(RuleErrorNFTAuctionCannotBeBuyNow, ValidateNFTAuction(true, true, false))
+	require.Equal(RuleErrorNFTAuctionCannotHaveUnlockable, ValidateNFTAuction(true, false, true))
+
+	// The auction end height is encoded once the migration is triggered.
+	nftEntry := &NFTEntry{
+		OwnerPKID:             NewPKID(m0PkBytes),
+		NFTPostHash:           NewBlockHash(RandomBytes(HashSizeBytes)),
+		SerialNumber:          1,
+		IsForSale:             true,
+		AuctionEndBlockHeight: 100,
+	}
+	require.True(nftEntry.IsAuction())
+	decodedEntry, err := DecodeDeSoEncoder(&NFTEntry{}, bytes.NewReader(EncodeToBytes(10, nftEntry)))
+	require.NoError(err)
+	require.Equal(uint64(100), decodedEntry.AuctionEndBlockHeight)
+	decodedEntry, err = DecodeDeSoEncoder(&NFTEntry{}, bytes.NewReader(EncodeToBytes(5, nftEntry)))
+	require.NoError(err)
+	require.False(decodedEntry.IsAuction())
+}
+
+func TestNFTAuctionSettlement(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(100)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(m4PkBytes)] = true
+	params.ForkHeights.BrokenNFTBidsFixBlockHeight = uint32(0)
+	params.ForkHeights.BuyNowAndNFTSplitsBlockHeight = uint32(0)
+	params.ForkHeights.NFTAuctionBlockHeight = uint32(0)
+	// The settlements' utxo ops are stored in AtomicTxnsInnerUtxoOps, which are only encoded
+	// once the PoS state setup migration is triggered.
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = uint32(1)
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 4; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m0Pub, senderPrivString, 1e5)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m1Pub, senderPrivString, 1e5)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m2Pub, senderPrivString, 1e5)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m3Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m4Pub, senderPrivString, 100)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+
+	// Set max copies to a non-zero value to activate NFTs. The fee buckets need a minimum
+	// network fee once the PoS state setup fork is active.
+	_updateGlobalParamsEntryWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m4Pub,
+		m4Priv,
+		-1,                       /*USDCentsPerBitcoinExchangeRate*/
+		int64(feeRateNanosPerKB), /*minimumNetworkFeeNanosPerKb*/
+		-1,                       /*createProfileFeeNanos*/
+		-1,                       /*createNFTFeeNanos*/
+		1000,                     /*maxCopiesPerNFT*/
+	)
+
+	// m0 auctions two copies of a post, with a 10% creator royalty, a 5% coin royalty, and a
+	// 2% royalty to m3. The auction ends two blocks after the block the bids are connected at.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,         /*updaterPkBase58Check*/
+		m0Priv,        /*updaterPrivBase58Check*/
+		[]byte{},      /*profilePubKey*/
+		"m0",          /*newUsername*/
+		"i am the m0", /*newDescription*/
+		shortPic,      /*newProfilePic*/
+		10*100,        /*newCreatorBasisPoints*/
+		1.25*100*100,  /*newStakeMultipleBasisPoints*/
+		false /*isHidden*/)
+	// m1 buys some of m0's coin so that the coin royalty isn't burned.
+	_creatorCoinTxnWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m1Pub,  /*updaterPkBase58Check*/
+		m1Priv, /*updaterPrivBase58Check*/
+		m0Pub,  /*profilePubKeyBase58Check*/
+		CreatorCoinOperationTypeBuy,
+		1000, /*DeSoToSellNanos*/
+		0,    /*CreatorCoinToSellNanos*/
+		0,    /*DeSoToAddNanos*/
+		0,    /*MinDeSoExpectedNanos*/
+		0,    /*MinCreatorCoinExpectedNanos*/
+	)
+	_submitPostWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,                              /*updaterPkBase58Check*/
+		m0Priv,                             /*updaterPrivBase58Check*/
+		[]byte{},                           /*postHashToModify*/
+		[]byte{},                           /*parentStakeID*/
+		&DeSoBodySchema{Body: "m0 post 1"}, /*body*/
+		[]byte{},
+		1502947011*1e9, /*tstampNanos*/
+		false /*isHidden*/)
+	postHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	auctionEndBlockHeight := uint64(chain.blockTip().Height) + 3
+	_createNFTWithAdditionalRoyaltiesAndExtraDataWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,    /*updaterPkBase58Check*/
+		m0Priv,   /*updaterPrivBase58Check*/
+		postHash, /*postHashToModify*/
+		2,        /*numCopies*/
+		false,    /*hasUnlockable*/
+		true,     /*isForSale*/
+		1000,     /*minBidAmountNanos*/
+		0,        /*nftFee*/
+		10*100,   /*nftRoyaltyToCreatorBasisPoints*/
+		5*100,    /*nftRoyaltyToCoinBasisPoints*/
+		false,    /*isBuyNow*/
+		0,        /*buyNowPriceNanos*/
+		map[PublicKey]uint64{*NewPublicKey(m3PkBytes): 2 * 100},
+		nil,
+		map[string][]byte{NFTAuctionEndBlockHeightKey: UintToBuf(auctionEndBlockHeight)},
+	)
+
+	// m1 and then m2 bid on serial #1. Each bid has to beat the highest standing bid.
+	_createNFTBidWithTestMeta(testMeta, feeRateNanosPerKB, m1Pub, m1Priv, postHash, 1, 2000)
+	_createNFTBidWithTestMeta(testMeta, feeRateNanosPerKB, m2Pub, m2Priv, postHash, 1, 10000)
+	_, _, _, err := _createNFTBid(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv, postHash, 1, 5000)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTAuctionBidTooLow)
+
+	// The owner can't accept a bid on an open auction.
+	_, _, _, err = _acceptNFTBid(t, chain, db, params, feeRateNanosPerKB, m0Pub, m0Priv, postHash, 1, m2Pub, 10000, "")
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTAuctionCannotAcceptBid)
+
+	// Nothing is settled before the auction ends.
+	for uint64(chain.blockTip().Height)+1 < auctionEndBlockHeight {
+		_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	for _, nftEntry := range DBGetNFTEntriesForPostHash(db, postHash) {
+		require.Equal(m0PKID, nftEntry.OwnerPKID)
+		require.True(nftEntry.IsForSale)
+		require.Equal(auctionEndBlockHeight, nftEntry.AuctionEndBlockHeight)
+	}
+
+	// Bids are rejected once the auction ends, including in the block that ends it.
+	_, _, _, err = _createNFTBid(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv, postHash, 2, 2000)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTBidAfterAuctionClose)
+
+	type auctionState struct {
+		nftEntries          []*NFTEntry
+		bidEntries          [][]*NFTBidEntry
+		balances            []uint64
+		coinDeSoLockedNanos uint64
+		numNFTCopiesForSale uint64
+	}
+	getAuctionState := func() *auctionState {
+		state := &auctionState{
+			nftEntries: DBGetNFTEntriesForPostHash(db, postHash),
+			bidEntries: [][]*NFTBidEntry{
+				DBGetNFTBidEntries(db, postHash, 1), DBGetNFTBidEntries(db, postHash, 2),
+			},
+			coinDeSoLockedNanos: DBGetProfileEntryForPKID(db, chain.snapshot, m0PKID).CreatorCoinEntry.DeSoLockedNanos,
+			numNFTCopiesForSale: DBGetPostEntryByPostHash(db, chain.snapshot, postHash).NumNFTCopiesForSale,
+		}
+		for _, publicKey := range []string{m0Pub, m1Pub, m2Pub, m3Pub} {
+			state.balances = append(state.balances, _getBalance(t, chain, nil, publicKey))
+		}
+		return state
+	}
+	stateBeforeSettlement := getAuctionState()
+	require.Len(stateBeforeSettlement.bidEntries[0], 2)
+	require.Empty(stateBeforeSettlement.bidEntries[1])
+	require.Equal(uint64(2), stateBeforeSettlement.numNFTCopiesForSale)
+
+	// Mine the block that ends the auction.
+	block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	require.Equal(auctionEndBlockHeight, block.Header.Height)
+
+	// m2's highest bid wins serial #1, and the NFT's other bids are deleted.
+	stateAfterSettlement := getAuctionState()
+	soldNFTEntry := stateAfterSettlement.nftEntries[0]
+	require.Equal(uint64(1), soldNFTEntry.SerialNumber)
+	require.Equal(m2PKID, soldNFTEntry.OwnerPKID)
+	require.False(soldNFTEntry.IsForSale)
+	require.False(soldNFTEntry.IsAuction())
+	require.Equal(uint64(10000), soldNFTEntry.LastAcceptedBidAmountNanos)
+	require.Empty(stateAfterSettlement.bidEntries[0])
+
+	// Serial #2 had no bids, so m0 keeps it and it's taken off sale.
+	unsoldNFTEntry := stateAfterSettlement.nftEntries[1]
+	require.Equal(uint64(2), unsoldNFTEntry.SerialNumber)
+	require.Equal(m0PKID, unsoldNFTEntry.OwnerPKID)
+	require.False(unsoldNFTEntry.IsForSale)
+	require.False(unsoldNFTEntry.IsAuction())
+	require.Zero(stateAfterSettlement.numNFTCopiesForSale)
+
+	// m2 pays its bid without a fee. m0 gets the creator royalty of 1000 nanos and the
+	// remaining 8300 nanos as the owner, 500 nanos go to m0's coin, and 200 nanos go to m3.
+	require.Equal(stateBeforeSettlement.balances[0]+9300, stateAfterSettlement.balances[0])
+	require.Equal(stateBeforeSettlement.balances[1], stateAfterSettlement.balances[1])
+	require.Equal(stateBeforeSettlement.balances[2]-10000, stateAfterSettlement.balances[2])
+	require.Equal(stateBeforeSettlement.balances[3]+200, stateAfterSettlement.balances[3])
+	require.Equal(stateBeforeSettlement.coinDeSoLockedNanos+500, stateAfterSettlement.coinDeSoLockedNanos)
+
+	// The settlements are recorded in the block-level utxo ops.
+	blockHash, err := block.Header.Hash()
+	require.NoError(err)
+	utxoOps, err := GetUtxoOperationsForBlock(db, chain.snapshot, blockHash)
+	require.NoError(err)
+	require.Len(utxoOps, len(block.Txns)+1)
+	var settlementUtxoOp *UtxoOperation
+	for _, utxoOp := range utxoOps[len(utxoOps)-1] {
+		if utxoOp.Type == OperationTypeSettleNFTAuctions {
+			settlementUtxoOp = utxoOp
+		}
+	}
+	require.NotNil(settlementUtxoOp)
+	require.Len(settlementUtxoOp.AtomicTxnsInnerUtxoOps, 2)
+	acceptUtxoOps := settlementUtxoOp.AtomicTxnsInnerUtxoOps[0]
+	acceptUtxoOp := acceptUtxoOps[len(acceptUtxoOps)-1]
+	require.Equal(OperationTypeAcceptNFTBid, acceptUtxoOp.Type)
+	require.Equal(uint64(500), acceptUtxoOp.AcceptNFTBidCreatorRoyaltyNanos)
+	require.Equal(uint64(1000), acceptUtxoOp.AcceptNFTBidCreatorDESORoyaltyNanos)
+	require.Equal(OperationTypeUpdateNFT, settlementUtxoOp.AtomicTxnsInnerUtxoOps[1][0].Type)
+
+	// Disconnecting the block puts the owners, balances, and bids back exactly.
+	txHashes, err := ComputeTransactionHashes(block.Txns)
+	require.NoError(err)
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	require.NoError(utxoView.DisconnectBlock(block, txHashes, utxoOps, block.Header.Height))
+	require.NoError(utxoView.FlushToDb(block.Header.Height))
+	require.Equal(stateBeforeSettlement, getAuctionState())
+}
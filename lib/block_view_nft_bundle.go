@@ -0,0 +1,888 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_view_nft_bundle.go implements NFT bundles. An NFT owner lists several of their NFT
+// serials, each with its own price, as a bundle with an NFTBundle txn, and any other user can
+// then buy the whole bundle for the sum of the prices with another NFTBundle txn. The seller
+// can cancel the listing until it's bought.
+//
+// A listing doesn't lock up its NFTs. The seller keeps them for sale individually, so they can
+// still be bid on, sold, or taken off sale while the bundle is listed. When the bundle is
+// bought, every NFT in it is checked again, and if any of them can no longer be sold by the
+// seller the txn fails and none of them change hands.
+//
+// Each NFT in a bought bundle is sold at its price exactly as if the seller had accepted a bid
+// from the buyer for that amount, so the creator royalties, coin royalties, and any additional
+// royalties of each NFT are paid from its own price.
+
+// MaxNFTBundleItems is the largest number of NFT serials that can be listed in one bundle.
+const MaxNFTBundleItems = 100
+
+//
+// TYPES: NFTBundleItem
+//
+
+type NFTBundleItem struct {
+	NFTPostHash  *BlockHash
+	SerialNumber uint64
+	// PriceNanos is the part of the bundle's price that's paid for this NFT.
+	PriceNanos uint64
+}
+
+func (item *NFTBundleItem) Copy() *NFTBundleItem {
+	return &NFTBundleItem{
+		NFTPostHash:  item.NFTPostHash.NewBlockHash(),
+		SerialNumber: item.SerialNumber,
+		PriceNanos:   item.PriceNanos,
+	}
+}
+
+func (item *NFTBundleItem) ToBytes() ([]byte, error) {
+	if len(item.NFTPostHash) != HashSizeBytes {
+		return nil, fmt.Errorf("NFTBundleItem.ToBytes: NFTPostHash "+
+			"has length %d != %d", len(item.NFTPostHash), HashSizeBytes)
+	}
+
+	var data []byte
+	data = append(data, item.NFTPostHash[:]...)
+	data = append(data, UintToBuf(item.SerialNumber)...)
+	data = append(data, UintToBuf(item.PriceNanos)...)
+	return data, nil
+}
+
+func (item *NFTBundleItem) FromBytes(rr *bytes.Reader) error {
+	var err error
+
+	item.NFTPostHash = &BlockHash{}
+	if _, err = io.ReadFull(rr, item.NFTPostHash[:]); err != nil {
+		return errors.Wrapf(err, "NFTBundleItem.FromBytes: Problem reading NFTPostHash: ")
+	}
+	if item.SerialNumber, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTBundleItem.FromBytes: Problem reading SerialNumber: ")
+	}
+	if item.PriceNanos, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTBundleItem.FromBytes: Problem reading PriceNanos: ")
+	}
+	return nil
+}
+
+func _encodeNFTBundleItems(items []*NFTBundleItem) ([]byte, error) {
+	data := UintToBuf(uint64(len(items)))
+	for _, item := range items {
+		itemBytes, err := item.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, itemBytes...)
+	}
+	return data, nil
+}
+
+func _decodeNFTBundleItems(rr *bytes.Reader) ([]*NFTBundleItem, error) {
+	numItems, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_decodeNFTBundleItems: Problem reading number of items: ")
+	}
+	if numItems > MaxNFTBundleItems {
+		return nil, errors.Wrapf(RuleErrorNFTBundleTooManyItems, "_decodeNFTBundleItems: %d items", numItems)
+	}
+	var items []*NFTBundleItem
+	for ii := uint64(0); ii < numItems; ii++ {
+		item := &NFTBundleItem{}
+		if err = item.FromBytes(rr); err != nil {
+			return nil, errors.Wrapf(err, "_decodeNFTBundleItems: Problem reading item %d: ", ii)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+//
+// TYPES: NFTBundleEntry
+//
+
+type NFTBundleEntry struct {
+	// BundleID is the hash of the txn that listed the bundle.
+	BundleID   *BlockHash
+	SellerPKID *PKID
+	Items      []*NFTBundleItem
+
+	isDeleted bool
+}
+
+func (entry *NFTBundleEntry) Copy() *NFTBundleEntry {
+	items := make([]*NFTBundleItem, 0, len(entry.Items))
+	for _, item := range entry.Items {
+		items = append(items, item.Copy())
+	}
+	return &NFTBundleEntry{
+		BundleID:   entry.BundleID.NewBlockHash(),
+		SellerPKID: entry.SellerPKID.NewPKID(),
+		Items:      items,
+		isDeleted:  entry.isDeleted,
+	}
+}
+
+// GetTotalPriceNanos returns the price of the whole bundle. The sum is checked for overflow
+// when the bundle is listed.
+func (entry *NFTBundleEntry) GetTotalPriceNanos() uint64 {
+	totalPriceNanos := uint64(0)
+	for _, item := range entry.Items {
+		totalPriceNanos += item.PriceNanos
+	}
+	return totalPriceNanos
+}
+
+func (entry *NFTBundleEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.BundleID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.SellerPKID, skipMetadata...)...)
+	// The items were validated when the bundle was listed, so they always encode.
+	itemsBytes, err := _encodeNFTBundleItems(entry.Items)
+	if err != nil {
+		glog.Errorf("NFTBundleEntry.Encode: Problem encoding items: %v", err)
+	}
+	data = append(data, itemsBytes...)
+	return data
+}
+
+func (entry *NFTBundleEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// BundleID
+	entry.BundleID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTBundleEntry.Decode: Problem reading BundleID: ")
+	}
+
+	// SellerPKID
+	entry.SellerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTBundleEntry.Decode: Problem reading SellerPKID: ")
+	}
+
+	// Items
+	entry.Items, err = _decodeNFTBundleItems(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTBundleEntry.Decode: Problem reading Items: ")
+	}
+
+	return nil
+}
+
+func (entry *NFTBundleEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *NFTBundleEntry) GetEncoderType() EncoderType {
+	return EncoderTypeNFTBundleEntry
+}
+
+//
+// TYPES: NFTBundleMetadata
+//
+
+type NFTBundleOperationType uint8
+
+const (
+	// NFTBundleOperationTypeList lists the transactor's NFTs in Items as a new bundle.
+	NFTBundleOperationTypeList NFTBundleOperationType = 0
+	// NFTBundleOperationTypeCancel removes the transactor's listing with BundleID.
+	NFTBundleOperationTypeCancel NFTBundleOperationType = 1
+	// NFTBundleOperationTypeBuy buys the bundle with BundleID for TotalPriceNanos.
+	NFTBundleOperationTypeBuy NFTBundleOperationType = 2
+)
+
+type NFTBundleMetadata struct {
+	OperationType NFTBundleOperationType
+	// BundleID is the bundle being canceled or bought. It's unset when listing a bundle.
+	BundleID *BlockHash
+	// Items are the NFTs being listed. They're unset when canceling or buying a bundle.
+	Items []*NFTBundleItem
+	// TotalPriceNanos is the price the buyer agrees to pay, which must match the listing.
+	// It's zero when listing or canceling a bundle.
+	TotalPriceNanos uint64
+}
+
+func (txnData *NFTBundleMetadata) GetTxnType() TxnType {
+	return TxnTypeNFTBundle
+}
+
+func (txnData *NFTBundleMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, byte(txnData.OperationType))
+	if txnData.BundleID != nil {
+		data = append(data, BoolToByte(true))
+		data = append(data, txnData.BundleID[:]...)
+	} else {
+		data = append(data, BoolToByte(false))
+	}
+	itemsBytes, err := _encodeNFTBundleItems(txnData.Items)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NFTBundleMetadata.ToBytes: ")
+	}
+	data = append(data, itemsBytes...)
+	data = append(data, UintToBuf(txnData.TotalPriceNanos)...)
+	return data, nil
+}
+
+func (txnData *NFTBundleMetadata) FromBytes(data []byte) error {
+	ret := NFTBundleMetadata{}
+	rr := bytes.NewReader(data)
+	var err error
+
+	operationType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "NFTBundleMetadata.FromBytes: Problem reading OperationType: ")
+	}
+	ret.OperationType = NFTBundleOperationType(operationType)
+
+	hasBundleID, err := ReadBoolByte(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTBundleMetadata.FromBytes: Problem reading BundleID: ")
+	}
+	if hasBundleID {
+		ret.BundleID = &BlockHash{}
+		if _, err = io.ReadFull(rr, ret.BundleID[:]); err != nil {
+			return errors.Wrapf(err, "NFTBundleMetadata.FromBytes: Problem reading BundleID: ")
+		}
+	}
+	if ret.Items, err = _decodeNFTBundleItems(rr); err != nil {
+		return errors.Wrapf(err, "NFTBundleMetadata.FromBytes: Problem reading Items: ")
+	}
+	if ret.TotalPriceNanos, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTBundleMetadata.FromBytes: Problem reading TotalPriceNanos: ")
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *NFTBundleMetadata) New() DeSoTxnMetadata {
+	return &NFTBundleMetadata{}
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForNFTBundleEntry(bundleID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixNFTBundleByID...)
+	key = append(key, bundleID[:]...)
+	return key
+}
+
+func DBKeyForNFTBundleBySeller(sellerPKID *PKID, bundleID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixNFTBundleIDBySellerPKID...)
+	key = append(key, sellerPKID.ToBytes()...)
+	key = append(key, bundleID[:]...)
+	return key
+}
+
+func DBGetNFTBundleEntry(handle *badger.DB, snap *Snapshot, bundleID *BlockHash) (*NFTBundleEntry, error) {
+	var ret *NFTBundleEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetNFTBundleEntryWithTxn(txn, snap, bundleID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetNFTBundleEntryWithTxn(txn *badger.Txn, snap *Snapshot, bundleID *BlockHash) (*NFTBundleEntry, error) {
+	// Retrieve NFTBundleEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForNFTBundleEntry(bundleID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetNFTBundleEntry: problem retrieving NFTBundleEntry: ")
+	}
+
+	// Decode NFTBundleEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&NFTBundleEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetNFTBundleEntry: problem decoding NFTBundleEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetNFTBundleEntriesForSeller returns the NFT bundles the seller has listed.
+func DBGetNFTBundleEntriesForSeller(handle *badger.DB, snap *Snapshot, sellerPKID *PKID) ([]*NFTBundleEntry, error) {
+	prefix := append([]byte{}, Prefixes.PrefixNFTBundleIDBySellerPKID...)
+	prefix = append(prefix, sellerPKID.ToBytes()...)
+	keysFound, _ := EnumerateKeysForPrefix(handle, prefix, true)
+
+	var entries []*NFTBundleEntry
+	for _, key := range keysFound {
+		if len(key) != len(prefix)+HashSizeBytes {
+			return nil, fmt.Errorf("DBGetNFTBundleEntriesForSeller: invalid index key length %d", len(key))
+		}
+		bundleID := NewBlockHash(key[len(prefix):])
+		entry, err := DBGetNFTBundleEntry(handle, snap, bundleID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetNFTBundleEntriesForSeller: ")
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("DBGetNFTBundleEntriesForSeller: NFT bundle %v is indexed but "+
+				"doesn't exist", bundleID)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutNFTBundleEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *NFTBundleEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForNFTBundleEntry(entry.BundleID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutNFTBundleEntryWithTxn: problem storing NFTBundleEntry: ")
+	}
+	indexKey := DBKeyForNFTBundleBySeller(entry.SellerPKID, entry.BundleID)
+	if err := DBSetWithTxn(txn, snap, indexKey, []byte{}, eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutNFTBundleEntryWithTxn: problem storing NFT bundle index: ")
+	}
+	return nil
+}
+
+func DBDeleteNFTBundleEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *NFTBundleEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForNFTBundleEntry(entry.BundleID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteNFTBundleEntryWithTxn: problem deleting NFTBundleEntry: ")
+	}
+	indexKey := DBKeyForNFTBundleBySeller(entry.SellerPKID, entry.BundleID)
+	if err := DBDeleteWithTxn(txn, snap, indexKey, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteNFTBundleEntryWithTxn: problem deleting NFT bundle index: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetNFTBundleEntry returns the NFT bundle, or nil if it isn't listed.
+func (bav *UtxoView) GetNFTBundleEntry(bundleID *BlockHash) (*NFTBundleEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.NFTBundleIDToNFTBundleEntry[*bundleID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetNFTBundleEntry(bundleID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetNFTBundleEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the NFTBundleEntry from the db in the UtxoView.
+		bav._setNFTBundleEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetNFTBundleEntriesForSeller returns the NFT bundles the seller has listed, including the
+// bundles in the view.
+func (bav *UtxoView) GetNFTBundleEntriesForSeller(sellerPKID *PKID) ([]*NFTBundleEntry, error) {
+	dbEntries, err := bav.GetDbAdapter().GetNFTBundleEntriesForSeller(sellerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetNFTBundleEntriesForSeller: ")
+	}
+	for _, dbEntry := range dbEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		if _, exists := bav.NFTBundleIDToNFTBundleEntry[*dbEntry.BundleID]; !exists {
+			bav._setNFTBundleEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*NFTBundleEntry
+	for _, entry := range bav.NFTBundleIDToNFTBundleEntry {
+		if !entry.isDeleted && entry.SellerPKID.Eq(sellerPKID) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (bav *UtxoView) _setNFTBundleEntryMappings(entry *NFTBundleEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setNFTBundleEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.NFTBundleIDToNFTBundleEntry[*entry.BundleID] = entry
+}
+
+func (bav *UtxoView) _deleteNFTBundleEntryMappings(entry *NFTBundleEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteNFTBundleEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setNFTBundleEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushNFTBundleEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Delete every bundle in the view first, since a bundle's index has to be removed along
+	// with it. The bundles that aren't deleted are put back below.
+	for mapKeyIter, entryIter := range bav.NFTBundleIDToNFTBundleEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.BundleID.IsEqual(&mapKey) {
+			return fmt.Errorf("_flushNFTBundleEntriesToDbWithTxn: NFTBundleEntry BundleID %v "+
+				"doesn't match MapKey %v", entry.BundleID, &mapKey)
+		}
+
+		if err := DBDeleteNFTBundleEntryWithTxn(
+			txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+		); err != nil {
+			return errors.Wrapf(err, "_flushNFTBundleEntriesToDbWithTxn: ")
+		}
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutNFTBundleEntryWithTxn(
+			txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushNFTBundleEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
+
+// _validateNFTBundleItem checks that the seller can sell the NFT in a bundle at blockHeight.
+// The NFT has to be for sale, and it can't be changing hands or held by anyone else in the
+// meantime. NFTs with unlockable content can't be bundled, since the seller has to encrypt
+// the content for the buyer when each of them is sold.
+func (bav *UtxoView) _validateNFTBundleItem(
+	item *NFTBundleItem, sellerPKID *PKID, blockHeight uint32) error {
+
+	nftKey := MakeNFTKey(item.NFTPostHash, item.SerialNumber)
+	nftEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+	if nftEntry == nil || nftEntry.isDeleted {
+		return RuleErrorNFTBundleNonExistentNFT
+	}
+	if !nftEntry.OwnerPKID.Eq(sellerPKID) {
+		return RuleErrorNFTBundleNFTNotOwnedBySeller
+	}
+	if !nftEntry.IsForSale {
+		return RuleErrorNFTBundleNFTNotForSale
+	}
+	if nftEntry.IsPending {
+		return RuleErrorNFTBundleNFTIsPending
+	}
+	if nftEntry.IsLeaseActive(uint64(blockHeight)) {
+		return RuleErrorNFTBundleNFTIsLeased
+	}
+	if nftEntry.IsAuction() {
+		return RuleErrorNFTBundleNFTIsAuction
+	}
+	postEntry := bav.GetPostEntryForPostHash(item.NFTPostHash)
+	if postEntry == nil || postEntry.isDeleted {
+		return RuleErrorNFTBundleNonExistentNFT
+	}
+	if postEntry.HasUnlockable {
+		return RuleErrorNFTBundleNFTHasUnlockable
+	}
+	return nil
+}
+
+// makeNFTBundleSaleTxn returns the AcceptNFTBid txn that sells one NFT in a bundle on the
+// seller's behalf. It's never signed or broadcast, and it's rebuilt from the NFT's entries
+// when the sale is disconnected.
+func makeNFTBundleSaleTxn(sellerPublicKey []byte, nftPostHash *BlockHash, serialNumber uint64,
+	buyerPKID *PKID, priceNanos uint64) *MsgDeSoTxn {
+
+	return &MsgDeSoTxn{
+		TxnVersion: DeSoTxnVersion0,
+		PublicKey:  sellerPublicKey,
+		TxnMeta: &AcceptNFTBidMetadata{
+			NFTPostHash:    nftPostHash,
+			SerialNumber:   serialNumber,
+			BidderPKID:     buyerPKID,
+			BidAmountNanos: priceNanos,
+		},
+	}
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectNFTBundle(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.NFTBundleBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTBundleBeforeBlockHeight, "_connectNFTBundle: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeNFTBundle {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectNFTBundle: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*NFTBundleMetadata)
+
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectNFTBundle: PKID for transactor %v not found",
+			PkToStringBoth(txn.PublicKey))
+	}
+	transactorPKID := transactorPKIDEntry.PKID
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectNFTBundle: ")
+	}
+
+	switch txMeta.OperationType {
+	case NFTBundleOperationTypeList:
+		if err = bav._connectListNFTBundle(txMeta, txHash, transactorPKID, blockHeight); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTBundle: ")
+		}
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type: OperationTypeNFTBundle,
+		})
+
+	case NFTBundleOperationTypeCancel:
+		bundleEntry, err := bav._getNFTBundleEntryForTxn(txMeta)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTBundle: ")
+		}
+		if !bundleEntry.SellerPKID.Eq(transactorPKID) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorNFTBundleCancelByNonSeller, "_connectNFTBundle: ")
+		}
+		prevBundleEntry := bundleEntry.Copy()
+		bav._deleteNFTBundleEntryMappings(bundleEntry)
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type:               OperationTypeNFTBundle,
+			PrevNFTBundleEntry: prevBundleEntry,
+		})
+
+	case NFTBundleOperationTypeBuy:
+		bundleEntry, err := bav._getNFTBundleEntryForTxn(txMeta)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTBundle: ")
+		}
+		prevBundleEntry := bundleEntry.Copy()
+		saleUtxoOps, replacedBidEntries, err := bav._connectBuyNFTBundle(
+			txn, txMeta, bundleEntry, transactorPKID, blockHeight)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTBundle: ")
+		}
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type:                   OperationTypeNFTBundle,
+			PrevNFTBundleEntry:     prevBundleEntry,
+			DeletedNFTBidEntries:   replacedBidEntries,
+			AtomicTxnsInnerUtxoOps: saleUtxoOps,
+		})
+
+	default:
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTBundleInvalidOperationType,
+			"_connectNFTBundle: %d", txMeta.OperationType)
+	}
+
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+// _getNFTBundleEntryForTxn returns the listed bundle that a Cancel or Buy txn refers to.
+func (bav *UtxoView) _getNFTBundleEntryForTxn(txMeta *NFTBundleMetadata) (*NFTBundleEntry, error) {
+	if txMeta.BundleID == nil {
+		return nil, errors.Wrapf(RuleErrorNFTBundleNotFound, "_getNFTBundleEntryForTxn: BundleID is unset")
+	}
+	bundleEntry, err := bav.GetNFTBundleEntry(txMeta.BundleID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getNFTBundleEntryForTxn: ")
+	}
+	if bundleEntry == nil {
+		return nil, errors.Wrapf(RuleErrorNFTBundleNotFound, "_getNFTBundleEntryForTxn: %v", txMeta.BundleID)
+	}
+	return bundleEntry, nil
+}
+
+// _connectListNFTBundle validates the NFTs being listed and creates a bundle with the txn's
+// hash as its BundleID.
+func (bav *UtxoView) _connectListNFTBundle(
+	txMeta *NFTBundleMetadata, txHash *BlockHash, sellerPKID *PKID, blockHeight uint32) error {
+
+	if len(txMeta.Items) == 0 {
+		return RuleErrorNFTBundleNoItems
+	}
+	if len(txMeta.Items) > MaxNFTBundleItems {
+		return errors.Wrapf(RuleErrorNFTBundleTooManyItems, "_connectListNFTBundle: %d items", len(txMeta.Items))
+	}
+
+	totalPriceNanos := uint64(0)
+	nftKeys := make(map[NFTKey]bool, len(txMeta.Items))
+	for ii, item := range txMeta.Items {
+		nftKey := MakeNFTKey(item.NFTPostHash, item.SerialNumber)
+		if nftKeys[nftKey] {
+			return errors.Wrapf(RuleErrorNFTBundleDuplicateItem, "_connectListNFTBundle: item %d", ii)
+		}
+		nftKeys[nftKey] = true
+
+		if item.PriceNanos == 0 {
+			return errors.Wrapf(RuleErrorNFTBundleZeroItemPrice, "_connectListNFTBundle: item %d", ii)
+		}
+		if totalPriceNanos > math.MaxUint64-item.PriceNanos {
+			return RuleErrorNFTBundlePriceOverflow
+		}
+		totalPriceNanos += item.PriceNanos
+
+		if err := bav._validateNFTBundleItem(item, sellerPKID, blockHeight); err != nil {
+			return errors.Wrapf(err, "_connectListNFTBundle: post hash %v serial number %d: ",
+				item.NFTPostHash, item.SerialNumber)
+		}
+	}
+
+	bundleEntry := &NFTBundleEntry{
+		BundleID:   txHash.NewBlockHash(),
+		SellerPKID: sellerPKID.NewPKID(),
+	}
+	for _, item := range txMeta.Items {
+		bundleEntry.Items = append(bundleEntry.Items, item.Copy())
+	}
+	bav._setNFTBundleEntryMappings(bundleEntry)
+	return nil
+}
+
+// _connectBuyNFTBundle sells every NFT in the bundle to the buyer and delists the bundle. It
+// returns the UtxoOperations of each NFT's sale, along with the buyer's existing bids on the
+// NFTs, which are replaced by the bids the sales accept.
+func (bav *UtxoView) _connectBuyNFTBundle(txn *MsgDeSoTxn, txMeta *NFTBundleMetadata,
+	bundleEntry *NFTBundleEntry, buyerPKID *PKID, blockHeight uint32) (
+	_saleUtxoOps [][]*UtxoOperation, _replacedBidEntries []*NFTBidEntry, _err error) {
+
+	if bundleEntry.SellerPKID.Eq(buyerPKID) {
+		return nil, nil, RuleErrorNFTBundleBuyerIsSeller
+	}
+	totalPriceNanos := bundleEntry.GetTotalPriceNanos()
+	if txMeta.TotalPriceNanos != totalPriceNanos {
+		return nil, nil, errors.Wrapf(RuleErrorNFTBundlePriceMismatch,
+			"_connectBuyNFTBundle: txn price %d != bundle price %d", txMeta.TotalPriceNanos, totalPriceNanos)
+	}
+
+	// Check every NFT before any of them is sold so that the whole bundle fails if one of
+	// them can't be.
+	for _, item := range bundleEntry.Items {
+		if err := bav._validateNFTBundleItem(item, bundleEntry.SellerPKID, blockHeight); err != nil {
+			return nil, nil, errors.Wrapf(err, "_connectBuyNFTBundle: post hash %v serial number %d: ",
+				item.NFTPostHash, item.SerialNumber)
+		}
+	}
+	// We assume the tip is right before the block in which this txn is about to be applied.
+	buyerBalanceNanos, err := bav.GetSpendableDeSoBalanceNanosForPublicKey(txn.PublicKey, blockHeight-1)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "_connectBuyNFTBundle: Problem getting buyer balance: ")
+	}
+	if buyerBalanceNanos < totalPriceNanos {
+		return nil, nil, errors.Wrapf(RuleErrorNFTBundleInsufficientBuyerBalance,
+			"_connectBuyNFTBundle: balance %d < price %d", buyerBalanceNanos, totalPriceNanos)
+	}
+
+	sellerPublicKey := bav.GetPublicKeyForPKID(bundleEntry.SellerPKID)
+	var saleUtxoOps [][]*UtxoOperation
+	var replacedBidEntries []*NFTBidEntry
+	for _, item := range bundleEntry.Items {
+		// Each NFT is sold by accepting a bid from the buyer at the NFT's price, which
+		// replaces any bid the buyer already had on it.
+		nftBidKey := MakeNFTBidKey(buyerPKID, item.NFTPostHash, item.SerialNumber)
+		if existingBidEntry := bav.GetNFTBidEntryForNFTBidKey(&nftBidKey); existingBidEntry != nil &&
+			!existingBidEntry.isDeleted {
+			replacedBidEntries = append(replacedBidEntries, existingBidEntry.Copy())
+		}
+		bav._setNFTBidEntryMappings(&NFTBidEntry{
+			BidderPKID:     buyerPKID.NewPKID(),
+			NFTPostHash:    item.NFTPostHash.NewBlockHash(),
+			SerialNumber:   item.SerialNumber,
+			BidAmountNanos: item.PriceNanos,
+		})
+
+		saleTxn := makeNFTBundleSaleTxn(
+			sellerPublicKey, item.NFTPostHash, item.SerialNumber, buyerPKID, item.PriceNanos)
+		_, _, utxoOps, err := bav._helpConnectNFTSold(HelpConnectNFTSoldStruct{
+			NFTPostHash:    item.NFTPostHash,
+			SerialNumber:   item.SerialNumber,
+			BidderPKID:     buyerPKID,
+			BidAmountNanos: item.PriceNanos,
+
+			BlockHeight:      blockHeight,
+			Txn:              saleTxn,
+			TxHash:           saleTxn.Hash(),
+			VerifySignatures: false,
+		})
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "_connectBuyNFTBundle: Problem selling post hash %v "+
+				"serial number %d: ", item.NFTPostHash, item.SerialNumber)
+		}
+		saleUtxoOps = append(saleUtxoOps, utxoOps)
+	}
+
+	bav._deleteNFTBundleEntryMappings(bundleEntry)
+	return saleUtxoOps, replacedBidEntries, nil
+}
+
+func (bav *UtxoView) _disconnectNFTBundle(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.NFTBundleBlockHeight {
+		return errors.Wrapf(RuleErrorNFTBundleBeforeBlockHeight, "_disconnectNFTBundle: ")
+	}
+
+	// Validate the last operation is an NFTBundle operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectNFTBundle: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeNFTBundle {
+		return fmt.Errorf(
+			"_disconnectNFTBundle: trying to revert %v but found %v",
+			OperationTypeNFTBundle,
+			operationData.Type,
+		)
+	}
+	txMeta := currentTxn.TxnMeta.(*NFTBundleMetadata)
+
+	switch txMeta.OperationType {
+	case NFTBundleOperationTypeList:
+		// The txn listed the bundle, so delist it. It can't have been bought or canceled
+		// yet, since those txns would have been disconnected first.
+		bundleEntry, err := bav.GetNFTBundleEntry(txHash)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectNFTBundle: ")
+		}
+		if bundleEntry == nil {
+			return fmt.Errorf("_disconnectNFTBundle: listed NFT bundle %v not found", txHash)
+		}
+		bav._deleteNFTBundleEntryMappings(bundleEntry)
+
+	case NFTBundleOperationTypeCancel:
+		if operationData.PrevNFTBundleEntry == nil {
+			return fmt.Errorf("_disconnectNFTBundle: prev NFT bundle entry doesn't exist; " +
+				"this should never happen")
+		}
+		bav._setNFTBundleEntryMappings(operationData.PrevNFTBundleEntry)
+
+	case NFTBundleOperationTypeBuy:
+		if operationData.PrevNFTBundleEntry == nil {
+			return fmt.Errorf("_disconnectNFTBundle: prev NFT bundle entry doesn't exist; " +
+				"this should never happen")
+		}
+		if err := bav._disconnectBuyNFTBundle(operationData, blockHeight); err != nil {
+			return errors.Wrapf(err, "_disconnectNFTBundle: ")
+		}
+		bav._setNFTBundleEntryMappings(operationData.PrevNFTBundleEntry)
+
+	default:
+		return fmt.Errorf("_disconnectNFTBundle: invalid operation type %d", txMeta.OperationType)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// _disconnectBuyNFTBundle reverts the sales of the NFTs in a bought bundle, and restores the
+// buyer's bids that the sales replaced.
+func (bav *UtxoView) _disconnectBuyNFTBundle(operationData *UtxoOperation, blockHeight uint32) error {
+	// Disconnect the sales in reverse.
+	for ii := len(operationData.AtomicTxnsInnerUtxoOps) - 1; ii >= 0; ii-- {
+		utxoOps := operationData.AtomicTxnsInnerUtxoOps[ii]
+		if len(utxoOps) == 0 {
+			return fmt.Errorf("_disconnectBuyNFTBundle: utxoOperations are missing for sale %d", ii)
+		}
+		prevNFTEntry := utxoOps[len(utxoOps)-1].PrevNFTEntry
+		if prevNFTEntry == nil || prevNFTEntry.isDeleted {
+			return fmt.Errorf("_disconnectBuyNFTBundle: prev NFT entry doesn't exist for "+
+				"sale %d; this should never happen", ii)
+		}
+
+		// The buyer owns the NFT now, so its entry holds the price it was sold for.
+		nftKey := MakeNFTKey(prevNFTEntry.NFTPostHash, prevNFTEntry.SerialNumber)
+		soldNFTEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+		if soldNFTEntry == nil || soldNFTEntry.isDeleted {
+			return fmt.Errorf("_disconnectBuyNFTBundle: NFT entry doesn't exist for "+
+				"sale %d; this should never happen", ii)
+		}
+		buyerPKID := soldNFTEntry.OwnerPKID
+		saleTxn := makeNFTBundleSaleTxn(bav.GetPublicKeyForPKID(prevNFTEntry.OwnerPKID),
+			prevNFTEntry.NFTPostHash, prevNFTEntry.SerialNumber,
+			buyerPKID, soldNFTEntry.LastAcceptedBidAmountNanos)
+		if err := bav._disconnectAcceptNFTBid(
+			OperationTypeAcceptNFTBid, saleTxn, saleTxn.Hash(), utxoOps, blockHeight); err != nil {
+			return errors.Wrapf(err, "_disconnectBuyNFTBundle: Problem disconnecting sale %d: ", ii)
+		}
+
+		// Disconnecting the sale restores the bid it accepted, which only existed for the sale.
+		nftBidKey := MakeNFTBidKey(buyerPKID, prevNFTEntry.NFTPostHash, prevNFTEntry.SerialNumber)
+		saleBidEntry := bav.GetNFTBidEntryForNFTBidKey(&nftBidKey)
+		if saleBidEntry == nil || saleBidEntry.isDeleted {
+			return fmt.Errorf("_disconnectBuyNFTBundle: accepted bid doesn't exist for "+
+				"sale %d; this should never happen", ii)
+		}
+		bav._deleteNFTBidEntryMappings(saleBidEntry)
+	}
+
+	for _, bidEntry := range operationData.DeletedNFTBidEntries {
+		bav._setNFTBidEntryMappings(bidEntry)
+	}
+	return nil
+}
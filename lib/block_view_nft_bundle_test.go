@@ -0,0 +1,415 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTBundleMetadata(t *testing.T) {
+	require := require.New(t)
+
+	items := []*NFTBundleItem{
+		{NFTPostHash: NewBlockHash(RandomBytes(HashSizeBytes)), SerialNumber: 1, PriceNanos: 1000},
+		{NFTPostHash: NewBlockHash(RandomBytes(HashSizeBytes)), SerialNumber: 7, PriceNanos: 250},
+	}
+	bundleID := NewBlockHash(RandomBytes(HashSizeBytes))
+
+	// Round-trip the metadata for listing, canceling and buying a bundle.
+	for _, metadata := range []*NFTBundleMetadata{
+		{OperationType: NFTBundleOperationTypeList, Items: items},
+		{OperationType: NFTBundleOperationTypeCancel, BundleID: bundleID},
+		{OperationType: NFTBundleOperationTypeBuy, BundleID: bundleID, TotalPriceNanos: 1250},
+	} {
+		metadataBytes, err := metadata.ToBytes(false)
+		require.NoError(err)
+		decodedMetadata := &NFTBundleMetadata{}
+		require.NoError(decodedMetadata.FromBytes(metadataBytes))
+		require.Equal(metadata, decodedMetadata)
+	}
+
+	// A bundle can't be decoded with more than MaxNFTBundleItems items.
+	tooManyItems := make([]*NFTBundleItem, MaxNFTBundleItems+1)
+	for ii := range tooManyItems {
+		tooManyItems[ii] = items[0]
+	}
+	metadataBytes, err := (&NFTBundleMetadata{Items: tooManyItems}).ToBytes(false)
+	require.NoError(err)
+	err = (&NFTBundleMetadata{}).FromBytes(metadataBytes)
+	require.Error(err)
+	require.Contains(err.Error(), string(RuleErrorNFTBundleTooManyItems))
+
+	entry := &NFTBundleEntry{
+		BundleID:   bundleID,
+		SellerPKID: NewPKID(m0PkBytes),
+		Items:      items,
+	}
+	require.Equal(uint64(1250), entry.GetTotalPriceNanos())
+
+	decodedEntry, err := DecodeDeSoEncoder(&NFTBundleEntry{}, bytes.NewReader(EncodeToBytes(0, entry)))
+	require.NoError(err)
+	require.Equal(entry, decodedEntry)
+	require.Equal(entry, entry.Copy())
+}
+
+func TestNFTBundleConnectAndDisconnect(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(100)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(m4PkBytes)] = true
+	params.ForkHeights.BrokenNFTBidsFixBlockHeight = uint32(0)
+	params.ForkHeights.BuyNowAndNFTSplitsBlockHeight = uint32(0)
+	params.ForkHeights.NFTBundleBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	// The sales' utxo ops are stored in AtomicTxnsInnerUtxoOps, which are only encoded once the
+	// PoS state setup migration is triggered.
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	params.BlockRewardMaturity = time.Second
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 4; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m0Pub, senderPrivString, 1e5)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m1Pub, senderPrivString, 1e5)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m2Pub, senderPrivString, 1e5)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m3Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m4Pub, senderPrivString, 100)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+
+	// Set max copies to a non-zero value to activate NFTs. The fee buckets need a minimum
+	// network fee once the PoS state setup fork is active.
+	_updateGlobalParamsEntryWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m4Pub,
+		m4Priv,
+		-1,                       /*USDCentsPerBitcoinExchangeRate*/
+		int64(feeRateNanosPerKB), /*minimumNetworkFeeNanosPerKb*/
+		-1,                       /*createProfileFeeNanos*/
+		-1,                       /*createNFTFeeNanos*/
+		1000,                     /*maxCopiesPerNFT*/
+	)
+
+	// m0 mints four copies of a post, with a 10% creator royalty, a 5% coin royalty, and a 2%
+	// royalty to m3, and puts them all up for sale.
+	_updateProfileWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,         /*updaterPkBase58Check*/
+		m0Priv,        /*updaterPrivBase58Check*/
+		[]byte{},      /*profilePubKey*/
+		"m0",          /*newUsername*/
+		"i am the m0", /*newDescription*/
+		shortPic,      /*newProfilePic*/
+		10*100,        /*newCreatorBasisPoints*/
+		1.25*100*100,  /*newStakeMultipleBasisPoints*/
+		false /*isHidden*/)
+	// m1 buys some of m0's coin so that the coin royalty isn't burned.
+	_creatorCoinTxnWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m1Pub,  /*updaterPkBase58Check*/
+		m1Priv, /*updaterPrivBase58Check*/
+		m0Pub,  /*profilePubKeyBase58Check*/
+		CreatorCoinOperationTypeBuy,
+		1000, /*DeSoToSellNanos*/
+		0,    /*CreatorCoinToSellNanos*/
+		0,    /*DeSoToAddNanos*/
+		0,    /*MinDeSoExpectedNanos*/
+		0,    /*MinCreatorCoinExpectedNanos*/
+	)
+	_submitPostWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,                              /*updaterPkBase58Check*/
+		m0Priv,                             /*updaterPrivBase58Check*/
+		[]byte{},                           /*postHashToModify*/
+		[]byte{},                           /*parentStakeID*/
+		&DeSoBodySchema{Body: "m0 post 1"}, /*body*/
+		[]byte{},
+		1502947011*1e9, /*tstampNanos*/
+		false /*isHidden*/)
+	postHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	_createNFTWithAdditionalRoyaltiesWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,    /*updaterPkBase58Check*/
+		m0Priv,   /*updaterPrivBase58Check*/
+		postHash, /*postHashToModify*/
+		4,        /*numCopies*/
+		false,    /*hasUnlockable*/
+		true,     /*isForSale*/
+		0,        /*minBidAmountNanos*/
+		0,        /*nftFee*/
+		10*100,   /*nftRoyaltyToCreatorBasisPoints*/
+		5*100,    /*nftRoyaltyToCoinBasisPoints*/
+		false,    /*isBuyNow*/
+		0,        /*buyNowPriceNanos*/
+		map[PublicKey]uint64{*NewPublicKey(m3PkBytes): 2 * 100},
+		nil,
+	)
+
+	// A bundle can't list a serial that doesn't exist.
+	_, _, err := _nftBundle(t, chain, db, params, feeRateNanosPerKB, m0Pub, m0Priv, &NFTBundleMetadata{
+		OperationType: NFTBundleOperationTypeList,
+		Items: []*NFTBundleItem{
+			{NFTPostHash: postHash, SerialNumber: 1, PriceNanos: 1000},
+			{NFTPostHash: postHash, SerialNumber: 5, PriceNanos: 1000},
+		},
+	})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTBundleNonExistentNFT)
+
+	// m0 lists serials 1 and 2 as one bundle, serials 1 and 3 as another, and serials 3 and 4
+	// as a third.
+	listBundle := func(items ...*NFTBundleItem) *BlockHash {
+		_nftBundleWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, &NFTBundleMetadata{
+			OperationType: NFTBundleOperationTypeList,
+			Items:         items,
+		})
+		return testMeta.txns[len(testMeta.txns)-1].Hash()
+	}
+	bundle12ID := listBundle(
+		&NFTBundleItem{NFTPostHash: postHash, SerialNumber: 1, PriceNanos: 1000},
+		&NFTBundleItem{NFTPostHash: postHash, SerialNumber: 2, PriceNanos: 2000},
+	)
+	bundle13ID := listBundle(
+		&NFTBundleItem{NFTPostHash: postHash, SerialNumber: 1, PriceNanos: 500},
+		&NFTBundleItem{NFTPostHash: postHash, SerialNumber: 3, PriceNanos: 500},
+	)
+	bundle34ID := listBundle(
+		&NFTBundleItem{NFTPostHash: postHash, SerialNumber: 3, PriceNanos: 500},
+		&NFTBundleItem{NFTPostHash: postHash, SerialNumber: 4, PriceNanos: 500},
+	)
+
+	type bundleState struct {
+		nftEntries          []*NFTEntry
+		m2BidEntries        []*NFTBidEntry
+		balances            []uint64
+		coinDeSoLockedNanos uint64
+		bundle12Entry       *NFTBundleEntry
+	}
+	getBundleState := func(utxoView *UtxoView) *bundleState {
+		if utxoView == nil {
+			utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		}
+		state := &bundleState{
+			coinDeSoLockedNanos: utxoView.GetProfileEntryForPKID(m0PKID).CreatorCoinEntry.DeSoLockedNanos,
+		}
+		for serialNumber := uint64(1); serialNumber <= 4; serialNumber++ {
+			nftKey := MakeNFTKey(postHash, serialNumber)
+			state.nftEntries = append(state.nftEntries, utxoView.GetNFTEntryForNFTKey(&nftKey))
+			bidKey := MakeNFTBidKey(m2PKID, postHash, serialNumber)
+			bidEntry := utxoView.GetNFTBidEntryForNFTBidKey(&bidKey)
+			if bidEntry != nil && bidEntry.isDeleted {
+				bidEntry = nil
+			}
+			state.m2BidEntries = append(state.m2BidEntries, bidEntry)
+		}
+		for _, publicKey := range [][]byte{m0PkBytes, m1PkBytes, m2PkBytes, m3PkBytes} {
+			balance, err := utxoView.GetDeSoBalanceNanosForPublicKey(publicKey)
+			require.NoError(err)
+			state.balances = append(state.balances, balance)
+		}
+		bundleEntry, err := utxoView.GetNFTBundleEntry(bundle12ID)
+		require.NoError(err)
+		state.bundle12Entry = bundleEntry
+		return state
+	}
+	stateBeforeBuy := getBundleState(nil)
+	require.NotNil(stateBeforeBuy.bundle12Entry)
+	require.Equal(m0PKID, stateBeforeBuy.bundle12Entry.SellerPKID)
+
+	// The buyer has to pay exactly the bundle's price.
+	_, _, err = _nftBundle(t, chain, db, params, feeRateNanosPerKB, m2Pub, m2Priv, &NFTBundleMetadata{
+		OperationType:   NFTBundleOperationTypeBuy,
+		BundleID:        bundle12ID,
+		TotalPriceNanos: 2000,
+	})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTBundlePriceMismatch)
+
+	// m2 buys serials 1 and 2 at once.
+	_nftBundleWithTestMeta(testMeta, feeRateNanosPerKB, m2Pub, m2Priv, &NFTBundleMetadata{
+		OperationType:   NFTBundleOperationTypeBuy,
+		BundleID:        bundle12ID,
+		TotalPriceNanos: 3000,
+	})
+	stateAfterBuy := getBundleState(nil)
+	for _, nftEntry := range stateAfterBuy.nftEntries[:2] {
+		require.Equal(m2PKID, nftEntry.OwnerPKID)
+		require.False(nftEntry.IsForSale)
+	}
+	for _, nftEntry := range stateAfterBuy.nftEntries[2:] {
+		require.Equal(m0PKID, nftEntry.OwnerPKID)
+		require.True(nftEntry.IsForSale)
+	}
+	require.Nil(stateAfterBuy.bundle12Entry)
+
+	// Each NFT pays its royalties from its own price. m0 is the creator, so it keeps the
+	// creator royalty, and pays 5% to the coin and 2% to m3 from each price.
+	buyFeeNanos := testMeta.txns[len(testMeta.txns)-1].TxnFeeNanos
+	require.Equal(stateBeforeBuy.balances[0]+3000-150-60, stateAfterBuy.balances[0])
+	require.Equal(stateBeforeBuy.balances[2]-3000-buyFeeNanos, stateAfterBuy.balances[2])
+	require.Equal(stateBeforeBuy.balances[3]+60, stateAfterBuy.balances[3])
+	require.Equal(stateBeforeBuy.coinDeSoLockedNanos+150, stateAfterBuy.coinDeSoLockedNanos)
+	buyUtxoOps := testMeta.txnOps[len(testMeta.txnOps)-1]
+	bundleUtxoOp := buyUtxoOps[len(buyUtxoOps)-1]
+	require.Equal(OperationTypeNFTBundle, bundleUtxoOp.Type)
+	require.Len(bundleUtxoOp.AtomicTxnsInnerUtxoOps, 2)
+	for ii, priceNanos := range []uint64{1000, 2000} {
+		saleUtxoOps := bundleUtxoOp.AtomicTxnsInnerUtxoOps[ii]
+		saleUtxoOp := saleUtxoOps[len(saleUtxoOps)-1]
+		require.Equal(OperationTypeAcceptNFTBid, saleUtxoOp.Type)
+		require.Equal(priceNanos*5/100, saleUtxoOp.AcceptNFTBidCreatorRoyaltyNanos)
+		require.Equal(priceNanos*10/100, saleUtxoOp.AcceptNFTBidCreatorDESORoyaltyNanos)
+		require.Len(saleUtxoOp.AcceptNFTBidAdditionalDESORoyalties, 1)
+		require.Equal(m3PkBytes, saleUtxoOp.AcceptNFTBidAdditionalDESORoyalties[0].PublicKey)
+		require.Equal(priceNanos*2/100, saleUtxoOp.AcceptNFTBidAdditionalDESORoyalties[0].RoyaltyAmountNanos)
+	}
+
+	// Disconnecting the purchase relists the bundle and puts the NFTs and balances back.
+	{
+		buyTxn := testMeta.txns[len(testMeta.txns)-1]
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(buyTxn, buyTxn.Hash(), buyUtxoOps, testMeta.savedHeight))
+		require.Equal(stateBeforeBuy, getBundleState(utxoView))
+	}
+
+	// If any serial in a bundle can't be sold, none of them change hands. Serial 1 was
+	// already sold with the first bundle.
+	_, _, err = _nftBundle(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv, &NFTBundleMetadata{
+		OperationType:   NFTBundleOperationTypeBuy,
+		BundleID:        bundle13ID,
+		TotalPriceNanos: 1000,
+	})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTBundleNFTNotOwnedBySeller)
+	require.Equal(stateAfterBuy, getBundleState(nil))
+
+	// Serial 4 is taken off sale and then transferred, so it's pending for m3.
+	_updateNFTWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, postHash, 4, false, 0, false, 0)
+	_, _, err = _nftBundle(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv, &NFTBundleMetadata{
+		OperationType:   NFTBundleOperationTypeBuy,
+		BundleID:        bundle34ID,
+		TotalPriceNanos: 1000,
+	})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTBundleNFTNotForSale)
+	_transferNFTWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, m3Pub, postHash, 4, "")
+	stateAfterTransfer := getBundleState(nil)
+	require.True(stateAfterTransfer.nftEntries[3].IsPending)
+	_, _, err = _nftBundle(t, chain, db, params, feeRateNanosPerKB, m1Pub, m1Priv, &NFTBundleMetadata{
+		OperationType:   NFTBundleOperationTypeBuy,
+		BundleID:        bundle34ID,
+		TotalPriceNanos: 1000,
+	})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTBundleNFTNotOwnedBySeller)
+	require.Equal(stateAfterTransfer, getBundleState(nil))
+	bundle34Entry, err := DBGetNFTBundleEntry(db, chain.snapshot, bundle34ID)
+	require.NoError(err)
+	require.NotNil(bundle34Entry)
+
+	_executeAllTestRollbackAndFlush(testMeta)
+
+	// Rolling everything back deletes the NFTs and the bundles.
+	require.Empty(DBGetNFTEntriesForPostHash(db, postHash))
+	for _, bundleID := range []*BlockHash{bundle12ID, bundle13ID, bundle34ID} {
+		bundleEntry, err := DBGetNFTBundleEntry(db, chain.snapshot, bundleID)
+		require.NoError(err)
+		require.Nil(bundleEntry)
+	}
+}
+
+//
+// ----- HELPERS
+//
+
+func _nftBundleWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *NFTBundleMetadata,
+) {
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check))
+	currentOps, currentTxn, err := _nftBundle(
+		testMeta.t, testMeta.chain, testMeta.db, testMeta.params, feeRateNanosPerKB,
+		transactorPublicKeyBase58Check, transactorPrivateKeyBase58Check, metadata)
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+func _nftBundle(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoParams,
+	feeRateNanosPerKB uint64, transactorPublicKeyBase58Check string, transactorPrivateKeyBase58Check string,
+	metadata *NFTBundleMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+
+	txn, totalInputMake, _, feesMake, err := chain.CreateNFTBundleTxn(
+		transactorPkBytes, metadata, nil, feeRateNanosPerKB, nil, []*DeSoOutput{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(t, txn, transactorPrivateKeyBase58Check)
+
+	// Always use height+1 for validation since it's assumed the transaction will
+	// get mined into the next block.
+	blockHeight := chain.blockTip().Height + 1
+	utxoOps, totalInput, totalOutput, fees, err :=
+		utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	require.Equal(totalInput, totalOutput+fees)
+	require.Equal(feesMake, fees)
+	// The price of a bought bundle is paid by the sales rather than as part of the total input.
+	require.True(totalInputMake >= totalInput)
+	require.Equal(OperationTypeSpendBalance, utxoOps[0].Type)
+	require.Equal(OperationTypeNFTBundle, utxoOps[len(utxoOps)-1].Type)
+
+	require.NoError(utxoView.FlushToDb(0))
+
+	return utxoOps, txn, nil
+}
@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// A Buy Now NFT can be sold as a Dutch auction by setting BuyNowEndPriceKey and
+// BuyNowPriceDecayEndBlockHeightKey in the ExtraData of the CreateNFT or UpdateNFT txn that
+// puts it up for sale. Its Buy Now price then falls from BuyNowPriceNanos to the end price
+// between the decay's start and end heights, and stays at the end price afterwards. The
+// first bid at or above the price at the height it's connected buys the NFT exactly like a
+// Buy Now bid, so the sale is accounted for by the existing Buy Now UtxoOperations.
+
+// _getNFTDutchAuctionExtraData returns the Dutch auction settings in the txn's ExtraData. The
+// end block height is zero if the txn doesn't make the NFT a Dutch auction.
+func (bav *UtxoView) _getNFTDutchAuctionExtraData(txn *MsgDeSoTxn, blockHeight uint32) (
+	_endPriceNanos uint64, _startBlockHeight uint64, _endBlockHeight uint64, _stepBlocks uint64, _err error) {
+
+	values := make(map[string]uint64)
+	for _, key := range []string{BuyNowEndPriceKey, BuyNowPriceDecayStartBlockHeightKey,
+		BuyNowPriceDecayEndBlockHeightKey, BuyNowPriceDecayStepBlocksKey} {
+
+		val, exists := txn.ExtraData[key]
+		if !exists {
+			continue
+		}
+		value, bytesRead := Uvarint(val)
+		if bytesRead <= 0 {
+			return 0, 0, 0, 0, errors.Wrapf(RuleErrorNFTDutchAuctionInvalidExtraData,
+				"_getNFTDutchAuctionExtraData: Problem reading bytes for %v", key)
+		}
+		values[key] = value
+	}
+	if len(values) == 0 {
+		return 0, 0, 0, 0, nil
+	}
+	if blockHeight < bav.Params.ForkHeights.NFTDutchAuctionBlockHeight {
+		return 0, 0, 0, 0, errors.Wrapf(RuleErrorNFTDutchAuctionBeforeBlockHeight, "_getNFTDutchAuctionExtraData: ")
+	}
+
+	endPriceNanos, hasEndPrice := values[BuyNowEndPriceKey]
+	endBlockHeight, hasEndBlockHeight := values[BuyNowPriceDecayEndBlockHeightKey]
+	if !hasEndPrice || !hasEndBlockHeight {
+		return 0, 0, 0, 0, errors.Wrapf(RuleErrorNFTDutchAuctionInvalidExtraData,
+			"_getNFTDutchAuctionExtraData: %v and %v are required", BuyNowEndPriceKey, BuyNowPriceDecayEndBlockHeightKey)
+	}
+	startBlockHeight, hasStartBlockHeight := values[BuyNowPriceDecayStartBlockHeightKey]
+	if !hasStartBlockHeight {
+		startBlockHeight = uint64(blockHeight)
+	}
+	if endBlockHeight <= uint64(blockHeight) {
+		return 0, 0, 0, 0, errors.Wrapf(RuleErrorNFTDutchAuctionEndNotInFuture,
+			"_getNFTDutchAuctionExtraData: End block height %d must be after block height %d",
+			endBlockHeight, blockHeight)
+	}
+	if endBlockHeight <= startBlockHeight {
+		return 0, 0, 0, 0, errors.Wrapf(RuleErrorNFTDutchAuctionInvalidBlockRange,
+			"_getNFTDutchAuctionExtraData: End block height %d must be after start block height %d",
+			endBlockHeight, startBlockHeight)
+	}
+	stepBlocks, hasStepBlocks := values[BuyNowPriceDecayStepBlocksKey]
+	if hasStepBlocks && (stepBlocks == 0 || stepBlocks > endBlockHeight-startBlockHeight) {
+		return 0, 0, 0, 0, errors.Wrapf(RuleErrorNFTDutchAuctionInvalidStepBlocks,
+			"_getNFTDutchAuctionExtraData: Step of %d blocks must be between 1 and %d",
+			stepBlocks, endBlockHeight-startBlockHeight)
+	}
+	return endPriceNanos, startBlockHeight, endBlockHeight, stepBlocks, nil
+}
+
+// ValidateNFTDutchAuction checks that an NFT with the given sale settings can be a Dutch
+// auction. Only Buy Now NFTs have a price to decay, the price has to fall, and it can't fall
+// below the min bid amount since a Buy Now purchase must meet it.
+func ValidateNFTDutchAuction(
+	isBuyNow bool, buyNowPriceNanos uint64, endPriceNanos uint64, minBidAmountNanos uint64) error {
+
+	if !isBuyNow {
+		return RuleErrorNFTDutchAuctionMustBeBuyNow
+	}
+	if endPriceNanos >= buyNowPriceNanos {
+		return RuleErrorNFTDutchAuctionEndPriceNotBelowStart
+	}
+	if endPriceNanos < minBidAmountNanos {
+		return RuleErrorNFTDutchAuctionEndPriceBelowMinBid
+	}
+	return nil
+}
+
+// IsDutchAuction returns true if the NFT's Buy Now price declines over time.
+func (nft *NFTEntry) IsDutchAuction() bool {
+	return nft.BuyNowPriceDecayEndBlockHeight != 0
+}
+
+// GetBuyNowPriceNanos returns the price at which a bid buys the NFT at blockHeight. Unless
+// the NFT is a Dutch auction, this is just BuyNowPriceNanos.
+func (nft *NFTEntry) GetBuyNowPriceNanos(blockHeight uint64) uint64 {
+	if !nft.IsDutchAuction() || blockHeight <= nft.BuyNowPriceDecayStartBlockHeight {
+		return nft.BuyNowPriceNanos
+	}
+	if blockHeight >= nft.BuyNowPriceDecayEndBlockHeight {
+		return nft.BuyNowEndPriceNanos
+	}
+
+	elapsedBlocks := blockHeight - nft.BuyNowPriceDecayStartBlockHeight
+	if nft.BuyNowPriceDecayStepBlocks != 0 {
+		elapsedBlocks -= elapsedBlocks % nft.BuyNowPriceDecayStepBlocks
+	}
+	// The total price drop times the elapsed blocks can overflow a uint64, so the drop so
+	// far is computed with big.Ints. It's rounded down so the price never undershoots.
+	priceDrop := big.NewInt(0).Mul(
+		big.NewInt(0).SetUint64(nft.BuyNowPriceNanos-nft.BuyNowEndPriceNanos),
+		big.NewInt(0).SetUint64(elapsedBlocks))
+	priceDrop.Div(priceDrop, big.NewInt(0).SetUint64(
+		nft.BuyNowPriceDecayEndBlockHeight-nft.BuyNowPriceDecayStartBlockHeight))
+	return nft.BuyNowPriceNanos - priceDrop.Uint64()
+}
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTDutchAuctionBuyNowPrice(t *testing.T) {
+	require := require.New(t)
+
+	// The price falls linearly from 1000 nanos at block 100 to 200 nanos at block 200.
+	nftEntry := &NFTEntry{
+		IsBuyNow:                         true,
+		BuyNowPriceNanos:                 1000,
+		BuyNowEndPriceNanos:              200,
+		BuyNowPriceDecayStartBlockHeight: 100,
+		BuyNowPriceDecayEndBlockHeight:   200,
+	}
+	require.True(nftEntry.IsDutchAuction())
+	require.Equal(uint64(1000), nftEntry.GetBuyNowPriceNanos(50))
+	require.Equal(uint64(1000), nftEntry.GetBuyNowPriceNanos(100))
+	require.Equal(uint64(992), nftEntry.GetBuyNowPriceNanos(101))
+	require.Equal(uint64(600), nftEntry.GetBuyNowPriceNanos(150))
+	require.Equal(uint64(200), nftEntry.GetBuyNowPriceNanos(200))
+	require.Equal(uint64(200), nftEntry.GetBuyNowPriceNanos(500))
+
+	// With a step of 30 blocks, the price only drops at blocks 130, 160 and 190.
+	nftEntry.BuyNowPriceDecayStepBlocks = 30
+	require.Equal(uint64(1000), nftEntry.GetBuyNowPriceNanos(129))
+	require.Equal(uint64(760), nftEntry.GetBuyNowPriceNanos(130))
+	require.Equal(uint64(760), nftEntry.GetBuyNowPriceNanos(159))
+	require.Equal(uint64(280), nftEntry.GetBuyNowPriceNanos(199))
+	require.Equal(uint64(200), nftEntry.GetBuyNowPriceNanos(200))
+
+	// A regular Buy Now NFT always sells at its Buy Now price.
+	nftEntry = &NFTEntry{IsBuyNow: true, BuyNowPriceNanos: 1000}
+	require.False(nftEntry.IsDutchAuction())
+	require.Equal(uint64(1000), nftEntry.GetBuyNowPriceNanos(150))
+
+	require.NoError(ValidateNFTDutchAuction(true, 1000, 200, 100))
+	require.Equal(RuleErrorNFTDutchAuctionMustBeBuyNow, ValidateNFTDutchAuction(false, 1000, 200, 100))
+	require.Equal(RuleErrorNFTDutchAuctionEndPriceNotBelowStart, ValidateNFTDutchAuction(true, 1000, 1000, 100))
+	require.Equal(RuleErrorNFTDutchAuctionEndPriceBelowMinBid, ValidateNFTDutchAuction(true, 1000, 50, 100))
+}
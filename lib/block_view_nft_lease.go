@@ -0,0 +1,378 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/pkg/errors"
+)
+
+// block_view_nft_lease.go implements NFT leases. The owner of an NFT serial can lease it to
+// another user with a LeaseNFT txn, which makes the lessee the NFT's holder until the lease's
+// expiration block without transferring ownership. While the lease is active the owner can't
+// sell, transfer, burn, bundle, or swap the NFT, and GetNFTsHeldByPKID lists it among the
+// lessee's NFTs rather than the owner's.
+//
+// A lease is ended with an EndNFTLease txn, which the lessee can submit at any time to hand the
+// NFT back early and the owner can submit once the lease has expired. An expired lease that
+// hasn't been ended no longer grants any holder rights, and the owner can lease the NFT again
+// without ending it first.
+
+//
+// TYPES: LeaseNFTMetadata
+//
+
+type LeaseNFTMetadata struct {
+	NFTPostHash     *BlockHash
+	SerialNumber    uint64
+	LesseePublicKey []byte
+	// LeaseExpirationBlock is the first block height at which the lease is no longer active.
+	LeaseExpirationBlock uint64
+}
+
+func (txnData *LeaseNFTMetadata) GetTxnType() TxnType {
+	return TxnTypeLeaseNFT
+}
+
+func (txnData *LeaseNFTMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	if len(txnData.NFTPostHash) != HashSizeBytes {
+		return nil, fmt.Errorf("LeaseNFTMetadata.ToBytes: NFTPostHash "+
+			"has length %d != %d", len(txnData.NFTPostHash), HashSizeBytes)
+	}
+
+	var data []byte
+	data = append(data, txnData.NFTPostHash[:]...)
+	data = append(data, UintToBuf(txnData.SerialNumber)...)
+	data = append(data, EncodeByteArray(txnData.LesseePublicKey)...)
+	data = append(data, UintToBuf(txnData.LeaseExpirationBlock)...)
+	return data, nil
+}
+
+func (txnData *LeaseNFTMetadata) FromBytes(data []byte) error {
+	ret := LeaseNFTMetadata{}
+	rr := bytes.NewReader(data)
+	var err error
+
+	ret.NFTPostHash = &BlockHash{}
+	if _, err = io.ReadFull(rr, ret.NFTPostHash[:]); err != nil {
+		return errors.Wrapf(err, "LeaseNFTMetadata.FromBytes: Problem reading NFTPostHash: ")
+	}
+	if ret.SerialNumber, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "LeaseNFTMetadata.FromBytes: Problem reading SerialNumber: ")
+	}
+	if ret.LesseePublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "LeaseNFTMetadata.FromBytes: Problem reading LesseePublicKey: ")
+	}
+	if ret.LeaseExpirationBlock, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "LeaseNFTMetadata.FromBytes: Problem reading LeaseExpirationBlock: ")
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *LeaseNFTMetadata) New() DeSoTxnMetadata {
+	return &LeaseNFTMetadata{}
+}
+
+//
+// TYPES: EndNFTLeaseMetadata
+//
+
+type EndNFTLeaseMetadata struct {
+	NFTPostHash  *BlockHash
+	SerialNumber uint64
+}
+
+func (txnData *EndNFTLeaseMetadata) GetTxnType() TxnType {
+	return TxnTypeEndNFTLease
+}
+
+func (txnData *EndNFTLeaseMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	if len(txnData.NFTPostHash) != HashSizeBytes {
+		return nil, fmt.Errorf("EndNFTLeaseMetadata.ToBytes: NFTPostHash "+
+			"has length %d != %d", len(txnData.NFTPostHash), HashSizeBytes)
+	}
+
+	var data []byte
+	data = append(data, txnData.NFTPostHash[:]...)
+	data = append(data, UintToBuf(txnData.SerialNumber)...)
+	return data, nil
+}
+
+func (txnData *EndNFTLeaseMetadata) FromBytes(data []byte) error {
+	ret := EndNFTLeaseMetadata{}
+	rr := bytes.NewReader(data)
+	var err error
+
+	ret.NFTPostHash = &BlockHash{}
+	if _, err = io.ReadFull(rr, ret.NFTPostHash[:]); err != nil {
+		return errors.Wrapf(err, "EndNFTLeaseMetadata.FromBytes: Problem reading NFTPostHash: ")
+	}
+	if ret.SerialNumber, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "EndNFTLeaseMetadata.FromBytes: Problem reading SerialNumber: ")
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *EndNFTLeaseMetadata) New() DeSoTxnMetadata {
+	return &EndNFTLeaseMetadata{}
+}
+
+//
+// NFTEntry HELPERS
+//
+
+// IsLeaseActive returns true if the NFT is leased and the lease hasn't expired at blockHeight.
+func (nft *NFTEntry) IsLeaseActive(blockHeight uint64) bool {
+	return nft.LesseePKID != nil && blockHeight < nft.LeaseExpirationBlock
+}
+
+// GetHolderPKID returns the PKID that holds the NFT at blockHeight: the lessee while a lease
+// is active, and the owner otherwise.
+func (nft *NFTEntry) GetHolderPKID(blockHeight uint64) *PKID {
+	if nft.IsLeaseActive(blockHeight) {
+		return nft.LesseePKID
+	}
+	return nft.OwnerPKID
+}
+
+// GetNFTsHeldByPKID returns the NFTs that holderPKID holds at blockHeight, sorted by post hash
+// and serial number: the NFTs it owns that aren't leased out, and the NFTs leased to it whose
+// lease is still active.
+func (bav *UtxoView) GetNFTsHeldByPKID(holderPKID *PKID, blockHeight uint64) ([]*NFTEntry, error) {
+	dbLeasedNFTEntries, err := bav.GetDbAdapter().GetNFTEntriesForLesseePKID(holderPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetNFTsHeldByPKID: ")
+	}
+	for _, dbNFTEntry := range dbLeasedNFTEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		nftKey := MakeNFTKey(dbNFTEntry.NFTPostHash, dbNFTEntry.SerialNumber)
+		if _, exists := bav.NFTKeyToNFTEntry[nftKey]; !exists {
+			bav._setNFTEntryMappings(dbNFTEntry)
+		}
+	}
+	// This loads the NFTs holderPKID owns into the view.
+	bav.GetNFTEntriesForPKID(holderPKID)
+
+	var nftEntries []*NFTEntry
+	for _, nftEntry := range bav.NFTKeyToNFTEntry {
+		if !nftEntry.isDeleted && nftEntry.GetHolderPKID(blockHeight).Eq(holderPKID) {
+			nftEntries = append(nftEntries, nftEntry)
+		}
+	}
+	sort.Slice(nftEntries, func(ii, jj int) bool {
+		nftKeyII := MakeNFTKey(nftEntries[ii].NFTPostHash, nftEntries[ii].SerialNumber)
+		nftKeyJJ := MakeNFTKey(nftEntries[jj].NFTPostHash, nftEntries[jj].SerialNumber)
+		return compareNFTKeys(&nftKeyII, &nftKeyJJ) < 0
+	})
+	return nftEntries, nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectLeaseNFT(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	if blockHeight < bav.Params.ForkHeights.NFTLeaseBlockHeight {
+		return 0, 0, nil, RuleErrorNFTLeaseBeforeBlockHeight
+	}
+
+	// Check that the transaction has the right TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeLeaseNFT {
+		return 0, 0, nil, fmt.Errorf("_connectLeaseNFT: called with bad TxnType %s",
+			txn.TxnMeta.GetTxnType().String())
+	}
+	txMeta := txn.TxnMeta.(*LeaseNFTMetadata)
+
+	// Verify the NFT entry exists and that the transactor owns it.
+	nftKey := MakeNFTKey(txMeta.NFTPostHash, txMeta.SerialNumber)
+	nftEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+	if nftEntry == nil || nftEntry.isDeleted {
+		return 0, 0, nil, RuleErrorNFTLeaseNonExistentNFT
+	}
+	ownerPKID := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if ownerPKID == nil || ownerPKID.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectLeaseNFT: non-existent ownerPKID: %s",
+			PkToString(txn.PublicKey, bav.Params))
+	}
+	if !nftEntry.OwnerPKID.Eq(ownerPKID.PKID) {
+		return 0, 0, nil, RuleErrorNFTLeaseByNonOwner
+	}
+
+	// An NFT can't be leased while it could change hands.
+	if nftEntry.IsForSale {
+		return 0, 0, nil, RuleErrorNFTLeaseNFTIsForSale
+	}
+	if nftEntry.IsPending {
+		return 0, 0, nil, RuleErrorNFTLeasePendingNFTTransfer
+	}
+	if nftEntry.IsLeaseActive(uint64(blockHeight)) {
+		return 0, 0, nil, RuleErrorNFTLeaseAlreadyLeased
+	}
+
+	// Validate the lessee and the expiration.
+	if len(txMeta.LesseePublicKey) != btcec.PubKeyBytesLenCompressed {
+		return 0, 0, nil, RuleErrorNFTLeaseInvalidLesseePublicKey
+	}
+	if _, err := btcec.ParsePubKey(txMeta.LesseePublicKey, btcec.S256()); err != nil {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTLeaseInvalidLesseePublicKey, "_connectLeaseNFT: %v", err)
+	}
+	lesseePKID := bav.GetPKIDForPublicKey(txMeta.LesseePublicKey)
+	if lesseePKID == nil || lesseePKID.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectLeaseNFT: non-existent lesseePKID: %s",
+			PkToString(txMeta.LesseePublicKey, bav.Params))
+	}
+	if lesseePKID.PKID.Eq(ownerPKID.PKID) {
+		return 0, 0, nil, RuleErrorNFTLeaseLesseeIsOwner
+	}
+	if txMeta.LeaseExpirationBlock <= uint64(blockHeight) {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTLeaseExpirationNotInFuture,
+			"_connectLeaseNFT: LeaseExpirationBlock %d, block height %d",
+			txMeta.LeaseExpirationBlock, blockHeight)
+	}
+
+	// Connect basic txn to get the total input and the total output without
+	// considering the transaction metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectLeaseNFT: ")
+	}
+
+	// Save a copy of the NFT entry and set the lease on a new one.
+	prevNFTEntry := *nftEntry
+	newNFTEntry := *nftEntry
+	newNFTEntry.LesseePKID = lesseePKID.PKID.NewPKID()
+	newNFTEntry.LeaseExpirationBlock = txMeta.LeaseExpirationBlock
+	bav._setNFTEntryMappings(&newNFTEntry)
+
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:         OperationTypeLeaseNFT,
+		PrevNFTEntry: &prevNFTEntry,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _connectEndNFTLease(
+	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool) (
+	_totalInput uint64, _totalOutput uint64, _utxoOps []*UtxoOperation, _err error) {
+
+	if blockHeight < bav.Params.ForkHeights.NFTLeaseBlockHeight {
+		return 0, 0, nil, RuleErrorNFTLeaseBeforeBlockHeight
+	}
+
+	// Check that the transaction has the right TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeEndNFTLease {
+		return 0, 0, nil, fmt.Errorf("_connectEndNFTLease: called with bad TxnType %s",
+			txn.TxnMeta.GetTxnType().String())
+	}
+	txMeta := txn.TxnMeta.(*EndNFTLeaseMetadata)
+
+	// Verify the NFT entry exists and is leased.
+	nftKey := MakeNFTKey(txMeta.NFTPostHash, txMeta.SerialNumber)
+	nftEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+	if nftEntry == nil || nftEntry.isDeleted {
+		return 0, 0, nil, RuleErrorNFTLeaseNonExistentNFT
+	}
+	if nftEntry.LesseePKID == nil {
+		return 0, 0, nil, RuleErrorNFTLeaseNotLeased
+	}
+
+	// The lessee can end the lease at any time. The owner has to wait until it expires.
+	transactorPKID := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKID == nil || transactorPKID.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectEndNFTLease: non-existent transactorPKID: %s",
+			PkToString(txn.PublicKey, bav.Params))
+	}
+	if nftEntry.OwnerPKID.Eq(transactorPKID.PKID) {
+		if nftEntry.IsLeaseActive(uint64(blockHeight)) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorNFTLeaseCannotEndBeforeExpiration,
+				"_connectEndNFTLease: LeaseExpirationBlock %d, block height %d",
+				nftEntry.LeaseExpirationBlock, blockHeight)
+		}
+	} else if !nftEntry.LesseePKID.Eq(transactorPKID.PKID) {
+		return 0, 0, nil, RuleErrorNFTLeaseEndByNonOwnerOrLessee
+	}
+
+	// Connect basic txn to get the total input and the total output without
+	// considering the transaction metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectEndNFTLease: ")
+	}
+
+	// Save a copy of the NFT entry and clear the lease on a new one.
+	prevNFTEntry := *nftEntry
+	newNFTEntry := *nftEntry
+	newNFTEntry.LesseePKID = nil
+	newNFTEntry.LeaseExpirationBlock = 0
+	bav._setNFTEntryMappings(&newNFTEntry)
+
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:         OperationTypeEndNFTLease,
+		PrevNFTEntry: &prevNFTEntry,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+// _disconnectNFTLease disconnects both LeaseNFT and EndNFTLease txns, which only differ in
+// the lease they leave on the NFT entry.
+func (bav *UtxoView) _disconnectNFTLease(
+	operationType OperationType, currentTxn *MsgDeSoTxn, txnHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation, blockHeight uint32) error {
+
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectNFTLease: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != operationType {
+		return fmt.Errorf("_disconnectNFTLease: Trying to revert %v but found type %v",
+			operationType, operationData.Type)
+	}
+
+	// Sanity check the previous NFT entry against the txn.
+	var nftPostHash *BlockHash
+	var serialNumber uint64
+	switch txMeta := currentTxn.TxnMeta.(type) {
+	case *LeaseNFTMetadata:
+		nftPostHash, serialNumber = txMeta.NFTPostHash, txMeta.SerialNumber
+	case *EndNFTLeaseMetadata:
+		nftPostHash, serialNumber = txMeta.NFTPostHash, txMeta.SerialNumber
+	default:
+		return fmt.Errorf("_disconnectNFTLease: called with bad TxnType %s",
+			currentTxn.TxnMeta.GetTxnType().String())
+	}
+	if operationData.PrevNFTEntry == nil || operationData.PrevNFTEntry.isDeleted {
+		return fmt.Errorf("_disconnectNFTLease: prev NFT entry doesn't exist; " +
+			"this should never happen.")
+	}
+	if !operationData.PrevNFTEntry.NFTPostHash.IsEqual(nftPostHash) ||
+		operationData.PrevNFTEntry.SerialNumber != serialNumber {
+		return fmt.Errorf("_disconnectNFTLease: txMeta post hash and serial number do "+
+			"not match previous NFT entry; this should never happen (%v, %v).",
+			currentTxn.TxnMeta, operationData.PrevNFTEntry)
+	}
+
+	// Restore the previous NFT entry.
+	nftKey := MakeNFTKey(nftPostHash, serialNumber)
+	currNFTEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+	if currNFTEntry == nil || currNFTEntry.isDeleted {
+		return fmt.Errorf("_disconnectNFTLease: currNFTEntry not found: %s, %d",
+			nftPostHash.String(), serialNumber)
+	}
+	bav._deleteNFTEntryMappings(currNFTEntry)
+	bav._setNFTEntryMappings(operationData.PrevNFTEntry)
+
+	// Now revert the basic transfer with the remaining operations.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txnHash, utxoOpsForTxn[:operationIndex], blockHeight)
+}
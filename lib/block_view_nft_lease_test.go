@@ -0,0 +1,202 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTLeaseConnectAndDisconnect(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.NFTLeaseBlockHeight = 0
+	prevGlobalDeSoParams := GlobalDeSoParams
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams = prevGlobalDeSoParams
+	}()
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	// The db has no best chain, so give the view a tip that CopyUtxoView can copy.
+	utxoView.TipHash = &BlockHash{}
+	blockHeight := uint32(10)
+	leaseExpirationBlock := uint64(20)
+
+	// m0 owns an NFT, and everyone has nanos to pay fees.
+	ownerPKID := NewPKID(m0PkBytes)
+	lesseePKID := NewPKID(m1PkBytes)
+	nftPostHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	nftKey := MakeNFTKey(nftPostHash, 1)
+	utxoView._setNFTEntryMappings(&NFTEntry{OwnerPKID: ownerPKID, NFTPostHash: nftPostHash, SerialNumber: 1})
+	for _, publicKey := range [][]byte{m0PkBytes, m1PkBytes, m2PkBytes} {
+		_, err := utxoView._addBalance(1000, publicKey)
+		require.NoError(err)
+	}
+
+	nextPartialID := uint64(0)
+	makeTxn := func(publicKey []byte, txnMeta DeSoTxnMetadata) *MsgDeSoTxn {
+		nextPartialID++
+		return &MsgDeSoTxn{
+			TxnVersion:  DeSoTxnVersion1,
+			TxnMeta:     txnMeta,
+			PublicKey:   publicKey,
+			TxnFeeNanos: 10,
+			TxnNonce:    &DeSoNonce{ExpirationBlockHeight: 100, PartialID: nextPartialID},
+		}
+	}
+	makeLeaseTxn := func(publicKey []byte, lesseePublicKey []byte, expirationBlock uint64) *MsgDeSoTxn {
+		return makeTxn(publicKey, &LeaseNFTMetadata{
+			NFTPostHash:          nftPostHash,
+			SerialNumber:         1,
+			LesseePublicKey:      lesseePublicKey,
+			LeaseExpirationBlock: expirationBlock,
+		})
+	}
+	makeEndLeaseTxn := func(publicKey []byte) *MsgDeSoTxn {
+		return makeTxn(publicKey, &EndNFTLeaseMetadata{NFTPostHash: nftPostHash, SerialNumber: 1})
+	}
+	connect := func(view *UtxoView, txn *MsgDeSoTxn, blockHeight uint32) ([]*UtxoOperation, error) {
+		var utxoOps []*UtxoOperation
+		var err error
+		if txn.TxnMeta.GetTxnType() == TxnTypeLeaseNFT {
+			_, _, utxoOps, err = view._connectLeaseNFT(txn, txn.Hash(), blockHeight, false)
+		} else {
+			_, _, utxoOps, err = view._connectEndNFTLease(txn, txn.Hash(), blockHeight, false)
+		}
+		return utxoOps, err
+	}
+	// A failed connect leaves the view dirty, so it's tried on a copy.
+	requireConnectError := func(view *UtxoView, txn *MsgDeSoTxn, blockHeight uint32, ruleError RuleError) {
+		_, err := connect(view.CopyUtxoView(), txn, blockHeight)
+		require.Error(err)
+		require.Contains(err.Error(), ruleError)
+	}
+	disconnect := func(txn *MsgDeSoTxn, utxoOps []*UtxoOperation, blockHeight uint32) {
+		operationType := OperationTypeLeaseNFT
+		if txn.TxnMeta.GetTxnType() == TxnTypeEndNFTLease {
+			operationType = OperationTypeEndNFTLease
+		}
+		require.NoError(utxoView._disconnectNFTLease(operationType, txn, txn.Hash(), utxoOps, blockHeight))
+	}
+	requireLease := func(lesseePKID *PKID, expirationBlock uint64) {
+		nftEntry := utxoView.GetNFTEntryForNFTKey(&nftKey)
+		require.Equal(ownerPKID, nftEntry.OwnerPKID)
+		require.Equal(lesseePKID, nftEntry.LesseePKID)
+		require.Equal(expirationBlock, nftEntry.LeaseExpirationBlock)
+	}
+	requireHolder := func(holderPKID *PKID, blockHeight uint64) {
+		for _, pkid := range []*PKID{ownerPKID, lesseePKID} {
+			nftEntries, err := utxoView.GetNFTsHeldByPKID(pkid, blockHeight)
+			require.NoError(err)
+			if pkid.Eq(holderPKID) {
+				require.Len(nftEntries, 1)
+				require.Equal(nftPostHash, nftEntries[0].NFTPostHash)
+			} else {
+				require.Empty(nftEntries)
+			}
+		}
+	}
+	requireBalance := func(publicKey []byte, balanceNanos uint64) {
+		actualBalanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(publicKey)
+		require.NoError(err)
+		require.Equal(balanceNanos, actualBalanceNanos)
+	}
+	requireHolder(ownerPKID, uint64(blockHeight))
+
+	// Leases are only allowed on existing NFTs that the transactor owns and that can't change
+	// hands, to another user, and until a future block.
+	beforeForkParams := params
+	beforeForkParams.ForkHeights.NFTLeaseBlockHeight = uint32(blockHeight) + 1
+	_, _, _, err := NewUtxoView(db, &beforeForkParams, nil, nil, nil)._connectLeaseNFT(
+		makeLeaseTxn(m0PkBytes, m1PkBytes, leaseExpirationBlock), nil, blockHeight, false)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorNFTLeaseBeforeBlockHeight)
+	requireConnectError(utxoView, makeTxn(m0PkBytes, &LeaseNFTMetadata{
+		NFTPostHash: nftPostHash, SerialNumber: 2, LesseePublicKey: m1PkBytes, LeaseExpirationBlock: leaseExpirationBlock,
+	}), blockHeight, RuleErrorNFTLeaseNonExistentNFT)
+	requireConnectError(utxoView, makeLeaseTxn(m2PkBytes, m1PkBytes, leaseExpirationBlock),
+		blockHeight, RuleErrorNFTLeaseByNonOwner)
+	requireConnectError(utxoView, makeLeaseTxn(m0PkBytes, m0PkBytes, leaseExpirationBlock),
+		blockHeight, RuleErrorNFTLeaseLesseeIsOwner)
+	requireConnectError(utxoView, makeLeaseTxn(m0PkBytes, m1PkBytes[:10], leaseExpirationBlock),
+		blockHeight, RuleErrorNFTLeaseInvalidLesseePublicKey)
+	requireConnectError(utxoView, makeLeaseTxn(m0PkBytes, m1PkBytes, uint64(blockHeight)),
+		blockHeight, RuleErrorNFTLeaseExpirationNotInFuture)
+	for _, ruleError := range []RuleError{RuleErrorNFTLeaseNFTIsForSale, RuleErrorNFTLeasePendingNFTTransfer} {
+		unleasableView := utxoView.CopyUtxoView()
+		unleasableNFTEntry := *unleasableView.GetNFTEntryForNFTKey(&nftKey)
+		unleasableNFTEntry.IsForSale = ruleError == RuleErrorNFTLeaseNFTIsForSale
+		unleasableNFTEntry.IsPending = ruleError == RuleErrorNFTLeasePendingNFTTransfer
+		unleasableView._setNFTEntryMappings(&unleasableNFTEntry)
+		requireConnectError(unleasableView, makeLeaseTxn(m0PkBytes, m1PkBytes, leaseExpirationBlock), blockHeight, ruleError)
+	}
+	requireConnectError(utxoView, makeEndLeaseTxn(m0PkBytes), blockHeight, RuleErrorNFTLeaseNotLeased)
+
+	// m0 leases the NFT to m1, who holds it until the lease expires. Disconnecting the lease
+	// puts everything back.
+	leaseTxn := makeLeaseTxn(m0PkBytes, m1PkBytes, leaseExpirationBlock)
+	leaseUtxoOps, err := connect(utxoView, leaseTxn, blockHeight)
+	require.NoError(err)
+	requireLease(lesseePKID, leaseExpirationBlock)
+	requireHolder(lesseePKID, uint64(blockHeight))
+	requireHolder(lesseePKID, leaseExpirationBlock-1)
+	requireHolder(ownerPKID, leaseExpirationBlock)
+	requireBalance(m0PkBytes, 990)
+	disconnect(leaseTxn, leaseUtxoOps, blockHeight)
+	requireLease(nil, 0)
+	requireHolder(ownerPKID, uint64(blockHeight))
+	requireBalance(m0PkBytes, 1000)
+	leaseUtxoOps, err = connect(utxoView, leaseTxn, blockHeight)
+	require.NoError(err)
+
+	// The NFT can't be leased again while the lease is active. Only the lessee can end it
+	// early, and the owner has to wait until it expires.
+	requireConnectError(utxoView, makeLeaseTxn(m0PkBytes, m2PkBytes, leaseExpirationBlock+10),
+		blockHeight, RuleErrorNFTLeaseAlreadyLeased)
+	requireConnectError(utxoView, makeEndLeaseTxn(m0PkBytes), blockHeight, RuleErrorNFTLeaseCannotEndBeforeExpiration)
+	requireConnectError(utxoView, makeEndLeaseTxn(m2PkBytes), blockHeight, RuleErrorNFTLeaseEndByNonOwnerOrLessee)
+	earlyEndTxn := makeEndLeaseTxn(m1PkBytes)
+	earlyEndUtxoOps, err := connect(utxoView, earlyEndTxn, blockHeight)
+	require.NoError(err)
+	requireLease(nil, 0)
+	requireHolder(ownerPKID, uint64(blockHeight))
+	requireBalance(m1PkBytes, 990)
+	disconnect(earlyEndTxn, earlyEndUtxoOps, blockHeight)
+	requireLease(lesseePKID, leaseExpirationBlock)
+	requireHolder(lesseePKID, uint64(blockHeight))
+	requireBalance(m1PkBytes, 1000)
+
+	// The lease is kept in the db and the lessee index until it's ended.
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+	requireLease(lesseePKID, leaseExpirationBlock)
+	requireHolder(lesseePKID, uint64(blockHeight))
+	dbLeasedNFTEntries, err := DBGetNFTEntriesForLesseePKID(db, nil, lesseePKID)
+	require.NoError(err)
+	require.Len(dbLeasedNFTEntries, 1)
+
+	// Once the lease expires, the owner can end it, or lease the NFT again without ending it.
+	expiredBlockHeight := uint32(leaseExpirationBlock)
+	requireHolder(ownerPKID, leaseExpirationBlock)
+	releaseTxn := makeLeaseTxn(m0PkBytes, m2PkBytes, leaseExpirationBlock+10)
+	releaseUtxoOps, err := connect(utxoView, releaseTxn, expiredBlockHeight)
+	require.NoError(err)
+	requireLease(NewPKID(m2PkBytes), leaseExpirationBlock+10)
+	disconnect(releaseTxn, releaseUtxoOps, expiredBlockHeight)
+	requireLease(lesseePKID, leaseExpirationBlock)
+	endTxn := makeEndLeaseTxn(m0PkBytes)
+	_, err = connect(utxoView, endTxn, expiredBlockHeight)
+	require.NoError(err)
+	requireLease(nil, 0)
+	require.NoError(utxoView.FlushToDb(uint64(expiredBlockHeight)))
+	dbLeasedNFTEntries, err = DBGetNFTEntriesForLesseePKID(db, nil, lesseePKID)
+	require.NoError(err)
+	require.Empty(dbLeasedNFTEntries)
+}
@@ -0,0 +1,886 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_nft_swap.go implements NFT swaps. A user proposes to swap one of their NFT
+// serials for one of a counterparty's with an NFTSwap txn, optionally adding DESO from either
+// side, and the counterparty accepts it with another NFTSwap txn. Both NFTs change hands in the
+// accepting txn, so neither party can end up with both NFTs or neither.
+//
+// The DESO the proposer adds is escrowed in an EscrowEntry with the swap's SwapID as its
+// EscrowID when the swap is proposed. It's released to the counterparty when the swap is
+// accepted, and refunded to the proposer when either party cancels it. The DESO the
+// counterparty adds is paid from their balance when they accept.
+//
+// A proposal doesn't lock up either NFT. The proposer and the counterparty keep full control
+// of them, and when the swap is accepted both NFTs are checked again, so the txn fails if
+// either of them can no longer be swapped. A proposal can only be accepted through its
+// ExpirationBlockHeight, but it stays on-chain, with its DESO escrowed, until it's canceled.
+//
+// Like NFT transfers, swaps don't pay royalties. NFTs with unlockable content can't be
+// swapped, since the content has to be encrypted for the new owner.
+
+//
+// TYPES: NFTSwapEntry
+//
+
+type NFTSwapEntry struct {
+	// SwapID is the hash of the txn that proposed the swap.
+	SwapID           *BlockHash
+	ProposerPKID     *PKID
+	CounterpartyPKID *PKID
+
+	// The proposer's NFT, which goes to the counterparty.
+	OfferedNFTPostHash  *BlockHash
+	OfferedSerialNumber uint64
+	// The counterparty's NFT, which goes to the proposer.
+	RequestedNFTPostHash  *BlockHash
+	RequestedSerialNumber uint64
+
+	// OfferedDESONanos is escrowed from the proposer and paid to the counterparty.
+	OfferedDESONanos uint64
+	// RequestedDESONanos is paid by the counterparty to the proposer.
+	RequestedDESONanos uint64
+
+	// ExpirationBlockHeight is the last block height at which the swap can be accepted.
+	ExpirationBlockHeight uint64
+
+	isDeleted bool
+}
+
+func (entry *NFTSwapEntry) Copy() *NFTSwapEntry {
+	return &NFTSwapEntry{
+		SwapID:                entry.SwapID.NewBlockHash(),
+		ProposerPKID:          entry.ProposerPKID.NewPKID(),
+		CounterpartyPKID:      entry.CounterpartyPKID.NewPKID(),
+		OfferedNFTPostHash:    entry.OfferedNFTPostHash.NewBlockHash(),
+		OfferedSerialNumber:   entry.OfferedSerialNumber,
+		RequestedNFTPostHash:  entry.RequestedNFTPostHash.NewBlockHash(),
+		RequestedSerialNumber: entry.RequestedSerialNumber,
+		OfferedDESONanos:      entry.OfferedDESONanos,
+		RequestedDESONanos:    entry.RequestedDESONanos,
+		ExpirationBlockHeight: entry.ExpirationBlockHeight,
+		isDeleted:             entry.isDeleted,
+	}
+}
+
+func (entry *NFTSwapEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.SwapID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ProposerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.CounterpartyPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.OfferedNFTPostHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.OfferedSerialNumber)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.RequestedNFTPostHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.RequestedSerialNumber)...)
+	data = append(data, UintToBuf(entry.OfferedDESONanos)...)
+	data = append(data, UintToBuf(entry.RequestedDESONanos)...)
+	data = append(data, UintToBuf(entry.ExpirationBlockHeight)...)
+	return data
+}
+
+func (entry *NFTSwapEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// SwapID
+	entry.SwapID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading SwapID: ")
+	}
+
+	// ProposerPKID
+	entry.ProposerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading ProposerPKID: ")
+	}
+
+	// CounterpartyPKID
+	entry.CounterpartyPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading CounterpartyPKID: ")
+	}
+
+	// OfferedNFTPostHash
+	entry.OfferedNFTPostHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading OfferedNFTPostHash: ")
+	}
+
+	// OfferedSerialNumber
+	entry.OfferedSerialNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading OfferedSerialNumber: ")
+	}
+
+	// RequestedNFTPostHash
+	entry.RequestedNFTPostHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading RequestedNFTPostHash: ")
+	}
+
+	// RequestedSerialNumber
+	entry.RequestedSerialNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading RequestedSerialNumber: ")
+	}
+
+	// OfferedDESONanos
+	entry.OfferedDESONanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading OfferedDESONanos: ")
+	}
+
+	// RequestedDESONanos
+	entry.RequestedDESONanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading RequestedDESONanos: ")
+	}
+
+	// ExpirationBlockHeight
+	entry.ExpirationBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapEntry.Decode: Problem reading ExpirationBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (entry *NFTSwapEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *NFTSwapEntry) GetEncoderType() EncoderType {
+	return EncoderTypeNFTSwapEntry
+}
+
+//
+// TYPES: NFTSwapMetadata
+//
+
+type NFTSwapOperationType uint8
+
+const (
+	// NFTSwapOperationTypePropose proposes a new swap with the counterparty.
+	NFTSwapOperationTypePropose NFTSwapOperationType = 0
+	// NFTSwapOperationTypeAccept accepts the swap with SwapID, which the transactor is the
+	// counterparty of.
+	NFTSwapOperationTypeAccept NFTSwapOperationType = 1
+	// NFTSwapOperationTypeCancel cancels the swap with SwapID. Either party can cancel it.
+	NFTSwapOperationTypeCancel NFTSwapOperationType = 2
+)
+
+type NFTSwapMetadata struct {
+	OperationType NFTSwapOperationType
+	// SwapID is the swap being accepted or canceled. It's unset when proposing a swap.
+	SwapID *BlockHash
+
+	// The terms of a proposed swap. They're unset when accepting or canceling a swap.
+	CounterpartyPublicKey []byte
+	OfferedNFTPostHash    *BlockHash
+	OfferedSerialNumber   uint64
+	RequestedNFTPostHash  *BlockHash
+	RequestedSerialNumber uint64
+	OfferedDESONanos      uint64
+	RequestedDESONanos    uint64
+	ExpirationBlockHeight uint64
+}
+
+func (txnData *NFTSwapMetadata) GetTxnType() TxnType {
+	return TxnTypeNFTSwap
+}
+
+func (txnData *NFTSwapMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, byte(txnData.OperationType))
+	data = append(data, EncodeOptionalBlockHash(txnData.SwapID)...)
+	data = append(data, EncodeByteArray(txnData.CounterpartyPublicKey)...)
+	data = append(data, EncodeOptionalBlockHash(txnData.OfferedNFTPostHash)...)
+	data = append(data, UintToBuf(txnData.OfferedSerialNumber)...)
+	data = append(data, EncodeOptionalBlockHash(txnData.RequestedNFTPostHash)...)
+	data = append(data, UintToBuf(txnData.RequestedSerialNumber)...)
+	data = append(data, UintToBuf(txnData.OfferedDESONanos)...)
+	data = append(data, UintToBuf(txnData.RequestedDESONanos)...)
+	data = append(data, UintToBuf(txnData.ExpirationBlockHeight)...)
+	return data, nil
+}
+
+func (txnData *NFTSwapMetadata) FromBytes(data []byte) error {
+	ret := NFTSwapMetadata{}
+	rr := bytes.NewReader(data)
+	var err error
+
+	operationType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading OperationType: ")
+	}
+	ret.OperationType = NFTSwapOperationType(operationType)
+
+	if ret.SwapID, err = ReadOptionalBlockHash(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading SwapID: ")
+	}
+	if ret.CounterpartyPublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading CounterpartyPublicKey: ")
+	}
+	if ret.OfferedNFTPostHash, err = ReadOptionalBlockHash(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading OfferedNFTPostHash: ")
+	}
+	if ret.OfferedSerialNumber, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading OfferedSerialNumber: ")
+	}
+	if ret.RequestedNFTPostHash, err = ReadOptionalBlockHash(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading RequestedNFTPostHash: ")
+	}
+	if ret.RequestedSerialNumber, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading RequestedSerialNumber: ")
+	}
+	if ret.OfferedDESONanos, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading OfferedDESONanos: ")
+	}
+	if ret.RequestedDESONanos, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading RequestedDESONanos: ")
+	}
+	if ret.ExpirationBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTSwapMetadata.FromBytes: Problem reading ExpirationBlockHeight: ")
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *NFTSwapMetadata) New() DeSoTxnMetadata {
+	return &NFTSwapMetadata{}
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForNFTSwapEntry(swapID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixNFTSwapByID...)
+	key = append(key, swapID[:]...)
+	return key
+}
+
+func DBKeyForNFTSwapByPKID(pkid *PKID, swapID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixNFTSwapIDByPKID...)
+	key = append(key, pkid.ToBytes()...)
+	key = append(key, swapID[:]...)
+	return key
+}
+
+func DBGetNFTSwapEntry(handle *badger.DB, snap *Snapshot, swapID *BlockHash) (*NFTSwapEntry, error) {
+	var ret *NFTSwapEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetNFTSwapEntryWithTxn(txn, snap, swapID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetNFTSwapEntryWithTxn(txn *badger.Txn, snap *Snapshot, swapID *BlockHash) (*NFTSwapEntry, error) {
+	// Retrieve NFTSwapEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForNFTSwapEntry(swapID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetNFTSwapEntry: problem retrieving NFTSwapEntry: ")
+	}
+
+	// Decode NFTSwapEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&NFTSwapEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetNFTSwapEntry: problem decoding NFTSwapEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetNFTSwapEntriesForPKID returns the swaps the user has proposed or been proposed.
+func DBGetNFTSwapEntriesForPKID(handle *badger.DB, snap *Snapshot, pkid *PKID) ([]*NFTSwapEntry, error) {
+	prefix := append([]byte{}, Prefixes.PrefixNFTSwapIDByPKID...)
+	prefix = append(prefix, pkid.ToBytes()...)
+	keysFound, _ := EnumerateKeysForPrefix(handle, prefix, true)
+
+	var entries []*NFTSwapEntry
+	for _, key := range keysFound {
+		if len(key) != len(prefix)+HashSizeBytes {
+			return nil, fmt.Errorf("DBGetNFTSwapEntriesForPKID: invalid index key length %d", len(key))
+		}
+		swapID := NewBlockHash(key[len(prefix):])
+		entry, err := DBGetNFTSwapEntry(handle, snap, swapID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetNFTSwapEntriesForPKID: ")
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("DBGetNFTSwapEntriesForPKID: NFT swap %v is indexed but "+
+				"doesn't exist", swapID)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutNFTSwapEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *NFTSwapEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForNFTSwapEntry(entry.SwapID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutNFTSwapEntryWithTxn: problem storing NFTSwapEntry: ")
+	}
+	// The swap is indexed under both of its parties.
+	for _, pkid := range []*PKID{entry.ProposerPKID, entry.CounterpartyPKID} {
+		indexKey := DBKeyForNFTSwapByPKID(pkid, entry.SwapID)
+		if err := DBSetWithTxn(txn, snap, indexKey, []byte{}, eventManager); err != nil {
+			return errors.Wrapf(err, "DBPutNFTSwapEntryWithTxn: problem storing NFT swap index: ")
+		}
+	}
+	return nil
+}
+
+func DBDeleteNFTSwapEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *NFTSwapEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForNFTSwapEntry(entry.SwapID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteNFTSwapEntryWithTxn: problem deleting NFTSwapEntry: ")
+	}
+	for _, pkid := range []*PKID{entry.ProposerPKID, entry.CounterpartyPKID} {
+		indexKey := DBKeyForNFTSwapByPKID(pkid, entry.SwapID)
+		if err := DBDeleteWithTxn(txn, snap, indexKey, eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(err, "DBDeleteNFTSwapEntryWithTxn: problem deleting NFT swap index: ")
+		}
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetNFTSwapEntry returns the NFT swap, or nil if it isn't pending.
+func (bav *UtxoView) GetNFTSwapEntry(swapID *BlockHash) (*NFTSwapEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.NFTSwapIDToNFTSwapEntry[*swapID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetNFTSwapEntry(swapID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetNFTSwapEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the NFTSwapEntry from the db in the UtxoView.
+		bav._setNFTSwapEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetNFTSwapEntriesForPKID returns the pending swaps the user has proposed or been proposed,
+// including the swaps in the view.
+func (bav *UtxoView) GetNFTSwapEntriesForPKID(pkid *PKID) ([]*NFTSwapEntry, error) {
+	dbEntries, err := bav.GetDbAdapter().GetNFTSwapEntriesForPKID(pkid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetNFTSwapEntriesForPKID: ")
+	}
+	for _, dbEntry := range dbEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		if _, exists := bav.NFTSwapIDToNFTSwapEntry[*dbEntry.SwapID]; !exists {
+			bav._setNFTSwapEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*NFTSwapEntry
+	for _, entry := range bav.NFTSwapIDToNFTSwapEntry {
+		if !entry.isDeleted && (entry.ProposerPKID.Eq(pkid) || entry.CounterpartyPKID.Eq(pkid)) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (bav *UtxoView) _setNFTSwapEntryMappings(entry *NFTSwapEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setNFTSwapEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.NFTSwapIDToNFTSwapEntry[*entry.SwapID] = entry
+}
+
+func (bav *UtxoView) _deleteNFTSwapEntryMappings(entry *NFTSwapEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteNFTSwapEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setNFTSwapEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushNFTSwapEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Delete every swap in the view first, since a swap's indexes have to be removed along
+	// with it. The swaps that aren't deleted are put back below.
+	for mapKeyIter, entryIter := range bav.NFTSwapIDToNFTSwapEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.SwapID.IsEqual(&mapKey) {
+			return fmt.Errorf("_flushNFTSwapEntriesToDbWithTxn: NFTSwapEntry SwapID %v "+
+				"doesn't match MapKey %v", entry.SwapID, &mapKey)
+		}
+
+		if err := DBDeleteNFTSwapEntryWithTxn(
+			txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+		); err != nil {
+			return errors.Wrapf(err, "_flushNFTSwapEntriesToDbWithTxn: ")
+		}
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutNFTSwapEntryWithTxn(
+			txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushNFTSwapEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
+
+// _validateNFTSwapNFT checks that the owner can swap the NFT at blockHeight, and returns its
+// entry. The NFT can't be for sale, changing hands, or held by anyone else in the meantime,
+// and it can't have unlockable content.
+func (bav *UtxoView) _validateNFTSwapNFT(
+	nftPostHash *BlockHash, serialNumber uint64, ownerPKID *PKID, blockHeight uint32) (*NFTEntry, error) {
+
+	if nftPostHash == nil {
+		return nil, RuleErrorNFTSwapNonExistentNFT
+	}
+	nftKey := MakeNFTKey(nftPostHash, serialNumber)
+	nftEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+	if nftEntry == nil || nftEntry.isDeleted {
+		return nil, RuleErrorNFTSwapNonExistentNFT
+	}
+	if !nftEntry.OwnerPKID.Eq(ownerPKID) {
+		return nil, RuleErrorNFTSwapNFTNotOwnedByParty
+	}
+	if nftEntry.IsForSale {
+		return nil, RuleErrorNFTSwapNFTIsForSale
+	}
+	if nftEntry.IsPending {
+		return nil, RuleErrorNFTSwapNFTIsPending
+	}
+	if nftEntry.IsLeaseActive(uint64(blockHeight)) {
+		return nil, RuleErrorNFTSwapNFTIsLeased
+	}
+	postEntry := bav.GetPostEntryForPostHash(nftPostHash)
+	if postEntry == nil || postEntry.isDeleted {
+		return nil, RuleErrorNFTSwapNonExistentNFT
+	}
+	if postEntry.HasUnlockable {
+		return nil, RuleErrorNFTSwapNFTHasUnlockable
+	}
+	return nftEntry, nil
+}
+
+// _checkNFTSwapBalance checks that the public key can spend amountNanos in the block at
+// blockHeight.
+func (bav *UtxoView) _checkNFTSwapBalance(publicKey []byte, amountNanos uint64, blockHeight uint32) error {
+	if amountNanos == 0 {
+		return nil
+	}
+	// We assume the tip is right before the block in which this txn is about to be applied.
+	balanceNanos, err := bav.GetSpendableDeSoBalanceNanosForPublicKey(publicKey, blockHeight-1)
+	if err != nil {
+		return errors.Wrapf(err, "_checkNFTSwapBalance: Problem getting balance: ")
+	}
+	if balanceNanos < amountNanos {
+		return errors.Wrapf(RuleErrorNFTSwapInsufficientBalance,
+			"_checkNFTSwapBalance: balance %d < amount %d", balanceNanos, amountNanos)
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectNFTSwap(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.NFTSwapBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTSwapBeforeBlockHeight, "_connectNFTSwap: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeNFTSwap {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectNFTSwap: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*NFTSwapMetadata)
+
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectNFTSwap: PKID for transactor %v not found",
+			PkToStringBoth(txn.PublicKey))
+	}
+	transactorPKID := transactorPKIDEntry.PKID
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectNFTSwap: ")
+	}
+
+	switch txMeta.OperationType {
+	case NFTSwapOperationTypePropose:
+		escrowUtxoOp, err := bav._connectProposeNFTSwap(txn, txMeta, txHash, transactorPKID, blockHeight)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTSwap: ")
+		}
+		if escrowUtxoOp != nil {
+			utxoOpsForTxn = append(utxoOpsForTxn, escrowUtxoOp)
+		}
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type: OperationTypeNFTSwap,
+		})
+
+	case NFTSwapOperationTypeAccept:
+		swapEntry, err := bav._getNFTSwapEntryForTxn(txMeta)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTSwap: ")
+		}
+		prevSwapEntry := swapEntry.Copy()
+		prevOfferedNFTEntry, prevRequestedNFTEntry, escrowUtxoOp, err := bav._connectAcceptNFTSwap(
+			txn, swapEntry, transactorPKID, blockHeight)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTSwap: ")
+		}
+		if escrowUtxoOp != nil {
+			utxoOpsForTxn = append(utxoOpsForTxn, escrowUtxoOp)
+		}
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type:                  OperationTypeNFTSwap,
+			PrevNFTSwapEntry:      prevSwapEntry,
+			PrevNFTEntry:          prevOfferedNFTEntry,
+			PrevRequestedNFTEntry: prevRequestedNFTEntry,
+		})
+
+	case NFTSwapOperationTypeCancel:
+		swapEntry, err := bav._getNFTSwapEntryForTxn(txMeta)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTSwap: ")
+		}
+		if !swapEntry.ProposerPKID.Eq(transactorPKID) && !swapEntry.CounterpartyPKID.Eq(transactorPKID) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorNFTSwapCancelByNonParty, "_connectNFTSwap: ")
+		}
+		prevSwapEntry := swapEntry.Copy()
+		// Refund the proposer's escrowed DESO.
+		if swapEntry.OfferedDESONanos > 0 {
+			escrowUtxoOp, err := bav._refundEscrow(swapEntry.SwapID, blockHeight)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectNFTSwap: Problem refunding escrow: ")
+			}
+			utxoOpsForTxn = append(utxoOpsForTxn, escrowUtxoOp)
+		}
+		bav._deleteNFTSwapEntryMappings(swapEntry)
+		utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+			Type:             OperationTypeNFTSwap,
+			PrevNFTSwapEntry: prevSwapEntry,
+		})
+
+	default:
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTSwapInvalidOperationType,
+			"_connectNFTSwap: %d", txMeta.OperationType)
+	}
+
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+// _getNFTSwapEntryForTxn returns the pending swap that an Accept or Cancel txn refers to.
+func (bav *UtxoView) _getNFTSwapEntryForTxn(txMeta *NFTSwapMetadata) (*NFTSwapEntry, error) {
+	if txMeta.SwapID == nil {
+		return nil, errors.Wrapf(RuleErrorNFTSwapNotFound, "_getNFTSwapEntryForTxn: SwapID is unset")
+	}
+	swapEntry, err := bav.GetNFTSwapEntry(txMeta.SwapID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getNFTSwapEntryForTxn: ")
+	}
+	if swapEntry == nil {
+		return nil, errors.Wrapf(RuleErrorNFTSwapNotFound, "_getNFTSwapEntryForTxn: %v", txMeta.SwapID)
+	}
+	return swapEntry, nil
+}
+
+// _connectProposeNFTSwap validates the proposed swap, escrows the proposer's DESO, and creates
+// a pending swap with the txn's hash as its SwapID. It returns the escrow's UtxoOperation, or
+// nil if the proposer doesn't add DESO.
+func (bav *UtxoView) _connectProposeNFTSwap(txn *MsgDeSoTxn, txMeta *NFTSwapMetadata,
+	txHash *BlockHash, proposerPKID *PKID, blockHeight uint32) (*UtxoOperation, error) {
+
+	if len(txMeta.CounterpartyPublicKey) != btcec.PubKeyBytesLenCompressed {
+		return nil, RuleErrorNFTSwapInvalidCounterpartyPublicKey
+	}
+	counterpartyPKIDEntry := bav.GetPKIDForPublicKey(txMeta.CounterpartyPublicKey)
+	if counterpartyPKIDEntry == nil || counterpartyPKIDEntry.isDeleted {
+		return nil, errors.Wrapf(RuleErrorNFTSwapInvalidCounterpartyPublicKey,
+			"_connectProposeNFTSwap: PKID for counterparty not found")
+	}
+	counterpartyPKID := counterpartyPKIDEntry.PKID
+	if counterpartyPKID.Eq(proposerPKID) {
+		return nil, RuleErrorNFTSwapWithSelf
+	}
+	if txMeta.ExpirationBlockHeight < uint64(blockHeight) {
+		return nil, errors.Wrapf(RuleErrorNFTSwapExpirationInPast,
+			"_connectProposeNFTSwap: expiration %d < block height %d", txMeta.ExpirationBlockHeight, blockHeight)
+	}
+
+	// The offered NFT has to be swappable now. The requested NFT only has to be the
+	// counterparty's, since they can take it off sale before accepting.
+	if _, err := bav._validateNFTSwapNFT(
+		txMeta.OfferedNFTPostHash, txMeta.OfferedSerialNumber, proposerPKID, blockHeight); err != nil {
+		return nil, errors.Wrapf(err, "_connectProposeNFTSwap: offered NFT: ")
+	}
+	if txMeta.RequestedNFTPostHash == nil {
+		return nil, errors.Wrapf(RuleErrorNFTSwapNonExistentNFT, "_connectProposeNFTSwap: requested NFT: ")
+	}
+	requestedNFTKey := MakeNFTKey(txMeta.RequestedNFTPostHash, txMeta.RequestedSerialNumber)
+	requestedNFTEntry := bav.GetNFTEntryForNFTKey(&requestedNFTKey)
+	if requestedNFTEntry == nil || requestedNFTEntry.isDeleted {
+		return nil, errors.Wrapf(RuleErrorNFTSwapNonExistentNFT, "_connectProposeNFTSwap: requested NFT: ")
+	}
+	if !requestedNFTEntry.OwnerPKID.Eq(counterpartyPKID) {
+		return nil, errors.Wrapf(RuleErrorNFTSwapNFTNotOwnedByParty, "_connectProposeNFTSwap: requested NFT: ")
+	}
+
+	// Escrow the proposer's DESO until the swap is accepted or canceled.
+	var escrowUtxoOp *UtxoOperation
+	if txMeta.OfferedDESONanos > 0 {
+		if err := bav._checkNFTSwapBalance(txn.PublicKey, txMeta.OfferedDESONanos, blockHeight); err != nil {
+			return nil, errors.Wrapf(err, "_connectProposeNFTSwap: ")
+		}
+		var err error
+		escrowUtxoOp, err = bav._lockEscrow(&EscrowEntry{
+			EscrowID:                   txHash,
+			OwnerPKID:                  proposerPKID,
+			BeneficiaryPKID:            counterpartyPKID,
+			AssetCreatorPKID:           &ZeroPKID,
+			AmountBaseUnits:            uint256.NewInt().SetUint64(txMeta.OfferedDESONanos),
+			ExpirationBlockHeight:      txMeta.ExpirationBlockHeight,
+			RefundableBeforeExpiration: true,
+		}, blockHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "_connectProposeNFTSwap: Problem escrowing DESO: ")
+		}
+	}
+
+	bav._setNFTSwapEntryMappings(&NFTSwapEntry{
+		SwapID:                txHash.NewBlockHash(),
+		ProposerPKID:          proposerPKID.NewPKID(),
+		CounterpartyPKID:      counterpartyPKID.NewPKID(),
+		OfferedNFTPostHash:    txMeta.OfferedNFTPostHash.NewBlockHash(),
+		OfferedSerialNumber:   txMeta.OfferedSerialNumber,
+		RequestedNFTPostHash:  txMeta.RequestedNFTPostHash.NewBlockHash(),
+		RequestedSerialNumber: txMeta.RequestedSerialNumber,
+		OfferedDESONanos:      txMeta.OfferedDESONanos,
+		RequestedDESONanos:    txMeta.RequestedDESONanos,
+		ExpirationBlockHeight: txMeta.ExpirationBlockHeight,
+	})
+	return escrowUtxoOp, nil
+}
+
+// _connectAcceptNFTSwap swaps the NFTs and pays out the DESO of both parties, then removes the
+// swap. It returns the NFT entries prior to the swap and the UtxoOperation that released the
+// escrow, if the proposer added DESO.
+func (bav *UtxoView) _connectAcceptNFTSwap(txn *MsgDeSoTxn, swapEntry *NFTSwapEntry,
+	counterpartyPKID *PKID, blockHeight uint32) (
+	_prevOfferedNFTEntry *NFTEntry, _prevRequestedNFTEntry *NFTEntry, _escrowUtxoOp *UtxoOperation, _err error) {
+
+	if !swapEntry.CounterpartyPKID.Eq(counterpartyPKID) {
+		return nil, nil, nil, RuleErrorNFTSwapAcceptByNonCounterparty
+	}
+	if uint64(blockHeight) > swapEntry.ExpirationBlockHeight {
+		return nil, nil, nil, errors.Wrapf(RuleErrorNFTSwapExpired,
+			"_connectAcceptNFTSwap: block height %d > expiration %d", blockHeight, swapEntry.ExpirationBlockHeight)
+	}
+
+	// Check both NFTs and the counterparty's balance before anything changes hands.
+	offeredNFTEntry, err := bav._validateNFTSwapNFT(
+		swapEntry.OfferedNFTPostHash, swapEntry.OfferedSerialNumber, swapEntry.ProposerPKID, blockHeight)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "_connectAcceptNFTSwap: offered NFT: ")
+	}
+	requestedNFTEntry, err := bav._validateNFTSwapNFT(
+		swapEntry.RequestedNFTPostHash, swapEntry.RequestedSerialNumber, counterpartyPKID, blockHeight)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "_connectAcceptNFTSwap: requested NFT: ")
+	}
+	if err = bav._checkNFTSwapBalance(txn.PublicKey, swapEntry.RequestedDESONanos, blockHeight); err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "_connectAcceptNFTSwap: ")
+	}
+
+	// The entries aren't modified by the swap, so they're kept as they are for disconnecting.
+	bav._swapNFTOwner(offeredNFTEntry, counterpartyPKID)
+	bav._swapNFTOwner(requestedNFTEntry, swapEntry.ProposerPKID)
+
+	// Pay the escrowed DESO to the counterparty, and the counterparty's DESO to the proposer.
+	proposerPublicKey := bav.GetPublicKeyForPKID(swapEntry.ProposerPKID)
+	var escrowUtxoOp *UtxoOperation
+	if swapEntry.OfferedDESONanos > 0 {
+		escrowUtxoOp, err = bav._releaseEscrow(swapEntry.SwapID, counterpartyPKID,
+			uint256.NewInt().SetUint64(swapEntry.OfferedDESONanos), blockHeight)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "_connectAcceptNFTSwap: Problem releasing escrow: ")
+		}
+	}
+	if swapEntry.RequestedDESONanos > 0 {
+		if _, err = bav._spendBalance(swapEntry.RequestedDESONanos, txn.PublicKey, blockHeight-1); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "_connectAcceptNFTSwap: Problem spending DESO: ")
+		}
+		if _, err = bav._addBalance(swapEntry.RequestedDESONanos, proposerPublicKey); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "_connectAcceptNFTSwap: Problem paying DESO: ")
+		}
+	}
+
+	bav._deleteNFTSwapEntryMappings(swapEntry)
+	return offeredNFTEntry, requestedNFTEntry, escrowUtxoOp, nil
+}
+
+// _swapNFTOwner gives the NFT to its new owner in a swap.
+func (bav *UtxoView) _swapNFTOwner(nftEntry *NFTEntry, newOwnerPKID *PKID) {
+	newNFTEntry := *nftEntry
+	newNFTEntry.LastOwnerPKID = nftEntry.OwnerPKID
+	newNFTEntry.OwnerPKID = newOwnerPKID.NewPKID()
+	bav._deleteNFTEntryMappings(nftEntry)
+	bav._setNFTEntryMappings(&newNFTEntry)
+}
+
+func (bav *UtxoView) _disconnectNFTSwap(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.NFTSwapBlockHeight {
+		return errors.Wrapf(RuleErrorNFTSwapBeforeBlockHeight, "_disconnectNFTSwap: ")
+	}
+
+	// Validate the last operation is an NFTSwap operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectNFTSwap: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeNFTSwap {
+		return fmt.Errorf(
+			"_disconnectNFTSwap: trying to revert %v but found %v",
+			OperationTypeNFTSwap,
+			operationData.Type,
+		)
+	}
+	txMeta := currentTxn.TxnMeta.(*NFTSwapMetadata)
+
+	switch txMeta.OperationType {
+	case NFTSwapOperationTypePropose:
+		// The txn proposed the swap, so remove it. It can't have been accepted or canceled
+		// yet, since those txns would have been disconnected first.
+		swapEntry, err := bav.GetNFTSwapEntry(txHash)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectNFTSwap: ")
+		}
+		if swapEntry == nil {
+			return fmt.Errorf("_disconnectNFTSwap: proposed NFT swap %v not found", txHash)
+		}
+		bav._deleteNFTSwapEntryMappings(swapEntry)
+
+	case NFTSwapOperationTypeAccept:
+		prevSwapEntry := operationData.PrevNFTSwapEntry
+		if prevSwapEntry == nil || operationData.PrevNFTEntry == nil || operationData.PrevRequestedNFTEntry == nil {
+			return fmt.Errorf("_disconnectNFTSwap: prev NFT swap or NFT entries don't exist; " +
+				"this should never happen")
+		}
+		proposerPublicKey := bav.GetPublicKeyForPKID(prevSwapEntry.ProposerPKID)
+		if prevSwapEntry.RequestedDESONanos > 0 {
+			if err := bav._unAddBalance(prevSwapEntry.RequestedDESONanos, proposerPublicKey); err != nil {
+				return errors.Wrapf(err, "_disconnectNFTSwap: ")
+			}
+			if err := bav._unSpendBalance(prevSwapEntry.RequestedDESONanos, currentTxn.PublicKey); err != nil {
+				return errors.Wrapf(err, "_disconnectNFTSwap: ")
+			}
+		}
+		// Setting the prev NFT entries replaces the swapped ones, since they share NFT keys.
+		bav._setNFTEntryMappings(operationData.PrevRequestedNFTEntry)
+		bav._setNFTEntryMappings(operationData.PrevNFTEntry)
+		bav._setNFTSwapEntryMappings(prevSwapEntry)
+
+	case NFTSwapOperationTypeCancel:
+		prevSwapEntry := operationData.PrevNFTSwapEntry
+		if prevSwapEntry == nil {
+			return fmt.Errorf("_disconnectNFTSwap: prev NFT swap entry doesn't exist; " +
+				"this should never happen")
+		}
+		bav._setNFTSwapEntryMappings(prevSwapEntry)
+
+	default:
+		return fmt.Errorf("_disconnectNFTSwap: invalid operation type %d", txMeta.OperationType)
+	}
+
+	// Revert the escrow's lock, release, or refund.
+	basicTransferUtxoOps, err := bav._disconnectEscrowOperations(utxoOpsForTxn[:operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectNFTSwap: ")
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, basicTransferUtxoOps, blockHeight,
+	)
+}
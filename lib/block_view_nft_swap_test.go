@@ -0,0 +1,218 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTSwapConnectAndDisconnect(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.NFTSwapBlockHeight = 0
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	// The db has no best chain, so give the view a tip that CopyUtxoView can copy.
+	utxoView.TipHash = &BlockHash{}
+	blockHeight := uint32(10)
+	expirationBlockHeight := uint64(20)
+
+	// m0 and m1 each own an NFT and 1000 nanos, and m2 has nanos to pay fees.
+	proposerPKID := NewPKID(m0PkBytes)
+	counterpartyPKID := NewPKID(m1PkBytes)
+	offeredPostHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	requestedPostHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	for _, nftEntry := range []*NFTEntry{
+		{OwnerPKID: proposerPKID, NFTPostHash: offeredPostHash, SerialNumber: 1},
+		{OwnerPKID: counterpartyPKID, NFTPostHash: requestedPostHash, SerialNumber: 1},
+	} {
+		utxoView._setPostEntryMappings(&PostEntry{
+			PostHash:        nftEntry.NFTPostHash,
+			PosterPublicKey: utxoView.GetPublicKeyForPKID(nftEntry.OwnerPKID),
+			IsNFT:           true,
+			NumNFTCopies:    1,
+		})
+		utxoView._setNFTEntryMappings(nftEntry)
+	}
+	for _, publicKey := range [][]byte{m0PkBytes, m1PkBytes, m2PkBytes} {
+		_, err := utxoView._addBalance(1000, publicKey)
+		require.NoError(err)
+	}
+
+	nextPartialID := uint64(0)
+	makeTxn := func(publicKey []byte, txnMeta *NFTSwapMetadata) *MsgDeSoTxn {
+		nextPartialID++
+		return &MsgDeSoTxn{
+			TxnVersion:  DeSoTxnVersion1,
+			TxnMeta:     txnMeta,
+			PublicKey:   publicKey,
+			TxnFeeNanos: 10,
+			TxnNonce:    &DeSoNonce{ExpirationBlockHeight: 100, PartialID: nextPartialID},
+		}
+	}
+	connect := func(view *UtxoView, txn *MsgDeSoTxn, blockHeight uint32) ([]*UtxoOperation, error) {
+		_, _, utxoOps, err := view._connectNFTSwap(txn, txn.Hash(), blockHeight, false)
+		return utxoOps, err
+	}
+	// A failed connect leaves the view dirty, so it's tried on a copy.
+	requireConnectError := func(view *UtxoView, txn *MsgDeSoTxn, blockHeight uint32, ruleError RuleError) {
+		_, err := connect(view.CopyUtxoView(), txn, blockHeight)
+		require.Error(err)
+		require.Contains(err.Error(), ruleError)
+	}
+	disconnect := func(txn *MsgDeSoTxn, utxoOps []*UtxoOperation, blockHeight uint32) {
+		require.NoError(utxoView._disconnectNFTSwap(OperationTypeNFTSwap, txn, txn.Hash(), utxoOps, blockHeight))
+	}
+	requireBalances := func(proposerBalanceNanos uint64, counterpartyBalanceNanos uint64) {
+		balanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+		require.NoError(err)
+		require.Equal(proposerBalanceNanos, balanceNanos)
+		balanceNanos, err = utxoView.GetDeSoBalanceNanosForPublicKey(m1PkBytes)
+		require.NoError(err)
+		require.Equal(counterpartyBalanceNanos, balanceNanos)
+	}
+	requireOwners := func(offeredOwnerPKID *PKID, requestedOwnerPKID *PKID) {
+		offeredNFTKey := MakeNFTKey(offeredPostHash, 1)
+		require.Equal(offeredOwnerPKID, utxoView.GetNFTEntryForNFTKey(&offeredNFTKey).OwnerPKID)
+		requestedNFTKey := MakeNFTKey(requestedPostHash, 1)
+		require.Equal(requestedOwnerPKID, utxoView.GetNFTEntryForNFTKey(&requestedNFTKey).OwnerPKID)
+	}
+	requireSwaps := func(swapIDs ...*BlockHash) {
+		for _, pkid := range []*PKID{proposerPKID, counterpartyPKID} {
+			swapEntries, err := utxoView.GetNFTSwapEntriesForPKID(pkid)
+			require.NoError(err)
+			var entrySwapIDs []*BlockHash
+			for _, swapEntry := range swapEntries {
+				entrySwapIDs = append(entrySwapIDs, swapEntry.SwapID)
+			}
+			require.ElementsMatch(swapIDs, entrySwapIDs)
+		}
+	}
+	requireEscrowNanos := func(swapID *BlockHash, amountNanos uint64) {
+		escrowEntry, err := utxoView.GetEscrowEntry(swapID)
+		require.NoError(err)
+		if amountNanos == 0 {
+			require.Nil(escrowEntry)
+			return
+		}
+		require.NotNil(escrowEntry)
+		require.Equal(amountNanos, escrowEntry.AmountBaseUnits.Uint64())
+	}
+
+	// m0 offers its NFT and 300 nanos for m1's NFT and 200 nanos. The offered nanos are
+	// escrowed and the NFTs don't change hands yet.
+	proposeTxn := makeTxn(m0PkBytes, &NFTSwapMetadata{
+		OperationType:         NFTSwapOperationTypePropose,
+		CounterpartyPublicKey: m1PkBytes,
+		OfferedNFTPostHash:    offeredPostHash,
+		OfferedSerialNumber:   1,
+		RequestedNFTPostHash:  requestedPostHash,
+		RequestedSerialNumber: 1,
+		OfferedDESONanos:      300,
+		RequestedDESONanos:    200,
+		ExpirationBlockHeight: expirationBlockHeight,
+	})
+	swapID := proposeTxn.Hash()
+	proposeUtxoOps, err := connect(utxoView, proposeTxn, blockHeight)
+	require.NoError(err)
+	requireSwaps(swapID)
+	requireEscrowNanos(swapID, 300)
+	requireBalances(690, 1000)
+	requireOwners(proposerPKID, counterpartyPKID)
+
+	// Only the counterparty can accept. Accepting swaps the NFTs and pays out both amounts,
+	// and disconnecting it puts everything back.
+	acceptTxn := makeTxn(m1PkBytes, &NFTSwapMetadata{OperationType: NFTSwapOperationTypeAccept, SwapID: swapID})
+	requireConnectError(utxoView, makeTxn(m0PkBytes, &NFTSwapMetadata{
+		OperationType: NFTSwapOperationTypeAccept, SwapID: swapID,
+	}), blockHeight, RuleErrorNFTSwapAcceptByNonCounterparty)
+	acceptUtxoOps, err := connect(utxoView, acceptTxn, blockHeight)
+	require.NoError(err)
+	requireSwaps()
+	requireEscrowNanos(swapID, 0)
+	requireBalances(890, 1090)
+	requireOwners(counterpartyPKID, proposerPKID)
+	disconnect(acceptTxn, acceptUtxoOps, blockHeight)
+	requireSwaps(swapID)
+	requireEscrowNanos(swapID, 300)
+	requireBalances(690, 1000)
+	requireOwners(proposerPKID, counterpartyPKID)
+
+	// Either party can cancel, which refunds the escrowed nanos.
+	requireConnectError(utxoView, makeTxn(m2PkBytes, &NFTSwapMetadata{
+		OperationType: NFTSwapOperationTypeCancel, SwapID: swapID,
+	}), blockHeight, RuleErrorNFTSwapCancelByNonParty)
+	cancelTxn := makeTxn(m1PkBytes, &NFTSwapMetadata{OperationType: NFTSwapOperationTypeCancel, SwapID: swapID})
+	cancelUtxoOps, err := connect(utxoView, cancelTxn, blockHeight)
+	require.NoError(err)
+	requireSwaps()
+	requireEscrowNanos(swapID, 0)
+	requireBalances(990, 990)
+	disconnect(cancelTxn, cancelUtxoOps, blockHeight)
+	requireSwaps(swapID)
+	requireEscrowNanos(swapID, 300)
+	requireBalances(690, 1000)
+
+	// The swap can be accepted at its expiration height but not after it. Once it's expired,
+	// the proposer can still cancel it to get their nanos back.
+	_, err = connect(utxoView.CopyUtxoView(), acceptTxn, uint32(expirationBlockHeight))
+	require.NoError(err)
+	requireConnectError(utxoView, acceptTxn, uint32(expirationBlockHeight)+1, RuleErrorNFTSwapExpired)
+	expiredCancelTxn := makeTxn(m0PkBytes, &NFTSwapMetadata{OperationType: NFTSwapOperationTypeCancel, SwapID: swapID})
+	expiredCancelUtxoOps, err := connect(utxoView, expiredCancelTxn, uint32(expirationBlockHeight)+1)
+	require.NoError(err)
+	requireSwaps()
+	requireBalances(980, 1000)
+	disconnect(expiredCancelTxn, expiredCancelUtxoOps, uint32(expirationBlockHeight)+1)
+	requireSwaps(swapID)
+	requireEscrowNanos(swapID, 300)
+	requireBalances(690, 1000)
+
+	// Proposing a swap doesn't lock either NFT, so if either of them is listed for sale after
+	// the proposal, the swap can't be accepted until it's taken off sale.
+	for _, nftPostHash := range []*BlockHash{offeredPostHash, requestedPostHash} {
+		listedView := utxoView.CopyUtxoView()
+		nftKey := MakeNFTKey(nftPostHash, 1)
+		listedNFTEntry := *listedView.GetNFTEntryForNFTKey(&nftKey)
+		listedNFTEntry.IsForSale = true
+		listedView._setNFTEntryMappings(&listedNFTEntry)
+		requireConnectError(listedView, acceptTxn, blockHeight, RuleErrorNFTSwapNFTIsForSale)
+	}
+
+	// The counterparty has to be able to pay the requested nanos when they accept.
+	expensiveProposeTxn := makeTxn(m0PkBytes, &NFTSwapMetadata{
+		OperationType:         NFTSwapOperationTypePropose,
+		CounterpartyPublicKey: m1PkBytes,
+		OfferedNFTPostHash:    offeredPostHash,
+		OfferedSerialNumber:   1,
+		RequestedNFTPostHash:  requestedPostHash,
+		RequestedSerialNumber: 1,
+		RequestedDESONanos:    2000,
+		ExpirationBlockHeight: expirationBlockHeight,
+	})
+	expensiveSwapID := expensiveProposeTxn.Hash()
+	expensiveProposeUtxoOps, err := connect(utxoView, expensiveProposeTxn, blockHeight)
+	require.NoError(err)
+	requireSwaps(swapID, expensiveSwapID)
+	requireEscrowNanos(expensiveSwapID, 0)
+	requireBalances(680, 1000)
+	requireConnectError(utxoView, makeTxn(m1PkBytes, &NFTSwapMetadata{
+		OperationType: NFTSwapOperationTypeAccept, SwapID: expensiveSwapID,
+	}), blockHeight, RuleErrorNFTSwapInsufficientBalance)
+
+	// Disconnecting the proposals removes the swaps and refunds the escrow.
+	disconnect(expensiveProposeTxn, expensiveProposeUtxoOps, blockHeight)
+	requireSwaps(swapID)
+	requireBalances(690, 1000)
+	disconnect(proposeTxn, proposeUtxoOps, blockHeight)
+	requireSwaps()
+	requireEscrowNanos(swapID, 0)
+	requireBalances(1000, 1000)
+	requireOwners(proposerPKID, counterpartyPKID)
+}
@@ -1,7 +1,10 @@
+//go:build !deso_lean
+
 package lib
 
 import (
 	"math"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -112,7 +115,7 @@ func _createNFTWithExtraData(t *testing.T, chain *Blockchain, db *badger.DB, par
 		require.Equal(OperationTypeCreateNFT, utxoOps[1].Type)
 	}
 
-	require.NoError(utxoView.FlushToDb(0))
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
 
 	return utxoOps, txn, blockHeight, nil
 }
@@ -326,7 +329,7 @@ func _createNFTBid(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoP
 		require.Equal(OperationTypeNFTBid, utxoOps[len(utxoOps)-1].Type)
 	}
 
-	require.NoError(utxoView.FlushToDb(0))
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
 
 	return utxoOps, txn, blockHeight, nil
 }
@@ -439,7 +442,7 @@ func _acceptNFTBid(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoP
 
 	require.Equal(OperationTypeAcceptNFTBid, utxoOps[numOps-1].Type)
 
-	require.NoError(utxoView.FlushToDb(0))
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
 
 	return utxoOps, txn, blockHeight, nil
 }
@@ -7828,3 +7831,69 @@ func TestNFTSplitsHardcorePKIDBug(t *testing.T) {
 	_disconnectTestMetaTxnsFromViewAndFlush(testMeta)
 	_connectBlockThenDisconnectBlockAndFlush(testMeta)
 }
+
+func TestNFTOwnerIndex(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	postHash1 := &BlockHash{0x01}
+	postHash2 := &BlockHash{0x02}
+
+	// m0 owns two copies of the first post's NFT and one of the second's, and m1 owns the rest.
+	// The index is backfilled from NFTEntries that were stored before it existed.
+	nftEntries := []*NFTEntry{
+		{OwnerPKID: m0PKID, NFTPostHash: postHash2, SerialNumber: 1},
+		{OwnerPKID: m0PKID, NFTPostHash: postHash1, SerialNumber: 2},
+		{OwnerPKID: m1PKID, NFTPostHash: postHash1, SerialNumber: 3},
+		{OwnerPKID: m0PKID, NFTPostHash: postHash1, SerialNumber: 1},
+	}
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		for _, nftEntry := range nftEntries {
+			if err := DBPutNFTEntryMappingsWithTxn(txn, nil, 0, nftEntry, nil); err != nil {
+				return err
+			}
+		}
+		return DBBackfillNFTOwnerIndexWithTxn(txn, nil, nil)
+	}))
+
+	getNFTKeys := func(ownerPKID *PKID, startingNFTKey *NFTKey, limit uint32) []NFTKey {
+		nftEntries, err := DBGetPaginatedNFTEntriesForOwnerPKID(db, nil, ownerPKID, startingNFTKey, limit)
+		require.NoError(err)
+		var nftKeys []NFTKey
+		for _, nftEntry := range nftEntries {
+			nftKeys = append(nftKeys, MakeNFTKey(nftEntry.NFTPostHash, nftEntry.SerialNumber))
+		}
+		return nftKeys
+	}
+
+	// m0's NFTs are returned in order, a page at a time.
+	firstPage := getNFTKeys(m0PKID, nil, 2)
+	require.Equal([]NFTKey{MakeNFTKey(postHash1, 1), MakeNFTKey(postHash1, 2)}, firstPage)
+	require.Equal([]NFTKey{MakeNFTKey(postHash2, 1)}, getNFTKeys(m0PKID, &firstPage[1], 2))
+	require.Empty(getNFTKeys(m0PKID, &NFTKey{NFTPostHash: *postHash2, SerialNumber: 1}, 2))
+	require.Equal([]NFTKey{MakeNFTKey(postHash1, 3)}, getNFTKeys(m1PKID, nil, 10))
+
+	// When m1's NFT is transferred to m0, it moves to m0's part of the index.
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		if err := DBDeleteNFTOwnerIndexWithTxn(txn, nil, postHash1, 3, nil, false); err != nil {
+			return err
+		}
+		if err := DBDeleteNFTMappingsWithTxn(txn, nil, postHash1, 3, nil, false); err != nil {
+			return err
+		}
+		transferredNFTEntry := &NFTEntry{
+			LastOwnerPKID: m1PKID, OwnerPKID: m0PKID, NFTPostHash: postHash1, SerialNumber: 3,
+		}
+		if err := DBPutNFTEntryMappingsWithTxn(txn, nil, 0, transferredNFTEntry, nil); err != nil {
+			return err
+		}
+		return DBPutNFTOwnerIndexWithTxn(txn, nil, transferredNFTEntry, nil)
+	}))
+	require.Empty(getNFTKeys(m1PKID, nil, 10))
+	require.Equal([]NFTKey{MakeNFTKey(postHash1, 3), MakeNFTKey(postHash2, 1)}, getNFTKeys(m0PKID, &firstPage[1], 10))
+}
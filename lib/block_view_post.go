@@ -13,7 +13,6 @@ import (
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/davecgh/go-spew/spew"
-	"github.com/dgraph-io/badger/v3"
 	"github.com/gernest/mention"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
@@ -29,8 +28,7 @@ func (bav *UtxoView) _getRepostEntryForRepostKey(repostKey *RepostKey) *RepostEn
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil. Either way, save the value to the in-memory view mapping got later.
-	repostEntry := DbReposterPubKeyRepostedPostHashToRepostEntry(bav.Handle, bav.Snapshot,
-		repostKey.ReposterPubKey[:], repostKey.RepostedPostHash)
+	repostEntry := bav.GetDbAdapter().GetRepostEntry(repostKey.ReposterPubKey[:], repostKey.RepostedPostHash)
 	if repostEntry != nil {
 		bav._setRepostEntryMappings(repostEntry)
 	}
@@ -97,22 +95,8 @@ func (bav *UtxoView) GetDiamondEntryForDiamondKey(diamondKey *DiamondKey) *Diamo
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
-	var diamondEntry *DiamondEntry
-	if bav.Postgres != nil {
-		diamond := bav.Postgres.GetDiamond(&diamondKey.SenderPKID, &diamondKey.ReceiverPKID, &diamondKey.DiamondPostHash)
-		if diamond != nil {
-			diamondEntry = &DiamondEntry{
-				SenderPKID:      diamond.SenderPKID,
-				ReceiverPKID:    diamond.ReceiverPKID,
-				DiamondPostHash: diamond.DiamondPostHash,
-				DiamondLevel:    int64(diamond.DiamondLevel),
-			}
-		}
-	} else {
-		diamondEntry = DbGetDiamondMappings(bav.Handle, bav.Snapshot,
-			&diamondKey.ReceiverPKID, &diamondKey.SenderPKID, &diamondKey.DiamondPostHash)
-	}
-
+	diamondEntry := bav.GetDbAdapter().GetDiamondEntry(
+		&diamondKey.SenderPKID, &diamondKey.ReceiverPKID, &diamondKey.DiamondPostHash)
 	if diamondEntry != nil {
 		bav._setDiamondEntryMappings(diamondEntry)
 	}
@@ -130,26 +114,18 @@ func (bav *UtxoView) GetPostEntryForPostHash(postHash *BlockHash) *PostEntry {
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
-	if bav.Postgres != nil {
-		post := bav.Postgres.GetPost(postHash)
-		if post != nil {
-			return bav.setPostMappings(post)
-		}
-		return nil
-	} else {
-		dbPostEntry := DBGetPostEntryByPostHash(bav.Handle, bav.Snapshot, postHash)
-		if dbPostEntry != nil {
-			bav._setPostEntryMappings(dbPostEntry)
-		}
-		return dbPostEntry
+	dbPostEntry := bav.GetDbAdapter().GetPostEntryForPostHash(postHash)
+	if dbPostEntry != nil {
+		bav._setPostEntryMappings(dbPostEntry)
 	}
+	return dbPostEntry
 }
 
 func (bav *UtxoView) GetDiamondEntryMapForPublicKey(publicKey []byte, fetchYouDiamonded bool,
 ) (_pkidToDiamondsMap map[PKID][]*DiamondEntry, _err error) {
 	pkidEntry := bav.GetPKIDForPublicKey(publicKey)
 
-	dbPKIDToDiamondsMap, err := DbGetPKIDsThatDiamondedYouMap(bav.Handle, pkidEntry.PKID, fetchYouDiamonded)
+	dbPKIDToDiamondsMap, err := bav.GetDbAdapter().GetPKIDsThatDiamondedYouMap(pkidEntry.PKID, fetchYouDiamonded)
 	if err != nil {
 		return nil, errors.Wrapf(err, "GetDiamondEntryMapForPublicKey: Error Getting "+
 			"PKIDs that diamonded you map from the DB.")
@@ -197,7 +173,7 @@ func (bav *UtxoView) GetDiamondEntriesForSenderToReceiver(receiverPublicKey []by
 
 	receiverPKIDEntry := bav.GetPKIDForPublicKey(receiverPublicKey)
 	senderPKIDEntry := bav.GetPKIDForPublicKey(senderPublicKey)
-	dbDiamondEntries, err := DbGetDiamondEntriesForSenderToReceiver(bav.Handle, receiverPKIDEntry.PKID, senderPKIDEntry.PKID)
+	dbDiamondEntries, err := bav.GetDbAdapter().GetDiamondEntriesForSenderToReceiver(receiverPKIDEntry.PKID, senderPKIDEntry.PKID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "GetDiamondEntriesForGiverToReceiver: Error getting diamond entries from DB.")
 	}
@@ -307,21 +283,15 @@ func (bav *UtxoView) GetRepostPostEntryStateForReader(readerPK []byte, postHash
 }
 
 func (bav *UtxoView) GetCommentEntriesForParentStakeID(parentStakeID []byte) ([]*PostEntry, error) {
-	if bav.Postgres != nil {
-		posts := bav.Postgres.GetComments(NewBlockHash(parentStakeID))
-		for _, post := range posts {
-			bav.setPostMappings(post)
-		}
-	} else {
-		_, dbCommentHashes, _, err := DBGetCommentPostHashesForParentStakeID(
-			bav.Handle, bav.Snapshot, parentStakeID, false)
-		if err != nil {
-			return nil, errors.Wrapf(err, "GetCommentEntriesForParentStakeID: Problem fetching comments: %v", err)
-		}
+	dbCommentEntries, err := bav.GetDbAdapter().GetCommentEntriesForParentStakeID(parentStakeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetCommentEntriesForParentStakeID: ")
+	}
 
-		// Load comment hashes into the view.
-		for _, commentHash := range dbCommentHashes {
-			bav.GetPostEntryForPostHash(commentHash)
+	// Load the comments the view doesn't have yet into the view.
+	for _, dbCommentEntry := range dbCommentEntries {
+		if _, exists := bav.PostHashToPostEntry[*dbCommentEntry.PostHash]; !exists {
+			bav._setPostEntryMappings(dbCommentEntry)
 		}
 	}
 
@@ -390,7 +360,7 @@ func (bav *UtxoView) GetAllPosts() (_corePosts []*PostEntry, _commentsByPostHash
 	//
 	// TODO(performance): This currently fetches all posts. We should implement
 	// some kind of pagination instead though.
-	_, _, dbPostEntries, err := DBGetAllPostsByTstamp(bav.Handle, bav.Snapshot, true)
+	_, _, dbPostEntries, err := bav.GetDbAdapter().GetAllPostsByTstamp(true)
 	if err != nil {
 		return nil, nil, errors.Wrapf(err, "GetAllPosts: Problem fetching PostEntry's from db: ")
 	}
@@ -415,8 +385,8 @@ func (bav *UtxoView) GetAllPosts() (_corePosts []*PostEntry, _commentsByPostHash
 		// comments.
 
 		if len(postEntry.ParentStakeID) == 0 {
-			_, dbCommentHashes, _, err := DBGetCommentPostHashesForParentStakeID(
-				bav.Handle, bav.Snapshot, postEntry.ParentStakeID, false)
+			_, dbCommentHashes, _, err := bav.GetDbAdapter().GetCommentPostHashesForParentStakeID(
+				postEntry.ParentStakeID, false)
 			if err != nil {
 				return nil, nil, errors.Wrapf(err, "GetAllPosts: Problem fetching comment PostEntry's from db: ")
 			}
@@ -484,8 +454,6 @@ func (bav *UtxoView) GetPostsPaginatedForPublicKeyOrderedByTimestamp(publicKey [
 			bav.setPostMappings(post)
 		}
 	} else {
-		handle := bav.Handle
-		// FIXME: Db operation like this shouldn't happen in utxoview.
 		dbPrefix := append([]byte{}, Prefixes.PrefixPosterPublicKeyTimestampPostHash...)
 		dbPrefix = append(dbPrefix, publicKey...)
 		var prefix []byte
@@ -502,55 +470,47 @@ func (bav *UtxoView) GetPostsPaginatedForPublicKeyOrderedByTimestamp(publicKey [
 		}
 		timestampSizeBytes := 8
 		var posts []*PostEntry
-		err := handle.View(func(txn *badger.Txn) error {
-			opts := badger.DefaultIteratorOptions
-
-			opts.PrefetchValues = false
+		// Go in reverse order, skipping the first post if we have a startPostHash.
+		skipFirstPost := startPostHash != nil
+		err := bav.GetDbAdapter().IterateKeys(dbPrefix, prefix, true, func(rawKey []byte) (bool, error) {
+			if uint64(len(posts)) >= limit {
+				return false, nil
+			}
+			if skipFirstPost {
+				skipFirstPost = false
+				return true, nil
+			}
 
-			// Go in reverse order
-			opts.Reverse = true
+			keyWithoutPrefix := rawKey[1:]
+			//posterPublicKey := keyWithoutPrefix[:HashSizeBytes]
+			publicKeySizeBytes := HashSizeBytes + 1
+			//tstampNanos := DecodeUint64(keyWithoutPrefix[publicKeySizeBytes:(publicKeySizeBytes + timestampSizeBytes)])
 
-			it := txn.NewIterator(opts)
-			defer it.Close()
-			it.Seek(prefix)
-			if startPostHash != nil {
-				// Skip the first post if we have a startPostHash.
-				it.Next()
+			postHash := &BlockHash{}
+			copy(postHash[:], keyWithoutPrefix[(publicKeySizeBytes+timestampSizeBytes):])
+			postEntry := bav.GetPostEntryForPostHash(postHash)
+			if postEntry == nil {
+				return false, fmt.Errorf("Missing post entry")
+			}
+			if postEntry.isDeleted || postEntry.ParentStakeID != nil || postEntry.IsHidden {
+				return true, nil
 			}
-			for ; it.ValidForPrefix(dbPrefix) && uint64(len(posts)) < limit; it.Next() {
-				rawKey := it.Item().Key()
-
-				keyWithoutPrefix := rawKey[1:]
-				//posterPublicKey := keyWithoutPrefix[:HashSizeBytes]
-				publicKeySizeBytes := HashSizeBytes + 1
-				//tstampNanos := DecodeUint64(keyWithoutPrefix[publicKeySizeBytes:(publicKeySizeBytes + timestampSizeBytes)])
-
-				postHash := &BlockHash{}
-				copy(postHash[:], keyWithoutPrefix[(publicKeySizeBytes+timestampSizeBytes):])
-				postEntry := bav.GetPostEntryForPostHash(postHash)
-				if postEntry == nil {
-					return fmt.Errorf("Missing post entry")
-				}
-				if postEntry.isDeleted || postEntry.ParentStakeID != nil || postEntry.IsHidden {
-					continue
-				}
-
-				// mediaRequired set to determine if we only want posts that include media and ignore posts without
-				if mediaRequired && !postEntry.HasMedia() {
-					continue
-				}
 
-				// onlyNFTs set to determine if we only want posts that are NFTs
-				if onlyNFTs && !postEntry.IsNFT {
-					continue
-				}
-				if onlyPosts && postEntry.IsNFT {
-					continue
-				}
+			// mediaRequired set to determine if we only want posts that include media and ignore posts without
+			if mediaRequired && !postEntry.HasMedia() {
+				return true, nil
+			}
 
-				posts = append(posts, postEntry)
+			// onlyNFTs set to determine if we only want posts that are NFTs
+			if onlyNFTs && !postEntry.IsNFT {
+				return true, nil
+			}
+			if onlyPosts && postEntry.IsNFT {
+				return true, nil
 			}
-			return nil
+
+			posts = append(posts, postEntry)
+			return true, nil
 		})
 
 		if err != nil {
@@ -588,11 +548,12 @@ func (bav *UtxoView) GetPostsPaginatedForPublicKeyOrderedByTimestamp(publicKey [
 }
 
 func (bav *UtxoView) GetDiamondSendersForPostHash(postHash *BlockHash) (_pkidToDiamondLevel map[PKID]int64, _err error) {
-	handle := bav.Handle
-	// FIXME: Db operation like this shouldn't happen in utxoview.
 	dbPrefix := append([]byte{}, Prefixes.PrefixDiamondedPostHashDiamonderPKIDDiamondLevel...)
 	dbPrefix = append(dbPrefix, postHash[:]...)
-	keysFound, _ := EnumerateKeysForPrefix(handle, dbPrefix, true)
+	keysFound, err := bav.GetDbAdapter().GetKeysForPrefix(dbPrefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDiamondSendersForPostHash: ")
+	}
 
 	diamondPostEntry := bav.GetPostEntryForPostHash(postHash)
 	receiverPKIDEntry := bav.GetPKIDForPublicKey(diamondPostEntry.PosterPublicKey)
@@ -629,11 +590,12 @@ func (bav *UtxoView) GetDiamondSendersForPostHash(postHash *BlockHash) (_pkidToD
 }
 
 func (bav *UtxoView) GetRepostsForPostHash(postHash *BlockHash) (_reposterPubKeys [][]byte, _err error) {
-	handle := bav.Handle
-	// FIXME: Db operation like this shouldn't happen in utxoview.
 	dbPrefix := append([]byte{}, Prefixes.PrefixRepostedPostHashReposterPubKey...)
 	dbPrefix = append(dbPrefix, postHash[:]...)
-	keysFound, _ := EnumerateKeysForPrefix(handle, dbPrefix, true)
+	keysFound, err := bav.GetDbAdapter().GetKeysForPrefix(dbPrefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetRepostsForPostHash: ")
+	}
 
 	// Iterate over all the db keys & values and load them into the view.
 	expectedKeyLength := 1 + HashSizeBytes + btcec.PubKeyBytesLenCompressed
@@ -666,11 +628,12 @@ func (bav *UtxoView) GetRepostsForPostHash(postHash *BlockHash) (_reposterPubKey
 
 func (bav *UtxoView) GetQuoteRepostsForPostHash(postHash *BlockHash,
 ) (_quoteReposterPubKeys [][]byte, _quoteReposterPubKeyToPosts map[PkMapKey][]*PostEntry, _err error) {
-	handle := bav.Handle
-	// FIXME: Db operation like this shouldn't happen in utxoview.
 	dbPrefix := append([]byte{}, Prefixes.PrefixRepostedPostHashReposterPubKeyRepostPostHash...)
 	dbPrefix = append(dbPrefix, postHash[:]...)
-	keysFound, _ := EnumerateKeysForPrefix(handle, dbPrefix, true)
+	keysFound, err := bav.GetDbAdapter().GetKeysForPrefix(dbPrefix)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "UtxoView.GetQuoteRepostsForPostHash: ")
+	}
 
 	// Iterate over all the db keys & values and load them into the view.
 	expectedKeyLength := 1 + HashSizeBytes + btcec.PubKeyBytesLenCompressed + HashSizeBytes
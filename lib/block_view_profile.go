@@ -1,13 +1,13 @@
 package lib
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
-	"github.com/holiman/uint256"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/sha3"
 	"reflect"
@@ -28,7 +28,7 @@ func (bav *UtxoView) GetAllProfiles(readerPK []byte) (
 	//
 	// TODO(performance): This currently fetches all profiles. We should implement
 	// some kind of pagination instead though.
-	_, _, dbProfileEntries, err := DBGetAllProfilesByCoinValue(bav.Handle, bav.Snapshot, true)
+	_, _, dbProfileEntries, err := bav.GetDbAdapter().GetAllProfilesByCoinValue(true)
 	if err != nil {
 		return nil, nil, nil, nil, errors.Wrapf(
 			err, "GetAllProfiles: Problem fetching ProfileEntrys from db: ")
@@ -52,8 +52,8 @@ func (bav *UtxoView) GetAllProfiles(readerPK []byte) (
 			continue
 		}
 		commentsByProfilePublicKey[MakePkMapKey(profileEntry.PublicKey)] = []*PostEntry{}
-		_, dbCommentHashes, _, err := DBGetCommentPostHashesForParentStakeID(
-			bav.Handle, bav.Snapshot, profileEntry.PublicKey, false)
+		_, dbCommentHashes, _, err := bav.GetDbAdapter().GetCommentPostHashesForParentStakeID(
+			profileEntry.PublicKey, false)
 		if err != nil {
 			return nil, nil, nil, nil, errors.Wrapf(err, "GetAllPosts: Problem fetching comment PostEntry's from db: ")
 		}
@@ -65,7 +65,7 @@ func (bav *UtxoView) GetAllProfiles(readerPK []byte) (
 	// has made, just go ahead and load *all* the posts into the view so that
 	// they'll get returned in the mapping. Later, we should use the db index
 	// to do this.
-	_, _, dbPostEntries, err := DBGetAllPostsByTstamp(bav.Handle, bav.Snapshot, true)
+	_, _, dbPostEntries, err := bav.GetDbAdapter().GetAllPostsByTstamp(true)
 	if err != nil {
 		return nil, nil, nil, nil, errors.Wrapf(
 			err, "GetAllPosts: Problem fetching PostEntry's from db: ")
@@ -146,22 +146,11 @@ func (bav *UtxoView) GetProfileEntryForUsername(nonLowercaseUsername []byte) *Pr
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
 	// Note that the DB username lookup is case-insensitive.
-	if bav.Postgres != nil {
-		profile := bav.Postgres.GetProfileForUsername(string(nonLowercaseUsername))
-		if profile == nil {
-			bav.ProfileUsernameToProfileEntry[mapKey] = nil
-			return nil
-		}
-
-		profileEntry, _ := bav.setProfileMappings(profile)
-		return profileEntry
-	} else {
-		dbProfileEntry := DBGetProfileEntryForUsername(bav.Handle, bav.Snapshot, nonLowercaseUsername)
-		if dbProfileEntry != nil {
-			bav._setProfileEntryMappings(dbProfileEntry)
-		}
-		return dbProfileEntry
+	dbProfileEntry := bav.GetDbAdapter().GetProfileEntryForUsername(nonLowercaseUsername)
+	if dbProfileEntry != nil {
+		bav._setProfileEntryMappings(dbProfileEntry)
 	}
+	return dbProfileEntry
 }
 
 func (bav *UtxoView) GetPKIDForPublicKey(publicKeyArg []byte) *PKIDEntry {
@@ -181,26 +170,16 @@ func (bav *UtxoView) GetPKIDForPublicKey(publicKeyArg []byte) *PKIDEntry {
 	// Note that we construct an entry from the DB return value in order to track
 	// isDeleted on the view. If not for isDeleted, we wouldn't need the PKIDEntry
 	// wrapper.
-	if bav.Postgres != nil {
-		profile := bav.Postgres.GetProfileForPublicKey(publicKey)
-		if profile == nil {
-			pkidEntry := &PKIDEntry{
-				PKID:      PublicKeyToPKID(publicKey),
-				PublicKey: publicKey,
-			}
-			bav._setPKIDMappings(pkidEntry)
-			return pkidEntry
-		}
-
-		_, pkidEntry := bav.setProfileMappings(profile)
-		return pkidEntry
-	} else {
-		dbPKIDEntry := DBGetPKIDEntryForPublicKey(bav.Handle, bav.Snapshot, publicKey)
-		if dbPKIDEntry != nil {
-			bav._setPKIDMappings(dbPKIDEntry)
-		}
-		return dbPKIDEntry
+	dbPKID := bav.GetDbAdapter().GetPKIDForPublicKey(publicKey)
+	if dbPKID == nil {
+		return nil
+	}
+	dbPKIDEntry := &PKIDEntry{
+		PKID:      dbPKID,
+		PublicKey: publicKey,
 	}
+	bav._setPKIDMappings(dbPKIDEntry)
+	return dbPKIDEntry
 }
 
 func (bav *UtxoView) GetPublicKeyForPKID(pkidArg *PKID) []byte {
@@ -223,29 +202,14 @@ func (bav *UtxoView) GetPublicKeyForPKID(pkidArg *PKID) []byte {
 	// Note that we construct an entry from the DB return value in order to track
 	// isDeleted on the view. If not for isDeleted, we wouldn't need the PKIDEntry
 	// wrapper.
-	if bav.Postgres != nil {
-		profile := bav.Postgres.GetProfile(*pkid)
-		if profile == nil {
-			pkidEntry := &PKIDEntry{
-				PKID:      pkid,
-				PublicKey: PKIDToPublicKey(pkid),
-			}
-			bav._setPKIDMappings(pkidEntry)
-			return pkidEntry.PublicKey
-		}
-
-		_, pkidEntry := bav.setProfileMappings(profile)
-		return pkidEntry.PublicKey
-	} else {
-		dbPublicKey := DBGetPublicKeyForPKID(bav.Handle, bav.Snapshot, pkid)
-		if len(dbPublicKey) != 0 {
-			bav._setPKIDMappings(&PKIDEntry{
-				PKID:      pkid,
-				PublicKey: dbPublicKey,
-			})
-		}
-		return dbPublicKey
+	dbPublicKey := bav.GetDbAdapter().GetPublicKeyForPKID(pkid)
+	if len(dbPublicKey) != 0 {
+		bav._setPKIDMappings(&PKIDEntry{
+			PKID:      pkid,
+			PublicKey: dbPublicKey,
+		})
 	}
+	return dbPublicKey
 }
 
 func (bav *UtxoView) _setPKIDMappings(pkidEntry *PKIDEntry) {
@@ -291,22 +255,11 @@ func (bav *UtxoView) GetProfileEntryForPKID(pkid *PKID) *ProfileEntry {
 	// If we get here it means no value exists in our in-memory map. In this case,
 	// defer to the db. If a mapping exists in the db, return it. If not, return
 	// nil.
-	if bav.Postgres != nil {
-		// Note: We should never get here but writing this code just in case
-		profile := bav.Postgres.GetProfile(*pkid)
-		if profile == nil {
-			return nil
-		}
-
-		profileEntry, _ := bav.setProfileMappings(profile)
-		return profileEntry
-	} else {
-		dbProfileEntry := DBGetProfileEntryForPKID(bav.Handle, bav.Snapshot, pkid)
-		if dbProfileEntry != nil {
-			bav._setProfileEntryMappings(dbProfileEntry)
-		}
-		return dbProfileEntry
+	dbProfileEntry := bav.GetDbAdapter().GetProfileEntryForPKID(pkid)
+	if dbProfileEntry != nil {
+		bav._setProfileEntryMappings(dbProfileEntry)
 	}
+	return dbProfileEntry
 }
 
 func (bav *UtxoView) _setProfileEntryMappings(profileEntry *ProfileEntry) {
@@ -370,20 +323,10 @@ func (bav *UtxoView) GetAllDerivedKeyMappingsForOwner(ownerPublicKey []byte) (
 	}
 
 	// Check for entries in DB.
-	var dbMappings []*DerivedKeyEntry
-	ownerPk := NewPublicKey(ownerPublicKey)
-	if bav.Postgres != nil {
-		pgMappings := bav.Postgres.GetAllDerivedKeysForOwner(ownerPk)
-		for _, entry := range pgMappings {
-			dbMappings = append(dbMappings, entry.NewDerivedKeyEntry())
-		}
-	} else {
-		var err error
-		dbMappings, err = DBGetAllOwnerToDerivedKeyMappings(bav.Handle, *ownerPk)
-		if err != nil {
-			return nil, errors.Wrapf(err, "GetAllDerivedKeyMappingsForOwner: problem looking up"+
-				"entries in the DB.")
-		}
+	dbMappings, err := bav.GetDbAdapter().GetAllOwnerToDerivedKeyMappings(*NewPublicKey(ownerPublicKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetAllDerivedKeyMappingsForOwner: problem looking up"+
+			"entries in the DB.")
 	}
 
 	// Add entries from the DB that aren't already present.
@@ -439,45 +382,12 @@ func (bav *UtxoView) setProfileMappings(profile *PGProfile) (*ProfileEntry, *PKI
 	}
 	bav._setPKIDMappings(pkidEntry)
 
-	var profileEntry *ProfileEntry
-
 	// Postgres stores profiles with empty usernames when a swap identity occurs.
 	// Storing a nil value for the profile entry preserves badger behavior
-	if profile.Empty() {
+	profileEntry := profile.NewProfileEntry()
+	if profileEntry == nil {
 		bav.ProfilePKIDToProfileEntry[*pkidEntry.PKID] = nil
 	} else {
-		var daoCoinsInCirculationNanos *uint256.Int
-		if profile.DAOCoinCoinsInCirculationNanos != "" {
-			var err error
-			daoCoinsInCirculationNanos, err = uint256.FromHex(profile.DAOCoinCoinsInCirculationNanos)
-			if err != nil {
-				daoCoinsInCirculationNanos = uint256.NewInt()
-			}
-		} else {
-			daoCoinsInCirculationNanos = uint256.NewInt()
-		}
-		profileEntry = &ProfileEntry{
-			PublicKey:   profile.PublicKey.ToBytes(),
-			Username:    []byte(profile.Username),
-			Description: []byte(profile.Description),
-			ProfilePic:  profile.ProfilePic,
-			CreatorCoinEntry: CoinEntry{
-				CreatorBasisPoints:      profile.CreatorBasisPoints,
-				DeSoLockedNanos:         profile.DeSoLockedNanos,
-				NumberOfHolders:         profile.NumberOfHolders,
-				CoinsInCirculationNanos: *uint256.NewInt().SetUint64(profile.CoinsInCirculationNanos),
-				CoinWatermarkNanos:      profile.CoinWatermarkNanos,
-				MintingDisabled:         profile.MintingDisabled,
-			},
-			DAOCoinEntry: CoinEntry{
-				NumberOfHolders:           profile.DAOCoinNumberOfHolders,
-				CoinsInCirculationNanos:   *daoCoinsInCirculationNanos,
-				MintingDisabled:           profile.DAOCoinMintingDisabled,
-				TransferRestrictionStatus: profile.DAOCoinTransferRestrictionStatus,
-			},
-			ExtraData: profile.ExtraData,
-		}
-
 		bav._setProfileEntryMappings(profileEntry)
 	}
 
@@ -557,6 +467,16 @@ func (bav *UtxoView) _connectUpdateProfile(
 	if uint64(len(txMeta.NewProfilePic)) > bav.Params.MaxProfilePicLengthBytes {
 		return 0, 0, nil, RuleErrorMaxProfilePicSize
 	}
+	// After the ProfilePicBlobsBlockHeight, large profile pics are stored on the
+	// ProfileEntry as a reference to a blob. A txn can't set a reference directly
+	// since it would point at a blob the txn doesn't contain.
+	newProfilePic := txMeta.NewProfilePic
+	if blockHeight >= bav.Params.ForkHeights.ProfilePicBlobsBlockHeight {
+		if bytes.HasPrefix(newProfilePic, ProfilePicBlobReferencePrefix) {
+			return 0, 0, nil, RuleErrorProfilePicBlobReferenceNotAllowed
+		}
+		newProfilePic = bav._offloadProfilePic(newProfilePic)
+	}
 	if txMeta.NewCreatorBasisPoints > bav.Params.MaxCreatorBasisPoints || txMeta.NewCreatorBasisPoints < 0 {
 		return 0, 0, nil, RuleErrorProfileCreatorPercentageSize
 	}
@@ -688,8 +608,8 @@ func (bav *UtxoView) _connectUpdateProfile(
 		if len(txMeta.NewDescription) != 0 {
 			newProfileEntry.Description = txMeta.NewDescription
 		}
-		if len(txMeta.NewProfilePic) != 0 {
-			newProfileEntry.ProfilePic = txMeta.NewProfilePic
+		if len(newProfilePic) != 0 {
+			newProfileEntry.ProfilePic = newProfilePic
 		}
 		// TODO: Right now a profile can be undeleted by the owner of the profile,
 		// which seems like undesired behavior if a paramUpdater is trying to reduce
@@ -746,7 +666,7 @@ func (bav *UtxoView) _connectUpdateProfile(
 			PublicKey:   profileEntryPublicKey,
 			Username:    txMeta.NewUsername,
 			Description: txMeta.NewDescription,
-			ProfilePic:  txMeta.NewProfilePic,
+			ProfilePic:  newProfilePic,
 
 			CreatorCoinEntry: CoinEntry{
 				CreatorBasisPoints: txMeta.NewCreatorBasisPoints,
@@ -0,0 +1,644 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// block_view_royalty_split.go implements reusable royalty splits for NFTs. A creator registers
+// a split once with the RoyaltySplit txn and references it from the NFTs they mint by setting
+// the RoyaltySplitIDKey in the CreateNFT txn's ExtraData, instead of passing the DESO and coin
+// royalty maps on every mint.
+//
+// The NFTs reference the split rather than copying it, so updating a split with another
+// RoyaltySplit txn changes who is paid when any of the NFTs minted with it are sold. Since an
+// NFT's royalties were checked against MaxNFTRoyaltyBasisPoints when it was minted, an update
+// can't increase a split's total basis points.
+
+//
+// TYPES: RoyaltySplitEntry
+//
+
+type RoyaltySplitEntry struct {
+	// RoyaltySplitID is the hash of the txn that registered the split.
+	RoyaltySplitID *BlockHash
+	CreatorPKID    *PKID
+	// DESORoyaltiesBasisPoints maps each recipient to the basis points of a sale they're
+	// paid in DESO.
+	DESORoyaltiesBasisPoints map[PKID]uint64
+	// CoinRoyaltiesBasisPoints maps each recipient to the basis points of a sale that are
+	// added to the DESO locked in their creator coin.
+	CoinRoyaltiesBasisPoints map[PKID]uint64
+
+	isDeleted bool
+}
+
+func (entry *RoyaltySplitEntry) Copy() *RoyaltySplitEntry {
+	return &RoyaltySplitEntry{
+		RoyaltySplitID:           entry.RoyaltySplitID.NewBlockHash(),
+		CreatorPKID:              entry.CreatorPKID.NewPKID(),
+		DESORoyaltiesBasisPoints: _copyRoyaltyBasisPointsMap(entry.DESORoyaltiesBasisPoints),
+		CoinRoyaltiesBasisPoints: _copyRoyaltyBasisPointsMap(entry.CoinRoyaltiesBasisPoints),
+		isDeleted:                entry.isDeleted,
+	}
+}
+
+// GetTotalBasisPoints returns the sum of the split's DESO and coin royalties. The sum is
+// checked for overflow when the split is registered.
+func (entry *RoyaltySplitEntry) GetTotalBasisPoints() uint64 {
+	totalBasisPoints := uint64(0)
+	for _, basisPoints := range entry.DESORoyaltiesBasisPoints {
+		totalBasisPoints += basisPoints
+	}
+	for _, basisPoints := range entry.CoinRoyaltiesBasisPoints {
+		totalBasisPoints += basisPoints
+	}
+	return totalBasisPoints
+}
+
+func (entry *RoyaltySplitEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.RoyaltySplitID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.CreatorPKID, skipMetadata...)...)
+	data = append(data, EncodePKIDuint64Map(entry.DESORoyaltiesBasisPoints)...)
+	data = append(data, EncodePKIDuint64Map(entry.CoinRoyaltiesBasisPoints)...)
+	return data
+}
+
+func (entry *RoyaltySplitEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// RoyaltySplitID
+	entry.RoyaltySplitID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "RoyaltySplitEntry.Decode: Problem reading RoyaltySplitID: ")
+	}
+
+	// CreatorPKID
+	entry.CreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "RoyaltySplitEntry.Decode: Problem reading CreatorPKID: ")
+	}
+
+	// DESORoyaltiesBasisPoints
+	entry.DESORoyaltiesBasisPoints, err = DecodePKIDuint64Map(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RoyaltySplitEntry.Decode: Problem reading DESORoyaltiesBasisPoints: ")
+	}
+
+	// CoinRoyaltiesBasisPoints
+	entry.CoinRoyaltiesBasisPoints, err = DecodePKIDuint64Map(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RoyaltySplitEntry.Decode: Problem reading CoinRoyaltiesBasisPoints: ")
+	}
+
+	return nil
+}
+
+func (entry *RoyaltySplitEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *RoyaltySplitEntry) GetEncoderType() EncoderType {
+	return EncoderTypeRoyaltySplitEntry
+}
+
+func _copyRoyaltyBasisPointsMap(royaltiesBasisPoints map[PKID]uint64) map[PKID]uint64 {
+	royaltiesBasisPointsCopy := make(map[PKID]uint64, len(royaltiesBasisPoints))
+	for pkid, basisPoints := range royaltiesBasisPoints {
+		royaltiesBasisPointsCopy[pkid] = basisPoints
+	}
+	return royaltiesBasisPointsCopy
+}
+
+//
+// TYPES: RoyaltySplitMetadata
+//
+
+type RoyaltySplitMetadata struct {
+	// RoyaltySplitID is the split to update. It's nil when registering a new split, whose
+	// RoyaltySplitID is the hash of the txn.
+	RoyaltySplitID *BlockHash
+	// DESORoyalties and CoinRoyalties replace the split's recipients. They have the same
+	// meaning as the maps under DESORoyaltiesMapKey and CoinRoyaltiesMapKey in a CreateNFT txn.
+	DESORoyalties map[PublicKey]uint64
+	CoinRoyalties map[PublicKey]uint64
+}
+
+func (txnData *RoyaltySplitMetadata) GetTxnType() TxnType {
+	return TxnTypeRoyaltySplit
+}
+
+func (txnData *RoyaltySplitMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	royaltySplitID := ZeroBlockHash
+	if txnData.RoyaltySplitID != nil {
+		royaltySplitID = *txnData.RoyaltySplitID
+	}
+	data = append(data, royaltySplitID[:]...)
+
+	desoRoyaltiesBytes, err := SerializePubKeyToUint64Map(txnData.DESORoyalties)
+	if err != nil {
+		return nil, errors.Wrapf(err, "RoyaltySplitMetadata.ToBytes: Problem encoding DESORoyalties: ")
+	}
+	data = append(data, EncodeByteArray(desoRoyaltiesBytes)...)
+
+	coinRoyaltiesBytes, err := SerializePubKeyToUint64Map(txnData.CoinRoyalties)
+	if err != nil {
+		return nil, errors.Wrapf(err, "RoyaltySplitMetadata.ToBytes: Problem encoding CoinRoyalties: ")
+	}
+	data = append(data, EncodeByteArray(coinRoyaltiesBytes)...)
+	return data, nil
+}
+
+func (txnData *RoyaltySplitMetadata) FromBytes(data []byte) error {
+	ret := RoyaltySplitMetadata{}
+	rr := bytes.NewReader(data)
+
+	// RoyaltySplitID
+	royaltySplitID := &BlockHash{}
+	if _, err := io.ReadFull(rr, royaltySplitID[:]); err != nil {
+		return errors.Wrapf(err, "RoyaltySplitMetadata.FromBytes: Problem reading RoyaltySplitID: ")
+	}
+	if *royaltySplitID != ZeroBlockHash {
+		ret.RoyaltySplitID = royaltySplitID
+	}
+
+	// DESORoyalties
+	desoRoyaltiesBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RoyaltySplitMetadata.FromBytes: Problem reading DESORoyalties: ")
+	}
+	if ret.DESORoyalties, err = DeserializePubKeyToUint64Map(desoRoyaltiesBytes); err != nil {
+		return errors.Wrapf(err, "RoyaltySplitMetadata.FromBytes: Problem decoding DESORoyalties: ")
+	}
+
+	// CoinRoyalties
+	coinRoyaltiesBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RoyaltySplitMetadata.FromBytes: Problem reading CoinRoyalties: ")
+	}
+	if ret.CoinRoyalties, err = DeserializePubKeyToUint64Map(coinRoyaltiesBytes); err != nil {
+		return errors.Wrapf(err, "RoyaltySplitMetadata.FromBytes: Problem decoding CoinRoyalties: ")
+	}
+
+	*txnData = ret
+	return nil
+}
+
+func (txnData *RoyaltySplitMetadata) New() DeSoTxnMetadata {
+	return &RoyaltySplitMetadata{}
+}
+
+// ValidateRoyaltySplitMetadata checks that the split has at least one recipient, that every
+// recipient has a valid public key and a non-zero share, and that the split's total doesn't
+// exceed maxBasisPoints.
+func ValidateRoyaltySplitMetadata(txMeta *RoyaltySplitMetadata, maxBasisPoints uint64) error {
+	if len(txMeta.DESORoyalties)+len(txMeta.CoinRoyalties) == 0 {
+		return RuleErrorRoyaltySplitNoRecipients
+	}
+	totalBasisPoints := uint64(0)
+	for _, royalties := range []map[PublicKey]uint64{txMeta.DESORoyalties, txMeta.CoinRoyalties} {
+		for publicKey, basisPoints := range royalties {
+			if _, err := btcec.ParsePubKey(publicKey.ToBytes(), btcec.S256()); err != nil {
+				return errors.Wrapf(RuleErrorAdditionalRoyaltyPubKeyMustBeValid,
+					"Error parsing public key: %v, %v", PkToStringBoth(publicKey.ToBytes()), err)
+			}
+			if basisPoints == 0 {
+				return errors.Wrapf(RuleErrorRoyaltySplitZeroBasisPoints,
+					"recipient %v", PkToStringBoth(publicKey.ToBytes()))
+			}
+			if totalBasisPoints > math.MaxUint64-basisPoints {
+				return errors.Wrapf(RuleErrorRoyaltySplitHasTooManyBasisPoints, "total basis points overflow")
+			}
+			totalBasisPoints += basisPoints
+		}
+	}
+	if totalBasisPoints > maxBasisPoints {
+		return errors.Wrapf(RuleErrorRoyaltySplitHasTooManyBasisPoints,
+			"%d basis points exceeds the max of %d", totalBasisPoints, maxBasisPoints)
+	}
+	return nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForRoyaltySplitEntry(royaltySplitID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixRoyaltySplitByID...)
+	key = append(key, royaltySplitID[:]...)
+	return key
+}
+
+func DBKeyForRoyaltySplitByCreator(creatorPKID *PKID, royaltySplitID *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixRoyaltySplitIDByCreatorPKID...)
+	key = append(key, creatorPKID.ToBytes()...)
+	key = append(key, royaltySplitID[:]...)
+	return key
+}
+
+func DBGetRoyaltySplitEntry(handle *badger.DB, snap *Snapshot, royaltySplitID *BlockHash) (*RoyaltySplitEntry, error) {
+	var ret *RoyaltySplitEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetRoyaltySplitEntryWithTxn(txn, snap, royaltySplitID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetRoyaltySplitEntryWithTxn(txn *badger.Txn, snap *Snapshot, royaltySplitID *BlockHash) (*RoyaltySplitEntry, error) {
+	// Retrieve RoyaltySplitEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForRoyaltySplitEntry(royaltySplitID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetRoyaltySplitEntry: problem retrieving RoyaltySplitEntry: ")
+	}
+
+	// Decode RoyaltySplitEntry from bytes.
+	entry, err := DecodeDeSoEncoder(&RoyaltySplitEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetRoyaltySplitEntry: problem decoding RoyaltySplitEntry: ")
+	}
+	return entry, nil
+}
+
+// DBGetRoyaltySplitEntriesForCreator returns the royalty splits the creator has registered.
+func DBGetRoyaltySplitEntriesForCreator(handle *badger.DB, snap *Snapshot, creatorPKID *PKID) ([]*RoyaltySplitEntry, error) {
+	prefix := append([]byte{}, Prefixes.PrefixRoyaltySplitIDByCreatorPKID...)
+	prefix = append(prefix, creatorPKID.ToBytes()...)
+	keysFound, _ := EnumerateKeysForPrefix(handle, prefix, true)
+
+	var entries []*RoyaltySplitEntry
+	for _, key := range keysFound {
+		if len(key) != len(prefix)+HashSizeBytes {
+			return nil, fmt.Errorf("DBGetRoyaltySplitEntriesForCreator: invalid index key length %d", len(key))
+		}
+		royaltySplitID := NewBlockHash(key[len(prefix):])
+		entry, err := DBGetRoyaltySplitEntry(handle, snap, royaltySplitID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetRoyaltySplitEntriesForCreator: ")
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("DBGetRoyaltySplitEntriesForCreator: royalty split %v is indexed but "+
+				"doesn't exist", royaltySplitID)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutRoyaltySplitEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *RoyaltySplitEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForRoyaltySplitEntry(entry.RoyaltySplitID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutRoyaltySplitEntryWithTxn: problem storing RoyaltySplitEntry: ")
+	}
+	indexKey := DBKeyForRoyaltySplitByCreator(entry.CreatorPKID, entry.RoyaltySplitID)
+	if err := DBSetWithTxn(txn, snap, indexKey, []byte{}, eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutRoyaltySplitEntryWithTxn: problem storing royalty split index: ")
+	}
+	return nil
+}
+
+func DBDeleteRoyaltySplitEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *RoyaltySplitEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	key := DBKeyForRoyaltySplitEntry(entry.RoyaltySplitID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteRoyaltySplitEntryWithTxn: problem deleting RoyaltySplitEntry: ")
+	}
+	indexKey := DBKeyForRoyaltySplitByCreator(entry.CreatorPKID, entry.RoyaltySplitID)
+	if err := DBDeleteWithTxn(txn, snap, indexKey, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteRoyaltySplitEntryWithTxn: problem deleting royalty split index: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetRoyaltySplitEntry returns the royalty split, or nil if it doesn't exist.
+func (bav *UtxoView) GetRoyaltySplitEntry(royaltySplitID *BlockHash) (*RoyaltySplitEntry, error) {
+	// First check the UtxoView.
+	if entry, exists := bav.RoyaltySplitIDToRoyaltySplitEntry[*royaltySplitID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// Then check the database.
+	dbEntry, err := bav.GetDbAdapter().GetRoyaltySplitEntry(royaltySplitID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetRoyaltySplitEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the RoyaltySplitEntry from the db in the UtxoView.
+		bav._setRoyaltySplitEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetRoyaltySplitEntriesForCreator returns the royalty splits the creator has registered,
+// including the splits in the view.
+func (bav *UtxoView) GetRoyaltySplitEntriesForCreator(creatorPKID *PKID) ([]*RoyaltySplitEntry, error) {
+	dbEntries, err := bav.GetDbAdapter().GetRoyaltySplitEntriesForCreator(creatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetRoyaltySplitEntriesForCreator: ")
+	}
+	for _, dbEntry := range dbEntries {
+		// Don't overwrite the entries that have been modified in the view.
+		if _, exists := bav.RoyaltySplitIDToRoyaltySplitEntry[*dbEntry.RoyaltySplitID]; !exists {
+			bav._setRoyaltySplitEntryMappings(dbEntry)
+		}
+	}
+
+	var entries []*RoyaltySplitEntry
+	for _, entry := range bav.RoyaltySplitIDToRoyaltySplitEntry {
+		if !entry.isDeleted && entry.CreatorPKID.Eq(creatorPKID) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// GetNFTAdditionalRoyalties returns the additional DESO and coin royalties that are paid when
+// the NFT is sold. These are the current recipients of the NFT's royalty split if it was
+// minted with one, and otherwise the royalties it was minted with.
+func (bav *UtxoView) GetNFTAdditionalRoyalties(nftPostEntry *PostEntry) (
+	_additionalDESORoyaltiesBasisPoints map[PKID]uint64,
+	_additionalCoinRoyaltiesBasisPoints map[PKID]uint64,
+	_err error,
+) {
+	if nftPostEntry.RoyaltySplitID == nil {
+		return nftPostEntry.AdditionalNFTRoyaltiesToCreatorsBasisPoints,
+			nftPostEntry.AdditionalNFTRoyaltiesToCoinsBasisPoints, nil
+	}
+	royaltySplitEntry, err := bav.GetRoyaltySplitEntry(nftPostEntry.RoyaltySplitID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "GetNFTAdditionalRoyalties: ")
+	}
+	if royaltySplitEntry == nil {
+		return nil, nil, fmt.Errorf("GetNFTAdditionalRoyalties: royalty split %v for post %v not found",
+			nftPostEntry.RoyaltySplitID, nftPostEntry.PostHash)
+	}
+	return royaltySplitEntry.DESORoyaltiesBasisPoints, royaltySplitEntry.CoinRoyaltiesBasisPoints, nil
+}
+
+// _getRoyaltySplitForExtraData returns the royalty split referenced by a CreateNFT txn's
+// ExtraData, or nil if it doesn't reference one.
+func (bav *UtxoView) _getRoyaltySplitForExtraData(
+	extraData map[string][]byte, blockHeight uint32) (*RoyaltySplitEntry, error) {
+
+	royaltySplitIDBytes, exists := extraData[RoyaltySplitIDKey]
+	if !exists || blockHeight < bav.Params.ForkHeights.RoyaltySplitBlockHeight {
+		return nil, nil
+	}
+	if len(royaltySplitIDBytes) != HashSizeBytes {
+		return nil, errors.Wrapf(RuleErrorRoyaltySplitInvalidID,
+			"_getRoyaltySplitForExtraData: %d bytes", len(royaltySplitIDBytes))
+	}
+	royaltySplitID := NewBlockHash(royaltySplitIDBytes)
+	royaltySplitEntry, err := bav.GetRoyaltySplitEntry(royaltySplitID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getRoyaltySplitForExtraData: ")
+	}
+	if royaltySplitEntry == nil {
+		return nil, errors.Wrapf(RuleErrorRoyaltySplitNotFound, "_getRoyaltySplitForExtraData: %v", royaltySplitID)
+	}
+	return royaltySplitEntry, nil
+}
+
+func (bav *UtxoView) _setRoyaltySplitEntryMappings(entry *RoyaltySplitEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setRoyaltySplitEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.RoyaltySplitIDToRoyaltySplitEntry[*entry.RoyaltySplitID] = entry
+}
+
+func (bav *UtxoView) _deleteRoyaltySplitEntryMappings(entry *RoyaltySplitEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteRoyaltySplitEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setRoyaltySplitEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushRoyaltySplitEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Delete every royalty split in the view first, since a split's index has to be removed
+	// along with it. The splits that aren't deleted are put back below.
+	for mapKeyIter, entryIter := range bav.RoyaltySplitIDToRoyaltySplitEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.RoyaltySplitID.IsEqual(&mapKey) {
+			return fmt.Errorf("_flushRoyaltySplitEntriesToDbWithTxn: RoyaltySplitEntry RoyaltySplitID %v "+
+				"doesn't match MapKey %v", entry.RoyaltySplitID, &mapKey)
+		}
+
+		if err := DBDeleteRoyaltySplitEntryWithTxn(
+			txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+		); err != nil {
+			return errors.Wrapf(err, "_flushRoyaltySplitEntriesToDbWithTxn: ")
+		}
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutRoyaltySplitEntryWithTxn(
+			txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushRoyaltySplitEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
+
+//
+// CONNECT AND DISCONNECT
+//
+
+func (bav *UtxoView) _connectRoyaltySplit(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.RoyaltySplitBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorRoyaltySplitBeforeBlockHeight, "_connectRoyaltySplit: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeRoyaltySplit {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectRoyaltySplit: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*RoyaltySplitMetadata)
+
+	// Connect a basic transfer to get the total input and the total output without
+	// considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRoyaltySplit: ")
+	}
+
+	if err = ValidateRoyaltySplitMetadata(txMeta, bav.Params.MaxNFTRoyaltyBasisPoints); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRoyaltySplit: ")
+	}
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, fmt.Errorf("_connectRoyaltySplit: PKID for transactor %v not found",
+			PkToStringBoth(txn.PublicKey))
+	}
+	transactorPKID := transactorPKIDEntry.PKID
+
+	desoRoyaltiesBasisPoints, _, err := bav._getPKIDRoyaltyMapForPubKeyRoyaltyMap(txMeta.DESORoyalties, false)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRoyaltySplit: Problem with DESO royalties: ")
+	}
+	coinRoyaltiesBasisPoints, _, err := bav._getPKIDRoyaltyMapForPubKeyRoyaltyMap(txMeta.CoinRoyalties, true)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRoyaltySplit: Problem with coin royalties: ")
+	}
+	// The creator is paid through the royalties on the NFT itself, so they can't be in the split.
+	if _, exists := desoRoyaltiesBasisPoints[*transactorPKID]; exists {
+		return 0, 0, nil, errors.Wrapf(RuleErrorCannotSpecifyCreatorAsAdditionalRoyalty,
+			"_connectRoyaltySplit: cannot specify the creator in the DESO royalties")
+	}
+	if _, exists := coinRoyaltiesBasisPoints[*transactorPKID]; exists {
+		return 0, 0, nil, errors.Wrapf(RuleErrorCannotSpecifyCreatorAsAdditionalRoyalty,
+			"_connectRoyaltySplit: cannot specify the creator in the coin royalties")
+	}
+
+	newEntry := &RoyaltySplitEntry{
+		RoyaltySplitID:           txHash.NewBlockHash(),
+		CreatorPKID:              transactorPKID.NewPKID(),
+		DESORoyaltiesBasisPoints: desoRoyaltiesBasisPoints,
+		CoinRoyaltiesBasisPoints: coinRoyaltiesBasisPoints,
+	}
+
+	// If the txn updates an existing split, check that the transactor registered it and that
+	// the update doesn't push the NFTs minted with it over the royalty limit.
+	var prevEntry *RoyaltySplitEntry
+	if txMeta.RoyaltySplitID != nil {
+		existingEntry, err := bav.GetRoyaltySplitEntry(txMeta.RoyaltySplitID)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectRoyaltySplit: ")
+		}
+		if existingEntry == nil {
+			return 0, 0, nil, errors.Wrapf(RuleErrorRoyaltySplitNotFound, "_connectRoyaltySplit: %v",
+				txMeta.RoyaltySplitID)
+		}
+		if !existingEntry.CreatorPKID.Eq(transactorPKID) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorRoyaltySplitNotOwnedByTransactor, "_connectRoyaltySplit: ")
+		}
+		if newEntry.GetTotalBasisPoints() > existingEntry.GetTotalBasisPoints() {
+			return 0, 0, nil, errors.Wrapf(RuleErrorRoyaltySplitUpdateIncreasesBasisPoints,
+				"_connectRoyaltySplit: %d basis points exceeds the previous %d",
+				newEntry.GetTotalBasisPoints(), existingEntry.GetTotalBasisPoints())
+		}
+		prevEntry = existingEntry.Copy()
+		newEntry.RoyaltySplitID = existingEntry.RoyaltySplitID.NewBlockHash()
+	}
+	bav._setRoyaltySplitEntryMappings(newEntry)
+
+	// Add a UTXO operation.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                  OperationTypeRoyaltySplit,
+		PrevRoyaltySplitEntry: prevEntry,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectRoyaltySplit(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.RoyaltySplitBlockHeight {
+		return errors.Wrapf(RuleErrorRoyaltySplitBeforeBlockHeight, "_disconnectRoyaltySplit: ")
+	}
+
+	// Validate the last operation is a RoyaltySplit operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectRoyaltySplit: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeRoyaltySplit {
+		return fmt.Errorf(
+			"_disconnectRoyaltySplit: trying to revert %v but found %v",
+			OperationTypeRoyaltySplit,
+			operationData.Type,
+		)
+	}
+
+	if operationData.PrevRoyaltySplitEntry != nil {
+		// The txn updated a split, so restore it.
+		bav._setRoyaltySplitEntryMappings(operationData.PrevRoyaltySplitEntry)
+	} else {
+		// The txn registered the split, so delete it. NFTs can't have been minted with it
+		// yet, since they'd have been disconnected first.
+		royaltySplitEntry, err := bav.GetRoyaltySplitEntry(txHash)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectRoyaltySplit: ")
+		}
+		if royaltySplitEntry == nil {
+			return fmt.Errorf("_disconnectRoyaltySplit: registered royalty split %v not found", txHash)
+		}
+		bav._deleteRoyaltySplitEntryMappings(royaltySplitEntry)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
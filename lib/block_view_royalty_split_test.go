@@ -0,0 +1,427 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoyaltySplitMetadata(t *testing.T) {
+	require := require.New(t)
+
+	newMetadata := func() *RoyaltySplitMetadata {
+		return &RoyaltySplitMetadata{
+			DESORoyalties: map[PublicKey]uint64{*NewPublicKey(m1PkBytes): 100, *NewPublicKey(m2PkBytes): 250},
+			CoinRoyalties: map[PublicKey]uint64{*NewPublicKey(m3PkBytes): 50},
+		}
+	}
+
+	// Round-trip the metadata for a new split and for an update.
+	for _, royaltySplitID := range []*BlockHash{nil, NewBlockHash(RandomBytes(HashSizeBytes))} {
+		metadata := newMetadata()
+		metadata.RoyaltySplitID = royaltySplitID
+		metadataBytes, err := metadata.ToBytes(false)
+		require.NoError(err)
+		decodedMetadata := &RoyaltySplitMetadata{}
+		require.NoError(decodedMetadata.FromBytes(metadataBytes))
+		require.Equal(metadata, decodedMetadata)
+	}
+
+	require.NoError(ValidateRoyaltySplitMetadata(newMetadata(), 400))
+	for expectedErr, mutate := range map[RuleError]func(*RoyaltySplitMetadata){
+		RuleErrorRoyaltySplitNoRecipients: func(metadata *RoyaltySplitMetadata) {
+			metadata.DESORoyalties = nil
+			metadata.CoinRoyalties = nil
+		},
+		RuleErrorRoyaltySplitZeroBasisPoints: func(metadata *RoyaltySplitMetadata) {
+			metadata.CoinRoyalties[*NewPublicKey(m3PkBytes)] = 0
+		},
+		RuleErrorRoyaltySplitHasTooManyBasisPoints: func(metadata *RoyaltySplitMetadata) {
+			metadata.CoinRoyalties[*NewPublicKey(m3PkBytes)] = 51
+		},
+		RuleErrorAdditionalRoyaltyPubKeyMustBeValid: func(metadata *RoyaltySplitMetadata) {
+			metadata.DESORoyalties[PublicKey{}] = 1
+		},
+	} {
+		metadata := newMetadata()
+		mutate(metadata)
+		err := ValidateRoyaltySplitMetadata(metadata, 400)
+		require.Error(err)
+		require.Contains(err.Error(), string(expectedErr))
+	}
+}
+
+func TestRoyaltySplitEntry(t *testing.T) {
+	require := require.New(t)
+
+	entry := &RoyaltySplitEntry{
+		RoyaltySplitID:           NewBlockHash(RandomBytes(HashSizeBytes)),
+		CreatorPKID:              NewPKID(m0PkBytes),
+		DESORoyaltiesBasisPoints: map[PKID]uint64{*NewPKID(m1PkBytes): 100, *NewPKID(m2PkBytes): 250},
+		CoinRoyaltiesBasisPoints: map[PKID]uint64{*NewPKID(m3PkBytes): 50},
+	}
+	require.Equal(uint64(400), entry.GetTotalBasisPoints())
+
+	decodedEntry, err := DecodeDeSoEncoder(&RoyaltySplitEntry{}, bytes.NewReader(EncodeToBytes(0, entry)))
+	require.NoError(err)
+	require.Equal(entry, decodedEntry)
+
+	// An NFT minted with the split is paid out to the split's current recipients, not the
+	// royalties copied onto the post when it was minted.
+	bav := &UtxoView{RoyaltySplitIDToRoyaltySplitEntry: map[BlockHash]*RoyaltySplitEntry{
+		*entry.RoyaltySplitID: entry,
+	}}
+	postEntry := &PostEntry{
+		AdditionalNFTRoyaltiesToCreatorsBasisPoints: map[PKID]uint64{*NewPKID(m4PkBytes): 400},
+		RoyaltySplitID: entry.RoyaltySplitID,
+	}
+	desoRoyalties, coinRoyalties, err := bav.GetNFTAdditionalRoyalties(postEntry)
+	require.NoError(err)
+	require.Equal(entry.DESORoyaltiesBasisPoints, desoRoyalties)
+	require.Equal(entry.CoinRoyaltiesBasisPoints, coinRoyalties)
+
+	// Without a split, the post's royalties are used.
+	postEntry.RoyaltySplitID = nil
+	desoRoyalties, _, err = bav.GetNFTAdditionalRoyalties(postEntry)
+	require.NoError(err)
+	require.Equal(postEntry.AdditionalNFTRoyaltiesToCreatorsBasisPoints, desoRoyalties)
+}
+
+func TestRoyaltySplitConnectAndDisconnect(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+	require := require.New(t)
+	const feeRateNanosPerKB = uint64(100)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(m4PkBytes)] = true
+	params.ForkHeights.BrokenNFTBidsFixBlockHeight = uint32(0)
+	params.ForkHeights.BuyNowAndNFTSplitsBlockHeight = uint32(0)
+	// The royalty split migration can't come before the balance model migration, since an
+	// encoder's version byte is decoded as the height of the newest migration it was encoded with.
+	params.ForkHeights.RoyaltySplitBlockHeight = params.ForkHeights.BalanceModelBlockHeight
+	oldEncoderMigrationHeights := GlobalDeSoParams.EncoderMigrationHeights
+	oldEncoderMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		GlobalDeSoParams.EncoderMigrationHeights = oldEncoderMigrationHeights
+		GlobalDeSoParams.EncoderMigrationHeightsList = oldEncoderMigrationHeightsList
+	}()
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m0Pub, senderPrivString, 1e5)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m3Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m4Pub, senderPrivString, 100)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, m5Pub, senderPrivString, 1e5)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+	m3PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m3PkBytes).PKID
+
+	// Set max copies to a non-zero value to activate NFTs.
+	_updateGlobalParamsEntryWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m4Pub,
+		m4Priv,
+		-1,   /*USDCentsPerBitcoinExchangeRate*/
+		-1,   /*minimumNetworkFeeNanosPerKb*/
+		-1,   /*createProfileFeeNanos*/
+		-1,   /*createNFTFeeNanos*/
+		1000, /*maxCopiesPerNFT*/
+	)
+	// m0 mints the NFTs, and m2 is paid a coin royalty, so they both need profiles.
+	for _, profile := range []struct{ publicKey, privateKey, username string }{
+		{m0Pub, m0Priv, "m0"},
+		{m2Pub, m2Priv, "m2"},
+	} {
+		_updateProfileWithTestMeta(
+			testMeta,
+			feeRateNanosPerKB,
+			profile.publicKey,            /*updaterPkBase58Check*/
+			profile.privateKey,           /*updaterPrivBase58Check*/
+			[]byte{},                     /*profilePubKey*/
+			profile.username,             /*newUsername*/
+			"i am the "+profile.username, /*newDescription*/
+			shortPic,                     /*newProfilePic*/
+			10*100,                       /*newCreatorBasisPoints*/
+			1.25*100*100,                 /*newStakeMultipleBasisPoints*/
+			false /*isHidden*/)
+	}
+	// m1 buys some of m2's coin so that m2's coin royalty isn't burned.
+	_creatorCoinTxnWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m1Pub,  /*updaterPkBase58Check*/
+		m1Priv, /*updaterPrivBase58Check*/
+		m2Pub,  /*profilePubKeyBase58Check*/
+		CreatorCoinOperationTypeBuy,
+		1000, /*DeSoToSellNanos*/
+		0,    /*CreatorCoinToSellNanos*/
+		0,    /*DeSoToAddNanos*/
+		0,    /*MinDeSoExpectedNanos*/
+		0,    /*MinCreatorCoinExpectedNanos*/
+	)
+
+	// requireRoyaltySplitEntry checks the split in a view, which is the db's if it's nil.
+	requireRoyaltySplitEntry := func(
+		utxoView *UtxoView, royaltySplitID *BlockHash, expectedEntry *RoyaltySplitEntry) {
+		if utxoView == nil {
+			utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		}
+		royaltySplitEntry, err := utxoView.GetRoyaltySplitEntry(royaltySplitID)
+		require.NoError(err)
+		if expectedEntry == nil {
+			require.Nil(royaltySplitEntry)
+			return
+		}
+		require.Equal(expectedEntry, royaltySplitEntry)
+	}
+	// disconnectLastTxn disconnects the last txn in a view and returns the view.
+	disconnectLastTxn := func() *UtxoView {
+		lastTxn := testMeta.txns[len(testMeta.txns)-1]
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(
+			lastTxn, lastTxn.Hash(), testMeta.txnOps[len(testMeta.txnOps)-1], chain.blockTip().Height+1))
+		return utxoView
+	}
+
+	// The creator can't be one of the split's recipients.
+	_, _, err := _royaltySplit(t, chain, db, params, feeRateNanosPerKB, m0Pub, m0Priv, &RoyaltySplitMetadata{
+		DESORoyalties: map[PublicKey]uint64{*NewPublicKey(m0PkBytes): 10 * 100},
+	})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCannotSpecifyCreatorAsAdditionalRoyalty)
+
+	// m0 registers a split that pays 10% to m1 and 5% to m3 in DESO, and 3% to m2's coin.
+	_royaltySplitWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, &RoyaltySplitMetadata{
+		DESORoyalties: map[PublicKey]uint64{*NewPublicKey(m1PkBytes): 10 * 100, *NewPublicKey(m3PkBytes): 5 * 100},
+		CoinRoyalties: map[PublicKey]uint64{*NewPublicKey(m2PkBytes): 3 * 100},
+	})
+	royaltySplitID := testMeta.txns[len(testMeta.txns)-1].Hash()
+	registeredEntry := &RoyaltySplitEntry{
+		RoyaltySplitID:           royaltySplitID,
+		CreatorPKID:              m0PKID,
+		DESORoyaltiesBasisPoints: map[PKID]uint64{*m1PKID: 10 * 100, *m3PKID: 5 * 100},
+		CoinRoyaltiesBasisPoints: map[PKID]uint64{*m2PKID: 3 * 100},
+	}
+	requireRoyaltySplitEntry(nil, royaltySplitID, registeredEntry)
+	// Disconnecting the registration deletes the split.
+	requireRoyaltySplitEntry(disconnectLastTxn(), royaltySplitID, nil)
+
+	// Only the split's creator can update it, it must exist, and an update can't increase its
+	// total basis points.
+	for _, testCase := range []struct {
+		publicKey   string
+		privateKey  string
+		metadata    *RoyaltySplitMetadata
+		expectedErr RuleError
+	}{
+		{m1Pub, m1Priv, &RoyaltySplitMetadata{
+			RoyaltySplitID: royaltySplitID,
+			DESORoyalties:  map[PublicKey]uint64{*NewPublicKey(m3PkBytes): 100},
+		}, RuleErrorRoyaltySplitNotOwnedByTransactor},
+		{m0Pub, m0Priv, &RoyaltySplitMetadata{
+			RoyaltySplitID: NewBlockHash(RandomBytes(HashSizeBytes)),
+			DESORoyalties:  map[PublicKey]uint64{*NewPublicKey(m3PkBytes): 100},
+		}, RuleErrorRoyaltySplitNotFound},
+		{m0Pub, m0Priv, &RoyaltySplitMetadata{
+			RoyaltySplitID: royaltySplitID,
+			DESORoyalties:  map[PublicKey]uint64{*NewPublicKey(m3PkBytes): 18*100 + 1},
+		}, RuleErrorRoyaltySplitUpdateIncreasesBasisPoints},
+	} {
+		_, _, err = _royaltySplit(
+			t, chain, db, params, feeRateNanosPerKB, testCase.publicKey, testCase.privateKey, testCase.metadata)
+		require.Error(err)
+		require.Contains(err.Error(), testCase.expectedErr)
+	}
+
+	// m0 mints an NFT that references the split, with a 10% creator royalty of its own.
+	_submitPostWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,                              /*updaterPkBase58Check*/
+		m0Priv,                             /*updaterPrivBase58Check*/
+		[]byte{},                           /*postHashToModify*/
+		[]byte{},                           /*parentStakeID*/
+		&DeSoBodySchema{Body: "m0 post 1"}, /*body*/
+		[]byte{},
+		1502947011*1e9, /*tstampNanos*/
+		false /*isHidden*/)
+	postHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	royaltySplitExtraData := map[string][]byte{RoyaltySplitIDKey: royaltySplitID[:]}
+	createNFT := func(additionalDESORoyaltiesMap map[PublicKey]uint64, extraData map[string][]byte) error {
+		_, _, _, err := _createNFTWithExtraData(t, chain, db, params, feeRateNanosPerKB,
+			m0Pub,    /*updaterPkBase58Check*/
+			m0Priv,   /*updaterPrivBase58Check*/
+			postHash, /*nftPostHash*/
+			1,        /*numCopies*/
+			false,    /*hasUnlockable*/
+			true,     /*isForSale*/
+			0,        /*minBidAmountNanos*/
+			0,        /*nftFee*/
+			10*100,   /*nftRoyaltyToCreatorBasisPoints*/
+			0,        /*nftRoyaltyToCoinBasisPoints*/
+			false,    /*isBuyNow*/
+			0,        /*buyNowPriceNanos*/
+			additionalDESORoyaltiesMap,
+			nil,
+			extraData)
+		return err
+	}
+	// An NFT can't reference a split and have royalty maps of its own, and the split has to
+	// exist.
+	err = createNFT(map[PublicKey]uint64{*NewPublicKey(m1PkBytes): 100}, royaltySplitExtraData)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorRoyaltySplitCombinedWithRoyaltyMaps)
+	err = createNFT(nil, map[string][]byte{RoyaltySplitIDKey: RandomBytes(HashSizeBytes)})
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorRoyaltySplitNotFound)
+
+	_createNFTWithAdditionalRoyaltiesAndExtraDataWithTestMeta(
+		testMeta,
+		feeRateNanosPerKB,
+		m0Pub,    /*updaterPkBase58Check*/
+		m0Priv,   /*updaterPrivBase58Check*/
+		postHash, /*postHashToModify*/
+		1,        /*numCopies*/
+		false,    /*hasUnlockable*/
+		true,     /*isForSale*/
+		0,        /*minBidAmountNanos*/
+		0,        /*nftFee*/
+		10*100,   /*nftRoyaltyToCreatorBasisPoints*/
+		0,        /*nftRoyaltyToCoinBasisPoints*/
+		false,    /*isBuyNow*/
+		0,        /*buyNowPriceNanos*/
+		nil,
+		nil,
+		royaltySplitExtraData,
+	)
+	nftPostEntry := DBGetPostEntryByPostHash(db, chain.snapshot, postHash)
+	require.Equal(royaltySplitID, nftPostEntry.RoyaltySplitID)
+	require.Equal(registeredEntry.DESORoyaltiesBasisPoints, nftPostEntry.AdditionalNFTRoyaltiesToCreatorsBasisPoints)
+	require.Equal(registeredEntry.CoinRoyaltiesBasisPoints, nftPostEntry.AdditionalNFTRoyaltiesToCoinsBasisPoints)
+
+	// m0 updates the split to pay m1 only 5%. The NFT references the split, so the update
+	// changes what its sale pays.
+	_royaltySplitWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, &RoyaltySplitMetadata{
+		RoyaltySplitID: royaltySplitID,
+		DESORoyalties:  map[PublicKey]uint64{*NewPublicKey(m1PkBytes): 5 * 100, *NewPublicKey(m3PkBytes): 5 * 100},
+		CoinRoyalties:  map[PublicKey]uint64{*NewPublicKey(m2PkBytes): 3 * 100},
+	})
+	updatedEntry := &RoyaltySplitEntry{
+		RoyaltySplitID:           royaltySplitID,
+		CreatorPKID:              m0PKID,
+		DESORoyaltiesBasisPoints: map[PKID]uint64{*m1PKID: 5 * 100, *m3PKID: 5 * 100},
+		CoinRoyaltiesBasisPoints: map[PKID]uint64{*m2PKID: 3 * 100},
+	}
+	requireRoyaltySplitEntry(nil, royaltySplitID, updatedEntry)
+	// Disconnecting the update puts the registered split back.
+	requireRoyaltySplitEntry(disconnectLastTxn(), royaltySplitID, registeredEntry)
+
+	// m5 bids 10,000 nanos and m0 accepts. The split's current recipients are paid: 500 to m1
+	// and 500 to m3 in DESO, and 300 to m2's coin.
+	bidAmountNanos := uint64(10000)
+	_createNFTBidWithTestMeta(testMeta, feeRateNanosPerKB, m5Pub, m5Priv, postHash, 1, bidAmountNanos)
+	require.Equal(royaltySplitID, DBGetPostEntryByPostHash(db, chain.snapshot, postHash).RoyaltySplitID)
+	m1BalanceBeforeSale := _getBalance(t, chain, nil, m1Pub)
+	m3BalanceBeforeSale := _getBalance(t, chain, nil, m3Pub)
+	m2CoinEntryBeforeSale := DBGetProfileEntryForPKID(db, chain.snapshot, m2PKID).CreatorCoinEntry
+	_acceptNFTBidWithTestMeta(testMeta, feeRateNanosPerKB, m0Pub, m0Priv, postHash, 1, m5Pub, bidAmountNanos, "")
+	require.Equal(m1BalanceBeforeSale+500, _getBalance(t, chain, nil, m1Pub))
+	require.Equal(m3BalanceBeforeSale+500, _getBalance(t, chain, nil, m3Pub))
+	require.Equal(m2CoinEntryBeforeSale.DeSoLockedNanos+300,
+		DBGetProfileEntryForPKID(db, chain.snapshot, m2PKID).CreatorCoinEntry.DeSoLockedNanos)
+
+	// Rolling everything back deletes the split and its index.
+	_executeAllTestRollbackAndFlush(testMeta)
+	dbRoyaltySplitEntry, err := DBGetRoyaltySplitEntry(db, chain.snapshot, royaltySplitID)
+	require.NoError(err)
+	require.Nil(dbRoyaltySplitEntry)
+	dbRoyaltySplitEntries, err := DBGetRoyaltySplitEntriesForCreator(db, chain.snapshot, m0PKID)
+	require.NoError(err)
+	require.Empty(dbRoyaltySplitEntries)
+}
+
+//
+// ----- HELPERS
+//
+
+func _royaltySplitWithTestMeta(
+	testMeta *TestMeta,
+	feeRateNanosPerKB uint64,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *RoyaltySplitMetadata,
+) {
+	testMeta.expectedSenderBalances = append(
+		testMeta.expectedSenderBalances, _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check))
+	currentOps, currentTxn, err := _royaltySplit(
+		testMeta.t, testMeta.chain, testMeta.db, testMeta.params, feeRateNanosPerKB,
+		transactorPublicKeyBase58Check, transactorPrivateKeyBase58Check, metadata)
+	require.NoError(testMeta.t, err)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+}
+
+func _royaltySplit(t *testing.T, chain *Blockchain, db *badger.DB, params *DeSoParams,
+	feeRateNanosPerKB uint64, transactorPublicKeyBase58Check string, transactorPrivateKeyBase58Check string,
+	metadata *RoyaltySplitMetadata,
+) (_utxoOps []*UtxoOperation, _txn *MsgDeSoTxn, _err error) {
+	require := require.New(t)
+
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(err)
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	txn, totalInputMake, _, feesMake, err := chain.CreateRoyaltySplitTxn(
+		transactorPkBytes, metadata, nil, feeRateNanosPerKB, nil, []*DeSoOutput{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(t, txn, transactorPrivateKeyBase58Check)
+
+	// Always use height+1 for validation since it's assumed the transaction will
+	// get mined into the next block.
+	blockHeight := chain.blockTip().Height + 1
+	utxoOps, totalInput, totalOutput, fees, err :=
+		utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	require.Equal(totalInput, totalOutput+fees)
+	require.Equal(totalInputMake, totalInput)
+	require.Equal(feesMake, fees)
+	require.Equal(OperationTypeSpendBalance, utxoOps[0].Type)
+	require.Equal(OperationTypeRoyaltySplit, utxoOps[len(utxoOps)-1].Type)
+
+	require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+
+	return utxoOps, txn, nil
+}
@@ -28,6 +28,15 @@ import (
 // UnlockStake: Once sufficient time has elapsed since unstaking their funds, a user can
 // submit an UnlockStake transaction to retrieve their funds. Any eligible funds are
 // unlocked and returned to the user's account balance.
+//
+// Delegation: Staking with a validator other than yourself is how a user delegates, so
+// delegated stake goes through the same three transactions and the same lockup period
+// when it's unstaked. A delegator is exposed to their validator's behavior: the stake
+// stops earning rewards while the validator is jailed or out of the validator set, and a
+// SlashValidator txn burns a share of it, along with any stake still locked up after
+// unstaking from the validator, if the validator votes twice in a view. A user's delegations can be looked up with GetStakeEntriesForStakerPKID
+// and GetLockedStakeEntriesForStakerPKID, and a validator's delegators with
+// GetDelegatedStakeEntriesForValidatorPKID.
 
 //
 // TYPES: StakeEntry
@@ -47,7 +56,20 @@ type StakeEntry struct {
 	RewardMethod     StakingRewardMethod
 	StakeAmountNanos *uint256.Int
 	ExtraData        map[string][]byte
-	isDeleted        bool
+
+	// RewardIndexCheckpoint is the value of the validator's reward index for this
+	// stake's RewardMethod as of the last time this stake's rewards were settled. A nil
+	// checkpoint is treated as the index's starting value, which means a stake that
+	// predates the StakingRewardsAccrualBlockHeight accrues rewards from the moment the
+	// validator's reward index starts growing.
+	RewardIndexCheckpoint *uint256.Int
+	// WarmupStakeAmountNanos is the portion of StakeAmountNanos that was staked during
+	// WarmupEpochNumber. It doesn't earn rewards until that epoch is complete, so a stake
+	// added just before an epoch ends doesn't earn the whole epoch's reward.
+	WarmupStakeAmountNanos *uint256.Int
+	WarmupEpochNumber      uint64
+
+	isDeleted bool
 }
 
 type StakeMapKey struct {
@@ -56,13 +78,27 @@ type StakeMapKey struct {
 }
 
 func (stakeEntry *StakeEntry) Copy() *StakeEntry {
+	var rewardIndexCheckpoint *uint256.Int
+	if stakeEntry.RewardIndexCheckpoint != nil {
+		rewardIndexCheckpoint = stakeEntry.RewardIndexCheckpoint.Clone()
+	}
+	var warmupStakeAmountNanos *uint256.Int
+	if stakeEntry.WarmupStakeAmountNanos != nil {
+		warmupStakeAmountNanos = stakeEntry.WarmupStakeAmountNanos.Clone()
+	}
 	return &StakeEntry{
 		StakerPKID:       stakeEntry.StakerPKID.NewPKID(),
 		ValidatorPKID:    stakeEntry.ValidatorPKID.NewPKID(),
 		RewardMethod:     stakeEntry.RewardMethod,
 		StakeAmountNanos: stakeEntry.StakeAmountNanos.Clone(),
 		ExtraData:        copyExtraData(stakeEntry.ExtraData),
-		isDeleted:        stakeEntry.isDeleted,
+
+		RewardIndexCheckpoint: rewardIndexCheckpoint,
+
+		WarmupStakeAmountNanos: warmupStakeAmountNanos,
+		WarmupEpochNumber:      stakeEntry.WarmupEpochNumber,
+
+		isDeleted: stakeEntry.isDeleted,
 	}
 }
 
@@ -84,6 +120,11 @@ func (stakeEntry *StakeEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipM
 	data = append(data, stakeEntry.RewardMethod)
 	data = append(data, VariableEncodeUint256(stakeEntry.StakeAmountNanos)...)
 	data = append(data, EncodeExtraData(stakeEntry.ExtraData)...)
+	if MigrationTriggered(blockHeight, StakingRewardsAccrualMigration) {
+		data = append(data, VariableEncodeUint256(stakeEntry.RewardIndexCheckpoint)...)
+		data = append(data, VariableEncodeUint256(stakeEntry.WarmupStakeAmountNanos)...)
+		data = append(data, UintToBuf(stakeEntry.WarmupEpochNumber)...)
+	}
 	return data
 }
 
@@ -120,11 +161,31 @@ func (stakeEntry *StakeEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *b
 		return errors.Wrapf(err, "StakeEntry.Decode: Problem reading ExtraData: ")
 	}
 
+	if MigrationTriggered(blockHeight, StakingRewardsAccrualMigration) {
+		// RewardIndexCheckpoint
+		stakeEntry.RewardIndexCheckpoint, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "StakeEntry.Decode: Problem reading RewardIndexCheckpoint: ")
+		}
+
+		// WarmupStakeAmountNanos
+		stakeEntry.WarmupStakeAmountNanos, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "StakeEntry.Decode: Problem reading WarmupStakeAmountNanos: ")
+		}
+
+		// WarmupEpochNumber
+		stakeEntry.WarmupEpochNumber, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "StakeEntry.Decode: Problem reading WarmupEpochNumber: ")
+		}
+	}
+
 	return err
 }
 
 func (stakeEntry *StakeEntry) GetVersionByte(blockHeight uint64) byte {
-	return 0
+	return GetMigrationVersion(blockHeight, StakingRewardsAccrualMigration)
 }
 
 func (stakeEntry *StakeEntry) GetEncoderType() EncoderType {
@@ -603,9 +664,39 @@ func DBKeyForLockedStakeByValidatorAndStakerAndLockedAt(lockedStakeEntry *Locked
 }
 
 func DBPrefixKeyForLockedStakeByValidatorAndStaker(lockedStakeEntry *LockedStakeEntry) []byte {
+	data := DBPrefixKeyForLockedStakeByValidator(lockedStakeEntry.ValidatorPKID)
+	data = append(data, lockedStakeEntry.StakerPKID.ToBytes()...)
+	return data
+}
+
+func DBPrefixKeyForLockedStakeByValidator(validatorPKID *PKID) []byte {
 	data := append([]byte{}, Prefixes.PrefixLockedStakeByValidatorAndStakerAndLockedAt...)
+	data = append(data, validatorPKID.ToBytes()...)
+	return data
+}
+
+func DBKeyForStakeByStakerAndValidator(stakerPKID *PKID, validatorPKID *PKID) []byte {
+	data := DBKeyForStakeByStaker(stakerPKID)
+	data = append(data, validatorPKID.ToBytes()...)
+	return data
+}
+
+func DBKeyForStakeByStaker(stakerPKID *PKID) []byte {
+	data := append([]byte{}, Prefixes.PrefixStakeByStakerAndValidator...)
+	data = append(data, stakerPKID.ToBytes()...)
+	return data
+}
+
+func DBKeyForLockedStakeByStakerAndValidatorAndLockedAt(lockedStakeEntry *LockedStakeEntry) []byte {
+	data := DBKeyForLockedStakeByStaker(lockedStakeEntry.StakerPKID)
 	data = append(data, lockedStakeEntry.ValidatorPKID.ToBytes()...)
-	data = append(data, lockedStakeEntry.StakerPKID.ToBytes()...)
+	data = append(data, EncodeUint64(lockedStakeEntry.LockedAtEpochNumber)...)
+	return data
+}
+
+func DBKeyForLockedStakeByStaker(stakerPKID *PKID) []byte {
+	data := append([]byte{}, Prefixes.PrefixLockedStakeByStakerAndValidatorAndLockedAt...)
+	data = append(data, stakerPKID.ToBytes()...)
 	return data
 }
 
@@ -913,6 +1004,33 @@ func DBGetLockedStakeEntriesInRangeWithTxn(
 	return lockedStakeEntries, nil
 }
 
+func DBGetLockedStakeEntriesForValidatorPKID(
+	handle *badger.DB,
+	snap *Snapshot,
+	validatorPKID *PKID,
+) ([]*LockedStakeEntry, error) {
+	// Retrieve LockedStakeEntries from db.
+	prefix := DBPrefixKeyForLockedStakeByValidator(validatorPKID)
+	_, valsFound, err := EnumerateKeysForPrefixWithLimitOffsetOrder(
+		handle, prefix, 0, nil, false, NewSet([]string{}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetLockedStakeEntriesForValidatorPKID: problem retrieving LockedStakeEntries: ")
+	}
+
+	// Decode LockedStakeEntries from bytes.
+	var lockedStakeEntries []*LockedStakeEntry
+	for _, lockedStakeEntryBytes := range valsFound {
+		rr := bytes.NewReader(lockedStakeEntryBytes)
+		lockedStakeEntry, err := DecodeDeSoEncoder(&LockedStakeEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetLockedStakeEntriesForValidatorPKID: problem decoding LockedStakeEntry: ")
+		}
+		lockedStakeEntries = append(lockedStakeEntries, lockedStakeEntry)
+	}
+	return lockedStakeEntries, nil
+}
+
 // In order to optimize the flush, we want to only write entries to the db that have changed.
 // On top of that, we add a further optimization to only update the
 // PrefixStakeByStakeAmount index if the stake amount has changed. Not doing this results
@@ -1086,6 +1204,241 @@ func DBDeleteLockedStakeEntryWithTxn(
 	return nil
 }
 
+func DBGetStakeEntriesForStakerPKID(handle *badger.DB, snap *Snapshot, stakerPKID *PKID) ([]*StakeEntry, error) {
+	var stakeEntries []*StakeEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		// Retrieve the ValidatorPKIDs the staker has staked to from the index.
+		prefix := DBKeyForStakeByStaker(stakerPKID)
+		keysFound := _enumerateKeysOnlyForPrefixWithTxn(txn, prefix)
+		for _, key := range keysFound {
+			if len(key) != len(prefix)+PublicKeyLenCompressed {
+				return fmt.Errorf("DBGetStakeEntriesForStakerPKID: invalid key length %d", len(key))
+			}
+			validatorPKID := NewPKID(key[len(prefix):])
+
+			// Retrieve the StakeEntry from the primary index.
+			stakeEntry, err := DBGetStakeEntryWithTxn(txn, snap, validatorPKID, stakerPKID)
+			if err != nil {
+				return errors.Wrapf(err, "DBGetStakeEntriesForStakerPKID: ")
+			}
+			if stakeEntry == nil {
+				return fmt.Errorf(
+					"DBGetStakeEntriesForStakerPKID: missing StakeEntry for ValidatorPKID %v and StakerPKID %v",
+					validatorPKID, stakerPKID,
+				)
+			}
+			stakeEntries = append(stakeEntries, stakeEntry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stakeEntries, nil
+}
+
+func DBGetLockedStakeEntriesForStakerPKID(
+	handle *badger.DB,
+	snap *Snapshot,
+	stakerPKID *PKID,
+) ([]*LockedStakeEntry, error) {
+	var lockedStakeEntries []*LockedStakeEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		// Retrieve the ValidatorPKIDs and LockedAtEpochNumbers from the index.
+		prefix := DBKeyForLockedStakeByStaker(stakerPKID)
+		keysFound := _enumerateKeysOnlyForPrefixWithTxn(txn, prefix)
+		for _, key := range keysFound {
+			if len(key) != len(prefix)+PublicKeyLenCompressed+8 {
+				return fmt.Errorf("DBGetLockedStakeEntriesForStakerPKID: invalid key length %d", len(key))
+			}
+			validatorPKID := NewPKID(key[len(prefix) : len(prefix)+PublicKeyLenCompressed])
+			lockedAtEpochNumber := DecodeUint64(key[len(prefix)+PublicKeyLenCompressed:])
+
+			// Retrieve the LockedStakeEntry from the primary index.
+			lockedStakeEntry, err := DBGetLockedStakeEntryWithTxn(
+				txn, snap, validatorPKID, stakerPKID, lockedAtEpochNumber,
+			)
+			if err != nil {
+				return errors.Wrapf(err, "DBGetLockedStakeEntriesForStakerPKID: ")
+			}
+			if lockedStakeEntry == nil {
+				return fmt.Errorf(
+					"DBGetLockedStakeEntriesForStakerPKID: missing LockedStakeEntry for ValidatorPKID %v, "+
+						"StakerPKID %v, and LockedAtEpochNumber %d", validatorPKID, stakerPKID, lockedAtEpochNumber,
+				)
+			}
+			lockedStakeEntries = append(lockedStakeEntries, lockedStakeEntry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lockedStakeEntries, nil
+}
+
+// DBPutStakeByStakerIndexWithTxn adds a StakeEntry to the staker index. The index isn't
+// part of the state, so it's written without the snapshot or the event manager.
+func DBPutStakeByStakerIndexWithTxn(txn *badger.Txn, stakeEntry *StakeEntry) error {
+	if stakeEntry == nil {
+		return nil
+	}
+	key := DBKeyForStakeByStakerAndValidator(stakeEntry.StakerPKID, stakeEntry.ValidatorPKID)
+	if err := DBSetWithTxn(txn, nil, key, []byte{}, nil); err != nil {
+		return errors.Wrapf(
+			err, "DBPutStakeByStakerIndexWithTxn: problem storing StakeEntry in index PrefixStakeByStakerAndValidator: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteStakeByStakerIndexWithTxn(txn *badger.Txn, stakeEntry *StakeEntry) error {
+	if stakeEntry == nil {
+		return nil
+	}
+	key := DBKeyForStakeByStakerAndValidator(stakeEntry.StakerPKID, stakeEntry.ValidatorPKID)
+	if err := DBDeleteWithTxn(txn, nil, key, nil, true); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteStakeByStakerIndexWithTxn: problem deleting StakeEntry from index PrefixStakeByStakerAndValidator: ",
+		)
+	}
+	return nil
+}
+
+// DBPutLockedStakeByStakerIndexWithTxn adds a LockedStakeEntry to the staker index. Like the
+// StakeEntry index, it isn't part of the state.
+func DBPutLockedStakeByStakerIndexWithTxn(txn *badger.Txn, lockedStakeEntry *LockedStakeEntry) error {
+	if lockedStakeEntry == nil {
+		return nil
+	}
+	key := DBKeyForLockedStakeByStakerAndValidatorAndLockedAt(lockedStakeEntry)
+	if err := DBSetWithTxn(txn, nil, key, []byte{}, nil); err != nil {
+		return errors.Wrapf(
+			err, "DBPutLockedStakeByStakerIndexWithTxn: problem storing LockedStakeEntry in index "+
+				"PrefixLockedStakeByStakerAndValidatorAndLockedAt: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteLockedStakeByStakerIndexWithTxn(txn *badger.Txn, lockedStakeEntry *LockedStakeEntry) error {
+	if lockedStakeEntry == nil {
+		return nil
+	}
+	key := DBKeyForLockedStakeByStakerAndValidatorAndLockedAt(lockedStakeEntry)
+	if err := DBDeleteWithTxn(txn, nil, key, nil, true); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteLockedStakeByStakerIndexWithTxn: problem deleting LockedStakeEntry from index "+
+				"PrefixLockedStakeByStakerAndValidatorAndLockedAt: ",
+		)
+	}
+	return nil
+}
+
+// DbBuildStakerIndexesIfMissing builds the staker indexes if they haven't been built yet,
+// e.g. because the db was created before the indexes existed.
+func DbBuildStakerIndexesIfMissing(handle *badger.DB) error {
+	isBuilt := false
+	err := handle.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(Prefixes.PrefixStakerIndexesBuilt)
+		if err == nil {
+			isBuilt = true
+			return nil
+		} else if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbBuildStakerIndexesIfMissing: Problem checking indexes: ")
+	}
+	if isBuilt {
+		return nil
+	}
+	return DbRebuildStakerIndexes(handle)
+}
+
+// DbRebuildStakerIndexes clears PrefixStakeByStakerAndValidator and
+// PrefixLockedStakeByStakerAndValidatorAndLockedAt and builds them again from the
+// StakeEntries and LockedStakeEntries in the db. The indexes are written in batches, so
+// this works no matter how many entries there are.
+func DbRebuildStakerIndexes(handle *badger.DB) error {
+	glog.Infof("DbRebuildStakerIndexes: Building staker indexes")
+
+	// Clear the existing indexes, starting with the marker so that the indexes are rebuilt
+	// if we're interrupted.
+	var keysToDelete [][]byte
+	err := handle.View(func(txn *badger.Txn) error {
+		for _, prefix := range [][]byte{
+			Prefixes.PrefixStakerIndexesBuilt,
+			Prefixes.PrefixStakeByStakerAndValidator,
+			Prefixes.PrefixLockedStakeByStakerAndValidatorAndLockedAt,
+		} {
+			keysToDelete = append(keysToDelete, _enumerateKeysOnlyForPrefixWithTxn(txn, prefix)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbRebuildStakerIndexes: Problem enumerating indexes: ")
+	}
+	deleteBatch := handle.NewWriteBatch()
+	defer deleteBatch.Cancel()
+	for _, key := range keysToDelete {
+		if err = deleteBatch.Delete(key); err != nil {
+			return errors.Wrapf(err, "DbRebuildStakerIndexes: Problem deleting indexes: ")
+		}
+	}
+	if err = deleteBatch.Flush(); err != nil {
+		return errors.Wrapf(err, "DbRebuildStakerIndexes: Problem deleting indexes: ")
+	}
+
+	writeBatch := handle.NewWriteBatch()
+	defer writeBatch.Cancel()
+	err = handle.View(func(txn *badger.Txn) error {
+		// Keys in PrefixStakeByValidatorAndStaker are: Prefix, <ValidatorPKID>, <StakerPKID>.
+		stakePrefix := Prefixes.PrefixStakeByValidatorAndStaker
+		for _, key := range _enumerateKeysOnlyForPrefixWithTxn(txn, stakePrefix) {
+			if len(key) != len(stakePrefix)+2*PublicKeyLenCompressed {
+				return fmt.Errorf("invalid StakeEntry key length %d", len(key))
+			}
+			validatorPKID := NewPKID(key[len(stakePrefix) : len(stakePrefix)+PublicKeyLenCompressed])
+			stakerPKID := NewPKID(key[len(stakePrefix)+PublicKeyLenCompressed:])
+			if err := writeBatch.Set(DBKeyForStakeByStakerAndValidator(stakerPKID, validatorPKID), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		// Keys in PrefixLockedStakeByValidatorAndStakerAndLockedAt are:
+		// Prefix, <ValidatorPKID>, <StakerPKID>, <LockedAtEpochNumber>.
+		lockedStakePrefix := Prefixes.PrefixLockedStakeByValidatorAndStakerAndLockedAt
+		for _, key := range _enumerateKeysOnlyForPrefixWithTxn(txn, lockedStakePrefix) {
+			if len(key) != len(lockedStakePrefix)+2*PublicKeyLenCompressed+8 {
+				return fmt.Errorf("invalid LockedStakeEntry key length %d", len(key))
+			}
+			stakerPKIDOffset := len(lockedStakePrefix) + PublicKeyLenCompressed
+			lockedStakeEntry := &LockedStakeEntry{
+				ValidatorPKID:       NewPKID(key[len(lockedStakePrefix):stakerPKIDOffset]),
+				StakerPKID:          NewPKID(key[stakerPKIDOffset : stakerPKIDOffset+PublicKeyLenCompressed]),
+				LockedAtEpochNumber: DecodeUint64(key[stakerPKIDOffset+PublicKeyLenCompressed:]),
+			}
+			if err := writeBatch.Set(DBKeyForLockedStakeByStakerAndValidatorAndLockedAt(lockedStakeEntry), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbRebuildStakerIndexes: Problem indexing stake: ")
+	}
+	if err = writeBatch.Set(Prefixes.PrefixStakerIndexesBuilt, []byte{}); err != nil {
+		return errors.Wrapf(err, "DbRebuildStakerIndexes: Problem marking indexes as built: ")
+	}
+	if err = writeBatch.Flush(); err != nil {
+		return errors.Wrapf(err, "DbRebuildStakerIndexes: Problem writing indexes: ")
+	}
+	return nil
+}
+
 //
 // BLOCKCHAIN UTILS
 //
@@ -1116,7 +1469,7 @@ func (bc *Blockchain) CreateStakeTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use
 	// it to get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	if !isInterfaceValueNil(mempool) {
 		var err error
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -1189,7 +1542,7 @@ func (bc *Blockchain) CreateUnstakeTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use
 	// it to get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	if !isInterfaceValueNil(mempool) {
 		var err error
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -1261,7 +1614,7 @@ func (bc *Blockchain) CreateUnlockStakeTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use
 	// it to get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	if !isInterfaceValueNil(mempool) {
 		var err error
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -1394,6 +1747,17 @@ func (bav *UtxoView) _connectStake(
 	if err != nil {
 		return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
 	}
+	// Retrieve the validator's ValidatorRewardIndexEntry before any of its StakeEntries change,
+	// so that its Restake stake can be totaled from them if it hasn't been yet. The
+	// PrevValidatorRewardIndexEntry will be restored if we disconnect this transaction.
+	var prevRewardIndexEntry, currentRewardIndexEntry *ValidatorRewardIndexEntry
+	if blockHeight >= bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight {
+		prevRewardIndexEntry, err = bav.getValidatorRewardIndexEntryWithRestakeStake(prevValidatorEntry.ValidatorPKID)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
+		}
+		currentRewardIndexEntry = prevRewardIndexEntry.Copy()
+	}
 	// Delete the existing StakeEntry, if exists.
 	//
 	// Note that we don't really need to do this, as setting a new StakeEntry will naturally cause
@@ -1412,6 +1776,27 @@ func (bav *UtxoView) _connectStake(
 		}
 	}
 
+	// Settle any staking rewards the existing StakeEntry has accrued since its last
+	// checkpoint. Restake rewards are added to the stake and PayToBalance rewards are
+	// paid to the staker's balance.
+	restakedRewardNanos := uint256.NewInt()
+	var paidRewardNanos uint64
+	if prevStakeEntry != nil {
+		var rewardUtxoOp *UtxoOperation
+		restakedRewardNanos, rewardUtxoOp, err = bav.settleStakeReward(prevStakeEntry, uint64(blockHeight))
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
+		}
+		if rewardUtxoOp != nil {
+			paidRewardNanos = rewardUtxoOp.BalanceAmountNanos
+			utxoOpsForTxn = append(utxoOpsForTxn, rewardUtxoOp)
+		}
+		stakeAmountNanos, err = SafeUint256().Add(stakeAmountNanos, restakedRewardNanos)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectStake: error adding restaked rewards to StakeAmountNanos: ")
+		}
+	}
+
 	// Retrieve existing ExtraData to merge with any new ExtraData.
 	var prevExtraData map[string][]byte
 	if prevStakeEntry != nil {
@@ -1426,9 +1811,38 @@ func (bav *UtxoView) _connectStake(
 		StakeAmountNanos: stakeAmountNanos,
 		ExtraData:        mergeExtraData(prevExtraData, txn.ExtraData),
 	}
+	// Checkpoint the new StakeEntry against its validator's current reward index.
+	currentStakeEntry.RewardIndexCheckpoint, err = bav.getRewardIndexCheckpoint(currentStakeEntry, uint64(blockHeight))
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
+	}
+	// The newly staked amount doesn't earn rewards until the current epoch is complete.
+	var prevWarmupStakeAmountNanos *uint256.Int
+	var prevWarmupEpochNumber uint64
+	if prevStakeEntry != nil {
+		prevWarmupStakeAmountNanos, prevWarmupEpochNumber = prevStakeEntry.WarmupStakeAmountNanos, prevStakeEntry.WarmupEpochNumber
+	}
+	currentStakeEntry.WarmupStakeAmountNanos, currentStakeEntry.WarmupEpochNumber, err = bav.computeWarmupStakeAmountNanos(
+		prevWarmupStakeAmountNanos, prevWarmupEpochNumber, txMeta.StakeAmountNanos, uint256.NewInt(), uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
+	}
 	// Set the new StakeEntry.
 	bav._setStakeEntryMappings(currentStakeEntry)
 
+	// Update the validator's Restake stake. The settled Restake rewards were already added to
+	// the validator's TotalStakeAmountNanos, apart from any shortfall from rounding.
+	restakedRewardShortfallNanos, err := bav.updateRestakeStakeAmounts(
+		currentRewardIndexEntry, prevStakeEntry, currentStakeEntry, restakedRewardNanos, uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
+	}
+	if currentRewardIndexEntry != nil {
+		bav._setValidatorRewardIndexEntryMappings(currentRewardIndexEntry)
+	}
+
 	// Update the ValidatorEntry.TotalStakeAmountNanos.
 	// 1. Copy the existing ValidatorEntry.
 	currentValidatorEntry := prevValidatorEntry.Copy()
@@ -1444,6 +1858,22 @@ func (bav *UtxoView) _connectStake(
 	if err != nil {
 		return 0, 0, nil, errors.Wrapf(err, "_connectStake: error adding StakeAmountNanos to TotalStakeAmountNanos: ")
 	}
+	currentValidatorEntry.TotalStakeAmountNanos, err = SafeUint256().Add(
+		currentValidatorEntry.TotalStakeAmountNanos, restakedRewardShortfallNanos,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectStake: error adding restaked rewards to TotalStakeAmountNanos: ")
+	}
+	currentValidatorEntry.WarmupStakeAmountNanos, currentValidatorEntry.WarmupEpochNumber, err = bav.computeWarmupStakeAmountNanos(
+		prevValidatorEntry.WarmupStakeAmountNanos,
+		prevValidatorEntry.WarmupEpochNumber,
+		txMeta.StakeAmountNanos,
+		uint256.NewInt(),
+		uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
+	}
 	// 4. Set the new ValidatorEntry.
 	bav._setValidatorEntryMappings(currentValidatorEntry)
 
@@ -1457,12 +1887,19 @@ func (bav *UtxoView) _connectStake(
 
 	// Create a UTXO operation
 	utxoOpForTxn := &UtxoOperation{
-		Type:               OperationTypeStake,
-		PrevValidatorEntry: prevValidatorEntry,
-		PrevStakeEntries:   prevStakeEntries,
+		Type:                          OperationTypeStake,
+		PrevValidatorEntry:            prevValidatorEntry,
+		PrevStakeEntries:              prevStakeEntries,
+		PrevValidatorRewardIndexEntry: prevRewardIndexEntry,
 	}
 	if err = bav.SanityCheckStakeTxn(
-		transactorPKIDEntry.PKID, utxoOpForTxn, txMeta.StakeAmountNanos, txn.TxnFeeNanos, prevBalanceNanos,
+		transactorPKIDEntry.PKID,
+		utxoOpForTxn,
+		txMeta.StakeAmountNanos,
+		restakedRewardNanos,
+		paidRewardNanos,
+		txn.TxnFeeNanos,
+		prevBalanceNanos,
 	); err != nil {
 		return 0, 0, nil, errors.Wrapf(err, "_connectStake: ")
 	}
@@ -1544,6 +1981,17 @@ func (bav *UtxoView) _disconnectStake(
 		bav._setStakeEntryMappings(operationData.PrevStakeEntries[0])
 	}
 
+	// Restore the PrevValidatorRewardIndexEntry, if exists.
+	if operationData.PrevValidatorRewardIndexEntry != nil {
+		bav._setValidatorRewardIndexEntryMappings(operationData.PrevValidatorRewardIndexEntry)
+	}
+
+	// Revert any staking rewards that were paid to the transactor's balance.
+	operationIndex, err = bav._disconnectStakeRewardPayments(utxoOpsForTxn, operationIndex)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectStake: ")
+	}
+
 	// Disconnect the BasicTransfer. Disconnecting the BasicTransfer also returns
 	// the extra spend associated with the amount the transactor staked.
 	return bav._disconnectBasicTransfer(
@@ -1620,14 +2068,64 @@ func (bav *UtxoView) _connectUnstake(
 	if prevStakeEntry == nil || prevStakeEntry.isDeleted {
 		return 0, 0, nil, errors.Wrapf(RuleErrorInvalidUnstakeNoStakeFound, "_connectUnstake: ")
 	}
-	if prevStakeEntry.StakeAmountNanos.Cmp(txMeta.UnstakeAmountNanos) < 0 {
+	prevStakeEntries := []*StakeEntry{prevStakeEntry}
+
+	// Retrieve the validator's ValidatorRewardIndexEntry before the StakeEntry changes. The
+	// PrevValidatorRewardIndexEntry will be restored if we disconnect the txn.
+	var prevRewardIndexEntry, currentRewardIndexEntry *ValidatorRewardIndexEntry
+	if blockHeight >= bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight {
+		prevRewardIndexEntry, err = bav.getValidatorRewardIndexEntryWithRestakeStake(prevValidatorEntry.ValidatorPKID)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: ")
+		}
+		currentRewardIndexEntry = prevRewardIndexEntry.Copy()
+	}
+
+	// Settle the StakeEntry's staking rewards. Restake rewards are added to the stake, and so
+	// can be unstaked along with it. PayToBalance rewards are paid to the staker's balance.
+	restakedRewardNanos, rewardUtxoOp, err := bav.settleStakeReward(prevStakeEntry, uint64(blockHeight))
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: ")
+	}
+	if rewardUtxoOp != nil {
+		utxoOpsForTxn = append(utxoOpsForTxn, rewardUtxoOp)
+	}
+	settledStakeAmountNanos, err := SafeUint256().Add(prevStakeEntry.StakeAmountNanos, restakedRewardNanos)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: error adding restaked rewards to StakeAmountNanos: ")
+	}
+	if settledStakeAmountNanos.Cmp(txMeta.UnstakeAmountNanos) < 0 {
 		return 0, 0, nil, errors.Wrapf(RuleErrorInvalidUnstakeInsufficientStakeFound, "_connectUnstake: ")
 	}
-	prevStakeEntries := []*StakeEntry{prevStakeEntry}
+
+	// Unstaked stake is taken from the stake that is still warming up first. Track how much of
+	// it was warming up so it can be removed from the validator's warmup stake as well.
+	warmupStakeAmountNanos, warmupEpochNumber, err := bav.computeWarmupStakeAmountNanos(
+		prevStakeEntry.WarmupStakeAmountNanos,
+		prevStakeEntry.WarmupEpochNumber,
+		uint256.NewInt(),
+		txMeta.UnstakeAmountNanos,
+		uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: ")
+	}
+	unstakedWarmupStakeAmountNanos := uint256.NewInt()
+	if warmupStakeAmountNanos != nil {
+		unstakedWarmupStakeAmountNanos, err = SafeUint256().Sub(
+			getActiveWarmupStakeAmountNanos(
+				prevStakeEntry.WarmupStakeAmountNanos, prevStakeEntry.WarmupEpochNumber, warmupEpochNumber,
+			),
+			warmupStakeAmountNanos,
+		)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: error computing unstaked warmup stake: ")
+		}
+	}
 
 	// Update the StakeEntry, decreasing the StakeAmountNanos.
 	// 1. Calculate the updated StakeAmountNanos.
-	stakeAmountNanos, err := SafeUint256().Sub(prevStakeEntry.StakeAmountNanos, txMeta.UnstakeAmountNanos)
+	stakeAmountNanos, err := SafeUint256().Sub(settledStakeAmountNanos, txMeta.UnstakeAmountNanos)
 	if err != nil {
 		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: error subtracting UnstakeAmountNanos from StakeAmountNanos: ")
 	}
@@ -1636,6 +2134,12 @@ func (bav *UtxoView) _connectUnstake(
 	if stakeAmountNanos.Cmp(uint256.NewInt()) > 0 {
 		currentStakeEntry = prevStakeEntry.Copy()
 		currentStakeEntry.StakeAmountNanos = stakeAmountNanos.Clone()
+		currentStakeEntry.RewardIndexCheckpoint, err = bav.getRewardIndexCheckpoint(currentStakeEntry, uint64(blockHeight))
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: ")
+		}
+		currentStakeEntry.WarmupStakeAmountNanos = warmupStakeAmountNanos
+		currentStakeEntry.WarmupEpochNumber = warmupEpochNumber
 	}
 	// 3. Delete the prevStakeEntry.
 	bav._deleteStakeEntryMappings(prevStakeEntry)
@@ -1645,6 +2149,18 @@ func (bav *UtxoView) _connectUnstake(
 		bav._setStakeEntryMappings(currentStakeEntry)
 	}
 
+	// Update the validator's Restake stake. The settled Restake rewards were already added to
+	// the validator's TotalStakeAmountNanos, apart from any shortfall from rounding.
+	restakedRewardShortfallNanos, err := bav.updateRestakeStakeAmounts(
+		currentRewardIndexEntry, prevStakeEntry, currentStakeEntry, restakedRewardNanos, uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: ")
+	}
+	if currentRewardIndexEntry != nil {
+		bav._setValidatorRewardIndexEntryMappings(currentRewardIndexEntry)
+	}
+
 	// Update the ValidatorEntry.TotalStakeAmountNanos.
 	// 1. Copy the existing ValidatorEntry.
 	currentValidatorEntry := prevValidatorEntry.Copy()
@@ -1655,12 +2171,28 @@ func (bav *UtxoView) _connectUnstake(
 	// but we do this here for clarity.
 	bav._deleteValidatorEntryMappings(prevValidatorEntry)
 	// 3. Update the new ValidatorEntry's TotalStakeAmountNanos.
+	currentValidatorEntry.TotalStakeAmountNanos, err = SafeUint256().Add(
+		currentValidatorEntry.TotalStakeAmountNanos, restakedRewardShortfallNanos,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: error adding restaked rewards to TotalStakeAmountNanos: ")
+	}
 	currentValidatorEntry.TotalStakeAmountNanos, err = SafeUint256().Sub(
 		currentValidatorEntry.TotalStakeAmountNanos, txMeta.UnstakeAmountNanos,
 	)
 	if err != nil {
 		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: error subtracting UnstakeAmountNanos from TotalStakeAmountNanos: ")
 	}
+	currentValidatorEntry.WarmupStakeAmountNanos, currentValidatorEntry.WarmupEpochNumber, err = bav.computeWarmupStakeAmountNanos(
+		prevValidatorEntry.WarmupStakeAmountNanos,
+		prevValidatorEntry.WarmupEpochNumber,
+		uint256.NewInt(),
+		unstakedWarmupStakeAmountNanos,
+		uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: ")
+	}
 	// 4. Set the new ValidatorEntry.
 	bav._setValidatorEntryMappings(currentValidatorEntry)
 
@@ -1714,13 +2246,16 @@ func (bav *UtxoView) _connectUnstake(
 
 	// Create a UTXO operation.
 	utxoOpForTxn := &UtxoOperation{
-		Type:                   OperationTypeUnstake,
-		PrevValidatorEntry:     prevValidatorEntry,
-		PrevStakeEntries:       prevStakeEntries,
-		PrevLockedStakeEntries: prevLockedStakeEntries,
-		LockedAtEpochNumber:    currentEpochNumber,
-	}
-	if err = bav.SanityCheckUnstakeTxn(transactorPKIDEntry.PKID, utxoOpForTxn, txMeta.UnstakeAmountNanos); err != nil {
+		Type:                          OperationTypeUnstake,
+		PrevValidatorEntry:            prevValidatorEntry,
+		PrevStakeEntries:              prevStakeEntries,
+		PrevLockedStakeEntries:        prevLockedStakeEntries,
+		LockedAtEpochNumber:           currentEpochNumber,
+		PrevValidatorRewardIndexEntry: prevRewardIndexEntry,
+	}
+	if err = bav.SanityCheckUnstakeTxn(
+		transactorPKIDEntry.PKID, utxoOpForTxn, txMeta.UnstakeAmountNanos, restakedRewardNanos,
+	); err != nil {
 		return 0, 0, nil, errors.Wrapf(err, "_connectUnstake: ")
 	}
 	utxoOpsForTxn = append(utxoOpsForTxn, utxoOpForTxn)
@@ -1828,6 +2363,17 @@ func (bav *UtxoView) _disconnectUnstake(
 		bav._setLockedStakeEntryMappings(operationData.PrevLockedStakeEntries[0])
 	}
 
+	// Restore the PrevValidatorRewardIndexEntry, if exists.
+	if operationData.PrevValidatorRewardIndexEntry != nil {
+		bav._setValidatorRewardIndexEntryMappings(operationData.PrevValidatorRewardIndexEntry)
+	}
+
+	// Revert any staking rewards that were paid to the transactor's balance.
+	operationIndex, err = bav._disconnectStakeRewardPayments(utxoOpsForTxn, operationIndex)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUnstake: ")
+	}
+
 	// Disconnect the basic transfer.
 	return bav._disconnectBasicTransfer(
 		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
@@ -2183,7 +2729,7 @@ func (bav *UtxoView) IsCorrectValidatorTotalStakeAmountNanos(validatorEntry *Val
 	// Map of all the stake entries for this validator.
 	stakeEntryMap := make(map[StakeMapKey]*StakeEntry)
 
-	dbStakeEntries, err := DBGetStakeEntriesForValidatorPKID(bav.Handle, bav.Snapshot, validatorEntry.ValidatorPKID)
+	dbStakeEntries, err := bav.GetDbAdapter().GetStakeEntriesForValidatorPKID(validatorEntry.ValidatorPKID)
 	if err != nil {
 		return false, errors.Wrapf(err, "IsCorrectValidatorTotalStakeAmountNanos: error retrieving StakeEntries: ")
 	}
@@ -2208,6 +2754,12 @@ func (bav *UtxoView) IsCorrectValidatorTotalStakeAmountNanos(validatorEntry *Val
 		}
 		totalStakeAmountNanos.Add(totalStakeAmountNanos, stakeEntry.StakeAmountNanos)
 	}
+	// Include the restaked rewards that haven't been settled into the StakeEntries yet.
+	restakedRewardNanos, err := bav.GetRestakedRewardNanos(validatorEntry.ValidatorPKID)
+	if err != nil {
+		return false, errors.Wrapf(err, "IsCorrectValidatorTotalStakeAmountNanos: ")
+	}
+	totalStakeAmountNanos.Add(totalStakeAmountNanos, restakedRewardNanos)
 	return totalStakeAmountNanos.Eq(validatorEntry.TotalStakeAmountNanos), nil
 }
 
@@ -2215,6 +2767,8 @@ func (bav *UtxoView) SanityCheckStakeTxn(
 	transactorPKID *PKID,
 	utxoOp *UtxoOperation,
 	amountNanos *uint256.Int,
+	restakedRewardNanos *uint256.Int,
+	paidRewardNanos uint64,
 	feeNanos uint64,
 	prevBalanceNanos uint64,
 ) error {
@@ -2233,13 +2787,38 @@ func (bav *UtxoView) SanityCheckStakeTxn(
 	if currentValidatorEntry == nil {
 		return errors.New("SanityCheckStakeTxn: no CurrentValidatorEntry found")
 	}
-	validatorEntryTotalStakeAmountNanosIncrease, err := SafeUint256().Sub(
-		currentValidatorEntry.TotalStakeAmountNanos, utxoOp.PrevValidatorEntry.TotalStakeAmountNanos,
+	// The stake increases by the staked amount plus any settled rewards that were restaked.
+	// Restaked rewards that were already added to the validator's TotalStakeAmountNanos are
+	// taken out of its RestakedRewardNanos instead.
+	// CurrentTotalStakeAmountNanos + PrevRestakedRewardNanos =
+	//     PrevTotalStakeAmountNanos + AmountNanos + RestakedRewardNanos + CurrentRestakedRewardNanos
+	expectedStakeAmountNanosIncrease, err := SafeUint256().Add(amountNanos, restakedRewardNanos)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckStakeTxn: error calculating expected StakeAmountNanos increase: ")
+	}
+	currentRestakedRewardNanos, err := bav.GetRestakedRewardNanos(currentValidatorEntry.ValidatorPKID)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckStakeTxn: ")
+	}
+	expectedTotalStakeAmountNanos, err := SafeUint256().Add(
+		utxoOp.PrevValidatorEntry.TotalStakeAmountNanos, expectedStakeAmountNanosIncrease,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckStakeTxn: error calculating expected TotalStakeAmountNanos: ")
+	}
+	expectedTotalStakeAmountNanos, err = SafeUint256().Add(
+		expectedTotalStakeAmountNanos, currentRestakedRewardNanos,
 	)
 	if err != nil {
-		return errors.Wrapf(err, "SanityCheckStakeTxn: error calculating TotalStakeAmountNanos increase: ")
+		return errors.Wrapf(err, "SanityCheckStakeTxn: error calculating expected TotalStakeAmountNanos: ")
 	}
-	if !validatorEntryTotalStakeAmountNanosIncrease.Eq(amountNanos) {
+	actualTotalStakeAmountNanos, err := SafeUint256().Add(
+		currentValidatorEntry.TotalStakeAmountNanos, getRestakedRewardNanos(utxoOp.PrevValidatorRewardIndexEntry),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckStakeTxn: error calculating TotalStakeAmountNanos: ")
+	}
+	if !actualTotalStakeAmountNanos.Eq(expectedTotalStakeAmountNanos) {
 		return errors.New("SanityCheckStakeTxn: TotalStakeAmountNanos increase does not match")
 	}
 
@@ -2261,17 +2840,21 @@ func (bav *UtxoView) SanityCheckStakeTxn(
 	if err != nil {
 		return errors.Wrapf(err, "SanityCheckStakeTxn: error calculating StakeAmountNanos increase: ")
 	}
-	if !stakeEntryStakeAmountNanosIncrease.Eq(amountNanos) {
+	if !stakeEntryStakeAmountNanosIncrease.Eq(expectedStakeAmountNanosIncrease) {
 		return errors.New("SanityCheckStakeTxn: StakeAmountNanos increase does not match")
 	}
 
 	// Validate TransactorBalance decrease.
-	// PrevTransactorBalanceNanos = CurrentTransactorBalanceNanos + AmountNanos + FeeNanos
-	// PrevTransactorBalanceNanos - CurrentTransactorBalanceNanos - FeeNanos = AmountNanos
+	// PrevTransactorBalanceNanos + PaidRewardNanos = CurrentTransactorBalanceNanos + AmountNanos + FeeNanos
+	// PrevTransactorBalanceNanos + PaidRewardNanos - CurrentTransactorBalanceNanos - FeeNanos = AmountNanos
 	currentBalanceNanos, err := bav.GetDeSoBalanceNanosForPublicKey(bav.GetPublicKeyForPKID(transactorPKID))
 	if err != nil {
 		return errors.Wrapf(err, "SanityCheckStakeTxn: error retrieving TransactorBalance: ")
 	}
+	prevBalanceNanos, err = SafeUint64().Add(prevBalanceNanos, paidRewardNanos)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckStakeTxn: error including paid rewards in TransactorBalance: ")
+	}
 	transactorBalanceNanosDecrease, err := SafeUint64().Sub(prevBalanceNanos, currentBalanceNanos)
 	if err != nil {
 		return errors.Wrapf(err, "SanityCheckStakeTxn: error calculating TransactorBalance decrease: ")
@@ -2296,7 +2879,12 @@ func (bav *UtxoView) SanityCheckStakeTxn(
 	return nil
 }
 
-func (bav *UtxoView) SanityCheckUnstakeTxn(transactorPKID *PKID, utxoOp *UtxoOperation, amountNanos *uint256.Int) error {
+func (bav *UtxoView) SanityCheckUnstakeTxn(
+	transactorPKID *PKID,
+	utxoOp *UtxoOperation,
+	amountNanos *uint256.Int,
+	restakedRewardNanos *uint256.Int,
+) error {
 	if utxoOp.Type != OperationTypeUnstake {
 		return fmt.Errorf("SanityCheckUnstakeTxn: called with %v", utxoOp.Type)
 	}
@@ -2312,13 +2900,40 @@ func (bav *UtxoView) SanityCheckUnstakeTxn(transactorPKID *PKID, utxoOp *UtxoOpe
 	if currentValidatorEntry == nil {
 		return errors.New("SanityCheckUnstakeTxn: no CurrentValidatorEntry found")
 	}
-	validatorEntryTotalStakeAmountNanosDecrease, err := SafeUint256().Sub(
-		utxoOp.PrevValidatorEntry.TotalStakeAmountNanos, currentValidatorEntry.TotalStakeAmountNanos,
+	// Settled rewards that were restaked are added to the stake before the amount is unstaked.
+	// Restaked rewards that were already added to the validator's TotalStakeAmountNanos are
+	// taken out of its RestakedRewardNanos instead.
+	// CurrentTotalStakeAmountNanos + AmountNanos + PrevRestakedRewardNanos =
+	//     PrevTotalStakeAmountNanos + RestakedRewardNanos + CurrentRestakedRewardNanos
+	currentRestakedRewardNanos, err := bav.GetRestakedRewardNanos(currentValidatorEntry.ValidatorPKID)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckUnstakeTxn: ")
+	}
+	expectedTotalStakeAmountNanos, err := SafeUint256().Add(
+		utxoOp.PrevValidatorEntry.TotalStakeAmountNanos, restakedRewardNanos,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckUnstakeTxn: error calculating expected TotalStakeAmountNanos: ")
+	}
+	expectedTotalStakeAmountNanos, err = SafeUint256().Add(
+		expectedTotalStakeAmountNanos, currentRestakedRewardNanos,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckUnstakeTxn: error calculating expected TotalStakeAmountNanos: ")
+	}
+	actualTotalStakeAmountNanos, err := SafeUint256().Add(
+		currentValidatorEntry.TotalStakeAmountNanos, amountNanos,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckUnstakeTxn: error calculating TotalStakeAmountNanos: ")
+	}
+	actualTotalStakeAmountNanos, err = SafeUint256().Add(
+		actualTotalStakeAmountNanos, getRestakedRewardNanos(utxoOp.PrevValidatorRewardIndexEntry),
 	)
 	if err != nil {
-		return errors.Wrapf(err, "SanityCheckUnstakeTxn: error calculating TotalStakeAmountNanos decrease: ")
+		return errors.Wrapf(err, "SanityCheckUnstakeTxn: error calculating TotalStakeAmountNanos: ")
 	}
-	if !validatorEntryTotalStakeAmountNanosDecrease.Eq(amountNanos) {
+	if !actualTotalStakeAmountNanos.Eq(expectedTotalStakeAmountNanos) {
 		return errors.New("SanityCheckUnstakeTxn: TotalStakeAmountNanos decrease does not match")
 	}
 
@@ -2334,8 +2949,12 @@ func (bav *UtxoView) SanityCheckUnstakeTxn(transactorPKID *PKID, utxoOp *UtxoOpe
 	if currentStakeEntry == nil {
 		currentStakeEntry = &StakeEntry{StakeAmountNanos: uint256.NewInt()}
 	}
+	settledStakeAmountNanos, err := SafeUint256().Add(prevStakeEntry.StakeAmountNanos, restakedRewardNanos)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckUnstakeTxn: error adding restaked rewards to StakeAmountNanos: ")
+	}
 	stakeEntryStakeAmountNanosDecrease, err := SafeUint256().Sub(
-		prevStakeEntry.StakeAmountNanos, currentStakeEntry.StakeAmountNanos,
+		settledStakeAmountNanos, currentStakeEntry.StakeAmountNanos,
 	)
 	if err != nil {
 		return errors.Wrapf(err, "SanityCheckUnstakeTxn: error calculating StakeAmountNanos decrease: ")
@@ -2448,7 +3067,7 @@ func (bav *UtxoView) GetStakeEntry(validatorPKID *PKID, stakerPKID *PKID) (*Stak
 		return stakeEntry, nil
 	}
 	// Then, check the database.
-	stakeEntry, err := DBGetStakeEntry(bav.Handle, bav.Snapshot, validatorPKID, stakerPKID)
+	stakeEntry, err := bav.GetDbAdapter().GetStakeEntry(validatorPKID, stakerPKID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetStakeEntry: ")
 	}
@@ -2466,7 +3085,7 @@ func (bav *UtxoView) GetStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*St
 	}
 
 	// First, pull matching StakeEntries from the database and cache them in the UtxoView.
-	dbStakeEntries, err := DBGetStakeEntriesForValidatorPKID(bav.Handle, bav.Snapshot, validatorPKID)
+	dbStakeEntries, err := bav.GetDbAdapter().GetStakeEntriesForValidatorPKID(validatorPKID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetStakeEntriesForValidatorPKID: error retrieving StakeEntries from the db: ")
 	}
@@ -2496,6 +3115,151 @@ func (bav *UtxoView) GetStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*St
 	return stakeEntries, nil
 }
 
+// GetDelegatedStakeEntriesForValidatorPKID returns the StakeEntries delegated to a
+// validator by stakers other than the validator itself.
+func (bav *UtxoView) GetDelegatedStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*StakeEntry, error) {
+	stakeEntries, err := bav.GetStakeEntriesForValidatorPKID(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDelegatedStakeEntriesForValidatorPKID: ")
+	}
+	var delegatedStakeEntries []*StakeEntry
+	for _, stakeEntry := range stakeEntries {
+		if stakeEntry.StakerPKID.Eq(validatorPKID) {
+			continue
+		}
+		delegatedStakeEntries = append(delegatedStakeEntries, stakeEntry)
+	}
+	return delegatedStakeEntries, nil
+}
+
+// GetStakeEntriesForStakerPKID returns all of the StakeEntries a staker has across
+// validators, sorted by ValidatorPKID.
+func (bav *UtxoView) GetStakeEntriesForStakerPKID(stakerPKID *PKID) ([]*StakeEntry, error) {
+	// Validate inputs.
+	if stakerPKID == nil {
+		return nil, errors.New("UtxoView.GetStakeEntriesForStakerPKID: nil StakerPKID provided as input")
+	}
+
+	// First, pull matching StakeEntries from the database and cache them in the UtxoView.
+	dbStakeEntries, err := bav.GetDbAdapter().GetStakeEntriesForStakerPKID(stakerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetStakeEntriesForStakerPKID: error retrieving StakeEntries from the db: ")
+	}
+	for _, stakeEntry := range dbStakeEntries {
+		// Cache results in the UtxoView.
+		if _, exists := bav.StakeMapKeyToStakeEntry[stakeEntry.ToMapKey()]; !exists {
+			bav._setStakeEntryMappings(stakeEntry)
+		}
+	}
+
+	// Then, pull matching StakeEntries from the UtxoView.
+	var stakeEntries []*StakeEntry
+	for _, stakeEntry := range bav.StakeMapKeyToStakeEntry {
+		if !stakeEntry.StakerPKID.Eq(stakerPKID) || stakeEntry.isDeleted {
+			continue
+		}
+		stakeEntries = append(stakeEntries, stakeEntry)
+	}
+
+	// Sort by ValidatorPKID so that the ordering is deterministic.
+	sort.Slice(stakeEntries, func(ii, jj int) bool {
+		return bytes.Compare(
+			stakeEntries[ii].ValidatorPKID.ToBytes(),
+			stakeEntries[jj].ValidatorPKID.ToBytes(),
+		) < 0
+	})
+	return stakeEntries, nil
+}
+
+// GetLockedStakeEntriesForStakerPKID returns all of a staker's LockedStakeEntries,
+// i.e. stake that is unbonding or ready to be unlocked, sorted by ValidatorPKID and
+// then LockedAtEpochNumber. Unbonding stake stays attributed to the validator it was
+// unstaked from until it is unlocked.
+func (bav *UtxoView) GetLockedStakeEntriesForStakerPKID(stakerPKID *PKID) ([]*LockedStakeEntry, error) {
+	// Validate inputs.
+	if stakerPKID == nil {
+		return nil, errors.New("UtxoView.GetLockedStakeEntriesForStakerPKID: nil StakerPKID provided as input")
+	}
+
+	// First, pull matching LockedStakeEntries from the db and cache them in the UtxoView.
+	dbLockedStakeEntries, err := bav.GetDbAdapter().GetLockedStakeEntriesForStakerPKID(stakerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetLockedStakeEntriesForStakerPKID: ")
+	}
+	for _, lockedStakeEntry := range dbLockedStakeEntries {
+		// Cache results in the UtxoView.
+		if _, exists := bav.LockedStakeMapKeyToLockedStakeEntry[lockedStakeEntry.ToMapKey()]; !exists {
+			bav._setLockedStakeEntryMappings(lockedStakeEntry)
+		}
+	}
+
+	// Then, pull matching LockedStakeEntries from the UtxoView.
+	var lockedStakeEntries []*LockedStakeEntry
+	for _, lockedStakeEntry := range bav.LockedStakeMapKeyToLockedStakeEntry {
+		if !lockedStakeEntry.StakerPKID.Eq(stakerPKID) || lockedStakeEntry.isDeleted {
+			continue
+		}
+		lockedStakeEntries = append(lockedStakeEntries, lockedStakeEntry)
+	}
+
+	// Sort by ValidatorPKID, then LockedAtEpochNumber ASC.
+	sort.Slice(lockedStakeEntries, func(ii, jj int) bool {
+		validatorCmp := bytes.Compare(
+			lockedStakeEntries[ii].ValidatorPKID.ToBytes(),
+			lockedStakeEntries[jj].ValidatorPKID.ToBytes(),
+		)
+		if validatorCmp != 0 {
+			return validatorCmp < 0
+		}
+		return lockedStakeEntries[ii].LockedAtEpochNumber < lockedStakeEntries[jj].LockedAtEpochNumber
+	})
+	return lockedStakeEntries, nil
+}
+
+// GetLockedStakeEntriesForValidatorPKID returns the LockedStakeEntries of all of the stakers
+// who unstaked from a validator and haven't unlocked yet, sorted by StakerPKID then
+// LockedAtEpochNumber.
+func (bav *UtxoView) GetLockedStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*LockedStakeEntry, error) {
+	// Validate inputs.
+	if validatorPKID == nil {
+		return nil, errors.New("UtxoView.GetLockedStakeEntriesForValidatorPKID: nil ValidatorPKID provided as input")
+	}
+
+	// First, pull matching LockedStakeEntries from the db and cache them in the UtxoView.
+	dbLockedStakeEntries, err := bav.GetDbAdapter().GetLockedStakeEntriesForValidatorPKID(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetLockedStakeEntriesForValidatorPKID: ")
+	}
+	for _, lockedStakeEntry := range dbLockedStakeEntries {
+		// Cache results in the UtxoView.
+		if _, exists := bav.LockedStakeMapKeyToLockedStakeEntry[lockedStakeEntry.ToMapKey()]; !exists {
+			bav._setLockedStakeEntryMappings(lockedStakeEntry)
+		}
+	}
+
+	// Then, pull matching LockedStakeEntries from the UtxoView.
+	var lockedStakeEntries []*LockedStakeEntry
+	for _, lockedStakeEntry := range bav.LockedStakeMapKeyToLockedStakeEntry {
+		if !lockedStakeEntry.ValidatorPKID.Eq(validatorPKID) || lockedStakeEntry.isDeleted {
+			continue
+		}
+		lockedStakeEntries = append(lockedStakeEntries, lockedStakeEntry)
+	}
+
+	// Sort by StakerPKID, then LockedAtEpochNumber ASC.
+	sort.Slice(lockedStakeEntries, func(ii, jj int) bool {
+		stakerCmp := bytes.Compare(
+			lockedStakeEntries[ii].StakerPKID.ToBytes(),
+			lockedStakeEntries[jj].StakerPKID.ToBytes(),
+		)
+		if stakerCmp != 0 {
+			return stakerCmp < 0
+		}
+		return lockedStakeEntries[ii].LockedAtEpochNumber < lockedStakeEntries[jj].LockedAtEpochNumber
+	})
+	return lockedStakeEntries, nil
+}
+
 // GetTopStakesForValidatorsByStakeAmount fetches the top n StakeEntries sorted by stake amount for
 // the given validators. The validatorPKIDs and limit parameters are strictly respected. If either has
 // 0 size, then no StakeEntries are returned.
@@ -2529,9 +3293,7 @@ func (bav *UtxoView) GetTopStakesForValidatorsByStakeAmount(
 	// Pull top N StakeEntries from the database (not present in the UtxoView).
 	// Note that we will skip stakers that are present in the view because we pass
 	// utxoViewStakeEntries to the function.
-	dbStakeEntries, err := DBGetTopStakesForValidatorsByStakeAmount(
-		bav.Handle,
-		bav.Snapshot,
+	dbStakeEntries, err := bav.GetDbAdapter().GetTopStakesForValidatorsByStakeAmount(
 		limit,
 		validatorPKIDsToInclude,
 		utxoViewStakeEntries,
@@ -2620,7 +3382,7 @@ func (bav *UtxoView) ValidatorHasDelegatedStake(validatorPKID *PKID) (bool, erro
 	}
 
 	// Next, check the database skipping any deleted StakeEntries for this validator.
-	return DBValidatorHasDelegatedStake(bav.Handle, bav.Snapshot, validatorPKID, utxoDeletedStakeEntries)
+	return bav.GetDbAdapter().ValidatorHasDelegatedStake(validatorPKID, utxoDeletedStakeEntries)
 }
 
 func (bav *UtxoView) GetLockedStakeEntry(
@@ -2649,7 +3411,7 @@ func (bav *UtxoView) GetLockedStakeEntry(
 		return lockedStakeEntry, nil
 	}
 	// Then, check the database.
-	lockedStakeEntry, err := DBGetLockedStakeEntry(bav.Handle, bav.Snapshot, validatorPKID, stakerPKID, lockedAtEpochNumber)
+	lockedStakeEntry, err := bav.GetDbAdapter().GetLockedStakeEntry(validatorPKID, stakerPKID, lockedAtEpochNumber)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetLockedStakeEntry: ")
 	}
@@ -2678,8 +3440,8 @@ func (bav *UtxoView) GetLockedStakeEntriesInRange(
 	}
 
 	// First, pull matching LockedStakeEntries from the db and cache them in the UtxoView.
-	dbLockedStakeEntries, err := DBGetLockedStakeEntriesInRange(
-		bav.Handle, bav.Snapshot, validatorPKID, stakerPKID, startEpochNumber, endEpochNumber,
+	dbLockedStakeEntries, err := bav.GetDbAdapter().GetLockedStakeEntriesInRange(
+		validatorPKID, stakerPKID, startEpochNumber, endEpochNumber,
 	)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetLockedStakeEntriesInRange: ")
@@ -2780,10 +3542,16 @@ func (bav *UtxoView) _flushStakeEntriesToDbWithTxn(txn *badger.Txn, blockHeight
 			if err := DBDeleteStakeEntryWithTxn(txn, bav.Snapshot, entry.ValidatorPKID, entry.StakerPKID, blockHeight, bav.EventManager, entry.isDeleted); err != nil {
 				return errors.Wrapf(err, "_flushStakeEntriesToDbWithTxn: ")
 			}
+			if err := DBDeleteStakeByStakerIndexWithTxn(txn, &entry); err != nil {
+				return errors.Wrapf(err, "_flushStakeEntriesToDbWithTxn: ")
+			}
 		} else {
 			if err := DBUpdateStakeEntryWithTxn(txn, bav.Snapshot, &entry, blockHeight, bav.EventManager); err != nil {
 				return errors.Wrapf(err, "_flushStakeEntriesToDbWithTxn: ")
 			}
+			if err := DBPutStakeByStakerIndexWithTxn(txn, &entry); err != nil {
+				return errors.Wrapf(err, "_flushStakeEntriesToDbWithTxn: ")
+			}
 		}
 	}
 
@@ -2812,6 +3580,9 @@ func (bav *UtxoView) _flushLockedStakeEntriesToDbWithTxn(txn *badger.Txn, blockH
 		if err := DBDeleteLockedStakeEntryWithTxn(txn, bav.Snapshot, &entry, blockHeight, bav.EventManager, entry.isDeleted); err != nil {
 			return errors.Wrapf(err, "_flushLockedStakeEntriesToDbWithTxn: ")
 		}
+		if err := DBDeleteLockedStakeByStakerIndexWithTxn(txn, &entry); err != nil {
+			return errors.Wrapf(err, "_flushLockedStakeEntriesToDbWithTxn: ")
+		}
 	}
 
 	// Set any !isDeleted entries in the UtxoView map.
@@ -2826,6 +3597,9 @@ func (bav *UtxoView) _flushLockedStakeEntriesToDbWithTxn(txn *badger.Txn, blockH
 			if err := DBPutLockedStakeEntryWithTxn(txn, bav.Snapshot, &entry, blockHeight, bav.EventManager); err != nil {
 				return errors.Wrapf(err, "_flushLockedStakeEntriesToDbWithTxn: ")
 			}
+			if err := DBPutLockedStakeByStakerIndexWithTxn(txn, &entry); err != nil {
+				return errors.Wrapf(err, "_flushLockedStakeEntriesToDbWithTxn: ")
+			}
 		}
 	}
 
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -7,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
 	"github.com/holiman/uint256"
 	"github.com/stretchr/testify/require"
 )
@@ -2206,3 +2209,89 @@ func testStakingToJailedValidator(t *testing.T, flushToDB bool) {
 		require.Nil(t, validatorEntry)
 	}
 }
+
+func TestDBStakerIndexes(t *testing.T) {
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	newTestPKID := func(id byte) *PKID {
+		pkidBytes := make([]byte, PublicKeyLenCompressed)
+		pkidBytes[0] = id
+		return NewPKID(pkidBytes)
+	}
+	stakerPKID := newTestPKID(1)
+	otherStakerPKID := newTestPKID(2)
+	validator1PKID := newTestPKID(3)
+	validator2PKID := newTestPKID(4)
+
+	stakeEntries := []*StakeEntry{
+		{StakerPKID: stakerPKID, ValidatorPKID: validator2PKID, StakeAmountNanos: uint256.NewInt().SetUint64(200)},
+		{StakerPKID: stakerPKID, ValidatorPKID: validator1PKID, StakeAmountNanos: uint256.NewInt().SetUint64(100)},
+		{StakerPKID: otherStakerPKID, ValidatorPKID: validator1PKID, StakeAmountNanos: uint256.NewInt().SetUint64(300)},
+	}
+	lockedStakeEntries := []*LockedStakeEntry{
+		{StakerPKID: stakerPKID, ValidatorPKID: validator1PKID, LockedAmountNanos: uint256.NewInt().SetUint64(50), LockedAtEpochNumber: 7},
+		{StakerPKID: otherStakerPKID, ValidatorPKID: validator1PKID, LockedAmountNanos: uint256.NewInt().SetUint64(60), LockedAtEpochNumber: 7},
+	}
+
+	// Store the entries in their primary indexes only, as they would have been in a db
+	// created before the staker indexes existed.
+	putEntries := func(stakeEntries []*StakeEntry, lockedStakeEntries []*LockedStakeEntry) {
+		require.NoError(t, db.Update(func(txn *badger.Txn) error {
+			for _, stakeEntry := range stakeEntries {
+				if err := DBUpdateStakeEntryWithTxn(txn, nil, stakeEntry, 0, nil); err != nil {
+					return err
+				}
+			}
+			for _, lockedStakeEntry := range lockedStakeEntries {
+				if err := DBPutLockedStakeEntryWithTxn(txn, nil, lockedStakeEntry, 0, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+	putEntries(stakeEntries[:1], nil)
+	dbStakeEntries, err := DBGetStakeEntriesForStakerPKID(db, nil, stakerPKID)
+	require.NoError(t, err)
+	require.Empty(t, dbStakeEntries)
+
+	// The indexes are built when they're missing, and only then.
+	require.NoError(t, DbBuildStakerIndexesIfMissing(db))
+	dbStakeEntries, err = DBGetStakeEntriesForStakerPKID(db, nil, stakerPKID)
+	require.NoError(t, err)
+	require.Len(t, dbStakeEntries, 1)
+	putEntries(stakeEntries[1:], lockedStakeEntries)
+	require.NoError(t, DbBuildStakerIndexesIfMissing(db))
+	dbStakeEntries, err = DBGetStakeEntriesForStakerPKID(db, nil, stakerPKID)
+	require.NoError(t, err)
+	require.Len(t, dbStakeEntries, 1)
+
+	// Rebuilding the indexes picks up all of the entries.
+	require.NoError(t, DbRebuildStakerIndexes(db))
+	dbStakeEntries, err = DBGetStakeEntriesForStakerPKID(db, nil, stakerPKID)
+	require.NoError(t, err)
+	require.Len(t, dbStakeEntries, 2)
+	require.True(t, dbStakeEntries[0].ValidatorPKID.Eq(validator1PKID))
+	require.Equal(t, uint64(100), dbStakeEntries[0].StakeAmountNanos.Uint64())
+	require.True(t, dbStakeEntries[1].ValidatorPKID.Eq(validator2PKID))
+	require.Equal(t, uint64(200), dbStakeEntries[1].StakeAmountNanos.Uint64())
+
+	dbLockedStakeEntries, err := DBGetLockedStakeEntriesForStakerPKID(db, nil, stakerPKID)
+	require.NoError(t, err)
+	require.Len(t, dbLockedStakeEntries, 1)
+	require.Equal(t, uint64(50), dbLockedStakeEntries[0].LockedAmountNanos.Uint64())
+	require.Equal(t, uint64(7), dbLockedStakeEntries[0].LockedAtEpochNumber)
+
+	// Deleting a StakeEntry from the staker index removes it from the results.
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		if err := DBDeleteStakeEntryWithTxn(txn, nil, validator2PKID, stakerPKID, 0, nil, true); err != nil {
+			return err
+		}
+		return DBDeleteStakeByStakerIndexWithTxn(txn, stakeEntries[0])
+	}))
+	dbStakeEntries, err = DBGetStakeEntriesForStakerPKID(db, nil, stakerPKID)
+	require.NoError(t, err)
+	require.Len(t, dbStakeEntries, 1)
+	require.True(t, dbStakeEntries[0].ValidatorPKID.Eq(validator1PKID))
+}
@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// The ParamUpdater can raise the minimum network fee rate of individual txn types above
+// MinimumNetworkFeeNanosPerKB, e.g. to charge more for DAO coin limit orders, which are
+// expensive to connect, than for likes. Each UpdateGlobalParams txn sets the minimum of one
+// txn type by setting TxnTypeMinimumNetworkFeeNanosPerKBKey in its ExtraData to the value
+// returned by EncodeTxnTypeMinimumNetworkFee, and a minimum of zero removes the type's
+// override.
+//
+// An override can only raise a txn type's minimum, so the minimum of a txn type is always
+// the larger of MinimumNetworkFeeNanosPerKB and its override. An atomic txns wrapper has to
+// pay the largest minimum of the txns it wraps, so wrapping txns can't lower their minimum.
+
+// GetMinimumNetworkFeeNanosPerKBForTxnType returns the minimum fee rate of txns of the type.
+func (gp *GlobalParamsEntry) GetMinimumNetworkFeeNanosPerKBForTxnType(txnType TxnType) uint64 {
+	if txnTypeMinimumFee := gp.TxnTypeMinimumNetworkFeeNanosPerKB[txnType]; txnTypeMinimumFee >
+		gp.MinimumNetworkFeeNanosPerKB {
+		return txnTypeMinimumFee
+	}
+	return gp.MinimumNetworkFeeNanosPerKB
+}
+
+// GetMinimumNetworkFeeNanosPerKBForTxn returns the minimum fee rate of the txn.
+func (gp *GlobalParamsEntry) GetMinimumNetworkFeeNanosPerKBForTxn(txn *MsgDeSoTxn) uint64 {
+	if txn.TxnMeta == nil {
+		return gp.MinimumNetworkFeeNanosPerKB
+	}
+	minimumFee := gp.GetMinimumNetworkFeeNanosPerKBForTxnType(txn.TxnMeta.GetTxnType())
+	if txnMeta, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata); ok {
+		for _, innerTxn := range txnMeta.Txns {
+			if innerTxn == nil || innerTxn.TxnMeta == nil {
+				continue
+			}
+			if innerMinimumFee := gp.GetMinimumNetworkFeeNanosPerKBForTxnType(
+				innerTxn.TxnMeta.GetTxnType()); innerMinimumFee > minimumFee {
+				minimumFee = innerMinimumFee
+			}
+		}
+	}
+	return minimumFee
+}
+
+// EncodeTxnTypeMinimumNetworkFee returns the ExtraData value that sets the minimum fee rate of
+// the txn type in an UpdateGlobalParams txn.
+func EncodeTxnTypeMinimumNetworkFee(txnType TxnType, feeNanosPerKB uint64) []byte {
+	data := UintToBuf(uint64(txnType))
+	data = append(data, UintToBuf(feeNanosPerKB)...)
+	return data
+}
+
+// DecodeTxnTypeMinimumNetworkFee decodes an ExtraData value returned by
+// EncodeTxnTypeMinimumNetworkFee.
+func DecodeTxnTypeMinimumNetworkFee(data []byte) (_txnType TxnType, _feeNanosPerKB uint64, _err error) {
+	rr := bytes.NewReader(data)
+	txnType, err := ReadUvarint(rr)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "DecodeTxnTypeMinimumNetworkFee: Problem reading TxnType: ")
+	}
+	feeNanosPerKB, err := ReadUvarint(rr)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "DecodeTxnTypeMinimumNetworkFee: Problem reading fee: ")
+	}
+	if rr.Len() != 0 {
+		return 0, 0, fmt.Errorf("DecodeTxnTypeMinimumNetworkFee: %d extra bytes", rr.Len())
+	}
+	return TxnType(txnType), feeNanosPerKB, nil
+}
+
+// IsValidTxnTypeForMinimumNetworkFee returns true if the txn type's minimum fee rate can be
+// set. BlockReward and BitcoinExchange txns don't pay the network fee.
+func IsValidTxnTypeForMinimumNetworkFee(txnType TxnType) bool {
+	if txnType == TxnTypeUnset || txnType == TxnTypeBlockReward || txnType == TxnTypeBitcoinExchange {
+		return false
+	}
+	for _, validTxnType := range AllTxnTypes {
+		if txnType == validTxnType {
+			return true
+		}
+	}
+	return false
+}
+
+func copyTxnTypeMinimumNetworkFees(fees map[TxnType]uint64) map[TxnType]uint64 {
+	if fees == nil {
+		return nil
+	}
+	feesCopy := make(map[TxnType]uint64, len(fees))
+	for txnType, feeNanosPerKB := range fees {
+		feesCopy[txnType] = feeNanosPerKB
+	}
+	return feesCopy
+}
+
+func encodeTxnTypeMinimumNetworkFees(fees map[TxnType]uint64) []byte {
+	// Encode the fees sorted by txn type so that the encoding is deterministic.
+	txnTypes := make([]TxnType, 0, len(fees))
+	for txnType := range fees {
+		txnTypes = append(txnTypes, txnType)
+	}
+	sort.Slice(txnTypes, func(ii, jj int) bool {
+		return txnTypes[ii] < txnTypes[jj]
+	})
+
+	data := UintToBuf(uint64(len(txnTypes)))
+	for _, txnType := range txnTypes {
+		data = append(data, EncodeTxnTypeMinimumNetworkFee(txnType, fees[txnType])...)
+	}
+	return data
+}
+
+func decodeTxnTypeMinimumNetworkFees(rr *bytes.Reader) (map[TxnType]uint64, error) {
+	numFees, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decodeTxnTypeMinimumNetworkFees: Problem reading number of fees: ")
+	}
+	if numFees == 0 {
+		return nil, nil
+	}
+	if numFees > uint64(len(AllTxnTypes)) {
+		return nil, fmt.Errorf("decodeTxnTypeMinimumNetworkFees: %d fees exceeds the number of txn types", numFees)
+	}
+	fees := make(map[TxnType]uint64, numFees)
+	for ii := uint64(0); ii < numFees; ii++ {
+		txnType, err := ReadUvarint(rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decodeTxnTypeMinimumNetworkFees: Problem reading TxnType: ")
+		}
+		feeNanosPerKB, err := ReadUvarint(rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decodeTxnTypeMinimumNetworkFees: Problem reading fee: ")
+		}
+		fees[TxnType(txnType)] = feeNanosPerKB
+	}
+	return fees, nil
+}
@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnTypeMinimumNetworkFee(t *testing.T) {
+	require := require.New(t)
+
+	globalParams := &GlobalParamsEntry{
+		MinimumNetworkFeeNanosPerKB: 1000,
+		TxnTypeMinimumNetworkFeeNanosPerKB: map[TxnType]uint64{
+			TxnTypeDAOCoinLimitOrder: 5000,
+			// An override below the network minimum has no effect.
+			TxnTypeLike: 500,
+		},
+	}
+	require.Equal(uint64(5000), globalParams.GetMinimumNetworkFeeNanosPerKBForTxnType(TxnTypeDAOCoinLimitOrder))
+	require.Equal(uint64(1000), globalParams.GetMinimumNetworkFeeNanosPerKBForTxnType(TxnTypeLike))
+	require.Equal(uint64(1000), globalParams.GetMinimumNetworkFeeNanosPerKBForTxnType(TxnTypeBasicTransfer))
+
+	// An atomic txns wrapper pays the largest minimum of the txns it wraps.
+	wrapperTxn := &MsgDeSoTxn{TxnMeta: &AtomicTxnsWrapperMetadata{Txns: []*MsgDeSoTxn{
+		{TxnMeta: &LikeMetadata{}},
+		{TxnMeta: &DAOCoinLimitOrderMetadata{}},
+	}}}
+	require.Equal(uint64(5000), globalParams.GetMinimumNetworkFeeNanosPerKBForTxn(wrapperTxn))
+	require.Equal(uint64(1000), globalParams.GetMinimumNetworkFeeNanosPerKBForTxn(
+		&MsgDeSoTxn{TxnMeta: &LikeMetadata{}}))
+
+	// The ExtraData value round-trips.
+	txnType, feeNanosPerKB, err := DecodeTxnTypeMinimumNetworkFee(
+		EncodeTxnTypeMinimumNetworkFee(TxnTypeDAOCoinLimitOrder, 5000))
+	require.NoError(err)
+	require.Equal(TxnTypeDAOCoinLimitOrder, txnType)
+	require.Equal(uint64(5000), feeNanosPerKB)
+
+	require.True(IsValidTxnTypeForMinimumNetworkFee(TxnTypeLike))
+	require.False(IsValidTxnTypeForMinimumNetworkFee(TxnTypeBlockReward))
+	require.False(IsValidTxnTypeForMinimumNetworkFee(TxnTypeBitcoinExchange))
+	require.False(IsValidTxnTypeForMinimumNetworkFee(TxnType(math.MaxUint8)))
+
+	// The overrides are encoded with the GlobalParamsEntry once the migration is triggered.
+	blockHeight := uint64(GlobalDeSoParams.ForkHeights.TxnTypeMinimumNetworkFeeBlockHeight)
+	decodedGlobalParams := &GlobalParamsEntry{}
+	exists, err := DecodeFromBytes(decodedGlobalParams, bytes.NewReader(EncodeToBytes(blockHeight, globalParams)))
+	require.True(exists)
+	require.NoError(err)
+	require.Equal(globalParams.TxnTypeMinimumNetworkFeeNanosPerKB, decodedGlobalParams.TxnTypeMinimumNetworkFeeNanosPerKB)
+	require.Equal(globalParams.TxnTypeMinimumNetworkFeeNanosPerKB, globalParams.Copy().TxnTypeMinimumNetworkFeeNanosPerKB)
+}
@@ -136,8 +136,28 @@ const (
 	// EncoderTypeBlockNode represents a block node in the blockchain.
 	EncoderTypeBlockNode EncoderType = 52
 
+	EncoderTypeValidatorRewardIndexEntry      EncoderType = 53
+	EncoderTypeValidatorEpochPerformanceEntry EncoderType = 54
+	EncoderTypeTxnFeeReceipt                  EncoderType = 55
+	EncoderTypeBlockProducerRegistryEntry     EncoderType = 56
+	EncoderTypeDAOCoinLastTradePriceEntry     EncoderType = 57
+	EncoderTypeDAOCoinMetadataEntry           EncoderType = 58
+	EncoderTypeExternalHeaderRelayerEntry     EncoderType = 59
+	EncoderTypeExternalHeaderEntry            EncoderType = 60
+	EncoderTypeExchangeRateFeedEntry          EncoderType = 61
+	EncoderTypeDAOCoinLimitOrderFillEntry     EncoderType = 62
+	EncoderTypeDeadKeyEntry                   EncoderType = 63
+	EncoderTypeMultisigEntry                  EncoderType = 64
+	EncoderTypeDAOCoinStreamEntry             EncoderType = 65
+	EncoderTypeProposalEntry                  EncoderType = 66
+	EncoderTypeVoteEntry                      EncoderType = 67
+	EncoderTypeRoyaltySplitEntry              EncoderType = 68
+	EncoderTypeNFTBundleEntry                 EncoderType = 69
+	EncoderTypeNFTSwapEntry                   EncoderType = 70
+	EncoderTypeEscrowEntry                    EncoderType = 71
+
 	// EncoderTypeEndBlockView encoder type should be at the end and is used for automated tests.
-	EncoderTypeEndBlockView EncoderType = 53
+	EncoderTypeEndBlockView EncoderType = 72
 )
 
 // Txindex encoder types.
@@ -298,6 +318,44 @@ func (encoderType EncoderType) New() DeSoEncoder {
 		return &BLSPublicKeyPKIDPairEntry{}
 	case EncoderTypeBlockNode:
 		return &BlockNode{}
+	case EncoderTypeValidatorRewardIndexEntry:
+		return &ValidatorRewardIndexEntry{}
+	case EncoderTypeValidatorEpochPerformanceEntry:
+		return &ValidatorEpochPerformanceEntry{}
+	case EncoderTypeTxnFeeReceipt:
+		return &TxnFeeReceipt{}
+	case EncoderTypeBlockProducerRegistryEntry:
+		return &BlockProducerRegistryEntry{}
+	case EncoderTypeDAOCoinLastTradePriceEntry:
+		return &DAOCoinLastTradePriceEntry{}
+	case EncoderTypeDAOCoinMetadataEntry:
+		return &DAOCoinMetadataEntry{}
+	case EncoderTypeExternalHeaderRelayerEntry:
+		return &ExternalHeaderRelayerEntry{}
+	case EncoderTypeExternalHeaderEntry:
+		return &ExternalHeaderEntry{}
+	case EncoderTypeExchangeRateFeedEntry:
+		return &ExchangeRateFeedEntry{}
+	case EncoderTypeDAOCoinLimitOrderFillEntry:
+		return &DAOCoinLimitOrderFillEntry{}
+	case EncoderTypeDeadKeyEntry:
+		return &DeadKeyEntry{}
+	case EncoderTypeMultisigEntry:
+		return &MultisigEntry{}
+	case EncoderTypeDAOCoinStreamEntry:
+		return &DAOCoinStreamEntry{}
+	case EncoderTypeProposalEntry:
+		return &ProposalEntry{}
+	case EncoderTypeVoteEntry:
+		return &VoteEntry{}
+	case EncoderTypeRoyaltySplitEntry:
+		return &RoyaltySplitEntry{}
+	case EncoderTypeNFTBundleEntry:
+		return &NFTBundleEntry{}
+	case EncoderTypeNFTSwapEntry:
+		return &NFTSwapEntry{}
+	case EncoderTypeEscrowEntry:
+		return &EscrowEntry{}
 	}
 
 	// Txindex encoder types
@@ -639,59 +697,78 @@ const (
 	// used when rolling back a txn to determine what kind of operations need
 	// to be performed. For example, rolling back a BitcoinExchange may require
 	// rolling back an AddUtxo operation.
-	OperationTypeAddUtxo                       OperationType = 0
-	OperationTypeSpendUtxo                     OperationType = 1
-	OperationTypeBitcoinExchange               OperationType = 2
-	OperationTypePrivateMessage                OperationType = 3
-	OperationTypeSubmitPost                    OperationType = 4
-	OperationTypeUpdateProfile                 OperationType = 5
-	OperationTypeDeletePost                    OperationType = 7
-	OperationTypeUpdateBitcoinUSDExchangeRate  OperationType = 8
-	OperationTypeFollow                        OperationType = 9
-	OperationTypeLike                          OperationType = 10
-	OperationTypeCreatorCoin                   OperationType = 11
-	OperationTypeSwapIdentity                  OperationType = 12
-	OperationTypeUpdateGlobalParams            OperationType = 13
-	OperationTypeCreatorCoinTransfer           OperationType = 14
-	OperationTypeCreateNFT                     OperationType = 15
-	OperationTypeUpdateNFT                     OperationType = 16
-	OperationTypeAcceptNFTBid                  OperationType = 17
-	OperationTypeNFTBid                        OperationType = 18
-	OperationTypeDeSoDiamond                   OperationType = 19
-	OperationTypeNFTTransfer                   OperationType = 20
-	OperationTypeAcceptNFTTransfer             OperationType = 21
-	OperationTypeBurnNFT                       OperationType = 22
-	OperationTypeAuthorizeDerivedKey           OperationType = 23
-	OperationTypeMessagingKey                  OperationType = 24
-	OperationTypeDAOCoin                       OperationType = 25
-	OperationTypeDAOCoinTransfer               OperationType = 26
-	OperationTypeSpendingLimitAccounting       OperationType = 27
-	OperationTypeDAOCoinLimitOrder             OperationType = 28
-	OperationTypeCreateUserAssociation         OperationType = 29
-	OperationTypeDeleteUserAssociation         OperationType = 30
-	OperationTypeCreatePostAssociation         OperationType = 31
-	OperationTypeDeletePostAssociation         OperationType = 32
-	OperationTypeAccessGroup                   OperationType = 33
-	OperationTypeAccessGroupMembers            OperationType = 34
-	OperationTypeNewMessage                    OperationType = 35
-	OperationTypeAddBalance                    OperationType = 36
-	OperationTypeSpendBalance                  OperationType = 37
-	OperationTypeDeleteExpiredNonces           OperationType = 38
-	OperationTypeRegisterAsValidator           OperationType = 39
-	OperationTypeUnregisterAsValidator         OperationType = 40
-	OperationTypeStake                         OperationType = 41
-	OperationTypeUnstake                       OperationType = 42
-	OperationTypeUnlockStake                   OperationType = 43
-	OperationTypeUnjailValidator               OperationType = 44
-	OperationTypeCoinLockup                    OperationType = 45
-	OperationTypeCoinLockupTransfer            OperationType = 46
-	OperationTypeCoinUnlock                    OperationType = 47
-	OperationTypeUpdateCoinLockupParams        OperationType = 48
-	OperationTypeStakeDistributionRestake      OperationType = 49
-	OperationTypeStakeDistributionPayToBalance OperationType = 50
-	OperationTypeSetValidatorLastActiveAtEpoch OperationType = 51
-	OperationTypeAtomicTxnsWrapper             OperationType = 52
-	// NEXT_TAG = 53
+	OperationTypeAddUtxo                         OperationType = 0
+	OperationTypeSpendUtxo                       OperationType = 1
+	OperationTypeBitcoinExchange                 OperationType = 2
+	OperationTypePrivateMessage                  OperationType = 3
+	OperationTypeSubmitPost                      OperationType = 4
+	OperationTypeUpdateProfile                   OperationType = 5
+	OperationTypeDeletePost                      OperationType = 7
+	OperationTypeUpdateBitcoinUSDExchangeRate    OperationType = 8
+	OperationTypeFollow                          OperationType = 9
+	OperationTypeLike                            OperationType = 10
+	OperationTypeCreatorCoin                     OperationType = 11
+	OperationTypeSwapIdentity                    OperationType = 12
+	OperationTypeUpdateGlobalParams              OperationType = 13
+	OperationTypeCreatorCoinTransfer             OperationType = 14
+	OperationTypeCreateNFT                       OperationType = 15
+	OperationTypeUpdateNFT                       OperationType = 16
+	OperationTypeAcceptNFTBid                    OperationType = 17
+	OperationTypeNFTBid                          OperationType = 18
+	OperationTypeDeSoDiamond                     OperationType = 19
+	OperationTypeNFTTransfer                     OperationType = 20
+	OperationTypeAcceptNFTTransfer               OperationType = 21
+	OperationTypeBurnNFT                         OperationType = 22
+	OperationTypeAuthorizeDerivedKey             OperationType = 23
+	OperationTypeMessagingKey                    OperationType = 24
+	OperationTypeDAOCoin                         OperationType = 25
+	OperationTypeDAOCoinTransfer                 OperationType = 26
+	OperationTypeSpendingLimitAccounting         OperationType = 27
+	OperationTypeDAOCoinLimitOrder               OperationType = 28
+	OperationTypeCreateUserAssociation           OperationType = 29
+	OperationTypeDeleteUserAssociation           OperationType = 30
+	OperationTypeCreatePostAssociation           OperationType = 31
+	OperationTypeDeletePostAssociation           OperationType = 32
+	OperationTypeAccessGroup                     OperationType = 33
+	OperationTypeAccessGroupMembers              OperationType = 34
+	OperationTypeNewMessage                      OperationType = 35
+	OperationTypeAddBalance                      OperationType = 36
+	OperationTypeSpendBalance                    OperationType = 37
+	OperationTypeDeleteExpiredNonces             OperationType = 38
+	OperationTypeRegisterAsValidator             OperationType = 39
+	OperationTypeUnregisterAsValidator           OperationType = 40
+	OperationTypeStake                           OperationType = 41
+	OperationTypeUnstake                         OperationType = 42
+	OperationTypeUnlockStake                     OperationType = 43
+	OperationTypeUnjailValidator                 OperationType = 44
+	OperationTypeCoinLockup                      OperationType = 45
+	OperationTypeCoinLockupTransfer              OperationType = 46
+	OperationTypeCoinUnlock                      OperationType = 47
+	OperationTypeUpdateCoinLockupParams          OperationType = 48
+	OperationTypeStakeDistributionRestake        OperationType = 49
+	OperationTypeStakeDistributionPayToBalance   OperationType = 50
+	OperationTypeSetValidatorLastActiveAtEpoch   OperationType = 51
+	OperationTypeAtomicTxnsWrapper               OperationType = 52
+	OperationTypeUpdateValidatorEpochPerformance OperationType = 53
+	OperationTypeAnchorExternalHeaders           OperationType = 54
+	OperationTypeDAOCoinLimitOrderBatch          OperationType = 55
+	OperationTypeRegisterDeadKeys                OperationType = 56
+	OperationTypeRegisterMultisig                OperationType = 57
+	OperationTypeDAOCoinStream                   OperationType = 58
+	OperationTypeCreateProposal                  OperationType = 59
+	OperationTypeCastVote                        OperationType = 60
+	OperationTypeDAOCoinMultiTransfer            OperationType = 61
+	OperationTypeRoyaltySplit                    OperationType = 62
+	OperationTypeDAOCoinFee                      OperationType = 63
+	OperationTypeLeaseNFT                        OperationType = 64
+	OperationTypeEndNFTLease                     OperationType = 65
+	OperationTypeSettleNFTAuctions               OperationType = 66
+	OperationTypeNFTBundle                       OperationType = 67
+	OperationTypeNFTSwap                         OperationType = 68
+	OperationTypeEscrow                          OperationType = 69
+	OperationTypeStakeDistributionAccrue         OperationType = 70
+	OperationTypeSlashValidator                  OperationType = 71
+	// NEXT_TAG = 72
 )
 
 func (op OperationType) String() string {
@@ -800,6 +877,44 @@ func (op OperationType) String() string {
 		return "OperationTypeStakeDistributionPayToBalance"
 	case OperationTypeAtomicTxnsWrapper:
 		return "OperationTypeAtomicTxnsWrapper"
+	case OperationTypeUpdateValidatorEpochPerformance:
+		return "OperationTypeUpdateValidatorEpochPerformance"
+	case OperationTypeAnchorExternalHeaders:
+		return "OperationTypeAnchorExternalHeaders"
+	case OperationTypeDAOCoinLimitOrderBatch:
+		return "OperationTypeDAOCoinLimitOrderBatch"
+	case OperationTypeRegisterDeadKeys:
+		return "OperationTypeRegisterDeadKeys"
+	case OperationTypeRegisterMultisig:
+		return "OperationTypeRegisterMultisig"
+	case OperationTypeDAOCoinStream:
+		return "OperationTypeDAOCoinStream"
+	case OperationTypeCreateProposal:
+		return "OperationTypeCreateProposal"
+	case OperationTypeCastVote:
+		return "OperationTypeCastVote"
+	case OperationTypeDAOCoinMultiTransfer:
+		return "OperationTypeDAOCoinMultiTransfer"
+	case OperationTypeRoyaltySplit:
+		return "OperationTypeRoyaltySplit"
+	case OperationTypeDAOCoinFee:
+		return "OperationTypeDAOCoinFee"
+	case OperationTypeLeaseNFT:
+		return "OperationTypeLeaseNFT"
+	case OperationTypeEndNFTLease:
+		return "OperationTypeEndNFTLease"
+	case OperationTypeSettleNFTAuctions:
+		return "OperationTypeSettleNFTAuctions"
+	case OperationTypeNFTBundle:
+		return "OperationTypeNFTBundle"
+	case OperationTypeNFTSwap:
+		return "OperationTypeNFTSwap"
+	case OperationTypeEscrow:
+		return "OperationTypeEscrow"
+	case OperationTypeStakeDistributionAccrue:
+		return "OperationTypeStakeDistributionAccrue"
+	case OperationTypeSlashValidator:
+		return "OperationTypeSlashValidator"
 	}
 	return "OperationTypeUNKNOWN"
 }
@@ -908,6 +1023,11 @@ type UtxoOperation struct {
 	// in order to avoid having to reconnect all transactions.
 	CreatorCoinDESOLockedNanosDiff int64
 
+	// CreatorCoinNanosDiff is the change in the creator coin's CoinsInCirculationNanos
+	// during a CreatorCoin txn, including any founder reward. Together with the
+	// CreatorCoinDESOLockedNanosDiff, it gives the price of the trade.
+	CreatorCoinNanosDiff int64
+
 	// This value is used by Rosetta to create a proper input/output when we
 	// encounter a SwapIdentity txn. This makes it so that we don't have to
 	// reconnect all txns in order to get these values.
@@ -1000,6 +1120,10 @@ type UtxoOperation struct {
 	// prior to a unstake or unlock stake txn.
 	PrevLockedStakeEntries []*LockedStakeEntry
 
+	// PrevValidatorRewardIndexEntry is the previous ValidatorRewardIndexEntry prior
+	// to an unregister, stake, or unstake txn, or an end-of-epoch reward distribution.
+	PrevValidatorRewardIndexEntry *ValidatorRewardIndexEntry
+
 	//
 	// Coin Lockup fields
 	//
@@ -1037,7 +1161,12 @@ type UtxoOperation struct {
 
 	// StakeAmountNanosDiff is used by Rosetta to return the amount of DESO that was added
 	// to a StakeEntry during the end-of-epoch hook. It's needed
-	// in order to avoid having to re-run the end of epoch hook.
+	// in order to avoid having to re-run the end of epoch hook. For an
+	// OperationTypeStakeDistributionAccrue, it's the delegators' share of the validator's
+	// reward that was folded into the validator's reward index. For an
+	// OperationTypeStakeDistributionRestake without PrevStakeEntries, it's the delegators'
+	// restaked rewards that were added to the validator's stake. For an
+	// OperationTypeSlashValidator, it's the stake and locked stake that was burned.
 	StakeAmountNanosDiff uint64
 
 	// LockedAtEpochNumber is used by Rosetta to uniquely identify a subaccount representing
@@ -1068,7 +1197,79 @@ type UtxoOperation struct {
 	// this is not the case as we only call RawEncodeWithoutMetadata if the length of the
 	// AtomicTxnsInnerUtxoOps transaction is non-zero. This will always occur, meaning we
 	// can deterministically encode and decode AtomicTxnsInnerUtxoOps.
+	//
+	// DAOCoinLimitOrderBatch txns also use this field to hold the UtxoOps of each of their orders.
 	AtomicTxnsInnerUtxoOps [][]*UtxoOperation
+
+	// PrevValidatorEpochPerformanceEntries holds the ValidatorEpochPerformanceEntries
+	// updated by a block prior to connecting it, used to restore them on disconnect.
+	PrevValidatorEpochPerformanceEntries []*ValidatorEpochPerformanceEntry
+
+	// FeeReceipt is set on the last UtxoOperation of every connected transaction and
+	// records the fee it paid. See TxnFeeReceipt.
+	FeeReceipt *TxnFeeReceipt
+
+	// PrevBlockProducerRegistryEntry is the block producer registry entry prior to an
+	// UpdateGlobalParams txn that registers, updates, or removes a block producer.
+	PrevBlockProducerRegistryEntry *BlockProducerRegistryEntry
+
+	// PrevDAOCoinLastTradePriceEntries are the last trade price entries for both
+	// directions of a coin pair prior to a DAOCoinLimitOrder txn that trades on it.
+	PrevDAOCoinLastTradePriceEntries []*DAOCoinLastTradePriceEntry
+
+	// PrevDAOCoinMetadataEntry is the DAO coin's metadata entry prior to a DAOCoin
+	// txn that updates it, or nil if the coin had no metadata.
+	PrevDAOCoinMetadataEntry *DAOCoinMetadataEntry
+
+	// PrevExternalHeaderRelayerEntry is the relayer registry entry prior to an
+	// UpdateGlobalParams txn that registers or removes an external header relayer.
+	PrevExternalHeaderRelayerEntry *ExternalHeaderRelayerEntry
+
+	// PrevExchangeRateFeedEntry is the exchange rate feed entry prior to an UpdateGlobalParams
+	// txn that registers or removes a feed key, or prior to an UpdateBitcoinUSDExchangeRate
+	// txn in which a feed key submits a rate.
+	PrevExchangeRateFeedEntry *ExchangeRateFeedEntry
+
+	// RegisteredDeadKeyEntries are the DeadKeyEntries a block added to the registry,
+	// used to remove them on disconnect.
+	RegisteredDeadKeyEntries []*DeadKeyEntry
+
+	// PrevMultisigEntry is the owner's multisig prior to a RegisterMultisig txn.
+	PrevMultisigEntry *MultisigEntry
+
+	// PrevDAOCoinStreamEntry is the stream prior to a DAOCoinStream txn that withdraws from
+	// or cancels it. The txn's balance changes are saved in PrevBalanceEntries.
+	PrevDAOCoinStreamEntry *DAOCoinStreamEntry
+
+	// PrevProposalEntry and PrevVoteEntry are the proposal and the voter's vote prior to
+	// a CastVote txn.
+	PrevProposalEntry *ProposalEntry
+	PrevVoteEntry     *VoteEntry
+
+	// PrevRoyaltySplitEntry is the royalty split prior to a RoyaltySplit txn that updates it.
+	PrevRoyaltySplitEntry *RoyaltySplitEntry
+
+	// PrevNFTBundleEntry is the bundle prior to an NFTBundle txn that cancels or buys it. When
+	// a bundle is bought, the UtxoOperations of each NFT's sale are in AtomicTxnsInnerUtxoOps
+	// and the buyer's bids that were replaced to make the sales are in DeletedNFTBidEntries.
+	PrevNFTBundleEntry *NFTBundleEntry
+
+	// PrevNFTSwapEntry is the swap prior to an NFTSwap txn that accepts or cancels it. When
+	// a swap is accepted, the entries of the offered and requested NFTs prior to the swap are
+	// in PrevNFTEntry and PrevRequestedNFTEntry.
+	PrevNFTSwapEntry      *NFTSwapEntry
+	PrevRequestedNFTEntry *NFTEntry
+
+	// These are set by OperationTypeEscrow operations, which lock, release, or refund an
+	// escrow. PrevEscrowEntry is the escrow prior to a release or refund, or the escrow a lock
+	// created. EscrowRecipientPKID is the user a release or refund paid, and
+	// EscrowAmountBaseUnits is the amount that was locked or paid. When a DAO coin is
+	// escrowed, the balance and coin entry prior to the operation are in PrevBalanceEntries
+	// and PrevCoinEntry.
+	EscrowOperationType   EscrowOperationType
+	PrevEscrowEntry       *EscrowEntry
+	EscrowRecipientPKID   *PKID
+	EscrowAmountBaseUnits *uint256.Int
 }
 
 // FIXME: This hackIsRunningStateSyncer() call is a hack to get around the fact that
@@ -1452,6 +1653,98 @@ func (op *UtxoOperation) RawEncodeWithoutMetadata(blockHeight uint64, skipMetada
 		}
 	}
 
+	if MigrationTriggered(blockHeight, StakingRewardsAccrualMigration) {
+		// PrevValidatorRewardIndexEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevValidatorRewardIndexEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, ValidatorPerformanceTrackingMigration) {
+		// PrevValidatorEpochPerformanceEntries
+		data = append(data, EncodeDeSoEncoderSlice(op.PrevValidatorEpochPerformanceEntries, blockHeight, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, TxnFeeReceiptsMigration) {
+		// FeeReceipt
+		data = append(data, EncodeToBytes(blockHeight, op.FeeReceipt, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, BlockProducerAttestationMigration) {
+		// PrevBlockProducerRegistryEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevBlockProducerRegistryEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderStopLimitMigration) {
+		// PrevDAOCoinLastTradePriceEntries
+		data = append(data, EncodeDeSoEncoderSlice(op.PrevDAOCoinLastTradePriceEntries, blockHeight, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinMetadataMigration) {
+		// PrevDAOCoinMetadataEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevDAOCoinMetadataEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, ExternalHeaderAnchoringMigration) {
+		// PrevExternalHeaderRelayerEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevExternalHeaderRelayerEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, ExchangeRateFeedMigration) {
+		// PrevExchangeRateFeedEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevExchangeRateFeedEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, DeadKeyRegistryMigration) {
+		// RegisteredDeadKeyEntries
+		data = append(data, EncodeDeSoEncoderSlice(op.RegisteredDeadKeyEntries, blockHeight, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, CreatorCoinTradeAmountsMigration) {
+		// CreatorCoinNanosDiff
+		data = append(data, UintToBuf(uint64(op.CreatorCoinNanosDiff))...)
+	}
+
+	if MigrationTriggered(blockHeight, MultisigMigration) {
+		// PrevMultisigEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevMultisigEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinStreamMigration) {
+		// PrevDAOCoinStreamEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevDAOCoinStreamEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, GovernanceMigration) {
+		// PrevProposalEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevProposalEntry, skipMetadata...)...)
+		// PrevVoteEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevVoteEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, RoyaltySplitMigration) {
+		// PrevRoyaltySplitEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevRoyaltySplitEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, NFTBundleMigration) {
+		// PrevNFTBundleEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevNFTBundleEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, NFTSwapMigration) {
+		// PrevNFTSwapEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevNFTSwapEntry, skipMetadata...)...)
+		// PrevRequestedNFTEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevRequestedNFTEntry, skipMetadata...)...)
+		// EscrowOperationType
+		data = append(data, byte(op.EscrowOperationType))
+		// PrevEscrowEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevEscrowEntry, skipMetadata...)...)
+		// EscrowRecipientPKID
+		data = append(data, EncodeToBytes(blockHeight, op.EscrowRecipientPKID, skipMetadata...)...)
+		// EscrowAmountBaseUnits
+		data = append(data, VariableEncodeUint256(op.EscrowAmountBaseUnits)...)
+	}
+
 	return data
 }
 
@@ -2172,6 +2465,146 @@ func (op *UtxoOperation) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.
 		}
 	}
 
+	if MigrationTriggered(blockHeight, StakingRewardsAccrualMigration) {
+		// PrevValidatorRewardIndexEntry
+		if op.PrevValidatorRewardIndexEntry, err = DecodeDeSoEncoder(&ValidatorRewardIndexEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevValidatorRewardIndexEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, ValidatorPerformanceTrackingMigration) {
+		// PrevValidatorEpochPerformanceEntries
+		if op.PrevValidatorEpochPerformanceEntries, err = DecodeDeSoEncoderSlice[*ValidatorEpochPerformanceEntry](rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevValidatorEpochPerformanceEntries: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, TxnFeeReceiptsMigration) {
+		// FeeReceipt
+		if op.FeeReceipt, err = DecodeDeSoEncoder(&TxnFeeReceipt{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading FeeReceipt: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, BlockProducerAttestationMigration) {
+		// PrevBlockProducerRegistryEntry
+		if op.PrevBlockProducerRegistryEntry, err = DecodeDeSoEncoder(&BlockProducerRegistryEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevBlockProducerRegistryEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderStopLimitMigration) {
+		// PrevDAOCoinLastTradePriceEntries
+		if op.PrevDAOCoinLastTradePriceEntries, err = DecodeDeSoEncoderSlice[*DAOCoinLastTradePriceEntry](rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevDAOCoinLastTradePriceEntries: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinMetadataMigration) {
+		// PrevDAOCoinMetadataEntry
+		if op.PrevDAOCoinMetadataEntry, err = DecodeDeSoEncoder(&DAOCoinMetadataEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevDAOCoinMetadataEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, ExternalHeaderAnchoringMigration) {
+		// PrevExternalHeaderRelayerEntry
+		if op.PrevExternalHeaderRelayerEntry, err = DecodeDeSoEncoder(&ExternalHeaderRelayerEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevExternalHeaderRelayerEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, ExchangeRateFeedMigration) {
+		// PrevExchangeRateFeedEntry
+		if op.PrevExchangeRateFeedEntry, err = DecodeDeSoEncoder(&ExchangeRateFeedEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevExchangeRateFeedEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, DeadKeyRegistryMigration) {
+		// RegisteredDeadKeyEntries
+		if op.RegisteredDeadKeyEntries, err = DecodeDeSoEncoderSlice[*DeadKeyEntry](rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading RegisteredDeadKeyEntries: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, CreatorCoinTradeAmountsMigration) {
+		// CreatorCoinNanosDiff
+		uint64CreatorCoinNanosDiff, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading CreatorCoinNanosDiff: ")
+		}
+		op.CreatorCoinNanosDiff = int64(uint64CreatorCoinNanosDiff)
+	}
+
+	if MigrationTriggered(blockHeight, MultisigMigration) {
+		// PrevMultisigEntry
+		if op.PrevMultisigEntry, err = DecodeDeSoEncoder(&MultisigEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevMultisigEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinStreamMigration) {
+		// PrevDAOCoinStreamEntry
+		if op.PrevDAOCoinStreamEntry, err = DecodeDeSoEncoder(&DAOCoinStreamEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevDAOCoinStreamEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, GovernanceMigration) {
+		// PrevProposalEntry
+		if op.PrevProposalEntry, err = DecodeDeSoEncoder(&ProposalEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevProposalEntry: ")
+		}
+		// PrevVoteEntry
+		if op.PrevVoteEntry, err = DecodeDeSoEncoder(&VoteEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevVoteEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, RoyaltySplitMigration) {
+		// PrevRoyaltySplitEntry
+		if op.PrevRoyaltySplitEntry, err = DecodeDeSoEncoder(&RoyaltySplitEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevRoyaltySplitEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, NFTBundleMigration) {
+		// PrevNFTBundleEntry
+		if op.PrevNFTBundleEntry, err = DecodeDeSoEncoder(&NFTBundleEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevNFTBundleEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, NFTSwapMigration) {
+		// PrevNFTSwapEntry
+		if op.PrevNFTSwapEntry, err = DecodeDeSoEncoder(&NFTSwapEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevNFTSwapEntry: ")
+		}
+		// PrevRequestedNFTEntry
+		if op.PrevRequestedNFTEntry, err = DecodeDeSoEncoder(&NFTEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevRequestedNFTEntry: ")
+		}
+		// EscrowOperationType
+		escrowOperationType, err := rr.ReadByte()
+		if err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading EscrowOperationType: ")
+		}
+		op.EscrowOperationType = EscrowOperationType(escrowOperationType)
+		// PrevEscrowEntry
+		if op.PrevEscrowEntry, err = DecodeDeSoEncoder(&EscrowEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevEscrowEntry: ")
+		}
+		// EscrowRecipientPKID
+		if op.EscrowRecipientPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading EscrowRecipientPKID: ")
+		}
+		// EscrowAmountBaseUnits
+		if op.EscrowAmountBaseUnits, err = VariableDecodeUint256(rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading EscrowAmountBaseUnits: ")
+		}
+	}
+
 	return nil
 }
 
@@ -2181,6 +2614,22 @@ func (op *UtxoOperation) GetVersionByte(blockHeight uint64) byte {
 		AssociationsAndAccessGroupsMigration,
 		BalanceModelMigration,
 		ProofOfStake1StateSetupMigration,
+		StakingRewardsAccrualMigration,
+		ValidatorPerformanceTrackingMigration,
+		TxnFeeReceiptsMigration,
+		BlockProducerAttestationMigration,
+		DAOCoinLimitOrderStopLimitMigration,
+		DAOCoinMetadataMigration,
+		ExternalHeaderAnchoringMigration,
+		ExchangeRateFeedMigration,
+		DeadKeyRegistryMigration,
+		CreatorCoinTradeAmountsMigration,
+		MultisigMigration,
+		DAOCoinStreamMigration,
+		GovernanceMigration,
+		RoyaltySplitMigration,
+		NFTBundleMigration,
+		NFTSwapMigration,
 	)
 }
 
@@ -3478,6 +3927,24 @@ type NFTEntry struct {
 
 	ExtraData map[string][]byte
 
+	// If this NFT is leased, LesseePKID holds the NFT until LeaseExpirationBlock. The owner
+	// keeps ownership but can't sell, transfer, or burn the NFT while the lease is active.
+	LesseePKID           *PKID
+	LeaseExpirationBlock uint64
+
+	// If this NFT is for sale as an English auction, AuctionEndBlockHeight is the height at
+	// which its highest bid is accepted automatically. It's zero otherwise.
+	AuctionEndBlockHeight uint64
+
+	// If this Buy Now NFT is a Dutch auction, its Buy Now price falls from BuyNowPriceNanos at
+	// BuyNowPriceDecayStartBlockHeight to BuyNowEndPriceNanos at BuyNowPriceDecayEndBlockHeight,
+	// every block or every BuyNowPriceDecayStepBlocks blocks. BuyNowPriceDecayEndBlockHeight is
+	// zero otherwise.
+	BuyNowEndPriceNanos              uint64
+	BuyNowPriceDecayStartBlockHeight uint64
+	BuyNowPriceDecayEndBlockHeight   uint64
+	BuyNowPriceDecayStepBlocks       uint64
+
 	// Whether or not this entry is deleted in the view.
 	isDeleted bool
 }
@@ -3497,6 +3964,19 @@ func (nft *NFTEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata .
 	data = append(data, BoolToByte(nft.IsBuyNow))
 	data = append(data, UintToBuf(nft.BuyNowPriceNanos)...)
 	data = append(data, EncodeExtraData(nft.ExtraData)...)
+	if MigrationTriggered(blockHeight, NFTLeaseMigration) {
+		data = append(data, EncodeToBytes(blockHeight, nft.LesseePKID, skipMetadata...)...)
+		data = append(data, UintToBuf(nft.LeaseExpirationBlock)...)
+	}
+	if MigrationTriggered(blockHeight, NFTAuctionMigration) {
+		data = append(data, UintToBuf(nft.AuctionEndBlockHeight)...)
+	}
+	if MigrationTriggered(blockHeight, NFTDutchAuctionMigration) {
+		data = append(data, UintToBuf(nft.BuyNowEndPriceNanos)...)
+		data = append(data, UintToBuf(nft.BuyNowPriceDecayStartBlockHeight)...)
+		data = append(data, UintToBuf(nft.BuyNowPriceDecayEndBlockHeight)...)
+		data = append(data, UintToBuf(nft.BuyNowPriceDecayStepBlocks)...)
+	}
 	return data
 }
 
@@ -3569,11 +4049,48 @@ func (nft *NFTEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Read
 		return errors.Wrapf(err, "NFTEntry.Decode: Problem decoding extra data")
 	}
 
+	if MigrationTriggered(blockHeight, NFTLeaseMigration) {
+		lesseePKID := &PKID{}
+		if exist, err := DecodeFromBytes(lesseePKID, rr); exist && err == nil {
+			nft.LesseePKID = lesseePKID
+		} else if err != nil {
+			return errors.Wrapf(err, "NFTEntry.Decode: Problem reading LesseePKID")
+		}
+		nft.LeaseExpirationBlock, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "NFTEntry.Decode: Problem reading LeaseExpirationBlock")
+		}
+	}
+	if MigrationTriggered(blockHeight, NFTAuctionMigration) {
+		nft.AuctionEndBlockHeight, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "NFTEntry.Decode: Problem reading AuctionEndBlockHeight")
+		}
+	}
+	if MigrationTriggered(blockHeight, NFTDutchAuctionMigration) {
+		nft.BuyNowEndPriceNanos, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "NFTEntry.Decode: Problem reading BuyNowEndPriceNanos")
+		}
+		nft.BuyNowPriceDecayStartBlockHeight, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "NFTEntry.Decode: Problem reading BuyNowPriceDecayStartBlockHeight")
+		}
+		nft.BuyNowPriceDecayEndBlockHeight, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "NFTEntry.Decode: Problem reading BuyNowPriceDecayEndBlockHeight")
+		}
+		nft.BuyNowPriceDecayStepBlocks, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "NFTEntry.Decode: Problem reading BuyNowPriceDecayStepBlocks")
+		}
+	}
+
 	return nil
 }
 
 func (nft *NFTEntry) GetVersionByte(blockHeight uint64) byte {
-	return 0
+	return GetMigrationVersion(blockHeight, NFTLeaseMigration, NFTAuctionMigration, NFTDutchAuctionMigration)
 }
 
 func (nft *NFTEntry) GetEncoderType() EncoderType {
@@ -3754,6 +4271,12 @@ type DerivedKeyEntry struct {
 	// permissions so the user can manage it from a centralized UI.
 	Memo []byte
 
+	// ===== ENCODER MIGRATION DerivedKeyNonceMigration =====
+	// Nonce is the number of txns signed by this derived key that have
+	// carried a DerivedKeyNonceKey in their ExtraData. A txn that carries
+	// one must carry the current Nonce, which then moves on by one.
+	Nonce uint64
+
 	// Whether or not this entry is deleted in the view.
 	isDeleted bool
 }
@@ -3780,6 +4303,10 @@ func (key *DerivedKeyEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMet
 	}
 	data = append(data, EncodeByteArray(key.Memo)...)
 
+	if MigrationTriggered(blockHeight, DerivedKeyNonceMigration) {
+		data = append(data, UintToBuf(key.Nonce)...)
+	}
+
 	return data
 }
 
@@ -3832,6 +4359,13 @@ func (key *DerivedKeyEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *byt
 		return errors.Wrapf(err, "DerivedKeyEntry.Decode: Problem decoding Memo")
 	}
 
+	if MigrationTriggered(blockHeight, DerivedKeyNonceMigration) {
+		key.Nonce, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DerivedKeyEntry.Decode: Problem decoding Nonce")
+		}
+	}
+
 	return nil
 }
 
@@ -3839,7 +4373,8 @@ func (key *DerivedKeyEntry) GetVersionByte(blockHeight uint64) byte {
 	// Remember to update this every time there an encoder migration that impacts
 	// the TransactionSpendingLimit struct.
 	return GetMigrationVersion(blockHeight, UnlimitedDerivedKeysMigration, AssociationsAndAccessGroupsMigration,
-		BalanceModelMigration, ProofOfStake1StateSetupMigration)
+		BalanceModelMigration, ProofOfStake1StateSetupMigration, DerivedKeyCoinAmountLimitsMigration,
+		DerivedKeyRecipientWhitelistMigration, DerivedKeyNonceMigration, GovernanceMigration)
 }
 
 func (key *DerivedKeyEntry) GetEncoderType() EncoderType {
@@ -4277,6 +4812,47 @@ type GlobalParamsEntry struct {
 
 	// TimeoutIntervalMillisecondsPoS is the time in milliseconds to wait before timing out a view.
 	TimeoutIntervalMillisecondsPoS uint64
+
+	// JailMissedSlotsThreshold is the number of leader slots a validator may miss in a single
+	// epoch. A validator that misses more slots than this is jailed at the end of the epoch,
+	// which removes it from future validator sets and leader schedules until it unjails itself.
+	JailMissedSlotsThreshold uint64
+
+	// DAOCoinLimitOrderMakerFeeBasisPoints and DAOCoinLimitOrderTakerFeeBasisPoints are the
+	// fees charged on each DAO coin limit order fill. The maker is the order resting in the
+	// order book and the taker is the order that matched against it. Each side pays its fee
+	// out of the coins it receives, and the fees are credited to DAOCoinLimitOrderFeeRecipientPKID.
+	// No fees are charged while the recipient is unset.
+	DAOCoinLimitOrderMakerFeeBasisPoints uint64
+	DAOCoinLimitOrderTakerFeeBasisPoints uint64
+	DAOCoinLimitOrderFeeRecipientPKID    *PKID
+
+	// ExchangeRateFeedMaxAgeBlocks, ExchangeRateFeedMaxDeviationBasisPoints, and
+	// ExchangeRateFeedMinSubmissions bound how the USDCentsPerBitcoin exchange rate is
+	// aggregated from the rates submitted by registered exchange rate feed keys. Submissions
+	// older than ExchangeRateFeedMaxAgeBlocks are ignored, submissions that deviate from the
+	// median by more than ExchangeRateFeedMaxDeviationBasisPoints are discarded as outliers,
+	// and the exchange rate is only updated if at least ExchangeRateFeedMinSubmissions remain.
+	ExchangeRateFeedMaxAgeBlocks            uint64
+	ExchangeRateFeedMaxDeviationBasisPoints uint64
+	ExchangeRateFeedMinSubmissions          uint64
+
+	// DAOCoinFeeWhitelistPKIDs are the creator PKIDs of the DAO coins that txn fees can be
+	// paid in. A fee paid in one of these coins is converted to DESO at the coin's
+	// time-weighted trade price, marked up by DAOCoinFeeHaircutBasisPoints, and is only
+	// accepted within the sponsorship budget set by the coin's creator.
+	DAOCoinFeeWhitelistPKIDs     []*PKID
+	DAOCoinFeeHaircutBasisPoints uint64
+
+	// TxnTypeMinimumNetworkFeeNanosPerKB overrides MinimumNetworkFeeNanosPerKB for individual
+	// txn types. Overrides below MinimumNetworkFeeNanosPerKB have no effect. Use
+	// GetMinimumNetworkFeeNanosPerKBForTxn to get the minimum fee rate of a txn.
+	TxnTypeMinimumNetworkFeeNanosPerKB map[TxnType]uint64
+
+	// ValidatorSlashBasisPoints is the share of a validator's stake, including the stake
+	// delegated to it and the stake locked up after unstaking from it, that's burned when
+	// the validator is slashed for voting twice in the same view.
+	ValidatorSlashBasisPoints uint64
 }
 
 func (gp *GlobalParamsEntry) Copy() *GlobalParamsEntry {
@@ -4310,7 +4886,36 @@ func (gp *GlobalParamsEntry) Copy() *GlobalParamsEntry {
 		MaxTxnSizeBytesPoS:                             gp.MaxTxnSizeBytesPoS,
 		BlockProductionIntervalMillisecondsPoS:         gp.BlockProductionIntervalMillisecondsPoS,
 		TimeoutIntervalMillisecondsPoS:                 gp.TimeoutIntervalMillisecondsPoS,
+		JailMissedSlotsThreshold:                       gp.JailMissedSlotsThreshold,
+		DAOCoinLimitOrderMakerFeeBasisPoints:           gp.DAOCoinLimitOrderMakerFeeBasisPoints,
+		DAOCoinLimitOrderTakerFeeBasisPoints:           gp.DAOCoinLimitOrderTakerFeeBasisPoints,
+		DAOCoinLimitOrderFeeRecipientPKID:              copyOptionalPKID(gp.DAOCoinLimitOrderFeeRecipientPKID),
+		ExchangeRateFeedMaxAgeBlocks:                   gp.ExchangeRateFeedMaxAgeBlocks,
+		ExchangeRateFeedMaxDeviationBasisPoints:        gp.ExchangeRateFeedMaxDeviationBasisPoints,
+		ExchangeRateFeedMinSubmissions:                 gp.ExchangeRateFeedMinSubmissions,
+		DAOCoinFeeWhitelistPKIDs:                       copyPKIDs(gp.DAOCoinFeeWhitelistPKIDs),
+		DAOCoinFeeHaircutBasisPoints:                   gp.DAOCoinFeeHaircutBasisPoints,
+		TxnTypeMinimumNetworkFeeNanosPerKB:             copyTxnTypeMinimumNetworkFees(gp.TxnTypeMinimumNetworkFeeNanosPerKB),
+		ValidatorSlashBasisPoints:                      gp.ValidatorSlashBasisPoints,
+	}
+}
+
+func copyPKIDs(pkids []*PKID) []*PKID {
+	if pkids == nil {
+		return nil
+	}
+	pkidsCopy := make([]*PKID, len(pkids))
+	for ii, pkid := range pkids {
+		pkidsCopy[ii] = pkid.NewPKID()
+	}
+	return pkidsCopy
+}
+
+func copyOptionalPKID(pkid *PKID) *PKID {
+	if pkid == nil {
+		return nil
 	}
+	return pkid.NewPKID()
 }
 
 func (gp *GlobalParamsEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
@@ -4349,6 +4954,29 @@ func (gp *GlobalParamsEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMe
 		data = append(data, UintToBuf(gp.BlockProductionIntervalMillisecondsPoS)...)
 		data = append(data, UintToBuf(gp.TimeoutIntervalMillisecondsPoS)...)
 	}
+	if MigrationTriggered(blockHeight, ValidatorPerformanceTrackingMigration) {
+		data = append(data, UintToBuf(gp.JailMissedSlotsThreshold)...)
+	}
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTradingFeesMigration) {
+		data = append(data, UintToBuf(gp.DAOCoinLimitOrderMakerFeeBasisPoints)...)
+		data = append(data, UintToBuf(gp.DAOCoinLimitOrderTakerFeeBasisPoints)...)
+		data = append(data, EncodeToBytes(blockHeight, gp.DAOCoinLimitOrderFeeRecipientPKID, skipMetadata...)...)
+	}
+	if MigrationTriggered(blockHeight, ExchangeRateFeedMigration) {
+		data = append(data, UintToBuf(gp.ExchangeRateFeedMaxAgeBlocks)...)
+		data = append(data, UintToBuf(gp.ExchangeRateFeedMaxDeviationBasisPoints)...)
+		data = append(data, UintToBuf(gp.ExchangeRateFeedMinSubmissions)...)
+	}
+	if MigrationTriggered(blockHeight, DAOCoinFeeMigration) {
+		data = append(data, EncodeDeSoEncoderSlice(gp.DAOCoinFeeWhitelistPKIDs, blockHeight, skipMetadata...)...)
+		data = append(data, UintToBuf(gp.DAOCoinFeeHaircutBasisPoints)...)
+	}
+	if MigrationTriggered(blockHeight, TxnTypeMinimumNetworkFeeMigration) {
+		data = append(data, encodeTxnTypeMinimumNetworkFees(gp.TxnTypeMinimumNetworkFeeNanosPerKB)...)
+	}
+	if MigrationTriggered(blockHeight, ValidatorSlashingMigration) {
+		data = append(data, UintToBuf(gp.ValidatorSlashBasisPoints)...)
+	}
 	return data
 }
 
@@ -4477,11 +5105,73 @@ func (gp *GlobalParamsEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *by
 			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading TimeoutIntervalMillisecondsPoS")
 		}
 	}
+	if MigrationTriggered(blockHeight, ValidatorPerformanceTrackingMigration) {
+		gp.JailMissedSlotsThreshold, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading JailMissedSlotsThreshold")
+		}
+	}
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTradingFeesMigration) {
+		gp.DAOCoinLimitOrderMakerFeeBasisPoints, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading DAOCoinLimitOrderMakerFeeBasisPoints")
+		}
+		gp.DAOCoinLimitOrderTakerFeeBasisPoints, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading DAOCoinLimitOrderTakerFeeBasisPoints")
+		}
+		feeRecipientPKID := &PKID{}
+		if exist, err := DecodeFromBytes(feeRecipientPKID, rr); exist && err == nil {
+			gp.DAOCoinLimitOrderFeeRecipientPKID = feeRecipientPKID
+		} else if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading DAOCoinLimitOrderFeeRecipientPKID")
+		}
+	}
+	if MigrationTriggered(blockHeight, ExchangeRateFeedMigration) {
+		gp.ExchangeRateFeedMaxAgeBlocks, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading ExchangeRateFeedMaxAgeBlocks")
+		}
+		gp.ExchangeRateFeedMaxDeviationBasisPoints, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading ExchangeRateFeedMaxDeviationBasisPoints")
+		}
+		gp.ExchangeRateFeedMinSubmissions, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading ExchangeRateFeedMinSubmissions")
+		}
+	}
+	if MigrationTriggered(blockHeight, DAOCoinFeeMigration) {
+		gp.DAOCoinFeeWhitelistPKIDs, err = DecodeDeSoEncoderSlice[*PKID](rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading DAOCoinFeeWhitelistPKIDs")
+		}
+		gp.DAOCoinFeeHaircutBasisPoints, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading DAOCoinFeeHaircutBasisPoints")
+		}
+	}
+	if MigrationTriggered(blockHeight, TxnTypeMinimumNetworkFeeMigration) {
+		gp.TxnTypeMinimumNetworkFeeNanosPerKB, err = decodeTxnTypeMinimumNetworkFees(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading TxnTypeMinimumNetworkFeeNanosPerKB")
+		}
+	}
+	if MigrationTriggered(blockHeight, ValidatorSlashingMigration) {
+		gp.ValidatorSlashBasisPoints, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading ValidatorSlashBasisPoints")
+		}
+	}
 	return nil
 }
 
 func (gp *GlobalParamsEntry) GetVersionByte(blockHeight uint64) byte {
-	return GetMigrationVersion(blockHeight, BalanceModelMigration, ProofOfStake1StateSetupMigration)
+	return GetMigrationVersion(
+		blockHeight, BalanceModelMigration, ProofOfStake1StateSetupMigration, ValidatorPerformanceTrackingMigration,
+		DAOCoinLimitOrderTradingFeesMigration, ExchangeRateFeedMigration, DAOCoinFeeMigration,
+		TxnTypeMinimumNetworkFeeMigration, ValidatorSlashingMigration,
+	)
 }
 
 func (gp *GlobalParamsEntry) GetEncoderType() EncoderType {
@@ -4628,6 +5318,11 @@ type PostEntry struct {
 	// If a PostEntry is frozen then it can no longer be updated.
 	// That includes unfreezing the post.
 	IsFrozen bool
+
+	// RoyaltySplitID is the royalty split the NFT was minted with, if any. When it's set, the
+	// split's current recipients receive the additional royalties upon sale of this NFT instead
+	// of the Additional*RoyaltiesBasisPoints maps, which hold the split as of the mint.
+	RoyaltySplitID *BlockHash
 }
 
 func (pe *PostEntry) IsDeleted() bool {
@@ -4689,6 +5384,10 @@ func (pe *PostEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata .
 		data = append(data, BoolToByte(pe.IsFrozen))
 	}
 
+	if MigrationTriggered(blockHeight, RoyaltySplitMigration) {
+		data = append(data, EncodeToBytes(blockHeight, pe.RoyaltySplitID, skipMetadata...)...)
+	}
+
 	return data
 }
 
@@ -4820,11 +5519,18 @@ func (pe *PostEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Read
 		}
 	}
 
+	if MigrationTriggered(blockHeight, RoyaltySplitMigration) {
+		pe.RoyaltySplitID, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+		if err != nil {
+			return errors.Wrap(err, "PostEntry.Decode: Problem reading RoyaltySplitID")
+		}
+	}
+
 	return nil
 }
 
 func (pe *PostEntry) GetVersionByte(blockHeight uint64) byte {
-	return GetMigrationVersion(blockHeight, AssociationsAndAccessGroupsMigration)
+	return GetMigrationVersion(blockHeight, AssociationsAndAccessGroupsMigration, RoyaltySplitMigration)
 }
 
 func (pe *PostEntry) GetEncoderType() EncoderType {
@@ -4962,6 +5668,29 @@ func (transferRestrictionStatus TransferRestrictionStatus) String() string {
 	}
 }
 
+type DAOCoinLimitOrderRestriction uint8
+
+const (
+	DAOCoinLimitOrderRestrictionUnrestricted    DAOCoinLimitOrderRestriction = 0
+	DAOCoinLimitOrderRestrictionTradingDisabled DAOCoinLimitOrderRestriction = 1
+)
+
+func (restriction DAOCoinLimitOrderRestriction) IsValid() bool {
+	return restriction == DAOCoinLimitOrderRestrictionUnrestricted ||
+		restriction == DAOCoinLimitOrderRestrictionTradingDisabled
+}
+
+func (restriction DAOCoinLimitOrderRestriction) String() string {
+	switch restriction {
+	case DAOCoinLimitOrderRestrictionUnrestricted:
+		return "Unrestricted"
+	case DAOCoinLimitOrderRestrictionTradingDisabled:
+		return "Trading Disabled"
+	default:
+		return "INVALID DAO COIN LIMIT ORDER RESTRICTION"
+	}
+}
+
 // This struct contains all the information required to support coin
 // buy/sell transactions on profiles.
 type CoinEntry struct {
@@ -5017,6 +5746,28 @@ type CoinEntry struct {
 	// LockupTransferRestrictionStatus specifies transfer restrictions
 	// for only those DAO coins actively locked up.
 	LockupTransferRestrictionStatus TransferRestrictionStatus
+
+	// ===== ENCODER MIGRATION DAOCoinDecimalsMigration =====
+	// Decimals is the number of decimals used to display the DAO coin, i.e. there
+	// are 10^Decimals base units in a single coin. It's set by the creator so that
+	// every client converts base units the same way. Zero means the creator hasn't
+	// set it, in which case DefaultDAOCoinDecimals applies. See GetDecimals.
+	Decimals uint8
+
+	// ===== ENCODER MIGRATION DAOCoinLimitOrderRestrictionMigration =====
+	// DAOCoinLimitOrderRestriction lets the creator freeze order book trading of
+	// their DAO coin. While trading is disabled, no new orders can be placed for
+	// the coin and no existing orders for it can be matched.
+	DAOCoinLimitOrderRestriction DAOCoinLimitOrderRestriction
+}
+
+// GetDecimals returns the number of decimals used to display the coin, falling
+// back to DefaultDAOCoinDecimals if the creator hasn't set them.
+func (ce *CoinEntry) GetDecimals() uint8 {
+	if ce.Decimals == 0 {
+		return DefaultDAOCoinDecimals
+	}
+	return ce.Decimals
 }
 
 func (ce *CoinEntry) Copy() *CoinEntry {
@@ -5029,6 +5780,8 @@ func (ce *CoinEntry) Copy() *CoinEntry {
 		MintingDisabled:                 ce.MintingDisabled,
 		TransferRestrictionStatus:       ce.TransferRestrictionStatus,
 		LockupTransferRestrictionStatus: ce.LockupTransferRestrictionStatus,
+		Decimals:                        ce.Decimals,
+		DAOCoinLimitOrderRestriction:    ce.DAOCoinLimitOrderRestriction,
 	}
 }
 
@@ -5048,6 +5801,14 @@ func (ce *CoinEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata .
 		data = append(data, byte(ce.LockupTransferRestrictionStatus))
 	}
 
+	if MigrationTriggered(blockHeight, DAOCoinDecimalsMigration) {
+		data = append(data, ce.Decimals)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderRestrictionMigration) {
+		data = append(data, byte(ce.DAOCoinLimitOrderRestriction))
+	}
+
 	return data
 }
 
@@ -5097,6 +5858,21 @@ func (ce *CoinEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Read
 		ce.LockupTransferRestrictionStatus = TransferRestrictionStatus(lockedStatusByte)
 	}
 
+	if MigrationTriggered(blockHeight, DAOCoinDecimalsMigration) {
+		ce.Decimals, err = rr.ReadByte()
+		if err != nil {
+			return errors.Wrapf(err, "CoinEntry.Decode: Problem reading Decimals")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderRestrictionMigration) {
+		restrictionByte, err := rr.ReadByte()
+		if err != nil {
+			return errors.Wrapf(err, "CoinEntry.Decode: Problem reading DAOCoinLimitOrderRestriction")
+		}
+		ce.DAOCoinLimitOrderRestriction = DAOCoinLimitOrderRestriction(restrictionByte)
+	}
+
 	return nil
 }
 
@@ -5104,6 +5880,8 @@ func (ce *CoinEntry) GetVersionByte(blockHeight uint64) byte {
 	return GetMigrationVersion(
 		blockHeight,
 		ProofOfStake1StateSetupMigration,
+		DAOCoinDecimalsMigration,
+		DAOCoinLimitOrderRestrictionMigration,
 	)
 }
 
@@ -5757,6 +6535,30 @@ type DAOCoinLimitOrderEntry struct {
 	// to break ties between orders. If there are two orders that could be filled, we
 	// pick the one that was submitted earlier.
 	BlockHeight uint32
+	// ExpirationBlockHeight is the block height at which this order expires. Expired
+	// orders are no longer matched and fall out of the order book. Zero means the
+	// order never expires.
+	ExpirationBlockHeight uint32
+	// StopTriggerScaledPrice makes this a stop-limit order. The order is dormant, i.e.
+	// not matched, while the last trade price for its direction of the coin pair is
+	// below this scaled exchange rate. Once the order trades, the trigger is cleared so
+	// the remainder stays matchable. Nil for regular limit orders.
+	StopTriggerScaledPrice *uint256.Int
+	// MinQuantityToFillInBaseUnits is the smallest quantity, denominated like
+	// QuantityToFillInBaseUnits, that this order can be filled for in a single
+	// match, unless the match completes the order. Nil means any fill is allowed.
+	MinQuantityToFillInBaseUnits *uint256.Int
+	// QuantityDenomination overrides which coin QuantityToFillInBaseUnits is
+	// denominated in. By default, it's determined by the OperationType as described
+	// above. For example, a BID denominated in the selling coin spends an exact
+	// quantity of the selling coin rather than buying an exact quantity.
+	QuantityDenomination DAOCoinLimitOrderQuantityDenomination
+	// BuyingCoinIsCreatorCoin and SellingCoinIsCreatorCoin specify that the coin of
+	// BuyingDAOCoinCreatorPKID or SellingDAOCoinCreatorPKID, respectively, is the
+	// creator's creator coin rather than their DAO coin. Creator coin orders have their
+	// own order books, so they only ever match orders for the same coins.
+	BuyingCoinIsCreatorCoin  bool
+	SellingCoinIsCreatorCoin bool
 
 	isDeleted bool
 }
@@ -5765,6 +6567,68 @@ func (order *DAOCoinLimitOrderEntry) IsDeleted() bool {
 	return order.isDeleted
 }
 
+// IsCreatorCoinOrder returns true if the order buys or sells a creator coin.
+func (order *DAOCoinLimitOrderEntry) IsCreatorCoinOrder() bool {
+	return order.BuyingCoinIsCreatorCoin || order.SellingCoinIsCreatorCoin
+}
+
+// IsDAOCoin returns true if the order's coin with the given creator PKID is a DAO
+// coin, and false if it's a creator coin. The buying and selling creators always
+// differ, so the creator PKID is enough to tell the order's coins apart.
+func (order *DAOCoinLimitOrderEntry) IsDAOCoin(coinPKID *PKID) bool {
+	if order.BuyingCoinIsCreatorCoin && order.BuyingDAOCoinCreatorPKID.Eq(coinPKID) {
+		return false
+	}
+	if order.SellingCoinIsCreatorCoin && order.SellingDAOCoinCreatorPKID.Eq(coinPKID) {
+		return false
+	}
+	return true
+}
+
+// IsExpired returns true if the order has an ExpirationBlockHeight and it's been
+// reached at blockHeight.
+func (order *DAOCoinLimitOrderEntry) IsExpired(blockHeight uint32) bool {
+	return order.ExpirationBlockHeight != 0 && blockHeight >= order.ExpirationBlockHeight
+}
+
+// IsDormantStopOrder returns true if the order is a stop-limit order whose trigger
+// hasn't been reached. lastTradePrice is the last trade price for the order's own
+// direction of its coin pair, or nil if the pair hasn't traded.
+func (order *DAOCoinLimitOrderEntry) IsDormantStopOrder(lastTradePrice *uint256.Int) bool {
+	if order.StopTriggerScaledPrice == nil {
+		return false
+	}
+	return lastTradePrice == nil || lastTradePrice.Lt(order.StopTriggerScaledPrice)
+}
+
+// IsBelowMinFillQuantity returns true if a match that reduces the order's quantity to
+// fill from quantityToFill to updatedQuantityToFill fills less than the order's
+// MinQuantityToFillInBaseUnits without completing the order.
+func (order *DAOCoinLimitOrderEntry) IsBelowMinFillQuantity(
+	quantityToFill *uint256.Int, updatedQuantityToFill *uint256.Int) bool {
+
+	if order.MinQuantityToFillInBaseUnits == nil || updatedQuantityToFill.IsZero() {
+		return false
+	}
+	filledQuantity := uint256.NewInt().Sub(quantityToFill, updatedQuantityToFill)
+	return filledQuantity.Lt(order.MinQuantityToFillInBaseUnits)
+}
+
+// GetQuantityOperationType returns the operation type whose quantity semantics the
+// order's QuantityToFillInBaseUnits follows, i.e. ASK if the quantity is denominated
+// in the selling coin and BID if it's denominated in the buying coin. The matching
+// math uses this rather than the OperationType so that it supports either denomination.
+func (order *DAOCoinLimitOrderEntry) GetQuantityOperationType() DAOCoinLimitOrderOperationType {
+	switch order.QuantityDenomination {
+	case DAOCoinLimitOrderQuantityDenominationSellingCoin:
+		return DAOCoinLimitOrderOperationTypeASK
+	case DAOCoinLimitOrderQuantityDenominationBuyingCoin:
+		return DAOCoinLimitOrderOperationTypeBID
+	default:
+		return order.OperationType
+	}
+}
+
 type DAOCoinLimitOrderOperationType uint8
 
 const (
@@ -5795,8 +6659,65 @@ const (
 	// FillOrKill: fulfill whatever you can immediately then cancel
 	// the entire order if it is unable to be completely fulfilled.
 	DAOCoinLimitOrderFillTypeFillOrKill DAOCoinLimitOrderFillType = 3
+	// PostOnly: store the entire order in the database like a
+	// GoodTillCancelled order, or fail if any of it would be
+	// fulfilled immediately. This guarantees the order is a maker.
+	// Like a GoodTillCancelled order, it can set an expiration.
+	DAOCoinLimitOrderFillTypePostOnly DAOCoinLimitOrderFillType = 4
+)
+
+type DAOCoinLimitOrderQuantityDenomination uint8
+
+const (
+	// Default: the quantity is denominated in the buying coin for
+	// BID orders and in the selling coin for ASK orders.
+	DAOCoinLimitOrderQuantityDenominationDefault DAOCoinLimitOrderQuantityDenomination = 0
+	// BuyingCoin: the quantity is the amount of the buying coin to buy.
+	DAOCoinLimitOrderQuantityDenominationBuyingCoin DAOCoinLimitOrderQuantityDenomination = 1
+	// SellingCoin: the quantity is the amount of the selling coin to sell.
+	DAOCoinLimitOrderQuantityDenominationSellingCoin DAOCoinLimitOrderQuantityDenomination = 2
 )
 
+func (denomination DAOCoinLimitOrderQuantityDenomination) String() string {
+	switch denomination {
+	case DAOCoinLimitOrderQuantityDenominationDefault:
+		return "DEFAULT"
+	case DAOCoinLimitOrderQuantityDenominationBuyingCoin:
+		return "BUYING_COIN"
+	case DAOCoinLimitOrderQuantityDenominationSellingCoin:
+		return "SELLING_COIN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// DAOCoinLimitOrderCancelAll specifies which of the transactor's open orders a
+// DAO coin limit order txn cancels at once.
+type DAOCoinLimitOrderCancelAll uint8
+
+const (
+	// None: the txn doesn't cancel orders in bulk.
+	DAOCoinLimitOrderCancelAllNone DAOCoinLimitOrderCancelAll = 0
+	// All: the txn cancels every open order of the transactor.
+	DAOCoinLimitOrderCancelAllOrders DAOCoinLimitOrderCancelAll = 1
+	// ForPair: the txn cancels every open order of the transactor that buys the
+	// txn's buying coin and sells the txn's selling coin.
+	DAOCoinLimitOrderCancelAllForPair DAOCoinLimitOrderCancelAll = 2
+)
+
+func (cancelAll DAOCoinLimitOrderCancelAll) String() string {
+	switch cancelAll {
+	case DAOCoinLimitOrderCancelAllNone:
+		return "NONE"
+	case DAOCoinLimitOrderCancelAllOrders:
+		return "ALL"
+	case DAOCoinLimitOrderCancelAllForPair:
+		return "FOR_PAIR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 // FilledDAOCoinLimitOrder only exists to support understanding what orders were
 // fulfilled when connecting a DAO Coin Limit Order Txn
 type FilledDAOCoinLimitOrder struct {
@@ -5807,6 +6728,17 @@ type FilledDAOCoinLimitOrder struct {
 	CoinQuantityInBaseUnitsBought *uint256.Int
 	CoinQuantityInBaseUnitsSold   *uint256.Int
 	IsFulfilled                   bool
+
+	// ===== ENCODER MIGRATION DAOCoinLimitOrderTradingFeesMigration =====
+	// FeeInBaseUnitsPaid is the trading fee this order's transactor paid on the fill,
+	// denominated in the coin they bought. CoinQuantityInBaseUnitsBought includes it.
+	FeeInBaseUnitsPaid *uint256.Int
+
+	// ===== ENCODER MIGRATION CreatorCoinTradeAmountsMigration =====
+	// BuyingCoinIsCreatorCoin and SellingCoinIsCreatorCoin are copied from the order, so
+	// that a creator's creator coin and DAO coin can be told apart.
+	BuyingCoinIsCreatorCoin  bool
+	SellingCoinIsCreatorCoin bool
 }
 
 func (order *DAOCoinLimitOrderEntry) Copy() *DAOCoinLimitOrderEntry {
@@ -5820,10 +6752,23 @@ func (order *DAOCoinLimitOrderEntry) Copy() *DAOCoinLimitOrderEntry {
 		OperationType:                             order.OperationType,
 		FillType:                                  order.FillType,
 		BlockHeight:                               order.BlockHeight,
+		ExpirationBlockHeight:                     order.ExpirationBlockHeight,
+		StopTriggerScaledPrice:                    cloneOptionalUint256(order.StopTriggerScaledPrice),
+		MinQuantityToFillInBaseUnits:              cloneOptionalUint256(order.MinQuantityToFillInBaseUnits),
+		QuantityDenomination:                      order.QuantityDenomination,
+		BuyingCoinIsCreatorCoin:                   order.BuyingCoinIsCreatorCoin,
+		SellingCoinIsCreatorCoin:                  order.SellingCoinIsCreatorCoin,
 		isDeleted:                                 order.isDeleted,
 	}
 }
 
+func cloneOptionalUint256(number *uint256.Int) *uint256.Int {
+	if number == nil {
+		return nil
+	}
+	return number.Clone()
+}
+
 func (order *DAOCoinLimitOrderEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
 	var data []byte
 
@@ -5837,6 +6782,27 @@ func (order *DAOCoinLimitOrderEntry) RawEncodeWithoutMetadata(blockHeight uint64
 	data = append(data, UintToBuf(uint64(order.FillType))...)
 	data = append(data, UintToBuf(uint64(order.BlockHeight))...)
 
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderExpirationMigration) {
+		data = append(data, UintToBuf(uint64(order.ExpirationBlockHeight))...)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderStopLimitMigration) {
+		data = append(data, VariableEncodeUint256(order.StopTriggerScaledPrice)...)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderMinFillQuantityMigration) {
+		data = append(data, VariableEncodeUint256(order.MinQuantityToFillInBaseUnits)...)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderQuantityDenominationMigration) {
+		data = append(data, UintToBuf(uint64(order.QuantityDenomination))...)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderCreatorCoinsMigration) {
+		data = append(data, BoolToByte(order.BuyingCoinIsCreatorCoin))
+		data = append(data, BoolToByte(order.SellingCoinIsCreatorCoin))
+	}
+
 	return data
 }
 
@@ -5916,11 +6882,69 @@ func (order *DAOCoinLimitOrderEntry) RawDecodeWithoutMetadata(blockHeight uint64
 	}
 	order.BlockHeight = uint32(daoBlockHeight)
 
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderExpirationMigration) {
+		// Parse ExpirationBlockHeight
+		expirationBlockHeight, err := ReadUvarint(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Error reading ExpirationBlockHeight: %v", err)
+		}
+		if expirationBlockHeight > uint64(math.MaxUint32) {
+			return fmt.Errorf("DAOCoinLimitOrderEntry.FromBytes: Invalid expiration block height %d: "+
+				"Greater than max uint32", expirationBlockHeight)
+		}
+		order.ExpirationBlockHeight = uint32(expirationBlockHeight)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderStopLimitMigration) {
+		// Parse StopTriggerScaledPrice
+		order.StopTriggerScaledPrice, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Error reading StopTriggerScaledPrice: %v", err)
+		}
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderMinFillQuantityMigration) {
+		// Parse MinQuantityToFillInBaseUnits
+		order.MinQuantityToFillInBaseUnits, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Error reading MinQuantityToFillInBaseUnits: %v", err)
+		}
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderQuantityDenominationMigration) {
+		// Parse QuantityDenomination
+		quantityDenomination, err := ReadUvarint(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Error reading QuantityDenomination: %v", err)
+		}
+		order.QuantityDenomination = DAOCoinLimitOrderQuantityDenomination(quantityDenomination)
+	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderCreatorCoinsMigration) {
+		// Parse BuyingCoinIsCreatorCoin
+		order.BuyingCoinIsCreatorCoin, err = ReadBoolByte(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Error reading BuyingCoinIsCreatorCoin: %v", err)
+		}
+		// Parse SellingCoinIsCreatorCoin
+		order.SellingCoinIsCreatorCoin, err = ReadBoolByte(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Error reading SellingCoinIsCreatorCoin: %v", err)
+		}
+	}
+
 	return nil
 }
 
 func (order *DAOCoinLimitOrderEntry) GetVersionByte(blockHeight uint64) byte {
-	return byte(0)
+	return GetMigrationVersion(
+		blockHeight,
+		DAOCoinLimitOrderExpirationMigration,
+		DAOCoinLimitOrderStopLimitMigration,
+		DAOCoinLimitOrderMinFillQuantityMigration,
+		DAOCoinLimitOrderQuantityDenominationMigration,
+		DAOCoinLimitOrderCreatorCoinsMigration,
+	)
 }
 
 func (order *DAOCoinLimitOrderEntry) GetEncoderType() EncoderType {
@@ -5961,13 +6985,14 @@ func (order *DAOCoinLimitOrderEntry) IsBetterMatchingOrderThan(other *DAOCoinLim
 }
 
 func (order *DAOCoinLimitOrderEntry) BaseUnitsToBuyUint256() (*uint256.Int, error) {
-	if order.OperationType == DAOCoinLimitOrderOperationTypeASK {
+	quantityOperationType := order.GetQuantityOperationType()
+	if quantityOperationType == DAOCoinLimitOrderOperationTypeASK {
 		// In this case, the quantity specified in the order is the amount to sell,
 		// so needs to be converted.
 		return ComputeBaseUnitsToBuyUint256(
 			order.ScaledExchangeRateCoinsToSellPerCoinToBuy,
 			order.QuantityToFillInBaseUnits)
-	} else if order.OperationType == DAOCoinLimitOrderOperationTypeBID {
+	} else if quantityOperationType == DAOCoinLimitOrderOperationTypeBID {
 		// In this case, the quantity specified in the order is the amount to buy,
 		// so can be returned as-is.
 		return order.QuantityToFillInBaseUnits, nil
@@ -6030,13 +7055,14 @@ func ComputeBaseUnitsToBuyUint256(
 }
 
 func (order *DAOCoinLimitOrderEntry) BaseUnitsToSellUint256() (*uint256.Int, error) {
-	if order.OperationType == DAOCoinLimitOrderOperationTypeBID {
+	quantityOperationType := order.GetQuantityOperationType()
+	if quantityOperationType == DAOCoinLimitOrderOperationTypeBID {
 		// In this case, the quantity specified in the order is the amount to buy,
 		// so needs to be converted.
 		return ComputeBaseUnitsToSellUint256(
 			order.ScaledExchangeRateCoinsToSellPerCoinToBuy,
 			order.QuantityToFillInBaseUnits)
-	} else if order.OperationType == DAOCoinLimitOrderOperationTypeASK {
+	} else if quantityOperationType == DAOCoinLimitOrderOperationTypeASK {
 		// In this case, the quantity specified in the order is the amount to sell,
 		// so can be returned as-is.
 		return order.QuantityToFillInBaseUnits, nil
@@ -6129,6 +7155,15 @@ func (order *FilledDAOCoinLimitOrder) RawEncodeWithoutMetadata(blockHeight uint6
 	data = append(data, VariableEncodeUint256(order.CoinQuantityInBaseUnitsSold)...)
 	data = append(data, BoolToByte(order.IsFulfilled))
 
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTradingFeesMigration) {
+		data = append(data, VariableEncodeUint256(order.FeeInBaseUnitsPaid)...)
+	}
+
+	if MigrationTriggered(blockHeight, CreatorCoinTradeAmountsMigration) {
+		data = append(data, BoolToByte(order.BuyingCoinIsCreatorCoin))
+		data = append(data, BoolToByte(order.SellingCoinIsCreatorCoin))
+	}
+
 	return data
 }
 
@@ -6182,11 +7217,29 @@ func (order *FilledDAOCoinLimitOrder) RawDecodeWithoutMetadata(blockHeight uint6
 		return errors.Wrapf(err, "FilledDAOCoinLimiteOrder.Decode: Problem reading IsFulfilled")
 	}
 
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTradingFeesMigration) {
+		// FeeInBaseUnitsPaid
+		if order.FeeInBaseUnitsPaid, err = VariableDecodeUint256(rr); err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrder.Decode: Problem reading FeeInBaseUnitsPaid")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, CreatorCoinTradeAmountsMigration) {
+		// BuyingCoinIsCreatorCoin
+		if order.BuyingCoinIsCreatorCoin, err = ReadBoolByte(rr); err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrder.Decode: Problem reading BuyingCoinIsCreatorCoin")
+		}
+		// SellingCoinIsCreatorCoin
+		if order.SellingCoinIsCreatorCoin, err = ReadBoolByte(rr); err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrder.Decode: Problem reading SellingCoinIsCreatorCoin")
+		}
+	}
+
 	return nil
 }
 
 func (order *FilledDAOCoinLimitOrder) GetVersionByte(blockHeight uint64) byte {
-	return byte(0)
+	return GetMigrationVersion(blockHeight, DAOCoinLimitOrderTradingFeesMigration, CreatorCoinTradeAmountsMigration)
 }
 
 func (order *FilledDAOCoinLimitOrder) GetEncoderType() EncoderType {
@@ -83,6 +83,15 @@ type ValidatorEntry struct {
 	// JailedAtEpochNumber tracks when a validator was first jailed. This helps to verify
 	// that enough time (epochs) have passed before the validator is able to unjail themselves.
 	JailedAtEpochNumber uint64
+	// WarmupStakeAmountNanos is the portion of TotalStakeAmountNanos that was staked during
+	// WarmupEpochNumber. It's the sum of the assigned StakeEntries' WarmupStakeAmountNanos for
+	// that epoch, and it's excluded from the validator's rewards until the epoch is complete.
+	WarmupStakeAmountNanos *uint256.Int
+	WarmupEpochNumber      uint64
+	// LastSlashedAtView is the view of the most recent double vote this validator was
+	// slashed for. A validator can only be slashed again for a double vote in a later view,
+	// so the same evidence can't be used to slash it twice.
+	LastSlashedAtView uint64
 
 	ExtraData map[string][]byte
 	isDeleted bool
@@ -137,6 +146,12 @@ func (validatorEntry *ValidatorEntry) Copy() *ValidatorEntry {
 		domainsCopy = append(domainsCopy, append([]byte{}, domain...)) // Makes a copy.
 	}
 
+	// Copy WarmupStakeAmountNanos.
+	var warmupStakeAmountNanos *uint256.Int
+	if validatorEntry.WarmupStakeAmountNanos != nil {
+		warmupStakeAmountNanos = validatorEntry.WarmupStakeAmountNanos.Clone()
+	}
+
 	// Return new ValidatorEntry.
 	return &ValidatorEntry{
 		ValidatorPKID:                       validatorEntry.ValidatorPKID.NewPKID(),
@@ -148,6 +163,9 @@ func (validatorEntry *ValidatorEntry) Copy() *ValidatorEntry {
 		TotalStakeAmountNanos:               validatorEntry.TotalStakeAmountNanos.Clone(),
 		LastActiveAtEpochNumber:             validatorEntry.LastActiveAtEpochNumber,
 		JailedAtEpochNumber:                 validatorEntry.JailedAtEpochNumber,
+		WarmupStakeAmountNanos:              warmupStakeAmountNanos,
+		WarmupEpochNumber:                   validatorEntry.WarmupEpochNumber,
+		LastSlashedAtView:                   validatorEntry.LastSlashedAtView,
 		ExtraData:                           copyExtraData(validatorEntry.ExtraData),
 		isDeleted:                           validatorEntry.isDeleted,
 	}
@@ -171,6 +189,13 @@ func (validatorEntry *ValidatorEntry) RawEncodeWithoutMetadata(blockHeight uint6
 	data = append(data, UintToBuf(validatorEntry.LastActiveAtEpochNumber)...)
 	data = append(data, UintToBuf(validatorEntry.JailedAtEpochNumber)...)
 	data = append(data, EncodeExtraData(validatorEntry.ExtraData)...)
+	if MigrationTriggered(blockHeight, StakingRewardsAccrualMigration) {
+		data = append(data, VariableEncodeUint256(validatorEntry.WarmupStakeAmountNanos)...)
+		data = append(data, UintToBuf(validatorEntry.WarmupEpochNumber)...)
+	}
+	if MigrationTriggered(blockHeight, ValidatorSlashingMigration) {
+		data = append(data, UintToBuf(validatorEntry.LastSlashedAtView)...)
+	}
 	return data
 }
 
@@ -244,11 +269,33 @@ func (validatorEntry *ValidatorEntry) RawDecodeWithoutMetadata(blockHeight uint6
 		return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading ExtraData: ")
 	}
 
+	if MigrationTriggered(blockHeight, StakingRewardsAccrualMigration) {
+		// WarmupStakeAmountNanos
+		validatorEntry.WarmupStakeAmountNanos, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading WarmupStakeAmountNanos: ")
+		}
+
+		// WarmupEpochNumber
+		validatorEntry.WarmupEpochNumber, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading WarmupEpochNumber: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, ValidatorSlashingMigration) {
+		// LastSlashedAtView
+		validatorEntry.LastSlashedAtView, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading LastSlashedAtView: ")
+		}
+	}
+
 	return nil
 }
 
 func (validatorEntry *ValidatorEntry) GetVersionByte(blockHeight uint64) byte {
-	return 0
+	return GetMigrationVersion(blockHeight, StakingRewardsAccrualMigration, ValidatorSlashingMigration)
 }
 
 func (validatorEntry *ValidatorEntry) GetEncoderType() EncoderType {
@@ -1022,7 +1069,7 @@ func (bc *Blockchain) CreateRegisterAsValidatorTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use
 	// it to get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	if !isInterfaceValueNil(mempool) {
 		var err error
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -1095,7 +1142,7 @@ func (bc *Blockchain) CreateUnregisterAsValidatorTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use
 	// it to get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	if !isInterfaceValueNil(mempool) {
 		var err error
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -1167,7 +1214,7 @@ func (bc *Blockchain) CreateUnjailValidatorTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use
 	// it to get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	if !isInterfaceValueNil(mempool) {
 		var err error
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -1463,6 +1510,15 @@ func (bav *UtxoView) _connectUnregisterAsValidator(
 		return 0, 0, nil, errors.Wrapf(err, "_connectUnregisterAsValidator: error retrieving CurrentEpochNumber: ")
 	}
 
+	// Retrieve the PrevValidatorRewardIndexEntry. This will be restored if we disconnect the txn.
+	var prevRewardIndexEntry *ValidatorRewardIndexEntry
+	if blockHeight >= bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight {
+		prevRewardIndexEntry, err = bav.GetValidatorRewardIndexEntry(transactorPKIDEntry.PKID)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUnregisterAsValidator: ")
+		}
+	}
+
 	// Delete each StakeEntry and create or update the corresponding LockedStakeEntry.
 	// Track TotalUnstakedAmountNanos and PrevLockedStakeEntries.
 	totalUnstakedAmountNanos := uint256.NewInt()
@@ -1479,6 +1535,22 @@ func (bav *UtxoView) _connectUnregisterAsValidator(
 			)
 		}
 
+		// Settle the StakeEntry's staking rewards. Restake rewards are unstaked along with the
+		// stake, and PayToBalance rewards are paid to the staker's balance.
+		restakedRewardNanos, rewardUtxoOp, err := bav.settleStakeReward(prevStakeEntry, uint64(blockHeight))
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUnregisterAsValidator: ")
+		}
+		if rewardUtxoOp != nil {
+			utxoOpsForTxn = append(utxoOpsForTxn, rewardUtxoOp)
+		}
+		lockedAmountNanos, err := SafeUint256().Add(prevStakeEntry.StakeAmountNanos, restakedRewardNanos)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(
+				err, "_connectUnregisterAsValidator: error adding restaked rewards to UnstakedAmountNanos: ",
+			)
+		}
+
 		// Retrieve the existing LockedStakeEntry, if exists.
 		prevLockedStakeEntry, err := bav.GetLockedStakeEntry(
 			prevStakeEntry.ValidatorPKID, prevStakeEntry.StakerPKID, currentEpochNumber,
@@ -1497,7 +1569,7 @@ func (bav *UtxoView) _connectUnregisterAsValidator(
 			prevLockedStakeEntries = append(prevLockedStakeEntries, prevLockedStakeEntry)
 			lockedStakeEntry = prevLockedStakeEntry.Copy()
 			lockedStakeEntry.LockedAmountNanos, err = SafeUint256().Add(
-				lockedStakeEntry.LockedAmountNanos, prevStakeEntry.StakeAmountNanos,
+				lockedStakeEntry.LockedAmountNanos, lockedAmountNanos,
 			)
 			if err != nil {
 				return 0, 0, nil, errors.Wrapf(
@@ -1508,7 +1580,7 @@ func (bav *UtxoView) _connectUnregisterAsValidator(
 			lockedStakeEntry = &LockedStakeEntry{
 				StakerPKID:          prevStakeEntry.StakerPKID.NewPKID(),
 				ValidatorPKID:       prevStakeEntry.ValidatorPKID.NewPKID(),
-				LockedAmountNanos:   prevStakeEntry.StakeAmountNanos.Clone(),
+				LockedAmountNanos:   lockedAmountNanos,
 				LockedAtEpochNumber: currentEpochNumber,
 			}
 		}
@@ -1535,13 +1607,31 @@ func (bav *UtxoView) _connectUnregisterAsValidator(
 	}
 	bav._deleteValidatorEntryMappings(prevValidatorEntry)
 
-	// Sanity check that TotalUnstakedAmountNanos == PrevValidatorEntry.TotalStakedAmountNanos.
-	if !totalUnstakedAmountNanos.Eq(prevValidatorEntry.TotalStakeAmountNanos) {
+	// Sanity check that TotalUnstakedAmountNanos + RestakedRewardNanos == PrevValidatorEntry.TotalStakedAmountNanos.
+	// The restaked rewards that hadn't been settled into the StakeEntries are part of the validator's stake.
+	totalStakeAmountNanos, err := SafeUint256().Add(
+		totalUnstakedAmountNanos, getRestakedRewardNanos(prevRewardIndexEntry),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUnregisterAsValidator: error adding RestakedRewardNanos: ")
+	}
+	if !totalStakeAmountNanos.Eq(prevValidatorEntry.TotalStakeAmountNanos) {
 		return 0, 0, nil, errors.New(
 			"_connectUnregisterAsValidator: TotalUnstakedAmountNanos does not match ValidatorEntry.TotalStakedAmountNanos: ",
 		)
 	}
 
+	// Reset the validator's Restake stake now that all of its StakeEntries are gone. Its
+	// reward indexes are kept so that any future StakeEntries checkpoint against them.
+	if prevRewardIndexEntry != nil {
+		currentRewardIndexEntry := prevRewardIndexEntry.Copy()
+		currentRewardIndexEntry.RestakeStakeAmountNanos = uint256.NewInt()
+		currentRewardIndexEntry.RestakeWarmupStakeAmountNanos = uint256.NewInt()
+		currentRewardIndexEntry.RestakeWarmupEpochNumber = currentEpochNumber
+		currentRewardIndexEntry.RestakedRewardNanos = uint256.NewInt()
+		bav._setValidatorRewardIndexEntryMappings(currentRewardIndexEntry)
+	}
+
 	// Compute map of staker PKIDs to public key base58check for  state change entry.
 	stakerPKIDToPublicKeyBase58CheckMap := make(map[PKID]string)
 	for _, stakerPKID := range prevStakeEntries {
@@ -1551,10 +1641,11 @@ func (bav *UtxoView) _connectUnregisterAsValidator(
 
 	// Create a UTXO operation.
 	utxoOpForTxn := &UtxoOperation{
-		Type:                   OperationTypeUnregisterAsValidator,
-		PrevValidatorEntry:     prevValidatorEntry,
-		PrevStakeEntries:       prevStakeEntries,
-		PrevLockedStakeEntries: prevLockedStakeEntries,
+		Type:                          OperationTypeUnregisterAsValidator,
+		PrevValidatorEntry:            prevValidatorEntry,
+		PrevStakeEntries:              prevStakeEntries,
+		PrevLockedStakeEntries:        prevLockedStakeEntries,
+		PrevValidatorRewardIndexEntry: prevRewardIndexEntry,
 		StateChangeMetadata: &UnregisterAsValidatorStateChangeMetadata{
 			StakerPKIDToPublicKeyBase58CheckMap: stakerPKIDToPublicKeyBase58CheckMap,
 		},
@@ -1637,6 +1728,17 @@ func (bav *UtxoView) _disconnectUnregisterAsValidator(
 		bav._setLockedStakeEntryMappings(prevLockedStakeEntry)
 	}
 
+	// Restore the PrevValidatorRewardIndexEntry, if exists.
+	if operationData.PrevValidatorRewardIndexEntry != nil {
+		bav._setValidatorRewardIndexEntryMappings(operationData.PrevValidatorRewardIndexEntry)
+	}
+
+	// Revert any staking rewards that were paid to the stakers' balances.
+	operationIndex, err = bav._disconnectStakeRewardPayments(utxoOpsForTxn, operationIndex)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUnregisterAsValidator: ")
+	}
+
 	// Disconnect the BasicTransfer.
 	return bav._disconnectBasicTransfer(
 		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
@@ -1984,7 +2086,13 @@ func (bav *UtxoView) SanityCheckUnregisterAsValidatorTxn(
 	if !utxoOp.PrevValidatorEntry.ValidatorPKID.Eq(transactorPKID) {
 		return errors.New("SanityCheckUnregisterAsValidatorTxn: ValidatorPKID doesn't match TransactorPKID")
 	}
-	if !utxoOp.PrevValidatorEntry.TotalStakeAmountNanos.Eq(amountNanos) {
+	totalStakeAmountNanos, err := SafeUint256().Add(
+		amountNanos, getRestakedRewardNanos(utxoOp.PrevValidatorRewardIndexEntry),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "SanityCheckUnregisterAsValidatorTxn: error adding RestakedRewardNanos: ")
+	}
+	if !utxoOp.PrevValidatorEntry.TotalStakeAmountNanos.Eq(totalStakeAmountNanos) {
 		return errors.New("SanityCheckUnregisterAsValidatorTxn: TotalStakeAmountNanos doesn't match")
 	}
 	currentValidatorEntry, err := bav.GetValidatorByPKID(utxoOp.PrevValidatorEntry.ValidatorPKID)
@@ -2037,7 +2145,7 @@ func (bav *UtxoView) GetValidatorByPKID(pkid *PKID) (*ValidatorEntry, error) {
 
 	// If no ValidatorEntry (either isDeleted or !isDeleted) was found
 	// in the UtxoView for the given PKID, check the database.
-	dbValidatorEntry, err := DBGetValidatorByPKID(bav.Handle, bav.Snapshot, pkid)
+	dbValidatorEntry, err := bav.GetDbAdapter().GetValidatorByPKID(pkid)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetValidatorByPKID: ")
 	}
@@ -2077,7 +2185,7 @@ func (bav *UtxoView) GetBLSPublicKeyPKIDPairEntry(blsPublicKey *bls.PublicKey) (
 
 	// If no BLSPublicKeyPKIDPairEntry (either isDeleted or !isDeleted) was found
 	// in the UtxoView for the given blsPublicKey, check the database.
-	dbBLSPublicKeyPKIDPairEntry, err := DBGetValidatorBLSPublicKeyPKIDPairEntry(bav.Handle, bav.Snapshot, blsPublicKey)
+	dbBLSPublicKeyPKIDPairEntry, err := bav.GetDbAdapter().GetValidatorBLSPublicKeyPKIDPairEntry(blsPublicKey)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetBLSPublicKeyPKIDPairEntry: ")
 	}
@@ -2106,7 +2214,7 @@ func (bav *UtxoView) GetTopActiveValidatorsByStakeAmount(limit uint64) ([]*Valid
 	// Pull top N active ValidatorEntries from the database (not present in the UtxoView).
 	// Note that we will skip validators that are present in the view because we pass
 	// utxoViewValidatorEntries to the function.
-	dbValidatorEntries, err := DBGetTopActiveValidatorsByStakeAmount(bav.Handle, bav.Snapshot, limit, utxoViewValidatorEntries)
+	dbValidatorEntries, err := bav.GetDbAdapter().GetTopActiveValidatorsByStakeAmount(limit, utxoViewValidatorEntries)
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetTopActiveValidatorsByStakeAmount: error retrieving entries from db: ")
 	}
@@ -2211,6 +2319,16 @@ func (bav *UtxoView) ShouldJailValidator(validatorEntry *ValidatorEntry, blockHe
 		return false, nil
 	}
 
+	// Jail the validator if it missed too many of its leader slots in the current epoch,
+	// regardless of whether it has otherwise been active.
+	exceedsMissedSlotsThreshold, err := bav.ExceedsJailMissedSlotsThreshold(validatorEntry, blockHeight)
+	if err != nil {
+		return false, errors.Wrapf(err, "UtxoView.ShouldJailValidator: ")
+	}
+	if exceedsMissedSlotsThreshold {
+		return true, nil
+	}
+
 	// Retrieve the current GlobalParamsEntry. It's safe to use the current global params here because the
 	// jailing operations made here does not affect the PoS consensus until they are snapshotted and used in
 	// consensus n epochs later. The two params we care about here are:
@@ -2259,6 +2377,31 @@ func (bav *UtxoView) ShouldJailValidator(validatorEntry *ValidatorEntry, blockHe
 	return jailAtEpochNumber <= currentEpochNumber, nil
 }
 
+// ExceedsJailMissedSlotsThreshold returns true if the validator missed more than JailMissedSlotsThreshold
+// of its leader slots in the current epoch. Missed slots are only tracked from the
+// ValidatorPerformanceTrackingBlockHeight onward, so this always returns false before then.
+func (bav *UtxoView) ExceedsJailMissedSlotsThreshold(validatorEntry *ValidatorEntry, blockHeight uint64) (bool, error) {
+	if blockHeight < uint64(bav.Params.ForkHeights.ValidatorPerformanceTrackingBlockHeight) {
+		return false, nil
+	}
+
+	// Retrieve the CurrentEpochNumber.
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return false, errors.Wrapf(err, "UtxoView.ExceedsJailMissedSlotsThreshold: error retrieving CurrentEpochNumber: ")
+	}
+
+	// Retrieve the validator's performance during the current epoch.
+	performanceEntry, err := bav.GetValidatorEpochPerformanceEntry(validatorEntry.ValidatorPKID, currentEpochNumber)
+	if err != nil {
+		return false, errors.Wrapf(err, "UtxoView.ExceedsJailMissedSlotsThreshold: error retrieving performance entry: ")
+	}
+
+	// It's safe to use the current global params here for the same reason as in ShouldJailValidator.
+	currentGlobalParamsEntry := bav.GetCurrentGlobalParamsEntry()
+	return performanceEntry.SlotsMissed > currentGlobalParamsEntry.JailMissedSlotsThreshold, nil
+}
+
 func (bav *UtxoView) JailValidator(validatorEntry *ValidatorEntry) error {
 	// Retrieve the CurrentEpochNumber.
 	currentEpochNumber, err := bav.GetCurrentEpochNumber()
@@ -0,0 +1,592 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// block_view_validator_slash.go implements slashing. A validator that signs votes for two
+// different blocks in the same view can be slashed by anyone who submits both votes in a
+// SlashValidator txn. The votes are checked against the validator's VotingPublicKey, so
+// the txn is its own proof and doesn't depend on the blocks that were voted for.
+//
+// Slashing burns ValidatorSlashBasisPoints of the validator's stake. That includes the
+// stake delegated to it, since delegators share in the validator's rewards and so share
+// in its penalties, and the stake locked up after unstaking from it, so a staker can't
+// escape a slash by unstaking once the double vote is seen. The stake's rewards are
+// settled before the slash, so the rewards are slashed along with it. The validator is
+// also jailed if it isn't already, and has to unjail itself once the ValidatorJailEpochDuration
+// has passed.
+//
+// Evidence is only accepted for views in the current epoch, and a validator can only be
+// slashed again for a double vote in a later view than the one it was last slashed for.
+
+//
+// TYPES: SlashValidatorMetadata
+//
+
+type SlashValidatorMetadata struct {
+	ValidatorPublicKey *PublicKey
+	// View is the view in which the validator voted for both blocks.
+	View uint64
+	// FirstBlockHash and SecondBlockHash are the blocks the validator voted for, and
+	// FirstVoteSignature and SecondVoteSignature are its signatures of the votes.
+	FirstBlockHash      *BlockHash
+	FirstVoteSignature  *bls.Signature
+	SecondBlockHash     *BlockHash
+	SecondVoteSignature *bls.Signature
+}
+
+func (txnData *SlashValidatorMetadata) GetTxnType() TxnType {
+	return TxnTypeSlashValidator
+}
+
+func (txnData *SlashValidatorMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, EncodeByteArray(txnData.ValidatorPublicKey.ToBytes())...)
+	data = append(data, UintToBuf(txnData.View)...)
+	data = append(data, EncodeOptionalBlockHash(txnData.FirstBlockHash)...)
+	data = append(data, EncodeOptionalBLSSignature(txnData.FirstVoteSignature)...)
+	data = append(data, EncodeOptionalBlockHash(txnData.SecondBlockHash)...)
+	data = append(data, EncodeOptionalBLSSignature(txnData.SecondVoteSignature)...)
+	return data, nil
+}
+
+func (txnData *SlashValidatorMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	// ValidatorPublicKey
+	validatorPublicKeyBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "SlashValidatorMetadata.FromBytes: Problem reading ValidatorPublicKey: ")
+	}
+	txnData.ValidatorPublicKey = NewPublicKey(validatorPublicKeyBytes)
+
+	// View
+	if txnData.View, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SlashValidatorMetadata.FromBytes: Problem reading View: ")
+	}
+
+	// FirstBlockHash
+	if txnData.FirstBlockHash, err = ReadOptionalBlockHash(rr); err != nil {
+		return errors.Wrapf(err, "SlashValidatorMetadata.FromBytes: Problem reading FirstBlockHash: ")
+	}
+
+	// FirstVoteSignature
+	if txnData.FirstVoteSignature, err = DecodeOptionalBLSSignature(rr); err != nil {
+		return errors.Wrapf(err, "SlashValidatorMetadata.FromBytes: Problem reading FirstVoteSignature: ")
+	}
+
+	// SecondBlockHash
+	if txnData.SecondBlockHash, err = ReadOptionalBlockHash(rr); err != nil {
+		return errors.Wrapf(err, "SlashValidatorMetadata.FromBytes: Problem reading SecondBlockHash: ")
+	}
+
+	// SecondVoteSignature
+	if txnData.SecondVoteSignature, err = DecodeOptionalBLSSignature(rr); err != nil {
+		return errors.Wrapf(err, "SlashValidatorMetadata.FromBytes: Problem reading SecondVoteSignature: ")
+	}
+
+	return nil
+}
+
+func (txnData *SlashValidatorMetadata) New() DeSoTxnMetadata {
+	return &SlashValidatorMetadata{}
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateSlashValidatorTxn(
+	transactorPublicKey []byte,
+	metadata *SlashValidatorMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the SlashValidator fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Create a new UtxoView. If we have access to a mempool object, use
+	// it to get an augmented view that factors in pending transactions.
+	utxoView := bc.NewUtxoView()
+	if !isInterfaceValueNil(mempool) {
+		var err error
+		utxoView, err = mempool.GetAugmentedUniversalView()
+		if err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(
+				err, "Blockchain.CreateSlashValidatorTxn: problem getting augmented utxo view from mempool: ",
+			)
+		}
+	}
+
+	// Validate txn metadata.
+	if err := utxoView.IsValidSlashValidatorMetadata(metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateSlashValidatorTxn: invalid txn metadata: ",
+		)
+	}
+
+	// We don't need to make any tweaks to the amount because
+	// it's basically a standard "pay per kilobyte" transaction.
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateSlashValidatorTxn: problem adding inputs: ",
+		)
+	}
+
+	// Sanity-check that the spendAmount is zero.
+	if spendAmount != 0 {
+		return nil, 0, 0, 0, fmt.Errorf(
+			"Blockchain.CreateSlashValidatorTxn: spend amount is non-zero: %d", spendAmount,
+		)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectSlashValidator(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.ValidatorSlashingBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorSlashValidatorBeforeBlockHeight, "_connectSlashValidator: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeSlashValidator {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectSlashValidator: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+
+	// Connect a basic transfer to get the total input and the
+	// total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+	}
+
+	// Grab the txn metadata.
+	txMeta := txn.TxnMeta.(*SlashValidatorMetadata)
+
+	// Validate the evidence. Anyone can submit it, so the transactor isn't checked.
+	if err = bav.IsValidSlashValidatorMetadata(txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+	}
+
+	// Retrieve the PrevValidatorEntry. This will be restored if we disconnect the txn.
+	prevValidatorEntry, err := bav.GetValidatorByPublicKey(txMeta.ValidatorPublicKey)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+	}
+	validatorPKID := prevValidatorEntry.ValidatorPKID
+
+	// Retrieve the CurrentEpochNumber.
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error retrieving CurrentEpochNumber: ")
+	}
+	slashBasisPoints := bav.GetCurrentGlobalParamsEntry().ValidatorSlashBasisPoints
+	if slashBasisPoints == 0 {
+		slashBasisPoints = bav.Params.DefaultValidatorSlashBasisPoints
+	}
+
+	// Retrieve the validator's ValidatorRewardIndexEntry before its StakeEntries change. The
+	// PrevValidatorRewardIndexEntry will be restored if we disconnect the txn.
+	var prevRewardIndexEntry, currentRewardIndexEntry *ValidatorRewardIndexEntry
+	if blockHeight >= bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight {
+		prevRewardIndexEntry, err = bav.getValidatorRewardIndexEntryWithRestakeStake(validatorPKID)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+		}
+		currentRewardIndexEntry = prevRewardIndexEntry.Copy()
+	}
+
+	// Slash each of the validator's StakeEntries, including its own. Track the total that's
+	// slashed, the shortfall of restaked rewards from rounding, and how much of the slashed
+	// stake was warming up, so that the ValidatorEntry can be updated to match.
+	prevStakeEntries, err := bav.GetStakeEntriesForValidatorPKID(validatorPKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error retrieving StakeEntries: ")
+	}
+	totalSlashedStakeAmountNanos := uint256.NewInt()
+	totalSlashedWarmupStakeAmountNanos := uint256.NewInt()
+	totalRestakedRewardShortfallNanos := uint256.NewInt()
+	for _, prevStakeEntry := range prevStakeEntries {
+		// Settle the StakeEntry's staking rewards. Restake rewards are added to the stake, and
+		// so are slashed along with it. PayToBalance rewards are paid to the staker's balance.
+		restakedRewardNanos, rewardUtxoOp, err := bav.settleStakeReward(prevStakeEntry, uint64(blockHeight))
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+		}
+		if rewardUtxoOp != nil {
+			utxoOpsForTxn = append(utxoOpsForTxn, rewardUtxoOp)
+		}
+		settledStakeAmountNanos, err := SafeUint256().Add(prevStakeEntry.StakeAmountNanos, restakedRewardNanos)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error adding restaked rewards to StakeAmountNanos: ")
+		}
+		slashedAmountNanos, err := computeSlashedAmountNanos(settledStakeAmountNanos, slashBasisPoints)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+		}
+
+		// Slashed stake is taken from the stake that is still warming up first, like unstaked stake.
+		warmupStakeAmountNanos, warmupEpochNumber, err := bav.computeWarmupStakeAmountNanos(
+			prevStakeEntry.WarmupStakeAmountNanos,
+			prevStakeEntry.WarmupEpochNumber,
+			uint256.NewInt(),
+			slashedAmountNanos,
+			uint64(blockHeight),
+		)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+		}
+		if warmupStakeAmountNanos != nil {
+			slashedWarmupStakeAmountNanos, err := SafeUint256().Sub(
+				getActiveWarmupStakeAmountNanos(
+					prevStakeEntry.WarmupStakeAmountNanos, prevStakeEntry.WarmupEpochNumber, warmupEpochNumber,
+				),
+				warmupStakeAmountNanos,
+			)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error computing slashed warmup stake: ")
+			}
+			totalSlashedWarmupStakeAmountNanos, err = SafeUint256().Add(
+				totalSlashedWarmupStakeAmountNanos, slashedWarmupStakeAmountNanos,
+			)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error adding slashed warmup stake: ")
+			}
+		}
+
+		// Replace the PrevStakeEntry with the slashed StakeEntry. It's deleted if nothing is left.
+		stakeAmountNanos, err := SafeUint256().Sub(settledStakeAmountNanos, slashedAmountNanos)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error subtracting slashed stake: ")
+		}
+		var currentStakeEntry *StakeEntry
+		if !stakeAmountNanos.IsZero() {
+			currentStakeEntry = prevStakeEntry.Copy()
+			currentStakeEntry.StakeAmountNanos = stakeAmountNanos
+			currentStakeEntry.RewardIndexCheckpoint, err = bav.getRewardIndexCheckpoint(
+				currentStakeEntry, uint64(blockHeight),
+			)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+			}
+			currentStakeEntry.WarmupStakeAmountNanos = warmupStakeAmountNanos
+			currentStakeEntry.WarmupEpochNumber = warmupEpochNumber
+		}
+		bav._deleteStakeEntryMappings(prevStakeEntry)
+		if currentStakeEntry != nil {
+			bav._setStakeEntryMappings(currentStakeEntry)
+		}
+
+		// Update the validator's Restake stake.
+		restakedRewardShortfallNanos, err := bav.updateRestakeStakeAmounts(
+			currentRewardIndexEntry, prevStakeEntry, currentStakeEntry, restakedRewardNanos, uint64(blockHeight),
+		)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+		}
+		totalRestakedRewardShortfallNanos, err = SafeUint256().Add(
+			totalRestakedRewardShortfallNanos, restakedRewardShortfallNanos,
+		)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error adding restaked reward shortfall: ")
+		}
+		totalSlashedStakeAmountNanos, err = SafeUint256().Add(totalSlashedStakeAmountNanos, slashedAmountNanos)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error adding slashed stake: ")
+		}
+	}
+	if currentRewardIndexEntry != nil {
+		bav._setValidatorRewardIndexEntryMappings(currentRewardIndexEntry)
+	}
+
+	// Slash the stake that has been unstaked from the validator but not unlocked yet. It
+	// doesn't count towards the validator's TotalStakeAmountNanos.
+	lockedStakeEntries, err := bav.GetLockedStakeEntriesForValidatorPKID(validatorPKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error retrieving LockedStakeEntries: ")
+	}
+	var prevLockedStakeEntries []*LockedStakeEntry
+	totalSlashedAmountNanos := totalSlashedStakeAmountNanos.Clone()
+	for _, prevLockedStakeEntry := range lockedStakeEntries {
+		slashedAmountNanos, err := computeSlashedAmountNanos(prevLockedStakeEntry.LockedAmountNanos, slashBasisPoints)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+		}
+		if slashedAmountNanos.IsZero() {
+			continue
+		}
+		lockedAmountNanos, err := SafeUint256().Sub(prevLockedStakeEntry.LockedAmountNanos, slashedAmountNanos)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error subtracting slashed locked stake: ")
+		}
+		prevLockedStakeEntries = append(prevLockedStakeEntries, prevLockedStakeEntry)
+		bav._deleteLockedStakeEntryMappings(prevLockedStakeEntry)
+		if !lockedAmountNanos.IsZero() {
+			currentLockedStakeEntry := prevLockedStakeEntry.Copy()
+			currentLockedStakeEntry.LockedAmountNanos = lockedAmountNanos
+			bav._setLockedStakeEntryMappings(currentLockedStakeEntry)
+		}
+		totalSlashedAmountNanos, err = SafeUint256().Add(totalSlashedAmountNanos, slashedAmountNanos)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error adding slashed locked stake: ")
+		}
+	}
+	if !totalSlashedAmountNanos.IsUint64() {
+		return 0, 0, nil, errors.New("_connectSlashValidator: total slashed amount overflows uint64")
+	}
+
+	// Update the ValidatorEntry. Its TotalStakeAmountNanos loses the slashed stake, it's
+	// jailed if it isn't already, and the view is recorded so it can't be slashed for it again.
+	currentValidatorEntry := prevValidatorEntry.Copy()
+	currentValidatorEntry.TotalStakeAmountNanos, err = SafeUint256().Add(
+		currentValidatorEntry.TotalStakeAmountNanos, totalRestakedRewardShortfallNanos,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error adding restaked rewards to TotalStakeAmountNanos: ")
+	}
+	currentValidatorEntry.TotalStakeAmountNanos, err = SafeUint256().Sub(
+		currentValidatorEntry.TotalStakeAmountNanos, totalSlashedStakeAmountNanos,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: error subtracting slashed stake from TotalStakeAmountNanos: ")
+	}
+	currentValidatorEntry.WarmupStakeAmountNanos, currentValidatorEntry.WarmupEpochNumber, err = bav.computeWarmupStakeAmountNanos(
+		prevValidatorEntry.WarmupStakeAmountNanos,
+		prevValidatorEntry.WarmupEpochNumber,
+		uint256.NewInt(),
+		totalSlashedWarmupStakeAmountNanos,
+		uint64(blockHeight),
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSlashValidator: ")
+	}
+	if currentValidatorEntry.Status() != ValidatorStatusJailed {
+		currentValidatorEntry.JailedAtEpochNumber = currentEpochNumber
+	}
+	currentValidatorEntry.LastSlashedAtView = txMeta.View
+	bav._deleteValidatorEntryMappings(prevValidatorEntry)
+	bav._setValidatorEntryMappings(currentValidatorEntry)
+
+	// Add a UTXO operation. The slashed DESO is burned, so it isn't credited to anyone.
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                          OperationTypeSlashValidator,
+		PrevValidatorEntry:            prevValidatorEntry,
+		PrevStakeEntries:              prevStakeEntries,
+		PrevLockedStakeEntries:        prevLockedStakeEntries,
+		PrevValidatorRewardIndexEntry: prevRewardIndexEntry,
+		StakeAmountNanosDiff:          totalSlashedAmountNanos.Uint64(),
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectSlashValidator(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.ValidatorSlashingBlockHeight {
+		return errors.Wrapf(RuleErrorSlashValidatorBeforeBlockHeight, "_disconnectSlashValidator: ")
+	}
+
+	// Validate the last operation is a SlashValidator operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectSlashValidator: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeSlashValidator {
+		return fmt.Errorf(
+			"_disconnectSlashValidator: trying to revert %v but found %v",
+			OperationTypeSlashValidator,
+			operationData.Type,
+		)
+	}
+
+	// Restore the PrevValidatorEntry.
+	prevValidatorEntry := operationData.PrevValidatorEntry
+	if prevValidatorEntry == nil {
+		return errors.New("_disconnectSlashValidator: PrevValidatorEntry is nil")
+	}
+	currentValidatorEntry, err := bav.GetValidatorByPKID(prevValidatorEntry.ValidatorPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectSlashValidator: ")
+	}
+	if currentValidatorEntry == nil || currentValidatorEntry.isDeleted {
+		return errors.Wrapf(RuleErrorValidatorNotFound, "_disconnectSlashValidator: ")
+	}
+	bav._deleteValidatorEntryMappings(currentValidatorEntry)
+	bav._setValidatorEntryMappings(prevValidatorEntry)
+
+	// Restore the PrevStakeEntries. The current StakeEntry won't exist if all of its stake
+	// was slashed.
+	for _, prevStakeEntry := range operationData.PrevStakeEntries {
+		currentStakeEntry, err := bav.GetStakeEntry(prevStakeEntry.ValidatorPKID, prevStakeEntry.StakerPKID)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectSlashValidator: error retrieving CurrentStakeEntry: ")
+		}
+		if currentStakeEntry != nil {
+			bav._deleteStakeEntryMappings(currentStakeEntry)
+		}
+		bav._setStakeEntryMappings(prevStakeEntry)
+	}
+
+	// Restore the PrevLockedStakeEntries. The current LockedStakeEntry won't exist if all of
+	// its stake was slashed.
+	for _, prevLockedStakeEntry := range operationData.PrevLockedStakeEntries {
+		currentLockedStakeEntry, err := bav.GetLockedStakeEntry(
+			prevLockedStakeEntry.ValidatorPKID, prevLockedStakeEntry.StakerPKID, prevLockedStakeEntry.LockedAtEpochNumber,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectSlashValidator: error retrieving CurrentLockedStakeEntry: ")
+		}
+		if currentLockedStakeEntry != nil {
+			bav._deleteLockedStakeEntryMappings(currentLockedStakeEntry)
+		}
+		bav._setLockedStakeEntryMappings(prevLockedStakeEntry)
+	}
+
+	// Restore the PrevValidatorRewardIndexEntry, if exists.
+	if operationData.PrevValidatorRewardIndexEntry != nil {
+		bav._setValidatorRewardIndexEntryMappings(operationData.PrevValidatorRewardIndexEntry)
+	}
+
+	// Revert any staking rewards that were paid to the stakers' balances.
+	operationIndex, err = bav._disconnectStakeRewardPayments(utxoOpsForTxn, operationIndex)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectSlashValidator: ")
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// IsValidSlashValidatorMetadata checks that a SlashValidator txn's votes prove that the
+// validator voted for two different blocks in the same view of the current epoch, and
+// that it hasn't already been slashed for a double vote in that view or a later one.
+func (bav *UtxoView) IsValidSlashValidatorMetadata(metadata *SlashValidatorMetadata) error {
+	// Validate the ValidatorEntry exists.
+	if metadata.ValidatorPublicKey == nil {
+		return errors.Wrapf(RuleErrorInvalidValidatorPKID, "UtxoView.IsValidSlashValidatorMetadata: ")
+	}
+	validatorEntry, err := bav.GetValidatorByPublicKey(metadata.ValidatorPublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.IsValidSlashValidatorMetadata: ")
+	}
+
+	// Validate the votes are for two different blocks.
+	if metadata.FirstBlockHash == nil || metadata.SecondBlockHash == nil {
+		return errors.Wrapf(RuleErrorSlashValidatorMissingBlockHash, "UtxoView.IsValidSlashValidatorMetadata: ")
+	}
+	if metadata.FirstBlockHash.IsEqual(metadata.SecondBlockHash) {
+		return errors.Wrapf(RuleErrorSlashValidatorSameBlockHash, "UtxoView.IsValidSlashValidatorMetadata: ")
+	}
+
+	// Validate the validator signed both votes.
+	for _, vote := range []struct {
+		blockHash *BlockHash
+		signature *bls.Signature
+	}{
+		{metadata.FirstBlockHash, metadata.FirstVoteSignature},
+		{metadata.SecondBlockHash, metadata.SecondVoteSignature},
+	} {
+		if vote.signature == nil {
+			return errors.Wrapf(RuleErrorSlashValidatorInvalidVoteSignature, "UtxoView.IsValidSlashValidatorMetadata: ")
+		}
+		isValidSignature, err := BLSVerifyValidatorVote(
+			metadata.View, vote.blockHash, vote.signature, validatorEntry.VotingPublicKey,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "UtxoView.IsValidSlashValidatorMetadata: problem verifying vote signature: ")
+		}
+		if !isValidSignature {
+			return errors.Wrapf(RuleErrorSlashValidatorInvalidVoteSignature, "UtxoView.IsValidSlashValidatorMetadata: ")
+		}
+	}
+
+	// Validate the view is in the current epoch.
+	currentEpochEntry, err := bav.GetCurrentEpochEntry()
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.IsValidSlashValidatorMetadata: error retrieving CurrentEpochEntry: ")
+	}
+	if metadata.View < currentEpochEntry.InitialView {
+		return errors.Wrapf(RuleErrorSlashValidatorViewBeforeCurrentEpoch, "UtxoView.IsValidSlashValidatorMetadata: ")
+	}
+
+	// Validate the validator hasn't been slashed for this view or a later one.
+	if metadata.View <= validatorEntry.LastSlashedAtView {
+		return errors.Wrapf(RuleErrorSlashValidatorAlreadySlashed, "UtxoView.IsValidSlashValidatorMetadata: ")
+	}
+
+	return nil
+}
+
+// computeSlashedAmountNanos returns the share of amountNanos that's burned by a slash of
+// slashBasisPoints, rounded down.
+func computeSlashedAmountNanos(amountNanos *uint256.Int, slashBasisPoints uint64) (*uint256.Int, error) {
+	if slashBasisPoints > MaxBasisPoints {
+		return nil, fmt.Errorf("computeSlashedAmountNanos: slash %d exceeds MaxBasisPoints", slashBasisPoints)
+	}
+	slashedAmountNanos, err := SafeUint256().Mul(amountNanos, uint256.NewInt().SetUint64(slashBasisPoints))
+	if err != nil {
+		return nil, errors.Wrapf(err, "computeSlashedAmountNanos: ")
+	}
+	return uint256.NewInt().Div(slashedAmountNanos, uint256.NewInt().SetUint64(MaxBasisPoints)), nil
+}
+
+//
+// CONSTANTS
+//
+
+const RuleErrorSlashValidatorBeforeBlockHeight RuleError = "RuleErrorSlashValidatorBeforeBlockHeight"
+const RuleErrorSlashValidatorMissingBlockHash RuleError = "RuleErrorSlashValidatorMissingBlockHash"
+const RuleErrorSlashValidatorSameBlockHash RuleError = "RuleErrorSlashValidatorSameBlockHash"
+const RuleErrorSlashValidatorInvalidVoteSignature RuleError = "RuleErrorSlashValidatorInvalidVoteSignature"
+const RuleErrorSlashValidatorViewBeforeCurrentEpoch RuleError = "RuleErrorSlashValidatorViewBeforeCurrentEpoch"
+const RuleErrorSlashValidatorAlreadySlashed RuleError = "RuleErrorSlashValidatorAlreadySlashed"
@@ -0,0 +1,371 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/core/consensus"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlashValidator(t *testing.T) {
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	t.Run("flushToDB=false", func(t *testing.T) {
+		_testSlashValidator(t, false)
+	})
+	t.Run("flushToDB=true", func(t *testing.T) {
+		_testSlashValidator(t, true)
+	})
+}
+
+func _testSlashValidator(t *testing.T, flushToDB bool) {
+	var err error
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	// Initialize PoS and slashing fork heights.
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = uint32(1)
+	params.ForkHeights.ValidatorSlashingBlockHeight = uint32(1)
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	chain.snapshot = nil
+
+	utxoView := func() *UtxoView {
+		newUtxoView, err := mempool.GetAugmentedUniversalView()
+		require.NoError(t, err)
+		return newUtxoView
+	}
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	blockHeight := uint64(chain.blockTip().Height + 1)
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       uint32(blockHeight),
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e4)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 1e4)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+
+	// Seed a CurrentEpochEntry.
+	epochUtxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	epochUtxoView._setCurrentEpochEntry(&EpochEntry{EpochNumber: 1, FinalBlockHeight: blockHeight + 10})
+	require.NoError(t, epochUtxoView.FlushToDb(blockHeight))
+	currentEpochNumber, err := utxoView().GetCurrentEpochNumber()
+	require.NoError(t, err)
+
+	var prevGlobalParamsEntry *GlobalParamsEntry
+	{
+		// RuleErrorValidatorSlashBasisPointsTooHigh
+		params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(
+			t, chain, db, params, testMeta.feeRateNanosPerKb, paramUpdaterPub, paramUpdaterPriv,
+			-1, int64(testMeta.feeRateNanosPerKb), -1, -1, -1, -1,
+			map[string][]byte{ValidatorSlashBasisPointsKey: UintToBuf(MaxBasisPoints + 1)},
+			true, mempool,
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorSlashBasisPointsTooHigh)
+	}
+	{
+		// ParamUpdater sets ValidatorSlashBasisPoints=1000, i.e. 10%.
+		_updateGlobalParamsEntryWithExtraData(
+			testMeta,
+			testMeta.feeRateNanosPerKb,
+			paramUpdaterPub,
+			paramUpdaterPriv,
+			map[string][]byte{ValidatorSlashBasisPointsKey: UintToBuf(1000)},
+		)
+
+		// The update is flushed to the db, so reload the GlobalParamsEntry into the mempool's views.
+		prevGlobalParamsEntry = mempool.universalUtxoView.GlobalParamsEntry
+		mempool.universalUtxoView.GlobalParamsEntry = DbGetGlobalParamsEntry(db, chain.snapshot)
+		mempool.readOnlyUtxoView.GlobalParamsEntry = DbGetGlobalParamsEntry(db, chain.snapshot)
+		require.Equal(t, utxoView().GetCurrentGlobalParamsEntry().ValidatorSlashBasisPoints, uint64(1000))
+	}
+
+	// m0 registers as a validator with a voting key we can sign votes with.
+	votingPrivateKey, votingPublicKey, votingAuthorization := _generateVotingPrivateKeyPublicKeyAndAuthorization(
+		t, m0PkBytes,
+	)
+	{
+		registerMetadata := &RegisterAsValidatorMetadata{
+			Domains:             [][]byte{[]byte("example.com:18000")},
+			VotingPublicKey:     votingPublicKey,
+			VotingAuthorization: votingAuthorization,
+		}
+		_, err = _submitRegisterAsValidatorTxn(testMeta, m0Pub, m0Priv, registerMetadata, nil, flushToDB)
+		require.NoError(t, err)
+	}
+	{
+		// m0 stakes 600 with itself, and m1 stakes 200 with m0 and unstakes 100 of it.
+		_, err = _submitStakeTxn(testMeta, m0Pub, m0Priv, &StakeMetadata{
+			ValidatorPublicKey: NewPublicKey(m0PkBytes),
+			StakeAmountNanos:   uint256.NewInt().SetUint64(600),
+		}, nil, flushToDB)
+		require.NoError(t, err)
+		_, err = _submitStakeTxn(testMeta, m1Pub, m1Priv, &StakeMetadata{
+			ValidatorPublicKey: NewPublicKey(m0PkBytes),
+			StakeAmountNanos:   uint256.NewInt().SetUint64(200),
+		}, nil, flushToDB)
+		require.NoError(t, err)
+		_, err = _submitUnstakeTxn(testMeta, m1Pub, m1Priv, &UnstakeMetadata{
+			ValidatorPublicKey: NewPublicKey(m0PkBytes),
+			UnstakeAmountNanos: uint256.NewInt().SetUint64(100),
+		}, nil, flushToDB)
+		require.NoError(t, err)
+
+		validatorEntry, err := utxoView().GetValidatorByPKID(m0PKID)
+		require.NoError(t, err)
+		require.Equal(t, validatorEntry.TotalStakeAmountNanos, uint256.NewInt().SetUint64(700))
+	}
+
+	// m0 votes for two different blocks in the same view.
+	view := uint64(5)
+	firstBlockHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	secondBlockHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	signVote := func(privateKey *bls.PrivateKey, view uint64, blockHash *BlockHash) *bls.Signature {
+		payload := consensus.GetVoteSignaturePayload(view, blockHash)
+		signature, err := privateKey.Sign(payload[:])
+		require.NoError(t, err)
+		return signature
+	}
+	slashMetadata := &SlashValidatorMetadata{
+		ValidatorPublicKey:  NewPublicKey(m0PkBytes),
+		View:                view,
+		FirstBlockHash:      firstBlockHash,
+		FirstVoteSignature:  signVote(votingPrivateKey, view, firstBlockHash),
+		SecondBlockHash:     secondBlockHash,
+		SecondVoteSignature: signVote(votingPrivateKey, view, secondBlockHash),
+	}
+
+	{
+		// The metadata round-trips through its encoding.
+		metadataBytes, err := slashMetadata.ToBytes(false)
+		require.NoError(t, err)
+		decodedMetadata := &SlashValidatorMetadata{}
+		require.NoError(t, decodedMetadata.FromBytes(metadataBytes))
+		require.Equal(t, slashMetadata.ValidatorPublicKey, decodedMetadata.ValidatorPublicKey)
+		require.Equal(t, slashMetadata.View, decodedMetadata.View)
+		require.Equal(t, slashMetadata.FirstBlockHash, decodedMetadata.FirstBlockHash)
+		require.True(t, slashMetadata.FirstVoteSignature.Eq(decodedMetadata.FirstVoteSignature))
+		require.Equal(t, slashMetadata.SecondBlockHash, decodedMetadata.SecondBlockHash)
+		require.True(t, slashMetadata.SecondVoteSignature.Eq(decodedMetadata.SecondVoteSignature))
+	}
+	{
+		// RuleErrorInvalidValidatorPKID
+		invalidMetadata := *slashMetadata
+		invalidMetadata.ValidatorPublicKey = NewPublicKey(m1PkBytes)
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, &invalidMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorInvalidValidatorPKID)
+	}
+	{
+		// RuleErrorSlashValidatorSameBlockHash
+		invalidMetadata := *slashMetadata
+		invalidMetadata.SecondBlockHash = firstBlockHash
+		invalidMetadata.SecondVoteSignature = slashMetadata.FirstVoteSignature
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, &invalidMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSlashValidatorSameBlockHash)
+	}
+	{
+		// RuleErrorSlashValidatorInvalidVoteSignature: a vote signed by a different key.
+		otherPrivateKey, err := bls.NewPrivateKey()
+		require.NoError(t, err)
+		invalidMetadata := *slashMetadata
+		invalidMetadata.SecondVoteSignature = signVote(otherPrivateKey, view, secondBlockHash)
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, &invalidMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSlashValidatorInvalidVoteSignature)
+	}
+	{
+		// RuleErrorSlashValidatorInvalidVoteSignature: votes signed for a different view.
+		invalidMetadata := *slashMetadata
+		invalidMetadata.View = view + 1
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, &invalidMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSlashValidatorInvalidVoteSignature)
+	}
+	{
+		// RuleErrorSlashValidatorBeforeBlockHeight. The encoder migration heights are left alone
+		// so that the entries already stored with the migration can still be read.
+		params.ForkHeights.ValidatorSlashingBlockHeight = math.MaxUint32
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, slashMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSlashValidatorBeforeBlockHeight)
+		params.ForkHeights.ValidatorSlashingBlockHeight = uint32(1)
+	}
+	{
+		// m2 slashes m0. 10% of m0's own stake, m1's delegated stake, and m1's locked stake is burned.
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, slashMetadata, flushToDB)
+		require.NoError(t, err)
+
+		validatorEntry, err := utxoView().GetValidatorByPKID(m0PKID)
+		require.NoError(t, err)
+		require.Equal(t, validatorEntry.TotalStakeAmountNanos, uint256.NewInt().SetUint64(630))
+		require.Equal(t, validatorEntry.Status(), ValidatorStatusJailed)
+		require.Equal(t, validatorEntry.JailedAtEpochNumber, currentEpochNumber)
+		require.Equal(t, validatorEntry.LastSlashedAtView, view)
+
+		stakeEntry, err := utxoView().GetStakeEntry(m0PKID, m0PKID)
+		require.NoError(t, err)
+		require.Equal(t, stakeEntry.StakeAmountNanos, uint256.NewInt().SetUint64(540))
+
+		stakeEntry, err = utxoView().GetStakeEntry(m0PKID, m1PKID)
+		require.NoError(t, err)
+		require.Equal(t, stakeEntry.StakeAmountNanos, uint256.NewInt().SetUint64(90))
+
+		lockedStakeEntry, err := utxoView().GetLockedStakeEntry(m0PKID, m1PKID, currentEpochNumber)
+		require.NoError(t, err)
+		require.Equal(t, lockedStakeEntry.LockedAmountNanos, uint256.NewInt().SetUint64(90))
+
+		// The burned stake is recorded for the emission index.
+		utxoOps := testMeta.txnOps[len(testMeta.txnOps)-1]
+		require.Equal(t, utxoOps[len(utxoOps)-1].StakeAmountNanosDiff, uint64(80))
+		emissionIndexEntry := &EmissionIndexEntry{}
+		require.NoError(t, _addEmissionForUtxoOps(emissionIndexEntry, utxoOps))
+		require.Equal(t, emissionIndexEntry.BurnedNanos, uint64(80))
+	}
+	{
+		// RuleErrorSlashValidatorAlreadySlashed: the same evidence can't be used twice.
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, slashMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSlashValidatorAlreadySlashed)
+
+		// Nor can evidence from an earlier view.
+		earlierView := view - 1
+		earlierMetadata := *slashMetadata
+		earlierMetadata.View = earlierView
+		earlierMetadata.FirstVoteSignature = signVote(votingPrivateKey, earlierView, firstBlockHash)
+		earlierMetadata.SecondVoteSignature = signVote(votingPrivateKey, earlierView, secondBlockHash)
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, &earlierMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSlashValidatorAlreadySlashed)
+	}
+	{
+		// m0 double votes again in a later view and is slashed again, while jailed.
+		laterView := view + 1
+		laterMetadata := *slashMetadata
+		laterMetadata.View = laterView
+		laterMetadata.FirstVoteSignature = signVote(votingPrivateKey, laterView, firstBlockHash)
+		laterMetadata.SecondVoteSignature = signVote(votingPrivateKey, laterView, secondBlockHash)
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, &laterMetadata, flushToDB)
+		require.NoError(t, err)
+
+		validatorEntry, err := utxoView().GetValidatorByPKID(m0PKID)
+		require.NoError(t, err)
+		require.Equal(t, validatorEntry.TotalStakeAmountNanos, uint256.NewInt().SetUint64(567))
+		require.Equal(t, validatorEntry.JailedAtEpochNumber, currentEpochNumber)
+		require.Equal(t, validatorEntry.LastSlashedAtView, laterView)
+	}
+	{
+		// RuleErrorSlashValidatorViewBeforeCurrentEpoch
+		mempool.universalUtxoView.CurrentEpochEntry = nil
+		mempool.readOnlyUtxoView.CurrentEpochEntry = nil
+		epochUtxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		epochUtxoView._setCurrentEpochEntry(
+			&EpochEntry{EpochNumber: currentEpochNumber, InitialView: 100, FinalBlockHeight: blockHeight + 10},
+		)
+		require.NoError(t, epochUtxoView.FlushToDb(blockHeight))
+
+		oldView := view + 2
+		oldMetadata := *slashMetadata
+		oldMetadata.View = oldView
+		oldMetadata.FirstVoteSignature = signVote(votingPrivateKey, oldView, firstBlockHash)
+		oldMetadata.SecondVoteSignature = signVote(votingPrivateKey, oldView, secondBlockHash)
+		_, err = _submitSlashValidatorTxn(testMeta, m2Pub, m2Priv, &oldMetadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSlashValidatorViewBeforeCurrentEpoch)
+
+		// Restore the CurrentEpochEntry so the txns can be connected again below.
+		mempool.universalUtxoView.CurrentEpochEntry = nil
+		mempool.readOnlyUtxoView.CurrentEpochEntry = nil
+		epochUtxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		epochUtxoView._setCurrentEpochEntry(&EpochEntry{EpochNumber: currentEpochNumber, FinalBlockHeight: blockHeight + 10})
+		require.NoError(t, epochUtxoView.FlushToDb(blockHeight))
+	}
+
+	// Flush mempool to the db and test rollbacks, which restore the slashed stake.
+	// The mempool's views go back to the GlobalParamsEntry they had before the txns.
+	require.NoError(t, mempool.universalUtxoView.FlushToDb(blockHeight))
+	mempool.universalUtxoView.GlobalParamsEntry = prevGlobalParamsEntry
+	mempool.readOnlyUtxoView.GlobalParamsEntry = prevGlobalParamsEntry
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func _submitSlashValidatorTxn(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *SlashValidatorMetadata,
+	flushToDB bool,
+) (_fees uint64, _err error) {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, testMeta.mempool, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, changeAmountMake, feesMake, err := testMeta.chain.CreateSlashValidatorTxn(
+		transactorPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		testMeta.mempool,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return 0, err
+	}
+	require.Equal(testMeta.t, totalInputMake, changeAmountMake+feesMake)
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	utxoOps, totalInput, totalOutput, fees, err := testMeta.mempool.universalUtxoView.ConnectTransaction(
+		txn, txn.Hash(), testMeta.savedHeight, 0, true, false)
+	if err != nil {
+		return 0, err
+	}
+	require.Equal(testMeta.t, totalInput, totalOutput+fees)
+	require.Equal(testMeta.t, totalInput, totalInputMake)
+	require.Equal(testMeta.t, OperationTypeSlashValidator, utxoOps[len(utxoOps)-1].Type)
+	if flushToDB {
+		require.NoError(testMeta.t, testMeta.mempool.universalUtxoView.FlushToDb(uint64(testMeta.savedHeight)))
+	}
+	require.NoError(testMeta.t, testMeta.mempool.RegenerateReadOnlyView())
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return fees, nil
+}
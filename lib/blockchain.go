@@ -533,6 +533,9 @@ type Blockchain struct {
 	MaxSyncBlockHeight              uint32
 	params                          *DeSoParams
 	eventManager                    *EventManager
+	// storageBackend is the third-party backend the chain's views and DbAdapters read from.
+	// It's nil if the node reads from the built-in badger and Postgres backends.
+	storageBackend StorageBackend
 
 	// Archival mode determines if we'll be downloading historical blocks after finishing hypersync.
 	// It is turned off by default, meaning we won't be downloading blocks prior to the first snapshot
@@ -598,6 +601,10 @@ type Blockchain struct {
 	checkpointBlockInfoLock sync.RWMutex
 
 	timer *Timer
+
+	// utxoOpsPruner is set on nodes that prune the UtxoOperations of old blocks, which can't
+	// reorg more blocks than its depth. See utxo_ops_pruner.go.
+	utxoOpsPruner *UtxoOpsPruner
 }
 
 func (bc *Blockchain) getHighestCheckpointView() uint64 {
@@ -837,7 +844,15 @@ func (bc *Blockchain) _initChain() error {
 	if bc.postgres != nil {
 		bc.blockIndexByHash, err = bc.postgres.GetBlockIndex()
 	} else {
-		bc.blockIndexByHash, err = GetBlockIndex(bc.db, false /*bitcoinNodes*/, bc.params)
+		// If the node has a saved block index, load that instead of reading every block
+		// node. It's only used if it matches the db.
+		bc.blockIndexByHash, err = LoadBlockIndexCache(bc.db, bestBlockHash, bc.params)
+		if err != nil {
+			glog.Warningf("_initChain: Not using the saved block index: %v", err)
+		}
+		if bc.blockIndexByHash == nil {
+			bc.blockIndexByHash, err = GetBlockIndex(bc.db, false /*bitcoinNodes*/, bc.params)
+		}
 	}
 	if err != nil {
 		return errors.Wrapf(err, "_initChain: Problem reading block index from db")
@@ -954,6 +969,7 @@ func NewBlockchain(
 	timeSource chainlib.MedianTimeSource,
 	db *badger.DB,
 	postgres *Postgres,
+	storageBackend StorageBackend,
 	eventManager *EventManager,
 	snapshot *Snapshot,
 	archivalMode bool,
@@ -976,6 +992,7 @@ func NewBlockchain(
 	bc := &Blockchain{
 		db:                              db,
 		postgres:                        postgres,
+		storageBackend:                  storageBackend,
 		snapshot:                        snapshot,
 		timeSource:                      timeSource,
 		trustedBlockProducerPublicKeys:  trustedBlockProducerPublicKeys,
@@ -1011,6 +1028,18 @@ func NewBlockchain(
 		return nil, errors.Wrapf(err, "NewBlockchain: ")
 	}
 
+	// Build the DAO coin holder index if the db was created before it existed. Postgres nodes
+	// keep their balance entries in Postgres, so they don't need it.
+	if postgres == nil {
+		if err := DbBuildDAOCoinHolderIndexIfMissing(db); err != nil {
+			return nil, errors.Wrapf(err, "NewBlockchain: ")
+		}
+	}
+	// Likewise for the staker indexes. Stake entries are always kept in badger.
+	if err := DbBuildStakerIndexesIfMissing(db); err != nil {
+		return nil, errors.Wrapf(err, "NewBlockchain: ")
+	}
+
 	// Update the best chain and best header chain to include uncommitted blocks.
 	if err := bc._applyUncommittedBlocksToBestChain(); err != nil {
 		return nil, errors.Wrapf(err, "NewBlockchain: ")
@@ -2553,7 +2582,7 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		// almost certainly be more efficient than doing a separate db call for each input
 		// and output.
 		if bc.blockView == nil {
-			bc.blockView = NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+			bc.blockView = bc.NewUtxoView()
 		}
 
 		// Preload the view with almost all of the data it will need to connect the block
@@ -2658,6 +2687,8 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		if err != nil {
 			return false, false, errors.Wrapf(err, "ProcessBlock: Problem writing block info to db on simple add to tip")
 		}
+		// Now that the flush has committed, let the flush hooks know.
+		bc.eventManager.utxoViewFlushCommitted()
 
 		// Now that we've set the best chain in the db, update our in-memory data
 		// structure to reflect this. Do a quick check first to make sure it's consistent.
@@ -2744,6 +2775,11 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 				"block (%v) at height (%d) to block (%v) at height of (%d)",
 				numBlocks, currentTip, currentTip.Height, nodeToValidate, nodeToValidate.Height)
 		}
+		// A node that prunes UtxoOperations can't disconnect blocks past its prune depth.
+		if bc.utxoOpsPruner != nil && uint64(numBlocks) > bc.utxoOpsPruner.GetDepth() {
+			return false, false, fmt.Errorf("ProcessBlock: Reorg of (%d) blocks to block (%v) is deeper "+
+				"than the UtxoOperations prune depth (%d)", numBlocks, nodeToValidate, bc.utxoOpsPruner.GetDepth())
+		}
 
 		// Create an empty view referencing the current tip.
 		//
@@ -2752,7 +2788,7 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		// the txns to account for txns that spend previous txns in the block, but it would
 		// almost certainly be more efficient than doing a separate db call for each input
 		// and output
-		utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+		utxoView := bc.NewUtxoView()
 
 		// Verify that the utxo view is pointing to the current tip.
 		if *utxoView.TipHash != *currentTip.Hash {
@@ -2764,6 +2800,7 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		// shouldn't encounter any errors but if we do, return without marking the
 		// block as invalid.
 		var blocksToDetach []*MsgDeSoBlock
+		var utxoOpsForDetachBlocks [][][]*UtxoOperation
 		for _, nodeToDetach := range detachBlocks {
 			// Fetch the utxo operations for the block we're detaching. We need these
 			// in order to be able to detach the block.
@@ -2773,6 +2810,7 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 					"utxo operations during detachment of block (%v) "+
 					"in reorg", nodeToDetach)
 			}
+			utxoOpsForDetachBlocks = append(utxoOpsForDetachBlocks, utxoOps)
 
 			// Fetch the block itself since we need some info from it to roll
 			// it back.
@@ -2937,6 +2975,8 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		if err != nil {
 			return false, false, errors.Errorf("ProcessBlock: Problem updating: %v", err)
 		}
+		// Now that the flush has committed, let the flush hooks know.
+		bc.eventManager.utxoViewFlushCommitted()
 
 		// Now the db has been updated, update our in-memory best chain. Note that there
 		// is no need to update the node index because it was updated as we went along.
@@ -2963,9 +3003,10 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 
 			// If we have a Server object then call its function
 			if bc.eventManager != nil {
-				// FIXME: We need to add the UtxoOps here to handle reorgs properly in Rosetta
-				// For now it's fine because reorgs are virtually impossible.
-				bc.eventManager.blockDisconnected(&BlockEvent{Block: blockToDetach})
+				bc.eventManager.blockDisconnected(&BlockEvent{
+					Block:   blockToDetach,
+					UtxoOps: utxoOpsForDetachBlocks[ii],
+				})
 			}
 		}
 		for ii, attachNode := range attachBlocks {
@@ -3037,7 +3078,7 @@ func (bc *Blockchain) ValidateTransaction(
 
 	// Create a new UtxoView. If we have access to a mempool object, use it to
 	// get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 
 	if !isInterfaceValueNil(mempool) {
 		var err error
@@ -3134,22 +3175,30 @@ func ComputeMerkleRoot(txns []*MsgDeSoTxn) (_merkle *BlockHash, _txHashes []*Blo
 	return rootHash, txHashes, nil
 }
 
-func (bc *Blockchain) GetSpendableUtxosForPublicKey(spendPublicKeyBytes []byte, mempool Mempool, referenceUtxoView *UtxoView) ([]*UtxoEntry, error) {
-	// If we have access to a mempool, use it to account for utxos we might not
-	// get otherwise.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
-	// Use the reference UtxoView if provided. Otherwise try to get one from the mempool.
-	// This improves efficiency when we have a UtxoView already handy.
+// getUtxoViewForPublicKey returns the reference UtxoView if provided. Otherwise it tries to get
+// one from the mempool, so that we account for utxos we might not get otherwise.
+func (bc *Blockchain) getUtxoViewForPublicKey(publicKeyBytes []byte, mempool Mempool, referenceUtxoView *UtxoView) (*UtxoView, error) {
+	// Using the reference UtxoView improves efficiency when we have one already handy.
 	if referenceUtxoView != nil {
-		utxoView = referenceUtxoView
-	} else {
-		if !isInterfaceValueNil(mempool) {
-			var err error
-			utxoView, err = mempool.GetAugmentedUtxoViewForPublicKey(spendPublicKeyBytes, nil)
-			if err != nil {
-				return nil, errors.Wrapf(err, "Blockchain.GetSpendableUtxosForPublicKey: Problem getting augmented UtxoView from mempool: ")
-			}
+		return referenceUtxoView, nil
+	}
+	if !isInterfaceValueNil(mempool) {
+		utxoView, err := mempool.GetAugmentedUtxoViewForPublicKey(publicKeyBytes, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Blockchain.getUtxoViewForPublicKey: Problem getting augmented UtxoView from mempool: ")
 		}
+		return utxoView, nil
+	}
+	return bc.NewUtxoView(), nil
+}
+
+// GetSpendableUtxosForPublicKey returns the utxos the public key can spend in the next block.
+// Block rewards that haven't matured yet and utxos already spent by the mempool are left out.
+// Use GetBlockRewardMaturityBalanceForPublicKey to see the block rewards that are left out.
+func (bc *Blockchain) GetSpendableUtxosForPublicKey(spendPublicKeyBytes []byte, mempool Mempool, referenceUtxoView *UtxoView) ([]*UtxoEntry, error) {
+	utxoView, err := bc.getUtxoViewForPublicKey(spendPublicKeyBytes, mempool, referenceUtxoView)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Blockchain.GetSpendableUtxosForPublicKey: ")
 	}
 
 	// Get unspent utxos from the view.
@@ -3917,7 +3966,7 @@ func (bc *Blockchain) CreateDAOCoinLimitOrderTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use it to
 	// get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	var err error
 	if !isInterfaceValueNil(mempool) {
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -3940,8 +3989,26 @@ func (bc *Blockchain) CreateDAOCoinLimitOrderTxn(
 	blockHeight := bc.blockTip().Height + 1
 	var transactorOrder *DAOCoinLimitOrderEntry
 
-	if metadata.CancelOrderID == nil {
-		// CancelOrderID is nil, so we know we're submitting a new order.
+	if metadata.PlacesOrder() {
+		// If we're replacing an order, remove it from our view so the new order
+		// doesn't match against it, mirroring what happens when the txn connects.
+		if metadata.CancelOrderID != nil {
+			transactorPKIDEntry := utxoView.GetPKIDForPublicKey(UpdaterPublicKey)
+			if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+				return nil, 0, 0, 0, fmt.Errorf(
+					"Blockchain.CreateDAOCoinLimitOrderTxn: No PKID found for public key %v",
+					PkToStringBoth(UpdaterPublicKey))
+			}
+			var orderToReplace *DAOCoinLimitOrderEntry
+			orderToReplace, err = utxoView._getDAOCoinLimitOrderToCancel(
+				transactorPKIDEntry.PKID, metadata.CancelOrderID, blockHeight)
+			if err != nil {
+				return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateDAOCoinLimitOrderTxn: ")
+			}
+			utxoView._deleteDAOCoinLimitOrderEntryMappings(orderToReplace)
+		}
+
+		// We know we're submitting a new order.
 		transactorOrder, err = utxoView.ConvertTxnToDAOCoinLimitOrderEntry(txn, blockHeight)
 		if err != nil {
 			return nil, 0, 0, 0, errors.Wrapf(
@@ -3952,7 +4019,7 @@ func (bc *Blockchain) CreateDAOCoinLimitOrderTxn(
 
 	// We use "explicitSpend" to track how much we need to spend to cover the transactor's bid in DESO.
 	var explicitSpend uint64
-	if metadata.CancelOrderID == nil &&
+	if metadata.PlacesOrder() &&
 		metadata.BuyingDAOCoinCreatorPublicKey.IsZeroPublicKey() {
 		// If buying $DESO, we need to find inputs from all the orders that match.
 		// This will move to txn construction as this will be put in the metadata.
@@ -3983,18 +4050,28 @@ func (bc *Blockchain) CreateDAOCoinLimitOrderTxn(
 
 				// Transactor is buying $DESO so matching order is selling $DESO.
 				// Calculate updated order quantities and coins exchanged.
+				var updatedTransactorQuantityToFill *uint256.Int
+				var updatedMatchingOrderQuantityToFill *uint256.Int
 				var desoNanosExchanged *uint256.Int
 
-				transactorQuantityToFill,
-					_, // matching order updated quantity, not used here
+				updatedTransactorQuantityToFill,
+					updatedMatchingOrderQuantityToFill,
 					desoNanosExchanged,
 					_, // dao coin nanos exchanged, not used here
 					err = _calculateDAOCoinsTransferredInLimitOrderMatch(
-					matchingOrder, transactorOrder.OperationType, transactorQuantityToFill)
+					matchingOrder, transactorOrder.GetQuantityOperationType(), transactorQuantityToFill)
 				if err != nil {
 					return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateDAOCoinLimitOrderTxn: ")
 				}
 
+				// Skip if the match would be below either order's minimum fill quantity.
+				if transactorOrder.IsBelowMinFillQuantity(transactorQuantityToFill, updatedTransactorQuantityToFill) ||
+					matchingOrder.IsBelowMinFillQuantity(
+						matchingOrder.QuantityToFillInBaseUnits, updatedMatchingOrderQuantityToFill) {
+					continue
+				}
+				transactorQuantityToFill = updatedTransactorQuantityToFill
+
 				// Check for overflow in $DESO exchanged.
 				if !desoNanosExchanged.IsUint64() {
 					return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateDAOCoinLimitOrderTxn: order cost overflows $DESO")
@@ -4055,7 +4132,7 @@ func (bc *Blockchain) CreateDAOCoinLimitOrderTxn(
 				metadata.BidderInputs = append(metadata.BidderInputs, &inputsByTransactor)
 			}
 		}
-	} else if metadata.CancelOrderID == nil &&
+	} else if metadata.PlacesOrder() &&
 		metadata.SellingDAOCoinCreatorPublicKey.IsZeroPublicKey() {
 		explicitSpend, err = utxoView.GetDESONanosToFillOrder(transactorOrder, blockHeight)
 		if err != nil {
@@ -4253,7 +4330,7 @@ func (bc *Blockchain) CreateNFTBidTxn(
 				"CreateNFTBidTxn: Problem getting augmented universal view: ")
 		}
 	} else {
-		utxoView = NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+		utxoView = bc.NewUtxoView()
 	}
 
 	nftKey := MakeNFTKey(NFTPostHash, SerialNumber)
@@ -4264,7 +4341,8 @@ func (bc *Blockchain) CreateNFTBidTxn(
 			"_computeInputsForTxn: nftEntry is deleted")
 	}
 	var explicitSpend uint64
-	if nftEntry != nil && nftEntry.IsBuyNow && nftEntry.BuyNowPriceNanos <= BidAmountNanos {
+	if nftEntry != nil && nftEntry.IsBuyNow &&
+		nftEntry.GetBuyNowPriceNanos(uint64(bc.blockTip().Height)+1) <= BidAmountNanos {
 		explicitSpend = BidAmountNanos
 	}
 
@@ -4420,7 +4498,7 @@ func (bc *Blockchain) CreateAcceptNFTBidTxn(
 
 	// Create a new UtxoView. If we have access to a mempool object, use it to
 	// get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	var err error
 	if !isInterfaceValueNil(mempool) {
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -4729,7 +4807,7 @@ func (bc *Blockchain) CreateCreatorCoinTransferTxnWithDiamonds(
 
 	// Create a new UtxoView. If we have access to a mempool object, use it to
 	// get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	var err error
 	if !isInterfaceValueNil(mempool) {
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -4902,6 +4980,88 @@ func (bc *Blockchain) CreateAuthorizeDerivedKeyTxn(
 	return txn, totalInput, changeAmount, fees, nil
 }
 
+// CreateExtendDerivedKeyTxn creates an AuthorizeDerivedKey txn that extends an existing derived
+// key to a new expiration block. The accessSignature is the owner's signature of
+// AssembleDerivedKeyExtensionAccessBytes for the key's current expiration block, and is only
+// required when the txn will be signed by the derived key.
+func (bc *Blockchain) CreateExtendDerivedKeyTxn(
+	ownerPublicKey []byte,
+	derivedPublicKey []byte,
+	expirationBlock uint64,
+	accessSignature []byte,
+	derivedKeySignature bool,
+	extraData map[string][]byte,
+	// Standard transaction fields
+	minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	blockHeight := bc.blockTip().Height + 1
+	if blockHeight < bc.params.ForkHeights.DerivedKeyExtensionBlockHeight {
+		return nil, 0, 0, 0, RuleErrorAuthorizeDerivedKeyExtendBeforeBlockHeight
+	}
+	if derivedKeySignature {
+		// The access signature is bound to the key's current expiration block, so look it up
+		// in a view that factors in pending transactions if we have a mempool.
+		utxoView := bc.NewUtxoView()
+		var err error
+		if !isInterfaceValueNil(mempool) {
+			utxoView, err = mempool.GetAugmentedUniversalView()
+			if err != nil {
+				return nil, 0, 0, 0, errors.Wrapf(err,
+					"Blockchain.CreateExtendDerivedKeyTxn: Problem getting augmented UtxoView from mempool: ")
+			}
+		}
+		derivedKeyEntry := utxoView.GetDerivedKeyMappingForOwner(ownerPublicKey, derivedPublicKey)
+		if derivedKeyEntry == nil || derivedKeyEntry.isDeleted {
+			return nil, 0, 0, 0, RuleErrorAuthorizeDerivedKeyExtendNonExistentDerivedKey
+		}
+		if err = _verifyDerivedKeyExtensionAccessSignature(ownerPublicKey, derivedPublicKey,
+			derivedKeyEntry.ExpirationBlock, expirationBlock, accessSignature, blockHeight, bc.params); err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(err,
+				"Blockchain.CreateExtendDerivedKeyTxn: Problem verifying access signature")
+		}
+	}
+	if expirationBlock <= uint64(blockHeight) {
+		return nil, 0, 0, 0, fmt.Errorf(
+			"Blockchain.CreateExtendDerivedKeyTxn: Expiration block %d has already passed", expirationBlock)
+	}
+
+	derivedKeyExtraData := make(map[string][]byte)
+	if derivedKeySignature {
+		derivedKeyExtraData[DerivedPublicKey] = derivedPublicKey
+	}
+	// Delete protected keys
+	if extraData != nil {
+		delete(extraData, DerivedPublicKey)
+		delete(extraData, DerivedKeyMemoKey)
+		delete(extraData, TransactionSpendingLimitKey)
+	}
+
+	txn := &MsgDeSoTxn{
+		PublicKey: ownerPublicKey,
+		TxnMeta: &AuthorizeDerivedKeyMetadata{
+			DerivedPublicKey: derivedPublicKey,
+			ExpirationBlock:  expirationBlock,
+			OperationType:    AuthorizeDerivedKeyOperationExtend,
+			AccessSignature:  accessSignature,
+		},
+		TxOutputs: additionalOutputs,
+		ExtraData: mergeExtraData(extraData, derivedKeyExtraData),
+	}
+
+	totalInput, spendAmount, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateExtendDerivedKeyTxn: Problem adding inputs: ")
+	}
+	if spendAmount != 0 {
+		return nil, 0, 0, 0, fmt.Errorf("CreateExtendDerivedKeyTxn: Spend amount "+
+			"should be zero but was %d instead: ", spendAmount)
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
 func (bc *Blockchain) CreateMessagingKeyTxn(
 	senderPublicKey []byte,
 	messagingPublicKey []byte,
@@ -4953,7 +5113,7 @@ func (bc *Blockchain) CreateBasicTransferTxnWithDiamonds(
 
 	// Create a new UtxoView. If we have access to a mempool object, use it to
 	// get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	var err error
 	if !isInterfaceValueNil(mempool) {
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -5061,7 +5221,7 @@ func (bc *Blockchain) CreateMaxSpend(
 					"Blockchain.CreateMaxSpend: Problem getting augmented UtxoView from mempool: ")
 			}
 		} else {
-			utxoView = NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+			utxoView = bc.NewUtxoView()
 		}
 		spendableBalance, err := utxoView.GetSpendableDeSoBalanceNanosForPublicKey(
 			senderPkBytes, bc.BlockTip().Height)
@@ -5198,7 +5358,7 @@ func (bc *Blockchain) AddInputsAndChangeToTransactionWithSubsidy(
 
 		txArg.TxnVersion = 1
 
-		utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+		utxoView := bc.NewUtxoView()
 		var err error
 		txArg.TxnNonce, err = utxoView.ConstructNonceForPublicKey(txArg.PublicKey, uint64(blockHeight))
 		if err != nil {
@@ -5324,8 +5484,9 @@ func (bc *Blockchain) AddInputsAndChangeToTransactionWithSubsidy(
 		return 0, 0, 0, 0, fmt.Errorf("AddInputsAndChangeToTransaction: Sanity check failed: Total "+
 			"input %d is not sufficient to "+
 			"cover the spend amount (=%d) plus the fee (=%d, feerate=%d, txsize=%d), "+
-			"total=%d", totalInput, spendAmount, maxFeeWithMaxChange, minFeeRateNanosPerKB,
-			_computeMaxTxSize(finalTxCopy), spendAmount+maxFeeWithMaxChange)
+			"total=%d.%s", totalInput, spendAmount, maxFeeWithMaxChange, minFeeRateNanosPerKB,
+			_computeMaxTxSize(finalTxCopy), spendAmount+maxFeeWithMaxChange,
+			bc._describeImmatureBlockRewards(spendPublicKeyBytes, mempool))
 	}
 
 	// Now that we know the input will cover the spend amount plus the fee, add
@@ -5396,7 +5557,7 @@ func (bc *Blockchain) EstimateDefaultFeeRateNanosPerKB(
 
 	// If the block is more than X% full, use the maximum between the min
 	// fee rate and the median fees of all the transactions in the block.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	utxoOps, err := GetUtxoOperationsForBlock(bc.db, bc.snapshot, tipNode.Hash)
 	if err != nil {
 		return minFeeRateNanosPerKB
@@ -5579,7 +5740,7 @@ func (bc *Blockchain) _createAssociationTxn(
 ) {
 	// Create a new UtxoView. If we have access to a mempool object, use
 	// it to get an augmented view that factors in pending transactions.
-	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	utxoView := bc.NewUtxoView()
 	var err error
 	if !isInterfaceValueNil(mempool) {
 		utxoView, err = mempool.GetAugmentedUniversalView()
@@ -5841,6 +6002,289 @@ func (bc *Blockchain) CreateCoinUnlockTxn(
 	return txn, totalInput, 0, fees, nil
 }
 
+// CreateRegisterMultisigTxn creates a txn that sets the co-signers and threshold the owner's
+// txns require. Passing no co-signers with a zero threshold removes the owner's multisig. If
+// the owner already has a multisig, the txn must be co-signed with AddMultisigSignature
+// before it's submitted. The fee doesn't account for the co-signer signatures.
+func (bc *Blockchain) CreateRegisterMultisigTxn(
+	ownerPublicKey []byte,
+	metadata *RegisterMultisigMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	if err := ValidateRegisterMultisigMetadata(metadata, ownerPublicKey); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateRegisterMultisigTxn: ")
+	}
+
+	txn := &MsgDeSoTxn{
+		PublicKey: ownerPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateRegisterMultisigTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+// CreateDAOCoinStreamTxn creates a txn that creates, withdraws from, or cancels a DAO coin
+// stream, depending on the metadata's OperationType.
+func (bc *Blockchain) CreateDAOCoinStreamTxn(
+	transactorPublicKey []byte,
+	metadata *DAOCoinStreamMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateDAOCoinStreamTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateDAOCoinMultiTransferTxn(
+	transactorPublicKey []byte,
+	metadata *DAOCoinMultiTransferMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateDAOCoinMultiTransferTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateRoyaltySplitTxn(
+	transactorPublicKey []byte,
+	metadata *RoyaltySplitMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateRoyaltySplitTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateLeaseNFTTxn(
+	transactorPublicKey []byte,
+	metadata *LeaseNFTMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateLeaseNFTTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateEndNFTLeaseTxn(
+	transactorPublicKey []byte,
+	metadata *EndNFTLeaseMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateEndNFTLeaseTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateNFTBundleTxn(
+	transactorPublicKey []byte,
+	metadata *NFTBundleMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	// Buying a bundle spends its price on top of the fee.
+	var explicitSpend uint64
+	if metadata.OperationType == NFTBundleOperationTypeBuy {
+		explicitSpend = metadata.TotalPriceNanos
+	}
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransactionWithSubsidy(txn, minFeeRateNanosPerKB, 0, mempool, explicitSpend)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateNFTBundleTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateNFTSwapTxn(
+	transactorPublicKey []byte,
+	metadata *NFTSwapMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	// Proposing a swap escrows the proposer's DESO, and accepting one spends the
+	// counterparty's, on top of the fee.
+	var explicitSpend uint64
+	switch metadata.OperationType {
+	case NFTSwapOperationTypePropose:
+		explicitSpend = metadata.OfferedDESONanos
+	case NFTSwapOperationTypeAccept:
+		utxoView := bc.NewUtxoView()
+		var err error
+		if !isInterfaceValueNil(mempool) {
+			utxoView, err = mempool.GetAugmentedUniversalView()
+			if err != nil {
+				return nil, 0, 0, 0, errors.Wrapf(err,
+					"CreateNFTSwapTxn: Problem getting augmented UtxoView from mempool: ")
+			}
+		}
+		swapEntry, err := utxoView._getNFTSwapEntryForTxn(metadata)
+		if err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(err, "CreateNFTSwapTxn: ")
+		}
+		explicitSpend = swapEntry.RequestedDESONanos
+	}
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransactionWithSubsidy(txn, minFeeRateNanosPerKB, 0, mempool, explicitSpend)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateNFTSwapTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateCreateProposalTxn(
+	transactorPublicKey []byte,
+	metadata *CreateProposalMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	// Catch invalid proposals before the txn is built. The voting end height is checked
+	// against the next block's height when the txn is connected.
+	if err := ValidateCreateProposalMetadata(metadata, 0); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateCreateProposalTxn: ")
+	}
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateCreateProposalTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+func (bc *Blockchain) CreateCastVoteTxn(
+	transactorPublicKey []byte,
+	metadata *CastVoteMetadata,
+	// Standard transaction fields
+	extraData map[string][]byte, minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// The signature will be added once other transaction fields are finalized.
+	}
+
+	totalInput, _, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "CreateCastVoteTxn: Problem adding inputs: ")
+	}
+
+	return txn, totalInput, changeAmount, fees, nil
+}
+
 // -------------------------------------------------
 // Atomic Transaction Creation Function
 // -------------------------------------------------
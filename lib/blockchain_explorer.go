@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Block explorers mostly page through two things: the blocks on the best chain, and the txns
+// that affect a public key. The methods below serve both straight from the indexes we already
+// keep, so explorer backends don't need to walk the best chain or load a public key's whole
+// txn history themselves.
+
+const (
+	// MaxBlocksInRange is the most blocks GetBlocksInRange returns in a single call.
+	MaxBlocksInRange = 1000
+	// MaxTransactionsPerPage is the most txn hashes GetTransactionsForPublicKeyPaginated
+	// returns in a single call.
+	MaxTransactionsPerPage = 1000
+)
+
+// GetBlocksInRange returns the blocks on the best chain from startHeight to endHeight,
+// inclusive. If endHeight is past the tip, the range stops at the tip.
+func (bc *Blockchain) GetBlocksInRange(startHeight uint64, endHeight uint64) ([]*MsgDeSoBlock, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("Blockchain.GetBlocksInRange: Start height %v is greater than "+
+			"end height %v", startHeight, endHeight)
+	}
+	if endHeight-startHeight >= MaxBlocksInRange {
+		return nil, fmt.Errorf("Blockchain.GetBlocksInRange: Range from %v to %v has more "+
+			"than %v blocks", startHeight, endHeight, MaxBlocksInRange)
+	}
+
+	// Copy the nodes we need while holding the lock, and read the blocks from the db after
+	// releasing it.
+	bc.ChainLock.RLock()
+	var blockNodes []*BlockNode
+	for height := startHeight; height <= endHeight && height < uint64(len(bc.bestChain)); height++ {
+		blockNodes = append(blockNodes, bc.bestChain[height])
+	}
+	bc.ChainLock.RUnlock()
+
+	blocks := make([]*MsgDeSoBlock, 0, len(blockNodes))
+	for _, blockNode := range blockNodes {
+		block, err := GetBlock(blockNode.Hash, bc.db, bc.snapshot)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Blockchain.GetBlocksInRange: Problem fetching block "+
+				"%v at height %v", blockNode.Hash, blockNode.Height)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// GetTransactionsForPublicKeyPaginated returns up to limit hashes of txns that affect the
+// public key, newest first, along with the txindex position of the last one returned. The
+// position is the cursor for the next page: passing it as lastTxnIndex starts the page with
+// the txn indexed right before it, and a nil lastTxnIndex starts from the newest txn. The
+// returned position is nil if the page is empty. The public key's txns live in the
+// txindex, so this should be called on the txindex's Blockchain, i.e. TXIndex.TXIndexChain.
+func (bc *Blockchain) GetTransactionsForPublicKeyPaginated(
+	publicKey []byte, lastTxnIndex *uint32, limit uint64) (
+	_txnHashes []*BlockHash, _lastTxnIndex *uint32, _err error) {
+
+	if limit == 0 || limit > MaxTransactionsPerPage {
+		return nil, nil, fmt.Errorf("Blockchain.GetTransactionsForPublicKeyPaginated: Limit %v "+
+			"must be between 1 and %v", limit, MaxTransactionsPerPage)
+	}
+
+	// The public key's txns are keyed by a big-endian uint32 position, so a reverse iterator
+	// seeked to a position starts at the newest txn at or before it.
+	startIndex := uint32(math.MaxUint32)
+	if lastTxnIndex != nil {
+		if *lastTxnIndex == 0 {
+			return []*BlockHash{}, nil, nil
+		}
+		startIndex = *lastTxnIndex - 1
+	}
+
+	txnHashes := []*BlockHash{}
+	var pageLastTxnIndex *uint32
+	err := bc.db.View(func(txn *badger.Txn) error {
+		dbPrefix := DbTxindexPublicKeyPrefix(publicKey)
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.Prefix = dbPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(DbTxindexPublicKeyIndexToTxnKey(publicKey, startIndex)); it.ValidForPrefix(dbPrefix); it.Next() {
+			indexBytes := it.Item().Key()[len(dbPrefix):]
+			if len(indexBytes) != 4 {
+				return fmt.Errorf("Invalid txindex key length %v", len(indexBytes)+len(dbPrefix))
+			}
+			txnHashBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return errors.Wrapf(err, "Problem reading txn hash")
+			}
+			txnHashes = append(txnHashes, NewBlockHash(txnHashBytes))
+			index := DecodeUint32(indexBytes)
+			pageLastTxnIndex = &index
+			if uint64(len(txnHashes)) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Blockchain.GetTransactionsForPublicKeyPaginated: ")
+	}
+	return txnHashes, pageLastTxnIndex, nil
+}
@@ -0,0 +1,118 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBlocksInRange(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	bc := &Blockchain{db: db, params: &params}
+
+	// Store a best chain of five blocks.
+	for height := uint64(0); height < 5; height++ {
+		header := *expectedBlockHeaderVersion1
+		header.Height = height
+		block := &MsgDeSoBlock{
+			Header: &header,
+			Txns:   []*MsgDeSoTxn{{TxnMeta: &BlockRewardMetadataa{ExtraData: UintToBuf(height)}}},
+		}
+		blockHash, err := header.Hash()
+		require.NoError(err)
+		require.NoError(PutBlock(db, nil, block, nil))
+		bc.bestChain = append(bc.bestChain, &BlockNode{Hash: blockHash, Height: uint32(height), Header: &header})
+	}
+	requireHeights := func(blocks []*MsgDeSoBlock, heights ...uint64) {
+		require.Len(blocks, len(heights))
+		for ii, block := range blocks {
+			require.Equal(heights[ii], block.Header.Height)
+		}
+	}
+
+	blocks, err := bc.GetBlocksInRange(1, 3)
+	require.NoError(err)
+	requireHeights(blocks, 1, 2, 3)
+
+	// A range past the tip stops at the tip.
+	blocks, err = bc.GetBlocksInRange(3, 10)
+	require.NoError(err)
+	requireHeights(blocks, 3, 4)
+	blocks, err = bc.GetBlocksInRange(5, 10)
+	require.NoError(err)
+	requireHeights(blocks)
+
+	// Backwards and oversized ranges are rejected.
+	_, err = bc.GetBlocksInRange(3, 2)
+	require.Error(err)
+	_, err = bc.GetBlocksInRange(0, MaxBlocksInRange)
+	require.Error(err)
+}
+
+func TestGetTransactionsForPublicKeyPaginated(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	bc := &Blockchain{db: db, params: &params}
+
+	// Index five txns for m0, at positions 0 through 4, and one for m1.
+	var txnHashes []*BlockHash
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		for ii := 0; ii < 5; ii++ {
+			txnHash := NewBlockHash(RandomBytes(HashSizeBytes))
+			txnHashes = append(txnHashes, txnHash)
+			if err := DbPutTxindexPublicKeyToTxnMappingSingleWithTxn(txn, nil, m0PkBytes, txnHash, nil); err != nil {
+				return err
+			}
+		}
+		return DbPutTxindexPublicKeyToTxnMappingSingleWithTxn(
+			txn, nil, m1PkBytes, NewBlockHash(RandomBytes(HashSizeBytes)), nil)
+	}))
+
+	// Paging through m0's txns returns them newest first, with each page's last position
+	// as the cursor for the next one.
+	page, lastTxnIndex, err := bc.GetTransactionsForPublicKeyPaginated(m0PkBytes, nil, 2)
+	require.NoError(err)
+	require.Equal([]*BlockHash{txnHashes[4], txnHashes[3]}, page)
+	require.Equal(uint32(3), *lastTxnIndex)
+	page, lastTxnIndex, err = bc.GetTransactionsForPublicKeyPaginated(m0PkBytes, lastTxnIndex, 2)
+	require.NoError(err)
+	require.Equal([]*BlockHash{txnHashes[2], txnHashes[1]}, page)
+	require.Equal(uint32(1), *lastTxnIndex)
+	page, lastTxnIndex, err = bc.GetTransactionsForPublicKeyPaginated(m0PkBytes, lastTxnIndex, 2)
+	require.NoError(err)
+	require.Equal([]*BlockHash{txnHashes[0]}, page)
+	require.Equal(uint32(0), *lastTxnIndex)
+	page, lastTxnIndex, err = bc.GetTransactionsForPublicKeyPaginated(m0PkBytes, lastTxnIndex, 2)
+	require.NoError(err)
+	require.Empty(page)
+	require.Nil(lastTxnIndex)
+
+	// A cursor past the newest txn starts from the newest one.
+	pastNewestTxnIndex := uint32(100)
+	page, lastTxnIndex, err = bc.GetTransactionsForPublicKeyPaginated(m0PkBytes, &pastNewestTxnIndex, 10)
+	require.NoError(err)
+	require.Equal([]*BlockHash{txnHashes[4], txnHashes[3], txnHashes[2], txnHashes[1], txnHashes[0]}, page)
+	require.Equal(uint32(0), *lastTxnIndex)
+
+	// A public key with no txns gets an empty page.
+	page, lastTxnIndex, err = bc.GetTransactionsForPublicKeyPaginated(m2PkBytes, nil, 10)
+	require.NoError(err)
+	require.Empty(page)
+	require.Nil(lastTxnIndex)
+
+	// The limit has to be between 1 and the max.
+	_, _, err = bc.GetTransactionsForPublicKeyPaginated(m0PkBytes, nil, 0)
+	require.Error(err)
+	_, _, err = bc.GetTransactionsForPublicKeyPaginated(m0PkBytes, nil, MaxTransactionsPerPage+1)
+	require.Error(err)
+}
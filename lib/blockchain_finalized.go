@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// blockchain_finalized.go exposes "finalized" reads: views of the state that only
+// reflect blocks with at least a configurable number of confirmations. Exchanges
+// and other integrators can use these to query balances that can no longer be
+// reorged away, without having to implement their own confirmation tracking.
+//
+// Under PoW, finality is probabilistic, so the finalized state is the state at
+// the tip minus N blocks. Under PoS, blocks become final once they are committed
+// by Fast-HotStuff, so the finalized state is simply the committed tip and the
+// confirmation count is not needed.
+//
+// The PoS finality machinery itself already exists: validators send
+// MsgDeSoValidatorVote and MsgDeSoValidatorTimeout messages, the consensus event
+// loop aggregates a supermajority of them into QCs that later headers carry, and
+// runCommitRuleOnBestChain is the finality gadget that marks blocks committed. This
+// file doesn't add a second gadget; it only exposes the finalized tip that they
+// produce to readers.
+
+// FinalizedReadConfig controls how deep a block must be before its state is
+// returned by the finalized read APIs.
+type FinalizedReadConfig struct {
+	// MinConfirmations is the number of blocks that must be built on top of a
+	// block before it is considered finalized under PoW. A value of zero returns
+	// the state at the current tip.
+	MinConfirmations uint64
+}
+
+// GetFinalizedUtxoView returns a UtxoView reflecting the state as of the most recent
+// finalized block, along with that block's node. The returned view is detached from
+// the chain and must not be flushed.
+func (bc *Blockchain) GetFinalizedUtxoView(config FinalizedReadConfig) (*UtxoView, *BlockNode, error) {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	return bc.getFinalizedUtxoView(config)
+}
+
+func (bc *Blockchain) getFinalizedUtxoView(config FinalizedReadConfig) (*UtxoView, *BlockNode, error) {
+	// Once we are running PoS, the committed tip is final and the db always
+	// reflects it, so there is nothing to roll back.
+	if finalizedBlock, _, isPoSFinalized := bc.getLatestFinalizedBlock(); isPoSFinalized {
+		return bc.GetCommittedTipView(), finalizedBlock, nil
+	}
+
+	utxoView := NewUtxoViewWithStorageBackend(bc.db, bc.params, bc.postgres, bc.snapshot, nil, bc.storageBackend)
+	tipNode, exists := bc.bestChainMap[*utxoView.TipHash]
+	if !exists {
+		return nil, nil, fmt.Errorf("getFinalizedUtxoView: Tip hash %v for utxo view not found in best chain",
+			utxoView.TipHash)
+	}
+	if config.MinConfirmations == 0 {
+		return utxoView, tipNode, nil
+	}
+	if config.MinConfirmations > uint64(tipNode.Height) {
+		return nil, nil, fmt.Errorf("getFinalizedUtxoView: MinConfirmations %v exceeds tip height %v",
+			config.MinConfirmations, tipNode.Height)
+	}
+	targetHeight := uint64(tipNode.Height) - config.MinConfirmations
+
+	// Roll back blocks one at a time until the view points at the target height.
+	currentNode := tipNode
+	for uint64(currentNode.Height) > targetHeight {
+		utxoOps, err := GetUtxoOperationsForBlock(bc.db, bc.snapshot, currentNode.Hash)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "getFinalizedUtxoView: Problem fetching utxo operations for block %v",
+				currentNode.Hash)
+		}
+		block, err := GetBlock(currentNode.Hash, bc.db, bc.snapshot)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "getFinalizedUtxoView: Problem fetching block %v", currentNode.Hash)
+		}
+		txHashes, err := ComputeTransactionHashes(block.Txns)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "getFinalizedUtxoView: Problem computing txn hashes for block %v",
+				currentNode.Hash)
+		}
+		if err = utxoView.DisconnectBlock(block, txHashes, utxoOps, uint64(currentNode.Height)); err != nil {
+			return nil, nil, errors.Wrapf(err, "getFinalizedUtxoView: Problem disconnecting block %v",
+				currentNode.Hash)
+		}
+		if currentNode.Parent == nil {
+			return nil, nil, fmt.Errorf("getFinalizedUtxoView: Block %v has no parent", currentNode.Hash)
+		}
+		currentNode = currentNode.Parent
+	}
+	return utxoView, currentNode, nil
+}
+
+// GetFinalizedDeSoBalanceNanos returns the DESO balance of a public key as of the
+// most recent finalized block.
+func (bc *Blockchain) GetFinalizedDeSoBalanceNanos(publicKey []byte, config FinalizedReadConfig) (uint64, error) {
+	utxoView, _, err := bc.GetFinalizedUtxoView(config)
+	if err != nil {
+		return 0, errors.Wrapf(err, "GetFinalizedDeSoBalanceNanos: ")
+	}
+	balanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(publicKey)
+	if err != nil {
+		return 0, errors.Wrapf(err, "GetFinalizedDeSoBalanceNanos: ")
+	}
+	return balanceNanos, nil
+}
+
+// GetLatestFinalizedBlock returns the most recent block that has been finalized by
+// the Fast-HotStuff commit rule, along with the QC from the best chain that aggregates
+// the supermajority of validator votes for it. A block is finalized once it and its
+// child are proposed in consecutive views and both have been certified by QCs, at
+// which point runCommitRuleOnBestChain marks it committed. The bool is false before
+// the PoS cutover, when finality is probabilistic and no finalized block exists. The
+// QC may be nil if no descendant of the block on the best chain carries one yet,
+// e.g. for the final PoW block.
+func (bc *Blockchain) GetLatestFinalizedBlock() (*BlockNode, *QuorumCertificate, bool) {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	return bc.getLatestFinalizedBlock()
+}
+
+func (bc *Blockchain) getLatestFinalizedBlock() (*BlockNode, *QuorumCertificate, bool) {
+	committedTip, committedTipIndex := bc.GetCommittedTip()
+	if committedTip == nil || !bc.params.IsPoSBlockHeight(uint64(committedTip.Height)) {
+		return nil, nil, false
+	}
+
+	// The supermajority votes for a block are aggregated into a QC that is included
+	// in the header of a later block. Search the blocks built on top of the committed
+	// tip for the QC that certifies it.
+	for ii := committedTipIndex + 1; ii < len(bc.bestChain); ii++ {
+		header := bc.bestChain[ii].Header
+		if header == nil {
+			continue
+		}
+		qc, ok := header.GetQC().(*QuorumCertificate)
+		if !ok || qc == nil || qc.BlockHash == nil {
+			continue
+		}
+		if qc.BlockHash.IsEqual(committedTip.Hash) {
+			return committedTip, qc, true
+		}
+	}
+	return committedTip, nil, true
+}
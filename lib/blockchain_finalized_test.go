@@ -0,0 +1,145 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/deso-protocol/core/collections/bitset"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLatestFinalizedBlock(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 10
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+
+	// Blocks 8 and 9 are PoW blocks, which are always committed, and blocks 10 through
+	// 14 are PoS blocks that start out uncommitted.
+	bc := &Blockchain{params: &params}
+	var parent *BlockNode
+	for height := uint32(8); height <= 14; height++ {
+		parent = &BlockNode{
+			Parent: parent,
+			Hash:   NewBlockHash(RandomBytes(32)),
+			Height: height,
+			Header: &MsgDeSoHeader{Height: uint64(height)},
+			Status: StatusBlockValidated,
+		}
+		bc.bestChain = append(bc.bestChain, parent)
+	}
+	makeAggregatedSignature := func() *AggregatedBLSSignature {
+		signature, err := _generateRandomBLSPrivateKey(t).Sign(RandomBytes(32))
+		require.NoError(err)
+		return &AggregatedBLSSignature{Signature: signature, SignersList: bitset.NewBitset()}
+	}
+	makeQC := func(blockNode *BlockNode) *QuorumCertificate {
+		return &QuorumCertificate{
+			BlockHash:                         blockNode.Hash,
+			ProposedInView:                    uint64(blockNode.Height),
+			ValidatorsVoteAggregatedSignature: makeAggregatedSignature(),
+		}
+	}
+	commitThroughHeight := func(height uint32) {
+		for _, blockNode := range bc.bestChain {
+			if blockNode.Height <= height {
+				blockNode.Status |= StatusBlockCommitted
+			}
+		}
+	}
+
+	// Before any PoS block is committed, there's no finalized block.
+	finalizedBlock, qc, isPoSFinalized := bc.GetLatestFinalizedBlock()
+	require.False(isPoSFinalized)
+	require.Nil(finalizedBlock)
+	require.Nil(qc)
+
+	// Once block 11 is committed it's final, even before a QC for it is found.
+	commitThroughHeight(11)
+	finalizedBlock, qc, isPoSFinalized = bc.GetLatestFinalizedBlock()
+	require.True(isPoSFinalized)
+	require.Equal(bc.bestChain[3], finalizedBlock)
+	require.Nil(qc)
+
+	// QCs for other blocks are skipped, and the one that certifies block 11 is returned.
+	bc.bestChain[4].Header.ValidatorsVoteQC = makeQC(bc.bestChain[2])
+	bc.bestChain[5].Header.ValidatorsVoteQC = makeQC(bc.bestChain[3])
+	finalizedBlock, qc, isPoSFinalized = bc.GetLatestFinalizedBlock()
+	require.True(isPoSFinalized)
+	require.Equal(bc.bestChain[3], finalizedBlock)
+	require.Equal(bc.bestChain[5].Header.ValidatorsVoteQC, qc)
+
+	// The QC can also come from a timeout QC's high QC.
+	bc.bestChain[5].Header.ValidatorsVoteQC = nil
+	bc.bestChain[6].Header.ValidatorsTimeoutAggregateQC = &TimeoutAggregateQuorumCertificate{
+		TimedOutView:                         13,
+		ValidatorsHighQC:                     makeQC(bc.bestChain[3]),
+		ValidatorsTimeoutHighQCViews:         []uint64{11},
+		ValidatorsTimeoutAggregatedSignature: makeAggregatedSignature(),
+	}
+	finalizedBlock, qc, isPoSFinalized = bc.GetLatestFinalizedBlock()
+	require.True(isPoSFinalized)
+	require.Equal(bc.bestChain[3], finalizedBlock)
+	require.Equal(bc.bestChain[6].Header.ValidatorsTimeoutAggregateQC.ValidatorsHighQC, qc)
+
+	// Committing more blocks moves the finalized tip forward.
+	commitThroughHeight(13)
+	finalizedBlock, qc, isPoSFinalized = bc.GetLatestFinalizedBlock()
+	require.True(isPoSFinalized)
+	require.Equal(bc.bestChain[5], finalizedBlock)
+	require.Nil(qc)
+}
+
+func TestGetFinalizedUtxoView(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, _ := NewTestBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+
+	// Record the miner's balance in a view built at each height as the chain grows.
+	getBalanceAtTip := func() uint64 {
+		utxoView := NewUtxoView(chain.db, chain.params, chain.postgres, chain.snapshot, nil)
+		balanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(senderPkBytes)
+		require.NoError(err)
+		return balanceNanos
+	}
+	balancesByHeight := []uint64{getBalanceAtTip()}
+	for ii := 0; ii < 5; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+		balancesByHeight = append(balancesByHeight, getBalanceAtTip())
+	}
+	tipHeight := uint64(chain.BlockTip().Height)
+	require.Equal(uint64(5), tipHeight)
+	require.NotEqual(balancesByHeight[0], balancesByHeight[5])
+
+	// The view at depth N matches the view that was built at height tip-N, including
+	// rolling all the way back to the genesis block.
+	for minConfirmations := uint64(0); minConfirmations <= tipHeight; minConfirmations++ {
+		config := FinalizedReadConfig{MinConfirmations: minConfirmations}
+		utxoView, finalizedNode, err := chain.GetFinalizedUtxoView(config)
+		require.NoError(err)
+		require.Equal(uint32(tipHeight-minConfirmations), finalizedNode.Height)
+		require.Equal(*chain.bestChain[finalizedNode.Height].Hash, *finalizedNode.Hash)
+		require.Equal(*finalizedNode.Hash, *utxoView.TipHash)
+
+		balanceNanos, err := chain.GetFinalizedDeSoBalanceNanos(senderPkBytes, config)
+		require.NoError(err)
+		require.Equal(balancesByHeight[tipHeight-minConfirmations], balanceNanos)
+	}
+
+	// Reading the finalized state doesn't change the chain's state.
+	require.Equal(balancesByHeight[tipHeight], getBalanceAtTip())
+
+	// More confirmations than the chain has blocks is an error.
+	_, _, err = chain.GetFinalizedUtxoView(FinalizedReadConfig{MinConfirmations: tipHeight + 1})
+	require.Error(err)
+	_, err = chain.GetFinalizedDeSoBalanceNanos(senderPkBytes, FinalizedReadConfig{MinConfirmations: tipHeight + 1})
+	require.Error(err)
+}
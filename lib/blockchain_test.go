@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -152,7 +154,7 @@ func NewTestBlockchain(t *testing.T) (*Blockchain, *DeSoParams, *badger.DB) {
 	paramsCopy := DeSoTestnetParams
 
 	chain, err := NewBlockchain([]string{blockSignerPk}, 0, 0, &paramsCopy,
-		timesource, db, nil, nil, nil, false, nil)
+		timesource, db, nil, nil, nil, nil, false, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -254,7 +256,7 @@ func NewLowDifficultyBlockchainWithParamsAndDb(t *testing.T, params *DeSoParams,
 		}
 	}
 	chain, err := NewBlockchain([]string{blockSignerPk}, 0, 0,
-		&testParams, timesource, db, postgresDb, NewEventManager(), snap, false, nil)
+		&testParams, timesource, db, postgresDb, nil, NewEventManager(), snap, false, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
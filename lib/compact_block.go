@@ -0,0 +1,409 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ==================================================================
+// COMPACT_BLOCK, GET_BLOCK_TXNS, and BLOCK_TXNS Messages
+// ==================================================================
+
+// When a node accepts a new block, it invs it to its peers, which then fetch the header and the
+// full block. By then, a peer that's current usually has most of the block's txns in its mempool
+// already, so most of the block's bytes are downloaded twice, and the round trips delay the
+// block's propagation.
+//
+// A node instead sends the peers that advertise SFCompactBlocks a COMPACT_BLOCK message right
+// away. It holds the block without its txns, the block reward txn, which is never in a mempool,
+// and a short id for each of the other txns. The peer fills in the txns from its mempool, asks
+// for the ones it's missing with a GET_BLOCK_TXNS message, and gets them back in a BLOCK_TXNS
+// message. Once it has all of them, it checks them against the header's merkle root and
+// processes the block as if it had downloaded it in full. If that check fails, because two txns
+// shared a short id, the peer falls back to downloading the full block.
+//
+// A short id is the first eight bytes of the SHA256 of the block hash followed by the txn hash.
+// Keying the ids on the block hash keeps anyone from crafting txns whose short ids collide with
+// the txns of future blocks.
+
+const (
+	// MaxCompactBlockTxns is the most txns a compact block or a BLOCK_TXNS message can hold.
+	MaxCompactBlockTxns = 1 << 20
+)
+
+// GetCompactBlockShortTxnID returns the short id of a txn in the compact form of a block.
+func GetCompactBlockShortTxnID(blockHash *BlockHash, txnHash *BlockHash) uint64 {
+	idHash := sha256.Sum256(append(append([]byte{}, blockHash[:]...), txnHash[:]...))
+	return binary.BigEndian.Uint64(idHash[:8])
+}
+
+// CompactBlockPrefilledTxn is a txn sent in full in a compact block.
+type CompactBlockPrefilledTxn struct {
+	// Index is the index of the txn in the block.
+	Index uint64
+	Txn   *MsgDeSoTxn
+}
+
+type MsgDeSoCompactBlock struct {
+	// Block is the block without its txns.
+	Block *MsgDeSoBlock
+	// PrefilledTxns are the txns sent in full, sorted by their index in the block.
+	PrefilledTxns []*CompactBlockPrefilledTxn
+	// ShortTxnIDs are the short ids of the rest of the txns, in the order they're in the block.
+	ShortTxnIDs []uint64
+}
+
+// NewMsgDeSoCompactBlock returns the compact form of the block, with the block reward txn
+// prefilled.
+func NewMsgDeSoCompactBlock(block *MsgDeSoBlock) (*MsgDeSoCompactBlock, error) {
+	blockHash, err := block.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewMsgDeSoCompactBlock: Problem hashing block: ")
+	}
+	msg := &MsgDeSoCompactBlock{
+		Block: &MsgDeSoBlock{
+			Header:            block.Header,
+			BlockProducerInfo: block.BlockProducerInfo,
+		},
+	}
+	for ii, txn := range block.Txns {
+		if ii == 0 {
+			msg.PrefilledTxns = append(msg.PrefilledTxns, &CompactBlockPrefilledTxn{Index: 0, Txn: txn})
+			continue
+		}
+		msg.ShortTxnIDs = append(msg.ShortTxnIDs, GetCompactBlockShortTxnID(blockHash, txn.Hash()))
+	}
+	return msg, nil
+}
+
+func (msg *MsgDeSoCompactBlock) GetMsgType() MsgType {
+	return MsgTypeCompactBlock
+}
+
+// NumTxns returns the number of txns in the block.
+func (msg *MsgDeSoCompactBlock) NumTxns() uint64 {
+	return uint64(len(msg.PrefilledTxns) + len(msg.ShortTxnIDs))
+}
+
+func (msg *MsgDeSoCompactBlock) ToBytes(preSignature bool) ([]byte, error) {
+	if msg.Block == nil || msg.Block.Header == nil {
+		return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Block header should not be nil")
+	}
+	if len(msg.Block.Txns) > 0 {
+		return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Block should not hold txns")
+	}
+	if msg.NumTxns() > MaxCompactBlockTxns {
+		return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Number of txns %d exceeds max allowed %d",
+			msg.NumTxns(), MaxCompactBlockTxns)
+	}
+	blockBytes, err := msg.Block.ToBytes(preSignature)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompactBlock.ToBytes: Problem encoding block: ")
+	}
+	data := EncodeByteArray(blockBytes)
+
+	// The prefilled txns' indexes are delta-encoded.
+	data = append(data, UintToBuf(uint64(len(msg.PrefilledTxns)))...)
+	nextIndex := uint64(0)
+	for _, prefilledTxn := range msg.PrefilledTxns {
+		if prefilledTxn.Index < nextIndex || prefilledTxn.Index >= msg.NumTxns() {
+			return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Prefilled txn index %d is out of order "+
+				"or out of range", prefilledTxn.Index)
+		}
+		txnBytes, err := prefilledTxn.Txn.ToBytes(preSignature)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MsgDeSoCompactBlock.ToBytes: Problem encoding prefilled txn: ")
+		}
+		data = append(data, UintToBuf(prefilledTxn.Index-nextIndex)...)
+		data = append(data, EncodeByteArray(txnBytes)...)
+		nextIndex = prefilledTxn.Index + 1
+	}
+
+	data = append(data, UintToBuf(uint64(len(msg.ShortTxnIDs)))...)
+	for _, shortTxnID := range msg.ShortTxnIDs {
+		data = append(data, EncodeUint64(shortTxnID)...)
+	}
+	return data, nil
+}
+
+func (msg *MsgDeSoCompactBlock) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoCompactBlock{}
+
+	blockBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading block: ")
+	}
+	retMsg.Block = &MsgDeSoBlock{}
+	if err = retMsg.Block.FromBytes(blockBytes); err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem decoding block: ")
+	}
+	if len(retMsg.Block.Txns) > 0 {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Block should not hold txns")
+	}
+
+	numPrefilledTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading number of prefilled txns: ")
+	}
+	if numPrefilledTxns > MaxCompactBlockTxns {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Number of prefilled txns %d exceeds max allowed %d",
+			numPrefilledTxns, MaxCompactBlockTxns)
+	}
+	nextIndex := uint64(0)
+	for ii := uint64(0); ii < numPrefilledTxns; ii++ {
+		indexDelta, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading prefilled txn index: ")
+		}
+		if indexDelta >= MaxCompactBlockTxns {
+			return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Prefilled txn index is out of range")
+		}
+		txnBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading prefilled txn: ")
+		}
+		txn := &MsgDeSoTxn{}
+		if err = txn.FromBytes(txnBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem decoding prefilled txn: ")
+		}
+		retMsg.PrefilledTxns = append(retMsg.PrefilledTxns, &CompactBlockPrefilledTxn{
+			Index: nextIndex + indexDelta,
+			Txn:   txn,
+		})
+		nextIndex += indexDelta + 1
+	}
+
+	numShortTxnIDs, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading number of short txn ids: ")
+	}
+	if numShortTxnIDs > MaxCompactBlockTxns {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Number of short txn ids %d exceeds max allowed %d",
+			numShortTxnIDs, MaxCompactBlockTxns)
+	}
+	for ii := uint64(0); ii < numShortTxnIDs; ii++ {
+		shortTxnIDBytes := make([]byte, 8)
+		if _, err = io.ReadFull(rr, shortTxnIDBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading short txn id: ")
+		}
+		retMsg.ShortTxnIDs = append(retMsg.ShortTxnIDs, DecodeUint64(shortTxnIDBytes))
+	}
+
+	// Every prefilled txn has to fall within the block.
+	if len(retMsg.PrefilledTxns) > 0 &&
+		retMsg.PrefilledTxns[len(retMsg.PrefilledTxns)-1].Index >= retMsg.NumTxns() {
+
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Prefilled txn index is out of range")
+	}
+
+	*msg = retMsg
+	return nil
+}
+
+// Reconstruct fills in the block's txns from the prefilled txns and the given txns, which are
+// usually the ones in our mempool. It returns the block, with nil in place of the txns we don't
+// have, and the indexes of those txns.
+func (msg *MsgDeSoCompactBlock) Reconstruct(txns []*MsgDeSoTxn) (
+	_block *MsgDeSoBlock, _missingIndexes []uint64, _err error) {
+
+	blockHash, err := msg.Block.Hash()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "MsgDeSoCompactBlock.Reconstruct: Problem hashing block: ")
+	}
+
+	// Map the short ids to our txns. If two of our txns share a short id, we can't tell
+	// which one is in the block, so we treat it as missing.
+	txnsByShortID := make(map[uint64]*MsgDeSoTxn)
+	ambiguousShortIDs := make(map[uint64]bool)
+	for _, txn := range txns {
+		shortTxnID := GetCompactBlockShortTxnID(blockHash, txn.Hash())
+		if existingTxn, exists := txnsByShortID[shortTxnID]; exists && *existingTxn.Hash() != *txn.Hash() {
+			ambiguousShortIDs[shortTxnID] = true
+		}
+		txnsByShortID[shortTxnID] = txn
+	}
+
+	block := &MsgDeSoBlock{
+		Header:            msg.Block.Header,
+		BlockProducerInfo: msg.Block.BlockProducerInfo,
+		Txns:              make([]*MsgDeSoTxn, msg.NumTxns()),
+	}
+	for _, prefilledTxn := range msg.PrefilledTxns {
+		block.Txns[prefilledTxn.Index] = prefilledTxn.Txn
+	}
+	var missingIndexes []uint64
+	shortTxnIDIndex := 0
+	for index := range block.Txns {
+		if block.Txns[index] != nil {
+			continue
+		}
+		shortTxnID := msg.ShortTxnIDs[shortTxnIDIndex]
+		shortTxnIDIndex++
+		if txn, exists := txnsByShortID[shortTxnID]; exists && !ambiguousShortIDs[shortTxnID] {
+			block.Txns[index] = txn
+			continue
+		}
+		missingIndexes = append(missingIndexes, uint64(index))
+	}
+	return block, missingIndexes, nil
+}
+
+// FillCompactBlockTxns fills in the missing txns of a reconstructed block, and checks the txns
+// against the block's merkle root.
+func FillCompactBlockTxns(block *MsgDeSoBlock, missingIndexes []uint64, missingTxns []*MsgDeSoTxn) error {
+	if len(missingIndexes) != len(missingTxns) {
+		return fmt.Errorf("FillCompactBlockTxns: Got %d txns but %d are missing",
+			len(missingTxns), len(missingIndexes))
+	}
+	for ii, index := range missingIndexes {
+		if index >= uint64(len(block.Txns)) || missingTxns[ii] == nil {
+			return fmt.Errorf("FillCompactBlockTxns: Missing txn %d is invalid", index)
+		}
+		block.Txns[index] = missingTxns[ii]
+	}
+	for index, txn := range block.Txns {
+		if txn == nil {
+			return fmt.Errorf("FillCompactBlockTxns: Txn %d is still missing", index)
+		}
+	}
+	merkleRoot, _, err := ComputeMerkleRoot(block.Txns)
+	if err != nil {
+		return errors.Wrapf(err, "FillCompactBlockTxns: Problem computing merkle root: ")
+	}
+	if block.Header.TransactionMerkleRoot == nil || *merkleRoot != *block.Header.TransactionMerkleRoot {
+		return fmt.Errorf("FillCompactBlockTxns: Merkle root %v doesn't match the header's %v",
+			merkleRoot, block.Header.TransactionMerkleRoot)
+	}
+	return nil
+}
+
+type MsgDeSoGetBlockTxns struct {
+	BlockHash *BlockHash
+	// Indexes are the indexes of the txns in the block, in ascending order.
+	Indexes []uint64
+}
+
+func (msg *MsgDeSoGetBlockTxns) GetMsgType() MsgType {
+	return MsgTypeGetBlockTxns
+}
+
+func (msg *MsgDeSoGetBlockTxns) ToBytes(preSignature bool) ([]byte, error) {
+	if msg.BlockHash == nil {
+		return nil, fmt.Errorf("MsgDeSoGetBlockTxns.ToBytes: Block hash should not be nil")
+	}
+	if len(msg.Indexes) > MaxCompactBlockTxns {
+		return nil, fmt.Errorf("MsgDeSoGetBlockTxns.ToBytes: Number of indexes %d exceeds max allowed %d",
+			len(msg.Indexes), MaxCompactBlockTxns)
+	}
+	data := append([]byte{}, msg.BlockHash[:]...)
+	data = append(data, UintToBuf(uint64(len(msg.Indexes)))...)
+	// The indexes are delta-encoded.
+	nextIndex := uint64(0)
+	for _, index := range msg.Indexes {
+		if index < nextIndex {
+			return nil, fmt.Errorf("MsgDeSoGetBlockTxns.ToBytes: Indexes must be sorted with no duplicates")
+		}
+		data = append(data, UintToBuf(index-nextIndex)...)
+		nextIndex = index + 1
+	}
+	return data, nil
+}
+
+func (msg *MsgDeSoGetBlockTxns) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoGetBlockTxns{BlockHash: &BlockHash{}}
+
+	if _, err := io.ReadFull(rr, retMsg.BlockHash[:]); err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Problem reading block hash: ")
+	}
+	numIndexes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Problem reading number of indexes: ")
+	}
+	if numIndexes > MaxCompactBlockTxns {
+		return fmt.Errorf("MsgDeSoGetBlockTxns.FromBytes: Number of indexes %d exceeds max allowed %d",
+			numIndexes, MaxCompactBlockTxns)
+	}
+	nextIndex := uint64(0)
+	for ii := uint64(0); ii < numIndexes; ii++ {
+		indexDelta, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Problem reading index: ")
+		}
+		if indexDelta >= MaxCompactBlockTxns || nextIndex+indexDelta >= MaxCompactBlockTxns {
+			return fmt.Errorf("MsgDeSoGetBlockTxns.FromBytes: Index is out of range")
+		}
+		retMsg.Indexes = append(retMsg.Indexes, nextIndex+indexDelta)
+		nextIndex += indexDelta + 1
+	}
+
+	*msg = retMsg
+	return nil
+}
+
+type MsgDeSoBlockTxns struct {
+	BlockHash *BlockHash
+	// Txns are the requested txns, in the order they were requested.
+	Txns []*MsgDeSoTxn
+}
+
+func (msg *MsgDeSoBlockTxns) GetMsgType() MsgType {
+	return MsgTypeBlockTxns
+}
+
+func (msg *MsgDeSoBlockTxns) ToBytes(preSignature bool) ([]byte, error) {
+	if msg.BlockHash == nil {
+		return nil, fmt.Errorf("MsgDeSoBlockTxns.ToBytes: Block hash should not be nil")
+	}
+	if len(msg.Txns) > MaxCompactBlockTxns {
+		return nil, fmt.Errorf("MsgDeSoBlockTxns.ToBytes: Number of txns %d exceeds max allowed %d",
+			len(msg.Txns), MaxCompactBlockTxns)
+	}
+	data := append([]byte{}, msg.BlockHash[:]...)
+	data = append(data, UintToBuf(uint64(len(msg.Txns)))...)
+	for _, txn := range msg.Txns {
+		txnBytes, err := txn.ToBytes(preSignature)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MsgDeSoBlockTxns.ToBytes: Problem encoding txn: ")
+		}
+		data = append(data, EncodeByteArray(txnBytes)...)
+	}
+	return data, nil
+}
+
+func (msg *MsgDeSoBlockTxns) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoBlockTxns{BlockHash: &BlockHash{}}
+
+	if _, err := io.ReadFull(rr, retMsg.BlockHash[:]); err != nil {
+		return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Problem reading block hash: ")
+	}
+	numTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Problem reading number of txns: ")
+	}
+	if numTxns > MaxCompactBlockTxns {
+		return fmt.Errorf("MsgDeSoBlockTxns.FromBytes: Number of txns %d exceeds max allowed %d",
+			numTxns, MaxCompactBlockTxns)
+	}
+	for ii := uint64(0); ii < numTxns; ii++ {
+		txnBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Problem reading txn: ")
+		}
+		txn := &MsgDeSoTxn{}
+		if err = txn.FromBytes(txnBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Problem decoding txn: ")
+		}
+		retMsg.Txns = append(retMsg.Txns, txn)
+	}
+
+	*msg = retMsg
+	return nil
+}
@@ -0,0 +1,185 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"github.com/golang/glog"
+)
+
+// pendingCompactBlock is a compact block we're waiting on the missing txns of.
+type pendingCompactBlock struct {
+	peer           *Peer
+	block          *MsgDeSoBlock
+	missingIndexes []uint64
+}
+
+// _relayCompactBlock sends the block as a COMPACT_BLOCK message to the remote nodes that
+// understand them, and returns the ones that should be sent an inv instead.
+func (srv *Server) _relayCompactBlock(blk *MsgDeSoBlock, invVect *InvVect, remoteNodes []*RemoteNode) (
+	_invRemoteNodes []*RemoteNode) {
+
+	var compactBlock *MsgDeSoCompactBlock
+	for _, remoteNode := range remoteNodes {
+		pp := remoteNode.GetPeer()
+		if pp == nil || !remoteNode.GetServiceFlag().HasService(SFCompactBlocks) {
+			_invRemoteNodes = append(_invRemoteNodes, remoteNode)
+			continue
+		}
+		// Don't send the block back to the peer we got it from.
+		if pp.knownInventory.Contains(*invVect) {
+			continue
+		}
+		if compactBlock == nil {
+			var err error
+			compactBlock, err = NewMsgDeSoCompactBlock(blk)
+			if err != nil {
+				glog.Errorf("Server._relayCompactBlock: Problem creating compact block, relaying "+
+					"invs instead: %v", err)
+				return remoteNodes
+			}
+		}
+		pp.knownInventory.Add(*invVect)
+		if err := remoteNode.sendMessage(compactBlock); err != nil {
+			glog.Errorf("Server._relayCompactBlock: Problem sending compact block to %v: %v", pp, err)
+		}
+	}
+	return _invRemoteNodes
+}
+
+// _handleCompactBlock reconstructs a block from the txns in our mempool, and either processes
+// it or asks the peer for the txns we're missing.
+func (srv *Server) _handleCompactBlock(pp *Peer, msg *MsgDeSoCompactBlock) {
+	blockHash, err := msg.Block.Hash()
+	if err != nil {
+		srv._penalizeAndDisconnectPeer(pp, "Problem hashing compact block")
+		return
+	}
+	glog.V(1).Infof("Server._handleCompactBlock: Received compact block %v with %d txns from Peer %v",
+		blockHash, msg.NumTxns(), pp)
+
+	invVect := &InvVect{
+		Type: InvTypeBlock,
+		Hash: *blockHash,
+	}
+	pp.knownInventory.Add(*invVect)
+
+	if _, isPending := srv.pendingCompactBlocks[*blockHash]; isPending {
+		return
+	}
+	srv.blockchain.ChainLock.RLock()
+	hasBlock := srv.blockchain.HasBlock(blockHash)
+	hasParent := srv.blockchain.HasBlock(msg.Block.Header.PrevBlockHash)
+	srv.blockchain.ChainLock.RUnlock()
+	if hasBlock {
+		return
+	}
+
+	// Compact blocks only save us anything if our mempool is current and we can connect the
+	// block right away. Otherwise, we treat it like an inv and sync the block as usual.
+	if srv.blockchain.chainState() != SyncStateFullyCurrent || !hasParent {
+		glog.V(1).Infof("Server._handleCompactBlock: Treating compact block %v from Peer %v as an inv "+
+			"because we're not current or we're missing its parent", blockHash, pp)
+		srv._handleInv(pp, &MsgDeSoInv{InvList: []*InvVect{invVect}})
+		return
+	}
+
+	var mempoolTxns []*MsgDeSoTxn
+	for _, mempoolTx := range srv.GetMempool().GetTransactions() {
+		mempoolTxns = append(mempoolTxns, mempoolTx.Tx)
+	}
+	block, missingIndexes, err := msg.Reconstruct(mempoolTxns)
+	if err != nil {
+		srv._penalizeAndDisconnectPeer(pp, "Problem reconstructing compact block")
+		return
+	}
+	if len(missingIndexes) == 0 {
+		srv._processCompactBlock(pp, block, nil, nil)
+		return
+	}
+
+	glog.V(1).Infof("Server._handleCompactBlock: Requesting %d of %d txns of block %v from Peer %v",
+		len(missingIndexes), msg.NumTxns(), blockHash, pp)
+	srv.pendingCompactBlocks[*blockHash] = &pendingCompactBlock{
+		peer:           pp,
+		block:          block,
+		missingIndexes: missingIndexes,
+	}
+	pp.AddDeSoMessage(&MsgDeSoGetBlockTxns{
+		BlockHash: blockHash,
+		Indexes:   missingIndexes,
+	}, false)
+}
+
+// _handleGetBlockTxns lets the peer reply to a GET_BLOCK_TXNS message, since fetching the
+// block can take a while.
+func (srv *Server) _handleGetBlockTxns(pp *Peer, msg *MsgDeSoGetBlockTxns) {
+	glog.V(1).Infof("Server._handleGetBlockTxns: Received request for %d txns of block %v from Peer %v",
+		len(msg.Indexes), msg.BlockHash, pp)
+
+	pp.AddDeSoMessage(msg, true /*inbound*/)
+}
+
+// HandleGetBlockTxns replies to a GET_BLOCK_TXNS message with the requested txns of the block.
+func (pp *Peer) HandleGetBlockTxns(msg *MsgDeSoGetBlockTxns) {
+	block := pp.srv.blockchain.GetBlock(msg.BlockHash)
+	if block == nil {
+		// We only send compact blocks for blocks we have, so the peer shouldn't ask us
+		// for the txns of any other block.
+		glog.Errorf("Peer.HandleGetBlockTxns: Disconnecting peer %v because it asked for the txns "+
+			"of block %v that we don't have", pp, msg.BlockHash)
+		pp.Disconnect("HandleGetBlockTxns - requested txns of block we don't have")
+		return
+	}
+	blockTxns := &MsgDeSoBlockTxns{BlockHash: msg.BlockHash}
+	for _, index := range msg.Indexes {
+		if index >= uint64(len(block.Txns)) {
+			glog.Errorf("Peer.HandleGetBlockTxns: Disconnecting peer %v because it asked for txn %d "+
+				"of block %v, which has %d txns", pp, index, msg.BlockHash, len(block.Txns))
+			pp.Disconnect("HandleGetBlockTxns - requested txn index out of range")
+			return
+		}
+		blockTxns.Txns = append(blockTxns.Txns, block.Txns[index])
+	}
+	pp.AddDeSoMessage(blockTxns, false)
+}
+
+// _handleBlockTxns fills in the missing txns of a compact block we got from the peer.
+func (srv *Server) _handleBlockTxns(pp *Peer, msg *MsgDeSoBlockTxns) {
+	pending, exists := srv.pendingCompactBlocks[*msg.BlockHash]
+	if !exists || pending.peer.ID != pp.ID {
+		glog.V(1).Infof("Server._handleBlockTxns: Ignoring txns of block %v we didn't ask Peer %v for",
+			msg.BlockHash, pp)
+		return
+	}
+	delete(srv.pendingCompactBlocks, *msg.BlockHash)
+
+	srv._processCompactBlock(pp, pending.block, pending.missingIndexes, msg.Txns)
+}
+
+// _processCompactBlock fills in the missing txns of a block we reconstructed from a compact
+// block, and processes it. If the txns don't match the block's merkle root, we download the
+// full block instead.
+func (srv *Server) _processCompactBlock(pp *Peer, block *MsgDeSoBlock, missingIndexes []uint64,
+	missingTxns []*MsgDeSoTxn) {
+
+	blockHash, _ := block.Hash()
+	if err := FillCompactBlockTxns(block, missingIndexes, missingTxns); err != nil {
+		// This is usually a short txn id collision rather than the peer misbehaving.
+		glog.Warningf("Server._processCompactBlock: Problem filling in compact block %v from Peer %v, "+
+			"requesting the full block: %v", blockHash, pp, err)
+		srv.RequestBlocksByHash(pp, []*BlockHash{blockHash})
+		return
+	}
+	pp.requestedBlocks[*blockHash] = true
+	srv._handleBlock(pp, block, true /*isLastBlock*/)
+}
+
+// _cleanupPendingCompactBlocks drops the compact blocks we were waiting on a disconnected
+// peer for. Their blocks will be synced from the other peers.
+func (srv *Server) _cleanupPendingCompactBlocks(pp *Peer) {
+	for blockHash, pending := range srv.pendingCompactBlocks {
+		if pending.peer.ID == pp.ID {
+			delete(srv.pendingCompactBlocks, blockHash)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactBlock(t *testing.T) {
+	require := require.New(t)
+
+	// Build a block with a block reward and a few other txns.
+	txns := []*MsgDeSoTxn{{TxnMeta: &BlockRewardMetadataa{ExtraData: RandomBytes(8)}}}
+	for ii := 0; ii < 5; ii++ {
+		txns = append(txns, &MsgDeSoTxn{
+			PublicKey: RandomBytes(33),
+			TxOutputs: []*DeSoOutput{{PublicKey: RandomBytes(33), AmountNanos: uint64(ii + 1)}},
+			TxnMeta:   &BasicTransferMetadata{},
+		})
+	}
+	merkleRoot, _, err := ComputeMerkleRoot(txns)
+	require.NoError(err)
+	header := *expectedBlockHeaderVersion1
+	header.TransactionMerkleRoot = merkleRoot
+	block := &MsgDeSoBlock{Header: &header, Txns: txns}
+	blockHash, err := block.Hash()
+	require.NoError(err)
+
+	// The block reward is prefilled, and the rest of the txns are sent as short ids.
+	compactBlock, err := NewMsgDeSoCompactBlock(block)
+	require.NoError(err)
+	require.Len(compactBlock.PrefilledTxns, 1)
+	require.Equal(uint64(0), compactBlock.PrefilledTxns[0].Index)
+	require.Len(compactBlock.ShortTxnIDs, len(txns)-1)
+	require.Equal(GetCompactBlockShortTxnID(blockHash, txns[1].Hash()), compactBlock.ShortTxnIDs[0])
+	require.Equal(uint64(len(txns)), compactBlock.NumTxns())
+
+	// The message round-trips.
+	compactBlockBytes, err := compactBlock.ToBytes(false)
+	require.NoError(err)
+	decodedCompactBlock := NewMessage(MsgTypeCompactBlock).(*MsgDeSoCompactBlock)
+	require.NoError(decodedCompactBlock.FromBytes(compactBlockBytes))
+	require.Equal(compactBlock.ShortTxnIDs, decodedCompactBlock.ShortTxnIDs)
+	require.Len(decodedCompactBlock.PrefilledTxns, 1)
+	require.Equal(*txns[0].Hash(), *decodedCompactBlock.PrefilledTxns[0].Txn.Hash())
+	decodedBlockHash, err := decodedCompactBlock.Block.Hash()
+	require.NoError(err)
+	require.Equal(*blockHash, *decodedBlockHash)
+
+	// With the whole mempool, the block is reconstructed without any missing txns.
+	reconstructedBlock, missingIndexes, err := decodedCompactBlock.Reconstruct(txns[1:])
+	require.NoError(err)
+	require.Empty(missingIndexes)
+	require.NoError(FillCompactBlockTxns(reconstructedBlock, nil, nil))
+
+	// Txns missing from the mempool are reported by their index, and filled in afterwards.
+	unrelatedTxn := &MsgDeSoTxn{PublicKey: RandomBytes(33), TxnMeta: &BasicTransferMetadata{}}
+	reconstructedBlock, missingIndexes, err = decodedCompactBlock.Reconstruct(
+		[]*MsgDeSoTxn{txns[1], txns[3], txns[5], unrelatedTxn})
+	require.NoError(err)
+	require.Equal([]uint64{2, 4}, missingIndexes)
+	require.Error(FillCompactBlockTxns(reconstructedBlock, missingIndexes, []*MsgDeSoTxn{txns[2]}))
+	require.NoError(FillCompactBlockTxns(reconstructedBlock, missingIndexes, []*MsgDeSoTxn{txns[2], txns[4]}))
+	require.Equal(len(txns), len(reconstructedBlock.Txns))
+	for ii := range txns {
+		require.Equal(*txns[ii].Hash(), *reconstructedBlock.Txns[ii].Hash())
+	}
+
+	// Txns that don't match the merkle root, like the ones from a short id collision, are caught.
+	reconstructedBlock, missingIndexes, err = decodedCompactBlock.Reconstruct(txns[2:])
+	require.NoError(err)
+	require.Equal([]uint64{1}, missingIndexes)
+	require.Error(FillCompactBlockTxns(reconstructedBlock, missingIndexes, []*MsgDeSoTxn{unrelatedTxn}))
+
+	// The txn requests and replies round-trip.
+	getBlockTxns := &MsgDeSoGetBlockTxns{BlockHash: blockHash, Indexes: []uint64{2, 4, 100}}
+	getBlockTxnsBytes, err := getBlockTxns.ToBytes(false)
+	require.NoError(err)
+	decodedGetBlockTxns := NewMessage(MsgTypeGetBlockTxns)
+	require.NoError(decodedGetBlockTxns.FromBytes(getBlockTxnsBytes))
+	require.Equal(getBlockTxns, decodedGetBlockTxns)
+	_, err = (&MsgDeSoGetBlockTxns{BlockHash: blockHash, Indexes: []uint64{4, 2}}).ToBytes(false)
+	require.Error(err)
+
+	blockTxns := &MsgDeSoBlockTxns{BlockHash: blockHash, Txns: []*MsgDeSoTxn{txns[2], txns[4]}}
+	blockTxnsBytes, err := blockTxns.ToBytes(false)
+	require.NoError(err)
+	decodedBlockTxns := NewMessage(MsgTypeBlockTxns).(*MsgDeSoBlockTxns)
+	require.NoError(decodedBlockTxns.FromBytes(blockTxnsBytes))
+	require.Equal(*blockHash, *decodedBlockTxns.BlockHash)
+	require.Len(decodedBlockTxns.Txns, 2)
+	require.Equal(*txns[4].Hash(), *decodedBlockTxns.Txns[1].Hash())
+}
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -109,6 +111,10 @@ type ConnectionManager struct {
 
 	minFeeRateNanosPerKB uint64
 
+	// peerScores keeps the scores of the peers we've been connected to, and the bans of the
+	// ones that misbehaved. It's nil if the ConnectionManager was created without a DB.
+	peerScores *PeerScoreManager
+
 	// More chans we might want.	modifyRebroadcastInv chan interface{}
 	shutdown int32
 }
@@ -538,6 +544,119 @@ func (cmgr *ConnectionManager) GetNumOutboundPeers() uint32 {
 	return atomic.LoadUint32(&cmgr.numOutboundPeers)
 }
 
+// IsBannedIP returns true if the peers at the IP misbehaved enough that we shouldn't
+// connect to them.
+func (cmgr *ConnectionManager) IsBannedIP(ip string) bool {
+	return cmgr.peerScores != nil && cmgr.peerScores.IsBanned(ip)
+}
+
+// GetPeerScoreValue returns the score of the peer's IP, or zero if we don't know it.
+func (cmgr *ConnectionManager) GetPeerScoreValue(pp *Peer) int64 {
+	if cmgr.peerScores == nil {
+		return 0
+	}
+	score := cmgr.peerScores.GetScore(pp.IP())
+	if score == nil {
+		return 0
+	}
+	return score.Score()
+}
+
+func (cmgr *ConnectionManager) recordPeerLatency(pp *Peer, latencyMicros uint64) {
+	if cmgr.peerScores != nil {
+		cmgr.peerScores.RecordLatency(pp.IP(), latencyMicros)
+	}
+}
+
+func (cmgr *ConnectionManager) recordPeerBytesServed(pp *Peer, numBytes uint64) {
+	if cmgr.peerScores != nil && numBytes > 0 {
+		cmgr.peerScores.RecordBytesServed(pp.IP(), numBytes)
+	}
+}
+
+// RecordPeerInvalidMessage lowers the peer's score for sending us an invalid message, and
+// disconnects it if that got it banned.
+func (cmgr *ConnectionManager) RecordPeerInvalidMessage(pp *Peer, reason string) {
+	if cmgr.peerScores == nil {
+		return
+	}
+	if cmgr.peerScores.RecordInvalidMessage(pp.IP()) {
+		cmgr.disconnectBannedPeer(pp, reason)
+	}
+}
+
+// recordPeerStall lowers the peer's score for not answering a request in time, and
+// disconnects it if that got it banned.
+func (cmgr *ConnectionManager) recordPeerStall(pp *Peer) {
+	if cmgr.peerScores == nil {
+		return
+	}
+	if cmgr.peerScores.RecordStall(pp.IP()) {
+		cmgr.disconnectBannedPeer(pp, "stalled")
+	}
+}
+
+func (cmgr *ConnectionManager) disconnectBannedPeer(pp *Peer, reason string) {
+	// We keep our connections to persistent peers, since the node operator asked for them.
+	if pp.IsPersistent() {
+		return
+	}
+	pp.Disconnect(fmt.Sprintf("ConnectionManager: Peer banned, last offense: %v", reason))
+}
+
+// GetPeerScore returns a copy of the score of the peers at the IP, or nil if we don't have one.
+func (cmgr *ConnectionManager) GetPeerScore(ip string) *PeerScore {
+	if cmgr.peerScores == nil {
+		return nil
+	}
+	return cmgr.peerScores.GetScore(ip)
+}
+
+// GetAllPeerScores returns copies of the scores we have, from the highest to the lowest.
+func (cmgr *ConnectionManager) GetAllPeerScores() []*PeerScore {
+	if cmgr.peerScores == nil {
+		return nil
+	}
+	return cmgr.peerScores.GetAllScores()
+}
+
+// SetPeerScoreOverride pins the score of the peers at the IP. A score at or below
+// PeerScoreBanThreshold bans them, and disconnects the ones we're connected to, until
+// the override is cleared.
+func (cmgr *ConnectionManager) SetPeerScoreOverride(ip string, overrideScore int64) error {
+	if cmgr.peerScores == nil {
+		return fmt.Errorf("SetPeerScoreOverride: Peer scores are not enabled")
+	}
+	cmgr.peerScores.SetOverride(ip, overrideScore)
+	if cmgr.peerScores.IsBanned(ip) {
+		for _, pp := range cmgr.GetAllPeers() {
+			if pp.IP() == ip {
+				cmgr.disconnectBannedPeer(pp, "score overridden")
+			}
+		}
+	}
+	return nil
+}
+
+// ClearPeerScoreOverride goes back to scoring the peers at the IP by what they did.
+func (cmgr *ConnectionManager) ClearPeerScoreOverride(ip string) error {
+	if cmgr.peerScores == nil {
+		return fmt.Errorf("ClearPeerScoreOverride: Peer scores are not enabled")
+	}
+	cmgr.peerScores.ClearOverride(ip)
+	return nil
+}
+
+// ResetPeerScore forgets what the peers at the IP did, lifting any ban that isn't due to
+// an override.
+func (cmgr *ConnectionManager) ResetPeerScore(ip string) error {
+	if cmgr.peerScores == nil {
+		return fmt.Errorf("ResetPeerScore: Peer scores are not enabled")
+	}
+	cmgr.peerScores.Reset(ip)
+	return nil
+}
+
 func (cmgr *ConnectionManager) Stop() {
 	cmgr.mtxPeerMaps.Lock()
 	defer cmgr.mtxPeerMaps.Unlock()
@@ -547,6 +666,9 @@ func (cmgr *ConnectionManager) Stop() {
 			"shutting down")
 		return
 	}
+	if cmgr.peerScores != nil {
+		cmgr.peerScores.Stop()
+	}
 	for id := range cmgr.outboundConnectionAttempts {
 		cmgr.CloseAttemptedConnection(id)
 	}
@@ -595,6 +717,10 @@ func (cmgr *ConnectionManager) Start() {
 	// Accept inbound connections from peers on our listeners.
 	cmgr._handleInboundConnections()
 
+	if cmgr.peerScores != nil {
+		cmgr.peerScores.Start()
+	}
+
 	glog.Infof("Full node socket initialized")
 
 	for {
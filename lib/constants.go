@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -184,6 +185,17 @@ var (
 	BaseUnitsPerCoin, _ = uint256.FromHex("0xde0b6b3a7640000") // 1e18
 )
 
+const (
+	// DeSoDecimals is the number of decimals used to display $DESO, i.e. there
+	// are 1e9 nanos in a single $DESO.
+	DeSoDecimals = uint8(9)
+	// DefaultDAOCoinDecimals is the number of decimals used to display a DAO coin
+	// whose creator hasn't set its decimals. It matches BaseUnitsPerCoin.
+	DefaultDAOCoinDecimals = uint8(18)
+	// MaxDAOCoinDecimals is the largest number of decimals a creator can set.
+	MaxDAOCoinDecimals = uint8(18)
+)
+
 func (nt NetworkType) String() string {
 	switch nt {
 	case NetworkType_UNSET:
@@ -360,6 +372,212 @@ type ForkHeights struct {
 	// from PoW consensus to PoS consensus.
 	ProofOfStake2ConsensusCutoverBlockHeight uint32
 
+	// StakingRewardsAccrualBlockHeight defines the height at which end-of-epoch staking
+	// rewards for delegated stake switch from being paid out to every snapshotted stake
+	// to being accrued on a per-validator reward index. Each StakeEntry settles its
+	// rewards lazily against the index, which makes the epoch-end work proportional to
+	// the number of validators rather than the number of stakers.
+	StakingRewardsAccrualBlockHeight uint32
+
+	// ValidatorPerformanceTrackingBlockHeight defines the height at which we start
+	// recording per-epoch ValidatorEpochPerformanceEntries for every validator in the
+	// snapshot validator set: blocks proposed, leader slots missed, and votes cast.
+	ValidatorPerformanceTrackingBlockHeight uint32
+
+	// TxnFeeReceiptsBlockHeight defines the height at which we start storing a
+	// TxnFeeReceipt with the fee paid, the effective fee rate, and the change
+	// outputs of every connected transaction in its UtxoOperations.
+	TxnFeeReceiptsBlockHeight uint32
+
+	// BlockProducerAttestationBlockHeight defines the height at which block producer
+	// tags in the block reward's ExtraData are validated, and at which the ParamUpdater
+	// can start maintaining the on-chain block producer registry.
+	BlockProducerAttestationBlockHeight uint32
+
+	// DAOCoinLimitOrderExpirationBlockHeight defines the height at which DAO coin limit
+	// orders can specify an ExpirationBlockHeight, after which they're no longer matched.
+	DAOCoinLimitOrderExpirationBlockHeight uint32
+
+	// DAOCoinLimitOrderMaxSlippageBlockHeight defines the height at which market
+	// orders can specify a MaxSlippageScaledPrice.
+	DAOCoinLimitOrderMaxSlippageBlockHeight uint32
+
+	// DAOCoinLimitOrderStopLimitBlockHeight defines the height at which DAO coin limit
+	// orders can specify a StopTriggerScaledPrice, and at which we start tracking the
+	// last trade price of each DAO coin pair.
+	DAOCoinLimitOrderStopLimitBlockHeight uint32
+
+	// DAOCoinLimitOrderMinFillQuantityBlockHeight defines the height at which DAO coin
+	// limit orders can specify a MinQuantityToFillInBaseUnits for each match.
+	DAOCoinLimitOrderMinFillQuantityBlockHeight uint32
+
+	// DAOCoinLimitOrderQuantityDenominationBlockHeight defines the height at which DAO
+	// coin limit orders can specify which coin their quantity is denominated in.
+	DAOCoinLimitOrderQuantityDenominationBlockHeight uint32
+
+	// DAOCoinLimitOrderPostOnlyBlockHeight defines the height at which DAO coin limit
+	// orders can use the PostOnly fill type.
+	DAOCoinLimitOrderPostOnlyBlockHeight uint32
+
+	// DAOCoinLimitOrderBatchBlockHeight defines the height at which DAOCoinLimitOrderBatch
+	// txns, which connect several DAO coin limit orders atomically, are allowed. It must
+	// be after the BalanceModelBlockHeight.
+	DAOCoinLimitOrderBatchBlockHeight uint32
+
+	// BlockTimestampMedianTimePastBlockHeight defines the height at which PoS block
+	// timestamps must be greater than the median time past of their parent, and the
+	// BlockTimestampDriftNanoSecs global param is bounded by MaxBlockTimestampDriftNanoSecs.
+	BlockTimestampMedianTimePastBlockHeight uint32
+
+	// DAOCoinLimitOrderCancelAllBlockHeight defines the height at which a DAO coin
+	// limit order txn can cancel all of the transactor's orders, or all of them for
+	// a coin pair.
+	DAOCoinLimitOrderCancelAllBlockHeight uint32
+
+	// ProfilePicBlobsBlockHeight defines the height at which profile pics set by
+	// UpdateProfile txns are stored on the ProfileEntry as a content-hash reference,
+	// with the pic itself kept in a side-store outside of consensus state.
+	ProfilePicBlobsBlockHeight uint32
+
+	// DAOCoinLimitOrderReplaceBlockHeight defines the height at which a DAO coin limit
+	// order txn can atomically cancel one of the transactor's orders and place a new
+	// order in its place.
+	DAOCoinLimitOrderReplaceBlockHeight uint32
+
+	// DAOCoinLimitOrderCreatorCoinsBlockHeight defines the height at which DAO coin limit
+	// orders can trade creator coins against $DESO and against DAO coins.
+	DAOCoinLimitOrderCreatorCoinsBlockHeight uint32
+
+	// DeadKeyRegistryBlockHeight defines the height at which public keys that provably
+	// can't spend the DESO sent to them are recorded in a registry as blocks are connected.
+	DeadKeyRegistryBlockHeight uint32
+
+	// DAOCoinLimitOrderRestrictionBlockHeight defines the height at which DAO coin
+	// creators can disable order book trading of their coin.
+	DAOCoinLimitOrderRestrictionBlockHeight uint32
+
+	// NFTOwnerIndexBlockHeight defines the height at which we start maintaining an index
+	// of NFTs by owner that can be paginated. Existing NFTs are backfilled into the index
+	// at this height.
+	NFTOwnerIndexBlockHeight uint32
+
+	// DerivedKeyCoinAmountLimitsBlockHeight defines the height at which derived keys can
+	// be limited by the amount of DAO coins they transfer and creator coins they spend,
+	// in addition to the number of transactions.
+	DerivedKeyCoinAmountLimitsBlockHeight uint32
+
+	// CreatorCoinTradeAmountsBlockHeight defines the height at which creator coin buys and
+	// sells record the change in coins in circulation in their UtxoOperations, and DAO coin
+	// limit order fills record which of their coins are creator coins, so that creator coin
+	// trades can be indexed from the UtxoOperations.
+	CreatorCoinTradeAmountsBlockHeight uint32
+
+	// DerivedKeyExtensionBlockHeight defines the height at which an owner can extend the
+	// ExpirationBlock of an existing derived key with an AuthorizeDerivedKey txn, without
+	// resetting its spending limits.
+	DerivedKeyExtensionBlockHeight uint32
+
+	// DerivedKeyRecipientWhitelistBlockHeight defines the height at which derived keys can
+	// be restricted to sending DESO, coins, and NFTs to a whitelist of recipient public keys.
+	DerivedKeyRecipientWhitelistBlockHeight uint32
+
+	// DerivedKeyNonceBlockHeight defines the height at which txns signed by a derived key
+	// can carry the derived key's expected nonce in their ExtraData, so that they can't be
+	// replayed once the nonce has moved on.
+	DerivedKeyNonceBlockHeight uint32
+
+	// MultisigBlockHeight defines the height at which an account can register co-signer
+	// public keys and a threshold with the RegisterMultisig txn, after which its txns must
+	// carry that many co-signer signatures.
+	MultisigBlockHeight uint32
+
+	// DAOCoinStreamBlockHeight defines the height at which a DAO coin holder can escrow
+	// DAO coins in a stream that pays them out to a payee at a fixed rate per block.
+	DAOCoinStreamBlockHeight uint32
+
+	// GovernanceBlockHeight defines the height at which DAO coin holders can create
+	// proposals and vote on them with their DAO coin balances.
+	GovernanceBlockHeight uint32
+
+	// DAOCoinMultiTransferBlockHeight defines the height at which a DAO coin holder can
+	// transfer the coin to many recipients in a single txn.
+	DAOCoinMultiTransferBlockHeight uint32
+
+	// RoyaltySplitBlockHeight defines the height at which creators can register royalty
+	// splits and reference them from the NFTs they mint.
+	RoyaltySplitBlockHeight uint32
+
+	// DAOCoinFeeBlockHeight defines the height at which the ParamUpdater can whitelist DAO
+	// coins that txn fees can be paid in, and at which txns can opt into paying their fee
+	// in one of those coins.
+	DAOCoinFeeBlockHeight uint32
+
+	// NFTLeaseBlockHeight defines the height at which NFT owners can lease an NFT serial
+	// to another user for a fixed number of blocks without transferring ownership.
+	NFTLeaseBlockHeight uint32
+
+	// NFTAuctionBlockHeight defines the height at which NFTs can be put up for sale as
+	// English auctions, whose highest bid is accepted automatically at the auction's end.
+	NFTAuctionBlockHeight uint32
+
+	// NFTDutchAuctionBlockHeight defines the height at which a Buy Now NFT's price can be
+	// set to decline between a start and end block, turning it into a Dutch auction.
+	NFTDutchAuctionBlockHeight uint32
+
+	// NFTBundleBlockHeight defines the height at which NFT owners can list several NFT serials
+	// as a bundle that's bought in a single NFTBundle txn.
+	NFTBundleBlockHeight uint32
+
+	// NFTSwapBlockHeight defines the height at which users can propose and accept swaps of
+	// one NFT serial for another with NFTSwap txns.
+	NFTSwapBlockHeight uint32
+
+	// TxnTypeMinimumNetworkFeeBlockHeight defines the height at which the ParamUpdater can
+	// set minimum network fee rates for individual txn types.
+	TxnTypeMinimumNetworkFeeBlockHeight uint32
+
+	// DAOCoinDecimalsBlockHeight defines the height at which DAO coin creators can
+	// set the number of decimals used to display their coin.
+	DAOCoinDecimalsBlockHeight uint32
+
+	// DAOCoinLimitOrderTradingFeesBlockHeight defines the height at which the param
+	// updater can set maker and taker fees that are charged on DAO coin limit order fills.
+	DAOCoinLimitOrderTradingFeesBlockHeight uint32
+
+	// DAOCoinMetadataBlockHeight defines the height at which DAO coin creators can
+	// store display metadata for their coin in a DAOCoinMetadataEntry.
+	DAOCoinMetadataBlockHeight uint32
+
+	// ExternalHeaderAnchoringBlockHeight defines the height at which registered relayers
+	// can anchor external chain block headers into DeSo state, and at which the
+	// ParamUpdater can start maintaining the relayer registry.
+	ExternalHeaderAnchoringBlockHeight uint32
+
+	// ExchangeRateFeedBlockHeight defines the height at which the ParamUpdater can register
+	// exchange rate feed keys, and at which the USDCentsPerBitcoin exchange rate becomes the
+	// median of the rates recently submitted by those keys.
+	ExchangeRateFeedBlockHeight uint32
+
+	// DAOCoinLimitOrderFillHistoryBlockHeight defines the height at which every match of a
+	// DAO coin limit order is persisted as a DAOCoinLimitOrderFillEntry, indexed by the PKIDs
+	// of both sides and by the coin pair.
+	DAOCoinLimitOrderFillHistoryBlockHeight uint32
+
+	// DAOCoinLimitOrderTxindexBlockHeight defines the height at which the txindex records the
+	// counterparty, price, and fee of each DAO coin limit order fill, along with the totals
+	// the transactor traded.
+	DAOCoinLimitOrderTxindexBlockHeight uint32
+
+	// TxindexEnrichmentBlockHeight defines the height at which the txindex stores the output
+	// of the registered TxindexEnrichers with each txn's metadata.
+	TxindexEnrichmentBlockHeight uint32
+
+	// ValidatorSlashingBlockHeight defines the height at which anyone can submit evidence that
+	// a validator voted for two different blocks in the same view. The validator is jailed and
+	// a share of its stake is burned, including the stake delegated to it and the stake that's
+	// still locked after being unstaked from it.
+	ValidatorSlashingBlockHeight uint32
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -420,11 +638,45 @@ type MigrationHeight struct {
 }
 
 const (
-	DefaultMigration                     MigrationName = "DefaultMigration"
-	UnlimitedDerivedKeysMigration        MigrationName = "UnlimitedDerivedKeysMigration"
-	AssociationsAndAccessGroupsMigration MigrationName = "AssociationsAndAccessGroupsMigration"
-	BalanceModelMigration                MigrationName = "BalanceModelMigration"
-	ProofOfStake1StateSetupMigration     MigrationName = "ProofOfStake1StateSetupMigration"
+	DefaultMigration                               MigrationName = "DefaultMigration"
+	UnlimitedDerivedKeysMigration                  MigrationName = "UnlimitedDerivedKeysMigration"
+	AssociationsAndAccessGroupsMigration           MigrationName = "AssociationsAndAccessGroupsMigration"
+	BalanceModelMigration                          MigrationName = "BalanceModelMigration"
+	ProofOfStake1StateSetupMigration               MigrationName = "ProofOfStake1StateSetupMigration"
+	StakingRewardsAccrualMigration                 MigrationName = "StakingRewardsAccrualMigration"
+	ValidatorPerformanceTrackingMigration          MigrationName = "ValidatorPerformanceTrackingMigration"
+	TxnFeeReceiptsMigration                        MigrationName = "TxnFeeReceiptsMigration"
+	BlockProducerAttestationMigration              MigrationName = "BlockProducerAttestationMigration"
+	DAOCoinLimitOrderExpirationMigration           MigrationName = "DAOCoinLimitOrderExpirationMigration"
+	DAOCoinLimitOrderStopLimitMigration            MigrationName = "DAOCoinLimitOrderStopLimitMigration"
+	DAOCoinLimitOrderMinFillQuantityMigration      MigrationName = "DAOCoinLimitOrderMinFillQuantityMigration"
+	DAOCoinLimitOrderQuantityDenominationMigration MigrationName = "DAOCoinLimitOrderQuantityDenominationMigration"
+	DAOCoinDecimalsMigration                       MigrationName = "DAOCoinDecimalsMigration"
+	DAOCoinLimitOrderTradingFeesMigration          MigrationName = "DAOCoinLimitOrderTradingFeesMigration"
+	DAOCoinMetadataMigration                       MigrationName = "DAOCoinMetadataMigration"
+	ExternalHeaderAnchoringMigration               MigrationName = "ExternalHeaderAnchoringMigration"
+	ExchangeRateFeedMigration                      MigrationName = "ExchangeRateFeedMigration"
+	DAOCoinLimitOrderCreatorCoinsMigration         MigrationName = "DAOCoinLimitOrderCreatorCoinsMigration"
+	DeadKeyRegistryMigration                       MigrationName = "DeadKeyRegistryMigration"
+	DAOCoinLimitOrderRestrictionMigration          MigrationName = "DAOCoinLimitOrderRestrictionMigration"
+	DerivedKeyCoinAmountLimitsMigration            MigrationName = "DerivedKeyCoinAmountLimitsMigration"
+	CreatorCoinTradeAmountsMigration               MigrationName = "CreatorCoinTradeAmountsMigration"
+	DerivedKeyRecipientWhitelistMigration          MigrationName = "DerivedKeyRecipientWhitelistMigration"
+	DerivedKeyNonceMigration                       MigrationName = "DerivedKeyNonceMigration"
+	MultisigMigration                              MigrationName = "MultisigMigration"
+	DAOCoinStreamMigration                         MigrationName = "DAOCoinStreamMigration"
+	GovernanceMigration                            MigrationName = "GovernanceMigration"
+	TxindexEnrichmentMigration                     MigrationName = "TxindexEnrichmentMigration"
+	RoyaltySplitMigration                          MigrationName = "RoyaltySplitMigration"
+	DAOCoinFeeMigration                            MigrationName = "DAOCoinFeeMigration"
+	NFTLeaseMigration                              MigrationName = "NFTLeaseMigration"
+	NFTAuctionMigration                            MigrationName = "NFTAuctionMigration"
+	NFTDutchAuctionMigration                       MigrationName = "NFTDutchAuctionMigration"
+	NFTBundleMigration                             MigrationName = "NFTBundleMigration"
+	NFTSwapMigration                               MigrationName = "NFTSwapMigration"
+	TxnTypeMinimumNetworkFeeMigration              MigrationName = "TxnTypeMinimumNetworkFeeMigration"
+	DAOCoinLimitOrderTxindexMigration              MigrationName = "DAOCoinLimitOrderTxindexMigration"
+	ValidatorSlashingMigration                     MigrationName = "ValidatorSlashingMigration"
 )
 
 type EncoderMigrationHeights struct {
@@ -441,6 +693,109 @@ type EncoderMigrationHeights struct {
 
 	// This coincides with the ProofOfStake1StateSetupBlockHeight
 	ProofOfStake1StateSetupMigration MigrationHeight
+
+	// This coincides with the StakingRewardsAccrualBlockHeight
+	StakingRewardsAccrualMigration MigrationHeight
+
+	// This coincides with the ValidatorPerformanceTrackingBlockHeight
+	ValidatorPerformanceTrackingMigration MigrationHeight
+
+	// This coincides with the TxnFeeReceiptsBlockHeight
+	TxnFeeReceiptsMigration MigrationHeight
+
+	// This coincides with the BlockProducerAttestationBlockHeight
+	BlockProducerAttestationMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderExpirationBlockHeight
+	DAOCoinLimitOrderExpirationMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderStopLimitBlockHeight
+	DAOCoinLimitOrderStopLimitMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderMinFillQuantityBlockHeight
+	DAOCoinLimitOrderMinFillQuantityMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderQuantityDenominationBlockHeight
+	DAOCoinLimitOrderQuantityDenominationMigration MigrationHeight
+
+	// This coincides with the DAOCoinDecimalsBlockHeight
+	DAOCoinDecimalsMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderTradingFeesBlockHeight
+	DAOCoinLimitOrderTradingFeesMigration MigrationHeight
+
+	// This coincides with the DAOCoinMetadataBlockHeight
+	DAOCoinMetadataMigration MigrationHeight
+
+	// This coincides with the ExternalHeaderAnchoringBlockHeight
+	ExternalHeaderAnchoringMigration MigrationHeight
+
+	// This coincides with the ExchangeRateFeedBlockHeight
+	ExchangeRateFeedMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderCreatorCoinsBlockHeight
+	DAOCoinLimitOrderCreatorCoinsMigration MigrationHeight
+
+	// This coincides with the DeadKeyRegistryBlockHeight
+	DeadKeyRegistryMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderRestrictionBlockHeight
+	DAOCoinLimitOrderRestrictionMigration MigrationHeight
+
+	// This coincides with the DerivedKeyCoinAmountLimitsBlockHeight
+	DerivedKeyCoinAmountLimitsMigration MigrationHeight
+
+	// This coincides with the CreatorCoinTradeAmountsBlockHeight
+	CreatorCoinTradeAmountsMigration MigrationHeight
+
+	// This coincides with the DerivedKeyRecipientWhitelistBlockHeight
+	DerivedKeyRecipientWhitelistMigration MigrationHeight
+
+	// This coincides with the DerivedKeyNonceBlockHeight
+	DerivedKeyNonceMigration MigrationHeight
+
+	// This coincides with the MultisigBlockHeight
+	MultisigMigration MigrationHeight
+
+	// This coincides with the DAOCoinStreamBlockHeight
+	DAOCoinStreamMigration MigrationHeight
+
+	// This coincides with the GovernanceBlockHeight
+	GovernanceMigration MigrationHeight
+
+	// This coincides with the TxindexEnrichmentBlockHeight
+	TxindexEnrichmentMigration MigrationHeight
+
+	// This coincides with the RoyaltySplitBlockHeight
+	RoyaltySplitMigration MigrationHeight
+
+	// This coincides with the DAOCoinFeeBlockHeight
+	DAOCoinFeeMigration MigrationHeight
+
+	// This coincides with the NFTLeaseBlockHeight
+	NFTLeaseMigration MigrationHeight
+
+	// This coincides with the NFTAuctionBlockHeight
+	NFTAuctionMigration MigrationHeight
+
+	// This coincides with the NFTDutchAuctionBlockHeight
+	NFTDutchAuctionMigration MigrationHeight
+
+	// This coincides with the NFTBundleBlockHeight
+	NFTBundleMigration MigrationHeight
+
+	// This coincides with the NFTSwapBlockHeight. It also covers the escrow fields of
+	// UtxoOperation, since NFT swaps are the only txns that escrow funds in EscrowEntries.
+	NFTSwapMigration MigrationHeight
+
+	// This coincides with the TxnTypeMinimumNetworkFeeBlockHeight
+	TxnTypeMinimumNetworkFeeMigration MigrationHeight
+
+	// This coincides with the DAOCoinLimitOrderTxindexBlockHeight
+	DAOCoinLimitOrderTxindexMigration MigrationHeight
+
+	// This coincides with the ValidatorSlashingBlockHeight
+	ValidatorSlashingMigration MigrationHeight
 }
 
 func GetEncoderMigrationHeights(forkHeights *ForkHeights) *EncoderMigrationHeights {
@@ -470,6 +825,176 @@ func GetEncoderMigrationHeights(forkHeights *ForkHeights) *EncoderMigrationHeigh
 			Height:  uint64(forkHeights.ProofOfStake1StateSetupBlockHeight),
 			Name:    ProofOfStake1StateSetupMigration,
 		},
+		StakingRewardsAccrualMigration: MigrationHeight{
+			Version: 5,
+			Height:  uint64(forkHeights.StakingRewardsAccrualBlockHeight),
+			Name:    StakingRewardsAccrualMigration,
+		},
+		ValidatorPerformanceTrackingMigration: MigrationHeight{
+			Version: 6,
+			Height:  uint64(forkHeights.ValidatorPerformanceTrackingBlockHeight),
+			Name:    ValidatorPerformanceTrackingMigration,
+		},
+		TxnFeeReceiptsMigration: MigrationHeight{
+			Version: 7,
+			Height:  uint64(forkHeights.TxnFeeReceiptsBlockHeight),
+			Name:    TxnFeeReceiptsMigration,
+		},
+		BlockProducerAttestationMigration: MigrationHeight{
+			Version: 8,
+			Height:  uint64(forkHeights.BlockProducerAttestationBlockHeight),
+			Name:    BlockProducerAttestationMigration,
+		},
+		DAOCoinLimitOrderExpirationMigration: MigrationHeight{
+			Version: 9,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderExpirationBlockHeight),
+			Name:    DAOCoinLimitOrderExpirationMigration,
+		},
+		DAOCoinLimitOrderStopLimitMigration: MigrationHeight{
+			Version: 10,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderStopLimitBlockHeight),
+			Name:    DAOCoinLimitOrderStopLimitMigration,
+		},
+		DAOCoinLimitOrderMinFillQuantityMigration: MigrationHeight{
+			Version: 11,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderMinFillQuantityBlockHeight),
+			Name:    DAOCoinLimitOrderMinFillQuantityMigration,
+		},
+		DAOCoinLimitOrderQuantityDenominationMigration: MigrationHeight{
+			Version: 12,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderQuantityDenominationBlockHeight),
+			Name:    DAOCoinLimitOrderQuantityDenominationMigration,
+		},
+		DAOCoinDecimalsMigration: MigrationHeight{
+			Version: 13,
+			Height:  uint64(forkHeights.DAOCoinDecimalsBlockHeight),
+			Name:    DAOCoinDecimalsMigration,
+		},
+		DAOCoinLimitOrderTradingFeesMigration: MigrationHeight{
+			Version: 14,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderTradingFeesBlockHeight),
+			Name:    DAOCoinLimitOrderTradingFeesMigration,
+		},
+		DAOCoinMetadataMigration: MigrationHeight{
+			Version: 15,
+			Height:  uint64(forkHeights.DAOCoinMetadataBlockHeight),
+			Name:    DAOCoinMetadataMigration,
+		},
+		ExternalHeaderAnchoringMigration: MigrationHeight{
+			Version: 16,
+			Height:  uint64(forkHeights.ExternalHeaderAnchoringBlockHeight),
+			Name:    ExternalHeaderAnchoringMigration,
+		},
+		ExchangeRateFeedMigration: MigrationHeight{
+			Version: 17,
+			Height:  uint64(forkHeights.ExchangeRateFeedBlockHeight),
+			Name:    ExchangeRateFeedMigration,
+		},
+		DAOCoinLimitOrderCreatorCoinsMigration: MigrationHeight{
+			Version: 18,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderCreatorCoinsBlockHeight),
+			Name:    DAOCoinLimitOrderCreatorCoinsMigration,
+		},
+		DeadKeyRegistryMigration: MigrationHeight{
+			Version: 19,
+			Height:  uint64(forkHeights.DeadKeyRegistryBlockHeight),
+			Name:    DeadKeyRegistryMigration,
+		},
+		DAOCoinLimitOrderRestrictionMigration: MigrationHeight{
+			Version: 20,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderRestrictionBlockHeight),
+			Name:    DAOCoinLimitOrderRestrictionMigration,
+		},
+		DerivedKeyCoinAmountLimitsMigration: MigrationHeight{
+			Version: 21,
+			Height:  uint64(forkHeights.DerivedKeyCoinAmountLimitsBlockHeight),
+			Name:    DerivedKeyCoinAmountLimitsMigration,
+		},
+		CreatorCoinTradeAmountsMigration: MigrationHeight{
+			Version: 22,
+			Height:  uint64(forkHeights.CreatorCoinTradeAmountsBlockHeight),
+			Name:    CreatorCoinTradeAmountsMigration,
+		},
+		DerivedKeyRecipientWhitelistMigration: MigrationHeight{
+			Version: 23,
+			Height:  uint64(forkHeights.DerivedKeyRecipientWhitelistBlockHeight),
+			Name:    DerivedKeyRecipientWhitelistMigration,
+		},
+		DerivedKeyNonceMigration: MigrationHeight{
+			Version: 24,
+			Height:  uint64(forkHeights.DerivedKeyNonceBlockHeight),
+			Name:    DerivedKeyNonceMigration,
+		},
+		MultisigMigration: MigrationHeight{
+			Version: 25,
+			Height:  uint64(forkHeights.MultisigBlockHeight),
+			Name:    MultisigMigration,
+		},
+		DAOCoinStreamMigration: MigrationHeight{
+			Version: 26,
+			Height:  uint64(forkHeights.DAOCoinStreamBlockHeight),
+			Name:    DAOCoinStreamMigration,
+		},
+		GovernanceMigration: MigrationHeight{
+			Version: 27,
+			Height:  uint64(forkHeights.GovernanceBlockHeight),
+			Name:    GovernanceMigration,
+		},
+		TxindexEnrichmentMigration: MigrationHeight{
+			Version: 28,
+			Height:  uint64(forkHeights.TxindexEnrichmentBlockHeight),
+			Name:    TxindexEnrichmentMigration,
+		},
+		RoyaltySplitMigration: MigrationHeight{
+			Version: 29,
+			Height:  uint64(forkHeights.RoyaltySplitBlockHeight),
+			Name:    RoyaltySplitMigration,
+		},
+		DAOCoinFeeMigration: MigrationHeight{
+			Version: 30,
+			Height:  uint64(forkHeights.DAOCoinFeeBlockHeight),
+			Name:    DAOCoinFeeMigration,
+		},
+		NFTLeaseMigration: MigrationHeight{
+			Version: 31,
+			Height:  uint64(forkHeights.NFTLeaseBlockHeight),
+			Name:    NFTLeaseMigration,
+		},
+		NFTAuctionMigration: MigrationHeight{
+			Version: 32,
+			Height:  uint64(forkHeights.NFTAuctionBlockHeight),
+			Name:    NFTAuctionMigration,
+		},
+		NFTDutchAuctionMigration: MigrationHeight{
+			Version: 33,
+			Height:  uint64(forkHeights.NFTDutchAuctionBlockHeight),
+			Name:    NFTDutchAuctionMigration,
+		},
+		NFTBundleMigration: MigrationHeight{
+			Version: 34,
+			Height:  uint64(forkHeights.NFTBundleBlockHeight),
+			Name:    NFTBundleMigration,
+		},
+		NFTSwapMigration: MigrationHeight{
+			Version: 35,
+			Height:  uint64(forkHeights.NFTSwapBlockHeight),
+			Name:    NFTSwapMigration,
+		},
+		TxnTypeMinimumNetworkFeeMigration: MigrationHeight{
+			Version: 36,
+			Height:  uint64(forkHeights.TxnTypeMinimumNetworkFeeBlockHeight),
+			Name:    TxnTypeMinimumNetworkFeeMigration,
+		},
+		DAOCoinLimitOrderTxindexMigration: MigrationHeight{
+			Version: 37,
+			Height:  uint64(forkHeights.DAOCoinLimitOrderTxindexBlockHeight),
+			Name:    DAOCoinLimitOrderTxindexMigration,
+		},
+		ValidatorSlashingMigration: MigrationHeight{
+			Version: 38,
+			Height:  uint64(forkHeights.ValidatorSlashingBlockHeight),
+			Name:    ValidatorSlashingMigration,
+		},
 	}
 }
 
@@ -765,10 +1290,39 @@ type DeSoParams struct {
 	// before they are jailed.
 	DefaultJailInactiveValidatorGracePeriodEpochs uint64
 
+	// DefaultJailMissedSlotsThreshold is the default number of leader slots a validator
+	// may miss in a single epoch before it is jailed.
+	DefaultJailMissedSlotsThreshold uint64
+
+	// DefaultValidatorSlashBasisPoints is the default share of a validator's stake, and of
+	// the stake delegated to it, that is burned when the validator is slashed.
+	DefaultValidatorSlashBasisPoints uint64
+
+	// DefaultExchangeRateFeedMaxAgeBlocks is the default number of blocks after which a
+	// submission from an exchange rate feed key is too stale to count towards the median.
+	DefaultExchangeRateFeedMaxAgeBlocks uint64
+
+	// DefaultExchangeRateFeedMaxDeviationBasisPoints is the default amount, in basis points,
+	// by which a feed submission can deviate from the median of all fresh submissions before
+	// it's discarded as an outlier.
+	DefaultExchangeRateFeedMaxDeviationBasisPoints uint64
+
+	// DefaultExchangeRateFeedMinSubmissions is the default number of fresh submissions that
+	// must agree with each other before the exchange rate is updated.
+	DefaultExchangeRateFeedMinSubmissions uint64
+
 	// DefaultBlockTimestampDriftNanoSecs is the default number of nanoseconds
 	// from the current timestamp that we will allow a PoS block to be submitted.
 	DefaultBlockTimestampDriftNanoSecs int64
 
+	// MaxBlockTimestampDriftNanoSecs is the highest value the BlockTimestampDriftNanoSecs
+	// global param can take after the BlockTimestampMedianTimePastBlockHeight.
+	MaxBlockTimestampDriftNanoSecs int64
+
+	// MedianTimePastNumBlocks is the number of blocks whose median timestamp is the
+	// median time past of a chain. See block_time.go.
+	MedianTimePastNumBlocks int
+
 	// DefaultFeeBucketGrowthRateBasisPoints is the rate of growth of the fee bucket ranges. The multiplier is given
 	// as basis points. For example a value of 1000 means that the fee bucket ranges will grow by 10% each time.
 	DefaultFeeBucketGrowthRateBasisPoints uint64
@@ -883,6 +1437,141 @@ var RegtestForkHeights = ForkHeights{
 
 	BlockRewardPatchBlockHeight: uint32(0),
 
+	// Not yet scheduled. Tests that exercise reward accrual set this explicitly.
+	StakingRewardsAccrualBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ValidatorPerformanceTrackingBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxnFeeReceiptsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	BlockProducerAttestationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderExpirationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderMaxSlippageBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderStopLimitBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderMinFillQuantityBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderQuantityDenominationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderPostOnlyBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderBatchBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	BlockTimestampMedianTimePastBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderCancelAllBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ProfilePicBlobsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderReplaceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderCreatorCoinsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DeadKeyRegistryBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderRestrictionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTOwnerIndexBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyCoinAmountLimitsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	CreatorCoinTradeAmountsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyExtensionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyRecipientWhitelistBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyNonceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	MultisigBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinStreamBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	GovernanceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinMultiTransferBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	RoyaltySplitBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinFeeBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTLeaseBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTAuctionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTDutchAuctionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTBundleBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTSwapBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxnTypeMinimumNetworkFeeBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinDecimalsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderTradingFeesBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinMetadataBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ExternalHeaderAnchoringBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ExchangeRateFeedBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderFillHistoryBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderTxindexBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxindexEnrichmentBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ValidatorSlashingBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -1093,6 +1782,141 @@ var MainnetForkHeights = ForkHeights{
 	// Tues July 2 2024 @ 12pm PST
 	LockupsBlockHeight: uint32(349167),
 
+	// Not yet scheduled.
+	StakingRewardsAccrualBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ValidatorPerformanceTrackingBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxnFeeReceiptsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	BlockProducerAttestationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderExpirationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderMaxSlippageBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderStopLimitBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderMinFillQuantityBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderQuantityDenominationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderPostOnlyBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderBatchBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	BlockTimestampMedianTimePastBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderCancelAllBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ProfilePicBlobsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderReplaceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderCreatorCoinsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DeadKeyRegistryBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderRestrictionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTOwnerIndexBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyCoinAmountLimitsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	CreatorCoinTradeAmountsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyExtensionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyRecipientWhitelistBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyNonceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	MultisigBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinStreamBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	GovernanceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinMultiTransferBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	RoyaltySplitBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinFeeBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTLeaseBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTAuctionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTDutchAuctionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTBundleBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTSwapBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxnTypeMinimumNetworkFeeBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinDecimalsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderTradingFeesBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinMetadataBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ExternalHeaderAnchoringBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ExchangeRateFeedBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderFillHistoryBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderTxindexBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxindexEnrichmentBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ValidatorSlashingBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -1309,9 +2133,30 @@ var DeSoMainnetParams = DeSoParams{
 	// The number of epochs before an inactive validator is jailed
 	DefaultJailInactiveValidatorGracePeriodEpochs: uint64(48),
 
+	// The number of leader slots a validator may miss in an epoch before it is jailed
+	DefaultJailMissedSlotsThreshold: uint64(20),
+
+	// 5% of a validator's stake is burned when it's slashed for voting twice in a view
+	DefaultValidatorSlashBasisPoints: uint64(500),
+
+	// Exchange rate feed submissions older than an hour of PoS blocks don't count towards the median.
+	DefaultExchangeRateFeedMaxAgeBlocks: uint64(3600),
+
+	// Exchange rate feed submissions more than 10% away from the median are discarded.
+	DefaultExchangeRateFeedMaxDeviationBasisPoints: uint64(1000),
+
+	// At least 3 exchange rate feed submissions must agree before the exchange rate is updated.
+	DefaultExchangeRateFeedMinSubmissions: uint64(3),
+
 	// The number of nanoseconds from the current timestamp that we will allow a PoS block to be submitted.
 	DefaultBlockTimestampDriftNanoSecs: (time.Minute * 10).Nanoseconds(),
 
+	// The BlockTimestampDriftNanoSecs global param can't exceed one hour.
+	MaxBlockTimestampDriftNanoSecs: time.Hour.Nanoseconds(),
+
+	// The median time past is the median timestamp of the last 11 blocks.
+	MedianTimePastNumBlocks: 11,
+
 	// The rate of growth of the fee bucket ranges.
 	DefaultFeeBucketGrowthRateBasisPoints: uint64(1000),
 
@@ -1496,6 +2341,141 @@ var TestnetForkHeights = ForkHeights{
 	// Wed May 1 2024 @ 12pm PT
 	LockupsBlockHeight: uint32(1113866),
 
+	// Not yet scheduled.
+	StakingRewardsAccrualBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ValidatorPerformanceTrackingBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxnFeeReceiptsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	BlockProducerAttestationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderExpirationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderMaxSlippageBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderStopLimitBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderMinFillQuantityBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderQuantityDenominationBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderPostOnlyBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderBatchBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	BlockTimestampMedianTimePastBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderCancelAllBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ProfilePicBlobsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderReplaceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderCreatorCoinsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DeadKeyRegistryBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderRestrictionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTOwnerIndexBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyCoinAmountLimitsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	CreatorCoinTradeAmountsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyExtensionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyRecipientWhitelistBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DerivedKeyNonceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	MultisigBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinStreamBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	GovernanceBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinMultiTransferBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	RoyaltySplitBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinFeeBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTLeaseBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTAuctionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTDutchAuctionBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTBundleBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	NFTSwapBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxnTypeMinimumNetworkFeeBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinDecimalsBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderTradingFeesBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinMetadataBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ExternalHeaderAnchoringBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ExchangeRateFeedBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderFillHistoryBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	DAOCoinLimitOrderTxindexBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	TxindexEnrichmentBlockHeight: uint32(math.MaxUint32),
+
+	// Not yet scheduled.
+	ValidatorSlashingBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -1673,9 +2653,30 @@ var DeSoTestnetParams = DeSoParams{
 	// The number of epochs before an inactive validator is jailed
 	DefaultJailInactiveValidatorGracePeriodEpochs: uint64(48),
 
+	// The number of leader slots a validator may miss in an epoch before it is jailed
+	DefaultJailMissedSlotsThreshold: uint64(20),
+
+	// 5% of a validator's stake is burned when it's slashed for voting twice in a view
+	DefaultValidatorSlashBasisPoints: uint64(500),
+
+	// Exchange rate feed submissions older than an hour of PoS blocks don't count towards the median.
+	DefaultExchangeRateFeedMaxAgeBlocks: uint64(3600),
+
+	// Exchange rate feed submissions more than 10% away from the median are discarded.
+	DefaultExchangeRateFeedMaxDeviationBasisPoints: uint64(1000),
+
+	// At least 3 exchange rate feed submissions must agree before the exchange rate is updated.
+	DefaultExchangeRateFeedMinSubmissions: uint64(3),
+
 	// The number of nanoseconds from the current timestamp that we will allow a PoS block to be submitted.
 	DefaultBlockTimestampDriftNanoSecs: (time.Minute * 10).Nanoseconds(),
 
+	// The BlockTimestampDriftNanoSecs global param can't exceed one hour.
+	MaxBlockTimestampDriftNanoSecs: time.Hour.Nanoseconds(),
+
+	// The median time past is the median timestamp of the last 11 blocks.
+	MedianTimePastNumBlocks: 11,
+
 	// The rate of growth of the fee bucket ranges.
 	DefaultFeeBucketGrowthRateBasisPoints: uint64(1000),
 
@@ -1773,6 +2774,24 @@ const (
 	StakingRewardsAPYBasisPointsKey                   = "StakingRewardsAPYBasisPoints"
 	EpochDurationNumBlocksKey                         = "EpochDurationNumBlocks"
 	JailInactiveValidatorGracePeriodEpochsKey         = "JailInactiveValidatorGracePeriodEpochs"
+	JailMissedSlotsThresholdKey                       = "JailMissedSlotsThreshold"
+	ValidatorSlashBasisPointsKey                      = "ValidatorSlashBasisPoints"
+	DAOCoinLimitOrderMakerFeeBasisPointsKey           = "DAOCoinLimitOrderMakerFeeBasisPoints"
+	DAOCoinLimitOrderTakerFeeBasisPointsKey           = "DAOCoinLimitOrderTakerFeeBasisPoints"
+	DAOCoinLimitOrderFeeRecipientPublicKeyKey         = "DAOCoinLimitOrderFeeRecipientPublicKey"
+	BlockProducerRegistryPublicKeyKey                 = "BlockProducerRegistryPublicKey"
+	BlockProducerRegistryTagKey                       = "BlockProducerRegistryTag"
+	ExternalHeaderRelayerPublicKeyKey                 = "ExternalHeaderRelayerPublicKey"
+	RemoveExternalHeaderRelayerKey                    = "RemoveExternalHeaderRelayer"
+	ExchangeRateFeedPublicKeyKey                      = "ExchangeRateFeedPublicKey"
+	RemoveExchangeRateFeedKey                         = "RemoveExchangeRateFeed"
+	ExchangeRateFeedMaxAgeBlocksKey                   = "ExchangeRateFeedMaxAgeBlocks"
+	ExchangeRateFeedMaxDeviationBasisPointsKey        = "ExchangeRateFeedMaxDeviationBasisPoints"
+	ExchangeRateFeedMinSubmissionsKey                 = "ExchangeRateFeedMinSubmissions"
+	DAOCoinFeePublicKeyKey                            = "DAOCoinFeePublicKey"
+	RemoveDAOCoinFeeKey                               = "RemoveDAOCoinFee"
+	DAOCoinFeeHaircutBasisPointsKey                   = "DAOCoinFeeHaircutBasisPoints"
+	TxnTypeMinimumNetworkFeeNanosPerKBKey             = "TxnTypeMinimumNetworkFeeNanosPerKB"
 	MaximumVestedIntersectionsPerLockupTransactionKey = "MaximumVestedIntersectionsPerLockupTransaction"
 	FeeBucketGrowthRateBasisPointsKey                 = "FeeBucketGrowthRateBasisPointsKey"
 	BlockTimestampDriftNanoSecsKey                    = "BlockTimestampDriftNanoSecs"
@@ -1792,6 +2811,12 @@ const (
 	DiamondLevelKey    = "DiamondLevel"
 	DiamondPostHashKey = "DiamondPostHash"
 
+	// Keys in a block reward transaction's extra data map that attest to the block's producer.
+	// See block_producer_attestation.go.
+	BlockProducerTagKey       = "BlockProducerTag"
+	BlockProducerPublicKeyKey = "BlockProducerPublicKey"
+	BlockProducerSignatureKey = "BlockProducerSignature"
+
 	// Atomic Transaction Keys
 	AtomicTxnsChainLength    = "AtmcChnLen"
 	NextAtomicTxnPreHash     = "NxtAtmcHsh"
@@ -1800,6 +2825,10 @@ const (
 	// Key in transaction's extra data map containing the derived key used in signing the txn.
 	DerivedPublicKey = "DerivedPublicKey"
 
+	// Key in transaction's extra data map containing an optional client-supplied idempotency key. Consensus
+	// ignores it, but the mempools use it to deduplicate retried submissions from the same transactor.
+	IdempotencyKeyExtraDataKey = "IdempotencyKey"
+
 	// Messaging keys
 	MessagingPublicKey             = "MessagingPublicKey"
 	SenderMessagingPublicKey       = "SenderMessagingPublicKey"
@@ -1818,12 +2847,44 @@ const (
 	// the amount of royalties that should be added to pkid's creator coin upon sale of this NFT.
 	CoinRoyaltiesMapKey = "CoinRoyaltiesMap"
 
+	// Key in a CreateNFT or UpdateNFT transaction's extra data map. If present, the NFT is put up for sale
+	// as an English auction and the value is the uvarint-encoded block height at which the auction ends.
+	NFTAuctionEndBlockHeightKey = "NFTAuctionEndBlockHeight"
+
+	// Keys in a CreateNFT or UpdateNFT transaction's extra data map that turn a Buy Now NFT into a Dutch
+	// auction. The Buy Now price falls from BuyNowPriceNanos to the uvarint-encoded BuyNowEndPriceNanos
+	// between the start and end block heights. The start height defaults to the txn's block height. If
+	// BuyNowPriceDecayStepBlocks is present, the price drops every that many blocks instead of every block.
+	BuyNowEndPriceKey                   = "BuyNowEndPriceNanos"
+	BuyNowPriceDecayStartBlockHeightKey = "BuyNowPriceDecayStartBlockHeight"
+	BuyNowPriceDecayEndBlockHeightKey   = "BuyNowPriceDecayEndBlockHeight"
+	BuyNowPriceDecayStepBlocksKey       = "BuyNowPriceDecayStepBlocks"
+
+	// Key in a CreateNFT transaction's extra data map. If present, the value is the ID of a royalty split
+	// registered by the poster, whose recipients receive the additional royalties upon sale of this NFT.
+	RoyaltySplitIDKey = "RoyaltySplitID"
+
+	// Key in transaction's extra data map. If present, the value is the public key of a DAO coin
+	// whitelisted in GlobalParams, and the transactor pays the txn fee in that coin instead of DESO.
+	FeeDAOCoinPublicKeyKey = "FeeDAOCoinPublicKey"
+
+	// Key in a profile's extra data map, set by the creator with an UpdateProfile txn. If present, the
+	// value is the uvarint-encoded number of DESO nanos the creator agrees to spend sponsoring fees paid
+	// in their DAO coin. Each sponsored fee is deducted from it.
+	DAOCoinFeeSponsorshipBudgetNanosKey = "DAOCoinFeeSponsorshipBudgetNanos"
+
 	// Key in transaction's extra data map. If present, the value represents a map of pkid to basis points. The
 	// key represents who to pay the fee to and the value indicates how many basis points to charge. All fees are
 	// charged as "taker fees" and are paid to the pkid in the map in the *quote currency* of the market (typically
 	// DESO, USDC, or FOCUS).
 	TokenTradingFeesByPkidMapKey = "TokenTradingFeesByPkidMap"
 
+	// Keys in a DAOCoin txn's extra data map that hold the display metadata set by a
+	// DAOCoinOperationTypeUpdateMetadata operation. Links are separated by newlines.
+	DAOCoinMetadataIconHashKey    = "DAOCoinIconHash"
+	DAOCoinMetadataDescriptionKey = "DAOCoinDescription"
+	DAOCoinMetadataLinksKey       = "DAOCoinLinks"
+
 	// Used to distinguish v3 messages from previous iterations
 	MessagesVersionString = "V"
 	MessagesVersion1      = 1
@@ -1838,6 +2899,11 @@ const (
 	TransactionSpendingLimitKey = "TransactionSpendingLimit"
 	DerivedKeyMemoKey           = "DerivedKeyMemo"
 
+	// Key in the ExtraData of a txn signed by a derived key. If present, the value is the
+	// uvarint-encoded nonce the derived key is expected to be at, and the txn is rejected
+	// if the derived key's nonce doesn't match.
+	DerivedKeyNonceKey = "DerivedKeyNonce"
+
 	// V3 Group Chat Messages ExtraData Key
 	MessagingGroupOperationType = "MessagingGroupOperationType"
 )
@@ -1918,6 +2984,33 @@ const (
 	// Min/MaxTimeoutIntervalMillisecondsPoS - Min/max value to which the timeout interval can be set.
 	MinTimeoutIntervalMillisecondsPoS = 1000  // 1s TODO: Verify this is a sane value.
 	MaxTimeoutIntervalMillisecondsPoS = 60000 // 60s TODO: Verify this is a sane value.
+	// MinJailMissedSlotsThreshold - Min value to which the jail missed slots threshold can be set. A
+	// threshold of zero would jail a validator for a single missed slot.
+	MinJailMissedSlotsThreshold = 1
+	// MaxDAOCoinLimitOrderFeeBasisPoints - Max value to which the DAO coin limit order maker
+	// and taker fees can be set (10%).
+	MaxDAOCoinLimitOrderFeeBasisPoints = 1000
+	// MaxBlockProducerTagLength - Max length of a block producer tag, in bytes.
+	MaxBlockProducerTagLength = 64
+	// MaxDAOCoinIconHashLength - Max length of a DAO coin's icon hash, in bytes. This fits
+	// a hex-encoded sha256 hash or an IPFS CID.
+	MaxDAOCoinIconHashLength = 64
+	// MaxDAOCoinDescriptionLength - Max length of a DAO coin's description, in bytes.
+	MaxDAOCoinDescriptionLength = 1024
+	// MaxDAOCoinNumLinks and MaxDAOCoinLinkLength - Max number of links a DAO coin can
+	// list, and the max length of each link in bytes.
+	MaxDAOCoinNumLinks   = 10
+	MaxDAOCoinLinkLength = 256
+	// MaxExternalHeadersPerTxn - Max number of external chain headers a single
+	// AnchorExternalHeaders txn can anchor.
+	MaxExternalHeadersPerTxn = 100
+	// MaxExternalHeaderLength - Max length of an encoded external chain header, in bytes.
+	MaxExternalHeaderLength = 2048
+	// MaxDAOCoinLimitOrdersPerBatch - Max number of orders a single DAOCoinLimitOrderBatch
+	// txn can connect.
+	MaxDAOCoinLimitOrdersPerBatch = 50
+	// MaxMultisigCoSigners - Max number of co-signer public keys an account can register.
+	MaxMultisigCoSigners = 20
 
 	// DefaultMaxNonceExpirationBlockHeightOffset - default value to which the MaxNonceExpirationBlockHeightOffset
 	// is set to before specified by ParamUpdater.
@@ -0,0 +1,825 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// dao_coin_candles.go implements an optional index of DAO coin limit order fills that
+// aggregates them into OHLCV candles for charting. The index is not part of consensus:
+// it's populated from the UtxoOperations of committed blocks, stored under non-state
+// prefixes, and removed again when a block is disconnected.
+//
+// Every fill is recorded on the directed pair of the order that was filled, i.e. the coin
+// it bought and the coin it sold. Since each trade fills an order on both sides, a trade
+// shows up once in each direction of the pair. Prices are expressed like an order's
+// ScaledExchangeRateCoinsToSellPerCoinToBuy, and volumes in base units of both coins.
+//
+// Creator coin buys and sells are recorded as trades between the creator coin and DESO,
+// in both directions like fills, so a creator coin's chart covers both the bonding curve
+// and the order book. Their price is the DESO that went into or out of the curve per
+// creator coin minted or burned, so it doesn't include fees or founder rewards. Buys and
+// sells are only recorded from the CreatorCoinTradeAmountsBlockHeight on, since the
+// UtxoOperations of earlier ones don't say how many coins were traded.
+
+const (
+	EncoderTypeDAOCoinTrade  EncoderType = 3000000
+	EncoderTypeDAOCoinCandle EncoderType = 3000001
+)
+
+// DAOCoinCandleIntervals are the candle intervals the index maintains.
+var DAOCoinCandleIntervals = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	4 * time.Hour,
+	24 * time.Hour,
+}
+
+// MaxDAOCoinCandlesPerQuery bounds the number of candles or trades a single query returns.
+const MaxDAOCoinCandlesPerQuery = 5000
+
+//
+// TYPES: DAOCoinCandlePair
+//
+
+// DAOCoinCandlePair is a directed pair of coins in the index, identified like the coins of
+// a DAO coin limit order. The ZeroPKID is DESO.
+type DAOCoinCandlePair struct {
+	BuyingDAOCoinCreatorPKID  *PKID
+	BuyingCoinIsCreatorCoin   bool
+	SellingDAOCoinCreatorPKID *PKID
+	SellingCoinIsCreatorCoin  bool
+}
+
+// dbKey returns the key prefix for the pair. Pairs that include a creator coin are kept
+// under creatorCoinPrefix, with a creator coin flag after each PKID.
+func (pair *DAOCoinCandlePair) dbKey(daoCoinPrefix []byte, creatorCoinPrefix []byte) []byte {
+	if !pair.BuyingCoinIsCreatorCoin && !pair.SellingCoinIsCreatorCoin {
+		key := append([]byte{}, daoCoinPrefix...)
+		key = append(key, pair.BuyingDAOCoinCreatorPKID.ToBytes()...)
+		key = append(key, pair.SellingDAOCoinCreatorPKID.ToBytes()...)
+		return key
+	}
+	key := append([]byte{}, creatorCoinPrefix...)
+	key = append(key, pair.BuyingDAOCoinCreatorPKID.ToBytes()...)
+	key = append(key, BoolToByte(pair.BuyingCoinIsCreatorCoin))
+	key = append(key, pair.SellingDAOCoinCreatorPKID.ToBytes()...)
+	key = append(key, BoolToByte(pair.SellingCoinIsCreatorCoin))
+	return key
+}
+
+//
+// TYPES: DAOCoinTrade
+//
+
+type DAOCoinTrade struct {
+	BuyingDAOCoinCreatorPKID  *PKID
+	SellingDAOCoinCreatorPKID *PKID
+	// The timestamp of the block that contains the fill.
+	TimestampNanoSecs uint64
+	BlockHash         *BlockHash
+	// The index of the txn in the block, and of the fill within the txn's fills.
+	TxnIndex  uint32
+	FillIndex uint32
+	// The price of the fill in coins sold per coin bought, scaled by 1e38.
+	ScaledPrice                   *uint256.Int
+	CoinQuantityInBaseUnitsBought *uint256.Int
+	CoinQuantityInBaseUnitsSold   *uint256.Int
+	// Whether the coins bought and sold are creator coins rather than DAO coins.
+	BuyingCoinIsCreatorCoin  bool
+	SellingCoinIsCreatorCoin bool
+}
+
+func (trade *DAOCoinTrade) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, trade.BuyingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, trade.SellingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(trade.TimestampNanoSecs)...)
+	data = append(data, EncodeToBytes(blockHeight, trade.BlockHash, skipMetadata...)...)
+	data = append(data, UintToBuf(uint64(trade.TxnIndex))...)
+	data = append(data, UintToBuf(uint64(trade.FillIndex))...)
+	data = append(data, VariableEncodeUint256(trade.ScaledPrice)...)
+	data = append(data, VariableEncodeUint256(trade.CoinQuantityInBaseUnitsBought)...)
+	data = append(data, VariableEncodeUint256(trade.CoinQuantityInBaseUnitsSold)...)
+	data = append(data, BoolToByte(trade.BuyingCoinIsCreatorCoin))
+	data = append(data, BoolToByte(trade.SellingCoinIsCreatorCoin))
+	return data
+}
+
+func (trade *DAOCoinTrade) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	trade.BuyingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading BuyingDAOCoinCreatorPKID: ")
+	}
+	trade.SellingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading SellingDAOCoinCreatorPKID: ")
+	}
+	trade.TimestampNanoSecs, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading TimestampNanoSecs: ")
+	}
+	trade.BlockHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading BlockHash: ")
+	}
+	txnIndex, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading TxnIndex: ")
+	}
+	trade.TxnIndex = uint32(txnIndex)
+	fillIndex, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading FillIndex: ")
+	}
+	trade.FillIndex = uint32(fillIndex)
+	trade.ScaledPrice, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading ScaledPrice: ")
+	}
+	trade.CoinQuantityInBaseUnitsBought, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading CoinQuantityInBaseUnitsBought: ")
+	}
+	trade.CoinQuantityInBaseUnitsSold, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading CoinQuantityInBaseUnitsSold: ")
+	}
+	// Trades recorded before creator coins were indexed don't have the creator coin flags.
+	if rr.Len() > 0 {
+		if trade.BuyingCoinIsCreatorCoin, err = ReadBoolByte(rr); err != nil {
+			return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading BuyingCoinIsCreatorCoin: ")
+		}
+		if trade.SellingCoinIsCreatorCoin, err = ReadBoolByte(rr); err != nil {
+			return errors.Wrapf(err, "DAOCoinTrade.Decode: Problem reading SellingCoinIsCreatorCoin: ")
+		}
+	}
+	return nil
+}
+
+func (trade *DAOCoinTrade) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (trade *DAOCoinTrade) GetPair() *DAOCoinCandlePair {
+	return &DAOCoinCandlePair{
+		BuyingDAOCoinCreatorPKID:  trade.BuyingDAOCoinCreatorPKID,
+		BuyingCoinIsCreatorCoin:   trade.BuyingCoinIsCreatorCoin,
+		SellingDAOCoinCreatorPKID: trade.SellingDAOCoinCreatorPKID,
+		SellingCoinIsCreatorCoin:  trade.SellingCoinIsCreatorCoin,
+	}
+}
+
+func (trade *DAOCoinTrade) GetEncoderType() EncoderType {
+	return EncoderTypeDAOCoinTrade
+}
+
+//
+// TYPES: DAOCoinCandle
+//
+
+type DAOCoinCandle struct {
+	BuyingDAOCoinCreatorPKID  *PKID
+	SellingDAOCoinCreatorPKID *PKID
+	IntervalSecs              uint64
+	// The start of the candle's interval. Candles are aligned to multiples of the interval.
+	StartTimestampNanoSecs uint64
+
+	OpenScaledPrice  *uint256.Int
+	HighScaledPrice  *uint256.Int
+	LowScaledPrice   *uint256.Int
+	CloseScaledPrice *uint256.Int
+	// The volume traded in base units of the coin bought and of the coin sold.
+	VolumeInBaseUnitsBought *uint256.Int
+	VolumeInBaseUnitsSold   *uint256.Int
+	NumTrades               uint64
+	// Whether the coins bought and sold are creator coins rather than DAO coins.
+	BuyingCoinIsCreatorCoin  bool
+	SellingCoinIsCreatorCoin bool
+}
+
+func (candle *DAOCoinCandle) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, candle.BuyingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, candle.SellingDAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(candle.IntervalSecs)...)
+	data = append(data, UintToBuf(candle.StartTimestampNanoSecs)...)
+	data = append(data, VariableEncodeUint256(candle.OpenScaledPrice)...)
+	data = append(data, VariableEncodeUint256(candle.HighScaledPrice)...)
+	data = append(data, VariableEncodeUint256(candle.LowScaledPrice)...)
+	data = append(data, VariableEncodeUint256(candle.CloseScaledPrice)...)
+	data = append(data, VariableEncodeUint256(candle.VolumeInBaseUnitsBought)...)
+	data = append(data, VariableEncodeUint256(candle.VolumeInBaseUnitsSold)...)
+	data = append(data, UintToBuf(candle.NumTrades)...)
+	data = append(data, BoolToByte(candle.BuyingCoinIsCreatorCoin))
+	data = append(data, BoolToByte(candle.SellingCoinIsCreatorCoin))
+	return data
+}
+
+func (candle *DAOCoinCandle) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	candle.BuyingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading BuyingDAOCoinCreatorPKID: ")
+	}
+	candle.SellingDAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading SellingDAOCoinCreatorPKID: ")
+	}
+	candle.IntervalSecs, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading IntervalSecs: ")
+	}
+	candle.StartTimestampNanoSecs, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading StartTimestampNanoSecs: ")
+	}
+	for _, field := range []**uint256.Int{
+		&candle.OpenScaledPrice,
+		&candle.HighScaledPrice,
+		&candle.LowScaledPrice,
+		&candle.CloseScaledPrice,
+		&candle.VolumeInBaseUnitsBought,
+		&candle.VolumeInBaseUnitsSold,
+	} {
+		if *field, err = VariableDecodeUint256(rr); err != nil {
+			return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading prices and volumes: ")
+		}
+	}
+	candle.NumTrades, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading NumTrades: ")
+	}
+	// Candles recorded before creator coins were indexed don't have the creator coin flags.
+	if rr.Len() > 0 {
+		if candle.BuyingCoinIsCreatorCoin, err = ReadBoolByte(rr); err != nil {
+			return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading BuyingCoinIsCreatorCoin: ")
+		}
+		if candle.SellingCoinIsCreatorCoin, err = ReadBoolByte(rr); err != nil {
+			return errors.Wrapf(err, "DAOCoinCandle.Decode: Problem reading SellingCoinIsCreatorCoin: ")
+		}
+	}
+	return nil
+}
+
+func (candle *DAOCoinCandle) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (candle *DAOCoinCandle) GetPair() *DAOCoinCandlePair {
+	return &DAOCoinCandlePair{
+		BuyingDAOCoinCreatorPKID:  candle.BuyingDAOCoinCreatorPKID,
+		BuyingCoinIsCreatorCoin:   candle.BuyingCoinIsCreatorCoin,
+		SellingDAOCoinCreatorPKID: candle.SellingDAOCoinCreatorPKID,
+		SellingCoinIsCreatorCoin:  candle.SellingCoinIsCreatorCoin,
+	}
+}
+
+// newDAOCoinCandleForTrade returns the empty candle of the given interval that the trade
+// falls into.
+func newDAOCoinCandleForTrade(trade *DAOCoinTrade, interval time.Duration) *DAOCoinCandle {
+	return &DAOCoinCandle{
+		BuyingDAOCoinCreatorPKID:  trade.BuyingDAOCoinCreatorPKID,
+		SellingDAOCoinCreatorPKID: trade.SellingDAOCoinCreatorPKID,
+		IntervalSecs:              uint64(interval / time.Second),
+		StartTimestampNanoSecs:    GetDAOCoinCandleStartTimestampNanoSecs(trade.TimestampNanoSecs, interval),
+		BuyingCoinIsCreatorCoin:   trade.BuyingCoinIsCreatorCoin,
+		SellingCoinIsCreatorCoin:  trade.SellingCoinIsCreatorCoin,
+	}
+}
+
+func (candle *DAOCoinCandle) GetEncoderType() EncoderType {
+	return EncoderTypeDAOCoinCandle
+}
+
+// addTrade folds a trade into the candle. Trades must be added in chronological order.
+func (candle *DAOCoinCandle) addTrade(trade *DAOCoinTrade) {
+	if candle.NumTrades == 0 {
+		candle.OpenScaledPrice = trade.ScaledPrice.Clone()
+		candle.HighScaledPrice = trade.ScaledPrice.Clone()
+		candle.LowScaledPrice = trade.ScaledPrice.Clone()
+		candle.VolumeInBaseUnitsBought = uint256.NewInt()
+		candle.VolumeInBaseUnitsSold = uint256.NewInt()
+	}
+	if trade.ScaledPrice.Gt(candle.HighScaledPrice) {
+		candle.HighScaledPrice = trade.ScaledPrice.Clone()
+	}
+	if trade.ScaledPrice.Lt(candle.LowScaledPrice) {
+		candle.LowScaledPrice = trade.ScaledPrice.Clone()
+	}
+	candle.CloseScaledPrice = trade.ScaledPrice.Clone()
+	candle.VolumeInBaseUnitsBought = _addDAOCoinCandleVolume(
+		candle.VolumeInBaseUnitsBought, trade.CoinQuantityInBaseUnitsBought)
+	candle.VolumeInBaseUnitsSold = _addDAOCoinCandleVolume(
+		candle.VolumeInBaseUnitsSold, trade.CoinQuantityInBaseUnitsSold)
+	candle.NumTrades++
+}
+
+// _addDAOCoinCandleVolume adds two volumes, capping the sum rather than letting it wrap around.
+func _addDAOCoinCandleVolume(volume *uint256.Int, quantity *uint256.Int) *uint256.Int {
+	sum := uint256.NewInt()
+	if sum.AddOverflow(volume, quantity) {
+		return MaxUint256.Clone()
+	}
+	return sum
+}
+
+// GetDAOCoinCandleStartTimestampNanoSecs returns the start of the candle of the given
+// interval that contains the timestamp.
+func GetDAOCoinCandleStartTimestampNanoSecs(timestampNanoSecs uint64, interval time.Duration) uint64 {
+	intervalNanoSecs := uint64(interval.Nanoseconds())
+	return timestampNanoSecs - timestampNanoSecs%intervalNanoSecs
+}
+
+// GetDAOCoinTradesForBlock extracts the DAO coin limit order fills and creator coin buys
+// and sells from a block's UtxoOperations. Trades with a zero quantity on either side are
+// skipped since they don't have a price.
+func GetDAOCoinTradesForBlock(block *MsgDeSoBlock, utxoOpsForBlock [][]*UtxoOperation) ([]*DAOCoinTrade, error) {
+	blockHash, err := block.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinTradesForBlock: Problem hashing block: ")
+	}
+
+	var trades []*DAOCoinTrade
+	for txnIndex, utxoOpsForTxn := range utxoOpsForBlock {
+		fillIndex := uint32(0)
+		addTrade := func(pair *DAOCoinCandlePair, bought *uint256.Int, sold *uint256.Int) {
+			if bought == nil || sold == nil || bought.IsZero() || sold.IsZero() {
+				return
+			}
+			scaledPriceBig := big.NewInt(0).Mul(sold.ToBig(), OneE38.ToBig())
+			scaledPriceBig.Div(scaledPriceBig, bought.ToBig())
+			scaledPrice, overflow := uint256.FromBig(scaledPriceBig)
+			if overflow {
+				return
+			}
+			trades = append(trades, &DAOCoinTrade{
+				BuyingDAOCoinCreatorPKID:      pair.BuyingDAOCoinCreatorPKID.NewPKID(),
+				SellingDAOCoinCreatorPKID:     pair.SellingDAOCoinCreatorPKID.NewPKID(),
+				TimestampNanoSecs:             uint64(block.Header.TstampNanoSecs),
+				BlockHash:                     blockHash,
+				TxnIndex:                      uint32(txnIndex),
+				FillIndex:                     fillIndex,
+				ScaledPrice:                   scaledPrice,
+				CoinQuantityInBaseUnitsBought: bought.Clone(),
+				CoinQuantityInBaseUnitsSold:   sold.Clone(),
+				BuyingCoinIsCreatorCoin:       pair.BuyingCoinIsCreatorCoin,
+				SellingCoinIsCreatorCoin:      pair.SellingCoinIsCreatorCoin,
+			})
+			fillIndex++
+		}
+
+		for _, utxoOp := range _flattenDAOCoinTradeUtxoOps(utxoOpsForTxn) {
+			switch utxoOp.Type {
+			case OperationTypeDAOCoinLimitOrder:
+				for _, filledOrder := range utxoOp.FilledDAOCoinLimitOrders {
+					addTrade(&DAOCoinCandlePair{
+						BuyingDAOCoinCreatorPKID:  filledOrder.BuyingDAOCoinCreatorPKID,
+						BuyingCoinIsCreatorCoin:   filledOrder.BuyingCoinIsCreatorCoin,
+						SellingDAOCoinCreatorPKID: filledOrder.SellingDAOCoinCreatorPKID,
+						SellingCoinIsCreatorCoin:  filledOrder.SellingCoinIsCreatorCoin,
+					}, filledOrder.CoinQuantityInBaseUnitsBought, filledOrder.CoinQuantityInBaseUnitsSold)
+				}
+
+			case OperationTypeCreatorCoin:
+				if utxoOp.PrevTransactorBalanceEntry == nil || utxoOp.PrevTransactorBalanceEntry.CreatorPKID == nil {
+					continue
+				}
+				// The curve takes the other side of the trade, so it's recorded in both
+				// directions, like a fill.
+				creatorCoinNanos := _absInt64ToUint256(utxoOp.CreatorCoinNanosDiff)
+				desoNanos := _absInt64ToUint256(utxoOp.CreatorCoinDESOLockedNanosDiff)
+				creatorPKID := utxoOp.PrevTransactorBalanceEntry.CreatorPKID
+				addTrade(&DAOCoinCandlePair{
+					BuyingDAOCoinCreatorPKID:  creatorPKID,
+					BuyingCoinIsCreatorCoin:   true,
+					SellingDAOCoinCreatorPKID: &ZeroPKID,
+				}, creatorCoinNanos, desoNanos)
+				addTrade(&DAOCoinCandlePair{
+					BuyingDAOCoinCreatorPKID:  &ZeroPKID,
+					SellingDAOCoinCreatorPKID: creatorPKID,
+					SellingCoinIsCreatorCoin:  true,
+				}, desoNanos, creatorCoinNanos)
+			}
+		}
+	}
+	return trades, nil
+}
+
+func _absInt64ToUint256(value int64) *uint256.Int {
+	if value < 0 {
+		return uint256.NewInt().SetUint64(uint64(-value))
+	}
+	return uint256.NewInt().SetUint64(uint64(value))
+}
+
+// _flattenDAOCoinTradeUtxoOps returns the DAO coin limit order and creator coin UtxoOperations
+// of a txn, including those of the txns wrapped by an atomic txn.
+func _flattenDAOCoinTradeUtxoOps(utxoOpsForTxn []*UtxoOperation) []*UtxoOperation {
+	var tradeOps []*UtxoOperation
+	for _, utxoOp := range utxoOpsForTxn {
+		switch utxoOp.Type {
+		case OperationTypeDAOCoinLimitOrder, OperationTypeCreatorCoin:
+			tradeOps = append(tradeOps, utxoOp)
+		case OperationTypeAtomicTxnsWrapper:
+			for _, innerUtxoOps := range utxoOp.AtomicTxnsInnerUtxoOps {
+				tradeOps = append(tradeOps, _flattenDAOCoinTradeUtxoOps(innerUtxoOps)...)
+			}
+		}
+	}
+	return tradeOps
+}
+
+//
+// DB UTILS
+//
+
+func _dbKeyForDAOCoinTradePair(pair *DAOCoinCandlePair) []byte {
+	return pair.dbKey(Prefixes.PrefixDAOCoinTradeByPairAndTimestamp,
+		Prefixes.PrefixDAOCoinTradeWithCreatorCoinsByPairAndTimestamp)
+}
+
+func DBKeyForDAOCoinTrade(trade *DAOCoinTrade) []byte {
+	key := _dbKeyForDAOCoinTradePair(trade.GetPair())
+	key = append(key, EncodeUint64(trade.TimestampNanoSecs)...)
+	key = append(key, trade.BlockHash.ToBytes()...)
+	key = append(key, _EncodeUint32(trade.TxnIndex)...)
+	key = append(key, _EncodeUint32(trade.FillIndex)...)
+	return key
+}
+
+func DBKeyForDAOCoinTradeKeysByBlockHash(blockHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixDAOCoinTradeKeysByBlockHash...), blockHash.ToBytes()...)
+}
+
+func _dbKeyForDAOCoinCandleInterval(pair *DAOCoinCandlePair, intervalSecs uint64) []byte {
+	key := pair.dbKey(Prefixes.PrefixDAOCoinCandleByPairAndInterval,
+		Prefixes.PrefixDAOCoinCandleWithCreatorCoinsByPairAndInterval)
+	key = append(key, EncodeUint64(intervalSecs)...)
+	return key
+}
+
+func DBKeyForDAOCoinCandle(candle *DAOCoinCandle) []byte {
+	key := _dbKeyForDAOCoinCandleInterval(candle.GetPair(), candle.IntervalSecs)
+	key = append(key, EncodeUint64(candle.StartTimestampNanoSecs)...)
+	return key
+}
+
+func DBGetDAOCoinCandleWithTxn(txn *badger.Txn, key []byte) (*DAOCoinCandle, error) {
+	candleBytes, err := DBGetWithTxn(txn, nil, key)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetDAOCoinCandleWithTxn: Problem retrieving candle: ")
+	}
+	candle, err := DecodeDeSoEncoder(&DAOCoinCandle{}, bytes.NewReader(candleBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDAOCoinCandleWithTxn: Problem decoding candle: ")
+	}
+	return candle, nil
+}
+
+// DBGetDAOCoinTradesWithTxn returns the trades of a directed pair with timestamps in
+// [startTimestampNanoSecs, endTimestampNanoSecs), in chronological order.
+func DBGetDAOCoinTradesWithTxn(
+	txn *badger.Txn,
+	pair *DAOCoinCandlePair,
+	startTimestampNanoSecs uint64,
+	endTimestampNanoSecs uint64,
+	limit int,
+) ([]*DAOCoinTrade, error) {
+	prefix := _dbKeyForDAOCoinTradePair(pair)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	var trades []*DAOCoinTrade
+	startKey := append(append([]byte{}, prefix...), EncodeUint64(startTimestampNanoSecs)...)
+	for iterator.Seek(startKey); iterator.ValidForPrefix(prefix) && len(trades) < limit; iterator.Next() {
+		tradeBytes, err := iterator.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDAOCoinTradesWithTxn: Problem reading trade: ")
+		}
+		trade, err := DecodeDeSoEncoder(&DAOCoinTrade{}, bytes.NewReader(tradeBytes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDAOCoinTradesWithTxn: Problem decoding trade: ")
+		}
+		if trade.TimestampNanoSecs >= endTimestampNanoSecs {
+			break
+		}
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// DBGetDAOCoinCandlesWithTxn returns the candles of a directed pair and interval that
+// start in [startTimestampNanoSecs, endTimestampNanoSecs), in chronological order.
+// Intervals without trades have no candle.
+func DBGetDAOCoinCandlesWithTxn(
+	txn *badger.Txn,
+	pair *DAOCoinCandlePair,
+	interval time.Duration,
+	startTimestampNanoSecs uint64,
+	endTimestampNanoSecs uint64,
+	limit int,
+) ([]*DAOCoinCandle, error) {
+	prefix := _dbKeyForDAOCoinCandleInterval(pair, uint64(interval/time.Second))
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	var candles []*DAOCoinCandle
+	startKey := append(append([]byte{}, prefix...), EncodeUint64(startTimestampNanoSecs)...)
+	for iterator.Seek(startKey); iterator.ValidForPrefix(prefix) && len(candles) < limit; iterator.Next() {
+		candleBytes, err := iterator.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDAOCoinCandlesWithTxn: Problem reading candle: ")
+		}
+		candle, err := DecodeDeSoEncoder(&DAOCoinCandle{}, bytes.NewReader(candleBytes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDAOCoinCandlesWithTxn: Problem decoding candle: ")
+		}
+		if candle.StartTimestampNanoSecs >= endTimestampNanoSecs {
+			break
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+//
+// DAOCoinCandleIndex
+//
+
+// DAOCoinCandleIndex maintains the DAO coin trade and candle index in the chain's db.
+// Register HandleBlockCommitted and HandleBlockDisconnected with the EventManager to
+// keep it in sync with the chain.
+type DAOCoinCandleIndex struct {
+	// mtx serializes connects and disconnects so candles are always recomputed from a
+	// consistent set of trades.
+	mtx sync.Mutex
+	db  *badger.DB
+}
+
+func NewDAOCoinCandleIndex(db *badger.DB) *DAOCoinCandleIndex {
+	return &DAOCoinCandleIndex{db: db}
+}
+
+func (index *DAOCoinCandleIndex) HandleBlockCommitted(event *BlockEvent) {
+	utxoOpsForBlock := event.UtxoOps
+	if utxoOpsForBlock == nil {
+		// Blocks attached during a reorg are signaled without their UtxoOperations, but
+		// they've been stored by the time the event fires.
+		blockHash, err := event.Block.Hash()
+		if err != nil {
+			glog.Errorf("DAOCoinCandleIndex.HandleBlockCommitted: Problem hashing block: %v", err)
+			return
+		}
+		utxoOpsForBlock, err = GetUtxoOperationsForBlock(index.db, nil, blockHash)
+		if err != nil {
+			glog.Errorf("DAOCoinCandleIndex.HandleBlockCommitted: Problem getting UtxoOps for block %v: %v",
+				blockHash, err)
+			return
+		}
+	}
+	if err := index.ConnectBlock(event.Block, utxoOpsForBlock); err != nil {
+		glog.Errorf("DAOCoinCandleIndex.HandleBlockCommitted: %v", err)
+	}
+}
+
+func (index *DAOCoinCandleIndex) HandleBlockDisconnected(event *BlockEvent) {
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		glog.Errorf("DAOCoinCandleIndex.HandleBlockDisconnected: Problem hashing block: %v", err)
+		return
+	}
+	if err = index.DisconnectBlock(blockHash); err != nil {
+		glog.Errorf("DAOCoinCandleIndex.HandleBlockDisconnected: %v", err)
+	}
+}
+
+// ConnectBlock records the block's fills and folds them into the candles of every
+// interval. A block that has already been recorded is skipped.
+func (index *DAOCoinCandleIndex) ConnectBlock(block *MsgDeSoBlock, utxoOpsForBlock [][]*UtxoOperation) error {
+	trades, err := GetDAOCoinTradesForBlock(block, utxoOpsForBlock)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinCandleIndex.ConnectBlock: ")
+	}
+	if len(trades) == 0 {
+		return nil
+	}
+	blockHash := trades[0].BlockHash
+
+	index.mtx.Lock()
+	defer index.mtx.Unlock()
+
+	return index.db.Update(func(txn *badger.Txn) error {
+		blockKey := DBKeyForDAOCoinTradeKeysByBlockHash(blockHash)
+		if _, err := txn.Get(blockKey); err == nil {
+			return nil
+		} else if err != badger.ErrKeyNotFound {
+			return errors.Wrapf(err, "DAOCoinCandleIndex.ConnectBlock: Problem checking block %v: ", blockHash)
+		}
+
+		var tradeKeysBytes []byte
+		tradeKeysBytes = append(tradeKeysBytes, UintToBuf(uint64(len(trades)))...)
+		for _, trade := range trades {
+			tradeKey := DBKeyForDAOCoinTrade(trade)
+			if err := DBSetWithTxn(txn, nil, tradeKey, EncodeToBytes(0, trade), nil); err != nil {
+				return errors.Wrapf(err, "DAOCoinCandleIndex.ConnectBlock: Problem storing trade: ")
+			}
+			tradeKeysBytes = append(tradeKeysBytes, EncodeByteArray(tradeKey)...)
+
+			for _, interval := range DAOCoinCandleIntervals {
+				candle := newDAOCoinCandleForTrade(trade, interval)
+				candleKey := DBKeyForDAOCoinCandle(candle)
+				existingCandle, err := DBGetDAOCoinCandleWithTxn(txn, candleKey)
+				if err != nil {
+					return errors.Wrapf(err, "DAOCoinCandleIndex.ConnectBlock: ")
+				}
+				if existingCandle != nil {
+					candle = existingCandle
+				}
+				candle.addTrade(trade)
+				if err = DBSetWithTxn(txn, nil, candleKey, EncodeToBytes(0, candle), nil); err != nil {
+					return errors.Wrapf(err, "DAOCoinCandleIndex.ConnectBlock: Problem storing candle: ")
+				}
+			}
+		}
+		return DBSetWithTxn(txn, nil, blockKey, tradeKeysBytes, nil)
+	})
+}
+
+// DisconnectBlock removes the block's fills and recomputes the candles they were part of
+// from the fills that remain.
+func (index *DAOCoinCandleIndex) DisconnectBlock(blockHash *BlockHash) error {
+	index.mtx.Lock()
+	defer index.mtx.Unlock()
+
+	return index.db.Update(func(txn *badger.Txn) error {
+		blockKey := DBKeyForDAOCoinTradeKeysByBlockHash(blockHash)
+		tradeKeysBytes, err := DBGetWithTxn(txn, nil, blockKey)
+		if err == badger.ErrKeyNotFound {
+			// The block didn't have any fills, or was never recorded.
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem getting block %v: ", blockHash)
+		}
+
+		rr := bytes.NewReader(tradeKeysBytes)
+		numTrades, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem reading number of trades: ")
+		}
+		candlesToRecompute := make(map[string]*DAOCoinCandle)
+		for ii := uint64(0); ii < numTrades; ii++ {
+			tradeKey, err := DecodeByteArray(rr)
+			if err != nil {
+				return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem reading trade key: ")
+			}
+			tradeBytes, err := DBGetWithTxn(txn, nil, tradeKey)
+			if err != nil {
+				return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem getting trade: ")
+			}
+			trade, err := DecodeDeSoEncoder(&DAOCoinTrade{}, bytes.NewReader(tradeBytes))
+			if err != nil {
+				return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem decoding trade: ")
+			}
+			if err = DBDeleteWithTxn(txn, nil, tradeKey, nil, true); err != nil {
+				return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem deleting trade: ")
+			}
+			for _, interval := range DAOCoinCandleIntervals {
+				candle := newDAOCoinCandleForTrade(trade, interval)
+				candlesToRecompute[string(DBKeyForDAOCoinCandle(candle))] = candle
+			}
+		}
+
+		for candleKey, candle := range candlesToRecompute {
+			endTimestampNanoSecs := candle.StartTimestampNanoSecs + candle.IntervalSecs*uint64(time.Second)
+			trades, err := DBGetDAOCoinTradesWithTxn(txn, candle.GetPair(),
+				candle.StartTimestampNanoSecs, endTimestampNanoSecs, math.MaxInt32)
+			if err != nil {
+				return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: ")
+			}
+			if len(trades) == 0 {
+				if err = DBDeleteWithTxn(txn, nil, []byte(candleKey), nil, true); err != nil {
+					return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem deleting candle: ")
+				}
+				continue
+			}
+			for _, trade := range trades {
+				candle.addTrade(trade)
+			}
+			if err = DBSetWithTxn(txn, nil, []byte(candleKey), EncodeToBytes(0, candle), nil); err != nil {
+				return errors.Wrapf(err, "DAOCoinCandleIndex.DisconnectBlock: Problem storing candle: ")
+			}
+		}
+		return DBDeleteWithTxn(txn, nil, blockKey, nil, true)
+	})
+}
+
+// GetCandles returns the candles of the directed pair that buys the DAO coin of
+// buyingDAOCoinCreatorPKID and sells the DAO coin of sellingDAOCoinCreatorPKID, for one of
+// the DAOCoinCandleIntervals, starting in [startTimestampNanoSecs, endTimestampNanoSecs).
+// Use GetCandlesForPair for pairs that include a creator coin.
+func (index *DAOCoinCandleIndex) GetCandles(
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+	interval time.Duration,
+	startTimestampNanoSecs uint64,
+	endTimestampNanoSecs uint64,
+	limit int,
+) ([]*DAOCoinCandle, error) {
+	pair := &DAOCoinCandlePair{
+		BuyingDAOCoinCreatorPKID:  buyingDAOCoinCreatorPKID,
+		SellingDAOCoinCreatorPKID: sellingDAOCoinCreatorPKID,
+	}
+	return index.GetCandlesForPair(pair, interval, startTimestampNanoSecs, endTimestampNanoSecs, limit)
+}
+
+// GetCandlesForPair returns the candles of the directed pair for one of the
+// DAOCoinCandleIntervals, starting in [startTimestampNanoSecs, endTimestampNanoSecs).
+func (index *DAOCoinCandleIndex) GetCandlesForPair(
+	pair *DAOCoinCandlePair,
+	interval time.Duration,
+	startTimestampNanoSecs uint64,
+	endTimestampNanoSecs uint64,
+	limit int,
+) ([]*DAOCoinCandle, error) {
+	isSupportedInterval := false
+	for _, supportedInterval := range DAOCoinCandleIntervals {
+		isSupportedInterval = isSupportedInterval || supportedInterval == interval
+	}
+	if !isSupportedInterval {
+		return nil, fmt.Errorf("DAOCoinCandleIndex.GetCandlesForPair: Interval %v isn't one of %v",
+			interval, DAOCoinCandleIntervals)
+	}
+	if limit <= 0 || limit > MaxDAOCoinCandlesPerQuery {
+		limit = MaxDAOCoinCandlesPerQuery
+	}
+
+	var candles []*DAOCoinCandle
+	err := index.db.View(func(txn *badger.Txn) error {
+		var innerErr error
+		candles, innerErr = DBGetDAOCoinCandlesWithTxn(
+			txn, pair, interval, startTimestampNanoSecs, endTimestampNanoSecs, limit)
+		return innerErr
+	})
+	return candles, err
+}
+
+// GetTrades returns the individual fills of the directed pair of DAO coins with timestamps
+// in [startTimestampNanoSecs, endTimestampNanoSecs). Use GetTradesForPair for pairs that
+// include a creator coin.
+func (index *DAOCoinCandleIndex) GetTrades(
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+	startTimestampNanoSecs uint64,
+	endTimestampNanoSecs uint64,
+	limit int,
+) ([]*DAOCoinTrade, error) {
+	pair := &DAOCoinCandlePair{
+		BuyingDAOCoinCreatorPKID:  buyingDAOCoinCreatorPKID,
+		SellingDAOCoinCreatorPKID: sellingDAOCoinCreatorPKID,
+	}
+	return index.GetTradesForPair(pair, startTimestampNanoSecs, endTimestampNanoSecs, limit)
+}
+
+// GetTradesForPair returns the individual trades of the directed pair with timestamps in
+// [startTimestampNanoSecs, endTimestampNanoSecs).
+func (index *DAOCoinCandleIndex) GetTradesForPair(
+	pair *DAOCoinCandlePair,
+	startTimestampNanoSecs uint64,
+	endTimestampNanoSecs uint64,
+	limit int,
+) ([]*DAOCoinTrade, error) {
+	if limit <= 0 || limit > MaxDAOCoinCandlesPerQuery {
+		limit = MaxDAOCoinCandlesPerQuery
+	}
+
+	var trades []*DAOCoinTrade
+	err := index.db.View(func(txn *badger.Txn) error {
+		var innerErr error
+		trades, innerErr = DBGetDAOCoinTradesWithTxn(
+			txn, pair, startTimestampNanoSecs, endTimestampNanoSecs, limit)
+		return innerErr
+	})
+	return trades, err
+}
@@ -0,0 +1,179 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinCandleIndex(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	index := NewDAOCoinCandleIndex(db)
+
+	daoCoinPKID := NewPKID(m0PkBytes)
+	blockTimestamp := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	makeFill := func(bought uint64, sold uint64) *FilledDAOCoinLimitOrder {
+		return &FilledDAOCoinLimitOrder{
+			TransactorPKID:                NewPKID(m1PkBytes),
+			BuyingDAOCoinCreatorPKID:      daoCoinPKID,
+			SellingDAOCoinCreatorPKID:     &ZeroPKID,
+			CoinQuantityInBaseUnitsBought: uint256.NewInt().SetUint64(bought),
+			CoinQuantityInBaseUnitsSold:   uint256.NewInt().SetUint64(sold),
+		}
+	}
+	makeBlock := func(height uint64, timestamp time.Time) *MsgDeSoBlock {
+		return &MsgDeSoBlock{Header: &MsgDeSoHeader{
+			Version:               HeaderVersion1,
+			PrevBlockHash:         &BlockHash{},
+			TransactionMerkleRoot: &BlockHash{},
+			TstampNanoSecs:        timestamp.UnixNano(),
+			Height:                height,
+		}}
+	}
+
+	// The first block fills at prices 2 and 4, the second one at price 1 a minute later.
+	block1 := makeBlock(1, blockTimestamp)
+	utxoOps1 := [][]*UtxoOperation{{{
+		Type:                     OperationTypeDAOCoinLimitOrder,
+		FilledDAOCoinLimitOrders: []*FilledDAOCoinLimitOrder{makeFill(100, 200), makeFill(50, 200)},
+	}}}
+	require.NoError(index.ConnectBlock(block1, utxoOps1))
+	// Connecting the same block again doesn't count its fills twice.
+	require.NoError(index.ConnectBlock(block1, utxoOps1))
+	block2 := makeBlock(2, blockTimestamp.Add(time.Minute))
+	utxoOps2 := [][]*UtxoOperation{{{
+		Type:                     OperationTypeDAOCoinLimitOrder,
+		FilledDAOCoinLimitOrders: []*FilledDAOCoinLimitOrder{makeFill(300, 300)},
+	}}}
+	require.NoError(index.ConnectBlock(block2, utxoOps2))
+
+	scaledPrice := func(price uint64) *uint256.Int {
+		return uint256.NewInt().Mul(OneE38, uint256.NewInt().SetUint64(price))
+	}
+	startTimestamp := uint64(blockTimestamp.Add(-time.Hour).UnixNano())
+	endTimestamp := uint64(blockTimestamp.Add(time.Hour).UnixNano())
+
+	// Each block falls into its own minute candle.
+	minuteCandles, err := index.GetCandles(daoCoinPKID, &ZeroPKID, time.Minute, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Len(minuteCandles, 2)
+	require.Equal(uint64(2), minuteCandles[0].NumTrades)
+
+	// Both blocks fall into the same hour candle.
+	hourCandles, err := index.GetCandles(daoCoinPKID, &ZeroPKID, time.Hour, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Len(hourCandles, 1)
+	hourCandle := hourCandles[0]
+	require.Equal(uint64(blockTimestamp.Truncate(time.Hour).UnixNano()), hourCandle.StartTimestampNanoSecs)
+	require.True(hourCandle.OpenScaledPrice.Eq(scaledPrice(2)))
+	require.True(hourCandle.HighScaledPrice.Eq(scaledPrice(4)))
+	require.True(hourCandle.LowScaledPrice.Eq(scaledPrice(1)))
+	require.True(hourCandle.CloseScaledPrice.Eq(scaledPrice(1)))
+	require.True(hourCandle.VolumeInBaseUnitsBought.Eq(uint256.NewInt().SetUint64(450)))
+	require.True(hourCandle.VolumeInBaseUnitsSold.Eq(uint256.NewInt().SetUint64(700)))
+	require.Equal(uint64(3), hourCandle.NumTrades)
+
+	// The opposite direction of the pair has no candles, and unsupported intervals are rejected.
+	reverseCandles, err := index.GetCandles(&ZeroPKID, daoCoinPKID, time.Hour, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Empty(reverseCandles)
+	_, err = index.GetCandles(daoCoinPKID, &ZeroPKID, 2*time.Minute, startTimestamp, endTimestamp, 0)
+	require.Error(err)
+
+	// Disconnecting the second block recomputes the hour candle from the first block's fills.
+	block2Hash, err := block2.Hash()
+	require.NoError(err)
+	require.NoError(index.DisconnectBlock(block2Hash))
+	hourCandles, err = index.GetCandles(daoCoinPKID, &ZeroPKID, time.Hour, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Len(hourCandles, 1)
+	require.True(hourCandles[0].CloseScaledPrice.Eq(scaledPrice(4)))
+	require.True(hourCandles[0].LowScaledPrice.Eq(scaledPrice(2)))
+	require.Equal(uint64(2), hourCandles[0].NumTrades)
+	trades, err := index.GetTrades(daoCoinPKID, &ZeroPKID, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Len(trades, 2)
+
+	// Disconnecting the first block removes the candles entirely.
+	block1Hash, err := block1.Hash()
+	require.NoError(err)
+	require.NoError(index.DisconnectBlock(block1Hash))
+	hourCandles, err = index.GetCandles(daoCoinPKID, &ZeroPKID, time.Hour, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Empty(hourCandles)
+}
+
+func TestDAOCoinCandleIndexCreatorCoins(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	index := NewDAOCoinCandleIndex(db)
+
+	creatorPKID := NewPKID(m0PkBytes)
+	blockTimestamp := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	block := &MsgDeSoBlock{Header: &MsgDeSoHeader{
+		Version:               HeaderVersion1,
+		PrevBlockHash:         &BlockHash{},
+		TransactionMerkleRoot: &BlockHash{},
+		TstampNanoSecs:        blockTimestamp.UnixNano(),
+		Height:                1,
+	}}
+	// One txn buys 100 coins for 200 DESO nanos and another sells 50 coins for 50 DESO nanos.
+	makeCreatorCoinOp := func(coinsDiff int64, desoDiff int64) *UtxoOperation {
+		return &UtxoOperation{
+			Type:                           OperationTypeCreatorCoin,
+			PrevTransactorBalanceEntry:     &BalanceEntry{HODLerPKID: NewPKID(m1PkBytes), CreatorPKID: creatorPKID},
+			CreatorCoinNanosDiff:           coinsDiff,
+			CreatorCoinDESOLockedNanosDiff: desoDiff,
+		}
+	}
+	utxoOps := [][]*UtxoOperation{{makeCreatorCoinOp(100, 200)}, {makeCreatorCoinOp(-50, -50)}}
+	require.NoError(index.ConnectBlock(block, utxoOps))
+
+	startTimestamp := uint64(blockTimestamp.Add(-time.Hour).UnixNano())
+	endTimestamp := uint64(blockTimestamp.Add(time.Hour).UnixNano())
+	buyingCreatorCoinPair := &DAOCoinCandlePair{
+		BuyingDAOCoinCreatorPKID:  creatorPKID,
+		BuyingCoinIsCreatorCoin:   true,
+		SellingDAOCoinCreatorPKID: &ZeroPKID,
+	}
+	hourCandles, err := index.GetCandlesForPair(buyingCreatorCoinPair, time.Hour, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Len(hourCandles, 1)
+	require.True(hourCandles[0].BuyingCoinIsCreatorCoin)
+	require.True(hourCandles[0].OpenScaledPrice.Eq(uint256.NewInt().Mul(OneE38, uint256.NewInt().SetUint64(2))))
+	require.True(hourCandles[0].CloseScaledPrice.Eq(OneE38))
+	require.True(hourCandles[0].VolumeInBaseUnitsBought.Eq(uint256.NewInt().SetUint64(150)))
+	require.Equal(uint64(2), hourCandles[0].NumTrades)
+
+	// The trades are also recorded in the opposite direction.
+	sellingCreatorCoinPair := &DAOCoinCandlePair{
+		BuyingDAOCoinCreatorPKID:  &ZeroPKID,
+		SellingDAOCoinCreatorPKID: creatorPKID,
+		SellingCoinIsCreatorCoin:  true,
+	}
+	trades, err := index.GetTradesForPair(sellingCreatorCoinPair, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Len(trades, 2)
+	require.True(trades[0].CoinQuantityInBaseUnitsBought.Eq(uint256.NewInt().SetUint64(200)))
+
+	// The creator coin's trades aren't mixed up with those of the DAO coin of the same creator.
+	daoCoinCandles, err := index.GetCandles(creatorPKID, &ZeroPKID, time.Hour, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Empty(daoCoinCandles)
+
+	blockHash, err := block.Hash()
+	require.NoError(err)
+	require.NoError(index.DisconnectBlock(blockHash))
+	hourCandles, err = index.GetCandlesForPair(buyingCreatorCoinPair, time.Hour, startTimestamp, endTimestamp, 0)
+	require.NoError(err)
+	require.Empty(hourCandles)
+}
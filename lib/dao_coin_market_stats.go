@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// DAOCoinMarketStatsVolumeWindow is how far back GetMarketStats looks when summing a
+// pair's trading volume.
+const DAOCoinMarketStatsVolumeWindow = 24 * time.Hour
+
+// DAOCoinMarketStats summarizes the order book and recent trading of the directed pair
+// that buys the DAO coin of BuyingDAOCoinCreatorPKID (the base coin) and sells the DAO
+// coin of SellingDAOCoinCreatorPKID (the quote coin). Like the pair's candles, every
+// price is in quote coin base units per base coin base unit, scaled by 1e38.
+type DAOCoinMarketStats struct {
+	BuyingDAOCoinCreatorPKID  *PKID
+	SellingDAOCoinCreatorPKID *PKID
+
+	// Bids are the open orders that buy the base coin, and asks are the open orders
+	// that sell it. Expired orders and dormant stop-limit orders aren't counted.
+	NumBids uint64
+	NumAsks uint64
+	// The best prices are nil if their side of the book is empty.
+	BestBidScaledPrice *uint256.Int
+	BestAskScaledPrice *uint256.Int
+	// The mid-price and spread are nil unless both sides of the book have orders. The
+	// spread is zero if the book is crossed.
+	MidScaledPrice    *uint256.Int
+	SpreadScaledPrice *uint256.Int
+	SpreadBasisPoints uint64
+
+	// DepthBasisPoints is how far from the mid-price orders are counted towards the
+	// depth, which is the quantity of the base coin bid for within that distance below
+	// the mid-price and offered within that distance above it. Both depths are zero if
+	// there's no mid-price.
+	DepthBasisPoints    uint64
+	BidDepthInBaseUnits *uint256.Int
+	AskDepthInBaseUnits *uint256.Int
+
+	// LastTradeScaledPrice is nil if the pair hasn't traded.
+	LastTradeScaledPrice *uint256.Int
+
+	// The volume is summed from the pair's hourly candles over the last
+	// DAOCoinMarketStatsVolumeWindow, including the current hour. VolumeInBaseUnitsBought
+	// is in the base coin and VolumeInBaseUnitsSold is in the quote coin.
+	VolumeInBaseUnitsBought *uint256.Int
+	VolumeInBaseUnitsSold   *uint256.Int
+	NumTrades               uint64
+}
+
+// GetDAOCoinOrderBookStats fills in the order book half of the DAOCoinMarketStats for the
+// directed pair from the orders in the view as of blockHeight. The volume fields are
+// left at zero; use DAOCoinCandleIndex.GetMarketStats for those.
+func (bav *UtxoView) GetDAOCoinOrderBookStats(
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+	depthBasisPoints uint64,
+	blockHeight uint32,
+) (*DAOCoinMarketStats, error) {
+	if depthBasisPoints > MaxBasisPoints {
+		return nil, errors.Errorf("GetDAOCoinOrderBookStats: Depth %d basis points is more than %d",
+			depthBasisPoints, MaxBasisPoints)
+	}
+
+	// Stop-limit orders are dormant until the last trade price for their own direction
+	// of the pair reaches their trigger, so each side needs its own last trade price.
+	bidLastTradePrice, err := bav.GetDAOCoinLastTradePrice(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinOrderBookStats: ")
+	}
+	askLastTradePrice, err := bav.GetDAOCoinLastTradePrice(sellingDAOCoinCreatorPKID, buyingDAOCoinCreatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinOrderBookStats: ")
+	}
+
+	bidOrders, err := bav.GetAllDAOCoinLimitOrdersForThisDAOCoinPair(
+		buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinOrderBookStats: Problem getting bids: ")
+	}
+	askOrders, err := bav.GetAllDAOCoinLimitOrdersForThisDAOCoinPair(
+		sellingDAOCoinCreatorPKID, buyingDAOCoinCreatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinOrderBookStats: Problem getting asks: ")
+	}
+
+	// Asks are quoted for the opposite direction of the pair, so their prices are
+	// inverted and their quantity is what they sell rather than what they buy.
+	var bids, asks []*daoCoinMarketStatsLevel
+	for _, order := range FilterExpiredDAOCoinLimitOrders(bidOrders, blockHeight) {
+		if order.IsDormantStopOrder(bidLastTradePrice) {
+			continue
+		}
+		quantity, err := order.BaseUnitsToBuyUint256()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetDAOCoinOrderBookStats: Problem computing bid quantity: ")
+		}
+		bids = append(bids, &daoCoinMarketStatsLevel{
+			scaledPrice: order.ScaledExchangeRateCoinsToSellPerCoinToBuy,
+			quantity:    quantity,
+		})
+	}
+	for _, order := range FilterExpiredDAOCoinLimitOrders(askOrders, blockHeight) {
+		if order.IsDormantStopOrder(askLastTradePrice) {
+			continue
+		}
+		scaledPrice, err := InvertScaledExchangeRate(order.ScaledExchangeRateCoinsToSellPerCoinToBuy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetDAOCoinOrderBookStats: Problem inverting ask price: ")
+		}
+		quantity, err := order.BaseUnitsToSellUint256()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetDAOCoinOrderBookStats: Problem computing ask quantity: ")
+		}
+		asks = append(asks, &daoCoinMarketStatsLevel{scaledPrice: scaledPrice, quantity: quantity})
+	}
+
+	stats := computeDAOCoinOrderBookStats(bids, asks, depthBasisPoints)
+	stats.BuyingDAOCoinCreatorPKID = buyingDAOCoinCreatorPKID
+	stats.SellingDAOCoinCreatorPKID = sellingDAOCoinCreatorPKID
+	stats.LastTradeScaledPrice = bidLastTradePrice
+	return stats, nil
+}
+
+// GetMarketStats returns a one-call summary of the directed pair of DAO coins: its order
+// book as of blockHeight in utxoView, and its volume over the
+// DAOCoinMarketStatsVolumeWindow ending at timestampNanoSecs from the index's candles.
+func (index *DAOCoinCandleIndex) GetMarketStats(
+	utxoView *UtxoView,
+	buyingDAOCoinCreatorPKID *PKID,
+	sellingDAOCoinCreatorPKID *PKID,
+	depthBasisPoints uint64,
+	blockHeight uint32,
+	timestampNanoSecs uint64,
+) (*DAOCoinMarketStats, error) {
+	stats, err := utxoView.GetDAOCoinOrderBookStats(
+		buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID, depthBasisPoints, blockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DAOCoinCandleIndex.GetMarketStats: ")
+	}
+
+	// Every fill is recorded on both directions of the pair, so the candles of this
+	// direction alone account for all of its trades.
+	endTimestampNanoSecs := GetDAOCoinCandleStartTimestampNanoSecs(timestampNanoSecs, time.Hour) +
+		uint64(time.Hour)
+	startTimestampNanoSecs := uint64(0)
+	if endTimestampNanoSecs > uint64(DAOCoinMarketStatsVolumeWindow) {
+		startTimestampNanoSecs = endTimestampNanoSecs - uint64(DAOCoinMarketStatsVolumeWindow)
+	}
+	candles, err := index.GetCandles(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID,
+		time.Hour, startTimestampNanoSecs, endTimestampNanoSecs, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DAOCoinCandleIndex.GetMarketStats: Problem getting candles: ")
+	}
+	for _, candle := range candles {
+		stats.VolumeInBaseUnitsBought = _addDAOCoinCandleVolume(
+			stats.VolumeInBaseUnitsBought, candle.VolumeInBaseUnitsBought)
+		stats.VolumeInBaseUnitsSold = _addDAOCoinCandleVolume(
+			stats.VolumeInBaseUnitsSold, candle.VolumeInBaseUnitsSold)
+		stats.NumTrades += candle.NumTrades
+	}
+	return stats, nil
+}
+
+// daoCoinMarketStatsLevel is one order's price and quantity in the base coin, expressed
+// for the direction of the pair the stats are computed for.
+type daoCoinMarketStatsLevel struct {
+	scaledPrice *uint256.Int
+	quantity    *uint256.Int
+}
+
+func computeDAOCoinOrderBookStats(
+	bids []*daoCoinMarketStatsLevel,
+	asks []*daoCoinMarketStatsLevel,
+	depthBasisPoints uint64,
+) *DAOCoinMarketStats {
+	stats := &DAOCoinMarketStats{
+		NumBids:                 uint64(len(bids)),
+		NumAsks:                 uint64(len(asks)),
+		DepthBasisPoints:        depthBasisPoints,
+		BidDepthInBaseUnits:     uint256.NewInt(),
+		AskDepthInBaseUnits:     uint256.NewInt(),
+		VolumeInBaseUnitsBought: uint256.NewInt(),
+		VolumeInBaseUnitsSold:   uint256.NewInt(),
+	}
+	for _, bid := range bids {
+		if stats.BestBidScaledPrice == nil || bid.scaledPrice.Gt(stats.BestBidScaledPrice) {
+			stats.BestBidScaledPrice = bid.scaledPrice.Clone()
+		}
+	}
+	for _, ask := range asks {
+		if stats.BestAskScaledPrice == nil || ask.scaledPrice.Lt(stats.BestAskScaledPrice) {
+			stats.BestAskScaledPrice = ask.scaledPrice.Clone()
+		}
+	}
+	if stats.BestBidScaledPrice == nil || stats.BestAskScaledPrice == nil {
+		return stats
+	}
+
+	// The sum of two prices can overflow a uint256, so the mid-price and the depth
+	// bounds are computed with big.Ints.
+	bestBid := stats.BestBidScaledPrice.ToBig()
+	bestAsk := stats.BestAskScaledPrice.ToBig()
+	mid := big.NewInt(0).Add(bestBid, bestAsk)
+	mid.Rsh(mid, 1)
+	stats.MidScaledPrice, _ = uint256.FromBig(mid)
+
+	stats.SpreadScaledPrice = uint256.NewInt()
+	if stats.BestAskScaledPrice.Gt(stats.BestBidScaledPrice) {
+		stats.SpreadScaledPrice = uint256.NewInt().Sub(stats.BestAskScaledPrice, stats.BestBidScaledPrice)
+		if mid.Sign() > 0 {
+			spreadBasisPoints := big.NewInt(0).Mul(
+				stats.SpreadScaledPrice.ToBig(), big.NewInt(0).SetUint64(MaxBasisPoints))
+			stats.SpreadBasisPoints = spreadBasisPoints.Div(spreadBasisPoints, mid).Uint64()
+		}
+	}
+
+	// A bid is within the depth if price * 1e4 >= mid * (1e4 - depth), and an ask is
+	// if price * 1e4 <= mid * (1e4 + depth).
+	maxBasisPoints := big.NewInt(0).SetUint64(MaxBasisPoints)
+	minBidPrice := big.NewInt(0).Mul(mid, big.NewInt(0).SetUint64(MaxBasisPoints-depthBasisPoints))
+	maxAskPrice := big.NewInt(0).Mul(mid, big.NewInt(0).SetUint64(MaxBasisPoints+depthBasisPoints))
+	for _, bid := range bids {
+		if big.NewInt(0).Mul(bid.scaledPrice.ToBig(), maxBasisPoints).Cmp(minBidPrice) >= 0 {
+			stats.BidDepthInBaseUnits = _addDAOCoinCandleVolume(stats.BidDepthInBaseUnits, bid.quantity)
+		}
+	}
+	for _, ask := range asks {
+		if big.NewInt(0).Mul(ask.scaledPrice.ToBig(), maxBasisPoints).Cmp(maxAskPrice) <= 0 {
+			stats.AskDepthInBaseUnits = _addDAOCoinCandleVolume(stats.AskDepthInBaseUnits, ask.quantity)
+		}
+	}
+	return stats
+}
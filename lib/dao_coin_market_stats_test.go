@@ -0,0 +1,272 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinMarketStats(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	index := NewDAOCoinCandleIndex(db)
+
+	// The stats are for the pair that buys m0's DAO coin with $DESO, so prices are in $DESO
+	// nanos per m0 DAO coin base unit.
+	daoCoinPKID := NewPKID(m0PkBytes)
+	transactorPKID := NewPKID(m1PkBytes)
+	blockHeight := uint32(10)
+	scaledPrice := func(price string) *uint256.Int {
+		scaledPrice, err := CalculateScaledExchangeRateFromString(price)
+		require.NoError(err)
+		return scaledPrice
+	}
+
+	// A level is an order at a price in $DESO nanos per DAO coin base unit, for a quantity of
+	// DAO coin base units. Asks are placed on the opposite direction of the pair, so their
+	// price is inverted when the order is created.
+	type level struct {
+		price    string
+		quantity uint64
+		// expired orders and dormant stop orders aren't part of the book.
+		expired bool
+		dormant bool
+	}
+	nextOrderID := byte(0)
+	makeOrder := func(lvl level, isBid bool) *DAOCoinLimitOrderEntry {
+		nextOrderID++
+		order := &DAOCoinLimitOrderEntry{
+			OrderID:                   NewBlockHash(append(make([]byte, HashSizeBytes-1), nextOrderID)),
+			TransactorPKID:            transactorPKID,
+			BuyingDAOCoinCreatorPKID:  daoCoinPKID,
+			SellingDAOCoinCreatorPKID: &ZeroPKID,
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: scaledPrice(lvl.price),
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(lvl.quantity),
+			OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+			BlockHeight:                               blockHeight - 1,
+		}
+		if !isBid {
+			invertedPrice, err := InvertScaledExchangeRate(order.ScaledExchangeRateCoinsToSellPerCoinToBuy)
+			require.NoError(err)
+			order.BuyingDAOCoinCreatorPKID = &ZeroPKID
+			order.SellingDAOCoinCreatorPKID = daoCoinPKID
+			order.ScaledExchangeRateCoinsToSellPerCoinToBuy = invertedPrice
+			order.OperationType = DAOCoinLimitOrderOperationTypeASK
+		}
+		if lvl.expired {
+			order.ExpirationBlockHeight = blockHeight
+		}
+		if lvl.dormant {
+			order.StopTriggerScaledPrice = scaledPrice("1")
+		}
+		return order
+	}
+
+	testCases := []struct {
+		name             string
+		bids             []level
+		asks             []level
+		depthBasisPoints uint64
+		// The expected prices are empty if they should be nil.
+		bestBid           string
+		bestAsk           string
+		mid               string
+		spread            string
+		spreadBasisPoints uint64
+		bidDepth          uint64
+		askDepth          uint64
+	}{
+		{
+			name:             "empty book",
+			depthBasisPoints: 1000,
+		},
+		{
+			name:             "bids only",
+			bids:             []level{{price: "4", quantity: 100}, {price: "2", quantity: 50}},
+			depthBasisPoints: 1000,
+			bestBid:          "4",
+		},
+		{
+			name:             "asks only",
+			asks:             []level{{price: "5", quantity: 30}, {price: "8", quantity: 70}},
+			depthBasisPoints: 1000,
+			bestAsk:          "5",
+		},
+		{
+			// The mid-price is 4.5, so the depth counts bids down to 3.6 and asks up to 5.4.
+			name:              "depth within 20%",
+			bids:              []level{{price: "4", quantity: 100}, {price: "2", quantity: 50}},
+			asks:              []level{{price: "5", quantity: 30}, {price: "8", quantity: 70}, {price: "10", quantity: 40}},
+			depthBasisPoints:  2000,
+			bestBid:           "4",
+			bestAsk:           "5",
+			mid:               "4.5",
+			spread:            "1",
+			spreadBasisPoints: 2222,
+			bidDepth:          100,
+			askDepth:          30,
+		},
+		{
+			// The depth counts every bid and the asks up to 9.
+			name:              "depth within 100%",
+			bids:              []level{{price: "4", quantity: 100}, {price: "2", quantity: 50}},
+			asks:              []level{{price: "5", quantity: 30}, {price: "8", quantity: 70}, {price: "10", quantity: 40}},
+			depthBasisPoints:  MaxBasisPoints,
+			bestBid:           "4",
+			bestAsk:           "5",
+			mid:               "4.5",
+			spread:            "1",
+			spreadBasisPoints: 2222,
+			bidDepth:          150,
+			askDepth:          100,
+		},
+		{
+			// Orders at the same price as the mid-price are within a depth of zero.
+			name:              "zero depth",
+			bids:              []level{{price: "5", quantity: 100}, {price: "4", quantity: 50}},
+			asks:              []level{{price: "5", quantity: 30}},
+			bestBid:           "5",
+			bestAsk:           "5",
+			mid:               "5",
+			spread:            "0",
+			spreadBasisPoints: 0,
+			bidDepth:          100,
+			askDepth:          30,
+		},
+		{
+			name:              "crossed book",
+			bids:              []level{{price: "6", quantity: 10}},
+			asks:              []level{{price: "5", quantity: 20}},
+			depthBasisPoints:  1000,
+			bestBid:           "6",
+			bestAsk:           "5",
+			mid:               "5.5",
+			spread:            "0",
+			spreadBasisPoints: 0,
+			bidDepth:          10,
+			askDepth:          20,
+		},
+		{
+			// The expired bid and the dormant ask would otherwise be the best prices.
+			name: "expired and dormant orders",
+			bids: []level{{price: "4", quantity: 100}, {price: "4.8", quantity: 500, expired: true}},
+			asks: []level{
+				{price: "5", quantity: 30}, {price: "4.2", quantity: 500, dormant: true},
+				{price: "4.4", quantity: 500, expired: true},
+			},
+			depthBasisPoints:  2000,
+			bestBid:           "4",
+			bestAsk:           "5",
+			mid:               "4.5",
+			spread:            "1",
+			spreadBasisPoints: 2222,
+			bidDepth:          100,
+			askDepth:          30,
+		},
+	}
+	requirePrice := func(expected string, actual *uint256.Int, name string) {
+		if expected == "" {
+			require.Nil(actual, name)
+			return
+		}
+		require.NotNil(actual, name)
+		require.Equal(scaledPrice(expected).Hex(), actual.Hex(), name)
+	}
+	for _, testCase := range testCases {
+		utxoView := NewUtxoView(db, &params, nil, nil, nil)
+		for _, bid := range testCase.bids {
+			utxoView._setDAOCoinLimitOrderEntryMappings(makeOrder(bid, true))
+		}
+		for _, ask := range testCase.asks {
+			utxoView._setDAOCoinLimitOrderEntryMappings(makeOrder(ask, false))
+		}
+		stats, err := index.GetMarketStats(
+			utxoView, daoCoinPKID, &ZeroPKID, testCase.depthBasisPoints, blockHeight, 0)
+		require.NoError(err, testCase.name)
+		require.Equal(daoCoinPKID, stats.BuyingDAOCoinCreatorPKID, testCase.name)
+		require.Equal(&ZeroPKID, stats.SellingDAOCoinCreatorPKID, testCase.name)
+		numBids, numAsks := uint64(0), uint64(0)
+		for _, bid := range testCase.bids {
+			if !bid.expired && !bid.dormant {
+				numBids++
+			}
+		}
+		for _, ask := range testCase.asks {
+			if !ask.expired && !ask.dormant {
+				numAsks++
+			}
+		}
+		require.Equal(numBids, stats.NumBids, testCase.name)
+		require.Equal(numAsks, stats.NumAsks, testCase.name)
+		requirePrice(testCase.bestBid, stats.BestBidScaledPrice, testCase.name)
+		requirePrice(testCase.bestAsk, stats.BestAskScaledPrice, testCase.name)
+		requirePrice(testCase.mid, stats.MidScaledPrice, testCase.name)
+		requirePrice(testCase.spread, stats.SpreadScaledPrice, testCase.name)
+		require.Equal(testCase.spreadBasisPoints, stats.SpreadBasisPoints, testCase.name)
+		require.Equal(testCase.depthBasisPoints, stats.DepthBasisPoints, testCase.name)
+		require.Equal(testCase.bidDepth, stats.BidDepthInBaseUnits.Uint64(), testCase.name)
+		require.Equal(testCase.askDepth, stats.AskDepthInBaseUnits.Uint64(), testCase.name)
+		require.Nil(stats.LastTradeScaledPrice, testCase.name)
+		require.True(stats.VolumeInBaseUnitsBought.IsZero(), testCase.name)
+		require.True(stats.VolumeInBaseUnitsSold.IsZero(), testCase.name)
+		require.Zero(stats.NumTrades, testCase.name)
+	}
+
+	// A depth of more than 100% is rejected.
+	_, err := index.GetMarketStats(
+		NewUtxoView(db, &params, nil, nil, nil), daoCoinPKID, &ZeroPKID, MaxBasisPoints+1, blockHeight, 0)
+	require.Error(err)
+
+	// The volume only counts the trades within the last day.
+	blockTimestamp := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	block := &MsgDeSoBlock{Header: &MsgDeSoHeader{
+		Version:               HeaderVersion1,
+		PrevBlockHash:         &BlockHash{},
+		TransactionMerkleRoot: &BlockHash{},
+		TstampNanoSecs:        blockTimestamp.UnixNano(),
+		Height:                uint64(blockHeight),
+	}}
+	require.NoError(index.ConnectBlock(block, [][]*UtxoOperation{{{
+		Type: OperationTypeDAOCoinLimitOrder,
+		FilledDAOCoinLimitOrders: []*FilledDAOCoinLimitOrder{
+			{
+				TransactorPKID:                transactorPKID,
+				BuyingDAOCoinCreatorPKID:      daoCoinPKID,
+				SellingDAOCoinCreatorPKID:     &ZeroPKID,
+				CoinQuantityInBaseUnitsBought: uint256.NewInt().SetUint64(100),
+				CoinQuantityInBaseUnitsSold:   uint256.NewInt().SetUint64(400),
+			},
+			{
+				TransactorPKID:                transactorPKID,
+				BuyingDAOCoinCreatorPKID:      daoCoinPKID,
+				SellingDAOCoinCreatorPKID:     &ZeroPKID,
+				CoinQuantityInBaseUnitsBought: uint256.NewInt().SetUint64(50),
+				CoinQuantityInBaseUnitsSold:   uint256.NewInt().SetUint64(250),
+			},
+		},
+	}}}))
+	for _, timestamp := range []time.Time{
+		blockTimestamp, blockTimestamp.Add(23 * time.Hour), blockTimestamp.Add(24 * time.Hour),
+	} {
+		stats, err := index.GetMarketStats(NewUtxoView(db, &params, nil, nil, nil),
+			daoCoinPKID, &ZeroPKID, 1000, blockHeight, uint64(timestamp.UnixNano()))
+		require.NoError(err)
+		if timestamp.Sub(blockTimestamp) < 24*time.Hour {
+			require.Equal(uint64(150), stats.VolumeInBaseUnitsBought.Uint64())
+			require.Equal(uint64(650), stats.VolumeInBaseUnitsSold.Uint64())
+			require.Equal(uint64(2), stats.NumTrades)
+		} else {
+			require.True(stats.VolumeInBaseUnitsBought.IsZero())
+			require.True(stats.VolumeInBaseUnitsSold.IsZero())
+			require.Zero(stats.NumTrades)
+		}
+	}
+}
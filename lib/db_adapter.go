@@ -1,576 +1,422 @@
 package lib
 
 import (
-	"bytes"
+	"fmt"
 	"sort"
+	"sync"
 
+	"github.com/deso-protocol/core/bls"
 	"github.com/dgraph-io/badger/v3"
-	"github.com/golang/glog"
+	"github.com/holiman/uint256"
 	"github.com/pkg/errors"
 )
 
-type DbAdapter struct {
-	badgerDb   *badger.DB
-	postgresDb *Postgres
-	snapshot   *Snapshot
-}
-
-func (bc *Blockchain) NewDbAdapter() *DbAdapter {
-	return &DbAdapter{
-		badgerDb:   bc.db,
-		postgresDb: bc.postgres,
-		snapshot:   bc.snapshot,
-	}
-}
-
-func (bav *UtxoView) GetDbAdapter() *DbAdapter {
-	snap := bav.Snapshot
-	if bav.Postgres != nil {
-		snap = nil
-	}
-	return &DbAdapter{
-		badgerDb:   bav.Handle,
-		postgresDb: bav.Postgres,
-		snapshot:   snap,
-	}
-}
-
-//
-// Associations
-//
-
-func (adapter *DbAdapter) GetUserAssociationByID(associationID *BlockHash) (*UserAssociationEntry, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetUserAssociationByID(associationID)
-	}
-	return DBGetUserAssociationByID(adapter.badgerDb, adapter.snapshot, associationID)
-}
-
-func (adapter *DbAdapter) GetPostAssociationByID(associationID *BlockHash) (*PostAssociationEntry, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetPostAssociationByID(associationID)
-	}
-	return DBGetPostAssociationByID(adapter.badgerDb, adapter.snapshot, associationID)
-}
-
-func (adapter *DbAdapter) GetUserAssociationByAttributes(associationEntry *UserAssociationEntry) (*UserAssociationEntry, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetUserAssociationByAttributes(associationEntry)
-	}
-	return DBGetUserAssociationByAttributes(adapter.badgerDb, adapter.snapshot, associationEntry)
-}
-
-func (adapter *DbAdapter) GetPostAssociationByAttributes(associationEntry *PostAssociationEntry) (*PostAssociationEntry, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetPostAssociationByAttributes(associationEntry)
-	}
-	return DBGetPostAssociationByAttributes(adapter.badgerDb, adapter.snapshot, associationEntry)
-}
-
-func (adapter *DbAdapter) GetUserAssociationsByAttributes(
-	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
-) ([]*UserAssociationEntry, []byte, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetUserAssociationsByAttributes(associationQuery, utxoViewAssociationIds)
-	}
-	return DBGetUserAssociationsByAttributes(adapter.badgerDb, adapter.snapshot, associationQuery, utxoViewAssociationIds)
-}
-
-func (adapter *DbAdapter) GetPostAssociationsByAttributes(
-	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
-) ([]*PostAssociationEntry, []byte, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetPostAssociationsByAttributes(associationQuery, utxoViewAssociationIds)
-	}
-	return DBGetPostAssociationsByAttributes(adapter.badgerDb, adapter.snapshot, associationQuery, utxoViewAssociationIds)
-}
-
-func (adapter *DbAdapter) GetUserAssociationIdsByAttributes(
-	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
-) (*Set[BlockHash], []byte, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetUserAssociationIdsByAttributes(associationQuery, utxoViewAssociationIds)
-	}
-	return DBGetUserAssociationIdsByAttributes(adapter.badgerDb, adapter.snapshot, associationQuery, utxoViewAssociationIds)
-}
-
-func (adapter *DbAdapter) GetPostAssociationIdsByAttributes(
-	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
-) (*Set[BlockHash], []byte, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetPostAssociationIdsByAttributes(associationQuery, utxoViewAssociationIds)
-	}
-	return DBGetPostAssociationIdsByAttributes(adapter.badgerDb, adapter.snapshot, associationQuery, utxoViewAssociationIds)
-}
-
-func (adapter *DbAdapter) SortUserAssociationEntriesByPrefix(
-	associationEntries []*UserAssociationEntry,
-	prefixType []byte,
-	sortDescending bool,
-) ([]*UserAssociationEntry, error) {
-	// Postgres sorts results by AssociationID.
-	if adapter.postgresDb != nil {
-		sort.Slice(associationEntries, func(ii int, jj int) bool {
-			byteComparison := bytes.Compare(
-				associationEntries[ii].AssociationID.ToBytes(),
-				associationEntries[jj].AssociationID.ToBytes(),
-			)
-			if sortDescending {
-				return byteComparison > 0
-			}
-			return byteComparison <= 0
-		})
-		return associationEntries, nil
-	}
-
-	// Badger sorts results by the key prefix.
-	var innerErr error
-	sort.Slice(associationEntries, func(ii int, jj int) bool {
-		keyII, err := DBKeyForUserAssociationByPrefix(associationEntries[ii], prefixType)
-		if err != nil {
-			innerErr = err
-			return false
-		}
-		keyJJ, err := DBKeyForUserAssociationByPrefix(associationEntries[jj], prefixType)
-		if err != nil {
-			innerErr = err
-			return false
-		}
-		byteComparison := bytes.Compare(keyII, keyJJ)
-		if sortDescending {
-			return byteComparison > 0
-		}
-		return byteComparison <= 0
-	})
-	if innerErr != nil {
-		return nil, errors.Wrapf(innerErr, "SortUserAssociationEntriesByPrefix: ")
-	}
-	return associationEntries, nil
-}
-
-func (adapter *DbAdapter) SortPostAssociationEntriesByPrefix(
-	associationEntries []*PostAssociationEntry,
-	prefixType []byte,
-	sortDescending bool,
-) ([]*PostAssociationEntry, error) {
-	// Postgres sorts results by AssociationID.
-	if adapter.postgresDb != nil {
-		sort.Slice(associationEntries, func(ii int, jj int) bool {
-			byteComparison := bytes.Compare(
-				associationEntries[ii].AssociationID.ToBytes(),
-				associationEntries[jj].AssociationID.ToBytes(),
-			)
-			if sortDescending {
-				return byteComparison > 0
-			}
-			return byteComparison <= 0
-		})
-		return associationEntries, nil
-	}
-
-	// Badger sorts results by the key prefix.
-	var innerErr error
-	sort.Slice(associationEntries, func(ii int, jj int) bool {
-		keyII, err := DBKeyForPostAssociationByPrefix(associationEntries[ii], prefixType)
-		if err != nil {
-			innerErr = err
-			return false
-		}
-		keyJJ, err := DBKeyForPostAssociationByPrefix(associationEntries[jj], prefixType)
-		if err != nil {
-			innerErr = err
-			return false
-		}
-		byteComparison := bytes.Compare(keyII, keyJJ)
-		if sortDescending {
-			return byteComparison > 0
-		}
-		return byteComparison <= 0
-	})
-	if innerErr != nil {
-		return nil, errors.Wrapf(innerErr, "SortPostAssociationEntriesByPrefix: ")
-	}
-	return associationEntries, nil
-}
-
-//
-// Balance entry
-//
-
-func (adapter *DbAdapter) GetBalanceEntry(holder *PKID, creator *PKID, isDAOCoin bool) *BalanceEntry {
-	if adapter.postgresDb != nil {
-		if isDAOCoin {
-			return adapter.postgresDb.GetDAOCoinBalance(holder, creator).NewBalanceEntry()
-		}
-
-		return adapter.postgresDb.GetCreatorCoinBalance(holder, creator).NewBalanceEntry()
-	}
-
-	return DbGetBalanceEntry(adapter.badgerDb, adapter.snapshot, holder, creator, isDAOCoin)
-}
-
-//
-// Derived keys
-//
-
-func (adapter *DbAdapter) GetOwnerToDerivedKeyMapping(ownerPublicKey PublicKey, derivedPublicKey PublicKey) *DerivedKeyEntry {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetDerivedKey(&ownerPublicKey, &derivedPublicKey).NewDerivedKeyEntry()
-	}
-
-	return DBGetOwnerToDerivedKeyMapping(adapter.badgerDb, adapter.snapshot, ownerPublicKey, derivedPublicKey)
-}
-
+// The DbAdapter is how the UtxoView and the Blockchain read entries that aren't in the view
+// from the DB. It used to check whether the node ran with Postgres in every getter, which
+// meant supporting another storage engine required touching all of them. The getters are
+// now defined by the StorageBackend interface instead, with one implementation per engine:
 //
-// DAO coin limit order
+//   - BadgerStorageBackend reads everything from badger.
+//   - PostgresStorageBackend reads the entries Postgres nodes keep in Postgres from Postgres,
+//     and everything else from badger.
 //
-
-func (adapter *DbAdapter) GetDAOCoinLimitOrder(orderID *BlockHash) (*DAOCoinLimitOrderEntry, error) {
-	// Temporarily use badger to support DAO Coin limit order DB operations
-	//if adapter.postgresDb != nil {
-	//	return adapter.postgresDb.GetDAOCoinLimitOrder(orderID)
-	//}
-
-	return DBGetDAOCoinLimitOrder(adapter.badgerDb, adapter.snapshot, orderID)
-}
-
-func (adapter *DbAdapter) GetAllDAOCoinLimitOrders() ([]*DAOCoinLimitOrderEntry, error) {
-	// This function is currently used for testing purposes only.
-	// Temporarily use badger to support DAO Coin limit order DB operations
-	//if adapter.postgresDb != nil {
-	//	return adapter.postgresDb.GetAllDAOCoinLimitOrders()
-	//}
-
-	return DBGetAllDAOCoinLimitOrders(adapter.badgerDb)
-}
-
-func (adapter *DbAdapter) GetAllDAOCoinLimitOrdersForThisDAOCoinPair(buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID) ([]*DAOCoinLimitOrderEntry, error) {
-	// Temporarily use badger to support DAO Coin limit order DB operations
-	//if adapter.postgresDb != nil {
-	//	return adapter.postgresDb.GetAllDAOCoinLimitOrdersForThisDAOCoinPair(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
-	//}
-
-	return DBGetAllDAOCoinLimitOrdersForThisDAOCoinPair(adapter.badgerDb, buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
-}
-
-func (adapter *DbAdapter) GetAllDAOCoinLimitOrdersForThisTransactor(
-	transactorPKID *PKID,
-	buyingCoinPkid *PKID,
-	sellingCoinPkid *PKID,
-) (
-	[]*DAOCoinLimitOrderEntry,
-	error,
-) {
-
-	// Temporarily use badger to support DAO Coin limit order DB operations
-	//if adapter.postgresDb != nil {
-	//	return adapter.postgresDb.GetAllDAOCoinLimitOrdersForThisTransactor(transactorPKID)
-	//}
-
-	return DBGetAllDAOCoinLimitOrdersForThisTransactor(
-		adapter.badgerDb, transactorPKID, buyingCoinPkid, sellingCoinPkid)
-}
-
-func (adapter *DbAdapter) GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimitOrderEntry, lastSeenOrder *DAOCoinLimitOrderEntry, orderEntriesInView map[DAOCoinLimitOrderMapKey]bool) ([]*DAOCoinLimitOrderEntry, error) {
-	// Temporarily use badger to support DAO Coin limit order DB operations
-	//if adapter.postgresDb != nil {
-	//	return adapter.postgresDb.GetMatchingDAOCoinLimitOrders(inputOrder, lastSeenOrder, orderEntriesInView)
-	//}
-
-	var outputOrders []*DAOCoinLimitOrderEntry
-	var err error
-
-	err = adapter.badgerDb.View(func(txn *badger.Txn) error {
-		outputOrders, err = DBGetMatchingDAOCoinLimitOrders(txn, inputOrder, lastSeenOrder, orderEntriesInView)
-		return err
-	})
-
-	return outputOrders, err
-}
-
+// Other engines, like RocksDB or FoundationDB, can be plugged in by registering a
+// StorageBackendFactory with RegisterStorageBackend, creating a backend with
+// NewStorageBackend, and passing it to NewServer. The Blockchain keeps the backend, and the
+// DbAdapters and UtxoViews it creates read from it. Writes still go through
+// UtxoView.FlushToDb, so a backend has to be kept in sync with the chain by the code that
+// registers it, e.g. through the EventManager's OnUtxoViewFlushed hooks.
 //
-// PKID
+// A few places in the UtxoView still check for Postgres directly because they aren't
+// lookups of entries missing from the view:
 //
-
-func (adapter *DbAdapter) GetPKIDForPublicKey(pkBytes []byte) *PKID {
-	if adapter.postgresDb != nil {
-		profile := adapter.postgresDb.GetProfileForPublicKey(pkBytes)
-		if profile == nil {
-			return NewPKID(pkBytes)
-		}
-		return profile.PKID
-	}
-
-	return DBGetPKIDEntryForPublicKey(adapter.badgerDb, adapter.snapshot, pkBytes).PKID
+//   - FlushToDb and the private message connect logic, which write to Postgres.
+//   - SwapIdentity, which saves the empty profiles Postgres uses in place of PKID mappings.
+//   - Preload, the immature block reward scan in GetSpendableDeSoBalanceNanosForPublicKey,
+//     and GetPostsPaginatedForPublicKeyOrderedByTimestamp, which use queries only Postgres has.
+
+// StorageBackend is a storage engine the DbAdapter reads from. It's made up of raw key-value
+// access to the badger keyspace (see db_utils.go for the prefixes) and typed getters for the
+// entries the UtxoView looks up.
+type StorageBackend interface {
+	// Name identifies the backend in logs.
+	Name() string
+
+	//
+	// Key-value access
+	//
+
+	// GetValue returns the value stored under the key, or nil if there isn't one.
+	GetValue(key []byte) ([]byte, error)
+	// IteratePrefix returns the entries under the prefix, starting with startKey, until
+	// roughly targetBytes of entries have been read. It also returns whether the target was
+	// reached, which means there may be more entries after the last one returned.
+	IteratePrefix(prefix []byte, startKey []byte, targetBytes uint32) (
+		_entries []*DBEntry, _isChunkFull bool, _err error)
+	// GetKeysForPrefix returns the keys under the prefix.
+	GetKeysForPrefix(prefix []byte) ([][]byte, error)
+	// IterateKeys calls handleKey with the keys under the prefix, starting with startKey, in
+	// order or in reverse order if reverse is set, until handleKey returns false or an error.
+	// The key is only valid until handleKey returns.
+	IterateKeys(prefix []byte, startKey []byte, reverse bool, handleKey func(key []byte) (bool, error)) error
+
+	//
+	// Associations
+	//
+
+	GetUserAssociationByID(associationID *BlockHash) (*UserAssociationEntry, error)
+	GetPostAssociationByID(associationID *BlockHash) (*PostAssociationEntry, error)
+	GetUserAssociationByAttributes(associationEntry *UserAssociationEntry) (*UserAssociationEntry, error)
+	GetPostAssociationByAttributes(associationEntry *PostAssociationEntry) (*PostAssociationEntry, error)
+	GetUserAssociationsByAttributes(associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash]) (
+		[]*UserAssociationEntry, []byte, error)
+	GetPostAssociationsByAttributes(associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash]) (
+		[]*PostAssociationEntry, []byte, error)
+	GetUserAssociationIdsByAttributes(associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash]) (
+		*Set[BlockHash], []byte, error)
+	GetPostAssociationIdsByAttributes(associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash]) (
+		*Set[BlockHash], []byte, error)
+	// SortUserAssociationEntriesByPrefix and SortPostAssociationEntriesByPrefix sort entries
+	// merged from the view and the DB in the order the backend returns them in.
+	SortUserAssociationEntriesByPrefix(associationEntries []*UserAssociationEntry, prefixType []byte,
+		sortDescending bool) ([]*UserAssociationEntry, error)
+	SortPostAssociationEntriesByPrefix(associationEntries []*PostAssociationEntry, prefixType []byte,
+		sortDescending bool) ([]*PostAssociationEntry, error)
+
+	//
+	// Balances, PKIDs, and derived keys
+	//
+
+	GetBalanceEntry(holder *PKID, creator *PKID, isDAOCoin bool) *BalanceEntry
+	GetBalanceEntriesYouHold(pkid *PKID, isDAOCoin bool) ([]*BalanceEntry, error)
+	GetBalanceEntriesHodlingYou(pkid *PKID, isDAOCoin bool) ([]*BalanceEntry, error)
+	// GetDAOCoinHoldersByBalance returns up to limit holders of the DAO coin with a non-zero
+	// balance, largest balance first, starting right after lastHolder if it's set.
+	GetDAOCoinHoldersByBalance(creatorPKID *PKID, lastHolder *BalanceEntry, limit int) ([]*BalanceEntry, error)
+	GetDAOCoinHolderCount(creatorPKID *PKID) (uint64, error)
+	GetDeSoBalanceForPublicKey(publicKey []byte) (uint64, error)
+	GetPKIDForPublicKey(pkBytes []byte) *PKID
+	GetPublicKeyForPKID(pkid *PKID) []byte
+	GetOwnerToDerivedKeyMapping(ownerPublicKey PublicKey, derivedPublicKey PublicKey) *DerivedKeyEntry
+	GetAllOwnerToDerivedKeyMappings(ownerPublicKey PublicKey) ([]*DerivedKeyEntry, error)
+
+	//
+	// UTXOs
+	//
+
+	GetUtxoEntryForUtxoKey(utxoKey *UtxoKey) *UtxoEntry
+	GetUtxoEntriesForPublicKey(publicKey []byte) ([]*UtxoEntry, error)
+
+	//
+	// Profiles, posts, and social entries
+	//
+
+	GetProfileEntryForUsername(nonLowercaseUsername []byte) *ProfileEntry
+	GetProfileEntryForPKID(pkid *PKID) *ProfileEntry
+	GetPostEntryForPostHash(postHash *BlockHash) *PostEntry
+	GetCommentEntriesForParentStakeID(parentStakeID []byte) ([]*PostEntry, error)
+	GetLikeEntry(likerPublicKey []byte, likedPostHash *BlockHash) *LikeEntry
+	GetLikeEntriesForPostHash(postHash *BlockHash) ([]*LikeEntry, error)
+	GetDiamondEntry(senderPKID *PKID, receiverPKID *PKID, diamondPostHash *BlockHash) *DiamondEntry
+	GetFollowEntry(followerPKID *PKID, followedPKID *PKID) *FollowEntry
+	// GetFollowEntriesForPKID returns the follows of the PKID, or the follows of other PKIDs
+	// that follow it if getEntriesFollowingPKID is set.
+	GetFollowEntriesForPKID(pkid *PKID, getEntriesFollowingPKID bool) ([]*FollowEntry, error)
+
+	//
+	// NFTs
+	//
+
+	GetNFTEntry(nftPostHash *BlockHash, serialNumber uint64) *NFTEntry
+	GetNFTEntriesForPostHash(nftPostHash *BlockHash) []*NFTEntry
+	GetNFTEntriesForPKID(ownerPKID *PKID) []*NFTEntry
+	// GetPaginatedNFTEntriesForOwnerPKID returns up to limit of the owner's NFTs, starting
+	// right after startingNFTKey if it's set. Backends that can't paginate may return all of
+	// them.
+	GetPaginatedNFTEntriesForOwnerPKID(ownerPKID *PKID, startingNFTKey *NFTKey, limit uint32) ([]*NFTEntry, error)
+	GetNFTBidEntry(nftBidKey *NFTBidKey) *NFTBidEntry
+	GetNFTBidEntriesForPKID(bidderPKID *PKID) []*NFTBidEntry
+	GetNFTBidEntriesForSerialNumber(nftPostHash *BlockHash, serialNumber uint64) []*NFTBidEntry
+
+	//
+	// DAO coin limit orders
+	//
+
+	GetDAOCoinLimitOrder(orderID *BlockHash) (*DAOCoinLimitOrderEntry, error)
+	GetAllDAOCoinLimitOrders() ([]*DAOCoinLimitOrderEntry, error)
+	GetAllDAOCoinLimitOrdersForThisDAOCoinPair(buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID) (
+		[]*DAOCoinLimitOrderEntry, error)
+	GetAllDAOCoinLimitOrdersForThisTransactor(transactorPKID *PKID, buyingCoinPkid *PKID, sellingCoinPkid *PKID) (
+		[]*DAOCoinLimitOrderEntry, error)
+	GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimitOrderEntry, lastSeenOrder *DAOCoinLimitOrderEntry,
+		orderEntriesInView map[DAOCoinLimitOrderMapKey]bool, matchingOrderLastTradePrice *uint256.Int) (
+		[]*DAOCoinLimitOrderEntry, error)
+	GetDAOCoinLimitOrderFillsForTransactor(transactorPKID *PKID, limit int) ([]*DAOCoinLimitOrderFillEntry, error)
+	GetDAOCoinLimitOrderFillsForCoinPair(coinPKID1 *PKID, coinPKID2 *PKID, limit int) (
+		[]*DAOCoinLimitOrderFillEntry, error)
+
+	//
+	// AccessGroups and AccessGroupMembers
+	//
+
+	GetAccessGroupEntryByAccessGroupId(accessGroupId *AccessGroupId) (*AccessGroupEntry, error)
+	GetAccessGroupExistenceByAccessGroupId(accessGroupId *AccessGroupId) (bool, error)
+	GetAccessGroupIdsForOwner(ownerPublicKey *PublicKey) (_accessGroupIdsOwned []*AccessGroupId, _err error)
+	GetAccessGroupIdsForMember(memberPublicKey *PublicKey) (_accessGroupIdsMember []*AccessGroupId, _err error)
+	GetAccessGroupMemberEntry(accessGroupMemberPublicKey PublicKey, accessGroupOwnerPublicKey PublicKey,
+		accessGroupKeyName GroupKeyName) (*AccessGroupMemberEntry, error)
+	GetAccessGroupMemberEnumerationEntry(accessGroupMemberPublicKey PublicKey, accessGroupOwnerPublicKey PublicKey,
+		accessGroupKeyName GroupKeyName) (_exists bool, _err error)
+	GetPaginatedAccessGroupMembersEnumerationEntries(accessGroupOwnerPublicKey PublicKey,
+		accessGroupKeyName GroupKeyName, startingAccessGroupMemberPublicKeyBytes []byte, maxMembersToFetch uint32) (
+		_accessGroupMemberPublicKeys []*PublicKey, _err error)
+
+	//
+	// NewMessage
+	//
+
+	GetDmMessageEntry(dmMessageKey DmMessageKey) (*NewMessageEntry, error)
+	GetGroupChatMessageEntry(groupChatMessageKey GroupChatMessageKey) (*NewMessageEntry, error)
+	CheckDmThreadExistence(dmThreadKey DmThreadKey) (*DmThreadEntry, error)
+	GetAllUserDmThreads(userAccessGroupOwnerPublicKey PublicKey) (_dmThreadKeys []*DmThreadKey, _err error)
+	GetPaginatedMessageEntriesForDmThread(dmThreadKey DmThreadKey, maxTimestamp uint64, maxMessagesToFetch uint64) (
+		_messageEntries []*NewMessageEntry, _err error)
+	GetPaginatedMessageEntriesForGroupChatThread(groupChatThread AccessGroupId, startingTimestamp uint64,
+		maxMessagesToFetch uint64) (_messageEntries []*NewMessageEntry, _err error)
+
+	//
+	// Chain state
+	//
+
+	GetBestHash(chainType ChainType) *BlockHash
+	GetUtxoNumEntries() uint64
+	GetNanosPurchased() uint64
+	GetUSDCentsPerBitcoinExchangeRate() uint64
+	GetGlobalParamsEntry() *GlobalParamsEntry
+	ExistsBitcoinBurnTxID(bitcoinBurnTxID *BlockHash) bool
+	GetBlockNodeForHeightHash(height uint32, hash *BlockHash, bitcoinNodes bool) *BlockNode
+	GetBlockRewardForPublicKeyBlockHash(publicKey []byte, blockHash *BlockHash) (uint64, error)
+	GetTransactorNonceEntry(nonce *DeSoNonce, pkid *PKID) (*TransactorNonceEntry, error)
+	GetTransactorNonceEntriesToExpireAtBlockHeight(blockHeight uint64) ([]*TransactorNonceEntry, error)
+	GetBlockProducerRegistryEntry(publicKey []byte) (*BlockProducerRegistryEntry, error)
+	GetDeadKeyEntry(publicKey []byte) (*DeadKeyEntry, error)
+	GetAllDeadKeyEntries() ([]*DeadKeyEntry, error)
+	GetExchangeRateFeedEntry(publicKey []byte) (*ExchangeRateFeedEntry, error)
+	GetAllExchangeRateFeedEntries() ([]*ExchangeRateFeedEntry, error)
+	GetExternalHeaderRelayerEntry(publicKey []byte) (*ExternalHeaderRelayerEntry, error)
+	GetExternalHeaderEntry(externalChain ExternalChain, blockHash *BlockHash) (*ExternalHeaderEntry, error)
+	GetTopExternalHeaderEntry(externalChain ExternalChain, blockHashesToSkip *Set[BlockHash]) (
+		*ExternalHeaderEntry, error)
+	GetMultisigEntry(ownerPKID *PKID) (*MultisigEntry, error)
+	GetProposalEntry(proposalID *BlockHash) (*ProposalEntry, error)
+	GetProposalEntriesForProfile(profilePKID *PKID) ([]*ProposalEntry, error)
+	GetVoteEntry(proposalID *BlockHash, voterPKID *PKID) (*VoteEntry, error)
+	GetVoteEntriesForProposal(proposalID *BlockHash) ([]*VoteEntry, error)
+
+	//
+	// Profiles, posts, and messages
+	//
+
+	GetAllProfilesByCoinValue(fetchEntries bool) (
+		_lockedDeSoNanos []uint64, _profilePKIDs []*PKID, _profileEntries []*ProfileEntry, _err error)
+	GetAllPostsByTstamp(fetchEntries bool) (
+		_tstamps []uint64, _postHashes []*BlockHash, _postEntries []*PostEntry, _err error)
+	GetCommentPostHashesForParentStakeID(parentStakeID []byte, fetchEntries bool) (
+		_tstamps []uint64, _commentPostHashes []*BlockHash, _commentPostEntries []*PostEntry, _err error)
+	GetRepostEntry(userPubKey []byte, repostedPostHash BlockHash) *RepostEntry
+	GetPKIDsThatDiamondedYouMap(yourPKID *PKID, fetchYouDiamonded bool) (map[PKID][]*DiamondEntry, error)
+	GetDiamondEntriesForSenderToReceiver(receiverPKID, senderPKID *PKID) ([]*DiamondEntry, error)
+	GetProfilePicBlob(blobHash *BlockHash) []byte
+	GetMessageEntry(publicKey []byte, tstampNanos uint64) *MessageEntry
+	GetMessagingGroupEntry(messagingGroupKey *MessagingGroupKey) *MessagingGroupEntry
+	GetAllUserGroupEntries(ownerPublicKey []byte) ([]*MessagingGroupEntry, error)
+	GetLimitedMessageForMessagingKeys(messagingKeys []*MessagingGroupEntry, limit uint64) ([]*MessageEntry, error)
+
+	//
+	// NFT bids, auctions, bundles, leases, and swaps
+	//
+
+	GetNFTBidEntriesPaginated(nftHash *BlockHash, serialNumber uint64, startEntry *NFTBidEntry, limit int,
+		reverse bool) []*NFTBidEntry
+	GetAcceptedNFTBidEntriesByPostHashSerialNumber(postHash *BlockHash, serialNumber uint64) *[]*NFTBidEntry
+	GetNFTKeysForAuctionsEndingAtBlockHeight(auctionEndBlockHeight uint64) ([]NFTKey, error)
+	GetNFTBundleEntry(bundleID *BlockHash) (*NFTBundleEntry, error)
+	GetNFTBundleEntriesForSeller(sellerPKID *PKID) ([]*NFTBundleEntry, error)
+	GetNFTEntriesForLesseePKID(lesseePKID *PKID) ([]*NFTEntry, error)
+	GetNFTSwapEntry(swapID *BlockHash) (*NFTSwapEntry, error)
+	GetNFTSwapEntriesForPKID(pkid *PKID) ([]*NFTSwapEntry, error)
+	GetRoyaltySplitEntry(royaltySplitID *BlockHash) (*RoyaltySplitEntry, error)
+	GetRoyaltySplitEntriesForCreator(creatorPKID *PKID) ([]*RoyaltySplitEntry, error)
+
+	//
+	// DAO coins
+	//
+
+	GetDAOCoinLastTradePriceEntry(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID *PKID) (
+		*DAOCoinLastTradePriceEntry, error)
+	GetDAOCoinLimitOrderFillEntry(txnHash *BlockHash, fillIndex uint32) (*DAOCoinLimitOrderFillEntry, error)
+	GetDAOCoinMetadataEntry(creatorPKID *PKID) (*DAOCoinMetadataEntry, error)
+	GetDAOCoinStreamEntry(streamID *BlockHash) (*DAOCoinStreamEntry, error)
+	GetDAOCoinStreamEntriesForPKID(pkid *PKID, asPayee bool) ([]*DAOCoinStreamEntry, error)
+	GetEscrowEntry(escrowID *BlockHash) (*EscrowEntry, error)
+	GetEscrowEntriesForOwnerPKID(ownerPKID *PKID) ([]*EscrowEntry, error)
+
+	//
+	// Lockups
+	//
+
+	GetLockedBalanceEntryForLockedBalanceEntryKey(lockedBalanceEntryKey LockedBalanceEntryKey) (
+		*LockedBalanceEntry, error)
+	GetAllLockedBalanceEntriesForHodlerPKID(hodlerPKID *PKID) ([]*LockedBalanceEntry, error)
+	GetLimitedVestedLockedBalanceEntries(hodlerPKID, profilePKID *PKID, unlockTimestampNanoSecs,
+		vestingEndTimestampNanoSecs int64, limitToFetch int) ([]*LockedBalanceEntry, error)
+	GetUnlockableLockedBalanceEntries(hodlerPKID, profilePKID *PKID, currentTimestampUnixNanoSecs int64) (
+		_unvestedUnlockableLockedBalanceEntries []*LockedBalanceEntry,
+		_vestedUnlockableLockedEntries []*LockedBalanceEntry, _err error)
+	GetYieldCurvePointsByProfilePKIDAndDurationNanoSecs(profilePKID *PKID, lockupDurationNanoSecs int64) (
+		*LockupYieldCurvePoint, error)
+	GetAllYieldCurvePointsByProfilePKID(profilePKID *PKID) ([]*LockupYieldCurvePoint, error)
+
+	//
+	// Validators and stakes
+	//
+
+	GetValidatorByPKID(pkid *PKID) (*ValidatorEntry, error)
+	GetValidatorBLSPublicKeyPKIDPairEntry(blsPublicKey *bls.PublicKey) (*BLSPublicKeyPKIDPairEntry, error)
+	GetTopActiveValidatorsByStakeAmount(limit uint64, validatorEntriesToSkip []*ValidatorEntry) (
+		[]*ValidatorEntry, error)
+	GetStakeEntry(validatorPKID, stakerPKID *PKID) (*StakeEntry, error)
+	GetStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*StakeEntry, error)
+	GetStakeEntriesForStakerPKID(stakerPKID *PKID) ([]*StakeEntry, error)
+	GetTopStakesForValidatorsByStakeAmount(limit uint64, validatorPKIDsToInclude *Set[PKID],
+		stakeEntriesToSkip []*StakeEntry) ([]*StakeEntry, error)
+	ValidatorHasDelegatedStake(validatorPKID *PKID, utxoDeletedStakeEntries []*StakeEntry) (bool, error)
+	GetLockedStakeEntry(validatorPKID, stakerPKID *PKID, lockedAtEpochNumber uint64) (*LockedStakeEntry, error)
+	GetLockedStakeEntriesForStakerPKID(stakerPKID *PKID) ([]*LockedStakeEntry, error)
+	GetLockedStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*LockedStakeEntry, error)
+	GetLockedStakeEntriesInRange(validatorPKID, stakerPKID *PKID, startEpochNumber, endEpochNumber uint64) (
+		[]*LockedStakeEntry, error)
+	GetValidatorRewardIndexEntry(validatorPKID *PKID) (*ValidatorRewardIndexEntry, error)
+	GetValidatorRewardIndexEntryAtEpochEnd(validatorPKID *PKID, epochNumber uint64) (
+		*ValidatorRewardIndexEntry, error)
+
+	//
+	// Epochs and snapshots
+	//
+
+	GetCurrentEpochEntry() (*EpochEntry, error)
+	GetCurrentRandomSeedHash() (*RandomSeedHash, error)
+	GetSnapshotGlobalParamsEntry(snapshotAtEpochNumber uint64) (*GlobalParamsEntry, error)
+	GetSnapshotValidatorSetEntryByPKID(pkid *PKID, snapshotAtEpochNumber uint64) (*ValidatorEntry, error)
+	GetSnapshotValidatorSetByStakeAmount(limit, snapshotAtEpochNumber uint64, validatorEntriesToSkip []*ValidatorEntry) (
+		[]*ValidatorEntry, error)
+	GetSnapshotValidatorBLSPublicKeyPKIDPairEntry(blsPublicKey *bls.PublicKey, snapshotAtEpochNumber uint64) (
+		*BLSPublicKeyPKIDPairEntry, error)
+	GetSnapshotStakesToReward(limit, snapshotAtEpochNumber uint64, stakeEntriesToSkip []*StakeEntry) (
+		[]*StakeEntry, error)
+	GetSnapshotLeaderScheduleValidator(leaderIndex uint16, snapshotAtEpochNumber uint64) (*ValidatorEntry, error)
+	GetSnapshotLeaderSchedule(snapshotAtEpochNumber uint64) (map[uint16]*PKID, error)
+
+	//
+	// ValidatorEpochPerformance
+	//
+
+	GetValidatorEpochPerformanceEntry(validatorPKID *PKID, epochNumber uint64) (*ValidatorEpochPerformanceEntry, error)
+	GetValidatorEpochPerformanceEntriesForPKID(validatorPKID *PKID) ([]*ValidatorEpochPerformanceEntry, error)
+}
+
+// DbAdapter reads from the StorageBackend the node is configured with.
+type DbAdapter struct {
+	StorageBackend
 }
 
-//
-// AccessGroups
-//
-
-// GetAccessGroupEntryByAccessGroupId returns the AccessGroupEntry for the given AccessGroupId from db.
-func (adapter *DbAdapter) GetAccessGroupEntryByAccessGroupId(accessGroupId *AccessGroupId) (*AccessGroupEntry, error) {
-	if accessGroupId == nil {
-		glog.Errorf("GetAccessGroupEntryByAccessGroupId: Called with nil accessGroupId, this should never happen")
-		return nil, nil
-	}
-
-	if adapter.postgresDb != nil {
-		pgAccessGroup := adapter.postgresDb.GetAccessGroupByAccessGroupId(accessGroupId)
-		if pgAccessGroup == nil {
-			return nil, nil
-		}
-		return pgAccessGroup.ToAccessGroupEntry(), nil
-	} else {
-		return DBGetAccessGroupEntryByAccessGroupId(adapter.badgerDb, adapter.snapshot,
-			&accessGroupId.AccessGroupOwnerPublicKey, &accessGroupId.AccessGroupKeyName)
-	}
+func (bc *Blockchain) NewDbAdapter() *DbAdapter {
+	return newDbAdapter(bc.db, bc.postgres, bc.snapshot, bc.storageBackend)
 }
 
-// GetAccessGroupExistenceByAccessGroupId returns true if the given AccessGroupId exists in db using optimized key-only lookup.
-func (adapter *DbAdapter) GetAccessGroupExistenceByAccessGroupId(accessGroupId *AccessGroupId) (bool, error) {
-	if accessGroupId == nil {
-		glog.Errorf("GetAccessGroupExistenceByAccessGroupId: Called with nil accessGroupId, this should never happen")
-		return false, nil
-	}
-
-	if adapter.postgresDb != nil {
-		pgAccessGroup := adapter.postgresDb.GetAccessGroupByAccessGroupId(accessGroupId)
-		if pgAccessGroup == nil {
-			return false, nil
-		}
-		return true, nil
-	} else {
-		return DBGetAccessGroupExistenceByAccessGroupId(adapter.badgerDb, adapter.snapshot,
-			&accessGroupId.AccessGroupOwnerPublicKey, &accessGroupId.AccessGroupKeyName)
-	}
+// NewUtxoView returns a view of the chain's db that reads from the chain's storage backend.
+func (bc *Blockchain) NewUtxoView() *UtxoView {
+	return NewUtxoViewWithStorageBackend(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager,
+		bc.storageBackend)
 }
 
-// GetAccessGroupIdsForOwner returns all the AccessGroupIds registered by given accessGroupOwnerPublicKey from db.
-func (adapter *DbAdapter) GetAccessGroupIdsForOwner(ownerPublicKey *PublicKey) (_accessGroupIdsOwned []*AccessGroupId, _err error) {
-	var accessGroupIds []*AccessGroupId
-	var err error
-	if ownerPublicKey == nil {
-		glog.Errorf("GetAccessGroupEntriesForOwner: Called with nil ownerPublicKey, this should never happen")
-		return nil, nil
-	}
-
-	if adapter.postgresDb != nil {
-		pgAccessGroupEntries := adapter.postgresDb.GetAccessGroupEntriesForOwner(*ownerPublicKey)
-		if pgAccessGroupEntries == nil {
-			return nil, nil
-		}
-		for _, pgAccessGroupEntry := range pgAccessGroupEntries {
-			accessGroupEntry := pgAccessGroupEntry.ToAccessGroupEntry()
-			accessGroupId := NewAccessGroupId(ownerPublicKey, accessGroupEntry.AccessGroupKeyName.ToBytes())
-			accessGroupIds = append(accessGroupIds, accessGroupId)
-		}
-	} else {
-		accessGroupIds, err = DBGetAccessGroupIdsForOwner(adapter.badgerDb, adapter.snapshot, *ownerPublicKey)
-		if err != nil {
-			return nil, err
-		}
+func (bav *UtxoView) GetDbAdapter() *DbAdapter {
+	snap := bav.Snapshot
+	if bav.Postgres != nil {
+		snap = nil
 	}
-	return accessGroupIds, nil
+	return newDbAdapter(bav.Handle, bav.Postgres, snap, bav.StorageBackend)
 }
 
-// GetAccessGroupIdsForMember returns all the AccessGroupIds that given memberPublicKey is a member of from db.
-func (adapter *DbAdapter) GetAccessGroupIdsForMember(memberPublicKey *PublicKey) (_accessGroupIdsMember []*AccessGroupId, _err error) {
-	var accessGroupIds []*AccessGroupId
-	var err error
-
-	if memberPublicKey == nil {
-		glog.Errorf("GetAccessGroupEntriesForMember: Called with nil memberPublicKey, this should never happen")
-		return nil, nil
+// newDbAdapter returns an adapter for the third-party backend if there is one. The snapshot
+// is only used to cache badger reads for hypersync, so it isn't passed to a third-party
+// backend, which serves reads from its own store.
+func newDbAdapter(handle *badger.DB, postgres *Postgres, snap *Snapshot, storageBackend StorageBackend) *DbAdapter {
+	if storageBackend != nil {
+		return &DbAdapter{StorageBackend: storageBackend}
 	}
-
-	if adapter.postgresDb != nil {
-		pgAccessGroupEnumerationEntries, err := adapter.postgresDb.GetAccessGroupEnumerationEntriesForMember(*memberPublicKey)
-		if err != nil {
-			return nil, err
-		}
-		for _, pgAccessEnumerationEntry := range pgAccessGroupEnumerationEntries {
-			accessGroupId := NewAccessGroupId(
-				pgAccessEnumerationEntry.AccessGroupOwnerPublicKey, pgAccessEnumerationEntry.AccessGroupKeyName.ToBytes())
-			accessGroupIds = append(accessGroupIds, accessGroupId)
-		}
-	} else {
-		accessGroupIds, err = DBGetAccessGroupIdsForMember(adapter.badgerDb, adapter.snapshot, *memberPublicKey)
-		if err != nil {
-			return nil, err
-		}
+	if postgres != nil {
+		return &DbAdapter{StorageBackend: NewPostgresStorageBackend(postgres, handle, snap)}
 	}
-
-	return accessGroupIds, nil
+	return &DbAdapter{StorageBackend: NewBadgerStorageBackend(handle, snap)}
 }
 
 //
-// AccessGroupMembers
+// Registry
 //
 
-// GetAccessGroupMemberEntry returns the AccessGroupMemberEntry for the given accessGroupMemberPublicKey and
-// the group identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db.
-func (adapter *DbAdapter) GetAccessGroupMemberEntry(accessGroupMemberPublicKey PublicKey,
-	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName) (*AccessGroupMemberEntry, error) {
-
-	if adapter.postgresDb != nil {
-		pgAccessGroupMember := adapter.postgresDb.GetAccessGroupMemberEntry(accessGroupMemberPublicKey,
-			accessGroupOwnerPublicKey, accessGroupKeyName)
-		if pgAccessGroupMember == nil {
-			return nil, nil
-		}
-		_, _, accessGroupMember := pgAccessGroupMember.ToAccessGroupMemberEntry()
-		return accessGroupMember, nil
-	} else {
-		return DBGetAccessGroupMemberEntry(adapter.badgerDb, adapter.snapshot,
-			accessGroupMemberPublicKey, accessGroupOwnerPublicKey, accessGroupKeyName)
-	}
-}
+// StorageBackendFactory creates a backend for the node with the given badger handle, which
+// is opened before the backend is created. options is passed through from the node's config,
+// e.g. to hold a connection string.
+type StorageBackendFactory func(handle *badger.DB, options string) (StorageBackend, error)
 
-// GetAccessGroupMemberEnumerationEntry returns a bool indicating whether the given accessGroupMemberPublicKey is a member
-// of the group identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db, using optimized key-only lookup.
-func (adapter *DbAdapter) GetAccessGroupMemberEnumerationEntry(accessGroupMemberPublicKey PublicKey,
-	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName) (_exists bool, _err error) {
-
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetAccessGroupMemberEnumerationEntry(accessGroupMemberPublicKey,
-			accessGroupOwnerPublicKey, accessGroupKeyName), nil
-	} else {
-		// TODO: Use similar function signatures.
-		return DBGetAccessGroupMemberExistenceFromEnumerationIndex(adapter.badgerDb, adapter.snapshot,
-			accessGroupMemberPublicKey, accessGroupOwnerPublicKey, accessGroupKeyName)
-	}
-}
-
-// GetPaginatedAccessGroupMembersEnumerationEntries returns a list of accessGroupMemberPublicKeys that are members of the group
-// identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db. The list is paginated by the given offset
-// startingGroupMemberPublicKeyBytes, so that each return publicKey is lexicographically greater than the offset.
-// The list is also limited to at most the given length of maxMembersToFetch. Returned public keys will be in
-// lexicographically ascending order.
-func (adapter *DbAdapter) GetPaginatedAccessGroupMembersEnumerationEntries(
-	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName,
-	startingAccessGroupMemberPublicKeyBytes []byte, maxMembersToFetch uint32) (
-	_accessGroupMemberPublicKeys []*PublicKey, _err error) {
-
-	if maxMembersToFetch == 0 {
-		return nil, nil
-	}
-
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetPaginatedAccessGroupMembersFromEnumerationIndex(
-			accessGroupOwnerPublicKey, accessGroupKeyName,
-			startingAccessGroupMemberPublicKeyBytes, maxMembersToFetch)
-	} else {
-		return DBGetPaginatedAccessGroupMembersFromEnumerationIndex(adapter.badgerDb, adapter.snapshot,
-			accessGroupOwnerPublicKey, accessGroupKeyName,
-			startingAccessGroupMemberPublicKeyBytes, maxMembersToFetch)
-	}
-}
-
-//
-// NewMessage
-//
-
-// GetDmMessageEntry returns the NewMessageEntry for the given DmMessageKey from db.
-func (adapter *DbAdapter) GetDmMessageEntry(dmMessageKey DmMessageKey) (*NewMessageEntry, error) {
-
-	if adapter.postgresDb != nil {
-		pgDmMessage := adapter.postgresDb.GetNewMessageDmEntry(dmMessageKey)
-		if pgDmMessage == nil {
-			return nil, nil
-		}
-		dmMessage := pgDmMessage.ToNewMessageEntry()
-		return dmMessage, nil
-	} else {
-		return DBGetDmMessageEntry(adapter.badgerDb, adapter.snapshot, dmMessageKey)
-	}
-}
+var (
+	storageBackendsMtx      sync.RWMutex
+	storageBackendFactories = make(map[string]StorageBackendFactory)
+)
 
-// GetGroupChatMessageEntry returns the NewMessageEntry for the given GroupChatMessageKey from db.
-func (adapter *DbAdapter) GetGroupChatMessageEntry(groupChatMessageKey GroupChatMessageKey) (*NewMessageEntry, error) {
-
-	if adapter.postgresDb != nil {
-		pgGroupChatMessage := adapter.postgresDb.GetNewMessageGroupChatEntry(groupChatMessageKey)
-		if pgGroupChatMessage == nil {
-			return nil, nil
-		}
-		groupChatMessage := pgGroupChatMessage.ToNewMessageEntry()
-		return groupChatMessage, nil
-	} else {
-		return DBGetGroupChatMessageEntry(adapter.badgerDb, adapter.snapshot, groupChatMessageKey)
-	}
-}
+// RegisterStorageBackend registers a factory for the backend with the given name. It's meant
+// to be called from an init function of the package that implements the backend.
+func RegisterStorageBackend(name string, factory StorageBackendFactory) error {
+	storageBackendsMtx.Lock()
+	defer storageBackendsMtx.Unlock()
 
-// CheckDmThreadExistence returns a DmThreadEntry entry for the provided DmThreadKey from db.
-func (adapter *DbAdapter) CheckDmThreadExistence(dmThreadKey DmThreadKey) (*DmThreadEntry, error) {
-
-	if adapter.postgresDb != nil {
-		pgDmThreadExistence := adapter.postgresDb.CheckDmThreadExistence(dmThreadKey)
-		if pgDmThreadExistence == nil {
-			return nil, nil
-		}
-		return pgDmThreadExistence, nil
-	} else {
-		return DBCheckDmThreadExistence(adapter.badgerDb, adapter.snapshot, dmThreadKey)
+	if name == "" || factory == nil {
+		return fmt.Errorf("RegisterStorageBackend: Name and factory are required")
 	}
-}
-
-// GetAllUserDmThreads returns a list of all the DmThreadKey entries associated with the given userAccessGroupOwnerPublicKey from db.
-func (adapter *DbAdapter) GetAllUserDmThreads(userAccessGroupOwnerPublicKey PublicKey) (
-	_dmThreadKeys []*DmThreadKey, _err error) {
-
-	if adapter.postgresDb != nil {
-		// TODO: The error might be thrown when key doesnt exist
-		return adapter.postgresDb.GetAllUserDmThreads(userAccessGroupOwnerPublicKey)
-	} else {
-		return DBGetAllUserDmThreads(adapter.badgerDb, adapter.snapshot, userAccessGroupOwnerPublicKey)
+	if _, exists := storageBackendFactories[name]; exists {
+		return fmt.Errorf("RegisterStorageBackend: Storage backend %v is already registered", name)
 	}
+	storageBackendFactories[name] = factory
+	return nil
 }
 
-// GetPaginatedMessageEntriesForDmThread returns a list of NewMessageEntry entries for the given DmThreadKey from db.
-// The list is paginated by the given offset maxTimestamp (exclusive), so that each return message's timestamp is
-// less than the offset. The list is also limited to at most the given length of maxMessagesToFetch. Returned
-// messages will be in descending order by timestamp.
-func (adapter *DbAdapter) GetPaginatedMessageEntriesForDmThread(dmThreadKey DmThreadKey, maxTimestamp uint64,
-	maxMessagesToFetch uint64) (_messageEntries []*NewMessageEntry, _err error) {
-
-	if maxMessagesToFetch == 0 {
-		return nil, nil
-	}
+// GetRegisteredStorageBackendNames returns the names of the registered backends, sorted.
+func GetRegisteredStorageBackendNames() []string {
+	storageBackendsMtx.RLock()
+	defer storageBackendsMtx.RUnlock()
 
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetPaginatedMessageEntriesForDmThread(
-			dmThreadKey, maxTimestamp, maxMessagesToFetch)
-	} else {
-		return DBGetPaginatedDmMessageEntry(adapter.badgerDb, adapter.snapshot,
-			dmThreadKey, maxTimestamp, maxMessagesToFetch)
+	names := make([]string, 0, len(storageBackendFactories))
+	for name := range storageBackendFactories {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-// GetPaginatedMessageEntriesForGroupChatThread returns a list of NewMessageEntry entries for the given AccessGroupId from db.
-// The list is paginated by the given offset maxTimestamp (exclusive), so that each return message's timestamp is
-// less than the offset. The list is also limited to at most the given length of maxMessagesToFetch. Returned
-// messages will be in descending order by timestamp.
-func (adapter *DbAdapter) GetPaginatedMessageEntriesForGroupChatThread(groupChatThread AccessGroupId, startingTimestamp uint64,
-	maxMessagesToFetch uint64) (_messageEntries []*NewMessageEntry, _err error) {
+// NewStorageBackend creates a backend with the factory registered under the given name.
+func NewStorageBackend(name string, handle *badger.DB, options string) (StorageBackend, error) {
+	storageBackendsMtx.RLock()
+	factory, exists := storageBackendFactories[name]
+	storageBackendsMtx.RUnlock()
 
-	if maxMessagesToFetch == 0 {
-		return nil, nil
+	if !exists {
+		return nil, fmt.Errorf("NewStorageBackend: Unknown storage backend %v, registered backends are %v",
+			name, GetRegisteredStorageBackendNames())
 	}
-
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetPaginatedMessageEntriesForGroupChatThread(
-			groupChatThread, startingTimestamp, maxMessagesToFetch)
-	} else {
-		return DBGetPaginatedGroupChatMessageEntry(adapter.badgerDb, adapter.snapshot,
-			groupChatThread, startingTimestamp, maxMessagesToFetch)
-	}
-}
-
-// GetDeSoBalanceForPublicKey returns the balance of the given public key in nanos.
-func (adapter *DbAdapter) GetDeSoBalanceForPublicKey(publicKey []byte) (uint64, error) {
-	if adapter.postgresDb != nil {
-		return adapter.postgresDb.GetBalance(NewPublicKey(publicKey)), nil
+	backend, err := factory(handle, options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStorageBackend: Problem creating storage backend %v: ", name)
 	}
-	return DbGetDeSoBalanceNanosForPublicKey(adapter.badgerDb, adapter.snapshot, publicKey)
+	return backend, nil
 }
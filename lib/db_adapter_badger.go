@@ -0,0 +1,1048 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/deso-protocol/core/bls"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// BadgerStorageBackend is the StorageBackend that reads everything from badger.
+type BadgerStorageBackend struct {
+	badgerDb *badger.DB
+	snapshot *Snapshot
+}
+
+func NewBadgerStorageBackend(handle *badger.DB, snap *Snapshot) *BadgerStorageBackend {
+	return &BadgerStorageBackend{
+		badgerDb: handle,
+		snapshot: snap,
+	}
+}
+
+func (backend *BadgerStorageBackend) Name() string {
+	return "badger"
+}
+
+//
+// Key-value access
+//
+
+func (backend *BadgerStorageBackend) GetValue(key []byte) ([]byte, error) {
+	var value []byte
+	err := backend.badgerDb.View(func(txn *badger.Txn) error {
+		var err error
+		value, err = DBGetWithTxn(txn, backend.snapshot, key)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (backend *BadgerStorageBackend) IteratePrefix(prefix []byte, startKey []byte, targetBytes uint32) (
+	_entries []*DBEntry, _isChunkFull bool, _err error) {
+
+	return DBIteratePrefixKeys(backend.badgerDb, prefix, startKey, targetBytes)
+}
+
+func (backend *BadgerStorageBackend) GetKeysForPrefix(prefix []byte) ([][]byte, error) {
+	keysFound, _ := EnumerateKeysForPrefix(backend.badgerDb, prefix, true)
+	return keysFound, nil
+}
+
+func (backend *BadgerStorageBackend) IterateKeys(prefix []byte, startKey []byte, reverse bool,
+	handleKey func(key []byte) (bool, error)) error {
+
+	return backend.badgerDb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Reverse = reverse
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(startKey); it.ValidForPrefix(prefix); it.Next() {
+			shouldContinue, err := handleKey(it.Item().Key())
+			if err != nil {
+				return err
+			}
+			if !shouldContinue {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+//
+// Associations
+//
+
+func (backend *BadgerStorageBackend) GetUserAssociationByID(associationID *BlockHash) (*UserAssociationEntry, error) {
+	return DBGetUserAssociationByID(backend.badgerDb, backend.snapshot, associationID)
+}
+
+func (backend *BadgerStorageBackend) GetPostAssociationByID(associationID *BlockHash) (*PostAssociationEntry, error) {
+	return DBGetPostAssociationByID(backend.badgerDb, backend.snapshot, associationID)
+}
+
+func (backend *BadgerStorageBackend) GetUserAssociationByAttributes(associationEntry *UserAssociationEntry) (*UserAssociationEntry, error) {
+	return DBGetUserAssociationByAttributes(backend.badgerDb, backend.snapshot, associationEntry)
+}
+
+func (backend *BadgerStorageBackend) GetPostAssociationByAttributes(associationEntry *PostAssociationEntry) (*PostAssociationEntry, error) {
+	return DBGetPostAssociationByAttributes(backend.badgerDb, backend.snapshot, associationEntry)
+}
+
+func (backend *BadgerStorageBackend) GetUserAssociationsByAttributes(
+	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) ([]*UserAssociationEntry, []byte, error) {
+	return DBGetUserAssociationsByAttributes(backend.badgerDb, backend.snapshot, associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *BadgerStorageBackend) GetPostAssociationsByAttributes(
+	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) ([]*PostAssociationEntry, []byte, error) {
+	return DBGetPostAssociationsByAttributes(backend.badgerDb, backend.snapshot, associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *BadgerStorageBackend) GetUserAssociationIdsByAttributes(
+	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (*Set[BlockHash], []byte, error) {
+	return DBGetUserAssociationIdsByAttributes(backend.badgerDb, backend.snapshot, associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *BadgerStorageBackend) GetPostAssociationIdsByAttributes(
+	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (*Set[BlockHash], []byte, error) {
+	return DBGetPostAssociationIdsByAttributes(backend.badgerDb, backend.snapshot, associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *BadgerStorageBackend) SortUserAssociationEntriesByPrefix(
+	associationEntries []*UserAssociationEntry,
+	prefixType []byte,
+	sortDescending bool,
+) ([]*UserAssociationEntry, error) {
+	// Badger sorts results by the key prefix.
+	var innerErr error
+	sort.Slice(associationEntries, func(ii int, jj int) bool {
+		keyII, err := DBKeyForUserAssociationByPrefix(associationEntries[ii], prefixType)
+		if err != nil {
+			innerErr = err
+			return false
+		}
+		keyJJ, err := DBKeyForUserAssociationByPrefix(associationEntries[jj], prefixType)
+		if err != nil {
+			innerErr = err
+			return false
+		}
+		byteComparison := bytes.Compare(keyII, keyJJ)
+		if sortDescending {
+			return byteComparison > 0
+		}
+		return byteComparison <= 0
+	})
+	if innerErr != nil {
+		return nil, errors.Wrapf(innerErr, "SortUserAssociationEntriesByPrefix: ")
+	}
+	return associationEntries, nil
+}
+
+func (backend *BadgerStorageBackend) SortPostAssociationEntriesByPrefix(
+	associationEntries []*PostAssociationEntry,
+	prefixType []byte,
+	sortDescending bool,
+) ([]*PostAssociationEntry, error) {
+	// Badger sorts results by the key prefix.
+	var innerErr error
+	sort.Slice(associationEntries, func(ii int, jj int) bool {
+		keyII, err := DBKeyForPostAssociationByPrefix(associationEntries[ii], prefixType)
+		if err != nil {
+			innerErr = err
+			return false
+		}
+		keyJJ, err := DBKeyForPostAssociationByPrefix(associationEntries[jj], prefixType)
+		if err != nil {
+			innerErr = err
+			return false
+		}
+		byteComparison := bytes.Compare(keyII, keyJJ)
+		if sortDescending {
+			return byteComparison > 0
+		}
+		return byteComparison <= 0
+	})
+	if innerErr != nil {
+		return nil, errors.Wrapf(innerErr, "SortPostAssociationEntriesByPrefix: ")
+	}
+	return associationEntries, nil
+}
+
+//
+// Balance entry
+//
+
+func (backend *BadgerStorageBackend) GetBalanceEntry(holder *PKID, creator *PKID, isDAOCoin bool) *BalanceEntry {
+	return DbGetBalanceEntry(backend.badgerDb, backend.snapshot, holder, creator, isDAOCoin)
+}
+
+func (backend *BadgerStorageBackend) GetBalanceEntriesYouHold(pkid *PKID, isDAOCoin bool) ([]*BalanceEntry, error) {
+	return DbGetBalanceEntriesYouHold(backend.badgerDb, backend.snapshot, pkid, true, isDAOCoin)
+}
+
+func (backend *BadgerStorageBackend) GetBalanceEntriesHodlingYou(pkid *PKID, isDAOCoin bool) ([]*BalanceEntry, error) {
+	return DbGetBalanceEntriesHodlingYou(backend.badgerDb, backend.snapshot, pkid, true, isDAOCoin)
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinHoldersByBalance(
+	creatorPKID *PKID, lastHolder *BalanceEntry, limit int) ([]*BalanceEntry, error) {
+
+	return DBGetDAOCoinHoldersByBalance(backend.badgerDb, backend.snapshot, creatorPKID, lastHolder, limit)
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinHolderCount(creatorPKID *PKID) (uint64, error) {
+	return DBGetDAOCoinHolderCount(backend.badgerDb, creatorPKID)
+}
+
+// GetDeSoBalanceForPublicKey returns the balance of the given public key in nanos.
+func (backend *BadgerStorageBackend) GetDeSoBalanceForPublicKey(publicKey []byte) (uint64, error) {
+	return DbGetDeSoBalanceNanosForPublicKey(backend.badgerDb, backend.snapshot, publicKey)
+}
+
+//
+// Derived keys
+//
+
+func (backend *BadgerStorageBackend) GetOwnerToDerivedKeyMapping(ownerPublicKey PublicKey, derivedPublicKey PublicKey) *DerivedKeyEntry {
+	return DBGetOwnerToDerivedKeyMapping(backend.badgerDb, backend.snapshot, ownerPublicKey, derivedPublicKey)
+}
+
+func (backend *BadgerStorageBackend) GetAllOwnerToDerivedKeyMappings(ownerPublicKey PublicKey) ([]*DerivedKeyEntry, error) {
+	return DBGetAllOwnerToDerivedKeyMappings(backend.badgerDb, ownerPublicKey)
+}
+
+//
+// DAO coin limit order
+//
+
+func (backend *BadgerStorageBackend) GetDAOCoinLimitOrder(orderID *BlockHash) (*DAOCoinLimitOrderEntry, error) {
+	return DBGetDAOCoinLimitOrder(backend.badgerDb, backend.snapshot, orderID)
+}
+
+func (backend *BadgerStorageBackend) GetAllDAOCoinLimitOrders() ([]*DAOCoinLimitOrderEntry, error) {
+	// This function is currently used for testing purposes only.
+	return DBGetAllDAOCoinLimitOrders(backend.badgerDb)
+}
+
+func (backend *BadgerStorageBackend) GetAllDAOCoinLimitOrdersForThisDAOCoinPair(buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID) ([]*DAOCoinLimitOrderEntry, error) {
+	return DBGetAllDAOCoinLimitOrdersForThisDAOCoinPair(backend.badgerDb, buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+}
+
+func (backend *BadgerStorageBackend) GetAllDAOCoinLimitOrdersForThisTransactor(
+	transactorPKID *PKID,
+	buyingCoinPkid *PKID,
+	sellingCoinPkid *PKID,
+) (
+	[]*DAOCoinLimitOrderEntry,
+	error,
+) {
+	return DBGetAllDAOCoinLimitOrdersForThisTransactor(
+		backend.badgerDb, transactorPKID, buyingCoinPkid, sellingCoinPkid)
+}
+
+func (backend *BadgerStorageBackend) GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimitOrderEntry, lastSeenOrder *DAOCoinLimitOrderEntry, orderEntriesInView map[DAOCoinLimitOrderMapKey]bool, matchingOrderLastTradePrice *uint256.Int) ([]*DAOCoinLimitOrderEntry, error) {
+	var outputOrders []*DAOCoinLimitOrderEntry
+	var err error
+
+	err = backend.badgerDb.View(func(txn *badger.Txn) error {
+		outputOrders, err = DBGetMatchingDAOCoinLimitOrders(
+			txn, inputOrder, lastSeenOrder, orderEntriesInView, matchingOrderLastTradePrice)
+		return err
+	})
+
+	return outputOrders, err
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinLimitOrderFillsForTransactor(
+	transactorPKID *PKID, limit int) ([]*DAOCoinLimitOrderFillEntry, error) {
+	return DBGetDAOCoinLimitOrderFillEntriesForTransactor(backend.badgerDb, backend.snapshot, transactorPKID, limit)
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinLimitOrderFillsForCoinPair(
+	coinPKID1 *PKID, coinPKID2 *PKID, limit int) ([]*DAOCoinLimitOrderFillEntry, error) {
+	return DBGetDAOCoinLimitOrderFillEntriesForCoinPair(backend.badgerDb, backend.snapshot, coinPKID1, coinPKID2, limit)
+}
+
+//
+// PKID
+//
+
+func (backend *BadgerStorageBackend) GetPKIDForPublicKey(pkBytes []byte) *PKID {
+	pkidEntry := DBGetPKIDEntryForPublicKey(backend.badgerDb, backend.snapshot, pkBytes)
+	if pkidEntry == nil {
+		return nil
+	}
+	return pkidEntry.PKID
+}
+
+func (backend *BadgerStorageBackend) GetPublicKeyForPKID(pkid *PKID) []byte {
+	return DBGetPublicKeyForPKID(backend.badgerDb, backend.snapshot, pkid)
+}
+
+//
+// UTXOs
+//
+
+func (backend *BadgerStorageBackend) GetUtxoEntryForUtxoKey(utxoKey *UtxoKey) *UtxoEntry {
+	return DbGetUtxoEntryForUtxoKey(backend.badgerDb, backend.snapshot, utxoKey)
+}
+
+func (backend *BadgerStorageBackend) GetUtxoEntriesForPublicKey(publicKey []byte) ([]*UtxoEntry, error) {
+	return DbGetUtxosForPubKey(publicKey, backend.badgerDb, backend.snapshot)
+}
+
+//
+// Profiles, posts, and social entries
+//
+
+func (backend *BadgerStorageBackend) GetProfileEntryForUsername(nonLowercaseUsername []byte) *ProfileEntry {
+	return DBGetProfileEntryForUsername(backend.badgerDb, backend.snapshot, nonLowercaseUsername)
+}
+
+func (backend *BadgerStorageBackend) GetProfileEntryForPKID(pkid *PKID) *ProfileEntry {
+	return DBGetProfileEntryForPKID(backend.badgerDb, backend.snapshot, pkid)
+}
+
+func (backend *BadgerStorageBackend) GetPostEntryForPostHash(postHash *BlockHash) *PostEntry {
+	return DBGetPostEntryByPostHash(backend.badgerDb, backend.snapshot, postHash)
+}
+
+func (backend *BadgerStorageBackend) GetCommentEntriesForParentStakeID(parentStakeID []byte) ([]*PostEntry, error) {
+	_, commentHashes, _, err := DBGetCommentPostHashesForParentStakeID(
+		backend.badgerDb, backend.snapshot, parentStakeID, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetCommentEntriesForParentStakeID: Problem fetching comments: ")
+	}
+	var commentEntries []*PostEntry
+	for _, commentHash := range commentHashes {
+		if commentEntry := backend.GetPostEntryForPostHash(commentHash); commentEntry != nil {
+			commentEntries = append(commentEntries, commentEntry)
+		}
+	}
+	return commentEntries, nil
+}
+
+func (backend *BadgerStorageBackend) GetLikeEntry(likerPublicKey []byte, likedPostHash *BlockHash) *LikeEntry {
+	if DbGetLikerPubKeyToLikedPostHashMapping(backend.badgerDb, backend.snapshot, likerPublicKey, *likedPostHash) == nil {
+		return nil
+	}
+	return &LikeEntry{
+		LikerPubKey:   likerPublicKey,
+		LikedPostHash: likedPostHash,
+	}
+}
+
+func (backend *BadgerStorageBackend) GetLikeEntriesForPostHash(postHash *BlockHash) ([]*LikeEntry, error) {
+	dbPrefix := append([]byte{}, Prefixes.PrefixLikedPostHashToLikerPubKey...)
+	dbPrefix = append(dbPrefix, postHash[:]...)
+	keysFound, _ := EnumerateKeysForPrefix(backend.badgerDb, dbPrefix, true)
+
+	expectedKeyLength := 1 + HashSizeBytes + btcec.PubKeyBytesLenCompressed
+	var likeEntries []*LikeEntry
+	for _, key := range keysFound {
+		// Sanity check that this is a reasonable key.
+		if len(key) != expectedKeyLength {
+			return nil, fmt.Errorf("GetLikeEntriesForPostHash: Invalid key length found: %d", len(key))
+		}
+		likeEntries = append(likeEntries, &LikeEntry{
+			LikerPubKey:   key[1+HashSizeBytes:],
+			LikedPostHash: postHash.NewBlockHash(),
+		})
+	}
+	return likeEntries, nil
+}
+
+func (backend *BadgerStorageBackend) GetDiamondEntry(
+	senderPKID *PKID, receiverPKID *PKID, diamondPostHash *BlockHash) *DiamondEntry {
+
+	return DbGetDiamondMappings(backend.badgerDb, backend.snapshot, receiverPKID, senderPKID, diamondPostHash)
+}
+
+func (backend *BadgerStorageBackend) GetFollowEntry(followerPKID *PKID, followedPKID *PKID) *FollowEntry {
+	if DbGetFollowerToFollowedMapping(backend.badgerDb, backend.snapshot, followerPKID, followedPKID) == nil {
+		return nil
+	}
+	return &FollowEntry{
+		FollowerPKID: followerPKID.NewPKID(),
+		FollowedPKID: followedPKID.NewPKID(),
+	}
+}
+
+func (backend *BadgerStorageBackend) GetFollowEntriesForPKID(pkid *PKID, getEntriesFollowingPKID bool) (
+	[]*FollowEntry, error) {
+
+	var followEntries []*FollowEntry
+	if getEntriesFollowingPKID {
+		followerPKIDs, err := DbGetPKIDsFollowingYou(backend.badgerDb, pkid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetFollowEntriesForPKID: ")
+		}
+		for _, followerPKID := range followerPKIDs {
+			followEntries = append(followEntries, &FollowEntry{FollowerPKID: followerPKID, FollowedPKID: pkid.NewPKID()})
+		}
+	} else {
+		followedPKIDs, err := DbGetPKIDsYouFollow(backend.badgerDb, pkid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetFollowEntriesForPKID: ")
+		}
+		for _, followedPKID := range followedPKIDs {
+			followEntries = append(followEntries, &FollowEntry{FollowerPKID: pkid.NewPKID(), FollowedPKID: followedPKID})
+		}
+	}
+	return followEntries, nil
+}
+
+//
+// NFTs
+//
+
+func (backend *BadgerStorageBackend) GetNFTEntry(nftPostHash *BlockHash, serialNumber uint64) *NFTEntry {
+	return DBGetNFTEntryByPostHashSerialNumber(backend.badgerDb, backend.snapshot, nftPostHash, serialNumber)
+}
+
+func (backend *BadgerStorageBackend) GetNFTEntriesForPostHash(nftPostHash *BlockHash) []*NFTEntry {
+	return DBGetNFTEntriesForPostHash(backend.badgerDb, nftPostHash)
+}
+
+func (backend *BadgerStorageBackend) GetNFTEntriesForPKID(ownerPKID *PKID) []*NFTEntry {
+	return DBGetNFTEntriesForPKID(backend.badgerDb, ownerPKID)
+}
+
+func (backend *BadgerStorageBackend) GetPaginatedNFTEntriesForOwnerPKID(
+	ownerPKID *PKID, startingNFTKey *NFTKey, limit uint32) ([]*NFTEntry, error) {
+
+	return DBGetPaginatedNFTEntriesForOwnerPKID(backend.badgerDb, backend.snapshot, ownerPKID, startingNFTKey, limit)
+}
+
+func (backend *BadgerStorageBackend) GetNFTBidEntry(nftBidKey *NFTBidKey) *NFTBidEntry {
+	return DBGetNFTBidEntryForNFTBidKey(backend.badgerDb, backend.snapshot, nftBidKey)
+}
+
+func (backend *BadgerStorageBackend) GetNFTBidEntriesForPKID(bidderPKID *PKID) []*NFTBidEntry {
+	return DBGetNFTBidEntriesForPKID(backend.badgerDb, bidderPKID)
+}
+
+func (backend *BadgerStorageBackend) GetNFTBidEntriesForSerialNumber(
+	nftPostHash *BlockHash, serialNumber uint64) []*NFTBidEntry {
+
+	return DBGetNFTBidEntries(backend.badgerDb, nftPostHash, serialNumber)
+}
+
+//
+// AccessGroups
+//
+
+// GetAccessGroupEntryByAccessGroupId returns the AccessGroupEntry for the given AccessGroupId from db.
+func (backend *BadgerStorageBackend) GetAccessGroupEntryByAccessGroupId(accessGroupId *AccessGroupId) (*AccessGroupEntry, error) {
+	if accessGroupId == nil {
+		glog.Errorf("GetAccessGroupEntryByAccessGroupId: Called with nil accessGroupId, this should never happen")
+		return nil, nil
+	}
+
+	return DBGetAccessGroupEntryByAccessGroupId(backend.badgerDb, backend.snapshot,
+		&accessGroupId.AccessGroupOwnerPublicKey, &accessGroupId.AccessGroupKeyName)
+}
+
+// GetAccessGroupExistenceByAccessGroupId returns true if the given AccessGroupId exists in db using optimized key-only lookup.
+func (backend *BadgerStorageBackend) GetAccessGroupExistenceByAccessGroupId(accessGroupId *AccessGroupId) (bool, error) {
+	if accessGroupId == nil {
+		glog.Errorf("GetAccessGroupExistenceByAccessGroupId: Called with nil accessGroupId, this should never happen")
+		return false, nil
+	}
+
+	return DBGetAccessGroupExistenceByAccessGroupId(backend.badgerDb, backend.snapshot,
+		&accessGroupId.AccessGroupOwnerPublicKey, &accessGroupId.AccessGroupKeyName)
+}
+
+// GetAccessGroupIdsForOwner returns all the AccessGroupIds registered by given accessGroupOwnerPublicKey from db.
+func (backend *BadgerStorageBackend) GetAccessGroupIdsForOwner(ownerPublicKey *PublicKey) (_accessGroupIdsOwned []*AccessGroupId, _err error) {
+	if ownerPublicKey == nil {
+		glog.Errorf("GetAccessGroupEntriesForOwner: Called with nil ownerPublicKey, this should never happen")
+		return nil, nil
+	}
+
+	accessGroupIds, err := DBGetAccessGroupIdsForOwner(backend.badgerDb, backend.snapshot, *ownerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return accessGroupIds, nil
+}
+
+// GetAccessGroupIdsForMember returns all the AccessGroupIds that given memberPublicKey is a member of from db.
+func (backend *BadgerStorageBackend) GetAccessGroupIdsForMember(memberPublicKey *PublicKey) (_accessGroupIdsMember []*AccessGroupId, _err error) {
+	if memberPublicKey == nil {
+		glog.Errorf("GetAccessGroupEntriesForMember: Called with nil memberPublicKey, this should never happen")
+		return nil, nil
+	}
+
+	accessGroupIds, err := DBGetAccessGroupIdsForMember(backend.badgerDb, backend.snapshot, *memberPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return accessGroupIds, nil
+}
+
+//
+// AccessGroupMembers
+//
+
+// GetAccessGroupMemberEntry returns the AccessGroupMemberEntry for the given accessGroupMemberPublicKey and
+// the group identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db.
+func (backend *BadgerStorageBackend) GetAccessGroupMemberEntry(accessGroupMemberPublicKey PublicKey,
+	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName) (*AccessGroupMemberEntry, error) {
+
+	return DBGetAccessGroupMemberEntry(backend.badgerDb, backend.snapshot,
+		accessGroupMemberPublicKey, accessGroupOwnerPublicKey, accessGroupKeyName)
+}
+
+// GetAccessGroupMemberEnumerationEntry returns a bool indicating whether the given accessGroupMemberPublicKey is a member
+// of the group identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db, using optimized key-only lookup.
+func (backend *BadgerStorageBackend) GetAccessGroupMemberEnumerationEntry(accessGroupMemberPublicKey PublicKey,
+	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName) (_exists bool, _err error) {
+
+	// TODO: Use similar function signatures.
+	return DBGetAccessGroupMemberExistenceFromEnumerationIndex(backend.badgerDb, backend.snapshot,
+		accessGroupMemberPublicKey, accessGroupOwnerPublicKey, accessGroupKeyName)
+}
+
+// GetPaginatedAccessGroupMembersEnumerationEntries returns a list of accessGroupMemberPublicKeys that are members of the group
+// identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db. The list is paginated by the given offset
+// startingGroupMemberPublicKeyBytes, so that each return publicKey is lexicographically greater than the offset.
+// The list is also limited to at most the given length of maxMembersToFetch. Returned public keys will be in
+// lexicographically ascending order.
+func (backend *BadgerStorageBackend) GetPaginatedAccessGroupMembersEnumerationEntries(
+	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName,
+	startingAccessGroupMemberPublicKeyBytes []byte, maxMembersToFetch uint32) (
+	_accessGroupMemberPublicKeys []*PublicKey, _err error) {
+
+	if maxMembersToFetch == 0 {
+		return nil, nil
+	}
+
+	return DBGetPaginatedAccessGroupMembersFromEnumerationIndex(backend.badgerDb, backend.snapshot,
+		accessGroupOwnerPublicKey, accessGroupKeyName,
+		startingAccessGroupMemberPublicKeyBytes, maxMembersToFetch)
+}
+
+//
+// NewMessage
+//
+
+// GetDmMessageEntry returns the NewMessageEntry for the given DmMessageKey from db.
+func (backend *BadgerStorageBackend) GetDmMessageEntry(dmMessageKey DmMessageKey) (*NewMessageEntry, error) {
+	return DBGetDmMessageEntry(backend.badgerDb, backend.snapshot, dmMessageKey)
+}
+
+// GetGroupChatMessageEntry returns the NewMessageEntry for the given GroupChatMessageKey from db.
+func (backend *BadgerStorageBackend) GetGroupChatMessageEntry(groupChatMessageKey GroupChatMessageKey) (*NewMessageEntry, error) {
+	return DBGetGroupChatMessageEntry(backend.badgerDb, backend.snapshot, groupChatMessageKey)
+}
+
+// CheckDmThreadExistence returns a DmThreadEntry entry for the provided DmThreadKey from db.
+func (backend *BadgerStorageBackend) CheckDmThreadExistence(dmThreadKey DmThreadKey) (*DmThreadEntry, error) {
+	return DBCheckDmThreadExistence(backend.badgerDb, backend.snapshot, dmThreadKey)
+}
+
+// GetAllUserDmThreads returns a list of all the DmThreadKey entries associated with the given userAccessGroupOwnerPublicKey from db.
+func (backend *BadgerStorageBackend) GetAllUserDmThreads(userAccessGroupOwnerPublicKey PublicKey) (
+	_dmThreadKeys []*DmThreadKey, _err error) {
+
+	return DBGetAllUserDmThreads(backend.badgerDb, backend.snapshot, userAccessGroupOwnerPublicKey)
+}
+
+// GetPaginatedMessageEntriesForDmThread returns a list of NewMessageEntry entries for the given DmThreadKey from db.
+// The list is paginated by the given offset maxTimestamp (exclusive), so that each return message's timestamp is
+// less than the offset. The list is also limited to at most the given length of maxMessagesToFetch. Returned
+// messages will be in descending order by timestamp.
+func (backend *BadgerStorageBackend) GetPaginatedMessageEntriesForDmThread(dmThreadKey DmThreadKey, maxTimestamp uint64,
+	maxMessagesToFetch uint64) (_messageEntries []*NewMessageEntry, _err error) {
+
+	if maxMessagesToFetch == 0 {
+		return nil, nil
+	}
+
+	return DBGetPaginatedDmMessageEntry(backend.badgerDb, backend.snapshot,
+		dmThreadKey, maxTimestamp, maxMessagesToFetch)
+}
+
+// GetPaginatedMessageEntriesForGroupChatThread returns a list of NewMessageEntry entries for the given AccessGroupId from db.
+// The list is paginated by the given offset maxTimestamp (exclusive), so that each return message's timestamp is
+// less than the offset. The list is also limited to at most the given length of maxMessagesToFetch. Returned
+// messages will be in descending order by timestamp.
+func (backend *BadgerStorageBackend) GetPaginatedMessageEntriesForGroupChatThread(groupChatThread AccessGroupId, startingTimestamp uint64,
+	maxMessagesToFetch uint64) (_messageEntries []*NewMessageEntry, _err error) {
+
+	if maxMessagesToFetch == 0 {
+		return nil, nil
+	}
+
+	return DBGetPaginatedGroupChatMessageEntry(backend.badgerDb, backend.snapshot,
+		groupChatThread, startingTimestamp, maxMessagesToFetch)
+}
+
+//
+// Chain state
+//
+
+func (backend *BadgerStorageBackend) GetBestHash(chainType ChainType) *BlockHash {
+	return DbGetBestHash(backend.badgerDb, backend.snapshot, chainType)
+}
+
+func (backend *BadgerStorageBackend) GetUtxoNumEntries() uint64 {
+	return GetUtxoNumEntries(backend.badgerDb, backend.snapshot)
+}
+
+func (backend *BadgerStorageBackend) GetNanosPurchased() uint64 {
+	return DbGetNanosPurchased(backend.badgerDb, backend.snapshot)
+}
+
+func (backend *BadgerStorageBackend) GetUSDCentsPerBitcoinExchangeRate() uint64 {
+	return DbGetUSDCentsPerBitcoinExchangeRate(backend.badgerDb, backend.snapshot)
+}
+
+func (backend *BadgerStorageBackend) GetGlobalParamsEntry() *GlobalParamsEntry {
+	return DbGetGlobalParamsEntry(backend.badgerDb, backend.snapshot)
+}
+
+func (backend *BadgerStorageBackend) ExistsBitcoinBurnTxID(bitcoinBurnTxID *BlockHash) bool {
+	return DbExistsBitcoinBurnTxID(backend.badgerDb, backend.snapshot, bitcoinBurnTxID)
+}
+
+func (backend *BadgerStorageBackend) GetBlockNodeForHeightHash(height uint32, hash *BlockHash, bitcoinNodes bool) *BlockNode {
+	return GetHeightHashToNodeInfo(backend.badgerDb, backend.snapshot, height, hash, bitcoinNodes)
+}
+
+func (backend *BadgerStorageBackend) GetBlockRewardForPublicKeyBlockHash(publicKey []byte, blockHash *BlockHash) (
+	uint64, error) {
+
+	return DbGetBlockRewardForPublicKeyBlockHash(backend.badgerDb, backend.snapshot, publicKey, blockHash)
+}
+
+func (backend *BadgerStorageBackend) GetTransactorNonceEntry(nonce *DeSoNonce, pkid *PKID) (
+	*TransactorNonceEntry, error) {
+
+	return DbGetTransactorNonceEntry(backend.badgerDb, backend.snapshot, nonce, pkid)
+}
+
+func (backend *BadgerStorageBackend) GetTransactorNonceEntriesToExpireAtBlockHeight(blockHeight uint64) (
+	[]*TransactorNonceEntry, error) {
+
+	return DbGetTransactorNonceEntriesToExpireAtBlockHeight(backend.badgerDb, blockHeight)
+}
+
+func (backend *BadgerStorageBackend) GetBlockProducerRegistryEntry(publicKey []byte) (
+	*BlockProducerRegistryEntry, error) {
+
+	return DBGetBlockProducerRegistryEntry(backend.badgerDb, backend.snapshot, publicKey)
+}
+
+func (backend *BadgerStorageBackend) GetDeadKeyEntry(publicKey []byte) (*DeadKeyEntry, error) {
+	return DBGetDeadKeyEntry(backend.badgerDb, backend.snapshot, publicKey)
+}
+
+func (backend *BadgerStorageBackend) GetAllDeadKeyEntries() ([]*DeadKeyEntry, error) {
+	return DBGetAllDeadKeyEntries(backend.badgerDb)
+}
+
+func (backend *BadgerStorageBackend) GetExchangeRateFeedEntry(publicKey []byte) (*ExchangeRateFeedEntry, error) {
+	return DBGetExchangeRateFeedEntry(backend.badgerDb, backend.snapshot, publicKey)
+}
+
+func (backend *BadgerStorageBackend) GetAllExchangeRateFeedEntries() ([]*ExchangeRateFeedEntry, error) {
+	return DBGetAllExchangeRateFeedEntries(backend.badgerDb)
+}
+
+func (backend *BadgerStorageBackend) GetExternalHeaderRelayerEntry(publicKey []byte) (
+	*ExternalHeaderRelayerEntry, error) {
+
+	return DBGetExternalHeaderRelayerEntry(backend.badgerDb, backend.snapshot, publicKey)
+}
+
+func (backend *BadgerStorageBackend) GetExternalHeaderEntry(externalChain ExternalChain, blockHash *BlockHash) (
+	*ExternalHeaderEntry, error) {
+
+	return DBGetExternalHeaderEntry(backend.badgerDb, backend.snapshot, externalChain, blockHash)
+}
+
+func (backend *BadgerStorageBackend) GetTopExternalHeaderEntry(externalChain ExternalChain, blockHashesToSkip *Set[BlockHash]) (
+	*ExternalHeaderEntry, error) {
+
+	return DBGetTopExternalHeaderEntry(backend.badgerDb, backend.snapshot, externalChain, blockHashesToSkip)
+}
+
+func (backend *BadgerStorageBackend) GetMultisigEntry(ownerPKID *PKID) (*MultisigEntry, error) {
+	return DBGetMultisigEntry(backend.badgerDb, backend.snapshot, ownerPKID)
+}
+
+func (backend *BadgerStorageBackend) GetProposalEntry(proposalID *BlockHash) (*ProposalEntry, error) {
+	return DBGetProposalEntry(backend.badgerDb, backend.snapshot, proposalID)
+}
+
+func (backend *BadgerStorageBackend) GetProposalEntriesForProfile(profilePKID *PKID) ([]*ProposalEntry, error) {
+	return DBGetProposalEntriesForProfile(backend.badgerDb, backend.snapshot, profilePKID)
+}
+
+func (backend *BadgerStorageBackend) GetVoteEntry(proposalID *BlockHash, voterPKID *PKID) (*VoteEntry, error) {
+	return DBGetVoteEntry(backend.badgerDb, backend.snapshot, proposalID, voterPKID)
+}
+
+func (backend *BadgerStorageBackend) GetVoteEntriesForProposal(proposalID *BlockHash) ([]*VoteEntry, error) {
+	return DBGetVoteEntriesForProposal(backend.badgerDb, proposalID)
+}
+
+//
+// Profiles, posts, and messages
+//
+
+func (backend *BadgerStorageBackend) GetAllProfilesByCoinValue(fetchEntries bool) (
+	_lockedDeSoNanos []uint64, _profilePKIDs []*PKID, _profileEntries []*ProfileEntry, _err error) {
+
+	return DBGetAllProfilesByCoinValue(backend.badgerDb, backend.snapshot, fetchEntries)
+}
+
+func (backend *BadgerStorageBackend) GetAllPostsByTstamp(fetchEntries bool) (
+	_tstamps []uint64, _postHashes []*BlockHash, _postEntries []*PostEntry, _err error) {
+
+	return DBGetAllPostsByTstamp(backend.badgerDb, backend.snapshot, fetchEntries)
+}
+
+func (backend *BadgerStorageBackend) GetCommentPostHashesForParentStakeID(parentStakeID []byte, fetchEntries bool) (
+	_tstamps []uint64, _commentPostHashes []*BlockHash, _commentPostEntries []*PostEntry, _err error) {
+
+	return DBGetCommentPostHashesForParentStakeID(backend.badgerDb, backend.snapshot, parentStakeID, fetchEntries)
+}
+
+func (backend *BadgerStorageBackend) GetRepostEntry(userPubKey []byte, repostedPostHash BlockHash) *RepostEntry {
+	return DbReposterPubKeyRepostedPostHashToRepostEntry(backend.badgerDb, backend.snapshot, userPubKey, repostedPostHash)
+}
+
+func (backend *BadgerStorageBackend) GetPKIDsThatDiamondedYouMap(yourPKID *PKID, fetchYouDiamonded bool) (
+	map[PKID][]*DiamondEntry, error) {
+
+	return DbGetPKIDsThatDiamondedYouMap(backend.badgerDb, yourPKID, fetchYouDiamonded)
+}
+
+func (backend *BadgerStorageBackend) GetDiamondEntriesForSenderToReceiver(receiverPKID, senderPKID *PKID) (
+	[]*DiamondEntry, error) {
+
+	return DbGetDiamondEntriesForSenderToReceiver(backend.badgerDb, receiverPKID, senderPKID)
+}
+
+func (backend *BadgerStorageBackend) GetProfilePicBlob(blobHash *BlockHash) []byte {
+	return DbGetProfilePicBlob(backend.badgerDb, blobHash)
+}
+
+func (backend *BadgerStorageBackend) GetMessageEntry(publicKey []byte, tstampNanos uint64) *MessageEntry {
+	return DBGetMessageEntry(backend.badgerDb, backend.snapshot, publicKey, tstampNanos)
+}
+
+func (backend *BadgerStorageBackend) GetMessagingGroupEntry(messagingGroupKey *MessagingGroupKey) *MessagingGroupEntry {
+	return DBGetMessagingGroupEntry(backend.badgerDb, backend.snapshot, messagingGroupKey)
+}
+
+func (backend *BadgerStorageBackend) GetAllUserGroupEntries(ownerPublicKey []byte) ([]*MessagingGroupEntry, error) {
+	return DBGetAllUserGroupEntries(backend.badgerDb, ownerPublicKey)
+}
+
+func (backend *BadgerStorageBackend) GetLimitedMessageForMessagingKeys(messagingKeys []*MessagingGroupEntry, limit uint64) (
+	[]*MessageEntry, error) {
+
+	return DBGetLimitedMessageForMessagingKeys(backend.badgerDb, messagingKeys, limit)
+}
+
+//
+// NFT bids, auctions, bundles, leases, and swaps
+//
+
+func (backend *BadgerStorageBackend) GetNFTBidEntriesPaginated(nftHash *BlockHash, serialNumber uint64, startEntry *NFTBidEntry, limit int, reverse bool) []*NFTBidEntry {
+	return DBGetNFTBidEntriesPaginated(backend.badgerDb, nftHash, serialNumber, startEntry, limit, reverse)
+}
+
+func (backend *BadgerStorageBackend) GetAcceptedNFTBidEntriesByPostHashSerialNumber(postHash *BlockHash, serialNumber uint64) *[]*NFTBidEntry {
+	return DBGetAcceptedNFTBidEntriesByPostHashSerialNumber(backend.badgerDb, backend.snapshot, postHash, serialNumber)
+}
+
+func (backend *BadgerStorageBackend) GetNFTKeysForAuctionsEndingAtBlockHeight(auctionEndBlockHeight uint64) (
+	[]NFTKey, error) {
+
+	return DBGetNFTKeysForAuctionsEndingAtBlockHeight(backend.badgerDb, auctionEndBlockHeight)
+}
+
+func (backend *BadgerStorageBackend) GetNFTBundleEntry(bundleID *BlockHash) (*NFTBundleEntry, error) {
+	return DBGetNFTBundleEntry(backend.badgerDb, backend.snapshot, bundleID)
+}
+
+func (backend *BadgerStorageBackend) GetNFTBundleEntriesForSeller(sellerPKID *PKID) ([]*NFTBundleEntry, error) {
+	return DBGetNFTBundleEntriesForSeller(backend.badgerDb, backend.snapshot, sellerPKID)
+}
+
+func (backend *BadgerStorageBackend) GetNFTEntriesForLesseePKID(lesseePKID *PKID) ([]*NFTEntry, error) {
+	return DBGetNFTEntriesForLesseePKID(backend.badgerDb, backend.snapshot, lesseePKID)
+}
+
+func (backend *BadgerStorageBackend) GetNFTSwapEntry(swapID *BlockHash) (*NFTSwapEntry, error) {
+	return DBGetNFTSwapEntry(backend.badgerDb, backend.snapshot, swapID)
+}
+
+func (backend *BadgerStorageBackend) GetNFTSwapEntriesForPKID(pkid *PKID) ([]*NFTSwapEntry, error) {
+	return DBGetNFTSwapEntriesForPKID(backend.badgerDb, backend.snapshot, pkid)
+}
+
+func (backend *BadgerStorageBackend) GetRoyaltySplitEntry(royaltySplitID *BlockHash) (*RoyaltySplitEntry, error) {
+	return DBGetRoyaltySplitEntry(backend.badgerDb, backend.snapshot, royaltySplitID)
+}
+
+func (backend *BadgerStorageBackend) GetRoyaltySplitEntriesForCreator(creatorPKID *PKID) (
+	[]*RoyaltySplitEntry, error) {
+
+	return DBGetRoyaltySplitEntriesForCreator(backend.badgerDb, backend.snapshot, creatorPKID)
+}
+
+//
+// DAO coins
+//
+
+func (backend *BadgerStorageBackend) GetDAOCoinLastTradePriceEntry(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID *PKID) (
+	*DAOCoinLastTradePriceEntry, error) {
+
+	return DBGetDAOCoinLastTradePriceEntry(backend.badgerDb, backend.snapshot, buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinLimitOrderFillEntry(txnHash *BlockHash, fillIndex uint32) (
+	*DAOCoinLimitOrderFillEntry, error) {
+
+	return DBGetDAOCoinLimitOrderFillEntry(backend.badgerDb, backend.snapshot, txnHash, fillIndex)
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinMetadataEntry(creatorPKID *PKID) (*DAOCoinMetadataEntry, error) {
+	return DBGetDAOCoinMetadataEntry(backend.badgerDb, backend.snapshot, creatorPKID)
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinStreamEntry(streamID *BlockHash) (*DAOCoinStreamEntry, error) {
+	return DBGetDAOCoinStreamEntry(backend.badgerDb, backend.snapshot, streamID)
+}
+
+func (backend *BadgerStorageBackend) GetDAOCoinStreamEntriesForPKID(pkid *PKID, asPayee bool) (
+	[]*DAOCoinStreamEntry, error) {
+
+	return DBGetDAOCoinStreamEntriesForPKID(backend.badgerDb, backend.snapshot, pkid, asPayee)
+}
+
+func (backend *BadgerStorageBackend) GetEscrowEntry(escrowID *BlockHash) (*EscrowEntry, error) {
+	return DBGetEscrowEntry(backend.badgerDb, backend.snapshot, escrowID)
+}
+
+func (backend *BadgerStorageBackend) GetEscrowEntriesForOwnerPKID(ownerPKID *PKID) ([]*EscrowEntry, error) {
+	return DBGetEscrowEntriesForOwnerPKID(backend.badgerDb, backend.snapshot, ownerPKID)
+}
+
+//
+// Lockups
+//
+
+func (backend *BadgerStorageBackend) GetLockedBalanceEntryForLockedBalanceEntryKey(lockedBalanceEntryKey LockedBalanceEntryKey) (
+	*LockedBalanceEntry, error) {
+
+	return DBGetLockedBalanceEntryForLockedBalanceEntryKey(backend.badgerDb, backend.snapshot, lockedBalanceEntryKey)
+}
+
+func (backend *BadgerStorageBackend) GetAllLockedBalanceEntriesForHodlerPKID(hodlerPKID *PKID) (
+	[]*LockedBalanceEntry, error) {
+
+	return DBGetAllLockedBalanceEntriesForHodlerPKID(backend.badgerDb, hodlerPKID)
+}
+
+func (backend *BadgerStorageBackend) GetLimitedVestedLockedBalanceEntries(hodlerPKID, profilePKID *PKID, unlockTimestampNanoSecs, vestingEndTimestampNanoSecs int64, limitToFetch int) (
+	[]*LockedBalanceEntry, error) {
+
+	return DBGetLimitedVestedLockedBalanceEntries(backend.badgerDb, hodlerPKID, profilePKID, unlockTimestampNanoSecs, vestingEndTimestampNanoSecs, limitToFetch)
+}
+
+func (backend *BadgerStorageBackend) GetUnlockableLockedBalanceEntries(hodlerPKID, profilePKID *PKID, currentTimestampUnixNanoSecs int64) (
+	_unvestedUnlockableLockedBalanceEntries []*LockedBalanceEntry, _vestedUnlockableLockedEntries []*LockedBalanceEntry, _err error) {
+
+	return DBGetUnlockableLockedBalanceEntries(backend.badgerDb, hodlerPKID, profilePKID, currentTimestampUnixNanoSecs)
+}
+
+func (backend *BadgerStorageBackend) GetYieldCurvePointsByProfilePKIDAndDurationNanoSecs(profilePKID *PKID, lockupDurationNanoSecs int64) (
+	*LockupYieldCurvePoint, error) {
+
+	return DBGetYieldCurvePointsByProfilePKIDAndDurationNanoSecs(backend.badgerDb, backend.snapshot, profilePKID, lockupDurationNanoSecs)
+}
+
+func (backend *BadgerStorageBackend) GetAllYieldCurvePointsByProfilePKID(profilePKID *PKID) (
+	[]*LockupYieldCurvePoint, error) {
+
+	return DBGetAllYieldCurvePointsByProfilePKID(backend.badgerDb, backend.snapshot, profilePKID)
+}
+
+//
+// Validators and stakes
+//
+
+func (backend *BadgerStorageBackend) GetValidatorByPKID(pkid *PKID) (*ValidatorEntry, error) {
+	return DBGetValidatorByPKID(backend.badgerDb, backend.snapshot, pkid)
+}
+
+func (backend *BadgerStorageBackend) GetValidatorBLSPublicKeyPKIDPairEntry(blsPublicKey *bls.PublicKey) (
+	*BLSPublicKeyPKIDPairEntry, error) {
+
+	return DBGetValidatorBLSPublicKeyPKIDPairEntry(backend.badgerDb, backend.snapshot, blsPublicKey)
+}
+
+func (backend *BadgerStorageBackend) GetTopActiveValidatorsByStakeAmount(limit uint64, validatorEntriesToSkip []*ValidatorEntry) (
+	[]*ValidatorEntry, error) {
+
+	return DBGetTopActiveValidatorsByStakeAmount(backend.badgerDb, backend.snapshot, limit, validatorEntriesToSkip)
+}
+
+func (backend *BadgerStorageBackend) GetStakeEntry(validatorPKID, stakerPKID *PKID) (*StakeEntry, error) {
+	return DBGetStakeEntry(backend.badgerDb, backend.snapshot, validatorPKID, stakerPKID)
+}
+
+func (backend *BadgerStorageBackend) GetStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*StakeEntry, error) {
+	return DBGetStakeEntriesForValidatorPKID(backend.badgerDb, backend.snapshot, validatorPKID)
+}
+
+func (backend *BadgerStorageBackend) GetStakeEntriesForStakerPKID(stakerPKID *PKID) ([]*StakeEntry, error) {
+	return DBGetStakeEntriesForStakerPKID(backend.badgerDb, backend.snapshot, stakerPKID)
+}
+
+func (backend *BadgerStorageBackend) GetTopStakesForValidatorsByStakeAmount(limit uint64, validatorPKIDsToInclude *Set[PKID], stakeEntriesToSkip []*StakeEntry) (
+	[]*StakeEntry, error) {
+
+	return DBGetTopStakesForValidatorsByStakeAmount(backend.badgerDb, backend.snapshot, limit, validatorPKIDsToInclude, stakeEntriesToSkip)
+}
+
+func (backend *BadgerStorageBackend) ValidatorHasDelegatedStake(validatorPKID *PKID, utxoDeletedStakeEntries []*StakeEntry) (
+	bool, error) {
+
+	return DBValidatorHasDelegatedStake(backend.badgerDb, backend.snapshot, validatorPKID, utxoDeletedStakeEntries)
+}
+
+func (backend *BadgerStorageBackend) GetLockedStakeEntry(validatorPKID, stakerPKID *PKID, lockedAtEpochNumber uint64) (
+	*LockedStakeEntry, error) {
+
+	return DBGetLockedStakeEntry(backend.badgerDb, backend.snapshot, validatorPKID, stakerPKID, lockedAtEpochNumber)
+}
+
+func (backend *BadgerStorageBackend) GetLockedStakeEntriesForStakerPKID(stakerPKID *PKID) (
+	[]*LockedStakeEntry, error) {
+
+	return DBGetLockedStakeEntriesForStakerPKID(backend.badgerDb, backend.snapshot, stakerPKID)
+}
+
+func (backend *BadgerStorageBackend) GetLockedStakeEntriesForValidatorPKID(validatorPKID *PKID) (
+	[]*LockedStakeEntry, error) {
+
+	return DBGetLockedStakeEntriesForValidatorPKID(backend.badgerDb, backend.snapshot, validatorPKID)
+}
+
+func (backend *BadgerStorageBackend) GetLockedStakeEntriesInRange(validatorPKID, stakerPKID *PKID, startEpochNumber, endEpochNumber uint64) (
+	[]*LockedStakeEntry, error) {
+
+	return DBGetLockedStakeEntriesInRange(backend.badgerDb, backend.snapshot, validatorPKID, stakerPKID, startEpochNumber, endEpochNumber)
+}
+
+func (backend *BadgerStorageBackend) GetValidatorRewardIndexEntry(validatorPKID *PKID) (
+	*ValidatorRewardIndexEntry, error) {
+
+	return DBGetValidatorRewardIndexEntry(backend.badgerDb, backend.snapshot, validatorPKID)
+}
+
+func (backend *BadgerStorageBackend) GetValidatorRewardIndexEntryAtEpochEnd(validatorPKID *PKID, epochNumber uint64) (
+	*ValidatorRewardIndexEntry, error) {
+
+	return DBGetValidatorRewardIndexEntryAtEpochEnd(backend.badgerDb, backend.snapshot, validatorPKID, epochNumber)
+}
+
+//
+// Epochs and snapshots
+//
+
+func (backend *BadgerStorageBackend) GetCurrentEpochEntry() (*EpochEntry, error) {
+	return DBGetCurrentEpochEntry(backend.badgerDb, backend.snapshot)
+}
+
+func (backend *BadgerStorageBackend) GetCurrentRandomSeedHash() (*RandomSeedHash, error) {
+	return DBGetCurrentRandomSeedHash(backend.badgerDb, backend.snapshot)
+}
+
+func (backend *BadgerStorageBackend) GetSnapshotGlobalParamsEntry(snapshotAtEpochNumber uint64) (
+	*GlobalParamsEntry, error) {
+
+	return DBGetSnapshotGlobalParamsEntry(backend.badgerDb, backend.snapshot, snapshotAtEpochNumber)
+}
+
+func (backend *BadgerStorageBackend) GetSnapshotValidatorSetEntryByPKID(pkid *PKID, snapshotAtEpochNumber uint64) (
+	*ValidatorEntry, error) {
+
+	return DBGetSnapshotValidatorSetEntryByPKID(backend.badgerDb, backend.snapshot, pkid, snapshotAtEpochNumber)
+}
+
+func (backend *BadgerStorageBackend) GetSnapshotValidatorSetByStakeAmount(limit, snapshotAtEpochNumber uint64, validatorEntriesToSkip []*ValidatorEntry) (
+	[]*ValidatorEntry, error) {
+
+	return DBGetSnapshotValidatorSetByStakeAmount(backend.badgerDb, backend.snapshot, limit, snapshotAtEpochNumber, validatorEntriesToSkip)
+}
+
+func (backend *BadgerStorageBackend) GetSnapshotValidatorBLSPublicKeyPKIDPairEntry(blsPublicKey *bls.PublicKey, snapshotAtEpochNumber uint64) (
+	*BLSPublicKeyPKIDPairEntry, error) {
+
+	return DBGetSnapshotValidatorBLSPublicKeyPKIDPairEntry(backend.badgerDb, backend.snapshot, blsPublicKey, snapshotAtEpochNumber)
+}
+
+func (backend *BadgerStorageBackend) GetSnapshotStakesToReward(limit, snapshotAtEpochNumber uint64, stakeEntriesToSkip []*StakeEntry) (
+	[]*StakeEntry, error) {
+
+	return DBGetSnapshotStakesToReward(backend.badgerDb, backend.snapshot, limit, snapshotAtEpochNumber, stakeEntriesToSkip)
+}
+
+func (backend *BadgerStorageBackend) GetSnapshotLeaderScheduleValidator(leaderIndex uint16, snapshotAtEpochNumber uint64) (
+	*ValidatorEntry, error) {
+
+	return DBGetSnapshotLeaderScheduleValidator(backend.badgerDb, backend.snapshot, leaderIndex, snapshotAtEpochNumber)
+}
+
+func (backend *BadgerStorageBackend) GetSnapshotLeaderSchedule(snapshotAtEpochNumber uint64) (
+	map[uint16]*PKID, error) {
+
+	return DBSeekSnapshotLeaderSchedule(backend.badgerDb, snapshotAtEpochNumber)
+}
+
+//
+// ValidatorEpochPerformance
+//
+
+// GetValidatorEpochPerformanceEntry returns the validator's performance during the given epoch from db,
+// or nil if nothing was recorded for the validator in that epoch.
+func (backend *BadgerStorageBackend) GetValidatorEpochPerformanceEntry(
+	validatorPKID *PKID,
+	epochNumber uint64,
+) (*ValidatorEpochPerformanceEntry, error) {
+	return DBGetValidatorEpochPerformanceEntry(backend.badgerDb, backend.snapshot, validatorPKID, epochNumber)
+}
+
+// GetValidatorEpochPerformanceEntriesForPKID returns the validator's performance for every epoch in which
+// something was recorded from db, sorted by EpochNumber ASC.
+func (backend *BadgerStorageBackend) GetValidatorEpochPerformanceEntriesForPKID(
+	validatorPKID *PKID,
+) ([]*ValidatorEpochPerformanceEntry, error) {
+	return DBGetValidatorEpochPerformanceEntriesForPKID(backend.badgerDb, backend.snapshot, validatorPKID)
+}
@@ -0,0 +1,605 @@
+package lib
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+)
+
+// PostgresStorageBackend is the StorageBackend of nodes that run with Postgres. The entries
+// Postgres nodes keep in Postgres are read from Postgres. Everything else, like DAO coin
+// limit orders and the PoS entries, is read from badger through the embedded
+// BadgerStorageBackend.
+type PostgresStorageBackend struct {
+	*BadgerStorageBackend
+	postgresDb *Postgres
+}
+
+func NewPostgresStorageBackend(postgres *Postgres, handle *badger.DB, snap *Snapshot) *PostgresStorageBackend {
+	return &PostgresStorageBackend{
+		BadgerStorageBackend: NewBadgerStorageBackend(handle, snap),
+		postgresDb:           postgres,
+	}
+}
+
+func (backend *PostgresStorageBackend) Name() string {
+	return "postgres"
+}
+
+//
+// Chain state
+//
+
+// GetBestHash returns the tip of the block chain from Postgres, which doesn't store the tip
+// of the header chain.
+func (backend *PostgresStorageBackend) GetBestHash(chainType ChainType) *BlockHash {
+	if chainType != ChainTypeDeSoBlock {
+		return backend.BadgerStorageBackend.GetBestHash(chainType)
+	}
+	pgChain := backend.postgresDb.GetChain(MAIN_CHAIN)
+	if pgChain == nil {
+		return nil
+	}
+	return pgChain.TipHash
+}
+
+//
+// Associations
+//
+
+func (backend *PostgresStorageBackend) GetUserAssociationByID(associationID *BlockHash) (*UserAssociationEntry, error) {
+	return backend.postgresDb.GetUserAssociationByID(associationID)
+}
+
+func (backend *PostgresStorageBackend) GetPostAssociationByID(associationID *BlockHash) (*PostAssociationEntry, error) {
+	return backend.postgresDb.GetPostAssociationByID(associationID)
+}
+
+func (backend *PostgresStorageBackend) GetUserAssociationByAttributes(associationEntry *UserAssociationEntry) (*UserAssociationEntry, error) {
+	return backend.postgresDb.GetUserAssociationByAttributes(associationEntry)
+}
+
+func (backend *PostgresStorageBackend) GetPostAssociationByAttributes(associationEntry *PostAssociationEntry) (*PostAssociationEntry, error) {
+	return backend.postgresDb.GetPostAssociationByAttributes(associationEntry)
+}
+
+func (backend *PostgresStorageBackend) GetUserAssociationsByAttributes(
+	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) ([]*UserAssociationEntry, []byte, error) {
+	return backend.postgresDb.GetUserAssociationsByAttributes(associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *PostgresStorageBackend) GetPostAssociationsByAttributes(
+	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) ([]*PostAssociationEntry, []byte, error) {
+	return backend.postgresDb.GetPostAssociationsByAttributes(associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *PostgresStorageBackend) GetUserAssociationIdsByAttributes(
+	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (*Set[BlockHash], []byte, error) {
+	return backend.postgresDb.GetUserAssociationIdsByAttributes(associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *PostgresStorageBackend) GetPostAssociationIdsByAttributes(
+	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (*Set[BlockHash], []byte, error) {
+	return backend.postgresDb.GetPostAssociationIdsByAttributes(associationQuery, utxoViewAssociationIds)
+}
+
+func (backend *PostgresStorageBackend) SortUserAssociationEntriesByPrefix(
+	associationEntries []*UserAssociationEntry,
+	prefixType []byte,
+	sortDescending bool,
+) ([]*UserAssociationEntry, error) {
+	// Postgres sorts results by AssociationID.
+	sort.Slice(associationEntries, func(ii int, jj int) bool {
+		byteComparison := bytes.Compare(
+			associationEntries[ii].AssociationID.ToBytes(),
+			associationEntries[jj].AssociationID.ToBytes(),
+		)
+		if sortDescending {
+			return byteComparison > 0
+		}
+		return byteComparison <= 0
+	})
+	return associationEntries, nil
+}
+
+func (backend *PostgresStorageBackend) SortPostAssociationEntriesByPrefix(
+	associationEntries []*PostAssociationEntry,
+	prefixType []byte,
+	sortDescending bool,
+) ([]*PostAssociationEntry, error) {
+	// Postgres sorts results by AssociationID.
+	sort.Slice(associationEntries, func(ii int, jj int) bool {
+		byteComparison := bytes.Compare(
+			associationEntries[ii].AssociationID.ToBytes(),
+			associationEntries[jj].AssociationID.ToBytes(),
+		)
+		if sortDescending {
+			return byteComparison > 0
+		}
+		return byteComparison <= 0
+	})
+	return associationEntries, nil
+}
+
+//
+// Balance entry
+//
+
+func (backend *PostgresStorageBackend) GetBalanceEntry(holder *PKID, creator *PKID, isDAOCoin bool) *BalanceEntry {
+	if isDAOCoin {
+		return backend.postgresDb.GetDAOCoinBalance(holder, creator).NewBalanceEntry()
+	}
+
+	return backend.postgresDb.GetCreatorCoinBalance(holder, creator).NewBalanceEntry()
+}
+
+func (backend *PostgresStorageBackend) GetBalanceEntriesYouHold(pkid *PKID, isDAOCoin bool) ([]*BalanceEntry, error) {
+	var balanceEntries []*BalanceEntry
+	if isDAOCoin {
+		for _, balance := range backend.postgresDb.GetDAOCoinHoldings(pkid) {
+			balanceEntries = append(balanceEntries, balance.NewBalanceEntry())
+		}
+	} else {
+		for _, balance := range backend.postgresDb.GetCreatorCoinHoldings(pkid) {
+			balanceEntries = append(balanceEntries, balance.NewBalanceEntry())
+		}
+	}
+	return balanceEntries, nil
+}
+
+func (backend *PostgresStorageBackend) GetBalanceEntriesHodlingYou(pkid *PKID, isDAOCoin bool) ([]*BalanceEntry, error) {
+	var balanceEntries []*BalanceEntry
+	if isDAOCoin {
+		for _, balance := range backend.postgresDb.GetDAOCoinHolders(pkid) {
+			balanceEntries = append(balanceEntries, balance.NewBalanceEntry())
+		}
+	} else {
+		for _, balance := range backend.postgresDb.GetCreatorCoinHolders(pkid) {
+			balanceEntries = append(balanceEntries, balance.NewBalanceEntry())
+		}
+	}
+	return balanceEntries, nil
+}
+
+// GetDAOCoinHoldersByBalance sorts all of the coin's holders since Postgres stores balances
+// as hex strings, which can't be sorted numerically in the db.
+func (backend *PostgresStorageBackend) GetDAOCoinHoldersByBalance(
+	creatorPKID *PKID, lastHolder *BalanceEntry, limit int) ([]*BalanceEntry, error) {
+
+	holders := backend._getDAOCoinHoldersWithNonZeroBalance(creatorPKID)
+	sort.Slice(holders, func(ii, jj int) bool {
+		return _isDAOCoinHolderBefore(holders[ii], holders[jj])
+	})
+	startIndex := 0
+	if lastHolder != nil {
+		startIndex = sort.Search(len(holders), func(ii int) bool {
+			return _isDAOCoinHolderBefore(lastHolder, holders[ii])
+		})
+	}
+	holders = holders[startIndex:]
+	if len(holders) > limit {
+		holders = holders[:limit]
+	}
+	return holders, nil
+}
+
+func (backend *PostgresStorageBackend) GetDAOCoinHolderCount(creatorPKID *PKID) (uint64, error) {
+	return uint64(len(backend._getDAOCoinHoldersWithNonZeroBalance(creatorPKID))), nil
+}
+
+func (backend *PostgresStorageBackend) _getDAOCoinHoldersWithNonZeroBalance(creatorPKID *PKID) []*BalanceEntry {
+	var holders []*BalanceEntry
+	for _, balance := range backend.postgresDb.GetDAOCoinHolders(creatorPKID) {
+		balanceEntry := balance.NewBalanceEntry()
+		if balanceEntry.BalanceNanos.IsZero() {
+			continue
+		}
+		holders = append(holders, balanceEntry)
+	}
+	return holders
+}
+
+// GetDeSoBalanceForPublicKey returns the balance of the given public key in nanos.
+func (backend *PostgresStorageBackend) GetDeSoBalanceForPublicKey(publicKey []byte) (uint64, error) {
+	return backend.postgresDb.GetBalance(NewPublicKey(publicKey)), nil
+}
+
+//
+// Derived keys
+//
+
+func (backend *PostgresStorageBackend) GetOwnerToDerivedKeyMapping(ownerPublicKey PublicKey, derivedPublicKey PublicKey) *DerivedKeyEntry {
+	return backend.postgresDb.GetDerivedKey(&ownerPublicKey, &derivedPublicKey).NewDerivedKeyEntry()
+}
+
+func (backend *PostgresStorageBackend) GetAllOwnerToDerivedKeyMappings(ownerPublicKey PublicKey) ([]*DerivedKeyEntry, error) {
+	var derivedKeyEntries []*DerivedKeyEntry
+	for _, derivedKey := range backend.postgresDb.GetAllDerivedKeysForOwner(&ownerPublicKey) {
+		derivedKeyEntries = append(derivedKeyEntries, derivedKey.NewDerivedKeyEntry())
+	}
+	return derivedKeyEntries, nil
+}
+
+//
+// DAO coin limit order
+//
+
+// Temporarily use badger to support DAO Coin limit order DB operations. Postgres has
+// GetDAOCoinLimitOrder and the other getters, but they aren't kept up to date, so the
+// methods of the embedded BadgerStorageBackend are used instead.
+
+//
+// PKID
+//
+
+func (backend *PostgresStorageBackend) GetPKIDForPublicKey(pkBytes []byte) *PKID {
+	profile := backend.postgresDb.GetProfileForPublicKey(pkBytes)
+	if profile == nil {
+		return NewPKID(pkBytes)
+	}
+	return profile.PKID
+}
+
+// GetPublicKeyForPKID falls back to the PKID itself since Postgres only keeps PKIDs that
+// differ from their public key on profiles.
+func (backend *PostgresStorageBackend) GetPublicKeyForPKID(pkid *PKID) []byte {
+	profile := backend.postgresDb.GetProfile(*pkid)
+	if profile == nil {
+		return PKIDToPublicKey(pkid)
+	}
+	return profile.PublicKey.ToBytes()
+}
+
+//
+// UTXOs
+//
+
+func (backend *PostgresStorageBackend) GetUtxoEntryForUtxoKey(utxoKey *UtxoKey) *UtxoEntry {
+	return backend.postgresDb.GetUtxoEntryForUtxoKey(utxoKey)
+}
+
+func (backend *PostgresStorageBackend) GetUtxoEntriesForPublicKey(publicKey []byte) ([]*UtxoEntry, error) {
+	return backend.postgresDb.GetUtxoEntriesForPublicKey(publicKey), nil
+}
+
+//
+// Profiles, posts, and social entries
+//
+
+// GetProfileEntryForUsername and GetProfileEntryForPKID return nil for the empty profiles
+// Postgres stores when a swap identity occurs, like badger does.
+func (backend *PostgresStorageBackend) GetProfileEntryForUsername(nonLowercaseUsername []byte) *ProfileEntry {
+	return backend.postgresDb.GetProfileForUsername(string(nonLowercaseUsername)).NewProfileEntry()
+}
+
+func (backend *PostgresStorageBackend) GetProfileEntryForPKID(pkid *PKID) *ProfileEntry {
+	return backend.postgresDb.GetProfile(*pkid).NewProfileEntry()
+}
+
+func (backend *PostgresStorageBackend) GetPostEntryForPostHash(postHash *BlockHash) *PostEntry {
+	post := backend.postgresDb.GetPost(postHash)
+	if post == nil {
+		return nil
+	}
+	return post.NewPostEntry()
+}
+
+func (backend *PostgresStorageBackend) GetCommentEntriesForParentStakeID(parentStakeID []byte) ([]*PostEntry, error) {
+	var commentEntries []*PostEntry
+	for _, post := range backend.postgresDb.GetComments(NewBlockHash(parentStakeID)) {
+		commentEntries = append(commentEntries, post.NewPostEntry())
+	}
+	return commentEntries, nil
+}
+
+func (backend *PostgresStorageBackend) GetLikeEntry(likerPublicKey []byte, likedPostHash *BlockHash) *LikeEntry {
+	like := backend.postgresDb.GetLike(likerPublicKey, likedPostHash)
+	if like == nil {
+		return nil
+	}
+	return like.NewLikeEntry()
+}
+
+func (backend *PostgresStorageBackend) GetLikeEntriesForPostHash(postHash *BlockHash) ([]*LikeEntry, error) {
+	var likeEntries []*LikeEntry
+	for _, like := range backend.postgresDb.GetLikesForPost(postHash) {
+		likeEntries = append(likeEntries, like.NewLikeEntry())
+	}
+	return likeEntries, nil
+}
+
+func (backend *PostgresStorageBackend) GetDiamondEntry(
+	senderPKID *PKID, receiverPKID *PKID, diamondPostHash *BlockHash) *DiamondEntry {
+
+	diamond := backend.postgresDb.GetDiamond(senderPKID, receiverPKID, diamondPostHash)
+	if diamond == nil {
+		return nil
+	}
+	return &DiamondEntry{
+		SenderPKID:      diamond.SenderPKID,
+		ReceiverPKID:    diamond.ReceiverPKID,
+		DiamondPostHash: diamond.DiamondPostHash,
+		DiamondLevel:    int64(diamond.DiamondLevel),
+	}
+}
+
+func (backend *PostgresStorageBackend) GetFollowEntry(followerPKID *PKID, followedPKID *PKID) *FollowEntry {
+	follow := backend.postgresDb.GetFollow(followerPKID, followedPKID)
+	if follow == nil {
+		return nil
+	}
+	return follow.NewFollowEntry()
+}
+
+func (backend *PostgresStorageBackend) GetFollowEntriesForPKID(pkid *PKID, getEntriesFollowingPKID bool) (
+	[]*FollowEntry, error) {
+
+	var follows []*PGFollow
+	if getEntriesFollowingPKID {
+		follows = backend.postgresDb.GetFollowers(pkid)
+	} else {
+		follows = backend.postgresDb.GetFollowing(pkid)
+	}
+	var followEntries []*FollowEntry
+	for _, follow := range follows {
+		followEntries = append(followEntries, follow.NewFollowEntry())
+	}
+	return followEntries, nil
+}
+
+//
+// NFTs
+//
+
+func (backend *PostgresStorageBackend) GetNFTEntry(nftPostHash *BlockHash, serialNumber uint64) *NFTEntry {
+	nft := backend.postgresDb.GetNFT(nftPostHash, serialNumber)
+	if nft == nil {
+		return nil
+	}
+	return nft.NewNFTEntry()
+}
+
+func (backend *PostgresStorageBackend) GetNFTEntriesForPostHash(nftPostHash *BlockHash) []*NFTEntry {
+	var nftEntries []*NFTEntry
+	for _, nft := range backend.postgresDb.GetNFTsForPostHash(nftPostHash) {
+		nftEntries = append(nftEntries, nft.NewNFTEntry())
+	}
+	return nftEntries
+}
+
+func (backend *PostgresStorageBackend) GetNFTEntriesForPKID(ownerPKID *PKID) []*NFTEntry {
+	var nftEntries []*NFTEntry
+	for _, nft := range backend.postgresDb.GetNFTsForPKID(ownerPKID) {
+		nftEntries = append(nftEntries, nft.NewNFTEntry())
+	}
+	return nftEntries
+}
+
+// GetPaginatedNFTEntriesForOwnerPKID returns all of the owner's NFTs since Postgres doesn't
+// have the owner index. The UtxoView sorts and pages through them.
+func (backend *PostgresStorageBackend) GetPaginatedNFTEntriesForOwnerPKID(
+	ownerPKID *PKID, startingNFTKey *NFTKey, limit uint32) ([]*NFTEntry, error) {
+
+	return backend.GetNFTEntriesForPKID(ownerPKID), nil
+}
+
+func (backend *PostgresStorageBackend) GetNFTBidEntry(nftBidKey *NFTBidKey) *NFTBidEntry {
+	bid := backend.postgresDb.GetNFTBid(&nftBidKey.NFTPostHash, &nftBidKey.BidderPKID, nftBidKey.SerialNumber)
+	if bid == nil {
+		return nil
+	}
+	return bid.NewNFTBidEntry()
+}
+
+func (backend *PostgresStorageBackend) GetNFTBidEntriesForPKID(bidderPKID *PKID) []*NFTBidEntry {
+	var nftBidEntries []*NFTBidEntry
+	for _, bid := range backend.postgresDb.GetNFTBidsForPKID(bidderPKID) {
+		nftBidEntries = append(nftBidEntries, bid.NewNFTBidEntry())
+	}
+	return nftBidEntries
+}
+
+func (backend *PostgresStorageBackend) GetNFTBidEntriesForSerialNumber(
+	nftPostHash *BlockHash, serialNumber uint64) []*NFTBidEntry {
+
+	var nftBidEntries []*NFTBidEntry
+	for _, bid := range backend.postgresDb.GetNFTBidsForSerial(nftPostHash, serialNumber) {
+		nftBidEntries = append(nftBidEntries, bid.NewNFTBidEntry())
+	}
+	return nftBidEntries
+}
+
+//
+// AccessGroups
+//
+
+// GetAccessGroupEntryByAccessGroupId returns the AccessGroupEntry for the given AccessGroupId from db.
+func (backend *PostgresStorageBackend) GetAccessGroupEntryByAccessGroupId(accessGroupId *AccessGroupId) (*AccessGroupEntry, error) {
+	if accessGroupId == nil {
+		glog.Errorf("GetAccessGroupEntryByAccessGroupId: Called with nil accessGroupId, this should never happen")
+		return nil, nil
+	}
+
+	pgAccessGroup := backend.postgresDb.GetAccessGroupByAccessGroupId(accessGroupId)
+	if pgAccessGroup == nil {
+		return nil, nil
+	}
+	return pgAccessGroup.ToAccessGroupEntry(), nil
+}
+
+// GetAccessGroupExistenceByAccessGroupId returns true if the given AccessGroupId exists in db.
+func (backend *PostgresStorageBackend) GetAccessGroupExistenceByAccessGroupId(accessGroupId *AccessGroupId) (bool, error) {
+	if accessGroupId == nil {
+		glog.Errorf("GetAccessGroupExistenceByAccessGroupId: Called with nil accessGroupId, this should never happen")
+		return false, nil
+	}
+
+	pgAccessGroup := backend.postgresDb.GetAccessGroupByAccessGroupId(accessGroupId)
+	if pgAccessGroup == nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// GetAccessGroupIdsForOwner returns all the AccessGroupIds registered by given accessGroupOwnerPublicKey from db.
+func (backend *PostgresStorageBackend) GetAccessGroupIdsForOwner(ownerPublicKey *PublicKey) (_accessGroupIdsOwned []*AccessGroupId, _err error) {
+	if ownerPublicKey == nil {
+		glog.Errorf("GetAccessGroupEntriesForOwner: Called with nil ownerPublicKey, this should never happen")
+		return nil, nil
+	}
+
+	pgAccessGroupEntries := backend.postgresDb.GetAccessGroupEntriesForOwner(*ownerPublicKey)
+	if pgAccessGroupEntries == nil {
+		return nil, nil
+	}
+	var accessGroupIds []*AccessGroupId
+	for _, pgAccessGroupEntry := range pgAccessGroupEntries {
+		accessGroupEntry := pgAccessGroupEntry.ToAccessGroupEntry()
+		accessGroupId := NewAccessGroupId(ownerPublicKey, accessGroupEntry.AccessGroupKeyName.ToBytes())
+		accessGroupIds = append(accessGroupIds, accessGroupId)
+	}
+	return accessGroupIds, nil
+}
+
+// GetAccessGroupIdsForMember returns all the AccessGroupIds that given memberPublicKey is a member of from db.
+func (backend *PostgresStorageBackend) GetAccessGroupIdsForMember(memberPublicKey *PublicKey) (_accessGroupIdsMember []*AccessGroupId, _err error) {
+	if memberPublicKey == nil {
+		glog.Errorf("GetAccessGroupEntriesForMember: Called with nil memberPublicKey, this should never happen")
+		return nil, nil
+	}
+
+	pgAccessGroupEnumerationEntries, err := backend.postgresDb.GetAccessGroupEnumerationEntriesForMember(*memberPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var accessGroupIds []*AccessGroupId
+	for _, pgAccessEnumerationEntry := range pgAccessGroupEnumerationEntries {
+		accessGroupId := NewAccessGroupId(
+			pgAccessEnumerationEntry.AccessGroupOwnerPublicKey, pgAccessEnumerationEntry.AccessGroupKeyName.ToBytes())
+		accessGroupIds = append(accessGroupIds, accessGroupId)
+	}
+	return accessGroupIds, nil
+}
+
+//
+// AccessGroupMembers
+//
+
+// GetAccessGroupMemberEntry returns the AccessGroupMemberEntry for the given accessGroupMemberPublicKey and
+// the group identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db.
+func (backend *PostgresStorageBackend) GetAccessGroupMemberEntry(accessGroupMemberPublicKey PublicKey,
+	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName) (*AccessGroupMemberEntry, error) {
+
+	pgAccessGroupMember := backend.postgresDb.GetAccessGroupMemberEntry(accessGroupMemberPublicKey,
+		accessGroupOwnerPublicKey, accessGroupKeyName)
+	if pgAccessGroupMember == nil {
+		return nil, nil
+	}
+	_, _, accessGroupMember := pgAccessGroupMember.ToAccessGroupMemberEntry()
+	return accessGroupMember, nil
+}
+
+// GetAccessGroupMemberEnumerationEntry returns a bool indicating whether the given accessGroupMemberPublicKey is a member
+// of the group identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db.
+func (backend *PostgresStorageBackend) GetAccessGroupMemberEnumerationEntry(accessGroupMemberPublicKey PublicKey,
+	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName) (_exists bool, _err error) {
+
+	return backend.postgresDb.GetAccessGroupMemberEnumerationEntry(accessGroupMemberPublicKey,
+		accessGroupOwnerPublicKey, accessGroupKeyName), nil
+}
+
+// GetPaginatedAccessGroupMembersEnumerationEntries returns a list of accessGroupMemberPublicKeys that are members of the group
+// identified by <accessGroupOwnerPublicKey, accessGroupKeyName> from db. See BadgerStorageBackend for the ordering.
+func (backend *PostgresStorageBackend) GetPaginatedAccessGroupMembersEnumerationEntries(
+	accessGroupOwnerPublicKey PublicKey, accessGroupKeyName GroupKeyName,
+	startingAccessGroupMemberPublicKeyBytes []byte, maxMembersToFetch uint32) (
+	_accessGroupMemberPublicKeys []*PublicKey, _err error) {
+
+	if maxMembersToFetch == 0 {
+		return nil, nil
+	}
+
+	return backend.postgresDb.GetPaginatedAccessGroupMembersFromEnumerationIndex(
+		accessGroupOwnerPublicKey, accessGroupKeyName,
+		startingAccessGroupMemberPublicKeyBytes, maxMembersToFetch)
+}
+
+//
+// NewMessage
+//
+
+// GetDmMessageEntry returns the NewMessageEntry for the given DmMessageKey from db.
+func (backend *PostgresStorageBackend) GetDmMessageEntry(dmMessageKey DmMessageKey) (*NewMessageEntry, error) {
+	pgDmMessage := backend.postgresDb.GetNewMessageDmEntry(dmMessageKey)
+	if pgDmMessage == nil {
+		return nil, nil
+	}
+	dmMessage := pgDmMessage.ToNewMessageEntry()
+	return dmMessage, nil
+}
+
+// GetGroupChatMessageEntry returns the NewMessageEntry for the given GroupChatMessageKey from db.
+func (backend *PostgresStorageBackend) GetGroupChatMessageEntry(groupChatMessageKey GroupChatMessageKey) (*NewMessageEntry, error) {
+	pgGroupChatMessage := backend.postgresDb.GetNewMessageGroupChatEntry(groupChatMessageKey)
+	if pgGroupChatMessage == nil {
+		return nil, nil
+	}
+	groupChatMessage := pgGroupChatMessage.ToNewMessageEntry()
+	return groupChatMessage, nil
+}
+
+// CheckDmThreadExistence returns a DmThreadEntry entry for the provided DmThreadKey from db.
+func (backend *PostgresStorageBackend) CheckDmThreadExistence(dmThreadKey DmThreadKey) (*DmThreadEntry, error) {
+	pgDmThreadExistence := backend.postgresDb.CheckDmThreadExistence(dmThreadKey)
+	if pgDmThreadExistence == nil {
+		return nil, nil
+	}
+	return pgDmThreadExistence, nil
+}
+
+// GetAllUserDmThreads returns a list of all the DmThreadKey entries associated with the given userAccessGroupOwnerPublicKey from db.
+func (backend *PostgresStorageBackend) GetAllUserDmThreads(userAccessGroupOwnerPublicKey PublicKey) (
+	_dmThreadKeys []*DmThreadKey, _err error) {
+
+	// TODO: The error might be thrown when key doesnt exist
+	return backend.postgresDb.GetAllUserDmThreads(userAccessGroupOwnerPublicKey)
+}
+
+// GetPaginatedMessageEntriesForDmThread returns a list of NewMessageEntry entries for the given DmThreadKey from db.
+// See BadgerStorageBackend for the pagination.
+func (backend *PostgresStorageBackend) GetPaginatedMessageEntriesForDmThread(dmThreadKey DmThreadKey, maxTimestamp uint64,
+	maxMessagesToFetch uint64) (_messageEntries []*NewMessageEntry, _err error) {
+
+	if maxMessagesToFetch == 0 {
+		return nil, nil
+	}
+
+	return backend.postgresDb.GetPaginatedMessageEntriesForDmThread(
+		dmThreadKey, maxTimestamp, maxMessagesToFetch)
+}
+
+// GetPaginatedMessageEntriesForGroupChatThread returns a list of NewMessageEntry entries for the given AccessGroupId from db.
+// See BadgerStorageBackend for the pagination.
+func (backend *PostgresStorageBackend) GetPaginatedMessageEntriesForGroupChatThread(groupChatThread AccessGroupId, startingTimestamp uint64,
+	maxMessagesToFetch uint64) (_messageEntries []*NewMessageEntry, _err error) {
+
+	if maxMessagesToFetch == 0 {
+		return nil, nil
+	}
+
+	return backend.postgresDb.GetPaginatedMessageEntriesForGroupChatThread(
+		groupChatThread, startingTimestamp, maxMessagesToFetch)
+}
+
+//
+// ValidatorEpochPerformance
+//
+
+// PoS state is only stored in badger, so the methods of the embedded BadgerStorageBackend
+// are used.
@@ -0,0 +1,208 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// testStorageBackend answers DeSo balance, profile, follow, and multisig lookups itself and
+// everything else from badger.
+type testStorageBackend struct {
+	*BadgerStorageBackend
+	balanceNanos    uint64
+	profileEntries  map[PKID]*ProfileEntry
+	followEntries   []*FollowEntry
+	multisigEntries map[PKID]*MultisigEntry
+}
+
+func (backend *testStorageBackend) Name() string {
+	return "test"
+}
+
+func (backend *testStorageBackend) GetDeSoBalanceForPublicKey(publicKey []byte) (uint64, error) {
+	return backend.balanceNanos, nil
+}
+
+func (backend *testStorageBackend) GetProfileEntryForPKID(pkid *PKID) *ProfileEntry {
+	return backend.profileEntries[*pkid]
+}
+
+func (backend *testStorageBackend) GetMultisigEntry(ownerPKID *PKID) (*MultisigEntry, error) {
+	return backend.multisigEntries[*ownerPKID], nil
+}
+
+func (backend *testStorageBackend) GetFollowEntriesForPKID(pkid *PKID, getEntriesFollowingPKID bool) (
+	[]*FollowEntry, error) {
+
+	var followEntries []*FollowEntry
+	for _, followEntry := range backend.followEntries {
+		if (getEntriesFollowingPKID && followEntry.FollowedPKID.Eq(pkid)) ||
+			(!getEntriesFollowingPKID && followEntry.FollowerPKID.Eq(pkid)) {
+			followEntries = append(followEntries, followEntry)
+		}
+	}
+	return followEntries, nil
+}
+
+func TestStorageBackendRegistry(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	require.Equal("badger", utxoView.GetDbAdapter().Name())
+	require.NoError(DbPutDeSoBalanceForPublicKey(db, nil, m0PkBytes, 100, nil))
+	balanceNanos, err := utxoView.GetDbAdapter().GetDeSoBalanceForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(100), balanceNanos)
+
+	// Backends can only be registered once per name, and unknown names are rejected.
+	name := "test-" + t.Name()
+	require.NoError(RegisterStorageBackend(name, func(handle *badger.DB, options string) (StorageBackend, error) {
+		return &testStorageBackend{BadgerStorageBackend: NewBadgerStorageBackend(handle, nil), balanceNanos: 5}, nil
+	}))
+	require.Error(RegisterStorageBackend(name, func(handle *badger.DB, options string) (StorageBackend, error) {
+		return nil, nil
+	}))
+	require.Contains(GetRegisteredStorageBackendNames(), name)
+	_, err = NewStorageBackend("unknown", db, "")
+	require.Error(err)
+
+	// A view with the backend answers every lookup from it.
+	backend, err := NewStorageBackend(name, db, "")
+	require.NoError(err)
+	dbAdapter := NewUtxoViewWithStorageBackend(db, &params, nil, nil, nil, backend).GetDbAdapter()
+	require.Equal("test", dbAdapter.Name())
+	balanceNanos, err = dbAdapter.GetDeSoBalanceForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(5), balanceNanos)
+	value, err := dbAdapter.GetValue(_dbKeyForPublicKeyToDeSoBalanceNanos(m0PkBytes))
+	require.NoError(err)
+	require.Equal(uint64(100), DecodeUint64(value))
+	value, err = dbAdapter.GetValue(_dbKeyForPublicKeyToDeSoBalanceNanos(m1PkBytes))
+	require.NoError(err)
+	require.Nil(value)
+
+	require.Equal("badger", utxoView.GetDbAdapter().Name())
+}
+
+func TestUtxoViewReadsThroughStorageBackend(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+
+	m0PKID, m1PKID, m2PKID := NewPKID(m0PkBytes), NewPKID(m1PkBytes), NewPKID(m2PkBytes)
+	m3PKID, m4PKID := NewPKID(m3PkBytes), NewPKID(m4PkBytes)
+	getFollowedPKIDs := func(followEntries []*FollowEntry) []*PKID {
+		var followedPKIDs []*PKID
+		for _, followEntry := range followEntries {
+			followedPKIDs = append(followedPKIDs, followEntry.FollowedPKID)
+		}
+		return followedPKIDs
+	}
+
+	// m0 follows m1 and likes and comments on m2's post, and m2 has a profile.
+	parentPostHash := &BlockHash{1}
+	commentEntry := &PostEntry{
+		PostHash:        &BlockHash{2},
+		PosterPublicKey: m0PkBytes,
+		ParentStakeID:   parentPostHash[:],
+		Body:            []byte("comment"),
+	}
+	profileEntry := &ProfileEntry{PublicKey: m2PkBytes, Username: []byte("m2")}
+	require.NoError(DbPutFollowMappings(db, nil, m0PKID, m1PKID, nil))
+	require.NoError(DbPutLikeMappings(db, nil, m0PkBytes, *parentPostHash, nil))
+	require.NoError(DBPutPostEntryMappings(db, nil, 0, commentEntry, &params, nil))
+	require.NoError(DBPutProfileEntryMappings(db, nil, 0, profileEntry, m2PKID, &params, nil))
+
+	// The view getters read the same entries through the badger backend as the db functions.
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	followEntries, err := utxoView.GetFollowEntriesForPublicKey(m0PkBytes, false)
+	require.NoError(err)
+	require.Equal([]*PKID{m1PKID}, getFollowedPKIDs(followEntries))
+	followEntries, err = utxoView.GetFollowEntriesForPublicKey(m1PkBytes, true)
+	require.NoError(err)
+	require.Len(followEntries, 1)
+	require.Equal(m0PKID, followEntries[0].FollowerPKID)
+	likerPublicKeys, err := utxoView.GetLikesForPostHash(parentPostHash)
+	require.NoError(err)
+	require.Equal([][]byte{m0PkBytes}, likerPublicKeys)
+	commentEntries, err := utxoView.GetCommentEntriesForParentStakeID(parentPostHash[:])
+	require.NoError(err)
+	require.Len(commentEntries, 1)
+	require.Equal(commentEntry.Body, commentEntries[0].Body)
+	require.Equal(profileEntry.Username, utxoView.GetProfileEntryForUsername([]byte("M2")).Username)
+	require.Equal(profileEntry.Username, utxoView.GetProfileEntryForPKID(m2PKID).Username)
+	require.Equal(m2PkBytes, utxoView.GetPublicKeyForPKID(m2PKID))
+	require.Nil(utxoView.GetProfileEntryForPKID(m3PKID))
+
+	// Entries modified in the view take precedence over the ones in the db.
+	utxoView._deleteFollowEntryMappings(followEntries[0])
+	followEntries, err = utxoView.GetFollowEntriesForPublicKey(m0PkBytes, false)
+	require.NoError(err)
+	require.Empty(followEntries)
+
+	// With a backend, the view getters read from it instead of badger.
+	utxoView = NewUtxoViewWithStorageBackend(db, &params, nil, nil, nil, &testStorageBackend{
+		BadgerStorageBackend: NewBadgerStorageBackend(db, nil),
+		profileEntries:       map[PKID]*ProfileEntry{*m3PKID: {PublicKey: m3PkBytes, Username: []byte("m3")}},
+		followEntries:        []*FollowEntry{{FollowerPKID: m3PKID, FollowedPKID: m4PKID}},
+	})
+	require.Equal([]byte("m3"), utxoView.GetProfileEntryForPKID(m3PKID).Username)
+	require.Nil(utxoView.GetProfileEntryForPKID(m2PKID))
+	followEntries, err = utxoView.GetFollowEntriesForPublicKey(m3PkBytes, false)
+	require.NoError(err)
+	require.Equal([]*PKID{m4PKID}, getFollowedPKIDs(followEntries))
+	followEntries, err = utxoView.GetFollowEntriesForPublicKey(m0PkBytes, false)
+	require.NoError(err)
+	require.Empty(followEntries)
+	likerPublicKeys, err = utxoView.GetLikesForPostHash(parentPostHash)
+	require.NoError(err)
+	require.Equal([][]byte{m0PkBytes}, likerPublicKeys)
+}
+
+func TestBlockchainStorageBackend(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+
+	m0PKID := NewPKID(m0PkBytes)
+	multisigEntry := &MultisigEntry{OwnerPKID: m0PKID, Threshold: 2}
+	backend := &testStorageBackend{
+		BadgerStorageBackend: NewBadgerStorageBackend(db, nil),
+		multisigEntries:      map[PKID]*MultisigEntry{*m0PKID: multisigEntry},
+	}
+
+	// Without a backend, the chain reads from badger.
+	bc := &Blockchain{db: db, params: &params}
+	require.Equal("badger", bc.NewDbAdapter().Name())
+	dbMultisigEntry, err := bc.NewUtxoView().GetMultisigEntry(m0PKID)
+	require.NoError(err)
+	require.Nil(dbMultisigEntry)
+
+	// With one, the chain's adapters and views read from it, including the getters the view
+	// used to read from badger directly.
+	bc.storageBackend = backend
+	require.Equal("test", bc.NewDbAdapter().Name())
+	utxoView := bc.NewUtxoView()
+	require.Equal("test", utxoView.GetDbAdapter().Name())
+	dbMultisigEntry, err = utxoView.GetMultisigEntry(m0PKID)
+	require.NoError(err)
+	require.Equal(multisigEntry, dbMultisigEntry)
+	// Copies of the view keep the backend. The copy needs a tip, which the empty db doesn't have.
+	utxoView.TipHash = &BlockHash{}
+	require.Equal("test", utxoView.CopyUtxoView().GetDbAdapter().Name())
+
+	// The backend is per chain, so a view of another chain on the same handle reads from badger.
+	require.Equal("badger", NewUtxoView(db, &params, nil, nil, nil).GetDbAdapter().Name())
+}
@@ -603,7 +603,306 @@ type DBPrefixes struct {
 	// When reading and writing data to this prefixes, please acquire the snapshotDbMutex in the snapshot.
 	PrefixHypersyncSnapshotDBPrefix []byte `prefix_id:"[97]"`
 
-	// NEXT_TAG: 98
+	// PrefixValidatorRewardIndexByPKID: Retrieve a validator's cumulative reward index.
+	// The index tracks the total staking reward earned per unit of delegated stake since
+	// the StakingRewardsAccrualBlockHeight, and StakeEntries settle their rewards against it.
+	// Prefix, <ValidatorPKID [33]byte> -> *ValidatorRewardIndexEntry
+	PrefixValidatorRewardIndexByPKID []byte `prefix_id:"[98]" is_state:"true" core_state:"true"`
+
+	// PrefixStakeByStakerAndValidator: Retrieve all of a staker's StakeEntries.
+	// Prefix, <StakerPKID [33]byte>, <ValidatorPKID [33]byte> -> nil
+	//
+	// This is the reverse of PrefixStakeByValidatorAndStaker. It isn't part of the state,
+	// so it's built from the StakeEntries in the db if it's missing, and it's kept up to
+	// date as StakeEntries are flushed.
+	PrefixStakeByStakerAndValidator []byte `prefix_id:"[99]"`
+
+	// PrefixLockedStakeByStakerAndValidatorAndLockedAt: Retrieve all of a staker's LockedStakeEntries.
+	// Prefix, <StakerPKID [33]byte>, <ValidatorPKID [33]byte>, <LockedAtEpochNumber uint64> -> nil
+	//
+	// This is the reverse of PrefixLockedStakeByValidatorAndStakerAndLockedAt. Like
+	// PrefixStakeByStakerAndValidator, it isn't part of the state.
+	PrefixLockedStakeByStakerAndValidatorAndLockedAt []byte `prefix_id:"[100]"`
+
+	// PrefixValidatorEpochPerformanceByPKIDAndEpoch: Retrieve a validator's performance during an epoch.
+	// Prefix, <ValidatorPKID [33]byte>, <EpochNumber uint64> -> ValidatorEpochPerformanceEntry
+	PrefixValidatorEpochPerformanceByPKIDAndEpoch []byte `prefix_id:"[101]" is_state:"true" core_state:"true"`
+
+	// PrefixBlockProducerRegistryEntryByPublicKey: Retrieve a block producer's registered tag.
+	// Prefix, <PublicKey [33]byte> -> BlockProducerRegistryEntry
+	PrefixBlockProducerRegistryEntryByPublicKey []byte `prefix_id:"[102]" is_state:"true" core_state:"true"`
+
+	// PrefixDAOCoinLastTradePriceByPair: Retrieve the price of the last trade between two DAO coins,
+	// expressed from the perspective of an order buying the first coin and selling the second.
+	// Prefix, <BuyingDAOCoinCreatorPKID [33]byte>, <SellingDAOCoinCreatorPKID [33]byte> -> DAOCoinLastTradePriceEntry
+	PrefixDAOCoinLastTradePriceByPair []byte `prefix_id:"[103]" is_state:"true" core_state:"true"`
+
+	// PrefixDAOCoinMetadataEntryByCreatorPKID: Retrieve the display metadata of a DAO coin.
+	// Prefix, <CreatorPKID [33]byte> -> DAOCoinMetadataEntry
+	PrefixDAOCoinMetadataEntryByCreatorPKID []byte `prefix_id:"[104]" is_state:"true" core_state:"true"`
+
+	// The DAO coin candle index is an optional, non-consensus index of DAO coin limit order
+	// fills. It's only populated when the node runs with the DAO coin candle index enabled.
+	//
+	// PrefixDAOCoinTradeByPairAndTimestamp: Retrieve the fills of a directed coin pair in order.
+	// Prefix, <BuyingDAOCoinCreatorPKID [33]byte>, <SellingDAOCoinCreatorPKID [33]byte>,
+	//   <TimestampNanoSecs [8]byte>, <BlockHash [32]byte>, <TxnIndex [4]byte>, <FillIndex [4]byte> -> DAOCoinTrade
+	PrefixDAOCoinTradeByPairAndTimestamp []byte `prefix_id:"[105]"`
+
+	// PrefixDAOCoinTradeKeysByBlockHash: Retrieve the fills recorded for a block so they can be
+	// removed when the block is disconnected.
+	// Prefix, <BlockHash [32]byte> -> []<PrefixDAOCoinTradeByPairAndTimestamp key>
+	PrefixDAOCoinTradeKeysByBlockHash []byte `prefix_id:"[106]"`
+
+	// PrefixDAOCoinCandleByPairAndInterval: Retrieve the OHLCV candles of a directed coin pair.
+	// Prefix, <BuyingDAOCoinCreatorPKID [33]byte>, <SellingDAOCoinCreatorPKID [33]byte>,
+	//   <IntervalSecs [8]byte>, <StartTimestampNanoSecs [8]byte> -> DAOCoinCandle
+	PrefixDAOCoinCandleByPairAndInterval []byte `prefix_id:"[107]"`
+
+	// PrefixExternalHeaderRelayerByPublicKey: Retrieve a relayer registered to anchor external chain headers.
+	// Prefix, <PublicKey [33]byte> -> ExternalHeaderRelayerEntry
+	PrefixExternalHeaderRelayerByPublicKey []byte `prefix_id:"[108]" is_state:"true" core_state:"true"`
+
+	// PrefixExternalHeaderByChainAndHash: Retrieve an anchored external chain header by its hash.
+	// Prefix, <ExternalChain uint8>, <BlockHash [32]byte> -> ExternalHeaderEntry
+	PrefixExternalHeaderByChainAndHash []byte `prefix_id:"[109]" is_state:"true" core_state:"true"`
+
+	// PrefixExternalHeaderByChainAndHeight: Retrieve the anchored headers of an external chain by height.
+	// Prefix, <ExternalChain uint8>, <Height uint64>, <BlockHash [32]byte> -> nil
+	// Note that we save space by storing a nil value and parsing the BlockHash from the key.
+	PrefixExternalHeaderByChainAndHeight []byte `prefix_id:"[110]" is_state:"true"`
+
+	// PrefixExchangeRateFeedEntryByPublicKey: Retrieve a registered exchange rate feed key and
+	// the last rate it submitted.
+	// Prefix, <PublicKey [33]byte> -> ExchangeRateFeedEntry
+	PrefixExchangeRateFeedEntryByPublicKey []byte `prefix_id:"[111]" is_state:"true" core_state:"true"`
+
+	// PrefixDAOCoinLimitOrderFillByTxnHashAndIndex: Retrieve a DAO coin limit order fill by the
+	// hash of the txn that matched and the index of the match within the txn.
+	// Prefix, <TxnHash [32]byte>, <FillIndex uint32> -> DAOCoinLimitOrderFillEntry
+	PrefixDAOCoinLimitOrderFillByTxnHashAndIndex []byte `prefix_id:"[112]" is_state:"true" core_state:"true"`
+
+	// PrefixDAOCoinLimitOrderFillByTransactorPKID: Retrieve the fills of a taker or maker, most recent last.
+	// Prefix, <TransactorPKID [33]byte>, <BlockHeight uint64>, <TxnHash [32]byte>, <FillIndex uint32> -> nil
+	// Note that we save space by storing a nil value and parsing the TxnHash and FillIndex from the key.
+	PrefixDAOCoinLimitOrderFillByTransactorPKID []byte `prefix_id:"[113]" is_state:"true"`
+
+	// PrefixDAOCoinLimitOrderFillByCoinPair: Retrieve the fills between two coins in either direction.
+	// The lower of the two coin PKIDs comes first so that both directions share a prefix.
+	// Prefix, <LowerCoinPKID [33]byte>, <HigherCoinPKID [33]byte>, <BlockHeight uint64>, <TxnHash [32]byte>, <FillIndex uint32> -> nil
+	PrefixDAOCoinLimitOrderFillByCoinPair []byte `prefix_id:"[114]" is_state:"true"`
+
+	// PrefixUtxoViewFlushCursor: Retrieve the cursor of the last committed UtxoView flush. It's only
+	// maintained while UtxoView flush hooks are registered.
+	// Prefix -> UtxoViewFlushCursor
+	PrefixUtxoViewFlushCursor []byte `prefix_id:"[115]"`
+
+	// PrefixProfilePicBlobByHash: Retrieve a profile pic that was offloaded from its ProfileEntry by
+	// the sha256 hash it's referenced by. Blobs aren't part of consensus state, so they're never
+	// hypersynced. Nodes that are missing one fetch it lazily from their peers.
+	// Prefix, <BlobHash [32]byte> -> <ProfilePic []byte>
+	PrefixProfilePicBlobByHash []byte `prefix_id:"[116]"`
+
+	// PrefixDAOCoinLimitOrderWithCreatorCoins: The order book for DAO coin limit orders that buy or
+	// sell a creator coin. A creator's creator coin and DAO coin share a PKID, so these orders are
+	// kept out of PrefixDAOCoinLimitOrder, and each PKID is followed by whether it's a creator coin.
+	// They're indexed by transactor and by OrderID alongside all other orders.
+	// Prefix, <BuyingDAOCoinCreatorPKID [33]byte>, <BuyingCoinIsCreatorCoin byte>,
+	//   <SellingDAOCoinCreatorPKID [33]byte>, <SellingCoinIsCreatorCoin byte>,
+	//   <ScaledExchangeRateCoinsToSellPerCoinToBuy [32]byte>, <BlockHeight [32]byte>, <OrderID [32]byte>
+	//   -> <DAOCoinLimitOrderEntry>
+	PrefixDAOCoinLimitOrderWithCreatorCoins []byte `prefix_id:"[117]" is_state:"true" core_state:"true"`
+
+	// PrefixDeadKeyEntryByPublicKey: Retrieve a public key that provably can't spend the DESO
+	// sent to it, e.g. an all-zero key or a key that isn't a valid point on the curve.
+	// Prefix, <PublicKey [33]byte> -> DeadKeyEntry
+	PrefixDeadKeyEntryByPublicKey []byte `prefix_id:"[118]" is_state:"true" core_state:"true"`
+
+	// PrefixNFTOwnerPKIDPostHashSerialNumber: Retrieve the NFTs owned by a PKID, sorted by
+	// post hash and serial number so that they can be paginated. Unlike
+	// PrefixPKIDIsForSaleBidAmountNanosPostHashSerialNumberToNFTEntry, this index's key doesn't
+	// change when an NFT is put up for sale. It's maintained from the NFTOwnerIndexBlockHeight,
+	// at which point it's backfilled from the existing NFTEntries.
+	// Prefix, <OwnerPKID [33]byte>, <NFTPostHash [32]byte>, <SerialNumber uint64> -> nil
+	PrefixNFTOwnerPKIDPostHashSerialNumber []byte `prefix_id:"[119]" is_state:"true"`
+
+	// PrefixArchivedNFTBidByPostHashSerialNumber: Retrieve the bids that were on an NFT when it
+	// was sold, sorted by the height of the sale. The archive is only kept by nodes that opt into
+	// it with NFTBidArchiveDepth, so it isn't state.
+	// Prefix, <NFTPostHash [32]byte>, <SerialNumber uint64>, <SoldAtBlockHeight uint64>,
+	//   <BidderPKID [33]byte>, <BidSerialNumber uint64> -> <NFTBidEntry>
+	PrefixArchivedNFTBidByPostHashSerialNumber []byte `prefix_id:"[120]"`
+
+	// PrefixDAOCoinTradeWithCreatorCoinsByPairAndTimestamp: The DAO coin candle index's trades for
+	// directed pairs that include a creator coin, from limit order fills or creator coin buys and
+	// sells. A creator's creator coin and DAO coin share a PKID, so each PKID is followed by
+	// whether it's a creator coin.
+	// Prefix, <BuyingDAOCoinCreatorPKID [33]byte>, <BuyingCoinIsCreatorCoin byte>,
+	//   <SellingDAOCoinCreatorPKID [33]byte>, <SellingCoinIsCreatorCoin byte>, <TimestampNanoSecs [8]byte>,
+	//   <BlockHash [32]byte>, <TxnIndex [4]byte>, <FillIndex [4]byte> -> DAOCoinTrade
+	PrefixDAOCoinTradeWithCreatorCoinsByPairAndTimestamp []byte `prefix_id:"[121]"`
+
+	// PrefixDAOCoinCandleWithCreatorCoinsByPairAndInterval: The DAO coin candle index's OHLCV candles
+	// for directed pairs that include a creator coin.
+	// Prefix, <BuyingDAOCoinCreatorPKID [33]byte>, <BuyingCoinIsCreatorCoin byte>,
+	//   <SellingDAOCoinCreatorPKID [33]byte>, <SellingCoinIsCreatorCoin byte>,
+	//   <IntervalSecs [8]byte>, <StartTimestampNanoSecs [8]byte> -> DAOCoinCandle
+	PrefixDAOCoinCandleWithCreatorCoinsByPairAndInterval []byte `prefix_id:"[122]"`
+
+	// PrefixMultisigEntryByOwnerPKID: Retrieve the co-signers and threshold an account requires
+	// on its txns.
+	// Prefix, <OwnerPKID [33]byte> -> MultisigEntry
+	PrefixMultisigEntryByOwnerPKID []byte `prefix_id:"[123]" is_state:"true" core_state:"true"`
+
+	// PrefixDAOCoinStreamByStreamID: Retrieve a DAO coin stream by the hash of the txn that
+	// created it.
+	// Prefix, <StreamID [32]byte> -> DAOCoinStreamEntry
+	PrefixDAOCoinStreamByStreamID []byte `prefix_id:"[124]" is_state:"true" core_state:"true"`
+
+	// PrefixDAOCoinStreamIDByPayerPKID: Retrieve the DAO coin streams a PKID pays.
+	// Prefix, <PayerPKID [33]byte>, <StreamID [32]byte> -> nil
+	PrefixDAOCoinStreamIDByPayerPKID []byte `prefix_id:"[125]" is_state:"true"`
+
+	// PrefixDAOCoinStreamIDByPayeePKID: Retrieve the DAO coin streams that pay a PKID.
+	// Prefix, <PayeePKID [33]byte>, <StreamID [32]byte> -> nil
+	PrefixDAOCoinStreamIDByPayeePKID []byte `prefix_id:"[126]" is_state:"true"`
+
+	// PrefixProposalByProposalID: Retrieve a governance proposal by the hash of the txn that
+	// created it.
+	// Prefix, <ProposalID [32]byte> -> ProposalEntry
+	PrefixProposalByProposalID []byte `prefix_id:"[127]" is_state:"true" core_state:"true"`
+
+	// PrefixProposalIDByProfilePKID: Retrieve the proposals for a DAO coin.
+	// Prefix, <ProfilePKID [33]byte>, <ProposalID [32]byte> -> nil
+	PrefixProposalIDByProfilePKID []byte `prefix_id:"[128]" is_state:"true"`
+
+	// PrefixVoteByProposalIDVoterPKID: Retrieve a holder's vote on a proposal. Every holder
+	// of the DAO coin when the proposal was created has a vote, whether or not they've cast it.
+	// Prefix, <ProposalID [32]byte>, <VoterPKID [33]byte> -> VoteEntry
+	PrefixVoteByProposalIDVoterPKID []byte `prefix_id:"[129]" is_state:"true" core_state:"true"`
+
+	// PrefixRoyaltySplitByID: Retrieve a royalty split by the hash of the txn that registered it.
+	// Prefix, <RoyaltySplitID [32]byte> -> RoyaltySplitEntry
+	PrefixRoyaltySplitByID []byte `prefix_id:"[130]" is_state:"true" core_state:"true"`
+
+	// PrefixRoyaltySplitIDByCreatorPKID: Retrieve the royalty splits a creator has registered.
+	// Prefix, <CreatorPKID [33]byte>, <RoyaltySplitID [32]byte> -> nil
+	PrefixRoyaltySplitIDByCreatorPKID []byte `prefix_id:"[131]" is_state:"true"`
+
+	// PrefixNFTAuctionEndBlockHeightPostHashSerialNumber: Retrieve the NFT auctions that end at
+	// a block height so that they can be settled when that block is connected.
+	// Prefix, <AuctionEndBlockHeight uint64>, <NFTPostHash [32]byte>, <SerialNumber uint64> -> nil
+	PrefixNFTAuctionEndBlockHeightPostHashSerialNumber []byte `prefix_id:"[132]" is_state:"true"`
+
+	// PrefixTxnLabelByTxnHash: The operator's local labels, memos and categories for txns. They're
+	// bookkeeping metadata kept by the optional TxnLabelStore, so they aren't state.
+	// Prefix, <TxnHash [32]byte> -> TxnLabel
+	PrefixTxnLabelByTxnHash []byte `prefix_id:"[133]"`
+
+	// PrefixTxnLabelTxnHashByCategory: Retrieve the labeled txns in a category.
+	// Prefix, <Category []byte>, <TxnHash [32]byte> -> nil
+	PrefixTxnLabelTxnHashByCategory []byte `prefix_id:"[134]"`
+
+	// PrefixBlockIndexCacheMetadata: The tip, size and checksum of the block index saved at the
+	// last clean shutdown. The saved index is a copy of the block nodes, so it isn't state.
+	// Prefix -> BlockIndexCacheMetadata
+	PrefixBlockIndexCacheMetadata []byte `prefix_id:"[135]"`
+
+	// PrefixBlockIndexCacheChunk: The serialized block nodes of the saved block index.
+	// Prefix, <ChunkIndex uint64> -> <NumBlockNodes uvarint>, []<BlockNode bytes>
+	PrefixBlockIndexCacheChunk []byte `prefix_id:"[136]"`
+
+	// PrefixNFTBundleByID: Retrieve an NFT bundle listing by the hash of the txn that listed it.
+	// Prefix, <BundleID [32]byte> -> NFTBundleEntry
+	PrefixNFTBundleByID []byte `prefix_id:"[137]" is_state:"true" core_state:"true"`
+
+	// PrefixNFTBundleIDBySellerPKID: Retrieve the NFT bundles a seller has listed.
+	// Prefix, <SellerPKID [33]byte>, <BundleID [32]byte> -> nil
+	PrefixNFTBundleIDBySellerPKID []byte `prefix_id:"[138]" is_state:"true"`
+
+	// PrefixNFTSwapByID: Retrieve a pending NFT swap by the hash of the txn that proposed it.
+	// Prefix, <SwapID [32]byte> -> NFTSwapEntry
+	PrefixNFTSwapByID []byte `prefix_id:"[139]" is_state:"true" core_state:"true"`
+
+	// PrefixNFTSwapIDByPKID: Retrieve the pending NFT swaps a user is the proposer or the
+	// counterparty of.
+	// Prefix, <PKID [33]byte>, <SwapID [32]byte> -> nil
+	PrefixNFTSwapIDByPKID []byte `prefix_id:"[140]" is_state:"true"`
+
+	// PrefixEscrowByID: Retrieve the DESO or DAO coins held in escrow by their EscrowID.
+	// Prefix, <EscrowID [32]byte> -> EscrowEntry
+	PrefixEscrowByID []byte `prefix_id:"[141]" is_state:"true" core_state:"true"`
+
+	// PrefixEscrowIDByOwnerPKID: Retrieve the escrows a user owns.
+	// Prefix, <OwnerPKID [33]byte>, <EscrowID [32]byte> -> nil
+	PrefixEscrowIDByOwnerPKID []byte `prefix_id:"[142]" is_state:"true"`
+
+	// PrefixUtxoOpsPrunedThroughHeight: Retrieve the height through which the UtxoOperations of
+	// the main chain's blocks have been pruned. It's only set on nodes that prune them.
+	// Prefix -> <Height uint64>
+	PrefixUtxoOpsPrunedThroughHeight []byte `prefix_id:"[143]"`
+
+	// PrefixPeerScoreByIP: Retrieve the score of the peers at an IP address.
+	// Prefix, <IP string> -> PeerScore
+	PrefixPeerScoreByIP []byte `prefix_id:"[144]"`
+
+	// PrefixDeSoBalanceHistoryByPublicKey: The optional DESO balance history index's changes to
+	// a public key's balance, in the order they happened.
+	// Prefix, <PublicKey [33]byte>, <BlockHeight [8]byte>, <TxnIndex [4]byte> -> DeSoBalanceHistoryEntry
+	PrefixDeSoBalanceHistoryByPublicKey []byte `prefix_id:"[145]"`
+
+	// PrefixDeSoBalanceHistoryKeysByBlockHash: Retrieve the balance history entries recorded for a
+	// block so they can be removed when the block is disconnected.
+	// Prefix, <BlockHash [32]byte> -> []<PrefixDeSoBalanceHistoryByPublicKey key>
+	PrefixDeSoBalanceHistoryKeysByBlockHash []byte `prefix_id:"[146]"`
+
+	// PrefixDAOCoinHolderByCreatorPKIDAndBalance: Retrieve the holders of a DAO coin sorted by
+	// balance, largest first. The balance is stored inverted so that iterating forward returns
+	// the largest balances first. Only holders with a non-zero balance are indexed.
+	// Prefix, <CreatorPKID [33]byte>, <^BalanceNanos [32]byte>, <HODLerPKID [33]byte> -> nil
+	PrefixDAOCoinHolderByCreatorPKIDAndBalance []byte `prefix_id:"[147]"`
+
+	// PrefixDAOCoinHolderCountByCreatorPKID: Retrieve the number of holders of a DAO coin with a
+	// non-zero balance.
+	// Prefix, <CreatorPKID [33]byte> -> <NumHolders uint64>
+	PrefixDAOCoinHolderCountByCreatorPKID []byte `prefix_id:"[148]"`
+
+	// PrefixDAOCoinHolderIndexBuilt: Set once the DAO coin holder index has been built from the
+	// DAO coin balance entries in the db. From then on, it's kept up to date as balances are flushed.
+	// Prefix -> nil
+	PrefixDAOCoinHolderIndexBuilt []byte `prefix_id:"[149]"`
+
+	// PrefixValidatorRewardIndexByPKIDAndEpochNumber: Retrieve a validator's reward index as of
+	// the end of an epoch in which stake was added to the validator. Stake added during an epoch
+	// only starts earning rewards once that epoch is complete, so it settles against this value.
+	// Prefix, <ValidatorPKID [33]byte>, <EpochNumber [8]byte> -> *ValidatorRewardIndexEntry
+	PrefixValidatorRewardIndexByPKIDAndEpochNumber []byte `prefix_id:"[150]" is_state:"true" core_state:"true"`
+
+	// PrefixStakerIndexesBuilt: Set once PrefixStakeByStakerAndValidator and
+	// PrefixLockedStakeByStakerAndValidatorAndLockedAt have been built from the stake entries in
+	// the db. From then on, they're kept up to date as stake entries are flushed.
+	// Prefix -> nil
+	PrefixStakerIndexesBuilt []byte `prefix_id:"[151]"`
+
+	// PrefixBlockIndexCacheJournal: The block nodes stored or deleted since the block index
+	// cache was saved. It's written in the same txn as the block node, so the saved index stays
+	// usable after an unclean shutdown.
+	// Prefix, <Height uint32>, <BlockHash [32]byte> -> nil
+	PrefixBlockIndexCacheJournal []byte `prefix_id:"[152]"`
+
+	// PrefixEmissionIndexByHeight: The optional emission index's staking rewards, founder rewards,
+	// and burns for each block on the main chain, along with their running totals.
+	// Prefix, <BlockHeight [8]byte> -> EmissionIndexEntry
+	PrefixEmissionIndexByHeight []byte `prefix_id:"[153]"`
+
+	// PrefixNFTLesseePKIDPostHashSerialNumber: Retrieve the NFTs leased to a PKID, sorted by post
+	// hash and serial number. An NFT stays in the index until its lease is ended, even once the
+	// lease has expired. It's maintained from the NFTLeaseBlockHeight, before which there are no
+	// leases.
+	// Prefix, <LesseePKID [33]byte>, <NFTPostHash [32]byte>, <SerialNumber uint64> -> nil
+	PrefixNFTLesseePKIDPostHashSerialNumber []byte `prefix_id:"[154]" is_state:"true"`
+
+	// NEXT_TAG: 155
 }
 
 // DecodeStateKey decodes a state key into a DeSoEncoder type. This is useful for encoders which don't have a stored
@@ -903,6 +1202,105 @@ func StatePrefixToDeSoEncoder(prefix []byte) (_isEncoder bool, _encoder DeSoEnco
 	} else if bytes.Equal(prefix, Prefixes.PrefixSnapshotValidatorBLSPublicKeyPKIDPairEntry) {
 		// prefix_id:"[96]"
 		return true, &BLSPublicKeyPKIDPairEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixValidatorRewardIndexByPKID) {
+		// prefix_id:"[98]"
+		return true, &ValidatorRewardIndexEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixValidatorEpochPerformanceByPKIDAndEpoch) {
+		// prefix_id:"[101]"
+		return true, &ValidatorEpochPerformanceEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixBlockProducerRegistryEntryByPublicKey) {
+		// prefix_id:"[102]"
+		return true, &BlockProducerRegistryEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinLastTradePriceByPair) {
+		// prefix_id:"[103]"
+		return true, &DAOCoinLastTradePriceEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinMetadataEntryByCreatorPKID) {
+		// prefix_id:"[104]"
+		return true, &DAOCoinMetadataEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixExternalHeaderRelayerByPublicKey) {
+		// prefix_id:"[108]"
+		return true, &ExternalHeaderRelayerEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixExternalHeaderByChainAndHash) {
+		// prefix_id:"[109]"
+		return true, &ExternalHeaderEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixExternalHeaderByChainAndHeight) {
+		// prefix_id:"[110]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixExchangeRateFeedEntryByPublicKey) {
+		// prefix_id:"[111]"
+		return true, &ExchangeRateFeedEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinLimitOrderFillByTxnHashAndIndex) {
+		// prefix_id:"[112]"
+		return true, &DAOCoinLimitOrderFillEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinLimitOrderFillByTransactorPKID) {
+		// prefix_id:"[113]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinLimitOrderFillByCoinPair) {
+		// prefix_id:"[114]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinLimitOrderWithCreatorCoins) {
+		// prefix_id:"[117]"
+		return true, &DAOCoinLimitOrderEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDeadKeyEntryByPublicKey) {
+		// prefix_id:"[118]"
+		return true, &DeadKeyEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTOwnerPKIDPostHashSerialNumber) {
+		// prefix_id:"[119]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixMultisigEntryByOwnerPKID) {
+		// prefix_id:"[123]"
+		return true, &MultisigEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinStreamByStreamID) {
+		// prefix_id:"[124]"
+		return true, &DAOCoinStreamEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinStreamIDByPayerPKID) {
+		// prefix_id:"[125]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixDAOCoinStreamIDByPayeePKID) {
+		// prefix_id:"[126]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixProposalByProposalID) {
+		// prefix_id:"[127]"
+		return true, &ProposalEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixProposalIDByProfilePKID) {
+		// prefix_id:"[128]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixVoteByProposalIDVoterPKID) {
+		// prefix_id:"[129]"
+		return true, &VoteEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixRoyaltySplitByID) {
+		// prefix_id:"[130]"
+		return true, &RoyaltySplitEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixRoyaltySplitIDByCreatorPKID) {
+		// prefix_id:"[131]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTAuctionEndBlockHeightPostHashSerialNumber) {
+		// prefix_id:"[132]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTBundleByID) {
+		// prefix_id:"[137]"
+		return true, &NFTBundleEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTBundleIDBySellerPKID) {
+		// prefix_id:"[138]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTSwapByID) {
+		// prefix_id:"[139]"
+		return true, &NFTSwapEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTSwapIDByPKID) {
+		// prefix_id:"[140]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixEscrowByID) {
+		// prefix_id:"[141]"
+		return true, &EscrowEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixEscrowIDByOwnerPKID) {
+		// prefix_id:"[142]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixValidatorRewardIndexByPKIDAndEpochNumber) {
+		// prefix_id:"[150]"
+		return true, &ValidatorRewardIndexEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTLesseePKIDPostHashSerialNumber) {
+		// prefix_id:"[154]"
+		return false, nil
 	}
 
 	return true, nil
@@ -1127,6 +1525,7 @@ func DBSetWithTxn(txn *badger.Txn, snap *Snapshot, key []byte, value []byte, eve
 		return errors.Wrapf(err, "DBSetWithTxn: Problem setting record "+
 			"in DB with key: %v, value: %v", key, value)
 	}
+	eventManager.recordModifiedKey(DbOperationTypeUpsert, key, value)
 
 	// After a successful DB write, we update the snapshot.
 	if isState {
@@ -1226,6 +1625,7 @@ func DBDeleteWithTxn(txn *badger.Txn, snap *Snapshot, key []byte, eventManager *
 		return errors.Wrapf(err, "DBDeleteWithTxn: Problem deleting record "+
 			"from DB with key: %v", key)
 	}
+	eventManager.recordModifiedKey(DbOperationTypeDelete, key, nil)
 
 	// After a successful DB delete, we update the snapshot.
 	if isState {
@@ -5237,6 +5637,9 @@ func PutHeightHashToNodeInfoWithTxn(txn *badger.Txn, snap *Snapshot,
 	if err := DBSetWithTxn(txn, snap, key, serializedNode, eventManager); err != nil {
 		return err
 	}
+	if !bitcoinNodes {
+		return DBPutBlockIndexCacheJournalWithTxn(txn, node.Height, node.Hash)
+	}
 	return nil
 }
 
@@ -5268,7 +5671,14 @@ func PutHeightHashToNodeInfo(handle *badger.DB, snap *Snapshot, node *BlockNode,
 
 func DbDeleteHeightHashToNodeInfoWithTxn(txn *badger.Txn, snap *Snapshot, node *BlockNode, bitcoinNodes bool, eventManager *EventManager, entryIsDeleted bool) error {
 
-	return DBDeleteWithTxn(txn, snap, _heightHashToNodeIndexKey(node.Height, node.Hash, bitcoinNodes), eventManager, entryIsDeleted)
+	err := DBDeleteWithTxn(txn, snap, _heightHashToNodeIndexKey(node.Height, node.Hash, bitcoinNodes), eventManager, entryIsDeleted)
+	if err != nil {
+		return err
+	}
+	if !bitcoinNodes {
+		return DBPutBlockIndexCacheJournalWithTxn(txn, node.Height, node.Hash)
+	}
+	return nil
 }
 
 func DbBulkDeleteHeightHashToNodeInfo(handle *badger.DB, snap *Snapshot, nodes []*BlockNode, bitcoinNodes bool, eventManager *EventManager, entryIsDeleted bool) error {
@@ -6249,6 +6659,22 @@ type FilledDAOCoinLimitOrderMetadata struct {
 	CoinQuantityInBaseUnitsBought  *uint256.Int
 	CoinQuantityInBaseUnitsSold    *uint256.Int
 	IsFulfilled                    bool
+
+	// ===== ENCODER MIGRATION DAOCoinLimitOrderTxindexMigration =====
+	// OrderIDHex is the hex-encoded OrderID of the order that was filled.
+	OrderIDHex string
+	// IsTransactorOrder is true if the order was placed by the txn's transactor, and false
+	// if it's a resting order the transactor's order matched against.
+	IsTransactorOrder bool
+	// CounterpartyPublicKeyBase58Check is the transactor of the order on the other side of
+	// the fill.
+	CounterpartyPublicKeyBase58Check string
+	// ScaledPriceCoinsSoldPerCoinBought is the price the fill executed at from this order's
+	// side, scaled by 1e38 like ScaledExchangeRateCoinsToSellPerCoinToBuy.
+	ScaledPriceCoinsSoldPerCoinBought *uint256.Int
+	// FeeInBaseUnitsPaid is the trading fee paid on the fill, denominated in the coin
+	// bought. CoinQuantityInBaseUnitsBought includes it.
+	FeeInBaseUnitsPaid *uint256.Int
 }
 
 func (orderMeta *FilledDAOCoinLimitOrderMetadata) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
@@ -6261,6 +6687,14 @@ func (orderMeta *FilledDAOCoinLimitOrderMetadata) RawEncodeWithoutMetadata(block
 	data = append(data, VariableEncodeUint256(orderMeta.CoinQuantityInBaseUnitsSold)...)
 	data = append(data, BoolToByte(orderMeta.IsFulfilled))
 
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTxindexMigration) {
+		data = append(data, EncodeByteArray([]byte(orderMeta.OrderIDHex))...)
+		data = append(data, BoolToByte(orderMeta.IsTransactorOrder))
+		data = append(data, EncodeByteArray([]byte(orderMeta.CounterpartyPublicKeyBase58Check))...)
+		data = append(data, VariableEncodeUint256(orderMeta.ScaledPriceCoinsSoldPerCoinBought)...)
+		data = append(data, VariableEncodeUint256(orderMeta.FeeInBaseUnitsPaid)...)
+	}
+
 	return data
 }
 
@@ -6303,11 +6737,40 @@ func (orderMeta *FilledDAOCoinLimitOrderMetadata) RawDecodeWithoutMetadata(block
 	if err != nil {
 		return errors.Wrapf(err, "FilledDAOCoinLimitOrderMetadata.Decode: Problem reading IsFulfilled")
 	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTxindexMigration) {
+		orderIDHex, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrderMetadata.Decode: Problem reading OrderIDHex")
+		}
+		orderMeta.OrderIDHex = string(orderIDHex)
+
+		orderMeta.IsTransactorOrder, err = ReadBoolByte(rr)
+		if err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrderMetadata.Decode: Problem reading IsTransactorOrder")
+		}
+
+		counterpartyPublicKeyBase58Check, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrderMetadata.Decode: Problem reading CounterpartyPublicKeyBase58Check")
+		}
+		orderMeta.CounterpartyPublicKeyBase58Check = string(counterpartyPublicKeyBase58Check)
+
+		orderMeta.ScaledPriceCoinsSoldPerCoinBought, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrderMetadata.Decode: Problem reading ScaledPriceCoinsSoldPerCoinBought")
+		}
+
+		orderMeta.FeeInBaseUnitsPaid, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "FilledDAOCoinLimitOrderMetadata.Decode: Problem reading FeeInBaseUnitsPaid")
+		}
+	}
 	return nil
 }
 
 func (orderMeta *FilledDAOCoinLimitOrderMetadata) GetVersionByte(blockHeight uint64) byte {
-	return byte(0)
+	return GetMigrationVersion(blockHeight, DAOCoinLimitOrderTxindexMigration)
 }
 
 func (orderMeta *FilledDAOCoinLimitOrderMetadata) GetEncoderType() EncoderType {
@@ -6320,6 +6783,17 @@ type DAOCoinLimitOrderTxindexMetadata struct {
 	ScaledExchangeRateCoinsToSellPerCoinToBuy *uint256.Int
 	QuantityToFillInBaseUnits                 *uint256.Int
 	FilledDAOCoinLimitOrdersMetadata          []*FilledDAOCoinLimitOrderMetadata
+
+	// ===== ENCODER MIGRATION DAOCoinLimitOrderTxindexMigration =====
+	// CoinQuantityInBaseUnitsBought and CoinQuantityInBaseUnitsSold are the totals the
+	// transactor received and paid across all of the order's fills, and FeeInBaseUnitsPaid
+	// is the total trading fee the transactor paid out of the coins they bought.
+	CoinQuantityInBaseUnitsBought *uint256.Int
+	CoinQuantityInBaseUnitsSold   *uint256.Int
+	FeeInBaseUnitsPaid            *uint256.Int
+	// CounterpartyPublicKeysBase58Check are the transactors of the orders that were
+	// matched, in the order they were first filled.
+	CounterpartyPublicKeysBase58Check []string
 }
 
 func (daoMeta *DAOCoinLimitOrderTxindexMetadata) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
@@ -6334,6 +6808,16 @@ func (daoMeta *DAOCoinLimitOrderTxindexMetadata) RawEncodeWithoutMetadata(blockH
 	for _, order := range daoMeta.FilledDAOCoinLimitOrdersMetadata {
 		data = append(data, EncodeToBytes(blockHeight, order)...)
 	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTxindexMigration) {
+		data = append(data, VariableEncodeUint256(daoMeta.CoinQuantityInBaseUnitsBought)...)
+		data = append(data, VariableEncodeUint256(daoMeta.CoinQuantityInBaseUnitsSold)...)
+		data = append(data, VariableEncodeUint256(daoMeta.FeeInBaseUnitsPaid)...)
+		data = append(data, UintToBuf(uint64(len(daoMeta.CounterpartyPublicKeysBase58Check)))...)
+		for _, counterpartyPublicKeyBase58Check := range daoMeta.CounterpartyPublicKeysBase58Check {
+			data = append(data, EncodeByteArray([]byte(counterpartyPublicKeyBase58Check))...)
+		}
+	}
 	return data
 }
 
@@ -6372,11 +6856,41 @@ func (daoMeta *DAOCoinLimitOrderTxindexMetadata) RawDecodeWithoutMetadata(blockH
 		}
 		daoMeta.FilledDAOCoinLimitOrdersMetadata = append(daoMeta.FilledDAOCoinLimitOrdersMetadata, filledDAOCoinLimitOrderMetadata)
 	}
+
+	if MigrationTriggered(blockHeight, DAOCoinLimitOrderTxindexMigration) {
+		daoMeta.CoinQuantityInBaseUnitsBought, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinLimitOrderTxindexMetadata.Decode: Problem reading CoinQuantityInBaseUnitsBought")
+		}
+
+		daoMeta.CoinQuantityInBaseUnitsSold, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinLimitOrderTxindexMetadata.Decode: Problem reading CoinQuantityInBaseUnitsSold")
+		}
+
+		daoMeta.FeeInBaseUnitsPaid, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinLimitOrderTxindexMetadata.Decode: Problem reading FeeInBaseUnitsPaid")
+		}
+
+		lenCounterpartyPublicKeys, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DAOCoinLimitOrderTxindexMetadata.Decode: Problem reading len CounterpartyPublicKeysBase58Check")
+		}
+		for ; lenCounterpartyPublicKeys > 0; lenCounterpartyPublicKeys-- {
+			counterpartyPublicKeyBase58Check, err := DecodeByteArray(rr)
+			if err != nil {
+				return errors.Wrapf(err, "DAOCoinLimitOrderTxindexMetadata.Decode: Problem reading CounterpartyPublicKeysBase58Check")
+			}
+			daoMeta.CounterpartyPublicKeysBase58Check = append(
+				daoMeta.CounterpartyPublicKeysBase58Check, string(counterpartyPublicKeyBase58Check))
+		}
+	}
 	return nil
 }
 
 func (daoMeta *DAOCoinLimitOrderTxindexMetadata) GetVersionByte(blockHeight uint64) byte {
-	return byte(0)
+	return GetMigrationVersion(blockHeight, DAOCoinLimitOrderTxindexMigration)
 }
 
 func (daoMeta *DAOCoinLimitOrderTxindexMetadata) GetEncoderType() EncoderType {
@@ -7087,6 +7601,9 @@ type TransactionMetadata struct {
 	CoinLockupTransferTxindexMetadata     *CoinLockupTransferTxindexMetadata     `json:",omitempty"`
 	CoinUnlockTxindexMetadata             *CoinUnlockTxindexMetadata             `json:",omitempty"`
 	AtomicTxnsWrapperTxindexMetadata      *AtomicTxnsWrapperTxindexMetadata      `json:",omitempty"`
+
+	// Enrichments are the outputs of the registered TxindexEnrichers, in the order they ran.
+	Enrichments []*TxindexEnrichment `json:",omitempty"`
 }
 
 func (txnMeta *TransactionMetadata) GetEncoderForTxType(txnType TxnType) DeSoEncoder {
@@ -7268,6 +7785,14 @@ func (txnMeta *TransactionMetadata) RawEncodeWithoutMetadata(blockHeight uint64,
 		data = append(data, EncodeToBytes(blockHeight, txnMeta.AtomicTxnsWrapperTxindexMetadata, skipMetadata...)...)
 	}
 
+	if MigrationTriggered(blockHeight, TxindexEnrichmentMigration) {
+		// encoding Enrichments
+		data = append(data, UintToBuf(uint64(len(txnMeta.Enrichments)))...)
+		for _, enrichment := range txnMeta.Enrichments {
+			data = append(data, enrichment.Encode()...)
+		}
+	}
+
 	return data
 }
 
@@ -7548,11 +8073,27 @@ func (txnMeta *TransactionMetadata) RawDecodeWithoutMetadata(blockHeight uint64,
 		}
 	}
 
+	if MigrationTriggered(blockHeight, TxindexEnrichmentMigration) {
+		// decoding Enrichments
+		numEnrichments, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "TransactionMetadata.Decode: Problem reading number of Enrichments: ")
+		}
+		for ii := uint64(0); ii < numEnrichments; ii++ {
+			enrichment := &TxindexEnrichment{}
+			if err = enrichment.Decode(rr); err != nil {
+				return errors.Wrapf(err, "TransactionMetadata.Decode: Problem reading Enrichments: ")
+			}
+			txnMeta.Enrichments = append(txnMeta.Enrichments, enrichment)
+		}
+	}
+
 	return nil
 }
 
 func (txnMeta *TransactionMetadata) GetVersionByte(blockHeight uint64) byte {
-	return GetMigrationVersion(blockHeight, AssociationsAndAccessGroupsMigration, ProofOfStake1StateSetupMigration)
+	return GetMigrationVersion(blockHeight, AssociationsAndAccessGroupsMigration, ProofOfStake1StateSetupMigration,
+		TxindexEnrichmentMigration)
 }
 
 func (txnMeta *TransactionMetadata) GetEncoderType() EncoderType {
@@ -8314,6 +8855,14 @@ func DBDeleteNFTMappingsWithTxn(txn *badger.Txn, snap *Snapshot, nftPostHash *Bl
 			"nft mapping for pkid %v post hash %v serial number %d", nftEntry.OwnerPKID, nftPostHash, serialNumber)
 	}
 
+	if nftEntry.AuctionEndBlockHeight != 0 {
+		if err := DBDeleteWithTxn(txn, snap, _dbKeyForNFTAuctionEndBlockHeightPostHashSerialNumber(
+			nftEntry.AuctionEndBlockHeight, nftPostHash, serialNumber), eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(err, "DbDeleteNFTMappingsWithTxn: Deleting "+
+				"nft auction mapping for post hash %v serial number %d", nftPostHash, serialNumber)
+		}
+	}
+
 	// When an nftEntry exists, delete the mapping.
 	if err := DBDeleteWithTxn(txn, snap, _dbKeyForNFTPostHashSerialNumber(nftPostHash, serialNumber), eventManager, entryIsDeleted); err != nil {
 		return errors.Wrapf(err, "DbDeleteNFTMappingsWithTxn: Deleting "+
@@ -8346,6 +8895,14 @@ func DBPutNFTEntryMappingsWithTxn(txn *badger.Txn, snap *Snapshot, blockHeight u
 			"adding mapping for pkid: %v, post: %v, serial number: %d", nftEntry.OwnerPKID, nftEntry.NFTPostHash, nftEntry.SerialNumber)
 	}
 
+	if nftEntry.AuctionEndBlockHeight != 0 {
+		if err := DBSetWithTxn(txn, snap, _dbKeyForNFTAuctionEndBlockHeightPostHashSerialNumber(
+			nftEntry.AuctionEndBlockHeight, nftEntry.NFTPostHash, nftEntry.SerialNumber), nil, eventManager); err != nil {
+			return errors.Wrapf(err, "DbPutNFTEntryMappingsWithTxn: Problem adding auction "+
+				"mapping for post: %v, serial number: %d", nftEntry.NFTPostHash, nftEntry.SerialNumber)
+		}
+	}
+
 	return nil
 }
 
@@ -8356,6 +8913,36 @@ func DBPutNFTEntryMappings(handle *badger.DB, snap *Snapshot, blockHeight uint64
 	})
 }
 
+func _dbKeyForNFTAuctionEndBlockHeightPostHashSerialNumber(
+	auctionEndBlockHeight uint64, nftPostHash *BlockHash, serialNumber uint64) []byte {
+
+	prefixCopy := append([]byte{}, Prefixes.PrefixNFTAuctionEndBlockHeightPostHashSerialNumber...)
+	key := append(prefixCopy, EncodeUint64(auctionEndBlockHeight)...)
+	key = append(key, nftPostHash[:]...)
+	key = append(key, EncodeUint64(serialNumber)...)
+	return key
+}
+
+// DBGetNFTKeysForAuctionsEndingAtBlockHeight gets the keys of the NFT auctions that end at
+// auctionEndBlockHeight *from the DB*. Does not include mempool txns.
+func DBGetNFTKeysForAuctionsEndingAtBlockHeight(handle *badger.DB, auctionEndBlockHeight uint64) (
+	_nftKeys []NFTKey, _err error) {
+
+	prefix := append(append([]byte{}, Prefixes.PrefixNFTAuctionEndBlockHeightPostHashSerialNumber...),
+		EncodeUint64(auctionEndBlockHeight)...)
+	keysFound, _ := _enumerateKeysForPrefix(handle, prefix, true)
+	var nftKeys []NFTKey
+	for _, key := range keysFound {
+		if len(key) != len(prefix)+HashSizeBytes+8 {
+			return nil, fmt.Errorf("DBGetNFTKeysForAuctionsEndingAtBlockHeight: invalid key length %d", len(key))
+		}
+		nftPostHash := NewBlockHash(key[len(prefix) : len(prefix)+HashSizeBytes])
+		serialNumber := DecodeUint64(key[len(prefix)+HashSizeBytes:])
+		nftKeys = append(nftKeys, MakeNFTKey(nftPostHash, serialNumber))
+	}
+	return nftKeys, nil
+}
+
 // DBGetNFTEntriesForPostHash gets NFT Entries *from the DB*. Does not include mempool txns.
 func DBGetNFTEntriesForPostHash(handle *badger.DB, nftPostHash *BlockHash) (_nftEntries []*NFTEntry) {
 	nftEntries := []*NFTEntry{}
@@ -8418,6 +9005,173 @@ func DBGetNFTEntriesForPKID(handle *badger.DB, ownerPKID *PKID) (_nftEntries []*
 	return nftEntries
 }
 
+func _dbKeyForNFTOwnerPKIDPostHashSerialNumber(ownerPKID *PKID, nftPostHash *BlockHash, serialNumber uint64) []byte {
+	prefixCopy := append([]byte{}, Prefixes.PrefixNFTOwnerPKIDPostHashSerialNumber...)
+	key := append(prefixCopy, ownerPKID[:]...)
+	key = append(key, nftPostHash[:]...)
+	key = append(key, EncodeUint64(serialNumber)...)
+	return key
+}
+
+func DBPutNFTOwnerIndexWithTxn(txn *badger.Txn, snap *Snapshot, nftEntry *NFTEntry, eventManager *EventManager) error {
+	key := _dbKeyForNFTOwnerPKIDPostHashSerialNumber(nftEntry.OwnerPKID, nftEntry.NFTPostHash, nftEntry.SerialNumber)
+	if err := DBSetWithTxn(txn, snap, key, nil, eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutNFTOwnerIndexWithTxn: Problem adding mapping for pkid: %v, "+
+			"post: %v, serial number: %d", nftEntry.OwnerPKID, nftEntry.NFTPostHash, nftEntry.SerialNumber)
+	}
+	return nil
+}
+
+// DBDeleteNFTOwnerIndexWithTxn deletes the owner index mapping for the NFTEntry currently
+// stored in the db for the post / serial # passed in, if there is one.
+func DBDeleteNFTOwnerIndexWithTxn(txn *badger.Txn, snap *Snapshot, nftPostHash *BlockHash, serialNumber uint64,
+	eventManager *EventManager, entryIsDeleted bool) error {
+
+	nftEntry := DBGetNFTEntryByPostHashSerialNumberWithTxn(txn, snap, nftPostHash, serialNumber)
+	if nftEntry == nil {
+		return nil
+	}
+	key := _dbKeyForNFTOwnerPKIDPostHashSerialNumber(nftEntry.OwnerPKID, nftPostHash, serialNumber)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteNFTOwnerIndexWithTxn: Deleting mapping for pkid %v "+
+			"post hash %v serial number %d", nftEntry.OwnerPKID, nftPostHash, serialNumber)
+	}
+	return nil
+}
+
+// DBBackfillNFTOwnerIndexWithTxn populates PrefixNFTOwnerPKIDPostHashSerialNumber from the
+// existing NFTEntries. It runs once, when the NFTOwnerIndexBlockHeight is flushed.
+func DBBackfillNFTOwnerIndexWithTxn(txn *badger.Txn, snap *Snapshot, eventManager *EventManager) error {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, Prefixes.PrefixPostHashSerialNumberToNFTEntry, false)
+	if err != nil {
+		return errors.Wrapf(err, "DBBackfillNFTOwnerIndexWithTxn: ")
+	}
+	for _, nftEntryBytes := range valsFound {
+		nftEntry := &NFTEntry{}
+		if exists, err := DecodeFromBytes(nftEntry, bytes.NewReader(nftEntryBytes)); !exists || err != nil {
+			return errors.Wrapf(err, "DBBackfillNFTOwnerIndexWithTxn: Problem decoding NFTEntry")
+		}
+		if err := DBPutNFTOwnerIndexWithTxn(txn, snap, nftEntry, eventManager); err != nil {
+			return errors.Wrapf(err, "DBBackfillNFTOwnerIndexWithTxn: ")
+		}
+	}
+	return nil
+}
+
+// DBGetPaginatedNFTEntriesForOwnerPKID gets up to limit of the NFTEntries owned by ownerPKID
+// *from the DB*, sorted by post hash and serial number and starting after startingNFTKey. If
+// startingNFTKey is nil, it starts from the first NFT. Does not include mempool txns.
+func DBGetPaginatedNFTEntriesForOwnerPKID(handle *badger.DB, snap *Snapshot, ownerPKID *PKID,
+	startingNFTKey *NFTKey, limit uint32) (_nftEntries []*NFTEntry, _err error) {
+
+	var nftEntries []*NFTEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		prefix := append(append([]byte{}, Prefixes.PrefixNFTOwnerPKIDPostHashSerialNumber...), ownerPKID[:]...)
+		startKey := prefix
+		numKeysToFetch := limit
+		if startingNFTKey != nil {
+			startKey = _dbKeyForNFTOwnerPKIDPostHashSerialNumber(
+				ownerPKID, &startingNFTKey.NFTPostHash, startingNFTKey.SerialNumber)
+			// Fetch one extra key in case the first one found is the starting key.
+			if numKeysToFetch < math.MaxUint32 {
+				numKeysToFetch++
+			}
+		}
+		for _, key := range _enumeratePaginatedLimitedKeysForPrefixWithTxn(txn, prefix, startKey, numKeysToFetch) {
+			if bytes.Equal(key, startKey) || uint32(len(nftEntries)) >= limit {
+				continue
+			}
+			if len(key) != len(prefix)+HashSizeBytes+8 {
+				return fmt.Errorf("DBGetPaginatedNFTEntriesForOwnerPKID: invalid key length %d", len(key))
+			}
+			nftPostHash := NewBlockHash(key[len(prefix) : len(prefix)+HashSizeBytes])
+			serialNumber := DecodeUint64(key[len(prefix)+HashSizeBytes:])
+			nftEntry := DBGetNFTEntryByPostHashSerialNumberWithTxn(txn, snap, nftPostHash, serialNumber)
+			if nftEntry == nil {
+				return fmt.Errorf("DBGetPaginatedNFTEntriesForOwnerPKID: missing NFTEntry for "+
+					"post hash %v serial number %d", nftPostHash, serialNumber)
+			}
+			nftEntries = append(nftEntries, nftEntry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nftEntries, nil
+}
+
+func _dbKeyForNFTLesseePKIDPostHashSerialNumber(lesseePKID *PKID, nftPostHash *BlockHash, serialNumber uint64) []byte {
+	prefixCopy := append([]byte{}, Prefixes.PrefixNFTLesseePKIDPostHashSerialNumber...)
+	key := append(prefixCopy, lesseePKID[:]...)
+	key = append(key, nftPostHash[:]...)
+	key = append(key, EncodeUint64(serialNumber)...)
+	return key
+}
+
+// DBPutNFTLesseeIndexWithTxn adds the lessee index mapping for the NFTEntry if it's leased.
+func DBPutNFTLesseeIndexWithTxn(txn *badger.Txn, snap *Snapshot, nftEntry *NFTEntry, eventManager *EventManager) error {
+	if nftEntry.LesseePKID == nil {
+		return nil
+	}
+	key := _dbKeyForNFTLesseePKIDPostHashSerialNumber(nftEntry.LesseePKID, nftEntry.NFTPostHash, nftEntry.SerialNumber)
+	if err := DBSetWithTxn(txn, snap, key, nil, eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutNFTLesseeIndexWithTxn: Problem adding mapping for pkid: %v, "+
+			"post: %v, serial number: %d", nftEntry.LesseePKID, nftEntry.NFTPostHash, nftEntry.SerialNumber)
+	}
+	return nil
+}
+
+// DBDeleteNFTLesseeIndexWithTxn deletes the lessee index mapping for the NFTEntry currently
+// stored in the db for the post / serial # passed in, if it's leased.
+func DBDeleteNFTLesseeIndexWithTxn(txn *badger.Txn, snap *Snapshot, nftPostHash *BlockHash, serialNumber uint64,
+	eventManager *EventManager, entryIsDeleted bool) error {
+
+	nftEntry := DBGetNFTEntryByPostHashSerialNumberWithTxn(txn, snap, nftPostHash, serialNumber)
+	if nftEntry == nil || nftEntry.LesseePKID == nil {
+		return nil
+	}
+	key := _dbKeyForNFTLesseePKIDPostHashSerialNumber(nftEntry.LesseePKID, nftPostHash, serialNumber)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteNFTLesseeIndexWithTxn: Deleting mapping for pkid %v "+
+			"post hash %v serial number %d", nftEntry.LesseePKID, nftPostHash, serialNumber)
+	}
+	return nil
+}
+
+// DBGetNFTEntriesForLesseePKID gets the NFTEntries leased to lesseePKID *from the DB*,
+// including those whose lease has expired but hasn't been ended. Does not include mempool txns.
+func DBGetNFTEntriesForLesseePKID(handle *badger.DB, snap *Snapshot, lesseePKID *PKID) (
+	_nftEntries []*NFTEntry, _err error) {
+
+	var nftEntries []*NFTEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		prefix := append(append([]byte{}, Prefixes.PrefixNFTLesseePKIDPostHashSerialNumber...), lesseePKID[:]...)
+		keysFound, _, err := _enumerateKeysForPrefixWithTxn(txn, prefix, true)
+		if err != nil {
+			return err
+		}
+		for _, key := range keysFound {
+			if len(key) != len(prefix)+HashSizeBytes+8 {
+				return fmt.Errorf("DBGetNFTEntriesForLesseePKID: invalid key length %d", len(key))
+			}
+			nftPostHash := NewBlockHash(key[len(prefix) : len(prefix)+HashSizeBytes])
+			serialNumber := DecodeUint64(key[len(prefix)+HashSizeBytes:])
+			nftEntry := DBGetNFTEntryByPostHashSerialNumberWithTxn(txn, snap, nftPostHash, serialNumber)
+			if nftEntry == nil {
+				return fmt.Errorf("DBGetNFTEntriesForLesseePKID: missing NFTEntry for "+
+					"post hash %v serial number %d", nftPostHash, serialNumber)
+			}
+			nftEntries = append(nftEntries, nftEntry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nftEntries, nil
+}
+
 // =======================================================================================
 // AcceptedNFTBidEntries db functions
 // NOTE: This index is not essential to running the protocol and should be computed
@@ -9206,6 +9960,13 @@ func DBDeleteBalanceEntryMappingsWithTxn(txn *badger.Txn, snap *Snapshot, hodler
 			PkToStringBoth(hodlerPKID[:]), PkToStringBoth(creatorPKID[:]))
 	}
 
+	// Remove the holder from the DAO coin holder index. It's added back if the entry is put again.
+	if isDAOCoin {
+		if err := _dbDeleteDAOCoinHolderIndexEntryWithTxn(txn, balanceEntry); err != nil {
+			return errors.Wrapf(err, "DBDeleteBalanceEntryMappingsWithTxn: ")
+		}
+	}
+
 	// Note: We don't update the CreatorDeSoLockedNanosCreatorPubKeyIIndex
 	// because we expect that the caller is keeping the individual holdings in
 	// sync with the "total" coins stored in the profile.
@@ -9249,6 +10010,13 @@ func DBPutBalanceEntryMappingsWithTxn(txn *badger.Txn, snap *Snapshot, blockHeig
 			PkToStringBoth(balanceEntry.CreatorPKID[:]))
 	}
 
+	// Add the holder to the DAO coin holder index.
+	if isDAOCoin {
+		if err := _dbPutDAOCoinHolderIndexEntryWithTxn(txn, balanceEntry); err != nil {
+			return errors.Wrapf(err, "DBPutBalanceEntryMappingsWithTxn: ")
+		}
+	}
+
 	return nil
 }
 
@@ -9282,7 +10050,7 @@ func GetSingleBalanceEntryFromPublicKeys(holder []byte, creator []byte, utxoView
 	}
 
 	// Check if there's a balance entry in the database
-	balanceEntryFromDb := DbGetBalanceEntry(utxoView.Handle, utxoView.Snapshot, holderPKID, creatorPKID, isDAOCoin)
+	balanceEntryFromDb := utxoView.GetDbAdapter().GetBalanceEntry(holderPKID, creatorPKID, isDAOCoin)
 	return balanceEntryFromDb, nil
 }
 
@@ -9675,6 +10443,15 @@ func DBKeyForDAOCoinLimitOrder(order *DAOCoinLimitOrderEntry) []byte {
 }
 
 func DBPrefixKeyForDAOCoinLimitOrder(order *DAOCoinLimitOrderEntry) []byte {
+	// Orders that trade creator coins have their own order books.
+	if order.IsCreatorCoinOrder() {
+		key := append([]byte{}, Prefixes.PrefixDAOCoinLimitOrderWithCreatorCoins...)
+		key = append(key, order.BuyingDAOCoinCreatorPKID.ToBytes()...)
+		key = append(key, BoolToByte(order.BuyingCoinIsCreatorCoin))
+		key = append(key, order.SellingDAOCoinCreatorPKID.ToBytes()...)
+		key = append(key, BoolToByte(order.SellingCoinIsCreatorCoin))
+		return key
+	}
 	key := append([]byte{}, Prefixes.PrefixDAOCoinLimitOrder...)
 	key = append(key, order.BuyingDAOCoinCreatorPKID.ToBytes()...)
 	key = append(key, order.SellingDAOCoinCreatorPKID.ToBytes()...)
@@ -9737,19 +10514,22 @@ func DBGetDAOCoinLimitOrderWithTxn(txn *badger.Txn, snap *Snapshot, orderID *Blo
 
 func DBGetMatchingDAOCoinLimitOrders(
 	txn *badger.Txn, inputOrder *DAOCoinLimitOrderEntry, lastSeenOrder *DAOCoinLimitOrderEntry,
-	orderEntriesInView map[DAOCoinLimitOrderMapKey]bool) ([]*DAOCoinLimitOrderEntry, error) {
+	orderEntriesInView map[DAOCoinLimitOrderMapKey]bool, matchingOrderLastTradePrice *uint256.Int) (
+	[]*DAOCoinLimitOrderEntry, error) {
 
 	queryOrder := inputOrder.Copy()
 	queryQuantityToFill := queryOrder.QuantityToFillInBaseUnits.Clone()
 
 	// Convert the input BID order to the ASK order to query for.
 	// Note that we seek in reverse for the best matching orders.
-	//   * Swap BuyingDAOCoinCreatorPKID and SellingDAOCoinCreatorPKID.
+	//   * Swap BuyingDAOCoinCreatorPKID and SellingDAOCoinCreatorPKID, and their creator coin flags.
 	//   * Set ScaledExchangeRateCoinsToSellPerCoinToBuy to MaxUint256.
 	//   * Set BlockHeight to 0 as this becomes math.MaxUint32 in the key.
 	//   * Set OrderID to MaxBlockHash.
 	queryOrder.BuyingDAOCoinCreatorPKID = inputOrder.SellingDAOCoinCreatorPKID
 	queryOrder.SellingDAOCoinCreatorPKID = inputOrder.BuyingDAOCoinCreatorPKID
+	queryOrder.BuyingCoinIsCreatorCoin = inputOrder.SellingCoinIsCreatorCoin
+	queryOrder.SellingCoinIsCreatorCoin = inputOrder.BuyingCoinIsCreatorCoin
 	queryOrder.ScaledExchangeRateCoinsToSellPerCoinToBuy = MaxUint256.Clone()
 	queryOrder.BlockHeight = uint32(0)
 	queryOrder.OrderID = maxHash.NewBlockHash()
@@ -9799,6 +10579,18 @@ func DBGetMatchingDAOCoinLimitOrders(
 			continue
 		}
 
+		// Skip if order has expired. The input order's BlockHeight is
+		// the height at which it's being matched.
+		if matchingOrder.IsExpired(inputOrder.BlockHeight) {
+			continue
+		}
+
+		// Skip if order is a stop-limit order that hasn't been triggered by
+		// the last trade price for its direction of the pair.
+		if matchingOrder.IsDormantStopOrder(matchingOrderLastTradePrice) {
+			continue
+		}
+
 		// Validate matching order's price.
 		if !inputOrder.IsValidMatchingOrderPrice(matchingOrder) {
 			break
@@ -9808,7 +10600,7 @@ func DBGetMatchingDAOCoinLimitOrders(
 		// after being matched with this order. If the transactor still
 		// has quantity to fill, we loop.
 		queryQuantityToFill, _, _, _, err = _calculateDAOCoinsTransferredInLimitOrderMatch(
-			matchingOrder, queryOrder.OperationType, queryQuantityToFill)
+			matchingOrder, queryOrder.GetQuantityOperationType(), queryQuantityToFill)
 		if err != nil {
 			return nil, errors.Wrapf(err, "DBGetMatchingDAOCoinLimitOrders: ")
 		}
@@ -9820,9 +10612,18 @@ func DBGetMatchingDAOCoinLimitOrders(
 }
 
 func DBGetAllDAOCoinLimitOrders(handle *badger.DB) ([]*DAOCoinLimitOrderEntry, error) {
-	// Get all DAO Coin limit orders.
+	// Get all DAO Coin limit orders, including the ones that trade creator coins.
 	key := append([]byte{}, Prefixes.PrefixDAOCoinLimitOrder...)
-	return _DBGetAllDAOCoinLimitOrdersByPrefix(handle, key)
+	orders, err := _DBGetAllDAOCoinLimitOrdersByPrefix(handle, key)
+	if err != nil {
+		return nil, err
+	}
+	key = append([]byte{}, Prefixes.PrefixDAOCoinLimitOrderWithCreatorCoins...)
+	creatorCoinOrders, err := _DBGetAllDAOCoinLimitOrdersByPrefix(handle, key)
+	if err != nil {
+		return nil, err
+	}
+	return append(orders, creatorCoinOrders...), nil
 }
 
 func DBGetAllDAOCoinLimitOrdersForThisDAOCoinPair(
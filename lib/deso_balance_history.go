@@ -0,0 +1,450 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// deso_balance_history.go implements an optional index of every change to a public key's DESO
+// balance, so that accounting and compliance exports don't have to replay the chain. Like the
+// DAO coin candle index, it isn't part of consensus: it's populated from the UtxoOperations of
+// committed blocks, stored under non-state prefixes, and removed again when a block is
+// disconnected.
+//
+// Each entry is the net change a single txn made to a public key's balance, along with the
+// balance that resulted. Changes made after all of a block's txns were connected, like PoS
+// stake rewards, are recorded with a TxnIndex equal to the number of txns in the block. The
+// first time a public key shows up in the index, its balance before the block is worked out
+// from its balance after the block, so the index doesn't need to start at the genesis block.
+
+const (
+	EncoderTypeDeSoBalanceHistoryEntry EncoderType = 5000000
+)
+
+// MaxDeSoBalanceHistoryEntriesPerQuery bounds the number of entries a single query returns.
+const MaxDeSoBalanceHistoryEntriesPerQuery = 1000
+
+//
+// TYPES: DeSoBalanceHistoryEntry
+//
+
+type DeSoBalanceHistoryEntry struct {
+	PublicKey   []byte
+	BlockHash   *BlockHash
+	BlockHeight uint64
+	TxnIndex    uint32
+	// TxnHash is nil for changes made after all of the block's txns were connected.
+	TxnHash *BlockHash
+	// DeltaNanos is the net change to the balance, and BalanceNanos is the balance after it.
+	DeltaNanos   int64
+	BalanceNanos uint64
+}
+
+func (entry *DeSoBalanceHistoryEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeByteArray(entry.PublicKey)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.BlockHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, UintToBuf(uint64(entry.TxnIndex))...)
+	data = append(data, EncodeToBytes(blockHeight, entry.TxnHash, skipMetadata...)...)
+	data = append(data, IntToBuf(entry.DeltaNanos)...)
+	data = append(data, UintToBuf(entry.BalanceNanos)...)
+	return data
+}
+
+func (entry *DeSoBalanceHistoryEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	entry.PublicKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryEntry.Decode: Problem reading PublicKey: ")
+	}
+	entry.BlockHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryEntry.Decode: Problem reading BlockHash: ")
+	}
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryEntry.Decode: Problem reading BlockHeight: ")
+	}
+	txnIndex, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryEntry.Decode: Problem reading TxnIndex: ")
+	}
+	entry.TxnIndex = uint32(txnIndex)
+	entry.TxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryEntry.Decode: Problem reading TxnHash: ")
+	}
+	entry.DeltaNanos, err = ReadVarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryEntry.Decode: Problem reading DeltaNanos: ")
+	}
+	entry.BalanceNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryEntry.Decode: Problem reading BalanceNanos: ")
+	}
+	return nil
+}
+
+func (entry *DeSoBalanceHistoryEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DeSoBalanceHistoryEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDeSoBalanceHistoryEntry
+}
+
+// GetDeSoBalanceDeltasForBlock extracts the net change each txn in a block made to each public
+// key's DESO balance from the block's UtxoOperations. The entries it returns are in the order
+// the changes happened, and their BalanceNanos isn't set. Txns that leave a balance unchanged
+// don't get an entry.
+func GetDeSoBalanceDeltasForBlock(block *MsgDeSoBlock, utxoOpsForBlock [][]*UtxoOperation) (
+	[]*DeSoBalanceHistoryEntry, error) {
+
+	blockHash, err := block.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDeSoBalanceDeltasForBlock: Problem hashing block: ")
+	}
+
+	var entries []*DeSoBalanceHistoryEntry
+	for txnIndex, utxoOpsForTxn := range utxoOpsForBlock {
+		// The UtxoOperations past the block's txns are the block-level ones.
+		var txnHash *BlockHash
+		if txnIndex < len(block.Txns) {
+			txnHash = block.Txns[txnIndex].Hash()
+		}
+
+		deltasByPublicKey := make(map[PublicKey]int64)
+		var publicKeys []PublicKey
+		addDelta := func(publicKey []byte, deltaNanos int64) {
+			if len(publicKey) != PublicKeyLenCompressed {
+				return
+			}
+			pk := *NewPublicKey(publicKey)
+			if _, exists := deltasByPublicKey[pk]; !exists {
+				publicKeys = append(publicKeys, pk)
+			}
+			deltasByPublicKey[pk] += deltaNanos
+		}
+		for _, utxoOp := range _flattenDeSoBalanceUtxoOps(utxoOpsForTxn) {
+			switch utxoOp.Type {
+			case OperationTypeAddBalance, OperationTypeStakeDistributionPayToBalance:
+				addDelta(utxoOp.BalancePublicKey, int64(utxoOp.BalanceAmountNanos))
+			case OperationTypeSpendBalance:
+				addDelta(utxoOp.BalancePublicKey, -int64(utxoOp.BalanceAmountNanos))
+			case OperationTypeAddUtxo:
+				if utxoOp.Entry != nil {
+					addDelta(utxoOp.Entry.PublicKey, int64(utxoOp.Entry.AmountNanos))
+				}
+			case OperationTypeSpendUtxo:
+				if utxoOp.Entry != nil {
+					addDelta(utxoOp.Entry.PublicKey, -int64(utxoOp.Entry.AmountNanos))
+				}
+			}
+		}
+
+		for _, pk := range publicKeys {
+			if deltasByPublicKey[pk] == 0 {
+				continue
+			}
+			pkCopy := pk
+			entries = append(entries, &DeSoBalanceHistoryEntry{
+				PublicKey:   pkCopy.ToBytes(),
+				BlockHash:   blockHash,
+				BlockHeight: block.Header.Height,
+				TxnIndex:    uint32(txnIndex),
+				TxnHash:     txnHash,
+				DeltaNanos:  deltasByPublicKey[pk],
+			})
+		}
+	}
+	return entries, nil
+}
+
+// _flattenDeSoBalanceUtxoOps returns the UtxoOperations of a txn, including those of the txns
+// wrapped by an atomic txn or a batch.
+func _flattenDeSoBalanceUtxoOps(utxoOpsForTxn []*UtxoOperation) []*UtxoOperation {
+	var balanceOps []*UtxoOperation
+	for _, utxoOp := range utxoOpsForTxn {
+		balanceOps = append(balanceOps, utxoOp)
+		for _, innerUtxoOps := range utxoOp.AtomicTxnsInnerUtxoOps {
+			balanceOps = append(balanceOps, _flattenDeSoBalanceUtxoOps(innerUtxoOps)...)
+		}
+	}
+	return balanceOps
+}
+
+//
+// DB UTILS
+//
+
+func _dbKeyForDeSoBalanceHistoryPublicKey(publicKey []byte) []byte {
+	return append(append([]byte{}, Prefixes.PrefixDeSoBalanceHistoryByPublicKey...), publicKey...)
+}
+
+func DBKeyForDeSoBalanceHistoryEntry(entry *DeSoBalanceHistoryEntry) []byte {
+	key := _dbKeyForDeSoBalanceHistoryPublicKey(entry.PublicKey)
+	key = append(key, EncodeUint64(entry.BlockHeight)...)
+	key = append(key, _EncodeUint32(entry.TxnIndex)...)
+	return key
+}
+
+func DBKeyForDeSoBalanceHistoryKeysByBlockHash(blockHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixDeSoBalanceHistoryKeysByBlockHash...), blockHash.ToBytes()...)
+}
+
+// DBGetDeSoBalanceHistoryWithTxn returns up to limit of the public key's balance history entries
+// in the order they happened. If lastEntry is set, the entries start right after it. If reverse
+// is set, the entries are returned newest first, starting right before lastEntry.
+func DBGetDeSoBalanceHistoryWithTxn(
+	txn *badger.Txn,
+	publicKey []byte,
+	lastEntry *DeSoBalanceHistoryEntry,
+	limit int,
+	reverse bool,
+) ([]*DeSoBalanceHistoryEntry, error) {
+	prefix := _dbKeyForDeSoBalanceHistoryPublicKey(publicKey)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	opts.Reverse = reverse
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	var startKey []byte
+	var lastKey []byte
+	if lastEntry != nil {
+		lastKey = DBKeyForDeSoBalanceHistoryEntry(lastEntry)
+		startKey = lastKey
+	} else if reverse {
+		// The keys after the prefix are always 12 bytes long, so this sorts after all of them.
+		startKey = append(append([]byte{}, prefix...), bytes.Repeat([]byte{0xff}, 13)...)
+	} else {
+		startKey = prefix
+	}
+
+	var entries []*DeSoBalanceHistoryEntry
+	for iterator.Seek(startKey); iterator.ValidForPrefix(prefix) && len(entries) < limit; iterator.Next() {
+		if lastKey != nil && bytes.Equal(iterator.Item().Key(), lastKey) {
+			continue
+		}
+		entryBytes, err := iterator.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDeSoBalanceHistoryWithTxn: Problem reading entry: ")
+		}
+		entry, err := DecodeDeSoEncoder(&DeSoBalanceHistoryEntry{}, bytes.NewReader(entryBytes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDeSoBalanceHistoryWithTxn: Problem decoding entry: ")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+//
+// DeSoBalanceHistoryIndex
+//
+
+// DeSoBalanceHistoryIndex maintains the DESO balance history index in the chain's db. Register
+// HandleBlockCommitted and HandleBlockDisconnected with the EventManager to keep it in sync
+// with the chain.
+type DeSoBalanceHistoryIndex struct {
+	// mtx serializes connects and disconnects so running balances are always computed from a
+	// consistent history.
+	mtx sync.Mutex
+	db  *badger.DB
+}
+
+func NewDeSoBalanceHistoryIndex(db *badger.DB) *DeSoBalanceHistoryIndex {
+	return &DeSoBalanceHistoryIndex{db: db}
+}
+
+func (index *DeSoBalanceHistoryIndex) HandleBlockCommitted(event *BlockEvent) {
+	utxoOpsForBlock := event.UtxoOps
+	if utxoOpsForBlock == nil {
+		// Blocks attached during a reorg are signaled without their UtxoOperations, but
+		// they've been stored by the time the event fires.
+		blockHash, err := event.Block.Hash()
+		if err != nil {
+			glog.Errorf("DeSoBalanceHistoryIndex.HandleBlockCommitted: Problem hashing block: %v", err)
+			return
+		}
+		utxoOpsForBlock, err = GetUtxoOperationsForBlock(index.db, nil, blockHash)
+		if err != nil {
+			glog.Errorf("DeSoBalanceHistoryIndex.HandleBlockCommitted: Problem getting UtxoOps for block %v: %v",
+				blockHash, err)
+			return
+		}
+	}
+	if err := index.ConnectBlock(event.Block, utxoOpsForBlock, event.UtxoView); err != nil {
+		glog.Errorf("DeSoBalanceHistoryIndex.HandleBlockCommitted: %v", err)
+	}
+}
+
+func (index *DeSoBalanceHistoryIndex) HandleBlockDisconnected(event *BlockEvent) {
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		glog.Errorf("DeSoBalanceHistoryIndex.HandleBlockDisconnected: Problem hashing block: %v", err)
+		return
+	}
+	if err = index.DisconnectBlock(blockHash); err != nil {
+		glog.Errorf("DeSoBalanceHistoryIndex.DisconnectBlock: %v", err)
+	}
+}
+
+// ConnectBlock records the changes the block made to DESO balances. Running balances continue
+// from each public key's latest entry. For a public key without one, they start from its
+// balance after the block, taken from the view the block was connected to or from the db if
+// there's no view, minus what the block changed. A block that has already been recorded is
+// skipped.
+func (index *DeSoBalanceHistoryIndex) ConnectBlock(
+	block *MsgDeSoBlock, utxoOpsForBlock [][]*UtxoOperation, utxoView *UtxoView) error {
+
+	entries, err := GetDeSoBalanceDeltasForBlock(block, utxoOpsForBlock)
+	if err != nil {
+		return errors.Wrapf(err, "DeSoBalanceHistoryIndex.ConnectBlock: ")
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	blockHash := entries[0].BlockHash
+
+	netDeltasByPublicKey := make(map[PublicKey]int64)
+	for _, entry := range entries {
+		netDeltasByPublicKey[*NewPublicKey(entry.PublicKey)] += entry.DeltaNanos
+	}
+
+	index.mtx.Lock()
+	defer index.mtx.Unlock()
+
+	return index.db.Update(func(txn *badger.Txn) error {
+		blockKey := DBKeyForDeSoBalanceHistoryKeysByBlockHash(blockHash)
+		if _, err := txn.Get(blockKey); err == nil {
+			return nil
+		} else if err != badger.ErrKeyNotFound {
+			return errors.Wrapf(err, "DeSoBalanceHistoryIndex.ConnectBlock: Problem checking block %v: ", blockHash)
+		}
+
+		balancesByPublicKey := make(map[PublicKey]uint64)
+		var entryKeysBytes []byte
+		entryKeysBytes = append(entryKeysBytes, UintToBuf(uint64(len(entries)))...)
+		for _, entry := range entries {
+			pk := *NewPublicKey(entry.PublicKey)
+			balanceNanos, exists := balancesByPublicKey[pk]
+			if !exists {
+				balanceNanos, err = index._getBalanceBeforeBlockWithTxn(
+					txn, entry.PublicKey, netDeltasByPublicKey[pk], utxoView)
+				if err != nil {
+					return errors.Wrapf(err, "DeSoBalanceHistoryIndex.ConnectBlock: ")
+				}
+			}
+			if entry.DeltaNanos < 0 && uint64(-entry.DeltaNanos) > balanceNanos {
+				return fmt.Errorf("DeSoBalanceHistoryIndex.ConnectBlock: Change %v exceeds balance %v "+
+					"of public key %v", entry.DeltaNanos, balanceNanos, PkToStringBoth(entry.PublicKey))
+			}
+			entry.BalanceNanos = uint64(int64(balanceNanos) + entry.DeltaNanos)
+			balancesByPublicKey[pk] = entry.BalanceNanos
+
+			entryKey := DBKeyForDeSoBalanceHistoryEntry(entry)
+			if err := DBSetWithTxn(txn, nil, entryKey, EncodeToBytes(0, entry), nil); err != nil {
+				return errors.Wrapf(err, "DeSoBalanceHistoryIndex.ConnectBlock: Problem storing entry: ")
+			}
+			entryKeysBytes = append(entryKeysBytes, EncodeByteArray(entryKey)...)
+		}
+		return DBSetWithTxn(txn, nil, blockKey, entryKeysBytes, nil)
+	})
+}
+
+// _getBalanceBeforeBlockWithTxn returns the public key's balance before the block that changed
+// it by netDeltaNanos.
+func (index *DeSoBalanceHistoryIndex) _getBalanceBeforeBlockWithTxn(
+	txn *badger.Txn, publicKey []byte, netDeltaNanos int64, utxoView *UtxoView) (uint64, error) {
+
+	latestEntries, err := DBGetDeSoBalanceHistoryWithTxn(txn, publicKey, nil, 1, true)
+	if err != nil {
+		return 0, err
+	}
+	if len(latestEntries) != 0 {
+		return latestEntries[0].BalanceNanos, nil
+	}
+
+	var balanceAfterBlockNanos uint64
+	if utxoView != nil {
+		balanceAfterBlockNanos, err = utxoView.GetDeSoBalanceNanosForPublicKey(publicKey)
+	} else {
+		balanceAfterBlockNanos, err = DbGetDeSoBalanceNanosForPublicKeyWithTxn(txn, nil, publicKey)
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "Problem getting balance of public key %v: ", PkToStringBoth(publicKey))
+	}
+	if netDeltaNanos > 0 && uint64(netDeltaNanos) > balanceAfterBlockNanos {
+		return 0, fmt.Errorf("Balance %v of public key %v is less than the %v the block added to it",
+			balanceAfterBlockNanos, PkToStringBoth(publicKey), netDeltaNanos)
+	}
+	return uint64(int64(balanceAfterBlockNanos) - netDeltaNanos), nil
+}
+
+// DisconnectBlock removes the block's balance history entries.
+func (index *DeSoBalanceHistoryIndex) DisconnectBlock(blockHash *BlockHash) error {
+	index.mtx.Lock()
+	defer index.mtx.Unlock()
+
+	return index.db.Update(func(txn *badger.Txn) error {
+		blockKey := DBKeyForDeSoBalanceHistoryKeysByBlockHash(blockHash)
+		entryKeysBytes, err := DBGetWithTxn(txn, nil, blockKey)
+		if err == badger.ErrKeyNotFound {
+			// The block didn't change any balances, or was never recorded.
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "DeSoBalanceHistoryIndex.DisconnectBlock: Problem getting block %v: ", blockHash)
+		}
+
+		rr := bytes.NewReader(entryKeysBytes)
+		numEntries, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "DeSoBalanceHistoryIndex.DisconnectBlock: Problem reading number of entries: ")
+		}
+		for ii := uint64(0); ii < numEntries; ii++ {
+			entryKey, err := DecodeByteArray(rr)
+			if err != nil {
+				return errors.Wrapf(err, "DeSoBalanceHistoryIndex.DisconnectBlock: Problem reading entry key: ")
+			}
+			if err = DBDeleteWithTxn(txn, nil, entryKey, nil, true); err != nil {
+				return errors.Wrapf(err, "DeSoBalanceHistoryIndex.DisconnectBlock: Problem deleting entry: ")
+			}
+		}
+		return DBDeleteWithTxn(txn, nil, blockKey, nil, true)
+	})
+}
+
+// GetBalanceHistory returns up to limit of the public key's balance history entries, oldest
+// first. To get the next page, pass the last entry of the previous page as lastEntry. If
+// reverse is set, the entries are returned newest first instead.
+func (index *DeSoBalanceHistoryIndex) GetBalanceHistory(
+	publicKey []byte, lastEntry *DeSoBalanceHistoryEntry, limit int, reverse bool) (
+	[]*DeSoBalanceHistoryEntry, error) {
+
+	if limit <= 0 || limit > MaxDeSoBalanceHistoryEntriesPerQuery {
+		return nil, fmt.Errorf("DeSoBalanceHistoryIndex.GetBalanceHistory: Limit %v must be between 1 and %v",
+			limit, MaxDeSoBalanceHistoryEntriesPerQuery)
+	}
+	if lastEntry != nil && !bytes.Equal(lastEntry.PublicKey, publicKey) {
+		return nil, fmt.Errorf("DeSoBalanceHistoryIndex.GetBalanceHistory: Last entry is for a different public key")
+	}
+
+	var entries []*DeSoBalanceHistoryEntry
+	err := index.db.View(func(txn *badger.Txn) error {
+		var err error
+		entries, err = DBGetDeSoBalanceHistoryWithTxn(txn, publicKey, lastEntry, limit, reverse)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DeSoBalanceHistoryIndex.GetBalanceHistory: ")
+	}
+	return entries, nil
+}
@@ -0,0 +1,99 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeSoBalanceHistoryIndex(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	index := NewDeSoBalanceHistoryIndex(db)
+
+	makeBlock := func(height uint64, numTxns int) *MsgDeSoBlock {
+		block := &MsgDeSoBlock{Header: &MsgDeSoHeader{
+			Version:               HeaderVersion1,
+			PrevBlockHash:         &BlockHash{},
+			TransactionMerkleRoot: &BlockHash{},
+			Height:                height,
+		}}
+		for ii := 0; ii < numTxns; ii++ {
+			block.Txns = append(block.Txns, &MsgDeSoTxn{
+				PublicKey: m0PkBytes, TxnMeta: &BasicTransferMetadata{}, ExtraData: map[string][]byte{"i": {byte(ii)}}})
+		}
+		return block
+	}
+	addBalance := func(publicKey []byte, amountNanos uint64) *UtxoOperation {
+		return &UtxoOperation{Type: OperationTypeAddBalance, BalancePublicKey: publicKey, BalanceAmountNanos: amountNanos}
+	}
+	spendBalance := func(publicKey []byte, amountNanos uint64) *UtxoOperation {
+		return &UtxoOperation{Type: OperationTypeSpendBalance, BalancePublicKey: publicKey, BalanceAmountNanos: amountNanos}
+	}
+
+	// In the first block, m0 pays m1 100 with a fee of 10, then pays m1 50 in an atomic txn. After
+	// the block, m0 has 840 and m1 has 150, and m2 is paid a block-level reward of 5.
+	block1 := makeBlock(1, 2)
+	utxoOps1 := [][]*UtxoOperation{
+		{spendBalance(m0PkBytes, 110), addBalance(m1PkBytes, 100)},
+		{{Type: OperationTypeAtomicTxnsWrapper, AtomicTxnsInnerUtxoOps: [][]*UtxoOperation{
+			{spendBalance(m0PkBytes, 50), addBalance(m1PkBytes, 50)},
+		}}},
+		{{Type: OperationTypeStakeDistributionPayToBalance, BalancePublicKey: m2PkBytes, BalanceAmountNanos: 5}},
+	}
+	deltas, err := GetDeSoBalanceDeltasForBlock(block1, utxoOps1)
+	require.NoError(err)
+	require.Len(deltas, 5)
+	require.Equal(int64(-110), deltas[0].DeltaNanos)
+	require.Equal(block1.Txns[0].Hash(), deltas[0].TxnHash)
+	require.Equal(uint32(2), deltas[4].TxnIndex)
+	require.Nil(deltas[4].TxnHash)
+
+	require.NoError(DbPutDeSoBalanceForPublicKey(db, nil, m0PkBytes, 840, nil))
+	require.NoError(DbPutDeSoBalanceForPublicKey(db, nil, m1PkBytes, 150, nil))
+	require.NoError(DbPutDeSoBalanceForPublicKey(db, nil, m2PkBytes, 5, nil))
+	require.NoError(index.ConnectBlock(block1, utxoOps1, nil))
+	// Connecting the same block again doesn't record its changes twice.
+	require.NoError(index.ConnectBlock(block1, utxoOps1, nil))
+
+	// In the second block, m1 sends 30 back to m0. The running balances continue from the first block.
+	block2 := makeBlock(2, 1)
+	utxoOps2 := [][]*UtxoOperation{{spendBalance(m1PkBytes, 30), addBalance(m0PkBytes, 30)}, {}}
+	require.NoError(index.ConnectBlock(block2, utxoOps2, nil))
+
+	history, err := index.GetBalanceHistory(m0PkBytes, nil, 10, false)
+	require.NoError(err)
+	require.Len(history, 3)
+	require.Equal([]int64{-110, -50, 30},
+		[]int64{history[0].DeltaNanos, history[1].DeltaNanos, history[2].DeltaNanos})
+	require.Equal([]uint64{890, 840, 870},
+		[]uint64{history[0].BalanceNanos, history[1].BalanceNanos, history[2].BalanceNanos})
+
+	// Pages pick up right after the last entry of the previous one, in either direction.
+	page, err := index.GetBalanceHistory(m0PkBytes, history[0], 1, false)
+	require.NoError(err)
+	require.Equal(history[1:2], page)
+	page, err = index.GetBalanceHistory(m0PkBytes, nil, 2, true)
+	require.NoError(err)
+	require.Equal([]*DeSoBalanceHistoryEntry{history[2], history[1]}, page)
+	_, err = index.GetBalanceHistory(m0PkBytes, nil, MaxDeSoBalanceHistoryEntriesPerQuery+1, false)
+	require.Error(err)
+
+	history, err = index.GetBalanceHistory(m1PkBytes, nil, 10, false)
+	require.NoError(err)
+	require.Equal([]uint64{100, 150, 120},
+		[]uint64{history[0].BalanceNanos, history[1].BalanceNanos, history[2].BalanceNanos})
+
+	// Disconnecting a block removes its entries.
+	block2Hash, err := block2.Hash()
+	require.NoError(err)
+	require.NoError(index.DisconnectBlock(block2Hash))
+	history, err = index.GetBalanceHistory(m1PkBytes, nil, 10, false)
+	require.NoError(err)
+	require.Len(history, 2)
+	require.Equal(uint64(150), history[1].BalanceNanos)
+}
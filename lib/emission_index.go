@@ -0,0 +1,418 @@
+package lib
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// emission_index.go implements an optional index of the DESO each block minted as PoS staking
+// rewards, paid out as creator coin founder rewards, and burned, so that the emission schedule
+// can report them per interval. Like the DESO balance history index, it isn't part of
+// consensus: it's populated from the UtxoOperations of committed blocks, stored under a
+// non-state prefix, and removed again when a block is disconnected.
+//
+// Each block's entry also holds the running totals since the first block the index recorded,
+// so the figures for a range of heights are the difference between the entries at either end
+// of it.
+
+const (
+	EncoderTypeEmissionIndexEntry EncoderType = 6000000
+)
+
+//
+// TYPES: EmissionIndexEntry
+//
+
+type EmissionIndexEntry struct {
+	BlockHash   *BlockHash
+	BlockHeight uint64
+
+	// The DESO this block minted as staking rewards, paid out as DESO founder rewards, and burned.
+	StakingRewardNanos uint64
+	FounderRewardNanos uint64
+	BurnedNanos        uint64
+
+	// The running totals through this block, starting from the first block the index recorded.
+	CumulativeStakingRewardNanos uint64
+	CumulativeFounderRewardNanos uint64
+	CumulativeBurnedNanos        uint64
+}
+
+func (entry *EmissionIndexEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.BlockHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, UintToBuf(entry.StakingRewardNanos)...)
+	data = append(data, UintToBuf(entry.FounderRewardNanos)...)
+	data = append(data, UintToBuf(entry.BurnedNanos)...)
+	data = append(data, UintToBuf(entry.CumulativeStakingRewardNanos)...)
+	data = append(data, UintToBuf(entry.CumulativeFounderRewardNanos)...)
+	data = append(data, UintToBuf(entry.CumulativeBurnedNanos)...)
+	return data
+}
+
+func (entry *EmissionIndexEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	entry.BlockHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading BlockHash: ")
+	}
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading BlockHeight: ")
+	}
+	entry.StakingRewardNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading StakingRewardNanos: ")
+	}
+	entry.FounderRewardNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading FounderRewardNanos: ")
+	}
+	entry.BurnedNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading BurnedNanos: ")
+	}
+	entry.CumulativeStakingRewardNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading CumulativeStakingRewardNanos: ")
+	}
+	entry.CumulativeFounderRewardNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading CumulativeFounderRewardNanos: ")
+	}
+	entry.CumulativeBurnedNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndexEntry.Decode: Problem reading CumulativeBurnedNanos: ")
+	}
+	return nil
+}
+
+func (entry *EmissionIndexEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *EmissionIndexEntry) GetEncoderType() EncoderType {
+	return EncoderTypeEmissionIndexEntry
+}
+
+// GetEmissionForBlock works out what a block minted as staking rewards, paid out as DESO
+// founder rewards, and burned from the block and its UtxoOperations. The running totals of the
+// entry it returns aren't set.
+//
+// Staking rewards include the delegators' share that's accrued on validators' reward indexes
+// rather than paid out. Founder rewards move DESO from the buyer of a creator coin to its
+// creator, so they're reported alongside emission rather than as part of it. Burns are the
+// fees and block reward the block reward txn didn't claim, plus whatever was sent to the burn
+// public key.
+func GetEmissionForBlock(block *MsgDeSoBlock, utxoOpsForBlock [][]*UtxoOperation, params *DeSoParams) (
+	*EmissionIndexEntry, error) {
+
+	blockHash, err := block.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetEmissionForBlock: Problem hashing block: ")
+	}
+	entry := &EmissionIndexEntry{
+		BlockHash:   blockHash,
+		BlockHeight: block.Header.Height,
+	}
+	for _, utxoOpsForTxn := range utxoOpsForBlock {
+		if err = _addEmissionForUtxoOps(entry, utxoOpsForTxn); err != nil {
+			return nil, errors.Wrapf(err, "GetEmissionForBlock: ")
+		}
+	}
+	unclaimedNanos, err := _getUnclaimedFeesAndBlockRewardNanos(block, utxoOpsForBlock, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetEmissionForBlock: ")
+	}
+	if entry.BurnedNanos, err = SafeUint64().Add(entry.BurnedNanos, unclaimedNanos); err != nil {
+		return nil, errors.Wrapf(err, "GetEmissionForBlock: Problem adding unclaimed fees: ")
+	}
+	return entry, nil
+}
+
+// _addEmissionForUtxoOps adds the staking rewards, founder rewards, and burns recorded by a
+// txn's UtxoOperations to the entry, including those of the txns wrapped by an atomic txn.
+func _addEmissionForUtxoOps(entry *EmissionIndexEntry, utxoOps []*UtxoOperation) error {
+	var err error
+	for ii, utxoOp := range utxoOps {
+		switch utxoOp.Type {
+		case OperationTypeStakeDistributionRestake, OperationTypeStakeDistributionAccrue:
+			entry.StakingRewardNanos, err = SafeUint64().Add(entry.StakingRewardNanos, utxoOp.StakeAmountNanosDiff)
+		case OperationTypeStakeDistributionPayToBalance:
+			entry.StakingRewardNanos, err = SafeUint64().Add(entry.StakingRewardNanos, utxoOp.BalanceAmountNanos)
+		case OperationTypeCreatorCoin:
+			// The DESO founder reward is added by the UtxoOperation right before the CreatorCoin one.
+			if utxoOp.FounderRewardUtxoKey != nil && ii > 0 {
+				_, founderRewardNanos := _getAddedDeSoForUtxoOp(utxoOps[ii-1])
+				entry.FounderRewardNanos, err = SafeUint64().Add(entry.FounderRewardNanos, founderRewardNanos)
+			}
+		case OperationTypeSlashValidator:
+			entry.BurnedNanos, err = SafeUint64().Add(entry.BurnedNanos, utxoOp.StakeAmountNanosDiff)
+		case OperationTypeAddBalance, OperationTypeAddUtxo:
+			if publicKey, amountNanos := _getAddedDeSoForUtxoOp(utxoOp); bytes.Equal(publicKey, bitcoinBurnPublicKey) {
+				entry.BurnedNanos, err = SafeUint64().Add(entry.BurnedNanos, amountNanos)
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "_addEmissionForUtxoOps: Problem adding %v: ", utxoOp.Type)
+		}
+		for _, innerUtxoOps := range utxoOp.AtomicTxnsInnerUtxoOps {
+			if err = _addEmissionForUtxoOps(entry, innerUtxoOps); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// _getAddedDeSoForUtxoOp returns the public key and amount of DESO added by an AddBalance or
+// AddUtxo UtxoOperation.
+func _getAddedDeSoForUtxoOp(utxoOp *UtxoOperation) (_publicKey []byte, _amountNanos uint64) {
+	switch utxoOp.Type {
+	case OperationTypeAddBalance:
+		return utxoOp.BalancePublicKey, utxoOp.BalanceAmountNanos
+	case OperationTypeAddUtxo:
+		if utxoOp.Entry != nil {
+			return utxoOp.Entry.PublicKey, utxoOp.Entry.AmountNanos
+		}
+	}
+	return nil, 0
+}
+
+// _getUnclaimedFeesAndBlockRewardNanos returns the part of a block's fees and block reward that
+// its block reward txn didn't claim. Each txn's fee comes from its TxnFeeReceipt, or from its
+// TxnFeeNanos if there isn't one. Before the BalanceModelBlockHeight, txns without a receipt
+// don't record their fee, so zero is returned for blocks that contain them, as well as for the
+// genesis block, which isn't connected like other blocks.
+func _getUnclaimedFeesAndBlockRewardNanos(
+	block *MsgDeSoBlock, utxoOpsForBlock [][]*UtxoOperation, params *DeSoParams) (uint64, error) {
+
+	if block.Header.Height == 0 || len(block.Txns) == 0 {
+		return 0, nil
+	}
+	totalNanos := CalcBlockRewardNanos(uint32(block.Header.Height), params)
+	var err error
+	for txnIndex, txn := range block.Txns {
+		if txn.TxnMeta.GetTxnType() == TxnTypeBlockReward {
+			continue
+		}
+		feeNanos := txn.TxnFeeNanos
+		if txnIndex < len(utxoOpsForBlock) && len(utxoOpsForBlock[txnIndex]) > 0 &&
+			utxoOpsForBlock[txnIndex][len(utxoOpsForBlock[txnIndex])-1].FeeReceipt != nil {
+			feeNanos = utxoOpsForBlock[txnIndex][len(utxoOpsForBlock[txnIndex])-1].FeeReceipt.FeeNanos
+		} else if block.Header.Height < uint64(params.ForkHeights.BalanceModelBlockHeight) {
+			return 0, nil
+		}
+		if totalNanos, err = SafeUint64().Add(totalNanos, feeNanos); err != nil {
+			return 0, errors.Wrapf(err, "_getUnclaimedFeesAndBlockRewardNanos: Problem adding fee: ")
+		}
+	}
+	var claimedNanos uint64
+	for _, output := range block.Txns[0].TxOutputs {
+		if claimedNanos, err = SafeUint64().Add(claimedNanos, output.AmountNanos); err != nil {
+			return 0, errors.Wrapf(err, "_getUnclaimedFeesAndBlockRewardNanos: Problem adding output: ")
+		}
+	}
+	if claimedNanos >= totalNanos {
+		return 0, nil
+	}
+	return totalNanos - claimedNanos, nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForEmissionIndexEntry(blockHeight uint64) []byte {
+	return append(append([]byte{}, Prefixes.PrefixEmissionIndexByHeight...), EncodeUint64(blockHeight)...)
+}
+
+// DBGetEmissionIndexEntryAtOrBeforeHeightWithTxn returns the entry with the greatest height
+// that's at most blockHeight, or nil if there isn't one.
+func DBGetEmissionIndexEntryAtOrBeforeHeightWithTxn(txn *badger.Txn, blockHeight uint64) (
+	*EmissionIndexEntry, error) {
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = Prefixes.PrefixEmissionIndexByHeight
+	opts.Reverse = true
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	iterator.Seek(DBKeyForEmissionIndexEntry(blockHeight))
+	if !iterator.ValidForPrefix(Prefixes.PrefixEmissionIndexByHeight) {
+		return nil, nil
+	}
+	return _decodeEmissionIndexEntry(iterator.Item())
+}
+
+// DBGetFirstEmissionIndexEntryWithTxn returns the entry with the lowest height, or nil if the
+// index is empty.
+func DBGetFirstEmissionIndexEntryWithTxn(txn *badger.Txn) (*EmissionIndexEntry, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = Prefixes.PrefixEmissionIndexByHeight
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	iterator.Seek(Prefixes.PrefixEmissionIndexByHeight)
+	if !iterator.ValidForPrefix(Prefixes.PrefixEmissionIndexByHeight) {
+		return nil, nil
+	}
+	return _decodeEmissionIndexEntry(iterator.Item())
+}
+
+func _decodeEmissionIndexEntry(item *badger.Item) (*EmissionIndexEntry, error) {
+	entryBytes, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem reading emission index entry: ")
+	}
+	entry, err := DecodeDeSoEncoder(&EmissionIndexEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem decoding emission index entry: ")
+	}
+	return entry, nil
+}
+
+//
+// EmissionIndex
+//
+
+// EmissionIndex maintains the emission index in the chain's db. Register HandleBlockCommitted
+// and HandleBlockDisconnected with the EventManager to keep it in sync with the chain.
+type EmissionIndex struct {
+	// mtx serializes connects and disconnects so running totals always continue from the
+	// entry of the block before.
+	mtx    sync.Mutex
+	db     *badger.DB
+	params *DeSoParams
+}
+
+func NewEmissionIndex(db *badger.DB, params *DeSoParams) *EmissionIndex {
+	return &EmissionIndex{db: db, params: params}
+}
+
+func (index *EmissionIndex) HandleBlockCommitted(event *BlockEvent) {
+	utxoOpsForBlock := event.UtxoOps
+	if utxoOpsForBlock == nil {
+		// Blocks attached during a reorg are signaled without their UtxoOperations, but
+		// they've been stored by the time the event fires.
+		blockHash, err := event.Block.Hash()
+		if err != nil {
+			glog.Errorf("EmissionIndex.HandleBlockCommitted: Problem hashing block: %v", err)
+			return
+		}
+		utxoOpsForBlock, err = GetUtxoOperationsForBlock(index.db, nil, blockHash)
+		if err != nil {
+			glog.Errorf("EmissionIndex.HandleBlockCommitted: Problem getting UtxoOps for block %v: %v",
+				blockHash, err)
+			return
+		}
+	}
+	if err := index.ConnectBlock(event.Block, utxoOpsForBlock); err != nil {
+		glog.Errorf("EmissionIndex.HandleBlockCommitted: %v", err)
+	}
+}
+
+func (index *EmissionIndex) HandleBlockDisconnected(event *BlockEvent) {
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		glog.Errorf("EmissionIndex.HandleBlockDisconnected: Problem hashing block: %v", err)
+		return
+	}
+	if err = index.DisconnectBlock(blockHash, event.Block.Header.Height); err != nil {
+		glog.Errorf("EmissionIndex.HandleBlockDisconnected: %v", err)
+	}
+}
+
+// ConnectBlock records what the block minted, paid out, and burned. Its running totals continue
+// from the entry with the greatest height below the block's, and start from zero if there isn't
+// one. An entry left at the block's height by a block that's no longer on the main chain is
+// replaced, and a block that has already been recorded is skipped.
+func (index *EmissionIndex) ConnectBlock(block *MsgDeSoBlock, utxoOpsForBlock [][]*UtxoOperation) error {
+	entry, err := GetEmissionForBlock(block, utxoOpsForBlock, index.params)
+	if err != nil {
+		return errors.Wrapf(err, "EmissionIndex.ConnectBlock: ")
+	}
+
+	index.mtx.Lock()
+	defer index.mtx.Unlock()
+
+	return index.db.Update(func(txn *badger.Txn) error {
+		existingEntry, err := DBGetEmissionIndexEntryAtOrBeforeHeightWithTxn(txn, entry.BlockHeight)
+		if err != nil {
+			return errors.Wrapf(err, "EmissionIndex.ConnectBlock: ")
+		}
+		if existingEntry != nil && existingEntry.BlockHeight == entry.BlockHeight &&
+			existingEntry.BlockHash.IsEqual(entry.BlockHash) {
+			return nil
+		}
+
+		entry.CumulativeStakingRewardNanos = entry.StakingRewardNanos
+		entry.CumulativeFounderRewardNanos = entry.FounderRewardNanos
+		entry.CumulativeBurnedNanos = entry.BurnedNanos
+		if entry.BlockHeight > 0 {
+			prevEntry, err := DBGetEmissionIndexEntryAtOrBeforeHeightWithTxn(txn, entry.BlockHeight-1)
+			if err != nil {
+				return errors.Wrapf(err, "EmissionIndex.ConnectBlock: ")
+			}
+			if prevEntry != nil {
+				entry.CumulativeStakingRewardNanos += prevEntry.CumulativeStakingRewardNanos
+				entry.CumulativeFounderRewardNanos += prevEntry.CumulativeFounderRewardNanos
+				entry.CumulativeBurnedNanos += prevEntry.CumulativeBurnedNanos
+			}
+		}
+		return DBSetWithTxn(txn, nil, DBKeyForEmissionIndexEntry(entry.BlockHeight), EncodeToBytes(0, entry), nil)
+	})
+}
+
+// DisconnectBlock removes the block's entry, if it was recorded.
+func (index *EmissionIndex) DisconnectBlock(blockHash *BlockHash, blockHeight uint64) error {
+	index.mtx.Lock()
+	defer index.mtx.Unlock()
+
+	return index.db.Update(func(txn *badger.Txn) error {
+		entry, err := DBGetEmissionIndexEntryAtOrBeforeHeightWithTxn(txn, blockHeight)
+		if err != nil {
+			return errors.Wrapf(err, "EmissionIndex.DisconnectBlock: ")
+		}
+		if entry == nil || entry.BlockHeight != blockHeight || !entry.BlockHash.IsEqual(blockHash) {
+			return nil
+		}
+		return DBDeleteWithTxn(txn, nil, DBKeyForEmissionIndexEntry(blockHeight), nil, true)
+	})
+}
+
+// GetEntryAtOrBeforeHeight returns the entry with the greatest height that's at most
+// blockHeight, whose running totals cover every block the index recorded through blockHeight.
+// It returns nil if the index has no entries at or before blockHeight.
+func (index *EmissionIndex) GetEntryAtOrBeforeHeight(blockHeight uint64) (*EmissionIndexEntry, error) {
+	var entry *EmissionIndexEntry
+	err := index.db.View(func(txn *badger.Txn) error {
+		var err error
+		entry, err = DBGetEmissionIndexEntryAtOrBeforeHeightWithTxn(txn, blockHeight)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "EmissionIndex.GetEntryAtOrBeforeHeight: ")
+	}
+	return entry, nil
+}
+
+// GetFirstEntry returns the entry of the first block the index recorded, or nil if it's empty.
+func (index *EmissionIndex) GetFirstEntry() (*EmissionIndexEntry, error) {
+	var entry *EmissionIndexEntry
+	err := index.db.View(func(txn *badger.Txn) error {
+		var err error
+		entry, err = DBGetFirstEmissionIndexEntryWithTxn(txn)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "EmissionIndex.GetFirstEntry: ")
+	}
+	return entry, nil
+}
@@ -0,0 +1,147 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmissionIndex(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 11
+	index := NewEmissionIndex(db, &params)
+	burnPkBytes := MustBase58CheckDecode(BurnPubKeyBase58Check)
+
+	makeBlock := func(height uint64, blockRewardNanos uint64, txnFees ...uint64) *MsgDeSoBlock {
+		block := &MsgDeSoBlock{Header: &MsgDeSoHeader{
+			Version:               HeaderVersion1,
+			PrevBlockHash:         &BlockHash{},
+			TransactionMerkleRoot: &BlockHash{},
+			Height:                height,
+		}}
+		block.Txns = append(block.Txns, &MsgDeSoTxn{
+			TxOutputs: []*DeSoOutput{{PublicKey: m0PkBytes, AmountNanos: blockRewardNanos}},
+			TxnMeta:   &BlockRewardMetadataa{},
+		})
+		for _, feeNanos := range txnFees {
+			block.Txns = append(block.Txns, &MsgDeSoTxn{
+				TxnVersion: DeSoTxnVersion1, PublicKey: m1PkBytes, TxnMeta: &BasicTransferMetadata{}, TxnFeeNanos: feeNanos})
+		}
+		return block
+	}
+	addBalance := func(publicKey []byte, amountNanos uint64) *UtxoOperation {
+		return &UtxoOperation{Type: OperationTypeAddBalance, BalancePublicKey: publicKey, BalanceAmountNanos: amountNanos}
+	}
+	stakingRewardOps := func(restakeNanos uint64, payToBalanceNanos uint64, accrueNanos uint64) []*UtxoOperation {
+		return []*UtxoOperation{
+			{Type: OperationTypeStakeDistributionRestake, StakeAmountNanosDiff: restakeNanos},
+			{Type: OperationTypeStakeDistributionPayToBalance, BalancePublicKey: m2PkBytes, BalanceAmountNanos: payToBalanceNanos},
+			{Type: OperationTypeStakeDistributionAccrue, StakeAmountNanosDiff: accrueNanos},
+		}
+	}
+
+	// The PoW block at height 10 pays a 1 DESO block reward. Its txns pay fees of 100 and 40, the
+	// second of which is taken from its fee receipt, and the block reward txn claims all but 40 of
+	// the fees and block reward. The first txn sends 7 to the burn public key, and the second is
+	// an atomic txn that buys a creator coin, paying its creator a founder reward of 50.
+	block1 := makeBlock(10, NanosPerUnit+100, 100, 999)
+	utxoOps1 := [][]*UtxoOperation{
+		{addBalance(m0PkBytes, NanosPerUnit+100)},
+		{addBalance(burnPkBytes, 7)},
+		{{
+			Type: OperationTypeAtomicTxnsWrapper,
+			AtomicTxnsInnerUtxoOps: [][]*UtxoOperation{{
+				addBalance(m2PkBytes, 50),
+				{Type: OperationTypeCreatorCoin, FounderRewardUtxoKey: &UtxoKey{}},
+			}},
+			FeeReceipt: &TxnFeeReceipt{FeeNanos: 40},
+		}},
+		stakingRewardOps(20, 5, 3),
+	}
+	entry, err := GetEmissionForBlock(block1, utxoOps1, &params)
+	require.NoError(err)
+	require.Equal(uint64(28), entry.StakingRewardNanos)
+	require.Equal(uint64(50), entry.FounderRewardNanos)
+	require.Equal(uint64(47), entry.BurnedNanos)
+
+	// Before the balance model, txns without a fee receipt don't record their fee, so only the
+	// DESO sent to the burn public key is counted.
+	utxoModelParams := params
+	utxoModelParams.ForkHeights.BalanceModelBlockHeight = 100
+	entry, err = GetEmissionForBlock(block1, utxoOps1[:2], &utxoModelParams)
+	require.NoError(err)
+	require.Equal(uint64(7), entry.BurnedNanos)
+
+	require.NoError(index.ConnectBlock(block1, utxoOps1))
+	// Connecting the same block again doesn't count it twice.
+	require.NoError(index.ConnectBlock(block1, utxoOps1))
+
+	// The PoS block at height 12 has no block reward, and its block reward txn claims 10 of its
+	// 30 in fees. The running totals continue from the first block.
+	block2 := makeBlock(12, 10, 30)
+	utxoOps2 := [][]*UtxoOperation{{addBalance(m0PkBytes, 10)}, {}, stakingRewardOps(1, 2, 7)}
+	require.NoError(index.ConnectBlock(block2, utxoOps2))
+	entry, err = index.GetEntryAtOrBeforeHeight(12)
+	require.NoError(err)
+	require.Equal(uint64(10), entry.StakingRewardNanos)
+	require.Equal(uint64(20), entry.BurnedNanos)
+	require.Equal(uint64(38), entry.CumulativeStakingRewardNanos)
+	require.Equal(uint64(50), entry.CumulativeFounderRewardNanos)
+	require.Equal(uint64(67), entry.CumulativeBurnedNanos)
+
+	// Lookups return the nearest entry at or before the height.
+	entry, err = index.GetEntryAtOrBeforeHeight(11)
+	require.NoError(err)
+	require.Equal(uint64(10), entry.BlockHeight)
+	entry, err = index.GetEntryAtOrBeforeHeight(9)
+	require.NoError(err)
+	require.Nil(entry)
+	entry, err = index.GetFirstEntry()
+	require.NoError(err)
+	require.Equal(uint64(10), entry.BlockHeight)
+
+	// The emission schedule splits the figures at the PoS cutover.
+	schedule, err := GetEmissionSchedule(&params, 12, 0)
+	require.NoError(err)
+	require.NoError(schedule.AddEmissionIndexFigures(index))
+	require.True(schedule.IsEmissionIndexed)
+	require.Equal(uint64(10), schedule.EmissionIndexStartHeight)
+	require.Equal(uint64(11), schedule.Intervals[0].EndBlockHeight)
+	require.Equal([]uint64{28, 10}, []uint64{schedule.Intervals[0].StakingRewardNanos, schedule.Intervals[1].StakingRewardNanos})
+	require.Equal([]uint64{50, 0}, []uint64{schedule.Intervals[0].FounderRewardNanos, schedule.Intervals[1].FounderRewardNanos})
+	require.Equal([]uint64{47, 20}, []uint64{schedule.Intervals[0].BurnedNanos, schedule.Intervals[1].BurnedNanos})
+	require.Equal(uint64(38), schedule.TotalStakingRewardNanos)
+	require.Equal(uint64(50), schedule.TotalFounderRewardNanos)
+	require.Equal(uint64(67), schedule.TotalBurnedNanos)
+
+	// A different block at height 12 replaces the one that's no longer on the main chain, and
+	// disconnecting a block that isn't the one recorded at its height does nothing.
+	block2b := makeBlock(12, 0)
+	block2b.Header.TstampNanoSecs = SecondsToNanoSeconds(1)
+	require.NoError(index.ConnectBlock(block2b, [][]*UtxoOperation{{addBalance(m0PkBytes, 0)}, stakingRewardOps(0, 0, 4)}))
+	entry, err = index.GetEntryAtOrBeforeHeight(12)
+	require.NoError(err)
+	require.Equal(uint64(32), entry.CumulativeStakingRewardNanos)
+	require.Equal(uint64(47), entry.CumulativeBurnedNanos)
+	block2Hash, err := block2.Hash()
+	require.NoError(err)
+	require.NoError(index.DisconnectBlock(block2Hash, 12))
+	entry, err = index.GetEntryAtOrBeforeHeight(12)
+	require.NoError(err)
+	require.Equal(uint64(12), entry.BlockHeight)
+
+	// Disconnecting the recorded block removes its entry.
+	block2bHash, err := block2b.Hash()
+	require.NoError(err)
+	require.NoError(index.DisconnectBlock(block2bHash, 12))
+	entry, err = index.GetEntryAtOrBeforeHeight(12)
+	require.NoError(err)
+	require.Equal(uint64(10), entry.BlockHeight)
+}
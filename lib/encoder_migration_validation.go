@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+// Dual-encode validation catches encoder migration bugs on live data before they
+// corrupt state. Within a window of blocks around each encoder migration, every entry
+// that is encoded is also encoded at the versions just before and at the migration,
+// and we check that the two encodings are equivalent: the new encoding must decode to
+// an entry that re-encodes to exactly the old encoding, and both encodings must
+// round-trip. Starting the window before the migration height means a bug shows up
+// while the old encoding is still the one being written to the db.
+
+// dualEncodeValidationFailures counts the mismatches found since validation was enabled.
+var dualEncodeValidationFailures uint64
+
+// EnableDualEncodeValidation wraps EncodeToBytesImpl so that entries encoded within
+// windowBlocks of an encoder migration in params are validated. Mismatches are logged.
+func EnableDualEncodeValidation(params *DeSoParams, windowBlocks uint64) {
+	baseEncodeToBytes := EncodeToBytesImpl
+	EncodeToBytesImpl = func(blockHeight uint64, encoder DeSoEncoder, skipMetadata ...bool) []byte {
+		encodingBytes := baseEncodeToBytes(blockHeight, encoder, skipMetadata...)
+		// Checksum encodings skip metadata, and can't be decoded on their own.
+		if len(skipMetadata) > 0 && skipMetadata[0] {
+			return encodingBytes
+		}
+		migration := getEncoderMigrationInWindow(params, blockHeight, windowBlocks)
+		if migration == nil {
+			return encodingBytes
+		}
+		if err := ValidateDualEncoding(encoder, migration.Height-1, migration.Height); err != nil {
+			atomic.AddUint64(&dualEncodeValidationFailures, 1)
+			glog.Errorf("EncodeToBytes: Dual-encode validation failed for migration %v at block height %d: %v",
+				migration.Name, blockHeight, err)
+		}
+		return encodingBytes
+	}
+}
+
+// DisableDualEncodeValidation restores the default EncodeToBytesImpl.
+func DisableDualEncodeValidation() {
+	EncodeToBytesImpl = encodeToBytes
+}
+
+// GetDualEncodeValidationFailures returns the number of mismatches found by dual-encode validation.
+func GetDualEncodeValidationFailures() uint64 {
+	return atomic.LoadUint64(&dualEncodeValidationFailures)
+}
+
+// getEncoderMigrationInWindow returns the migration whose window contains blockHeight, or
+// nil if there isn't one. Migrations that aren't scheduled yet are skipped.
+func getEncoderMigrationInWindow(params *DeSoParams, blockHeight uint64, windowBlocks uint64) *MigrationHeight {
+	for _, migration := range params.EncoderMigrationHeightsList {
+		if migration.Height == 0 || migration.Height >= math.MaxUint32 {
+			continue
+		}
+		if blockHeight+windowBlocks >= migration.Height && blockHeight < migration.Height+windowBlocks {
+			return migration
+		}
+	}
+	return nil
+}
+
+// ValidateDualEncoding checks that encoding an entry at oldBlockHeight and at
+// newBlockHeight produces equivalent encodings. Entries whose version doesn't change
+// between the two heights are trivially valid.
+func ValidateDualEncoding(encoder DeSoEncoder, oldBlockHeight uint64, newBlockHeight uint64) error {
+	if encoder == nil || reflect.ValueOf(encoder).IsNil() {
+		return nil
+	}
+	if encoder.GetVersionByte(oldBlockHeight) == encoder.GetVersionByte(newBlockHeight) {
+		return nil
+	}
+
+	oldBytes := encodeToBytes(oldBlockHeight, encoder)
+	newBytes := encodeToBytes(newBlockHeight, encoder)
+
+	oldEntry, err := decodeIntoNewEncoder(encoder, oldBytes)
+	if err != nil {
+		return fmt.Errorf("ValidateDualEncoding: Problem decoding old encoding of %v: %v",
+			encoder.GetEncoderType(), err)
+	}
+	newEntry, err := decodeIntoNewEncoder(encoder, newBytes)
+	if err != nil {
+		return fmt.Errorf("ValidateDualEncoding: Problem decoding new encoding of %v: %v",
+			encoder.GetEncoderType(), err)
+	}
+
+	if reEncodedBytes := encodeToBytes(oldBlockHeight, oldEntry); !bytes.Equal(oldBytes, reEncodedBytes) {
+		return fmt.Errorf("ValidateDualEncoding: Old encoding of %v doesn't round-trip: (%v) vs (%v)",
+			encoder.GetEncoderType(), hex.EncodeToString(oldBytes), hex.EncodeToString(reEncodedBytes))
+	}
+	if reEncodedBytes := encodeToBytes(newBlockHeight, newEntry); !bytes.Equal(newBytes, reEncodedBytes) {
+		return fmt.Errorf("ValidateDualEncoding: New encoding of %v doesn't round-trip: (%v) vs (%v)",
+			encoder.GetEncoderType(), hex.EncodeToString(newBytes), hex.EncodeToString(reEncodedBytes))
+	}
+	if reEncodedBytes := encodeToBytes(oldBlockHeight, newEntry); !bytes.Equal(oldBytes, reEncodedBytes) {
+		return fmt.Errorf("ValidateDualEncoding: New encoding of %v loses data from the old encoding: "+
+			"(%v) vs (%v)", encoder.GetEncoderType(), hex.EncodeToString(oldBytes),
+			hex.EncodeToString(reEncodedBytes))
+	}
+	return nil
+}
+
+// decodeIntoNewEncoder decodes encodingBytes into a fresh instance of encoder's type.
+func decodeIntoNewEncoder(encoder DeSoEncoder, encodingBytes []byte) (DeSoEncoder, error) {
+	newEncoder, ok := reflect.New(reflect.TypeOf(encoder).Elem()).Interface().(DeSoEncoder)
+	if !ok {
+		return nil, fmt.Errorf("decodeIntoNewEncoder: Type %T isn't a DeSoEncoder", encoder)
+	}
+	if _, err := decodeFromBytes(newEncoder, bytes.NewReader(encodingBytes)); err != nil {
+		return nil, err
+	}
+	return newEncoder, nil
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// dualEncodeTestEntry adds a field under ValidatorPerformanceTrackingMigration. When
+// dropFieldBug is set, its new encoding mistakenly drops the original field.
+type dualEncodeTestEntry struct {
+	OriginalField uint64
+	NewField      uint64
+	dropFieldBug  bool
+}
+
+func (entry *dualEncodeTestEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	migrated := MigrationTriggered(blockHeight, ValidatorPerformanceTrackingMigration)
+	if !migrated || !entry.dropFieldBug {
+		data = append(data, UintToBuf(entry.OriginalField)...)
+	}
+	if migrated {
+		data = append(data, UintToBuf(entry.NewField)...)
+	}
+	return data
+}
+
+func (entry *dualEncodeTestEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+	entry.OriginalField, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "dualEncodeTestEntry.Decode: Problem reading OriginalField: ")
+	}
+	if MigrationTriggered(blockHeight, ValidatorPerformanceTrackingMigration) {
+		entry.NewField, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "dualEncodeTestEntry.Decode: Problem reading NewField: ")
+		}
+	}
+	return nil
+}
+
+func (entry *dualEncodeTestEntry) GetVersionByte(blockHeight uint64) byte {
+	return GetMigrationVersion(blockHeight, ValidatorPerformanceTrackingMigration)
+}
+
+func (entry *dualEncodeTestEntry) GetEncoderType() EncoderType {
+	return EncoderTypeEndBlockView
+}
+
+func TestDualEncodeValidation(t *testing.T) {
+	params := DeSoTestnetParams
+	params.ForkHeights.ValidatorPerformanceTrackingBlockHeight = 1000
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+
+	// Only heights within the window around the migration are validated.
+	require.Nil(t, getEncoderMigrationInWindow(&params, 989, 10))
+	migration := getEncoderMigrationInWindow(&params, 990, 10)
+	require.NotNil(t, migration)
+	require.Equal(t, ValidatorPerformanceTrackingMigration, migration.Name)
+	require.NotNil(t, getEncoderMigrationInWindow(&params, 1009, 10))
+	require.Nil(t, getEncoderMigrationInWindow(&params, 1010, 10))
+
+	// A correct migration passes, and so do encoders the migration doesn't affect.
+	require.NoError(t, ValidateDualEncoding(&dualEncodeTestEntry{OriginalField: 5, NewField: 7}, 999, 1000))
+	require.NoError(t, ValidateDualEncoding(&TxnFeeReceipt{FeeNanos: 5}, 999, 1000))
+
+	// A migration that drops data is caught.
+	err := ValidateDualEncoding(&dualEncodeTestEntry{OriginalField: 5, NewField: 7, dropFieldBug: true}, 999, 1000)
+	require.Error(t, err)
+
+	// Once enabled, encoding within the window counts failures without changing the encoding.
+	EnableDualEncodeValidation(&params, 10)
+	defer DisableDualEncodeValidation()
+	failuresBefore := GetDualEncodeValidationFailures()
+	buggyEntry := &dualEncodeTestEntry{OriginalField: 5, NewField: 7, dropFieldBug: true}
+	require.Equal(t, encodeToBytes(995, buggyEntry), EncodeToBytes(995, buggyEntry))
+	require.Equal(t, failuresBefore+1, GetDualEncodeValidationFailures())
+	EncodeToBytes(500, buggyEntry)
+	require.Equal(t, failuresBefore+1, GetDualEncodeValidationFailures())
+}
@@ -47,6 +47,7 @@ const (
 	RuleErrorProfileUsernameExists                RuleError = "RuleErrorProfileUsernameExists"
 	RuleErrorPubKeyLen                            RuleError = "RuleErrorPubKeyLen"
 	RuleErrorMaxProfilePicSize                    RuleError = "RuleErrorMaxProfilePicSize"
+	RuleErrorProfilePicBlobReferenceNotAllowed    RuleError = "RuleErrorProfilePicBlobReferenceNotAllowed"
 	RuleErrorProfileCreatorPercentageSize         RuleError = "RuleErrorProfileCreatorPercentageSize"
 	RuleErrorProfileStakeMultipleSize             RuleError = "RuleErrorProfileStakeMultipleSize"
 	RuleErrorInvalidUsername                      RuleError = "RuleErrorInvalidUsername"
@@ -225,6 +226,13 @@ const (
 	RuleErrorMaxNonceExpirationBlockHeightOffsetTooLow         RuleError = "RuleErrorMaxNonceExpirationBlockHeightOffsetTooLow"
 	RuleErrorMaxNonceExpirationBlockHeightOffsetTooHigh        RuleError = "RuleErrorMaxNonceExpirationBlockHeightOffsetTooHigh"
 	RuleErrorForbiddenPubKeyLength                             RuleError = "RuleErrorForbiddenPubKeyLength"
+	RuleErrorBlockProducerRegistryPubKeyLength                 RuleError = "RuleErrorBlockProducerRegistryPubKeyLength"
+	RuleErrorBlockProducerRegistryBeforeBlockHeight            RuleError = "RuleErrorBlockProducerRegistryBeforeBlockHeight"
+	RuleErrorBlockProducerTagInvalidLength                     RuleError = "RuleErrorBlockProducerTagInvalidLength"
+	RuleErrorBlockProducerAttestationIncomplete                RuleError = "RuleErrorBlockProducerAttestationIncomplete"
+	RuleErrorBlockProducerAttestationInvalidPublicKey          RuleError = "RuleErrorBlockProducerAttestationInvalidPublicKey"
+	RuleErrorBlockProducerAttestationInvalidSignature          RuleError = "RuleErrorBlockProducerAttestationInvalidSignature"
+	RuleErrorBlockProducerTagDoesNotMatchRegistry              RuleError = "RuleErrorBlockProducerTagDoesNotMatchRegistry"
 	RuleErrorUserNotAuthorizedToUpdateExchangeRate             RuleError = "RuleErrorUserNotAuthorizedToUpdateExchangeRate"
 	RuleErrorUserNotAuthorizedToUpdateGlobalParams             RuleError = "RuleErrorUserNotAuthorizedToUpdateGlobalParams"
 	RuleErrorUserOutputMustBeNonzero                           RuleError = "RuleErrorUserOutputMustBeNonzero"
@@ -238,10 +246,18 @@ const (
 	RuleErrorMaxTxnSizeBytesTooHigh                            RuleError = "RuleErrorMaxTxnSizeBytesTooHigh"
 	RuleErrorMaxTxnSizeBytesExceedsMaxBlockSizeBytes           RuleError = "RuleErrorMaxTxnSizeBytesExceedsMaxBlockSizeBytes"
 	RuleErrorFeeBucketSizeTooSmall                             RuleError = "RuleErrorFeeBucketSizeTooSmall"
+	RuleErrorBlockTimestampDriftNanoSecsTooHigh                RuleError = "RuleErrorBlockTimestampDriftNanoSecsTooHigh"
 	RuleErrorBlockProductionIntervalPoSTooLow                  RuleError = "RuleErrorBlockProductionIntervalPoSTooLow"
 	RuleErrorBlockProductionIntervalPoSTooHigh                 RuleError = "RuleErrorBlockProductionIntervalPoSTooHigh"
 	RuleErrorTimeoutIntervalPoSTooLow                          RuleError = "RuleErrorTimeoutIntervalPoSTooLow"
 	RuleErrorTimeoutIntervalPoSTooHigh                         RuleError = "RuleErrorTimeoutIntervalPoSTooHigh"
+	RuleErrorJailMissedSlotsThresholdTooLow                    RuleError = "RuleErrorJailMissedSlotsThresholdTooLow"
+	RuleErrorJailMissedSlotsThresholdBeforeBlockHeight         RuleError = "RuleErrorJailMissedSlotsThresholdBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderTradingFeesBeforeBlockHeight     RuleError = "RuleErrorDAOCoinLimitOrderTradingFeesBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderFeeBasisPointsTooHigh            RuleError = "RuleErrorDAOCoinLimitOrderFeeBasisPointsTooHigh"
+	RuleErrorDAOCoinLimitOrderFeeRecipientPubKeyLength         RuleError = "RuleErrorDAOCoinLimitOrderFeeRecipientPubKeyLength"
+	RuleErrorValidatorSlashBasisPointsBeforeBlockHeight        RuleError = "RuleErrorValidatorSlashBasisPointsBeforeBlockHeight"
+	RuleErrorValidatorSlashBasisPointsTooHigh                  RuleError = "RuleErrorValidatorSlashBasisPointsTooHigh"
 
 	// DeSo Diamonds
 	RuleErrorBasicTransferHasDiamondPostHashWithoutDiamondLevel   RuleError = "RuleErrorBasicTransferHasDiamondPostHashWithoutDiamondLevel"
@@ -317,6 +333,27 @@ const (
 	RuleErrorDAOCoinCannotUpdateRestrictionStatusIfStatusIsPermanentlyUnrestricted RuleError = "RuleErrorDAOCoinCannotUpdateRestrictionStatusIfStatusIsPermanentlyUnrestricted"
 	RuleErrorDAOCoinCannotUpdateTransferRestrictionStatusToCurrentStatus           RuleError = "RuleErrorDAOCoinCannotUpdateTransferRestrictionStatusToCurrentStatus"
 
+	// DAO Coin Decimals
+	RuleErrorDAOCoinDecimalsBeforeBlockHeight             RuleError = "RuleErrorDAOCoinDecimalsBeforeBlockHeight"
+	RuleErrorOnlyProfileOwnerCanUpdateDAOCoinDecimals     RuleError = "RuleErrorOnlyProfileOwnerCanUpdateDAOCoinDecimals"
+	RuleErrorDAOCoinInvalidDecimals                       RuleError = "RuleErrorDAOCoinInvalidDecimals"
+	RuleErrorDAOCoinCannotUpdateDecimalsToCurrentDecimals RuleError = "RuleErrorDAOCoinCannotUpdateDecimalsToCurrentDecimals"
+
+	// DAO Coin Limit Order Restrictions
+	RuleErrorDAOCoinLimitOrderRestrictionBeforeBlockHeight         RuleError = "RuleErrorDAOCoinLimitOrderRestrictionBeforeBlockHeight"
+	RuleErrorOnlyProfileOwnerCanUpdateDAOCoinLimitOrderRestriction RuleError = "RuleErrorOnlyProfileOwnerCanUpdateDAOCoinLimitOrderRestriction"
+	RuleErrorDAOCoinInvalidLimitOrderRestriction                   RuleError = "RuleErrorDAOCoinInvalidLimitOrderRestriction"
+	RuleErrorDAOCoinCannotUpdateLimitOrderRestrictionToCurrent     RuleError = "RuleErrorDAOCoinCannotUpdateLimitOrderRestrictionToCurrent"
+	RuleErrorDAOCoinLimitOrderTradingDisabled                      RuleError = "RuleErrorDAOCoinLimitOrderTradingDisabled"
+
+	// DAO Coin Metadata
+	RuleErrorDAOCoinMetadataBeforeBlockHeight         RuleError = "RuleErrorDAOCoinMetadataBeforeBlockHeight"
+	RuleErrorOnlyProfileOwnerCanUpdateDAOCoinMetadata RuleError = "RuleErrorOnlyProfileOwnerCanUpdateDAOCoinMetadata"
+	RuleErrorDAOCoinMetadataIconHashTooLong           RuleError = "RuleErrorDAOCoinMetadataIconHashTooLong"
+	RuleErrorDAOCoinMetadataDescriptionTooLong        RuleError = "RuleErrorDAOCoinMetadataDescriptionTooLong"
+	RuleErrorDAOCoinMetadataTooManyLinks              RuleError = "RuleErrorDAOCoinMetadataTooManyLinks"
+	RuleErrorDAOCoinMetadataInvalidLink               RuleError = "RuleErrorDAOCoinMetadataInvalidLink"
+
 	// DAO Coin Limit Orders
 	RuleErrorDAOCoinLimitOrderBeforeBlockHeight                       RuleError = "RuleErrorDAOCoinLimitOrderBeforeBlockHeight"
 	RuleErrorDAOCoinLimitOrderInvalidTransactorPKID                   RuleError = "RuleErrorDAOCoinLimitOrderInvalidTransactorPKID"
@@ -351,6 +388,34 @@ const (
 	RuleErrorDAOCoinLimitOrderTotalInputMinusTotalOutputNotEqualToFee RuleError = "RuleErrorDAOCoinLimitOrderTotalInputMinusTotalOutputNotEqualToFee"
 	RuleErrorDAOCoinLimitOrderInvalidFillType                         RuleError = "RuleErrorDAOCoinLimitOrderInvalidFillType"
 	RuleErrorDAOCoinLimitOrderFillOrKillOrderUnfulfilled              RuleError = "RuleErrorDAOCoinLimitOrderFillOrKillOrderUnfulfilled"
+	RuleErrorDAOCoinLimitOrderExpirationBeforeBlockHeight             RuleError = "RuleErrorDAOCoinLimitOrderExpirationBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderExpirationBlockHeightNotInFuture        RuleError = "RuleErrorDAOCoinLimitOrderExpirationBlockHeightNotInFuture"
+	RuleErrorDAOCoinLimitOrderExpirationRequiresGoodTillCancelled     RuleError = "RuleErrorDAOCoinLimitOrderExpirationRequiresGoodTillCancelled"
+	RuleErrorDAOCoinLimitOrderMaxSlippageBeforeBlockHeight            RuleError = "RuleErrorDAOCoinLimitOrderMaxSlippageBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderMaxSlippageRequiresMarketOrder          RuleError = "RuleErrorDAOCoinLimitOrderMaxSlippageRequiresMarketOrder"
+	RuleErrorDAOCoinLimitOrderInvalidMaxSlippageScaledPrice           RuleError = "RuleErrorDAOCoinLimitOrderInvalidMaxSlippageScaledPrice"
+	RuleErrorDAOCoinLimitOrderMaxSlippageExceeded                     RuleError = "RuleErrorDAOCoinLimitOrderMaxSlippageExceeded"
+	RuleErrorDAOCoinLimitOrderStopLimitBeforeBlockHeight              RuleError = "RuleErrorDAOCoinLimitOrderStopLimitBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderStopLimitRequiresGoodTillCancelled      RuleError = "RuleErrorDAOCoinLimitOrderStopLimitRequiresGoodTillCancelled"
+	RuleErrorDAOCoinLimitOrderInvalidStopTriggerScaledPrice           RuleError = "RuleErrorDAOCoinLimitOrderInvalidStopTriggerScaledPrice"
+	RuleErrorDAOCoinLimitOrderMinFillQuantityBeforeBlockHeight        RuleError = "RuleErrorDAOCoinLimitOrderMinFillQuantityBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderInvalidMinQuantityToFill                RuleError = "RuleErrorDAOCoinLimitOrderInvalidMinQuantityToFill"
+	RuleErrorDAOCoinLimitOrderQuantityDenominationBeforeBlockHeight   RuleError = "RuleErrorDAOCoinLimitOrderQuantityDenominationBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderInvalidQuantityDenomination             RuleError = "RuleErrorDAOCoinLimitOrderInvalidQuantityDenomination"
+	RuleErrorDAOCoinLimitOrderPostOnlyBeforeBlockHeight               RuleError = "RuleErrorDAOCoinLimitOrderPostOnlyBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderPostOnlyWouldCross                      RuleError = "RuleErrorDAOCoinLimitOrderPostOnlyWouldCross"
+	RuleErrorDAOCoinLimitOrderBatchBeforeBlockHeight                  RuleError = "RuleErrorDAOCoinLimitOrderBatchBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderBatchEmpty                              RuleError = "RuleErrorDAOCoinLimitOrderBatchEmpty"
+	RuleErrorDAOCoinLimitOrderBatchTooManyOrders                      RuleError = "RuleErrorDAOCoinLimitOrderBatchTooManyOrders"
+	RuleErrorDAOCoinLimitOrderBatchInvalidOrder                       RuleError = "RuleErrorDAOCoinLimitOrderBatchInvalidOrder"
+	RuleErrorDAOCoinLimitOrderCancelAllBeforeBlockHeight              RuleError = "RuleErrorDAOCoinLimitOrderCancelAllBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderInvalidCancelAll                        RuleError = "RuleErrorDAOCoinLimitOrderInvalidCancelAll"
+	RuleErrorDAOCoinLimitOrderReplaceBeforeBlockHeight                RuleError = "RuleErrorDAOCoinLimitOrderReplaceBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderReplaceRequiresCancelOrderID            RuleError = "RuleErrorDAOCoinLimitOrderReplaceRequiresCancelOrderID"
+	RuleErrorDAOCoinLimitOrderCreatorCoinsBeforeBlockHeight           RuleError = "RuleErrorDAOCoinLimitOrderCreatorCoinsBeforeBlockHeight"
+	RuleErrorDAOCoinLimitOrderCreatorCoinCannotBeDESO                 RuleError = "RuleErrorDAOCoinLimitOrderCreatorCoinCannotBeDESO"
+	RuleErrorDAOCoinLimitOrderCreatorCoinStopLimitNotSupported        RuleError = "RuleErrorDAOCoinLimitOrderCreatorCoinStopLimitNotSupported"
+	RuleErrorDAOCoinLimitOrderMatchingOrderDifferentCoinTypes         RuleError = "RuleErrorDAOCoinLimitOrderMatchingOrderDifferentCoinTypes"
 
 	// Derived Keys
 	RuleErrorAuthorizeDerivedKeyAccessSignatureNotValid RuleError = "RuleErrorAuthorizeDerivedKeyAccessSignatureNotValid"
@@ -367,6 +432,11 @@ const (
 	RuleErrorUnlimitedDerivedKeyBeforeBlockHeight       RuleError = "RuleErrorUnlimitedDerivedKeyBeforeBlockHeight"
 	RuleErrorUnlimitedDerivedKeyNonEmptySpendingLimits  RuleError = "RuleErrorUnlimitedDerivedKeyNonEmptySpendingLimits"
 
+	RuleErrorAuthorizeDerivedKeyExtendBeforeBlockHeight      RuleError = "RuleErrorAuthorizeDerivedKeyExtendBeforeBlockHeight"
+	RuleErrorAuthorizeDerivedKeyExtendNonExistentDerivedKey  RuleError = "RuleErrorAuthorizeDerivedKeyExtendNonExistentDerivedKey"
+	RuleErrorAuthorizeDerivedKeyExtendMustIncreaseExpiration RuleError = "RuleErrorAuthorizeDerivedKeyExtendMustIncreaseExpiration"
+	RuleErrorAuthorizeDerivedKeyExtendCannotSetSpendingLimit RuleError = "RuleErrorAuthorizeDerivedKeyExtendCannotSetSpendingLimit"
+
 	// Messages
 	RuleErrorMessagingPublicKeyCannotBeOwnerKey     RuleError = "RuleErrorMessagingPublicKeyCannotBeOwnerKey"
 	RuleErrorMessagingSignatureInvalid              RuleError = "RuleErrorMessagingSignatureInvalid"
@@ -481,6 +551,13 @@ const (
 	RuleErrorDerivedKeyCoinLockupOperationNotAuthorized      RuleError = "RuleErrorDerivedKeyCoinLockupOperationNotAuthorized"
 	RuleErrorDerivedKeyCoinLockupOperationInvalidProfilePKID RuleError = "RuleErrorDerivedKeyCoinLockupOperationInvalidProfilePKID"
 	RuleErrorDerivedKeyUpdateCoinLockupParamsIsNoOp          RuleError = "RuleErrorDerivedKeyUpdateCoinLockupParamsIsNoOp"
+	RuleErrorDerivedKeyDAOCoinTransferExceedsAmountLimit     RuleError = "RuleErrorDerivedKeyDAOCoinTransferExceedsAmountLimit"
+	RuleErrorDerivedKeyCreatorCoinSpendExceedsAmountLimit    RuleError = "RuleErrorDerivedKeyCreatorCoinSpendExceedsAmountLimit"
+	RuleErrorDerivedKeyRecipientNotWhitelisted               RuleError = "RuleErrorDerivedKeyRecipientNotWhitelisted"
+	RuleErrorDerivedKeyRecipientWhitelistCannotBeEmptied     RuleError = "RuleErrorDerivedKeyRecipientWhitelistCannotBeEmptied"
+	RuleErrorDerivedKeyGovernanceOperationNotAuthorized      RuleError = "RuleErrorDerivedKeyGovernanceOperationNotAuthorized"
+	RuleErrorDerivedKeyNonceMismatch                         RuleError = "RuleErrorDerivedKeyNonceMismatch"
+	RuleErrorDerivedKeyInvalidNonce                          RuleError = "RuleErrorDerivedKeyInvalidNonce"
 
 	// Association Errors
 	RuleErrorAssociationBeforeBlockHeight     RuleError = "RuleErrorAssociationBeforeBlockHeight"
@@ -569,6 +646,202 @@ const (
 	RuleErrorAtomicTxnsHasNonAtomicInnerTxn                  RuleError = "RuleErrorAtomicTxnsHasNonAtomicInnerTxn"
 	RuleErrorAtomicTxnsHasBrokenChain                        RuleError = "RuleErrorAtomicTxnsHasBrokenChain"
 
+	// External Header Anchoring
+	RuleErrorAnchorExternalHeadersBeforeBlockHeight RuleError = "RuleErrorAnchorExternalHeadersBeforeBlockHeight"
+	RuleErrorExternalHeaderRelayerNotRegistered     RuleError = "RuleErrorExternalHeaderRelayerNotRegistered"
+	RuleErrorExternalHeaderRelayerPubKeyLength      RuleError = "RuleErrorExternalHeaderRelayerPubKeyLength"
+	RuleErrorExternalHeaderInvalidChain             RuleError = "RuleErrorExternalHeaderInvalidChain"
+	RuleErrorExternalHeadersInvalidCount            RuleError = "RuleErrorExternalHeadersInvalidCount"
+	RuleErrorExternalHeaderTooLong                  RuleError = "RuleErrorExternalHeaderTooLong"
+	RuleErrorExternalHeaderMalformed                RuleError = "RuleErrorExternalHeaderMalformed"
+	RuleErrorExternalHeaderInsufficientWork         RuleError = "RuleErrorExternalHeaderInsufficientWork"
+	RuleErrorExternalHeaderAlreadyAnchored          RuleError = "RuleErrorExternalHeaderAlreadyAnchored"
+	RuleErrorExternalHeaderParentNotAnchored        RuleError = "RuleErrorExternalHeaderParentNotAnchored"
+	RuleErrorExternalHeaderHeightMismatch           RuleError = "RuleErrorExternalHeaderHeightMismatch"
+	RuleErrorExternalHeaderTimestampTooEarly        RuleError = "RuleErrorExternalHeaderTimestampTooEarly"
+
+	// Exchange Rate Feed
+	RuleErrorExchangeRateFeedBeforeBlockHeight    RuleError = "RuleErrorExchangeRateFeedBeforeBlockHeight"
+	RuleErrorExchangeRateFeedPubKeyLength         RuleError = "RuleErrorExchangeRateFeedPubKeyLength"
+	RuleErrorExchangeRateFeedMaxAgeBlocksTooLow   RuleError = "RuleErrorExchangeRateFeedMaxAgeBlocksTooLow"
+	RuleErrorExchangeRateFeedMaxDeviationTooHigh  RuleError = "RuleErrorExchangeRateFeedMaxDeviationTooHigh"
+	RuleErrorExchangeRateFeedMinSubmissionsTooLow RuleError = "RuleErrorExchangeRateFeedMinSubmissionsTooLow"
+
+	// Multisig
+	RuleErrorRegisterMultisigBeforeBlockHeight     RuleError = "RuleErrorRegisterMultisigBeforeBlockHeight"
+	RuleErrorRegisterMultisigMustBeSignedByOwner   RuleError = "RuleErrorRegisterMultisigMustBeSignedByOwner"
+	RuleErrorMultisigInvalidCoSignerPublicKey      RuleError = "RuleErrorMultisigInvalidCoSignerPublicKey"
+	RuleErrorMultisigDuplicateCoSigner             RuleError = "RuleErrorMultisigDuplicateCoSigner"
+	RuleErrorMultisigTooManyCoSigners              RuleError = "RuleErrorMultisigTooManyCoSigners"
+	RuleErrorMultisigInvalidThreshold              RuleError = "RuleErrorMultisigInvalidThreshold"
+	RuleErrorMultisigSignaturesBeforeBlockHeight   RuleError = "RuleErrorMultisigSignaturesBeforeBlockHeight"
+	RuleErrorMultisigSignaturesWithoutRegistration RuleError = "RuleErrorMultisigSignaturesWithoutRegistration"
+	RuleErrorMultisigSignerNotCoSigner             RuleError = "RuleErrorMultisigSignerNotCoSigner"
+	RuleErrorMultisigDuplicateSignature            RuleError = "RuleErrorMultisigDuplicateSignature"
+	RuleErrorMultisigInvalidSignature              RuleError = "RuleErrorMultisigInvalidSignature"
+	RuleErrorMultisigInsufficientSignatures        RuleError = "RuleErrorMultisigInsufficientSignatures"
+	RuleErrorMultisigTooManySignatures             RuleError = "RuleErrorMultisigTooManySignatures"
+	RuleErrorMultisigSignaturesNotSorted           RuleError = "RuleErrorMultisigSignaturesNotSorted"
+	RuleErrorMultisigNonCanonicalSignature         RuleError = "RuleErrorMultisigNonCanonicalSignature"
+
+	// DAO Coin Streams
+	RuleErrorDAOCoinStreamBeforeBlockHeight       RuleError = "RuleErrorDAOCoinStreamBeforeBlockHeight"
+	RuleErrorDAOCoinStreamInvalidOperationType    RuleError = "RuleErrorDAOCoinStreamInvalidOperationType"
+	RuleErrorDAOCoinStreamInvalidProfilePublicKey RuleError = "RuleErrorDAOCoinStreamInvalidProfilePublicKey"
+	RuleErrorDAOCoinStreamOnNonexistentProfile    RuleError = "RuleErrorDAOCoinStreamOnNonexistentProfile"
+	RuleErrorDAOCoinStreamInvalidPayeePublicKey   RuleError = "RuleErrorDAOCoinStreamInvalidPayeePublicKey"
+	RuleErrorDAOCoinStreamCannotStreamToSelf      RuleError = "RuleErrorDAOCoinStreamCannotStreamToSelf"
+	RuleErrorDAOCoinStreamInvalidRate             RuleError = "RuleErrorDAOCoinStreamInvalidRate"
+	RuleErrorDAOCoinStreamInvalidBlockHeights     RuleError = "RuleErrorDAOCoinStreamInvalidBlockHeights"
+	RuleErrorDAOCoinStreamTotalOverflow           RuleError = "RuleErrorDAOCoinStreamTotalOverflow"
+	RuleErrorDAOCoinStreamInsufficientCoins       RuleError = "RuleErrorDAOCoinStreamInsufficientCoins"
+	RuleErrorDAOCoinStreamNotFound                RuleError = "RuleErrorDAOCoinStreamNotFound"
+	RuleErrorDAOCoinStreamWithdrawByNonPayee      RuleError = "RuleErrorDAOCoinStreamWithdrawByNonPayee"
+	RuleErrorDAOCoinStreamCancelByNonPayer        RuleError = "RuleErrorDAOCoinStreamCancelByNonPayer"
+	RuleErrorDAOCoinStreamNothingToWithdraw       RuleError = "RuleErrorDAOCoinStreamNothingToWithdraw"
+
+	// Governance
+	RuleErrorGovernanceBeforeBlockHeight           RuleError = "RuleErrorGovernanceBeforeBlockHeight"
+	RuleErrorGovernanceInvalidProfilePublicKey     RuleError = "RuleErrorGovernanceInvalidProfilePublicKey"
+	RuleErrorGovernanceOnNonexistentProfile        RuleError = "RuleErrorGovernanceOnNonexistentProfile"
+	RuleErrorGovernanceDescriptionTooLong          RuleError = "RuleErrorGovernanceDescriptionTooLong"
+	RuleErrorGovernanceInvalidNumOptions           RuleError = "RuleErrorGovernanceInvalidNumOptions"
+	RuleErrorGovernanceInvalidOption               RuleError = "RuleErrorGovernanceInvalidOption"
+	RuleErrorGovernanceInvalidVotingEndBlockHeight RuleError = "RuleErrorGovernanceInvalidVotingEndBlockHeight"
+	RuleErrorGovernanceProposerIsNotHolder         RuleError = "RuleErrorGovernanceProposerIsNotHolder"
+	RuleErrorGovernanceTooManyHolders              RuleError = "RuleErrorGovernanceTooManyHolders"
+	RuleErrorGovernanceNoHolders                   RuleError = "RuleErrorGovernanceNoHolders"
+	RuleErrorGovernanceProposalNotFound            RuleError = "RuleErrorGovernanceProposalNotFound"
+	RuleErrorGovernanceVotingClosed                RuleError = "RuleErrorGovernanceVotingClosed"
+	RuleErrorGovernanceInvalidOptionIndex          RuleError = "RuleErrorGovernanceInvalidOptionIndex"
+	RuleErrorGovernanceNoVotingPower               RuleError = "RuleErrorGovernanceNoVotingPower"
+	RuleErrorGovernanceVoteUnchanged               RuleError = "RuleErrorGovernanceVoteUnchanged"
+
+	// DAO Coin Multi-Transfers
+	RuleErrorDAOCoinMultiTransferBeforeBlockHeight    RuleError = "RuleErrorDAOCoinMultiTransferBeforeBlockHeight"
+	RuleErrorDAOCoinMultiTransferInvalidNumRecipients RuleError = "RuleErrorDAOCoinMultiTransferInvalidNumRecipients"
+	RuleErrorDAOCoinMultiTransferDuplicateRecipient   RuleError = "RuleErrorDAOCoinMultiTransferDuplicateRecipient"
+	RuleErrorDAOCoinMultiTransferZeroAmount           RuleError = "RuleErrorDAOCoinMultiTransferZeroAmount"
+	RuleErrorDAOCoinMultiTransferTotalOverflow        RuleError = "RuleErrorDAOCoinMultiTransferTotalOverflow"
+
+	// Royalty Splits
+	RuleErrorRoyaltySplitBeforeBlockHeight          RuleError = "RuleErrorRoyaltySplitBeforeBlockHeight"
+	RuleErrorRoyaltySplitNoRecipients               RuleError = "RuleErrorRoyaltySplitNoRecipients"
+	RuleErrorRoyaltySplitZeroBasisPoints            RuleError = "RuleErrorRoyaltySplitZeroBasisPoints"
+	RuleErrorRoyaltySplitHasTooManyBasisPoints      RuleError = "RuleErrorRoyaltySplitHasTooManyBasisPoints"
+	RuleErrorRoyaltySplitNotFound                   RuleError = "RuleErrorRoyaltySplitNotFound"
+	RuleErrorRoyaltySplitNotOwnedByTransactor       RuleError = "RuleErrorRoyaltySplitNotOwnedByTransactor"
+	RuleErrorRoyaltySplitUpdateIncreasesBasisPoints RuleError = "RuleErrorRoyaltySplitUpdateIncreasesBasisPoints"
+	RuleErrorRoyaltySplitInvalidID                  RuleError = "RuleErrorRoyaltySplitInvalidID"
+	RuleErrorRoyaltySplitCombinedWithRoyaltyMaps    RuleError = "RuleErrorRoyaltySplitCombinedWithRoyaltyMaps"
+
+	// DAO Coin Fees
+	RuleErrorDAOCoinFeeBeforeBlockHeight      RuleError = "RuleErrorDAOCoinFeeBeforeBlockHeight"
+	RuleErrorDAOCoinFeePubKeyLength           RuleError = "RuleErrorDAOCoinFeePubKeyLength"
+	RuleErrorDAOCoinFeeProfileDoesNotExist    RuleError = "RuleErrorDAOCoinFeeProfileDoesNotExist"
+	RuleErrorDAOCoinFeeCoinAlreadyWhitelisted RuleError = "RuleErrorDAOCoinFeeCoinAlreadyWhitelisted"
+	RuleErrorDAOCoinFeeCoinNotWhitelisted     RuleError = "RuleErrorDAOCoinFeeCoinNotWhitelisted"
+	RuleErrorDAOCoinFeeHaircutTooHigh         RuleError = "RuleErrorDAOCoinFeeHaircutTooHigh"
+
+	// Txn Type Minimum Network Fees
+	RuleErrorTxnTypeMinimumNetworkFeeBeforeBlockHeight RuleError = "RuleErrorTxnTypeMinimumNetworkFeeBeforeBlockHeight"
+	RuleErrorTxnTypeMinimumNetworkFeeInvalidTxnType    RuleError = "RuleErrorTxnTypeMinimumNetworkFeeInvalidTxnType"
+	RuleErrorDAOCoinFeeZeroFee                         RuleError = "RuleErrorDAOCoinFeeZeroFee"
+	RuleErrorDAOCoinFeeTransactorIsCoinCreator         RuleError = "RuleErrorDAOCoinFeeTransactorIsCoinCreator"
+	RuleErrorDAOCoinFeeNoPrice                         RuleError = "RuleErrorDAOCoinFeeNoPrice"
+	RuleErrorDAOCoinFeeInsufficientCoins               RuleError = "RuleErrorDAOCoinFeeInsufficientCoins"
+	RuleErrorDAOCoinFeeSponsorshipBudgetExceeded       RuleError = "RuleErrorDAOCoinFeeSponsorshipBudgetExceeded"
+
+	// NFT Leases
+	RuleErrorNFTLeaseBeforeBlockHeight         RuleError = "RuleErrorNFTLeaseBeforeBlockHeight"
+	RuleErrorNFTLeaseNonExistentNFT            RuleError = "RuleErrorNFTLeaseNonExistentNFT"
+	RuleErrorNFTLeaseByNonOwner                RuleError = "RuleErrorNFTLeaseByNonOwner"
+	RuleErrorNFTLeaseNFTIsForSale              RuleError = "RuleErrorNFTLeaseNFTIsForSale"
+	RuleErrorNFTLeasePendingNFTTransfer        RuleError = "RuleErrorNFTLeasePendingNFTTransfer"
+	RuleErrorNFTLeaseInvalidLesseePublicKey    RuleError = "RuleErrorNFTLeaseInvalidLesseePublicKey"
+	RuleErrorNFTLeaseLesseeIsOwner             RuleError = "RuleErrorNFTLeaseLesseeIsOwner"
+	RuleErrorNFTLeaseExpirationNotInFuture     RuleError = "RuleErrorNFTLeaseExpirationNotInFuture"
+	RuleErrorNFTLeaseAlreadyLeased             RuleError = "RuleErrorNFTLeaseAlreadyLeased"
+	RuleErrorNFTLeaseNotLeased                 RuleError = "RuleErrorNFTLeaseNotLeased"
+	RuleErrorNFTLeaseEndByNonOwnerOrLessee     RuleError = "RuleErrorNFTLeaseEndByNonOwnerOrLessee"
+	RuleErrorNFTLeaseCannotEndBeforeExpiration RuleError = "RuleErrorNFTLeaseCannotEndBeforeExpiration"
+	RuleErrorNFTIsLeased                       RuleError = "RuleErrorNFTIsLeased"
+
+	// NFT Auctions
+	RuleErrorNFTAuctionBeforeBlockHeight     RuleError = "RuleErrorNFTAuctionBeforeBlockHeight"
+	RuleErrorNFTAuctionInvalidEndBlockHeight RuleError = "RuleErrorNFTAuctionInvalidEndBlockHeight"
+	RuleErrorNFTAuctionEndNotInFuture        RuleError = "RuleErrorNFTAuctionEndNotInFuture"
+	RuleErrorNFTAuctionNFTNotForSale         RuleError = "RuleErrorNFTAuctionNFTNotForSale"
+	RuleErrorNFTAuctionCannotBeBuyNow        RuleError = "RuleErrorNFTAuctionCannotBeBuyNow"
+	RuleErrorNFTAuctionCannotHaveUnlockable  RuleError = "RuleErrorNFTAuctionCannotHaveUnlockable"
+	RuleErrorNFTAuctionIsOpen                RuleError = "RuleErrorNFTAuctionIsOpen"
+	RuleErrorNFTAuctionCannotAcceptBid       RuleError = "RuleErrorNFTAuctionCannotAcceptBid"
+	RuleErrorNFTAuctionBidTooLow             RuleError = "RuleErrorNFTAuctionBidTooLow"
+	RuleErrorNFTBidAfterAuctionClose         RuleError = "RuleErrorNFTBidAfterAuctionClose"
+
+	// NFT Dutch Auctions
+	RuleErrorNFTDutchAuctionBeforeBlockHeight     RuleError = "RuleErrorNFTDutchAuctionBeforeBlockHeight"
+	RuleErrorNFTDutchAuctionInvalidExtraData      RuleError = "RuleErrorNFTDutchAuctionInvalidExtraData"
+	RuleErrorNFTDutchAuctionEndNotInFuture        RuleError = "RuleErrorNFTDutchAuctionEndNotInFuture"
+	RuleErrorNFTDutchAuctionInvalidBlockRange     RuleError = "RuleErrorNFTDutchAuctionInvalidBlockRange"
+	RuleErrorNFTDutchAuctionInvalidStepBlocks     RuleError = "RuleErrorNFTDutchAuctionInvalidStepBlocks"
+	RuleErrorNFTDutchAuctionMustBeBuyNow          RuleError = "RuleErrorNFTDutchAuctionMustBeBuyNow"
+	RuleErrorNFTDutchAuctionEndPriceNotBelowStart RuleError = "RuleErrorNFTDutchAuctionEndPriceNotBelowStart"
+	RuleErrorNFTDutchAuctionEndPriceBelowMinBid   RuleError = "RuleErrorNFTDutchAuctionEndPriceBelowMinBid"
+
+	// NFT Bundles
+	RuleErrorNFTBundleBeforeBlockHeight        RuleError = "RuleErrorNFTBundleBeforeBlockHeight"
+	RuleErrorNFTBundleInvalidOperationType     RuleError = "RuleErrorNFTBundleInvalidOperationType"
+	RuleErrorNFTBundleNoItems                  RuleError = "RuleErrorNFTBundleNoItems"
+	RuleErrorNFTBundleTooManyItems             RuleError = "RuleErrorNFTBundleTooManyItems"
+	RuleErrorNFTBundleDuplicateItem            RuleError = "RuleErrorNFTBundleDuplicateItem"
+	RuleErrorNFTBundleZeroItemPrice            RuleError = "RuleErrorNFTBundleZeroItemPrice"
+	RuleErrorNFTBundlePriceOverflow            RuleError = "RuleErrorNFTBundlePriceOverflow"
+	RuleErrorNFTBundleNonExistentNFT           RuleError = "RuleErrorNFTBundleNonExistentNFT"
+	RuleErrorNFTBundleNFTNotOwnedBySeller      RuleError = "RuleErrorNFTBundleNFTNotOwnedBySeller"
+	RuleErrorNFTBundleNFTNotForSale            RuleError = "RuleErrorNFTBundleNFTNotForSale"
+	RuleErrorNFTBundleNFTIsPending             RuleError = "RuleErrorNFTBundleNFTIsPending"
+	RuleErrorNFTBundleNFTIsLeased              RuleError = "RuleErrorNFTBundleNFTIsLeased"
+	RuleErrorNFTBundleNFTIsAuction             RuleError = "RuleErrorNFTBundleNFTIsAuction"
+	RuleErrorNFTBundleNFTHasUnlockable         RuleError = "RuleErrorNFTBundleNFTHasUnlockable"
+	RuleErrorNFTBundleNotFound                 RuleError = "RuleErrorNFTBundleNotFound"
+	RuleErrorNFTBundleCancelByNonSeller        RuleError = "RuleErrorNFTBundleCancelByNonSeller"
+	RuleErrorNFTBundleBuyerIsSeller            RuleError = "RuleErrorNFTBundleBuyerIsSeller"
+	RuleErrorNFTBundlePriceMismatch            RuleError = "RuleErrorNFTBundlePriceMismatch"
+	RuleErrorNFTBundleInsufficientBuyerBalance RuleError = "RuleErrorNFTBundleInsufficientBuyerBalance"
+
+	// NFT Swaps
+	RuleErrorNFTSwapBeforeBlockHeight            RuleError = "RuleErrorNFTSwapBeforeBlockHeight"
+	RuleErrorNFTSwapInvalidOperationType         RuleError = "RuleErrorNFTSwapInvalidOperationType"
+	RuleErrorNFTSwapInvalidCounterpartyPublicKey RuleError = "RuleErrorNFTSwapInvalidCounterpartyPublicKey"
+	RuleErrorNFTSwapWithSelf                     RuleError = "RuleErrorNFTSwapWithSelf"
+	RuleErrorNFTSwapExpirationInPast             RuleError = "RuleErrorNFTSwapExpirationInPast"
+	RuleErrorNFTSwapNonExistentNFT               RuleError = "RuleErrorNFTSwapNonExistentNFT"
+	RuleErrorNFTSwapNFTNotOwnedByParty           RuleError = "RuleErrorNFTSwapNFTNotOwnedByParty"
+	RuleErrorNFTSwapNFTIsForSale                 RuleError = "RuleErrorNFTSwapNFTIsForSale"
+	RuleErrorNFTSwapNFTIsPending                 RuleError = "RuleErrorNFTSwapNFTIsPending"
+	RuleErrorNFTSwapNFTIsLeased                  RuleError = "RuleErrorNFTSwapNFTIsLeased"
+	RuleErrorNFTSwapNFTHasUnlockable             RuleError = "RuleErrorNFTSwapNFTHasUnlockable"
+	RuleErrorNFTSwapInsufficientBalance          RuleError = "RuleErrorNFTSwapInsufficientBalance"
+	RuleErrorNFTSwapNotFound                     RuleError = "RuleErrorNFTSwapNotFound"
+	RuleErrorNFTSwapAcceptByNonCounterparty      RuleError = "RuleErrorNFTSwapAcceptByNonCounterparty"
+	RuleErrorNFTSwapExpired                      RuleError = "RuleErrorNFTSwapExpired"
+	RuleErrorNFTSwapCancelByNonParty             RuleError = "RuleErrorNFTSwapCancelByNonParty"
+
+	// Escrows
+	RuleErrorEscrowZeroAmount           RuleError = "RuleErrorEscrowZeroAmount"
+	RuleErrorEscrowAmountTooLarge       RuleError = "RuleErrorEscrowAmountTooLarge"
+	RuleErrorEscrowExpirationInPast     RuleError = "RuleErrorEscrowExpirationInPast"
+	RuleErrorEscrowNeverRefundable      RuleError = "RuleErrorEscrowNeverRefundable"
+	RuleErrorEscrowAlreadyExists        RuleError = "RuleErrorEscrowAlreadyExists"
+	RuleErrorEscrowNotFound             RuleError = "RuleErrorEscrowNotFound"
+	RuleErrorEscrowExpired              RuleError = "RuleErrorEscrowExpired"
+	RuleErrorEscrowInvalidRecipient     RuleError = "RuleErrorEscrowInvalidRecipient"
+	RuleErrorEscrowReleaseExceedsAmount RuleError = "RuleErrorEscrowReleaseExceedsAmount"
+	RuleErrorEscrowNotRefundable        RuleError = "RuleErrorEscrowNotRefundable"
+	RuleErrorEscrowInsufficientBalance  RuleError = "RuleErrorEscrowInsufficientBalance"
+	RuleErrorEscrowOnNonexistentProfile RuleError = "RuleErrorEscrowOnNonexistentProfile"
+
 	HeaderErrorDuplicateHeader                                                   RuleError = "HeaderErrorDuplicateHeader"
 	HeaderErrorNilPrevHash                                                       RuleError = "HeaderErrorNilPrevHash"
 	HeaderErrorInvalidParent                                                     RuleError = "HeaderErrorInvalidParent"
@@ -582,6 +855,7 @@ const (
 
 	TxErrorTooLarge                                 RuleError = "TxErrorTooLarge"
 	TxErrorDuplicate                                RuleError = "TxErrorDuplicate"
+	TxErrorDuplicateIdempotencyKey                  RuleError = "TxErrorDuplicateIdempotencyKey"
 	TxErrorIndividualBlockReward                    RuleError = "TxErrorIndividualBlockReward"
 	TxErrorInsufficientFeeMinFee                    RuleError = "TxErrorInsufficientFeeMinFee"
 	TxErrorInsufficientFeeRateLimit                 RuleError = "TxErrorInsufficientFeeRateLimit"
@@ -590,6 +864,9 @@ const (
 	TxErrorNonceExpired                             RuleError = "TxErrorNonceExpired"
 	TxErrorNonceExpirationBlockHeightOffsetExceeded RuleError = "TxErrorNonceExpirationBlockHeightOffsetExceeded"
 	TxErrorNoNonceAfterBalanceModelBlockHeight      RuleError = "TxErrorNoNonceAfterBalanceModelBlockHeight"
+	TxErrorRelayPolicyDeniedPublicKey               RuleError = "TxErrorRelayPolicyDeniedPublicKey"
+	TxErrorReplaceByFeeTooManyEvictions             RuleError = "TxErrorReplaceByFeeTooManyEvictions"
+	TxErrorReplaceByFeeInsufficientAbsoluteFee      RuleError = "TxErrorReplaceByFeeInsufficientAbsoluteFee"
 
 	// Mempool
 	MempoolErrorNotRunning          RuleError = "MempoolErrorNotRunning"
@@ -7,6 +7,7 @@ type StateSyncerOperationEventFunc func(event *StateSyncerOperationEvent)
 type StateSyncerFlushedEventFunc func(event *StateSyncerFlushedEvent)
 type BlockEventFunc func(event *BlockEvent)
 type SnapshotCompletedEventFunc func()
+type UtxoViewFlushedEventFunc func(event *UtxoViewFlushedEvent)
 
 // StateSyncerOperationEvent is an event that is fired when an entry is connected or disconnected from the badger db.
 type StateSyncerOperationEvent struct {
@@ -33,6 +34,16 @@ type StateSyncerFlushedEvent struct {
 	BlockSyncFlushId uuid.UUID
 }
 
+// UtxoViewFlushedEvent is an event that is fired after a UtxoView flush to the badger db commits. The
+// Cursor is persisted in the same badger transaction as the flush, so it can be used to resume after a crash.
+type UtxoViewFlushedEvent struct {
+	Cursor *UtxoViewFlushCursor
+
+	// Optional. Mutations holds the keys the flush set or deleted, in the order it did so. It's only
+	// set once EnableUtxoViewFlushMutations has been called.
+	Mutations []*UtxoViewFlushMutation
+}
+
 type TransactionEvent struct {
 	Txn     *MsgDeSoTxn
 	TxnHash *BlockHash
@@ -59,11 +70,21 @@ type EventManager struct {
 	blockCommittedHandlers       []BlockEventFunc
 	blockAcceptedHandlers        []BlockEventFunc
 	snapshotCompletedHandlers    []SnapshotCompletedEventFunc
+	utxoViewFlushedHandlers      []utxoViewFlushedHandler
+	utxoViewFlushTracker         *utxoViewFlushTracker
 	isMempoolManager             bool
 }
 
+// utxoViewFlushedHandler is a UtxoViewFlushedEventFunc along with the prefixes it was registered for.
+type utxoViewFlushedHandler struct {
+	prefixes [][]byte
+	handler  UtxoViewFlushedEventFunc
+}
+
 func NewEventManager() *EventManager {
-	return &EventManager{}
+	return &EventManager{
+		utxoViewFlushTracker: &utxoViewFlushTracker{},
+	}
 }
 
 func (em *EventManager) OnStateSyncerOperation(handler StateSyncerOperationEventFunc) {
@@ -86,6 +107,45 @@ func (em *EventManager) stateSyncerFlushed(event *StateSyncerFlushedEvent) {
 	}
 }
 
+// OnUtxoViewFlushed registers a handler that's called after every committed UtxoView flush that modified
+// keys under at least one of the given prefixes. A handler registered without prefixes is called after every
+// committed flush. Handlers should be registered before the node starts processing blocks.
+func (em *EventManager) OnUtxoViewFlushed(prefixes [][]byte, handler UtxoViewFlushedEventFunc) {
+	if em.utxoViewFlushTracker == nil {
+		em.utxoViewFlushTracker = &utxoViewFlushTracker{}
+	}
+	em.utxoViewFlushedHandlers = append(em.utxoViewFlushedHandlers, utxoViewFlushedHandler{
+		prefixes: prefixes,
+		handler:  handler,
+	})
+}
+
+// EnableUtxoViewFlushMutations makes every UtxoViewFlushedEvent carry the mutations of its flush. Like
+// handlers, it should be enabled before the node starts processing blocks.
+func (em *EventManager) EnableUtxoViewFlushMutations() {
+	if em.utxoViewFlushTracker == nil {
+		em.utxoViewFlushTracker = &utxoViewFlushTracker{}
+	}
+	em.utxoViewFlushTracker.mtx.Lock()
+	defer em.utxoViewFlushTracker.mtx.Unlock()
+	em.utxoViewFlushTracker.recordMutations = true
+}
+
+func (em *EventManager) utxoViewFlushed(event *UtxoViewFlushedEvent) {
+	for _, flushedHandler := range em.utxoViewFlushedHandlers {
+		if len(flushedHandler.prefixes) == 0 {
+			flushedHandler.handler(event)
+			continue
+		}
+		for _, prefix := range flushedHandler.prefixes {
+			if event.Cursor.ModifiedPrefix(prefix) {
+				flushedHandler.handler(event)
+				break
+			}
+		}
+	}
+}
+
 func (em *EventManager) OnTransactionConnected(handler TransactionEventFunc) {
 	em.transactionConnectedHandlers = append(em.transactionConnectedHandlers, handler)
 }
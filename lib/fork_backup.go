@@ -0,0 +1,332 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// When a fork scheduled in DeSoParams is approaching, the ForkBackupManager takes a
+// backup of the chain db so that an operator can roll back quickly if the consensus
+// upgrade misbehaves. Backups are incremental: a full backup is taken every retention
+// forks, and the backups in between only contain the changes since that full backup.
+// This keeps every backup restorable from at most two files, and lets old full
+// backups be deleted once no retained backup builds on them. Every backup is
+// accompanied by a marker file describing the fork it was taken for and which full
+// backup it builds on.
+
+const (
+	DefaultForkBackupBlocksBeforeFork = 100
+	DefaultForkBackupRetention        = 3
+
+	forkBackupFileSuffix       = ".backup"
+	forkBackupMarkerFileSuffix = ".marker.json"
+)
+
+// ForkBackupMarker describes a pre-fork backup.
+type ForkBackupMarker struct {
+	ForkName   string
+	ForkHeight uint64
+	// BlockHeight and BlockHash identify the committed block that triggered the
+	// backup. The backup is a consistent snapshot of the db taken shortly after this
+	// block was committed.
+	BlockHeight uint64
+	BlockHash   string
+	// BackupFile is the name of the backup file within the backup directory.
+	BackupFile string
+	// BaseBackupFile is the full backup this one is incremental to, or empty if this
+	// is a full backup. Restoring a backup requires restoring its base first.
+	BaseBackupFile string
+	// SinceVersion and BackupVersion are the badger versions the backup covers. The
+	// next incremental backup starts from BackupVersion.
+	SinceVersion  uint64
+	BackupVersion uint64
+	TimestampSecs uint64
+}
+
+type ForkBackupManager struct {
+	db               *badger.DB
+	bc               *Blockchain
+	backupDir        string
+	blocksBeforeFork uint64
+	retention        int
+
+	// markers holds the markers of all backups in the backup directory, ordered
+	// from oldest to newest.
+	markers    []*ForkBackupMarker
+	markersMtx sync.Mutex
+
+	backupInProgress int32
+	backupWaitGroup  sync.WaitGroup
+}
+
+func NewForkBackupManager(bc *Blockchain, backupDir string, blocksBeforeFork uint64,
+	retention int) (*ForkBackupManager, error) {
+
+	if retention < 1 {
+		return nil, fmt.Errorf("NewForkBackupManager: Retention must be at least 1, got %d", retention)
+	}
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
+		return nil, errors.Wrapf(err, "NewForkBackupManager: Problem creating backup dir %v: ", backupDir)
+	}
+	markers, err := LoadForkBackupMarkers(backupDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewForkBackupManager: ")
+	}
+	return &ForkBackupManager{
+		db:               bc.DB(),
+		bc:               bc,
+		backupDir:        backupDir,
+		blocksBeforeFork: blocksBeforeFork,
+		retention:        retention,
+		markers:          markers,
+	}, nil
+}
+
+// HandleBlockCommitted should be registered with EventManager.OnBlockCommitted. It
+// starts a backup in the background when the committed block is within
+// blocksBeforeFork of a scheduled fork that we haven't backed up for yet.
+func (fbm *ForkBackupManager) HandleBlockCommitted(event *BlockEvent) {
+	if event.Block == nil || event.Block.Header == nil {
+		return
+	}
+	// Backups are only useful for forks we're about to cross, not ones we're
+	// passing while syncing. This is called with the chain lock held, so we use
+	// the lock-free chainState.
+	if fbm.bc.chainState() != SyncStateFullyCurrent {
+		return
+	}
+	blockHeight := event.Block.Header.Height
+	nextFork, err := GetNextScheduledFork(fbm.bc.params, blockHeight)
+	if err != nil {
+		glog.Errorf("ForkBackupManager.HandleBlockCommitted: %v", err)
+		return
+	}
+	if nextFork == nil || nextFork.Height-blockHeight > fbm.blocksBeforeFork {
+		return
+	}
+
+	// Backups can take a while, so they run in the background and we never run
+	// more than one at a time. Note that we claim the backup before checking the
+	// markers, since a backup in progress holds the markers lock.
+	if !atomic.CompareAndSwapInt32(&fbm.backupInProgress, 0, 1) {
+		return
+	}
+	if fbm.hasBackupForFork(nextFork.Height) {
+		atomic.StoreInt32(&fbm.backupInProgress, 0)
+		return
+	}
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		atomic.StoreInt32(&fbm.backupInProgress, 0)
+		glog.Errorf("ForkBackupManager.HandleBlockCommitted: Problem hashing block: %v", err)
+		return
+	}
+	fbm.backupWaitGroup.Add(1)
+	go func() {
+		defer fbm.backupWaitGroup.Done()
+		defer atomic.StoreInt32(&fbm.backupInProgress, 0)
+
+		glog.Infof(CLog(Yellow, fmt.Sprintf("ForkBackupManager: Fork %v activates at height %d, "+
+			"backing up the db at height %d", nextFork.Name, nextFork.Height, blockHeight)))
+		marker, err := fbm.Backup(nextFork, blockHeight, blockHash)
+		if err != nil {
+			glog.Errorf("ForkBackupManager: Problem backing up the db before fork %v: %v", nextFork.Name, err)
+			return
+		}
+		glog.Infof(CLog(Yellow, fmt.Sprintf("ForkBackupManager: Wrote %v", marker.BackupFile)))
+	}()
+}
+
+// Stop waits for any backup in progress to finish.
+func (fbm *ForkBackupManager) Stop() {
+	fbm.backupWaitGroup.Wait()
+}
+
+func (fbm *ForkBackupManager) hasBackupForFork(forkHeight uint64) bool {
+	fbm.markersMtx.Lock()
+	defer fbm.markersMtx.Unlock()
+
+	for _, marker := range fbm.markers {
+		if marker.ForkHeight == forkHeight {
+			return true
+		}
+	}
+	return false
+}
+
+// Backup writes an incremental backup of the db and its marker, then prunes backups
+// beyond the retention limit.
+func (fbm *ForkBackupManager) Backup(fork *ExportedForkHeight, blockHeight uint64,
+	blockHash *BlockHash) (*ForkBackupMarker, error) {
+
+	fbm.markersMtx.Lock()
+	defer fbm.markersMtx.Unlock()
+
+	marker := &ForkBackupMarker{
+		ForkName:      fork.Name,
+		ForkHeight:    fork.Height,
+		BlockHeight:   blockHeight,
+		BlockHash:     blockHash.String(),
+		TimestampSecs: uint64(time.Now().Unix()),
+	}
+	if baseMarker := fbm._getIncrementalBaseMarker(); baseMarker != nil {
+		marker.BaseBackupFile = baseMarker.BackupFile
+		marker.SinceVersion = baseMarker.BackupVersion
+	}
+	backupName := fmt.Sprintf("%d-%s-%d", fork.Height, fork.Name, marker.TimestampSecs)
+	marker.BackupFile = backupName + forkBackupFileSuffix
+
+	// Write to a temp file and rename it once it's complete, so a crash mid-backup
+	// never leaves a truncated backup behind.
+	backupPath := filepath.Join(fbm.backupDir, marker.BackupFile)
+	tempBackupPath := backupPath + ".tmp"
+	backupFile, err := os.Create(tempBackupPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ForkBackupManager.Backup: Problem creating backup file: ")
+	}
+	marker.BackupVersion, err = fbm.db.Backup(backupFile, marker.SinceVersion)
+	if err != nil {
+		backupFile.Close()
+		os.Remove(tempBackupPath)
+		return nil, errors.Wrapf(err, "ForkBackupManager.Backup: Problem backing up db: ")
+	}
+	if err = backupFile.Sync(); err != nil {
+		backupFile.Close()
+		return nil, errors.Wrapf(err, "ForkBackupManager.Backup: Problem syncing backup file: ")
+	}
+	if err = backupFile.Close(); err != nil {
+		return nil, errors.Wrapf(err, "ForkBackupManager.Backup: Problem closing backup file: ")
+	}
+	if err = os.Rename(tempBackupPath, backupPath); err != nil {
+		return nil, errors.Wrapf(err, "ForkBackupManager.Backup: Problem renaming backup file: ")
+	}
+
+	markerBytes, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "ForkBackupManager.Backup: Problem encoding marker: ")
+	}
+	markerPath := filepath.Join(fbm.backupDir, backupName+forkBackupMarkerFileSuffix)
+	if err = os.WriteFile(markerPath, markerBytes, 0644); err != nil {
+		return nil, errors.Wrapf(err, "ForkBackupManager.Backup: Problem writing marker: ")
+	}
+	fbm.markers = append(fbm.markers, marker)
+
+	fbm._pruneBackups()
+	return marker, nil
+}
+
+// _getIncrementalBaseMarker returns the full backup the next backup should be
+// incremental to, or nil if the next backup should be a full backup.
+func (fbm *ForkBackupManager) _getIncrementalBaseMarker() *ForkBackupMarker {
+	for ii := len(fbm.markers) - 1; ii >= 0; ii-- {
+		if fbm.markers[ii].BaseBackupFile != "" {
+			continue
+		}
+		// Take a new full backup once retention backups build on the latest one, so
+		// that the old full backup can eventually be pruned.
+		if len(fbm.markers)-ii >= fbm.retention {
+			return nil
+		}
+		return fbm.markers[ii]
+	}
+	return nil
+}
+
+// _pruneBackups deletes all but the latest retention backups. Full backups that a
+// retained backup is incremental to are kept, since they're needed to restore it.
+func (fbm *ForkBackupManager) _pruneBackups() {
+	requiredBackupFiles := make(map[string]bool)
+	for ii := len(fbm.markers) - 1; ii >= 0 && ii >= len(fbm.markers)-fbm.retention; ii-- {
+		requiredBackupFiles[fbm.markers[ii].BackupFile] = true
+		if fbm.markers[ii].BaseBackupFile != "" {
+			requiredBackupFiles[fbm.markers[ii].BaseBackupFile] = true
+		}
+	}
+
+	retainedMarkers := []*ForkBackupMarker{}
+	for _, marker := range fbm.markers {
+		if requiredBackupFiles[marker.BackupFile] {
+			retainedMarkers = append(retainedMarkers, marker)
+			continue
+		}
+		backupName := strings.TrimSuffix(marker.BackupFile, forkBackupFileSuffix)
+		for _, fileName := range []string{marker.BackupFile, backupName + forkBackupMarkerFileSuffix} {
+			if err := os.Remove(filepath.Join(fbm.backupDir, fileName)); err != nil && !os.IsNotExist(err) {
+				glog.Errorf("ForkBackupManager: Problem removing %v: %v", fileName, err)
+			}
+		}
+	}
+	fbm.markers = retainedMarkers
+}
+
+// LoadForkBackupMarkers reads the markers in a backup directory, ordered from oldest
+// to newest.
+func LoadForkBackupMarkers(backupDir string) ([]*ForkBackupMarker, error) {
+	markerPaths, err := filepath.Glob(filepath.Join(backupDir, "*"+forkBackupMarkerFileSuffix))
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadForkBackupMarkers: Problem listing markers: ")
+	}
+	markers := []*ForkBackupMarker{}
+	for _, markerPath := range markerPaths {
+		markerBytes, err := os.ReadFile(markerPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadForkBackupMarkers: Problem reading %v: ", markerPath)
+		}
+		marker := &ForkBackupMarker{}
+		if err = json.Unmarshal(markerBytes, marker); err != nil {
+			return nil, errors.Wrapf(err, "LoadForkBackupMarkers: Problem decoding %v: ", markerPath)
+		}
+		markers = append(markers, marker)
+	}
+	sort.Slice(markers, func(ii, jj int) bool {
+		return markers[ii].BackupVersion < markers[jj].BackupVersion
+	})
+	return markers, nil
+}
+
+// RestoreForkBackup loads the backup described by marker, along with every backup it is
+// incremental to, into db. The db should be empty, and the node must not be running.
+func RestoreForkBackup(db *badger.DB, backupDir string, marker *ForkBackupMarker) error {
+	markers, err := LoadForkBackupMarkers(backupDir)
+	if err != nil {
+		return errors.Wrapf(err, "RestoreForkBackup: ")
+	}
+	markersByBackupFile := make(map[string]*ForkBackupMarker)
+	for _, existingMarker := range markers {
+		markersByBackupFile[existingMarker.BackupFile] = existingMarker
+	}
+
+	// Load the full backup first, followed by the incremental backup if there is one.
+	backupChain := []*ForkBackupMarker{marker}
+	if marker.BaseBackupFile != "" {
+		baseMarker, exists := markersByBackupFile[marker.BaseBackupFile]
+		if !exists {
+			return fmt.Errorf("RestoreForkBackup: Missing base backup %v for %v",
+				marker.BaseBackupFile, marker.BackupFile)
+		}
+		backupChain = []*ForkBackupMarker{baseMarker, marker}
+	}
+	for _, backupMarker := range backupChain {
+		backupFile, err := os.Open(filepath.Join(backupDir, backupMarker.BackupFile))
+		if err != nil {
+			return errors.Wrapf(err, "RestoreForkBackup: Problem opening %v: ", backupMarker.BackupFile)
+		}
+		err = db.Load(backupFile, 256)
+		backupFile.Close()
+		if err != nil {
+			return errors.Wrapf(err, "RestoreForkBackup: Problem loading %v: ", backupMarker.BackupFile)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForkBackupManager(t *testing.T) {
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	backupDir := t.TempDir()
+
+	fbm := &ForkBackupManager{db: db, backupDir: backupDir, retention: 2}
+	backupFork := func(forkHeight uint64) *ForkBackupMarker {
+		require.NoError(t, db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(fmt.Sprintf("key%d", forkHeight)), []byte{1})
+		}))
+		marker, err := fbm.Backup(
+			&ExportedForkHeight{Name: fmt.Sprintf("Fork%d", forkHeight), Height: forkHeight},
+			forkHeight-1, &BlockHash{byte(forkHeight)})
+		require.NoError(t, err)
+		return marker
+	}
+
+	// The first backup is full, and the next one is incremental to it.
+	marker1 := backupFork(100)
+	require.Empty(t, marker1.BaseBackupFile)
+	marker2 := backupFork(200)
+	require.Equal(t, marker1.BackupFile, marker2.BaseBackupFile)
+	require.Equal(t, marker1.BackupVersion, marker2.SinceVersion)
+
+	// With a retention of two, the third backup is full again. The first full backup
+	// is kept since the second backup builds on it.
+	marker3 := backupFork(300)
+	require.Empty(t, marker3.BaseBackupFile)
+	markers, err := LoadForkBackupMarkers(backupDir)
+	require.NoError(t, err)
+	require.Len(t, markers, 3)
+
+	// Once nothing builds on the first full backup, it's pruned.
+	marker4 := backupFork(400)
+	require.Equal(t, marker3.BackupFile, marker4.BaseBackupFile)
+	markers, err = LoadForkBackupMarkers(backupDir)
+	require.NoError(t, err)
+	require.Len(t, markers, 2)
+	require.Equal(t, marker3.BackupFile, markers[0].BackupFile)
+	require.Equal(t, marker4.BackupFile, markers[1].BackupFile)
+
+	// Restoring an incremental backup loads its full backup first.
+	restoreDb, _ := GetTestBadgerDb()
+	defer CleanUpBadger(restoreDb)
+	require.NoError(t, RestoreForkBackup(restoreDb, backupDir, markers[1]))
+	require.NoError(t, restoreDb.View(func(txn *badger.Txn) error {
+		for _, forkHeight := range []uint64{100, 200, 300, 400} {
+			if _, err := txn.Get([]byte(fmt.Sprintf("key%d", forkHeight))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,231 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/pkg/errors"
+)
+
+// DeSo keys are derived from a seed following BIP-44, at m/44'/0'/account'/change/index. The
+// coin type is 0, the same as Bitcoin's, so that the first key matches the first address most
+// Bitcoin wallets derive from the same seed. Wallets usually only use the first key, but a seed
+// can have been used to create more accounts. The functions below let a wallet that's
+// recovering from a seed find every account it was used for by asking a node which of the
+// seed's keys have state, following BIP-44's gap limit account discovery.
+
+// DeSoBIP44CoinType is the BIP-44 coin type DeSo keys are derived with.
+const DeSoBIP44CoinType uint32 = 0
+
+const (
+	// DefaultHDDiscoveryGapLimit is the number of consecutive unused keys after which
+	// discovery stops scanning an account. It's the gap limit recommended by BIP-44.
+	DefaultHDDiscoveryGapLimit uint32 = 20
+	// MaxHDDiscoveryGapLimit bounds the work a single discovery can do.
+	MaxHDDiscoveryGapLimit uint32 = 1000
+)
+
+// HDDerivationPath is the part of a BIP-44 path that varies between a seed's DeSo keys. Its
+// Account is hardened and its Change and AddressIndex aren't.
+type HDDerivationPath struct {
+	Account      uint32
+	Change       uint32
+	AddressIndex uint32
+}
+
+func (path *HDDerivationPath) String() string {
+	return fmt.Sprintf("m/44'/%d'/%d'/%d/%d", DeSoBIP44CoinType, path.Account, path.Change, path.AddressIndex)
+}
+
+// Validate checks that each index is below the first hardened index.
+func (path *HDDerivationPath) Validate() error {
+	if path.Account >= hdkeychain.HardenedKeyStart || path.Change >= hdkeychain.HardenedKeyStart ||
+		path.AddressIndex >= hdkeychain.HardenedKeyStart {
+		return fmt.Errorf("HDDerivationPath.Validate: index in %v exceeds the max of %d",
+			path, hdkeychain.HardenedKeyStart-1)
+	}
+	return nil
+}
+
+// ParseHDDerivationPath parses a path of the form m/44'/0'/account'/change/index. Hardened
+// indices can be marked with ' or h.
+func ParseHDDerivationPath(pathStr string) (*HDDerivationPath, error) {
+	components := strings.Split(strings.TrimSpace(pathStr), "/")
+	if len(components) != 6 || components[0] != "m" {
+		return nil, fmt.Errorf("ParseHDDerivationPath: %v isn't of the form "+
+			"m/44'/%d'/account'/change/index", pathStr, DeSoBIP44CoinType)
+	}
+	indices := make([]uint32, 0, 5)
+	for ii, component := range components[1:] {
+		isHardened := strings.HasSuffix(component, "'") || strings.HasSuffix(component, "h")
+		// The purpose, coin type, and account are hardened and the change and index aren't.
+		if isHardened != (ii < 3) {
+			return nil, fmt.Errorf("ParseHDDerivationPath: component %v of %v has the wrong hardening",
+				component, pathStr)
+		}
+		index, err := strconv.ParseUint(strings.TrimRight(component, "'h"), 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ParseHDDerivationPath: problem parsing component %v of %v: ",
+				component, pathStr)
+		}
+		indices = append(indices, uint32(index))
+	}
+	if indices[0] != 44 || indices[1] != DeSoBIP44CoinType {
+		return nil, fmt.Errorf("ParseHDDerivationPath: %v isn't a DeSo BIP-44 path", pathStr)
+	}
+	path := &HDDerivationPath{
+		Account:      indices[2],
+		Change:       indices[3],
+		AddressIndex: indices[4],
+	}
+	if err := path.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "ParseHDDerivationPath: ")
+	}
+	return path, nil
+}
+
+// ComputeKeysFromSeedAtPath derives the public key at the path from the seed.
+func ComputeKeysFromSeedAtPath(seedBytes []byte, path *HDDerivationPath, params *DeSoParams) ([]byte, error) {
+	if err := path.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "ComputeKeysFromSeedAtPath: ")
+	}
+	pubKey, _, _, err := ComputeKeysFromSeedAtPathWithNet(
+		seedBytes, path, params.NetworkType == NetworkType_TESTNET)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ComputeKeysFromSeedAtPath: ")
+	}
+	return pubKey.SerializeCompressed(), nil
+}
+
+// HDAccountUsage is the state that shows a public key has been used.
+type HDAccountUsage struct {
+	HasDeSoBalance        bool
+	HasProfile            bool
+	HasCreatorCoinHolding bool
+	HasDAOCoinHolding     bool
+	HasNFT                bool
+	HasDerivedKey         bool
+	// HasPKIDEntry is true if the public key was swapped into another PKID by a SwapIdentity.
+	HasPKIDEntry bool
+}
+
+func (usage *HDAccountUsage) IsUsed() bool {
+	return usage.HasDeSoBalance || usage.HasProfile || usage.HasCreatorCoinHolding ||
+		usage.HasDAOCoinHolding || usage.HasNFT || usage.HasDerivedKey || usage.HasPKIDEntry
+}
+
+// GetHDAccountUsage returns the state the view has for the public key. A public key whose
+// only use was to send its whole balance away leaves no state, so it isn't considered used
+// unless it was used in some other way.
+func (bav *UtxoView) GetHDAccountUsage(publicKey []byte) (*HDAccountUsage, error) {
+	usage := &HDAccountUsage{}
+
+	balanceNanos, err := bav.GetDeSoBalanceNanosForPublicKey(publicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetHDAccountUsage: ")
+	}
+	usage.HasDeSoBalance = balanceNanos > 0
+
+	profileEntry := bav.GetProfileEntryForPublicKey(publicKey)
+	usage.HasProfile = profileEntry != nil && !profileEntry.isDeleted
+
+	pkidEntry := bav.GetPKIDForPublicKey(publicKey)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return usage, nil
+	}
+	usage.HasPKIDEntry = !pkidEntry.PKID.Eq(PublicKeyToPKID(publicKey))
+
+	for _, isDAOCoin := range []bool{false, true} {
+		balanceEntries, _, err := bav.GetHoldings(pkidEntry.PKID, false, isDAOCoin)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetHDAccountUsage: ")
+		}
+		hasHolding := false
+		for _, balanceEntry := range balanceEntries {
+			if !balanceEntry.isDeleted && !balanceEntry.BalanceNanos.IsZero() {
+				hasHolding = true
+				break
+			}
+		}
+		if isDAOCoin {
+			usage.HasDAOCoinHolding = hasHolding
+		} else {
+			usage.HasCreatorCoinHolding = hasHolding
+		}
+	}
+
+	for _, nftEntry := range bav.GetNFTEntriesForPKID(pkidEntry.PKID) {
+		if !nftEntry.isDeleted {
+			usage.HasNFT = true
+			break
+		}
+	}
+
+	derivedKeyEntries, err := bav.GetAllDerivedKeyMappingsForOwner(publicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetHDAccountUsage: ")
+	}
+	for _, derivedKeyEntry := range derivedKeyEntries {
+		if !derivedKeyEntry.isDeleted {
+			usage.HasDerivedKey = true
+			break
+		}
+	}
+
+	return usage, nil
+}
+
+// HDDiscoveredKey is a used public key derived from a seed.
+type HDDiscoveredKey struct {
+	Path      *HDDerivationPath
+	PublicKey []byte
+	Usage     *HDAccountUsage
+}
+
+// DiscoverHDAccounts finds the used public keys derived from the seed, following BIP-44's
+// account discovery. Accounts are scanned in order, and each account's external chain is
+// scanned until gapLimit consecutive keys are unused. Discovery stops at the first account
+// with no used keys. A gapLimit of zero uses DefaultHDDiscoveryGapLimit.
+func (bav *UtxoView) DiscoverHDAccounts(seedBytes []byte, gapLimit uint32) ([]*HDDiscoveredKey, error) {
+	if gapLimit == 0 {
+		gapLimit = DefaultHDDiscoveryGapLimit
+	}
+	if gapLimit > MaxHDDiscoveryGapLimit {
+		return nil, fmt.Errorf("DiscoverHDAccounts: gap limit %d exceeds the max of %d",
+			gapLimit, MaxHDDiscoveryGapLimit)
+	}
+
+	var discoveredKeys []*HDDiscoveredKey
+	for account := uint32(0); account < hdkeychain.HardenedKeyStart; account++ {
+		accountIsUsed := false
+		numUnused := uint32(0)
+		for addressIndex := uint32(0); numUnused < gapLimit && addressIndex < hdkeychain.HardenedKeyStart; addressIndex++ {
+			path := &HDDerivationPath{Account: account, AddressIndex: addressIndex}
+			publicKey, err := ComputeKeysFromSeedAtPath(seedBytes, path, bav.Params)
+			if err != nil {
+				return nil, errors.Wrapf(err, "DiscoverHDAccounts: ")
+			}
+			usage, err := bav.GetHDAccountUsage(publicKey)
+			if err != nil {
+				return nil, errors.Wrapf(err, "DiscoverHDAccounts: problem checking %v: ", path)
+			}
+			if !usage.IsUsed() {
+				numUnused++
+				continue
+			}
+			numUnused = 0
+			accountIsUsed = true
+			discoveredKeys = append(discoveredKeys, &HDDiscoveredKey{
+				Path:      path,
+				PublicKey: publicKey,
+				Usage:     usage,
+			})
+		}
+		if !accountIsUsed {
+			break
+		}
+	}
+	return discoveredKeys, nil
+}
@@ -0,0 +1,92 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tyler-smith/go-bip39"
+)
+
+func TestHDDerivationPath(t *testing.T) {
+	require := require.New(t)
+
+	path, err := ParseHDDerivationPath("m/44'/0'/2'/0/7")
+	require.NoError(err)
+	require.Equal(&HDDerivationPath{Account: 2, Change: 0, AddressIndex: 7}, path)
+	require.Equal("m/44'/0'/2'/0/7", path.String())
+
+	path, err = ParseHDDerivationPath("m/44h/0h/1h/1/3")
+	require.NoError(err)
+	require.Equal(&HDDerivationPath{Account: 1, Change: 1, AddressIndex: 3}, path)
+
+	for _, invalidPath := range []string{
+		"m/44'/0'/0'/0",
+		"m/44'/0'/0/0/0",
+		"m/44'/0'/0'/0'/0",
+		"m/49'/0'/0'/0/0",
+		"m/44'/60'/0'/0/0",
+		"m/44'/0'/0'/0/2147483648",
+		"44'/0'/0'/0/0",
+	} {
+		_, err = ParseHDDerivationPath(invalidPath)
+		require.Error(err, invalidPath)
+	}
+
+	// The first key matches the key ComputeKeysFromSeed derives.
+	seedBytes, err := bip39.NewSeedWithErrorChecking(
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	require.NoError(err)
+	pubKey, _, _, err := ComputeKeysFromSeed(seedBytes, 0, &DeSoTestnetParams)
+	require.NoError(err)
+	publicKey, err := ComputeKeysFromSeedAtPath(seedBytes, &HDDerivationPath{}, &DeSoTestnetParams)
+	require.NoError(err)
+	require.Equal(pubKey.SerializeCompressed(), publicKey)
+}
+
+func TestDiscoverHDAccounts(t *testing.T) {
+	require := require.New(t)
+
+	_, params, db := NewLowDifficultyBlockchain(t)
+	seedBytes, err := bip39.NewSeedWithErrorChecking(
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	require.NoError(err)
+
+	utxoView := NewUtxoView(db, params, nil, nil, nil)
+	fundKey := func(path *HDDerivationPath) []byte {
+		publicKey, err := ComputeKeysFromSeedAtPath(seedBytes, path, params)
+		require.NoError(err)
+		utxoView.PublicKeyToDeSoBalanceNanos[*NewPublicKey(publicKey)] = 100
+		return publicKey
+	}
+
+	// Nothing is discovered for an unused seed.
+	discoveredKeys, err := utxoView.DiscoverHDAccounts(seedBytes, 5)
+	require.NoError(err)
+	require.Empty(discoveredKeys)
+
+	// Keys within the gap limit of a used key are discovered, in the first account and in
+	// the next one, but keys past the gap limit and accounts after an unused one aren't.
+	firstPublicKey := fundKey(&HDDerivationPath{Account: 0, AddressIndex: 0})
+	fundKey(&HDDerivationPath{Account: 0, AddressIndex: 5})
+	fundKey(&HDDerivationPath{Account: 0, AddressIndex: 11})
+	fundKey(&HDDerivationPath{Account: 1, AddressIndex: 2})
+	fundKey(&HDDerivationPath{Account: 3, AddressIndex: 0})
+	discoveredKeys, err = utxoView.DiscoverHDAccounts(seedBytes, 5)
+	require.NoError(err)
+	require.Len(discoveredKeys, 3)
+	require.Equal(&HDDerivationPath{Account: 0, AddressIndex: 0}, discoveredKeys[0].Path)
+	require.Equal(firstPublicKey, discoveredKeys[0].PublicKey)
+	require.True(discoveredKeys[0].Usage.HasDeSoBalance)
+	require.Equal(&HDDerivationPath{Account: 0, AddressIndex: 5}, discoveredKeys[1].Path)
+	require.Equal(&HDDerivationPath{Account: 1, AddressIndex: 2}, discoveredKeys[2].Path)
+
+	// A larger gap limit reaches further.
+	discoveredKeys, err = utxoView.DiscoverHDAccounts(seedBytes, 6)
+	require.NoError(err)
+	require.Len(discoveredKeys, 4)
+
+	_, err = utxoView.DiscoverHDAccounts(seedBytes, MaxHDDiscoveryGapLimit+1)
+	require.Error(err)
+}
@@ -0,0 +1,388 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// HyperSync downloads the state prefix by prefix, one chunk at a time. The progress used to
+// only be kept in memory, so a node that was restarted in the middle of HyperSync deleted
+// everything it had downloaded and started over, which can take hours on mainnet.
+//
+// To avoid that, the node saves a HyperSyncCheckpoint after every chunk. The checkpoint holds
+// the snapshot we're syncing, the progress on each prefix, and the state checksum and
+// migration checksums as of the chunk. It's written by the snapshot's Run loop after the chunk
+// itself, so a checkpoint never covers entries that aren't in the DB. Each prefix's progress
+// also keeps a running digest of the entries received for it, which is what the partially
+// downloaded prefix is re-validated against when the node resumes.
+//
+// When the node gets to HyperSync after a restart, it loads the checkpoint and, as long as
+// it's for the snapshot the node is about to sync:
+//
+//   - Completed prefixes are kept as they are.
+//   - The partially downloaded prefix has its entries up to the last received key hashed
+//     again and compared to the digest. Entries after the last received key were written
+//     after the checkpoint, so they're deleted.
+//   - Prefixes that weren't started by the checkpoint are cleared.
+//
+// The checksums and chunk verifiers (see SnapshotChunkVerifier) are then restored from the
+// checkpoint and the node asks its peer for the chunk after the last received key. If the checkpoint is for another snapshot, or the
+// partially downloaded prefix doesn't match its digest, the checkpoint is deleted and the
+// node starts over as before. The checkpoint is deleted once HyperSync finishes.
+
+// HyperSyncCheckpointPrefix is the progress on a single state prefix.
+type HyperSyncCheckpointPrefix struct {
+	Prefix          []byte
+	LastReceivedKey []byte
+	Completed       bool
+
+	// NumEntries and Digest cover the entries received for the prefix so far.
+	// See UpdateHyperSyncPrefixDigest.
+	NumEntries uint64
+	Digest     []byte
+
+	// ChunkVerifier is the prefix's verifier, if its chunks are being verified.
+	ChunkVerifier *SnapshotChunkVerifier
+}
+
+// HyperSyncCheckpointMigration is the checksum of an encoder migration as of the checkpoint.
+type HyperSyncCheckpointMigration struct {
+	BlockHeight   uint64
+	Version       byte
+	ChecksumBytes []byte
+}
+
+type HyperSyncCheckpoint struct {
+	// SnapshotMetadata is saved with its ChunkCommitment, if we've received one.
+	SnapshotMetadata *SnapshotEpochMetadata
+	Prefixes         []*HyperSyncCheckpointPrefix
+
+	// ChecksumBytes and Migrations are set by the snapshot when the checkpoint is saved.
+	ChecksumBytes []byte
+	Migrations    []*HyperSyncCheckpointMigration
+}
+
+func (checkpoint *HyperSyncCheckpoint) GetPrefix(prefix []byte) *HyperSyncCheckpointPrefix {
+	for _, prefixCheckpoint := range checkpoint.Prefixes {
+		if bytes.Equal(prefixCheckpoint.Prefix, prefix) {
+			return prefixCheckpoint
+		}
+	}
+	return nil
+}
+
+func (checkpoint *HyperSyncCheckpoint) ToBytes() []byte {
+	var data []byte
+
+	data = append(data, checkpoint.SnapshotMetadata.ToBytes()...)
+	data = append(data, UintToBuf(uint64(len(checkpoint.Prefixes)))...)
+	for _, prefixCheckpoint := range checkpoint.Prefixes {
+		data = append(data, EncodeByteArray(prefixCheckpoint.Prefix)...)
+		data = append(data, EncodeByteArray(prefixCheckpoint.LastReceivedKey)...)
+		data = append(data, BoolToByte(prefixCheckpoint.Completed))
+		data = append(data, UintToBuf(prefixCheckpoint.NumEntries)...)
+		data = append(data, EncodeByteArray(prefixCheckpoint.Digest)...)
+		data = append(data, BoolToByte(prefixCheckpoint.ChunkVerifier != nil))
+		if prefixCheckpoint.ChunkVerifier != nil {
+			data = append(data, prefixCheckpoint.ChunkVerifier.ToBytes()...)
+		}
+	}
+	data = append(data, EncodeByteArray(checkpoint.ChecksumBytes)...)
+	data = append(data, UintToBuf(uint64(len(checkpoint.Migrations)))...)
+	for _, migration := range checkpoint.Migrations {
+		data = append(data, UintToBuf(migration.BlockHeight)...)
+		data = append(data, migration.Version)
+		data = append(data, EncodeByteArray(migration.ChecksumBytes)...)
+	}
+	data = append(data, BoolToByte(checkpoint.SnapshotMetadata.ChunkCommitment != nil))
+	if checkpoint.SnapshotMetadata.ChunkCommitment != nil {
+		data = append(data, checkpoint.SnapshotMetadata.ChunkCommitment.ToBytes()...)
+	}
+	return data
+}
+
+func (checkpoint *HyperSyncCheckpoint) FromBytes(rr *bytes.Reader) error {
+	var err error
+
+	checkpoint.SnapshotMetadata = &SnapshotEpochMetadata{}
+	if err = checkpoint.SnapshotMetadata.FromBytes(rr); err != nil {
+		return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading SnapshotMetadata")
+	}
+
+	numPrefixes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading number of prefixes")
+	}
+	checkpoint.Prefixes = nil
+	for ii := uint64(0); ii < numPrefixes; ii++ {
+		prefixCheckpoint := &HyperSyncCheckpointPrefix{}
+		if prefixCheckpoint.Prefix, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading Prefix")
+		}
+		if prefixCheckpoint.LastReceivedKey, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading LastReceivedKey")
+		}
+		if prefixCheckpoint.Completed, err = ReadBoolByte(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading Completed")
+		}
+		if prefixCheckpoint.NumEntries, err = ReadUvarint(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading NumEntries")
+		}
+		if prefixCheckpoint.Digest, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading Digest")
+		}
+		hasChunkVerifier, err := ReadBoolByte(rr)
+		if err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading hasChunkVerifier")
+		}
+		if hasChunkVerifier {
+			prefixCheckpoint.ChunkVerifier = &SnapshotChunkVerifier{}
+			if err = prefixCheckpoint.ChunkVerifier.FromBytes(rr); err != nil {
+				return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading ChunkVerifier")
+			}
+		}
+		checkpoint.Prefixes = append(checkpoint.Prefixes, prefixCheckpoint)
+	}
+
+	if checkpoint.ChecksumBytes, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading ChecksumBytes")
+	}
+	numMigrations, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading number of migrations")
+	}
+	checkpoint.Migrations = nil
+	for ii := uint64(0); ii < numMigrations; ii++ {
+		migration := &HyperSyncCheckpointMigration{}
+		if migration.BlockHeight, err = ReadUvarint(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading migration BlockHeight")
+		}
+		if migration.Version, err = rr.ReadByte(); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading migration Version")
+		}
+		if migration.ChecksumBytes, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading migration ChecksumBytes")
+		}
+		checkpoint.Migrations = append(checkpoint.Migrations, migration)
+	}
+
+	hasChunkCommitment, err := ReadBoolByte(rr)
+	if err != nil {
+		return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading hasChunkCommitment")
+	}
+	if hasChunkCommitment {
+		checkpoint.SnapshotMetadata.ChunkCommitment = &SnapshotChunkCommitment{}
+		if err = checkpoint.SnapshotMetadata.ChunkCommitment.FromBytes(rr); err != nil {
+			return errors.Wrapf(err, "HyperSyncCheckpoint.FromBytes: Problem reading ChunkCommitment")
+		}
+	}
+	return nil
+}
+
+// UpdateHyperSyncPrefixDigest folds the entries into a prefix's digest, in order. Each entry
+// is hashed together with the digest so far, so the digest commits to both the entries and
+// their order. The digest of a prefix with no entries is empty.
+func UpdateHyperSyncPrefixDigest(digest []byte, entries []*DBEntry) []byte {
+	for _, entry := range entries {
+		var data []byte
+		data = append(data, digest...)
+		data = append(data, EncodeByteArray(entry.Key)...)
+		data = append(data, EncodeByteArray(entry.Value)...)
+		hash := sha256.Sum256(data)
+		digest = hash[:]
+	}
+	return digest
+}
+
+// ==================================================================
+// Snapshot
+// ==================================================================
+
+// SaveHyperSyncCheckpoint enqueues the checkpoint to be saved once the chunks enqueued before
+// it have been written to the DB.
+func (snap *Snapshot) SaveHyperSyncCheckpoint(checkpoint *HyperSyncCheckpoint) {
+	snap.OperationChannel.EnqueueOperation(&SnapshotOperation{
+		operationType:       SnapshotOperationSaveHyperSyncCheckpoint,
+		hyperSyncCheckpoint: checkpoint,
+	})
+}
+
+// saveHyperSyncCheckpoint is called from the Run loop. It sets the checksums on the checkpoint
+// and writes it to the DB.
+func (snap *Snapshot) saveHyperSyncCheckpoint(checkpoint *HyperSyncCheckpoint) error {
+	// Once a chunk has been rescheduled, the chunks are no longer written in the order they were
+	// received in, so later checkpoints could cover entries that aren't in the DB yet. The last
+	// checkpoint that was saved is still consistent with the DB, so we keep that one.
+	if snap.hyperSyncCheckpointsDisabled {
+		return nil
+	}
+
+	var err error
+	checkpoint.ChecksumBytes, err = snap.Checksum.ToBytes()
+	if err != nil {
+		return errors.Wrapf(err, "saveHyperSyncCheckpoint: Problem getting checksum bytes")
+	}
+	checkpoint.Migrations = nil
+	snap.Migrations.migrationChecksumLock.RLock()
+	for _, migrationChecksum := range snap.Migrations.migrationChecksums {
+		checksumBytes, err := migrationChecksum.Checksum.ToBytes()
+		if err != nil {
+			snap.Migrations.migrationChecksumLock.RUnlock()
+			return errors.Wrapf(err, "saveHyperSyncCheckpoint: Problem getting migration checksum bytes")
+		}
+		checkpoint.Migrations = append(checkpoint.Migrations, &HyperSyncCheckpointMigration{
+			BlockHeight:   migrationChecksum.BlockHeight,
+			Version:       migrationChecksum.Version,
+			ChecksumBytes: checksumBytes,
+		})
+	}
+	snap.Migrations.migrationChecksumLock.RUnlock()
+
+	snap.SnapshotDbMutex.Lock()
+	defer snap.SnapshotDbMutex.Unlock()
+	return snap.mainDb.Update(func(txn *badger.Txn) error {
+		return txn.Set(getMainDbPrefix(_prefixHyperSyncCheckpoint), checkpoint.ToBytes())
+	})
+}
+
+// RestoreHyperSyncCheckpointChecksums sets the state checksum and the migration checksums to
+// the ones in the checkpoint. It errors without changing anything if the checkpoint doesn't
+// have a checksum for each of the node's migrations.
+func (snap *Snapshot) RestoreHyperSyncCheckpointChecksums(checkpoint *HyperSyncCheckpoint) error {
+	snap.Migrations.migrationChecksumLock.Lock()
+	defer snap.Migrations.migrationChecksumLock.Unlock()
+
+	migrationChecksumBytes := make([][]byte, len(snap.Migrations.migrationChecksums))
+	for ii, migrationChecksum := range snap.Migrations.migrationChecksums {
+		for _, migration := range checkpoint.Migrations {
+			if migration.BlockHeight == migrationChecksum.BlockHeight && migration.Version == migrationChecksum.Version {
+				migrationChecksumBytes[ii] = migration.ChecksumBytes
+				break
+			}
+		}
+		if migrationChecksumBytes[ii] == nil {
+			return fmt.Errorf("RestoreHyperSyncCheckpointChecksums: Checkpoint has no checksum for migration "+
+				"at height (%v) with version (%v)", migrationChecksum.BlockHeight, migrationChecksum.Version)
+		}
+	}
+
+	if err := snap.Checksum.FromBytes(checkpoint.ChecksumBytes); err != nil {
+		return errors.Wrapf(err, "RestoreHyperSyncCheckpointChecksums: Problem restoring checksum")
+	}
+	for ii, migrationChecksum := range snap.Migrations.migrationChecksums {
+		if err := migrationChecksum.Checksum.FromBytes(migrationChecksumBytes[ii]); err != nil {
+			return errors.Wrapf(err, "RestoreHyperSyncCheckpointChecksums: Problem restoring migration checksum")
+		}
+		migrationChecksum.Completed = false
+	}
+	return nil
+}
+
+// ==================================================================
+// DB
+// ==================================================================
+
+// DBGetHyperSyncCheckpoint returns the saved checkpoint, or nil if there isn't one.
+func DBGetHyperSyncCheckpoint(handle *badger.DB) (*HyperSyncCheckpoint, error) {
+	var checkpointBytes []byte
+	err := handle.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(getMainDbPrefix(_prefixHyperSyncCheckpoint))
+		if err != nil {
+			return err
+		}
+		checkpointBytes, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetHyperSyncCheckpoint: ")
+	}
+
+	checkpoint := &HyperSyncCheckpoint{}
+	if err = checkpoint.FromBytes(bytes.NewReader(checkpointBytes)); err != nil {
+		return nil, errors.Wrapf(err, "DBGetHyperSyncCheckpoint: ")
+	}
+	return checkpoint, nil
+}
+
+func DBDeleteHyperSyncCheckpoint(handle *badger.DB) error {
+	return handle.Update(func(txn *badger.Txn) error {
+		return txn.Delete(getMainDbPrefix(_prefixHyperSyncCheckpoint))
+	})
+}
+
+// DBRestoreHyperSyncCheckpointState brings the state prefixes in the DB back to where they
+// were when the checkpoint was saved, re-validating the partially downloaded prefixes against
+// their digests. It errors if a prefix doesn't match its digest, in which case the state
+// can't be resumed from and has to be deleted.
+func DBRestoreHyperSyncCheckpointState(handle *badger.DB, checkpoint *HyperSyncCheckpoint) error {
+	for _, prefix := range StatePrefixes.StatePrefixesList {
+		prefixCheckpoint := checkpoint.GetPrefix(prefix)
+		if prefixCheckpoint != nil && prefixCheckpoint.Completed {
+			continue
+		}
+
+		// Prefixes that weren't started have all of their entries deleted. Otherwise, we keep the
+		// entries up to the last received key and hash them the same way they were hashed when
+		// they were received.
+		var lastReceivedKey []byte
+		if prefixCheckpoint != nil {
+			lastReceivedKey = prefixCheckpoint.LastReceivedKey
+		}
+		var digest []byte
+		numEntries := uint64(0)
+		var keysToDelete [][]byte
+		err := handle.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				key := it.Item().KeyCopy(nil)
+				if lastReceivedKey == nil || bytes.Compare(key, lastReceivedKey) > 0 {
+					keysToDelete = append(keysToDelete, key)
+					continue
+				}
+				value, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				digest = UpdateHyperSyncPrefixDigest(digest, []*DBEntry{{Key: key, Value: value}})
+				numEntries++
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "DBRestoreHyperSyncCheckpointState: Problem iterating prefix (%v)", prefix)
+		}
+		if prefixCheckpoint != nil &&
+			(numEntries != prefixCheckpoint.NumEntries || !bytes.Equal(digest, prefixCheckpoint.Digest)) {
+			return fmt.Errorf("DBRestoreHyperSyncCheckpointState: Prefix (%v) has (%v) entries in the db that "+
+				"don't match the (%v) entries in the checkpoint", prefix, numEntries, prefixCheckpoint.NumEntries)
+		}
+
+		if len(keysToDelete) == 0 {
+			continue
+		}
+		glog.V(1).Infof("DBRestoreHyperSyncCheckpointState: Deleting (%v) entries received after the "+
+			"checkpoint for prefix (%v)", len(keysToDelete), prefix)
+		wb := handle.NewWriteBatch()
+		for _, key := range keysToDelete {
+			if err = wb.Delete(key); err != nil {
+				wb.Cancel()
+				return errors.Wrapf(err, "DBRestoreHyperSyncCheckpointState: Problem deleting key")
+			}
+		}
+		if err = wb.Flush(); err != nil {
+			return errors.Wrapf(err, "DBRestoreHyperSyncCheckpointState: Problem flushing deletes")
+		}
+	}
+	return nil
+}
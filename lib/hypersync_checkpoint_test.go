@@ -0,0 +1,100 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHyperSyncCheckpoint(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	completedPrefix := StatePrefixes.StatePrefixesList[0]
+	partialPrefix := StatePrefixes.StatePrefixesList[1]
+	absentPrefix := StatePrefixes.StatePrefixesList[2]
+	entry := func(prefix []byte, suffix byte) *DBEntry {
+		return &DBEntry{Key: append(append([]byte{}, prefix...), suffix), Value: []byte{suffix, suffix}}
+	}
+	received := []*DBEntry{entry(partialPrefix, 1), entry(partialPrefix, 2)}
+
+	checkpoint := &HyperSyncCheckpoint{
+		SnapshotMetadata: &SnapshotEpochMetadata{
+			SnapshotBlockHeight:       1000,
+			FirstSnapshotBlockHeight:  1000,
+			CurrentEpochChecksumBytes: []byte{1, 2, 3},
+			CurrentEpochBlockHash:     NewBlockHash(RandomBytes(HashSizeBytes)),
+		},
+		Prefixes: []*HyperSyncCheckpointPrefix{
+			{
+				Prefix:          completedPrefix,
+				LastReceivedKey: entry(completedPrefix, 1).Key,
+				Completed:       true,
+				NumEntries:      1,
+				Digest:          UpdateHyperSyncPrefixDigest(nil, []*DBEntry{entry(completedPrefix, 1)}),
+			},
+			{
+				Prefix:          partialPrefix,
+				LastReceivedKey: received[1].Key,
+				NumEntries:      2,
+				Digest:          UpdateHyperSyncPrefixDigest(nil, received),
+			},
+		},
+		ChecksumBytes: []byte{4, 5, 6},
+		Migrations: []*HyperSyncCheckpointMigration{
+			{BlockHeight: 2000, Version: 1, ChecksumBytes: []byte{7, 8}},
+		},
+	}
+
+	// The digest depends on the order of the entries.
+	require.NotEqual(checkpoint.Prefixes[1].Digest,
+		UpdateHyperSyncPrefixDigest(nil, []*DBEntry{received[1], received[0]}))
+
+	// The checkpoint round-trips through its encoding.
+	decodedCheckpoint := &HyperSyncCheckpoint{}
+	require.NoError(decodedCheckpoint.FromBytes(bytes.NewReader(checkpoint.ToBytes())))
+	require.Equal(checkpoint.ToBytes(), decodedCheckpoint.ToBytes())
+	require.Equal(uint64(2), decodedCheckpoint.GetPrefix(partialPrefix).NumEntries)
+	require.Nil(decodedCheckpoint.GetPrefix(absentPrefix))
+
+	// Entries received after the checkpoint was saved are deleted, and everything the
+	// checkpoint covers is kept.
+	entries := []*DBEntry{
+		entry(completedPrefix, 1), received[0], received[1], entry(partialPrefix, 3), entry(absentPrefix, 1),
+	}
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		for _, dbEntry := range entries {
+			if err := txn.Set(dbEntry.Key, dbEntry.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(DBRestoreHyperSyncCheckpointState(db, checkpoint))
+	for ii, dbEntry := range entries {
+		var value []byte
+		err := db.View(func(txn *badger.Txn) error {
+			var innerErr error
+			value, innerErr = DBGetWithTxn(txn, nil, dbEntry.Key)
+			return innerErr
+		})
+		if ii < 3 {
+			require.NoError(err)
+			require.Equal(dbEntry.Value, value)
+		} else {
+			require.Equal(badger.ErrKeyNotFound, err)
+		}
+	}
+
+	// A partially downloaded prefix that doesn't match its digest can't be resumed from.
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return txn.Set(received[0].Key, []byte{9})
+	}))
+	require.Error(DBRestoreHyperSyncCheckpointState(db, checkpoint))
+}
@@ -0,0 +1,266 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// HyperSync used to download the whole state from a single peer, one chunk at a time, so it was
+// bound by that peer's round trips and took hours on mainnet. It also stalled whenever the peer
+// went away, until a new sync peer sent us headers.
+//
+// The state prefixes are now spread across up to hyperSyncMaxPeers connected peers that support
+// hypersync. Each peer downloads up to hyperSyncMaxRequestsPerPeer prefixes at once, with one
+// chunk request in flight per prefix, and the operationQueueSemaphore still bounds the chunks
+// in memory overall. A prefix is still downloaded in order, since each chunk starts at the last
+// key of the previous one, so the per-prefix digests, chunk verifiers, and checkpoints work as
+// before. The state checksum is a sum, so the order in which prefixes complete doesn't matter.
+//
+// When a peer disconnects, including when it doesn't answer a GetSnapshot in time, its prefixes
+// are handed to the other peers, which pick up from the last received key. Peers that connect
+// while we're syncing are given prefixes as well. Chunks from a peer that a prefix is no longer
+// assigned to are dropped.
+//
+// A chunk request only takes a slot in the operationQueueSemaphore once the semaphore has room,
+// so each prefix tracks its request in flight. Releasing the prefix frees the slot if the request
+// got one, or cancels the request if it's still waiting, and a chunk frees the slot of the request
+// it answers. That way a slot is freed exactly once for every slot taken.
+
+const (
+	DefaultHyperSyncMaxPeers           = 8
+	DefaultHyperSyncMaxRequestsPerPeer = 2
+)
+
+// SetHyperSyncPeerLimits sets the number of peers we download the snapshot from at once, and
+// the number of prefixes each of them downloads at once. Setting both to one downloads the
+// prefixes one after the other from a single peer.
+func (srv *Server) SetHyperSyncPeerLimits(maxPeers int, maxRequestsPerPeer int) error {
+	if maxPeers < 1 || maxRequestsPerPeer < 1 {
+		return fmt.Errorf("SetHyperSyncPeerLimits: Max peers (%d) and max requests per peer (%d) "+
+			"must be at least one", maxPeers, maxRequestsPerPeer)
+	}
+	srv.hyperSyncMaxPeers = maxPeers
+	srv.hyperSyncMaxRequestsPerPeer = maxRequestsPerPeer
+	return nil
+}
+
+// isHyperSyncInProgress returns true if we've started downloading the snapshot.
+func (srv *Server) isHyperSyncInProgress() bool {
+	return srv.cmgr.HyperSync && srv.blockchain.ChainState() == SyncStateSyncingSnapshot &&
+		srv.HyperSyncProgress.SnapshotMetadata != nil && len(srv.HyperSyncProgress.PrefixProgress) != 0
+}
+
+// isHyperSyncPeer returns true if we can download the snapshot from the peer.
+func (srv *Server) isHyperSyncPeer(pp *Peer) bool {
+	if pp == nil || !pp.Connected() {
+		return false
+	}
+	// If connectIps is set, only sync from persistent peers.
+	if len(srv.connectIps) > 0 && !pp.IsPersistent() {
+		return false
+	}
+	pp.PeerInfoMtx.Lock()
+	supportsHyperSync := (pp.serviceFlags & SFHyperSync) != 0
+	pp.PeerInfoMtx.Unlock()
+	return supportsHyperSync && pp.StartingBlockHeight() >= srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight
+}
+
+// getHyperSyncPeers returns the peers to download the snapshot from: the ones that are already
+// downloading a prefix, then pp, then other connected peers from the best score to the worst,
+// up to hyperSyncMaxPeers.
+func (srv *Server) getHyperSyncPeers(pp *Peer) []*Peer {
+	var peers []*Peer
+	peerIds := make(map[uint64]bool)
+	addPeer := func(peer *Peer) {
+		if len(peers) >= srv.hyperSyncMaxPeers || peer == nil || peerIds[peer.ID] || !srv.isHyperSyncPeer(peer) {
+			return
+		}
+		peers = append(peers, peer)
+		peerIds[peer.ID] = true
+	}
+	for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
+		if !prefixProgress.Completed {
+			addPeer(prefixProgress.PrefixSyncPeer)
+		}
+	}
+	// The peer we got the headers from has the snapshot, even if it hasn't told us its height.
+	if pp != nil && pp.Connected() && len(peers) < srv.hyperSyncMaxPeers && !peerIds[pp.ID] {
+		peers = append(peers, pp)
+		peerIds[pp.ID] = true
+	}
+	otherPeers := srv.cmgr.GetAllPeers()
+	peerScores := make(map[uint64]int64)
+	for _, peer := range otherPeers {
+		peerScores[peer.ID] = srv.cmgr.GetPeerScoreValue(peer)
+	}
+	sort.SliceStable(otherPeers, func(ii, jj int) bool {
+		return peerScores[otherPeers[ii].ID] > peerScores[otherPeers[jj].ID]
+	})
+	for _, peer := range otherPeers {
+		addPeer(peer)
+	}
+	return peers
+}
+
+// GetSnapshot hands the prefixes that no peer is downloading to pp and the other peers we can
+// hypersync from, and requests their next chunks.
+func (srv *Server) GetSnapshot(pp *Peer) {
+	// Prefixes assigned to a peer that went away are up for grabs.
+	for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
+		if prefixProgress.PrefixSyncPeer != nil && !prefixProgress.PrefixSyncPeer.Connected() {
+			srv.releaseHyperSyncPrefixes(prefixProgress.PrefixSyncPeer)
+		}
+	}
+
+	peers := srv.getHyperSyncPeers(pp)
+	numRequestsByPeer := make(map[uint64]int)
+	for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
+		if !prefixProgress.Completed && prefixProgress.PrefixSyncPeer != nil {
+			numRequestsByPeer[prefixProgress.PrefixSyncPeer.ID]++
+		}
+	}
+
+	for _, prefix := range StatePrefixes.StatePrefixesList {
+		var syncPrefixProgress *SyncPrefixProgress
+		for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
+			if bytes.Equal(prefix, prefixProgress.Prefix) {
+				syncPrefixProgress = prefixProgress
+				break
+			}
+		}
+		if syncPrefixProgress != nil && (syncPrefixProgress.Completed || syncPrefixProgress.PrefixSyncPeer != nil) {
+			continue
+		}
+
+		// Pick the peer with the fewest prefixes, preferring the peers that come first.
+		var syncPeer *Peer
+		for _, peer := range peers {
+			if numRequestsByPeer[peer.ID] >= srv.hyperSyncMaxRequestsPerPeer {
+				continue
+			}
+			if syncPeer == nil || numRequestsByPeer[peer.ID] < numRequestsByPeer[syncPeer.ID] {
+				syncPeer = peer
+			}
+		}
+		if syncPeer == nil {
+			break
+		}
+
+		if syncPrefixProgress == nil {
+			syncPrefixProgress = &SyncPrefixProgress{
+				Prefix:          prefix,
+				LastReceivedKey: prefix,
+				Completed:       false,
+			}
+			srv.HyperSyncProgress.PrefixProgress = append(srv.HyperSyncProgress.PrefixProgress, syncPrefixProgress)
+		} else {
+			glog.V(1).Infof("Server.GetSnapshot: Resuming prefix (%v) from peer (%v)", prefix, syncPeer)
+		}
+		syncPrefixProgress.PrefixSyncPeer = syncPeer
+		numRequestsByPeer[syncPeer.ID]++
+		srv.requestSnapshotChunk(syncPeer, syncPrefixProgress)
+	}
+}
+
+// hyperSyncChunkRequest is a GetSnapshot request that's waiting for a slot in the
+// operationQueueSemaphore or for its chunk.
+type hyperSyncChunkRequest struct {
+	mtx        sync.Mutex
+	acquired   bool
+	cancelled  bool
+	cancelChan chan struct{}
+}
+
+// release frees the request's slot in the operationQueueSemaphore if it got one, and otherwise
+// keeps it from taking one. It's a no-op on a nil or already released request.
+func (request *hyperSyncChunkRequest) release(snap *Snapshot) {
+	if request == nil {
+		return
+	}
+	request.mtx.Lock()
+	if request.cancelled {
+		request.mtx.Unlock()
+		return
+	}
+	request.cancelled = true
+	acquired := request.acquired
+	request.mtx.Unlock()
+
+	close(request.cancelChan)
+	if acquired {
+		snap.FreeOperationQueueSemaphore()
+	}
+}
+
+// requestSnapshotChunk requests the chunk of the prefix that starts at its last received key.
+func (srv *Server) requestSnapshotChunk(pp *Peer, syncPrefixProgress *SyncPrefixProgress) {
+	// Start the timer to measure how much time passes from a GetSnapshot msg to
+	// a SnapshotData message.
+	srv.timer.Start("Get Snapshot")
+
+	prefix := syncPrefixProgress.Prefix
+	lastReceivedKey := syncPrefixProgress.LastReceivedKey
+	request := &hyperSyncChunkRequest{cancelChan: make(chan struct{})}
+	syncPrefixProgress.chunkRequest.release(srv.snapshot)
+	syncPrefixProgress.chunkRequest = request
+	// As a pace-setting mechanism, we enqueue to the operationQueueSemaphore in a go routine. The request will be blocked
+	// if there are too many requests in memory.
+	go func() {
+		select {
+		case srv.snapshot.operationQueueSemaphore <- struct{}{}:
+		case <-request.cancelChan:
+			return
+		}
+		request.mtx.Lock()
+		if request.cancelled {
+			// The prefix was released while we were waiting, so give the slot back.
+			request.mtx.Unlock()
+			srv.snapshot.FreeOperationQueueSemaphore()
+			return
+		}
+		request.acquired = true
+		request.mtx.Unlock()
+
+		// Now send a message to the peer to fetch the snapshot chunk.
+		glog.V(2).Infof("Server.requestSnapshotChunk: Sending a GetSnapshot message to peer (%v) "+
+			"with Prefix (%v) and SnapshotStartEntry (%v)", pp, prefix, lastReceivedKey)
+		pp.AddDeSoMessage(&MsgDeSoGetSnapshot{
+			SnapshotStartKey: lastReceivedKey,
+		}, false)
+	}()
+}
+
+// releaseHyperSyncPrefixes unassigns the prefixes the peer was downloading, and returns the
+// number of prefixes released.
+func (srv *Server) releaseHyperSyncPrefixes(pp *Peer) int {
+	numReleased := 0
+	for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
+		if prefixProgress.Completed || prefixProgress.PrefixSyncPeer == nil || prefixProgress.PrefixSyncPeer.ID != pp.ID {
+			continue
+		}
+		prefixProgress.PrefixSyncPeer = nil
+		// The peer won't answer the request, so give up its slot in the operationQueueSemaphore.
+		prefixProgress.chunkRequest.release(srv.snapshot)
+		prefixProgress.chunkRequest = nil
+		numReleased++
+	}
+	return numReleased
+}
+
+// failOverHyperSyncPeer hands the prefixes of a peer that disconnected to the other peers.
+func (srv *Server) failOverHyperSyncPeer(pp *Peer) {
+	if !srv.isHyperSyncInProgress() {
+		return
+	}
+	if numReleased := srv.releaseHyperSyncPrefixes(pp); numReleased > 0 {
+		glog.Infof(CLog(Yellow, fmt.Sprintf("Server.failOverHyperSyncPeer: Peer (%v) disconnected while "+
+			"downloading (%v) prefixes, handing them to other peers", pp, numReleased)))
+		srv.GetSnapshot(nil)
+	}
+}
@@ -0,0 +1,275 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func _newHyperSyncTestPeer(id uint64, serviceFlags ServiceFlag, latestHeight uint64) *Peer {
+	return &Peer{ID: id, serviceFlags: serviceFlags, latestHeight: latestHeight}
+}
+
+// _newHyperSyncTestServer returns a server that's syncing the snapshot at height 10 with room for
+// semaphoreSize chunks in memory.
+func _newHyperSyncTestServer(t *testing.T, semaphoreSize int, maxPeers int, maxRequestsPerPeer int,
+	peers ...*Peer) *Server {
+
+	connectedPeers := make(map[uint64]*Peer)
+	for _, peer := range peers {
+		connectedPeers[peer.ID] = peer
+	}
+	srv := &Server{
+		cmgr: &ConnectionManager{HyperSync: true, connectedPeers: connectedPeers},
+		blockchain: &Blockchain{
+			bestHeaderChain:    []*BlockNode{{Height: 10}},
+			MaxSyncBlockHeight: 10,
+			syncingState:       true,
+		},
+		snapshot: &Snapshot{operationQueueSemaphore: make(chan struct{}, semaphoreSize)},
+		timer:    &Timer{},
+		HyperSyncProgress: SyncProgress{
+			SnapshotMetadata: &SnapshotEpochMetadata{SnapshotBlockHeight: 10, CurrentEpochBlockHash: &BlockHash{1}},
+		},
+	}
+	require.NoError(t, srv.SetHyperSyncPeerLimits(maxPeers, maxRequestsPerPeer))
+	return srv
+}
+
+// _waitForSnapshotRequests waits for the peer to be sent numRequests GetSnapshot messages and
+// returns their start keys. The requests to a peer are sent concurrently, so they can be in any
+// order.
+func _waitForSnapshotRequests(t *testing.T, pp *Peer, numRequests int) [][]byte {
+	var startKeys [][]byte
+	require.Eventually(t, func() bool {
+		for msg := pp.MaybeDequeueDeSoMessage(); msg != nil; msg = pp.MaybeDequeueDeSoMessage() {
+			startKeys = append(startKeys, msg.DeSoMessage.(*MsgDeSoGetSnapshot).SnapshotStartKey)
+		}
+		return len(startKeys) >= numRequests
+	}, time.Second, time.Millisecond)
+	require.Len(t, startKeys, numRequests)
+	return startKeys
+}
+
+func _getSyncPeerIDs(srv *Server) []uint64 {
+	var peerIDs []uint64
+	for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
+		peerID := uint64(0)
+		if prefixProgress.PrefixSyncPeer != nil {
+			peerID = prefixProgress.PrefixSyncPeer.ID
+		}
+		peerIDs = append(peerIDs, peerID)
+	}
+	return peerIDs
+}
+
+func TestGetSnapshotAssignsPrefixesToPeers(t *testing.T) {
+	require := require.New(t)
+
+	// Peer 3 doesn't support hypersync and peer 4 doesn't have the snapshot yet.
+	peer1 := _newHyperSyncTestPeer(1, SFHyperSync, 10)
+	peer2 := _newHyperSyncTestPeer(2, SFHyperSync, 10)
+	peer3 := _newHyperSyncTestPeer(3, 0, 10)
+	peer4 := _newHyperSyncTestPeer(4, SFHyperSync, 5)
+	srv := _newHyperSyncTestServer(t, 10, 3, 2, peer1, peer2, peer3, peer4)
+
+	// Each peer gets up to two prefixes, spread evenly starting with the peer we got the headers from.
+	srv.GetSnapshot(peer1)
+	prefixes := StatePrefixes.StatePrefixesList
+	require.Equal([]uint64{1, 2, 1, 2}, _getSyncPeerIDs(srv))
+	require.ElementsMatch([][]byte{prefixes[0], prefixes[2]}, _waitForSnapshotRequests(t, peer1, 2))
+	require.ElementsMatch([][]byte{prefixes[1], prefixes[3]}, _waitForSnapshotRequests(t, peer2, 2))
+	require.Nil(peer3.MaybeDequeueDeSoMessage())
+	require.Nil(peer4.MaybeDequeueDeSoMessage())
+	require.Len(srv.snapshot.operationQueueSemaphore, 4)
+
+	// Calling GetSnapshot again doesn't request prefixes that are already being downloaded.
+	srv.GetSnapshot(peer1)
+	require.Equal([]uint64{1, 2, 1, 2}, _getSyncPeerIDs(srv))
+	require.Nil(peer1.MaybeDequeueDeSoMessage())
+	require.Len(srv.snapshot.operationQueueSemaphore, 4)
+}
+
+func TestHyperSyncFailover(t *testing.T) {
+	require := require.New(t)
+
+	peer1 := _newHyperSyncTestPeer(1, SFHyperSync, 10)
+	peer2 := _newHyperSyncTestPeer(2, SFHyperSync, 10)
+	srv := _newHyperSyncTestServer(t, 4, 2, 2, peer1, peer2)
+	srv.GetSnapshot(peer1)
+	_waitForSnapshotRequests(t, peer1, 2)
+	_waitForSnapshotRequests(t, peer2, 2)
+	require.Len(srv.snapshot.operationQueueSemaphore, 4)
+
+	// Peer 1 got part of its first prefix before it disconnected, and peer 3 connects.
+	prefixes := StatePrefixes.StatePrefixesList
+	lastReceivedKey := append(append([]byte{}, prefixes[0]...), 1, 2, 3)
+	srv.HyperSyncProgress.PrefixProgress[0].LastReceivedKey = lastReceivedKey
+	atomic.StoreInt32(&peer1.disconnected, 1)
+	peer3 := _newHyperSyncTestPeer(3, SFHyperSync, 10)
+	srv.cmgr.connectedPeers[peer3.ID] = peer3
+
+	// Peer 1's prefixes and slots go to peer 3, which picks up from the last received key.
+	srv.failOverHyperSyncPeer(peer1)
+	require.Equal([]uint64{3, 2, 3, 2}, _getSyncPeerIDs(srv))
+	require.ElementsMatch([][]byte{lastReceivedKey, prefixes[2]}, _waitForSnapshotRequests(t, peer3, 2))
+	require.Len(srv.snapshot.operationQueueSemaphore, 4)
+
+	// Failing over a peer that isn't downloading anything doesn't free any slots.
+	srv.failOverHyperSyncPeer(peer1)
+	require.Len(srv.snapshot.operationQueueSemaphore, 4)
+}
+
+func TestReleaseHyperSyncPrefixesCancelsPendingRequests(t *testing.T) {
+	require := require.New(t)
+
+	// The semaphore is full, so the request to peer 1 waits for a slot.
+	peer1 := _newHyperSyncTestPeer(1, SFHyperSync, 10)
+	srv := _newHyperSyncTestServer(t, 1, 1, 1, peer1)
+	srv.snapshot.operationQueueSemaphore <- struct{}{}
+	srv.GetSnapshot(peer1)
+	require.Equal([]uint64{1}, _getSyncPeerIDs(srv))
+	require.Never(func() bool { return peer1.MaybeDequeueDeSoMessage() != nil }, 50*time.Millisecond, time.Millisecond)
+
+	// Peer 1 disconnects before its request gets a slot. Releasing its prefix doesn't free the
+	// slot of the chunk that's in memory, and the prefix goes to peer 2, which waits as well.
+	atomic.StoreInt32(&peer1.disconnected, 1)
+	peer2 := _newHyperSyncTestPeer(2, SFHyperSync, 10)
+	srv.cmgr.connectedPeers[peer2.ID] = peer2
+	srv.failOverHyperSyncPeer(peer1)
+	require.Equal([]uint64{2}, _getSyncPeerIDs(srv))
+	require.Len(srv.snapshot.operationQueueSemaphore, 1)
+
+	// Once the chunk in memory is processed, peer 2's request takes its slot rather than peer 1's.
+	srv.snapshot.FreeOperationQueueSemaphore()
+	require.Equal([][]byte{StatePrefixes.StatePrefixesList[0]}, _waitForSnapshotRequests(t, peer2, 1))
+	require.Len(srv.snapshot.operationQueueSemaphore, 1)
+}
+
+func TestHandleSnapshotDropsStaleChunks(t *testing.T) {
+	require := require.New(t)
+
+	peer1 := _newHyperSyncTestPeer(1, SFHyperSync, 10)
+	peer2 := _newHyperSyncTestPeer(2, SFHyperSync, 10)
+	srv := _newHyperSyncTestServer(t, 4, 1, 1, peer1)
+	srv.GetSnapshot(peer1)
+	_waitForSnapshotRequests(t, peer1, 1)
+	// Another chunk is in memory as well.
+	srv.snapshot.operationQueueSemaphore <- struct{}{}
+	require.Len(srv.snapshot.operationQueueSemaphore, 2)
+
+	prefix := StatePrefixes.StatePrefixesList[0]
+	prefixProgress := srv.HyperSyncProgress.PrefixProgress[0]
+	chunk := &MsgDeSoSnapshotData{
+		SnapshotMetadata: srv.HyperSyncProgress.SnapshotMetadata,
+		SnapshotChunk: []*DBEntry{
+			{Key: append(append([]byte{}, prefix...), 1), Value: []byte{1}},
+		},
+		SnapshotChunkFull: true,
+		Prefix:            prefix,
+	}
+
+	// A chunk from a peer the prefix isn't assigned to is dropped without touching the semaphore.
+	srv._handleSnapshot(peer2, chunk)
+	require.Equal(prefix, prefixProgress.LastReceivedKey)
+	require.Len(srv.snapshot.operationQueueSemaphore, 2)
+	require.True(peer2.Connected())
+
+	// Once peer 1 disconnects, its slot is freed, and the chunk it sent before it went away is
+	// dropped without freeing the slot of the other chunk.
+	atomic.StoreInt32(&peer1.disconnected, 1)
+	srv.failOverHyperSyncPeer(peer1)
+	require.Nil(prefixProgress.PrefixSyncPeer)
+	require.Len(srv.snapshot.operationQueueSemaphore, 1)
+	srv._handleSnapshot(peer1, chunk)
+	require.Equal(prefix, prefixProgress.LastReceivedKey)
+	require.Len(srv.snapshot.operationQueueSemaphore, 1)
+}
+
+func TestHandleSnapshotAdversarialChunkCommitment(t *testing.T) {
+	require := require.New(t)
+
+	// Peer 1 is adversarial and is the first to send a chunk, and peer 2 is honest.
+	peer1 := _newHyperSyncTestPeer(1, SFHyperSync, 10)
+	peer2 := _newHyperSyncTestPeer(2, SFHyperSync, 10)
+	srv := _newHyperSyncTestServer(t, 10, 2, 1, peer1, peer2)
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	srv.snapshot.OperationChannel = &SnapshotOperationChannel{}
+	require.NoError(srv.snapshot.OperationChannel.Initialize(db, &sync.Mutex{}, nil, nil))
+	srv.GetSnapshot(peer1)
+	require.Equal([]uint64{1, 2}, _getSyncPeerIDs(srv))
+	_waitForSnapshotRequests(t, peer1, 1)
+	_waitForSnapshotRequests(t, peer2, 1)
+
+	// Each peer commits to a tree over the first two prefixes, but peer 1 lies about the values.
+	prefixes := [][]byte{StatePrefixes.StatePrefixesList[0], StatePrefixes.StatePrefixesList[1]}
+	makeTree := func(value byte) (*snapshotChunkTree, map[string][]*DBEntry) {
+		sortedPrefixes := append([][]byte{}, prefixes...)
+		sort.Slice(sortedPrefixes, func(ii, jj int) bool {
+			return bytes.Compare(sortedPrefixes[ii], sortedPrefixes[jj]) < 0
+		})
+		entriesByPrefix := make(map[string][]*DBEntry)
+		builder := &snapshotChunkLeafBuilder{}
+		for _, prefix := range sortedPrefixes {
+			for ii := byte(1); ii <= 3; ii++ {
+				entry := &DBEntry{Key: append(append([]byte{}, prefix...), ii), Value: []byte{value, ii}}
+				entriesByPrefix[string(prefix)] = append(entriesByPrefix[string(prefix)], entry)
+				builder.addEntry(prefix, entry)
+			}
+			builder.finishPrefix()
+		}
+		tree, err := newSnapshotChunkTree(10, &BlockHash{1}, builder.leaves, builder.lastKeys)
+		require.NoError(err)
+		return tree, entriesByPrefix
+	}
+	adversarialTree, adversarialEntries := makeTree(1)
+	honestTree, honestEntries := makeTree(2)
+	makeChunk := func(tree *snapshotChunkTree, entriesByPrefix map[string][]*DBEntry, prefix []byte) *MsgDeSoSnapshotData {
+		entries := entriesByPrefix[string(prefix)]
+		return &MsgDeSoSnapshotData{
+			SnapshotMetadata: &SnapshotEpochMetadata{
+				SnapshotBlockHeight:   10,
+				CurrentEpochBlockHash: &BlockHash{1},
+				ChunkCommitment:       tree.commitment,
+			},
+			SnapshotChunk:     entries,
+			SnapshotChunkFull: true,
+			Prefix:            prefix,
+			ChunkProofs:       tree.getProofs(prefix, prefix, entries, true),
+		}
+	}
+
+	// Peer 1's commitment is locked in, since its chunk is consistent with it.
+	srv._handleSnapshot(peer1, makeChunk(adversarialTree, adversarialEntries, prefixes[0]))
+	require.True(adversarialTree.commitment.Equal(srv.HyperSyncProgress.SnapshotMetadata.ChunkCommitment))
+	require.NotNil(srv.HyperSyncProgress.PrefixProgress[0].ChunkVerifier)
+	_waitForSnapshotRequests(t, peer1, 1)
+
+	// Peer 2's chunk doesn't match the commitment, but we can't tell which peer is lying, so
+	// peer 2 isn't penalized. The commitment is reset and the chunk is re-fetched.
+	honestChunk := makeChunk(honestTree, honestEntries, prefixes[1])
+	srv._handleSnapshot(peer2, honestChunk)
+	require.True(peer2.Connected())
+	require.Nil(srv.HyperSyncProgress.SnapshotMetadata.ChunkCommitment)
+	require.Nil(srv.HyperSyncProgress.PrefixProgress[0].ChunkVerifier)
+	require.Equal(prefixes[1], srv.HyperSyncProgress.PrefixProgress[1].LastReceivedKey)
+	require.Equal([][]byte{prefixes[1]}, _waitForSnapshotRequests(t, peer2, 1))
+
+	// The re-fetched chunk locks in peer 2's commitment and is verified against it.
+	srv._handleSnapshot(peer2, honestChunk)
+	require.True(peer2.Connected())
+	require.True(honestTree.commitment.Equal(srv.HyperSyncProgress.SnapshotMetadata.ChunkCommitment))
+	require.NotNil(srv.HyperSyncProgress.PrefixProgress[1].ChunkVerifier)
+	honestPrefixEntries := honestEntries[string(prefixes[1])]
+	require.Equal(honestPrefixEntries[len(honestPrefixEntries)-1].Key,
+		srv.HyperSyncProgress.PrefixProgress[1].LastReceivedKey)
+	_waitForSnapshotRequests(t, peer2, 1)
+}
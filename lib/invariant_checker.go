@@ -0,0 +1,417 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// The InvariantChecker is an optional background job that walks the committed state
+// on a rolling basis and checks that entries which are maintained separately still
+// agree with each other. Each check walks a single db prefix and only reads a batch of
+// entries per run, so a full pass over mainnet state is spread over many runs and
+// never holds up block processing. A violation means the state was corrupted by a bug,
+// so it's logged as a structured alert, kept for the node's APIs, and optionally
+// posted to the configured alert URLs.
+//
+// Each batch is read in a single badger txn, so it sees a consistent snapshot of the
+// committed state even while blocks are being connected. The checker reads the db
+// directly and doesn't support Postgres.
+
+const (
+	DefaultInvariantCheckerIntervalSeconds = 60
+	DefaultInvariantCheckerBatchSize       = 100
+
+	// maxRecentInvariantViolations is the number of violations the checker keeps
+	// around for GetRecentViolations.
+	maxRecentInvariantViolations = 1000
+)
+
+// InvariantViolation is the structured alert raised when a check fails.
+type InvariantViolation struct {
+	// Invariant is the Name of the InvariantCheck that failed.
+	Invariant string
+	// Key is the hex-encoded db key of the entry the violation was found at.
+	Key     string
+	Details string
+	// BlockTipHeight is the height of the block tip when the violation was found.
+	BlockTipHeight uint64
+	TimestampSecs  uint64
+}
+
+// InvariantCheck validates every entry under a single db prefix.
+type InvariantCheck struct {
+	Name   string
+	Prefix []byte
+	// Check validates the entry stored at key and returns a description of each
+	// violation it finds. It should only return an error if the db can't be read.
+	Check func(txn *badger.Txn, key []byte, value []byte) (_violations []string, _err error)
+}
+
+// DefaultInvariantChecks returns the checks the InvariantChecker runs by default.
+//
+// Note that DAO coin limit orders aren't escrowed, so an order that sells more than
+// its transactor holds isn't a violation: it's cancelled when it's matched. The order
+// book check verifies that each order agrees across the indexes it's stored in instead.
+func DefaultInvariantChecks() []*InvariantCheck {
+	return []*InvariantCheck{
+		{
+			Name:   "CoinSupply",
+			Prefix: Prefixes.PrefixPKIDToProfileEntry,
+			Check:  checkCoinSupplyInvariant,
+		},
+		{
+			Name:   "FollowedToFollowerIndex",
+			Prefix: Prefixes.PrefixFollowedPKIDToFollowerPKID,
+			Check:  checkFollowedToFollowerInvariant,
+		},
+		{
+			Name:   "FollowerToFollowedIndex",
+			Prefix: Prefixes.PrefixFollowerPKIDToFollowedPKID,
+			Check:  checkFollowerToFollowedInvariant,
+		},
+		{
+			Name:   "DAOCoinLimitOrderIndex",
+			Prefix: Prefixes.PrefixDAOCoinLimitOrderByOrderID,
+			Check:  checkDAOCoinLimitOrderInvariant,
+		},
+	}
+}
+
+// checkCoinSupplyInvariant checks a profile's creator coin and DAO coin entries against
+// the balance entries for the coins. A creator coin's CoinsInCirculationNanos must equal
+// the sum of its holders' balances. DAO coins can also be held in LockedBalanceEntries,
+// which are indexed by holder, so a DAO coin's unlocked balances must only not exceed its
+// CoinsInCirculationNanos. In both cases NumberOfHolders must equal the number of
+// non-zero unlocked balances.
+func checkCoinSupplyInvariant(txn *badger.Txn, key []byte, value []byte) ([]string, error) {
+	profilePKID := &PKID{}
+	copy(profilePKID[:], key[len(Prefixes.PrefixPKIDToProfileEntry):])
+	profileEntry := &ProfileEntry{}
+	if exists, err := DecodeFromBytes(profileEntry, bytes.NewReader(value)); err != nil {
+		return nil, errors.Wrapf(err, "checkCoinSupplyInvariant: Problem decoding profile for %v", profilePKID)
+	} else if !exists {
+		return nil, nil
+	}
+
+	var violations []string
+	for _, isDAOCoin := range []bool{false, true} {
+		coinEntry := &profileEntry.CreatorCoinEntry
+		coinType := "creator coin"
+		if isDAOCoin {
+			coinEntry = &profileEntry.DAOCoinEntry
+			coinType = "DAO coin"
+		}
+
+		balancePrefix := append([]byte{}, _dbGetPrefixForCreatorPKIDHODLerPKIDToBalanceEntry(isDAOCoin)...)
+		balancePrefix = append(balancePrefix, profilePKID[:]...)
+		_, balanceEntryBytes, err := _enumerateKeysForPrefixWithTxn(txn, balancePrefix, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "checkCoinSupplyInvariant: Problem reading balances for %v", profilePKID)
+		}
+		totalBalanceNanos := uint256.NewInt()
+		numberOfHolders := uint64(0)
+		for _, entryBytes := range balanceEntryBytes {
+			balanceEntry := &BalanceEntry{}
+			if exists, err := DecodeFromBytes(balanceEntry, bytes.NewReader(entryBytes)); err != nil {
+				return nil, errors.Wrapf(err, "checkCoinSupplyInvariant: Problem decoding balance for %v", profilePKID)
+			} else if !exists || balanceEntry.BalanceNanos.IsZero() {
+				continue
+			}
+			numberOfHolders++
+			newTotalBalanceNanos, err := SafeUint256().Add(totalBalanceNanos, &balanceEntry.BalanceNanos)
+			if err != nil {
+				violations = append(violations, fmt.Sprintf("%s balances overflow", coinType))
+				break
+			}
+			totalBalanceNanos = newTotalBalanceNanos
+		}
+
+		if !isDAOCoin && !totalBalanceNanos.Eq(&coinEntry.CoinsInCirculationNanos) {
+			violations = append(violations, fmt.Sprintf("%s balances total %v but CoinsInCirculationNanos is %v",
+				coinType, totalBalanceNanos.Hex(), coinEntry.CoinsInCirculationNanos.Hex()))
+		}
+		if isDAOCoin && totalBalanceNanos.Gt(&coinEntry.CoinsInCirculationNanos) {
+			violations = append(violations, fmt.Sprintf("%s balances total %v which exceeds CoinsInCirculationNanos %v",
+				coinType, totalBalanceNanos.Hex(), coinEntry.CoinsInCirculationNanos.Hex()))
+		}
+		if numberOfHolders != coinEntry.NumberOfHolders {
+			violations = append(violations, fmt.Sprintf("%s has %d holders but NumberOfHolders is %d",
+				coinType, numberOfHolders, coinEntry.NumberOfHolders))
+		}
+	}
+	return violations, nil
+}
+
+// checkFollowedToFollowerInvariant checks that a follow in the followed-to-follower index
+// is also in the follower-to-followed index, so that a profile's follower count agrees
+// with the follows its followers see.
+func checkFollowedToFollowerInvariant(txn *badger.Txn, key []byte, value []byte) ([]string, error) {
+	followedPKID, followerPKID, err := _decodeFollowIndexKey(key)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	return _checkFollowIndexKeyExists(txn, _dbKeyForFollowerToFollowedMapping(followerPKID, followedPKID),
+		"follower-to-followed")
+}
+
+// checkFollowerToFollowedInvariant is the reverse of checkFollowedToFollowerInvariant.
+func checkFollowerToFollowedInvariant(txn *badger.Txn, key []byte, value []byte) ([]string, error) {
+	followerPKID, followedPKID, err := _decodeFollowIndexKey(key)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	return _checkFollowIndexKeyExists(txn, _dbKeyForFollowedToFollowerMapping(followedPKID, followerPKID),
+		"followed-to-follower")
+}
+
+func _decodeFollowIndexKey(key []byte) (_firstPKID *PKID, _secondPKID *PKID, _err error) {
+	if len(key) != 1+2*PublicKeyLenCompressed {
+		return nil, nil, fmt.Errorf("follow index key has length %d", len(key))
+	}
+	firstPKID := &PKID{}
+	copy(firstPKID[:], key[1:1+PublicKeyLenCompressed])
+	secondPKID := &PKID{}
+	copy(secondPKID[:], key[1+PublicKeyLenCompressed:])
+	return firstPKID, secondPKID, nil
+}
+
+func _checkFollowIndexKeyExists(txn *badger.Txn, key []byte, indexName string) ([]string, error) {
+	_, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return []string{fmt.Sprintf("follow is missing from the %s index", indexName)}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "_checkFollowIndexKeyExists: ")
+	}
+	return nil, nil
+}
+
+// checkDAOCoinLimitOrderInvariant checks that an order is stored identically in the order
+// book and transactor indexes as in the order ID index, and that it has something left
+// to fill.
+func checkDAOCoinLimitOrderInvariant(txn *badger.Txn, key []byte, value []byte) ([]string, error) {
+	order := &DAOCoinLimitOrderEntry{}
+	if exists, err := DecodeFromBytes(order, bytes.NewReader(value)); !exists || err != nil {
+		return []string{fmt.Sprintf("order can't be decoded: %v", err)}, nil
+	}
+
+	var violations []string
+	if order.QuantityToFillInBaseUnits == nil || order.QuantityToFillInBaseUnits.IsZero() {
+		violations = append(violations, "order has zero quantity to fill")
+	}
+	for indexName, indexKey := range map[string][]byte{
+		"order book": DBKeyForDAOCoinLimitOrder(order),
+		"transactor": DBKeyForDAOCoinLimitOrderByTransactorPKID(order),
+	} {
+		item, err := txn.Get(indexKey)
+		if err == badger.ErrKeyNotFound {
+			violations = append(violations, fmt.Sprintf("order is missing from the %s index", indexName))
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "checkDAOCoinLimitOrderInvariant: ")
+		}
+		indexValue, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "checkDAOCoinLimitOrderInvariant: ")
+		}
+		if !bytes.Equal(indexValue, value) {
+			violations = append(violations, fmt.Sprintf("order in the %s index doesn't match", indexName))
+		}
+	}
+	return violations, nil
+}
+
+type InvariantChecker struct {
+	db         *badger.DB
+	bc         *Blockchain
+	checks     []*InvariantCheck
+	interval   time.Duration
+	batchSize  int
+	alertURLs  []string
+	httpClient *http.Client
+
+	// cursors holds the last key each check validated, keyed by check name. A check
+	// starts a new pass from the beginning of its prefix when it has no cursor.
+	cursors map[string][]byte
+
+	recentViolations     []*InvariantViolation
+	recentViolationsLock sync.RWMutex
+
+	stopChannel chan struct{}
+	waitGroup   sync.WaitGroup
+}
+
+func NewInvariantChecker(bc *Blockchain, checks []*InvariantCheck, intervalSeconds uint64, batchSize uint64,
+	alertURLs []string) *InvariantChecker {
+
+	if intervalSeconds == 0 {
+		intervalSeconds = DefaultInvariantCheckerIntervalSeconds
+	}
+	if batchSize == 0 {
+		batchSize = DefaultInvariantCheckerBatchSize
+	}
+	return &InvariantChecker{
+		db:          bc.DB(),
+		bc:          bc,
+		checks:      checks,
+		interval:    time.Duration(intervalSeconds) * time.Second,
+		batchSize:   int(batchSize),
+		alertURLs:   alertURLs,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		cursors:     make(map[string][]byte),
+		stopChannel: make(chan struct{}),
+	}
+}
+
+func (ic *InvariantChecker) Start() {
+	glog.Infof("InvariantChecker: Checking %d entries per invariant every %v", ic.batchSize, ic.interval)
+
+	ic.waitGroup.Add(1)
+	go func() {
+		defer ic.waitGroup.Done()
+		for {
+			select {
+			case <-ic.stopChannel:
+				return
+			case <-time.After(ic.interval):
+			}
+			if _, err := ic.RunBatch(); err != nil {
+				glog.Errorf("InvariantChecker: %v", err)
+			}
+		}
+	}()
+}
+
+func (ic *InvariantChecker) Stop() {
+	glog.Info("InvariantChecker: Stopping")
+	close(ic.stopChannel)
+	ic.waitGroup.Wait()
+}
+
+// RunBatch validates the next batch of entries for every check, raises an alert for each
+// violation found, and returns the violations.
+func (ic *InvariantChecker) RunBatch() ([]*InvariantViolation, error) {
+	var violations []*InvariantViolation
+	for _, check := range ic.checks {
+		checkViolations, err := ic.runCheckBatch(check)
+		if err != nil {
+			return violations, errors.Wrapf(err, "RunBatch: Problem running %v: ", check.Name)
+		}
+		violations = append(violations, checkViolations...)
+	}
+	for _, violation := range violations {
+		ic.raiseAlert(violation)
+	}
+	return violations, nil
+}
+
+func (ic *InvariantChecker) runCheckBatch(check *InvariantCheck) ([]*InvariantViolation, error) {
+	blockTipHeight := uint64(ic.bc.BlockTip().Height)
+	timestampSecs := uint64(time.Now().Unix())
+
+	var violations []*InvariantViolation
+	var lastKey []byte
+	var numKeys int
+	err := ic.db.View(func(txn *badger.Txn) error {
+		// Start right after the last key we validated. Appending a zero byte gives the
+		// smallest key that sorts after it.
+		startKey := check.Prefix
+		if cursor, exists := ic.cursors[check.Name]; exists {
+			startKey = append(append([]byte{}, cursor...), 0)
+		}
+		keys, values, err := DBGetPaginatedKeysAndValuesForPrefixWithTxn(
+			txn, startKey, check.Prefix, 0, ic.batchSize, false, true)
+		if err != nil {
+			return err
+		}
+		numKeys = len(keys)
+		for ii, key := range keys {
+			descriptions, err := check.Check(txn, key, values[ii])
+			if err != nil {
+				return err
+			}
+			for _, description := range descriptions {
+				violations = append(violations, &InvariantViolation{
+					Invariant:      check.Name,
+					Key:            hex.EncodeToString(key),
+					Details:        description,
+					BlockTipHeight: blockTipHeight,
+					TimestampSecs:  timestampSecs,
+				})
+			}
+			lastKey = key
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// When we run out of entries, the pass is complete and the next batch starts over.
+	if numKeys < ic.batchSize {
+		glog.V(1).Infof("InvariantChecker: Finished a pass of %v", check.Name)
+		delete(ic.cursors, check.Name)
+	} else {
+		ic.cursors[check.Name] = lastKey
+	}
+	return violations, nil
+}
+
+// GetRecentViolations returns the most recent violations the checker has found, oldest
+// first.
+func (ic *InvariantChecker) GetRecentViolations() []*InvariantViolation {
+	ic.recentViolationsLock.RLock()
+	defer ic.recentViolationsLock.RUnlock()
+
+	return append([]*InvariantViolation{}, ic.recentViolations...)
+}
+
+func (ic *InvariantChecker) raiseAlert(violation *InvariantViolation) {
+	violationBytes, err := json.Marshal(violation)
+	if err != nil {
+		glog.Errorf("InvariantChecker: Problem encoding violation: %v", err)
+		return
+	}
+	glog.Error(CLog(Red, fmt.Sprintf("InvariantChecker: Invariant violated: %s", violationBytes)))
+
+	ic.recentViolationsLock.Lock()
+	ic.recentViolations = append(ic.recentViolations, violation)
+	if len(ic.recentViolations) > maxRecentInvariantViolations {
+		ic.recentViolations = ic.recentViolations[len(ic.recentViolations)-maxRecentInvariantViolations:]
+	}
+	ic.recentViolationsLock.Unlock()
+
+	for _, alertURL := range ic.alertURLs {
+		if err = ic.postAlert(alertURL, violationBytes); err != nil {
+			glog.Errorf("InvariantChecker: %v", err)
+		}
+	}
+}
+
+func (ic *InvariantChecker) postAlert(alertURL string, violationBytes []byte) error {
+	req, err := http.NewRequest("POST", alertURL, bytes.NewBuffer(violationBytes))
+	if err != nil {
+		return errors.Wrapf(err, "postAlert: Problem creating HTTP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ic.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "postAlert: Problem sending HTTP request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("postAlert: %v returned status %d", alertURL, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvariantChecks(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	m2PKID := NewPKID(m2PkBytes)
+
+	// m0's creator coin is held by m1 and m2, but its CoinsInCirculationNanos is off by one.
+	// m0's DAO coin is held by m1 alone, with some of its supply locked up.
+	profileEntry := &ProfileEntry{PublicKey: m0PkBytes, Username: []byte("m0")}
+	profileEntry.CreatorCoinEntry.CoinsInCirculationNanos = *uint256.NewInt().SetUint64(301)
+	profileEntry.CreatorCoinEntry.NumberOfHolders = 2
+	profileEntry.DAOCoinEntry.CoinsInCirculationNanos = *uint256.NewInt().SetUint64(1000)
+	profileEntry.DAOCoinEntry.NumberOfHolders = 1
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		if err := DBPutProfileEntryMappingsWithTxn(
+			txn, nil, 0, profileEntry, m0PKID, &DeSoTestnetParams, nil); err != nil {
+			return err
+		}
+		for _, balanceEntry := range []*BalanceEntry{
+			{HODLerPKID: m1PKID, CreatorPKID: m0PKID, BalanceNanos: *uint256.NewInt().SetUint64(100)},
+			{HODLerPKID: m2PKID, CreatorPKID: m0PKID, BalanceNanos: *uint256.NewInt().SetUint64(200)},
+		} {
+			if err := DBPutBalanceEntryMappingsWithTxn(txn, nil, 0, balanceEntry, false, nil); err != nil {
+				return err
+			}
+		}
+		daoBalanceEntry := &BalanceEntry{
+			HODLerPKID: m1PKID, CreatorPKID: m0PKID, BalanceNanos: *uint256.NewInt().SetUint64(600),
+		}
+		if err := DBPutBalanceEntryMappingsWithTxn(txn, nil, 0, daoBalanceEntry, true, nil); err != nil {
+			return err
+		}
+
+		// m1 follows m0 in both indexes, but m2's follow of m0 is only in one.
+		if err := DbPutFollowMappingsWithTxn(txn, nil, m1PKID, m0PKID, nil); err != nil {
+			return err
+		}
+		return DBSetWithTxn(txn, nil, _dbKeyForFollowedToFollowerMapping(m0PKID, m2PKID), []byte{}, nil)
+	}))
+
+	require.NoError(db.View(func(txn *badger.Txn) error {
+		profileKey := _dbKeyForPKIDToProfileEntry(m0PKID)
+		profileItem, err := txn.Get(profileKey)
+		require.NoError(err)
+		profileBytes, err := profileItem.ValueCopy(nil)
+		require.NoError(err)
+		violations, err := checkCoinSupplyInvariant(txn, profileKey, profileBytes)
+		require.NoError(err)
+		require.Len(violations, 1)
+		require.Contains(violations[0], "creator coin balances total")
+
+		violations, err = checkFollowedToFollowerInvariant(txn, _dbKeyForFollowedToFollowerMapping(m0PKID, m1PKID), nil)
+		require.NoError(err)
+		require.Empty(violations)
+		violations, err = checkFollowerToFollowedInvariant(txn, _dbKeyForFollowerToFollowedMapping(m1PKID, m0PKID), nil)
+		require.NoError(err)
+		require.Empty(violations)
+		violations, err = checkFollowedToFollowerInvariant(txn, _dbKeyForFollowedToFollowerMapping(m0PKID, m2PKID), nil)
+		require.NoError(err)
+		require.Len(violations, 1)
+		return nil
+	}))
+}
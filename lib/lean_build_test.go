@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// _getDeclaredNamesForBuildTags returns the names of the top-level types and funcs declared
+// in lib's non-test files when it's built with the given tags.
+func _getDeclaredNamesForBuildTags(t *testing.T, buildTags []string) map[string]bool {
+	require := require.New(t)
+
+	buildContext := build.Default
+	buildContext.BuildTags = buildTags
+	pkg, err := buildContext.ImportDir(".", 0)
+	require.NoError(err)
+
+	declaredNames := make(map[string]bool)
+	fileSet := token.NewFileSet()
+	for _, fileName := range pkg.GoFiles {
+		file, err := parser.ParseFile(fileSet, fileName, nil, parser.SkipObjectResolution)
+		require.NoError(err)
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					declaredNames[decl.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+						declaredNames[typeSpec.Name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return declaredNames
+}
+
+// TestLeanBuildExcludesNetworking checks that building lib with the deso_lean tag leaves out
+// the server, peer, and miner code, so that apps that only read state and construct txns
+// don't link them. The code can't be referenced, and so can't be linked, if it isn't
+// declared.
+func TestLeanBuildExcludesNetworking(t *testing.T) {
+	require := require.New(t)
+
+	networkingNames := []string{
+		"Server", "NewServer",
+		"Peer", "NewPeer",
+		"DeSoMiner", "NewDeSoMiner",
+		"ConnectionManager", "NetworkManager", "RemoteNode",
+		"DeSoBlockProducer", "PosBlockProducer", "FastHotStuffConsensus",
+	}
+	fullBuildNames := _getDeclaredNamesForBuildTags(t, nil)
+	leanBuildNames := _getDeclaredNamesForBuildTags(t, []string{"deso_lean"})
+	for _, name := range networkingNames {
+		require.Truef(fullBuildNames[name], "%v should be declared in the full build", name)
+		require.Falsef(leanBuildNames[name], "%v should not be declared in the deso_lean build", name)
+	}
+
+	// The lean build still has what's needed to read state and construct txns.
+	for _, name := range []string{"UtxoView", "NewUtxoView", "Blockchain", "NewBlockchain", "DeSoMempool"} {
+		require.Truef(leanBuildNames[name], "%v should be declared in the deso_lean build", name)
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"bytes"
 	"container/heap"
 	"container/list"
 	"encoding/hex"
@@ -23,6 +24,7 @@ import (
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/deso-protocol/go-deadlock"
 	"github.com/golang/glog"
+	"github.com/holiman/uint256"
 	"github.com/pkg/errors"
 )
 
@@ -168,6 +170,30 @@ type DeSoMempool struct {
 	// key has available to spend.
 	pubKeyToTxnMap map[PkMapKey]map[BlockHash]*MempoolTx
 
+	// idempotencyKeyTracker indexes the txns in poolMap by (public key, idempotency key) so that
+	// an app's retried submission of a txn that's already in the pool isn't accepted as a
+	// conflicting spend.
+	idempotencyKeyTracker *IdempotencyKeyTracker
+
+	// decisionRecorder records every ProcessTransaction decision when it's set. It's a
+	// debugging aid, see mempool_decision_recorder.go.
+	decisionRecorder *MempoolDecisionRecorder
+
+	// replaceByFeePolicy allows txns to replace the txns they conflict with when it's set,
+	// see mempool_replace_by_fee.go.
+	replaceByFeePolicy *ReplaceByFeePolicy
+
+	// journal persists the txns the mempool accepts when it's set, see mempool_journal.go.
+	journal *MempoolJournal
+
+	// transactionEventBus is notified of every txn the mempool accepts when it's set, including
+	// the unconnected txns accepted along with their parents. See transaction_event_bus.go.
+	transactionEventBus *TransactionEventBus
+
+	// counters count the txns accepted, rejected, and evicted by the mempool, see
+	// mempool_metrics.go.
+	counters *mempoolCounters
+
 	// The next time the unconnectTxn pool will be scanned for expired unconnectedTxns.
 	nextExpireScan time.Time
 
@@ -341,6 +367,7 @@ func (mp *DeSoMempool) resetPool(newPool *DeSoMempool) {
 	mp.totalTxSizeBytes = newPool.totalTxSizeBytes
 	mp.outpoints = newPool.outpoints
 	mp.pubKeyToTxnMap = newPool.pubKeyToTxnMap
+	mp.idempotencyKeyTracker = newPool.idempotencyKeyTracker
 	mp.unconnectedTxns = newPool.unconnectedTxns
 	mp.unconnectedTxnsByPrev = newPool.unconnectedTxnsByPrev
 	mp.nextExpireScan = newPool.nextExpireScan
@@ -471,8 +498,19 @@ func (mp *DeSoMempool) UpdateAfterConnectBlock(blk *MsgDeSoBlock) (_txnsAddedToM
 		}
 	}
 
+	// Count the txns that were dropped without being mined.
+	numInvalidTxns := 0
+	for _, mempoolTx := range oldMempoolTxns {
+		_, inBlock := txnsInBlock[*mempoolTx.Hash]
+		if _, inNewPool := newPool.poolMap[*mempoolTx.Hash]; !inBlock && !inNewPool {
+			numInvalidTxns++
+		}
+	}
+	mp._recordEvictions(MempoolEvictionReasonInvalidAfterConnectBlock, numInvalidTxns)
+
 	// Now set the fields on the old pool to match the new pool.
 	mp.resetPool(newPool)
+	mp._compactJournalIfNeeded()
 
 	// Return the newly accepted transactions now that we've fully updated our mempool.
 	return newlyAcceptedTxns
@@ -569,9 +607,21 @@ func (mp *DeSoMempool) UpdateAfterDisconnectBlock(blk *MsgDeSoBlock) {
 	// the block's transactions added (with timestamps set before the transactions that
 	// were in the original pool.
 
+	// Count the txns that were dropped.
+	numInvalidTxns := 0
+	for _, mempoolTx := range oldMempoolTxns {
+		if _, inNewPool := newPool.poolMap[*mempoolTx.Hash]; !inNewPool {
+			numInvalidTxns++
+		}
+	}
+	mp._recordEvictions(MempoolEvictionReasonInvalidAfterDisconnectBlock, numInvalidTxns)
+
 	// Replace the internal mappings of the original pool with the mappings of the new
 	// pool.
 	mp.resetPool(newPool)
+
+	// The block's txns are back in the pool but not in the journal.
+	mp._rewriteJournal()
 }
 
 // Acquires a read lock before returning the transactions.
@@ -599,6 +649,15 @@ func (mp *DeSoMempool) GetMempoolTipBlockHeight() uint64 {
 	return uint64(mp.bc.blockTip().Height)
 }
 
+// GetTransactionForIdempotencyKey returns the pool txn from the same transactor that used the
+// same idempotency key as the given txn, if there is one.
+func (mp *DeSoMempool) GetTransactionForIdempotencyKey(txn *MsgDeSoTxn) *MempoolTx {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	return mp.idempotencyKeyTracker.GetTxnByIdempotencyKey(txn)
+}
+
 func (mp *DeSoMempool) GetMempoolTx(txId *BlockHash) *MempoolTx {
 	return mp.readOnlyUniversalTransactionMap[*txId]
 }
@@ -637,6 +696,7 @@ func (mp *DeSoMempool) limitNumUnconnectedTxns() error {
 		numUnconnectedTxns := len(mp.unconnectedTxns)
 		if numExpired := prevNumUnconnectedTxns - numUnconnectedTxns; numExpired > 0 {
 			glog.V(1).Infof("Expired %d unconnectedTxns (remaining: %d)", numExpired, numUnconnectedTxns)
+			mp._recordEvictions(MempoolEvictionReasonUnconnectedExpired, numExpired)
 		}
 	}
 
@@ -646,6 +706,7 @@ func (mp *DeSoMempool) limitNumUnconnectedTxns() error {
 
 	for _, otx := range mp.unconnectedTxns {
 		mp.removeUnconnectedTxn(otx.tx, false)
+		mp._recordEvictions(MempoolEvictionReasonUnconnectedLimit, 1)
 		break
 	}
 
@@ -893,6 +954,9 @@ func (mp *DeSoMempool) addTransaction(
 	// to know her balance while factoring in mempool transactions.
 	mp._addMempoolTxToPubKeyOutputMap(mempoolTx)
 
+	// Index the transaction by its idempotency key, if it has one.
+	mp.idempotencyKeyTracker.AddTxn(mempoolTx)
+
 	// Add it to the universal view. We assume the txn was already added to the
 	// backup view.
 	_, _, _, _, err = mp.universalUtxoView._connectTransaction(
@@ -966,7 +1030,7 @@ func (mp *DeSoMempool) _quickCheckBitcoinExchangeTxn(
 	// Note that it is safe to use this because we expect that the blockchain
 	// lock is held for the duration of this function call so there shouldn't
 	// be any shifting of the db happening beneath our fee.
-	utxoView := NewUtxoView(mp.bc.db, mp.bc.params, mp.bc.postgres, mp.bc.snapshot, mp.bc.eventManager)
+	utxoView := mp.bc.NewUtxoView()
 
 	// Connnect all of this transaction's dependencies to the UtxoView in order. Note
 	// that we can do this because _findMempoolDependencies returns the transactions in
@@ -1065,6 +1129,13 @@ func (mp *DeSoMempool) tryAcceptTransaction(
 		return nil, nil, TxErrorDuplicate
 	}
 
+	// Reject the txn if another txn from the same transactor in the pool already used its
+	// idempotency key. This is almost always an app retrying a submission that went through.
+	if conflictingTxn := mp.idempotencyKeyTracker.GetConflictingTxn(tx); conflictingTxn != nil {
+		return nil, nil, errors.Wrapf(TxErrorDuplicateIdempotencyKey, "tryAcceptTransaction: "+
+			"Idempotency key was already used by txn %v", conflictingTxn.Hash)
+	}
+
 	// Iterate over the transaction's inputs. If any of them don't have utxos in the
 	// UtxoView that are unspent at this point then the transaction is an unconnected
 	// txn. Use a map to ensure there are no duplicates.
@@ -1232,6 +1303,16 @@ func ComputeTransactionMetadata(
 			Metadata:             "BasicTransferOutput",
 		})
 	}
+	// A fee paid in a DAO coin is sponsored by the coin's creator.
+	for _, utxoOp := range utxoOps {
+		if utxoOp.Type == OperationTypeDAOCoinFee {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(utxoOp.BalancePublicKey, utxoView.Params),
+				Metadata:             "FeeDAOCoinPublicKey",
+			})
+			break
+		}
+	}
 
 	switch txn.TxnMeta.GetTxnType() {
 	case TxnTypeBitcoinExchange:
@@ -1301,9 +1382,8 @@ func ComputeTransactionMetadata(
 		})
 	case TxnTypeCreatorCoinTransfer:
 		realTxMeta := txn.TxnMeta.(*CreatorCoinTransferMetadataa)
-		creatorProfileEntry := utxoView.GetProfileEntryForPublicKey(realTxMeta.ProfilePublicKey)
 		txnMeta.CreatorCoinTransferTxindexMetadata = &CreatorCoinTransferTxindexMetadata{
-			CreatorUsername:            string(creatorProfileEntry.Username),
+			CreatorUsername:            utxoView.GetDisplayHandleForPublicKey(realTxMeta.ProfilePublicKey),
 			CreatorCoinToTransferNanos: realTxMeta.CreatorCoinToTransferNanos,
 		}
 
@@ -1774,6 +1854,15 @@ func ComputeTransactionMetadata(
 		case DAOCoinOperationTypeUpdateTransferRestrictionStatus:
 			metadata = "DAOCoinUpdateTransferRestrictionStatus"
 			operationString = "update_transfer_restriction_status"
+		case DAOCoinOperationTypeUpdateDecimals:
+			metadata = "DAOCoinUpdateDecimalsPublicKeyBase58Check"
+			operationString = "update_decimals"
+		case DAOCoinOperationTypeUpdateMetadata:
+			metadata = "DAOCoinUpdateMetadataPublicKeyBase58Check"
+			operationString = "update_metadata"
+		case DAOCoinOperationTypeUpdateLimitOrderRestriction:
+			metadata = "DAOCoinUpdateLimitOrderRestrictionPublicKeyBase58Check"
+			operationString = "update_limit_order_restriction"
 		}
 
 		txnMeta.DAOCoinTxindexMetadata = &DAOCoinTxindexMetadata{
@@ -1790,9 +1879,8 @@ func ComputeTransactionMetadata(
 		})
 	case TxnTypeDAOCoinTransfer:
 		realTxMeta := txn.TxnMeta.(*DAOCoinTransferMetadata)
-		creatorProfileEntry := utxoView.GetProfileEntryForPublicKey(realTxMeta.ProfilePublicKey)
 		txnMeta.DAOCoinTransferTxindexMetadata = &DAOCoinTransferTxindexMetadata{
-			CreatorUsername:        string(creatorProfileEntry.Username),
+			CreatorUsername:        utxoView.GetDisplayHandleForPublicKey(realTxMeta.ProfilePublicKey),
 			DAOCoinToTransferNanos: realTxMeta.DAOCoinToTransferNanos,
 		}
 
@@ -1804,8 +1892,8 @@ func ComputeTransactionMetadata(
 		realTxMeta := txn.TxnMeta.(*DAOCoinLimitOrderMetadata)
 
 		// We only update the mempool if the transactor submitted a new
-		// order. Not if the transactor cancelled an existing order.
-		if realTxMeta.CancelOrderID != nil {
+		// order. Not if the transactor cancelled existing orders.
+		if !realTxMeta.PlacesOrder() {
 			break
 		}
 
@@ -1825,20 +1913,38 @@ func ComputeTransactionMetadata(
 
 		utxoOp := utxoOps[len(utxoOps)-1]
 		uniquePKIDMap := make(map[PKID]bool)
-		fulfilledOrderMetadata := []*FilledDAOCoinLimitOrderMetadata{}
 		for _, filledOrder := range utxoOp.FilledDAOCoinLimitOrders {
 			uniquePKIDMap[*filledOrder.TransactorPKID] = true
-			fulfilledOrderMetadata = append(fulfilledOrderMetadata, &FilledDAOCoinLimitOrderMetadata{
-				TransactorPublicKeyBase58Check: PkToString(
-					utxoView.GetPublicKeyForPKID(filledOrder.TransactorPKID), utxoView.Params),
-				BuyingDAOCoinCreatorPublicKey: PkToString(
-					utxoView.GetPublicKeyForPKID(filledOrder.BuyingDAOCoinCreatorPKID), utxoView.Params),
-				SellingDAOCoinCreatorPublicKey: PkToString(
-					utxoView.GetPublicKeyForPKID(filledOrder.SellingDAOCoinCreatorPKID), utxoView.Params),
-				CoinQuantityInBaseUnitsBought: filledOrder.CoinQuantityInBaseUnitsBought,
-				CoinQuantityInBaseUnitsSold:   filledOrder.CoinQuantityInBaseUnitsSold,
-				IsFulfilled:                   filledOrder.IsFulfilled,
-			})
+		}
+		fulfilledOrderMetadata := utxoView.GetFilledDAOCoinLimitOrdersMetadata(utxoOp.FilledDAOCoinLimitOrders)
+
+		// Total up what the transactor traded across all of the order's fills, so explorers
+		// can show the trade without adding up the fills themselves.
+		coinQuantityInBaseUnitsBought := uint256.NewInt()
+		coinQuantityInBaseUnitsSold := uint256.NewInt()
+		feeInBaseUnitsPaid := uint256.NewInt()
+		counterpartyPublicKeys := []string{}
+		seenCounterpartyPublicKeys := make(map[string]bool)
+		for _, filledOrderMetadata := range fulfilledOrderMetadata {
+			if !filledOrderMetadata.IsTransactorOrder {
+				continue
+			}
+			if filledOrderMetadata.CoinQuantityInBaseUnitsBought != nil {
+				coinQuantityInBaseUnitsBought.Add(
+					coinQuantityInBaseUnitsBought, filledOrderMetadata.CoinQuantityInBaseUnitsBought)
+			}
+			if filledOrderMetadata.CoinQuantityInBaseUnitsSold != nil {
+				coinQuantityInBaseUnitsSold.Add(
+					coinQuantityInBaseUnitsSold, filledOrderMetadata.CoinQuantityInBaseUnitsSold)
+			}
+			if filledOrderMetadata.FeeInBaseUnitsPaid != nil {
+				feeInBaseUnitsPaid.Add(feeInBaseUnitsPaid, filledOrderMetadata.FeeInBaseUnitsPaid)
+			}
+			counterpartyPublicKey := filledOrderMetadata.CounterpartyPublicKeyBase58Check
+			if counterpartyPublicKey != "" && !seenCounterpartyPublicKeys[counterpartyPublicKey] {
+				seenCounterpartyPublicKeys[counterpartyPublicKey] = true
+				counterpartyPublicKeys = append(counterpartyPublicKeys, counterpartyPublicKey)
+			}
 		}
 
 		for uniquePKID := range uniquePKIDMap {
@@ -1848,6 +1954,15 @@ func ComputeTransactionMetadata(
 			})
 		}
 
+		// Add the makers whose resting orders were filled under their own role, so wallets can
+		// tell them their orders traded.
+		for _, makerPKID := range GetDAOCoinLimitOrderMakerPKIDs(utxoOp.FilledDAOCoinLimitOrders) {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(utxoView.GetPublicKeyForPKID(makerPKID), utxoView.Params),
+				Metadata:             "MatchedOrderMakerPublicKey",
+			})
+		}
+
 		txnMeta.DAOCoinLimitOrderTxindexMetadata = &DAOCoinLimitOrderTxindexMetadata{
 			FilledDAOCoinLimitOrdersMetadata: fulfilledOrderMetadata,
 			BuyingDAOCoinCreatorPublicKey: PkToString(
@@ -1856,6 +1971,70 @@ func ComputeTransactionMetadata(
 				realTxMeta.SellingDAOCoinCreatorPublicKey.ToBytes(), utxoView.Params),
 			ScaledExchangeRateCoinsToSellPerCoinToBuy: realTxMeta.ScaledExchangeRateCoinsToSellPerCoinToBuy,
 			QuantityToFillInBaseUnits:                 realTxMeta.QuantityToFillInBaseUnits,
+			CoinQuantityInBaseUnitsBought:             coinQuantityInBaseUnitsBought,
+			CoinQuantityInBaseUnitsSold:               coinQuantityInBaseUnitsSold,
+			FeeInBaseUnitsPaid:                        feeInBaseUnitsPaid,
+			CounterpartyPublicKeysBase58Check:         counterpartyPublicKeys,
+		}
+
+	case TxnTypeDAOCoinLimitOrderBatch:
+		realTxMeta := txn.TxnMeta.(*DAOCoinLimitOrderBatchMetadata)
+
+		// As with single orders, only new orders affect their coins' creators.
+		for _, order := range realTxMeta.Orders {
+			if !order.PlacesOrder() {
+				continue
+			}
+			if !order.BuyingDAOCoinCreatorPublicKey.IsZeroPublicKey() {
+				txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+					PublicKeyBase58Check: PkToString(order.BuyingDAOCoinCreatorPublicKey.ToBytes(), utxoView.Params),
+					Metadata:             "BuyingDAOCoinCreatorPublicKey",
+				})
+			}
+			if !order.SellingDAOCoinCreatorPublicKey.IsZeroPublicKey() {
+				txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+					PublicKeyBase58Check: PkToString(order.SellingDAOCoinCreatorPublicKey.ToBytes(), utxoView.Params),
+					Metadata:             "SellingDAOCoinCreatorPublicKey",
+				})
+			}
+		}
+
+		// Add the transactors of the orders the batch filled, and the makers among them.
+		uniquePKIDMap := make(map[PKID]bool)
+		makerPKIDs := []*PKID{}
+		seenMakerPKIDs := make(map[PKID]bool)
+		for _, utxoOp := range utxoOps {
+			if utxoOp.Type != OperationTypeDAOCoinLimitOrderBatch {
+				continue
+			}
+			for _, orderUtxoOps := range utxoOp.AtomicTxnsInnerUtxoOps {
+				for _, orderUtxoOp := range orderUtxoOps {
+					if orderUtxoOp.Type != OperationTypeDAOCoinLimitOrder {
+						continue
+					}
+					for _, filledOrder := range orderUtxoOp.FilledDAOCoinLimitOrders {
+						uniquePKIDMap[*filledOrder.TransactorPKID] = true
+					}
+					for _, makerPKID := range GetDAOCoinLimitOrderMakerPKIDs(orderUtxoOp.FilledDAOCoinLimitOrders) {
+						if !seenMakerPKIDs[*makerPKID] {
+							seenMakerPKIDs[*makerPKID] = true
+							makerPKIDs = append(makerPKIDs, makerPKID)
+						}
+					}
+				}
+			}
+		}
+		for uniquePKID := range uniquePKIDMap {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(utxoView.GetPublicKeyForPKID(&uniquePKID), utxoView.Params),
+				Metadata:             "FilledOrderPublicKey",
+			})
+		}
+		for _, makerPKID := range makerPKIDs {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(utxoView.GetPublicKeyForPKID(makerPKID), utxoView.Params),
+				Metadata:             "MatchedOrderMakerPublicKey",
+			})
 		}
 
 	case TxnTypeCreateUserAssociation:
@@ -2060,6 +2239,141 @@ func ComputeTransactionMetadata(
 			PublicKeyBase58Check: PkToString(profilePublicKey, utxoView.Params),
 			Metadata:             "CoinUnlockProfilePublicKeyBase58Check",
 		})
+	case TxnTypeAnchorExternalHeaders:
+		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(txn.PublicKey, utxoView.Params),
+			Metadata:             "AnchorExternalHeadersRelayerPublicKeyBase58Check",
+		})
+	case TxnTypeRegisterMultisig:
+		realTxMeta := txn.TxnMeta.(*RegisterMultisigMetadata)
+		for _, coSignerPublicKey := range realTxMeta.CoSignerPublicKeys {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(coSignerPublicKey.ToBytes(), utxoView.Params),
+				Metadata:             "MultisigCoSignerPublicKeyBase58Check",
+			})
+		}
+	case TxnTypeDAOCoinStream:
+		realTxMeta := txn.TxnMeta.(*DAOCoinStreamMetadata)
+		if realTxMeta.OperationType == DAOCoinStreamOperationTypeCreate {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(realTxMeta.PayeePublicKey.ToBytes(), utxoView.Params),
+				Metadata:             "DAOCoinStreamPayeePublicKeyBase58Check",
+			})
+		}
+	case TxnTypeDAOCoinMultiTransfer:
+		realTxMeta := txn.TxnMeta.(*DAOCoinMultiTransferMetadata)
+		for _, recipient := range realTxMeta.Recipients {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(recipient.ReceiverPublicKey, utxoView.Params),
+				Metadata:             "ReceiverPublicKey",
+			})
+		}
+	case TxnTypeRoyaltySplit:
+		realTxMeta := txn.TxnMeta.(*RoyaltySplitMetadata)
+		for _, royalties := range []struct {
+			publicKeys map[PublicKey]uint64
+			metadata   string
+		}{
+			{realTxMeta.DESORoyalties, "DESORoyaltyPublicKey"},
+			{realTxMeta.CoinRoyalties, "CoinRoyaltyPublicKey"},
+		} {
+			publicKeys := make([]PublicKey, 0, len(royalties.publicKeys))
+			for publicKey := range royalties.publicKeys {
+				publicKeys = append(publicKeys, publicKey)
+			}
+			sort.Slice(publicKeys, func(ii, jj int) bool {
+				return bytes.Compare(publicKeys[ii][:], publicKeys[jj][:]) < 0
+			})
+			for _, publicKey := range publicKeys {
+				txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+					PublicKeyBase58Check: PkToString(publicKey[:], utxoView.Params),
+					Metadata:             royalties.metadata,
+				})
+			}
+		}
+	case TxnTypeLeaseNFT:
+		realTxMeta := txn.TxnMeta.(*LeaseNFTMetadata)
+		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(realTxMeta.LesseePublicKey, utxoView.Params),
+			Metadata:             "LesseePublicKeyBase58Check",
+		})
+	case TxnTypeEndNFTLease:
+		// The lease is already cleared from the NFT entry, so the lessee is taken from the
+		// entry saved for disconnecting the txn.
+		for _, utxoOp := range utxoOps {
+			if utxoOp.Type == OperationTypeEndNFTLease && utxoOp.PrevNFTEntry != nil &&
+				utxoOp.PrevNFTEntry.LesseePKID != nil {
+				txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+					PublicKeyBase58Check: PkToString(
+						utxoView.GetPublicKeyForPKID(utxoOp.PrevNFTEntry.LesseePKID), utxoView.Params),
+					Metadata: "LesseePublicKeyBase58Check",
+				})
+				break
+			}
+		}
+	case TxnTypeNFTBundle:
+		// A bought bundle is delisted, so the seller is taken from the entry saved for
+		// disconnecting the txn.
+		realTxMeta := txn.TxnMeta.(*NFTBundleMetadata)
+		if realTxMeta.OperationType != NFTBundleOperationTypeBuy {
+			break
+		}
+		for _, utxoOp := range utxoOps {
+			if utxoOp.Type == OperationTypeNFTBundle && utxoOp.PrevNFTBundleEntry != nil {
+				txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+					PublicKeyBase58Check: PkToString(
+						utxoView.GetPublicKeyForPKID(utxoOp.PrevNFTBundleEntry.SellerPKID), utxoView.Params),
+					Metadata: "NFTOwnerPublicKeyBase58Check",
+				})
+				break
+			}
+		}
+	case TxnTypeSlashValidator:
+		realTxMeta := txn.TxnMeta.(*SlashValidatorMetadata)
+		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(realTxMeta.ValidatorPublicKey.ToBytes(), utxoView.Params),
+			Metadata:             "SlashedValidatorPublicKeyBase58Check",
+		})
+	case TxnTypeNFTSwap:
+		// A proposal affects its counterparty. An accepted or canceled swap is removed, so its
+		// parties are taken from the entry saved for disconnecting the txn.
+		realTxMeta := txn.TxnMeta.(*NFTSwapMetadata)
+		if realTxMeta.OperationType == NFTSwapOperationTypePropose {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(realTxMeta.CounterpartyPublicKey, utxoView.Params),
+				Metadata:             "NFTSwapCounterpartyPublicKeyBase58Check",
+			})
+			break
+		}
+		for _, utxoOp := range utxoOps {
+			if utxoOp.Type == OperationTypeNFTSwap && utxoOp.PrevNFTSwapEntry != nil {
+				txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+					PublicKeyBase58Check: PkToString(
+						utxoView.GetPublicKeyForPKID(utxoOp.PrevNFTSwapEntry.ProposerPKID), utxoView.Params),
+					Metadata: "NFTSwapProposerPublicKeyBase58Check",
+				}, &AffectedPublicKey{
+					PublicKeyBase58Check: PkToString(
+						utxoView.GetPublicKeyForPKID(utxoOp.PrevNFTSwapEntry.CounterpartyPKID), utxoView.Params),
+					Metadata: "NFTSwapCounterpartyPublicKeyBase58Check",
+				})
+				break
+			}
+		}
+	case TxnTypeCreateProposal:
+		realTxMeta := txn.TxnMeta.(*CreateProposalMetadata)
+		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(realTxMeta.ProfilePublicKey.ToBytes(), utxoView.Params),
+			Metadata:             "CreateProposalProfilePublicKeyBase58Check",
+		})
+	case TxnTypeCastVote:
+		realTxMeta := txn.TxnMeta.(*CastVoteMetadata)
+		proposalEntry, err := utxoView.GetProposalEntry(realTxMeta.ProposalID)
+		if err == nil && proposalEntry != nil {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(utxoView.GetPublicKeyForPKID(proposalEntry.ProposerPKID), utxoView.Params),
+				Metadata:             "CastVoteProposerPublicKeyBase58Check",
+			})
+		}
 	case TxnTypeAtomicTxnsWrapper:
 		realTxMeta := txn.TxnMeta.(*AtomicTxnsWrapperMetadata)
 		txnMeta.AtomicTxnsWrapperTxindexMetadata = &AtomicTxnsWrapperTxindexMetadata{}
@@ -2120,6 +2434,16 @@ func ComputeTransactionMetadata(
 			})
 		}
 	}
+
+	// Run the registered enrichers now that the built-in metadata is complete.
+	RunTxindexEnrichers(&TxindexEnrichmentContext{
+		Txn:         txn,
+		BlockHash:   blockHash,
+		BlockHeight: blockHeight,
+		UtxoOps:     utxoOps,
+		UtxoView:    utxoView,
+		TxnMeta:     txnMeta,
+	})
 	return txnMeta
 }
 
@@ -2396,6 +2720,14 @@ func (mp *DeSoMempool) processTransaction(
 	}
 	glog.V(2).Infof("Processing transaction %v", txHash)
 
+	// If the txn conflicts with txns in the pool and replacements are allowed, try to
+	// replace them.
+	if mp.replaceByFeePolicy != nil && !mp.isTransactionInPool(txHash) {
+		if conflictingTxns := mp._getConflictingTxns(tx); len(conflictingTxns) > 0 {
+			return mp._replaceTransactions(tx, conflictingTxns, rateLimit, verifySignatures)
+		}
+	}
+
 	// Run validation and try to add this txn to the pool.
 	missingParents, mempoolTx, err := mp.tryAcceptTransaction(
 		tx, rateLimit, true, verifySignatures)
@@ -2450,7 +2782,44 @@ func (mp *DeSoMempool) ProcessTransaction(tx *MsgDeSoTxn, allowUnconnectedTxn bo
 	mp.mtx.Lock()
 	defer mp.mtx.Unlock()
 
-	return mp.processTransaction(tx, allowUnconnectedTxn, rateLimit, peerID, verifySignatures)
+	mempoolTxs, err := mp.processTransaction(tx, allowUnconnectedTxn, rateLimit, peerID, verifySignatures)
+	mp._recordProcessTransactionResult(mempoolTxs, err)
+	if mp.decisionRecorder != nil {
+		decision, decisionErr := newMempoolDecision(tx, allowUnconnectedTxn, rateLimit, peerID,
+			verifySignatures, mp.bc.BlockTip(), mempoolTxs, err)
+		if decisionErr != nil {
+			glog.Errorf("DeSoMempool.ProcessTransaction: Problem recording decision: %v", decisionErr)
+		} else {
+			mp.decisionRecorder.RecordDecision(decision)
+		}
+	}
+	if mp.journal != nil {
+		for _, mempoolTx := range mempoolTxs {
+			mp.journal.AppendTxn(mempoolTx.Tx)
+		}
+	}
+	for _, mempoolTx := range mempoolTxs {
+		mp.transactionEventBus.NotifyMempoolAccepted(mempoolTx.Tx)
+	}
+	return mempoolTxs, err
+}
+
+// SetDecisionRecorder makes the mempool record every ProcessTransaction decision. It should
+// be set before the mempool starts processing txns.
+func (mp *DeSoMempool) SetDecisionRecorder(recorder *MempoolDecisionRecorder) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	mp.decisionRecorder = recorder
+}
+
+// SetTransactionEventBus makes the mempool notify the bus of every txn it accepts. It should
+// be set before the mempool starts processing txns.
+func (mp *DeSoMempool) SetTransactionEventBus(bus *TransactionEventBus) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	mp.transactionEventBus = bus
 }
 
 // Returns an estimate of the number of txns in the mempool. This is an estimate because
@@ -2508,6 +2877,11 @@ func EstimateMaxTxnFeeV1(txn *MsgDeSoTxn, minFeeRateNanosPerKB uint64) uint64 {
 
 func (mp *DeSoMempool) EstimateFee(txn *MsgDeSoTxn, minFeeRateNanosPerKB uint64) (uint64, error) {
 	feeRate := mp.EstimateFeeRate(minFeeRateNanosPerKB)
+	// Don't estimate a fee below the minimum of the txn's type.
+	if txnMinFeeRateNanosPerKB := mp.readOnlyUtxoView.GetCurrentGlobalParamsEntry().
+		GetMinimumNetworkFeeNanosPerKBForTxn(txn); feeRate < txnMinFeeRateNanosPerKB {
+		feeRate = txnMinFeeRateNanosPerKB
+	}
 	return EstimateMaxTxnFeeV1(txn, feeRate), nil
 }
 
@@ -2545,7 +2919,21 @@ func (mp *DeSoMempool) inefficientRemoveTransaction(tx *MsgDeSoTxn) {
 	// In this case we remove the transaction by re-adding all the txns we can
 	// to the mempool except this one.
 	// TODO(performance): This could be a bit slow.
-	//
+	newPool := mp._newPoolWithoutTxns(map[BlockHash]bool{*tx.Hash(): true})
+	if numEvictedTxns := len(mp.poolMap) - len(newPool.poolMap); numEvictedTxns > 0 {
+		mp._recordEvictions(MempoolEvictionReasonRemoved, 1)
+		mp._recordEvictions(MempoolEvictionReasonDependencyRemoved, numEvictedTxns-1)
+	}
+
+	// Replace the internal mappings of the original pool with the mappings of the new
+	// pool.
+	mp.resetPool(newPool)
+	mp._rewriteJournal()
+}
+
+// _newPoolWithoutTxns returns a new pool with all the txns in this one that can still be
+// added without the excluded txns. Txns that depend on the excluded txns are dropped.
+func (mp *DeSoMempool) _newPoolWithoutTxns(excludedTxnHashes map[BlockHash]bool) *DeSoMempool {
 	// Create a new DeSoMempool. No need to set the min fees since we're just using
 	// this as a temporary data structure for validation.
 	//
@@ -2558,12 +2946,12 @@ func (mp *DeSoMempool) inefficientRemoveTransaction(tx *MsgDeSoTxn) {
 	// add the txns from the original pool. Start by fetching them in slice form.
 	oldMempoolTxns, oldUnconnectedTxns, err := mp._getTransactionsOrderedByTimeAdded()
 	if err != nil {
-		glog.Warning(errors.Wrapf(err, "inefficientRemoveTransaction: "))
+		glog.Warning(errors.Wrapf(err, "_newPoolWithoutTxns: "))
 	}
 	// Iterate through the pool transactions and add them to our new pool.
 
 	for _, mempoolTx := range oldMempoolTxns {
-		if *(mempoolTx.Tx.Hash()) == *(tx.Hash()) {
+		if excludedTxnHashes[*mempoolTx.Hash] {
 			continue
 		}
 
@@ -2572,10 +2960,10 @@ func (mp *DeSoMempool) inefficientRemoveTransaction(tx *MsgDeSoTxn) {
 			mempoolTx.Tx, false /*allowUnconnectedTxn*/, false, /*rateLimit*/
 			0 /*peerID*/, false /*verifySignatures*/)
 		if err != nil {
-			glog.Warning(errors.Wrapf(err, "inefficientRemoveTransaction: "))
+			glog.Warning(errors.Wrapf(err, "_newPoolWithoutTxns: "))
 		}
 		if len(txnsAccepted) == 0 {
-			glog.Warningf("inefficientRemoveTransaction: Dropping txn %v", mempoolTx.Tx)
+			glog.Warningf("_newPoolWithoutTxns: Dropping txn %v", mempoolTx.Tx)
 		}
 	}
 	// Iterate through the unconnectedTxns and add them to our new pool as well.
@@ -2585,17 +2973,14 @@ func (mp *DeSoMempool) inefficientRemoveTransaction(tx *MsgDeSoTxn) {
 		verifySignatures := false
 		_, err := newPool.processTransaction(oTx.tx, allowUnconnectedTxn, rateLimit, oTx.peerID, verifySignatures)
 		if err != nil {
-			glog.Warning(errors.Wrapf(err, "inefficientRemoveTransaction: "))
+			glog.Warning(errors.Wrapf(err, "_newPoolWithoutTxns: "))
 		}
 	}
 
 	// At this point the new mempool should be a duplicate of the original mempool but with
 	// the non-double-spend transactions added (with timestamps set before the transactions that
 	// were in the original pool.
-
-	// Replace the internal mappings of the original pool with the mappings of the new
-	// pool.
-	mp.resetPool(newPool)
+	return newPool
 }
 
 func (mp *DeSoMempool) InefficientRemoveTransaction(tx *MsgDeSoTxn) {
@@ -2772,9 +3157,9 @@ func NewDeSoMempool(_bc *Blockchain, _rateLimitFeerateNanosPerKB uint64,
 	_minFeerateNanosPerKB uint64, _blockCypherAPIKey string,
 	_runReadOnlyViewUpdater bool, _dataDir string, _mempoolDumpDir string, useDefaultBadgerOptions bool) *DeSoMempool {
 
-	utxoView := NewUtxoView(_bc.db, _bc.params, _bc.postgres, _bc.snapshot, _bc.eventManager)
-	backupUtxoView := NewUtxoView(_bc.db, _bc.params, _bc.postgres, _bc.snapshot, _bc.eventManager)
-	readOnlyUtxoView := NewUtxoView(_bc.db, _bc.params, _bc.postgres, _bc.snapshot, _bc.eventManager)
+	utxoView := _bc.NewUtxoView()
+	backupUtxoView := _bc.NewUtxoView()
+	readOnlyUtxoView := _bc.NewUtxoView()
 	newPool := &DeSoMempool{
 		quit:                            make(chan struct{}),
 		bc:                              _bc,
@@ -2785,6 +3170,8 @@ func NewDeSoMempool(_bc *Blockchain, _rateLimitFeerateNanosPerKB uint64,
 		unconnectedTxnsByPrev:           make(map[UtxoKey]map[BlockHash]*MsgDeSoTxn),
 		outpoints:                       make(map[UtxoKey]*MsgDeSoTxn),
 		pubKeyToTxnMap:                  make(map[PkMapKey]map[BlockHash]*MempoolTx),
+		idempotencyKeyTracker:           NewIdempotencyKeyTracker(),
+		counters:                        newMempoolCounters(),
 		blockCypherAPIKey:               _blockCypherAPIKey,
 		backupUniversalUtxoView:         backupUtxoView,
 		universalUtxoView:               utxoView,
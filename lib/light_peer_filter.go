@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// ==================================================================
+// FILTER_LOAD and FILTER_CLEAR Messages
+// ==================================================================
+
+// A light client, like a mobile wallet, only cares about the txns that touch its own accounts,
+// but a node invs its peers every txn that enters its mempool. A light client can send a node
+// that advertises SFTxnFilter a FILTER_LOAD message listing the data it's interested in, usually
+// the public keys of its accounts. The node then only invs it the mempool txns that contain one
+// of the elements anywhere in their serialized form, which covers the sender, the outputs, and
+// the public keys in the txn's metadata and extra data. Block invs are still relayed as usual.
+//
+// An element can also be a prefix of a public key. A short prefix matches the txns of every
+// account that shares it, which keeps the node from learning exactly which accounts the client
+// follows, at the cost of some unrelated txns.
+//
+// Loading a filter replaces the previous one, and a FILTER_CLEAR message goes back to relaying
+// every txn. Either way, the txns that were already in the mempool and didn't match the old
+// filter aren't invved later, so a client that changes its filter should follow up with a
+// MEMPOOL_SYNC message to get the mempool txns that match the new one.
+
+const (
+	// MaxLightPeerFilterElements is the most elements a FILTER_LOAD message can list.
+	MaxLightPeerFilterElements = 1000
+	// MinLightPeerFilterElementLen keeps a client from loading a filter that matches nearly
+	// every txn, which would cost the node the matching without saving any relay traffic.
+	MinLightPeerFilterElementLen = 4
+	MaxLightPeerFilterElementLen = 64
+)
+
+// LightPeerFilter decides which txns are relayed to a peer that loaded a filter.
+type LightPeerFilter struct {
+	elements [][]byte
+}
+
+// NewLightPeerFilter returns a filter that matches the txns containing any of the elements.
+func NewLightPeerFilter(elements [][]byte) (*LightPeerFilter, error) {
+	if err := validateLightPeerFilterElements(elements); err != nil {
+		return nil, errors.Wrapf(err, "NewLightPeerFilter: ")
+	}
+	filter := &LightPeerFilter{}
+	for _, element := range elements {
+		filter.elements = append(filter.elements, append([]byte{}, element...))
+	}
+	return filter, nil
+}
+
+func validateLightPeerFilterElements(elements [][]byte) error {
+	if len(elements) > MaxLightPeerFilterElements {
+		return fmt.Errorf("validateLightPeerFilterElements: Number of elements %d exceeds max allowed %d",
+			len(elements), MaxLightPeerFilterElements)
+	}
+	for ii, element := range elements {
+		if len(element) < MinLightPeerFilterElementLen || len(element) > MaxLightPeerFilterElementLen {
+			return fmt.Errorf("validateLightPeerFilterElements: Element %d has length %d but must be "+
+				"between %d and %d bytes", ii, len(element), MinLightPeerFilterElementLen, MaxLightPeerFilterElementLen)
+		}
+	}
+	return nil
+}
+
+// MatchesTxnBytes returns true if the serialized txn contains any of the filter's elements.
+func (filter *LightPeerFilter) MatchesTxnBytes(txnBytes []byte) bool {
+	for _, element := range filter.elements {
+		if bytes.Contains(txnBytes, element) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesTxn returns true if the txn contains any of the filter's elements.
+func (filter *LightPeerFilter) MatchesTxn(txn *MsgDeSoTxn) (bool, error) {
+	txnBytes, err := txn.ToBytes(false /*preSignature*/)
+	if err != nil {
+		return false, errors.Wrapf(err, "LightPeerFilter.MatchesTxn: Problem serializing txn: ")
+	}
+	return filter.MatchesTxnBytes(txnBytes), nil
+}
+
+// lightPeerTxnMatcher matches mempool txns against the filters of light peers, serializing
+// each txn at most once however many peers it's matched for.
+type lightPeerTxnMatcher struct {
+	txnBytes map[BlockHash][]byte
+}
+
+func newLightPeerTxnMatcher() *lightPeerTxnMatcher {
+	return &lightPeerTxnMatcher{txnBytes: make(map[BlockHash][]byte)}
+}
+
+// matches returns true if the txn should be relayed to a peer with the filter. Every txn is
+// relayed to a peer without a filter.
+func (matcher *lightPeerTxnMatcher) matches(filter *LightPeerFilter, mempoolTx *MempoolTx) bool {
+	if filter == nil {
+		return true
+	}
+	txnBytes, exists := matcher.txnBytes[*mempoolTx.Hash]
+	if !exists {
+		var err error
+		txnBytes, err = mempoolTx.Tx.ToBytes(false /*preSignature*/)
+		if err != nil {
+			// This should never happen for a txn in the mempool, but if it does, we'd
+			// rather relay the txn than have the peer miss it.
+			glog.Errorf("lightPeerTxnMatcher.matches: Problem serializing txn %v: %v", mempoolTx.Hash, err)
+			return true
+		}
+		matcher.txnBytes[*mempoolTx.Hash] = txnBytes
+	}
+	return filter.MatchesTxnBytes(txnBytes)
+}
+
+type MsgDeSoFilterLoad struct {
+	// Elements are the byte strings the sender is interested in, usually public keys or
+	// prefixes of them.
+	Elements [][]byte
+}
+
+func (msg *MsgDeSoFilterLoad) GetMsgType() MsgType {
+	return MsgTypeFilterLoad
+}
+
+func (msg *MsgDeSoFilterLoad) ToBytes(preSignature bool) ([]byte, error) {
+	if err := validateLightPeerFilterElements(msg.Elements); err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoFilterLoad.ToBytes: ")
+	}
+	retBytes := UintToBuf(uint64(len(msg.Elements)))
+	for _, element := range msg.Elements {
+		retBytes = append(retBytes, EncodeByteArray(element)...)
+	}
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoFilterLoad) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoFilterLoad{}
+
+	numElements, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoFilterLoad.FromBytes: Problem reading number of elements: ")
+	}
+	if numElements > MaxLightPeerFilterElements {
+		return fmt.Errorf("MsgDeSoFilterLoad.FromBytes: Number of elements %d exceeds max allowed %d",
+			numElements, MaxLightPeerFilterElements)
+	}
+	for ii := uint64(0); ii < numElements; ii++ {
+		element, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoFilterLoad.FromBytes: Problem reading element: ")
+		}
+		retMsg.Elements = append(retMsg.Elements, element)
+	}
+	if err = validateLightPeerFilterElements(retMsg.Elements); err != nil {
+		return errors.Wrapf(err, "MsgDeSoFilterLoad.FromBytes: ")
+	}
+
+	*msg = retMsg
+	return nil
+}
+
+type MsgDeSoFilterClear struct{}
+
+func (msg *MsgDeSoFilterClear) GetMsgType() MsgType {
+	return MsgTypeFilterClear
+}
+
+func (msg *MsgDeSoFilterClear) ToBytes(preSignature bool) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (msg *MsgDeSoFilterClear) FromBytes(data []byte) error {
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"github.com/golang/glog"
+)
+
+// _handleFilterLoad limits the txns we inv the peer to the ones that match its filter.
+func (srv *Server) _handleFilterLoad(pp *Peer, msg *MsgDeSoFilterLoad) {
+	filter, err := NewLightPeerFilter(msg.Elements)
+	if err != nil {
+		// The elements were validated when the message was decoded, so this should never happen.
+		glog.Errorf("Server._handleFilterLoad: Problem loading filter from Peer %v: %v", pp, err)
+		srv._penalizeAndDisconnectPeer(pp, "handleFilterLoad: Invalid filter")
+		return
+	}
+	glog.V(1).Infof("Server._handleFilterLoad: Loaded filter with %d elements from Peer %v",
+		len(msg.Elements), pp)
+	pp.SetTxnFilter(filter)
+}
+
+// _handleFilterClear goes back to inving the peer every txn.
+func (srv *Server) _handleFilterClear(pp *Peer, msg *MsgDeSoFilterClear) {
+	glog.V(1).Infof("Server._handleFilterClear: Cleared filter of Peer %v", pp)
+	pp.SetTxnFilter(nil)
+}
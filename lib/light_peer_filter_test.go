@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLightPeerFilter(t *testing.T) {
+	require := require.New(t)
+
+	senderPk := RandomBytes(33)
+	outputPk := RandomBytes(33)
+	receiverPk := RandomBytes(33)
+	otherPk := RandomBytes(33)
+	txn := &MsgDeSoTxn{
+		PublicKey: senderPk,
+		TxOutputs: []*DeSoOutput{{PublicKey: outputPk, AmountNanos: 10}},
+		TxnMeta: &CreatorCoinTransferMetadataa{
+			ProfilePublicKey:           senderPk,
+			CreatorCoinToTransferNanos: 100,
+			ReceiverPublicKey:          receiverPk,
+		},
+	}
+
+	// The filter matches the sender, the outputs, and the public keys in the metadata, as well as
+	// prefixes of them.
+	for _, element := range [][]byte{senderPk, outputPk, receiverPk, receiverPk[:MinLightPeerFilterElementLen]} {
+		filter, err := NewLightPeerFilter([][]byte{otherPk, element})
+		require.NoError(err)
+		matches, err := filter.MatchesTxn(txn)
+		require.NoError(err)
+		require.True(matches)
+	}
+	filter, err := NewLightPeerFilter([][]byte{otherPk})
+	require.NoError(err)
+	matches, err := filter.MatchesTxn(txn)
+	require.NoError(err)
+	require.False(matches)
+
+	// Elements that are too short or too long, or too many of them, are rejected.
+	_, err = NewLightPeerFilter([][]byte{otherPk[:MinLightPeerFilterElementLen-1]})
+	require.Error(err)
+	_, err = NewLightPeerFilter([][]byte{RandomBytes(MaxLightPeerFilterElementLen + 1)})
+	require.Error(err)
+	tooManyElements := make([][]byte, MaxLightPeerFilterElements+1)
+	for ii := range tooManyElements {
+		tooManyElements[ii] = otherPk
+	}
+	_, err = NewLightPeerFilter(tooManyElements)
+	require.Error(err)
+
+	// The matcher relays every txn to peers without a filter.
+	txnHash := txn.Hash()
+	matcher := newLightPeerTxnMatcher()
+	mempoolTx := &MempoolTx{Tx: txn, Hash: txnHash}
+	require.True(matcher.matches(nil, mempoolTx))
+	require.False(matcher.matches(filter, mempoolTx))
+	receiverFilter, err := NewLightPeerFilter([][]byte{receiverPk})
+	require.NoError(err)
+	require.True(matcher.matches(receiverFilter, mempoolTx))
+
+	// The messages round-trip.
+	loadMsg := &MsgDeSoFilterLoad{Elements: [][]byte{senderPk, receiverPk[:8]}}
+	loadBytes, err := loadMsg.ToBytes(false)
+	require.NoError(err)
+	decodedLoadMsg := NewMessage(MsgTypeFilterLoad)
+	require.NoError(decodedLoadMsg.FromBytes(loadBytes))
+	require.Equal(loadMsg, decodedLoadMsg)
+	_, err = (&MsgDeSoFilterLoad{Elements: tooManyElements}).ToBytes(false)
+	require.Error(err)
+	require.Error((&MsgDeSoFilterLoad{}).FromBytes(UintToBuf(MaxLightPeerFilterElements + 1)))
+	require.Error((&MsgDeSoFilterLoad{}).FromBytes(append(UintToBuf(1), EncodeByteArray([]byte{1})...)))
+
+	clearBytes, err := (&MsgDeSoFilterClear{}).ToBytes(false)
+	require.NoError(err)
+	decodedClearMsg := NewMessage(MsgTypeFilterClear)
+	require.NoError(decodedClearMsg.FromBytes(clearBytes))
+	require.Equal(MsgTypeFilterClear, decodedClearMsg.GetMsgType())
+}
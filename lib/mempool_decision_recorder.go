@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Changes to mempool acceptance, e.g. to the relay policy or to fee checks, are hard to
+// validate before deploy because the txns that exercise them only show up in real traffic.
+// A node can record every mempool acceptance decision along with the inputs needed to
+// reproduce it, and a new version can replay the recorded decisions to report every txn it
+// would decide differently.
+//
+// Recording is a debugging aid. The log grows with every txn the node processes and is
+// written while the mempool lock is held, so it shouldn't be left on in production.
+
+// MempoolDecision is a recorded call to DeSoMempool.ProcessTransaction and its result.
+type MempoolDecision struct {
+	TxnHashHex string
+	TxnHex     string
+
+	AllowUnconnectedTxn bool
+	RateLimit           bool
+	PeerID              uint64
+	VerifySignatures    bool
+
+	// The tip the txn was validated against. A replay against a different tip can disagree
+	// for reasons that have nothing to do with the mempool's rules.
+	TipHeight  uint64
+	TipHashHex string
+
+	Accepted bool
+	// Unconnected is true if the txn was accepted as an unconnected txn.
+	Unconnected bool
+	Error       string
+
+	TimestampNanoSecs uint64
+}
+
+// MempoolDecisionRecorder appends MempoolDecisions to a file as JSON, one per line.
+type MempoolDecisionRecorder struct {
+	mtx     sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewMempoolDecisionRecorder returns a recorder that appends to the file at path, creating
+// it if it doesn't exist.
+func NewMempoolDecisionRecorder(path string) (*MempoolDecisionRecorder, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewMempoolDecisionRecorder: problem opening %v: ", path)
+	}
+	return &MempoolDecisionRecorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// RecordDecision records the result of processing a txn. Errors are logged rather than
+// returned, since recording mustn't change the decision.
+func (recorder *MempoolDecisionRecorder) RecordDecision(decision *MempoolDecision) {
+	recorder.mtx.Lock()
+	defer recorder.mtx.Unlock()
+
+	if recorder.file == nil {
+		return
+	}
+	if err := recorder.encoder.Encode(decision); err != nil {
+		glog.Errorf("MempoolDecisionRecorder.RecordDecision: problem recording txn %v: %v",
+			decision.TxnHashHex, err)
+	}
+}
+
+func (recorder *MempoolDecisionRecorder) Close() error {
+	recorder.mtx.Lock()
+	defer recorder.mtx.Unlock()
+
+	if recorder.file == nil {
+		return nil
+	}
+	err := recorder.file.Close()
+	recorder.file = nil
+	return err
+}
+
+func newMempoolDecision(txn *MsgDeSoTxn, allowUnconnectedTxn bool, rateLimit bool, peerID uint64,
+	verifySignatures bool, tipNode *BlockNode, acceptedTxns []*MempoolTx, processErr error) (*MempoolDecision, error) {
+
+	txnBytes, err := txn.ToBytes(false)
+	if err != nil {
+		return nil, err
+	}
+	decision := &MempoolDecision{
+		TxnHashHex:          hex.EncodeToString(txn.Hash()[:]),
+		TxnHex:              hex.EncodeToString(txnBytes),
+		AllowUnconnectedTxn: allowUnconnectedTxn,
+		RateLimit:           rateLimit,
+		PeerID:              peerID,
+		VerifySignatures:    verifySignatures,
+		Accepted:            processErr == nil,
+		Unconnected:         processErr == nil && len(acceptedTxns) == 0,
+		TimestampNanoSecs:   uint64(time.Now().UnixNano()),
+	}
+	if tipNode != nil {
+		decision.TipHeight = uint64(tipNode.Height)
+		decision.TipHashHex = hex.EncodeToString(tipNode.Hash[:])
+	}
+	if processErr != nil {
+		decision.Error = processErr.Error()
+	}
+	return decision, nil
+}
+
+// LoadMempoolDecisions reads the decisions recorded by a MempoolDecisionRecorder.
+func LoadMempoolDecisions(path string) ([]*MempoolDecision, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadMempoolDecisions: problem opening %v: ", path)
+	}
+	defer file.Close()
+
+	var decisions []*MempoolDecision
+	decoder := json.NewDecoder(file)
+	for {
+		decision := &MempoolDecision{}
+		if err := decoder.Decode(decision); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "LoadMempoolDecisions: problem decoding decision %d: ", len(decisions))
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+// MempoolDecisionMismatch is a recorded decision that was decided differently on replay.
+type MempoolDecisionMismatch struct {
+	Decision *MempoolDecision
+
+	ReplayedAccepted    bool
+	ReplayedUnconnected bool
+	ReplayedError       string
+}
+
+func (mismatch *MempoolDecisionMismatch) String() string {
+	return fmt.Sprintf("< Txn: %v, Recorded: (accepted: %v, unconnected: %v, error: %v), "+
+		"Replayed: (accepted: %v, unconnected: %v, error: %v) >", mismatch.Decision.TxnHashHex,
+		mismatch.Decision.Accepted, mismatch.Decision.Unconnected, mismatch.Decision.Error,
+		mismatch.ReplayedAccepted, mismatch.ReplayedUnconnected, mismatch.ReplayedError)
+}
+
+// MempoolDecisionReplayReport summarizes a replay of recorded decisions.
+type MempoolDecisionReplayReport struct {
+	NumDecisions uint64
+	NumMatches   uint64
+	// NumTipMismatches is the number of decisions that were recorded against a different tip
+	// than the one they were replayed against.
+	NumTipMismatches uint64
+	Mismatches       []*MempoolDecisionMismatch
+}
+
+// ReplayMempoolDecisions runs the recorded decisions, in order, through the relay policy and
+// then the mempool, and reports every txn that isn't accepted or rejected the same way it was
+// when it was recorded. The mempool should be a fresh one over a chain at the tip the
+// decisions were recorded at, since txns that were mined since then are rejected on replay.
+// The relay policy can be nil. Only acceptance is compared, not the exact error.
+func ReplayMempoolDecisions(mempool *DeSoMempool, relayPolicy *RelayPolicy, decisions []*MempoolDecision) (
+	*MempoolDecisionReplayReport, error) {
+
+	report := &MempoolDecisionReplayReport{}
+	for ii, decision := range decisions {
+		txnBytes, err := hex.DecodeString(decision.TxnHex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ReplayMempoolDecisions: problem decoding txn %d: ", ii)
+		}
+		txn := &MsgDeSoTxn{}
+		if err = txn.FromBytes(txnBytes); err != nil {
+			return nil, errors.Wrapf(err, "ReplayMempoolDecisions: problem parsing txn %d: ", ii)
+		}
+
+		var acceptedTxns []*MempoolTx
+		var replayErr error
+		if relayPolicy != nil {
+			replayErr = relayPolicy.CheckTransactionForRelay(txn, mempool.bc.params)
+		}
+		if replayErr == nil {
+			acceptedTxns, replayErr = mempool.ProcessTransaction(txn, decision.AllowUnconnectedTxn,
+				decision.RateLimit, decision.PeerID, decision.VerifySignatures)
+		}
+
+		report.NumDecisions++
+		if tipNode := mempool.bc.BlockTip(); decision.TipHashHex != hex.EncodeToString(tipNode.Hash[:]) {
+			report.NumTipMismatches++
+		}
+		replayedAccepted := replayErr == nil
+		replayedUnconnected := replayErr == nil && len(acceptedTxns) == 0
+		if replayedAccepted == decision.Accepted && replayedUnconnected == decision.Unconnected {
+			report.NumMatches++
+			continue
+		}
+		mismatch := &MempoolDecisionMismatch{
+			Decision:            decision,
+			ReplayedAccepted:    replayedAccepted,
+			ReplayedUnconnected: replayedUnconnected,
+		}
+		if replayErr != nil {
+			mismatch.ReplayedError = replayErr.Error()
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	return report, nil
+}
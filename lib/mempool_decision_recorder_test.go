@@ -0,0 +1,61 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMempoolDecisionReplay(t *testing.T) {
+	require := require.New(t)
+
+	chain, _, _, _ := _setupFiveBlocks(t)
+	newMempool := func() *DeSoMempool {
+		return NewDeSoMempool(chain, 0, 0, "", false, "", "", true)
+	}
+
+	// Record a txn being accepted and then rejected as a duplicate.
+	logPath := filepath.Join(t.TempDir(), "mempool_decisions.log")
+	recorder, err := NewMempoolDecisionRecorder(logPath)
+	require.NoError(err)
+	mp := newMempool()
+	mp.SetDecisionRecorder(recorder)
+	txn := _assembleBasicTransferTxnFullySigned(t, chain, 1, 0,
+		senderPkString, recipientPkString, senderPrivString, nil)
+	_, err = mp.ProcessTransaction(txn, false, false, 0, true)
+	require.NoError(err)
+	_, err = mp.ProcessTransaction(txn, false, false, 0, true)
+	require.Error(err)
+	require.NoError(recorder.Close())
+
+	decisions, err := LoadMempoolDecisions(logPath)
+	require.NoError(err)
+	require.Len(decisions, 2)
+	require.True(decisions[0].Accepted)
+	require.False(decisions[0].Unconnected)
+	require.False(decisions[1].Accepted)
+	require.NotEmpty(decisions[1].Error)
+	require.Equal(uint64(chain.BlockTip().Height), decisions[0].TipHeight)
+
+	// Replaying against the same rules decides every txn the same way.
+	report, err := ReplayMempoolDecisions(newMempool(), nil, decisions)
+	require.NoError(err)
+	require.Equal(uint64(2), report.NumDecisions)
+	require.Equal(uint64(2), report.NumMatches)
+	require.Equal(uint64(0), report.NumTipMismatches)
+	require.Empty(report.Mismatches)
+
+	// A relay policy that denies the recipient changes the first decision only.
+	relayPolicy := NewRelayPolicy()
+	require.NoError(relayPolicy.SetDeniedPublicKeys([]string{recipientPkString}))
+	report, err = ReplayMempoolDecisions(newMempool(), relayPolicy, decisions)
+	require.NoError(err)
+	require.Equal(uint64(1), report.NumMatches)
+	require.Len(report.Mismatches, 1)
+	require.Equal(decisions[0], report.Mismatches[0].Decision)
+	require.False(report.Mismatches[0].ReplayedAccepted)
+	require.Contains(report.Mismatches[0].ReplayedError, "refuses to relay")
+}
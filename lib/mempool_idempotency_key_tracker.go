@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// idempotencyKeyTrackerKey is a private type used by the IdempotencyKeyTracker to index transactions by
+// (public key, idempotency key) pairs. Scoping the idempotency key to the transactor's public key means one
+// user's keys can never collide with, or block, another user's transactions.
+type idempotencyKeyTrackerKey struct {
+	publicKey      PublicKey
+	idempotencyKey string
+}
+
+// GetTxnIdempotencyKey returns the idempotency key a client attached to the txn's ExtraData, or nil if there
+// isn't one. Consensus ignores the key. It's only used by the mempools to deduplicate retried submissions.
+//
+// Atomic txn wrappers don't have a single transactor, so they're never deduplicated by idempotency key.
+func GetTxnIdempotencyKey(txn *MsgDeSoTxn) []byte {
+	if txn == nil || txn.TxnMeta == nil || txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+		return nil
+	}
+	idempotencyKey, exists := txn.ExtraData[IdempotencyKeyExtraDataKey]
+	if !exists || len(idempotencyKey) == 0 {
+		return nil
+	}
+	return idempotencyKey
+}
+
+func newIdempotencyKeyTrackerKey(txn *MsgDeSoTxn) (idempotencyKeyTrackerKey, bool) {
+	idempotencyKey := GetTxnIdempotencyKey(txn)
+	if idempotencyKey == nil || len(txn.PublicKey) != btcec.PubKeyBytesLenCompressed {
+		return idempotencyKeyTrackerKey{}, false
+	}
+	return idempotencyKeyTrackerKey{
+		publicKey:      *NewPublicKey(txn.PublicKey),
+		idempotencyKey: string(idempotencyKey),
+	}, true
+}
+
+// IdempotencyKeyTracker is a helper struct that is used to track (public key, idempotency key) pairs in the
+// mempools. Apps that retry a submission after a timeout often re-sign the txn, which produces a new txn that
+// spends the same funds a second time. If both attach the same idempotency key, the mempool can recognize the
+// retry and hand back the original txn instead of accepting a conflicting one.
+type IdempotencyKeyTracker struct {
+	sync.RWMutex
+
+	// idempotencyKeyMap indexes mempool transactions by (public key, idempotency key) pairs.
+	idempotencyKeyMap map[idempotencyKeyTrackerKey]*MempoolTx
+}
+
+func NewIdempotencyKeyTracker() *IdempotencyKeyTracker {
+	return &IdempotencyKeyTracker{
+		idempotencyKeyMap: make(map[idempotencyKeyTrackerKey]*MempoolTx),
+	}
+}
+
+// GetTxnByIdempotencyKey returns the tracked transaction from the same transactor that used the same
+// idempotency key as the given txn, if there is one.
+func (tracker *IdempotencyKeyTracker) GetTxnByIdempotencyKey(txn *MsgDeSoTxn) *MempoolTx {
+	key, ok := newIdempotencyKeyTrackerKey(txn)
+	if !ok {
+		return nil
+	}
+
+	tracker.RLock()
+	defer tracker.RUnlock()
+
+	mempoolTx, _ := tracker.idempotencyKeyMap[key]
+	return mempoolTx
+}
+
+// GetConflictingTxn returns the tracked transaction that used the same idempotency key as the given txn,
+// unless it's the given txn itself.
+func (tracker *IdempotencyKeyTracker) GetConflictingTxn(txn *MsgDeSoTxn) *MempoolTx {
+	existingTxn := tracker.GetTxnByIdempotencyKey(txn)
+	if existingTxn == nil || existingTxn.Hash.IsEqual(txn.Hash()) {
+		return nil
+	}
+	return existingTxn
+}
+
+// AddTxn adds a (pk, idempotency key) -> txn mapping to the tracker. It's a no-op if the txn doesn't carry
+// an idempotency key.
+func (tracker *IdempotencyKeyTracker) AddTxn(mempoolTx *MempoolTx) {
+	key, ok := newIdempotencyKeyTrackerKey(mempoolTx.Tx)
+	if !ok {
+		return
+	}
+
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	tracker.idempotencyKeyMap[key] = mempoolTx
+}
+
+// RemoveTxn removes the txn's (pk, idempotency key) mapping from the tracker, as long as the mapping still
+// points to this txn.
+func (tracker *IdempotencyKeyTracker) RemoveTxn(mempoolTx *MempoolTx) {
+	key, ok := newIdempotencyKeyTrackerKey(mempoolTx.Tx)
+	if !ok {
+		return
+	}
+
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	if existingTxn, exists := tracker.idempotencyKeyMap[key]; exists && existingTxn.Hash.IsEqual(mempoolTx.Hash) {
+		delete(tracker.idempotencyKeyMap, key)
+	}
+}
+
+func (tracker *IdempotencyKeyTracker) Reset() {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	tracker.idempotencyKeyMap = make(map[idempotencyKeyTrackerKey]*MempoolTx)
+}
@@ -0,0 +1,48 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyKeyTracker(t *testing.T) {
+	require := require.New(t)
+
+	newTxn := func(publicKey []byte, idempotencyKey string, amountNanos uint64) *MempoolTx {
+		txn := &MsgDeSoTxn{
+			TxOutputs: []*DeSoOutput{{PublicKey: m1PkBytes, AmountNanos: amountNanos}},
+			PublicKey: publicKey,
+			TxnMeta:   &BasicTransferMetadata{},
+		}
+		if idempotencyKey != "" {
+			txn.ExtraData = map[string][]byte{IdempotencyKeyExtraDataKey: []byte(idempotencyKey)}
+		}
+		return &MempoolTx{Tx: txn, Hash: txn.Hash()}
+	}
+
+	tracker := NewIdempotencyKeyTracker()
+	originalTxn := newTxn(m0PkBytes, "retry-1", 100)
+	tracker.AddTxn(originalTxn)
+
+	// A re-signed retry from the same transactor conflicts with the original txn, but the
+	// original txn doesn't conflict with itself.
+	retryTxn := newTxn(m0PkBytes, "retry-1", 101)
+	require.Equal(originalTxn, tracker.GetTxnByIdempotencyKey(retryTxn.Tx))
+	require.Equal(originalTxn, tracker.GetConflictingTxn(retryTxn.Tx))
+	require.Nil(tracker.GetConflictingTxn(originalTxn.Tx))
+
+	// Keys are scoped to the transactor, and txns without a key are never tracked.
+	require.Nil(tracker.GetTxnByIdempotencyKey(newTxn(m2PkBytes, "retry-1", 100).Tx))
+	require.Nil(tracker.GetTxnByIdempotencyKey(newTxn(m0PkBytes, "retry-2", 100).Tx))
+	tracker.AddTxn(newTxn(m0PkBytes, "", 100))
+	require.Len(tracker.idempotencyKeyMap, 1)
+
+	// Removing a txn that isn't the tracked one leaves the mapping alone.
+	tracker.RemoveTxn(retryTxn)
+	require.Equal(originalTxn, tracker.GetTxnByIdempotencyKey(retryTxn.Tx))
+	tracker.RemoveTxn(originalTxn)
+	require.Nil(tracker.GetTxnByIdempotencyKey(retryTxn.Tx))
+}
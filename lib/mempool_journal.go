@@ -0,0 +1,306 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// The DeSoMempool only lives in memory, so a node drops all of its unconfirmed txns when it
+// restarts. A MempoolJournal persists every txn the mempool accepts to an append-only file so
+// that they can be replayed through the mempool when the node starts back up.
+//
+// Each record is the length of the txn's bytes, a CRC32 checksum of them, and the bytes
+// themselves. A node that crashes can leave a partially written record at the end of the
+// file, and a record can be corrupted on disk, so the journal is read as far as it can be:
+// a record whose checksum or txn doesn't match is skipped, and reading stops at a record
+// that's cut off or whose length is invalid, since the records after it can't be found.
+//
+// The journal isn't pruned when txns are mined. Instead, it's rewritten with the txns in the
+// mempool once it has accumulated enough stale records, when txns are removed from the
+// mempool or a block is disconnected, and when it's loaded, which also discards any
+// corrupted records. A txn that replaced another by fee is journaled after it, so it only
+// replaces it again on replay if replacements are allowed then.
+//
+// The PoS mempool persists its txns on its own, see pos_mempool_persister.go.
+
+const (
+	// mempoolJournalRecordHeaderSize is the size of a record's length and checksum.
+	mempoolJournalRecordHeaderSize = 8
+	// MempoolJournalMinRecordsToCompact is the number of stale records the journal has to
+	// accumulate before it's rewritten.
+	MempoolJournalMinRecordsToCompact = 1000
+)
+
+// MempoolJournal is an append-only file of the txns accepted by the mempool.
+type MempoolJournal struct {
+	mtx  sync.Mutex
+	path string
+	file *os.File
+	// numRecords is the number of records written to the file since it was opened or last
+	// rewritten. Records that were in the file when it was opened aren't counted.
+	numRecords uint64
+}
+
+// NewMempoolJournal returns a journal that appends to the file at path, creating it if it
+// doesn't exist.
+func NewMempoolJournal(path string) (*MempoolJournal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewMempoolJournal: problem opening %v: ", path)
+	}
+	return &MempoolJournal{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// AppendTxn appends the txn to the journal. Errors are logged rather than returned, since
+// failing to persist a txn mustn't stop the mempool from accepting it.
+func (journal *MempoolJournal) AppendTxn(txn *MsgDeSoTxn) {
+	journal.mtx.Lock()
+	defer journal.mtx.Unlock()
+
+	if journal.file == nil {
+		return
+	}
+	record, err := encodeMempoolJournalRecord(txn)
+	if err == nil {
+		_, err = journal.file.Write(record)
+	}
+	if err != nil {
+		glog.Errorf("MempoolJournal.AppendTxn: problem appending txn %v: %v", txn.Hash(), err)
+		return
+	}
+	journal.numRecords++
+}
+
+// Rewrite replaces the contents of the journal with the txns. The new contents are written
+// to a temp file that's then moved over the journal, so a crash leaves either the old or the
+// new contents in place.
+func (journal *MempoolJournal) Rewrite(txns []*MsgDeSoTxn) error {
+	journal.mtx.Lock()
+	defer journal.mtx.Unlock()
+
+	if journal.file == nil {
+		return errors.New("MempoolJournal.Rewrite: journal is closed")
+	}
+
+	tempPath := journal.path + ".tmp"
+	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "MempoolJournal.Rewrite: problem opening %v: ", tempPath)
+	}
+	var contents bytes.Buffer
+	for _, txn := range txns {
+		record, err := encodeMempoolJournalRecord(txn)
+		if err != nil {
+			tempFile.Close()
+			return errors.Wrapf(err, "MempoolJournal.Rewrite: problem encoding txn %v: ", txn.Hash())
+		}
+		contents.Write(record)
+	}
+	if _, err = tempFile.Write(contents.Bytes()); err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "MempoolJournal.Rewrite: problem writing %v: ", tempPath)
+	}
+
+	// Swap the temp file in and reopen the journal on it.
+	if err = journal.file.Close(); err != nil {
+		glog.Errorf("MempoolJournal.Rewrite: problem closing %v: %v", journal.path, err)
+	}
+	journal.file = nil
+	if err = os.Rename(tempPath, journal.path); err != nil {
+		return errors.Wrapf(err, "MempoolJournal.Rewrite: problem moving %v to %v: ", tempPath, journal.path)
+	}
+	journal.file, err = os.OpenFile(journal.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "MempoolJournal.Rewrite: problem reopening %v: ", journal.path)
+	}
+	journal.numRecords = uint64(len(txns))
+	return nil
+}
+
+// NumRecords returns the number of records written to the journal since it was opened or
+// last rewritten.
+func (journal *MempoolJournal) NumRecords() uint64 {
+	journal.mtx.Lock()
+	defer journal.mtx.Unlock()
+
+	return journal.numRecords
+}
+
+// ReadTxns returns the txns in the journal in the order they were appended, along with the
+// number of corrupted records that were skipped or that reading stopped at.
+func (journal *MempoolJournal) ReadTxns() (_txns []*MsgDeSoTxn, _numCorruptRecords int, _err error) {
+	journal.mtx.Lock()
+	defer journal.mtx.Unlock()
+
+	return ReadMempoolJournal(journal.path)
+}
+
+func (journal *MempoolJournal) Close() error {
+	journal.mtx.Lock()
+	defer journal.mtx.Unlock()
+
+	if journal.file == nil {
+		return nil
+	}
+	err := journal.file.Close()
+	journal.file = nil
+	return err
+}
+
+func encodeMempoolJournalRecord(txn *MsgDeSoTxn) ([]byte, error) {
+	txnBytes, err := txn.ToBytes(false)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, mempoolJournalRecordHeaderSize, mempoolJournalRecordHeaderSize+len(txnBytes))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(txnBytes)))
+	binary.BigEndian.PutUint32(record[4:mempoolJournalRecordHeaderSize], crc32.ChecksumIEEE(txnBytes))
+	return append(record, txnBytes...), nil
+}
+
+// ReadMempoolJournal returns the txns in the journal at path in the order they were appended,
+// along with the number of corrupted records that were skipped or that reading stopped at.
+// A journal that doesn't exist has no txns.
+func ReadMempoolJournal(path string) (_txns []*MsgDeSoTxn, _numCorruptRecords int, _err error) {
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "ReadMempoolJournal: problem reading %v: ", path)
+	}
+
+	var txns []*MsgDeSoTxn
+	numCorruptRecords := 0
+	reader := bytes.NewReader(contents)
+	for reader.Len() > 0 {
+		offset := len(contents) - reader.Len()
+		header := make([]byte, mempoolJournalRecordHeaderSize)
+		if _, err = io.ReadFull(reader, header); err != nil {
+			glog.Warningf("ReadMempoolJournal: Stopping at cut off record header at offset %d of %v", offset, path)
+			numCorruptRecords++
+			break
+		}
+		txnLen := binary.BigEndian.Uint32(header[:4])
+		if txnLen == 0 || txnLen > MaxMessagePayload || int(txnLen) > reader.Len() {
+			glog.Warningf("ReadMempoolJournal: Stopping at record with invalid length %d at offset %d of %v",
+				txnLen, offset, path)
+			numCorruptRecords++
+			break
+		}
+		txnBytes := make([]byte, txnLen)
+		if _, err = io.ReadFull(reader, txnBytes); err != nil {
+			return nil, 0, errors.Wrapf(err, "ReadMempoolJournal: problem reading record at offset %d: ", offset)
+		}
+
+		// The record's length was valid, so the records after it can still be read even if
+		// this one is corrupted.
+		if crc32.ChecksumIEEE(txnBytes) != binary.BigEndian.Uint32(header[4:]) {
+			glog.Warningf("ReadMempoolJournal: Skipping record with invalid checksum at offset %d of %v", offset, path)
+			numCorruptRecords++
+			continue
+		}
+		txn := &MsgDeSoTxn{}
+		if err = txn.FromBytes(txnBytes); err != nil {
+			glog.Warningf("ReadMempoolJournal: Skipping record with invalid txn at offset %d of %v: %v",
+				offset, path, err)
+			numCorruptRecords++
+			continue
+		}
+		txns = append(txns, txn)
+	}
+	return txns, numCorruptRecords, nil
+}
+
+// LoadJournal replays the txns in the journal through the mempool, then rewrites the journal
+// with the txns that were accepted and makes the mempool append every txn it accepts from
+// then on. It should be called before the mempool starts processing txns. Txns that are no
+// longer valid, e.g. because they were mined while the node was down, are dropped.
+func (mp *DeSoMempool) LoadJournal(journal *MempoolJournal) error {
+	txns, numCorruptRecords, err := journal.ReadTxns()
+	if err != nil {
+		return errors.Wrapf(err, "DeSoMempool.LoadJournal: ")
+	}
+
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	numAccepted := 0
+	for _, txn := range txns {
+		// The txns were validated when they were journaled, so their signatures don't need to
+		// be verified again.
+		mempoolTxs, err := mp.processTransaction(txn, false /*allowUnconnectedTxn*/, false, /*rateLimit*/
+			0 /*peerID*/, false /*verifySignatures*/)
+		if err != nil {
+			glog.V(1).Infof("DeSoMempool.LoadJournal: Dropping txn %v: %v", txn.Hash(), err)
+			continue
+		}
+		for _, mempoolTx := range mempoolTxs {
+			mp.transactionEventBus.NotifyMempoolAccepted(mempoolTx.Tx)
+		}
+		numAccepted++
+	}
+	glog.Infof("DeSoMempool.LoadJournal: Accepted %d of %d journaled txns, skipped %d corrupted records",
+		numAccepted, len(txns), numCorruptRecords)
+
+	if err = journal.Rewrite(mp._getJournaledTxns()); err != nil {
+		return errors.Wrapf(err, "DeSoMempool.LoadJournal: ")
+	}
+	mp.journal = journal
+	return nil
+}
+
+// _getJournaledTxns returns the txns in the pool in the order they were added, which is an
+// order they can be replayed in.
+func (mp *DeSoMempool) _getJournaledTxns() []*MsgDeSoTxn {
+	poolTxns, _, err := mp._getTransactionsOrderedByTimeAdded()
+	if err != nil {
+		glog.Errorf("DeSoMempool._getJournaledTxns: %v", err)
+	}
+	txns := make([]*MsgDeSoTxn, 0, len(poolTxns))
+	for _, mempoolTx := range poolTxns {
+		txns = append(txns, mempoolTx.Tx)
+	}
+	return txns
+}
+
+// _compactJournalIfNeeded rewrites the journal with the txns in the pool once most of its
+// records are for txns that have left the pool. Must be called with the write lock held.
+func (mp *DeSoMempool) _compactJournalIfNeeded() {
+	if mp.journal == nil {
+		return
+	}
+	numPoolTxns := uint64(len(mp.poolMap))
+	if mp.journal.NumRecords() < 2*numPoolTxns+MempoolJournalMinRecordsToCompact {
+		return
+	}
+	mp._rewriteJournal()
+}
+
+// _rewriteJournal rewrites the journal with the txns in the pool. It's called when txns leave
+// the pool in a way that replaying the journal wouldn't reproduce, e.g. when they're removed
+// explicitly, and when txns enter the pool without being journaled, e.g. when a block is
+// disconnected. Must be called with the write lock held.
+func (mp *DeSoMempool) _rewriteJournal() {
+	if mp.journal == nil {
+		return
+	}
+	if err := mp.journal.Rewrite(mp._getJournaledTxns()); err != nil {
+		glog.Errorf("DeSoMempool._rewriteJournal: %v", err)
+	}
+}
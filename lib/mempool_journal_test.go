@@ -0,0 +1,74 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMempoolJournal(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "mempool_journal")
+	txns := []*MsgDeSoTxn{
+		{PublicKey: m0PkBytes, TxnMeta: &BasicTransferMetadata{}},
+		{PublicKey: m1PkBytes, TxnMeta: &BasicTransferMetadata{}},
+		{PublicKey: m2PkBytes, TxnMeta: &BasicTransferMetadata{}},
+	}
+	txnHashes := func(txns []*MsgDeSoTxn) []*BlockHash {
+		var hashes []*BlockHash
+		for _, txn := range txns {
+			hashes = append(hashes, txn.Hash())
+		}
+		return hashes
+	}
+
+	// A journal that doesn't exist has no txns.
+	readTxns, numCorruptRecords, err := ReadMempoolJournal(path)
+	require.NoError(err)
+	require.Empty(readTxns)
+	require.Equal(0, numCorruptRecords)
+
+	journal, err := NewMempoolJournal(path)
+	require.NoError(err)
+	for _, txn := range txns {
+		journal.AppendTxn(txn)
+	}
+	require.Equal(uint64(3), journal.NumRecords())
+	readTxns, numCorruptRecords, err = journal.ReadTxns()
+	require.NoError(err)
+	require.Equal(txnHashes(txns), txnHashes(readTxns))
+	require.Equal(0, numCorruptRecords)
+
+	// Flip a byte in the second txn. Its record is skipped but the third is still read.
+	contents, err := os.ReadFile(path)
+	require.NoError(err)
+	firstRecord, err := encodeMempoolJournalRecord(txns[0])
+	require.NoError(err)
+	contents[len(firstRecord)+mempoolJournalRecordHeaderSize] ^= 0xff
+	// Cut off the end of a fourth record, like a crash in the middle of a write would.
+	fourthRecord, err := encodeMempoolJournalRecord(txns[0])
+	require.NoError(err)
+	contents = append(contents, fourthRecord[:len(fourthRecord)-1]...)
+	require.NoError(os.WriteFile(path, contents, 0644))
+
+	readTxns, numCorruptRecords, err = journal.ReadTxns()
+	require.NoError(err)
+	require.Equal(txnHashes([]*MsgDeSoTxn{txns[0], txns[2]}), txnHashes(readTxns))
+	require.Equal(2, numCorruptRecords)
+
+	// Rewriting the journal discards the corrupted records and appends after the new contents.
+	require.NoError(journal.Rewrite(readTxns))
+	journal.AppendTxn(txns[1])
+	require.Equal(uint64(3), journal.NumRecords())
+	require.NoError(journal.Close())
+
+	readTxns, numCorruptRecords, err = ReadMempoolJournal(path)
+	require.NoError(err)
+	require.Equal(txnHashes([]*MsgDeSoTxn{txns[0], txns[2], txns[1]}), txnHashes(readTxns))
+	require.Equal(0, numCorruptRecords)
+}
@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The DeSoMempool drops txns in a number of places: it rejects txns that don't pay enough,
+// that are rate limited, or that don't fit, it drops txns that stop connecting after a block
+// is connected or disconnected, and it evicts unconnected txns when there are too many or
+// they expire. MempoolMetrics gathers how full the mempool is, what it holds, and why txns
+// left it or never made it in, so that operators can tune its limits.
+//
+// The counters only cover the PoW mempool. They start at zero when the node starts.
+
+// MempoolEvictionReason is why txns were removed from the mempool.
+type MempoolEvictionReason string
+
+const (
+	// The txn stopped connecting after a block was connected, e.g. because a conflicting txn
+	// was mined. Txns that were mined aren't counted.
+	MempoolEvictionReasonInvalidAfterConnectBlock MempoolEvictionReason = "InvalidAfterConnectBlock"
+	// The txn stopped connecting after a block was disconnected.
+	MempoolEvictionReasonInvalidAfterDisconnectBlock MempoolEvictionReason = "InvalidAfterDisconnectBlock"
+	// The txn was replaced by a txn that paid a higher fee, see mempool_replace_by_fee.go.
+	MempoolEvictionReasonReplacedByFee MempoolEvictionReason = "ReplacedByFee"
+	// The txn depended on a txn that was replaced or removed.
+	MempoolEvictionReasonDependencyRemoved MempoolEvictionReason = "DependencyRemoved"
+	// The txn was removed explicitly.
+	MempoolEvictionReasonRemoved MempoolEvictionReason = "Removed"
+	// The unconnected txn expired before its parents showed up.
+	MempoolEvictionReasonUnconnectedExpired MempoolEvictionReason = "UnconnectedExpired"
+	// The unconnected txn was evicted to make room for another one.
+	MempoolEvictionReasonUnconnectedLimit MempoolEvictionReason = "UnconnectedLimit"
+)
+
+// MempoolRejectionReasonOther counts rejections whose error isn't a RuleError.
+const MempoolRejectionReasonOther = "Other"
+
+// MempoolMetrics is a snapshot of the state of the mempool and of the counters it keeps.
+type MempoolMetrics struct {
+	NumTxns            uint64
+	NumUnconnectedTxns uint64
+	// TotalTxSizeBytes is the size of the txns in the pool, which can't exceed
+	// MaxTotalTxSizeBytes. Txns that don't fit are rejected no matter what fee they pay.
+	TotalTxSizeBytes    uint64
+	MaxTotalTxSizeBytes uint64
+
+	// NumTxnsByType and TxSizeBytesByType break the pool down by txn type. Like the other
+	// maps, they're keyed by the txn type's string so that they read well when published.
+	NumTxnsByType     map[string]uint64
+	TxSizeBytesByType map[string]uint64
+
+	// MinFeeRateNanosPerKB is the lowest fee rate a txn can pay to get in: the higher of the
+	// node's min fee rate and the network's min fee rate. Txn types can have higher minimums,
+	// which are in MinFeeRateNanosPerKBByType. Txns that pay less than
+	// RateLimitFeeRateNanosPerKB are rate limited, and LowFeeTxSizeAccumulatorBytes is how much
+	// of the rate limit is in use.
+	MinFeeRateNanosPerKB         uint64
+	MinFeeRateNanosPerKBByType   map[string]uint64
+	RateLimitFeeRateNanosPerKB   uint64
+	LowFeeTxSizeAccumulatorBytes uint64
+	LowFeeTxLimitBytes           uint64
+
+	// NumTxnsAccepted counts the txns added to the pool, including unconnected txns that were
+	// added once their parents showed up. NumTxnsRejectedByReason counts the txns that were
+	// rejected by the RuleError they were rejected with, and NumTxnsEvictedByReason counts the
+	// txns that were removed from the pool without being mined.
+	NumTxnsAccepted         uint64
+	NumTxnsRejectedByReason map[string]uint64
+	NumTxnsEvictedByReason  map[MempoolEvictionReason]uint64
+}
+
+// mempoolCounters are the counters behind MempoolMetrics. They live on the mempool rather
+// than on its pool state, so they survive the pool being rebuilt. They're guarded by the
+// mempool's lock.
+type mempoolCounters struct {
+	numTxnsAccepted         uint64
+	numTxnsRejectedByReason map[string]uint64
+	numTxnsEvictedByReason  map[MempoolEvictionReason]uint64
+}
+
+func newMempoolCounters() *mempoolCounters {
+	return &mempoolCounters{
+		numTxnsRejectedByReason: make(map[string]uint64),
+		numTxnsEvictedByReason:  make(map[MempoolEvictionReason]uint64),
+	}
+}
+
+// _recordProcessTransactionResult counts the result of processing a txn. Must be called with
+// the write lock held.
+func (mp *DeSoMempool) _recordProcessTransactionResult(acceptedTxns []*MempoolTx, err error) {
+	if err == nil {
+		mp.counters.numTxnsAccepted += uint64(len(acceptedTxns))
+		return
+	}
+	reason := MempoolRejectionReasonOther
+	if ruleErr, isRuleErr := errors.Cause(err).(RuleError); isRuleErr {
+		reason = string(ruleErr)
+	}
+	mp.counters.numTxnsRejectedByReason[reason]++
+}
+
+// _recordEvictions counts txns that were removed from the pool. Must be called with the write
+// lock held.
+func (mp *DeSoMempool) _recordEvictions(reason MempoolEvictionReason, numTxns int) {
+	if numTxns <= 0 {
+		return
+	}
+	mp.counters.numTxnsEvictedByReason[reason] += uint64(numTxns)
+}
+
+// GetMetrics returns a snapshot of the mempool's metrics.
+func (mp *DeSoMempool) GetMetrics() *MempoolMetrics {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	metrics := &MempoolMetrics{
+		NumTxns:                      uint64(len(mp.poolMap)),
+		NumUnconnectedTxns:           uint64(len(mp.unconnectedTxns)),
+		TotalTxSizeBytes:             mp.totalTxSizeBytes,
+		MaxTotalTxSizeBytes:          MaxTotalTransactionSizeBytes,
+		NumTxnsByType:                make(map[string]uint64),
+		TxSizeBytesByType:            make(map[string]uint64),
+		MinFeeRateNanosPerKB:         mp.minFeeRateNanosPerKB,
+		MinFeeRateNanosPerKBByType:   make(map[string]uint64),
+		RateLimitFeeRateNanosPerKB:   mp.rateLimitFeeRateNanosPerKB,
+		LowFeeTxSizeAccumulatorBytes: uint64(mp.lowFeeTxSizeAccumulator),
+		LowFeeTxLimitBytes:           uint64(LowFeeTxLimitBytesPerTenMinutes),
+		NumTxnsAccepted:              mp.counters.numTxnsAccepted,
+		NumTxnsRejectedByReason:      make(map[string]uint64, len(mp.counters.numTxnsRejectedByReason)),
+		NumTxnsEvictedByReason:       make(map[MempoolEvictionReason]uint64, len(mp.counters.numTxnsEvictedByReason)),
+	}
+	for _, mempoolTx := range mp.poolMap {
+		txnType := mempoolTx.Tx.TxnMeta.GetTxnType().String()
+		metrics.NumTxnsByType[txnType]++
+		metrics.TxSizeBytesByType[txnType] += mempoolTx.TxSizeBytes
+	}
+	if mp.universalUtxoView != nil {
+		globalParams := mp.universalUtxoView.GetCurrentGlobalParamsEntry()
+		if globalParams.MinimumNetworkFeeNanosPerKB > metrics.MinFeeRateNanosPerKB {
+			metrics.MinFeeRateNanosPerKB = globalParams.MinimumNetworkFeeNanosPerKB
+		}
+		for txnType := range globalParams.TxnTypeMinimumNetworkFeeNanosPerKB {
+			if minFeeRate := globalParams.GetMinimumNetworkFeeNanosPerKBForTxnType(txnType); minFeeRate >
+				metrics.MinFeeRateNanosPerKB {
+				metrics.MinFeeRateNanosPerKBByType[txnType.String()] = minFeeRate
+			}
+		}
+	}
+	for reason, numTxns := range mp.counters.numTxnsRejectedByReason {
+		metrics.NumTxnsRejectedByReason[reason] = numTxns
+	}
+	for reason, numTxns := range mp.counters.numTxnsEvictedByReason {
+		metrics.NumTxnsEvictedByReason[reason] = numTxns
+	}
+	return metrics
+}
+
+// MempoolMetricsExpvarName is the name the mempool's metrics are published under by
+// PublishMempoolMetricsExpvar.
+const MempoolMetricsExpvarName = "deso_mempool"
+
+var (
+	mempoolMetricsExpvarMtx     sync.Mutex
+	mempoolMetricsExpvarMempool *DeSoMempool
+)
+
+// PublishMempoolMetricsExpvar publishes the mempool's metrics through expvar, which serves
+// them as JSON on /debug/vars of any HTTP server using http.DefaultServeMux. expvar names
+// can't be unpublished, so publishing again, e.g. after a node restart, switches the
+// published metrics to the new mempool.
+func PublishMempoolMetricsExpvar(mp *DeSoMempool) {
+	mempoolMetricsExpvarMtx.Lock()
+	defer mempoolMetricsExpvarMtx.Unlock()
+
+	mempoolMetricsExpvarMempool = mp
+	if expvar.Get(MempoolMetricsExpvarName) != nil {
+		return
+	}
+	expvar.Publish(MempoolMetricsExpvarName, expvar.Func(func() interface{} {
+		mempoolMetricsExpvarMtx.Lock()
+		mempool := mempoolMetricsExpvarMempool
+		mempoolMetricsExpvarMtx.Unlock()
+		return mempool.GetMetrics()
+	}))
+}
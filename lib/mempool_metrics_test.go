@@ -0,0 +1,47 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMempoolMetrics(t *testing.T) {
+	require := require.New(t)
+
+	chain, _, _, _ := _setupFiveBlocks(t)
+	mp := NewDeSoMempool(
+		chain, 0, /* rateLimitFeeRateNanosPerKB */
+		0 /* minFeeRateNanosPerKB */, "", true,
+		"" /*dataDir*/, "", true)
+	t.Cleanup(func() {
+		if !mp.stopped {
+			mp.Stop()
+		}
+	})
+
+	txn := _assembleBasicTransferTxnFullySigned(t, chain, 1, 0,
+		senderPkString, recipientPkString, senderPrivString, nil)
+	_, err := mp.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+	require.NoError(err)
+	// Processing the txn again is rejected as a duplicate.
+	_, err = mp.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+	require.Error(err)
+
+	metrics := mp.GetMetrics()
+	require.Equal(uint64(1), metrics.NumTxns)
+	require.Equal(uint64(1), metrics.NumTxnsByType[TxnTypeBasicTransfer.String()])
+	require.Equal(metrics.TotalTxSizeBytes, metrics.TxSizeBytesByType[TxnTypeBasicTransfer.String()])
+	require.Equal(uint64(1), metrics.NumTxnsAccepted)
+	require.Equal(map[string]uint64{string(TxErrorDuplicate): 1}, metrics.NumTxnsRejectedByReason)
+	require.Empty(metrics.NumTxnsEvictedByReason)
+
+	// Removing the txn counts it as evicted.
+	mp.inefficientRemoveTransaction(txn)
+	metrics = mp.GetMetrics()
+	require.Equal(uint64(0), metrics.NumTxns)
+	require.Equal(uint64(0), metrics.TotalTxSizeBytes)
+	require.Equal(map[MempoolEvictionReason]uint64{MempoolEvictionReasonRemoved: 1}, metrics.NumTxnsEvictedByReason)
+}
@@ -0,0 +1,224 @@
+package lib
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// The DeSoMempool rejects a txn that conflicts with a txn already in the pool, i.e. one that
+// spends one of its inputs or, after the balance model fork, has the same transactor and
+// nonce. When a ReplaceByFeePolicy is set, a conflicting txn that pays a higher fee rate than
+// every txn it conflicts with replaces them instead, so that users can bump the fee of a txn
+// that's stuck in the mempool by re-signing it with the same nonce and a higher fee.
+//
+// Replacing txns rebuilds the pool without them, the same way InefficientRemoveTransaction
+// does, so the txns that depended on the replaced txns are evicted along with them. Since
+// rebuilding the pool is expensive, the replacement's fee is checked against the txns it
+// conflicts with before the pool is rebuilt. Once it has been, the replacement's absolute fee
+// also has to cover the fees of every txn it evicts, so that replacing a txn can't lower the
+// fees in the pool. The replacement is only accepted if it can be added to the rebuilt pool,
+// and the pool is only replaced once it has been. The replacement is relayed to peers like any other new txn, but
+// peers that don't allow replacements reject it as a conflict.
+//
+// Atomic txn wrappers can't replace or be replaced by other txns, since their nonces are on
+// their inner txns. The PoS mempool replaces txns with the same nonce on its own.
+
+// ReplaceByFeePolicy controls when a txn can replace the txns it conflicts with in the
+// DeSoMempool.
+type ReplaceByFeePolicy struct {
+	// MinFeeRateIncreaseBasisPoints is how much higher than the fee rate of each txn it
+	// replaces a replacement's fee rate has to be, in basis points. The fee rate always has
+	// to be strictly higher, even if it's zero.
+	MinFeeRateIncreaseBasisPoints uint64
+	// MaxEvictedTxns caps the number of txns a replacement can evict, including the txns that
+	// depended on the txns it replaces. Zero means there's no cap.
+	MaxEvictedTxns uint64
+}
+
+// SetReplaceByFeePolicy allows txns to replace the txns they conflict with under the policy.
+// A nil policy rejects conflicting txns, which is the default.
+func (mp *DeSoMempool) SetReplaceByFeePolicy(policy *ReplaceByFeePolicy) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	mp.replaceByFeePolicy = policy
+}
+
+// GetReplaceByFeePolicy returns the mempool's ReplaceByFeePolicy, or nil if it doesn't
+// allow replacements.
+func (mp *DeSoMempool) GetReplaceByFeePolicy() *ReplaceByFeePolicy {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	return mp.replaceByFeePolicy
+}
+
+// _getConflictingTxns returns the txns in the pool that spend one of the txn's inputs or
+// have the same transactor and nonce as it.
+func (mp *DeSoMempool) _getConflictingTxns(tx *MsgDeSoTxn) []*MempoolTx {
+	conflictingTxns := make(map[BlockHash]*MempoolTx)
+	for _, txIn := range tx.TxInputs {
+		if spendingTxn, exists := mp.outpoints[UtxoKey(*txIn)]; exists {
+			if mempoolTx, exists := mp.poolMap[*spendingTxn.Hash()]; exists {
+				conflictingTxns[*mempoolTx.Hash] = mempoolTx
+			}
+		}
+	}
+	if tx.TxnNonce != nil && tx.TxnMeta != nil && tx.TxnMeta.GetTxnType() != TxnTypeAtomicTxnsWrapper {
+		for _, mempoolTx := range mp.PublicKeyTxnMap(tx.PublicKey) {
+			poolTxn := mempoolTx.Tx
+			if poolTxn.TxnNonce == nil || poolTxn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+				continue
+			}
+			if bytes.Equal(poolTxn.PublicKey, tx.PublicKey) &&
+				poolTxn.TxnNonce.PartialID == tx.TxnNonce.PartialID &&
+				poolTxn.TxnNonce.ExpirationBlockHeight == tx.TxnNonce.ExpirationBlockHeight {
+				conflictingTxns[*mempoolTx.Hash] = mempoolTx
+			}
+		}
+	}
+
+	var ret []*MempoolTx
+	for _, mempoolTx := range conflictingTxns {
+		ret = append(ret, mempoolTx)
+	}
+	return ret
+}
+
+// _replaceTransactions adds the txn to the pool in place of the txns it conflicts with if
+// the policy allows it, and returns the txn.
+func (mp *DeSoMempool) _replaceTransactions(tx *MsgDeSoTxn, conflictingTxns []*MempoolTx,
+	rateLimit bool, verifySignatures bool) ([]*MempoolTx, error) {
+
+	policy := mp.replaceByFeePolicy
+
+	// Check the replacement's fee against the txns it conflicts with before rebuilding the pool.
+	fee, err := mp._getReplacementFee(tx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_replaceTransactions: Problem computing the replacement's fee: ")
+	}
+	txBytes, err := tx.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_replaceTransactions: Problem serializing replacement: ")
+	}
+	if err = _checkReplacementFee(fee, fee*1000/uint64(len(txBytes)), conflictingTxns, policy); err != nil {
+		return nil, errors.Wrapf(err, "_replaceTransactions: ")
+	}
+
+	excludedTxnHashes := make(map[BlockHash]bool, len(conflictingTxns))
+	for _, conflictingTxn := range conflictingTxns {
+		excludedTxnHashes[*conflictingTxn.Hash] = true
+	}
+
+	// Build the pool without the conflicting txns and check how many txns that evicts.
+	newPool := mp._newPoolWithoutTxns(excludedTxnHashes)
+	newPool.minFeeRateNanosPerKB = mp.minFeeRateNanosPerKB
+	newPool.rateLimitFeeRateNanosPerKB = mp.rateLimitFeeRateNanosPerKB
+	numEvictedTxns := uint64(len(mp.poolMap) - len(newPool.poolMap))
+	if policy.MaxEvictedTxns != 0 && numEvictedTxns > policy.MaxEvictedTxns {
+		return nil, errors.Wrapf(TxErrorReplaceByFeeTooManyEvictions, "_replaceTransactions: Replacing "+
+			"%d conflicting txns would evict %d txns, which exceeds the max of %d",
+			len(conflictingTxns), numEvictedTxns, policy.MaxEvictedTxns)
+	}
+
+	// The replacement has to be valid on its own once the conflicting txns are gone.
+	missingParents, mempoolTx, err := newPool.tryAcceptTransaction(tx, rateLimit, true, verifySignatures)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_replaceTransactions: Problem adding replacement: ")
+	}
+	if len(missingParents) > 0 || mempoolTx == nil {
+		return nil, errors.Wrapf(TxErrorUnconnectedTxnNotAllowed,
+			"_replaceTransactions: Replacements can't be unconnected txns")
+	}
+
+	// Now that the replacement has been connected, check its actual fee against every txn it
+	// evicts, including the txns that depended on the txns it replaces.
+	var evictedTxns []*MempoolTx
+	for txHash, poolTxn := range mp.poolMap {
+		if _, exists := newPool.poolMap[txHash]; !exists {
+			evictedTxns = append(evictedTxns, poolTxn)
+		}
+	}
+	if err = _checkReplacementFee(mempoolTx.Fee, mempoolTx.FeePerKB, conflictingTxns, policy); err != nil {
+		return nil, errors.Wrapf(err, "_replaceTransactions: ")
+	}
+	if err = _checkReplacementFee(mempoolTx.Fee, mempoolTx.FeePerKB, evictedTxns, nil); err != nil {
+		return nil, errors.Wrapf(err, "_replaceTransactions: ")
+	}
+
+	glog.V(1).Infof("DeSoMempool._replaceTransactions: Txn %v replaced %d conflicting txns and "+
+		"evicted %d txns in total", mempoolTx.Hash, len(conflictingTxns), numEvictedTxns)
+	mp._recordEvictions(MempoolEvictionReasonReplacedByFee, len(conflictingTxns))
+	mp._recordEvictions(MempoolEvictionReasonDependencyRemoved, int(numEvictedTxns)-len(conflictingTxns))
+	mp.resetPool(newPool)
+	return []*MempoolTx{mempoolTx}, nil
+}
+
+// _getReplacementFee returns the fee a replacement pays without connecting it. Before the
+// balance model fork the fee is whatever the inputs don't send to the outputs, so the inputs
+// are looked up in the pool's view, which keeps the entries of inputs spent by the txns the
+// replacement conflicts with.
+func (mp *DeSoMempool) _getReplacementFee(tx *MsgDeSoTxn) (uint64, error) {
+	blockHeight := uint32(mp.bc.blockTip().Height + 1)
+	if blockHeight >= mp.bc.params.ForkHeights.BalanceModelBlockHeight {
+		return tx.TxnFeeNanos, nil
+	}
+
+	var err error
+	totalInputNanos := uint64(0)
+	for _, txIn := range tx.TxInputs {
+		utxoEntry := mp.universalUtxoView.GetUtxoEntryForUtxoKey((*UtxoKey)(txIn))
+		if utxoEntry == nil {
+			return 0, errors.Wrapf(RuleErrorInputSpendsNonexistentUtxo, "_getReplacementFee: Input %v", txIn)
+		}
+		if totalInputNanos, err = SafeUint64().Add(totalInputNanos, utxoEntry.AmountNanos); err != nil {
+			return 0, errors.Wrapf(err, "_getReplacementFee: Problem adding input %v: ", txIn)
+		}
+	}
+	totalOutputNanos := uint64(0)
+	for _, txOut := range tx.TxOutputs {
+		if totalOutputNanos, err = SafeUint64().Add(totalOutputNanos, txOut.AmountNanos); err != nil {
+			return 0, errors.Wrapf(err, "_getReplacementFee: Problem adding output: ")
+		}
+	}
+	if totalOutputNanos > totalInputNanos {
+		return 0, errors.Wrapf(RuleErrorTxnOutputExceedsInput, "_getReplacementFee: Outputs %d exceed inputs %d",
+			totalOutputNanos, totalInputNanos)
+	}
+	return totalInputNanos - totalOutputNanos, nil
+}
+
+// _checkReplacementFee returns an error unless a replacement paying fee at feePerKB can replace
+// the replacedTxns. Its absolute fee always has to cover the fees of all the replacedTxns. If a
+// policy is given, its fee rate also has to exceed the fee rate of each of the replacedTxns by
+// the policy's MinFeeRateIncreaseBasisPoints.
+func _checkReplacementFee(fee uint64, feePerKB uint64, replacedTxns []*MempoolTx,
+	policy *ReplaceByFeePolicy) error {
+
+	totalReplacedFee := big.NewInt(0)
+	for _, replacedTxn := range replacedTxns {
+		totalReplacedFee.Add(totalReplacedFee, big.NewInt(0).SetUint64(replacedTxn.Fee))
+		if policy == nil {
+			continue
+		}
+		// minFeePerKB = FeePerKB * (MaxBasisPoints + MinFeeRateIncreaseBasisPoints) / MaxBasisPoints.
+		// This is computed with big.Ints since it can overflow a uint64 for large fee rates.
+		minFeePerKB := big.NewInt(0).Add(
+			big.NewInt(0).SetUint64(MaxBasisPoints), big.NewInt(0).SetUint64(policy.MinFeeRateIncreaseBasisPoints))
+		minFeePerKB.Mul(minFeePerKB, big.NewInt(0).SetUint64(replacedTxn.FeePerKB))
+		minFeePerKB.Quo(minFeePerKB, big.NewInt(0).SetUint64(MaxBasisPoints))
+		if feePerKB <= replacedTxn.FeePerKB || big.NewInt(0).SetUint64(feePerKB).Cmp(minFeePerKB) < 0 {
+			return errors.Wrapf(MempoolFailedReplaceByHigherFee, "_checkReplacementFee: Fee rate %d "+
+				"doesn't exceed fee rate %d of txn %v by %d basis points",
+				feePerKB, replacedTxn.FeePerKB, replacedTxn.Hash, policy.MinFeeRateIncreaseBasisPoints)
+		}
+	}
+	if big.NewInt(0).SetUint64(fee).Cmp(totalReplacedFee) < 0 {
+		return errors.Wrapf(TxErrorReplaceByFeeInsufficientAbsoluteFee, "_checkReplacementFee: Fee %d "+
+			"doesn't cover the total fee %v of the %d txns it replaces", fee, totalReplacedFee, len(replacedTxns))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReplacementFee(t *testing.T) {
+	require := require.New(t)
+
+	policy := &ReplaceByFeePolicy{MinFeeRateIncreaseBasisPoints: 1000}
+	replacedTxns := []*MempoolTx{{Fee: 100, FeePerKB: 1000}, {Fee: 50, FeePerKB: 500}}
+
+	// The fee rate has to be 10% higher than each replaced txn's and the fee has to cover theirs.
+	require.NoError(_checkReplacementFee(150, 1100, replacedTxns, policy))
+	err := _checkReplacementFee(150, 1099, replacedTxns, policy)
+	require.Error(err)
+	require.Contains(err.Error(), MempoolFailedReplaceByHigherFee)
+	err = _checkReplacementFee(149, 1100, replacedTxns, policy)
+	require.Error(err)
+	require.Contains(err.Error(), TxErrorReplaceByFeeInsufficientAbsoluteFee)
+
+	// Without a policy only the absolute fee is checked.
+	require.NoError(_checkReplacementFee(150, 0, replacedTxns, nil))
+
+	// The fee rate always has to be strictly higher, even with no minimum increase.
+	err = _checkReplacementFee(150, 1000, replacedTxns, &ReplaceByFeePolicy{})
+	require.Error(err)
+	require.Contains(err.Error(), MempoolFailedReplaceByHigherFee)
+
+	// A fee rate close to the max doesn't overflow into a minimum that's easy to beat.
+	err = _checkReplacementFee(100, math.MaxUint64, []*MempoolTx{{Fee: 100, FeePerKB: math.MaxUint64 - 1}}, policy)
+	require.Error(err)
+	require.Contains(err.Error(), MempoolFailedReplaceByHigherFee)
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	require := require.New(t)
+
+	chain, _, senderPkBytes, _ := _setupFiveBlocks(t)
+	mp := NewDeSoMempool(
+		chain, 0, /* rateLimitFeeRateNanosPerKB */
+		0 /* minFeeRateNanosPerKB */, "", true,
+		"" /*dataDir*/, "", true)
+	t.Cleanup(func() {
+		if !mp.stopped {
+			mp.Stop()
+		}
+	})
+	mp.SetReplaceByFeePolicy(&ReplaceByFeePolicy{MinFeeRateIncreaseBasisPoints: 1000, MaxEvictedTxns: 1})
+	processTxn := func(txn *MsgDeSoTxn) error {
+		_, err := mp.processTransaction(txn, false /*allowUnconnectedTxn*/, false, /*rateLimit*/
+			0 /*peerID*/, false /*verifySignatures*/)
+		return err
+	}
+	requirePoolTxns := func(txns ...*MsgDeSoTxn) {
+		require.Len(mp.poolMap, len(txns))
+		for _, txn := range txns {
+			require.True(mp.isTransactionInPool(txn.Hash()))
+		}
+	}
+
+	// txn1 sends 1 nano to the recipient and its change back to the sender, and a child txn
+	// spends the change with a much higher fee.
+	txn1 := _assembleBasicTransferTxnFullySigned(t, chain, 1, 100,
+		senderPkString, recipientPkString, senderPrivString, nil)
+	require.NoError(processTxn(txn1))
+	require.Len(txn1.TxOutputs, 2)
+	childTxn := &MsgDeSoTxn{
+		TxInputs: []*DeSoInput{{TxID: *txn1.Hash(), Index: 1}},
+		TxOutputs: []*DeSoOutput{{
+			PublicKey:   senderPkBytes,
+			AmountNanos: txn1.TxOutputs[1].AmountNanos - 10000,
+		}},
+		TxnMeta:   &BasicTransferMetadata{},
+		PublicKey: senderPkBytes,
+		Signature: txn1.Signature, // Dummy signature.
+	}
+	require.NoError(processTxn(childTxn))
+	requirePoolTxns(txn1, childTxn)
+
+	// The sender's block rewards are all the same size, so which one gets spent isn't fixed.
+	// Replacements spend txn1's input instead, which leaves their change and fee unchanged.
+	assembleReplacementTxn := func(feeRateNanosPerKB uint64) *MsgDeSoTxn {
+		txn := _assembleBasicTransferTxnFullySigned(t, chain, 2, feeRateNanosPerKB,
+			senderPkString, recipientPkString, senderPrivString, nil)
+		require.Len(txn.TxInputs, len(txn1.TxInputs))
+		txn.TxInputs = txn1.TxInputs
+		return txn
+	}
+
+	// A replacement that spends the same inputs at the same fee rate is rejected before the
+	// pool is rebuilt.
+	replacementTxn := assembleReplacementTxn(100)
+	require.NotEmpty(mp._getConflictingTxns(replacementTxn))
+	err := processTxn(replacementTxn)
+	require.Error(err)
+	require.Contains(err.Error(), MempoolFailedReplaceByHigherFee)
+	requirePoolTxns(txn1, childTxn)
+
+	// A higher fee rate replaces txn1, but evicting its child exceeds the max evictions.
+	replacementTxn = assembleReplacementTxn(1000)
+	err = processTxn(replacementTxn)
+	require.Error(err)
+	require.Contains(err.Error(), TxErrorReplaceByFeeTooManyEvictions)
+	requirePoolTxns(txn1, childTxn)
+
+	// With a higher cap, the replacement's fee still has to cover the child's fee.
+	mp.SetReplaceByFeePolicy(&ReplaceByFeePolicy{MinFeeRateIncreaseBasisPoints: 1000, MaxEvictedTxns: 2})
+	err = processTxn(replacementTxn)
+	require.Error(err)
+	require.Contains(err.Error(), TxErrorReplaceByFeeInsufficientAbsoluteFee)
+	requirePoolTxns(txn1, childTxn)
+
+	// A replacement that pays more than both evicts them.
+	replacementTxn = assembleReplacementTxn(100000)
+	require.NoError(processTxn(replacementTxn))
+	requirePoolTxns(replacementTxn)
+}
@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ==================================================================
+// MEMPOOL_SYNC Message
+// ==================================================================
+
+// A node that was just restarted has an empty or stale mempool, and the MEMPOOL message
+// only tells a peer to start relaying it new txns. A node that opts into mempool sync
+// instead sends its peers a MEMPOOL_SYNC message listing the txns it already has, and each
+// peer replies right away with invs for the txns in its mempool that aren't on the list.
+// The node then fetches them with the usual GET_TRANSACTIONS flow, so its mempool is
+// repopulated within a round trip rather than as new txns trickle in.
+//
+// The txns are listed by short ids, which are the first eight bytes of their hashes. Since
+// txn hashes are uniformly distributed, two txns in the two mempools sharing a short id is
+// vanishingly unlikely, and if they do the peer just doesn't inv the txn. The ids are sent
+// sorted and delta-encoded, so a list of N ids takes a few bytes per id.
+
+// MaxMempoolSyncShortTxnIDs is the most short txn ids a MEMPOOL_SYNC message can list. A
+// node with more txns than this lists the first ones, and the peer invs it the rest.
+const MaxMempoolSyncShortTxnIDs = 1 << 20
+
+// GetMempoolSyncShortTxnID returns the short id of a txn in a MEMPOOL_SYNC message.
+func GetMempoolSyncShortTxnID(txnHash *BlockHash) uint64 {
+	return binary.BigEndian.Uint64(txnHash[:8])
+}
+
+type MsgDeSoMempoolSync struct {
+	// ShortTxnIDs are the short ids of the txns in the sender's mempool, sorted in
+	// ascending order with no duplicates.
+	ShortTxnIDs []uint64
+}
+
+// NewMsgDeSoMempoolSync returns a MEMPOOL_SYNC message listing the given txns.
+func NewMsgDeSoMempoolSync(txnHashes []*BlockHash) *MsgDeSoMempoolSync {
+	shortTxnIDs := make([]uint64, 0, len(txnHashes))
+	for _, txnHash := range txnHashes {
+		shortTxnIDs = append(shortTxnIDs, GetMempoolSyncShortTxnID(txnHash))
+	}
+	sort.Slice(shortTxnIDs, func(ii, jj int) bool {
+		return shortTxnIDs[ii] < shortTxnIDs[jj]
+	})
+
+	msg := &MsgDeSoMempoolSync{}
+	for _, shortTxnID := range shortTxnIDs {
+		if len(msg.ShortTxnIDs) == MaxMempoolSyncShortTxnIDs {
+			break
+		}
+		if len(msg.ShortTxnIDs) > 0 && msg.ShortTxnIDs[len(msg.ShortTxnIDs)-1] == shortTxnID {
+			continue
+		}
+		msg.ShortTxnIDs = append(msg.ShortTxnIDs, shortTxnID)
+	}
+	return msg
+}
+
+// HasTxn returns true if the txn is on the message's list.
+func (msg *MsgDeSoMempoolSync) HasTxn(txnHash *BlockHash) bool {
+	shortTxnID := GetMempoolSyncShortTxnID(txnHash)
+	index := sort.Search(len(msg.ShortTxnIDs), func(ii int) bool {
+		return msg.ShortTxnIDs[ii] >= shortTxnID
+	})
+	return index < len(msg.ShortTxnIDs) && msg.ShortTxnIDs[index] == shortTxnID
+}
+
+func (msg *MsgDeSoMempoolSync) GetMsgType() MsgType {
+	return MsgTypeMempoolSync
+}
+
+func (msg *MsgDeSoMempoolSync) ToBytes(preSignature bool) ([]byte, error) {
+	if len(msg.ShortTxnIDs) > MaxMempoolSyncShortTxnIDs {
+		return nil, fmt.Errorf("MsgDeSoMempoolSync.ToBytes: Number of short txn ids %d exceeds max allowed %d",
+			len(msg.ShortTxnIDs), MaxMempoolSyncShortTxnIDs)
+	}
+	retBytes := UintToBuf(uint64(len(msg.ShortTxnIDs)))
+	prevShortTxnID := uint64(0)
+	for ii, shortTxnID := range msg.ShortTxnIDs {
+		if ii > 0 && shortTxnID <= prevShortTxnID {
+			return nil, fmt.Errorf("MsgDeSoMempoolSync.ToBytes: Short txn ids must be sorted "+
+				"with no duplicates but %d follows %d", shortTxnID, prevShortTxnID)
+		}
+		retBytes = append(retBytes, UintToBuf(shortTxnID-prevShortTxnID)...)
+		prevShortTxnID = shortTxnID
+	}
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoMempoolSync) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoMempoolSync{}
+
+	numShortTxnIDs, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoMempoolSync.FromBytes: Problem reading number of short txn ids: ")
+	}
+	if numShortTxnIDs > MaxMempoolSyncShortTxnIDs {
+		return fmt.Errorf("MsgDeSoMempoolSync.FromBytes: Number of short txn ids %d exceeds max allowed %d",
+			numShortTxnIDs, MaxMempoolSyncShortTxnIDs)
+	}
+	prevShortTxnID := uint64(0)
+	for ii := uint64(0); ii < numShortTxnIDs; ii++ {
+		delta, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoMempoolSync.FromBytes: Problem reading short txn id: ")
+		}
+		// Every id after the first has to be larger than the one before it.
+		if (ii > 0 && delta == 0) || prevShortTxnID+delta < prevShortTxnID {
+			return fmt.Errorf("MsgDeSoMempoolSync.FromBytes: Short txn id %d isn't sorted", ii)
+		}
+		prevShortTxnID += delta
+		retMsg.ShortTxnIDs = append(retMsg.ShortTxnIDs, prevShortTxnID)
+	}
+
+	*msg = retMsg
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"github.com/golang/glog"
+)
+
+// _newMempoolSyncMessage returns a MEMPOOL_SYNC message listing the txns in our mempool.
+func (srv *Server) _newMempoolSyncMessage() *MsgDeSoMempoolSync {
+	var txnHashes []*BlockHash
+	for _, mempoolTx := range srv.GetMempool().GetTransactions() {
+		txnHashes = append(txnHashes, mempoolTx.Hash)
+	}
+	return NewMsgDeSoMempoolSync(txnHashes)
+}
+
+// _handleMempoolSync replies to a MEMPOOL_SYNC message with invs for the validated txns in
+// our mempool that the peer doesn't have. Like a MEMPOOL message, it also lets the peer
+// receive invs for new txns from now on.
+func (srv *Server) _handleMempoolSync(pp *Peer, msg *MsgDeSoMempoolSync) {
+	glog.V(1).Infof("Server._handleMempoolSync: Received MempoolSync message with %d short txn ids "+
+		"from Peer %v", len(msg.ShortTxnIDs), pp)
+
+	// Peers should only send MEMPOOL_SYNC to nodes that advertise SFMempoolSync, and only once.
+	if !srv.MempoolSyncOnConnect {
+		glog.Errorf("Server._handleMempoolSync: Disconnecting Peer %v because mempool sync is "+
+			"turned off", pp)
+		pp.Disconnect("handleMempoolSync - mempool sync is turned off")
+		return
+	}
+	if pp.hasSentMempoolSyncMessage {
+		glog.Errorf("Server._handleMempoolSync: Disconnecting Peer %v because it already sent "+
+			"a MempoolSync message", pp)
+		pp.Disconnect("handleMempoolSync - peer already sent a mempool sync message")
+		return
+	}
+	pp.hasSentMempoolSyncMessage = true
+
+	invMsg := &MsgDeSoInv{}
+	// A light peer that loaded a filter only gets the txns that match it.
+	txnFilter := pp.TxnFilter()
+	txnMatcher := newLightPeerTxnMatcher()
+	for _, mempoolTx := range srv.GetMempool().GetTransactions() {
+		if !mempoolTx.IsValidated() {
+			continue
+		}
+		invVect := &InvVect{
+			Type: InvTypeTx,
+			Hash: *mempoolTx.Hash,
+		}
+		// Either way the peer knows about the txn now, so _relayTransactions won't inv it.
+		pp.knownInventory.Add(*invVect)
+		if msg.HasTxn(mempoolTx.Hash) || !txnMatcher.matches(txnFilter, mempoolTx) {
+			continue
+		}
+		invMsg.InvList = append(invMsg.InvList, invVect)
+	}
+	glog.V(1).Infof("Server._handleMempoolSync: Sending %d invs to Peer %v", len(invMsg.InvList), pp)
+	if len(invMsg.InvList) > 0 {
+		pp.AddDeSoMessage(invMsg, false)
+	}
+
+	pp.canReceiveInvMessages = true
+}
@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func _mempoolSyncTestTxnHash(firstBytes ...byte) *BlockHash {
+	txnHash := &BlockHash{}
+	copy(txnHash[:], firstBytes)
+	// The rest of the hash isn't part of the short id.
+	txnHash[31] = byte(len(firstBytes))
+	return txnHash
+}
+
+func TestMempoolSyncEncodeDecode(t *testing.T) {
+	require := require.New(t)
+
+	// The short ids are sorted and deduplicated.
+	txnHash1 := _mempoolSyncTestTxnHash(0, 0, 0, 0, 0, 0, 0, 1)
+	txnHash2 := _mempoolSyncTestTxnHash(0, 0, 0, 0, 0, 0, 1, 0)
+	txnHash3 := _mempoolSyncTestTxnHash(0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	msg := NewMsgDeSoMempoolSync([]*BlockHash{txnHash3, txnHash1, txnHash2, txnHash1})
+	require.Equal([]uint64{1, 256, 1<<64 - 1}, msg.ShortTxnIDs)
+
+	// The message round-trips through the wire format.
+	var buf bytes.Buffer
+	_, err := WriteMessage(&buf, msg, NetworkType_MAINNET)
+	require.NoError(err)
+	testMsg, _, err := ReadMessage(bytes.NewReader(buf.Bytes()), NetworkType_MAINNET)
+	require.NoError(err)
+	require.Equal(msg, testMsg)
+
+	// The ids are delta-encoded.
+	msgBytes, err := msg.ToBytes(false)
+	require.NoError(err)
+	expectedBytes := UintToBuf(3)
+	expectedBytes = append(expectedBytes, UintToBuf(1)...)
+	expectedBytes = append(expectedBytes, UintToBuf(255)...)
+	expectedBytes = append(expectedBytes, UintToBuf(1<<64-1-256)...)
+	require.Equal(expectedBytes, msgBytes)
+
+	// An empty message round-trips too.
+	emptyMsgBytes, err := NewMsgDeSoMempoolSync(nil).ToBytes(false)
+	require.NoError(err)
+	emptyMsg := &MsgDeSoMempoolSync{}
+	require.NoError(emptyMsg.FromBytes(emptyMsgBytes))
+	require.Empty(emptyMsg.ShortTxnIDs)
+
+	// Unsorted and duplicate ids can't be encoded.
+	_, err = (&MsgDeSoMempoolSync{ShortTxnIDs: []uint64{2, 1}}).ToBytes(false)
+	require.Error(err)
+	_, err = (&MsgDeSoMempoolSync{ShortTxnIDs: []uint64{1, 1}}).ToBytes(false)
+	require.Error(err)
+
+	// Nor decoded: a zero delta after the first id is a duplicate, and a delta that
+	// overflows would wrap around to a smaller id.
+	duplicateBytes := append(UintToBuf(2), append(UintToBuf(1), UintToBuf(0)...)...)
+	require.Error((&MsgDeSoMempoolSync{}).FromBytes(duplicateBytes))
+	overflowBytes := append(UintToBuf(2), append(UintToBuf(2), UintToBuf(1<<64-1)...)...)
+	require.Error((&MsgDeSoMempoolSync{}).FromBytes(overflowBytes))
+
+	// A message can't list more than MaxMempoolSyncShortTxnIDs ids, and a truncated one fails.
+	require.Error((&MsgDeSoMempoolSync{}).FromBytes(UintToBuf(MaxMempoolSyncShortTxnIDs + 1)))
+	require.Error((&MsgDeSoMempoolSync{}).FromBytes(msgBytes[:len(msgBytes)-1]))
+}
+
+func TestMempoolSyncHasTxn(t *testing.T) {
+	require := require.New(t)
+
+	txnHash1 := _mempoolSyncTestTxnHash(1)
+	txnHash2 := _mempoolSyncTestTxnHash(2)
+	txnHash3 := _mempoolSyncTestTxnHash(3)
+	msg := NewMsgDeSoMempoolSync([]*BlockHash{txnHash3, txnHash1})
+
+	require.True(msg.HasTxn(txnHash1))
+	require.False(msg.HasTxn(txnHash2))
+	require.True(msg.HasTxn(txnHash3))
+	require.False(msg.HasTxn(_mempoolSyncTestTxnHash(4)))
+	require.False(msg.HasTxn(&BlockHash{}))
+
+	// Only the short id is compared, so a txn whose hash shares the first eight bytes
+	// counts as listed.
+	sameShortIDHash := *txnHash1
+	sameShortIDHash[31]++
+	require.True(msg.HasTxn(&sameShortIDHash))
+
+	// Nothing is on an empty list.
+	require.False(NewMsgDeSoMempoolSync(nil).HasTxn(txnHash1))
+}
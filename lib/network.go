@@ -107,7 +107,31 @@ const (
 	MsgTypeValidatorVote    MsgType = 20
 	MsgTypeValidatorTimeout MsgType = 21
 
-	// NEXT_TAG = 23
+	// MsgTypeNodeAdvisory is a param updater-signed advisory that is relayed to all
+	// nodes that support it.
+	MsgTypeNodeAdvisory MsgType = 23
+
+	// MsgTypeGetProfilePicBlobs and MsgTypeProfilePicBlobs are used to lazily fetch
+	// offloaded profile pics from peers.
+	MsgTypeGetProfilePicBlobs MsgType = 24
+	MsgTypeProfilePicBlobs    MsgType = 25
+
+	// MsgTypeMempoolSync lists the txns in the sender's mempool so the receiver can inv
+	// it the ones it's missing.
+	MsgTypeMempoolSync MsgType = 26
+
+	// MsgTypeFilterLoad and MsgTypeFilterClear let a light client limit the txns we inv
+	// it to the ones that touch its accounts.
+	MsgTypeFilterLoad  MsgType = 27
+	MsgTypeFilterClear MsgType = 28
+
+	// MsgTypeCompactBlock relays a new block as short txn ids the receiver fills in from
+	// its mempool, and the receiver fetches the txns it's missing with MsgTypeGetBlockTxns.
+	MsgTypeCompactBlock MsgType = 29
+	MsgTypeGetBlockTxns MsgType = 30
+	MsgTypeBlockTxns    MsgType = 31
+
+	// NEXT_TAG = 32
 
 	// Below are control messages used to signal to the Server from other parts of
 	// the code but not actually sent among peers.
@@ -194,6 +218,24 @@ func (msgType MsgType) String() string {
 		return "GET_SNAPSHOT"
 	case MsgTypeSnapshotData:
 		return "SNAPSHOT_DATA"
+	case MsgTypeNodeAdvisory:
+		return "NODE_ADVISORY"
+	case MsgTypeGetProfilePicBlobs:
+		return "GET_PROFILE_PIC_BLOBS"
+	case MsgTypeProfilePicBlobs:
+		return "PROFILE_PIC_BLOBS"
+	case MsgTypeMempoolSync:
+		return "MEMPOOL_SYNC"
+	case MsgTypeFilterLoad:
+		return "FILTER_LOAD"
+	case MsgTypeFilterClear:
+		return "FILTER_CLEAR"
+	case MsgTypeCompactBlock:
+		return "COMPACT_BLOCK"
+	case MsgTypeGetBlockTxns:
+		return "GET_BLOCK_TXNS"
+	case MsgTypeBlockTxns:
+		return "BLOCK_TXNS"
 	default:
 		return fmt.Sprintf("UNRECOGNIZED(%d) - make sure String() is up to date", msgType)
 	}
@@ -274,8 +316,21 @@ const (
 	TxnTypeCoinLockupTransfer           TxnType = 42
 	TxnTypeCoinUnlock                   TxnType = 43
 	TxnTypeAtomicTxnsWrapper            TxnType = 44
-
-	// NEXT_ID = 44
+	TxnTypeAnchorExternalHeaders        TxnType = 45
+	TxnTypeDAOCoinLimitOrderBatch       TxnType = 46
+	TxnTypeRegisterMultisig             TxnType = 47
+	TxnTypeDAOCoinStream                TxnType = 48
+	TxnTypeCreateProposal               TxnType = 49
+	TxnTypeCastVote                     TxnType = 50
+	TxnTypeDAOCoinMultiTransfer         TxnType = 51
+	TxnTypeRoyaltySplit                 TxnType = 52
+	TxnTypeLeaseNFT                     TxnType = 53
+	TxnTypeEndNFTLease                  TxnType = 54
+	TxnTypeNFTBundle                    TxnType = 55
+	TxnTypeNFTSwap                      TxnType = 56
+	TxnTypeSlashValidator               TxnType = 57
+
+	// NEXT_ID = 58
 )
 
 type TxnString string
@@ -326,6 +381,19 @@ const (
 	TxnStringCoinLockupTransfer           TxnString = "COIN_LOCKUP_TRANSFER"
 	TxnStringCoinUnlock                   TxnString = "COIN_UNLOCK"
 	TxnStringAtomicTxnsWrapper            TxnString = "ATOMIC_TXNS_WRAPPER"
+	TxnStringAnchorExternalHeaders        TxnString = "ANCHOR_EXTERNAL_HEADERS"
+	TxnStringDAOCoinLimitOrderBatch       TxnString = "DAO_COIN_LIMIT_ORDER_BATCH"
+	TxnStringRegisterMultisig             TxnString = "REGISTER_MULTISIG"
+	TxnStringDAOCoinStream                TxnString = "DAO_COIN_STREAM"
+	TxnStringCreateProposal               TxnString = "CREATE_PROPOSAL"
+	TxnStringCastVote                     TxnString = "CAST_VOTE"
+	TxnStringDAOCoinMultiTransfer         TxnString = "DAO_COIN_MULTI_TRANSFER"
+	TxnStringRoyaltySplit                 TxnString = "ROYALTY_SPLIT"
+	TxnStringLeaseNFT                     TxnString = "LEASE_NFT"
+	TxnStringEndNFTLease                  TxnString = "END_NFT_LEASE"
+	TxnStringNFTBundle                    TxnString = "NFT_BUNDLE"
+	TxnStringNFTSwap                      TxnString = "NFT_SWAP"
+	TxnStringSlashValidator               TxnString = "SLASH_VALIDATOR"
 )
 
 var (
@@ -340,7 +408,10 @@ var (
 		TxnTypeAccessGroup, TxnTypeAccessGroupMembers, TxnTypeNewMessage, TxnTypeRegisterAsValidator,
 		TxnTypeUnregisterAsValidator, TxnTypeStake, TxnTypeUnstake, TxnTypeUnlockStake, TxnTypeUnjailValidator,
 		TxnTypeCoinLockup, TxnTypeUpdateCoinLockupParams, TxnTypeCoinLockupTransfer, TxnTypeCoinUnlock,
-		TxnTypeAtomicTxnsWrapper,
+		TxnTypeAtomicTxnsWrapper, TxnTypeAnchorExternalHeaders, TxnTypeDAOCoinLimitOrderBatch,
+		TxnTypeRegisterMultisig, TxnTypeDAOCoinStream, TxnTypeCreateProposal, TxnTypeCastVote,
+		TxnTypeDAOCoinMultiTransfer, TxnTypeRoyaltySplit, TxnTypeLeaseNFT, TxnTypeEndNFTLease,
+		TxnTypeNFTBundle, TxnTypeNFTSwap, TxnTypeSlashValidator,
 	}
 	AllTxnString = []TxnString{
 		TxnStringUnset, TxnStringBlockReward, TxnStringBasicTransfer, TxnStringBitcoinExchange, TxnStringPrivateMessage,
@@ -353,7 +424,10 @@ var (
 		TxnStringAccessGroup, TxnStringAccessGroupMembers, TxnStringNewMessage, TxnStringRegisterAsValidator,
 		TxnStringUnregisterAsValidator, TxnStringStake, TxnStringUnstake, TxnStringUnlockStake, TxnStringUnjailValidator,
 		TxnStringCoinLockup, TxnStringUpdateCoinLockupParams, TxnStringCoinLockupTransfer, TxnStringCoinUnlock,
-		TxnStringAtomicTxnsWrapper,
+		TxnStringAtomicTxnsWrapper, TxnStringAnchorExternalHeaders, TxnStringDAOCoinLimitOrderBatch,
+		TxnStringRegisterMultisig, TxnStringDAOCoinStream, TxnStringCreateProposal, TxnStringCastVote,
+		TxnStringDAOCoinMultiTransfer, TxnStringRoyaltySplit, TxnStringLeaseNFT, TxnStringEndNFTLease,
+		TxnStringNFTBundle, TxnStringNFTSwap, TxnStringSlashValidator,
 	}
 )
 
@@ -455,6 +529,32 @@ func (txnType TxnType) GetTxnString() TxnString {
 		return TxnStringCoinUnlock
 	case TxnTypeAtomicTxnsWrapper:
 		return TxnStringAtomicTxnsWrapper
+	case TxnTypeAnchorExternalHeaders:
+		return TxnStringAnchorExternalHeaders
+	case TxnTypeDAOCoinLimitOrderBatch:
+		return TxnStringDAOCoinLimitOrderBatch
+	case TxnTypeRegisterMultisig:
+		return TxnStringRegisterMultisig
+	case TxnTypeDAOCoinStream:
+		return TxnStringDAOCoinStream
+	case TxnTypeCreateProposal:
+		return TxnStringCreateProposal
+	case TxnTypeCastVote:
+		return TxnStringCastVote
+	case TxnTypeDAOCoinMultiTransfer:
+		return TxnStringDAOCoinMultiTransfer
+	case TxnTypeRoyaltySplit:
+		return TxnStringRoyaltySplit
+	case TxnTypeLeaseNFT:
+		return TxnStringLeaseNFT
+	case TxnTypeEndNFTLease:
+		return TxnStringEndNFTLease
+	case TxnTypeNFTBundle:
+		return TxnStringNFTBundle
+	case TxnTypeNFTSwap:
+		return TxnStringNFTSwap
+	case TxnTypeSlashValidator:
+		return TxnStringSlashValidator
 	default:
 		return TxnStringUndefined
 	}
@@ -550,6 +650,32 @@ func GetTxnTypeFromString(txnString TxnString) TxnType {
 		return TxnTypeCoinUnlock
 	case TxnStringAtomicTxnsWrapper:
 		return TxnTypeAtomicTxnsWrapper
+	case TxnStringAnchorExternalHeaders:
+		return TxnTypeAnchorExternalHeaders
+	case TxnStringDAOCoinLimitOrderBatch:
+		return TxnTypeDAOCoinLimitOrderBatch
+	case TxnStringRegisterMultisig:
+		return TxnTypeRegisterMultisig
+	case TxnStringDAOCoinStream:
+		return TxnTypeDAOCoinStream
+	case TxnStringCreateProposal:
+		return TxnTypeCreateProposal
+	case TxnStringCastVote:
+		return TxnTypeCastVote
+	case TxnStringDAOCoinMultiTransfer:
+		return TxnTypeDAOCoinMultiTransfer
+	case TxnStringRoyaltySplit:
+		return TxnTypeRoyaltySplit
+	case TxnStringLeaseNFT:
+		return TxnTypeLeaseNFT
+	case TxnStringEndNFTLease:
+		return TxnTypeEndNFTLease
+	case TxnStringNFTBundle:
+		return TxnTypeNFTBundle
+	case TxnStringNFTSwap:
+		return TxnTypeNFTSwap
+	case TxnStringSlashValidator:
+		return TxnTypeSlashValidator
 	default:
 		// TxnTypeUnset means we couldn't find a matching txn type
 		return TxnTypeUnset
@@ -653,6 +779,32 @@ func NewTxnMetadata(txType TxnType) (DeSoTxnMetadata, error) {
 		return (&CoinUnlockMetadata{}).New(), nil
 	case TxnTypeAtomicTxnsWrapper:
 		return (&AtomicTxnsWrapperMetadata{}).New(), nil
+	case TxnTypeAnchorExternalHeaders:
+		return (&AnchorExternalHeadersMetadata{}).New(), nil
+	case TxnTypeDAOCoinLimitOrderBatch:
+		return (&DAOCoinLimitOrderBatchMetadata{}).New(), nil
+	case TxnTypeRegisterMultisig:
+		return (&RegisterMultisigMetadata{}).New(), nil
+	case TxnTypeDAOCoinStream:
+		return (&DAOCoinStreamMetadata{}).New(), nil
+	case TxnTypeCreateProposal:
+		return (&CreateProposalMetadata{}).New(), nil
+	case TxnTypeCastVote:
+		return (&CastVoteMetadata{}).New(), nil
+	case TxnTypeDAOCoinMultiTransfer:
+		return (&DAOCoinMultiTransferMetadata{}).New(), nil
+	case TxnTypeRoyaltySplit:
+		return (&RoyaltySplitMetadata{}).New(), nil
+	case TxnTypeLeaseNFT:
+		return (&LeaseNFTMetadata{}).New(), nil
+	case TxnTypeEndNFTLease:
+		return (&EndNFTLeaseMetadata{}).New(), nil
+	case TxnTypeNFTBundle:
+		return (&NFTBundleMetadata{}).New(), nil
+	case TxnTypeNFTSwap:
+		return (&NFTSwapMetadata{}).New(), nil
+	case TxnTypeSlashValidator:
+		return (&SlashValidatorMetadata{}).New(), nil
 	default:
 		return nil, fmt.Errorf("NewTxnMetadata: Unrecognized TxnType: %v; make sure you add the new type of transaction to NewTxnMetadata", txType)
 	}
@@ -832,6 +984,24 @@ func NewMessage(msgType MsgType) DeSoMessage {
 		return &MsgDeSoGetSnapshot{}
 	case MsgTypeSnapshotData:
 		return &MsgDeSoSnapshotData{}
+	case MsgTypeNodeAdvisory:
+		return &MsgDeSoNodeAdvisory{}
+	case MsgTypeGetProfilePicBlobs:
+		return &MsgDeSoGetProfilePicBlobs{}
+	case MsgTypeProfilePicBlobs:
+		return &MsgDeSoProfilePicBlobs{}
+	case MsgTypeMempoolSync:
+		return &MsgDeSoMempoolSync{}
+	case MsgTypeFilterLoad:
+		return &MsgDeSoFilterLoad{}
+	case MsgTypeFilterClear:
+		return &MsgDeSoFilterClear{}
+	case MsgTypeCompactBlock:
+		return &MsgDeSoCompactBlock{}
+	case MsgTypeGetBlockTxns:
+		return &MsgDeSoGetBlockTxns{}
+	case MsgTypeBlockTxns:
+		return &MsgDeSoBlockTxns{}
 	default:
 		{
 			return nil
@@ -1666,6 +1836,16 @@ const (
 	SFArchivalNode ServiceFlag = 1 << 2
 	// SFPosValidator is a flag used to indicate that the peer is running a PoS validator.
 	SFPosValidator ServiceFlag = 1 << 3
+	// SFNodeAdvisories is a flag used to indicate that the peer understands node advisory messages.
+	SFNodeAdvisories ServiceFlag = 1 << 4
+	// SFProfilePicBlobs is a flag used to indicate that the peer serves offloaded profile pic blobs.
+	SFProfilePicBlobs ServiceFlag = 1 << 5
+	// SFMempoolSync is a flag used to indicate that the peer answers mempool sync messages.
+	SFMempoolSync ServiceFlag = 1 << 6
+	// SFTxnFilter is a flag used to indicate that the peer accepts txn filters from light clients.
+	SFTxnFilter ServiceFlag = 1 << 7
+	// SFCompactBlocks is a flag used to indicate that the peer understands compact block messages.
+	SFCompactBlocks ServiceFlag = 1 << 8
 )
 
 func (sf ServiceFlag) HasService(serviceFlag ServiceFlag) bool {
@@ -3110,6 +3290,11 @@ type MsgDeSoSnapshotData struct {
 
 	// Prefix indicates the db prefix of the current snapshot chunk.
 	Prefix []byte
+
+	// ChunkProofs prove the buckets that end in the chunk against SnapshotMetadata.ChunkCommitment.
+	// The commitment and the proofs are encoded after the prefix, and only if there is a
+	// commitment, so that nodes that don't know about them can still decode the message.
+	ChunkProofs []*SnapshotChunkProof
 }
 
 func (msg *MsgDeSoSnapshotData) ToBytes(preSignature bool) ([]byte, error) {
@@ -3130,6 +3315,19 @@ func (msg *MsgDeSoSnapshotData) ToBytes(preSignature bool) ([]byte, error) {
 	data = append(data, UintToBuf(uint64(len(msg.Prefix)))...)
 	data = append(data, msg.Prefix...)
 
+	// Encode the chunk commitment and proofs.
+	if msg.SnapshotMetadata.ChunkCommitment != nil {
+		data = append(data, msg.SnapshotMetadata.ChunkCommitment.ToBytes()...)
+		data = append(data, UintToBuf(uint64(len(msg.ChunkProofs)))...)
+		for _, proof := range msg.ChunkProofs {
+			proofBytes, err := proof.ToBytes()
+			if err != nil {
+				return nil, errors.Wrapf(err, "MsgDeSoSnapshotData.ToBytes: Problem encoding ChunkProofs")
+			}
+			data = append(data, proofBytes...)
+		}
+	}
+
 	return data, nil
 }
 
@@ -3173,6 +3371,30 @@ func (msg *MsgDeSoSnapshotData) FromBytes(data []byte) error {
 		return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding prefix")
 	}
 
+	// Decode the chunk commitment and proofs, which older nodes don't send.
+	if rr.Len() > 0 {
+		msg.SnapshotMetadata.ChunkCommitment = &SnapshotChunkCommitment{}
+		if err = msg.SnapshotMetadata.ChunkCommitment.FromBytes(rr); err != nil {
+			return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding ChunkCommitment")
+		}
+		numProofs, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding length of ChunkProofs")
+		}
+		// Each entry ends at most one bucket, and the leaves around a prefix are proven as well.
+		if numProofs > uint64(len(msg.SnapshotChunk))+2 {
+			return fmt.Errorf("MsgDeSoSnapshotData.FromBytes: Too many ChunkProofs (%v) for a chunk "+
+				"with (%v) entries", numProofs, len(msg.SnapshotChunk))
+		}
+		for ; numProofs > 0; numProofs-- {
+			proof := &SnapshotChunkProof{}
+			if err = proof.FromBytes(rr); err != nil {
+				return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding ChunkProofs")
+			}
+			msg.ChunkProofs = append(msg.ChunkProofs, proof)
+		}
+	}
+
 	return nil
 }
 
@@ -3624,6 +3846,13 @@ type MsgDeSoTxn struct {
 	// since they have no inputs.
 	Signature DeSoSignature
 
+	// MultisigSignatures are the co-signer signatures required by an account that has
+	// registered a multisig with the RegisterMultisig txn. Like the Signature, they sign
+	// the txn without any signatures, so they're encoded after the V1 fields and only
+	// when present. This keeps the bytes of txns without them unchanged. Since they're part
+	// of the txn's hash, they must be sorted by signer public key and canonically encoded.
+	MultisigSignatures []*MultisigSignature
+
 	// (!!) **DO_NOT_USE** (!!)
 	//
 	// Use txn.TxnMeta.GetTxnType() instead.
@@ -3737,6 +3966,18 @@ func (msg *MsgDeSoTxn) ToBytes(preSignature bool) ([]byte, error) {
 		data = append(data, UintToBuf(msg.TxnFeeNanos)...)
 		data = append(data, msg.TxnNonce.ToBytes()...)
 	}
+
+	// The multisig signatures are only encoded if there are any, in the same way that the
+	// V1 fields are only encoded for V1 txns. They can only follow the V1 fields.
+	if !preSignature && len(msg.MultisigSignatures) > 0 {
+		if msg.TxnVersion == 0 {
+			return nil, fmt.Errorf("MsgDeSoTxn.ToBytes: Multisig signatures require TxnVersion 1")
+		}
+		data = append(data, UintToBuf(uint64(len(msg.MultisigSignatures)))...)
+		for _, multisigSignature := range msg.MultisigSignatures {
+			data = append(data, multisigSignature.ToBytes()...)
+		}
+	}
 	return data, nil
 }
 
@@ -3951,6 +4192,27 @@ func ReadTransactionV1Fields(rr io.Reader, ret *MsgDeSoTxn) error {
 	}
 	ret.TxnNonce = txnNonce
 
+	// The multisig signatures are only present if the reader hasn't reached EOF.
+	numMultisigSignatures, err := ReadUvarint(rr)
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(
+			err, "ReadTransactionV1Fields: Problem parsing number of DeSoTxn.MultisigSignatures")
+	}
+	if numMultisigSignatures == 0 || numMultisigSignatures > MaxMultisigCoSigners {
+		return fmt.Errorf("ReadTransactionV1Fields: Invalid number of multisig signatures %d",
+			numMultisigSignatures)
+	}
+	for ii := uint64(0); ii < numMultisigSignatures; ii++ {
+		multisigSignature := &MultisigSignature{}
+		if err = multisigSignature.FromBytes(rr); err != nil {
+			return errors.Wrapf(
+				err, "ReadTransactionV1Fields: Problem parsing DeSoTxn.MultisigSignatures bytes")
+		}
+		ret.MultisigSignatures = append(ret.MultisigSignatures, multisigSignature)
+	}
+
 	return nil
 }
 
@@ -5959,6 +6221,10 @@ type AuthorizeDerivedKeyOperationType uint8
 const (
 	AuthorizeDerivedKeyOperationNotValid AuthorizeDerivedKeyOperationType = 0
 	AuthorizeDerivedKeyOperationValid    AuthorizeDerivedKeyOperationType = 1
+	// AuthorizeDerivedKeyOperationExtend moves the ExpirationBlock of an existing valid
+	// derived key to a later block, keeping its spending limit tracker as it is. Its
+	// AccessSignature is made over AssembleDerivedKeyExtensionAccessBytes.
+	AuthorizeDerivedKeyOperationExtend AuthorizeDerivedKeyOperationType = 2
 )
 
 type AuthorizeDerivedKeyMetadata struct {
@@ -6067,6 +6333,34 @@ type TransactionSpendingLimit struct {
 	UnstakeLimitMap map[StakeLimitKey]*uint256.Int
 	// ValidatorPKID || StakerPKID to number of UnlockStake transactions.
 	UnlockStakeLimitMap map[StakeLimitKey]uint64
+
+	// ===== ENCODER MIGRATION DerivedKeyCoinAmountLimitsMigration =====
+	// CreatorPKID to the total base units of the creator's DAO coin that
+	// this derived key can transfer. The ZeroPKID caps transfers of any
+	// DAO coin. Unlike the DAOCoinOperationLimitMap, this limits the amount
+	// transferred rather than the number of txns, and a coin with no entry
+	// is only limited by the number of txns.
+	DAOCoinTransferLimitMap map[PKID]*uint256.Int
+	// CreatorPKID to the total nanos of the creator's coin that this derived
+	// key can spend, either by selling or transferring them. The ZeroPKID caps
+	// spending of any creator coin. A coin with no entry is only limited by the
+	// number of txns.
+	CreatorCoinSpendingLimitMap map[PKID]uint64
+
+	// ===== ENCODER MIGRATION DerivedKeyRecipientWhitelistMigration =====
+	// RecipientWhitelist is the set of public keys this derived key can send
+	// DESO, creator coins, DAO coins (including locked coins and streams), and
+	// NFTs to. Sending back to the owner is always allowed, and an empty
+	// whitelist allows any recipient. When authorizing a key, a false value
+	// removes the public key from the whitelist, but the last one can't be
+	// removed since that would allow any recipient. The tracker only holds
+	// true values.
+	RecipientWhitelist map[PublicKey]bool
+
+	// ===== ENCODER MIGRATION GovernanceMigration =====
+	// ProfilePKID || GovernanceLimitOperation to number of CreateProposal and
+	// CastVote transactions. The ZeroPKID applies to any DAO coin.
+	GovernanceLimitMap map[GovernanceLimitKey]uint64
 }
 
 // ToMetamaskString encodes the TransactionSpendingLimit into a Metamask-compatible string. The encoded string will
@@ -6425,6 +6719,102 @@ func (tsl *TransactionSpendingLimit) ToMetamaskString(params *DeSoParams) string
 		indentationCounter--
 	}
 
+	// DAOCoinTransferLimitMap
+	if len(tsl.DAOCoinTransferLimitMap) > 0 {
+		var daoCoinTransferLimitStr []string
+		str += _indt(indentationCounter) + "DAO Coin Transfer Amount Limits:\n"
+		indentationCounter++
+		for creatorPKID, limit := range tsl.DAOCoinTransferLimitMap {
+			opString := _indt(indentationCounter) + "[\n"
+
+			indentationCounter++
+			creatorPublicKeyBase58Check := "Any"
+			if !creatorPKID.IsZeroPKID() {
+				creatorPublicKeyBase58Check = Base58CheckEncode(creatorPKID.ToBytes(), false, params)
+			}
+			opString += _indt(indentationCounter) + "Creator PKID: " + creatorPublicKeyBase58Check + "\n"
+			opString += _indt(indentationCounter) + "Transfer Limit: " + limit.Hex() + " base units\n"
+			indentationCounter--
+
+			opString += _indt(indentationCounter) + "]\n"
+			daoCoinTransferLimitStr = append(daoCoinTransferLimitStr, opString)
+		}
+		// Ensure deterministic ordering of the limit strings by doing a lexicographical sort.
+		sortStringsAndAddToLimitStr(daoCoinTransferLimitStr)
+		indentationCounter--
+	}
+
+	// CreatorCoinSpendingLimitMap
+	if len(tsl.CreatorCoinSpendingLimitMap) > 0 {
+		var creatorCoinSpendingLimitStr []string
+		str += _indt(indentationCounter) + "Creator Coin Spending Amount Limits:\n"
+		indentationCounter++
+		for creatorPKID, limit := range tsl.CreatorCoinSpendingLimitMap {
+			opString := _indt(indentationCounter) + "[\n"
+
+			indentationCounter++
+			creatorPublicKeyBase58Check := "Any"
+			if !creatorPKID.IsZeroPKID() {
+				creatorPublicKeyBase58Check = Base58CheckEncode(creatorPKID.ToBytes(), false, params)
+			}
+			opString += _indt(indentationCounter) + "Creator PKID: " + creatorPublicKeyBase58Check + "\n"
+			creatorCoinLimit := NewFloat().Quo(
+				NewFloat().SetUint64(limit), NewFloat().SetUint64(NanosPerUnit),
+			)
+			opString += _indt(indentationCounter) + fmt.Sprintf("Spending Limit: %.2f Creator Coins\n", creatorCoinLimit)
+			indentationCounter--
+
+			opString += _indt(indentationCounter) + "]\n"
+			creatorCoinSpendingLimitStr = append(creatorCoinSpendingLimitStr, opString)
+		}
+		// Ensure deterministic ordering of the limit strings by doing a lexicographical sort.
+		sortStringsAndAddToLimitStr(creatorCoinSpendingLimitStr)
+		indentationCounter--
+	}
+
+	// RecipientWhitelist
+	if len(tsl.RecipientWhitelist) > 0 {
+		var recipientWhitelistStr []string
+		str += _indt(indentationCounter) + "Recipient Whitelist:\n"
+		indentationCounter++
+		for recipientPublicKey, isWhitelisted := range tsl.RecipientWhitelist {
+			action := "Allow"
+			if !isWhitelisted {
+				action = "Remove"
+			}
+			recipientWhitelistStr = append(recipientWhitelistStr, _indt(indentationCounter)+action+": "+
+				Base58CheckEncode(recipientPublicKey.ToBytes(), false, params)+"\n")
+		}
+		// Ensure deterministic ordering of the whitelist strings by doing a lexicographical sort.
+		sortStringsAndAddToLimitStr(recipientWhitelistStr)
+		indentationCounter--
+	}
+
+	// GovernanceLimitMap
+	if len(tsl.GovernanceLimitMap) > 0 {
+		var governanceLimitStr []string
+		str += _indt(indentationCounter) + "Governance Operation Limits:\n"
+		indentationCounter++
+		for limitKey, limit := range tsl.GovernanceLimitMap {
+			opString := _indt(indentationCounter) + "[\n"
+
+			indentationCounter++
+			opString += _indt(indentationCounter) + "Profile PKID: " +
+				Base58CheckEncode(limitKey.ProfilePKID.ToBytes(), false, params) + "\n"
+			opString += _indt(indentationCounter) + "Operation: " +
+				limitKey.Operation.ToString() + "\n"
+			opString += _indt(indentationCounter) + "Transaction Count: " +
+				strconv.FormatUint(limit, 10) + "\n"
+			indentationCounter--
+
+			opString += _indt(indentationCounter) + "]\n"
+			governanceLimitStr = append(governanceLimitStr, opString)
+		}
+		// Ensure deterministic ordering of the transaction count limit strings by doing a lexicographical sort.
+		sortStringsAndAddToLimitStr(governanceLimitStr)
+		indentationCounter--
+	}
+
 	// IsUnlimited
 	if tsl.IsUnlimited {
 		str += "Unlimited"
@@ -6725,6 +7115,97 @@ func (tsl *TransactionSpendingLimit) ToBytes(blockHeight uint64) ([]byte, error)
 		}
 	}
 
+	// DAOCoinTransferLimitMap and CreatorCoinSpendingLimitMap, gated by the encoder migration.
+	if MigrationTriggered(blockHeight, DerivedKeyCoinAmountLimitsMigration) {
+		// DAOCoinTransferLimitMap
+		daoCoinTransferLimitMapLength := uint64(len(tsl.DAOCoinTransferLimitMap))
+		data = append(data, UintToBuf(daoCoinTransferLimitMapLength)...)
+		if daoCoinTransferLimitMapLength > 0 {
+			keys, err := SafeMakeSliceWithLengthAndCapacity[PKID](0, daoCoinTransferLimitMapLength)
+			if err != nil {
+				return nil, err
+			}
+			for key := range tsl.DAOCoinTransferLimitMap {
+				keys = append(keys, key)
+			}
+			// Sort the keys to ensure deterministic ordering.
+			sort.Slice(keys, func(ii, jj int) bool {
+				return bytes.Compare(keys[ii].ToBytes(), keys[jj].ToBytes()) < 0
+			})
+			for _, key := range keys {
+				data = append(data, key.ToBytes()...)
+				data = append(data, VariableEncodeUint256(tsl.DAOCoinTransferLimitMap[key])...)
+			}
+		}
+
+		// CreatorCoinSpendingLimitMap
+		creatorCoinSpendingLimitMapLength := uint64(len(tsl.CreatorCoinSpendingLimitMap))
+		data = append(data, UintToBuf(creatorCoinSpendingLimitMapLength)...)
+		if creatorCoinSpendingLimitMapLength > 0 {
+			keys, err := SafeMakeSliceWithLengthAndCapacity[PKID](0, creatorCoinSpendingLimitMapLength)
+			if err != nil {
+				return nil, err
+			}
+			for key := range tsl.CreatorCoinSpendingLimitMap {
+				keys = append(keys, key)
+			}
+			// Sort the keys to ensure deterministic ordering.
+			sort.Slice(keys, func(ii, jj int) bool {
+				return bytes.Compare(keys[ii].ToBytes(), keys[jj].ToBytes()) < 0
+			})
+			for _, key := range keys {
+				data = append(data, key.ToBytes()...)
+				data = append(data, UintToBuf(tsl.CreatorCoinSpendingLimitMap[key])...)
+			}
+		}
+	}
+
+	// RecipientWhitelist, gated by the encoder migration.
+	if MigrationTriggered(blockHeight, DerivedKeyRecipientWhitelistMigration) {
+		recipientWhitelistLength := uint64(len(tsl.RecipientWhitelist))
+		data = append(data, UintToBuf(recipientWhitelistLength)...)
+		if recipientWhitelistLength > 0 {
+			keys, err := SafeMakeSliceWithLengthAndCapacity[PublicKey](0, recipientWhitelistLength)
+			if err != nil {
+				return nil, err
+			}
+			for key := range tsl.RecipientWhitelist {
+				keys = append(keys, key)
+			}
+			// Sort the keys to ensure deterministic ordering.
+			sort.Slice(keys, func(ii, jj int) bool {
+				return bytes.Compare(keys[ii].ToBytes(), keys[jj].ToBytes()) < 0
+			})
+			for _, key := range keys {
+				data = append(data, EncodeByteArray(key.ToBytes())...)
+				data = append(data, BoolToByte(tsl.RecipientWhitelist[key]))
+			}
+		}
+	}
+
+	// GovernanceLimitMap, gated by the encoder migration.
+	if MigrationTriggered(blockHeight, GovernanceMigration) {
+		governanceLimitMapLength := uint64(len(tsl.GovernanceLimitMap))
+		data = append(data, UintToBuf(governanceLimitMapLength)...)
+		if governanceLimitMapLength > 0 {
+			keys, err := SafeMakeSliceWithLengthAndCapacity[GovernanceLimitKey](0, governanceLimitMapLength)
+			if err != nil {
+				return nil, err
+			}
+			for key := range tsl.GovernanceLimitMap {
+				keys = append(keys, key)
+			}
+			// Sort the keys to ensure deterministic ordering.
+			sort.Slice(keys, func(ii, jj int) bool {
+				return bytes.Compare(keys[ii].Encode(), keys[jj].Encode()) < 0
+			})
+			for _, key := range keys {
+				data = append(data, key.Encode()...)
+				data = append(data, UintToBuf(tsl.GovernanceLimitMap[key])...)
+			}
+		}
+	}
+
 	return data, nil
 }
 
@@ -7033,6 +7514,103 @@ func (tsl *TransactionSpendingLimit) FromBytes(blockHeight uint64, rr *bytes.Rea
 		}
 	}
 
+	// DAOCoinTransferLimitMap and CreatorCoinSpendingLimitMap, gated by the encoder migration.
+	if MigrationTriggered(blockHeight, DerivedKeyCoinAmountLimitsMigration) {
+		// DAOCoinTransferLimitMap
+		daoCoinTransferLimitMapLen, err := ReadUvarint(rr)
+		if err != nil {
+			return err
+		}
+		tsl.DAOCoinTransferLimitMap = make(map[PKID]*uint256.Int)
+		for ii := uint64(0); ii < daoCoinTransferLimitMapLen; ii++ {
+			creatorPKID := &PKID{}
+			if err = creatorPKID.FromBytes(rr); err != nil {
+				return errors.Wrap(err, "Error decoding CreatorPKID for DAOCoinTransferLimitMap: ")
+			}
+			var transferLimitBaseUnits *uint256.Int
+			transferLimitBaseUnits, err = VariableDecodeUint256(rr)
+			if err != nil {
+				return errors.Wrap(err, "Error decoding limit for DAOCoinTransferLimitMap: ")
+			}
+			if _, exists := tsl.DAOCoinTransferLimitMap[*creatorPKID]; exists {
+				return errors.New("CreatorPKID already exists in DAOCoinTransferLimitMap")
+			}
+			tsl.DAOCoinTransferLimitMap[*creatorPKID] = transferLimitBaseUnits
+		}
+
+		// CreatorCoinSpendingLimitMap
+		creatorCoinSpendingLimitMapLen, err := ReadUvarint(rr)
+		if err != nil {
+			return err
+		}
+		tsl.CreatorCoinSpendingLimitMap = make(map[PKID]uint64)
+		for ii := uint64(0); ii < creatorCoinSpendingLimitMapLen; ii++ {
+			creatorPKID := &PKID{}
+			if err = creatorPKID.FromBytes(rr); err != nil {
+				return errors.Wrap(err, "Error decoding CreatorPKID for CreatorCoinSpendingLimitMap: ")
+			}
+			var spendingLimitNanos uint64
+			spendingLimitNanos, err = ReadUvarint(rr)
+			if err != nil {
+				return errors.Wrap(err, "Error decoding limit for CreatorCoinSpendingLimitMap: ")
+			}
+			if _, exists := tsl.CreatorCoinSpendingLimitMap[*creatorPKID]; exists {
+				return errors.New("CreatorPKID already exists in CreatorCoinSpendingLimitMap")
+			}
+			tsl.CreatorCoinSpendingLimitMap[*creatorPKID] = spendingLimitNanos
+		}
+	}
+
+	// RecipientWhitelist, gated by the encoder migration.
+	if MigrationTriggered(blockHeight, DerivedKeyRecipientWhitelistMigration) {
+		recipientWhitelistLen, err := ReadUvarint(rr)
+		if err != nil {
+			return err
+		}
+		tsl.RecipientWhitelist = make(map[PublicKey]bool)
+		for ii := uint64(0); ii < recipientWhitelistLen; ii++ {
+			recipientPublicKeyBytes, err := DecodeByteArray(rr)
+			if err != nil {
+				return errors.Wrap(err, "Error decoding public key for RecipientWhitelist: ")
+			}
+			if len(recipientPublicKeyBytes) != btcec.PubKeyBytesLenCompressed {
+				return fmt.Errorf("Invalid public key length %d for RecipientWhitelist", len(recipientPublicKeyBytes))
+			}
+			isWhitelisted, err := ReadBoolByte(rr)
+			if err != nil {
+				return errors.Wrap(err, "Error decoding value for RecipientWhitelist: ")
+			}
+			recipientPublicKey := *NewPublicKey(recipientPublicKeyBytes)
+			if _, exists := tsl.RecipientWhitelist[recipientPublicKey]; exists {
+				return errors.New("Public key already exists in RecipientWhitelist")
+			}
+			tsl.RecipientWhitelist[recipientPublicKey] = isWhitelisted
+		}
+	}
+
+	// GovernanceLimitMap, gated by the encoder migration.
+	if MigrationTriggered(blockHeight, GovernanceMigration) {
+		governanceLimitMapLen, err := ReadUvarint(rr)
+		if err != nil {
+			return err
+		}
+		tsl.GovernanceLimitMap = make(map[GovernanceLimitKey]uint64)
+		for ii := uint64(0); ii < governanceLimitMapLen; ii++ {
+			governanceLimitKey := &GovernanceLimitKey{}
+			if err = governanceLimitKey.Decode(rr); err != nil {
+				return errors.Wrap(err, "Error decoding key for GovernanceLimitMap: ")
+			}
+			operationCount, err := ReadUvarint(rr)
+			if err != nil {
+				return errors.Wrap(err, "Error decoding count for GovernanceLimitMap: ")
+			}
+			if _, exists := tsl.GovernanceLimitMap[*governanceLimitKey]; exists {
+				return errors.New("Key already exists in GovernanceLimitMap")
+			}
+			tsl.GovernanceLimitMap[*governanceLimitKey] = operationCount
+		}
+	}
+
 	return nil
 }
 
@@ -7093,6 +7671,10 @@ func (tsl *TransactionSpendingLimit) Copy() *TransactionSpendingLimit {
 		StakeLimitMap:                make(map[StakeLimitKey]*uint256.Int),
 		UnstakeLimitMap:              make(map[StakeLimitKey]*uint256.Int),
 		UnlockStakeLimitMap:          make(map[StakeLimitKey]uint64),
+		DAOCoinTransferLimitMap:      make(map[PKID]*uint256.Int),
+		CreatorCoinSpendingLimitMap:  make(map[PKID]uint64),
+		RecipientWhitelist:           make(map[PublicKey]bool),
+		GovernanceLimitMap:           make(map[GovernanceLimitKey]uint64),
 		IsUnlimited:                  tsl.IsUnlimited,
 	}
 
@@ -7149,11 +7731,27 @@ func (tsl *TransactionSpendingLimit) Copy() *TransactionSpendingLimit {
 		copyTSL.UnlockStakeLimitMap[stakeLimitKey] = unlockStakeOperationCount
 	}
 
+	for creatorPKID, transferLimitBaseUnits := range tsl.DAOCoinTransferLimitMap {
+		copyTSL.DAOCoinTransferLimitMap[creatorPKID] = transferLimitBaseUnits.Clone()
+	}
+
+	for creatorPKID, spendingLimitNanos := range tsl.CreatorCoinSpendingLimitMap {
+		copyTSL.CreatorCoinSpendingLimitMap[creatorPKID] = spendingLimitNanos
+	}
+
+	for recipientPublicKey, isWhitelisted := range tsl.RecipientWhitelist {
+		copyTSL.RecipientWhitelist[recipientPublicKey] = isWhitelisted
+	}
+
+	for governanceLimitKey, governanceOperationCount := range tsl.GovernanceLimitMap {
+		copyTSL.GovernanceLimitMap[governanceLimitKey] = governanceOperationCount
+	}
+
 	return copyTSL
 }
 
 func (bav *UtxoView) CheckIfValidUnlimitedSpendingLimit(tsl *TransactionSpendingLimit, blockHeight uint32) (_isUnlimited bool, _err error) {
-	AssertDependencyStructFieldNumbers(&TransactionSpendingLimit{}, 14)
+	AssertDependencyStructFieldNumbers(&TransactionSpendingLimit{}, 18)
 
 	if tsl.IsUnlimited && blockHeight < bav.Params.ForkHeights.DeSoUnlimitedDerivedKeysBlockHeight {
 		return false, RuleErrorUnlimitedDerivedKeyBeforeBlockHeight
@@ -7173,7 +7771,11 @@ func (bav *UtxoView) CheckIfValidUnlimitedSpendingLimit(tsl *TransactionSpending
 		len(tsl.LockupLimitMap) > 0 ||
 		len(tsl.StakeLimitMap) > 0 ||
 		len(tsl.UnstakeLimitMap) > 0 ||
-		len(tsl.UnlockStakeLimitMap) > 0) {
+		len(tsl.UnlockStakeLimitMap) > 0 ||
+		len(tsl.DAOCoinTransferLimitMap) > 0 ||
+		len(tsl.CreatorCoinSpendingLimitMap) > 0 ||
+		len(tsl.RecipientWhitelist) > 0 ||
+		len(tsl.GovernanceLimitMap) > 0) {
 		return tsl.IsUnlimited, RuleErrorUnlimitedDerivedKeyNonEmptySpendingLimits
 	}
 
@@ -7427,6 +8029,9 @@ const (
 	UpdateTransferRestrictionStatusDAOCoinOperation DAOCoinLimitOperation = 4
 	TransferDAOCoinOperation                        DAOCoinLimitOperation = 5
 	UndefinedDAOCoinOperation                       DAOCoinLimitOperation = 6
+	UpdateDecimalsDAOCoinOperation                  DAOCoinLimitOperation = 7
+	UpdateMetadataDAOCoinOperation                  DAOCoinLimitOperation = 8
+	UpdateLimitOrderRestrictionDAOCoinOperation     DAOCoinLimitOperation = 9
 )
 
 type DAOCoinLimitOperationString string
@@ -7438,6 +8043,9 @@ const (
 	DisableMintingDAOCoinOperationString                  DAOCoinLimitOperationString = "disable_minting"
 	UpdateTransferRestrictionStatusDAOCoinOperationString DAOCoinLimitOperationString = "update_transfer_restriction_status"
 	TransferDAOCoinOperationString                        DAOCoinLimitOperationString = "transfer"
+	UpdateDecimalsDAOCoinOperationString                  DAOCoinLimitOperationString = "update_decimals"
+	UpdateMetadataDAOCoinOperationString                  DAOCoinLimitOperationString = "update_metadata"
+	UpdateLimitOrderRestrictionDAOCoinOperationString     DAOCoinLimitOperationString = "update_limit_order_restriction"
 	UndefinedDAOCoinOperationString                       DAOCoinLimitOperationString = "undefined"
 )
 
@@ -7459,6 +8067,12 @@ func (daoCoinLimitOperation DAOCoinLimitOperation) ToDAOCoinLimitOperationString
 		return UpdateTransferRestrictionStatusDAOCoinOperationString
 	case TransferDAOCoinOperation:
 		return TransferDAOCoinOperationString
+	case UpdateDecimalsDAOCoinOperation:
+		return UpdateDecimalsDAOCoinOperationString
+	case UpdateMetadataDAOCoinOperation:
+		return UpdateMetadataDAOCoinOperationString
+	case UpdateLimitOrderRestrictionDAOCoinOperation:
+		return UpdateLimitOrderRestrictionDAOCoinOperationString
 	default:
 		return UndefinedDAOCoinOperationString
 	}
@@ -7478,6 +8092,12 @@ func (daoCoinLimitOperationString DAOCoinLimitOperationString) ToDAOCoinLimitOpe
 		return UpdateTransferRestrictionStatusDAOCoinOperation
 	case TransferDAOCoinOperationString:
 		return TransferDAOCoinOperation
+	case UpdateDecimalsDAOCoinOperationString:
+		return UpdateDecimalsDAOCoinOperation
+	case UpdateMetadataDAOCoinOperationString:
+		return UpdateMetadataDAOCoinOperation
+	case UpdateLimitOrderRestrictionDAOCoinOperationString:
+		return UpdateLimitOrderRestrictionDAOCoinOperation
 	default:
 		return UndefinedDAOCoinOperation
 	}
@@ -7973,6 +8593,9 @@ const (
 	DAOCoinOperationTypeBurn                            DAOCoinOperationType = 1
 	DAOCoinOperationTypeDisableMinting                  DAOCoinOperationType = 2
 	DAOCoinOperationTypeUpdateTransferRestrictionStatus DAOCoinOperationType = 3
+	DAOCoinOperationTypeUpdateDecimals                  DAOCoinOperationType = 4
+	DAOCoinOperationTypeUpdateMetadata                  DAOCoinOperationType = 5
+	DAOCoinOperationTypeUpdateLimitOrderRestriction     DAOCoinOperationType = 6
 )
 
 type DAOCoinMetadata struct {
@@ -7994,6 +8617,15 @@ type DAOCoinMetadata struct {
 
 	// TransferRestrictionStatus to set if OperationType == DAOCoinOperationTypeUpdateTransferRestrictionStatus
 	TransferRestrictionStatus
+
+	// Decimals to set if OperationType == DAOCoinOperationTypeUpdateDecimals. It's
+	// only encoded when set, so other operations keep their original encoding.
+	Decimals uint8
+
+	// DAOCoinLimitOrderRestriction to set if OperationType ==
+	// DAOCoinOperationTypeUpdateLimitOrderRestriction. Like Decimals, it's only
+	// encoded when set. Clearing the restriction is encoded as an absent byte.
+	DAOCoinLimitOrderRestriction
 }
 
 func (txnData *DAOCoinMetadata) GetTxnType() TxnType {
@@ -8026,6 +8658,15 @@ func (txnData *DAOCoinMetadata) ToBytes(preSignature bool) ([]byte, error) {
 
 	data = append(data, byte(txnData.TransferRestrictionStatus))
 
+	// Decimals is always written ahead of a DAOCoinLimitOrderRestriction so that
+	// the trailing bytes can be told apart, even if it's zero.
+	if txnData.Decimals != 0 || txnData.DAOCoinLimitOrderRestriction != 0 {
+		data = append(data, txnData.Decimals)
+	}
+	if txnData.DAOCoinLimitOrderRestriction != 0 {
+		data = append(data, byte(txnData.DAOCoinLimitOrderRestriction))
+	}
+
 	return data, nil
 }
 
@@ -8099,6 +8740,29 @@ func (txnData *DAOCoinMetadata) FromBytes(data []byte) error {
 	}
 	ret.TransferRestrictionStatus = TransferRestrictionStatus(transferRestrictionStatus)
 
+	if rr.Len() > 0 {
+		ret.Decimals, err = rr.ReadByte()
+		if err != nil {
+			return fmt.Errorf("DAOCoinMetadata.FromBytes: Error reading Decimals: %v", err)
+		}
+		// A zero would be dropped when re-encoding unless a restriction follows.
+		if ret.Decimals == 0 && rr.Len() == 0 {
+			return fmt.Errorf("DAOCoinMetadata.FromBytes: Decimals is encoded but not set")
+		}
+	}
+
+	if rr.Len() > 0 {
+		restrictionByte, err := rr.ReadByte()
+		if err != nil {
+			return fmt.Errorf("DAOCoinMetadata.FromBytes: Error reading DAOCoinLimitOrderRestriction: %v", err)
+		}
+		ret.DAOCoinLimitOrderRestriction = DAOCoinLimitOrderRestriction(restrictionByte)
+		// Likewise, a zero would be dropped when re-encoding.
+		if ret.DAOCoinLimitOrderRestriction == DAOCoinLimitOrderRestrictionUnrestricted {
+			return fmt.Errorf("DAOCoinMetadata.FromBytes: DAOCoinLimitOrderRestriction is encoded but not set")
+		}
+	}
+
 	*txnData = ret
 	return nil
 }
@@ -8234,6 +8898,65 @@ type DAOCoinLimitOrderMetadata struct {
 	// of the transaction AND ensures the internal balance model of the
 	// DAO Coin Limit Order transaction connection logic remains valid.
 	FeeNanos uint64
+
+	// The fields below are optional. They're encoded after FeeNanos in the
+	// order they were added, and only up to the last one that's set, so
+	// orders that don't use them keep their original encoding.
+
+	// If set, the order expires at this block height and falls out of the
+	// order book. Zero means the order never expires.
+	ExpirationBlockHeight uint32
+
+	// If set on a market order, the order never matches an order whose price
+	// is worse than this scaled exchange rate, which is expressed like
+	// ScaledExchangeRateCoinsToSellPerCoinToBuy. Reaching it fails a FillOrKill
+	// order, and stops an ImmediateOrCancel order at the fills it already got.
+	// This protects market orders from filling at an absurd price when the
+	// book is thin.
+	MaxSlippageScaledPrice *uint256.Int
+
+	// If set, the order is a stop-limit order. It rests in the order book
+	// dormant until the last trade price of the coin pair, expressed like
+	// ScaledExchangeRateCoinsToSellPerCoinToBuy, reaches this scaled exchange
+	// rate, at which point it becomes matchable like a regular limit order.
+	StopTriggerScaledPrice *uint256.Int
+
+	// If set, the order is never filled for less than this many base units in
+	// a single match, unless the match completes the order. The quantity is
+	// denominated like QuantityToFillInBaseUnits. This keeps a large order
+	// from being whittled down by dust fills.
+	MinQuantityToFillInBaseUnits *uint256.Int
+
+	// If set, overrides which coin QuantityToFillInBaseUnits is denominated in,
+	// which otherwise depends on the OperationType. This lets a BID spend an
+	// exact amount of the selling coin, e.g. "spend exactly 10 DESO", or an ASK
+	// buy an exact amount of the buying coin.
+	QuantityDenomination DAOCoinLimitOrderQuantityDenomination
+
+	// If set, the txn doesn't place an order, and instead cancels all of the
+	// transactor's open orders, or all of them for the coin pair given by
+	// BuyingDAOCoinCreatorPublicKey and SellingDAOCoinCreatorPublicKey. This
+	// lets a bot pull all its quotes in a single txn.
+	CancelAll DAOCoinLimitOrderCancelAll
+
+	// If set along with CancelOrderID, the txn cancels that order and places
+	// the order described by the rest of the metadata in its place. Either both
+	// take effect or the txn fails, so a bot never ends up with its old quote
+	// cancelled but its new one missing.
+	ReplaceCancelledOrder bool
+
+	// If set, the coin of BuyingDAOCoinCreatorPublicKey or SellingDAOCoinCreatorPublicKey,
+	// respectively, is the creator's creator coin rather than their DAO coin. Neither
+	// can be set for $DESO.
+	BuyingCoinIsCreatorCoin  bool
+	SellingCoinIsCreatorCoin bool
+}
+
+// PlacesOrder returns true if the txn places a new order, i.e. if it's not
+// just cancelling orders.
+func (txnData *DAOCoinLimitOrderMetadata) PlacesOrder() bool {
+	return txnData.CancelAll == DAOCoinLimitOrderCancelAllNone &&
+		(txnData.CancelOrderID == nil || txnData.ReplaceCancelledOrder)
 }
 
 func (txnData *DAOCoinLimitOrderMetadata) GetTxnType() TxnType {
@@ -8262,6 +8985,50 @@ func (txnData *DAOCoinLimitOrderMetadata) ToBytes(preSignature bool) ([]byte, er
 	}
 
 	data = append(data, UintToBuf(txnData.FeeNanos)...)
+
+	// Encode the optional fields up to the last one that's set.
+	optionalFields := [][]byte{
+		UintToBuf(uint64(txnData.ExpirationBlockHeight)),
+		VariableEncodeUint256(txnData.MaxSlippageScaledPrice),
+		VariableEncodeUint256(txnData.StopTriggerScaledPrice),
+		VariableEncodeUint256(txnData.MinQuantityToFillInBaseUnits),
+		UintToBuf(uint64(txnData.QuantityDenomination)),
+		UintToBuf(uint64(txnData.CancelAll)),
+		{BoolToByte(txnData.ReplaceCancelledOrder)},
+		{BoolToByte(txnData.BuyingCoinIsCreatorCoin)},
+		{BoolToByte(txnData.SellingCoinIsCreatorCoin)},
+	}
+	numOptionalFields := 0
+	if txnData.ExpirationBlockHeight != 0 {
+		numOptionalFields = 1
+	}
+	if txnData.MaxSlippageScaledPrice != nil {
+		numOptionalFields = 2
+	}
+	if txnData.StopTriggerScaledPrice != nil {
+		numOptionalFields = 3
+	}
+	if txnData.MinQuantityToFillInBaseUnits != nil {
+		numOptionalFields = 4
+	}
+	if txnData.QuantityDenomination != DAOCoinLimitOrderQuantityDenominationDefault {
+		numOptionalFields = 5
+	}
+	if txnData.CancelAll != DAOCoinLimitOrderCancelAllNone {
+		numOptionalFields = 6
+	}
+	if txnData.ReplaceCancelledOrder {
+		numOptionalFields = 7
+	}
+	if txnData.BuyingCoinIsCreatorCoin {
+		numOptionalFields = 8
+	}
+	if txnData.SellingCoinIsCreatorCoin {
+		numOptionalFields = 9
+	}
+	for _, optionalField := range optionalFields[:numOptionalFields] {
+		data = append(data, optionalField...)
+	}
 	return data, nil
 }
 
@@ -8391,6 +9158,109 @@ func (txnData *DAOCoinLimitOrderMetadata) FromBytes(data []byte) error {
 		return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading FeeNanos: %v", err)
 	}
 
+	// Parse the optional fields that are present. The last one that's present
+	// must be set, otherwise it would be dropped when re-encoding.
+	lastOptionalFieldIsSet := true
+
+	// Parse ExpirationBlockHeight
+	if rr.Len() > 0 {
+		expirationBlockHeight, err := ReadUvarint(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading ExpirationBlockHeight: %v", err)
+		}
+		if expirationBlockHeight > uint64(math.MaxUint32) {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Invalid ExpirationBlockHeight %d",
+				expirationBlockHeight)
+		}
+		ret.ExpirationBlockHeight = uint32(expirationBlockHeight)
+		lastOptionalFieldIsSet = ret.ExpirationBlockHeight != 0
+	}
+
+	// Parse MaxSlippageScaledPrice
+	if rr.Len() > 0 {
+		ret.MaxSlippageScaledPrice, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading MaxSlippageScaledPrice: %v", err)
+		}
+		lastOptionalFieldIsSet = ret.MaxSlippageScaledPrice != nil
+	}
+
+	// Parse StopTriggerScaledPrice
+	if rr.Len() > 0 {
+		ret.StopTriggerScaledPrice, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading StopTriggerScaledPrice: %v", err)
+		}
+		lastOptionalFieldIsSet = ret.StopTriggerScaledPrice != nil
+	}
+
+	// Parse MinQuantityToFillInBaseUnits
+	if rr.Len() > 0 {
+		ret.MinQuantityToFillInBaseUnits, err = VariableDecodeUint256(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading MinQuantityToFillInBaseUnits: %v", err)
+		}
+		lastOptionalFieldIsSet = ret.MinQuantityToFillInBaseUnits != nil
+	}
+
+	// Parse QuantityDenomination
+	if rr.Len() > 0 {
+		quantityDenomination, err := ReadUvarint(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading QuantityDenomination: %v", err)
+		}
+		if quantityDenomination > math.MaxUint8 {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Invalid QuantityDenomination %d",
+				quantityDenomination)
+		}
+		ret.QuantityDenomination = DAOCoinLimitOrderQuantityDenomination(quantityDenomination)
+		lastOptionalFieldIsSet = ret.QuantityDenomination != DAOCoinLimitOrderQuantityDenominationDefault
+	}
+
+	// Parse CancelAll
+	if rr.Len() > 0 {
+		cancelAll, err := ReadUvarint(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading CancelAll: %v", err)
+		}
+		if cancelAll > math.MaxUint8 {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Invalid CancelAll %d", cancelAll)
+		}
+		ret.CancelAll = DAOCoinLimitOrderCancelAll(cancelAll)
+		lastOptionalFieldIsSet = ret.CancelAll != DAOCoinLimitOrderCancelAllNone
+	}
+
+	// Parse ReplaceCancelledOrder
+	if rr.Len() > 0 {
+		ret.ReplaceCancelledOrder, err = ReadBoolByte(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading ReplaceCancelledOrder: %v", err)
+		}
+		lastOptionalFieldIsSet = ret.ReplaceCancelledOrder
+	}
+
+	// Parse BuyingCoinIsCreatorCoin
+	if rr.Len() > 0 {
+		ret.BuyingCoinIsCreatorCoin, err = ReadBoolByte(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading BuyingCoinIsCreatorCoin: %v", err)
+		}
+		lastOptionalFieldIsSet = ret.BuyingCoinIsCreatorCoin
+	}
+
+	// Parse SellingCoinIsCreatorCoin
+	if rr.Len() > 0 {
+		ret.SellingCoinIsCreatorCoin, err = ReadBoolByte(rr)
+		if err != nil {
+			return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Error reading SellingCoinIsCreatorCoin: %v", err)
+		}
+		lastOptionalFieldIsSet = ret.SellingCoinIsCreatorCoin
+	}
+
+	if !lastOptionalFieldIsSet {
+		return fmt.Errorf("DAOCoinLimitOrderMetadata.FromBytes: Last optional field is encoded but not set")
+	}
+
 	*txnData = ret
 	return nil
 }
@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/pkg/errors"
+)
+
+// ==================================================================
+// NODE_ADVISORY Message
+// ==================================================================
+
+// Node advisories let the param updaters warn node operators about urgent upgrades
+// or common misconfigurations. They are signed by a param updater key and relayed
+// by every node that supports them, so an operator sees the advisory regardless of
+// which peers they're connected to. Advisories carry an expiration, and nodes
+// remember every advisory they've accepted until it expires, so a stale or already
+// seen advisory can't be replayed into the network.
+
+const (
+	// MaxNodeAdvisoryMessageLength is the maximum length of an advisory's Message.
+	MaxNodeAdvisoryMessageLength = 2048
+	// MaxNodeAdvisoryLifetime is the furthest after its issue time that an advisory
+	// can expire. It bounds how long nodes need to remember an advisory for.
+	MaxNodeAdvisoryLifetime = 30 * 24 * time.Hour
+	// MaxNodeAdvisoryClockSkew is how far into the future an advisory's issue time
+	// can be relative to our clock.
+	MaxNodeAdvisoryClockSkew = 10 * time.Minute
+	// MaxActiveNodeAdvisories bounds the number of advisories a node keeps in memory.
+	MaxActiveNodeAdvisories = 100
+)
+
+type NodeAdvisorySeverity uint8
+
+const (
+	NodeAdvisorySeverityInfo    NodeAdvisorySeverity = 0
+	NodeAdvisorySeverityWarning NodeAdvisorySeverity = 1
+	NodeAdvisorySeverityUrgent  NodeAdvisorySeverity = 2
+)
+
+func (severity NodeAdvisorySeverity) String() string {
+	switch severity {
+	case NodeAdvisorySeverityInfo:
+		return "INFO"
+	case NodeAdvisorySeverityWarning:
+		return "WARNING"
+	case NodeAdvisorySeverityUrgent:
+		return "URGENT"
+	default:
+		return fmt.Sprintf("UNRECOGNIZED(%d)", severity)
+	}
+}
+
+type MsgDeSoNodeAdvisory struct {
+	Severity NodeAdvisorySeverity
+	// Message is the human-readable advisory shown to node operators.
+	Message string
+	// Nonce makes two advisories with the same contents and timestamps distinct.
+	Nonce                   uint64
+	IssuedAtTimestampSecs   uint64
+	ExpirationTimestampSecs uint64
+	// SignerPublicKey is the compressed public key of the param updater that
+	// signed the advisory.
+	SignerPublicKey []byte
+	// Signature is a DER-encoded signature of the double-sha256 hash of the
+	// advisory's pre-signature bytes.
+	Signature []byte
+}
+
+func (msg *MsgDeSoNodeAdvisory) ToBytes(preSignature bool) ([]byte, error) {
+	retBytes := []byte{}
+
+	retBytes = append(retBytes, UintToBuf(uint64(msg.Severity))...)
+	retBytes = append(retBytes, EncodeByteArray([]byte(msg.Message))...)
+	retBytes = append(retBytes, UintToBuf(msg.Nonce)...)
+	retBytes = append(retBytes, UintToBuf(msg.IssuedAtTimestampSecs)...)
+	retBytes = append(retBytes, UintToBuf(msg.ExpirationTimestampSecs)...)
+	retBytes = append(retBytes, EncodeByteArray(msg.SignerPublicKey)...)
+	if !preSignature {
+		retBytes = append(retBytes, EncodeByteArray(msg.Signature)...)
+	}
+
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoNodeAdvisory) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoNodeAdvisory{}
+
+	// Severity
+	severity, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.FromBytes: Problem reading Severity: ")
+	}
+	if severity > uint64(NodeAdvisorySeverityUrgent) {
+		return fmt.Errorf("MsgDeSoNodeAdvisory.FromBytes: Unrecognized severity %d", severity)
+	}
+	retMsg.Severity = NodeAdvisorySeverity(severity)
+
+	// Message
+	messageBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.FromBytes: Problem reading Message: ")
+	}
+	if len(messageBytes) > MaxNodeAdvisoryMessageLength {
+		return fmt.Errorf("MsgDeSoNodeAdvisory.FromBytes: Message length %d exceeds max allowed %d",
+			len(messageBytes), MaxNodeAdvisoryMessageLength)
+	}
+	retMsg.Message = string(messageBytes)
+
+	// Nonce
+	retMsg.Nonce, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.FromBytes: Problem reading Nonce: ")
+	}
+
+	// IssuedAtTimestampSecs
+	retMsg.IssuedAtTimestampSecs, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.FromBytes: Problem reading IssuedAtTimestampSecs: ")
+	}
+
+	// ExpirationTimestampSecs
+	retMsg.ExpirationTimestampSecs, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.FromBytes: Problem reading ExpirationTimestampSecs: ")
+	}
+
+	// SignerPublicKey
+	retMsg.SignerPublicKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.FromBytes: Problem reading SignerPublicKey: ")
+	}
+
+	// Signature
+	retMsg.Signature, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.FromBytes: Problem reading Signature: ")
+	}
+
+	*msg = retMsg
+	return nil
+}
+
+func (msg *MsgDeSoNodeAdvisory) GetMsgType() MsgType {
+	return MsgTypeNodeAdvisory
+}
+
+func (msg *MsgDeSoNodeAdvisory) String() string {
+	return fmt.Sprintf("[%v] %s (expires %v)", msg.Severity, msg.Message,
+		time.Unix(int64(msg.ExpirationTimestampSecs), 0).UTC())
+}
+
+// Hash uniquely identifies an advisory. It covers everything but the signature.
+func (msg *MsgDeSoNodeAdvisory) Hash() (*BlockHash, error) {
+	preSignatureBytes, err := msg.ToBytes(true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoNodeAdvisory.Hash: Problem serializing advisory: ")
+	}
+	return Sha256DoubleHash(preSignatureBytes), nil
+}
+
+// Sign sets the advisory's SignerPublicKey and Signature using the given param updater key.
+func (msg *MsgDeSoNodeAdvisory) Sign(privateKey *btcec.PrivateKey) error {
+	msg.SignerPublicKey = privateKey.PubKey().SerializeCompressed()
+	hash, err := msg.Hash()
+	if err != nil {
+		return err
+	}
+	signature, err := privateKey.Sign(hash[:])
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoNodeAdvisory.Sign: Problem signing advisory: ")
+	}
+	msg.Signature = signature.Serialize()
+	return nil
+}
+
+// ValidateNodeAdvisory checks that an advisory is well-formed, unexpired, and signed by
+// one of the given param updater keys.
+func ValidateNodeAdvisory(msg *MsgDeSoNodeAdvisory, paramUpdaterPublicKeys map[PkMapKey]bool, now time.Time) error {
+	if len(msg.Message) == 0 || len(msg.Message) > MaxNodeAdvisoryMessageLength {
+		return fmt.Errorf("ValidateNodeAdvisory: Message length %d must be between 1 and %d",
+			len(msg.Message), MaxNodeAdvisoryMessageLength)
+	}
+	nowSecs := uint64(now.Unix())
+	if msg.ExpirationTimestampSecs <= nowSecs {
+		return fmt.Errorf("ValidateNodeAdvisory: Advisory expired at %d", msg.ExpirationTimestampSecs)
+	}
+	if msg.IssuedAtTimestampSecs > nowSecs+uint64(MaxNodeAdvisoryClockSkew.Seconds()) {
+		return fmt.Errorf("ValidateNodeAdvisory: Advisory issued in the future at %d", msg.IssuedAtTimestampSecs)
+	}
+	if msg.ExpirationTimestampSecs <= msg.IssuedAtTimestampSecs ||
+		msg.ExpirationTimestampSecs-msg.IssuedAtTimestampSecs > uint64(MaxNodeAdvisoryLifetime.Seconds()) {
+		return fmt.Errorf("ValidateNodeAdvisory: Advisory lifetime must be positive and at most %v",
+			MaxNodeAdvisoryLifetime)
+	}
+
+	if len(msg.SignerPublicKey) != btcec.PubKeyBytesLenCompressed {
+		return fmt.Errorf("ValidateNodeAdvisory: Invalid signer public key length %d", len(msg.SignerPublicKey))
+	}
+	if _, exists := paramUpdaterPublicKeys[MakePkMapKey(msg.SignerPublicKey)]; !exists {
+		return fmt.Errorf("ValidateNodeAdvisory: Signer %v is not a param updater",
+			PkToStringBoth(msg.SignerPublicKey))
+	}
+	signerPublicKey, err := btcec.ParsePubKey(msg.SignerPublicKey, btcec.S256())
+	if err != nil {
+		return errors.Wrapf(err, "ValidateNodeAdvisory: Problem parsing signer public key: ")
+	}
+	signature, err := btcec.ParseDERSignature(msg.Signature, btcec.S256())
+	if err != nil {
+		return errors.Wrapf(err, "ValidateNodeAdvisory: Problem parsing signature: ")
+	}
+	hash, err := msg.Hash()
+	if err != nil {
+		return err
+	}
+	if !signature.Verify(hash[:], signerPublicKey) {
+		return fmt.Errorf("ValidateNodeAdvisory: Invalid signature")
+	}
+	return nil
+}
+
+// NodeAdvisoryPool holds the advisories a node has accepted until they expire.
+type NodeAdvisoryPool struct {
+	mtx        sync.RWMutex
+	advisories map[BlockHash]*MsgDeSoNodeAdvisory
+}
+
+func NewNodeAdvisoryPool() *NodeAdvisoryPool {
+	return &NodeAdvisoryPool{
+		advisories: make(map[BlockHash]*MsgDeSoNodeAdvisory),
+	}
+}
+
+// ProcessAdvisory validates an advisory and adds it to the pool. It returns true if
+// the advisory is new and should be relayed, and false if we've already seen it.
+func (pool *NodeAdvisoryPool) ProcessAdvisory(msg *MsgDeSoNodeAdvisory,
+	paramUpdaterPublicKeys map[PkMapKey]bool, now time.Time) (_isNew bool, _err error) {
+
+	hash, err := msg.Hash()
+	if err != nil {
+		return false, err
+	}
+
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	pool._pruneExpired(now)
+	if _, exists := pool.advisories[*hash]; exists {
+		return false, nil
+	}
+	if err = ValidateNodeAdvisory(msg, paramUpdaterPublicKeys, now); err != nil {
+		return false, err
+	}
+	if len(pool.advisories) >= MaxActiveNodeAdvisories {
+		return false, fmt.Errorf("NodeAdvisoryPool.ProcessAdvisory: Pool already holds the max "+
+			"of %d advisories", MaxActiveNodeAdvisories)
+	}
+	pool.advisories[*hash] = msg
+	return true, nil
+}
+
+// GetActiveAdvisories returns the unexpired advisories, most severe first and then
+// most recent first.
+func (pool *NodeAdvisoryPool) GetActiveAdvisories(now time.Time) []*MsgDeSoNodeAdvisory {
+	pool.mtx.RLock()
+	defer pool.mtx.RUnlock()
+
+	nowSecs := uint64(now.Unix())
+	activeAdvisories := []*MsgDeSoNodeAdvisory{}
+	for _, advisory := range pool.advisories {
+		if advisory.ExpirationTimestampSecs > nowSecs {
+			activeAdvisories = append(activeAdvisories, advisory)
+		}
+	}
+	sort.Slice(activeAdvisories, func(ii, jj int) bool {
+		if activeAdvisories[ii].Severity != activeAdvisories[jj].Severity {
+			return activeAdvisories[ii].Severity > activeAdvisories[jj].Severity
+		}
+		return activeAdvisories[ii].IssuedAtTimestampSecs > activeAdvisories[jj].IssuedAtTimestampSecs
+	})
+	return activeAdvisories
+}
+
+// _pruneExpired drops expired advisories. Once an advisory has expired it fails
+// validation, so we no longer need to remember it to reject replays.
+func (pool *NodeAdvisoryPool) _pruneExpired(now time.Time) {
+	nowSecs := uint64(now.Unix())
+	for hash, advisory := range pool.advisories {
+		if advisory.ExpirationTimestampSecs <= nowSecs {
+			delete(pool.advisories, hash)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ==================================================================
+// Server handlers
+// ==================================================================
+
+func (srv *Server) _handleNodeAdvisory(pp *Peer, msg *MsgDeSoNodeAdvisory) {
+	if msg.GetMsgType() != MsgTypeNodeAdvisory {
+		return
+	}
+	if err := srv.processAndRelayNodeAdvisory(msg, pp); err != nil {
+		glog.V(1).Infof("Server._handleNodeAdvisory: Ignoring advisory from peer %v: %v", pp, err)
+	}
+}
+
+// BroadcastNodeAdvisory adds a signed advisory to our pool and relays it to our peers.
+func (srv *Server) BroadcastNodeAdvisory(msg *MsgDeSoNodeAdvisory) error {
+	return srv.processAndRelayNodeAdvisory(msg, nil)
+}
+
+// GetActiveNodeAdvisories returns the unexpired advisories this node has accepted. It
+// is surfaced by the health API so operators see them.
+func (srv *Server) GetActiveNodeAdvisories() []*MsgDeSoNodeAdvisory {
+	if srv.nodeAdvisoryPool == nil {
+		return []*MsgDeSoNodeAdvisory{}
+	}
+	return srv.nodeAdvisoryPool.GetActiveAdvisories(time.Now())
+}
+
+func (srv *Server) processAndRelayNodeAdvisory(msg *MsgDeSoNodeAdvisory, sourcePeer *Peer) error {
+	if srv.nodeAdvisoryPool == nil {
+		return fmt.Errorf("Server.processAndRelayNodeAdvisory: Node advisory pool is nil")
+	}
+	paramUpdaterPublicKeys := GetParamUpdaterPublicKeys(srv.blockchain.BlockTip().Height, srv.params)
+	isNew, err := srv.nodeAdvisoryPool.ProcessAdvisory(msg, paramUpdaterPublicKeys, time.Now())
+	if err != nil {
+		return err
+	}
+	if !isNew {
+		return nil
+	}
+	glog.Warningf(CLog(Yellow, fmt.Sprintf("NODE ADVISORY: %v", msg)))
+
+	for _, rn := range srv.networkManager.GetAllRemoteNodes().GetAll() {
+		if sourcePeer != nil && rn.GetPeer() == sourcePeer {
+			continue
+		}
+		srv.sendNodeAdvisory(rn, msg)
+	}
+	return nil
+}
+
+// sendActiveNodeAdvisories sends all of our unexpired advisories to a newly connected peer.
+func (srv *Server) sendActiveNodeAdvisories(rn *RemoteNode) {
+	for _, advisory := range srv.GetActiveNodeAdvisories() {
+		srv.sendNodeAdvisory(rn, advisory)
+	}
+}
+
+func (srv *Server) sendNodeAdvisory(rn *RemoteNode, msg *MsgDeSoNodeAdvisory) {
+	// Older nodes don't recognize the advisory message type and would disconnect us
+	// for sending it, so only send it to peers that advertise support.
+	if rn == nil || !rn.IsHandshakeCompleted() || !rn.GetServiceFlag().HasService(SFNodeAdvisories) {
+		return
+	}
+	if err := rn.SendMessage(msg); err != nil {
+		glog.Errorf("Server.sendNodeAdvisory: Problem sending advisory to RemoteNode (id= %v): %v",
+			rn.GetId(), err)
+	}
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeAdvisory(t *testing.T) {
+	paramUpdaterPrivateKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	otherPrivateKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	paramUpdaterPublicKeys := map[PkMapKey]bool{
+		MakePkMapKey(paramUpdaterPrivateKey.PubKey().SerializeCompressed()): true,
+	}
+
+	now := time.Unix(1700000000, 0)
+	newAdvisory := func(severity NodeAdvisorySeverity, message string, lifetime time.Duration) *MsgDeSoNodeAdvisory {
+		return &MsgDeSoNodeAdvisory{
+			Severity:                severity,
+			Message:                 message,
+			Nonce:                   1,
+			IssuedAtTimestampSecs:   uint64(now.Unix()),
+			ExpirationTimestampSecs: uint64(now.Add(lifetime).Unix()),
+		}
+	}
+
+	// A signed advisory round-trips through the wire format.
+	advisory := newAdvisory(NodeAdvisorySeverityUrgent, "Upgrade before the next fork", 24*time.Hour)
+	require.NoError(t, advisory.Sign(paramUpdaterPrivateKey))
+	advisoryBytes, err := advisory.ToBytes(false)
+	require.NoError(t, err)
+	decodedAdvisory := NewMessage(MsgTypeNodeAdvisory).(*MsgDeSoNodeAdvisory)
+	require.NoError(t, decodedAdvisory.FromBytes(advisoryBytes))
+	require.Equal(t, advisory, decodedAdvisory)
+
+	// The first time we see an advisory it's new, and afterwards it's a no-op.
+	pool := NewNodeAdvisoryPool()
+	isNew, err := pool.ProcessAdvisory(decodedAdvisory, paramUpdaterPublicKeys, now)
+	require.NoError(t, err)
+	require.True(t, isNew)
+	isNew, err = pool.ProcessAdvisory(decodedAdvisory, paramUpdaterPublicKeys, now)
+	require.NoError(t, err)
+	require.False(t, isNew)
+
+	// Advisories signed by anyone other than a param updater are rejected.
+	unauthorizedAdvisory := newAdvisory(NodeAdvisorySeverityUrgent, "Unauthorized", time.Hour)
+	require.NoError(t, unauthorizedAdvisory.Sign(otherPrivateKey))
+	_, err = pool.ProcessAdvisory(unauthorizedAdvisory, paramUpdaterPublicKeys, now)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not a param updater")
+
+	// Tampering with a signed advisory invalidates its signature.
+	tamperedAdvisory := *advisory
+	tamperedAdvisory.Message = "Tampered"
+	_, err = pool.ProcessAdvisory(&tamperedAdvisory, paramUpdaterPublicKeys, now)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid signature")
+
+	// Advisories can't outlive MaxNodeAdvisoryLifetime.
+	longLivedAdvisory := newAdvisory(NodeAdvisorySeverityInfo, "Long lived", MaxNodeAdvisoryLifetime+time.Hour)
+	require.NoError(t, longLivedAdvisory.Sign(paramUpdaterPrivateKey))
+	_, err = pool.ProcessAdvisory(longLivedAdvisory, paramUpdaterPublicKeys, now)
+	require.Error(t, err)
+
+	// Active advisories are sorted by severity.
+	infoAdvisory := newAdvisory(NodeAdvisorySeverityInfo, "Check your config", time.Hour)
+	require.NoError(t, infoAdvisory.Sign(paramUpdaterPrivateKey))
+	isNew, err = pool.ProcessAdvisory(infoAdvisory, paramUpdaterPublicKeys, now)
+	require.NoError(t, err)
+	require.True(t, isNew)
+	activeAdvisories := pool.GetActiveAdvisories(now)
+	require.Len(t, activeAdvisories, 2)
+	require.Equal(t, NodeAdvisorySeverityUrgent, activeAdvisories[0].Severity)
+	require.Equal(t, NodeAdvisorySeverityInfo, activeAdvisories[1].Severity)
+
+	// Once an advisory expires it's no longer active, and replaying it is rejected.
+	later := now.Add(2 * time.Hour)
+	activeAdvisories = pool.GetActiveAdvisories(later)
+	require.Len(t, activeAdvisories, 1)
+	require.Equal(t, advisory.Message, activeAdvisories[0].Message)
+	_, err = pool.ProcessAdvisory(infoAdvisory, paramUpdaterPublicKeys, later)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expired")
+}
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -98,6 +100,10 @@ type NetworkManager struct {
 	// among other things.
 	limitOneInboundRemoteNodePerIP bool
 
+	// peerFilter restricts the RemoteNodes we connect to, and accept connections from, by IP address and
+	// validator public key. It allows every RemoteNode unless rules are set.
+	peerFilter *PeerFilter
+
 	// The frequency at which the NetworkManager goroutines should run.
 	peerConnectionRefreshInterval time.Duration
 
@@ -143,6 +149,7 @@ func NewNetworkManager(
 		targetNonValidatorOutboundRemoteNodes: targetNonValidatorOutboundRemoteNodes,
 		targetNonValidatorInboundRemoteNodes:  targetNonValidatorInboundRemoteNodes,
 		limitOneInboundRemoteNodePerIP:        limitOneInboundConnectionPerIP,
+		peerFilter:                            &PeerFilter{},
 		peerConnectionRefreshInterval:         time.Duration(peerConnectionRefreshIntervalMillis) * time.Millisecond,
 		exitChan:                              make(chan struct{}),
 	}
@@ -385,6 +392,18 @@ func (nm *NetworkManager) processInboundConnection(conn Connection) (*RemoteNode
 			"ConvertIPStringToNetAddress for addr: (%s)", ic.connection.RemoteAddr().String())
 	}
 
+	// Don't accept connections from IP addresses that the peer filter rules out.
+	if err := nm.peerFilter.CheckAddress(na.IP); err != nil {
+		return nil, errors.Wrapf(err, "NetworkManager.handleInboundConnection: Rejecting INBOUND peer (%s)",
+			ic.connection.RemoteAddr().String())
+	}
+
+	// Don't accept connections from peers that were banned for misbehaving.
+	if nm.cmgr.IsBannedIP(na.IP.String()) {
+		return nil, fmt.Errorf("NetworkManager.handleInboundConnection: Rejecting INBOUND peer (%s) "+
+			"due to it being banned", ic.connection.RemoteAddr().String())
+	}
+
 	remoteNode, err := nm.AttachInboundConnection(ic.connection, na)
 	if remoteNode == nil || err != nil {
 		return nil, errors.Wrapf(err, "NetworkManager.handleInboundConnection: Problem calling "+
@@ -420,6 +439,12 @@ func (nm *NetworkManager) processOutboundConnection(conn Connection) (*RemoteNod
 			"for addr: (%s)", oc.connection.RemoteAddr().String())
 	}
 
+	// The peer filter rules apply to persistent remote nodes and validators as well.
+	if err := nm.peerFilter.CheckAddress(na.IP); err != nil {
+		return nil, errors.Wrapf(err, "NetworkManager.handleOutboundConnection: Rejecting OUTBOUND peer (%s)",
+			oc.connection.RemoteAddr().String())
+	}
+
 	// Attach the connection before additional validation steps because it is already established.
 	remoteNode, err := nm.AttachOutboundConnection(oc.connection, na, oc.attemptId, oc.isPersistent)
 	if remoteNode == nil || err != nil {
@@ -435,6 +460,12 @@ func (nm *NetworkManager) processOutboundConnection(conn Connection) (*RemoteNod
 	// If we get here, it means we're dealing with a non-persistent or non-validator remote node. We perform additional
 	// connection validation.
 
+	// Don't connect to peers that were banned for misbehaving.
+	if nm.cmgr.IsBannedIP(oc.address.IP.String()) {
+		return nil, fmt.Errorf("NetworkManager.handleOutboundConnection: Rejecting OUTBOUND NON-PERSISTENT "+
+			"connection with banned peer (%s).", oc.address.IP.String())
+	}
+
 	// If the group key overlaps with another peer we're already connected to then abort mission. We only connect to
 	// one peer per IP group in order to prevent Sybil attacks.
 	if nm.cmgr.IsFromRedundantOutboundIPAddress(oc.address) {
@@ -806,6 +837,14 @@ func (nm *NetworkManager) getRandomUnconnectedAddress() *wire.NetAddress {
 			continue
 		}
 
+		if nm.cmgr.IsBannedIP(addr.NetAddress().IP.String()) {
+			continue
+		}
+
+		if nm.peerFilter.CheckAddress(addr.NetAddress().IP) != nil {
+			continue
+		}
+
 		// We can only have one outbound address per /16. This is similar to
 		// Bitcoin and we do it to prevent Sybil attacks.
 		if nm.cmgr.IsFromRedundantOutboundIPAddress(addr.NetAddress()) {
@@ -922,6 +961,40 @@ func (nm *NetworkManager) AttachOutboundConnection(
 	return remoteNode, nil
 }
 
+// ###########################
+// ## Peer Filter
+// ###########################
+
+// SetPeerFilterRules replaces the rules that restrict the RemoteNodes we connect to, and disconnects the
+// RemoteNodes that the new rules don't allow. See PeerFilter for the format of the rules.
+func (nm *NetworkManager) SetPeerFilterRules(allowRules []string, denyRules []string) error {
+	if err := nm.peerFilter.SetRules(allowRules, denyRules); err != nil {
+		return errors.Wrapf(err, "NetworkManager.SetPeerFilterRules: ")
+	}
+	for _, rn := range nm.GetAllRemoteNodes().GetAll() {
+		if err := nm.checkPeerFilter(rn); err != nil {
+			glog.Infof("NetworkManager.SetPeerFilterRules: Disconnecting remote node (id=%v): %v", rn.GetId(), err)
+			nm.Disconnect(rn, fmt.Sprintf("rejected by peer filter: %v", err))
+		}
+	}
+	return nil
+}
+
+// GetPeerFilterRules returns the rules that restrict the RemoteNodes we connect to.
+func (nm *NetworkManager) GetPeerFilterRules() (_allowRules []string, _denyRules []string) {
+	return nm.peerFilter.GetRules()
+}
+
+// checkPeerFilter checks a RemoteNode that completed the handshake against the peer filter rules. RemoteNodes
+// that haven't completed it yet are checked once they do.
+func (nm *NetworkManager) checkPeerFilter(rn *RemoteNode) error {
+	netAddr := rn.GetNetAddress()
+	if netAddr == nil {
+		return nil
+	}
+	return nm.peerFilter.CheckPeer(netAddr.IP, rn.GetValidatorPublicKey())
+}
+
 // ###########################
 // ## RemoteNode Management
 // ###########################
@@ -970,6 +1043,7 @@ func (nm *NetworkManager) ProcessCompletedHandshake(remoteNode *RemoteNode) {
 	}
 	nm.srv.HandleAcceptedPeer(remoteNode)
 	nm.srv.maybeRequestAddresses(remoteNode)
+	nm.srv.sendActiveNodeAdvisories(remoteNode)
 }
 
 func (nm *NetworkManager) Disconnect(rn *RemoteNode, disconnectReason string) {
@@ -1262,6 +1336,13 @@ func (nm *NetworkManager) handleHandshakeComplete(remoteNode *RemoteNode) {
 		return
 	}
 
+	// Now that we know the remote node's public key, check it against the peer filter rules.
+	if err := nm.checkPeerFilter(remoteNode); err != nil {
+		glog.V(1).Infof("NetworkManager.handleHandshakeComplete: %v", err)
+		nm.Disconnect(remoteNode, fmt.Sprintf("rejected by peer filter: %v", err))
+		return
+	}
+
 	if remoteNode.GetNegotiatedProtocolVersion().Before(ProtocolVersion2) {
 		nm.ProcessCompletedHandshake(remoteNode)
 		return
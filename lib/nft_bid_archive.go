@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// When an NFT is sold, all of the bids on it are deleted, so the only record of the bids that
+// competed with the winning one is in the txns themselves. Nodes can opt into keeping the
+// bids on each NFT in an archive when it's sold, so that marketplaces can show past bids and
+// price discovery without running their own indexer.
+//
+// The archive isn't consensus state. It's only kept by nodes that set NFTBidArchiveDepth,
+// it isn't hypersynced, and it only covers the sales connected since it was turned on.
+
+// NFTBidArchiveDepth is the number of bids to keep in the archive for each NFT. Once an NFT
+// has more archived bids than this, the bids from its oldest sales are pruned. It's set by the
+// node operator, and zero disables the archive.
+var NFTBidArchiveDepth uint64
+
+// NFTBidArchiveKey identifies a bid that was archived when an NFT was sold.
+type NFTBidArchiveKey struct {
+	// NFTKey is the NFT that was sold.
+	NFTKey            NFTKey
+	SoldAtBlockHeight uint64
+	BidderPKID        PKID
+	// BidSerialNumber is the serial number the bid was placed on. It's zero for a bid on
+	// any serial number of the post.
+	BidSerialNumber uint64
+}
+
+// ArchivedNFTBid is a bid on an NFT that was archived when the NFT was sold.
+type ArchivedNFTBid struct {
+	BidEntry          *NFTBidEntry
+	SoldAtBlockHeight uint64
+	// Accepted is true for the bid that won the NFT.
+	Accepted bool
+}
+
+// ==================================================================
+// DB
+// ==================================================================
+
+func _dbPrefixForArchivedNFTBids(nftPostHash *BlockHash, serialNumber uint64) []byte {
+	key := append([]byte{}, Prefixes.PrefixArchivedNFTBidByPostHashSerialNumber...)
+	key = append(key, nftPostHash[:]...)
+	key = append(key, EncodeUint64(serialNumber)...)
+	return key
+}
+
+func _dbKeyForArchivedNFTBid(archiveKey *NFTBidArchiveKey) []byte {
+	key := _dbPrefixForArchivedNFTBids(&archiveKey.NFTKey.NFTPostHash, archiveKey.NFTKey.SerialNumber)
+	key = append(key, EncodeUint64(archiveKey.SoldAtBlockHeight)...)
+	key = append(key, archiveKey.BidderPKID[:]...)
+	key = append(key, EncodeUint64(archiveKey.BidSerialNumber)...)
+	return key
+}
+
+func DBPutArchivedNFTBidWithTxn(txn *badger.Txn, archiveKey *NFTBidArchiveKey, bidEntry *NFTBidEntry) error {
+	if err := DBSetWithTxn(txn, nil, _dbKeyForArchivedNFTBid(archiveKey), EncodeToBytes(0, bidEntry), nil); err != nil {
+		return errors.Wrapf(err, "DBPutArchivedNFTBidWithTxn: Problem putting bid for post %v serial number %d",
+			&archiveKey.NFTKey.NFTPostHash, archiveKey.NFTKey.SerialNumber)
+	}
+	return nil
+}
+
+func DBDeleteArchivedNFTBidWithTxn(txn *badger.Txn, archiveKey *NFTBidArchiveKey) error {
+	if err := DBDeleteWithTxn(txn, nil, _dbKeyForArchivedNFTBid(archiveKey), nil, true); err != nil {
+		return errors.Wrapf(err, "DBDeleteArchivedNFTBidWithTxn: Problem deleting bid for post %v serial number %d",
+			&archiveKey.NFTKey.NFTPostHash, archiveKey.NFTKey.SerialNumber)
+	}
+	return nil
+}
+
+// DBPruneArchivedNFTBidsWithTxn deletes the bids from the oldest sales of the NFT until it
+// has at most maxBids archived bids.
+func DBPruneArchivedNFTBidsWithTxn(txn *badger.Txn, nftPostHash *BlockHash, serialNumber uint64, maxBids uint64) error {
+	// Keys are sorted by the height of the sale, so the oldest bids come first.
+	keysFound := _enumerateKeysOnlyForPrefixWithTxn(txn, _dbPrefixForArchivedNFTBids(nftPostHash, serialNumber))
+	for ii := 0; uint64(len(keysFound)-ii) > maxBids; ii++ {
+		if err := DBDeleteWithTxn(txn, nil, keysFound[ii], nil, true); err != nil {
+			return errors.Wrapf(err, "DBPruneArchivedNFTBidsWithTxn: Problem pruning bids for post %v "+
+				"serial number %d", nftPostHash, serialNumber)
+		}
+	}
+	return nil
+}
+
+// DBGetArchivedNFTBids returns the archived bids on an NFT, from the most recent sale to the
+// oldest.
+func DBGetArchivedNFTBids(handle *badger.DB, nftPostHash *BlockHash, serialNumber uint64) (
+	_archivedBids []*ArchivedNFTBid, _err error) {
+
+	prefix := _dbPrefixForArchivedNFTBids(nftPostHash, serialNumber)
+	keysFound, valsFound := _enumerateKeysForPrefix(handle, prefix, false)
+
+	var archivedBids []*ArchivedNFTBid
+	for ii := len(keysFound) - 1; ii >= 0; ii-- {
+		if len(keysFound[ii]) != len(prefix)+8+PublicKeyLenCompressed+8 {
+			return nil, fmt.Errorf("DBGetArchivedNFTBids: invalid key length %d", len(keysFound[ii]))
+		}
+		bidEntry := &NFTBidEntry{}
+		if exists, err := DecodeFromBytes(bidEntry, bytes.NewReader(valsFound[ii])); !exists || err != nil {
+			return nil, errors.Wrapf(err, "DBGetArchivedNFTBids: Problem decoding NFTBidEntry")
+		}
+		archivedBids = append(archivedBids, &ArchivedNFTBid{
+			BidEntry:          bidEntry,
+			SoldAtBlockHeight: DecodeUint64(keysFound[ii][len(prefix) : len(prefix)+8]),
+			Accepted:          bidEntry.AcceptedBlockHeight != nil,
+		})
+	}
+	return archivedBids, nil
+}
+
+// ==================================================================
+// UtxoView
+// ==================================================================
+
+// _archiveNFTBidEntries adds the bids that were deleted when an NFT was sold to the view's
+// archive. The winning bid is marked as accepted.
+func (bav *UtxoView) _archiveNFTBidEntries(nftKey NFTKey, blockHeight uint32, bidEntries []*NFTBidEntry,
+	winningBidderPKID *PKID) {
+
+	if NFTBidArchiveDepth == 0 {
+		return
+	}
+	for _, bidEntry := range bidEntries {
+		archivedBidEntry := bidEntry.Copy()
+		archivedBidEntry.isDeleted = false
+		archivedBidEntry.AcceptedBlockHeight = nil
+		if bidEntry.BidderPKID.Eq(winningBidderPKID) {
+			acceptedBlockHeight := blockHeight
+			archivedBidEntry.AcceptedBlockHeight = &acceptedBlockHeight
+		}
+		archiveKey := NFTBidArchiveKey{
+			NFTKey:            nftKey,
+			SoldAtBlockHeight: uint64(blockHeight),
+			BidderPKID:        *bidEntry.BidderPKID,
+			BidSerialNumber:   bidEntry.SerialNumber,
+		}
+		bav.NFTBidArchiveKeyToNFTBidEntry[archiveKey] = archivedBidEntry
+	}
+}
+
+// _unarchiveNFTBidEntries removes the bids archived by _archiveNFTBidEntries when the sale
+// of the NFT is disconnected.
+func (bav *UtxoView) _unarchiveNFTBidEntries(nftKey NFTKey, blockHeight uint32, bidEntries []*NFTBidEntry) {
+	if NFTBidArchiveDepth == 0 {
+		return
+	}
+	for _, bidEntry := range bidEntries {
+		archiveKey := NFTBidArchiveKey{
+			NFTKey:            nftKey,
+			SoldAtBlockHeight: uint64(blockHeight),
+			BidderPKID:        *bidEntry.BidderPKID,
+			BidSerialNumber:   bidEntry.SerialNumber,
+		}
+		tombstoneBidEntry := *bidEntry
+		tombstoneBidEntry.isDeleted = true
+		bav.NFTBidArchiveKeyToNFTBidEntry[archiveKey] = &tombstoneBidEntry
+	}
+}
+
+func (bav *UtxoView) _flushArchivedNFTBidsToDbWithTxn(txn *badger.Txn) error {
+	if NFTBidArchiveDepth == 0 {
+		return nil
+	}
+	nftKeysToPrune := make(map[NFTKey]bool)
+	for archiveKeyIter, bidEntry := range bav.NFTBidArchiveKeyToNFTBidEntry {
+		archiveKey := archiveKeyIter
+		if bidEntry.isDeleted {
+			if err := DBDeleteArchivedNFTBidWithTxn(txn, &archiveKey); err != nil {
+				return errors.Wrapf(err, "_flushArchivedNFTBidsToDbWithTxn: ")
+			}
+			continue
+		}
+		if err := DBPutArchivedNFTBidWithTxn(txn, &archiveKey, bidEntry); err != nil {
+			return errors.Wrapf(err, "_flushArchivedNFTBidsToDbWithTxn: ")
+		}
+		nftKeysToPrune[archiveKey.NFTKey] = true
+	}
+	for nftKeyIter := range nftKeysToPrune {
+		nftKey := nftKeyIter
+		if err := DBPruneArchivedNFTBidsWithTxn(
+			txn, &nftKey.NFTPostHash, nftKey.SerialNumber, NFTBidArchiveDepth); err != nil {
+			return errors.Wrapf(err, "_flushArchivedNFTBidsToDbWithTxn: ")
+		}
+	}
+	return nil
+}
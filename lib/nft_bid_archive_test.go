@@ -0,0 +1,220 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTBidArchive(t *testing.T) {
+	require := require.New(t)
+
+	// Keep at most four bids per NFT, so the second sale prunes all but one bid from the first.
+	prevNFTBidArchiveDepth := NFTBidArchiveDepth
+	NFTBidArchiveDepth = 4
+	defer func() {
+		NFTBidArchiveDepth = prevNFTBidArchiveDepth
+	}()
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	// Make m4 a paramUpdater for this test
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(m4PkBytes)] = true
+	params.BlockRewardMaturity = time.Second
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 4; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:           t,
+		chain:       chain,
+		params:      params,
+		db:          db,
+		mempool:     mempool,
+		miner:       miner,
+		savedHeight: chain.blockTip().Height + 1,
+	}
+
+	// Fund all the keys.
+	for _, publicKey := range []string{m0Pub, m1Pub, m2Pub, m3Pub, m4Pub} {
+		_registerOrTransferWithTestMeta(testMeta, "", senderPkString, publicKey, senderPrivString, 2000)
+	}
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+	m3PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m3PkBytes).PKID
+	m4PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m4PkBytes).PKID
+
+	// Set max copies to a non-zero value to activate NFTs.
+	_updateGlobalParamsEntryWithTestMeta(
+		testMeta,
+		10, /*FeeRateNanosPerKB*/
+		m4Pub,
+		m4Priv,
+		-1, -1, -1, -1,
+		1000, /*maxCopiesPerNFT*/
+	)
+
+	// m0 creates a profile and a post, and turns the post into an NFT.
+	_submitPostWithTestMeta(
+		testMeta,
+		10,                                 /*feeRateNanosPerKB*/
+		m0Pub,                              /*updaterPkBase58Check*/
+		m0Priv,                             /*updaterPrivBase58Check*/
+		[]byte{},                           /*postHashToModify*/
+		[]byte{},                           /*parentStakeID*/
+		&DeSoBodySchema{Body: "m0 post 1"}, /*body*/
+		[]byte{},
+		1502947011*1e9, /*tstampNanos*/
+		false /*isHidden*/)
+	post1Hash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	_updateProfileWithTestMeta(
+		testMeta,
+		10,            /*feeRateNanosPerKB*/
+		m0Pub,         /*updaterPkBase58Check*/
+		m0Priv,        /*updaterPrivBase58Check*/
+		[]byte{},      /*profilePubKey*/
+		"m0",          /*newUsername*/
+		"i am the m0", /*newDescription*/
+		shortPic,      /*newProfilePic*/
+		10*100,        /*newCreatorBasisPoints*/
+		1.25*100*100,  /*newStakeMultipleBasisPoints*/
+		false /*isHidden*/)
+	_createNFTWithTestMeta(
+		testMeta,
+		10, /*FeeRateNanosPerKB*/
+		m0Pub,
+		m0Priv,
+		post1Hash,
+		2,     /*NumCopies*/
+		false, /*HasUnlockable*/
+		true,  /*IsForSale*/
+		10,    /*MinBidAmountNanos*/
+		0,     /*nftFee*/
+		0,     /*nftRoyaltyToCreatorBasisPoints*/
+		0,     /*nftRoyaltyToCoinBasisPoints*/
+		false,
+		0,
+	)
+
+	type expectedBid struct {
+		bidderPKID        *PKID
+		bidAmountNanos    uint64
+		soldAtBlockHeight uint32
+		accepted          bool
+	}
+	requireArchivedBids := func(expectedBids []expectedBid) {
+		archivedBids, err := DBGetArchivedNFTBids(db, post1Hash, 1)
+		require.NoError(err)
+		require.Len(archivedBids, len(expectedBids))
+		for ii, expected := range expectedBids {
+			require.Equal(expected.bidderPKID, archivedBids[ii].BidEntry.BidderPKID)
+			require.Equal(expected.bidAmountNanos, archivedBids[ii].BidEntry.BidAmountNanos)
+			require.Equal(uint64(expected.soldAtBlockHeight), archivedBids[ii].SoldAtBlockHeight)
+			require.Equal(expected.accepted, archivedBids[ii].Accepted)
+		}
+		// Bids on the other serial number are never archived since it isn't sold.
+		archivedBids, err = DBGetArchivedNFTBids(db, post1Hash, 2)
+		require.NoError(err)
+		require.Empty(archivedBids)
+	}
+
+	// m1, m2, and m3 bid on serial number one, and m1 bids on serial number two.
+	_createNFTBidWithTestMeta(testMeta, 10, m1Pub, m1Priv, post1Hash, 1, 11)
+	_createNFTBidWithTestMeta(testMeta, 10, m2Pub, m2Priv, post1Hash, 1, 12)
+	_createNFTBidWithTestMeta(testMeta, 10, m3Pub, m3Priv, post1Hash, 1, 13)
+	_createNFTBidWithTestMeta(testMeta, 10, m1Pub, m1Priv, post1Hash, 2, 14)
+	requireArchivedBids(nil)
+
+	// m0 accepts m2's bid. Every bid on the serial number is archived, and only m2's is
+	// marked as accepted.
+	firstSaleHeight := chain.blockTip().Height + 1
+	_acceptNFTBidWithTestMeta(testMeta, 10, m0Pub, m0Priv, post1Hash, 1, m2Pub, 12, "")
+	firstSaleTxnIndex := len(testMeta.txns) - 1
+	require.Empty(DBGetNFTBidEntries(db, post1Hash, 1))
+	require.Len(DBGetNFTBidEntries(db, post1Hash, 2), 1)
+	firstSaleBids := []expectedBid{
+		{m1PKID, 11, firstSaleHeight, false},
+		{m2PKID, 12, firstSaleHeight, true},
+		{m3PKID, 13, firstSaleHeight, false},
+	}
+	// Bids from the same sale are returned by bidder PKID, from last to first.
+	sortExpectedBids := func(expectedBids []expectedBid) []expectedBid {
+		sort.Slice(expectedBids, func(ii, jj int) bool {
+			return bytes.Compare(expectedBids[ii].bidderPKID[:], expectedBids[jj].bidderPKID[:]) > 0
+		})
+		return expectedBids
+	}
+	firstSaleBids = sortExpectedBids(firstSaleBids)
+	requireArchivedBids(firstSaleBids)
+
+	// Mine a block so the second sale happens at a later height.
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+
+	// m2 puts the NFT back up for sale, and m1, m3, and m4 bid on it.
+	_updateNFTWithTestMeta(testMeta, 10, m2Pub, m2Priv, post1Hash, 1, true, 10, false, 0)
+	_createNFTBidWithTestMeta(testMeta, 10, m1Pub, m1Priv, post1Hash, 1, 21)
+	_createNFTBidWithTestMeta(testMeta, 10, m3Pub, m3Priv, post1Hash, 1, 22)
+	_createNFTBidWithTestMeta(testMeta, 10, m4Pub, m4Priv, post1Hash, 1, 23)
+	requireArchivedBids(firstSaleBids)
+
+	// m2 accepts m3's bid. The second sale's bids come first, and only the most recent of the
+	// first sale's bids is kept.
+	secondSaleHeight := chain.blockTip().Height + 1
+	require.Greater(secondSaleHeight, firstSaleHeight)
+	_acceptNFTBidWithTestMeta(testMeta, 10, m2Pub, m2Priv, post1Hash, 1, m3Pub, 22, "")
+	secondSaleTxn := testMeta.txns[len(testMeta.txns)-1]
+	secondSaleOps := testMeta.txnOps[len(testMeta.txnOps)-1]
+	require.Empty(DBGetNFTBidEntries(db, post1Hash, 1))
+	secondSaleBids := sortExpectedBids([]expectedBid{
+		{m1PKID, 21, secondSaleHeight, false},
+		{m3PKID, 22, secondSaleHeight, true},
+		{m4PKID, 23, secondSaleHeight, false},
+	})
+	requireArchivedBids(append(append([]expectedBid{}, secondSaleBids...), firstSaleBids[0]))
+
+	// Disconnecting the second sale restores its bids on the NFT and removes them from the
+	// archive. The first sale's bids that were pruned aren't restored.
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	require.NoError(utxoView.DisconnectTransaction(
+		secondSaleTxn, secondSaleTxn.Hash(), secondSaleOps, secondSaleHeight))
+	require.NoError(utxoView.FlushToDb(uint64(secondSaleHeight)))
+	bidEntries := DBGetNFTBidEntries(db, post1Hash, 1)
+	require.Len(bidEntries, 3)
+	for _, bidEntry := range bidEntries {
+		require.Nil(bidEntry.AcceptedBlockHeight)
+	}
+	requireArchivedBids(firstSaleBids[:1])
+
+	// Reconnecting it archives the bids again.
+	utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	_, _, _, _, err = utxoView.ConnectTransaction(
+		secondSaleTxn, secondSaleTxn.Hash(), secondSaleHeight, 0, true, false)
+	require.NoError(err)
+	require.NoError(utxoView.FlushToDb(uint64(secondSaleHeight)))
+	require.Empty(DBGetNFTBidEntries(db, post1Hash, 1))
+	requireArchivedBids(append(append([]expectedBid{}, secondSaleBids...), firstSaleBids[0]))
+
+	// Disconnecting everything back to the first sale leaves the archive empty.
+	utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	for ii := len(testMeta.txns) - 1; ii >= firstSaleTxnIndex; ii-- {
+		blockHeight := secondSaleHeight
+		if ii == firstSaleTxnIndex {
+			blockHeight = firstSaleHeight
+		}
+		txn := testMeta.txns[ii]
+		require.NoError(utxoView.DisconnectTransaction(txn, txn.Hash(), testMeta.txnOps[ii], blockHeight))
+	}
+	require.NoError(utxoView.FlushToDb(uint64(secondSaleHeight)))
+	require.Len(DBGetNFTBidEntries(db, post1Hash, 1), 3)
+	requireArchivedBids(nil)
+}
@@ -0,0 +1,365 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Exchanges crediting deposits and other services that follow the chain currently have to poll
+// the node to find out about new blocks. The NotificationServer pushes them instead. It streams
+// a notification for every block that's connected to, disconnected from, or committed on the
+// best chain, and for every txn accepted into the mempool.
+//
+// Subscribers connect with a GET on RoutePathNotifications and get the notifications as
+// server-sent events, which any HTTP client can read. The optional "kinds" query parameter is
+// a comma-separated list of the NotificationKinds to subscribe to, e.g.
+// ?kinds=BLOCK_COMMITTED,MEMPOOL_TXN, and it defaults to all of them. Each event's data is a
+// ChainNotification encoded as JSON.
+//
+// A reorg shows up as a BLOCK_DISCONNECTED notification for each block that leaves the best
+// chain, newest first, followed by a BLOCK_CONNECTED notification for each block that joins
+// it. A subscriber that falls more than the buffer size behind is disconnected rather than
+// allowed to hold up the node. It should catch up with Blockchain.GetBlocksInRange and
+// resubscribe.
+
+const RoutePathNotifications = "/api/v0/notifications"
+
+const (
+	DefaultNotificationSubscriptionBufferSize = 1000
+
+	// notificationKeepaliveInterval is how often we send a comment to idle subscribers, so that
+	// proxies don't time out their connections.
+	notificationKeepaliveInterval = 15 * time.Second
+)
+
+type NotificationKind uint8
+
+const (
+	NotificationKindBlockConnected    NotificationKind = 1
+	NotificationKindBlockDisconnected NotificationKind = 2
+	NotificationKindBlockCommitted    NotificationKind = 3
+	NotificationKindMempoolTxn        NotificationKind = 4
+)
+
+var allNotificationKinds = []NotificationKind{NotificationKindBlockConnected,
+	NotificationKindBlockDisconnected, NotificationKindBlockCommitted, NotificationKindMempoolTxn}
+
+func (kind NotificationKind) String() string {
+	switch kind {
+	case NotificationKindBlockConnected:
+		return "BLOCK_CONNECTED"
+	case NotificationKindBlockDisconnected:
+		return "BLOCK_DISCONNECTED"
+	case NotificationKindBlockCommitted:
+		return "BLOCK_COMMITTED"
+	case NotificationKindMempoolTxn:
+		return "MEMPOOL_TXN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseNotificationKinds parses a comma-separated list of NotificationKinds.
+func ParseNotificationKinds(kindsStr string) ([]NotificationKind, error) {
+	var kinds []NotificationKind
+	for _, kindStr := range strings.Split(kindsStr, ",") {
+		kindStr = strings.ToUpper(strings.TrimSpace(kindStr))
+		if kindStr == "" {
+			continue
+		}
+		exists := false
+		for _, kind := range allNotificationKinds {
+			if kind.String() == kindStr {
+				kinds = append(kinds, kind)
+				exists = true
+			}
+		}
+		if !exists {
+			return nil, fmt.Errorf("ParseNotificationKinds: Unknown notification kind %v, must be "+
+				"one of %v", kindStr, allNotificationKinds)
+		}
+	}
+	return kinds, nil
+}
+
+// ChainNotification is a single notification sent to subscribers.
+type ChainNotification struct {
+	Kind string
+	// SequenceNumber increases by one with every notification a subscription gets, so a
+	// subscriber can tell whether it missed any.
+	SequenceNumber uint64
+
+	// The block's header fields. They're set for block notifications.
+	BlockHashHex     string
+	PrevBlockHashHex string
+	BlockHeight      uint64
+	TstampNanoSecs   int64
+	NumTxns          uint64
+
+	// The txn's hash and type. They're set for mempool notifications.
+	TxnHashHex string
+	TxnType    string
+}
+
+type NotificationSubscription struct {
+	// Notifications is closed when the subscription ends, either because the subscriber fell
+	// behind or because the server stopped.
+	Notifications chan *ChainNotification
+
+	kinds          map[NotificationKind]bool
+	sequenceNumber uint64
+	id             uint64
+}
+
+type NotificationServer struct {
+	listenAddress string
+	bufferSize    int
+
+	mtx                sync.Mutex
+	subscriptions      map[uint64]*NotificationSubscription
+	nextSubscriptionID uint64
+	stopped            bool
+
+	httpServer *http.Server
+	waitGroup  sync.WaitGroup
+}
+
+// NewNotificationServer creates a NotificationServer that listens on the address once it's
+// started. The address can be empty if the server's Handler is served by another HTTP server.
+func NewNotificationServer(listenAddress string, bufferSize int) *NotificationServer {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	ns := &NotificationServer{
+		listenAddress: listenAddress,
+		bufferSize:    bufferSize,
+		subscriptions: make(map[uint64]*NotificationSubscription),
+	}
+	ns.httpServer = &http.Server{Handler: ns.Handler()}
+	return ns
+}
+
+// Handler returns the handler for RoutePathNotifications, for embedding the NotificationServer
+// in another HTTP server.
+func (ns *NotificationServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(RoutePathNotifications, ns._handleNotifications)
+	return mux
+}
+
+func (ns *NotificationServer) Start() error {
+	if ns.listenAddress == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", ns.listenAddress)
+	if err != nil {
+		return errors.Wrapf(err, "NotificationServer.Start: Problem listening on %v", ns.listenAddress)
+	}
+	glog.Infof("NotificationServer.Start: Serving notifications on %v%v",
+		listener.Addr(), RoutePathNotifications)
+
+	ns.waitGroup.Add(1)
+	go func() {
+		defer ns.waitGroup.Done()
+		if err := ns.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("NotificationServer: Problem serving notifications: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (ns *NotificationServer) Stop() {
+	ns.mtx.Lock()
+	ns.stopped = true
+	for _, subscription := range ns.subscriptions {
+		ns._removeSubscription(subscription)
+	}
+	ns.mtx.Unlock()
+
+	// Subscribers hold their connections open, so close them rather than waiting for them.
+	if err := ns.httpServer.Close(); err != nil {
+		glog.Errorf("NotificationServer.Stop: Problem closing the HTTP server: %v", err)
+	}
+	ns.waitGroup.Wait()
+}
+
+// Subscribe returns a subscription to the given kinds of notifications, or to all of them if
+// none are given. If the subscriber falls behind by more than the buffer size, its channel is
+// closed.
+func (ns *NotificationServer) Subscribe(kinds []NotificationKind) (*NotificationSubscription, error) {
+	if len(kinds) == 0 {
+		kinds = allNotificationKinds
+	}
+
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+
+	if ns.stopped {
+		return nil, errors.New("NotificationServer.Subscribe: Server is stopped")
+	}
+	ns.nextSubscriptionID++
+	subscription := &NotificationSubscription{
+		Notifications: make(chan *ChainNotification, ns.bufferSize),
+		kinds:         make(map[NotificationKind]bool),
+		id:            ns.nextSubscriptionID,
+	}
+	for _, kind := range kinds {
+		subscription.kinds[kind] = true
+	}
+	ns.subscriptions[subscription.id] = subscription
+	return subscription, nil
+}
+
+func (ns *NotificationServer) Unsubscribe(subscription *NotificationSubscription) {
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+
+	ns._removeSubscription(subscription)
+}
+
+func (ns *NotificationServer) _removeSubscription(subscription *NotificationSubscription) {
+	if _, exists := ns.subscriptions[subscription.id]; !exists {
+		return
+	}
+	delete(ns.subscriptions, subscription.id)
+	close(subscription.Notifications)
+}
+
+// _publish sends the notification to every subscription for its kind. It never blocks, so
+// it's safe to call while holding the ChainLock.
+func (ns *NotificationServer) _publish(kind NotificationKind, notification *ChainNotification) {
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+
+	notification.Kind = kind.String()
+	for _, subscription := range ns.subscriptions {
+		if !subscription.kinds[kind] {
+			continue
+		}
+		subscriptionNotification := *notification
+		subscriptionNotification.SequenceNumber = subscription.sequenceNumber
+		select {
+		case subscription.Notifications <- &subscriptionNotification:
+			subscription.sequenceNumber++
+		default:
+			glog.V(1).Infof("NotificationServer._publish: Dropping subscription %v that fell behind",
+				subscription.id)
+			ns._removeSubscription(subscription)
+		}
+	}
+}
+
+func (ns *NotificationServer) _publishBlock(kind NotificationKind, block *MsgDeSoBlock) {
+	if block == nil || block.Header == nil {
+		return
+	}
+	blockHash, err := block.Hash()
+	if err != nil {
+		glog.Errorf("NotificationServer._publishBlock: Problem hashing block: %v", err)
+		return
+	}
+	notification := &ChainNotification{
+		BlockHashHex:   blockHash.String(),
+		BlockHeight:    block.Header.Height,
+		TstampNanoSecs: block.Header.TstampNanoSecs,
+		NumTxns:        uint64(len(block.Txns)),
+	}
+	if block.Header.PrevBlockHash != nil {
+		notification.PrevBlockHashHex = block.Header.PrevBlockHash.String()
+	}
+	ns._publish(kind, notification)
+}
+
+// HandleBlockConnected is registered with the EventManager for connected blocks.
+func (ns *NotificationServer) HandleBlockConnected(event *BlockEvent) {
+	ns._publishBlock(NotificationKindBlockConnected, event.Block)
+}
+
+// HandleBlockDisconnected is registered with the EventManager for disconnected blocks.
+func (ns *NotificationServer) HandleBlockDisconnected(event *BlockEvent) {
+	ns._publishBlock(NotificationKindBlockDisconnected, event.Block)
+}
+
+// HandleBlockCommitted is registered with the EventManager for committed blocks.
+func (ns *NotificationServer) HandleBlockCommitted(event *BlockEvent) {
+	ns._publishBlock(NotificationKindBlockCommitted, event.Block)
+}
+
+// HandleTransactionEvent is registered with the TransactionEventBus. Only txns accepted into
+// the mempool are published, since connected txns are covered by the block notifications.
+func (ns *NotificationServer) HandleTransactionEvent(event *TypedTransactionEvent) {
+	if event.Kind != TransactionEventKindMempoolAccepted {
+		return
+	}
+	ns._publish(NotificationKindMempoolTxn, &ChainNotification{
+		TxnHashHex: event.TxnHash.String(),
+		TxnType:    event.TxnType.String(),
+	})
+}
+
+func (ns *NotificationServer) _handleNotifications(ww http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(ww, "Notifications must be requested with GET", http.StatusMethodNotAllowed)
+		return
+	}
+	kinds, err := ParseNotificationKinds(req.URL.Query().Get("kinds"))
+	if err != nil {
+		http.Error(ww, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := ww.(http.Flusher)
+	if !ok {
+		http.Error(ww, "Streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+	subscription, err := ns.Subscribe(kinds)
+	if err != nil {
+		http.Error(ww, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer ns.Unsubscribe(subscription)
+
+	ww.Header().Set("Content-Type", "text/event-stream")
+	ww.Header().Set("Cache-Control", "no-cache")
+	ww.Header().Set("Connection", "keep-alive")
+	ww.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepaliveTicker := time.NewTicker(notificationKeepaliveInterval)
+	defer keepaliveTicker.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+
+		case <-keepaliveTicker.C:
+			if _, err := fmt.Fprint(ww, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case notification, open := <-subscription.Notifications:
+			if !open {
+				return
+			}
+			notificationBytes, err := json.Marshal(notification)
+			if err != nil {
+				glog.Errorf("NotificationServer: Problem encoding notification: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(ww, "id: %d\nevent: %s\ndata: %s\n\n", notification.SequenceNumber,
+				notification.Kind, notificationBytes); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationServer(t *testing.T) {
+	require := require.New(t)
+
+	ns := NewNotificationServer("", 2)
+	header := *expectedBlockHeaderVersion1
+	block := &MsgDeSoBlock{Header: &header, Txns: []*MsgDeSoTxn{{TxnMeta: &BlockRewardMetadataa{}}}}
+	blockHash, err := block.Hash()
+	require.NoError(err)
+	txn := &MsgDeSoTxn{PublicKey: RandomBytes(33), TxnMeta: &BasicTransferMetadata{}}
+
+	// Subscribers only get the kinds of notifications they asked for.
+	kinds, err := ParseNotificationKinds("block_disconnected, MEMPOOL_TXN")
+	require.NoError(err)
+	_, err = ParseNotificationKinds("BLOCK_CONNECTED,BLOCKS")
+	require.Error(err)
+	subscription, err := ns.Subscribe(kinds)
+	require.NoError(err)
+	allSubscription, err := ns.Subscribe(nil)
+	require.NoError(err)
+
+	ns.HandleBlockConnected(&BlockEvent{Block: block})
+	ns.HandleTransactionEvent(&TypedTransactionEvent{
+		Kind: TransactionEventKindConnected, Txn: txn, TxnHash: txn.Hash(), TxnType: TxnTypeBasicTransfer})
+	ns.HandleTransactionEvent(&TypedTransactionEvent{
+		Kind: TransactionEventKindMempoolAccepted, Txn: txn, TxnHash: txn.Hash(), TxnType: TxnTypeBasicTransfer})
+
+	notification := <-subscription.Notifications
+	require.Equal(&ChainNotification{
+		Kind:       "MEMPOOL_TXN",
+		TxnHashHex: txn.Hash().String(),
+		TxnType:    TxnTypeBasicTransfer.String(),
+	}, notification)
+
+	notification = <-allSubscription.Notifications
+	require.Equal("BLOCK_CONNECTED", notification.Kind)
+	require.Equal(blockHash.String(), notification.BlockHashHex)
+	require.Equal(header.PrevBlockHash.String(), notification.PrevBlockHashHex)
+	require.Equal(header.Height, notification.BlockHeight)
+	require.Equal(uint64(1), notification.NumTxns)
+	notification = <-allSubscription.Notifications
+	require.Equal("MEMPOOL_TXN", notification.Kind)
+	require.Equal(uint64(1), notification.SequenceNumber)
+
+	// A subscriber that falls behind by more than the buffer size is dropped.
+	ns.Unsubscribe(allSubscription)
+	for ii := 0; ii < 3; ii++ {
+		ns.HandleBlockDisconnected(&BlockEvent{Block: block})
+	}
+	require.Len(subscription.Notifications, 2)
+	<-subscription.Notifications
+	<-subscription.Notifications
+	_, open := <-subscription.Notifications
+	require.False(open)
+	ns.Unsubscribe(subscription)
+
+	// Notifications are streamed over HTTP as server-sent events.
+	httpServer := httptest.NewServer(ns.Handler())
+	defer httpServer.Close()
+	resp, err := http.Get(httpServer.URL + RoutePathNotifications + "?kinds=BLOCK_COMMITTED")
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	ns.HandleBlockCommitted(&BlockEvent{Block: block})
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(err)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	require.Equal("id: 0", lines[0])
+	require.Equal("event: BLOCK_COMMITTED", lines[1])
+	streamedNotification := &ChainNotification{}
+	require.NoError(json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), streamedNotification))
+	require.Equal(blockHash.String(), streamedNotification.BlockHashHex)
+
+	badResp, err := http.Get(httpServer.URL + RoutePathNotifications + "?kinds=UNKNOWN")
+	require.NoError(err)
+	badResp.Body.Close()
+	require.Equal(http.StatusBadRequest, badResp.StatusCode)
+
+	// Stopping the server ends every subscription.
+	lastSubscription, err := ns.Subscribe(nil)
+	require.NoError(err)
+	ns.Stop()
+	_, open = <-lastSubscription.Notifications
+	require.False(open)
+	_, err = ns.Subscribe(nil)
+	require.Error(err)
+}
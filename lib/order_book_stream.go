@@ -0,0 +1,440 @@
+package lib
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// The OrderBookDiffStream lets trading UIs maintain live order books without polling
+// GetAllDAOCoinLimitOrdersForThisDAOCoinPair. A subscriber first receives a snapshot of
+// the book for a trading pair, followed by incremental diffs. Books are recomputed from
+// the mempool's augmented view whenever a block is connected or disconnected or a DAO
+// coin limit order enters the mempool, and diffed against the previous book. This way
+// reorgs, mempool evictions, and expired orders are handled the same way as new orders.
+
+const DefaultOrderBookSubscriptionBufferSize = 100
+
+type OrderBookUpdateType uint8
+
+const (
+	OrderBookUpdateTypeAdd    OrderBookUpdateType = 1
+	OrderBookUpdateTypeModify OrderBookUpdateType = 2
+	OrderBookUpdateTypeRemove OrderBookUpdateType = 3
+)
+
+func (updateType OrderBookUpdateType) String() string {
+	switch updateType {
+	case OrderBookUpdateTypeAdd:
+		return "ADD"
+	case OrderBookUpdateTypeModify:
+		return "MODIFY"
+	case OrderBookUpdateTypeRemove:
+		return "REMOVE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// OrderBookPair identifies a trading pair. The book for a pair contains the orders on
+// both sides, so the pair is the same regardless of the order the coins are given in.
+type OrderBookPair struct {
+	CoinAPKID PKID
+	CoinBPKID PKID
+}
+
+func NewOrderBookPair(coin1PKID *PKID, coin2PKID *PKID) OrderBookPair {
+	if bytes.Compare(coin1PKID[:], coin2PKID[:]) > 0 {
+		coin1PKID, coin2PKID = coin2PKID, coin1PKID
+	}
+	return OrderBookPair{CoinAPKID: *coin1PKID, CoinBPKID: *coin2PKID}
+}
+
+// OrderBookOrderUpdate describes a change to a single order. For removals, Order is the
+// order as it was last seen.
+type OrderBookOrderUpdate struct {
+	UpdateType OrderBookUpdateType
+	Order      *DAOCoinLimitOrderEntry
+}
+
+// OrderBookPriceLevel aggregates the orders on one side of a book at one exchange rate.
+// A price level update with NumOrders equal to zero means the level was removed.
+type OrderBookPriceLevel struct {
+	BuyingDAOCoinCreatorPKID                  *PKID
+	SellingDAOCoinCreatorPKID                 *PKID
+	ScaledExchangeRateCoinsToSellPerCoinToBuy *uint256.Int
+	TotalBaseUnitsToBuy                       *uint256.Int
+	TotalBaseUnitsToSell                      *uint256.Int
+	NumOrders                                 uint64
+}
+
+func (level *OrderBookPriceLevel) eq(other *OrderBookPriceLevel) bool {
+	return level.NumOrders == other.NumOrders &&
+		level.TotalBaseUnitsToBuy.Eq(other.TotalBaseUnitsToBuy) &&
+		level.TotalBaseUnitsToSell.Eq(other.TotalBaseUnitsToSell)
+}
+
+type orderBookPriceLevelKey struct {
+	BuyingDAOCoinCreatorPKID                  PKID
+	ScaledExchangeRateCoinsToSellPerCoinToBuy [32]byte
+}
+
+// OrderBookDiff is a single message on an OrderBookSubscription.
+type OrderBookDiff struct {
+	Pair OrderBookPair
+	// SequenceNumber increases by one with every diff for a pair. A subscriber that
+	// sees a gap, or whose channel is closed, should resubscribe to get a fresh snapshot.
+	SequenceNumber uint64
+	// IsSnapshot is set on the first message of a subscription, which adds every order
+	// and price level currently in the book.
+	IsSnapshot bool
+	// BlockHeight is the height of the next block at the time the book was computed.
+	BlockHeight       uint32
+	OrderUpdates      []*OrderBookOrderUpdate
+	PriceLevelUpdates []*OrderBookPriceLevel
+}
+
+type OrderBookSubscription struct {
+	Pair    OrderBookPair
+	Updates chan *OrderBookDiff
+
+	id uint64
+}
+
+// orderBook is the last computed book for a pair along with its subscriptions.
+type orderBook struct {
+	orders         map[BlockHash]*DAOCoinLimitOrderEntry
+	priceLevels    map[orderBookPriceLevelKey]*OrderBookPriceLevel
+	blockHeight    uint32
+	sequenceNumber uint64
+	subscriptions  map[uint64]*OrderBookSubscription
+}
+
+// OrderBookViewFunc returns a view to compute order books from, along with the height
+// of the next block, which is used to filter out expired orders.
+type OrderBookViewFunc func() (_utxoView *UtxoView, _blockHeight uint32, _err error)
+
+type OrderBookDiffStream struct {
+	getView    OrderBookViewFunc
+	bufferSize int
+
+	mtx                sync.Mutex
+	books              map[OrderBookPair]*orderBook
+	nextSubscriptionID uint64
+
+	refreshChannel chan struct{}
+	stopChannel    chan struct{}
+	waitGroup      sync.WaitGroup
+}
+
+func NewOrderBookDiffStream(getView OrderBookViewFunc, bufferSize int) *OrderBookDiffStream {
+	// Subscriptions need room for at least their snapshot.
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &OrderBookDiffStream{
+		getView:        getView,
+		bufferSize:     bufferSize,
+		books:          make(map[OrderBookPair]*orderBook),
+		refreshChannel: make(chan struct{}, 1),
+		stopChannel:    make(chan struct{}),
+	}
+}
+
+func (obs *OrderBookDiffStream) Start() {
+	obs.waitGroup.Add(1)
+	go func() {
+		defer obs.waitGroup.Done()
+		for {
+			select {
+			case <-obs.stopChannel:
+				return
+			case <-obs.refreshChannel:
+				obs.Refresh()
+			}
+		}
+	}()
+}
+
+func (obs *OrderBookDiffStream) Stop() {
+	close(obs.stopChannel)
+	obs.waitGroup.Wait()
+
+	obs.mtx.Lock()
+	defer obs.mtx.Unlock()
+	for pair, book := range obs.books {
+		for _, subscription := range book.subscriptions {
+			close(subscription.Updates)
+		}
+		delete(obs.books, pair)
+	}
+}
+
+// Notify schedules a refresh of every subscribed book. It never blocks, so it's safe
+// to call while holding the ChainLock.
+func (obs *OrderBookDiffStream) Notify() {
+	select {
+	case obs.refreshChannel <- struct{}{}:
+	default:
+	}
+}
+
+// HandleBlockEvent is registered with the EventManager for connected and disconnected blocks.
+func (obs *OrderBookDiffStream) HandleBlockEvent(event *BlockEvent) {
+	obs.Notify()
+}
+
+// NotifyTransaction should be called whenever a txn is added to the mempool. Only DAO
+// coin limit orders and batches of them can change a book, so other txns are ignored.
+func (obs *OrderBookDiffStream) NotifyTransaction(txn *MsgDeSoTxn) {
+	if txn.TxnMeta != nil && (txn.TxnMeta.GetTxnType() == TxnTypeDAOCoinLimitOrder ||
+		txn.TxnMeta.GetTxnType() == TxnTypeDAOCoinLimitOrderBatch) {
+		obs.Notify()
+	}
+}
+
+// Subscribe returns a subscription to the book for the pair of coins. Its first message
+// is a snapshot of the current book. If the subscriber falls behind by more than the
+// buffer size, its channel is closed.
+func (obs *OrderBookDiffStream) Subscribe(coin1PKID *PKID, coin2PKID *PKID) (*OrderBookSubscription, error) {
+	if coin1PKID == nil || coin2PKID == nil {
+		return nil, errors.New("OrderBookDiffStream.Subscribe: Called with nil coin PKID")
+	}
+	if coin1PKID.Eq(coin2PKID) {
+		return nil, errors.New("OrderBookDiffStream.Subscribe: Coins in a pair must be different")
+	}
+	pair := NewOrderBookPair(coin1PKID, coin2PKID)
+
+	obs.mtx.Lock()
+	defer obs.mtx.Unlock()
+
+	book, exists := obs.books[pair]
+	if !exists {
+		utxoView, blockHeight, err := obs.getView()
+		if err != nil {
+			return nil, errors.Wrapf(err, "OrderBookDiffStream.Subscribe: Problem getting view: ")
+		}
+		book, err = computeOrderBook(utxoView, pair, blockHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "OrderBookDiffStream.Subscribe: ")
+		}
+		obs.books[pair] = book
+	}
+
+	obs.nextSubscriptionID++
+	subscription := &OrderBookSubscription{
+		Pair:    pair,
+		Updates: make(chan *OrderBookDiff, obs.bufferSize),
+		id:      obs.nextSubscriptionID,
+	}
+	book.subscriptions[subscription.id] = subscription
+
+	// The snapshot diffs the book against an empty one.
+	emptyBook := &orderBook{
+		orders:      make(map[BlockHash]*DAOCoinLimitOrderEntry),
+		priceLevels: make(map[orderBookPriceLevelKey]*OrderBookPriceLevel),
+	}
+	snapshot := diffOrderBooks(pair, emptyBook, book)
+	snapshot.SequenceNumber = book.sequenceNumber
+	snapshot.IsSnapshot = true
+	subscription.Updates <- snapshot
+
+	return subscription, nil
+}
+
+func (obs *OrderBookDiffStream) Unsubscribe(subscription *OrderBookSubscription) {
+	obs.mtx.Lock()
+	defer obs.mtx.Unlock()
+
+	obs._removeSubscription(subscription)
+}
+
+func (obs *OrderBookDiffStream) _removeSubscription(subscription *OrderBookSubscription) {
+	book, exists := obs.books[subscription.Pair]
+	if !exists {
+		return
+	}
+	if _, exists = book.subscriptions[subscription.id]; !exists {
+		return
+	}
+	delete(book.subscriptions, subscription.id)
+	close(subscription.Updates)
+
+	// Stop tracking books nobody is subscribed to.
+	if len(book.subscriptions) == 0 {
+		delete(obs.books, subscription.Pair)
+	}
+}
+
+// Refresh recomputes every subscribed book and publishes a diff for each one that changed.
+func (obs *OrderBookDiffStream) Refresh() {
+	obs.mtx.Lock()
+	defer obs.mtx.Unlock()
+
+	if len(obs.books) == 0 {
+		return
+	}
+	utxoView, blockHeight, err := obs.getView()
+	if err != nil {
+		glog.Errorf("OrderBookDiffStream.Refresh: Problem getting view: %v", err)
+		return
+	}
+
+	for pair, prevBook := range obs.books {
+		newBook, err := computeOrderBook(utxoView, pair, blockHeight)
+		if err != nil {
+			glog.Errorf("OrderBookDiffStream.Refresh: Problem computing book for pair %v: %v", pair, err)
+			continue
+		}
+		diff := diffOrderBooks(pair, prevBook, newBook)
+		newBook.sequenceNumber = prevBook.sequenceNumber
+		newBook.subscriptions = prevBook.subscriptions
+		obs.books[pair] = newBook
+		if len(diff.OrderUpdates) == 0 && len(diff.PriceLevelUpdates) == 0 {
+			continue
+		}
+
+		newBook.sequenceNumber++
+		diff.SequenceNumber = newBook.sequenceNumber
+		for _, subscription := range newBook.subscriptions {
+			select {
+			case subscription.Updates <- diff:
+			default:
+				glog.V(1).Infof("OrderBookDiffStream.Refresh: Dropping subscription %d "+
+					"to pair %v because it fell behind", subscription.id, pair)
+				obs._removeSubscription(subscription)
+			}
+		}
+	}
+}
+
+// computeOrderBook fetches both sides of the book for the pair from the view.
+func computeOrderBook(utxoView *UtxoView, pair OrderBookPair, blockHeight uint32) (*orderBook, error) {
+	book := &orderBook{
+		orders:        make(map[BlockHash]*DAOCoinLimitOrderEntry),
+		priceLevels:   make(map[orderBookPriceLevelKey]*OrderBookPriceLevel),
+		blockHeight:   blockHeight,
+		subscriptions: make(map[uint64]*OrderBookSubscription),
+	}
+	coinAPKID, coinBPKID := pair.CoinAPKID, pair.CoinBPKID
+	for _, side := range [][2]*PKID{{&coinAPKID, &coinBPKID}, {&coinBPKID, &coinAPKID}} {
+		orders, err := utxoView.GetAllDAOCoinLimitOrdersForThisDAOCoinPair(side[0], side[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "computeOrderBook: Problem getting orders: ")
+		}
+		// Dormant stop-limit orders aren't matchable, so they aren't part of the book's depth.
+		lastTradePrice, err := utxoView.GetDAOCoinLastTradePrice(side[0], side[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "computeOrderBook: Problem getting last trade price: ")
+		}
+		for _, order := range FilterExpiredDAOCoinLimitOrders(orders, blockHeight) {
+			if order.IsDormantStopOrder(lastTradePrice) {
+				continue
+			}
+			baseUnitsToBuy, err := order.BaseUnitsToBuyUint256()
+			if err != nil {
+				return nil, errors.Wrapf(err, "computeOrderBook: Problem computing base units to buy: ")
+			}
+			baseUnitsToSell, err := order.BaseUnitsToSellUint256()
+			if err != nil {
+				return nil, errors.Wrapf(err, "computeOrderBook: Problem computing base units to sell: ")
+			}
+
+			book.orders[*order.OrderID] = order.Copy()
+			levelKey := orderBookPriceLevelKey{
+				BuyingDAOCoinCreatorPKID:                  *order.BuyingDAOCoinCreatorPKID,
+				ScaledExchangeRateCoinsToSellPerCoinToBuy: order.ScaledExchangeRateCoinsToSellPerCoinToBuy.Bytes32(),
+			}
+			level, exists := book.priceLevels[levelKey]
+			if !exists {
+				level = &OrderBookPriceLevel{
+					BuyingDAOCoinCreatorPKID:                  order.BuyingDAOCoinCreatorPKID.NewPKID(),
+					SellingDAOCoinCreatorPKID:                 order.SellingDAOCoinCreatorPKID.NewPKID(),
+					ScaledExchangeRateCoinsToSellPerCoinToBuy: order.ScaledExchangeRateCoinsToSellPerCoinToBuy.Clone(),
+					TotalBaseUnitsToBuy:                       uint256.NewInt(),
+					TotalBaseUnitsToSell:                      uint256.NewInt(),
+				}
+				book.priceLevels[levelKey] = level
+			}
+			if level.TotalBaseUnitsToBuy.AddOverflow(level.TotalBaseUnitsToBuy, baseUnitsToBuy) {
+				return nil, errors.New("computeOrderBook: Overflow computing total base units to buy")
+			}
+			if level.TotalBaseUnitsToSell.AddOverflow(level.TotalBaseUnitsToSell, baseUnitsToSell) {
+				return nil, errors.New("computeOrderBook: Overflow computing total base units to sell")
+			}
+			level.NumOrders++
+		}
+	}
+	return book, nil
+}
+
+// diffOrderBooks returns the updates that turn prevBook into newBook. Updates are sorted
+// so that every subscriber sees the same diff.
+func diffOrderBooks(pair OrderBookPair, prevBook *orderBook, newBook *orderBook) *OrderBookDiff {
+	diff := &OrderBookDiff{
+		Pair:              pair,
+		BlockHeight:       newBook.blockHeight,
+		OrderUpdates:      []*OrderBookOrderUpdate{},
+		PriceLevelUpdates: []*OrderBookPriceLevel{},
+	}
+
+	for orderID, newOrder := range newBook.orders {
+		prevOrder, exists := prevBook.orders[orderID]
+		if !exists {
+			diff.OrderUpdates = append(diff.OrderUpdates, &OrderBookOrderUpdate{
+				UpdateType: OrderBookUpdateTypeAdd,
+				Order:      newOrder,
+			})
+		} else if !prevOrder.QuantityToFillInBaseUnits.Eq(newOrder.QuantityToFillInBaseUnits) {
+			diff.OrderUpdates = append(diff.OrderUpdates, &OrderBookOrderUpdate{
+				UpdateType: OrderBookUpdateTypeModify,
+				Order:      newOrder,
+			})
+		}
+	}
+	for orderID, prevOrder := range prevBook.orders {
+		if _, exists := newBook.orders[orderID]; !exists {
+			diff.OrderUpdates = append(diff.OrderUpdates, &OrderBookOrderUpdate{
+				UpdateType: OrderBookUpdateTypeRemove,
+				Order:      prevOrder,
+			})
+		}
+	}
+	sort.Slice(diff.OrderUpdates, func(ii, jj int) bool {
+		return bytes.Compare(diff.OrderUpdates[ii].Order.OrderID[:], diff.OrderUpdates[jj].Order.OrderID[:]) < 0
+	})
+
+	for levelKey, newLevel := range newBook.priceLevels {
+		if prevLevel, exists := prevBook.priceLevels[levelKey]; !exists || !prevLevel.eq(newLevel) {
+			diff.PriceLevelUpdates = append(diff.PriceLevelUpdates, newLevel)
+		}
+	}
+	for levelKey, prevLevel := range prevBook.priceLevels {
+		if _, exists := newBook.priceLevels[levelKey]; !exists {
+			diff.PriceLevelUpdates = append(diff.PriceLevelUpdates, &OrderBookPriceLevel{
+				BuyingDAOCoinCreatorPKID:                  prevLevel.BuyingDAOCoinCreatorPKID,
+				SellingDAOCoinCreatorPKID:                 prevLevel.SellingDAOCoinCreatorPKID,
+				ScaledExchangeRateCoinsToSellPerCoinToBuy: prevLevel.ScaledExchangeRateCoinsToSellPerCoinToBuy,
+				TotalBaseUnitsToBuy:                       uint256.NewInt(),
+				TotalBaseUnitsToSell:                      uint256.NewInt(),
+				NumOrders:                                 0,
+			})
+		}
+	}
+	// Sort by side, then by best exchange rate first.
+	sort.Slice(diff.PriceLevelUpdates, func(ii, jj int) bool {
+		levelII, levelJJ := diff.PriceLevelUpdates[ii], diff.PriceLevelUpdates[jj]
+		if sideCmp := bytes.Compare(
+			levelII.BuyingDAOCoinCreatorPKID[:], levelJJ.BuyingDAOCoinCreatorPKID[:]); sideCmp != 0 {
+			return sideCmp < 0
+		}
+		return levelII.ScaledExchangeRateCoinsToSellPerCoinToBuy.Gt(
+			levelJJ.ScaledExchangeRateCoinsToSellPerCoinToBuy)
+	})
+
+	return diff
+}
@@ -0,0 +1,95 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderBookDiffStream(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	// The db has no best chain, so give the view a tip that CopyUtxoView can copy.
+	utxoView.TipHash = &BlockHash{}
+	blockHeight := uint32(100)
+	stream := NewOrderBookDiffStream(func() (*UtxoView, uint32, error) {
+		return utxoView.CopyUtxoView(), blockHeight, nil
+	}, 1)
+
+	daoCoinPKID := NewPKID(m0PkBytes)
+	newBid := func(orderID uint64, quantity uint64) *DAOCoinLimitOrderEntry {
+		return &DAOCoinLimitOrderEntry{
+			OrderID:                   NewBlockHash(uint256.NewInt().SetUint64(orderID).Bytes()),
+			TransactorPKID:            NewPKID(m1PkBytes),
+			BuyingDAOCoinCreatorPKID:  daoCoinPKID,
+			SellingDAOCoinCreatorPKID: &ZeroPKID,
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: OneE38.Clone(),
+			QuantityToFillInBaseUnits:                 uint256.NewInt().SetUint64(quantity),
+			OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+			BlockHeight:                               blockHeight,
+		}
+	}
+	bid1 := newBid(1, 100)
+	bid2 := newBid(2, 50)
+	utxoView._setDAOCoinLimitOrderEntryMappings(bid1)
+	utxoView._setDAOCoinLimitOrderEntryMappings(bid2)
+
+	// The first message is a snapshot with both orders aggregated into one price level.
+	subscription, err := stream.Subscribe(&ZeroPKID, daoCoinPKID)
+	require.NoError(err)
+	snapshot := <-subscription.Updates
+	require.True(snapshot.IsSnapshot)
+	require.Len(snapshot.OrderUpdates, 2)
+	require.Equal(OrderBookUpdateTypeAdd, snapshot.OrderUpdates[0].UpdateType)
+	require.Len(snapshot.PriceLevelUpdates, 1)
+	require.Equal(uint64(2), snapshot.PriceLevelUpdates[0].NumOrders)
+	require.Equal(uint64(150), snapshot.PriceLevelUpdates[0].TotalBaseUnitsToBuy.Uint64())
+
+	// Refreshing an unchanged book doesn't publish anything.
+	stream.Refresh()
+	require.Len(subscription.Updates, 0)
+
+	// A partially filled order is a modification.
+	partiallyFilledBid1 := bid1.Copy()
+	partiallyFilledBid1.QuantityToFillInBaseUnits = uint256.NewInt().SetUint64(40)
+	utxoView._setDAOCoinLimitOrderEntryMappings(partiallyFilledBid1)
+	stream.Refresh()
+	diff := <-subscription.Updates
+	require.False(diff.IsSnapshot)
+	require.Equal(snapshot.SequenceNumber+1, diff.SequenceNumber)
+	require.Len(diff.OrderUpdates, 1)
+	require.Equal(OrderBookUpdateTypeModify, diff.OrderUpdates[0].UpdateType)
+	require.Len(diff.PriceLevelUpdates, 1)
+	require.Equal(uint64(90), diff.PriceLevelUpdates[0].TotalBaseUnitsToBuy.Uint64())
+
+	// Expired and deleted orders are removed, along with their empty price level.
+	bid2.ExpirationBlockHeight = 101
+	utxoView._deleteDAOCoinLimitOrderEntryMappings(partiallyFilledBid1)
+	blockHeight = 101
+	stream.Refresh()
+	diff = <-subscription.Updates
+	require.Equal(snapshot.SequenceNumber+2, diff.SequenceNumber)
+	require.Len(diff.OrderUpdates, 2)
+	require.Equal(OrderBookUpdateTypeRemove, diff.OrderUpdates[0].UpdateType)
+	require.Equal(OrderBookUpdateTypeRemove, diff.OrderUpdates[1].UpdateType)
+	require.Len(diff.PriceLevelUpdates, 1)
+	require.Zero(diff.PriceLevelUpdates[0].NumOrders)
+
+	// Subscribers that fall behind are dropped.
+	utxoView._setDAOCoinLimitOrderEntryMappings(newBid(3, 10))
+	stream.Refresh()
+	utxoView._setDAOCoinLimitOrderEntryMappings(newBid(4, 10))
+	stream.Refresh()
+	<-subscription.Updates
+	_, isOpen := <-subscription.Updates
+	require.False(isOpen)
+	require.Empty(stream.books)
+}
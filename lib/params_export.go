@@ -0,0 +1,504 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// params_export.go produces a machine-readable JSON description of a network's
+// DeSoParams and genesis state. The output is generated directly from the params
+// compiled into the node so that auditors and alternative implementations have a
+// single source of truth, rather than having to re-derive constants from Go code.
+//
+// Every export is validated against the hand-written JSON schemas in
+// params_export_schema.go. The schemas are strict: every field is required and no
+// additional properties are allowed, so a change to the export structs that isn't
+// also made to the published schema is caught before the JSON is returned.
+//
+// Every DeSoParams field is exported except the ones in ParamsExportExcludedFields,
+// which only configure the local node rather than the network's consensus rules.
+
+// ParamsExportSchemaVersion is bumped whenever the shape of ExportedParams or
+// ExportedGenesisState changes in a way that consumers need to know about.
+const ParamsExportSchemaVersion = uint64(2)
+
+// ParamsExportExcludedFields lists the DeSoParams fields that ExportParams and
+// ExportGenesisState leave out, along with the reason for leaving each one out.
+var ParamsExportExcludedFields = map[string]string{
+	"ExtraRegtestParamUpdaterKeys":                 "only used on regtest networks",
+	"DNSSeedGenerators":                            "node-local peer discovery",
+	"BitcoinBtcdParams":                            "Bitcoin network params, not DeSo params",
+	"BitcoinStartBlockNode":                        "node-local Bitcoin header sync",
+	"BitcoinDoubleSpendWaitSeconds":                "node-local mempool policy",
+	"ServerMessageChannelSize":                     "node-local networking",
+	"DialTimeout":                                  "node-local networking",
+	"VersionNegotiationTimeout":                    "node-local networking",
+	"VerackNegotiationTimeout":                     "node-local networking",
+	"MaxAddressesToBroadcast":                      "node-local networking",
+	"HandshakeTimeoutMicroSeconds":                 "node-local networking",
+	"DisableNetworkManagerRoutines":                "node-local networking",
+	"MaxTipAgePoW":                                 "node-local sync policy",
+	"MaxTipAgePoS":                                 "node-local sync policy",
+	"MaxFetchBlocks":                               "node-local sync policy",
+	"MinerMaxBlockSizeBytes":                       "node-local mining policy",
+	"MiningIterationsPerCycle":                     "node-local mining policy",
+	"FastHotStuffConsensusTransitionCheckDuration": "node-local consensus polling",
+	"GenesisBlock":                                 "identified by GenesisBlockHashHex",
+	"EncoderMigrationHeights":                      "exported as EncoderMigrations",
+}
+
+type ExportedForkHeight struct {
+	Name   string
+	Height uint64
+}
+
+type ExportedEncoderMigration struct {
+	Name    string
+	Height  uint64
+	Version uint64
+}
+
+type ExportedFeeParams struct {
+	BitcoinExchangeFeeBasisPoints         uint64
+	CreatorCoinTradeFeeBasisPoints        uint64
+	CreatorCoinAutoSellThresholdNanos     uint64
+	StakeFeeBasisPoints                   uint64
+	MaxStakeMultipleBasisPoints           uint64
+	MaxCreatorBasisPoints                 uint64
+	MaxNFTRoyaltyBasisPoints              uint64
+	DefaultFeeBucketGrowthRateBasisPoints uint64
+	DefaultStakingRewardsAPYBasisPoints   uint64
+
+	DefaultMempoolFeeEstimatorNumMempoolBlocks            uint64
+	DefaultMempoolFeeEstimatorNumPastBlocks               uint64
+	DefaultMempoolCongestionFactorBasisPoints             uint64
+	DefaultMempoolPastBlocksCongestionFactorBasisPoints   uint64
+	DefaultMempoolPriorityPercentileBasisPoints           uint64
+	DefaultMempoolPastBlocksPriorityPercentileBasisPoints uint64
+}
+
+type ExportedPoSParams struct {
+	DefaultStakeLockupEpochDuration                       uint64
+	DefaultValidatorJailEpochDuration                     uint64
+	DefaultLeaderScheduleMaxNumValidators                 uint64
+	DefaultValidatorSetMaxNumValidators                   uint64
+	DefaultStakingRewardsMaxNumStakes                     uint64
+	DefaultEpochDurationNumBlocks                         uint64
+	DefaultJailInactiveValidatorGracePeriodEpochs         uint64
+	DefaultJailMissedSlotsThreshold                       uint64
+	DefaultValidatorSlashBasisPoints                      uint64
+	DefaultBlockTimestampDriftNanoSecs                    int64
+	MaxBlockTimestampDriftNanoSecs                        int64
+	MedianTimePastNumBlocks                               uint64
+	DefaultMaximumVestedIntersectionsPerLockupTransaction uint64
+	DefaultMempoolMaxSizeBytes                            uint64
+	DefaultExchangeRateFeedMaxAgeBlocks                   uint64
+	DefaultExchangeRateFeedMaxDeviationBasisPoints        uint64
+	DefaultExchangeRateFeedMinSubmissions                 uint64
+	DefaultMaxBlockSizeBytesPoS                           uint64
+	DefaultSoftMaxBlockSizeBytesPoS                       uint64
+	DefaultMaxTxnSizeBytesPoS                             uint64
+	DefaultBlockProductionIntervalMillisecondsPoS         uint64
+	DefaultTimeoutIntervalMillisecondsPoS                 uint64
+}
+
+type ExportedParams struct {
+	SchemaVersion uint64
+	NetworkType   string
+
+	ProtocolVersion    uint64
+	MinProtocolVersion uint64
+	UserAgent          string
+	DNSSeeds           []string
+	DefaultSocketPort  uint64
+	DefaultJSONPort    uint64
+
+	GenesisBlockHashHex    string
+	Base58PrefixPublicKey  string
+	Base58PrefixPrivateKey string
+	BitcoinBurnAddress     string
+
+	// All durations are expressed in nanoseconds.
+	TimeBetweenBlocksNanos              int64
+	TimeBetweenDifficultyRetargetsNanos int64
+	BlockRewardMaturityNanos            int64
+	MinDifficultyTargetHex              string
+	MinChainWorkHex                     string
+	MaxDifficultyRetargetFactor         int64
+	V1DifficultyAdjustmentFactor        int64
+	MaxTstampOffsetSeconds              uint64
+	MaxBlockSizeBytesPoW                uint64
+	DefaultPoWSnapshotBlockHeightPeriod uint64
+
+	MaxUsernameLengthBytes        uint64
+	MaxUserDescriptionLengthBytes uint64
+	MaxProfilePicLengthBytes      uint64
+	MaxProfilePicDimensions       uint64
+	MaxPrivateMessageLengthBytes  uint64
+	MaxNewMessageLengthBytes      uint64
+	MaxPostBodyLengthBytes        uint64
+	MaxPostSubLengthBytes         uint64
+
+	// The creator coin bonding curve parameters are exported as decimal strings so
+	// that no precision is lost.
+	CreatorCoinSlope        string
+	CreatorCoinReserveRatio string
+
+	Fees ExportedFeeParams
+	PoS  ExportedPoSParams
+
+	// ForkHeights is ordered by height and then by name so that the output is
+	// deterministic across runs.
+	ForkHeights       []ExportedForkHeight
+	EncoderMigrations []ExportedEncoderMigration
+}
+
+type ExportedSeedBalance struct {
+	PublicKeyBase58Check string
+	AmountNanos          uint64
+}
+
+type ExportedGenesisState struct {
+	SchemaVersion uint64
+	NetworkType   string
+
+	GenesisBlockHashHex         string
+	DeSoNanosPurchasedAtGenesis uint64
+
+	SeedBalances           []ExportedSeedBalance
+	TotalSeedBalancesNanos uint64
+
+	// SeedTxnHashesHex lists the hashes of the seed txns, in the order in which
+	// they are applied on top of the genesis block.
+	SeedTxnHashesHex []string
+}
+
+// ExportParams returns the schema-validated JSON encoding of the given params.
+func ExportParams(params *DeSoParams) ([]byte, error) {
+	exported, err := BuildExportedParams(params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ExportParams: ")
+	}
+	return _marshalAndValidateExport(exported, ExportedParamsSchemaJSON)
+}
+
+// ExportGenesisState returns the schema-validated JSON encoding of the genesis
+// balances and seed txns for the given params.
+func ExportGenesisState(params *DeSoParams) ([]byte, error) {
+	exported, err := BuildExportedGenesisState(params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ExportGenesisState: ")
+	}
+	return _marshalAndValidateExport(exported, ExportedGenesisStateSchemaJSON)
+}
+
+// ExportParamsSchema returns the JSON schema that ExportParams output conforms to.
+func ExportParamsSchema() []byte {
+	return []byte(ExportedParamsSchemaJSON)
+}
+
+// ExportGenesisStateSchema returns the JSON schema that ExportGenesisState output
+// conforms to.
+func ExportGenesisStateSchema() []byte {
+	return []byte(ExportedGenesisStateSchemaJSON)
+}
+
+func BuildExportedParams(params *DeSoParams) (*ExportedParams, error) {
+	if params == nil {
+		return nil, fmt.Errorf("BuildExportedParams: params cannot be nil")
+	}
+
+	exported := &ExportedParams{
+		SchemaVersion: ParamsExportSchemaVersion,
+		NetworkType:   params.NetworkType.String(),
+
+		ProtocolVersion:    uint64(params.ProtocolVersion),
+		MinProtocolVersion: params.MinProtocolVersion,
+		UserAgent:          params.UserAgent,
+		DNSSeeds:           append([]string{}, params.DNSSeeds...),
+		DefaultSocketPort:  uint64(params.DefaultSocketPort),
+		DefaultJSONPort:    uint64(params.DefaultJSONPort),
+
+		GenesisBlockHashHex:    params.GenesisBlockHashHex,
+		Base58PrefixPublicKey:  hex.EncodeToString(params.Base58PrefixPublicKey[:]),
+		Base58PrefixPrivateKey: hex.EncodeToString(params.Base58PrefixPrivateKey[:]),
+		BitcoinBurnAddress:     params.BitcoinBurnAddress,
+
+		TimeBetweenBlocksNanos:              params.TimeBetweenBlocks.Nanoseconds(),
+		TimeBetweenDifficultyRetargetsNanos: params.TimeBetweenDifficultyRetargets.Nanoseconds(),
+		BlockRewardMaturityNanos:            params.BlockRewardMaturity.Nanoseconds(),
+		MinDifficultyTargetHex:              params.MinDifficultyTargetHex,
+		MinChainWorkHex:                     params.MinChainWorkHex,
+		MaxDifficultyRetargetFactor:         params.MaxDifficultyRetargetFactor,
+		V1DifficultyAdjustmentFactor:        params.V1DifficultyAdjustmentFactor,
+		MaxTstampOffsetSeconds:              params.MaxTstampOffsetSeconds,
+		MaxBlockSizeBytesPoW:                params.MaxBlockSizeBytesPoW,
+		DefaultPoWSnapshotBlockHeightPeriod: params.DefaultPoWSnapshotBlockHeightPeriod,
+
+		MaxUsernameLengthBytes:        params.MaxUsernameLengthBytes,
+		MaxUserDescriptionLengthBytes: params.MaxUserDescriptionLengthBytes,
+		MaxProfilePicLengthBytes:      params.MaxProfilePicLengthBytes,
+		MaxProfilePicDimensions:       params.MaxProfilePicDimensions,
+		MaxPrivateMessageLengthBytes:  params.MaxPrivateMessageLengthBytes,
+		MaxNewMessageLengthBytes:      params.MaxNewMessageLengthBytes,
+		MaxPostBodyLengthBytes:        params.MaxPostBodyLengthBytes,
+		MaxPostSubLengthBytes:         params.MaxPostSubLengthBytes,
+
+		CreatorCoinSlope:        _exportBigFloat(params.CreatorCoinSlope),
+		CreatorCoinReserveRatio: _exportBigFloat(params.CreatorCoinReserveRatio),
+
+		Fees: ExportedFeeParams{
+			BitcoinExchangeFeeBasisPoints:         params.BitcoinExchangeFeeBasisPoints,
+			CreatorCoinTradeFeeBasisPoints:        params.CreatorCoinTradeFeeBasisPoints,
+			CreatorCoinAutoSellThresholdNanos:     params.CreatorCoinAutoSellThresholdNanos,
+			StakeFeeBasisPoints:                   params.StakeFeeBasisPoints,
+			MaxStakeMultipleBasisPoints:           params.MaxStakeMultipleBasisPoints,
+			MaxCreatorBasisPoints:                 params.MaxCreatorBasisPoints,
+			MaxNFTRoyaltyBasisPoints:              params.MaxNFTRoyaltyBasisPoints,
+			DefaultFeeBucketGrowthRateBasisPoints: params.DefaultFeeBucketGrowthRateBasisPoints,
+			DefaultStakingRewardsAPYBasisPoints:   params.DefaultStakingRewardsAPYBasisPoints,
+
+			DefaultMempoolFeeEstimatorNumMempoolBlocks:            params.DefaultMempoolFeeEstimatorNumMempoolBlocks,
+			DefaultMempoolFeeEstimatorNumPastBlocks:               params.DefaultMempoolFeeEstimatorNumPastBlocks,
+			DefaultMempoolCongestionFactorBasisPoints:             params.DefaultMempoolCongestionFactorBasisPoints,
+			DefaultMempoolPastBlocksCongestionFactorBasisPoints:   params.DefaultMempoolPastBlocksCongestionFactorBasisPoints,
+			DefaultMempoolPriorityPercentileBasisPoints:           params.DefaultMempoolPriorityPercentileBasisPoints,
+			DefaultMempoolPastBlocksPriorityPercentileBasisPoints: params.DefaultMempoolPastBlocksPriorityPercentileBasisPoints,
+		},
+		PoS: ExportedPoSParams{
+			DefaultStakeLockupEpochDuration:               params.DefaultStakeLockupEpochDuration,
+			DefaultValidatorJailEpochDuration:             params.DefaultValidatorJailEpochDuration,
+			DefaultLeaderScheduleMaxNumValidators:         params.DefaultLeaderScheduleMaxNumValidators,
+			DefaultValidatorSetMaxNumValidators:           params.DefaultValidatorSetMaxNumValidators,
+			DefaultStakingRewardsMaxNumStakes:             params.DefaultStakingRewardsMaxNumStakes,
+			DefaultEpochDurationNumBlocks:                 params.DefaultEpochDurationNumBlocks,
+			DefaultJailInactiveValidatorGracePeriodEpochs: params.DefaultJailInactiveValidatorGracePeriodEpochs,
+			DefaultJailMissedSlotsThreshold:               params.DefaultJailMissedSlotsThreshold,
+			DefaultValidatorSlashBasisPoints:              params.DefaultValidatorSlashBasisPoints,
+			DefaultBlockTimestampDriftNanoSecs:            params.DefaultBlockTimestampDriftNanoSecs,
+			MaxBlockTimestampDriftNanoSecs:                params.MaxBlockTimestampDriftNanoSecs,
+			MedianTimePastNumBlocks:                       uint64(params.MedianTimePastNumBlocks),
+			DefaultMaximumVestedIntersectionsPerLockupTransaction: uint64(
+				params.DefaultMaximumVestedIntersectionsPerLockupTransaction),
+			DefaultMempoolMaxSizeBytes:                     params.DefaultMempoolMaxSizeBytes,
+			DefaultExchangeRateFeedMaxAgeBlocks:            params.DefaultExchangeRateFeedMaxAgeBlocks,
+			DefaultExchangeRateFeedMaxDeviationBasisPoints: params.DefaultExchangeRateFeedMaxDeviationBasisPoints,
+			DefaultExchangeRateFeedMinSubmissions:          params.DefaultExchangeRateFeedMinSubmissions,
+			DefaultMaxBlockSizeBytesPoS:                    params.DefaultMaxBlockSizeBytesPoS,
+			DefaultSoftMaxBlockSizeBytesPoS:                params.DefaultSoftMaxBlockSizeBytesPoS,
+			DefaultMaxTxnSizeBytesPoS:                      params.DefaultMaxTxnSizeBytesPoS,
+			DefaultBlockProductionIntervalMillisecondsPoS:  params.DefaultBlockProductionIntervalMillisecondsPoS,
+			DefaultTimeoutIntervalMillisecondsPoS:          params.DefaultTimeoutIntervalMillisecondsPoS,
+		},
+	}
+	if exported.DNSSeeds == nil {
+		exported.DNSSeeds = []string{}
+	}
+
+	// Fork heights are read via reflection so that newly-added forks are exported
+	// without anyone having to remember to update this file.
+	forkHeightsValue := reflect.ValueOf(params.ForkHeights)
+	forkHeightsType := forkHeightsValue.Type()
+	exported.ForkHeights = []ExportedForkHeight{}
+	for ii := 0; ii < forkHeightsType.NumField(); ii++ {
+		field := forkHeightsValue.Field(ii)
+		var height uint64
+		switch field.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			height = field.Uint()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if field.Int() < 0 {
+				return nil, fmt.Errorf("BuildExportedParams: Negative fork height %v for %v",
+					field.Int(), forkHeightsType.Field(ii).Name)
+			}
+			height = uint64(field.Int())
+		default:
+			return nil, fmt.Errorf("BuildExportedParams: Unsupported fork height type %v for %v",
+				field.Kind(), forkHeightsType.Field(ii).Name)
+		}
+		exported.ForkHeights = append(exported.ForkHeights, ExportedForkHeight{
+			Name:   forkHeightsType.Field(ii).Name,
+			Height: height,
+		})
+	}
+	sort.SliceStable(exported.ForkHeights, func(ii, jj int) bool {
+		if exported.ForkHeights[ii].Height != exported.ForkHeights[jj].Height {
+			return exported.ForkHeights[ii].Height < exported.ForkHeights[jj].Height
+		}
+		return exported.ForkHeights[ii].Name < exported.ForkHeights[jj].Name
+	})
+
+	exported.EncoderMigrations = []ExportedEncoderMigration{}
+	for _, migration := range params.EncoderMigrationHeightsList {
+		exported.EncoderMigrations = append(exported.EncoderMigrations, ExportedEncoderMigration{
+			Name:    string(migration.Name),
+			Height:  migration.Height,
+			Version: uint64(migration.Version),
+		})
+	}
+
+	return exported, nil
+}
+
+// GetNextScheduledFork returns the first fork above blockHeight, or nil if no fork is
+// scheduled. Forks set to MaxUint32 aren't scheduled yet and are skipped.
+func GetNextScheduledFork(params *DeSoParams, blockHeight uint64) (*ExportedForkHeight, error) {
+	exported, err := BuildExportedParams(params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetNextScheduledFork: Problem exporting params: ")
+	}
+	// BuildExportedParams returns the fork heights sorted by height.
+	for _, forkHeight := range exported.ForkHeights {
+		if forkHeight.Height > blockHeight && forkHeight.Height < math.MaxUint32 {
+			return &forkHeight, nil
+		}
+	}
+	return nil, nil
+}
+
+func BuildExportedGenesisState(params *DeSoParams) (*ExportedGenesisState, error) {
+	if params == nil {
+		return nil, fmt.Errorf("BuildExportedGenesisState: params cannot be nil")
+	}
+
+	exported := &ExportedGenesisState{
+		SchemaVersion:               ParamsExportSchemaVersion,
+		NetworkType:                 params.NetworkType.String(),
+		GenesisBlockHashHex:         params.GenesisBlockHashHex,
+		DeSoNanosPurchasedAtGenesis: params.DeSoNanosPurchasedAtGenesis,
+		SeedBalances:                []ExportedSeedBalance{},
+		SeedTxnHashesHex:            []string{},
+	}
+
+	for index, seedBalance := range params.SeedBalances {
+		if seedBalance == nil {
+			return nil, fmt.Errorf("BuildExportedGenesisState: Nil seed balance at index %v", index)
+		}
+		total, err := SafeUint64().Add(exported.TotalSeedBalancesNanos, seedBalance.AmountNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "BuildExportedGenesisState: Seed balance total overflows at index %v", index)
+		}
+		exported.TotalSeedBalancesNanos = total
+		exported.SeedBalances = append(exported.SeedBalances, ExportedSeedBalance{
+			PublicKeyBase58Check: PkToString(seedBalance.PublicKey, params),
+			AmountNanos:          seedBalance.AmountNanos,
+		})
+	}
+
+	// Decode the seed txns exactly the way InitDbWithDeSoGenesisBlock does so the
+	// hashes reported here match the ones that end up in the chain.
+	for txnIndex, txnHex := range params.SeedTxns {
+		txnBytes, err := hex.DecodeString(txnHex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "BuildExportedGenesisState: Error decoding seed txn HEX at index %v", txnIndex)
+		}
+		txn := &MsgDeSoTxn{}
+		if err := txn.FromBytes(txnBytes); err != nil {
+			return nil, errors.Wrapf(err, "BuildExportedGenesisState: Error decoding seed txn BYTES at index %v", txnIndex)
+		}
+		exported.SeedTxnHashesHex = append(exported.SeedTxnHashesHex, hex.EncodeToString(txn.Hash()[:]))
+	}
+
+	return exported, nil
+}
+
+// _exportBigFloat returns the shortest decimal string that represents the value
+// exactly, or an empty string if the value isn't set.
+func _exportBigFloat(value *big.Float) string {
+	if value == nil {
+		return ""
+	}
+	return value.Text('g', -1)
+}
+
+// ValidateAgainstExportSchema checks a decoded JSON value against a decoded JSON
+// schema. Only the keywords used by the schemas in params_export_schema.go are
+// supported.
+func ValidateAgainstExportSchema(schema map[string]interface{}, value interface{}, path string) error {
+	schemaType, _ := schema["type"].(string)
+	switch schemaType {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("ValidateAgainstExportSchema: %v: expected object", path)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, exists := obj[fmt.Sprint(name)]; !exists {
+				return fmt.Errorf("ValidateAgainstExportSchema: %v: missing required field %v", path, name)
+			}
+		}
+		for name, fieldValue := range obj {
+			fieldSchema, exists := properties[name].(map[string]interface{})
+			if !exists {
+				return fmt.Errorf("ValidateAgainstExportSchema: %v: unexpected field %v", path, name)
+			}
+			if err := ValidateAgainstExportSchema(fieldSchema, fieldValue, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("ValidateAgainstExportSchema: %v: expected array", path)
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for ii, item := range arr {
+			if err := ValidateAgainstExportSchema(items, item, fmt.Sprintf("%v[%d]", path, ii)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("ValidateAgainstExportSchema: %v: expected string", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("ValidateAgainstExportSchema: %v: expected boolean", path)
+		}
+	case "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("ValidateAgainstExportSchema: %v: expected integer", path)
+		}
+		if _, isMinZero := schema["minimum"]; isMinZero {
+			if _, err := strconv.ParseUint(num.String(), 10, 64); err != nil {
+				return fmt.Errorf("ValidateAgainstExportSchema: %v: expected non-negative integer: %v", path, err)
+			}
+		} else if _, err := num.Int64(); err != nil {
+			return fmt.Errorf("ValidateAgainstExportSchema: %v: expected integer: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func _marshalAndValidateExport(exported interface{}, schemaJSON string) ([]byte, error) {
+	jsonBytes, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "_marshalAndValidateExport: Problem marshaling export")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, errors.Wrapf(err, "_marshalAndValidateExport: Problem decoding export")
+	}
+	schema := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
+		return nil, errors.Wrapf(err, "_marshalAndValidateExport: Problem decoding schema")
+	}
+	if err := ValidateAgainstExportSchema(schema, decoded, "$"); err != nil {
+		return nil, errors.Wrapf(err, "_marshalAndValidateExport: Export does not match schema")
+	}
+	return jsonBytes, nil
+}
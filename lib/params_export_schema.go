@@ -0,0 +1,161 @@
+package lib
+
+// params_export_schema.go holds the JSON schemas that ExportParams and
+// ExportGenesisState output is validated against. They're fixed documents rather than
+// being derived from the export structs, so that they're a contract for consumers: a
+// change to the structs fails validation until it's made here too, and should come
+// with a bump of ParamsExportSchemaVersion.
+
+// ExportedParamsSchemaJSON is the JSON schema for ExportParams output.
+const ExportedParamsSchemaJSON = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "DeSo network params",
+	"type": "object",
+	"properties": {
+		"SchemaVersion": {"type": "integer", "minimum": 0},
+		"NetworkType": {"type": "string"},
+		"ProtocolVersion": {"type": "integer", "minimum": 0},
+		"MinProtocolVersion": {"type": "integer", "minimum": 0},
+		"UserAgent": {"type": "string"},
+		"DNSSeeds": {
+			"type": "array",
+			"items": {"type": "string"}
+		},
+		"DefaultSocketPort": {"type": "integer", "minimum": 0},
+		"DefaultJSONPort": {"type": "integer", "minimum": 0},
+		"GenesisBlockHashHex": {"type": "string"},
+		"Base58PrefixPublicKey": {"type": "string"},
+		"Base58PrefixPrivateKey": {"type": "string"},
+		"BitcoinBurnAddress": {"type": "string"},
+		"TimeBetweenBlocksNanos": {"type": "integer"},
+		"TimeBetweenDifficultyRetargetsNanos": {"type": "integer"},
+		"BlockRewardMaturityNanos": {"type": "integer"},
+		"MinDifficultyTargetHex": {"type": "string"},
+		"MinChainWorkHex": {"type": "string"},
+		"MaxDifficultyRetargetFactor": {"type": "integer"},
+		"V1DifficultyAdjustmentFactor": {"type": "integer"},
+		"MaxTstampOffsetSeconds": {"type": "integer", "minimum": 0},
+		"MaxBlockSizeBytesPoW": {"type": "integer", "minimum": 0},
+		"DefaultPoWSnapshotBlockHeightPeriod": {"type": "integer", "minimum": 0},
+		"MaxUsernameLengthBytes": {"type": "integer", "minimum": 0},
+		"MaxUserDescriptionLengthBytes": {"type": "integer", "minimum": 0},
+		"MaxProfilePicLengthBytes": {"type": "integer", "minimum": 0},
+		"MaxProfilePicDimensions": {"type": "integer", "minimum": 0},
+		"MaxPrivateMessageLengthBytes": {"type": "integer", "minimum": 0},
+		"MaxNewMessageLengthBytes": {"type": "integer", "minimum": 0},
+		"MaxPostBodyLengthBytes": {"type": "integer", "minimum": 0},
+		"MaxPostSubLengthBytes": {"type": "integer", "minimum": 0},
+		"CreatorCoinSlope": {"type": "string"},
+		"CreatorCoinReserveRatio": {"type": "string"},
+		"Fees": {
+			"type": "object",
+			"properties": {
+				"BitcoinExchangeFeeBasisPoints": {"type": "integer", "minimum": 0},
+				"CreatorCoinTradeFeeBasisPoints": {"type": "integer", "minimum": 0},
+				"CreatorCoinAutoSellThresholdNanos": {"type": "integer", "minimum": 0},
+				"StakeFeeBasisPoints": {"type": "integer", "minimum": 0},
+				"MaxStakeMultipleBasisPoints": {"type": "integer", "minimum": 0},
+				"MaxCreatorBasisPoints": {"type": "integer", "minimum": 0},
+				"MaxNFTRoyaltyBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultFeeBucketGrowthRateBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultStakingRewardsAPYBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultMempoolFeeEstimatorNumMempoolBlocks": {"type": "integer", "minimum": 0},
+				"DefaultMempoolFeeEstimatorNumPastBlocks": {"type": "integer", "minimum": 0},
+				"DefaultMempoolCongestionFactorBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultMempoolPastBlocksCongestionFactorBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultMempoolPriorityPercentileBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultMempoolPastBlocksPriorityPercentileBasisPoints": {"type": "integer", "minimum": 0}
+			},
+			"required": ["BitcoinExchangeFeeBasisPoints", "CreatorCoinTradeFeeBasisPoints", "CreatorCoinAutoSellThresholdNanos", "StakeFeeBasisPoints", "MaxStakeMultipleBasisPoints", "MaxCreatorBasisPoints", "MaxNFTRoyaltyBasisPoints", "DefaultFeeBucketGrowthRateBasisPoints", "DefaultStakingRewardsAPYBasisPoints", "DefaultMempoolFeeEstimatorNumMempoolBlocks", "DefaultMempoolFeeEstimatorNumPastBlocks", "DefaultMempoolCongestionFactorBasisPoints", "DefaultMempoolPastBlocksCongestionFactorBasisPoints", "DefaultMempoolPriorityPercentileBasisPoints", "DefaultMempoolPastBlocksPriorityPercentileBasisPoints"],
+			"additionalProperties": false
+		},
+		"PoS": {
+			"type": "object",
+			"properties": {
+				"DefaultStakeLockupEpochDuration": {"type": "integer", "minimum": 0},
+				"DefaultValidatorJailEpochDuration": {"type": "integer", "minimum": 0},
+				"DefaultLeaderScheduleMaxNumValidators": {"type": "integer", "minimum": 0},
+				"DefaultValidatorSetMaxNumValidators": {"type": "integer", "minimum": 0},
+				"DefaultStakingRewardsMaxNumStakes": {"type": "integer", "minimum": 0},
+				"DefaultEpochDurationNumBlocks": {"type": "integer", "minimum": 0},
+				"DefaultJailInactiveValidatorGracePeriodEpochs": {"type": "integer", "minimum": 0},
+				"DefaultJailMissedSlotsThreshold": {"type": "integer", "minimum": 0},
+				"DefaultValidatorSlashBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultBlockTimestampDriftNanoSecs": {"type": "integer"},
+				"MaxBlockTimestampDriftNanoSecs": {"type": "integer"},
+				"MedianTimePastNumBlocks": {"type": "integer", "minimum": 0},
+				"DefaultMaximumVestedIntersectionsPerLockupTransaction": {"type": "integer", "minimum": 0},
+				"DefaultMempoolMaxSizeBytes": {"type": "integer", "minimum": 0},
+				"DefaultExchangeRateFeedMaxAgeBlocks": {"type": "integer", "minimum": 0},
+				"DefaultExchangeRateFeedMaxDeviationBasisPoints": {"type": "integer", "minimum": 0},
+				"DefaultExchangeRateFeedMinSubmissions": {"type": "integer", "minimum": 0},
+				"DefaultMaxBlockSizeBytesPoS": {"type": "integer", "minimum": 0},
+				"DefaultSoftMaxBlockSizeBytesPoS": {"type": "integer", "minimum": 0},
+				"DefaultMaxTxnSizeBytesPoS": {"type": "integer", "minimum": 0},
+				"DefaultBlockProductionIntervalMillisecondsPoS": {"type": "integer", "minimum": 0},
+				"DefaultTimeoutIntervalMillisecondsPoS": {"type": "integer", "minimum": 0}
+			},
+			"required": ["DefaultStakeLockupEpochDuration", "DefaultValidatorJailEpochDuration", "DefaultLeaderScheduleMaxNumValidators", "DefaultValidatorSetMaxNumValidators", "DefaultStakingRewardsMaxNumStakes", "DefaultEpochDurationNumBlocks", "DefaultJailInactiveValidatorGracePeriodEpochs", "DefaultJailMissedSlotsThreshold", "DefaultValidatorSlashBasisPoints", "DefaultBlockTimestampDriftNanoSecs", "MaxBlockTimestampDriftNanoSecs", "MedianTimePastNumBlocks", "DefaultMaximumVestedIntersectionsPerLockupTransaction", "DefaultMempoolMaxSizeBytes", "DefaultExchangeRateFeedMaxAgeBlocks", "DefaultExchangeRateFeedMaxDeviationBasisPoints", "DefaultExchangeRateFeedMinSubmissions", "DefaultMaxBlockSizeBytesPoS", "DefaultSoftMaxBlockSizeBytesPoS", "DefaultMaxTxnSizeBytesPoS", "DefaultBlockProductionIntervalMillisecondsPoS", "DefaultTimeoutIntervalMillisecondsPoS"],
+			"additionalProperties": false
+		},
+		"ForkHeights": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"Name": {"type": "string"},
+					"Height": {"type": "integer", "minimum": 0}
+				},
+				"required": ["Name", "Height"],
+				"additionalProperties": false
+			}
+		},
+		"EncoderMigrations": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"Name": {"type": "string"},
+					"Height": {"type": "integer", "minimum": 0},
+					"Version": {"type": "integer", "minimum": 0}
+				},
+				"required": ["Name", "Height", "Version"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["SchemaVersion", "NetworkType", "ProtocolVersion", "MinProtocolVersion", "UserAgent", "DNSSeeds", "DefaultSocketPort", "DefaultJSONPort", "GenesisBlockHashHex", "Base58PrefixPublicKey", "Base58PrefixPrivateKey", "BitcoinBurnAddress", "TimeBetweenBlocksNanos", "TimeBetweenDifficultyRetargetsNanos", "BlockRewardMaturityNanos", "MinDifficultyTargetHex", "MinChainWorkHex", "MaxDifficultyRetargetFactor", "V1DifficultyAdjustmentFactor", "MaxTstampOffsetSeconds", "MaxBlockSizeBytesPoW", "DefaultPoWSnapshotBlockHeightPeriod", "MaxUsernameLengthBytes", "MaxUserDescriptionLengthBytes", "MaxProfilePicLengthBytes", "MaxProfilePicDimensions", "MaxPrivateMessageLengthBytes", "MaxNewMessageLengthBytes", "MaxPostBodyLengthBytes", "MaxPostSubLengthBytes", "CreatorCoinSlope", "CreatorCoinReserveRatio", "Fees", "PoS", "ForkHeights", "EncoderMigrations"],
+	"additionalProperties": false
+}`
+
+// ExportedGenesisStateSchemaJSON is the JSON schema for ExportGenesisState output.
+const ExportedGenesisStateSchemaJSON = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "DeSo genesis state",
+	"type": "object",
+	"properties": {
+		"SchemaVersion": {"type": "integer", "minimum": 0},
+		"NetworkType": {"type": "string"},
+		"GenesisBlockHashHex": {"type": "string"},
+		"DeSoNanosPurchasedAtGenesis": {"type": "integer", "minimum": 0},
+		"SeedBalances": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"PublicKeyBase58Check": {"type": "string"},
+					"AmountNanos": {"type": "integer", "minimum": 0}
+				},
+				"required": ["PublicKeyBase58Check", "AmountNanos"],
+				"additionalProperties": false
+			}
+		},
+		"TotalSeedBalancesNanos": {"type": "integer", "minimum": 0},
+		"SeedTxnHashesHex": {
+			"type": "array",
+			"items": {"type": "string"}
+		}
+	},
+	"required": ["SchemaVersion", "NetworkType", "GenesisBlockHashHex", "DeSoNanosPurchasedAtGenesis", "SeedBalances", "TotalSeedBalancesNanos", "SeedTxnHashesHex"],
+	"additionalProperties": false
+}`
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportParams(t *testing.T) {
+	require := require.New(t)
+
+	for _, params := range []*DeSoParams{&DeSoMainnetParams, &DeSoTestnetParams} {
+		jsonBytes, err := ExportParams(params)
+		require.NoError(err)
+
+		exported := &ExportedParams{}
+		require.NoError(json.Unmarshal(jsonBytes, exported))
+		require.Equal(ParamsExportSchemaVersion, exported.SchemaVersion)
+		require.Equal(params.GenesisBlockHashHex, exported.GenesisBlockHashHex)
+		require.Equal(params.CreatorCoinTradeFeeBasisPoints, exported.Fees.CreatorCoinTradeFeeBasisPoints)
+		require.Equal(reflect.TypeOf(ForkHeights{}).NumField(), len(exported.ForkHeights))
+		require.Equal(len(params.EncoderMigrationHeightsList), len(exported.EncoderMigrations))
+
+		// Fork heights must be sorted so the output is deterministic.
+		for ii := 1; ii < len(exported.ForkHeights); ii++ {
+			require.LessOrEqual(exported.ForkHeights[ii-1].Height, exported.ForkHeights[ii].Height)
+		}
+
+		// Exporting twice must produce identical bytes.
+		jsonBytesAgain, err := ExportParams(params)
+		require.NoError(err)
+		require.Equal(jsonBytes, jsonBytesAgain)
+	}
+
+	_, err := ExportParams(nil)
+	require.Error(err)
+}
+
+func TestExportGenesisState(t *testing.T) {
+	require := require.New(t)
+
+	jsonBytes, err := ExportGenesisState(&DeSoMainnetParams)
+	require.NoError(err)
+
+	exported := &ExportedGenesisState{}
+	require.NoError(json.Unmarshal(jsonBytes, exported))
+	require.Equal(len(DeSoMainnetParams.SeedBalances), len(exported.SeedBalances))
+	require.Equal(len(DeSoMainnetParams.SeedTxns), len(exported.SeedTxnHashesHex))
+
+	totalNanos := uint64(0)
+	for _, seedBalance := range DeSoMainnetParams.SeedBalances {
+		totalNanos += seedBalance.AmountNanos
+	}
+	require.Equal(totalNanos, exported.TotalSeedBalancesNanos)
+}
+
+// Run the tests with -update-params-export-golden to rewrite the golden files after an
+// intended change to the params or the export.
+var updateParamsExportGolden = flag.Bool(
+	"update-params-export-golden", false, "rewrite the params export golden files in testdata")
+
+// Only mainnet is checked against golden files, since other tests modify the testnet
+// params in place.
+func TestExportParamsGolden(t *testing.T) {
+	require := require.New(t)
+
+	for _, testCase := range []struct {
+		goldenFile string
+		export     func() ([]byte, error)
+	}{
+		{"params_export_mainnet.json", func() ([]byte, error) { return ExportParams(&DeSoMainnetParams) }},
+		{"genesis_state_export_mainnet.json", func() ([]byte, error) { return ExportGenesisState(&DeSoMainnetParams) }},
+	} {
+		jsonBytes, err := testCase.export()
+		require.NoError(err)
+		goldenPath := filepath.Join("testdata", testCase.goldenFile)
+		if *updateParamsExportGolden {
+			require.NoError(os.MkdirAll("testdata", 0755))
+			require.NoError(os.WriteFile(goldenPath, jsonBytes, 0644))
+		}
+		goldenBytes, err := os.ReadFile(goldenPath)
+		require.NoError(err)
+		require.Equal(string(goldenBytes), string(jsonBytes), "%v is out of date", goldenPath)
+	}
+}
+
+func TestExportParamsCoversDeSoParams(t *testing.T) {
+	require := require.New(t)
+
+	// Collect the names of the exported fields, including the nested ones.
+	exportedFieldNames := make(map[string]bool)
+	for _, exportType := range []reflect.Type{
+		reflect.TypeOf(ExportedParams{}),
+		reflect.TypeOf(ExportedFeeParams{}),
+		reflect.TypeOf(ExportedPoSParams{}),
+		reflect.TypeOf(ExportedGenesisState{}),
+	} {
+		for ii := 0; ii < exportType.NumField(); ii++ {
+			exportedFieldNames[exportType.Field(ii).Name] = true
+		}
+	}
+	// Some fields are exported under a different name.
+	renamedFields := map[string]string{
+		"TimeBetweenBlocks":              "TimeBetweenBlocksNanos",
+		"TimeBetweenDifficultyRetargets": "TimeBetweenDifficultyRetargetsNanos",
+		"BlockRewardMaturity":            "BlockRewardMaturityNanos",
+		"EncoderMigrationHeightsList":    "EncoderMigrations",
+		"SeedTxns":                       "SeedTxnHashesHex",
+	}
+
+	// Every DeSoParams field is either exported or excluded with a reason.
+	paramsType := reflect.TypeOf(DeSoParams{})
+	for ii := 0; ii < paramsType.NumField(); ii++ {
+		fieldName := paramsType.Field(ii).Name
+		exportedName := fieldName
+		if renamedName, isRenamed := renamedFields[fieldName]; isRenamed {
+			exportedName = renamedName
+		}
+		_, isExcluded := ParamsExportExcludedFields[fieldName]
+		require.True(exportedFieldNames[exportedName] != isExcluded,
+			"DeSoParams.%v must be either exported or listed in ParamsExportExcludedFields, but not both", fieldName)
+	}
+	for fieldName := range ParamsExportExcludedFields {
+		_, exists := paramsType.FieldByName(fieldName)
+		require.True(exists, "ParamsExportExcludedFields lists %v, which isn't a DeSoParams field", fieldName)
+	}
+}
+
+func TestValidateAgainstExportSchema(t *testing.T) {
+	require := require.New(t)
+
+	decode := func(jsonStr string) interface{} {
+		var decoded interface{}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(jsonStr)))
+		decoder.UseNumber()
+		require.NoError(decoder.Decode(&decoded))
+		return decoded
+	}
+	decodeSchema := func(jsonStr string) map[string]interface{} {
+		schema := make(map[string]interface{})
+		require.NoError(json.Unmarshal([]byte(jsonStr), &schema))
+		return schema
+	}
+
+	schema := decodeSchema(`{
+		"type": "object",
+		"properties": {"Name": {"type": "string"}, "Height": {"type": "integer", "minimum": 0}},
+		"required": ["Name", "Height"],
+		"additionalProperties": false
+	}`)
+	require.NoError(ValidateAgainstExportSchema(schema, decode(`{"Name": "Fork", "Height": 10}`), "$"))
+	// Missing fields, unknown fields, wrong types, and negative heights are all rejected.
+	require.Error(ValidateAgainstExportSchema(schema, decode(`{"Name": "Fork"}`), "$"))
+	require.Error(ValidateAgainstExportSchema(schema, decode(`{"Name": "Fork", "Height": 10, "Extra": 1}`), "$"))
+	require.Error(ValidateAgainstExportSchema(schema, decode(`{"Name": 1, "Height": 10}`), "$"))
+	require.Error(ValidateAgainstExportSchema(schema, decode(`{"Name": "Fork", "Height": -1}`), "$"))
+
+	// The committed schema catches an export that has drifted from it.
+	paramsSchema := decodeSchema(ExportedParamsSchemaJSON)
+	jsonBytes, err := ExportParams(&DeSoMainnetParams)
+	require.NoError(err)
+	exported := decode(string(jsonBytes)).(map[string]interface{})
+	require.NoError(ValidateAgainstExportSchema(paramsSchema, exported, "$"))
+	exported["PoS"].(map[string]interface{})["DefaultUnpublishedParam"] = json.Number("1")
+	require.Error(ValidateAgainstExportSchema(paramsSchema, exported, "$"))
+	delete(exported["PoS"].(map[string]interface{}), "DefaultUnpublishedParam")
+	delete(exported["Fees"].(map[string]interface{}), "StakeFeeBasisPoints")
+	require.Error(ValidateAgainstExportSchema(paramsSchema, exported, "$"))
+}
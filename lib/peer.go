@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -77,6 +79,9 @@ type Peer struct {
 	addrStr                string
 	netAddr                *wire.NetAddress
 	minTxFeeRateNanosPerKB uint64
+	// txnFilter limits the txns we inv a light client to the ones it's interested in. It's
+	// nil unless the peer loaded a filter.
+	txnFilter *LightPeerFilter
 	// Messages for which we are expecting a reply within a fixed
 	// amount of time. This list is always sorted by ExpectedTime,
 	// with the item having the earliest time at the front.
@@ -109,6 +114,11 @@ type Peer struct {
 	blocksToSendMtx deadlock.Mutex
 	blocksToSend    map[BlockHash]bool
 
+	// rateLimiter limits how often the peer can send us expensive requests. It's created
+	// when the peer sends its first one, and only accessed from the Server's message
+	// handler thread.
+	rateLimiter *PeerRateLimiter
+
 	// Inventory stuff.
 	// The inventory that we know the peer already has.
 	knownInventory lru.Cache
@@ -119,6 +129,9 @@ type Peer struct {
 	// Whether we have sent a MEMPOOL message to the peer to request INV messages.
 	// This makes sure that we only ever send one MEMPOOL message to the peer.
 	hasReceivedMempoolMessage bool
+	// Whether the peer has sent us a MEMPOOL_SYNC message. Each one makes us walk our whole
+	// mempool, so a peer only gets to send one.
+	hasSentMempoolSyncMessage bool
 
 	// We process GetTransaction requests in a separate loop. This allows us
 	// to ensure that the responses are ordered.
@@ -521,7 +534,7 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 
 	snapshotDataMsg := &MsgDeSoSnapshotData{
 		Prefix:           msg.GetPrefix(),
-		SnapshotMetadata: pp.srv.snapshot.CurrentEpochSnapshotMetadata,
+		SnapshotMetadata: pp.srv.snapshot.GetEpochMetadataCopy(),
 	}
 	if isStateKey(msg.GetPrefix()) {
 		snapshotDataMsg.SnapshotChunk, snapshotDataMsg.SnapshotChunkFull, err =
@@ -540,6 +553,13 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 			"snapshot chunk for peer (%v), error (%v)", pp, err)
 		return
 	}
+	// Attach the proofs for the chunk if we've committed to the snapshot. We can't prove anything
+	// about prefixes we don't know about, so the peer will only check those against the checksum.
+	if isStateKey(msg.GetPrefix()) {
+		snapshotDataMsg.SnapshotMetadata.ChunkCommitment, snapshotDataMsg.ChunkProofs =
+			pp.srv.snapshot.GetSnapshotChunkProofs(snapshotDataMsg.SnapshotMetadata.SnapshotBlockHeight,
+				msg.GetPrefix(), msg.SnapshotStartKey, snapshotDataMsg.SnapshotChunk, snapshotDataMsg.SnapshotChunkFull)
+	}
 
 	pp.AddDeSoMessage(snapshotDataMsg, false)
 
@@ -612,6 +632,12 @@ func (pp *Peer) StartDeSoMessageProcessor() {
 					"num hashes %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), len(msg.HashList), pp)
 				pp.HandleGetBlocks(msg)
 
+			case MsgTypeGetBlockTxns:
+				msg := msgToProcess.DeSoMessage.(*MsgDeSoGetBlockTxns)
+				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
+					"num indexes %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), len(msg.Indexes), pp)
+				pp.HandleGetBlockTxns(msg)
+
 			case MsgTypeGetSnapshot:
 				msg := msgToProcess.DeSoMessage.(*MsgDeSoGetSnapshot)
 				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with start key %v "+
@@ -751,6 +777,9 @@ func (pp *Peer) HandlePongMsg(msg *MsgDeSoPong) {
 		pp.LastPingMicros /= 1000 // convert to usec.
 		pp.LastPingNonce = 0
 		glog.V(2).Infof("Peer.HandlePongMsg: LastPingMicros(%d) from Peer %v", pp.LastPingMicros, pp)
+		if pp.cmgr != nil {
+			pp.cmgr.recordPeerLatency(pp, uint64(pp.LastPingMicros))
+		}
 	}
 }
 
@@ -870,6 +899,13 @@ func (pp *Peer) _handleOutExpectedResponse(msg DeSoMessage) {
 			TimeExpected: time.Now().Add(stallTimeout),
 			MessageType:  MsgTypeHeaderBundle,
 		})
+	case MsgTypeGetBlockTxns:
+		// If we're sending a GetBlockTxns message, the Peer should respond within
+		// a few seconds with the txns we're missing from the compact block.
+		pp._addExpectedResponse(&ExpectedResponse{
+			TimeExpected: time.Now().Add(stallTimeout),
+			MessageType:  MsgTypeBlockTxns,
+		})
 	case MsgTypeGetSnapshot:
 		// If we're sending a GetSnapshot message, the peer should respond within a few seconds with a SnapshotData.
 		pp._addExpectedResponse(&ExpectedResponse{
@@ -949,6 +985,21 @@ func (pp *Peer) SetServiceFlag(sf ServiceFlag) {
 	pp.serviceFlags = sf
 }
 
+// TxnFilter returns the filter the peer loaded, or nil if it gets every txn.
+func (pp *Peer) TxnFilter() *LightPeerFilter {
+	pp.PeerInfoMtx.Lock()
+	defer pp.PeerInfoMtx.Unlock()
+
+	return pp.txnFilter
+}
+
+func (pp *Peer) SetTxnFilter(txnFilter *LightPeerFilter) {
+	pp.PeerInfoMtx.Lock()
+	defer pp.PeerInfoMtx.Unlock()
+
+	pp.txnFilter = txnFilter
+}
+
 func (pp *Peer) SetNegotiatedProtocolVersion(negotiatedProtocolVersion ProtocolVersionType) {
 	pp.PeerInfoMtx.Lock()
 	defer pp.PeerInfoMtx.Unlock()
@@ -983,7 +1034,7 @@ out:
 			}
 
 			// if we're sending a MEMPOOL message, then we
-			if msg.GetMsgType() == MsgTypeMempool {
+			if msg.GetMsgType() == MsgTypeMempool || msg.GetMsgType() == MsgTypeMempoolSync {
 				pp.hasReceivedMempoolMessage = true
 			}
 
@@ -1040,6 +1091,9 @@ out:
 				glog.Errorf("Peer.outHandler: Peer %v took too long to response to "+
 					"reqest. Expected MsgType=%v at time %v but it is now time %v",
 					pp, firstEntry.MessageType, firstEntry.TimeExpected, nowTime)
+				if pp.cmgr != nil {
+					pp.cmgr.recordPeerStall(pp)
+				}
 				pp.Disconnect(fmt.Sprintf(
 					"outHandler - peer took too long to respond to request, expected MsgType=%v",
 					firstEntry.MessageType))
@@ -1127,12 +1181,13 @@ func (pp *Peer) _addExpectedResponse(item *ExpectedResponse) {
 	pp.expectedResponses = append(append(left, item), right...)
 }
 
-func (pp *Peer) _handleInExpectedResponse(rmsg DeSoMessage) error {
+func (pp *Peer) _handleInExpectedResponse(rmsg DeSoMessage, msgLen uint64) error {
 	// Let the Peer off the hook if the response is one we were waiting for.
 	// Do this in a separate switch to keep things clean.
 	msgType := rmsg.GetMsgType()
 	if msgType == MsgTypeBlock ||
 		msgType == MsgTypeBlockBundle ||
+		msgType == MsgTypeBlockTxns ||
 		msgType == MsgTypeHeaderBundle ||
 		msgType == MsgTypeTransactionBundle ||
 		msgType == MsgTypeTransactionBundleV2 ||
@@ -1150,7 +1205,10 @@ func (pp *Peer) _handleInExpectedResponse(rmsg DeSoMessage) error {
 		}
 
 		// If we get here then we managed to dequeue a message we were
-		// expecting, which is good.
+		// expecting, which is good. Credit the peer for serving us the data.
+		if expectedResponse != nil && pp.cmgr != nil {
+			pp.cmgr.recordPeerBytesServed(pp, msgLen)
+		}
 	}
 
 	return nil
@@ -1174,6 +1232,7 @@ out:
 		// Read a message and stop the idle timer as soon as the read
 		// is done. The timer is reset below for the next iteration if
 		// needed.
+		bytesReceivedBefore := atomic.LoadUint64(&pp.bytesReceived)
 		rmsg, err := pp.ReadDeSoMessage()
 		idleTimer.Stop()
 		if err != nil {
@@ -1184,7 +1243,8 @@ out:
 
 		// Adjust what we expect our Peer to send us based on what we're now
 		// receiving with this message.
-		if err := pp._handleInExpectedResponse(rmsg); err != nil {
+		msgLen := atomic.LoadUint64(&pp.bytesReceived) - bytesReceivedBefore
+		if err := pp._handleInExpectedResponse(rmsg, msgLen); err != nil {
 			break out
 		}
 
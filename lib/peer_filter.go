@@ -0,0 +1,178 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/deso-protocol/core/bls"
+)
+
+// Private and consortium deployments need to keep their nodes from talking to the rest of the
+// network. The PeerFilter restricts the peers a node connects to, and accepts connections from,
+// to an allowlist, and keeps it from connecting to the peers on a denylist.
+//
+// Each rule is either an IP range in CIDR notation (10.0.0.0/8), a single IP address, or the BLS
+// public key of a validator (0x...). A peer is denied if its IP address or its public key matches
+// a deny rule. Otherwise, if there are allow rules, the peer is only allowed if its IP address or
+// its public key matches one of them. If there are no allow rules, every peer that isn't denied
+// is allowed.
+//
+// A peer's public key is only known once it completes the handshake, so the IP rules are checked
+// as soon as the connection is established, and the public key rules once the handshake completes.
+// The rules can be replaced while the node is running, which disconnects the peers that they no
+// longer allow.
+
+// PeerFilter holds the allow and deny rules for peers. The zero value allows every peer.
+type PeerFilter struct {
+	mtx sync.RWMutex
+
+	allowRules []string
+	denyRules  []string
+
+	allowedNets       []*net.IPNet
+	allowedPublicKeys map[bls.SerializedPublicKey]bool
+	deniedNets        []*net.IPNet
+	deniedPublicKeys  map[bls.SerializedPublicKey]bool
+}
+
+// NewPeerFilter parses the allow and deny rules.
+func NewPeerFilter(allowRules []string, denyRules []string) (*PeerFilter, error) {
+	filter := &PeerFilter{}
+	if err := filter.SetRules(allowRules, denyRules); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parsePeerFilterRules splits the rules into IP ranges and public keys.
+func parsePeerFilterRules(rules []string) (
+	_nets []*net.IPNet, _publicKeys map[bls.SerializedPublicKey]bool, _rules []string, _err error) {
+
+	publicKeys := make(map[bls.SerializedPublicKey]bool)
+	var nets []*net.IPNet
+	var parsedRules []string
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parsedRules = append(parsedRules, rule)
+
+		if strings.HasPrefix(rule, "0x") {
+			publicKey, err := (&bls.PublicKey{}).FromString(rule)
+			if err != nil || publicKey.IsEmpty() {
+				return nil, nil, nil, fmt.Errorf("parsePeerFilterRules: Invalid public key (%v)", rule)
+			}
+			publicKeys[publicKey.Serialize()] = true
+			continue
+		}
+		if strings.Contains(rule, "/") {
+			_, ipNet, err := net.ParseCIDR(rule)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parsePeerFilterRules: Invalid IP range (%v): %v", rule, err)
+			}
+			nets = append(nets, ipNet)
+			continue
+		}
+		ip := net.ParseIP(rule)
+		if ip == nil {
+			return nil, nil, nil, fmt.Errorf("parsePeerFilterRules: Rule (%v) is neither an IP range, "+
+				"an IP address, nor a public key", rule)
+		}
+		numBits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			numBits = 8 * net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(numBits, numBits)})
+	}
+	return nets, publicKeys, parsedRules, nil
+}
+
+// SetRules replaces the rules. The rules are left as they were if any of the new ones is invalid.
+func (filter *PeerFilter) SetRules(allowRules []string, denyRules []string) error {
+	allowedNets, allowedPublicKeys, parsedAllowRules, err := parsePeerFilterRules(allowRules)
+	if err != nil {
+		return fmt.Errorf("PeerFilter.SetRules: Problem parsing allow rules: %v", err)
+	}
+	deniedNets, deniedPublicKeys, parsedDenyRules, err := parsePeerFilterRules(denyRules)
+	if err != nil {
+		return fmt.Errorf("PeerFilter.SetRules: Problem parsing deny rules: %v", err)
+	}
+
+	filter.mtx.Lock()
+	defer filter.mtx.Unlock()
+
+	filter.allowRules = parsedAllowRules
+	filter.denyRules = parsedDenyRules
+	filter.allowedNets = allowedNets
+	filter.allowedPublicKeys = allowedPublicKeys
+	filter.deniedNets = deniedNets
+	filter.deniedPublicKeys = deniedPublicKeys
+	return nil
+}
+
+// GetRules returns copies of the allow and deny rules.
+func (filter *PeerFilter) GetRules() (_allowRules []string, _denyRules []string) {
+	filter.mtx.RLock()
+	defer filter.mtx.RUnlock()
+
+	return append([]string{}, filter.allowRules...), append([]string{}, filter.denyRules...)
+}
+
+func peerFilterNetsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAddress returns an error if no peer at the IP address can be allowed, whatever its public
+// key. It's meant to reject connections before the handshake.
+func (filter *PeerFilter) CheckAddress(ip net.IP) error {
+	filter.mtx.RLock()
+	defer filter.mtx.RUnlock()
+
+	if peerFilterNetsContain(filter.deniedNets, ip) {
+		return fmt.Errorf("PeerFilter.CheckAddress: IP address (%v) is denied", ip)
+	}
+	// If there are public keys on the allowlist, the peer may still be allowed by its key.
+	if len(filter.allowedNets) > 0 && len(filter.allowedPublicKeys) == 0 &&
+		!peerFilterNetsContain(filter.allowedNets, ip) {
+
+		return fmt.Errorf("PeerFilter.CheckAddress: IP address (%v) is not allowed", ip)
+	}
+	return nil
+}
+
+// CheckPeer returns an error if the peer at the IP address, with the given public key, isn't
+// allowed. The public key is nil for peers that aren't validators.
+func (filter *PeerFilter) CheckPeer(ip net.IP, publicKey *bls.PublicKey) error {
+	filter.mtx.RLock()
+	defer filter.mtx.RUnlock()
+
+	var serializedPublicKey bls.SerializedPublicKey
+	if !publicKey.IsEmpty() {
+		serializedPublicKey = publicKey.Serialize()
+	}
+	if peerFilterNetsContain(filter.deniedNets, ip) {
+		return fmt.Errorf("PeerFilter.CheckPeer: IP address (%v) is denied", ip)
+	}
+	if serializedPublicKey != "" && filter.deniedPublicKeys[serializedPublicKey] {
+		return fmt.Errorf("PeerFilter.CheckPeer: Public key (%v) is denied", publicKey.ToAbbreviatedString())
+	}
+	if len(filter.allowedNets) == 0 && len(filter.allowedPublicKeys) == 0 {
+		return nil
+	}
+	if peerFilterNetsContain(filter.allowedNets, ip) ||
+		(serializedPublicKey != "" && filter.allowedPublicKeys[serializedPublicKey]) {
+
+		return nil
+	}
+	return fmt.Errorf("PeerFilter.CheckPeer: Peer with IP address (%v) and public key (%v) is not allowed",
+		ip, publicKey.ToAbbreviatedString())
+}
@@ -0,0 +1,64 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerFilter(t *testing.T) {
+	require := require.New(t)
+
+	allowedPublicKey := _generateRandomBLSPrivateKey(t).PublicKey()
+	deniedPublicKey := _generateRandomBLSPrivateKey(t).PublicKey()
+	otherPublicKey := _generateRandomBLSPrivateKey(t).PublicKey()
+
+	// The zero value allows every peer.
+	filter := &PeerFilter{}
+	require.NoError(filter.CheckAddress(net.ParseIP("1.2.3.4")))
+	require.NoError(filter.CheckPeer(net.ParseIP("1.2.3.4"), nil))
+
+	// Invalid rules are rejected, and leave the rules as they were.
+	require.Error(filter.SetRules([]string{"10.0.0.0/33"}, nil))
+	require.Error(filter.SetRules(nil, []string{"not-an-ip"}))
+	require.Error(filter.SetRules([]string{"0xnothex"}, nil))
+	allowRules, denyRules := filter.GetRules()
+	require.Empty(allowRules)
+	require.Empty(denyRules)
+
+	// With only IP ranges on the allowlist, peers outside of them are rejected before the handshake.
+	filter, err := NewPeerFilter([]string{"10.0.0.0/8", " 192.168.1.1 ", "2001:db8::/32"}, []string{"10.1.0.0/16"})
+	require.NoError(err)
+	require.NoError(filter.CheckAddress(net.ParseIP("10.2.3.4")))
+	require.NoError(filter.CheckAddress(net.ParseIP("192.168.1.1")))
+	require.NoError(filter.CheckAddress(net.ParseIP("2001:db8::1")))
+	require.Error(filter.CheckAddress(net.ParseIP("192.168.1.2")))
+	require.Error(filter.CheckAddress(net.ParseIP("10.1.2.3")))
+	allowRules, denyRules = filter.GetRules()
+	require.Equal([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"}, allowRules)
+	require.Equal([]string{"10.1.0.0/16"}, denyRules)
+
+	// With public keys on the allowlist, peers outside of the IP ranges may be allowed once we know
+	// their public key, and denied public keys are rejected even from allowed IP ranges.
+	require.NoError(filter.SetRules(
+		[]string{"10.0.0.0/8", allowedPublicKey.ToString()},
+		[]string{"10.1.0.0/16", deniedPublicKey.ToString()}))
+	require.NoError(filter.CheckAddress(net.ParseIP("8.8.8.8")))
+	require.NoError(filter.CheckPeer(net.ParseIP("8.8.8.8"), allowedPublicKey))
+	require.Error(filter.CheckPeer(net.ParseIP("8.8.8.8"), otherPublicKey))
+	require.Error(filter.CheckPeer(net.ParseIP("8.8.8.8"), nil))
+	require.NoError(filter.CheckPeer(net.ParseIP("10.2.3.4"), nil))
+	require.Error(filter.CheckPeer(net.ParseIP("10.2.3.4"), deniedPublicKey))
+	require.Error(filter.CheckAddress(net.ParseIP("10.1.2.3")))
+	require.Error(filter.CheckPeer(net.ParseIP("10.1.2.3"), allowedPublicKey))
+
+	// With only a denylist, every other peer is allowed.
+	require.NoError(filter.SetRules(nil, []string{deniedPublicKey.ToString(), "5.6.7.8"}))
+	require.NoError(filter.CheckPeer(net.ParseIP("8.8.8.8"), otherPublicKey))
+	require.Error(filter.CheckPeer(net.ParseIP("8.8.8.8"), deniedPublicKey))
+	require.Error(filter.CheckAddress(net.ParseIP("5.6.7.8")))
+	require.NoError(filter.CheckAddress(net.ParseIP("5.6.7.9")))
+}
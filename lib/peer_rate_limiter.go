@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Some requests are a lot more expensive for us to answer than for a peer to send. A single
+// GET_SNAPSHOT message makes us read a whole chunk of the state from disk, a GET_BLOCKS message
+// makes us read every block it lists, and a GET_HEADERS message makes us walk the block index.
+// Without a limit, a single peer can keep our disk busy by repeating these requests.
+//
+// The PeerRateLimiter gives each peer a token bucket per expensive message type. The bucket
+// refills at a steady rate up to a burst size, and each request takes tokens from it: one per
+// GET_SNAPSHOT and GET_HEADERS message, and one per block listed in a GET_BLOCKS message.
+// Requests that exceed the budget are dropped, and a peer that keeps sending them after it
+// runs out is disconnected. The budgets are generous enough that a peer syncing from us at
+// full speed stays within them.
+
+const (
+	// DefaultPeerRateLimitMaxViolations is the number of requests over budget, in a row, we drop
+	// before disconnecting the peer.
+	DefaultPeerRateLimitMaxViolations = 10
+)
+
+// PeerRateLimit is the budget a peer has for one type of message.
+type PeerRateLimit struct {
+	// RequestsPerSecond is the rate at which the budget refills. For GET_BLOCKS messages, it
+	// counts blocks rather than messages.
+	RequestsPerSecond float64
+	// Burst is the most the peer can request at once.
+	Burst float64
+}
+
+// peerRateLimitedMsgTypes are the message types that can be rate limited.
+var peerRateLimitedMsgTypes = []MsgType{MsgTypeGetSnapshot, MsgTypeGetBlocks, MsgTypeGetHeaders}
+
+// DefaultPeerRateLimits returns the budgets peers get unless they're configured otherwise.
+func DefaultPeerRateLimits() map[MsgType]PeerRateLimit {
+	return map[MsgType]PeerRateLimit{
+		MsgTypeGetSnapshot: {RequestsPerSecond: 50, Burst: 200},
+		// A peer syncing blocks from a PoS node can request a whole flight of blocks at once.
+		MsgTypeGetBlocks:  {RequestsPerSecond: 2500, Burst: MaxBlocksInFlightPoS},
+		MsgTypeGetHeaders: {RequestsPerSecond: 10, Burst: 50},
+	}
+}
+
+// ParsePeerRateLimits overrides the default budgets with the given ones, each formatted as
+// <MESSAGE_TYPE>:<requests per second>:<burst>, e.g. GET_SNAPSHOT:20:100. A rate of zero
+// removes the limit for the message type.
+func ParsePeerRateLimits(entries []string) (map[MsgType]PeerRateLimit, error) {
+	limits := DefaultPeerRateLimits()
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("ParsePeerRateLimits: Rate limit (%v) should be formatted as "+
+				"<MESSAGE_TYPE>:<requests per second>:<burst>", entry)
+		}
+		var msgType MsgType
+		exists := false
+		for _, rateLimitedMsgType := range peerRateLimitedMsgTypes {
+			if rateLimitedMsgType.String() == strings.ToUpper(parts[0]) {
+				msgType, exists = rateLimitedMsgType, true
+			}
+		}
+		if !exists {
+			return nil, fmt.Errorf("ParsePeerRateLimits: Message type (%v) can't be rate limited, "+
+				"must be one of %v", parts[0], peerRateLimitedMsgTypes)
+		}
+		requestsPerSecond, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || requestsPerSecond < 0 {
+			return nil, fmt.Errorf("ParsePeerRateLimits: Invalid requests per second (%v) for %v",
+				parts[1], msgType)
+		}
+		burst, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("ParsePeerRateLimits: Burst (%v) for %v must be at least one",
+				parts[2], msgType)
+		}
+		if requestsPerSecond == 0 {
+			delete(limits, msgType)
+			continue
+		}
+		limits[msgType] = PeerRateLimit{RequestsPerSecond: requestsPerSecond, Burst: burst}
+	}
+	return limits, nil
+}
+
+// peerRateLimitBucket is a token bucket that starts out full.
+type peerRateLimitBucket struct {
+	limit      PeerRateLimit
+	tokens     float64
+	lastRefill time.Time
+}
+
+func (bucket *peerRateLimitBucket) take(cost float64, now time.Time) bool {
+	if now.After(bucket.lastRefill) {
+		bucket.tokens = math.Min(bucket.limit.Burst,
+			bucket.tokens+now.Sub(bucket.lastRefill).Seconds()*bucket.limit.RequestsPerSecond)
+		bucket.lastRefill = now
+	}
+	// A request that costs more than the burst needs a full bucket, so it can still get through.
+	cost = math.Min(cost, bucket.limit.Burst)
+	if bucket.tokens < cost {
+		return false
+	}
+	bucket.tokens -= cost
+	return true
+}
+
+// PeerRateLimiter tracks a single peer's budgets. It isn't safe for concurrent use.
+type PeerRateLimiter struct {
+	buckets       map[MsgType]*peerRateLimitBucket
+	maxViolations uint64
+	numViolations uint64
+}
+
+func NewPeerRateLimiter(limits map[MsgType]PeerRateLimit, maxViolations uint64, now time.Time) *PeerRateLimiter {
+	limiter := &PeerRateLimiter{
+		buckets:       make(map[MsgType]*peerRateLimitBucket),
+		maxViolations: maxViolations,
+	}
+	for msgType, limit := range limits {
+		limiter.buckets[msgType] = &peerRateLimitBucket{
+			limit:      limit,
+			tokens:     limit.Burst,
+			lastRefill: now,
+		}
+	}
+	return limiter
+}
+
+// Allow takes the cost of a request from the peer's budget for the message type. It returns
+// whether the request is within the budget, and whether the peer has sent more than
+// maxViolations requests in a row that weren't, in which case it should be disconnected.
+func (limiter *PeerRateLimiter) Allow(msgType MsgType, cost uint64, now time.Time) (
+	_allowed bool, _shouldDisconnect bool) {
+
+	bucket, exists := limiter.buckets[msgType]
+	if !exists || bucket.take(float64(cost), now) {
+		limiter.numViolations = 0
+		return true, false
+	}
+	limiter.numViolations++
+	return false, limiter.numViolations > limiter.maxViolations
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerRateLimiter(t *testing.T) {
+	require := require.New(t)
+
+	// Overrides replace the defaults for their message type, and a rate of zero removes the limit.
+	limits, err := ParsePeerRateLimits([]string{"GET_SNAPSHOT:2:5", " get_headers:0:1 "})
+	require.NoError(err)
+	require.Equal(PeerRateLimit{RequestsPerSecond: 2, Burst: 5}, limits[MsgTypeGetSnapshot])
+	require.Equal(DefaultPeerRateLimits()[MsgTypeGetBlocks], limits[MsgTypeGetBlocks])
+	require.NotContains(limits, MsgTypeGetHeaders)
+	for _, invalidEntry := range []string{"GET_SNAPSHOT:2", "INV:1:1", "GET_BLOCKS:x:1", "GET_BLOCKS:1:0"} {
+		_, err = ParsePeerRateLimits([]string{invalidEntry})
+		require.Error(err, invalidEntry)
+	}
+
+	// The peer can use its whole burst at once.
+	now := time.Unix(1700000000, 0)
+	limiter := NewPeerRateLimiter(limits, 2, now)
+	for ii := 0; ii < 5; ii++ {
+		allowed, shouldDisconnect := limiter.Allow(MsgTypeGetSnapshot, 1, now)
+		require.True(allowed)
+		require.False(shouldDisconnect)
+	}
+
+	// Requests over budget are dropped, and the budget refills over time.
+	allowed, shouldDisconnect := limiter.Allow(MsgTypeGetSnapshot, 1, now)
+	require.False(allowed)
+	require.False(shouldDisconnect)
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = limiter.Allow(MsgTypeGetSnapshot, 1, now)
+	require.True(allowed)
+	allowed, _ = limiter.Allow(MsgTypeGetSnapshot, 1, now)
+	require.False(allowed)
+
+	// Message types without a limit are always allowed, and each type has its own budget.
+	for ii := 0; ii < 100; ii++ {
+		allowed, _ = limiter.Allow(MsgTypeGetHeaders, 1, now)
+		require.True(allowed)
+	}
+	allowed, _ = limiter.Allow(MsgTypeGetBlocks, MaxBlocksInFlightPoS, now)
+	require.True(allowed)
+	allowed, _ = limiter.Allow(MsgTypeGetBlocks, 1, now)
+	require.False(allowed)
+
+	// A peer that keeps sending requests over budget is disconnected.
+	allowed, shouldDisconnect = limiter.Allow(MsgTypeGetSnapshot, 1, now)
+	require.False(allowed)
+	require.False(shouldDisconnect)
+	allowed, shouldDisconnect = limiter.Allow(MsgTypeGetSnapshot, 1, now)
+	require.False(allowed)
+	require.True(shouldDisconnect)
+
+	// Requests that cost more than the burst get through once the budget is full.
+	now = now.Add(time.Minute)
+	allowed, _ = limiter.Allow(MsgTypeGetSnapshot, 10, now)
+	require.True(allowed)
+}
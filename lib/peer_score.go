@@ -0,0 +1,432 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// The node used to treat every peer the same: the sync peer was whichever candidate it happened
+// to iterate over last, and a peer that sent invalid data was disconnected, only to be connected
+// to again shortly after.
+//
+// The PeerScoreManager keeps a score for each peer IP address, built from what the peer did for
+// us: the latency of its pongs, the invalid messages it sent, the requests it stalled on, and the
+// bytes of blocks, headers, and snapshot chunks it served. The scores are saved in the DB, so
+// they carry over restarts and reconnects. The ConnectionManager records the events, the server
+// prefers the peers with the highest scores for sync, and a peer whose score drops to
+// PeerScoreBanThreshold is banned for PeerScoreBanDuration: it's disconnected, and we neither
+// accept nor make connections to its IP address until the ban expires. Penalties are halved every
+// PeerScoreDecayPeriod, so a peer that misbehaved once is eventually forgiven.
+//
+// Operators can inspect the scores, and override a peer's score to pin it as a good peer or to
+// ban it indefinitely.
+
+const (
+	// PeerScoreBanThreshold is the score at or below which a peer is banned.
+	PeerScoreBanThreshold = -100
+	PeerScoreBanDuration  = 24 * time.Hour
+	PeerScoreDecayPeriod  = 24 * time.Hour
+
+	// Each invalid message and each stall takes this many points off the score.
+	PeerScoreInvalidMessagePenalty = 20
+	PeerScoreStallPenalty          = 10
+	// A peer gets a point for each PeerScoreBytesServedPerPoint bytes it served us, up to
+	// PeerScoreMaxBytesServedPoints points.
+	PeerScoreBytesServedPerPoint  = 1 << 20
+	PeerScoreMaxBytesServedPoints = 100
+	// A peer loses a point for each PeerScoreLatencyMicrosPerPoint of latency, up to
+	// PeerScoreMaxLatencyPoints points.
+	PeerScoreLatencyMicrosPerPoint = 100000
+	PeerScoreMaxLatencyPoints      = 50
+
+	peerScoreFlushInterval = 60 * time.Second
+)
+
+// PeerScore is what we know about the peers at an IP address.
+type PeerScore struct {
+	IP string
+
+	// LatencyMicros is a moving average of the peer's ping latency.
+	LatencyMicros      uint64
+	NumInvalidMessages uint64
+	NumStalls          uint64
+	BytesServed        uint64
+
+	// If HasOverride is set, the score is OverrideScore no matter what the peer did.
+	HasOverride   bool
+	OverrideScore int64
+
+	// BannedUntil is the unix time in seconds until which the peer is banned.
+	BannedUntil int64
+	// LastDecayed is the unix time in seconds at which the penalties were last halved.
+	LastDecayed int64
+}
+
+// Score combines the peer's stats into a single score. Higher is better.
+func (score *PeerScore) Score() int64 {
+	if score.HasOverride {
+		return score.OverrideScore
+	}
+	bytesServedPoints := score.BytesServed / PeerScoreBytesServedPerPoint
+	if bytesServedPoints > PeerScoreMaxBytesServedPoints {
+		bytesServedPoints = PeerScoreMaxBytesServedPoints
+	}
+	latencyPoints := score.LatencyMicros / PeerScoreLatencyMicrosPerPoint
+	if latencyPoints > PeerScoreMaxLatencyPoints {
+		latencyPoints = PeerScoreMaxLatencyPoints
+	}
+	return int64(bytesServedPoints) - int64(latencyPoints) -
+		int64(score.NumInvalidMessages*PeerScoreInvalidMessagePenalty) - int64(score.NumStalls*PeerScoreStallPenalty)
+}
+
+// IsBanned returns true if we shouldn't connect to the peer at the given time.
+func (score *PeerScore) IsBanned(now time.Time) bool {
+	if score.HasOverride {
+		return score.OverrideScore <= PeerScoreBanThreshold
+	}
+	return now.Unix() < score.BannedUntil
+}
+
+// decay halves the penalties once for every PeerScoreDecayPeriod since they were last halved.
+func (score *PeerScore) decay(now time.Time) {
+	decayPeriodSeconds := int64(PeerScoreDecayPeriod / time.Second)
+	for ; now.Unix()-score.LastDecayed >= decayPeriodSeconds; score.LastDecayed += decayPeriodSeconds {
+		if score.NumInvalidMessages == 0 && score.NumStalls == 0 {
+			score.LastDecayed = now.Unix()
+			break
+		}
+		score.NumInvalidMessages /= 2
+		score.NumStalls /= 2
+	}
+}
+
+func (score *PeerScore) copy() *PeerScore {
+	scoreCopy := *score
+	return &scoreCopy
+}
+
+func (score *PeerScore) ToBytes() []byte {
+	var data []byte
+	data = append(data, EncodeByteArray([]byte(score.IP))...)
+	data = append(data, UintToBuf(score.LatencyMicros)...)
+	data = append(data, UintToBuf(score.NumInvalidMessages)...)
+	data = append(data, UintToBuf(score.NumStalls)...)
+	data = append(data, UintToBuf(score.BytesServed)...)
+	data = append(data, BoolToByte(score.HasOverride))
+	data = append(data, IntToBuf(score.OverrideScore)...)
+	data = append(data, IntToBuf(score.BannedUntil)...)
+	data = append(data, IntToBuf(score.LastDecayed)...)
+	return data
+}
+
+func (score *PeerScore) FromBytes(rr *bytes.Reader) error {
+	ipBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading IP")
+	}
+	score.IP = string(ipBytes)
+	if score.LatencyMicros, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading LatencyMicros")
+	}
+	if score.NumInvalidMessages, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading NumInvalidMessages")
+	}
+	if score.NumStalls, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading NumStalls")
+	}
+	if score.BytesServed, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading BytesServed")
+	}
+	if score.HasOverride, err = ReadBoolByte(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading HasOverride")
+	}
+	if score.OverrideScore, err = ReadVarint(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading OverrideScore")
+	}
+	if score.BannedUntil, err = ReadVarint(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading BannedUntil")
+	}
+	if score.LastDecayed, err = ReadVarint(rr); err != nil {
+		return errors.Wrapf(err, "PeerScore.FromBytes: Problem reading LastDecayed")
+	}
+	return nil
+}
+
+// PeerScoreManager keeps the scores of the peers we've been connected to.
+type PeerScoreManager struct {
+	// db is where the scores are saved. If it's nil, the scores are only kept in memory.
+	db *badger.DB
+
+	mtx    sync.Mutex
+	scores map[string]*PeerScore
+	// dirty holds the IPs whose scores changed since they were last saved.
+	dirty map[string]bool
+
+	stopChannel chan struct{}
+	waitGroup   sync.WaitGroup
+}
+
+// NewPeerScoreManager loads the scores saved in the DB.
+func NewPeerScoreManager(db *badger.DB) (*PeerScoreManager, error) {
+	manager := &PeerScoreManager{
+		db:          db,
+		scores:      make(map[string]*PeerScore),
+		dirty:       make(map[string]bool),
+		stopChannel: make(chan struct{}),
+	}
+	if db == nil {
+		return manager, nil
+	}
+	scores, err := DBGetAllPeerScores(db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewPeerScoreManager: ")
+	}
+	for _, score := range scores {
+		manager.scores[score.IP] = score
+	}
+	return manager, nil
+}
+
+// Start periodically saves the scores that changed.
+func (manager *PeerScoreManager) Start() {
+	manager.waitGroup.Add(1)
+	go func() {
+		defer manager.waitGroup.Done()
+		ticker := time.NewTicker(peerScoreFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-manager.stopChannel:
+				return
+			case <-ticker.C:
+				if err := manager.Flush(); err != nil {
+					glog.Errorf("PeerScoreManager: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops saving the scores periodically and saves the ones that changed.
+func (manager *PeerScoreManager) Stop() {
+	close(manager.stopChannel)
+	manager.waitGroup.Wait()
+	if err := manager.Flush(); err != nil {
+		glog.Errorf("PeerScoreManager.Stop: %v", err)
+	}
+}
+
+// Flush saves the scores that changed since they were last saved.
+func (manager *PeerScoreManager) Flush() error {
+	manager.mtx.Lock()
+	var scores []*PeerScore
+	for ip := range manager.dirty {
+		scores = append(scores, manager.scores[ip].copy())
+	}
+	manager.dirty = make(map[string]bool)
+	manager.mtx.Unlock()
+
+	if manager.db == nil || len(scores) == 0 {
+		return nil
+	}
+	err := manager.db.Update(func(txn *badger.Txn) error {
+		for _, score := range scores {
+			if err := DBPutPeerScoreWithTxn(txn, score); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Flush: Problem saving (%v) peer scores", len(scores))
+	}
+	return nil
+}
+
+// updateScore applies the update to the IP's score and returns true if the update got the peer
+// banned. It must be called with the mtx held.
+func (manager *PeerScoreManager) updateScore(ip string, update func(score *PeerScore)) (_banned bool) {
+	now := time.Now()
+	score, exists := manager.scores[ip]
+	if !exists {
+		score = &PeerScore{IP: ip, LastDecayed: now.Unix()}
+		manager.scores[ip] = score
+	}
+	score.decay(now)
+	wasBanned := score.IsBanned(now)
+	update(score)
+	if !score.HasOverride && !wasBanned && score.Score() <= PeerScoreBanThreshold {
+		score.BannedUntil = now.Add(PeerScoreBanDuration).Unix()
+		glog.Infof(CLog(Yellow, fmt.Sprintf("PeerScoreManager: Banning peer (%v) until (%v) with score (%v)",
+			ip, time.Unix(score.BannedUntil, 0), score.Score())))
+	}
+	manager.dirty[ip] = true
+	return !wasBanned && score.IsBanned(now)
+}
+
+func (manager *PeerScoreManager) RecordLatency(ip string, latencyMicros uint64) {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	manager.updateScore(ip, func(score *PeerScore) {
+		if score.LatencyMicros == 0 {
+			score.LatencyMicros = latencyMicros
+		} else {
+			score.LatencyMicros = (3*score.LatencyMicros + latencyMicros) / 4
+		}
+	})
+}
+
+// RecordInvalidMessage returns true if the peer got banned for the message.
+func (manager *PeerScoreManager) RecordInvalidMessage(ip string) (_banned bool) {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	return manager.updateScore(ip, func(score *PeerScore) {
+		score.NumInvalidMessages++
+	})
+}
+
+// RecordStall returns true if the peer got banned for the stall.
+func (manager *PeerScoreManager) RecordStall(ip string) (_banned bool) {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	return manager.updateScore(ip, func(score *PeerScore) {
+		score.NumStalls++
+	})
+}
+
+func (manager *PeerScoreManager) RecordBytesServed(ip string, numBytes uint64) {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	manager.updateScore(ip, func(score *PeerScore) {
+		score.BytesServed += numBytes
+	})
+}
+
+// GetScore returns a copy of the IP's score, or nil if we don't have one.
+func (manager *PeerScoreManager) GetScore(ip string) *PeerScore {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	score, exists := manager.scores[ip]
+	if !exists {
+		return nil
+	}
+	score.decay(time.Now())
+	return score.copy()
+}
+
+// GetAllScores returns copies of all the scores, sorted from the highest score to the lowest.
+func (manager *PeerScoreManager) GetAllScores() []*PeerScore {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	now := time.Now()
+	var scores []*PeerScore
+	for _, score := range manager.scores {
+		score.decay(now)
+		scores = append(scores, score.copy())
+	}
+	sort.Slice(scores, func(ii, jj int) bool {
+		if scores[ii].Score() != scores[jj].Score() {
+			return scores[ii].Score() > scores[jj].Score()
+		}
+		return scores[ii].IP < scores[jj].IP
+	})
+	return scores
+}
+
+// IsBanned returns true if we shouldn't connect to the IP.
+func (manager *PeerScoreManager) IsBanned(ip string) bool {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	score, exists := manager.scores[ip]
+	return exists && score.IsBanned(time.Now())
+}
+
+// SetOverride pins the IP's score. A score at or below PeerScoreBanThreshold bans the IP until
+// the override is cleared.
+func (manager *PeerScoreManager) SetOverride(ip string, overrideScore int64) {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	manager.updateScore(ip, func(score *PeerScore) {
+		score.HasOverride = true
+		score.OverrideScore = overrideScore
+	})
+}
+
+// ClearOverride goes back to scoring the IP by what the peer did.
+func (manager *PeerScoreManager) ClearOverride(ip string) {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	manager.updateScore(ip, func(score *PeerScore) {
+		score.HasOverride = false
+		score.OverrideScore = 0
+	})
+}
+
+// Reset forgets everything the peer did, lifting any ban. The override, if any, is kept.
+func (manager *PeerScoreManager) Reset(ip string) {
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+
+	manager.updateScore(ip, func(score *PeerScore) {
+		*score = PeerScore{
+			IP:            ip,
+			HasOverride:   score.HasOverride,
+			OverrideScore: score.OverrideScore,
+			LastDecayed:   time.Now().Unix(),
+		}
+	})
+}
+
+// ==================================================================
+// DB
+// ==================================================================
+
+func _dbKeyForPeerScore(ip string) []byte {
+	return append(append([]byte{}, Prefixes.PrefixPeerScoreByIP...), []byte(ip)...)
+}
+
+func DBPutPeerScoreWithTxn(txn *badger.Txn, score *PeerScore) error {
+	return txn.Set(_dbKeyForPeerScore(score.IP), score.ToBytes())
+}
+
+func DBGetAllPeerScores(handle *badger.DB) ([]*PeerScore, error) {
+	var scores []*PeerScore
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = Prefixes.PrefixPeerScoreByIP
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		for iterator.Seek(Prefixes.PrefixPeerScoreByIP); iterator.ValidForPrefix(Prefixes.PrefixPeerScoreByIP); iterator.Next() {
+			scoreBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			score := &PeerScore{}
+			if err = score.FromBytes(bytes.NewReader(scoreBytes)); err != nil {
+				return err
+			}
+			scores = append(scores, score)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetAllPeerScores: ")
+	}
+	return scores, nil
+}
@@ -0,0 +1,86 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerScore(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	manager, err := NewPeerScoreManager(db)
+	require.NoError(err)
+
+	goodIP := "1.2.3.4"
+	badIP := "5.6.7.8"
+	require.Nil(manager.GetScore(goodIP))
+	require.False(manager.IsBanned(goodIP))
+
+	// Serving bytes raises the score, up to a cap, and latency lowers it.
+	manager.RecordBytesServed(goodIP, 10*PeerScoreBytesServedPerPoint)
+	require.Equal(int64(10), manager.GetScore(goodIP).Score())
+	manager.RecordBytesServed(goodIP, 1000*PeerScoreBytesServedPerPoint)
+	require.Equal(int64(PeerScoreMaxBytesServedPoints), manager.GetScore(goodIP).Score())
+	manager.RecordLatency(goodIP, 4*PeerScoreLatencyMicrosPerPoint)
+	require.Equal(int64(PeerScoreMaxBytesServedPoints-4), manager.GetScore(goodIP).Score())
+	manager.RecordLatency(goodIP, 0)
+	require.Equal(uint64(3*PeerScoreLatencyMicrosPerPoint), manager.GetScore(goodIP).LatencyMicros)
+
+	// A peer that keeps sending invalid messages gets banned exactly once.
+	numBans := 0
+	for ii := 0; ii < 10; ii++ {
+		if manager.RecordInvalidMessage(badIP) {
+			numBans++
+		}
+	}
+	require.Equal(1, numBans)
+	require.True(manager.IsBanned(badIP))
+	require.False(manager.IsBanned(goodIP))
+	require.Equal(uint64(10), manager.GetScore(badIP).NumInvalidMessages)
+
+	// The scores are sorted from the best to the worst.
+	allScores := manager.GetAllScores()
+	require.Len(allScores, 2)
+	require.Equal(goodIP, allScores[0].IP)
+	require.Equal(badIP, allScores[1].IP)
+
+	// The override takes precedence, and a low override bans the peer.
+	manager.SetOverride(goodIP, PeerScoreBanThreshold)
+	require.True(manager.IsBanned(goodIP))
+	require.Equal(int64(PeerScoreBanThreshold), manager.GetScore(goodIP).Score())
+	manager.ClearOverride(goodIP)
+	require.False(manager.IsBanned(goodIP))
+	manager.SetOverride(badIP, 1000)
+	require.False(manager.IsBanned(badIP))
+	manager.ClearOverride(badIP)
+	require.True(manager.IsBanned(badIP))
+
+	// Resetting the score lifts the ban.
+	manager.Reset(badIP)
+	require.False(manager.IsBanned(badIP))
+	require.Equal(int64(0), manager.GetScore(badIP).Score())
+
+	// The penalties are halved for every decay period that passed.
+	score := &PeerScore{IP: badIP, NumInvalidMessages: 8, NumStalls: 3}
+	score.decay(time.Unix(int64(2*PeerScoreDecayPeriod/time.Second)+5, 0))
+	require.Equal(uint64(2), score.NumInvalidMessages)
+	require.Equal(uint64(0), score.NumStalls)
+	require.Equal(int64(2*PeerScoreDecayPeriod/time.Second), score.LastDecayed)
+
+	// The scores round-trip through their encoding and through the DB.
+	manager.RecordStall(badIP)
+	decodedScore := &PeerScore{}
+	require.NoError(decodedScore.FromBytes(bytes.NewReader(manager.GetScore(goodIP).ToBytes())))
+	require.Equal(manager.GetScore(goodIP), decodedScore)
+	require.NoError(manager.Flush())
+	loadedManager, err := NewPeerScoreManager(db)
+	require.NoError(err)
+	require.Equal(manager.GetAllScores(), loadedManager.GetAllScores())
+}
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -29,6 +31,11 @@ type PosBlockProducer struct {
 	proposerVotingPublicKey        *bls.PublicKey
 	previousBlockTimestampNanoSecs int64
 	mockBlockSignature             *bls.Signature
+	// relayPolicy is the operator's policy for leaving txns out of blocks. It can be nil.
+	relayPolicy *RelayPolicy
+	// blockAssemblyPolicy is the operator's policy for reserving block space for certain txn
+	// types. It can be nil.
+	blockAssemblyPolicy *BlockAssemblyPolicy
 }
 
 func NewPosBlockProducer(
@@ -296,8 +303,9 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 	_maxUtilityFee uint64,
 	_err error,
 ) {
-	// Get Fee-Time ordered transactions from the mempool
-	feeTimeTxns := pbp.mp.GetTransactions()
+	// Get Fee-Time ordered transactions from the mempool, with the txns the operator reserved
+	// block space for moved to the front.
+	feeTimeTxns := pbp.blockAssemblyPolicy.OrderTxnsForBlock(pbp.mp.GetTransactions(), softMaxBlockSizeBytes)
 	// Try to connect transactions one by one.
 	blocksTxns := []*MsgDeSoTxn{}
 	maxUtilityFee := uint64(0)
@@ -323,6 +331,11 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 			continue
 		}
 
+		// Skip over transactions the operator's relay policy excludes from blocks.
+		if pbp.relayPolicy.ShouldExcludeTransactionFromBlock(txn.Tx, pbp.params) {
+			continue
+		}
+
 		// Connect the transaction to the SafeUtxoView to test if it connects.
 		_, _, _, fees, err := safeUtxoView.ConnectTransaction(
 			txn.Tx, txn.Hash, uint32(newBlockHeight), newBlockTimestampNanoSecs, true, false,
@@ -369,6 +369,22 @@ func (bc *Blockchain) processBlockPoS(block *MsgDeSoBlock, currentView uint64, v
 		return false, false, nil, errors.Wrap(err, "processBlockPoS: Problem applying new tip: ")
 	}
 
+	// The operations of the disconnected blocks are passed to listeners along with the blocks.
+	// They're computed from the committed tip, so we fetch them before running the commit rule
+	// moves it.
+	utxoOpsForDisconnectedBlocks := make(map[BlockHash][][]*UtxoOperation)
+	if bc.eventManager != nil {
+		for _, disconnectedBlockHash := range disconnectedBlockHashes {
+			viewAndUtxoOps, err := bc.getUtxoViewAndUtxoOpsAtBlockHash(disconnectedBlockHash)
+			if err != nil {
+				glog.Errorf("processBlockPoS: Problem getting UtxoOps for disconnected block %v: %v",
+					disconnectedBlockHash, err)
+				continue
+			}
+			utxoOpsForDisconnectedBlocks[disconnectedBlockHash] = viewAndUtxoOps.UtxoOps
+		}
+	}
+
 	// 6. Commit grandparent if possible. Only need to do this if we applied a new tip.
 	if appliedNewTip {
 		if err = bc.runCommitRuleOnBestChain(verifySignatures); err != nil {
@@ -385,7 +401,10 @@ func (bc *Blockchain) processBlockPoS(block *MsgDeSoBlock, currentView uint64, v
 			continue
 		}
 		if bc.eventManager != nil {
-			bc.eventManager.blockDisconnected(&BlockEvent{Block: disconnectedBlock})
+			bc.eventManager.blockDisconnected(&BlockEvent{
+				Block:   disconnectedBlock,
+				UtxoOps: utxoOpsForDisconnectedBlocks[disconnectedBlockHashes[ii]],
+			})
 		}
 	}
 	for ii := 0; ii < len(connectedBlockHashes); ii++ {
@@ -899,6 +918,12 @@ func (bc *Blockchain) isBlockTimestampValidRelativeToParentPoS(header *MsgDeSoHe
 	if header.TstampNanoSecs < parentBlockNode.Header.TstampNanoSecs {
 		return RuleErrorPoSBlockTstampNanoSecsTooOld
 	}
+	// After the median time past fork, the timestamp must also be greater than the
+	// median time past of the parent, so that a run of blocks can't hold time still.
+	if header.Height >= uint64(bc.params.ForkHeights.BlockTimestampMedianTimePastBlockHeight) &&
+		header.TstampNanoSecs <= bc.GetMedianTimePastNanoSecs(parentBlockNode) {
+		return RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast
+	}
 	return nil
 }
 
@@ -939,7 +964,9 @@ func (bc *Blockchain) isBlockTimestampTooFarInFuturePoS(header *MsgDeSoHeader) (
 		return false, errors.Wrapf(err, "isBlockTimestampTooFarInFuturePoS: Problem getting snapshot global params")
 	}
 
-	return header.TstampNanoSecs > time.Now().UnixNano()+snapshotGlobalParams.BlockTimestampDriftNanoSecs, nil
+	blockTimestampDriftNanoSecs := bc.params.getMaxBlockTimestampDriftNanoSecs(
+		snapshotGlobalParams.BlockTimestampDriftNanoSecs, header.Height)
+	return header.TstampNanoSecs > time.Now().UnixNano()+blockTimestampDriftNanoSecs, nil
 }
 
 // isProperlyFormedBlockPoS validates the block at a surface level and makes
@@ -1796,6 +1823,8 @@ func (bc *Blockchain) commitBlockPoS(blockHash *BlockHash, verifySignatures bool
 	if err != nil {
 		return errors.Wrapf(err, "commitBlockPoS: Problem putting block in db: ")
 	}
+	// Now that the flush has committed, let the flush hooks know.
+	bc.eventManager.utxoViewFlushCommitted()
 
 	if bc.snapshot != nil {
 		bc.snapshot.FinishProcessBlock(blockNode)
@@ -1865,7 +1894,8 @@ func (bc *Blockchain) GetUncommittedBlocks(tipHash *BlockHash) ([]*BlockNode, er
 
 // GetCommittedTipView builds a UtxoView to the committed tip.
 func (bc *Blockchain) GetCommittedTipView() *UtxoView {
-	return NewUtxoViewWithSnapshotCache(bc.db, bc.params, bc.postgres, bc.snapshot, nil, bc.snapshotCache)
+	return NewUtxoViewWithSnapshotCache(bc.db, bc.params, bc.postgres, bc.snapshot, nil, bc.storageBackend,
+		bc.snapshotCache)
 }
 
 // BlockViewAndUtxoOps is a struct that contains a UtxoView and the UtxoOperations
@@ -1968,7 +1998,7 @@ func (bc *Blockchain) getUtxoViewAndUtxoOpsAtBlockHash(blockHash BlockHash) (
 	}
 	// Connect the uncommitted blocks to the tip so that we can validate subsequent blocks
 	utxoView := NewUtxoViewWithSnapshotCache(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager,
-		bc.snapshotCache)
+		bc.storageBackend, bc.snapshotCache)
 	// TODO: there's another performance enhancement we can make here. If we have a view in the
 	// cache for one of the ancestors, we can skip fetching the block and connecting it by taking
 	// a copy of it and replacing the existing view.
@@ -2129,6 +2159,7 @@ const (
 	RuleErrorNilPrevBlockHash                                   RuleError = "RuleErrorNilPrevBlockHash"
 	RuleErrorPoSBlockTstampNanoSecsTooOld                       RuleError = "RuleErrorPoSBlockTstampNanoSecsTooOld"
 	RuleErrorPoSBlockTstampNanoSecsInFuture                     RuleError = "RuleErrorPoSBlockTstampNanoSecsInFuture"
+	RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast       RuleError = "RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast"
 	RuleErrorInvalidPoSBlockHeaderVersion                       RuleError = "RuleErrorInvalidPoSBlockHeaderVersion"
 	RuleErrorNoTimeoutOrVoteQC                                  RuleError = "RuleErrorNoTimeoutOrVoteQC"
 	RuleErrorBothTimeoutAndVoteQC                               RuleError = "RuleErrorBothTimeoutAndVoteQC"
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -20,6 +22,9 @@ type FastHotStuffConsensus struct {
 	mempool               Mempool
 	params                *DeSoParams
 	signer                *BLSSigner
+	relayPolicy           *RelayPolicy
+	// blockAssemblyPolicy is passed to the block producers. It can be nil.
+	blockAssemblyPolicy *BlockAssemblyPolicy
 }
 
 func NewFastHotStuffConsensus(
@@ -28,6 +33,7 @@ func NewFastHotStuffConsensus(
 	blockchain *Blockchain,
 	mempool Mempool,
 	signer *BLSSigner,
+	relayPolicy *RelayPolicy,
 ) *FastHotStuffConsensus {
 	return &FastHotStuffConsensus{
 		networkManager:        networkManager,
@@ -36,6 +42,7 @@ func NewFastHotStuffConsensus(
 		mempool:               mempool,
 		params:                params,
 		signer:                signer,
+		relayPolicy:           relayPolicy,
 	}
 }
 
@@ -890,6 +897,8 @@ func (fc *FastHotStuffConsensus) createBlockProducer(bav *UtxoView, previousBloc
 		blockProducerBlsPublicKey,
 		previousBlockTimestampNanoSecs,
 	)
+	blockProducer.relayPolicy = fc.relayPolicy
+	blockProducer.blockAssemblyPolicy = fc.blockAssemblyPolicy
 	return blockProducer, nil
 }
 
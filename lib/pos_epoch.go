@@ -123,7 +123,7 @@ func (bav *UtxoView) GetCurrentEpochEntry() (*EpochEntry, error) {
 	}
 
 	// If not found, check the database.
-	epochEntry, err = DBGetCurrentEpochEntry(bav.Handle, bav.Snapshot)
+	epochEntry, err = bav.GetDbAdapter().GetCurrentEpochEntry()
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetCurrentEpoch: problem retrieving EpochEntry from db: ")
 	}
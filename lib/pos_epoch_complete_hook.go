@@ -84,7 +84,7 @@ func (bav *UtxoView) RunEpochCompleteHook(
 	}
 
 	// Step 2: Run All Snapshotting Operations
-	if err = bav.runEpochCompleteSnapshotGeneration(currentEpochEntry.EpochNumber); err != nil {
+	if err = bav.runEpochCompleteSnapshotGeneration(currentEpochEntry.EpochNumber, blockHeight); err != nil {
 		return nil, errors.Wrapf(err, "RunEpochCompleteHook: ")
 	}
 
@@ -127,7 +127,7 @@ func (bav *UtxoView) runEpochCompleteStateTransition(blockHeight uint64, blockTi
 }
 
 // Generates all required snapshots for the current epoch.
-func (bav *UtxoView) runEpochCompleteSnapshotGeneration(epochNumber uint64) error {
+func (bav *UtxoView) runEpochCompleteSnapshotGeneration(epochNumber uint64, blockHeight uint64) error {
 	// Snapshot the current GlobalParamsEntry.
 	bav._setSnapshotGlobalParamsEntry(bav.GetCurrentGlobalParamsEntry(), epochNumber)
 
@@ -146,6 +146,17 @@ func (bav *UtxoView) runEpochCompleteSnapshotGeneration(epochNumber uint64) erro
 		return errors.Wrapf(err, "runEpochCompleteSnapshotGeneration: problem snapshotting leader schedule: ")
 	}
 
+	// Once staking rewards are accrued on per-validator reward indexes, delegated stakes
+	// no longer need to be snapshotted in order to reward them. The validators' own stakes
+	// are still snapshotted so that their rewards are sized from the same snapshot as the
+	// validator set.
+	if blockHeight >= uint64(bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight) {
+		if err = bav.generateAndSnapshotValidatorStakesToReward(epochNumber, validatorEntries); err != nil {
+			return errors.Wrapf(err, "runEpochCompleteSnapshotGeneration: problem snapshotting validator stakes: ")
+		}
+		return nil
+	}
+
 	// Snapshot the current top n stake entries as the stakes to reward.
 	if err = bav.generateAndSnapshotStakesToReward(epochNumber, validatorEntries); err != nil {
 		return errors.Wrapf(err, "runEpochCompleteSnapshotGeneration: problem snapshotting stakes to reward: ")
@@ -361,3 +372,19 @@ func (bav *UtxoView) generateAndSnapshotStakesToReward(epochNumber uint64, valid
 
 	return nil
 }
+
+// generateAndSnapshotValidatorStakesToReward snapshots each validator's stake to itself as a stake
+// to reward. Delegated stakes accrue their rewards on the validator's reward indexes instead.
+func (bav *UtxoView) generateAndSnapshotValidatorStakesToReward(epochNumber uint64, validatorSet []*ValidatorEntry) error {
+	for _, validatorEntry := range validatorSet {
+		stakeEntry, err := bav.GetStakeEntry(validatorEntry.ValidatorPKID, validatorEntry.ValidatorPKID)
+		if err != nil {
+			return errors.Wrapf(err, "generateAndSnapshotValidatorStakesToReward: error retrieving StakeEntry: ")
+		}
+		if stakeEntry == nil {
+			continue
+		}
+		bav._setSnapshotStakeToReward(stakeEntry.Copy(), epochNumber)
+	}
+	return nil
+}
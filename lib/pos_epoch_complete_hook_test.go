@@ -1,7 +1,10 @@
+//go:build !deso_lean
+
 package lib
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"testing"
 
@@ -835,6 +838,277 @@ func TestStakingRewardDistribution(t *testing.T) {
 
 }
 
+func TestStakingRewardAccrualWarmup(t *testing.T) {
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+	// Initialize PoS fork heights, with delegated staking rewards accrued from the start.
+	setPoSBlockHeights(t, 11, 11)
+	DeSoTestnetParams.ForkHeights.StakingRewardsAccrualBlockHeight = uint32(11)
+	DeSoTestnetParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&DeSoTestnetParams.ForkHeights)
+	DeSoTestnetParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&DeSoTestnetParams.ForkHeights)
+	GlobalDeSoParams = DeSoTestnetParams
+	t.Cleanup(func() {
+		DeSoTestnetParams.ForkHeights.StakingRewardsAccrualBlockHeight = uint32(math.MaxUint32)
+		DeSoTestnetParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&DeSoTestnetParams.ForkHeights)
+		DeSoTestnetParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&DeSoTestnetParams.ForkHeights)
+		GlobalDeSoParams = DeSoTestnetParams
+	})
+	// Initialize test chain, miner, and testMeta
+	testMeta := _setUpMinerAndTestMetaForEpochCompleteTest(t)
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e3)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(testMeta.db, testMeta.chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(testMeta.db, testMeta.chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(testMeta.db, testMeta.chain.snapshot, m2PkBytes).PKID
+
+	blockHeight := uint64(testMeta.chain.blockTip().Height) + 1
+	incrBlockHeight := func() uint64 {
+		blockHeight += 1
+		return blockHeight
+	}
+	viewNumber := uint64(0)
+	incrViewNumber := func() uint64 {
+		viewNumber += 1
+		return viewNumber
+	}
+	getUnsettledStakeRewardNanos := func(stakerPKID *PKID) uint64 {
+		unsettledRewardNanos, err := _newUtxoView(testMeta).GetUnsettledStakeRewardNanos(m0PKID, stakerPKID, blockHeight)
+		require.NoError(t, err)
+		return unsettledRewardNanos
+	}
+	getM0BalanceNanos := func() uint64 {
+		balanceNanos, err := _newUtxoView(testMeta).GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+		require.NoError(t, err)
+		return balanceNanos
+	}
+
+	// Seed a CurrentEpochEntry.
+	tmpUtxoView := _newUtxoView(testMeta)
+	tmpUtxoView._setCurrentEpochEntry(&EpochEntry{EpochNumber: 2, FinalBlockHeight: blockHeight + 1})
+	require.NoError(t, tmpUtxoView.FlushToDb(blockHeight))
+
+	// For these tests, we set each epoch duration to only one block.
+	testMeta.params.DefaultEpochDurationNumBlocks = uint64(1)
+
+	// We set the default staking rewards APY to 10%
+	testMeta.params.DefaultStakingRewardsAPYBasisPoints = uint64(1000)
+
+	// m0 registers with a 20% commission rate and stakes 400 nanos to itself, and m1
+	// delegates 100 nanos to m0. All rewards are paid out rather than restaked.
+	_registerValidatorAndStake(testMeta, m0Pub, m0Priv, 2000, 400, false)
+	_stakeToValidator(testMeta, m1Pub, m1Priv, m0Pub, 100, false)
+
+	// Run the OnEpochCompleteHook() twice so that m0 is in the snapshot validator set.
+	incrViewNumber()
+	_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+	incrViewNumber()
+	_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+	require.Zero(t, getUnsettledStakeRewardNanos(m1PKID))
+
+	// m2 delegates 100 nanos to m0 just before the epoch ends.
+	_stakeToValidator(testMeta, m2Pub, m2Priv, m0Pub, 100, false)
+	m2StakeEntry, err := _newUtxoView(testMeta).GetStakeEntry(m0PKID, m2PKID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), m2StakeEntry.WarmupStakeAmountNanos.Uint64())
+	validatorEntry, err := _newUtxoView(testMeta).GetValidatorByPKID(m0PKID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(600), validatorEntry.TotalStakeAmountNanos.Uint64())
+	require.Equal(t, uint64(100), validatorEntry.WarmupStakeAmountNanos.Uint64())
+
+	{
+		// Run the OnEpochCompleteHook(). This is the first epoch where staking rewards are
+		// distributed, and exactly 1 year has passed since the previous epoch.
+		m0BalanceNanos := getM0BalanceNanos()
+		incrViewNumber()
+		_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+
+		// m0's reward is computed on its own stake and m1's stake only:
+		// - m0's reward from its own stake is: 400 * [e^0.1 - 1] = 42 nanos
+		// - m0's commission is: 100 * [e^0.1 - 1] * 0.2 = 2 nanos
+		require.Equal(t, m0BalanceNanos+42+2, getM0BalanceNanos())
+
+		// m1 accrues 100 * [e^0.1 - 1] * 0.8 = 8 nanos, while m2 doesn't earn anything
+		// for the epoch it staked in.
+		require.Equal(t, uint64(8), getUnsettledStakeRewardNanos(m1PKID))
+		require.Zero(t, getUnsettledStakeRewardNanos(m2PKID))
+	}
+
+	{
+		// Run the OnEpochCompleteHook(). m2's stake has now been in place for a whole epoch.
+		m0BalanceNanos := getM0BalanceNanos()
+		incrViewNumber()
+		_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+
+		// m0's commission is sized from the snapshot validator set, which was taken before
+		// m2 staked: 100 * [e^0.1 - 1] * 0.2 = 2 nanos.
+		require.Equal(t, m0BalanceNanos+42+2, getM0BalanceNanos())
+
+		// m2 accrues the same reward for this epoch as m1 does.
+		require.Equal(t, uint64(16), getUnsettledStakeRewardNanos(m1PKID))
+		require.Equal(t, uint64(8), getUnsettledStakeRewardNanos(m2PKID))
+	}
+
+	{
+		// Run the OnEpochCompleteHook(). The snapshot validator set now includes m2's stake.
+		m0BalanceNanos := getM0BalanceNanos()
+		incrViewNumber()
+		_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+
+		// m0's commission now includes m2's stake: 200 * [e^0.1 - 1] * 0.2 = 4 nanos.
+		require.Equal(t, m0BalanceNanos+42+4, getM0BalanceNanos())
+
+		// Accrued rewards are rounded down once over all of a stake's epochs rather than per
+		// epoch, so m1 has 3 * 100 * [e^0.1 - 1] * 0.8 = 25 nanos.
+		require.Equal(t, uint64(25), getUnsettledStakeRewardNanos(m1PKID))
+		require.Equal(t, uint64(16), getUnsettledStakeRewardNanos(m2PKID))
+	}
+}
+
+func TestStakingRewardAccrualSettlement(t *testing.T) {
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+	// Initialize PoS fork heights, with delegated staking rewards accrued from the start.
+	setPoSBlockHeights(t, 11, 11)
+	DeSoTestnetParams.ForkHeights.StakingRewardsAccrualBlockHeight = uint32(11)
+	DeSoTestnetParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&DeSoTestnetParams.ForkHeights)
+	DeSoTestnetParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&DeSoTestnetParams.ForkHeights)
+	GlobalDeSoParams = DeSoTestnetParams
+	t.Cleanup(func() {
+		DeSoTestnetParams.ForkHeights.StakingRewardsAccrualBlockHeight = uint32(math.MaxUint32)
+		DeSoTestnetParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&DeSoTestnetParams.ForkHeights)
+		DeSoTestnetParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&DeSoTestnetParams.ForkHeights)
+		GlobalDeSoParams = DeSoTestnetParams
+	})
+	// Initialize test chain, miner, and testMeta
+	testMeta := _setUpMinerAndTestMetaForEpochCompleteTest(t)
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e3)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(testMeta.db, testMeta.chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(testMeta.db, testMeta.chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(testMeta.db, testMeta.chain.snapshot, m2PkBytes).PKID
+
+	blockHeight := uint64(testMeta.chain.blockTip().Height) + 1
+	incrBlockHeight := func() uint64 {
+		blockHeight += 1
+		return blockHeight
+	}
+	viewNumber := uint64(0)
+	incrViewNumber := func() uint64 {
+		viewNumber += 1
+		return viewNumber
+	}
+	getUnsettledStakeRewardNanos := func(stakerPKID *PKID) uint64 {
+		unsettledRewardNanos, err := _newUtxoView(testMeta).GetUnsettledStakeRewardNanos(m0PKID, stakerPKID, blockHeight)
+		require.NoError(t, err)
+		return unsettledRewardNanos
+	}
+	getValidatorEntry := func() *ValidatorEntry {
+		validatorEntry, err := _newUtxoView(testMeta).GetValidatorByPKID(m0PKID)
+		require.NoError(t, err)
+		return validatorEntry
+	}
+	getRestakedRewardNanos := func() uint64 {
+		restakedRewardNanos, err := _newUtxoView(testMeta).GetRestakedRewardNanos(m0PKID)
+		require.NoError(t, err)
+		return restakedRewardNanos.Uint64()
+	}
+	requireCorrectTotalStakeAmountNanos := func() {
+		isCorrect, err := _newUtxoView(testMeta).IsCorrectValidatorTotalStakeAmountNanos(getValidatorEntry())
+		require.NoError(t, err)
+		require.True(t, isCorrect)
+	}
+
+	// Seed a CurrentEpochEntry.
+	tmpUtxoView := _newUtxoView(testMeta)
+	tmpUtxoView._setCurrentEpochEntry(&EpochEntry{EpochNumber: 2, FinalBlockHeight: blockHeight + 1})
+	require.NoError(t, tmpUtxoView.FlushToDb(blockHeight))
+
+	// For these tests, we set each epoch duration to only one block.
+	testMeta.params.DefaultEpochDurationNumBlocks = uint64(1)
+
+	// We set the default staking rewards APY to 10%
+	testMeta.params.DefaultStakingRewardsAPYBasisPoints = uint64(1000)
+
+	// m0 registers with a 20% commission rate and stakes 400 nanos to itself. m1 delegates
+	// 100 nanos to m0 and is paid its rewards, while m2 delegates 100 nanos and restakes them.
+	_registerValidatorAndStake(testMeta, m0Pub, m0Priv, 2000, 400, false)
+	_stakeToValidator(testMeta, m1Pub, m1Priv, m0Pub, 100, false)
+	_stakeToValidator(testMeta, m2Pub, m2Priv, m0Pub, 100, true)
+
+	// Run the OnEpochCompleteHook() twice so that m0 is in the snapshot validator set.
+	incrViewNumber()
+	_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+	incrViewNumber()
+	_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+	require.Equal(t, uint64(600), getValidatorEntry().TotalStakeAmountNanos.Uint64())
+
+	{
+		// Run the OnEpochCompleteHook(). This is the first epoch where staking rewards are distributed.
+		incrViewNumber()
+		_runOnEpochCompleteHook(testMeta, incrBlockHeight(), viewNumber, viewNumber-1)
+
+		// m1 and m2 each accrue 100 * [e^0.1 - 1] * 0.8 = 8 nanos.
+		require.Equal(t, uint64(8), getUnsettledStakeRewardNanos(m1PKID))
+		require.Equal(t, uint64(8), getUnsettledStakeRewardNanos(m2PKID))
+
+		// m2's restaked reward is added to m0's stake right away, before it's settled.
+		require.Equal(t, uint64(608), getValidatorEntry().TotalStakeAmountNanos.Uint64())
+		require.Equal(t, uint64(8), getRestakedRewardNanos())
+		requireCorrectTotalStakeAmountNanos()
+	}
+
+	// Reset the UniversalUtxoView so that it picks up the entries that the OnEpochCompleteHook() flushed.
+	testMeta.mempool.universalUtxoView._ResetViewMappingsAfterFlush()
+
+	{
+		// m1 unstakes 50 nanos. Its reward is paid straight to its balance, and only
+		// the unstaked amount is locked.
+		m1BalanceNanos := _getBalance(t, testMeta.chain, testMeta.mempool, m1Pub)
+		feeNanos, err := _submitUnstakeTxn(testMeta, m1Pub, m1Priv, &UnstakeMetadata{
+			ValidatorPublicKey: NewPublicKey(m0PkBytes),
+			UnstakeAmountNanos: uint256.NewInt().SetUint64(50),
+		}, nil, true)
+		require.NoError(t, err)
+		require.Equal(t, m1BalanceNanos-feeNanos+8, _getBalance(t, testMeta.chain, testMeta.mempool, m1Pub))
+		require.Zero(t, getUnsettledStakeRewardNanos(m1PKID))
+
+		currentEpochNumber, err := _newUtxoView(testMeta).GetCurrentEpochNumber()
+		require.NoError(t, err)
+		lockedStakeEntry, err := _newUtxoView(testMeta).GetLockedStakeEntry(m0PKID, m1PKID, currentEpochNumber)
+		require.NoError(t, err)
+		require.Equal(t, uint64(50), lockedStakeEntry.LockedAmountNanos.Uint64())
+
+		require.Equal(t, uint64(558), getValidatorEntry().TotalStakeAmountNanos.Uint64())
+		require.Equal(t, uint64(8), getRestakedRewardNanos())
+		requireCorrectTotalStakeAmountNanos()
+	}
+
+	{
+		// m2 unstakes 50 nanos. Its restaked reward is settled into its stake first, and taken
+		// out of m0's restaked rewards since it's already part of m0's stake.
+		_, err := _submitUnstakeTxn(testMeta, m2Pub, m2Priv, &UnstakeMetadata{
+			ValidatorPublicKey: NewPublicKey(m0PkBytes),
+			UnstakeAmountNanos: uint256.NewInt().SetUint64(50),
+		}, nil, true)
+		require.NoError(t, err)
+		require.Zero(t, getUnsettledStakeRewardNanos(m2PKID))
+
+		stakeEntry, err := _newUtxoView(testMeta).GetStakeEntry(m0PKID, m2PKID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(58), stakeEntry.StakeAmountNanos.Uint64())
+
+		require.Equal(t, uint64(508), getValidatorEntry().TotalStakeAmountNanos.Uint64())
+		require.Zero(t, getRestakedRewardNanos())
+		requireCorrectTotalStakeAmountNanos()
+	}
+}
+
 func _setUpMinerAndTestMetaForEpochCompleteTest(t *testing.T) *TestMeta {
 	// Initialize test chain and miner.
 	chain, params, db := NewLowDifficultyBlockchain(t)
@@ -42,6 +42,7 @@ type Mempool interface {
 	IsTransactionInPool(txHash *BlockHash) bool
 	GetMempoolTipBlockHeight() uint64
 	GetMempoolTx(txHash *BlockHash) *MempoolTx
+	GetTransactionForIdempotencyKey(txn *MsgDeSoTxn) *MempoolTx
 	GetMempoolSummaryStats() map[string]*SummaryStats
 	EstimateFee(txn *MsgDeSoTxn, minFeeRateNanosPerKB uint64) (uint64, error)
 	EstimateFeeRate(minFeeRateNanosPerKB uint64) uint64
@@ -138,6 +139,9 @@ type PosMempool struct {
 	// facilitating a "replace by higher fee" feature. This feature gives users the ability to replace their existing
 	// mempool transaction with a new transaction having the same nonce but higher fee.
 	nonceTracker *NonceTracker
+	// idempotencyKeyTracker keeps track of a (public key, idempotency key) -> Txn index. It's used to turn an app's
+	// retried submission of a txn that's already in the mempool into a no-op rather than a conflicting spend.
+	idempotencyKeyTracker *IdempotencyKeyTracker
 
 	// readOnlyLatestBlockView is used to check if a transaction has a valid nonce before being added to the mempool.
 	// The readOnlyLatestBlockView should be updated whenever a new block is added to the blockchain via UpdateLatestBlock.
@@ -154,6 +158,18 @@ type PosMempool struct {
 	augmentedReadOnlyLatestBlockView *UtxoView
 	// augmentedReadOnlyLatestBlockViewMutex is used to protect the augmentedLatestBlockView from concurrent access.
 	augmentedReadOnlyLatestBlockViewMutex sync.RWMutex
+	// augmentedSafeView is the SafeUtxoView whose primary view is published as the augmentedReadOnlyLatestBlockView.
+	// Transactions admitted to the mempool are connected to it as they arrive, so that the augmented view reflects
+	// them without reconnecting the rest of the mempool. It's nil until the first validateTransactions run.
+	augmentedSafeView *SafeUtxoView
+	// augmentedViewNeedsRebuild is set whenever the mempool changes in a way that can't be applied incrementally to
+	// the augmentedSafeView, i.e. when a block is connected or disconnected, when a transaction is removed or replaced,
+	// or when an admitted transaction fails to connect. The next validateTransactions run then reconnects the whole
+	// mempool. While it's unset, validateTransactions has nothing to do.
+	augmentedViewNeedsRebuild bool
+	// augmentedViewRebuildInProgress is set while validateTransactions is reconnecting the mempool outside of the lock.
+	// Transactions admitted in the meantime aren't connected to the augmentedSafeView, since it's about to be replaced.
+	augmentedViewRebuildInProgress bool
 	// Signals that the mempool is now in the stopped state.
 	quit chan interface{}
 	// latestBlockNode is used to infer the latest block height. The latestBlockNode should be updated whenever a new
@@ -196,6 +212,8 @@ func NewPosMempool() *PosMempool {
 		feeEstimator: NewPoSFeeEstimator(),
 		nonceTracker: NewNonceTracker(),
 		quit:         make(chan interface{}),
+
+		idempotencyKeyTracker: NewIdempotencyKeyTracker(),
 	}
 }
 
@@ -228,6 +246,9 @@ func (mp *PosMempool) Init(
 		mp.validateTransactionsReadOnlyLatestBlockView = readOnlyLatestBlockView.CopyUtxoView()
 	}
 	mp.latestBlockHeight = latestBlockHeight
+	mp.augmentedSafeView = nil
+	mp.augmentedViewNeedsRebuild = true
+	mp.augmentedViewRebuildInProgress = false
 	mp.dir = dir
 	mp.inMemoryOnly = inMemoryOnly
 	mp.mempoolBackupIntervalMillis = mempoolBackupIntervalMillis
@@ -240,6 +261,7 @@ func (mp *PosMempool) Init(
 	mp.txnRegister = NewTransactionRegister()
 	mp.txnRegister.Init(mp.globalParams)
 	mp.nonceTracker = NewNonceTracker()
+	mp.idempotencyKeyTracker = NewIdempotencyKeyTracker()
 
 	// Initialize the fee estimator
 	err = mp.feeEstimator.Init(mp.txnRegister, feeEstimatorPastBlocks, mp.globalParams)
@@ -328,6 +350,7 @@ func (mp *PosMempool) Stop() {
 	// Reset the transaction register, the ledger, and the nonce tracker.
 	mp.txnRegister.Reset()
 	mp.nonceTracker.Reset()
+	mp.idempotencyKeyTracker.Reset()
 	mp.feeEstimator = NewPoSFeeEstimator()
 	mp.status = PosMempoolStatusNotInitialized
 }
@@ -640,6 +663,9 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 		}
 		// Emit a persist event only for the wrapper transaction.
 		mp.persistMempoolAddEvent(txn, persistToDb)
+
+		// Apply the atomic txn to the augmented view.
+		mp.applyTransactionToAugmentedViewNoLock(txn)
 		return nil
 	}
 
@@ -649,6 +675,14 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem checking nonce tracker")
 	}
 
+	// Reject the txn if it reuses the idempotency key of another txn from the same transactor, unless it's
+	// replacing that txn by higher fee.
+	if conflictingTxn := mp.idempotencyKeyTracker.GetConflictingTxn(txn.Tx); conflictingTxn != nil &&
+		(existingTxn == nil || !existingTxn.Hash.IsEqual(conflictingTxn.Hash)) {
+		return errors.Wrapf(TxErrorDuplicateIdempotencyKey, "PosMempool.AddTransaction: Idempotency key "+
+			"was already used by txn %v", conflictingTxn.Hash)
+	}
+
 	// We can now add the transaction to the mempool.
 	if err = mp.txnRegister.AddTransaction(txn); err != nil {
 		return errors.Wrapf(err, "PosMempool.addTransactionNoLock: Problem adding txn to register")
@@ -663,15 +697,53 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 		}
 	}
 
-	// At this point the transaction is in the mempool. We can now update the nonce tracker.
+	// At this point the transaction is in the mempool. We can now update the nonce and idempotency key trackers.
 	mp.nonceTracker.AddTxnByPublicKeyNonce(txn, *userPk, *txn.Tx.TxnNonce)
+	mp.idempotencyKeyTracker.AddTxn(txn)
 
 	// Emit an event for the newly added transaction.
 	mp.persistMempoolAddEvent(txn, persistToDb)
 
+	// Apply the transaction to the augmented view. A replaced transaction has already flagged the view for a
+	// rebuild, in which case this is a no-op.
+	mp.applyTransactionToAugmentedViewNoLock(txn)
+
 	return nil
 }
 
+// applyTransactionToAugmentedViewNoLock connects a newly admitted transaction on top of the augmented view, so that
+// it's reflected by GetAugmentedUniversalView immediately rather than after the whole mempool is reconnected. If the
+// augmented view is waiting on a rebuild, or if the transaction doesn't connect, the view is flagged for a rebuild
+// instead, and validateTransactions will decide whether the transaction stays in the mempool.
+func (mp *PosMempool) applyTransactionToAugmentedViewNoLock(txn *MempoolTx) {
+	if mp.augmentedSafeView == nil || mp.augmentedViewNeedsRebuild || mp.augmentedViewRebuildInProgress {
+		mp.augmentedViewNeedsRebuild = true
+		return
+	}
+	// The rebuild only connects the top maxValidationViewConnects transactions, so once the mempool is larger than
+	// that we can't tell whether this transaction belongs in the view without reordering it.
+	if mp.txnRegister.Count() > mp.maxValidationViewConnects {
+		mp.augmentedViewNeedsRebuild = true
+		return
+	}
+
+	mp.augmentedReadOnlyLatestBlockViewMutex.Lock()
+	defer mp.augmentedReadOnlyLatestBlockViewMutex.Unlock()
+
+	_, _, _, _, err := mp.augmentedSafeView.ConnectTransaction(
+		txn.Tx, txn.Hash, uint32(mp.latestBlockHeight+1), time.Now().UnixNano(), !txn.IsValidated(), false,
+	)
+	if err != nil {
+		mp.augmentedViewNeedsRebuild = true
+		return
+	}
+	txn.SetValidated(true)
+
+	// The SafeUtxoView swaps its primary view out when a connect fails, so we always publish the current one.
+	mp.augmentedReadOnlyLatestBlockView = mp.augmentedSafeView.primaryView
+	atomic.AddInt64(&mp.augmentedLatestBlockViewSequenceNumber, 1)
+}
+
 // loadPersistedTransactions fetches transactions from the persister's storage and adds the transactions to the mempool.
 // No lock is held and (persistToDb = false) flag is used when adding transactions internally.
 func (mp *PosMempool) loadPersistedTransactions() error {
@@ -727,6 +799,9 @@ func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool)
 		return errors.Wrapf(err, "PosMempool.removeTransactionNoLock: Problem removing txn from register")
 	}
 
+	// The transaction may have been connected to the augmented view, and a connect can't be undone incrementally.
+	mp.augmentedViewNeedsRebuild = true
+
 	if txn.Tx.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
 		// For atomic transactions, we remove the nonces of the inner txns, but not the wrapper txn.
 		atomicTxnsWrapper, ok := txn.Tx.TxnMeta.(*AtomicTxnsWrapperMetadata)
@@ -740,6 +815,7 @@ func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool)
 		// For non-atomic transactions, we just remove the nonce from the nonce tracker.
 		// Remove the transaction from the nonce tracker.
 		mp.nonceTracker.RemoveTxnByPublicKeyNonce(*userPk, *txn.Tx.TxnNonce)
+		mp.idempotencyKeyTracker.RemoveTxn(txn)
 	}
 
 	// Emit an event for the removed transaction.
@@ -800,13 +876,25 @@ func (mp *PosMempool) getTransactionsNoLock() []*MempoolTx {
 // mempool transactions to the readOnlyLatestBlockView, creating a cumulative validationView. Transactions that fail to
 // connect to the validationView are removed from the mempool, as they would have also failed to connect during
 // block production. This function is thread-safe.
+//
+// Transactions admitted since the last run are usually already connected to the augmented view by
+// applyTransactionToAugmentedViewNoLock, in which case there is nothing to reconnect and the function only bumps
+// the augmentedLatestBlockViewSequenceNumber.
 func (mp *PosMempool) validateTransactions() error {
 	if !mp.IsRunning() {
 		return nil
 	}
 
-	// We hold a read-lock on the mempool to get the transactions and the latest block view.
-	mp.RLock()
+	// We hold the lock on the mempool to get the transactions and the latest block view, and to claim the rebuild.
+	mp.Lock()
+
+	if !mp.augmentedViewNeedsRebuild && mp.augmentedSafeView != nil {
+		mp.Unlock()
+		atomic.AddInt64(&mp.augmentedLatestBlockViewSequenceNumber, 1)
+		return nil
+	}
+	mp.augmentedViewNeedsRebuild = false
+	mp.augmentedViewRebuildInProgress = true
 
 	// It's fine to create a copy of the pointer to the readOnlyLatestBlockView. Since the
 	// utxoView is immutable, we don't need to copy the entire view while we hold the lock.
@@ -815,10 +903,14 @@ func (mp *PosMempool) validateTransactions() error {
 	nextBlockHeight := mp.latestBlockHeight + 1
 	nextBlockTimestamp := time.Now().UnixNano()
 
-	mp.RUnlock()
+	mp.Unlock()
 
 	// If the validation view is nil, there's nothing to do so we return early.
 	if validationView == nil {
+		mp.Lock()
+		mp.augmentedViewNeedsRebuild = true
+		mp.augmentedViewRebuildInProgress = false
+		mp.Unlock()
 		return nil
 	}
 
@@ -858,14 +950,16 @@ func (mp *PosMempool) validateTransactions() error {
 		txn.SetValidated(true)
 	}
 
-	// Get the final UtxoView from the SafeUtxoView.
-	validationView = safeUtxoView.GetUtxoView()
-
 	// Update the augmentedLatestBlockView with the latest validationView after the transactions
-	// have been connected.
+	// have been connected. The SafeUtxoView is kept so that transactions admitted from now on can be
+	// connected on top of it.
+	mp.Lock()
 	mp.augmentedReadOnlyLatestBlockViewMutex.Lock()
-	mp.augmentedReadOnlyLatestBlockView = validationView
+	mp.augmentedSafeView = safeUtxoView
+	mp.augmentedReadOnlyLatestBlockView = safeUtxoView.primaryView
 	mp.augmentedReadOnlyLatestBlockViewMutex.Unlock()
+	mp.augmentedViewRebuildInProgress = false
+	mp.Unlock()
 
 	// Increment the augmentedLatestBlockViewSequenceNumber.
 	atomic.AddInt64(&mp.augmentedLatestBlockViewSequenceNumber, 1)
@@ -937,6 +1031,9 @@ func (mp *PosMempool) UpdateLatestBlock(blockView *UtxoView, blockHeight uint64)
 		mp.validateTransactionsReadOnlyLatestBlockView = blockView.CopyUtxoView()
 	}
 	mp.latestBlockHeight = blockHeight
+
+	// The augmented view was built on top of the previous block, so it has to be rebuilt.
+	mp.augmentedViewNeedsRebuild = true
 }
 
 // UpdateGlobalParams updates the global params in the mempool. Changing GlobalParamsEntry can impact the validity of
@@ -953,6 +1050,9 @@ func (mp *PosMempool) UpdateGlobalParams(globalParams *GlobalParamsEntry) {
 
 	mp.globalParams = globalParams
 
+	// The new global params can change which transactions connect, so the augmented view has to be rebuilt.
+	mp.augmentedViewNeedsRebuild = true
+
 	// Trim the mempool size to the new maximum size.
 	if err := mp.pruneNoLock(); err != nil {
 		glog.Errorf("PosMempool.UpdateGlobalParams: Problem pruning mempool: %v", err)
@@ -979,10 +1079,12 @@ func (mp *PosMempool) GetAugmentedUniversalView() (*UtxoView, error) {
 	if !mp.IsRunning() {
 		return nil, errors.Wrapf(MempoolErrorNotRunning, "PosMempool.GetAugmentedUniversalView: ")
 	}
+	// The published view is the augmentedSafeView's primary view, which applyTransactionToAugmentedViewNoLock
+	// connects admitted transactions to in place. We hold the read lock for the whole copy so that we never
+	// read the view's maps while a transaction is being connected to it.
 	mp.augmentedReadOnlyLatestBlockViewMutex.RLock()
-	readOnlyViewPointer := mp.augmentedReadOnlyLatestBlockView
-	mp.augmentedReadOnlyLatestBlockViewMutex.RUnlock()
-	newView := readOnlyViewPointer.CopyUtxoView()
+	defer mp.augmentedReadOnlyLatestBlockViewMutex.RUnlock()
+	newView := mp.augmentedReadOnlyLatestBlockView.CopyUtxoView()
 	return newView, nil
 }
 
@@ -1077,11 +1179,27 @@ func (mp *PosMempool) GetMempoolTx(txHash *BlockHash) *MempoolTx {
 	return mp.txnRegister.txnMembership[*txHash]
 }
 
+// GetTransactionForIdempotencyKey returns the mempool txn from the same transactor that used the same idempotency
+// key as the given txn, if there is one.
+func (mp *PosMempool) GetTransactionForIdempotencyKey(txn *MsgDeSoTxn) *MempoolTx {
+	mp.RLock()
+	defer mp.RUnlock()
+	if !mp.IsRunning() {
+		return nil
+	}
+	return mp.idempotencyKeyTracker.GetTxnByIdempotencyKey(txn)
+}
+
 func (mp *PosMempool) GetMempoolSummaryStats() map[string]*SummaryStats {
 	return convertMempoolTxsToSummaryStats(mp.txnRegister.GetFeeTimeTransactions())
 }
 
 func (mp *PosMempool) EstimateFee(txn *MsgDeSoTxn, minFeeRateNanosPerKB uint64) (uint64, error) {
+	// Don't estimate a fee below the minimum of the txn's type.
+	if txnMinFeeRateNanosPerKB := mp.globalParams.GetMinimumNetworkFeeNanosPerKBForTxn(txn); minFeeRateNanosPerKB <
+		txnMinFeeRateNanosPerKB {
+		minFeeRateNanosPerKB = txnMinFeeRateNanosPerKB
+	}
 	return mp.feeEstimator.EstimateFee(txn, minFeeRateNanosPerKB)
 }
 
@@ -1,9 +1,13 @@
+//go:build !deso_lean
+
 package lib
 
 import (
 	"bytes"
+	"fmt"
 	"math/rand"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -405,6 +409,169 @@ func TestPosMempoolTransactionValidation(t *testing.T) {
 	mempool.Stop()
 }
 
+func TestPosMempoolIncrementalAugmentedView(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1091)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	m1Balance, err := latestBlockView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	dir := _dbDirSetup(t)
+
+	// Use a long refresh interval so that we control when the validation routine runs.
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 100, 1000000,
+	))
+	require.NoError(mempool.Start())
+	require.NoError(mempool.validateTransactions())
+	require.False(mempool.augmentedViewNeedsRebuild)
+
+	// An admitted txn is reflected by the augmented view without another validation run.
+	output := []*DeSoOutput{{
+		PublicKey:   m1PubBytes,
+		AmountNanos: 1000,
+	}}
+	txn1 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25, output)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
+	require.True(mempool.GetTransaction(txn1.Hash()).IsValidated())
+	require.False(mempool.augmentedViewNeedsRebuild)
+	augmentedView, err := mempool.GetAugmentedUniversalView()
+	require.NoError(err)
+	augmentedBalance, err := augmentedView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	require.Equal(m1Balance+1000, augmentedBalance)
+
+	// A txn that fails to connect leaves the view untouched and is left to the next validation run.
+	txn2 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m1Priv, 100, 25, output)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn2)
+	require.False(mempool.GetTransaction(txn2.Hash()).IsValidated())
+	require.True(mempool.augmentedViewNeedsRebuild)
+	require.NoError(mempool.validateTransactions())
+	require.Nil(mempool.GetTransaction(txn2.Hash()))
+	augmentedView, err = mempool.GetAugmentedUniversalView()
+	require.NoError(err)
+	augmentedBalance, err = augmentedView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	require.Equal(m1Balance+1000, augmentedBalance)
+
+	// Removing a txn can't be applied incrementally, so the view is rebuilt without it.
+	_wrappedPosMempoolRemoveTransaction(t, mempool, txn1.Hash())
+	require.True(mempool.augmentedViewNeedsRebuild)
+	require.NoError(mempool.validateTransactions())
+	require.False(mempool.augmentedViewNeedsRebuild)
+	augmentedView, err = mempool.GetAugmentedUniversalView()
+	require.NoError(err)
+	augmentedBalance, err = augmentedView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	require.Equal(m1Balance, augmentedBalance)
+
+	mempool.Stop()
+}
+
+// TestPosMempoolAugmentedViewConcurrentReads admits transactions, which connects them to the augmented view in
+// place, while other goroutines copy the augmented view. Run it with -race to check that readers never see the
+// view's maps while they're being written to.
+func TestPosMempoolAugmentedViewConcurrentReads(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1097)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	m1Balance, err := latestBlockView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	dir := _dbDirSetup(t)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 100, 1000000,
+	))
+	require.NoError(mempool.Start())
+	require.NoError(mempool.validateTransactions())
+
+	// Generate the txns up front so the admissions below are as close together as possible.
+	numTxns := 20
+	output := []*DeSoOutput{{
+		PublicKey:   m1PubBytes,
+		AmountNanos: 1000,
+	}}
+	var txns []*MsgDeSoTxn
+	for ii := 0; ii < numTxns; ii++ {
+		txns = append(txns, _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25, output))
+	}
+
+	// The readers copy the augmented view until all the txns have been admitted. The balance they see can only
+	// be one of the balances between admissions.
+	done := make(chan struct{})
+	readerErrs := make(chan error, 4)
+	var readers sync.WaitGroup
+	for ii := 0; ii < 4; ii++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				augmentedView, err := mempool.GetAugmentedUniversalView()
+				if err != nil {
+					readerErrs <- err
+					return
+				}
+				balance, err := augmentedView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+				if err != nil {
+					readerErrs <- err
+					return
+				}
+				if balance < m1Balance || balance > m1Balance+uint64(numTxns)*1000 || (balance-m1Balance)%1000 != 0 {
+					readerErrs <- fmt.Errorf("unexpected augmented balance %v", balance)
+					return
+				}
+			}
+		}()
+	}
+
+	for _, txn := range txns {
+		_wrappedPosMempoolAddTransaction(t, mempool, txn)
+	}
+	close(done)
+	readers.Wait()
+	close(readerErrs)
+	for readerErr := range readerErrs {
+		require.NoError(readerErr)
+	}
+
+	require.NoError(mempool.validateTransactions())
+	augmentedView, err := mempool.GetAugmentedUniversalView()
+	require.NoError(err)
+	augmentedBalance, err := augmentedView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	require.Equal(m1Balance+uint64(numTxns)*1000, augmentedBalance)
+
+	mempool.Stop()
+}
+
 func _posTestBlockchainSetup(t *testing.T) (_params *DeSoParams, _db *badger.DB) {
 	return _posTestBlockchainSetupWithBalances(t, 200000, 200000)
 }
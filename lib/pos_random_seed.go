@@ -116,7 +116,7 @@ func (bav *UtxoView) GetCurrentRandomSeedHash() (*RandomSeedHash, error) {
 		return bav.CurrentRandomSeedHash, nil
 	}
 	// Then, check the db.
-	currentRandomSeedHash, err := DBGetCurrentRandomSeedHash(bav.Handle, bav.Snapshot)
+	currentRandomSeedHash, err := bav.GetDbAdapter().GetCurrentRandomSeedHash()
 	if err != nil {
 		return nil, errors.Wrapf(err, "UtxoView.GetCurrentRandomSeedHash: problem retrieving CurrentRandomSeedHash from the db: ")
 	}
@@ -88,7 +88,7 @@ func (bav *UtxoView) GetSnapshotGlobalParamsEntryByEpochNumber(snapshotAtEpochNu
 		return MergeGlobalParamEntryDefaults(globalParamsEntry, bav.Params), nil
 	}
 	// If we don't have it in the UtxoView, check the db.
-	globalParamsEntry, err := DBGetSnapshotGlobalParamsEntry(bav.Handle, bav.Snapshot, snapshotAtEpochNumber)
+	globalParamsEntry, err := bav.GetDbAdapter().GetSnapshotGlobalParamsEntry(snapshotAtEpochNumber)
 	if err != nil {
 		return nil, errors.Wrapf(
 			err,
@@ -184,6 +184,21 @@ func MergeGlobalParamEntryDefaults(globalParamsEntry *GlobalParamsEntry, params
 	if globalParamsEntryCopy.TimeoutIntervalMillisecondsPoS == 0 {
 		globalParamsEntryCopy.TimeoutIntervalMillisecondsPoS = params.DefaultTimeoutIntervalMillisecondsPoS
 	}
+	if globalParamsEntryCopy.JailMissedSlotsThreshold == 0 {
+		globalParamsEntryCopy.JailMissedSlotsThreshold = params.DefaultJailMissedSlotsThreshold
+	}
+	if globalParamsEntryCopy.ValidatorSlashBasisPoints == 0 {
+		globalParamsEntryCopy.ValidatorSlashBasisPoints = params.DefaultValidatorSlashBasisPoints
+	}
+	if globalParamsEntryCopy.ExchangeRateFeedMaxAgeBlocks == 0 {
+		globalParamsEntryCopy.ExchangeRateFeedMaxAgeBlocks = params.DefaultExchangeRateFeedMaxAgeBlocks
+	}
+	if globalParamsEntryCopy.ExchangeRateFeedMaxDeviationBasisPoints == 0 {
+		globalParamsEntryCopy.ExchangeRateFeedMaxDeviationBasisPoints = params.DefaultExchangeRateFeedMaxDeviationBasisPoints
+	}
+	if globalParamsEntryCopy.ExchangeRateFeedMinSubmissions == 0 {
+		globalParamsEntryCopy.ExchangeRateFeedMinSubmissions = params.DefaultExchangeRateFeedMinSubmissions
+	}
 
 	// Return the merged result.
 	return globalParamsEntryCopy
@@ -296,7 +311,7 @@ func (bav *UtxoView) GetSnapshotValidatorSetEntryByPKIDAtEpochNumber(pkid *PKID,
 		return validatorEntry, nil
 	}
 	// If we don't have it in the UtxoView, check the db.
-	validatorEntry, err := DBGetSnapshotValidatorSetEntryByPKID(bav.Handle, bav.Snapshot, pkid, snapshotAtEpochNumber)
+	validatorEntry, err := bav.GetDbAdapter().GetSnapshotValidatorSetEntryByPKID(pkid, snapshotAtEpochNumber)
 	if err != nil {
 		return nil, errors.Wrapf(
 			err,
@@ -332,8 +347,8 @@ func (bav *UtxoView) GetSnapshotValidatorSetByStakeAmountAtEpochNumber(snapshotA
 		// Pull top N ValidatorEntries from the database (not present in the UtxoView).
 		// Note that we will skip validators that are present in the view because we pass
 		// utxoViewValidatorEntries to the function.
-		dbValidatorEntries, err := DBGetSnapshotValidatorSetByStakeAmount(
-			bav.Handle, bav.Snapshot, limit, snapshotAtEpochNumber, utxoViewValidatorEntries,
+		dbValidatorEntries, err := bav.GetDbAdapter().GetSnapshotValidatorSetByStakeAmount(
+			limit, snapshotAtEpochNumber, utxoViewValidatorEntries,
 		)
 		if err != nil {
 			return nil, errors.Wrapf(
@@ -756,7 +771,7 @@ func (bav *UtxoView) GetSnapshotValidatorBLSPublicKeyPKIDPairEntry(blsPublicKey
 	}
 
 	// If we don't have it in the UtxoView, check the db.
-	blsPublicKeyPKIDPairEntry, err := DBGetSnapshotValidatorBLSPublicKeyPKIDPairEntry(bav.Handle, bav.Snapshot, blsPublicKey, snapshotAtEpochNumber)
+	blsPublicKeyPKIDPairEntry, err := bav.GetDbAdapter().GetSnapshotValidatorBLSPublicKeyPKIDPairEntry(blsPublicKey, snapshotAtEpochNumber)
 	if err != nil {
 		return nil, errors.Wrap(
 			err,
@@ -967,8 +982,8 @@ func (bav *UtxoView) GetAllSnapshotStakesToReward() ([]*StakeEntry, error) {
 	}
 
 	// Pull top N snapshot StakeEntries from the database (not present in the UtxoView).
-	dbStakeEntries, err := DBGetSnapshotStakesToReward(
-		bav.Handle, bav.Snapshot, maxNumSnapshotStakes, snapshotAtEpochNumber, utxoViewStakeEntries,
+	dbStakeEntries, err := bav.GetDbAdapter().GetSnapshotStakesToReward(
+		maxNumSnapshotStakes, snapshotAtEpochNumber, utxoViewStakeEntries,
 	)
 	if err != nil {
 		return nil, errors.Wrapf(err, "GetAllSnapshotStakesToReward: error retrieving entries from db: ")
@@ -1177,7 +1192,7 @@ func (bav *UtxoView) GetSnapshotLeaderScheduleValidator(leaderIndex uint16) (*Va
 		return bav.GetCurrentSnapshotValidatorSetEntryByPKID(validatorPKID)
 	}
 	// Next, check the db.
-	validatorEntry, err := DBGetSnapshotLeaderScheduleValidator(bav.Handle, bav.Snapshot, leaderIndex, snapshotAtEpochNumber)
+	validatorEntry, err := bav.GetDbAdapter().GetSnapshotLeaderScheduleValidator(leaderIndex, snapshotAtEpochNumber)
 	if err != nil {
 		return nil, errors.Wrapf(err, "GetSnapshotLeaderScheduleValidator: error retrieving ValidatorPKID: ")
 	}
@@ -1207,7 +1222,7 @@ func (bav *UtxoView) GetCurrentSnapshotLeaderSchedule() ([]*PKID, error) {
 func (bav *UtxoView) GetSnapshotLeaderScheduleAtEpochNumber(snapshotAtEpochNumber uint64) ([]*PKID, error) {
 	if !bav.HasFullSnapshotLeaderScheduleByEpoch[snapshotAtEpochNumber] {
 		// Seek over DB prefix and merge into view.
-		leaderIdxToValidatorPKIDMap, err := DBSeekSnapshotLeaderSchedule(bav.Handle, snapshotAtEpochNumber)
+		leaderIdxToValidatorPKIDMap, err := bav.GetDbAdapter().GetSnapshotLeaderSchedule(snapshotAtEpochNumber)
 		if err != nil {
 			return nil, errors.Wrapf(err, "GetSnapshotLeaderScheduleAtEpochNumber: error retrieving ValidatorPKIDs: ")
 		}
@@ -0,0 +1,1129 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
+// pos_staking_reward_accrual.go implements O(1) per-staker accounting for delegated
+// staking rewards. Prior to the StakingRewardsAccrualBlockHeight, the end-of-epoch
+// hook snapshots the top stakes and writes a reward for every one of them. After the
+// fork, the hook only touches one ValidatorRewardIndexEntry per validator, and each
+// delegated StakeEntry settles what it is owed against its validator's index the next
+// time the staker interacts with it.
+//
+// Each validator tracks two cumulative indexes, both scaled by RewardIndexScale:
+//   - RewardPerStakeIndex: the total delegator reward paid per unit of stake. A
+//     PayToBalance stake accrues StakeAmountNanos * (index - checkpoint).
+//   - CompoundingIndex: the growth factor of a unit of stake whose rewards are
+//     restaked every epoch. A Restake stake accrues
+//     StakeAmountNanos * (index / checkpoint - 1), which compounds exactly as if the
+//     rewards had been restaked at the end of every epoch.
+//
+// A StakeEntry's RewardIndexCheckpoint is interpreted against whichever of the two
+// indexes matches its RewardMethod. Rewards are settled whenever a Stake, Unstake, or
+// UnregisterAsValidator txn changes the stake: PayToBalance rewards are paid straight
+// to the staker's balance, and Restake rewards are added to the StakeEntry.
+//
+// Restaked rewards count towards the validator's stake as soon as they're earned, so
+// that its weight doesn't fall behind its delegators' stake between settlements. Each
+// ValidatorRewardIndexEntry tracks its validator's delegated Restake stake, and the end
+// of each epoch adds that stake's rewards to the validator's TotalStakeAmountNanos and
+// holds them in RestakedRewardNanos until the stakes they belong to are settled.
+//
+// Validators' own stake and their commissions are still paid out directly at the end
+// of each epoch, since there is only one such payment per validator. They're sized from
+// the snapshot validator set, along with a snapshot of each validator's own StakeEntry.
+//
+// Only stake that was already in place when an epoch started earns that epoch's reward.
+// Stake added during an epoch is tracked as warmup stake on both the StakeEntry and the
+// ValidatorEntry, and it is left out of the validator's reward and commission for that
+// epoch. When the epoch completes, the validator's index is recorded for that epoch, and
+// the warmup stake later settles against it as though it had been staked at the start of
+// the next epoch.
+
+// RewardIndexScale is the fixed-point scale of the ValidatorRewardIndexEntry indexes.
+var RewardIndexScale = uint256.NewInt().SetUint64(1e18)
+
+//
+// TYPES: ValidatorRewardIndexEntry
+//
+
+type ValidatorRewardIndexEntry struct {
+	ValidatorPKID *PKID
+	// RewardPerStakeIndex is the cumulative reward paid to delegators per unit of
+	// delegated stake, scaled by RewardIndexScale. It starts at zero.
+	RewardPerStakeIndex *uint256.Int
+	// CompoundingIndex is the cumulative growth factor of delegated stake whose
+	// rewards are restaked, scaled by RewardIndexScale. It starts at RewardIndexScale.
+	CompoundingIndex *uint256.Int
+
+	// RestakeStakeAmountNanos is the total StakeAmountNanos of the validator's delegated
+	// StakeEntries with the Restake RewardMethod. It's nil until it's first needed, at
+	// which point it's totaled from the validator's StakeEntries.
+	RestakeStakeAmountNanos *uint256.Int
+	// RestakeWarmupStakeAmountNanos is the portion of RestakeStakeAmountNanos that was
+	// staked during RestakeWarmupEpochNumber and isn't earning rewards yet.
+	RestakeWarmupStakeAmountNanos *uint256.Int
+	RestakeWarmupEpochNumber      uint64
+	// RestakedRewardNanos is the delegators' restaked rewards that have been added to the
+	// validator's TotalStakeAmountNanos but not yet settled into their StakeEntries.
+	RestakedRewardNanos *uint256.Int
+
+	isDeleted bool
+}
+
+func NewValidatorRewardIndexEntry(validatorPKID *PKID) *ValidatorRewardIndexEntry {
+	return &ValidatorRewardIndexEntry{
+		ValidatorPKID:       validatorPKID.NewPKID(),
+		RewardPerStakeIndex: uint256.NewInt(),
+		CompoundingIndex:    RewardIndexScale.Clone(),
+	}
+}
+
+func (rewardIndexEntry *ValidatorRewardIndexEntry) Copy() *ValidatorRewardIndexEntry {
+	copyUint256 := func(number *uint256.Int) *uint256.Int {
+		if number == nil {
+			return nil
+		}
+		return number.Clone()
+	}
+	return &ValidatorRewardIndexEntry{
+		ValidatorPKID:                 rewardIndexEntry.ValidatorPKID.NewPKID(),
+		RewardPerStakeIndex:           rewardIndexEntry.RewardPerStakeIndex.Clone(),
+		CompoundingIndex:              rewardIndexEntry.CompoundingIndex.Clone(),
+		RestakeStakeAmountNanos:       copyUint256(rewardIndexEntry.RestakeStakeAmountNanos),
+		RestakeWarmupStakeAmountNanos: copyUint256(rewardIndexEntry.RestakeWarmupStakeAmountNanos),
+		RestakeWarmupEpochNumber:      rewardIndexEntry.RestakeWarmupEpochNumber,
+		RestakedRewardNanos:           copyUint256(rewardIndexEntry.RestakedRewardNanos),
+		isDeleted:                     rewardIndexEntry.isDeleted,
+	}
+}
+
+// GetIndexForRewardMethod returns the index that a StakeEntry with the given
+// RewardMethod checkpoints against.
+func (rewardIndexEntry *ValidatorRewardIndexEntry) GetIndexForRewardMethod(rewardMethod StakingRewardMethod) *uint256.Int {
+	if rewardMethod == StakingRewardMethodRestake {
+		return rewardIndexEntry.CompoundingIndex
+	}
+	return rewardIndexEntry.RewardPerStakeIndex
+}
+
+func (rewardIndexEntry *ValidatorRewardIndexEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, rewardIndexEntry.ValidatorPKID, skipMetadata...)...)
+	data = append(data, VariableEncodeUint256(rewardIndexEntry.RewardPerStakeIndex)...)
+	data = append(data, VariableEncodeUint256(rewardIndexEntry.CompoundingIndex)...)
+	data = append(data, VariableEncodeUint256(rewardIndexEntry.RestakeStakeAmountNanos)...)
+	data = append(data, VariableEncodeUint256(rewardIndexEntry.RestakeWarmupStakeAmountNanos)...)
+	data = append(data, UintToBuf(rewardIndexEntry.RestakeWarmupEpochNumber)...)
+	data = append(data, VariableEncodeUint256(rewardIndexEntry.RestakedRewardNanos)...)
+	return data
+}
+
+func (rewardIndexEntry *ValidatorRewardIndexEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// ValidatorPKID
+	rewardIndexEntry.ValidatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorRewardIndexEntry.Decode: Problem reading ValidatorPKID: ")
+	}
+
+	// RewardPerStakeIndex
+	rewardIndexEntry.RewardPerStakeIndex, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorRewardIndexEntry.Decode: Problem reading RewardPerStakeIndex: ")
+	}
+
+	// CompoundingIndex
+	rewardIndexEntry.CompoundingIndex, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorRewardIndexEntry.Decode: Problem reading CompoundingIndex: ")
+	}
+
+	// RestakeStakeAmountNanos
+	rewardIndexEntry.RestakeStakeAmountNanos, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorRewardIndexEntry.Decode: Problem reading RestakeStakeAmountNanos: ")
+	}
+
+	// RestakeWarmupStakeAmountNanos
+	rewardIndexEntry.RestakeWarmupStakeAmountNanos, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorRewardIndexEntry.Decode: Problem reading RestakeWarmupStakeAmountNanos: ")
+	}
+
+	// RestakeWarmupEpochNumber
+	rewardIndexEntry.RestakeWarmupEpochNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorRewardIndexEntry.Decode: Problem reading RestakeWarmupEpochNumber: ")
+	}
+
+	// RestakedRewardNanos
+	rewardIndexEntry.RestakedRewardNanos, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorRewardIndexEntry.Decode: Problem reading RestakedRewardNanos: ")
+	}
+
+	return nil
+}
+
+func (rewardIndexEntry *ValidatorRewardIndexEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (rewardIndexEntry *ValidatorRewardIndexEntry) GetEncoderType() EncoderType {
+	return EncoderTypeValidatorRewardIndexEntry
+}
+
+type ValidatorRewardIndexAtEpochEndMapKey struct {
+	ValidatorPKID PKID
+	EpochNumber   uint64
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForValidatorRewardIndexByPKID(validatorPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixValidatorRewardIndexByPKID...)
+	key = append(key, validatorPKID.ToBytes()...)
+	return key
+}
+
+func DBGetValidatorRewardIndexEntry(
+	handle *badger.DB,
+	snap *Snapshot,
+	validatorPKID *PKID,
+) (*ValidatorRewardIndexEntry, error) {
+	var ret *ValidatorRewardIndexEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetValidatorRewardIndexEntryWithTxn(txn, snap, validatorPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetValidatorRewardIndexEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	validatorPKID *PKID,
+) (*ValidatorRewardIndexEntry, error) {
+	// Retrieve ValidatorRewardIndexEntry from db.
+	key := DBKeyForValidatorRewardIndexByPKID(validatorPKID)
+	rewardIndexEntryBytes, err := DBGetWithTxn(txn, snap, key)
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetValidatorRewardIndexEntry: problem retrieving ValidatorRewardIndexEntry: ")
+	}
+
+	// Decode ValidatorRewardIndexEntry from bytes.
+	rr := bytes.NewReader(rewardIndexEntryBytes)
+	rewardIndexEntry, err := DecodeDeSoEncoder(&ValidatorRewardIndexEntry{}, rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetValidatorRewardIndexEntry: problem decoding ValidatorRewardIndexEntry: ")
+	}
+	return rewardIndexEntry, nil
+}
+
+func DBPutValidatorRewardIndexEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	rewardIndexEntry *ValidatorRewardIndexEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if rewardIndexEntry == nil {
+		return nil
+	}
+
+	// Set ValidatorRewardIndexEntry in PrefixValidatorRewardIndexByPKID.
+	key := DBKeyForValidatorRewardIndexByPKID(rewardIndexEntry.ValidatorPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, rewardIndexEntry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutValidatorRewardIndexEntryWithTxn: problem storing ValidatorRewardIndexEntry in index PrefixValidatorRewardIndexByPKID: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteValidatorRewardIndexEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	validatorPKID *PKID,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if validatorPKID == nil {
+		return nil
+	}
+
+	// Delete ValidatorRewardIndexEntry from PrefixValidatorRewardIndexByPKID.
+	key := DBKeyForValidatorRewardIndexByPKID(validatorPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteValidatorRewardIndexEntryWithTxn: problem deleting ValidatorRewardIndexEntry from index PrefixValidatorRewardIndexByPKID: ",
+		)
+	}
+	return nil
+}
+
+func DBKeyForValidatorRewardIndexAtEpochEnd(validatorPKID *PKID, epochNumber uint64) []byte {
+	key := append([]byte{}, Prefixes.PrefixValidatorRewardIndexByPKIDAndEpochNumber...)
+	key = append(key, validatorPKID.ToBytes()...)
+	key = append(key, EncodeUint64(epochNumber)...)
+	return key
+}
+
+func DBGetValidatorRewardIndexEntryAtEpochEnd(
+	handle *badger.DB,
+	snap *Snapshot,
+	validatorPKID *PKID,
+	epochNumber uint64,
+) (*ValidatorRewardIndexEntry, error) {
+	var ret *ValidatorRewardIndexEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetValidatorRewardIndexEntryAtEpochEndWithTxn(txn, snap, validatorPKID, epochNumber)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetValidatorRewardIndexEntryAtEpochEndWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	validatorPKID *PKID,
+	epochNumber uint64,
+) (*ValidatorRewardIndexEntry, error) {
+	// Retrieve ValidatorRewardIndexEntry from db.
+	key := DBKeyForValidatorRewardIndexAtEpochEnd(validatorPKID, epochNumber)
+	rewardIndexEntryBytes, err := DBGetWithTxn(txn, snap, key)
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetValidatorRewardIndexEntryAtEpochEnd: problem retrieving ValidatorRewardIndexEntry: ")
+	}
+
+	// Decode ValidatorRewardIndexEntry from bytes.
+	rr := bytes.NewReader(rewardIndexEntryBytes)
+	rewardIndexEntry, err := DecodeDeSoEncoder(&ValidatorRewardIndexEntry{}, rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetValidatorRewardIndexEntryAtEpochEnd: problem decoding ValidatorRewardIndexEntry: ")
+	}
+	return rewardIndexEntry, nil
+}
+
+func DBPutValidatorRewardIndexEntryAtEpochEndWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	rewardIndexEntry *ValidatorRewardIndexEntry,
+	epochNumber uint64,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if rewardIndexEntry == nil {
+		return nil
+	}
+
+	// Set ValidatorRewardIndexEntry in PrefixValidatorRewardIndexByPKIDAndEpochNumber.
+	key := DBKeyForValidatorRewardIndexAtEpochEnd(rewardIndexEntry.ValidatorPKID, epochNumber)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, rewardIndexEntry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutValidatorRewardIndexEntryAtEpochEndWithTxn: problem storing ValidatorRewardIndexEntry in index PrefixValidatorRewardIndexByPKIDAndEpochNumber: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteValidatorRewardIndexEntryAtEpochEndWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	validatorPKID *PKID,
+	epochNumber uint64,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if validatorPKID == nil {
+		return nil
+	}
+
+	// Delete ValidatorRewardIndexEntry from PrefixValidatorRewardIndexByPKIDAndEpochNumber.
+	key := DBKeyForValidatorRewardIndexAtEpochEnd(validatorPKID, epochNumber)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteValidatorRewardIndexEntryAtEpochEndWithTxn: problem deleting ValidatorRewardIndexEntry from index PrefixValidatorRewardIndexByPKIDAndEpochNumber: ",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+// distributeStakingRewardsWithAccrual distributes one epoch's staking rewards to every
+// validator in the current snapshot validator set. Validators are paid their own
+// reward and their commission directly, while delegators' rewards are folded into the
+// validator's ValidatorRewardIndexEntry to be settled lazily. This is O(n) in the
+// number of validators and O(1) per delegator.
+func (bav *UtxoView) distributeStakingRewardsWithAccrual(growthMultiplier *big.Float) ([]*UtxoOperation, error) {
+	snapshotValidatorSet, err := bav.GetAllSnapshotValidatorSetEntriesByStake()
+	if err != nil {
+		return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem retrieving snapshot validator set: ")
+	}
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem retrieving CurrentEpochNumber: ")
+	}
+
+	// The validators' own StakeEntries are snapshotted along with the validator set, so that
+	// their rewards are sized from the same snapshot as their total stake.
+	snapshotStakesToReward, err := bav.GetAllSnapshotStakesToReward()
+	if err != nil {
+		return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem retrieving snapshot stakes to reward: ")
+	}
+	snapshotSelfStakeAmounts := make(map[PKID]*uint256.Int)
+	for _, snapshotStakeEntry := range snapshotStakesToReward {
+		if snapshotStakeEntry != nil && snapshotStakeEntry.StakerPKID.Eq(snapshotStakeEntry.ValidatorPKID) {
+			snapshotSelfStakeAmounts[*snapshotStakeEntry.ValidatorPKID] = snapshotStakeEntry.StakeAmountNanos
+		}
+	}
+
+	var utxoOperations []*UtxoOperation
+	for _, snapshotValidatorEntry := range snapshotValidatorSet {
+		if snapshotValidatorEntry == nil {
+			continue
+		}
+		validatorPKID := snapshotValidatorEntry.ValidatorPKID
+
+		// If the validator has unregistered since the snapshot, its stakes were already
+		// unlocked and there is nothing left to reward.
+		validatorEntry, err := bav.GetValidatorByPKID(validatorPKID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem retrieving ValidatorEntry: ")
+		}
+		if validatorEntry == nil || validatorEntry.isDeleted {
+			continue
+		}
+
+		// Split the validator's snapshotted stake into the validator's own stake and delegated stake.
+		selfStakeAmountNanos := uint256.NewInt()
+		if snapshotSelfStakeAmountNanos, exists := snapshotSelfStakeAmounts[*validatorPKID]; exists {
+			selfStakeAmountNanos = snapshotSelfStakeAmountNanos
+		}
+		delegatedStakeAmountNanos, err := SafeUint256().Sub(snapshotValidatorEntry.TotalStakeAmountNanos, selfStakeAmountNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem computing delegated stake: ")
+		}
+
+		// Compute the validator's own reward and its commission on delegated stake before paying
+		// anything out, since restaking either of them changes the validator's total stake.
+		commissionBasisPoints := snapshotValidatorEntry.DelegatedStakeCommissionBasisPoints
+		selfRewardNanos := convertBigFloatToBigInt(computeStakingReward(selfStakeAmountNanos, growthMultiplier))
+		delegatedRewardNanos := convertBigFloatToBigInt(computeStakingReward(delegatedStakeAmountNanos, growthMultiplier))
+		validatorCommissionNanos := computeValidatorCommission(delegatedRewardNanos, commissionBasisPoints)
+		accruedRewardNanos := big.NewInt(0).Sub(delegatedRewardNanos, validatorCommissionNanos)
+		if !selfRewardNanos.IsUint64() || !validatorCommissionNanos.IsUint64() || !accruedRewardNanos.IsUint64() {
+			return nil, errors.Errorf(
+				"distributeStakingRewardsWithAccrual: validator reward, commission, or accrued reward is not a uint64",
+			)
+		}
+
+		// Fold the delegators' share of this epoch's rewards into the validator's indexes.
+		prevRewardIndexEntry, err := bav.getValidatorRewardIndexEntryWithRestakeStake(validatorPKID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: ")
+		}
+		rewardIndexEntry := prevRewardIndexEntry.Copy()
+		rewardIndexEntry.RewardPerStakeIndex, rewardIndexEntry.CompoundingIndex, err = computeNextRewardIndexes(
+			prevRewardIndexEntry.RewardPerStakeIndex,
+			prevRewardIndexEntry.CompoundingIndex,
+			growthMultiplier,
+			commissionBasisPoints,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: ")
+		}
+
+		// Restake the rewards of the validator's delegated Restake stake. They're added to the
+		// validator's stake now, and to the StakeEntries they belong to when they're settled.
+		// Stake that was added during this epoch hasn't started earning rewards yet.
+		earningRestakeStakeAmountNanos, err := SafeUint256().Add(
+			rewardIndexEntry.RestakeStakeAmountNanos, rewardIndexEntry.RestakedRewardNanos,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem computing Restake stake: ")
+		}
+		earningRestakeStakeAmountNanos, err = SafeUint256().Sub(
+			earningRestakeStakeAmountNanos,
+			getActiveWarmupStakeAmountNanos(
+				rewardIndexEntry.RestakeWarmupStakeAmountNanos, rewardIndexEntry.RestakeWarmupEpochNumber, currentEpochNumber,
+			),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem computing Restake stake: ")
+		}
+		restakedRewardNanos, err := computeAccruedStakeReward(
+			earningRestakeStakeAmountNanos,
+			StakingRewardMethodRestake,
+			prevRewardIndexEntry.CompoundingIndex,
+			rewardIndexEntry.CompoundingIndex,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: ")
+		}
+		rewardIndexEntry.RestakedRewardNanos, err = SafeUint256().Add(
+			rewardIndexEntry.RestakedRewardNanos, uint256.NewInt().SetUint64(restakedRewardNanos),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem adding RestakedRewardNanos: ")
+		}
+		bav._setValidatorRewardIndexEntryMappings(rewardIndexEntry)
+		currentValidatorEntry := validatorEntry.Copy()
+		currentValidatorEntry.TotalStakeAmountNanos, err = SafeUint256().Add(
+			validatorEntry.TotalStakeAmountNanos, uint256.NewInt().SetUint64(restakedRewardNanos),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem adding restaked rewards to TotalStakeAmountNanos: ")
+		}
+		bav._setValidatorEntryMappings(currentValidatorEntry)
+		utxoOperations = append(utxoOperations, &UtxoOperation{
+			Type:                          OperationTypeStakeDistributionRestake,
+			PrevValidatorEntry:            validatorEntry,
+			PrevValidatorRewardIndexEntry: prevRewardIndexEntry,
+			StakeAmountNanosDiff:          restakedRewardNanos,
+		})
+
+		// If stake was added to the validator during this epoch, record the index it starts
+		// earning from.
+		if validatorEntry.WarmupStakeAmountNanos != nil && validatorEntry.WarmupEpochNumber == currentEpochNumber {
+			bav._setValidatorRewardIndexAtEpochEndMappings(rewardIndexEntry.Copy(), currentEpochNumber)
+		}
+		// Record the delegators' share so that the rewards minted in this epoch can be totaled
+		// from the block's UtxoOperations. It's settled per stake later, so the amounts the
+		// delegators end up with may differ from it by rounding.
+		if accruedRewardNanos.Sign() > 0 {
+			utxoOperations = append(utxoOperations, &UtxoOperation{
+				Type:                 OperationTypeStakeDistributionAccrue,
+				StakeAmountNanosDiff: accruedRewardNanos.Uint64(),
+			})
+		}
+
+		// Pay the validator its own reward and its commission.
+		if selfRewardNanos.Sign() > 0 {
+			utxoOperation, err := bav.distributeStakingReward(validatorPKID, validatorPKID, selfRewardNanos.Uint64(), false)
+			if err != nil {
+				return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem distributing validator reward: ")
+			}
+			utxoOperations = append(utxoOperations, utxoOperation)
+		}
+		if validatorCommissionNanos.Sign() > 0 {
+			utxoOperation, err := bav.distributeValidatorCommission(validatorPKID, validatorCommissionNanos.Uint64())
+			if err != nil {
+				return nil, errors.Wrapf(err, "distributeStakingRewardsWithAccrual: problem distributing validator commission: ")
+			}
+			utxoOperations = append(utxoOperations, utxoOperation)
+		}
+	}
+
+	return utxoOperations, nil
+}
+
+// isStakeRewardAccrualActive returns true if the StakeEntry's rewards are tracked via
+// its validator's ValidatorRewardIndexEntry at the given block height. A validator's
+// stake to itself is always paid out directly.
+func (bav *UtxoView) isStakeRewardAccrualActive(stakeEntry *StakeEntry, blockHeight uint64) bool {
+	return blockHeight >= uint64(bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight) &&
+		!stakeEntry.StakerPKID.Eq(stakeEntry.ValidatorPKID)
+}
+
+// computeUnsettledStakeRewardNanos returns the rewards that a StakeEntry has accrued
+// since its RewardIndexCheckpoint.
+func (bav *UtxoView) computeUnsettledStakeRewardNanos(stakeEntry *StakeEntry, blockHeight uint64) (uint64, error) {
+	if !bav.isStakeRewardAccrualActive(stakeEntry, blockHeight) {
+		return 0, nil
+	}
+	rewardIndexEntry, err := bav.GetValidatorRewardIndexEntry(stakeEntry.ValidatorPKID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+	}
+	currentIndex := rewardIndexEntry.GetIndexForRewardMethod(stakeEntry.RewardMethod)
+
+	// If none of the stake is warming up, the whole stake accrues from the checkpoint.
+	if stakeEntry.WarmupStakeAmountNanos == nil || stakeEntry.WarmupStakeAmountNanos.IsZero() {
+		accruedRewardNanos, err := computeAccruedStakeReward(
+			stakeEntry.StakeAmountNanos, stakeEntry.RewardMethod, stakeEntry.RewardIndexCheckpoint, currentIndex,
+		)
+		if err != nil {
+			return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+		}
+		return accruedRewardNanos, nil
+	}
+
+	// Otherwise, only the rest of the stake accrues until the end of the WarmupEpochNumber.
+	earningStakeAmountNanos, err := SafeUint256().Sub(stakeEntry.StakeAmountNanos, stakeEntry.WarmupStakeAmountNanos)
+	if err != nil {
+		return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: WarmupStakeAmountNanos exceeds StakeAmountNanos: ")
+	}
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+	}
+	var warmupEndRewardIndexEntry *ValidatorRewardIndexEntry
+	if stakeEntry.WarmupEpochNumber < currentEpochNumber {
+		warmupEndRewardIndexEntry, err = bav.GetValidatorRewardIndexEntryAtEpochEnd(
+			stakeEntry.ValidatorPKID, stakeEntry.WarmupEpochNumber,
+		)
+		if err != nil {
+			return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+		}
+	}
+	if warmupEndRewardIndexEntry == nil {
+		// If the WarmupEpochNumber hasn't completed yet, the warmup stake hasn't earned anything.
+		// If it has but no index was recorded for it, the validator wasn't rewarded for that
+		// epoch, so the whole stake has been earning since the checkpoint.
+		accruingStakeAmountNanos := earningStakeAmountNanos
+		if stakeEntry.WarmupEpochNumber < currentEpochNumber {
+			accruingStakeAmountNanos = stakeEntry.StakeAmountNanos
+		}
+		accruedRewardNanos, err := computeAccruedStakeReward(
+			accruingStakeAmountNanos, stakeEntry.RewardMethod, stakeEntry.RewardIndexCheckpoint, currentIndex,
+		)
+		if err != nil {
+			return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+		}
+		return accruedRewardNanos, nil
+	}
+
+	// The warmup stake started earning at the end of the WarmupEpochNumber. Settle the rest of
+	// the stake up to that point, then the whole stake from there. Rewards that a Restake
+	// stake accrued before that point compound along with it.
+	warmupEndIndex := warmupEndRewardIndexEntry.GetIndexForRewardMethod(stakeEntry.RewardMethod)
+	warmupRewardNanos, err := computeAccruedStakeReward(
+		earningStakeAmountNanos, stakeEntry.RewardMethod, stakeEntry.RewardIndexCheckpoint, warmupEndIndex,
+	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+	}
+	stakeAmountNanos := stakeEntry.StakeAmountNanos.Clone()
+	if stakeEntry.RewardMethod == StakingRewardMethodRestake {
+		stakeAmountNanos, err = SafeUint256().Add(stakeAmountNanos, uint256.NewInt().SetUint64(warmupRewardNanos))
+		if err != nil {
+			return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+		}
+	}
+	accruedRewardNanos, err := computeAccruedStakeReward(
+		stakeAmountNanos, stakeEntry.RewardMethod, warmupEndIndex, currentIndex,
+	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+	}
+	accruedRewardNanos, err = SafeUint64().Add(accruedRewardNanos, warmupRewardNanos)
+	if err != nil {
+		return 0, errors.Wrapf(err, "computeUnsettledStakeRewardNanos: ")
+	}
+	return accruedRewardNanos, nil
+}
+
+// settleStakeReward settles the rewards that a StakeEntry has accrued since its
+// RewardIndexCheckpoint. PayToBalance rewards are paid straight to the staker's balance,
+// and the UtxoOperation for the payment is returned. Restake rewards are returned so that
+// they can be added to the StakeEntry.
+func (bav *UtxoView) settleStakeReward(stakeEntry *StakeEntry, blockHeight uint64) (
+	_restakedRewardNanos *uint256.Int,
+	_utxoOp *UtxoOperation,
+	_err error,
+) {
+	accruedRewardNanos, err := bav.computeUnsettledStakeRewardNanos(stakeEntry, blockHeight)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "settleStakeReward: ")
+	}
+	if accruedRewardNanos == 0 {
+		return uint256.NewInt(), nil, nil
+	}
+	if stakeEntry.RewardMethod == StakingRewardMethodRestake {
+		return uint256.NewInt().SetUint64(accruedRewardNanos), nil, nil
+	}
+	utxoOp, err := bav._addBalanceForStakeReward(accruedRewardNanos, bav.GetPublicKeyForPKID(stakeEntry.StakerPKID))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "settleStakeReward: problem adding rewards to staker's DESO balance: ")
+	}
+	utxoOp.StateChangeMetadata = &StakeRewardStateChangeMetadata{
+		ValidatorPKID:       stakeEntry.ValidatorPKID,
+		StakerPKID:          stakeEntry.StakerPKID,
+		RewardNanos:         accruedRewardNanos,
+		StakingRewardMethod: StakingRewardMethodPayToBalance,
+	}
+	return uint256.NewInt(), utxoOp, nil
+}
+
+// _disconnectStakeRewardPayments reverts the PayToBalance reward payments that precede the
+// UtxoOperation at operationIndex, and returns the index of the first of them.
+func (bav *UtxoView) _disconnectStakeRewardPayments(utxoOpsForTxn []*UtxoOperation, operationIndex int) (int, error) {
+	for operationIndex > 0 && utxoOpsForTxn[operationIndex-1].Type == OperationTypeStakeDistributionPayToBalance {
+		operationIndex--
+		utxoOp := utxoOpsForTxn[operationIndex]
+		if err := bav._unAddBalance(utxoOp.BalanceAmountNanos, utxoOp.BalancePublicKey); err != nil {
+			return 0, errors.Wrapf(err, "_disconnectStakeRewardPayments: ")
+		}
+	}
+	return operationIndex, nil
+}
+
+// getValidatorRewardIndexEntryWithRestakeStake returns a copy of the validator's
+// ValidatorRewardIndexEntry that's safe to modify. If its RestakeStakeAmountNanos
+// hasn't been set yet, it's totaled from the validator's delegated StakeEntries, which
+// picks up the stakes that predate the StakingRewardsAccrualBlockHeight.
+func (bav *UtxoView) getValidatorRewardIndexEntryWithRestakeStake(validatorPKID *PKID) (*ValidatorRewardIndexEntry, error) {
+	rewardIndexEntry, err := bav.GetValidatorRewardIndexEntry(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getValidatorRewardIndexEntryWithRestakeStake: ")
+	}
+	rewardIndexEntry = rewardIndexEntry.Copy()
+	if rewardIndexEntry.RestakeStakeAmountNanos != nil {
+		return rewardIndexEntry, nil
+	}
+	delegatedStakeEntries, err := bav.GetDelegatedStakeEntriesForValidatorPKID(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getValidatorRewardIndexEntryWithRestakeStake: ")
+	}
+	rewardIndexEntry.RestakeStakeAmountNanos = uint256.NewInt()
+	for _, stakeEntry := range delegatedStakeEntries {
+		if stakeEntry.RewardMethod != StakingRewardMethodRestake {
+			continue
+		}
+		rewardIndexEntry.RestakeStakeAmountNanos, err = SafeUint256().Add(
+			rewardIndexEntry.RestakeStakeAmountNanos, stakeEntry.StakeAmountNanos,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getValidatorRewardIndexEntryWithRestakeStake: ")
+		}
+	}
+	rewardIndexEntry.RestakeWarmupStakeAmountNanos = uint256.NewInt()
+	rewardIndexEntry.RestakedRewardNanos = uint256.NewInt()
+	return rewardIndexEntry, nil
+}
+
+// updateRestakeStakeAmounts updates a validator's ValidatorRewardIndexEntry, as returned by
+// getValidatorRewardIndexEntryWithRestakeStake, after one of its StakeEntries changes from
+// prevStakeEntry to currentStakeEntry, either of which may be nil, and restakedRewardNanos of
+// its rewards are settled. The settled rewards were already added to the validator's
+// TotalStakeAmountNanos, so they're taken out of RestakedRewardNanos. If rounding left less
+// there than was settled, the shortfall is returned so that it can be added to the
+// validator's TotalStakeAmountNanos.
+func (bav *UtxoView) updateRestakeStakeAmounts(
+	rewardIndexEntry *ValidatorRewardIndexEntry,
+	prevStakeEntry *StakeEntry,
+	currentStakeEntry *StakeEntry,
+	restakedRewardNanos *uint256.Int,
+	blockHeight uint64,
+) (*uint256.Int, error) {
+	if rewardIndexEntry == nil {
+		return restakedRewardNanos.Clone(), nil
+	}
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return nil, errors.Wrapf(err, "updateRestakeStakeAmounts: ")
+	}
+	isRestakeStake := func(stakeEntry *StakeEntry) bool {
+		return stakeEntry != nil && stakeEntry.RewardMethod == StakingRewardMethodRestake &&
+			bav.isStakeRewardAccrualActive(stakeEntry, blockHeight)
+	}
+
+	restakeStakeAmountNanos := rewardIndexEntry.RestakeStakeAmountNanos
+	restakeWarmupStakeAmountNanos := getActiveWarmupStakeAmountNanos(
+		rewardIndexEntry.RestakeWarmupStakeAmountNanos, rewardIndexEntry.RestakeWarmupEpochNumber, currentEpochNumber,
+	)
+	if isRestakeStake(prevStakeEntry) {
+		restakeStakeAmountNanos, err = SafeUint256().Sub(restakeStakeAmountNanos, prevStakeEntry.StakeAmountNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updateRestakeStakeAmounts: problem removing prev StakeEntry: ")
+		}
+		restakeWarmupStakeAmountNanos, err = SafeUint256().Sub(
+			restakeWarmupStakeAmountNanos,
+			getActiveWarmupStakeAmountNanos(
+				prevStakeEntry.WarmupStakeAmountNanos, prevStakeEntry.WarmupEpochNumber, currentEpochNumber,
+			),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updateRestakeStakeAmounts: problem removing prev StakeEntry's warmup stake: ")
+		}
+	}
+	if isRestakeStake(currentStakeEntry) {
+		restakeStakeAmountNanos, err = SafeUint256().Add(restakeStakeAmountNanos, currentStakeEntry.StakeAmountNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updateRestakeStakeAmounts: problem adding current StakeEntry: ")
+		}
+		restakeWarmupStakeAmountNanos, err = SafeUint256().Add(
+			restakeWarmupStakeAmountNanos,
+			getActiveWarmupStakeAmountNanos(
+				currentStakeEntry.WarmupStakeAmountNanos, currentStakeEntry.WarmupEpochNumber, currentEpochNumber,
+			),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updateRestakeStakeAmounts: problem adding current StakeEntry's warmup stake: ")
+		}
+	}
+	rewardIndexEntry.RestakeStakeAmountNanos = restakeStakeAmountNanos
+	rewardIndexEntry.RestakeWarmupStakeAmountNanos = restakeWarmupStakeAmountNanos
+	rewardIndexEntry.RestakeWarmupEpochNumber = currentEpochNumber
+
+	settledRewardNanos := restakedRewardNanos.Clone()
+	if rewardIndexEntry.RestakedRewardNanos.Lt(settledRewardNanos) {
+		settledRewardNanos = rewardIndexEntry.RestakedRewardNanos.Clone()
+	}
+	rewardIndexEntry.RestakedRewardNanos = uint256.NewInt().Sub(rewardIndexEntry.RestakedRewardNanos, settledRewardNanos)
+	return uint256.NewInt().Sub(restakedRewardNanos, settledRewardNanos), nil
+}
+
+// getActiveWarmupStakeAmountNanos returns the portion of a stake that is still warming up
+// in the given epoch. Warmup stake from an earlier epoch is already earning rewards.
+func getActiveWarmupStakeAmountNanos(
+	warmupStakeAmountNanos *uint256.Int,
+	warmupEpochNumber uint64,
+	currentEpochNumber uint64,
+) *uint256.Int {
+	if warmupStakeAmountNanos == nil || warmupEpochNumber != currentEpochNumber {
+		return uint256.NewInt()
+	}
+	return warmupStakeAmountNanos.Clone()
+}
+
+// computeWarmupStakeAmountNanos returns the warmup stake and epoch to store on a StakeEntry or
+// ValidatorEntry after stakedAmountNanos is added to it and unstakedAmountNanos is removed from
+// it in the current epoch. Unstaked stake is taken from the warmup stake first. It returns nil
+// before the StakingRewardsAccrualBlockHeight, since snapshotted stakes are rewarded instead.
+func (bav *UtxoView) computeWarmupStakeAmountNanos(
+	warmupStakeAmountNanos *uint256.Int,
+	warmupEpochNumber uint64,
+	stakedAmountNanos *uint256.Int,
+	unstakedAmountNanos *uint256.Int,
+	blockHeight uint64,
+) (*uint256.Int, uint64, error) {
+	if blockHeight < uint64(bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight) {
+		return nil, 0, nil
+	}
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "computeWarmupStakeAmountNanos: ")
+	}
+	nextWarmupStakeAmountNanos, err := SafeUint256().Add(
+		getActiveWarmupStakeAmountNanos(warmupStakeAmountNanos, warmupEpochNumber, currentEpochNumber),
+		stakedAmountNanos,
+	)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "computeWarmupStakeAmountNanos: ")
+	}
+	if nextWarmupStakeAmountNanos.Lt(unstakedAmountNanos) {
+		return uint256.NewInt(), currentEpochNumber, nil
+	}
+	return uint256.NewInt().Sub(nextWarmupStakeAmountNanos, unstakedAmountNanos), currentEpochNumber, nil
+}
+
+// getRewardIndexCheckpoint returns the checkpoint to store on a StakeEntry whose
+// rewards have just been settled. It returns nil if accrual is not active, which
+// leaves the StakeEntry's encoding unchanged.
+func (bav *UtxoView) getRewardIndexCheckpoint(stakeEntry *StakeEntry, blockHeight uint64) (*uint256.Int, error) {
+	if !bav.isStakeRewardAccrualActive(stakeEntry, blockHeight) {
+		return nil, nil
+	}
+	rewardIndexEntry, err := bav.GetValidatorRewardIndexEntry(stakeEntry.ValidatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getRewardIndexCheckpoint: ")
+	}
+	return rewardIndexEntry.GetIndexForRewardMethod(stakeEntry.RewardMethod).Clone(), nil
+}
+
+// computeNextRewardIndexes applies one epoch's growth to a validator's reward indexes.
+// The delegators' reward rate for the epoch is (growthMultiplier - 1) net of the
+// validator's commission, which is added to the RewardPerStakeIndex and compounded
+// into the CompoundingIndex.
+func computeNextRewardIndexes(
+	rewardPerStakeIndex *uint256.Int,
+	compoundingIndex *uint256.Int,
+	growthMultiplier *big.Float,
+	commissionBasisPoints uint64,
+) (*uint256.Int, *uint256.Int, error) {
+	if commissionBasisPoints > MaxBasisPoints {
+		return nil, nil, fmt.Errorf("computeNextRewardIndexes: commission %d exceeds MaxBasisPoints", commissionBasisPoints)
+	}
+
+	// scaledRate = floor[RewardIndexScale * (growthMultiplier - 1) * (1e4 - commission) / 1e4]
+	scaledRate := convertBigFloatToBigInt(computeStakingReward(RewardIndexScale, growthMultiplier))
+	scaledRate = big.NewInt(0).Sub(scaledRate, computeValidatorCommission(scaledRate, commissionBasisPoints))
+
+	// nextRewardPerStakeIndex = rewardPerStakeIndex + scaledRate
+	nextRewardPerStakeIndex := big.NewInt(0).Add(rewardPerStakeIndex.ToBig(), scaledRate)
+
+	// nextCompoundingIndex = floor[compoundingIndex * (RewardIndexScale + scaledRate) / RewardIndexScale]
+	nextCompoundingIndex := big.NewInt(0).Add(RewardIndexScale.ToBig(), scaledRate)
+	nextCompoundingIndex.Mul(nextCompoundingIndex, compoundingIndex.ToBig())
+	nextCompoundingIndex.Div(nextCompoundingIndex, RewardIndexScale.ToBig())
+
+	nextRewardPerStakeIndexUint256, overflow := uint256.FromBig(nextRewardPerStakeIndex)
+	if overflow {
+		return nil, nil, errors.New("computeNextRewardIndexes: RewardPerStakeIndex overflows uint256")
+	}
+	nextCompoundingIndexUint256, overflow := uint256.FromBig(nextCompoundingIndex)
+	if overflow {
+		return nil, nil, errors.New("computeNextRewardIndexes: CompoundingIndex overflows uint256")
+	}
+	return nextRewardPerStakeIndexUint256, nextCompoundingIndexUint256, nil
+}
+
+// computeAccruedStakeReward computes the rewards accrued by a stake between its
+// checkpoint and the validator's current index for the stake's RewardMethod. A nil
+// checkpoint is the index's starting value: zero for PayToBalance stakes and
+// RewardIndexScale for Restake stakes.
+//
+// PayToBalance: floor[stakeAmount * (index - checkpoint) / RewardIndexScale]
+// Restake:      floor[stakeAmount * index / checkpoint] - stakeAmount
+func computeAccruedStakeReward(
+	stakeAmountNanos *uint256.Int,
+	rewardMethod StakingRewardMethod,
+	checkpoint *uint256.Int,
+	currentIndex *uint256.Int,
+) (uint64, error) {
+	if checkpoint == nil {
+		checkpoint = uint256.NewInt()
+		if rewardMethod == StakingRewardMethodRestake {
+			checkpoint = RewardIndexScale.Clone()
+		}
+	}
+	if currentIndex.Lt(checkpoint) {
+		return 0, errors.New("computeAccruedStakeReward: reward index is below the stake's checkpoint")
+	}
+
+	var accruedRewardNanos *big.Int
+	if rewardMethod == StakingRewardMethodRestake {
+		if checkpoint.IsZero() {
+			return 0, errors.New("computeAccruedStakeReward: compounding checkpoint is zero")
+		}
+		grownStakeNanos := big.NewInt(0).Mul(stakeAmountNanos.ToBig(), currentIndex.ToBig())
+		grownStakeNanos.Div(grownStakeNanos, checkpoint.ToBig())
+		accruedRewardNanos = grownStakeNanos.Sub(grownStakeNanos, stakeAmountNanos.ToBig())
+	} else {
+		indexDelta := big.NewInt(0).Sub(currentIndex.ToBig(), checkpoint.ToBig())
+		accruedRewardNanos = indexDelta.Mul(indexDelta, stakeAmountNanos.ToBig())
+		accruedRewardNanos.Div(accruedRewardNanos, RewardIndexScale.ToBig())
+	}
+
+	if !accruedRewardNanos.IsUint64() {
+		return 0, errors.New("computeAccruedStakeReward: accrued reward is not a uint64")
+	}
+	return accruedRewardNanos.Uint64(), nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetValidatorRewardIndexEntry returns the ValidatorRewardIndexEntry for the given
+// validator. If the validator has never accrued rewards, a fresh entry at the indexes'
+// starting values is returned. The returned entry must not be modified in place.
+func (bav *UtxoView) GetValidatorRewardIndexEntry(validatorPKID *PKID) (*ValidatorRewardIndexEntry, error) {
+	// First check the UtxoView.
+	rewardIndexEntry, exists := bav.ValidatorPKIDToValidatorRewardIndexEntry[*validatorPKID]
+	if exists && !rewardIndexEntry.isDeleted {
+		return rewardIndexEntry, nil
+	}
+	if exists {
+		return NewValidatorRewardIndexEntry(validatorPKID), nil
+	}
+
+	// If no ValidatorRewardIndexEntry was found in the UtxoView, check the database.
+	dbRewardIndexEntry, err := bav.GetDbAdapter().GetValidatorRewardIndexEntry(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetValidatorRewardIndexEntry: ")
+	}
+	if dbRewardIndexEntry == nil {
+		return NewValidatorRewardIndexEntry(validatorPKID), nil
+	}
+	// Cache the ValidatorRewardIndexEntry from the db in the UtxoView.
+	bav._setValidatorRewardIndexEntryMappings(dbRewardIndexEntry)
+	return dbRewardIndexEntry, nil
+}
+
+// GetRestakedRewardNanos returns the Restake rewards that have been added to a validator's
+// TotalStakeAmountNanos at the end of an epoch but not yet settled into its StakeEntries.
+func (bav *UtxoView) GetRestakedRewardNanos(validatorPKID *PKID) (*uint256.Int, error) {
+	rewardIndexEntry, err := bav.GetValidatorRewardIndexEntry(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetRestakedRewardNanos: ")
+	}
+	return getRestakedRewardNanos(rewardIndexEntry), nil
+}
+
+func getRestakedRewardNanos(rewardIndexEntry *ValidatorRewardIndexEntry) *uint256.Int {
+	if rewardIndexEntry == nil || rewardIndexEntry.RestakedRewardNanos == nil {
+		return uint256.NewInt()
+	}
+	return rewardIndexEntry.RestakedRewardNanos.Clone()
+}
+
+// GetUnsettledStakeRewardNanos returns the staking rewards a staker has earned on its
+// stake with a validator that have not yet been added to the stake or paid out.
+func (bav *UtxoView) GetUnsettledStakeRewardNanos(
+	validatorPKID *PKID,
+	stakerPKID *PKID,
+	blockHeight uint64,
+) (uint64, error) {
+	stakeEntry, err := bav.GetStakeEntry(validatorPKID, stakerPKID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "GetUnsettledStakeRewardNanos: ")
+	}
+	if stakeEntry == nil {
+		return 0, nil
+	}
+	accruedRewardNanos, err := bav.computeUnsettledStakeRewardNanos(stakeEntry, blockHeight)
+	if err != nil {
+		return 0, errors.Wrapf(err, "GetUnsettledStakeRewardNanos: ")
+	}
+	return accruedRewardNanos, nil
+}
+
+func (bav *UtxoView) _setValidatorRewardIndexEntryMappings(rewardIndexEntry *ValidatorRewardIndexEntry) {
+	// This function shouldn't be called with nil.
+	if rewardIndexEntry == nil {
+		glog.Errorf("_setValidatorRewardIndexEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ValidatorPKIDToValidatorRewardIndexEntry[*rewardIndexEntry.ValidatorPKID] = rewardIndexEntry
+}
+
+func (bav *UtxoView) _deleteValidatorRewardIndexEntryMappings(rewardIndexEntry *ValidatorRewardIndexEntry) {
+	// This function shouldn't be called with nil.
+	if rewardIndexEntry == nil {
+		glog.Errorf("_deleteValidatorRewardIndexEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *rewardIndexEntry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setValidatorRewardIndexEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushValidatorRewardIndexEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for validatorPKIDIter, entryIter := range bav.ValidatorPKIDToValidatorRewardIndexEntry {
+		// Make a copy of the iterators since we make references to them below.
+		validatorPKID := validatorPKIDIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.ValidatorPKID.Eq(&validatorPKID) {
+			return fmt.Errorf(
+				"_flushValidatorRewardIndexEntriesToDbWithTxn: ValidatorRewardIndexEntry key %v doesn't match MapKey %v",
+				entry.ValidatorPKID,
+				&validatorPKID,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteValidatorRewardIndexEntryWithTxn(
+				txn, bav.Snapshot, &validatorPKID, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushValidatorRewardIndexEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutValidatorRewardIndexEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushValidatorRewardIndexEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+// GetValidatorRewardIndexEntryAtEpochEnd returns the validator's ValidatorRewardIndexEntry as of
+// the end of the given epoch, if stake was added to the validator during that epoch and the
+// validator was rewarded for it. Otherwise, it returns nil.
+func (bav *UtxoView) GetValidatorRewardIndexEntryAtEpochEnd(
+	validatorPKID *PKID,
+	epochNumber uint64,
+) (*ValidatorRewardIndexEntry, error) {
+	// First check the UtxoView.
+	mapKey := ValidatorRewardIndexAtEpochEndMapKey{ValidatorPKID: *validatorPKID, EpochNumber: epochNumber}
+	rewardIndexEntry, exists := bav.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry[mapKey]
+	if exists {
+		if rewardIndexEntry.isDeleted {
+			return nil, nil
+		}
+		return rewardIndexEntry, nil
+	}
+
+	// If no ValidatorRewardIndexEntry was found in the UtxoView, check the database.
+	dbRewardIndexEntry, err := bav.GetDbAdapter().GetValidatorRewardIndexEntryAtEpochEnd(validatorPKID, epochNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetValidatorRewardIndexEntryAtEpochEnd: ")
+	}
+	if dbRewardIndexEntry != nil {
+		// Cache the ValidatorRewardIndexEntry from the db in the UtxoView.
+		bav._setValidatorRewardIndexAtEpochEndMappings(dbRewardIndexEntry, epochNumber)
+	}
+	return dbRewardIndexEntry, nil
+}
+
+func (bav *UtxoView) _setValidatorRewardIndexAtEpochEndMappings(
+	rewardIndexEntry *ValidatorRewardIndexEntry,
+	epochNumber uint64,
+) {
+	// This function shouldn't be called with nil.
+	if rewardIndexEntry == nil {
+		glog.Errorf("_setValidatorRewardIndexAtEpochEndMappings: called with nil entry, this should never happen")
+		return
+	}
+	mapKey := ValidatorRewardIndexAtEpochEndMapKey{ValidatorPKID: *rewardIndexEntry.ValidatorPKID, EpochNumber: epochNumber}
+	bav.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry[mapKey] = rewardIndexEntry
+}
+
+func (bav *UtxoView) _flushValidatorRewardIndexAtEpochEndEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.ValidatorRewardIndexAtEpochEndMapKeyToValidatorRewardIndexEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.ValidatorPKID.Eq(&mapKey.ValidatorPKID) {
+			return fmt.Errorf(
+				"_flushValidatorRewardIndexAtEpochEndEntriesToDbWithTxn: ValidatorRewardIndexEntry key %v doesn't match MapKey %v",
+				entry.ValidatorPKID,
+				&mapKey.ValidatorPKID,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteValidatorRewardIndexEntryAtEpochEndWithTxn(
+				txn, bav.Snapshot, &mapKey.ValidatorPKID, mapKey.EpochNumber, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushValidatorRewardIndexAtEpochEndEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutValidatorRewardIndexEntryAtEpochEndWithTxn(
+				txn, bav.Snapshot, &entry, mapKey.EpochNumber, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushValidatorRewardIndexAtEpochEndEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
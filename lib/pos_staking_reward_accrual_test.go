@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeNextRewardIndexes(t *testing.T) {
+	// A growth multiplier of 1.25 is a 25% reward rate for the epoch.
+	growthMultiplier := NewFloat().SetFloat64(1.25)
+
+	// With no commission, the delegators receive the full 25%.
+	rewardPerStakeIndex, compoundingIndex, err := computeNextRewardIndexes(
+		uint256.NewInt(), RewardIndexScale, growthMultiplier, 0,
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(25e16), rewardPerStakeIndex.Uint64())
+	require.Equal(t, uint64(125e16), compoundingIndex.Uint64())
+
+	// With a 10% commission, the delegators receive 22.5%. The RewardPerStakeIndex
+	// grows linearly while the CompoundingIndex grows geometrically.
+	rewardPerStakeIndex, compoundingIndex, err = computeNextRewardIndexes(
+		uint256.NewInt(), RewardIndexScale, growthMultiplier, 1000,
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(225e15), rewardPerStakeIndex.Uint64())
+	require.Equal(t, uint64(1225e15), compoundingIndex.Uint64())
+
+	rewardPerStakeIndex, compoundingIndex, err = computeNextRewardIndexes(
+		rewardPerStakeIndex, compoundingIndex, growthMultiplier, 1000,
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(45e16), rewardPerStakeIndex.Uint64())
+	require.Equal(t, uint64(1500625e12), compoundingIndex.Uint64())
+
+	// A commission above MaxBasisPoints is rejected.
+	_, _, err = computeNextRewardIndexes(uint256.NewInt(), RewardIndexScale, growthMultiplier, MaxBasisPoints+1)
+	require.Error(t, err)
+}
+
+func TestComputeAccruedStakeReward(t *testing.T) {
+	stakeAmountNanos := uint256.NewInt().SetUint64(1000)
+
+	// A PayToBalance stake with a nil checkpoint accrues from zero.
+	accruedRewardNanos, err := computeAccruedStakeReward(
+		stakeAmountNanos, StakingRewardMethodPayToBalance, nil, uint256.NewInt().SetUint64(45e16),
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(450), accruedRewardNanos)
+
+	// A PayToBalance stake only accrues the index growth since its checkpoint.
+	accruedRewardNanos, err = computeAccruedStakeReward(
+		stakeAmountNanos,
+		StakingRewardMethodPayToBalance,
+		uint256.NewInt().SetUint64(225e15),
+		uint256.NewInt().SetUint64(45e16),
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(225), accruedRewardNanos)
+
+	// A Restake stake with a nil checkpoint compounds from RewardIndexScale.
+	accruedRewardNanos, err = computeAccruedStakeReward(
+		stakeAmountNanos, StakingRewardMethodRestake, nil, uint256.NewInt().SetUint64(1500625e12),
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(500), accruedRewardNanos)
+
+	// A Restake stake compounds from its checkpoint.
+	accruedRewardNanos, err = computeAccruedStakeReward(
+		stakeAmountNanos,
+		StakingRewardMethodRestake,
+		uint256.NewInt().SetUint64(1225e15),
+		uint256.NewInt().SetUint64(1500625e12),
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(225), accruedRewardNanos)
+
+	// An index below the checkpoint is rejected.
+	_, err = computeAccruedStakeReward(
+		stakeAmountNanos,
+		StakingRewardMethodPayToBalance,
+		uint256.NewInt().SetUint64(45e16),
+		uint256.NewInt().SetUint64(225e15),
+	)
+	require.Error(t, err)
+}
@@ -49,6 +49,12 @@ func (bav *UtxoView) DistributeStakingRewardsToSnapshotStakes(blockHeight uint64
 	// e ^ (apy * elapsedTime / 1 year)
 	growthMultiplier := computeGrowthMultiplier(apy, elapsedFractionOfYear)
 
+	// After the StakingRewardsAccrualBlockHeight, delegators' rewards are accrued on each validator's
+	// reward index instead of being paid out to every snapshotted stake.
+	if blockHeight >= uint64(bav.Params.ForkHeights.StakingRewardsAccrualBlockHeight) {
+		return bav.distributeStakingRewardsWithAccrual(growthMultiplier)
+	}
+
 	// We reward all snapshotted stakes from the current snapshot validator set. This is an O(n) operation
 	// that loops through all of the snapshotted stakes and rewards them one by one.
 	snapshotStakesToReward, err := bav.GetAllSnapshotStakesToReward()
@@ -0,0 +1,556 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/deso-protocol/core/collections/bitset"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// pos_validator_performance.go tracks how each validator in the snapshot validator set
+// performs during every epoch: the blocks it proposed, the leader slots it missed, and
+// the QCs it contributed a signature to. The counters are updated as part of connecting
+// each PoS block, so they are part of consensus state and can be verified by anyone.
+
+//
+// TYPES: ValidatorEpochPerformanceEntry
+//
+
+type ValidatorEpochPerformanceEntry struct {
+	ValidatorPKID *PKID
+	EpochNumber   uint64
+
+	// BlocksProposed is the number of blocks the validator proposed that made it into the chain.
+	BlocksProposed uint64
+	// SlotsMissed is the number of views in which the validator was the scheduled leader but
+	// the view timed out without a block.
+	SlotsMissed uint64
+	// VotesCast is the number of QCs, vote or timeout, that included the validator's signature.
+	VotesCast uint64
+	// VotesExpected is the number of QCs that were formed while the validator was in the
+	// snapshot validator set. VotesCast / VotesExpected is the validator's participation rate.
+	VotesExpected uint64
+
+	isDeleted bool
+}
+
+type ValidatorEpochPerformanceMapKey struct {
+	ValidatorPKID PKID
+	EpochNumber   uint64
+}
+
+func (performanceEntry *ValidatorEpochPerformanceEntry) Copy() *ValidatorEpochPerformanceEntry {
+	return &ValidatorEpochPerformanceEntry{
+		ValidatorPKID:  performanceEntry.ValidatorPKID.NewPKID(),
+		EpochNumber:    performanceEntry.EpochNumber,
+		BlocksProposed: performanceEntry.BlocksProposed,
+		SlotsMissed:    performanceEntry.SlotsMissed,
+		VotesCast:      performanceEntry.VotesCast,
+		VotesExpected:  performanceEntry.VotesExpected,
+		isDeleted:      performanceEntry.isDeleted,
+	}
+}
+
+func (performanceEntry *ValidatorEpochPerformanceEntry) ToMapKey() ValidatorEpochPerformanceMapKey {
+	return ValidatorEpochPerformanceMapKey{
+		ValidatorPKID: *performanceEntry.ValidatorPKID,
+		EpochNumber:   performanceEntry.EpochNumber,
+	}
+}
+
+// IsEmpty returns true if none of the entry's counters have been incremented. An
+// empty entry is equivalent to no entry at all.
+func (performanceEntry *ValidatorEpochPerformanceEntry) IsEmpty() bool {
+	return performanceEntry.BlocksProposed == 0 &&
+		performanceEntry.SlotsMissed == 0 &&
+		performanceEntry.VotesCast == 0 &&
+		performanceEntry.VotesExpected == 0
+}
+
+func (performanceEntry *ValidatorEpochPerformanceEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, performanceEntry.ValidatorPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(performanceEntry.EpochNumber)...)
+	data = append(data, UintToBuf(performanceEntry.BlocksProposed)...)
+	data = append(data, UintToBuf(performanceEntry.SlotsMissed)...)
+	data = append(data, UintToBuf(performanceEntry.VotesCast)...)
+	data = append(data, UintToBuf(performanceEntry.VotesExpected)...)
+	return data
+}
+
+func (performanceEntry *ValidatorEpochPerformanceEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// ValidatorPKID
+	performanceEntry.ValidatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorEpochPerformanceEntry.Decode: Problem reading ValidatorPKID: ")
+	}
+
+	// EpochNumber
+	performanceEntry.EpochNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorEpochPerformanceEntry.Decode: Problem reading EpochNumber: ")
+	}
+
+	// BlocksProposed
+	performanceEntry.BlocksProposed, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorEpochPerformanceEntry.Decode: Problem reading BlocksProposed: ")
+	}
+
+	// SlotsMissed
+	performanceEntry.SlotsMissed, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorEpochPerformanceEntry.Decode: Problem reading SlotsMissed: ")
+	}
+
+	// VotesCast
+	performanceEntry.VotesCast, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorEpochPerformanceEntry.Decode: Problem reading VotesCast: ")
+	}
+
+	// VotesExpected
+	performanceEntry.VotesExpected, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorEpochPerformanceEntry.Decode: Problem reading VotesExpected: ")
+	}
+
+	return nil
+}
+
+func (performanceEntry *ValidatorEpochPerformanceEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (performanceEntry *ValidatorEpochPerformanceEntry) GetEncoderType() EncoderType {
+	return EncoderTypeValidatorEpochPerformanceEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForValidatorEpochPerformanceByPKIDAndEpoch(validatorPKID *PKID, epochNumber uint64) []byte {
+	key := DBKeyForValidatorEpochPerformanceByPKID(validatorPKID)
+	key = append(key, EncodeUint64(epochNumber)...)
+	return key
+}
+
+func DBKeyForValidatorEpochPerformanceByPKID(validatorPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixValidatorEpochPerformanceByPKIDAndEpoch...)
+	key = append(key, validatorPKID.ToBytes()...)
+	return key
+}
+
+func DBGetValidatorEpochPerformanceEntry(
+	handle *badger.DB,
+	snap *Snapshot,
+	validatorPKID *PKID,
+	epochNumber uint64,
+) (*ValidatorEpochPerformanceEntry, error) {
+	var ret *ValidatorEpochPerformanceEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetValidatorEpochPerformanceEntryWithTxn(txn, snap, validatorPKID, epochNumber)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetValidatorEpochPerformanceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	validatorPKID *PKID,
+	epochNumber uint64,
+) (*ValidatorEpochPerformanceEntry, error) {
+	// Retrieve ValidatorEpochPerformanceEntry from db.
+	key := DBKeyForValidatorEpochPerformanceByPKIDAndEpoch(validatorPKID, epochNumber)
+	performanceEntryBytes, err := DBGetWithTxn(txn, snap, key)
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetValidatorEpochPerformanceEntry: problem retrieving ValidatorEpochPerformanceEntry: ")
+	}
+
+	// Decode ValidatorEpochPerformanceEntry from bytes.
+	rr := bytes.NewReader(performanceEntryBytes)
+	performanceEntry, err := DecodeDeSoEncoder(&ValidatorEpochPerformanceEntry{}, rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetValidatorEpochPerformanceEntry: problem decoding ValidatorEpochPerformanceEntry: ")
+	}
+	return performanceEntry, nil
+}
+
+// DBGetValidatorEpochPerformanceEntriesForPKID returns all of a validator's
+// ValidatorEpochPerformanceEntries, sorted by EpochNumber ASC.
+func DBGetValidatorEpochPerformanceEntriesForPKID(
+	handle *badger.DB,
+	snap *Snapshot,
+	validatorPKID *PKID,
+) ([]*ValidatorEpochPerformanceEntry, error) {
+	prefix := DBKeyForValidatorEpochPerformanceByPKID(validatorPKID)
+	_, valsFound, err := EnumerateKeysForPrefixWithLimitOffsetOrder(
+		handle, prefix, 0, nil, false, NewSet([]string{}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetValidatorEpochPerformanceEntriesForPKID: problem retrieving entries: ")
+	}
+
+	var performanceEntries []*ValidatorEpochPerformanceEntry
+	for _, performanceEntryBytes := range valsFound {
+		rr := bytes.NewReader(performanceEntryBytes)
+		performanceEntry, err := DecodeDeSoEncoder(&ValidatorEpochPerformanceEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetValidatorEpochPerformanceEntriesForPKID: problem decoding entry: ")
+		}
+		performanceEntries = append(performanceEntries, performanceEntry)
+	}
+	return performanceEntries, nil
+}
+
+func DBPutValidatorEpochPerformanceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	performanceEntry *ValidatorEpochPerformanceEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if performanceEntry == nil {
+		return nil
+	}
+
+	// Set ValidatorEpochPerformanceEntry in PrefixValidatorEpochPerformanceByPKIDAndEpoch.
+	key := DBKeyForValidatorEpochPerformanceByPKIDAndEpoch(performanceEntry.ValidatorPKID, performanceEntry.EpochNumber)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, performanceEntry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutValidatorEpochPerformanceEntryWithTxn: problem storing ValidatorEpochPerformanceEntry in index "+
+				"PrefixValidatorEpochPerformanceByPKIDAndEpoch: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteValidatorEpochPerformanceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	performanceEntry *ValidatorEpochPerformanceEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if performanceEntry == nil {
+		return nil
+	}
+
+	// Delete ValidatorEpochPerformanceEntry from PrefixValidatorEpochPerformanceByPKIDAndEpoch.
+	key := DBKeyForValidatorEpochPerformanceByPKIDAndEpoch(performanceEntry.ValidatorPKID, performanceEntry.EpochNumber)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteValidatorEpochPerformanceEntryWithTxn: problem deleting ValidatorEpochPerformanceEntry from index "+
+				"PrefixValidatorEpochPerformanceByPKIDAndEpoch: ",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+// updateValidatorEpochPerformance records the performance of the current snapshot validator
+// set for a single PoS block. The block's QC counts as one expected vote for every validator
+// in the snapshot validator set and one cast vote for each of its signers. The block's
+// proposer is credited with a proposed block, and the scheduled leaders for any views that
+// timed out between the block's parent and the block itself are charged with a missed slot.
+//
+// It returns a single UtxoOperation that holds the previous value of every entry it touched.
+func (bav *UtxoView) updateValidatorEpochPerformance(
+	blockHeader *MsgDeSoHeader,
+	signersList *bitset.Bitset,
+	snapshotValidators []*ValidatorEntry,
+) (*UtxoOperation, error) {
+	currentEpochEntry, err := bav.GetCurrentEpochEntry()
+	if err != nil {
+		return nil, errors.Wrapf(err, "updateValidatorEpochPerformance: problem retrieving current EpochEntry: ")
+	}
+	if currentEpochEntry == nil {
+		return nil, errors.New("updateValidatorEpochPerformance: current EpochEntry is nil, this should never happen")
+	}
+	epochNumber := currentEpochEntry.EpochNumber
+
+	// Collect the updated entries by validator so that each entry is only copied once.
+	updatedEntries := make(map[PKID]*ValidatorEpochPerformanceEntry)
+	var prevEntries []*ValidatorEpochPerformanceEntry
+	getUpdatableEntry := func(validatorPKID *PKID) (*ValidatorEpochPerformanceEntry, error) {
+		if entry, exists := updatedEntries[*validatorPKID]; exists {
+			return entry, nil
+		}
+		prevEntry, err := bav.GetValidatorEpochPerformanceEntry(validatorPKID, epochNumber)
+		if err != nil {
+			return nil, err
+		}
+		prevEntries = append(prevEntries, prevEntry.Copy())
+		entry := prevEntry.Copy()
+		updatedEntries[*validatorPKID] = entry
+		return entry, nil
+	}
+
+	// Record the votes in the block's QC.
+	for ii, validatorEntry := range snapshotValidators {
+		entry, err := getUpdatableEntry(validatorEntry.ValidatorPKID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updateValidatorEpochPerformance: ")
+		}
+		entry.VotesExpected++
+		if signersList != nil && signersList.Get(ii) {
+			entry.VotesCast++
+		}
+	}
+
+	// Credit the block's proposer.
+	snapshotAtEpochNumber, err := bav.ComputeSnapshotEpochNumberForEpoch(epochNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "updateValidatorEpochPerformance: problem computing snapshot epoch number: ")
+	}
+	proposerEntry, err := bav.GetSnapshotValidatorEntryByBLSPublicKey(blockHeader.ProposerVotingPublicKey, snapshotAtEpochNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "updateValidatorEpochPerformance: problem retrieving block proposer: ")
+	}
+	if proposerEntry != nil {
+		entry, err := getUpdatableEntry(proposerEntry.ValidatorPKID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updateValidatorEpochPerformance: ")
+		}
+		entry.BlocksProposed++
+	}
+
+	// Charge the leaders of any views that timed out before this block.
+	missedSlotsByLeader, err := bav.computeMissedLeaderSlots(blockHeader, currentEpochEntry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "updateValidatorEpochPerformance: ")
+	}
+	for _, missedSlots := range missedSlotsByLeader {
+		entry, err := getUpdatableEntry(missedSlots.validatorPKID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updateValidatorEpochPerformance: ")
+		}
+		entry.SlotsMissed += missedSlots.numSlots
+	}
+
+	for _, entry := range updatedEntries {
+		bav._setValidatorEpochPerformanceEntryMappings(entry)
+	}
+
+	// Sort the previous entries so that the UtxoOperation is deterministic.
+	sort.Slice(prevEntries, func(ii, jj int) bool {
+		return bytes.Compare(prevEntries[ii].ValidatorPKID.ToBytes(), prevEntries[jj].ValidatorPKID.ToBytes()) < 0
+	})
+	return &UtxoOperation{
+		Type:                                 OperationTypeUpdateValidatorEpochPerformance,
+		PrevValidatorEpochPerformanceEntries: prevEntries,
+	}, nil
+}
+
+type missedLeaderSlots struct {
+	validatorPKID *PKID
+	numSlots      uint64
+}
+
+// computeMissedLeaderSlots returns the scheduled leaders of the views that timed out
+// between the block's parent and the block, i.e. the views in (QC.View, block.View),
+// restricted to views in the current epoch. It follows the same leader indexing as
+// hasValidBlockProposerPoS: all of these views would have produced the block at the
+// block's height, so the leader index for view v is
+//
+//	[InitialLeaderIndexOffset + (v - InitialView) - (block.Height - InitialBlockHeight)] % len(leaders)
+func (bav *UtxoView) computeMissedLeaderSlots(
+	blockHeader *MsgDeSoHeader,
+	currentEpochEntry *EpochEntry,
+) ([]missedLeaderSlots, error) {
+	qc := blockHeader.GetQC()
+	if isInterfaceValueNil(qc) {
+		return nil, nil
+	}
+	firstMissedView := qc.GetView() + 1
+	if firstMissedView < currentEpochEntry.InitialView {
+		firstMissedView = currentEpochEntry.InitialView
+	}
+	if blockHeader.ProposedInView <= firstMissedView || blockHeader.Height < currentEpochEntry.InitialBlockHeight {
+		return nil, nil
+	}
+	heightDiff := blockHeader.Height - currentEpochEntry.InitialBlockHeight
+	if firstMissedView-currentEpochEntry.InitialView < heightDiff {
+		return nil, fmt.Errorf("computeMissedLeaderSlots: view %d precedes height %d in the epoch",
+			firstMissedView, blockHeader.Height)
+	}
+
+	leaders, err := bav.GetCurrentSnapshotLeaderSchedule()
+	if err != nil {
+		return nil, errors.Wrapf(err, "computeMissedLeaderSlots: problem retrieving leader schedule: ")
+	}
+	numLeaders := uint64(len(leaders))
+	if numLeaders == 0 {
+		return nil, nil
+	}
+
+	// Every leader in the schedule misses one slot per full cycle through the schedule, and
+	// the leaders at the start of the remaining partial cycle miss one more.
+	numMissedViews := blockHeader.ProposedInView - firstMissedView
+	fullCycles := numMissedViews / numLeaders
+	firstLeaderIdx := (currentEpochEntry.InitialLeaderIndexOffset + (firstMissedView - currentEpochEntry.InitialView) - heightDiff) % numLeaders
+
+	missedSlotsByLeaderIdx := make(map[uint64]uint64)
+	if fullCycles > 0 {
+		for leaderIdx := uint64(0); leaderIdx < numLeaders; leaderIdx++ {
+			missedSlotsByLeaderIdx[leaderIdx] = fullCycles
+		}
+	}
+	for ii := uint64(0); ii < numMissedViews%numLeaders; ii++ {
+		missedSlotsByLeaderIdx[(firstLeaderIdx+ii)%numLeaders]++
+	}
+
+	var missedSlots []missedLeaderSlots
+	for leaderIdx := uint64(0); leaderIdx < numLeaders; leaderIdx++ {
+		numSlots, exists := missedSlotsByLeaderIdx[leaderIdx]
+		if !exists {
+			continue
+		}
+		leaderEntry, err := bav.GetSnapshotLeaderScheduleValidator(uint16(leaderIdx))
+		if err != nil {
+			return nil, errors.Wrapf(err, "computeMissedLeaderSlots: problem retrieving leader %d: ", leaderIdx)
+		}
+		if leaderEntry == nil {
+			continue
+		}
+		missedSlots = append(missedSlots, missedLeaderSlots{validatorPKID: leaderEntry.ValidatorPKID, numSlots: numSlots})
+	}
+	return missedSlots, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetValidatorEpochPerformanceEntry returns the validator's performance during the given
+// epoch. If nothing was recorded for the validator, an empty entry is returned.
+func (bav *UtxoView) GetValidatorEpochPerformanceEntry(
+	validatorPKID *PKID,
+	epochNumber uint64,
+) (*ValidatorEpochPerformanceEntry, error) {
+	mapKey := ValidatorEpochPerformanceMapKey{ValidatorPKID: *validatorPKID, EpochNumber: epochNumber}
+	emptyEntry := &ValidatorEpochPerformanceEntry{ValidatorPKID: validatorPKID.NewPKID(), EpochNumber: epochNumber}
+
+	// First check the UtxoView.
+	if performanceEntry, exists := bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry[mapKey]; exists {
+		if performanceEntry.isDeleted {
+			return emptyEntry, nil
+		}
+		return performanceEntry, nil
+	}
+
+	// Then check the database.
+	dbPerformanceEntry, err := bav.GetDbAdapter().GetValidatorEpochPerformanceEntry(validatorPKID, epochNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetValidatorEpochPerformanceEntry: ")
+	}
+	if dbPerformanceEntry == nil {
+		return emptyEntry, nil
+	}
+	// Cache the ValidatorEpochPerformanceEntry from the db in the UtxoView.
+	bav._setValidatorEpochPerformanceEntryMappings(dbPerformanceEntry)
+	return dbPerformanceEntry, nil
+}
+
+// GetValidatorEpochPerformanceEntriesForPKID returns the validator's performance for
+// every epoch in which something was recorded, sorted by EpochNumber ASC.
+func (bav *UtxoView) GetValidatorEpochPerformanceEntriesForPKID(
+	validatorPKID *PKID,
+) ([]*ValidatorEpochPerformanceEntry, error) {
+	// First, pull matching entries from the db and cache them in the UtxoView.
+	dbPerformanceEntries, err := bav.GetDbAdapter().GetValidatorEpochPerformanceEntriesForPKID(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetValidatorEpochPerformanceEntriesForPKID: ")
+	}
+	for _, performanceEntry := range dbPerformanceEntries {
+		if _, exists := bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry[performanceEntry.ToMapKey()]; !exists {
+			bav._setValidatorEpochPerformanceEntryMappings(performanceEntry)
+		}
+	}
+
+	// Then, pull matching entries from the UtxoView.
+	var performanceEntries []*ValidatorEpochPerformanceEntry
+	for _, performanceEntry := range bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry {
+		if !performanceEntry.ValidatorPKID.Eq(validatorPKID) || performanceEntry.isDeleted {
+			continue
+		}
+		performanceEntries = append(performanceEntries, performanceEntry)
+	}
+	sort.Slice(performanceEntries, func(ii, jj int) bool {
+		return performanceEntries[ii].EpochNumber < performanceEntries[jj].EpochNumber
+	})
+	return performanceEntries, nil
+}
+
+func (bav *UtxoView) _setValidatorEpochPerformanceEntryMappings(performanceEntry *ValidatorEpochPerformanceEntry) {
+	// This function shouldn't be called with nil.
+	if performanceEntry == nil {
+		glog.Errorf("_setValidatorEpochPerformanceEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry[performanceEntry.ToMapKey()] = performanceEntry
+}
+
+func (bav *UtxoView) _deleteValidatorEpochPerformanceEntryMappings(performanceEntry *ValidatorEpochPerformanceEntry) {
+	// This function shouldn't be called with nil.
+	if performanceEntry == nil {
+		glog.Errorf("_deleteValidatorEpochPerformanceEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *performanceEntry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to the point to the tombstone entry.
+	bav._setValidatorEpochPerformanceEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushValidatorEpochPerformanceEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries in the view. Delete the entries that have isDeleted=true
+	// and update the entries that don't.
+	for mapKeyIter, entryIter := range bav.ValidatorEpochPerformanceMapKeyToValidatorEpochPerformanceEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		mapKeyInEntry := entry.ToMapKey()
+		if mapKeyInEntry != mapKey {
+			return fmt.Errorf(
+				"_flushValidatorEpochPerformanceEntriesToDbWithTxn: ValidatorEpochPerformanceEntry key %v doesn't match MapKey %v",
+				&mapKeyInEntry,
+				&mapKey,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteValidatorEpochPerformanceEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushValidatorEpochPerformanceEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutValidatorEpochPerformanceEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushValidatorEpochPerformanceEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
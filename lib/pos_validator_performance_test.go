@@ -0,0 +1,187 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatorEpochPerformanceEntries(t *testing.T) {
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+
+	newTestPKID := func(id byte) *PKID {
+		pkidBytes := make([]byte, PublicKeyLenCompressed)
+		pkidBytes[0] = id
+		return NewPKID(pkidBytes)
+	}
+	validatorPKID := newTestPKID(1)
+	otherValidatorPKID := newTestPKID(2)
+
+	// Store entries for two epochs, out of order, and one for another validator.
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	utxoView._setValidatorEpochPerformanceEntryMappings(&ValidatorEpochPerformanceEntry{
+		ValidatorPKID: validatorPKID, EpochNumber: 5, BlocksProposed: 3, SlotsMissed: 1, VotesCast: 9, VotesExpected: 10,
+	})
+	utxoView._setValidatorEpochPerformanceEntryMappings(&ValidatorEpochPerformanceEntry{
+		ValidatorPKID: validatorPKID, EpochNumber: 4, BlocksProposed: 2, VotesCast: 10, VotesExpected: 10,
+	})
+	utxoView._setValidatorEpochPerformanceEntryMappings(&ValidatorEpochPerformanceEntry{
+		ValidatorPKID: otherValidatorPKID, EpochNumber: 4, SlotsMissed: 4, VotesExpected: 10,
+	})
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return utxoView._flushValidatorEpochPerformanceEntriesToDbWithTxn(txn, 0)
+	}))
+
+	// The entries can be read back from the db, sorted by EpochNumber.
+	dbEntry, err := DBGetValidatorEpochPerformanceEntry(db, nil, validatorPKID, 5)
+	require.NoError(t, err)
+	require.NotNil(t, dbEntry)
+	require.Equal(t, uint64(3), dbEntry.BlocksProposed)
+	require.Equal(t, uint64(1), dbEntry.SlotsMissed)
+	require.Equal(t, uint64(9), dbEntry.VotesCast)
+	require.Equal(t, uint64(10), dbEntry.VotesExpected)
+
+	dbEntry, err = DBGetValidatorEpochPerformanceEntry(db, nil, validatorPKID, 6)
+	require.NoError(t, err)
+	require.Nil(t, dbEntry)
+
+	dbEntries, err := DBGetValidatorEpochPerformanceEntriesForPKID(db, nil, validatorPKID)
+	require.NoError(t, err)
+	require.Len(t, dbEntries, 2)
+	require.Equal(t, uint64(4), dbEntries[0].EpochNumber)
+	require.Equal(t, uint64(5), dbEntries[1].EpochNumber)
+
+	// A fresh view merges the db entries with its own mappings.
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+	epoch4Entry, err := utxoView.GetValidatorEpochPerformanceEntry(validatorPKID, 4)
+	require.NoError(t, err)
+	utxoView._deleteValidatorEpochPerformanceEntryMappings(epoch4Entry)
+	utxoView._setValidatorEpochPerformanceEntryMappings(&ValidatorEpochPerformanceEntry{
+		ValidatorPKID: validatorPKID, EpochNumber: 6, BlocksProposed: 1, VotesCast: 1, VotesExpected: 1,
+	})
+
+	viewEntries, err := utxoView.GetValidatorEpochPerformanceEntriesForPKID(validatorPKID)
+	require.NoError(t, err)
+	require.Len(t, viewEntries, 2)
+	require.Equal(t, uint64(5), viewEntries[0].EpochNumber)
+	require.Equal(t, uint64(6), viewEntries[1].EpochNumber)
+
+	// A deleted or missing entry is returned as an empty entry.
+	epoch4Entry, err = utxoView.GetValidatorEpochPerformanceEntry(validatorPKID, 4)
+	require.NoError(t, err)
+	require.True(t, epoch4Entry.IsEmpty())
+	epoch7Entry, err := utxoView.GetValidatorEpochPerformanceEntry(validatorPKID, 7)
+	require.NoError(t, err)
+	require.True(t, epoch7Entry.IsEmpty())
+	require.Equal(t, uint64(7), epoch7Entry.EpochNumber)
+}
+
+func TestJailMissedSlotsThreshold(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.ValidatorPerformanceTrackingBlockHeight = 10
+	paramUpdaterPriv, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+	paramUpdaterPkBytes := paramUpdaterPriv.PubKey().SerializeCompressed()
+	params.ExtraRegtestParamUpdaterKeys = map[PkMapKey]bool{MakePkMapKey(paramUpdaterPkBytes): true}
+	require.Equal(uint64(20), params.DefaultJailMissedSlotsThreshold)
+
+	validatorEntry := &ValidatorEntry{ValidatorPKID: NewPKID(m0PkBytes)}
+	currentEpochNumber := uint64(5)
+	newUtxoView := func() *UtxoView {
+		utxoView := NewUtxoView(db, &params, nil, nil, nil)
+		utxoView._setCurrentEpochEntry(&EpochEntry{
+			EpochNumber:        currentEpochNumber,
+			InitialBlockHeight: 0,
+			FinalBlockHeight:   100,
+		})
+		return utxoView
+	}
+	setSlotsMissed := func(utxoView *UtxoView, epochNumber uint64, slotsMissed uint64) {
+		utxoView._setValidatorEpochPerformanceEntryMappings(&ValidatorEpochPerformanceEntry{
+			ValidatorPKID: validatorEntry.ValidatorPKID, EpochNumber: epochNumber, SlotsMissed: slotsMissed,
+		})
+	}
+	requireExceeds := func(utxoView *UtxoView, blockHeight uint64, expected bool) {
+		exceeds, err := utxoView.ExceedsJailMissedSlotsThreshold(validatorEntry, blockHeight)
+		require.NoError(err)
+		require.Equal(expected, exceeds)
+	}
+
+	// Missed slots aren't tracked before the fork, so they never exceed the threshold.
+	utxoView := newUtxoView()
+	setSlotsMissed(utxoView, currentEpochNumber, 100)
+	requireExceeds(utxoView, 9, false)
+
+	// From the fork onward, a validator can miss up to the default threshold of 20 slots
+	// in the current epoch without being jailed, but not 21.
+	setSlotsMissed(utxoView, currentEpochNumber, 20)
+	requireExceeds(utxoView, 10, false)
+	shouldJail, err := utxoView.ShouldJailValidator(validatorEntry, 10)
+	require.NoError(err)
+	require.False(shouldJail)
+	setSlotsMissed(utxoView, currentEpochNumber, 21)
+	requireExceeds(utxoView, 10, true)
+	shouldJail, err = utxoView.ShouldJailValidator(validatorEntry, 10)
+	require.NoError(err)
+	require.True(shouldJail)
+
+	// A validator that's already jailed isn't jailed again.
+	jailedValidatorEntry := *validatorEntry
+	jailedValidatorEntry.JailedAtEpochNumber = currentEpochNumber - 1
+	shouldJail, err = utxoView.ShouldJailValidator(&jailedValidatorEntry, 10)
+	require.NoError(err)
+	require.False(shouldJail)
+
+	// Only slots missed in the current epoch count.
+	utxoView = newUtxoView()
+	setSlotsMissed(utxoView, currentEpochNumber-1, 100)
+	setSlotsMissed(utxoView, currentEpochNumber, 1)
+	requireExceeds(utxoView, 10, false)
+
+	updateThreshold := func(threshold uint64, blockHeight uint32) (*UtxoView, error) {
+		utxoView := newUtxoView()
+		txn := &MsgDeSoTxn{
+			PublicKey: paramUpdaterPkBytes,
+			TxnMeta:   &UpdateGlobalParamsMetadata{},
+			ExtraData: map[string][]byte{
+				// The fee bucket check rejects updates that leave the min network fee at zero.
+				MinNetworkFeeNanosPerKBKey:  UintToBuf(1000),
+				JailMissedSlotsThresholdKey: UintToBuf(threshold),
+			},
+		}
+		_, _, _, err := utxoView._connectUpdateGlobalParams(txn, txn.Hash(), blockHeight, false)
+		return utxoView, err
+	}
+
+	// The threshold can't be updated before the fork or set below the min.
+	_, err = updateThreshold(30, 9)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorJailMissedSlotsThresholdBeforeBlockHeight)
+	_, err = updateThreshold(MinJailMissedSlotsThreshold-1, 10)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorJailMissedSlotsThresholdTooLow)
+
+	// Once it's updated, jailing uses the new threshold instead of the default.
+	utxoView, err = updateThreshold(30, 10)
+	require.NoError(err)
+	require.Equal(uint64(30), utxoView.GetCurrentGlobalParamsEntry().JailMissedSlotsThreshold)
+	setSlotsMissed(utxoView, currentEpochNumber, 21)
+	requireExceeds(utxoView, 10, false)
+	setSlotsMissed(utxoView, currentEpochNumber, 30)
+	requireExceeds(utxoView, 10, false)
+	setSlotsMissed(utxoView, currentEpochNumber, 31)
+	requireExceeds(utxoView, 10, true)
+}
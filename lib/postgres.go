@@ -536,6 +536,7 @@ type PGProfile struct {
 	DAOCoinCoinsInCirculationNanos   string                    `pg:"dao_coin_coins_in_circulation_nanos"`
 	DAOCoinMintingDisabled           bool                      `pg:"dao_coin_minting_disabled"`
 	DAOCoinTransferRestrictionStatus TransferRestrictionStatus `pg:"dao_coin_transfer_restriction_status"`
+	DAOCoinDecimals                  uint8                     `pg:"dao_coin_decimals,use_zero"`
 	ExtraData                        map[string][]byte
 }
 
@@ -543,6 +544,45 @@ func (profile *PGProfile) Empty() bool {
 	return profile.Username == ""
 }
 
+// NewProfileEntry returns the ProfileEntry for the profile, or nil if the profile is empty.
+func (profile *PGProfile) NewProfileEntry() *ProfileEntry {
+	if profile == nil || profile.Empty() {
+		return nil
+	}
+	var daoCoinsInCirculationNanos *uint256.Int
+	if profile.DAOCoinCoinsInCirculationNanos != "" {
+		var err error
+		daoCoinsInCirculationNanos, err = uint256.FromHex(profile.DAOCoinCoinsInCirculationNanos)
+		if err != nil {
+			daoCoinsInCirculationNanos = uint256.NewInt()
+		}
+	} else {
+		daoCoinsInCirculationNanos = uint256.NewInt()
+	}
+	return &ProfileEntry{
+		PublicKey:   profile.PublicKey.ToBytes(),
+		Username:    []byte(profile.Username),
+		Description: []byte(profile.Description),
+		ProfilePic:  profile.ProfilePic,
+		CreatorCoinEntry: CoinEntry{
+			CreatorBasisPoints:      profile.CreatorBasisPoints,
+			DeSoLockedNanos:         profile.DeSoLockedNanos,
+			NumberOfHolders:         profile.NumberOfHolders,
+			CoinsInCirculationNanos: *uint256.NewInt().SetUint64(profile.CoinsInCirculationNanos),
+			CoinWatermarkNanos:      profile.CoinWatermarkNanos,
+			MintingDisabled:         profile.MintingDisabled,
+		},
+		DAOCoinEntry: CoinEntry{
+			NumberOfHolders:           profile.DAOCoinNumberOfHolders,
+			CoinsInCirculationNanos:   *daoCoinsInCirculationNanos,
+			MintingDisabled:           profile.DAOCoinMintingDisabled,
+			TransferRestrictionStatus: profile.DAOCoinTransferRestrictionStatus,
+			Decimals:                  profile.DAOCoinDecimals,
+		},
+		ExtraData: profile.ExtraData,
+	}
+}
+
 type PGPost struct {
 	tableName struct{} `pg:"pg_posts"`
 
@@ -760,6 +800,12 @@ type PGDAOCoinLimitOrder struct {
 	OperationType                             uint8      `pg:",use_zero"`
 	FillType                                  uint8      `pg:",use_zero"`
 	BlockHeight                               uint32     `pg:",use_zero"`
+	ExpirationBlockHeight                     uint32     `pg:",use_zero"`
+	StopTriggerScaledPrice                    string     `pg:",use_zero"` // Empty for regular limit orders.
+	MinQuantityToFillInBaseUnits              string     `pg:",use_zero"` // Empty if the order has no minimum.
+	QuantityDenomination                      uint8      `pg:",use_zero"`
+	BuyingCoinIsCreatorCoin                   bool       `pg:",use_zero"`
+	SellingCoinIsCreatorCoin                  bool       `pg:",use_zero"`
 }
 
 func (order *PGDAOCoinLimitOrder) FromDAOCoinLimitOrderEntry(orderEntry *DAOCoinLimitOrderEntry) {
@@ -772,6 +818,7 @@ func (order *PGDAOCoinLimitOrder) FromDAOCoinLimitOrderEntry(orderEntry *DAOCoin
 	operationType := uint8(orderEntry.OperationType)
 	fillType := uint8(orderEntry.FillType)
 	blockHeight := orderEntry.BlockHeight
+	expirationBlockHeight := orderEntry.ExpirationBlockHeight
 
 	order.OrderID = &orderId
 	order.TransactorPKID = &transactorPKID
@@ -782,6 +829,18 @@ func (order *PGDAOCoinLimitOrder) FromDAOCoinLimitOrderEntry(orderEntry *DAOCoin
 	order.OperationType = operationType
 	order.FillType = fillType
 	order.BlockHeight = blockHeight
+	order.ExpirationBlockHeight = expirationBlockHeight
+	order.StopTriggerScaledPrice = ""
+	if orderEntry.StopTriggerScaledPrice != nil {
+		order.StopTriggerScaledPrice = Uint256ToLeftPaddedHex(orderEntry.StopTriggerScaledPrice.Clone())
+	}
+	order.MinQuantityToFillInBaseUnits = ""
+	if orderEntry.MinQuantityToFillInBaseUnits != nil {
+		order.MinQuantityToFillInBaseUnits = Uint256ToLeftPaddedHex(orderEntry.MinQuantityToFillInBaseUnits.Clone())
+	}
+	order.QuantityDenomination = uint8(orderEntry.QuantityDenomination)
+	order.BuyingCoinIsCreatorCoin = orderEntry.BuyingCoinIsCreatorCoin
+	order.SellingCoinIsCreatorCoin = orderEntry.SellingCoinIsCreatorCoin
 }
 
 func (order *PGDAOCoinLimitOrder) ToDAOCoinLimitOrderEntry() *DAOCoinLimitOrderEntry {
@@ -794,6 +853,15 @@ func (order *PGDAOCoinLimitOrder) ToDAOCoinLimitOrderEntry() *DAOCoinLimitOrderE
 	operationType := order.OperationType
 	fillType := order.FillType
 	blockHeight := order.BlockHeight
+	expirationBlockHeight := order.ExpirationBlockHeight
+	var stopTriggerScaledPrice *uint256.Int
+	if order.StopTriggerScaledPrice != "" {
+		stopTriggerScaledPrice = LeftPaddedHexToUint256(order.StopTriggerScaledPrice)
+	}
+	var minQuantityToFillInBaseUnits *uint256.Int
+	if order.MinQuantityToFillInBaseUnits != "" {
+		minQuantityToFillInBaseUnits = LeftPaddedHexToUint256(order.MinQuantityToFillInBaseUnits)
+	}
 
 	return &DAOCoinLimitOrderEntry{
 		OrderID:                   &orderId,
@@ -805,6 +873,134 @@ func (order *PGDAOCoinLimitOrder) ToDAOCoinLimitOrderEntry() *DAOCoinLimitOrderE
 		OperationType:                             DAOCoinLimitOrderOperationType(operationType),
 		FillType:                                  DAOCoinLimitOrderFillType(fillType),
 		BlockHeight:                               blockHeight,
+		ExpirationBlockHeight:                     expirationBlockHeight,
+		StopTriggerScaledPrice:                    stopTriggerScaledPrice,
+		MinQuantityToFillInBaseUnits:              minQuantityToFillInBaseUnits,
+		QuantityDenomination:                      DAOCoinLimitOrderQuantityDenomination(order.QuantityDenomination),
+		BuyingCoinIsCreatorCoin:                   order.BuyingCoinIsCreatorCoin,
+		SellingCoinIsCreatorCoin:                  order.SellingCoinIsCreatorCoin,
+	}
+}
+
+// PGDAOCoinLastTradePrice represents DAOCoinLastTradePriceEntry
+type PGDAOCoinLastTradePrice struct {
+	tableName struct{} `pg:"pg_dao_coin_last_trade_prices"`
+
+	BuyingDAOCoinCreatorPKID                  *PKID  `pg:"buying_dao_coin_creator_pkid,pk,type:bytea"`
+	SellingDAOCoinCreatorPKID                 *PKID  `pg:"selling_dao_coin_creator_pkid,pk,type:bytea"`
+	ScaledExchangeRateCoinsToSellPerCoinToBuy string `pg:",use_zero"`
+	TimeWeightedScaledExchangeRate            string `pg:",use_zero"`
+	BlockHeight                               uint32 `pg:",use_zero"`
+}
+
+func (price *PGDAOCoinLastTradePrice) FromDAOCoinLastTradePriceEntry(entry *DAOCoinLastTradePriceEntry) {
+	price.BuyingDAOCoinCreatorPKID = entry.BuyingDAOCoinCreatorPKID.NewPKID()
+	price.SellingDAOCoinCreatorPKID = entry.SellingDAOCoinCreatorPKID.NewPKID()
+	if entry.ScaledExchangeRateCoinsToSellPerCoinToBuy != nil {
+		price.ScaledExchangeRateCoinsToSellPerCoinToBuy = Uint256ToLeftPaddedHex(
+			entry.ScaledExchangeRateCoinsToSellPerCoinToBuy.Clone())
+	}
+	if entry.TimeWeightedScaledExchangeRate != nil {
+		price.TimeWeightedScaledExchangeRate = Uint256ToLeftPaddedHex(entry.TimeWeightedScaledExchangeRate.Clone())
+	}
+	price.BlockHeight = entry.BlockHeight
+}
+
+func (price *PGDAOCoinLastTradePrice) ToDAOCoinLastTradePriceEntry() *DAOCoinLastTradePriceEntry {
+	entry := &DAOCoinLastTradePriceEntry{
+		BuyingDAOCoinCreatorPKID:  price.BuyingDAOCoinCreatorPKID.NewPKID(),
+		SellingDAOCoinCreatorPKID: price.SellingDAOCoinCreatorPKID.NewPKID(),
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: LeftPaddedHexToUint256(
+			price.ScaledExchangeRateCoinsToSellPerCoinToBuy),
+		BlockHeight: price.BlockHeight,
+	}
+	// Rows written before the time-weighted price was tracked don't have one.
+	if price.TimeWeightedScaledExchangeRate != "" {
+		entry.TimeWeightedScaledExchangeRate = LeftPaddedHexToUint256(price.TimeWeightedScaledExchangeRate)
+	}
+	return entry
+}
+
+// PGLockedBalance represents LockedBalanceEntry
+type PGLockedBalance struct {
+	tableName struct{} `pg:"pg_locked_balances"`
+
+	HODLerPKID                  *PKID  `pg:"hodler_pkid,pk,type:bytea"`
+	ProfilePKID                 *PKID  `pg:"profile_pkid,pk,type:bytea"`
+	UnlockTimestampNanoSecs     int64  `pg:",pk,use_zero"`
+	VestingEndTimestampNanoSecs int64  `pg:",pk,use_zero"`
+	BalanceBaseUnits            string `pg:",use_zero"`
+}
+
+func (balance *PGLockedBalance) FromLockedBalanceEntry(entry *LockedBalanceEntry) {
+	balance.HODLerPKID = entry.HODLerPKID.NewPKID()
+	balance.ProfilePKID = entry.ProfilePKID.NewPKID()
+	balance.UnlockTimestampNanoSecs = entry.UnlockTimestampNanoSecs
+	balance.VestingEndTimestampNanoSecs = entry.VestingEndTimestampNanoSecs
+	balance.BalanceBaseUnits = Uint256ToLeftPaddedHex(entry.BalanceBaseUnits.Clone())
+}
+
+func (balance *PGLockedBalance) ToLockedBalanceEntry() *LockedBalanceEntry {
+	return &LockedBalanceEntry{
+		HODLerPKID:                  balance.HODLerPKID.NewPKID(),
+		ProfilePKID:                 balance.ProfilePKID.NewPKID(),
+		UnlockTimestampNanoSecs:     balance.UnlockTimestampNanoSecs,
+		VestingEndTimestampNanoSecs: balance.VestingEndTimestampNanoSecs,
+		BalanceBaseUnits:            *LeftPaddedHexToUint256(balance.BalanceBaseUnits),
+	}
+}
+
+// PGProposal represents ProposalEntry
+type PGProposal struct {
+	tableName struct{} `pg:"pg_proposals"`
+
+	ProposalID           *BlockHash `pg:",pk,type:bytea"`
+	ProposerPKID         *PKID      `pg:",type:bytea"`
+	ProfilePKID          *PKID      `pg:",type:bytea"`
+	Description          string     `pg:",use_zero"`
+	Options              []string   `pg:",array"`
+	SnapshotBlockHeight  uint64     `pg:",use_zero"`
+	VotingEndBlockHeight uint64     `pg:",use_zero"`
+	OptionVotingPowers   []string   `pg:",array"`
+	TotalVotingPower     string     `pg:",use_zero"`
+}
+
+func (proposal *PGProposal) FromProposalEntry(entry *ProposalEntry) {
+	proposal.ProposalID = entry.ProposalID.NewBlockHash()
+	proposal.ProposerPKID = entry.ProposerPKID.NewPKID()
+	proposal.ProfilePKID = entry.ProfilePKID.NewPKID()
+	proposal.Description = string(entry.Description)
+	proposal.Options = nil
+	for _, option := range entry.Options {
+		proposal.Options = append(proposal.Options, string(option))
+	}
+	proposal.SnapshotBlockHeight = entry.SnapshotBlockHeight
+	proposal.VotingEndBlockHeight = entry.VotingEndBlockHeight
+	proposal.OptionVotingPowers = nil
+	for _, votingPower := range entry.OptionVotingPowers {
+		proposal.OptionVotingPowers = append(proposal.OptionVotingPowers, Uint256ToLeftPaddedHex(votingPower.Clone()))
+	}
+	proposal.TotalVotingPower = Uint256ToLeftPaddedHex(entry.TotalVotingPower.Clone())
+}
+
+// PGProposalVote represents VoteEntry
+type PGProposalVote struct {
+	tableName struct{} `pg:"pg_proposal_votes"`
+
+	ProposalID  *BlockHash `pg:",pk,type:bytea"`
+	VoterPKID   *PKID      `pg:",pk,type:bytea"`
+	VotingPower string     `pg:",use_zero"`
+	// OptionIndex is -1 if the holder hasn't voted.
+	OptionIndex int64 `pg:",use_zero"`
+}
+
+func (vote *PGProposalVote) FromVoteEntry(entry *VoteEntry) {
+	vote.ProposalID = entry.ProposalID.NewBlockHash()
+	vote.VoterPKID = entry.VoterPKID.NewPKID()
+	vote.VotingPower = Uint256ToLeftPaddedHex(entry.VotingPower.Clone())
+	vote.OptionIndex = -1
+	if entry.HasVoted() {
+		vote.OptionIndex = int64(entry.OptionIndex)
 	}
 }
 
@@ -1243,6 +1439,7 @@ type PGDerivedKey struct {
 	TransactionSpendingLimitTracker []byte `pg:",type:bytea"`
 	Memo                            []byte `pg:",type:bytea"`
 	BlockHeight                     uint64 `pg:",use_zero"`
+	Nonce                           uint64 `pg:",use_zero"`
 }
 
 func (key *PGDerivedKey) NewDerivedKeyEntry() *DerivedKeyEntry {
@@ -1265,6 +1462,7 @@ func (key *PGDerivedKey) NewDerivedKeyEntry() *DerivedKeyEntry {
 		ExtraData:                       key.ExtraData,
 		TransactionSpendingLimitTracker: tsl,
 		Memo:                            key.Memo,
+		Nonce:                           key.Nonce,
 	}
 }
 
@@ -1733,7 +1931,7 @@ func (postgres *Postgres) InsertTransactionsTx(tx *pg.Tx, desoTxns []*MsgDeSoTxn
 		} else if txn.TxnMeta.GetTxnType() == TxnTypeDAOCoinLimitOrder {
 			txMeta := txn.TxnMeta.(*DAOCoinLimitOrderMetadata)
 
-			if txMeta.CancelOrderID != nil {
+			if txMeta.CancelOrderID != nil && !txMeta.ReplaceCancelledOrder {
 				// Transactor is cancelling an existing order.
 				metadataDAOCoinLimitOrder = append(metadataDAOCoinLimitOrder, &PGMetadataDAOCoinLimitOrder{
 					TransactionHash: txnHash,
@@ -1744,9 +1942,11 @@ func (postgres *Postgres) InsertTransactionsTx(tx *pg.Tx, desoTxns []*MsgDeSoTxn
 				break
 			}
 
-			// Transactor is submitting a new order.
+			// Transactor is submitting a new order. If it replaces an existing order,
+			// CancelOrderID is set as well.
 			metadataDAOCoinLimitOrder = append(metadataDAOCoinLimitOrder, &PGMetadataDAOCoinLimitOrder{
 				TransactionHash:                           txnHash,
+				CancelOrderID:                             txMeta.CancelOrderID,
 				BuyingDAOCoinCreatorPublicKey:             txMeta.BuyingDAOCoinCreatorPublicKey,
 				SellingDAOCoinCreatorPublicKey:            txMeta.SellingDAOCoinCreatorPublicKey,
 				ScaledExchangeRateCoinsToSellPerCoinToBuy: txMeta.ScaledExchangeRateCoinsToSellPerCoinToBuy.Hex(),
@@ -2331,6 +2531,25 @@ func (postgres *Postgres) FlushView(view *UtxoView, blockHeight uint64) error {
 		//if err := postgres.flushDAOCoinLimitOrders(tx, view); err != nil {
 		//	return err
 		//}
+		// Last trade prices are matched against from badger along with limit
+		// orders. They're mirrored here so they can be queried alongside the
+		// rest of the exchange data.
+		if err := postgres.flushDAOCoinLastTradePrices(tx, view); err != nil {
+			return err
+		}
+		// Locked balances are also read from badger when txns are connected, and
+		// they're mirrored here so vesting schedules can be queried.
+		if err := postgres.flushLockedBalances(tx, view); err != nil {
+			return err
+		}
+		// Governance entries are also read from badger, and they're mirrored here so
+		// proposals and votes can be queried.
+		if err := postgres.flushProposals(tx, view); err != nil {
+			return err
+		}
+		if err := postgres.flushProposalVotes(tx, view); err != nil {
+			return err
+		}
 		if err := postgres.flushUserAssociations(tx, view, blockHeight); err != nil {
 			return err
 		}
@@ -2394,6 +2613,7 @@ func (postgres *Postgres) flushProfiles(tx *pg.Tx, view *UtxoView) error {
 			profile.DAOCoinMintingDisabled = profileEntry.DAOCoinEntry.MintingDisabled
 			profile.DAOCoinNumberOfHolders = profileEntry.DAOCoinEntry.NumberOfHolders
 			profile.DAOCoinTransferRestrictionStatus = profileEntry.DAOCoinEntry.TransferRestrictionStatus
+			profile.DAOCoinDecimals = profileEntry.DAOCoinEntry.Decimals
 			profile.ExtraData = profileEntry.ExtraData
 		}
 
@@ -2909,6 +3129,7 @@ func (postgres *Postgres) flushDerivedKeys(tx *pg.Tx, view *UtxoView, blockHeigh
 			TransactionSpendingLimitTracker: tslBytes,
 			Memo:                            keyEntry.Memo,
 			BlockHeight:                     blockHeight,
+			Nonce:                           keyEntry.Nonce,
 		}
 
 		if keyEntry.isDeleted {
@@ -2976,6 +3197,171 @@ func (postgres *Postgres) flushDAOCoinLimitOrders(tx *pg.Tx, view *UtxoView) err
 	return nil
 }
 
+func (postgres *Postgres) flushDAOCoinLastTradePrices(tx *pg.Tx, view *UtxoView) error {
+	var insertPrices []*PGDAOCoinLastTradePrice
+	var deletePrices []*PGDAOCoinLastTradePrice
+
+	for _, entry := range view.DAOCoinPairMapKeyToDAOCoinLastTradePriceEntry {
+		if entry == nil {
+			continue
+		}
+
+		price := &PGDAOCoinLastTradePrice{}
+		price.FromDAOCoinLastTradePriceEntry(entry)
+
+		if entry.isDeleted {
+			deletePrices = append(deletePrices, price)
+		} else {
+			insertPrices = append(insertPrices, price)
+		}
+	}
+
+	if len(insertPrices) > 0 {
+		_, err := tx.Model(&insertPrices).
+			WherePK().
+			OnConflict("(buying_dao_coin_creator_pkid, selling_dao_coin_creator_pkid) DO UPDATE").
+			Returning("NULL").
+			Insert()
+
+		if err != nil {
+			return fmt.Errorf("flushDAOCoinLastTradePrices: insert: %v", err)
+		}
+	}
+
+	if len(deletePrices) > 0 {
+		_, err := tx.Model(&deletePrices).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushDAOCoinLastTradePrices: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushLockedBalances(tx *pg.Tx, view *UtxoView) error {
+	var insertBalances []*PGLockedBalance
+	var deleteBalances []*PGLockedBalance
+
+	for _, entry := range view.LockedBalanceEntryKeyToLockedBalanceEntry {
+		if entry == nil {
+			continue
+		}
+
+		balance := &PGLockedBalance{}
+		balance.FromLockedBalanceEntry(entry)
+
+		// Like in badger, a locked balance that's been fully unlocked is deleted.
+		if entry.isDeleted || entry.BalanceBaseUnits.IsZero() {
+			deleteBalances = append(deleteBalances, balance)
+		} else {
+			insertBalances = append(insertBalances, balance)
+		}
+	}
+
+	if len(insertBalances) > 0 {
+		_, err := tx.Model(&insertBalances).
+			WherePK().
+			OnConflict("(hodler_pkid, profile_pkid, unlock_timestamp_nano_secs, vesting_end_timestamp_nano_secs) DO UPDATE").
+			Returning("NULL").
+			Insert()
+
+		if err != nil {
+			return fmt.Errorf("flushLockedBalances: insert: %v", err)
+		}
+	}
+
+	if len(deleteBalances) > 0 {
+		_, err := tx.Model(&deleteBalances).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushLockedBalances: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushProposals(tx *pg.Tx, view *UtxoView) error {
+	var insertProposals []*PGProposal
+	var deleteProposals []*PGProposal
+
+	for _, entry := range view.ProposalIDToProposalEntry {
+		if entry == nil {
+			continue
+		}
+
+		proposal := &PGProposal{}
+		proposal.FromProposalEntry(entry)
+
+		if entry.isDeleted {
+			deleteProposals = append(deleteProposals, proposal)
+		} else {
+			insertProposals = append(insertProposals, proposal)
+		}
+	}
+
+	if len(insertProposals) > 0 {
+		_, err := tx.Model(&insertProposals).
+			WherePK().
+			OnConflict("(proposal_id) DO UPDATE").
+			Returning("NULL").
+			Insert()
+
+		if err != nil {
+			return fmt.Errorf("flushProposals: insert: %v", err)
+		}
+	}
+
+	if len(deleteProposals) > 0 {
+		_, err := tx.Model(&deleteProposals).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushProposals: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushProposalVotes(tx *pg.Tx, view *UtxoView) error {
+	var insertVotes []*PGProposalVote
+	var deleteVotes []*PGProposalVote
+
+	for _, entry := range view.VoteMapKeyToVoteEntry {
+		if entry == nil {
+			continue
+		}
+
+		vote := &PGProposalVote{}
+		vote.FromVoteEntry(entry)
+
+		if entry.isDeleted {
+			deleteVotes = append(deleteVotes, vote)
+		} else {
+			insertVotes = append(insertVotes, vote)
+		}
+	}
+
+	if len(insertVotes) > 0 {
+		_, err := tx.Model(&insertVotes).
+			WherePK().
+			OnConflict("(proposal_id, voter_pkid) DO UPDATE").
+			Returning("NULL").
+			Insert()
+
+		if err != nil {
+			return fmt.Errorf("flushProposalVotes: insert: %v", err)
+		}
+	}
+
+	if len(deleteVotes) > 0 {
+		_, err := tx.Model(&deleteVotes).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushProposalVotes: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
 func (postgres *Postgres) flushAccessGroupEntries(tx *pg.Tx, view *UtxoView) error {
 	var insertEntries []*PGAccessGroupEntry
 	var deleteEntries []*PGAccessGroupEntry
@@ -3695,7 +4081,7 @@ func (postgres *Postgres) GetAllDAOCoinLimitOrdersForThisTransactor(transactorPK
 	return outputOrders, nil
 }
 
-func (postgres *Postgres) GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimitOrderEntry, lastSeenOrder *DAOCoinLimitOrderEntry, orderEntriesInView map[DAOCoinLimitOrderMapKey]bool) ([]*DAOCoinLimitOrderEntry, error) {
+func (postgres *Postgres) GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimitOrderEntry, lastSeenOrder *DAOCoinLimitOrderEntry, orderEntriesInView map[DAOCoinLimitOrderMapKey]bool, matchingOrderLastTradePrice *uint256.Int) ([]*DAOCoinLimitOrderEntry, error) {
 	// We do need to make sure we sort by price descending so that
 	// the transactor is reviewing the best-priced orders first.
 
@@ -3708,10 +4094,12 @@ func (postgres *Postgres) GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimit
 
 	var matchingOrders []*PGDAOCoinLimitOrder
 
-	// Switch BuyingDAOCoinCreatorPKID and SellingDAOCoinCreatorPKID.
+	// Switch BuyingDAOCoinCreatorPKID and SellingDAOCoinCreatorPKID, and their creator coin flags.
 	err := postgres.db.Model(&matchingOrders).
 		Where("buying_dao_coin_creator_pkid = ?", inputOrder.SellingDAOCoinCreatorPKID).
 		Where("selling_dao_coin_creator_pkid = ?", inputOrder.BuyingDAOCoinCreatorPKID).
+		Where("buying_coin_is_creator_coin = ?", inputOrder.SellingCoinIsCreatorCoin).
+		Where("selling_coin_is_creator_coin = ?", inputOrder.BuyingCoinIsCreatorCoin).
 		Order("scaled_exchange_rate_coins_to_sell_per_coin_to_buy DESC"). // Best-priced first
 		Order("block_height ASC").                                        // Then oldest first (FIFO)
 		Order("order_id DESC").                                           // Then match BadgerDB ordering
@@ -3739,9 +4127,17 @@ func (postgres *Postgres) GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimit
 		if _, exists := orderEntriesInView[matchingOrderEntry.ToMapKey()]; exists {
 			continue
 		}
+		// Skip if order has expired.
+		if matchingOrderEntry.IsExpired(inputOrder.BlockHeight) {
+			continue
+		}
+		// Skip if order is a dormant stop-limit order.
+		if matchingOrderEntry.IsDormantStopOrder(matchingOrderLastTradePrice) {
+			continue
+		}
 		outputOrders = append(outputOrders, matchingOrderEntry)
 		totalQuantity, _, _, _, err = _calculateDAOCoinsTransferredInLimitOrderMatch(
-			matchingOrderEntry, inputOrder.OperationType, totalQuantity)
+			matchingOrderEntry, inputOrder.GetQuantityOperationType(), totalQuantity)
 		if err != nil {
 			return nil, err
 		}
@@ -3750,6 +4146,59 @@ func (postgres *Postgres) GetMatchingDAOCoinLimitOrders(inputOrder *DAOCoinLimit
 	return outputOrders, nil
 }
 
+//
+// Locked Balances
+//
+
+// GetLockedBalancesForHODLer returns the HODLer's locked balances, ordered by when they unlock.
+func (postgres *Postgres) GetLockedBalancesForHODLer(hodlerPKID *PKID) []*PGLockedBalance {
+	var balances []*PGLockedBalance
+	err := postgres.db.Model(&balances).Where("hodler_pkid = ?", hodlerPKID).
+		Order("unlock_timestamp_nano_secs ASC").Select()
+	if err != nil {
+		return nil
+	}
+	return balances
+}
+
+// GetLockedBalancesForProfile returns the locked balances of the profile's coins, ordered by
+// when they unlock.
+func (postgres *Postgres) GetLockedBalancesForProfile(profilePKID *PKID) []*PGLockedBalance {
+	var balances []*PGLockedBalance
+	err := postgres.db.Model(&balances).Where("profile_pkid = ?", profilePKID).
+		Order("unlock_timestamp_nano_secs ASC").Select()
+	if err != nil {
+		return nil
+	}
+	return balances
+}
+
+//
+// Governance
+//
+
+// GetProposalsForProfile returns the proposals for the DAO coin, newest first.
+func (postgres *Postgres) GetProposalsForProfile(profilePKID *PKID) []*PGProposal {
+	var proposals []*PGProposal
+	err := postgres.db.Model(&proposals).Where("profile_pkid = ?", profilePKID).
+		Order("snapshot_block_height DESC").Select()
+	if err != nil {
+		return nil
+	}
+	return proposals
+}
+
+// GetProposalVotes returns the votes that have been cast on the proposal.
+func (postgres *Postgres) GetProposalVotes(proposalID *BlockHash) []*PGProposalVote {
+	var votes []*PGProposalVote
+	err := postgres.db.Model(&votes).Where("proposal_id = ?", proposalID).
+		Where("option_index >= 0").Select()
+	if err != nil {
+		return nil
+	}
+	return votes
+}
+
 //
 // NFTS
 //
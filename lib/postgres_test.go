@@ -34,8 +34,8 @@ func TestParsePostgresURI(t *testing.T) {
 }
 
 func TestEmbedPg(t *testing.T) {
+	t.Skip("Skipping embedded postgres test")
 	require := require.New(t)
-	return
 
 	_, embpg, err := StartTestEmbeddedPostgresDB("", 5433)
 	require.NoError(err)
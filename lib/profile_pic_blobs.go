@@ -0,0 +1,305 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Profile pics are by far the largest field on a ProfileEntry, and storing them inline
+// inflates both the state every node keeps hot and the size of a hypersync. After the
+// ProfilePicBlobsBlockHeight, an UpdateProfile txn that sets a profile pic stores a
+// content-hash reference on the ProfileEntry instead, and the pic itself is kept as a
+// blob in a side-store keyed by its sha256 hash.
+//
+// The blob is still part of the UpdateProfile txn, so nodes that sync blocks pick it up
+// when they connect the txn, and anyone can check a blob against its reference by hashing
+// it. Blobs aren't consensus state though, so a hypersynced node won't have the blobs of
+// profiles that were updated before its snapshot. Those are fetched lazily from peers the
+// first time they're needed.
+
+const (
+	// MaxProfilePicBlobsPerMessage is the maximum number of blobs that can be requested in,
+	// or returned by, a single message.
+	MaxProfilePicBlobsPerMessage = 50
+	// ProfilePicBlobRequestTimeout is how long we wait on a blob request before we're
+	// willing to ask our peers for the same blob again.
+	ProfilePicBlobRequestTimeout = 30 * time.Second
+)
+
+// ProfilePicBlobReferencePrefix marks a ProfilePic as a reference to an offloaded blob.
+// It's followed by the 32-byte sha256 hash of the blob.
+var ProfilePicBlobReferencePrefix = []byte("deso-blob:sha256:")
+
+// GetProfilePicBlobHash returns the sha256 hash a profile pic blob is referenced by.
+func GetProfilePicBlobHash(blob []byte) *BlockHash {
+	blobHash := BlockHash(sha256.Sum256(blob))
+	return &blobHash
+}
+
+// NewProfilePicBlobReference returns the content-hash reference that's stored on a
+// ProfileEntry in place of the given profile pic.
+func NewProfilePicBlobReference(profilePic []byte) []byte {
+	return append(append([]byte{}, ProfilePicBlobReferencePrefix...), GetProfilePicBlobHash(profilePic)[:]...)
+}
+
+// GetProfilePicBlobReferenceHash returns the hash of the blob that a ProfilePic refers to,
+// or nil if the ProfilePic is stored inline.
+func GetProfilePicBlobReferenceHash(profilePic []byte) *BlockHash {
+	if len(profilePic) != len(ProfilePicBlobReferencePrefix)+HashSizeBytes ||
+		!bytes.HasPrefix(profilePic, ProfilePicBlobReferencePrefix) {
+		return nil
+	}
+	return NewBlockHash(profilePic[len(ProfilePicBlobReferencePrefix):])
+}
+
+// ShouldOffloadProfilePic returns true if storing a reference to the profile pic would
+// take up less space than storing the pic inline.
+func ShouldOffloadProfilePic(profilePic []byte) bool {
+	return len(profilePic) > len(ProfilePicBlobReferencePrefix)+HashSizeBytes
+}
+
+// ==================================================================
+// DB
+// ==================================================================
+
+func _dbKeyForProfilePicBlob(blobHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixProfilePicBlobByHash...), blobHash[:]...)
+}
+
+func DbPutProfilePicBlobWithTxn(txn *badger.Txn, blob []byte) error {
+	blobHash := GetProfilePicBlobHash(blob)
+	if err := DBSetWithTxn(txn, nil, _dbKeyForProfilePicBlob(blobHash), blob, nil); err != nil {
+		return errors.Wrapf(err, "DbPutProfilePicBlobWithTxn: Problem putting blob %v: ", blobHash)
+	}
+	return nil
+}
+
+func DbPutProfilePicBlob(handle *badger.DB, blob []byte) error {
+	return handle.Update(func(txn *badger.Txn) error {
+		return DbPutProfilePicBlobWithTxn(txn, blob)
+	})
+}
+
+func DbGetProfilePicBlobWithTxn(txn *badger.Txn, blobHash *BlockHash) []byte {
+	blob, err := DBGetWithTxn(txn, nil, _dbKeyForProfilePicBlob(blobHash))
+	if err != nil {
+		return nil
+	}
+	return blob
+}
+
+func DbGetProfilePicBlob(handle *badger.DB, blobHash *BlockHash) []byte {
+	var blob []byte
+	handle.View(func(txn *badger.Txn) error {
+		blob = DbGetProfilePicBlobWithTxn(txn, blobHash)
+		return nil
+	})
+	return blob
+}
+
+// ==================================================================
+// UtxoView
+// ==================================================================
+
+// _offloadProfilePic adds the profile pic to the view's blobs, if it's worth offloading,
+// and returns the value that should be stored on the ProfileEntry.
+func (bav *UtxoView) _offloadProfilePic(profilePic []byte) []byte {
+	if !ShouldOffloadProfilePic(profilePic) {
+		return profilePic
+	}
+	bav.ProfilePicBlobHashToBlob[*GetProfilePicBlobHash(profilePic)] = profilePic
+	return NewProfilePicBlobReference(profilePic)
+}
+
+// GetProfilePicBlob returns the blob with the given hash, or nil if this node doesn't
+// have it.
+func (bav *UtxoView) GetProfilePicBlob(blobHash *BlockHash) []byte {
+	if blob, exists := bav.ProfilePicBlobHashToBlob[*blobHash]; exists {
+		return blob
+	}
+	if bav.Handle == nil && bav.StorageBackend == nil {
+		return nil
+	}
+	return bav.GetDbAdapter().GetProfilePicBlob(blobHash)
+}
+
+// GetProfilePicForProfileEntry returns the profile pic of a ProfileEntry, resolving a
+// content-hash reference to its blob. The second return value is false if the profile
+// pic is a reference to a blob this node doesn't have yet.
+func (bav *UtxoView) GetProfilePicForProfileEntry(profileEntry *ProfileEntry) ([]byte, bool) {
+	if profileEntry == nil {
+		return nil, true
+	}
+	blobHash := GetProfilePicBlobReferenceHash(profileEntry.ProfilePic)
+	if blobHash == nil {
+		return profileEntry.ProfilePic, true
+	}
+	blob := bav.GetProfilePicBlob(blobHash)
+	return blob, blob != nil
+}
+
+// _flushProfilePicBlobsToDbWithTxn writes the view's blobs to the side-store. Blobs are
+// content-addressed and never deleted, so disconnecting an UpdateProfile txn just leaves
+// its blob behind.
+func (bav *UtxoView) _flushProfilePicBlobsToDbWithTxn(txn *badger.Txn) error {
+	for blobHash, blob := range bav.ProfilePicBlobHashToBlob {
+		if !GetProfilePicBlobHash(blob).IsEqual(&blobHash) {
+			return fmt.Errorf("_flushProfilePicBlobsToDbWithTxn: Blob hash %v doesn't match map key %v",
+				GetProfilePicBlobHash(blob), &blobHash)
+		}
+		if err := DbPutProfilePicBlobWithTxn(txn, blob); err != nil {
+			return errors.Wrapf(err, "_flushProfilePicBlobsToDbWithTxn: ")
+		}
+	}
+	return nil
+}
+
+// ==================================================================
+// GET_PROFILE_PIC_BLOBS and PROFILE_PIC_BLOBS Messages
+// ==================================================================
+
+type MsgDeSoGetProfilePicBlobs struct {
+	BlobHashes []*BlockHash
+}
+
+func (msg *MsgDeSoGetProfilePicBlobs) ToBytes(preSignature bool) ([]byte, error) {
+	if len(msg.BlobHashes) > MaxProfilePicBlobsPerMessage {
+		return nil, fmt.Errorf("MsgDeSoGetProfilePicBlobs.ToBytes: Number of hashes %d exceeds max allowed %d",
+			len(msg.BlobHashes), MaxProfilePicBlobsPerMessage)
+	}
+	retBytes := UintToBuf(uint64(len(msg.BlobHashes)))
+	for _, blobHash := range msg.BlobHashes {
+		retBytes = append(retBytes, blobHash[:]...)
+	}
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoGetProfilePicBlobs) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoGetProfilePicBlobs{}
+
+	numHashes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetProfilePicBlobs.FromBytes: Problem reading number of hashes: ")
+	}
+	if numHashes > MaxProfilePicBlobsPerMessage {
+		return fmt.Errorf("MsgDeSoGetProfilePicBlobs.FromBytes: Number of hashes %d exceeds max allowed %d",
+			numHashes, MaxProfilePicBlobsPerMessage)
+	}
+	for ii := uint64(0); ii < numHashes; ii++ {
+		blobHash := &BlockHash{}
+		if _, err = io.ReadFull(rr, blobHash[:]); err != nil {
+			return errors.Wrapf(err, "MsgDeSoGetProfilePicBlobs.FromBytes: Problem reading hash: ")
+		}
+		retMsg.BlobHashes = append(retMsg.BlobHashes, blobHash)
+	}
+
+	*msg = retMsg
+	return nil
+}
+
+func (msg *MsgDeSoGetProfilePicBlobs) GetMsgType() MsgType {
+	return MsgTypeGetProfilePicBlobs
+}
+
+type MsgDeSoProfilePicBlobs struct {
+	Blobs [][]byte
+}
+
+func (msg *MsgDeSoProfilePicBlobs) ToBytes(preSignature bool) ([]byte, error) {
+	if len(msg.Blobs) > MaxProfilePicBlobsPerMessage {
+		return nil, fmt.Errorf("MsgDeSoProfilePicBlobs.ToBytes: Number of blobs %d exceeds max allowed %d",
+			len(msg.Blobs), MaxProfilePicBlobsPerMessage)
+	}
+	retBytes := UintToBuf(uint64(len(msg.Blobs)))
+	for _, blob := range msg.Blobs {
+		retBytes = append(retBytes, EncodeByteArray(blob)...)
+	}
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoProfilePicBlobs) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := MsgDeSoProfilePicBlobs{}
+
+	numBlobs, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoProfilePicBlobs.FromBytes: Problem reading number of blobs: ")
+	}
+	if numBlobs > MaxProfilePicBlobsPerMessage {
+		return fmt.Errorf("MsgDeSoProfilePicBlobs.FromBytes: Number of blobs %d exceeds max allowed %d",
+			numBlobs, MaxProfilePicBlobsPerMessage)
+	}
+	for ii := uint64(0); ii < numBlobs; ii++ {
+		blob, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoProfilePicBlobs.FromBytes: Problem reading blob: ")
+		}
+		retMsg.Blobs = append(retMsg.Blobs, blob)
+	}
+
+	*msg = retMsg
+	return nil
+}
+
+func (msg *MsgDeSoProfilePicBlobs) GetMsgType() MsgType {
+	return MsgTypeProfilePicBlobs
+}
+
+// ==================================================================
+// Server
+// ==================================================================
+
+// ProfilePicBlobFetcher tracks the blobs we've asked our peers for. Peers can only send
+// us blobs we've asked for, which keeps them from filling the side-store with junk.
+type ProfilePicBlobFetcher struct {
+	sync.Mutex
+
+	// requestedBlobHashes maps the hash of each blob we're waiting on to the time we
+	// asked for it.
+	requestedBlobHashes map[BlockHash]time.Time
+}
+
+func NewProfilePicBlobFetcher() *ProfilePicBlobFetcher {
+	return &ProfilePicBlobFetcher{
+		requestedBlobHashes: make(map[BlockHash]time.Time),
+	}
+}
+
+// startRequests marks the given blobs as requested and returns the ones that weren't
+// already requested within the ProfilePicBlobRequestTimeout.
+func (fetcher *ProfilePicBlobFetcher) startRequests(blobHashes []*BlockHash, now time.Time) []*BlockHash {
+	fetcher.Lock()
+	defer fetcher.Unlock()
+
+	var blobHashesToRequest []*BlockHash
+	for _, blobHash := range blobHashes {
+		if requestedAt, exists := fetcher.requestedBlobHashes[*blobHash]; exists &&
+			now.Sub(requestedAt) < ProfilePicBlobRequestTimeout {
+			continue
+		}
+		fetcher.requestedBlobHashes[*blobHash] = now
+		blobHashesToRequest = append(blobHashesToRequest, blobHash)
+	}
+	return blobHashesToRequest
+}
+
+// finishRequest returns true if we asked for the blob with the given hash, and stops
+// waiting on it.
+func (fetcher *ProfilePicBlobFetcher) finishRequest(blobHash *BlockHash) bool {
+	fetcher.Lock()
+	defer fetcher.Unlock()
+
+	if _, exists := fetcher.requestedBlobHashes[*blobHash]; !exists {
+		return false
+	}
+	delete(fetcher.requestedBlobHashes, *blobHash)
+	return true
+}
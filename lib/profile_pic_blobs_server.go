@@ -0,0 +1,83 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// GetProfilePic returns the profile pic of a ProfileEntry, resolving a content-hash
+// reference to its blob. If this node doesn't have the blob yet, it asks its peers for
+// it and returns false. The blob will be available once a peer responds.
+func (srv *Server) GetProfilePic(utxoView *UtxoView, profileEntry *ProfileEntry) ([]byte, bool) {
+	profilePic, isAvailable := utxoView.GetProfilePicForProfileEntry(profileEntry)
+	if !isAvailable {
+		srv.RequestProfilePicBlobs([]*BlockHash{GetProfilePicBlobReferenceHash(profileEntry.ProfilePic)})
+	}
+	return profilePic, isAvailable
+}
+
+// RequestProfilePicBlobs asks our peers for the blobs with the given hashes.
+func (srv *Server) RequestProfilePicBlobs(blobHashes []*BlockHash) {
+	if srv.profilePicBlobFetcher == nil {
+		return
+	}
+	blobHashesToRequest := srv.profilePicBlobFetcher.startRequests(blobHashes, time.Now())
+	for len(blobHashesToRequest) > 0 {
+		numHashes := MinInt(len(blobHashesToRequest), MaxProfilePicBlobsPerMessage)
+		msg := &MsgDeSoGetProfilePicBlobs{BlobHashes: blobHashesToRequest[:numHashes]}
+		blobHashesToRequest = blobHashesToRequest[numHashes:]
+
+		// Whichever peer responds first wins. The rest of the responses are dropped since
+		// we're no longer waiting on the blobs.
+		for _, rn := range srv.networkManager.GetAllRemoteNodes().GetAll() {
+			if !rn.IsHandshakeCompleted() || !rn.GetServiceFlag().HasService(SFProfilePicBlobs) {
+				continue
+			}
+			if err := rn.SendMessage(msg); err != nil {
+				glog.Errorf("Server.RequestProfilePicBlobs: Problem sending request to RemoteNode (id= %v): %v",
+					rn.GetId(), err)
+			}
+		}
+	}
+}
+
+func (srv *Server) _handleGetProfilePicBlobs(pp *Peer, msg *MsgDeSoGetProfilePicBlobs) {
+	if msg.GetMsgType() != MsgTypeGetProfilePicBlobs {
+		return
+	}
+
+	// Only send back the blobs we have. The peer will ask someone else for the rest.
+	res := &MsgDeSoProfilePicBlobs{}
+	for _, blobHash := range msg.BlobHashes {
+		if blob := DbGetProfilePicBlob(srv.blockchain.db, blobHash); blob != nil {
+			res.Blobs = append(res.Blobs, blob)
+		}
+	}
+	rn := srv.networkManager.GetRemoteNodeById(NewRemoteNodeId(pp.ID))
+	if err := srv.networkManager.SendMessage(rn, res); err != nil {
+		glog.Errorf("Server._handleGetProfilePicBlobs: Problem sending blobs to peer %v: %v", pp, err)
+	}
+}
+
+func (srv *Server) _handleProfilePicBlobs(pp *Peer, msg *MsgDeSoProfilePicBlobs) {
+	if msg.GetMsgType() != MsgTypeProfilePicBlobs || srv.profilePicBlobFetcher == nil {
+		return
+	}
+
+	for _, blob := range msg.Blobs {
+		// A blob is identified by its hash, so hashing it is all that's needed to verify it.
+		blobHash := GetProfilePicBlobHash(blob)
+		if uint64(len(blob)) > srv.params.MaxProfilePicLengthBytes ||
+			!srv.profilePicBlobFetcher.finishRequest(blobHash) {
+			glog.V(1).Infof("Server._handleProfilePicBlobs: Ignoring unrequested blob %v from peer %v",
+				blobHash, pp)
+			continue
+		}
+		if err := DbPutProfilePicBlob(srv.blockchain.db, blob); err != nil {
+			glog.Errorf("Server._handleProfilePicBlobs: Problem storing blob %v: %v", blobHash, err)
+		}
+	}
+}
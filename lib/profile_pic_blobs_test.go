@@ -0,0 +1,232 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/deso-protocol/core/collections"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilePicBlobReferences(t *testing.T) {
+	require := require.New(t)
+
+	profilePic := bytes.Repeat([]byte{1}, 1000)
+	reference := NewProfilePicBlobReference(profilePic)
+	require.True(bytes.HasPrefix(reference, []byte("deso-blob:sha256:")))
+	require.Equal(GetProfilePicBlobHash(profilePic), GetProfilePicBlobReferenceHash(reference))
+	require.True(ShouldOffloadProfilePic(profilePic))
+
+	// Pics that aren't longer than a reference are kept inline, and only a prefixed hash
+	// is a reference.
+	require.False(ShouldOffloadProfilePic(reference))
+	require.Nil(GetProfilePicBlobReferenceHash(profilePic))
+	require.Nil(GetProfilePicBlobReferenceHash(reference[:len(reference)-1]))
+	notReference := append([]byte{}, reference...)
+	notReference[0]++
+	require.Nil(GetProfilePicBlobReferenceHash(notReference))
+}
+
+func TestUpdateProfileOffloadsProfilePic(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 0
+	params.ForkHeights.ProfilePicBlobsBlockHeight = 11
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	// The db has no best chain, so give the view a tip that CopyUtxoView can copy.
+	utxoView.TipHash = &BlockHash{}
+	_, err := utxoView._addBalance(1000, m0PkBytes)
+	require.NoError(err)
+
+	nextPartialID := uint64(0)
+	makeTxn := func(profilePic []byte) *MsgDeSoTxn {
+		nextPartialID++
+		return &MsgDeSoTxn{
+			TxnVersion: DeSoTxnVersion1,
+			TxnMeta: &UpdateProfileMetadata{
+				NewUsername:                 []byte("m0"),
+				NewProfilePic:               profilePic,
+				NewCreatorBasisPoints:       10 * 100,
+				NewStakeMultipleBasisPoints: 125 * 100,
+			},
+			PublicKey:   m0PkBytes,
+			TxnFeeNanos: 10,
+			TxnNonce:    &DeSoNonce{ExpirationBlockHeight: 100, PartialID: nextPartialID},
+		}
+	}
+	connect := func(view *UtxoView, txn *MsgDeSoTxn, blockHeight uint32) ([]*UtxoOperation, error) {
+		_, _, utxoOps, err := view._connectUpdateProfile(txn, txn.Hash(), blockHeight, false, false)
+		return utxoOps, err
+	}
+	requireProfilePic := func(view *UtxoView, storedProfilePic []byte, profilePic []byte) {
+		profileEntry := view.GetProfileEntryForPublicKey(m0PkBytes)
+		require.NotNil(profileEntry)
+		require.Equal(storedProfilePic, profileEntry.ProfilePic)
+		resolvedProfilePic, isAvailable := view.GetProfilePicForProfileEntry(profileEntry)
+		require.True(isAvailable)
+		require.Equal(profilePic, resolvedProfilePic)
+	}
+
+	// Before the fork, profile pics are stored inline.
+	inlineProfilePic := bytes.Repeat([]byte{1}, 1000)
+	_, err = connect(utxoView, makeTxn(inlineProfilePic), 10)
+	require.NoError(err)
+	requireProfilePic(utxoView, inlineProfilePic, inlineProfilePic)
+	require.Empty(utxoView.ProfilePicBlobHashToBlob)
+
+	// After the fork, a large profile pic is stored as a reference to its blob.
+	offloadedProfilePic := bytes.Repeat([]byte{2}, 1000)
+	blobHash := GetProfilePicBlobHash(offloadedProfilePic)
+	offloadTxn := makeTxn(offloadedProfilePic)
+	offloadUtxoOps, err := connect(utxoView, offloadTxn, 11)
+	require.NoError(err)
+	requireProfilePic(utxoView, NewProfilePicBlobReference(offloadedProfilePic), offloadedProfilePic)
+	require.Equal(offloadedProfilePic, utxoView.GetProfilePicBlob(blobHash))
+
+	// A small profile pic is still stored inline, and a txn can't set a reference itself.
+	// A failed connect leaves the view dirty, so these are tried on copies.
+	smallProfilePic := []byte{3}
+	smallView := utxoView.CopyUtxoView()
+	_, err = connect(smallView, makeTxn(smallProfilePic), 11)
+	require.NoError(err)
+	requireProfilePic(smallView, smallProfilePic, smallProfilePic)
+	_, err = connect(utxoView.CopyUtxoView(), makeTxn(NewProfilePicBlobReference(inlineProfilePic)), 11)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorProfilePicBlobReferenceNotAllowed)
+
+	// Disconnecting the txn restores the inline pic. The blob is left behind, since blobs are
+	// content-addressed and never deleted.
+	require.NoError(utxoView._disconnectUpdateProfile(
+		OperationTypeUpdateProfile, offloadTxn, offloadTxn.Hash(), offloadUtxoOps, 11))
+	requireProfilePic(utxoView, inlineProfilePic, inlineProfilePic)
+	require.Equal(offloadedProfilePic, utxoView.GetProfilePicBlob(blobHash))
+
+	// Once the view is flushed, the blob is read from the side-store.
+	_, err = connect(utxoView, makeTxn(offloadedProfilePic), 11)
+	require.NoError(err)
+	require.NoError(utxoView.FlushToDb(11))
+	require.Equal(offloadedProfilePic, DbGetProfilePicBlob(db, blobHash))
+	requireProfilePic(NewUtxoView(db, &params, nil, nil, nil),
+		NewProfilePicBlobReference(offloadedProfilePic), offloadedProfilePic)
+}
+
+func TestProfilePicBlobsMessages(t *testing.T) {
+	require := require.New(t)
+
+	getMsg := &MsgDeSoGetProfilePicBlobs{BlobHashes: []*BlockHash{{1}, {2}}}
+	getMsgBytes, err := getMsg.ToBytes(false)
+	require.NoError(err)
+	decodedGetMsg := &MsgDeSoGetProfilePicBlobs{}
+	require.NoError(decodedGetMsg.FromBytes(getMsgBytes))
+	require.Equal(getMsg, decodedGetMsg)
+
+	msg := &MsgDeSoProfilePicBlobs{Blobs: [][]byte{{1, 2, 3}, bytes.Repeat([]byte{4}, 1000)}}
+	msgBytes, err := msg.ToBytes(false)
+	require.NoError(err)
+	decodedMsg := &MsgDeSoProfilePicBlobs{}
+	require.NoError(decodedMsg.FromBytes(msgBytes))
+	require.Equal(msg, decodedMsg)
+
+	// Neither message can hold more than MaxProfilePicBlobsPerMessage entries.
+	tooManyBlobHashes := make([]*BlockHash, MaxProfilePicBlobsPerMessage+1)
+	for ii := range tooManyBlobHashes {
+		tooManyBlobHashes[ii] = &BlockHash{}
+	}
+	_, err = (&MsgDeSoGetProfilePicBlobs{BlobHashes: tooManyBlobHashes}).ToBytes(false)
+	require.Error(err)
+	require.Error((&MsgDeSoGetProfilePicBlobs{}).FromBytes(UintToBuf(MaxProfilePicBlobsPerMessage + 1)))
+	_, err = (&MsgDeSoProfilePicBlobs{Blobs: make([][]byte, MaxProfilePicBlobsPerMessage+1)}).ToBytes(false)
+	require.Error(err)
+	require.Error((&MsgDeSoProfilePicBlobs{}).FromBytes(UintToBuf(MaxProfilePicBlobsPerMessage + 1)))
+}
+
+// _newProfilePicBlobsTestServer returns a server whose handshakes with the given peers are
+// complete. Peers with an odd ID serve blobs, and peers with an even ID don't.
+func _newProfilePicBlobsTestServer(params *DeSoParams, db *badger.DB, peers ...*Peer) *Server {
+	connectedPeers := make(map[uint64]*Peer)
+	for _, peer := range peers {
+		connectedPeers[peer.ID] = peer
+	}
+	srv := &Server{
+		params:                params,
+		cmgr:                  &ConnectionManager{connectedPeers: connectedPeers},
+		blockchain:            &Blockchain{db: db},
+		networkManager:        &NetworkManager{AllRemoteNodes: collections.NewConcurrentMap[RemoteNodeId, *RemoteNode]()},
+		profilePicBlobFetcher: NewProfilePicBlobFetcher(),
+	}
+	for _, peer := range peers {
+		rn := NewRemoteNode(NewRemoteNodeId(peer.ID), nil, false, false, srv, srv.cmgr, nil, params, 0, 0, 0)
+		rn.setStatusHandshakeCompleted()
+		if peer.ID%2 == 1 {
+			rn.handshakeMetadata.serviceFlag = SFProfilePicBlobs
+		}
+		srv.networkManager.setRemoteNode(rn)
+	}
+	return srv
+}
+
+func TestFetchAndServeProfilePicBlobs(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	peer1 := &Peer{ID: 1}
+	peer2 := &Peer{ID: 2}
+	srv := _newProfilePicBlobsTestServer(&params, db, peer1, peer2)
+
+	profilePic := bytes.Repeat([]byte{1}, 1000)
+	blobHash := GetProfilePicBlobHash(profilePic)
+	profileEntry := &ProfileEntry{PublicKey: m0PkBytes, ProfilePic: NewProfilePicBlobReference(profilePic)}
+
+	// We don't have the blob yet, so it's requested from the peers that serve blobs.
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	_, isAvailable := srv.GetProfilePic(utxoView, profileEntry)
+	require.False(isAvailable)
+	requestMsg := peer1.MaybeDequeueDeSoMessage()
+	require.NotNil(requestMsg)
+	require.Equal(&MsgDeSoGetProfilePicBlobs{BlobHashes: []*BlockHash{blobHash}}, requestMsg.DeSoMessage)
+	require.Nil(peer1.MaybeDequeueDeSoMessage())
+	require.Nil(peer2.MaybeDequeueDeSoMessage())
+
+	// The blob isn't requested again while we're waiting on it.
+	_, isAvailable = srv.GetProfilePic(utxoView, profileEntry)
+	require.False(isAvailable)
+	require.Nil(peer1.MaybeDequeueDeSoMessage())
+
+	// A blob that doesn't hash to a requested hash is dropped, even if it's only slightly
+	// different from a requested one.
+	tamperedProfilePic := append([]byte{}, profilePic...)
+	tamperedProfilePic[0]++
+	srv._handleProfilePicBlobs(peer1, &MsgDeSoProfilePicBlobs{Blobs: [][]byte{tamperedProfilePic}})
+	require.Nil(DbGetProfilePicBlob(db, GetProfilePicBlobHash(tamperedProfilePic)))
+	require.Nil(DbGetProfilePicBlob(db, blobHash))
+
+	// The requested blob is stored, and the profile pic can be resolved.
+	srv._handleProfilePicBlobs(peer1, &MsgDeSoProfilePicBlobs{Blobs: [][]byte{profilePic}})
+	require.Equal(profilePic, DbGetProfilePicBlob(db, blobHash))
+	resolvedProfilePic, isAvailable := srv.GetProfilePic(utxoView, profileEntry)
+	require.True(isAvailable)
+	require.Equal(profilePic, resolvedProfilePic)
+	require.Nil(peer1.MaybeDequeueDeSoMessage())
+
+	// Blobs we never asked for are dropped as well.
+	otherProfilePic := bytes.Repeat([]byte{2}, 1000)
+	srv._handleProfilePicBlobs(peer1, &MsgDeSoProfilePicBlobs{Blobs: [][]byte{otherProfilePic}})
+	require.Nil(DbGetProfilePicBlob(db, GetProfilePicBlobHash(otherProfilePic)))
+
+	// When a peer asks for blobs, only the ones we have are sent back.
+	srv._handleGetProfilePicBlobs(peer2, &MsgDeSoGetProfilePicBlobs{
+		BlobHashes: []*BlockHash{GetProfilePicBlobHash(otherProfilePic), blobHash},
+	})
+	responseMsg := peer2.MaybeDequeueDeSoMessage()
+	require.NotNil(responseMsg)
+	require.Equal(&MsgDeSoProfilePicBlobs{Blobs: [][]byte{profilePic}}, responseMsg.DeSoMessage)
+}
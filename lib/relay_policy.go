@@ -0,0 +1,206 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// relay_policy.go implements an operator-level policy that lets a node refuse to relay
+// transactions that touch a configured list of public keys, and to leave them out of the
+// blocks it produces. Regulated operators can use it to comply with sanctions lists
+// without maintaining a private fork.
+//
+// The policy is NOT a consensus rule. It's only consulted when a txn is submitted to this
+// node or relayed to it by a peer, and when this node builds a block. Blocks produced by
+// other nodes are validated and connected the same way whether or not they contain denied
+// txns, so two nodes with different policies always agree on the state of the chain.
+
+// RelayPolicyStats are the counters a RelayPolicy exposes so that operators can see
+// exactly what their policy is doing.
+type RelayPolicyStats struct {
+	NumDeniedPublicKeys uint64
+	// The number of txns that were refused relay and mempool admission.
+	NumTxnsRefusedRelay uint64
+	// The number of times a mempool txn was left out of a block this node produced.
+	NumTxnsExcludedFromBlocks uint64
+}
+
+type RelayPolicy struct {
+	mtx              sync.RWMutex
+	deniedPublicKeys map[PkMapKey]bool
+
+	numTxnsRefusedRelay       uint64
+	numTxnsExcludedFromBlocks uint64
+}
+
+// NewRelayPolicy returns an empty RelayPolicy, which allows every txn.
+func NewRelayPolicy() *RelayPolicy {
+	return &RelayPolicy{
+		deniedPublicKeys: make(map[PkMapKey]bool),
+	}
+}
+
+// SetDeniedPublicKeys replaces the policy's list of denied public keys. Keys can be
+// Base58Check-encoded for any network or hex-encoded. The list can be replaced while the
+// node is running, and applies to txns processed from then on.
+func (rp *RelayPolicy) SetDeniedPublicKeys(publicKeyStrings []string) error {
+	deniedPublicKeys := make(map[PkMapKey]bool, len(publicKeyStrings))
+	for _, publicKeyString := range publicKeyStrings {
+		publicKeyBytes, err := _decodeRelayPolicyPublicKey(publicKeyString)
+		if err != nil {
+			return errors.Wrapf(err, "RelayPolicy.SetDeniedPublicKeys: ")
+		}
+		deniedPublicKeys[MakePkMapKey(publicKeyBytes)] = true
+	}
+
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+	rp.deniedPublicKeys = deniedPublicKeys
+	glog.Infof("RelayPolicy.SetDeniedPublicKeys: Refusing to relay txns touching %d public keys",
+		len(deniedPublicKeys))
+	return nil
+}
+
+func _decodeRelayPolicyPublicKey(publicKeyString string) ([]byte, error) {
+	publicKeyBytes, _, err := Base58CheckDecode(publicKeyString)
+	if err != nil {
+		publicKeyBytes, err = hex.DecodeString(publicKeyString)
+		if err != nil {
+			return nil, fmt.Errorf("Public key %v is neither Base58Check nor hex", publicKeyString)
+		}
+	}
+	if len(publicKeyBytes) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("Public key %v has length %d, should be %d",
+			publicKeyString, len(publicKeyBytes), btcec.PubKeyBytesLenCompressed)
+	}
+	return publicKeyBytes, nil
+}
+
+// LoadRelayPolicyPublicKeysFile reads a list of public keys from a file with one key per
+// line. Blank lines and lines starting with '#' are ignored.
+func LoadRelayPolicyPublicKeysFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadRelayPolicyPublicKeysFile: Problem opening %v: ", filePath)
+	}
+	defer file.Close()
+
+	var publicKeyStrings []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		publicKeyStrings = append(publicKeyStrings, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "LoadRelayPolicyPublicKeysFile: Problem reading %v: ", filePath)
+	}
+	return publicKeyStrings, nil
+}
+
+// GetPublicKeysTouchedByTxn returns the public keys a txn touches: its transactor, its
+// outputs, and the public keys referenced by its metadata. The txns wrapped by an atomic
+// txn are included.
+func GetPublicKeysTouchedByTxn(txn *MsgDeSoTxn, params *DeSoParams) [][]byte {
+	publicKeys := _getPublicKeysToIndexForTxn(txn, params)
+
+	switch txMeta := txn.TxnMeta.(type) {
+	case *UpdateProfileMetadata:
+		publicKeys = append(publicKeys, txMeta.ProfilePublicKey)
+	case *CreatorCoinTransferMetadataa:
+		publicKeys = append(publicKeys, txMeta.ProfilePublicKey, txMeta.ReceiverPublicKey)
+	case *NFTTransferMetadata:
+		publicKeys = append(publicKeys, txMeta.ReceiverPublicKey)
+	case *DAOCoinMetadata:
+		publicKeys = append(publicKeys, txMeta.ProfilePublicKey)
+	case *DAOCoinTransferMetadata:
+		publicKeys = append(publicKeys, txMeta.ProfilePublicKey, txMeta.ReceiverPublicKey)
+	case *DAOCoinLimitOrderMetadata:
+		if txMeta.BuyingDAOCoinCreatorPublicKey != nil {
+			publicKeys = append(publicKeys, txMeta.BuyingDAOCoinCreatorPublicKey.ToBytes())
+		}
+		if txMeta.SellingDAOCoinCreatorPublicKey != nil {
+			publicKeys = append(publicKeys, txMeta.SellingDAOCoinCreatorPublicKey.ToBytes())
+		}
+	case *AtomicTxnsWrapperMetadata:
+		for _, innerTxn := range txMeta.Txns {
+			publicKeys = append(publicKeys, GetPublicKeysTouchedByTxn(innerTxn, params)...)
+		}
+	}
+	return publicKeys
+}
+
+// GetDeniedPublicKeyForTxn returns a denied public key the txn touches, or nil if it
+// doesn't touch any.
+func (rp *RelayPolicy) GetDeniedPublicKeyForTxn(txn *MsgDeSoTxn, params *DeSoParams) []byte {
+	rp.mtx.RLock()
+	defer rp.mtx.RUnlock()
+
+	if len(rp.deniedPublicKeys) == 0 {
+		return nil
+	}
+	for _, publicKey := range GetPublicKeysTouchedByTxn(txn, params) {
+		if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+			continue
+		}
+		if rp.deniedPublicKeys[MakePkMapKey(publicKey)] {
+			return publicKey
+		}
+	}
+	return nil
+}
+
+// CheckTransactionForRelay returns TxErrorRelayPolicyDeniedPublicKey if the txn touches
+// a denied public key. Such txns are neither added to the mempool nor relayed to peers.
+func (rp *RelayPolicy) CheckTransactionForRelay(txn *MsgDeSoTxn, params *DeSoParams) error {
+	deniedPublicKey := rp.GetDeniedPublicKeyForTxn(txn, params)
+	if deniedPublicKey == nil {
+		return nil
+	}
+	atomic.AddUint64(&rp.numTxnsRefusedRelay, 1)
+	return errors.Wrapf(TxErrorRelayPolicyDeniedPublicKey,
+		"CheckTransactionForRelay: Txn %v touches public key %v, which this node's operator policy "+
+			"refuses to relay", txn.Hash(), PkToStringBoth(deniedPublicKey))
+}
+
+// ShouldExcludeTransactionFromBlock returns true if the txn touches a denied public key
+// and should be left out of a block this node produces. The list of denied public keys
+// can change while txns sit in the mempool, so block producers check it again.
+func (rp *RelayPolicy) ShouldExcludeTransactionFromBlock(txn *MsgDeSoTxn, params *DeSoParams) bool {
+	// A nil policy allows every txn, which keeps block producers that were constructed
+	// without one working.
+	if rp == nil {
+		return false
+	}
+	deniedPublicKey := rp.GetDeniedPublicKeyForTxn(txn, params)
+	if deniedPublicKey == nil {
+		return false
+	}
+	atomic.AddUint64(&rp.numTxnsExcludedFromBlocks, 1)
+	glog.V(1).Infof("RelayPolicy.ShouldExcludeTransactionFromBlock: Excluding txn %v touching public key %v",
+		txn.Hash(), PkToStringBoth(deniedPublicKey))
+	return true
+}
+
+func (rp *RelayPolicy) GetStats() *RelayPolicyStats {
+	rp.mtx.RLock()
+	numDeniedPublicKeys := uint64(len(rp.deniedPublicKeys))
+	rp.mtx.RUnlock()
+
+	return &RelayPolicyStats{
+		NumDeniedPublicKeys:       numDeniedPublicKeys,
+		NumTxnsRefusedRelay:       atomic.LoadUint64(&rp.numTxnsRefusedRelay),
+		NumTxnsExcludedFromBlocks: atomic.LoadUint64(&rp.numTxnsExcludedFromBlocks),
+	}
+}
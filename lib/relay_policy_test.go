@@ -0,0 +1,68 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayPolicy(t *testing.T) {
+	require := require.New(t)
+	params := &DeSoTestnetParams
+
+	basicTransfer := &MsgDeSoTxn{
+		PublicKey: m0PkBytes,
+		TxOutputs: []*DeSoOutput{{PublicKey: m1PkBytes, AmountNanos: 1}},
+		TxnMeta:   &BasicTransferMetadata{},
+	}
+	daoCoinTransfer := &MsgDeSoTxn{
+		PublicKey: m0PkBytes,
+		TxnMeta: &DAOCoinTransferMetadata{
+			ProfilePublicKey:  m0PkBytes,
+			ReceiverPublicKey: m2PkBytes,
+		},
+	}
+
+	// An empty policy allows everything, and so does a nil one.
+	relayPolicy := NewRelayPolicy()
+	require.NoError(relayPolicy.CheckTransactionForRelay(basicTransfer, params))
+	var nilRelayPolicy *RelayPolicy
+	require.False(nilRelayPolicy.ShouldExcludeTransactionFromBlock(basicTransfer, params))
+
+	// Keys can be given in Base58Check or hex, and invalid keys are rejected.
+	require.NoError(relayPolicy.SetDeniedPublicKeys([]string{m1Pub, hex.EncodeToString(m2PkBytes)}))
+	require.Error(relayPolicy.SetDeniedPublicKeys([]string{"not a public key"}))
+	require.Equal(uint64(2), relayPolicy.GetStats().NumDeniedPublicKeys)
+
+	// Outputs and public keys in the metadata are both checked.
+	err := relayPolicy.CheckTransactionForRelay(basicTransfer, params)
+	require.Error(err)
+	require.Contains(err.Error(), string(TxErrorRelayPolicyDeniedPublicKey))
+	require.Error(relayPolicy.CheckTransactionForRelay(daoCoinTransfer, params))
+	require.True(relayPolicy.ShouldExcludeTransactionFromBlock(daoCoinTransfer, params))
+	require.Equal(uint64(2), relayPolicy.GetStats().NumTxnsRefusedRelay)
+	require.Equal(uint64(1), relayPolicy.GetStats().NumTxnsExcludedFromBlocks)
+
+	// Txns that don't touch a denied key are allowed.
+	allowedTransfer := &MsgDeSoTxn{
+		PublicKey: m0PkBytes,
+		TxOutputs: []*DeSoOutput{{PublicKey: m3PkBytes, AmountNanos: 1}},
+		TxnMeta:   &BasicTransferMetadata{},
+	}
+	require.NoError(relayPolicy.CheckTransactionForRelay(allowedTransfer, params))
+
+	// Keys can be loaded from a file with comments.
+	filePath := filepath.Join(t.TempDir(), "denied_public_keys.txt")
+	require.NoError(os.WriteFile(filePath, []byte("# sanctioned\n"+m3Pub+"\n\n"), 0644))
+	publicKeyStrings, err := LoadRelayPolicyPublicKeysFile(filePath)
+	require.NoError(err)
+	require.Equal([]string{m3Pub}, publicKeyStrings)
+	require.NoError(relayPolicy.SetDeniedPublicKeys(publicKeyStrings))
+	require.NoError(relayPolicy.CheckTransactionForRelay(basicTransfer, params))
+	require.Error(relayPolicy.CheckTransactionForRelay(allowedTransfer, params))
+}
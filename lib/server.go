@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -66,6 +68,27 @@ type Server struct {
 	TxIndex       *TXIndex
 	params        *DeSoParams
 
+	// DAOCoinCandleIndex is the optional index of DAO coin trades and OHLCV candles. It's
+	// nil unless the node runs with the index enabled.
+	DAOCoinCandleIndex *DAOCoinCandleIndex
+
+	// EmissionIndex is the optional index of each block's staking rewards, founder rewards,
+	// and burns. It's nil unless the node runs with the index enabled.
+	EmissionIndex *EmissionIndex
+
+	// TxnLabelStore is the optional store of the operator's local txn labels. It's nil
+	// unless the node runs with the store enabled.
+	TxnLabelStore *TxnLabelStore
+
+	// StateAttestor signs state attestations with the operator's key. It's nil unless the
+	// node runs with a state attestation seed.
+	StateAttestor *StateAttestor
+
+	// MempoolSyncOnConnect makes the node ask the peers it connects to for the txns in
+	// their mempools that it's missing, rather than only the txns they see from then on.
+	// It also makes the node advertise SFMempoolSync and answer its peers' requests.
+	MempoolSyncOnConnect bool
+
 	networkManager *NetworkManager
 
 	fastHotStuffConsensus                    *FastHotStuffConsensus
@@ -112,10 +135,14 @@ type Server struct {
 
 	// If we're syncing state using hypersync, we'll keep track of the progress using HyperSyncProgress.
 	// It stores information about all the prefixes that we're fetching. The way that HyperSyncProgress
-	// is organized allows for multi-peer state synchronization. In such case, we would assign prefixes
-	// to different peers. Whenever we assign a prefix to a peer, we would append a SyncProgressPrefix
-	// struct to the HyperSyncProgress.PrefixProgress array.
+	// is organized allows for multi-peer state synchronization. We assign prefixes to different peers,
+	// and whenever we start on a prefix, we append a SyncPrefixProgress struct to the
+	// HyperSyncProgress.PrefixProgress array. See hypersync_server.go.
 	HyperSyncProgress SyncProgress
+	// hyperSyncMaxPeers and hyperSyncMaxRequestsPerPeer limit the peers we download the snapshot
+	// from at once, and the prefixes each of them downloads at once. See SetHyperSyncPeerLimits.
+	hyperSyncMaxPeers           int
+	hyperSyncMaxRequestsPerPeer int
 	// How long we wait on a transaction we're fetching before giving
 	// up on it. Note this doesn't apply to blocks because they have their own
 	// process for retrying that differs from transactions, which are
@@ -138,6 +165,43 @@ type Server struct {
 	addrsToBroadcastLock deadlock.RWMutex
 	addrsToBroadcast     map[string][]*SingleAddr
 
+	// pendingCompactBlocks holds the compact blocks we're waiting on the missing txns of,
+	// keyed by block hash. It's only accessed from the messageHandler thread. See
+	// compact_block_server.go.
+	pendingCompactBlocks map[BlockHash]*pendingCompactBlock
+
+	// peerRateLimits are the budgets each peer has for expensive requests, and
+	// peerRateLimitMaxViolations is the number of requests over budget, in a row, we drop
+	// before disconnecting the peer. See SetPeerRateLimits.
+	peerRateLimits             map[MsgType]PeerRateLimit
+	peerRateLimitMaxViolations uint64
+
+	// nodeAdvisoryPool holds the param updater-signed advisories we've accepted and relayed.
+	nodeAdvisoryPool *NodeAdvisoryPool
+
+	// profilePicBlobFetcher tracks the offloaded profile pics we've asked our peers for.
+	profilePicBlobFetcher *ProfilePicBlobFetcher
+
+	// orderBookDiffStream publishes incremental DAO coin order book updates to subscribers.
+	orderBookDiffStream *OrderBookDiffStream
+
+	// snapshotChunkCommitter commits to the chunks of each snapshot we serve, so that the
+	// peers syncing from us can verify the chunks as they get them. It's nil if we don't
+	// have a snapshot.
+	snapshotChunkCommitter *SnapshotChunkCommitter
+
+	// transactionEventBus emits an event for every connected, disconnected, and mempool
+	// accepted txn to the listeners registered with it.
+	transactionEventBus *TransactionEventBus
+
+	// relayPolicy is the operator's non-consensus policy for refusing to relay or include
+	// txns that touch a list of denied public keys. It allows every txn by default.
+	relayPolicy *RelayPolicy
+
+	// blockAssemblyPolicy is the operator's non-consensus policy for reserving space in the
+	// blocks this node produces for certain txn types. It has no lanes by default.
+	blockAssemblyPolicy *BlockAssemblyPolicy
+
 	AddrMgr *addrmgr.AddrManager
 
 	// When set to true, we disable the ConnectionManager
@@ -211,7 +275,9 @@ func (srv *Server) AdminOverrideViewNumber(view uint64) error {
 		srv.blockchain,
 		srv.posMempool,
 		signer,
+		srv.relayPolicy,
 	)
+	srv.fastHotStuffConsensus.blockAssemblyPolicy = srv.blockAssemblyPolicy
 	if err := srv.fastHotStuffConsensus.Start(); err != nil {
 		return fmt.Errorf("AdminOverrideViewNumber: Problem starting FastHotStuffConsensus: %v", err)
 	}
@@ -272,6 +338,114 @@ func (srv *Server) GetMempool() Mempool {
 	return srv.mempool
 }
 
+func (srv *Server) GetOrderBookDiffStream() *OrderBookDiffStream {
+	return srv.orderBookDiffStream
+}
+
+// RegisterTransactionEventListener registers a listener for an event for every txn that's
+// connected, disconnected, or accepted into the mempool, and returns an ID that can be used
+// to unregister it. See TransactionEventBus.
+func (srv *Server) RegisterTransactionEventListener(listener TransactionEventListener) uint64 {
+	return srv.transactionEventBus.RegisterTransactionEventListener(listener)
+}
+
+func (srv *Server) UnregisterTransactionEventListener(listenerID uint64) {
+	srv.transactionEventBus.UnregisterTransactionEventListener(listenerID)
+}
+
+func (srv *Server) GetRelayPolicy() *RelayPolicy {
+	return srv.relayPolicy
+}
+
+// GetMempoolMetrics returns the metrics of the PoW mempool. See MempoolMetrics.
+func (srv *Server) GetMempoolMetrics() *MempoolMetrics {
+	return srv.mempool.GetMetrics()
+}
+
+// PublishMempoolMetricsExpvar publishes the metrics of the PoW mempool through expvar. See
+// PublishMempoolMetricsExpvar.
+func (srv *Server) PublishMempoolMetricsExpvar() {
+	PublishMempoolMetricsExpvar(srv.mempool)
+}
+
+func (srv *Server) GetBlockAssemblyPolicy() *BlockAssemblyPolicy {
+	return srv.blockAssemblyPolicy
+}
+
+// SetMempoolDecisionRecorder records the decisions of the PoW mempool. The PoS mempool
+// doesn't support recording.
+func (srv *Server) SetMempoolDecisionRecorder(recorder *MempoolDecisionRecorder) {
+	srv.mempool.SetDecisionRecorder(recorder)
+}
+
+// SetMempoolReplaceByFeePolicy allows txns to replace the txns they conflict with in the PoW
+// mempool. The PoS mempool always replaces txns with the same nonce when they pay a higher fee.
+func (srv *Server) SetMempoolReplaceByFeePolicy(policy *ReplaceByFeePolicy) {
+	srv.mempool.SetReplaceByFeePolicy(policy)
+}
+
+// LoadMempoolJournal replays the txns persisted in the journal into the PoW mempool and then
+// keeps persisting the txns it accepts. See DeSoMempool.LoadJournal.
+func (srv *Server) LoadMempoolJournal(journal *MempoolJournal) error {
+	return srv.mempool.LoadJournal(journal)
+}
+
+// EnableUtxoViewChangeLog appends the mutations of every UtxoView flush committed from now on
+// to the change log. It should be called before the server starts. See utxo_view_change_log.go.
+func (srv *Server) EnableUtxoViewChangeLog(changeLog *UtxoViewChangeLog) error {
+	cursor, err := DBGetUtxoViewFlushCursor(srv.blockchain.db)
+	if err != nil {
+		return errors.Wrapf(err, "Server.EnableUtxoViewChangeLog: ")
+	}
+	lastSequenceNumber, hasBatches := changeLog.GetLastSequenceNumber()
+	if hasBatches && cursor != nil && cursor.SequenceNumber > lastSequenceNumber {
+		glog.Warningf("Server.EnableUtxoViewChangeLog: Flushes %d to %d were committed but aren't in the change log",
+			lastSequenceNumber+1, cursor.SequenceNumber)
+	}
+	srv.eventManager.EnableUtxoViewFlushMutations()
+	srv.eventManager.OnUtxoViewFlushed(nil, changeLog.HandleUtxoViewFlushed)
+	return nil
+}
+
+// EnableUtxoOpsPruning prunes the UtxoOperations of blocks more than depth blocks below the
+// tip as blocks are committed. See utxo_ops_pruner.go.
+func (srv *Server) EnableUtxoOpsPruning(depth uint64) error {
+	pruner, err := NewUtxoOpsPruner(srv.blockchain, depth)
+	if err != nil {
+		return errors.Wrapf(err, "Server.EnableUtxoOpsPruning: ")
+	}
+	if prunedThroughHeight, hasPruned := pruner.GetPrunedThroughHeight(); hasPruned {
+		glog.Infof("Server.EnableUtxoOpsPruning: UtxoOperations are pruned through height %d", prunedThroughHeight)
+	}
+	srv.blockchain.utxoOpsPruner = pruner
+	srv.eventManager.OnBlockCommitted(pruner.HandleBlockCommitted)
+	return nil
+}
+
+// ReplayMempoolDecisions replays recorded decisions against a fresh PoW mempool with the
+// same fee rates and relay policy as this node's. See ReplayMempoolDecisions.
+func (srv *Server) ReplayMempoolDecisions(decisions []*MempoolDecision) (*MempoolDecisionReplayReport, error) {
+	replayMempool := NewDeSoMempool(srv.blockchain, srv.mempool.rateLimitFeeRateNanosPerKB,
+		srv.mempool.minFeeRateNanosPerKB, "", false, "", "", true)
+	replayMempool.replaceByFeePolicy = srv.mempool.GetReplaceByFeePolicy()
+	replayMempool.transactionEventBus = srv.transactionEventBus
+	return ReplayMempoolDecisions(replayMempool, srv.relayPolicy, decisions)
+}
+
+// getOrderBookView returns the mempool's augmented view along with the height of the
+// next block, so that order books include pending orders.
+func (srv *Server) getOrderBookView() (*UtxoView, uint32, error) {
+	srv.blockchain.ChainLock.RLock()
+	blockHeight := srv.blockchain.BlockTip().Height + 1
+	srv.blockchain.ChainLock.RUnlock()
+
+	utxoView, err := srv.GetMempool().GetAugmentedUniversalView()
+	if err != nil {
+		return nil, 0, err
+	}
+	return utxoView, blockHeight, nil
+}
+
 // TODO: The hallmark of a messy non-law-of-demeter-following interface...
 func (srv *Server) GetBlockProducer() *DeSoBlockProducer {
 	return srv.blockProducer
@@ -291,6 +465,14 @@ func (srv *Server) BroadcastTransaction(txn *MsgDeSoTxn) ([]*MsgDeSoTxn, error)
 	if txnHash == nil {
 		return nil, fmt.Errorf("BroadcastTransaction: Txn hash is nil")
 	}
+	// If the txn carries an idempotency key that a txn from the same transactor in the
+	// mempool already used, the app is retrying a submission that went through. Return
+	// the original txn rather than trying to add a conflicting one.
+	if originalMempoolTx := srv.GetMempool().GetTransactionForIdempotencyKey(txn); originalMempoolTx != nil {
+		glog.V(1).Infof("BroadcastTransaction: Txn %v reuses the idempotency key of txn %v; "+
+			"returning the original txn", txnHash, originalMempoolTx.Hash)
+		return []*MsgDeSoTxn{originalMempoolTx.Tx}, nil
+	}
 	// Use the backendServer to add the transaction to the mempool and
 	// relay it to peers. When a transaction is created by the user there
 	// is no need to consider a rateLimit and also no need to verifySignatures
@@ -322,24 +504,6 @@ func (srv *Server) VerifyAndBroadcastTransaction(txn *MsgDeSoTxn) error {
 	return nil
 }
 
-type NodeSyncType string
-
-const (
-	// Note that "any" forces the node to be archival in order to remain
-	// backwards-compatible with the rest of the network. This may change
-	// in the future.
-	NodeSyncTypeAny               = "any"
-	NodeSyncTypeBlockSync         = "blocksync"
-	NodeSyncTypeHyperSyncArchival = "hypersync-archival"
-	NodeSyncTypeHyperSync         = "hypersync"
-)
-
-func IsNodeArchival(syncType NodeSyncType) bool {
-	return syncType == NodeSyncTypeAny ||
-		syncType == NodeSyncTypeHyperSyncArchival ||
-		syncType == NodeSyncTypeBlockSync
-}
-
 func NodeCanHypersyncState(syncType NodeSyncType) bool {
 	// We can hypersync state from another node in all cases except
 	// where block sync is required.
@@ -395,6 +559,7 @@ func NewServer(
 	_connectIps []string,
 	_db *badger.DB,
 	postgres *Postgres,
+	_storageBackend StorageBackend,
 	_targetOutboundPeers uint32,
 	_maxInboundPeers uint32,
 	_minerPublicKeys []string,
@@ -433,6 +598,7 @@ func NewServer(
 	_transactionValidationRefreshIntervalMillis uint64,
 	_stateSyncerMempoolTxnSyncLimit uint64,
 	_checkpointSyncingProviders []string,
+	_mempoolSyncOnConnect bool,
 ) (
 	_srv *Server,
 	_err error,
@@ -481,6 +647,7 @@ func NewServer(
 		params:                       _params,
 		connectIps:                   _connectIps,
 		datadir:                      _dataDir,
+		MempoolSyncOnConnect:         _mempoolSyncOnConnect,
 	}
 
 	if stateChangeSyncer != nil {
@@ -500,6 +667,10 @@ func NewServer(
 	_cmgr := NewConnectionManager(
 		_params, _listeners, _hyperSync, _syncType, _stallTimeoutSeconds,
 		_minFeeRateNanosPerKB, _incomingMessages, srv)
+	_cmgr.peerScores, err = NewPeerScoreManager(_db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem loading peer scores"), true
+	}
 
 	// Set up the blockchain data structure. This is responsible for accepting new
 	// blocks, keeping track of the best chain, and keeping all of that state up
@@ -519,7 +690,8 @@ func NewServer(
 
 	_chain, err := NewBlockchain(
 		_trustedBlockProducerPublicKeys, _trustedBlockProducerStartHeight, _maxSyncBlockHeight,
-		_params, timesource, _db, postgres, eventManager, _snapshot, archivalMode, _checkpointSyncingProviders)
+		_params, timesource, _db, postgres, _storageBackend, eventManager, _snapshot, archivalMode,
+		_checkpointSyncingProviders)
 	if err != nil {
 		return nil, errors.Wrapf(err, "NewServer: Problem initializing blockchain"), true
 	}
@@ -542,7 +714,10 @@ func NewServer(
 		hex.EncodeToString(_chain.blockTip().Hash[:]),
 		blockCumWorkStr)
 
-	nodeServices := SFFullNodeDeprecated
+	nodeServices := SFFullNodeDeprecated | SFNodeAdvisories | SFProfilePicBlobs | SFTxnFilter | SFCompactBlocks
+	if _mempoolSyncOnConnect {
+		nodeServices |= SFMempoolSync
+	}
 	if _hyperSync {
 		nodeServices |= SFHyperSync
 	}
@@ -617,6 +792,11 @@ func NewServer(
 		}()
 	*/
 
+	// Initialize the relay and block assembly policies before the block producers, which
+	// consult them when picking txns from the mempool.
+	srv.relayPolicy = NewRelayPolicy()
+	srv.blockAssemblyPolicy = NewBlockAssemblyPolicy()
+
 	// Initialize the BlockProducer
 	// TODO(miner): Should figure out a way to get this into main.
 	var _blockProducer *DeSoBlockProducer
@@ -630,6 +810,8 @@ func NewServer(
 		if err != nil {
 			panic(err)
 		}
+		_blockProducer.relayPolicy = srv.relayPolicy
+		_blockProducer.blockAssemblyPolicy = srv.blockAssemblyPolicy
 		glog.V(1).Infof("NewServer: Initiating block producer gofund")
 		go func() {
 			_blockProducer.Start()
@@ -659,7 +841,9 @@ func NewServer(
 			_chain,
 			_posMempool,
 			_blsKeystore.GetSigner(),
+			srv.relayPolicy,
 		)
+		srv.fastHotStuffConsensus.blockAssemblyPolicy = srv.blockAssemblyPolicy
 		// On testnet, if the node is configured to be a PoW block producer, and it is configured
 		// to be also a PoS validator, then we attach block mined listeners to the miner to kick
 		// off the PoS consensus once the miner is done.
@@ -694,6 +878,37 @@ func NewServer(
 	// Initialize the addrs to broadcast map.
 	srv.addrsToBroadcast = make(map[string][]*SingleAddr)
 
+	// Initialize the compact blocks we're waiting on the txns of.
+	srv.pendingCompactBlocks = make(map[BlockHash]*pendingCompactBlock)
+
+	// Limit how often each peer can send us expensive requests.
+	srv.peerRateLimits = DefaultPeerRateLimits()
+	srv.peerRateLimitMaxViolations = DefaultPeerRateLimitMaxViolations
+
+	// Initialize the node advisory pool.
+	srv.nodeAdvisoryPool = NewNodeAdvisoryPool()
+
+	// Initialize the profile pic blob fetcher.
+	srv.profilePicBlobFetcher = NewProfilePicBlobFetcher()
+
+	// Initialize the order book diff stream. Books are refreshed when blocks are
+	// connected or disconnected, and when limit orders are added to the mempool.
+	srv.orderBookDiffStream = NewOrderBookDiffStream(srv.getOrderBookView, DefaultOrderBookSubscriptionBufferSize)
+	eventManager.OnBlockConnected(srv.orderBookDiffStream.HandleBlockEvent)
+	eventManager.OnBlockDisconnected(srv.orderBookDiffStream.HandleBlockEvent)
+
+	if srv.snapshot != nil {
+		srv.snapshotChunkCommitter = NewSnapshotChunkCommitter(srv.snapshot)
+	}
+	srv.hyperSyncMaxPeers = DefaultHyperSyncMaxPeers
+	srv.hyperSyncMaxRequestsPerPeer = DefaultHyperSyncMaxRequestsPerPeer
+
+	// Initialize the txn event bus, which splits block and mempool events into txn events.
+	srv.transactionEventBus = NewTransactionEventBus(_chain)
+	eventManager.OnBlockConnected(srv.transactionEventBus.HandleBlockConnected)
+	eventManager.OnBlockDisconnected(srv.transactionEventBus.HandleBlockDisconnected)
+	_mempool.SetTransactionEventBus(srv.transactionEventBus)
+
 	// This will initialize the request queues.
 	srv.ResetRequestQueues()
 
@@ -721,6 +936,10 @@ func (srv *Server) _handleGetHeaders(pp *Peer, msg *MsgDeSoGetHeaders) {
 	glog.V(1).Infof("Server._handleGetHeadersMessage: called with locator: (%v), "+
 		"stopHash: (%v) from Peer %v", msg.BlockLocator, msg.StopHash, pp)
 
+	if !srv._checkPeerRateLimit(pp, MsgTypeGetHeaders, 1) {
+		return
+	}
+
 	// Find the most recent known block in the best block chain based
 	// on the block locator and fetch all of the headers after it until either
 	// MaxHeadersPerMsg have been fetched or the provided stop
@@ -751,87 +970,80 @@ func (srv *Server) _handleGetHeaders(pp *Peer, msg *MsgDeSoGetHeaders) {
 		headers, blockTip.Hash, blockTip.Height, pp)
 }
 
-// GetSnapshot is used for sending MsgDeSoGetSnapshot messages to peers. We will
-// check if the passed peer has been assigned to an in-progress prefix and if so,
-// we will request a snapshot data chunk from them. Otherwise, we will assign a
-// new prefix to that peer.
-func (srv *Server) GetSnapshot(pp *Peer) {
-
-	// Start the timer to measure how much time passes from a GetSnapshot msg to
-	// a SnapshotData message.
-	srv.timer.Start("Get Snapshot")
-
-	var prefix []byte
-	var lastReceivedKey []byte
+// resumeHyperSyncFromCheckpoint resumes hyper sync from the saved checkpoint and requests the
+// next chunk from the peer. It returns false if there's no checkpoint that can be resumed
+// from, in which case hyper sync should start over.
+func (srv *Server) resumeHyperSyncFromCheckpoint(pp *Peer, expectedSnapshotHeight uint64) bool {
+	checkpoint, err := DBGetHyperSyncCheckpoint(srv.blockchain.db)
+	if err != nil {
+		glog.Errorf("Server.resumeHyperSyncFromCheckpoint: Problem getting checkpoint, error (%v)", err)
+	}
+	if checkpoint == nil {
+		return false
+	}
 
-	// We will try to determine if the provided peer has been assigned a prefix.
-	// Iterate over all incomplete prefixes in the HyperSyncProgress and see if
-	// any of them has been assigned to the peer.
-	syncingPrefix := false
-	for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
-		if prefixProgress.Completed {
-			continue
+	// From here on, if we can't resume from the checkpoint it's deleted so that we don't try again.
+	resume := func() error {
+		if expectedSnapshotHeight >= uint64(len(srv.blockchain.bestHeaderChain)) {
+			return fmt.Errorf("expected snapshot height (%v) is past the header tip", expectedSnapshotHeight)
 		}
-		prefix = prefixProgress.Prefix
-		lastReceivedKey = prefixProgress.LastReceivedKey
-		syncingPrefix = true
-		if prefixProgress.PrefixSyncPeer.ID == pp.ID {
-			prefix = prefixProgress.Prefix
-			lastReceivedKey = prefixProgress.LastReceivedKey
-			syncingPrefix = true
-			break
-		} else {
-			glog.V(1).Infof("GetSnapshot: switching peers on prefix (%v), previous peer ID (%v) "+
-				"current peer ID (%v)", prefixProgress.Prefix, prefixProgress.PrefixSyncPeer.ID, pp.ID)
-			// TODO: Should disable the previous sync peer here somehow
-
-			prefixProgress.PrefixSyncPeer.ID = pp.ID
+		expectedBlockHash := srv.blockchain.bestHeaderChain[expectedSnapshotHeight].Hash
+		if checkpoint.SnapshotMetadata.SnapshotBlockHeight != expectedSnapshotHeight ||
+			!checkpoint.SnapshotMetadata.CurrentEpochBlockHash.IsEqual(expectedBlockHash) {
+			return fmt.Errorf("checkpoint is for the snapshot at height (%v) with hash (%v) but the "+
+				"expected snapshot is at height (%v) with hash (%v)", checkpoint.SnapshotMetadata.SnapshotBlockHeight,
+				checkpoint.SnapshotMetadata.CurrentEpochBlockHash, expectedSnapshotHeight, expectedBlockHash)
 		}
-	}
-
-	// If peer isn't assigned to any prefix, we will assign him now.
-	if !syncingPrefix {
-		// We will assign the peer to a non-existent prefix.
-		for _, prefix = range StatePrefixes.StatePrefixesList {
-			exists := false
-			for _, prefixProgress := range srv.HyperSyncProgress.PrefixProgress {
-				if reflect.DeepEqual(prefix, prefixProgress.Prefix) {
-					exists = true
-					break
-				}
-			}
-			// If prefix doesn't exist in our prefix progress struct, append new progress tracker
-			// and assign it to the current peer.
-			if !exists {
-				srv.HyperSyncProgress.PrefixProgress = append(srv.HyperSyncProgress.PrefixProgress, &SyncPrefixProgress{
-					PrefixSyncPeer:  pp,
-					Prefix:          prefix,
-					LastReceivedKey: prefix,
-					Completed:       false,
-				})
-				lastReceivedKey = prefix
-				syncingPrefix = true
-				break
-			}
+		if err := DBRestoreHyperSyncCheckpointState(srv.blockchain.db, checkpoint); err != nil {
+			return err
 		}
-		// If no prefix was found, we error and return because the state is already synced.
-		if !syncingPrefix {
-			glog.Errorf("Server.GetSnapshot: Error selecting a prefix for peer %v "+
-				"all prefixes are synced", pp)
-			return
+		if err := srv.snapshot.RestoreHyperSyncCheckpointChecksums(checkpoint); err != nil {
+			return err
 		}
+		return nil
 	}
-	// As a pace-setting mechanism, we enqueue to the operationQueueSemaphore in a go routine. The request will be blocked
-	// if there are too many requests in memory.
-	go func() {
-		srv.snapshot.operationQueueSemaphore <- struct{}{}
-		// Now send a message to the peer to fetch the snapshot chunk.
-		glog.V(2).Infof("Server.GetSnapshot: Sending a GetSnapshot message to peer (%v) "+
-			"with Prefix (%v) and SnapshotStartEntry (%v)", pp, prefix, lastReceivedKey)
-		pp.AddDeSoMessage(&MsgDeSoGetSnapshot{
-			SnapshotStartKey: lastReceivedKey,
-		}, false)
-	}()
+	if err = resume(); err != nil {
+		glog.Errorf(CLog(Red, fmt.Sprintf("Server.resumeHyperSyncFromCheckpoint: Can't resume hyper sync, "+
+			"will start over, error: %v", err)))
+		if err = DBDeleteHyperSyncCheckpoint(srv.blockchain.db); err != nil {
+			glog.Errorf("Server.resumeHyperSyncFromCheckpoint: Problem deleting checkpoint, error (%v)", err)
+		}
+		return false
+	}
+	if err = srv.snapshot.Checksum.SaveChecksum(); err != nil {
+		glog.Errorf("Server.resumeHyperSyncFromCheckpoint: Problem saving checksum, error (%v)", err)
+	}
+	if err = srv.snapshot.Migrations.SaveMigrations(); err != nil {
+		glog.Errorf("Server.resumeHyperSyncFromCheckpoint: Problem saving migration checksums, error (%v)", err)
+	}
+
+	numCompleted := 0
+	srv.HyperSyncProgress.SnapshotMetadata = checkpoint.SnapshotMetadata
+	srv.HyperSyncProgress.PrefixProgress = []*SyncPrefixProgress{}
+	for _, prefixCheckpoint := range checkpoint.Prefixes {
+		// The prefixes are assigned to peers by GetSnapshot.
+		srv.HyperSyncProgress.PrefixProgress = append(srv.HyperSyncProgress.PrefixProgress, &SyncPrefixProgress{
+			Prefix:          prefixCheckpoint.Prefix,
+			LastReceivedKey: prefixCheckpoint.LastReceivedKey,
+			NumEntries:      prefixCheckpoint.NumEntries,
+			Digest:          prefixCheckpoint.Digest,
+			ChunkVerifier:   prefixCheckpoint.ChunkVerifier,
+			Completed:       prefixCheckpoint.Completed,
+		})
+		if prefixCheckpoint.Completed {
+			numCompleted++
+		}
+	}
+	srv.HyperSyncProgress.Completed = false
+	go srv.HyperSyncProgress.PrintLoop()
+
+	glog.Infof(CLog(Magenta, fmt.Sprintf("Resuming HyperSync of the snapshot at height (%v) from a checkpoint "+
+		"with (%v) of (%v) prefixes completed. Connected peer (%v).", expectedSnapshotHeight, numCompleted,
+		len(StatePrefixes.StatePrefixesList), pp)))
+
+	srv.timer.Start("HyperSync")
+	srv.GetSnapshot(pp)
+	return true
 }
 
 // GetBlocksToStore is part of the archival mode, which makes the node download all historical blocks after completing
@@ -1183,6 +1395,10 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 					srv.GetSnapshot(pp)
 					return
 				}
+				// If hyper sync was interrupted by a restart, we pick up where we left off.
+				if srv.resumeHyperSyncFromCheckpoint(pp, expectedSnapshotHeight) {
+					return
+				}
 				glog.Infof(CLog(Magenta, fmt.Sprintf("Initiating HyperSync after finishing downloading headers. Node "+
 					"will quickly download a snapshot of the blockchain taken at height (%v). HyperSync will sync each "+
 					"prefix of the node's KV database. Connected peer (%v). Note: State sync is a new feature and hence "+
@@ -1354,6 +1570,10 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 func (srv *Server) _handleGetBlocks(pp *Peer, msg *MsgDeSoGetBlocks) {
 	glog.V(1).Infof("srv._handleGetBlocks: Called with message %v from Peer %v", msg, pp)
 
+	if !srv._checkPeerRateLimit(pp, MsgTypeGetBlocks, uint64(len(msg.HashList))) {
+		return
+	}
+
 	// Let the peer handle this
 	pp.AddDeSoMessage(msg, true /*inbound*/)
 }
@@ -1364,6 +1584,10 @@ func (srv *Server) _handleGetBlocks(pp *Peer, msg *MsgDeSoGetBlocks) {
 func (srv *Server) _handleGetSnapshot(pp *Peer, msg *MsgDeSoGetSnapshot) {
 	glog.V(1).Infof("srv._handleGetSnapshot: Called with message %v from Peer %v", msg, pp)
 
+	if !srv._checkPeerRateLimit(pp, MsgTypeGetSnapshot, 1) {
+		return
+	}
+
 	// Let the peer handle this. We will delegate this message to the peer's queue of inbound messages, because
 	// fetching a snapshot chunk is an expensive operation.
 	pp.AddDeSoMessage(msg, true /*inbound*/)
@@ -1416,7 +1640,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		// We should disconnect the peer because he is misbehaving or doesn't have the snapshot.
 		glog.Errorf("srv._handleSnapshot: Received a snapshot messages with empty snapshot chunk "+
 			"disconnecting misbehaving peer (%v)", pp)
-		pp.Disconnect("handleSnapshot: Empty snapshot chunk received from peer")
+		srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: Empty snapshot chunk received from peer")
 		return
 	}
 
@@ -1424,8 +1648,6 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		"<%v>, Last entry: <%v>), (number of entries: %v), metadata (%v), and isEmpty (%v), from Peer %v",
 		msg.SnapshotChunk[0].Key, msg.SnapshotChunk[len(msg.SnapshotChunk)-1].Key, len(msg.SnapshotChunk),
 		msg.SnapshotMetadata, msg.SnapshotChunk[0].IsEmpty(), pp)))
-	// Free up a slot in the operationQueueSemaphore, now that a chunk has been processed.
-	srv.snapshot.FreeOperationQueueSemaphore()
 
 	// There is a possibility that during hypersync the network entered a new snapshot epoch. We handle this case by
 	// restarting the node and starting hypersync from scratch.
@@ -1454,7 +1676,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			"hyper sync height (%v) and hash (%v)",
 			msg.SnapshotMetadata.SnapshotBlockHeight, msg.SnapshotMetadata.CurrentEpochBlockHash,
 			srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight, srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash)
-		pp.Disconnect("handleSnapshot: Snapshot metadata does not match expected snapshot metadata")
+		srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: Snapshot metadata does not match expected snapshot metadata")
 		return
 	}
 
@@ -1474,6 +1696,22 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		pp.Disconnect("handleSnapshot: Problem finding appropriate sync prefix progress")
 		return
 	}
+	// If the prefix was handed to another peer, e.g. because this one was disconnected, we drop the chunk.
+	if !syncPrefixProgress.Completed &&
+		(syncPrefixProgress.PrefixSyncPeer == nil || syncPrefixProgress.PrefixSyncPeer.ID != pp.ID) {
+		glog.V(1).Infof("srv._handleSnapshot: Dropping snapshot chunk for prefix (%v) from peer (%v) "+
+			"because the prefix isn't assigned to it", msg.Prefix, pp)
+		return
+	}
+	// Likewise, we drop chunks we didn't ask for, e.g. for a prefix we've already completed.
+	if syncPrefixProgress.chunkRequest == nil {
+		glog.V(1).Infof("srv._handleSnapshot: Dropping snapshot chunk for prefix (%v) from peer (%v) "+
+			"because no chunk was requested", msg.Prefix, pp)
+		return
+	}
+	// Free up the request's slot in the operationQueueSemaphore, now that its chunk has arrived.
+	syncPrefixProgress.chunkRequest.release(srv.snapshot)
+	syncPrefixProgress.chunkRequest = nil
 
 	// If we haven't yet set the epoch checksum bytes in the hyper sync progress, we'll do it now.
 	// If we did set the checksum bytes, we will verify that they match the one that peer has sent us.
@@ -1485,7 +1723,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		// We should disconnect the peer because he is misbehaving
 		glog.Errorf("srv._handleSnapshot: HyperSyncProgress epoch checksum bytes does not match that received from peer, "+
 			"disconnecting misbehaving peer (%v)", pp)
-		pp.Disconnect("handleSnapshot: Snapshot checksum bytes do not match expected checksum bytes")
+		srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: Snapshot checksum bytes do not match expected checksum bytes")
 		return
 	}
 
@@ -1508,7 +1746,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			glog.Errorf("srv._handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix "+
 				"disconnecting misbehaving peer (%v)", pp)
 			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-			pp.Disconnect("handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix")
+			srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix")
 			return
 		}
 		dbChunk = append(dbChunk, msg.SnapshotChunk[0])
@@ -1520,7 +1758,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			glog.Errorf("srv._handleSnapshot: Received a snapshot chunk that's not in-line with the sync progress "+
 				"disconnecting misbehaving peer (%v)", pp)
 			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-			pp.Disconnect("handleSnapshot: Snapshot chunk not in-line with sync progress")
+			srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: Snapshot chunk not in-line with sync progress")
 			return
 		}
 	}
@@ -1537,7 +1775,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 				glog.Errorf("srv._handleSnapshot: DBEntry key has mismatched prefix "+
 					"disconnecting misbehaving peer (%v)", pp)
 				srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-				pp.Disconnect("handleSnapshot: DBEntry key has mismatched prefix")
+				srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: DBEntry key has mismatched prefix")
 				return
 			}
 			// Make sure that the dbChunk is sorted increasingly.
@@ -1547,11 +1785,64 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 					"value (%v) and second entry with index (%v) and value (%v) disconnecting misbehaving peer (%v)",
 					ii-1, dbChunk[ii-1].Key, ii, dbChunk[ii].Key, pp)
 				srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-				pp.Disconnect("handleSnapshot: dbChunk entries are not sorted")
+				srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: dbChunk entries are not sorted")
 				return
 			}
 		}
+	}
+
+	// If the peer committed to the snapshot's chunks, verify the chunk against the commitment. We lock in
+	// the first commitment we receive, but unlike the checksum bytes, nothing binds the commitment to the
+	// snapshot yet, so when two peers send different commitments we can't tell which one is lying. Rather
+	// than penalize a peer that may be honest, we drop the commitment along with the verifiers that relied
+	// on it and re-fetch the chunk, which locks in the commitment it comes with. The final checksum check
+	// still covers every entry, verified or not.
+	if msg.SnapshotMetadata.ChunkCommitment != nil {
+		if srv.HyperSyncProgress.SnapshotMetadata.ChunkCommitment == nil {
+			srv.HyperSyncProgress.SnapshotMetadata.ChunkCommitment = msg.SnapshotMetadata.ChunkCommitment
+		} else if !srv.HyperSyncProgress.SnapshotMetadata.ChunkCommitment.Equal(msg.SnapshotMetadata.ChunkCommitment) {
+			glog.Warningf("srv._handleSnapshot: HyperSyncProgress chunk commitment does not match that received "+
+				"from peer (%v), resetting the commitment and re-fetching the chunk", pp)
+			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
+			srv.HyperSyncProgress.resetChunkCommitment()
+			srv.requestSnapshotChunk(pp, syncPrefixProgress)
+			return
+		}
+	}
+	chunkVerifier := syncPrefixProgress.ChunkVerifier
+	// A peer that doesn't commit to its chunks can't be held to another peer's commitment, so the rest
+	// of the prefix goes unverified.
+	if chunkVerifier != nil && msg.SnapshotMetadata.ChunkCommitment == nil {
+		glog.Warningf("srv._handleSnapshot: Peer (%v) sent a chunk without a commitment, no longer "+
+			"verifying prefix (%v)", pp, msg.Prefix)
+		chunkVerifier = nil
+		syncPrefixProgress.ChunkVerifier = nil
+	}
+	// We can only verify a prefix from its first chunk.
+	if chunkVerifier == nil && msg.SnapshotMetadata.ChunkCommitment != nil &&
+		bytes.Equal(syncPrefixProgress.LastReceivedKey, syncPrefixProgress.Prefix) {
+		chunkVerifier = NewSnapshotChunkVerifier(srv.HyperSyncProgress.SnapshotMetadata.ChunkCommitment)
+	}
+	if chunkVerifier != nil {
+		var chunkEntries []*DBEntry
+		if !chunkEmpty {
+			chunkEntries = dbChunk
+		}
+		// The peer's commitment is the one we locked in, so a chunk that doesn't match it is the peer's fault.
+		var err error
+		chunkVerifier, err = chunkVerifier.VerifyChunk(msg.Prefix, chunkEntries, !msg.SnapshotChunkFull,
+			msg.ChunkProofs)
+		if err != nil {
+			glog.Errorf("srv._handleSnapshot: Snapshot chunk failed verification against the chunk commitment, "+
+				"disconnecting misbehaving peer (%v), error: %v", pp, err)
+			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
+			srv._penalizeAndDisconnectPeer(pp, "handleSnapshot: Snapshot chunk failed verification")
+			return
+		}
+		syncPrefixProgress.ChunkVerifier = chunkVerifier
+	}
 
+	if !chunkEmpty {
 		// Process the DBEntries from the msg and add them to the db.
 		srv.timer.Start("Server._handleSnapshot Process Snapshot")
 		srv.snapshot.ProcessSnapshotChunk(srv.blockchain.db, &srv.blockchain.ChainLock, dbChunk,
@@ -1566,6 +1857,11 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			// We found the hyper sync progress corresponding to this snapshot chunk so update the key.
 			lastKey := msg.SnapshotChunk[len(msg.SnapshotChunk)-1].Key
 			srv.HyperSyncProgress.PrefixProgress[ii].LastReceivedKey = lastKey
+			if !chunkEmpty {
+				srv.HyperSyncProgress.PrefixProgress[ii].NumEntries += uint64(len(dbChunk))
+				srv.HyperSyncProgress.PrefixProgress[ii].Digest = UpdateHyperSyncPrefixDigest(
+					srv.HyperSyncProgress.PrefixProgress[ii].Digest, dbChunk)
+			}
 
 			// If the snapshot chunk is not full, it means that we've completed this prefix. In such case,
 			// there is a possibility we've finished hyper sync altogether. We will break out of the loop
@@ -1574,10 +1870,13 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			//		We'll do this when we want to implement multi-peer sync.
 			if !msg.SnapshotChunkFull {
 				srv.HyperSyncProgress.PrefixProgress[ii].Completed = true
+				srv.snapshot.SaveHyperSyncCheckpoint(srv.HyperSyncProgress.ToHyperSyncCheckpoint())
 				break
 			} else {
-				// If chunk is full it means there's more work to do, so we will resume snapshot sync.
-				srv.GetSnapshot(pp)
+				// Checkpoint the progress so that we can resume from this chunk if the node is restarted.
+				srv.snapshot.SaveHyperSyncCheckpoint(srv.HyperSyncProgress.ToHyperSyncCheckpoint())
+				// If chunk is full it means there's more work to do, so we will request the next chunk.
+				srv.requestSnapshotChunk(pp, srv.HyperSyncProgress.PrefixProgress[ii])
 				return
 			}
 		}
@@ -1699,6 +1998,17 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	// we've initialized the chain with seed transactions.
 	srv.snapshot.DatabaseCache = lru.NewKVCache(DatabaseCacheSize)
 
+	// The snapshot chunks were written to the db directly, so the DAO coin holder index and
+	// the staker indexes don't include the entries they contained yet.
+	if srv.blockchain.postgres == nil {
+		if err = DbRebuildDAOCoinHolderIndex(srv.blockchain.db); err != nil {
+			glog.Errorf("Server._handleSnapshot: Problem rebuilding DAO coin holder index, error: (%v)", err)
+		}
+	}
+	if err = DbRebuildStakerIndexes(srv.blockchain.db); err != nil {
+		glog.Errorf("Server._handleSnapshot: Problem rebuilding staker indexes, error: (%v)", err)
+	}
+
 	// If we got here then we finished the snapshot sync so set appropriate flags.
 	srv.blockchain.syncingState = false
 	srv.blockchain.snapshot.CurrentEpochSnapshotMetadata = srv.HyperSyncProgress.SnapshotMetadata
@@ -1722,6 +2032,11 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	srv.snapshot.Status.CurrentBlockHeight = msg.SnapshotMetadata.SnapshotBlockHeight
 	srv.snapshot.Status.SaveStatus()
 
+	// The state is complete, so there's nothing left to resume.
+	if err = DBDeleteHyperSyncCheckpoint(srv.blockchain.db); err != nil {
+		glog.Errorf("server._handleSnapshot: Problem deleting hyper sync checkpoint, error (%v)", err)
+	}
+
 	glog.Infof("server._handleSnapshot: FINAL snapshot checksum is (%v) (%v)",
 		srv.snapshot.CurrentEpochSnapshotMetadata.CurrentEpochChecksumBytes,
 		hex.EncodeToString(srv.snapshot.CurrentEpochSnapshotMetadata.CurrentEpochChecksumBytes))
@@ -1755,6 +2070,7 @@ func (srv *Server) _startSync() {
 
 	// Find a peer with StartingHeight bigger than our best header tip.
 	var bestPeer *Peer
+	var bestPeerScore int64
 	for _, peer := range srv.cmgr.GetAllPeers() {
 		// If connectIps is set, only sync from persistent peers.
 		if len(srv.connectIps) > 0 && !peer.IsPersistent() {
@@ -1774,10 +2090,14 @@ func (srv *Server) _startSync() {
 			continue
 		}
 
-		// TODO: Choose best peers based on ping time and/or the highest
-		// starting block height. For now, keeping it simple and just choosing
-		// the last one we iterate over with a block height larger than our best.
+		// Out of those, choose the peer with the best score, which accounts for its
+		// ping time and for how well it served us before.
+		peerScore := srv.cmgr.GetPeerScoreValue(peer)
+		if bestPeer != nil && peerScore < bestPeerScore {
+			continue
+		}
 		bestPeer = peer
+		bestPeerScore = peerScore
 	}
 
 	if bestPeer == nil {
@@ -1838,6 +2158,11 @@ func (srv *Server) HandleAcceptedPeer(rn *RemoteNode) {
 		srv._startSync()
 	}
 
+	// If we're downloading the snapshot, the peer can take some of the prefixes.
+	if srv.isHyperSyncInProgress() {
+		srv.GetSnapshot(nil)
+	}
+
 	if !isSyncCandidate {
 		glog.Infof("Peer is not sync candidate: %v (isOutbound: %v)", pp, pp.isOutbound)
 	}
@@ -1930,6 +2255,12 @@ func (srv *Server) _handleDisconnectedPeerMessage(pp *Peer) {
 
 	srv._cleanupDonePeerState(pp)
 
+	// Blocks we were waiting on the peer's txns for will be synced from other peers.
+	srv._cleanupPendingCompactBlocks(pp)
+
+	// If we were downloading the snapshot from the peer, other peers take over its prefixes.
+	srv.failOverHyperSyncPeer(pp)
+
 	// Attempt to find a new peer to sync from if the quitting peer is the sync peer.
 	// We need to refresh the sync peer regardless of whether we're syncing or not.
 	// In the event that we fall behind, this allows us to switch to a peer allows us
@@ -1957,6 +2288,9 @@ func (srv *Server) _relayTransactions() {
 	// on the current block height.
 	txnList := mempool.GetTransactions()
 
+	// Light peers that loaded a filter only get the txns that match it.
+	txnMatcher := newLightPeerTxnMatcher()
+
 	for _, pp := range allPeers {
 		if !pp.canReceiveInvMessages {
 			glog.V(1).Infof("Skipping invs for peer %v because not ready "+
@@ -1966,6 +2300,7 @@ func (srv *Server) _relayTransactions() {
 		// For each peer construct an inventory message that excludes transactions
 		// for which the minimum fee is below what the Peer will allow.
 		invMsg := &MsgDeSoInv{}
+		txnFilter := pp.TxnFilter()
 		for _, newTxn := range txnList {
 			if !newTxn.IsValidated() {
 				continue
@@ -1981,6 +2316,13 @@ func (srv *Server) _relayTransactions() {
 				continue
 			}
 
+			// If the peer isn't interested in this txn then skip it. We add it to the
+			// peer's known inventory so we don't have to match it again.
+			if !txnMatcher.matches(txnFilter, newTxn) {
+				pp.knownInventory.Add(*invVect)
+				continue
+			}
+
 			// Add the transaction to the peer's known inventory. We do
 			// it here when we enqueue the message to the peers outgoing
 			// message queue so that we don't have remember to do it later.
@@ -2020,6 +2362,12 @@ func (srv *Server) _addNewTxn(pp *Peer, txn *MsgDeSoTxn, rateLimit bool) ([]*Msg
 
 	glog.V(1).Infof("Server._addNewTxnAndRelay: txn: %v, peer: %v", txn, pp)
 
+	// Refuse txns the operator's relay policy denies before they reach either mempool.
+	if err := srv.relayPolicy.CheckTransactionForRelay(txn, srv.params); err != nil {
+		glog.V(1).Infof("Server._addNewTxn: %v", err)
+		return nil, errors.Wrapf(err, "Server._addNewTxn: ")
+	}
+
 	// Try and add the transaction to the mempool.
 	peerID := uint64(0)
 	if pp != nil {
@@ -2056,6 +2404,11 @@ func (srv *Server) _addNewTxn(pp *Peer, txn *MsgDeSoTxn, rateLimit bool) ([]*Msg
 		}
 	}
 
+	srv.orderBookDiffStream.NotifyTransaction(txn)
+	// The PoW mempool notifies the txn event bus of the txns it accepts itself.
+	if uint64(tipHeight) >= srv.params.GetFinalPoWBlockHeight() {
+		srv.transactionEventBus.NotifyMempoolAccepted(txn)
+	}
 	return []*MsgDeSoTxn{txn}, nil
 }
 
@@ -2165,6 +2518,15 @@ func (srv *Server) _tryRequestMempoolFromPeer(pp *Peer) {
 	isRunningFastHotStuffConsensus := srv.fastHotStuffConsensus != nil && srv.fastHotStuffConsensus.IsRunning()
 
 	if isChainCurrent || isRunningFastHotStuffConsensus {
+		// If mempool sync is on and the peer supports it, send the peer the txns we already
+		// have so it invs us the rest of its mempool right away.
+		if srv.MempoolSyncOnConnect && pp.serviceFlags.HasService(SFMempoolSync) {
+			mempoolSyncMsg := srv._newMempoolSyncMessage()
+			glog.V(1).Infof("Server._tryRequestMempoolFromPeer: Sending mempool sync message with %d "+
+				"short txn ids: %v", len(mempoolSyncMsg.ShortTxnIDs), pp)
+			pp.AddDeSoMessage(mempoolSyncMsg, false)
+			return
+		}
 		glog.V(1).Infof("Server._tryRequestMempoolFromPeer: Sending mempool message: %v", pp)
 		pp.AddDeSoMessage(&MsgDeSoMempool{}, false)
 	} else {
@@ -2191,10 +2553,11 @@ func (srv *Server) _handleBlockAccepted(event *BlockEvent) {
 		Hash: *blockHash,
 	}
 
-	// Iterate through all non-validator peers and relay the InvVect to them.
+	// Send the block as a compact block to the non-validator peers that understand them,
+	// and iterate through the rest and relay the InvVect to them.
 	// This will only actually be relayed if it's not already in the peer's knownInventory.
 	allNonValidators := srv.networkManager.GetAllNonValidators()
-	for _, remoteNode := range allNonValidators {
+	for _, remoteNode := range srv._relayCompactBlock(blk, invVect, allNonValidators) {
 		remoteNode.sendMessage(&MsgDeSoInv{
 			InvList: []*InvVect{invVect},
 		})
@@ -2211,7 +2574,50 @@ func (srv *Server) _logAndDisconnectPeer(pp *Peer, blockMsg *MsgDeSoBlock, suffi
 	// fetch headers, blocks, etc. So we'll be back.
 	glog.Errorf("Server._handleBlock: Encountered an error processing "+
 		"block %v. Disconnecting from peer %v: %s", blockMsg, pp, suffix)
-	pp.Disconnect("Problem processing block")
+	srv._penalizeAndDisconnectPeer(pp, "Problem processing block")
+}
+
+// SetPeerRateLimits sets the budgets each peer has for expensive requests, and the number of
+// requests over budget, in a row, we drop before disconnecting the peer. It only applies to the
+// peers that haven't sent us an expensive request yet, so it should be called before Start.
+func (srv *Server) SetPeerRateLimits(limits map[MsgType]PeerRateLimit, maxViolations uint64) error {
+	for msgType, limit := range limits {
+		if limit.RequestsPerSecond <= 0 || limit.Burst < 1 {
+			return fmt.Errorf("SetPeerRateLimits: Rate limit for %v must have a positive rate and "+
+				"a burst of at least one", msgType)
+		}
+	}
+	srv.peerRateLimits = limits
+	srv.peerRateLimitMaxViolations = maxViolations
+	return nil
+}
+
+// _checkPeerRateLimit returns true if the peer's request is within its budget. Requests over
+// budget are dropped, and the peer is disconnected if it keeps sending them.
+func (srv *Server) _checkPeerRateLimit(pp *Peer, msgType MsgType, cost uint64) bool {
+	now := time.Now()
+	if pp.rateLimiter == nil {
+		pp.rateLimiter = NewPeerRateLimiter(srv.peerRateLimits, srv.peerRateLimitMaxViolations, now)
+	}
+	allowed, shouldDisconnect := pp.rateLimiter.Allow(msgType, cost, now)
+	if shouldDisconnect {
+		glog.Errorf("Server._checkPeerRateLimit: Disconnecting Peer %v for exceeding its %v rate limit",
+			pp, msgType)
+		srv._penalizeAndDisconnectPeer(pp, fmt.Sprintf("Exceeded %v rate limit", msgType))
+	} else if !allowed {
+		glog.Warningf("Server._checkPeerRateLimit: Dropping %v message from Peer %v over its rate limit",
+			msgType, pp)
+	}
+	return allowed
+}
+
+// _penalizeAndDisconnectPeer disconnects a peer that sent us an invalid message, lowering its
+// score so that we stop connecting to it if it keeps doing so.
+func (srv *Server) _penalizeAndDisconnectPeer(pp *Peer, reason string) {
+	if srv.cmgr != nil {
+		srv.cmgr.RecordPeerInvalidMessage(pp, reason)
+	}
+	pp.Disconnect(reason)
 }
 
 // This function handles a single block that we receive from our peer. Originally, we would receive blocks
@@ -2576,6 +2982,11 @@ func (srv *Server) ProcessSingleTxnWithChainLock(pp *Peer, txn *MsgDeSoTxn) ([]*
 	}
 
 	// Happy path, the txn was successfully added to the PoS (and optionally PoW) mempool.
+	srv.orderBookDiffStream.NotifyTransaction(txn)
+	// The PoW mempool notifies the txn event bus of the txns it accepts itself.
+	if uint64(tipHeight) >= srv.params.GetFinalPoWBlockHeight() {
+		srv.transactionEventBus.NotifyMempoolAccepted(txn)
+	}
 	return []*MsgDeSoTxn{txn}, nil
 }
 
@@ -2671,6 +3082,26 @@ func (srv *Server) StartStatsdReporter() {
 				mempoolTotal := len(srv.mempool.readOnlyUniversalTransactionList)
 				srv.statsdClient.Gauge("MEMPOOL.COUNT", float64(mempoolTotal), tags, 1)
 
+				// Report mempool size, fees, and drops
+				mempoolMetrics := srv.mempool.GetMetrics()
+				srv.statsdClient.Gauge("MEMPOOL.SIZE_BYTES", float64(mempoolMetrics.TotalTxSizeBytes), tags, 1)
+				srv.statsdClient.Gauge("MEMPOOL.UNCONNECTED_COUNT", float64(mempoolMetrics.NumUnconnectedTxns), tags, 1)
+				srv.statsdClient.Gauge("MEMPOOL.MIN_FEE_RATE_NANOS_PER_KB",
+					float64(mempoolMetrics.MinFeeRateNanosPerKB), tags, 1)
+				srv.statsdClient.Gauge("MEMPOOL.TXNS_ACCEPTED", float64(mempoolMetrics.NumTxnsAccepted), tags, 1)
+				for txnType, numTxns := range mempoolMetrics.NumTxnsByType {
+					srv.statsdClient.Gauge("MEMPOOL.COUNT_BY_TYPE", float64(numTxns),
+						append(tags, "txn_type:"+txnType), 1)
+				}
+				for reason, numTxns := range mempoolMetrics.NumTxnsRejectedByReason {
+					srv.statsdClient.Gauge("MEMPOOL.TXNS_REJECTED", float64(numTxns),
+						append(tags, "reason:"+reason), 1)
+				}
+				for reason, numTxns := range mempoolMetrics.NumTxnsEvictedByReason {
+					srv.statsdClient.Gauge("MEMPOOL.TXNS_EVICTED", float64(numTxns),
+						append(tags, "reason:"+string(reason)), 1)
+				}
+
 				// Report PoS Mempool size
 				posMempoolTotal := srv.posMempool.txnRegister.Count()
 				srv.statsdClient.Gauge("POS_MEMPOOL.COUNT", float64(posMempoolTotal), tags, 1)
@@ -2682,6 +3113,15 @@ func (srv *Server) StartStatsdReporter() {
 				headersHeight := srv.blockchain.HeaderTip().Height
 				srv.statsdClient.Gauge("HEADERS.HEIGHT", float64(headersHeight), tags, 1)
 
+				// Report relay policy counters
+				relayPolicyStats := srv.relayPolicy.GetStats()
+				srv.statsdClient.Gauge("RELAY_POLICY.DENIED_PUBLIC_KEYS",
+					float64(relayPolicyStats.NumDeniedPublicKeys), tags, 1)
+				srv.statsdClient.Gauge("RELAY_POLICY.TXNS_REFUSED_RELAY",
+					float64(relayPolicyStats.NumTxnsRefusedRelay), tags, 1)
+				srv.statsdClient.Gauge("RELAY_POLICY.TXNS_EXCLUDED_FROM_BLOCKS",
+					float64(relayPolicyStats.NumTxnsExcludedFromBlocks), tags, 1)
+
 			case <-srv.mempool.quit:
 				break out
 			}
@@ -2846,6 +3286,16 @@ func (srv *Server) _handlePeerMessages(serverMessage *ServerMessage) {
 		srv._handleTransactionBundleV2(serverMessage.Peer, msg)
 	case *MsgDeSoMempool:
 		srv._handleMempool(serverMessage.Peer, msg)
+	case *MsgDeSoFilterLoad:
+		srv._handleFilterLoad(serverMessage.Peer, msg)
+	case *MsgDeSoFilterClear:
+		srv._handleFilterClear(serverMessage.Peer, msg)
+	case *MsgDeSoCompactBlock:
+		srv._handleCompactBlock(serverMessage.Peer, msg)
+	case *MsgDeSoGetBlockTxns:
+		srv._handleGetBlockTxns(serverMessage.Peer, msg)
+	case *MsgDeSoBlockTxns:
+		srv._handleBlockTxns(serverMessage.Peer, msg)
 	case *MsgDeSoInv:
 		srv._handleInv(serverMessage.Peer, msg)
 	case *MsgDeSoVersion:
@@ -2856,6 +3306,14 @@ func (srv *Server) _handlePeerMessages(serverMessage *ServerMessage) {
 		srv._handleValidatorVote(serverMessage.Peer, msg)
 	case *MsgDeSoValidatorTimeout:
 		srv._handleValidatorTimeout(serverMessage.Peer, msg)
+	case *MsgDeSoNodeAdvisory:
+		srv._handleNodeAdvisory(serverMessage.Peer, msg)
+	case *MsgDeSoGetProfilePicBlobs:
+		srv._handleGetProfilePicBlobs(serverMessage.Peer, msg)
+	case *MsgDeSoProfilePicBlobs:
+		srv._handleProfilePicBlobs(serverMessage.Peer, msg)
+	case *MsgDeSoMempoolSync:
+		srv._handleMempoolSync(serverMessage.Peer, msg)
 	}
 }
 
@@ -3235,6 +3693,14 @@ func (srv *Server) Stop() {
 	glog.Infof(CLog(Yellow, "Server.Stop: Closed PosMempool"))
 	srv.posMempool.Stop()
 
+	srv.orderBookDiffStream.Stop()
+	glog.Infof(CLog(Yellow, "Server.Stop: Closed the OrderBookDiffStream"))
+
+	if srv.snapshotChunkCommitter != nil {
+		srv.snapshotChunkCommitter.Stop()
+		glog.Infof(CLog(Yellow, "Server.Stop: Closed the SnapshotChunkCommitter"))
+	}
+
 	// Stop the block producer
 	if srv.blockProducer != nil {
 		if srv.blockchain.MaxSyncBlockHeight == 0 {
@@ -3296,6 +3762,12 @@ func (srv *Server) Start() {
 		srv.stateChangeSyncer.StartMempoolSyncRoutine(srv)
 	}
 
+	srv.orderBookDiffStream.Start()
+
+	if srv.snapshotChunkCommitter != nil {
+		srv.snapshotChunkCommitter.Start()
+	}
+
 	// Start the network manager's internal event loop to open and close connections to peers.
 	srv.networkManager.Start()
 }
@@ -3305,15 +3777,26 @@ func (srv *Server) Start() {
 // db key that we've received from that peer. Peers will send us state by chunks. But first we
 // need to tell the peer the starting key for the chunk we want to retrieve.
 type SyncPrefixProgress struct {
-	// Peer assigned for retrieving this particular prefix.
+	// Peer assigned for retrieving this particular prefix. It's nil if no peer is downloading the
+	// prefix, e.g. because its peer disconnected.
 	PrefixSyncPeer *Peer
 	// DB prefix corresponding to this particular sync progress.
 	Prefix []byte
 	// LastReceivedKey is the last key that we've received from this peer.
 	LastReceivedKey []byte
+	// NumEntries and Digest cover the entries we've received for this prefix. They're saved in
+	// the HyperSyncCheckpoint, so that the prefix can be re-validated if hyper sync is resumed.
+	NumEntries uint64
+	Digest     []byte
+	// ChunkVerifier checks the prefix's chunks against SnapshotMetadata.ChunkCommitment. It's nil
+	// if the prefix's first chunk came without a commitment.
+	ChunkVerifier *SnapshotChunkVerifier
 
 	// Completed indicates whether we've finished syncing this prefix.
 	Completed bool
+
+	// chunkRequest is the GetSnapshot request in flight for this prefix, if any.
+	chunkRequest *hyperSyncChunkRequest
 }
 
 // SyncProgress is used to keep track of hyper sync progress. It stores a list of SyncPrefixProgress
@@ -3332,6 +3815,41 @@ type SyncProgress struct {
 	printChannel chan struct{}
 }
 
+// resetChunkCommitment drops the chunk commitment we locked in along with the prefixes' verifiers,
+// so that the next commitment we receive is locked in instead. Prefixes that are partway through
+// are no longer verified, since a verifier can only start from a prefix's first chunk.
+func (progress *SyncProgress) resetChunkCommitment() {
+	progress.SnapshotMetadata.ChunkCommitment = nil
+	for _, prefixProgress := range progress.PrefixProgress {
+		prefixProgress.ChunkVerifier = nil
+	}
+}
+
+// ToHyperSyncCheckpoint copies the progress into a checkpoint, so that the progress can keep
+// changing while the checkpoint waits to be saved.
+func (progress *SyncProgress) ToHyperSyncCheckpoint() *HyperSyncCheckpoint {
+	checkpoint := &HyperSyncCheckpoint{
+		SnapshotMetadata: &SnapshotEpochMetadata{
+			SnapshotBlockHeight:       progress.SnapshotMetadata.SnapshotBlockHeight,
+			FirstSnapshotBlockHeight:  progress.SnapshotMetadata.FirstSnapshotBlockHeight,
+			CurrentEpochChecksumBytes: progress.SnapshotMetadata.CurrentEpochChecksumBytes,
+			CurrentEpochBlockHash:     progress.SnapshotMetadata.CurrentEpochBlockHash,
+			ChunkCommitment:           progress.SnapshotMetadata.ChunkCommitment,
+		},
+	}
+	for _, prefixProgress := range progress.PrefixProgress {
+		checkpoint.Prefixes = append(checkpoint.Prefixes, &HyperSyncCheckpointPrefix{
+			Prefix:          prefixProgress.Prefix,
+			LastReceivedKey: prefixProgress.LastReceivedKey,
+			Completed:       prefixProgress.Completed,
+			NumEntries:      prefixProgress.NumEntries,
+			Digest:          prefixProgress.Digest,
+			ChunkVerifier:   prefixProgress.ChunkVerifier,
+		})
+	}
+	return checkpoint
+}
+
 func (progress *SyncProgress) PrintLoop() {
 	progress.printChannel = make(chan struct{})
 	ticker := time.NewTicker(60 * time.Second)
@@ -53,6 +53,14 @@ var (
 	_prefixOperationChannelStatus = []byte{4}
 
 	_prefixMigrationStatus = []byte{5}
+
+	// This prefix saves the progress of an in-progress hyper sync so that it can be resumed after a restart.
+	// 	<prefix [1]byte> -> <HyperSyncCheckpoint>
+	_prefixHyperSyncCheckpoint = []byte{6}
+
+	// This prefix saves the leaves of the tree committing to the chunks of the current snapshot.
+	// 	<prefix [1]byte> -> <height, block hash, leaves and their last keys>
+	_prefixSnapshotChunkTree = []byte{7}
 )
 
 // getMainDbPrefix is a helper function thatused to get the main db prefix for a given snapshot db prefix.
@@ -366,6 +374,15 @@ type Snapshot struct {
 	timer *Timer
 
 	eventManager *EventManager
+
+	// hyperSyncCheckpointsDisabled is set once a snapshot chunk has been rescheduled, after which
+	// hyper sync checkpoints are no longer saved. It's only accessed from the Run loop.
+	hyperSyncCheckpointsDisabled bool
+
+	// chunkTree commits to the chunks of the current snapshot. It's set by the
+	// SnapshotChunkCommitter once the snapshot is complete.
+	chunkTree    *snapshotChunkTree
+	chunkTreeMtx sync.RWMutex
 }
 
 // NewSnapshot creates a new snapshot instance.
@@ -549,6 +566,11 @@ func (snap *Snapshot) Run() {
 			}
 			glog.V(0).Infof("Snapshot.Run: PrintText (%s) Current checksum (%v)", operation.printText, stateChecksum)
 
+		case SnapshotOperationSaveHyperSyncCheckpoint:
+			if err := snap.saveHyperSyncCheckpoint(operation.hyperSyncCheckpoint); err != nil {
+				glog.Errorf("Snapshot.Run: Problem saving hyper sync checkpoint, error (%v)", err)
+			}
+
 		case SnapshotOperationExit:
 			glog.V(2).Infof("Snapshot.Run: Exiting the operation loop")
 			if err := snap.Checksum.Wait(); err != nil {
@@ -1190,6 +1212,20 @@ func (snap *Snapshot) GetSnapshotChunk(prefix []byte, startKey []byte) (
 	return snapshotEntriesBatch, mainDbFilled || ancestralDbFilled, nil
 }
 
+// GetEpochMetadataCopy returns a copy of the current epoch's metadata, which can be read
+// without holding its lock.
+func (snap *Snapshot) GetEpochMetadataCopy() *SnapshotEpochMetadata {
+	epochMetadata := snap.CurrentEpochSnapshotMetadata
+	epochMetadata.updateMutex.RLock()
+	defer epochMetadata.updateMutex.RUnlock()
+	return &SnapshotEpochMetadata{
+		SnapshotBlockHeight:       epochMetadata.SnapshotBlockHeight,
+		FirstSnapshotBlockHeight:  epochMetadata.FirstSnapshotBlockHeight,
+		CurrentEpochChecksumBytes: append([]byte{}, epochMetadata.CurrentEpochChecksumBytes...),
+		CurrentEpochBlockHash:     epochMetadata.CurrentEpochBlockHash.NewBlockHash(),
+	}
+}
+
 // SetSnapshotChunk is called to put the snapshot chunk that we've got from a peer in the database.
 func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.RWMutex,
 	chunk []*DBEntry, blockHeight uint64) error {
@@ -1288,6 +1324,8 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 			panic(fmt.Errorf("Snapshot.SetSnapshotChunk: Problem resetting checksum. This should never happen, "+
 				"error: (%v)", err))
 		}
+		// The rescheduled chunk will be set after the checkpoints that were enqueued behind it.
+		snap.hyperSyncCheckpointsDisabled = true
 		snap.ProcessSnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight)
 		return err
 	}
@@ -1695,6 +1733,11 @@ type SnapshotEpochMetadata struct {
 	// CurrentEpochBlockHash is the hash of the first block of the current epoch. It's used to identify the snapshot.
 	CurrentEpochBlockHash *BlockHash
 
+	// ChunkCommitment is the commitment to the snapshot's chunks, see SnapshotChunkCommitment. It
+	// isn't part of the encoded metadata. Nodes serving the snapshot send it after the chunk in
+	// MsgDeSoSnapshotData, and a syncing node keeps the first one it receives here.
+	ChunkCommitment *SnapshotChunkCommitment
+
 	updateMutex sync.RWMutex
 
 	mainDb          *badger.DB
@@ -1852,6 +1895,8 @@ const (
 	SnapshotOperationChecksumRemove
 	// SnapshotOperationChecksumPrint is called when we want to print the state checksum.
 	SnapshotOperationChecksumPrint
+	// SnapshotOperationSaveHyperSyncCheckpoint is enqueued after a snapshot chunk to save the hyper sync progress.
+	SnapshotOperationSaveHyperSyncCheckpoint
 	// SnapshotOperationExit is used to quit the snapshot loop
 	SnapshotOperationExit
 )
@@ -1882,6 +1927,10 @@ type SnapshotOperation struct {
 	/* SnapshotOperationChecksumPrint */
 	// printText is the text we want to put in the print statement.
 	printText string
+
+	/* SnapshotOperationSaveHyperSyncCheckpoint */
+	// hyperSyncCheckpoint is the hyper sync progress as of the snapshot chunks enqueued before it.
+	hyperSyncCheckpoint *HyperSyncCheckpoint
 }
 
 type SnapshotOperationChannel struct {
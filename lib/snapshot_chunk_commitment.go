@@ -0,0 +1,744 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	merkletree "github.com/deso-protocol/go-merkle-tree"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// A hypersyncing node used to only find out whether the state it downloaded was valid once it
+// had every prefix, by comparing the state checksum it computed to the one in the snapshot
+// metadata. A peer that sent a single bad chunk wasted the whole sync.
+//
+// To catch bad chunks as they arrive, nodes that serve snapshots commit to the snapshot's
+// contents with a Merkle tree. The state at the snapshot height is split into buckets of
+// SnapshotChunkCommitmentBucketSize consecutive entries of the same prefix, and each bucket is
+// a leaf holding the number of entries in it and a digest of them (see
+// UpdateHyperSyncPrefixDigest). Since the buckets only depend on the state, every honest node
+// computes the same tree for a snapshot. The root and the number of leaves make up the
+// SnapshotChunkCommitment, which is sent with the snapshot metadata, and every chunk comes with
+// the Merkle proofs of the buckets that end in it.
+//
+// The syncing node locks in the first commitment it receives, the same way it locks in the
+// checksum, and checks every bucket it finishes against the leaf proven for it. Leaves are
+// sorted by prefix and numbered, so it can also check that a prefix starts with its first
+// leaf, that no bucket was skipped, and that a prefix isn't cut short or claimed to be empty
+// when it isn't. A peer that fails any of these checks is disconnected right away.
+//
+// The commitment is encoded after the rest of the snapshot message, so nodes that don't know
+// about it still decode the message. If the first chunk of a prefix comes without a
+// commitment, e.g. from an older peer or from a peer that's still computing the tree for a new
+// epoch, the prefix is only checked by the final checksum, as before.
+
+const (
+	// SnapshotChunkCommitmentBucketSize is the number of entries in each bucket of a prefix,
+	// except for the last one.
+	SnapshotChunkCommitmentBucketSize = 10000
+
+	DefaultSnapshotChunkCommitterIntervalSeconds = 60
+)
+
+// SnapshotChunkCommitment is the commitment to a snapshot's chunks.
+type SnapshotChunkCommitment struct {
+	Root      *BlockHash
+	NumLeaves uint64
+}
+
+func (commitment *SnapshotChunkCommitment) ToBytes() []byte {
+	var data []byte
+	data = append(data, commitment.Root.ToBytes()...)
+	data = append(data, UintToBuf(commitment.NumLeaves)...)
+	return data
+}
+
+func (commitment *SnapshotChunkCommitment) FromBytes(rr *bytes.Reader) error {
+	rootBytes := make([]byte, HashSizeBytes)
+	if _, err := io.ReadFull(rr, rootBytes); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkCommitment.FromBytes: Problem reading Root")
+	}
+	commitment.Root = NewBlockHash(rootBytes)
+
+	var err error
+	if commitment.NumLeaves, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkCommitment.FromBytes: Problem reading NumLeaves")
+	}
+	return nil
+}
+
+func (commitment *SnapshotChunkCommitment) Equal(other *SnapshotChunkCommitment) bool {
+	return other != nil && commitment.Root.IsEqual(other.Root) && commitment.NumLeaves == other.NumLeaves
+}
+
+// SnapshotChunkLeaf is a bucket of entries in the snapshot.
+type SnapshotChunkLeaf struct {
+	// Index is the position of the leaf in the tree.
+	Index  uint64
+	Prefix []byte
+	// Ordinal is the position of the bucket among its prefix's buckets.
+	Ordinal uint64
+	// IsLast is set on the last bucket of the prefix.
+	IsLast     bool
+	NumEntries uint64
+	Digest     []byte
+}
+
+func (leaf *SnapshotChunkLeaf) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(leaf.Index)...)
+	data = append(data, EncodeByteArray(leaf.Prefix)...)
+	data = append(data, UintToBuf(leaf.Ordinal)...)
+	data = append(data, BoolToByte(leaf.IsLast))
+	data = append(data, UintToBuf(leaf.NumEntries)...)
+	data = append(data, EncodeByteArray(leaf.Digest)...)
+	return data
+}
+
+func (leaf *SnapshotChunkLeaf) FromBytes(rr *bytes.Reader) error {
+	var err error
+	if leaf.Index, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkLeaf.FromBytes: Problem reading Index")
+	}
+	if leaf.Prefix, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkLeaf.FromBytes: Problem reading Prefix")
+	}
+	if leaf.Ordinal, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkLeaf.FromBytes: Problem reading Ordinal")
+	}
+	if leaf.IsLast, err = ReadBoolByte(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkLeaf.FromBytes: Problem reading IsLast")
+	}
+	if leaf.NumEntries, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkLeaf.FromBytes: Problem reading NumEntries")
+	}
+	if leaf.Digest, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkLeaf.FromBytes: Problem reading Digest")
+	}
+	return nil
+}
+
+// Hash is the leaf's hash in the tree.
+func (leaf *SnapshotChunkLeaf) Hash() []byte {
+	return merkletree.Sha256DoubleHash(leaf.ToBytes())
+}
+
+// SnapshotChunkProof proves that a leaf is in the tree.
+type SnapshotChunkProof struct {
+	Leaf *SnapshotChunkLeaf
+	Path []*merkletree.ProofPart
+}
+
+func (proof *SnapshotChunkProof) ToBytes() ([]byte, error) {
+	var data []byte
+	data = append(data, proof.Leaf.ToBytes()...)
+	data = append(data, UintToBuf(uint64(len(proof.Path)))...)
+	for _, pf := range proof.Path {
+		// ProofParts have a specific length so no need to encode the length.
+		pfBytes, err := pf.Serialize()
+		if err != nil {
+			return nil, errors.Wrapf(err, "SnapshotChunkProof.ToBytes: ")
+		}
+		data = append(data, pfBytes...)
+	}
+	return data, nil
+}
+
+func (proof *SnapshotChunkProof) FromBytes(rr *bytes.Reader) error {
+	proof.Leaf = &SnapshotChunkLeaf{}
+	if err := proof.Leaf.FromBytes(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkProof.FromBytes: ")
+	}
+	numProofParts, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "SnapshotChunkProof.FromBytes: Problem reading numProofParts")
+	}
+	// A path is at most as long as the tree is deep.
+	if numProofParts > 64 {
+		return fmt.Errorf("SnapshotChunkProof.FromBytes: Path has (%v) parts", numProofParts)
+	}
+	proof.Path = nil
+	for ii := uint64(0); ii < numProofParts; ii++ {
+		pfBytes := make([]byte, merkletree.ProofPartSerializeSize)
+		if _, err = io.ReadFull(rr, pfBytes); err != nil {
+			return errors.Wrapf(err, "SnapshotChunkProof.FromBytes: Problem reading ProofPart %d", ii)
+		}
+		pf := &merkletree.ProofPart{}
+		if err = pf.Deserialize(pfBytes); err != nil {
+			return errors.Wrapf(err, "SnapshotChunkProof.FromBytes: Problem parsing ProofPart %d", ii)
+		}
+		proof.Path = append(proof.Path, pf)
+	}
+	return nil
+}
+
+// Verify checks that the leaf is in the tree the commitment was made for.
+func (proof *SnapshotChunkProof) Verify(commitment *SnapshotChunkCommitment) bool {
+	if proof.Leaf == nil || proof.Leaf.Index >= commitment.NumLeaves {
+		return false
+	}
+	return merkletree.VerifyProof(proof.Leaf.Hash(), proof.Path, commitment.Root[:])
+}
+
+// ==================================================================
+// Building the tree
+// ==================================================================
+
+// snapshotChunkLeafBuilder splits the entries of a snapshot into leaves. Prefixes have to be
+// added in order, and each prefix's entries in order.
+type snapshotChunkLeafBuilder struct {
+	leaves []*SnapshotChunkLeaf
+	// lastKeys holds the key of the last entry in each leaf, which is used to find the leaves
+	// that end in a chunk.
+	lastKeys [][]byte
+
+	current        *SnapshotChunkLeaf
+	currentLastKey []byte
+	nextOrdinal    uint64
+}
+
+func (builder *snapshotChunkLeafBuilder) addEntry(prefix []byte, entry *DBEntry) {
+	if builder.current == nil {
+		builder.current = &SnapshotChunkLeaf{
+			Index:   uint64(len(builder.leaves)),
+			Prefix:  prefix,
+			Ordinal: builder.nextOrdinal,
+		}
+		builder.nextOrdinal++
+	}
+	builder.current.NumEntries++
+	builder.current.Digest = UpdateHyperSyncPrefixDigest(builder.current.Digest, []*DBEntry{entry})
+	builder.currentLastKey = entry.Key
+	if builder.current.NumEntries == SnapshotChunkCommitmentBucketSize {
+		builder.pushCurrent()
+	}
+}
+
+func (builder *snapshotChunkLeafBuilder) pushCurrent() {
+	builder.leaves = append(builder.leaves, builder.current)
+	builder.lastKeys = append(builder.lastKeys, builder.currentLastKey)
+	builder.current = nil
+	builder.currentLastKey = nil
+}
+
+func (builder *snapshotChunkLeafBuilder) finishPrefix() {
+	if builder.current != nil {
+		builder.pushCurrent()
+	}
+	if builder.nextOrdinal > 0 {
+		builder.leaves[len(builder.leaves)-1].IsLast = true
+	}
+	builder.nextOrdinal = 0
+}
+
+// snapshotChunkTree is the tree a node serving snapshots computed for the snapshot at a height.
+type snapshotChunkTree struct {
+	snapshotBlockHeight uint64
+	snapshotBlockHash   *BlockHash
+
+	leaves     []*SnapshotChunkLeaf
+	lastKeys   [][]byte
+	paths      [][]*merkletree.ProofPart
+	commitment *SnapshotChunkCommitment
+}
+
+func newSnapshotChunkTree(snapshotBlockHeight uint64, snapshotBlockHash *BlockHash,
+	leaves []*SnapshotChunkLeaf, lastKeys [][]byte) (*snapshotChunkTree, error) {
+
+	tree := &snapshotChunkTree{
+		snapshotBlockHeight: snapshotBlockHeight,
+		snapshotBlockHash:   snapshotBlockHash,
+		leaves:              leaves,
+		lastKeys:            lastKeys,
+		commitment: &SnapshotChunkCommitment{
+			Root:      ZeroBlockHash.NewBlockHash(),
+			NumLeaves: uint64(len(leaves)),
+		},
+	}
+	if len(leaves) == 0 {
+		return tree, nil
+	}
+
+	var leafHashes [][]byte
+	for _, leaf := range leaves {
+		leafHashes = append(leafHashes, leaf.Hash())
+	}
+	merkleTree := merkletree.NewTreeFromHashes(merkletree.Sha256DoubleHash, leafHashes)
+	copy(tree.commitment.Root[:], merkleTree.Root.GetHash())
+	for ii, leafHash := range leafHashes {
+		proof, err := merkleTree.CreateProof(leafHash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "newSnapshotChunkTree: Problem creating proof for leaf %d", ii)
+		}
+		tree.paths = append(tree.paths, proof.PathToRoot)
+	}
+	return tree, nil
+}
+
+// getProofs returns the proofs a peer needs to verify the chunk of the prefix that starts at
+// startKey: the leaves that end in the chunk, the prefix's last leaf if the chunk is its last,
+// the leaf before the prefix's first leaf, and, if the prefix is empty, the leaves around it.
+func (tree *snapshotChunkTree) getProofs(prefix []byte, startKey []byte, chunk []*DBEntry,
+	chunkFull bool) []*SnapshotChunkProof {
+
+	// Find the prefix's leaves, which are sorted by prefix.
+	startIndex := len(tree.leaves)
+	endIndex := len(tree.leaves)
+	for ii, leaf := range tree.leaves {
+		comparison := bytes.Compare(leaf.Prefix, prefix)
+		if comparison >= 0 && startIndex == len(tree.leaves) {
+			startIndex = ii
+		}
+		if comparison > 0 {
+			endIndex = ii
+			break
+		}
+	}
+
+	var indices []int
+	includeLeaf := func(index int) {
+		if len(indices) > 0 && indices[len(indices)-1] >= index {
+			return
+		}
+		if index == startIndex && index > 0 {
+			indices = append(indices, index-1)
+		}
+		indices = append(indices, index)
+	}
+	if len(chunk) > 0 && !chunk[0].IsEmpty() {
+		// Every chunk after the first starts with the last entry of the previous one, which
+		// was already accounted for.
+		isFirstChunk := bytes.Equal(startKey, prefix)
+		lastChunkKey := chunk[len(chunk)-1].Key
+		for ii := startIndex; ii < endIndex; ii++ {
+			if !isFirstChunk && bytes.Compare(tree.lastKeys[ii], startKey) <= 0 {
+				continue
+			}
+			if bytes.Compare(tree.lastKeys[ii], lastChunkKey) > 0 {
+				break
+			}
+			includeLeaf(ii)
+		}
+	}
+	if !chunkFull && startIndex < endIndex {
+		// The prefix's last bucket may have ended in an earlier chunk, but it's only checked
+		// once the prefix is complete.
+		includeLeaf(endIndex - 1)
+	} else if !chunkFull {
+		if startIndex > 0 {
+			indices = append(indices, startIndex-1)
+		}
+		if startIndex < len(tree.leaves) {
+			indices = append(indices, startIndex)
+		}
+	}
+
+	var proofs []*SnapshotChunkProof
+	for _, index := range indices {
+		proofs = append(proofs, &SnapshotChunkProof{
+			Leaf: tree.leaves[index],
+			Path: tree.paths[index],
+		})
+	}
+	return proofs
+}
+
+// ComputeSnapshotChunkTree reads the snapshot described by the metadata and computes its
+// tree. It fails if the node enters a new snapshot epoch before every chunk has been read.
+func (snap *Snapshot) ComputeSnapshotChunkTree(metadata *SnapshotEpochMetadata) (*snapshotChunkTree, error) {
+	builder := &snapshotChunkLeafBuilder{}
+	// The leaves are sorted by prefix, so the prefixes are read in order.
+	prefixes := make([][]byte, len(StatePrefixes.StatePrefixesList))
+	copy(prefixes, StatePrefixes.StatePrefixesList)
+	sort.Slice(prefixes, func(ii, jj int) bool {
+		return bytes.Compare(prefixes[ii], prefixes[jj]) < 0
+	})
+
+	for _, prefix := range prefixes {
+		startKey := prefix
+		for index := 0; ; index++ {
+			chunk, chunkFull, err := snap.GetSnapshotChunk(prefix, startKey)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ComputeSnapshotChunkTree: Problem getting chunk %d of prefix %v: ",
+					index, prefix)
+			}
+			// GetSnapshotChunk reads the current epoch, so make sure it's still ours.
+			if snap.GetEpochMetadataCopy().SnapshotBlockHeight != metadata.SnapshotBlockHeight {
+				return nil, fmt.Errorf("ComputeSnapshotChunkTree: The node entered a new snapshot epoch")
+			}
+
+			// Every chunk after the first starts with the last entry of the previous one.
+			for ii, dbEntry := range chunk {
+				if dbEntry.IsEmpty() || (index > 0 && ii == 0) {
+					continue
+				}
+				builder.addEntry(prefix, dbEntry)
+			}
+			if !chunkFull {
+				break
+			}
+			startKey = chunk[len(chunk)-1].Key
+		}
+		builder.finishPrefix()
+	}
+	return newSnapshotChunkTree(metadata.SnapshotBlockHeight, metadata.CurrentEpochBlockHash,
+		builder.leaves, builder.lastKeys)
+}
+
+// GetSnapshotChunkProofs returns the commitment for the snapshot at the given height along
+// with the proofs for a chunk of it. It returns a nil commitment if the node doesn't have a
+// tree for the snapshot yet.
+func (snap *Snapshot) GetSnapshotChunkProofs(snapshotBlockHeight uint64, prefix []byte, startKey []byte,
+	chunk []*DBEntry, chunkFull bool) (*SnapshotChunkCommitment, []*SnapshotChunkProof) {
+
+	snap.chunkTreeMtx.RLock()
+	tree := snap.chunkTree
+	snap.chunkTreeMtx.RUnlock()
+
+	if tree == nil || tree.snapshotBlockHeight != snapshotBlockHeight {
+		return nil, nil
+	}
+	return tree.commitment, tree.getProofs(prefix, startKey, chunk, chunkFull)
+}
+
+// ==================================================================
+// Verifying chunks
+// ==================================================================
+
+// SnapshotChunkVerifier checks the chunks of a prefix against the commitment as they're
+// received. It's kept in the prefix's SyncPrefixProgress.
+type SnapshotChunkVerifier struct {
+	Commitment *SnapshotChunkCommitment
+
+	// HasFirstLeaf is set once the prefix's first leaf has been found, after which
+	// NextLeafIndex is the index of the leaf for the current bucket.
+	HasFirstLeaf  bool
+	NextLeafIndex uint64
+	// PrefixDone is set once the prefix's last leaf has been verified.
+	PrefixDone bool
+
+	// NumBuckets is the number of buckets verified so far, and BucketNumEntries and
+	// BucketDigest cover the entries of the current bucket.
+	NumBuckets       uint64
+	BucketNumEntries uint64
+	BucketDigest     []byte
+}
+
+func NewSnapshotChunkVerifier(commitment *SnapshotChunkCommitment) *SnapshotChunkVerifier {
+	return &SnapshotChunkVerifier{
+		Commitment: commitment,
+	}
+}
+
+// VerifyChunk checks the entries received for the prefix, excluding the entry repeated from the
+// previous chunk. prefixCompleted is set if the chunk is the prefix's last. It returns the
+// verifier's state after the chunk, and leaves the verifier unchanged, so that the chunk can
+// be requested again from another peer if it fails.
+func (verifier *SnapshotChunkVerifier) VerifyChunk(prefix []byte, entries []*DBEntry, prefixCompleted bool,
+	proofs []*SnapshotChunkProof) (*SnapshotChunkVerifier, error) {
+
+	next := *verifier
+	leavesByIndex := make(map[uint64]*SnapshotChunkLeaf)
+	for _, proof := range proofs {
+		if proof == nil || !proof.Verify(verifier.Commitment) {
+			return nil, fmt.Errorf("VerifyChunk: Invalid proof for prefix (%v)", prefix)
+		}
+		leavesByIndex[proof.Leaf.Index] = proof.Leaf
+	}
+
+	completeBucket := func() error {
+		var leaf *SnapshotChunkLeaf
+		if !next.HasFirstLeaf {
+			for _, proofLeaf := range leavesByIndex {
+				if bytes.Equal(proofLeaf.Prefix, prefix) && proofLeaf.Ordinal == 0 {
+					leaf = proofLeaf
+				}
+			}
+			if leaf == nil {
+				return fmt.Errorf("missing the first leaf")
+			}
+			// The leaf before the prefix's first leaf has to belong to an earlier prefix.
+			if leaf.Index > 0 {
+				previousLeaf := leavesByIndex[leaf.Index-1]
+				if previousLeaf == nil || bytes.Compare(previousLeaf.Prefix, prefix) >= 0 {
+					return fmt.Errorf("first leaf (%v) isn't proven to be the first", leaf.Index)
+				}
+			}
+			next.HasFirstLeaf = true
+			next.NextLeafIndex = leaf.Index
+		} else {
+			leaf = leavesByIndex[next.NextLeafIndex]
+			if leaf == nil {
+				return fmt.Errorf("missing leaf (%v)", next.NextLeafIndex)
+			}
+		}
+		if !bytes.Equal(leaf.Prefix, prefix) || leaf.Ordinal != next.NumBuckets ||
+			leaf.NumEntries != next.BucketNumEntries || !bytes.Equal(leaf.Digest, next.BucketDigest) {
+			return fmt.Errorf("bucket (%v) with (%v) entries doesn't match leaf (%v)",
+				next.NumBuckets, next.BucketNumEntries, leaf.Index)
+		}
+		next.NextLeafIndex++
+		next.NumBuckets++
+		next.BucketNumEntries = 0
+		next.BucketDigest = nil
+		next.PrefixDone = leaf.IsLast
+		return nil
+	}
+
+	for _, entry := range entries {
+		if next.PrefixDone {
+			return nil, fmt.Errorf("VerifyChunk: Received entries after the last leaf of prefix (%v)", prefix)
+		}
+		next.BucketNumEntries++
+		next.BucketDigest = UpdateHyperSyncPrefixDigest(next.BucketDigest, []*DBEntry{entry})
+		if next.BucketNumEntries == SnapshotChunkCommitmentBucketSize {
+			if err := completeBucket(); err != nil {
+				return nil, errors.Wrapf(err, "VerifyChunk: Prefix (%v)", prefix)
+			}
+		}
+	}
+	if !prefixCompleted {
+		return &next, nil
+	}
+
+	if next.BucketNumEntries > 0 {
+		if err := completeBucket(); err != nil {
+			return nil, errors.Wrapf(err, "VerifyChunk: Prefix (%v)", prefix)
+		}
+	}
+	if next.HasFirstLeaf {
+		if !next.PrefixDone {
+			return nil, fmt.Errorf("VerifyChunk: Prefix (%v) ended before its last leaf", prefix)
+		}
+		return &next, nil
+	}
+
+	// If the prefix is empty, the leaves around it have to be adjacent.
+	var leafBefore, leafAfter *SnapshotChunkLeaf
+	for _, leaf := range leavesByIndex {
+		comparison := bytes.Compare(leaf.Prefix, prefix)
+		if comparison == 0 {
+			return nil, fmt.Errorf("VerifyChunk: Prefix (%v) is empty but has leaf (%v)", prefix, leaf.Index)
+		}
+		if comparison < 0 && (leafBefore == nil || leaf.Index > leafBefore.Index) {
+			leafBefore = leaf
+		}
+		if comparison > 0 && (leafAfter == nil || leaf.Index < leafAfter.Index) {
+			leafAfter = leaf
+		}
+	}
+	isEmpty := false
+	switch {
+	case leafBefore == nil && leafAfter == nil:
+		isEmpty = verifier.Commitment.NumLeaves == 0
+	case leafBefore == nil:
+		isEmpty = leafAfter.Index == 0
+	case leafAfter == nil:
+		isEmpty = leafBefore.Index == verifier.Commitment.NumLeaves-1
+	default:
+		isEmpty = leafAfter.Index == leafBefore.Index+1
+	}
+	if !isEmpty {
+		return nil, fmt.Errorf("VerifyChunk: Prefix (%v) isn't proven to be empty", prefix)
+	}
+	next.PrefixDone = true
+	return &next, nil
+}
+
+func (verifier *SnapshotChunkVerifier) ToBytes() []byte {
+	var data []byte
+	data = append(data, verifier.Commitment.ToBytes()...)
+	data = append(data, BoolToByte(verifier.HasFirstLeaf))
+	data = append(data, UintToBuf(verifier.NextLeafIndex)...)
+	data = append(data, BoolToByte(verifier.PrefixDone))
+	data = append(data, UintToBuf(verifier.NumBuckets)...)
+	data = append(data, UintToBuf(verifier.BucketNumEntries)...)
+	data = append(data, EncodeByteArray(verifier.BucketDigest)...)
+	return data
+}
+
+func (verifier *SnapshotChunkVerifier) FromBytes(rr *bytes.Reader) error {
+	var err error
+	verifier.Commitment = &SnapshotChunkCommitment{}
+	if err = verifier.Commitment.FromBytes(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkVerifier.FromBytes: ")
+	}
+	if verifier.HasFirstLeaf, err = ReadBoolByte(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkVerifier.FromBytes: Problem reading HasFirstLeaf")
+	}
+	if verifier.NextLeafIndex, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkVerifier.FromBytes: Problem reading NextLeafIndex")
+	}
+	if verifier.PrefixDone, err = ReadBoolByte(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkVerifier.FromBytes: Problem reading PrefixDone")
+	}
+	if verifier.NumBuckets, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkVerifier.FromBytes: Problem reading NumBuckets")
+	}
+	if verifier.BucketNumEntries, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkVerifier.FromBytes: Problem reading BucketNumEntries")
+	}
+	if verifier.BucketDigest, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotChunkVerifier.FromBytes: Problem reading BucketDigest")
+	}
+	return nil
+}
+
+// ==================================================================
+// SnapshotChunkCommitter
+// ==================================================================
+
+// SnapshotChunkCommitter computes the tree for each snapshot epoch the node completes, so that
+// the node can send proofs along with the chunks it serves.
+type SnapshotChunkCommitter struct {
+	snapshot *Snapshot
+	interval time.Duration
+
+	stopChannel chan struct{}
+	waitGroup   sync.WaitGroup
+}
+
+func NewSnapshotChunkCommitter(snapshot *Snapshot) *SnapshotChunkCommitter {
+	return &SnapshotChunkCommitter{
+		snapshot:    snapshot,
+		interval:    DefaultSnapshotChunkCommitterIntervalSeconds * time.Second,
+		stopChannel: make(chan struct{}),
+	}
+}
+
+func (committer *SnapshotChunkCommitter) Start() {
+	committer.waitGroup.Add(1)
+	go func() {
+		defer committer.waitGroup.Done()
+		for {
+			committer.commitIfNewEpoch()
+			select {
+			case <-committer.stopChannel:
+				return
+			case <-time.After(committer.interval):
+			}
+		}
+	}()
+}
+
+func (committer *SnapshotChunkCommitter) Stop() {
+	close(committer.stopChannel)
+	committer.waitGroup.Wait()
+}
+
+func (committer *SnapshotChunkCommitter) commitIfNewEpoch() {
+	snap := committer.snapshot
+	metadata := snap.GetEpochMetadataCopy()
+	// The checksum is set once the node has the complete state at the snapshot height.
+	if metadata.SnapshotBlockHeight == 0 || len(metadata.CurrentEpochChecksumBytes) == 0 {
+		return
+	}
+	snap.chunkTreeMtx.RLock()
+	tree := snap.chunkTree
+	snap.chunkTreeMtx.RUnlock()
+	if tree != nil && tree.snapshotBlockHeight == metadata.SnapshotBlockHeight {
+		return
+	}
+
+	// The tree is saved, so that it's only computed once per epoch.
+	tree, err := DBGetSnapshotChunkTree(snap.mainDb)
+	if err != nil {
+		glog.Errorf("SnapshotChunkCommitter: Problem reading the tree from the db: %v", err)
+	}
+	if tree == nil || tree.snapshotBlockHeight != metadata.SnapshotBlockHeight ||
+		!tree.snapshotBlockHash.IsEqual(metadata.CurrentEpochBlockHash) {
+
+		glog.Infof("SnapshotChunkCommitter: Computing the tree for the snapshot at height %d",
+			metadata.SnapshotBlockHeight)
+		if tree, err = snap.ComputeSnapshotChunkTree(metadata); err != nil {
+			// The next check retries the epoch, unless the node has moved on to a new one.
+			glog.Errorf("SnapshotChunkCommitter: Problem computing the tree for the snapshot at height %d: %v",
+				metadata.SnapshotBlockHeight, err)
+			return
+		}
+		snap.SnapshotDbMutex.Lock()
+		err = DBPutSnapshotChunkTree(snap.mainDb, tree)
+		snap.SnapshotDbMutex.Unlock()
+		if err != nil {
+			glog.Errorf("SnapshotChunkCommitter: Problem saving the tree: %v", err)
+		}
+	}
+
+	snap.chunkTreeMtx.Lock()
+	snap.chunkTree = tree
+	snap.chunkTreeMtx.Unlock()
+	glog.Infof("SnapshotChunkCommitter: Committed to the snapshot at height %d with %d leaves and root %v",
+		tree.snapshotBlockHeight, tree.commitment.NumLeaves, tree.commitment.Root)
+}
+
+// ==================================================================
+// DB
+// ==================================================================
+
+// DBGetSnapshotChunkTree returns the saved tree, or nil if there isn't one.
+func DBGetSnapshotChunkTree(handle *badger.DB) (*snapshotChunkTree, error) {
+	var treeBytes []byte
+	err := handle.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(getMainDbPrefix(_prefixSnapshotChunkTree))
+		if err != nil {
+			return err
+		}
+		treeBytes, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSnapshotChunkTree: ")
+	}
+
+	rr := bytes.NewReader(treeBytes)
+	snapshotBlockHeight, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSnapshotChunkTree: Problem reading height")
+	}
+	snapshotBlockHashBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSnapshotChunkTree: Problem reading hash")
+	}
+	numLeaves, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSnapshotChunkTree: Problem reading number of leaves")
+	}
+	var leaves []*SnapshotChunkLeaf
+	var lastKeys [][]byte
+	for ii := uint64(0); ii < numLeaves; ii++ {
+		leaf := &SnapshotChunkLeaf{}
+		if err = leaf.FromBytes(rr); err != nil {
+			return nil, errors.Wrapf(err, "DBGetSnapshotChunkTree: ")
+		}
+		lastKey, err := DecodeByteArray(rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetSnapshotChunkTree: Problem reading last key")
+		}
+		leaves = append(leaves, leaf)
+		lastKeys = append(lastKeys, lastKey)
+	}
+	return newSnapshotChunkTree(snapshotBlockHeight, NewBlockHash(snapshotBlockHashBytes), leaves, lastKeys)
+}
+
+func DBPutSnapshotChunkTree(handle *badger.DB, tree *snapshotChunkTree) error {
+	var data []byte
+	data = append(data, UintToBuf(tree.snapshotBlockHeight)...)
+	data = append(data, EncodeByteArray(tree.snapshotBlockHash.ToBytes())...)
+	data = append(data, UintToBuf(uint64(len(tree.leaves)))...)
+	for ii, leaf := range tree.leaves {
+		data = append(data, leaf.ToBytes()...)
+		data = append(data, EncodeByteArray(tree.lastKeys[ii])...)
+	}
+	return handle.Update(func(txn *badger.Txn) error {
+		return txn.Set(getMainDbPrefix(_prefixSnapshotChunkTree), data)
+	})
+}
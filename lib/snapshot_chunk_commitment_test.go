@@ -0,0 +1,219 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSnapshotChunk struct {
+	startKey []byte
+	chunk    []*DBEntry
+	full     bool
+}
+
+// makeTestSnapshotChunks splits a prefix's entries into chunks the way GetSnapshotChunk does.
+// If exhaustAtBoundary is set, the last chunk with entries is reported as full and is followed
+// by an empty chunk.
+func makeTestSnapshotChunks(prefix []byte, entries []*DBEntry, chunkSize int,
+	exhaustAtBoundary bool) []*testSnapshotChunk {
+
+	if len(entries) == 0 {
+		return []*testSnapshotChunk{{startKey: prefix, chunk: []*DBEntry{EmptyDBEntry()}}}
+	}
+	var chunks []*testSnapshotChunk
+	startKey := prefix
+	for index := 0; index < len(entries); {
+		end := index + chunkSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		chunk := entries[index:end]
+		if index > 0 {
+			chunk = entries[index-1 : end]
+		}
+		chunks = append(chunks, &testSnapshotChunk{
+			startKey: startKey,
+			chunk:    chunk,
+			full:     end < len(entries) || exhaustAtBoundary,
+		})
+		startKey = entries[end-1].Key
+		index = end
+	}
+	if exhaustAtBoundary {
+		chunks = append(chunks, &testSnapshotChunk{startKey: startKey, chunk: []*DBEntry{EmptyDBEntry()}})
+	}
+	return chunks
+}
+
+// verifyTestSnapshotChunks runs the chunks through a verifier, getting the proofs for each
+// chunk from the tree.
+func verifyTestSnapshotChunks(tree *snapshotChunkTree, prefix []byte, chunks []*testSnapshotChunk) error {
+	verifier := NewSnapshotChunkVerifier(tree.commitment)
+	for _, chunk := range chunks {
+		var entries []*DBEntry
+		if !chunk.chunk[0].IsEmpty() {
+			entries = chunk.chunk
+			if !bytes.Equal(chunk.startKey, prefix) {
+				entries = chunk.chunk[1:]
+			}
+		}
+		proofs := tree.getProofs(prefix, chunk.startKey, chunk.chunk, chunk.full)
+		var err error
+		if verifier, err = verifier.VerifyChunk(prefix, entries, !chunk.full, proofs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSnapshotChunkCommitment(t *testing.T) {
+	require := require.New(t)
+
+	largePrefix := []byte{10}
+	emptyPrefix := []byte{11}
+	smallPrefix := []byte{12}
+	makeEntries := func(prefix []byte, numEntries int) []*DBEntry {
+		var entries []*DBEntry
+		for ii := 0; ii < numEntries; ii++ {
+			key := append(append([]byte{}, prefix...), EncodeUint64(uint64(ii))...)
+			entries = append(entries, &DBEntry{Key: key, Value: EncodeUint64(uint64(ii) * 7)})
+		}
+		return entries
+	}
+	entriesByPrefix := map[byte][]*DBEntry{
+		largePrefix[0]: makeEntries(largePrefix, 2*SnapshotChunkCommitmentBucketSize+5000),
+		emptyPrefix[0]: nil,
+		smallPrefix[0]: makeEntries(smallPrefix, 3),
+	}
+
+	builder := &snapshotChunkLeafBuilder{}
+	for _, prefix := range [][]byte{largePrefix, emptyPrefix, smallPrefix} {
+		for _, entry := range entriesByPrefix[prefix[0]] {
+			builder.addEntry(prefix, entry)
+		}
+		builder.finishPrefix()
+	}
+	tree, err := newSnapshotChunkTree(1000, NewBlockHash(RandomBytes(HashSizeBytes)), builder.leaves, builder.lastKeys)
+	require.NoError(err)
+	require.Equal(uint64(4), tree.commitment.NumLeaves)
+	require.True(tree.leaves[2].IsLast)
+	require.Equal(uint64(5000), tree.leaves[2].NumEntries)
+	require.True(tree.leaves[3].IsLast)
+
+	// Every prefix verifies, whether its buckets span chunks or not.
+	for _, prefix := range [][]byte{largePrefix, emptyPrefix, smallPrefix} {
+		for _, chunkSize := range []int{7000, 5000, 30000} {
+			for _, exhaustAtBoundary := range []bool{false, true} {
+				chunks := makeTestSnapshotChunks(prefix, entriesByPrefix[prefix[0]], chunkSize, exhaustAtBoundary)
+				require.NoError(verifyTestSnapshotChunks(tree, prefix, chunks))
+			}
+		}
+	}
+
+	// A chunk with a tampered entry fails.
+	tamperedEntries := makeEntries(largePrefix, len(entriesByPrefix[largePrefix[0]]))
+	tamperedEntries[12345].Value = []byte{1}
+	require.Error(verifyTestSnapshotChunks(tree, largePrefix,
+		makeTestSnapshotChunks(largePrefix, tamperedEntries, 7000, false)))
+
+	// Skipping a bucket fails.
+	skippedEntries := append(append([]*DBEntry{}, entriesByPrefix[largePrefix[0]][:SnapshotChunkCommitmentBucketSize]...),
+		entriesByPrefix[largePrefix[0]][2*SnapshotChunkCommitmentBucketSize:]...)
+	require.Error(verifyTestSnapshotChunks(tree, largePrefix,
+		makeTestSnapshotChunks(largePrefix, skippedEntries, 7000, false)))
+
+	// Cutting a prefix short fails, even at the end of a bucket.
+	for _, numEntries := range []int{SnapshotChunkCommitmentBucketSize + 10, 2 * SnapshotChunkCommitmentBucketSize} {
+		require.Error(verifyTestSnapshotChunks(tree, largePrefix,
+			makeTestSnapshotChunks(largePrefix, entriesByPrefix[largePrefix[0]][:numEntries], 7000, false)))
+	}
+
+	// Claiming a prefix with entries is empty fails, with either its own proofs or the proofs
+	// of an empty prefix.
+	emptyChunk := []*DBEntry{EmptyDBEntry()}
+	verifier := NewSnapshotChunkVerifier(tree.commitment)
+	_, err = verifier.VerifyChunk(smallPrefix, nil, true, tree.getProofs(smallPrefix, smallPrefix, emptyChunk, false))
+	require.Error(err)
+	_, err = verifier.VerifyChunk(smallPrefix, nil, true, tree.getProofs(emptyPrefix, emptyPrefix, emptyChunk, false))
+	require.Error(err)
+	_, err = verifier.VerifyChunk(smallPrefix, nil, true, nil)
+	require.Error(err)
+
+	// A proof for a leaf that isn't in the tree fails.
+	forgedProof := tree.getProofs(smallPrefix, smallPrefix, entriesByPrefix[smallPrefix[0]], false)[1]
+	require.True(forgedProof.Verify(tree.commitment))
+	forgedLeaf := *forgedProof.Leaf
+	forgedLeaf.NumEntries++
+	require.False((&SnapshotChunkProof{Leaf: &forgedLeaf, Path: forgedProof.Path}).Verify(tree.commitment))
+
+	// The verifier round-trips through its encoding in the middle of a prefix.
+	chunks := makeTestSnapshotChunks(largePrefix, entriesByPrefix[largePrefix[0]], 7000, false)
+	verifier, err = NewSnapshotChunkVerifier(tree.commitment).VerifyChunk(largePrefix, chunks[0].chunk, false,
+		tree.getProofs(largePrefix, largePrefix, chunks[0].chunk, true))
+	require.NoError(err)
+	decodedVerifier := &SnapshotChunkVerifier{}
+	require.NoError(decodedVerifier.FromBytes(bytes.NewReader(verifier.ToBytes())))
+	require.Equal(verifier.ToBytes(), decodedVerifier.ToBytes())
+
+	// The tree round-trips through the DB.
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	loadedTree, err := DBGetSnapshotChunkTree(db)
+	require.NoError(err)
+	require.Nil(loadedTree)
+	require.NoError(DBPutSnapshotChunkTree(db, tree))
+	loadedTree, err = DBGetSnapshotChunkTree(db)
+	require.NoError(err)
+	require.True(tree.commitment.Equal(loadedTree.commitment))
+	require.Equal(tree.lastKeys, loadedTree.lastKeys)
+	require.True(tree.snapshotBlockHash.IsEqual(loadedTree.snapshotBlockHash))
+}
+
+func TestSnapshotDataMsgChunkProofs(t *testing.T) {
+	require := require.New(t)
+
+	prefix := []byte{12}
+	entries := []*DBEntry{{Key: []byte{12, 1}, Value: []byte{1}}, {Key: []byte{12, 2}, Value: []byte{2}}}
+	builder := &snapshotChunkLeafBuilder{}
+	for _, entry := range entries {
+		builder.addEntry(prefix, entry)
+	}
+	builder.finishPrefix()
+	tree, err := newSnapshotChunkTree(1000, NewBlockHash(RandomBytes(HashSizeBytes)), builder.leaves, builder.lastKeys)
+	require.NoError(err)
+
+	msg := &MsgDeSoSnapshotData{
+		SnapshotMetadata: &SnapshotEpochMetadata{
+			SnapshotBlockHeight:       1000,
+			CurrentEpochChecksumBytes: []byte{1, 2, 3},
+			CurrentEpochBlockHash:     tree.snapshotBlockHash,
+		},
+		SnapshotChunk:     entries,
+		SnapshotChunkFull: false,
+		Prefix:            prefix,
+	}
+
+	// Without a commitment, the message is encoded as before.
+	msgBytes, err := msg.ToBytes(false)
+	require.NoError(err)
+	decodedMsg := &MsgDeSoSnapshotData{}
+	require.NoError(decodedMsg.FromBytes(msgBytes))
+	require.Nil(decodedMsg.SnapshotMetadata.ChunkCommitment)
+	require.Empty(decodedMsg.ChunkProofs)
+
+	msg.SnapshotMetadata.ChunkCommitment = tree.commitment
+	msg.ChunkProofs = tree.getProofs(prefix, prefix, entries, false)
+	msgBytes, err = msg.ToBytes(false)
+	require.NoError(err)
+	decodedMsg = &MsgDeSoSnapshotData{}
+	require.NoError(decodedMsg.FromBytes(msgBytes))
+	require.True(tree.commitment.Equal(decodedMsg.SnapshotMetadata.ChunkCommitment))
+	require.Len(decodedMsg.ChunkProofs, 1)
+	_, err = NewSnapshotChunkVerifier(decodedMsg.SnapshotMetadata.ChunkCommitment).VerifyChunk(
+		prefix, decodedMsg.SnapshotChunk, true, decodedMsg.ChunkProofs)
+	require.NoError(err)
+}
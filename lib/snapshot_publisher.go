@@ -0,0 +1,344 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// The SnapshotPublisher uploads each snapshot epoch the node completes to S3-compatible object
+// storage, so that operators can hypersync from a CDN in front of the bucket rather than from
+// a handful of public nodes. A snapshot is published as:
+//
+//	<KeyPrefix>/<network>/<height>/chunks/<prefix hex>/<index>	one object per snapshot chunk
+//	<KeyPrefix>/<network>/<height>/manifest.json			the SnapshotManifest
+//	<KeyPrefix>/<network>/latest.json				a copy of the latest manifest
+//
+// Each chunk object holds the encoded MsgDeSoSnapshotData a peer would have sent for the same
+// GetSnapshot request, so chunks can be fed to the existing hypersync code unchanged. Chunks of
+// the same prefix overlap by one entry, just like the chunks peers send.
+//
+// Before a manifest is uploaded, the publisher recomputes the state checksum from the chunks it
+// uploaded and checks it against the epoch's checksum, so a manifest is only ever published for
+// a complete and verified snapshot. The manifest records the SHA-256 of every chunk so that
+// downloaders can verify chunks independently of the storage provider.
+
+const DefaultSnapshotPublisherIntervalSeconds = 60
+
+// SnapshotManifest describes a published snapshot.
+type SnapshotManifest struct {
+	NetworkType         string
+	SnapshotBlockHeight uint64
+	SnapshotBlockHash   string
+	// StateChecksum is the hex-encoded state checksum of the snapshot.
+	StateChecksum string
+	Chunks        []*SnapshotManifestChunk
+	TimestampSecs uint64
+}
+
+// SnapshotManifestChunk describes a published snapshot chunk.
+type SnapshotManifestChunk struct {
+	// ObjectKey is the key of the chunk's object in the bucket.
+	ObjectKey string
+	// Prefix is the hex-encoded db prefix of the chunk.
+	Prefix string
+	// Index is the position of the chunk among its prefix's chunks.
+	Index      uint64
+	NumEntries uint64
+	SizeBytes  uint64
+	// SHA256 is the hex-encoded SHA-256 of the chunk's object.
+	SHA256 string
+}
+
+// SnapshotObjectStore is the object storage the SnapshotPublisher uploads to.
+type SnapshotObjectStore interface {
+	PutObject(key string, data []byte) error
+}
+
+// S3ObjectStoreConfig configures an S3ObjectStore.
+type S3ObjectStoreConfig struct {
+	// Endpoint is the base URL of the storage service, e.g. https://s3.us-east-1.amazonaws.com.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3ObjectStore uploads objects to an S3-compatible service using path-style URLs and AWS
+// Signature Version 4. The payload's SHA-256 is signed, so the service rejects an object that
+// was corrupted in transit.
+type S3ObjectStore struct {
+	config     S3ObjectStoreConfig
+	endpoint   *url.URL
+	httpClient *http.Client
+}
+
+func NewS3ObjectStore(config S3ObjectStoreConfig) (*S3ObjectStore, error) {
+	endpoint, err := url.ParseRequestURI(config.Endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewS3ObjectStore: Problem parsing endpoint %v: ", config.Endpoint)
+	}
+	if config.Region == "" || config.Bucket == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("NewS3ObjectStore: Region, Bucket, AccessKeyID, and SecretAccessKey are required")
+	}
+	return &S3ObjectStore{
+		config:     config,
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (store *S3ObjectStore) PutObject(key string, data []byte) error {
+	payloadHash := sha256.Sum256(data)
+	objectURL := *store.endpoint
+	objectURL.Path = strings.TrimRight(objectURL.Path, "/") + "/" + store.config.Bucket + "/" + key
+	req, err := http.NewRequest("PUT", objectURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapf(err, "S3ObjectStore.PutObject: Problem creating request for %v: ", key)
+	}
+	store.signRequest(req, hex.EncodeToString(payloadHash[:]), time.Now().UTC())
+
+	resp, err := store.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "S3ObjectStore.PutObject: Problem uploading %v: ", key)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3ObjectStore.PutObject: Uploading %v failed with status %d: %s",
+			key, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// signRequest adds the AWS Signature Version 4 headers to the request.
+func (store *S3ObjectStore) signRequest(req *http.Request, payloadHashHex string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	req.Header.Set("x-amz-content-sha256", payloadHashHex)
+	req.Header.Set("x-amz-date", amzDate)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHashHex + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHashHex,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	credentialScope := dateStamp + "/" + store.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + credentialScope + "\n" +
+		hex.EncodeToString(canonicalRequestHash[:])
+
+	hmacSHA256 := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	signingKey := hmacSHA256([]byte("AWS4"+store.config.SecretAccessKey), dateStamp)
+	signingKey = hmacSHA256(signingKey, store.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		store.config.AccessKeyID, credentialScope, signedHeaders, signature))
+}
+
+// SnapshotPublisher publishes every snapshot epoch the node completes to a SnapshotObjectStore.
+type SnapshotPublisher struct {
+	snapshot  *Snapshot
+	params    *DeSoParams
+	store     SnapshotObjectStore
+	keyPrefix string
+	interval  time.Duration
+
+	// lastPublishedHeight is the height of the last snapshot that was published.
+	lastPublishedHeight uint64
+
+	stopChannel chan struct{}
+	waitGroup   sync.WaitGroup
+}
+
+func NewSnapshotPublisher(snapshot *Snapshot, params *DeSoParams, store SnapshotObjectStore,
+	keyPrefix string, intervalSeconds uint64) (*SnapshotPublisher, error) {
+
+	if snapshot == nil {
+		return nil, errors.New("NewSnapshotPublisher: publishing snapshots requires the snapshot, " +
+			"which is only maintained by hypersync and archival nodes")
+	}
+	if intervalSeconds == 0 {
+		intervalSeconds = DefaultSnapshotPublisherIntervalSeconds
+	}
+	return &SnapshotPublisher{
+		snapshot:    snapshot,
+		params:      params,
+		store:       store,
+		keyPrefix:   strings.Trim(keyPrefix, "/"),
+		interval:    time.Duration(intervalSeconds) * time.Second,
+		stopChannel: make(chan struct{}),
+	}, nil
+}
+
+func (sp *SnapshotPublisher) Start() {
+	glog.Infof("SnapshotPublisher: Checking for new snapshot epochs every %v", sp.interval)
+
+	sp.waitGroup.Add(1)
+	go func() {
+		defer sp.waitGroup.Done()
+		for {
+			sp.publishIfNewEpoch()
+			select {
+			case <-sp.stopChannel:
+				return
+			case <-time.After(sp.interval):
+			}
+		}
+	}()
+}
+
+func (sp *SnapshotPublisher) Stop() {
+	glog.Info("SnapshotPublisher: Stopping")
+	close(sp.stopChannel)
+	sp.waitGroup.Wait()
+}
+
+func (sp *SnapshotPublisher) publishIfNewEpoch() {
+	metadata := sp.snapshot.GetEpochMetadataCopy()
+	if metadata.SnapshotBlockHeight <= sp.lastPublishedHeight || len(metadata.CurrentEpochChecksumBytes) == 0 {
+		return
+	}
+	glog.Infof("SnapshotPublisher: Publishing the snapshot at height %d", metadata.SnapshotBlockHeight)
+	manifest, err := sp.PublishSnapshot(metadata)
+	if err != nil {
+		// The next check retries the epoch, unless the node has moved on to a new one.
+		glog.Errorf("SnapshotPublisher: Problem publishing the snapshot at height %d: %v",
+			metadata.SnapshotBlockHeight, err)
+		return
+	}
+	sp.lastPublishedHeight = metadata.SnapshotBlockHeight
+	glog.Infof("SnapshotPublisher: Published the snapshot at height %d in %d chunks",
+		manifest.SnapshotBlockHeight, len(manifest.Chunks))
+}
+
+func (sp *SnapshotPublisher) objectKey(parts ...string) string {
+	objectKey := strings.Join(append([]string{sp.params.NetworkType.String()}, parts...), "/")
+	if sp.keyPrefix == "" {
+		return objectKey
+	}
+	return sp.keyPrefix + "/" + objectKey
+}
+
+// PublishSnapshot uploads every chunk of the snapshot described by metadata followed by its
+// manifest. It fails without uploading the manifest if the node enters a new snapshot epoch
+// before every chunk has been read, or if the chunks don't match the epoch's checksum.
+func (sp *SnapshotPublisher) PublishSnapshot(metadata *SnapshotEpochMetadata) (*SnapshotManifest, error) {
+	heightStr := fmt.Sprintf("%d", metadata.SnapshotBlockHeight)
+	manifest := &SnapshotManifest{
+		NetworkType:         sp.params.NetworkType.String(),
+		SnapshotBlockHeight: metadata.SnapshotBlockHeight,
+		SnapshotBlockHash:   metadata.CurrentEpochBlockHash.String(),
+		StateChecksum:       hex.EncodeToString(metadata.CurrentEpochChecksumBytes),
+	}
+
+	checksum := &StateChecksum{}
+	if err := checksum.Initialize(nil, nil); err != nil {
+		return nil, errors.Wrapf(err, "PublishSnapshot: Problem initializing checksum: ")
+	}
+	for _, prefix := range StatePrefixes.StatePrefixesList {
+		startKey := prefix
+		for index := uint64(0); ; index++ {
+			chunk, chunkFull, err := sp.snapshot.GetSnapshotChunk(prefix, startKey)
+			if err != nil {
+				return nil, errors.Wrapf(err, "PublishSnapshot: Problem getting chunk %d of prefix %v: ",
+					index, prefix)
+			}
+			// GetSnapshotChunk reads the current epoch, so make sure it's still ours.
+			if sp.snapshot.GetEpochMetadataCopy().SnapshotBlockHeight != metadata.SnapshotBlockHeight {
+				return nil, fmt.Errorf("PublishSnapshot: The node entered a new snapshot epoch")
+			}
+
+			// Every chunk after the first starts with the last entry of the previous one.
+			for ii, dbEntry := range chunk {
+				if dbEntry.IsEmpty() || (index > 0 && ii == 0) {
+					continue
+				}
+				if err = checksum.AddBytes(EncodeKeyAndValueForChecksum(
+					dbEntry.Key, dbEntry.Value, metadata.SnapshotBlockHeight)); err != nil {
+					return nil, errors.Wrapf(err, "PublishSnapshot: Problem adding to checksum: ")
+				}
+			}
+
+			chunkBytes, err := (&MsgDeSoSnapshotData{
+				SnapshotMetadata:  metadata,
+				SnapshotChunk:     chunk,
+				SnapshotChunkFull: chunkFull,
+				Prefix:            prefix,
+			}).ToBytes(false)
+			if err != nil {
+				return nil, errors.Wrapf(err, "PublishSnapshot: Problem encoding chunk: ")
+			}
+			chunkHash := sha256.Sum256(chunkBytes)
+			manifestChunk := &SnapshotManifestChunk{
+				ObjectKey:  sp.objectKey(heightStr, "chunks", hex.EncodeToString(prefix), fmt.Sprintf("%06d", index)),
+				Prefix:     hex.EncodeToString(prefix),
+				Index:      index,
+				NumEntries: uint64(len(chunk)),
+				SizeBytes:  uint64(len(chunkBytes)),
+				SHA256:     hex.EncodeToString(chunkHash[:]),
+			}
+			if err = sp.store.PutObject(manifestChunk.ObjectKey, chunkBytes); err != nil {
+				return nil, errors.Wrapf(err, "PublishSnapshot: ")
+			}
+			manifest.Chunks = append(manifest.Chunks, manifestChunk)
+
+			if !chunkFull {
+				break
+			}
+			startKey = chunk[len(chunk)-1].Key
+		}
+	}
+
+	if err := checksum.Wait(); err != nil {
+		return nil, errors.Wrapf(err, "PublishSnapshot: Problem computing checksum: ")
+	}
+	checksumBytes, err := checksum.ToBytes()
+	if err != nil {
+		return nil, errors.Wrapf(err, "PublishSnapshot: Problem computing checksum: ")
+	}
+	if !reflect.DeepEqual(checksumBytes, metadata.CurrentEpochChecksumBytes) {
+		return nil, fmt.Errorf("PublishSnapshot: The checksum of the chunks %v doesn't match the "+
+			"snapshot's checksum %v", hex.EncodeToString(checksumBytes), manifest.StateChecksum)
+	}
+
+	manifest.TimestampSecs = uint64(time.Now().Unix())
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "PublishSnapshot: Problem encoding manifest: ")
+	}
+	if err = sp.store.PutObject(sp.objectKey(heightStr, "manifest.json"), manifestBytes); err != nil {
+		return nil, errors.Wrapf(err, "PublishSnapshot: ")
+	}
+	if err = sp.store.PutObject(sp.objectKey("latest.json"), manifestBytes); err != nil {
+		return nil, errors.Wrapf(err, "PublishSnapshot: ")
+	}
+	return manifest, nil
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3ObjectStorePutObject(t *testing.T) {
+	require := require.New(t)
+
+	var receivedPath string
+	var receivedBody []byte
+	var receivedHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath = r.URL.Path
+		receivedHeader = r.Header
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	store, err := NewS3ObjectStore(S3ObjectStoreConfig{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "snapshots",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(err)
+
+	data := []byte("snapshot chunk")
+	require.NoError(store.PutObject("deso/mainnet/1000/chunks/05/000000", data))
+	require.Equal("/snapshots/deso/mainnet/1000/chunks/05/000000", receivedPath)
+	require.Equal(data, receivedBody)
+
+	// The payload's hash is signed along with the request.
+	dataHash := sha256.Sum256(data)
+	require.Equal(hex.EncodeToString(dataHash[:]), receivedHeader.Get("x-amz-content-sha256"))
+	authorization := receivedHeader.Get("Authorization")
+	require.True(strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"))
+	require.Contains(authorization, "/us-east-1/s3/aws4_request")
+	require.Contains(authorization, "SignedHeaders=host;x-amz-content-sha256;x-amz-date")
+
+	// Missing credentials are rejected.
+	_, err = NewS3ObjectStore(S3ObjectStoreConfig{Endpoint: server.URL, Region: "us-east-1", Bucket: "snapshots"})
+	require.Error(err)
+}
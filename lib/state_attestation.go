@@ -0,0 +1,179 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// A state attestation is a statement, signed by a node operator's key, that the node's state
+// at a given height had a given checksum and contained a given set of records. Audit firms and
+// bridges can check the signature against a key they trust instead of trusting an API response.
+//
+// The state checksum is a multiset hash over every state record, so a single record can't be
+// proven against it. The records are attested by the operator's signature alongside the
+// checksum, and a consumer that trusts the checksum can compare it with those signed by other
+// operators or with one it computed from a hypersync snapshot.
+
+// StateAttestationRecord is a state record included in a state attestation.
+type StateAttestationRecord struct {
+	Key []byte
+	// Value is nil if the record doesn't exist in the state.
+	Value []byte
+}
+
+// StateAttestation is a signed statement of the node's state at BlockHeight.
+type StateAttestation struct {
+	BlockHeight uint64
+	BlockHash   *BlockHash
+	// ChecksumBytes is the state checksum after the block at BlockHeight was connected.
+	ChecksumBytes     []byte
+	Records           []*StateAttestationRecord
+	TimestampNanoSecs uint64
+
+	SignerPublicKey []byte
+	Signature       []byte
+}
+
+// StateAttestationHash returns the hash an operator signs to attest to a state attestation.
+// A nil record value is hashed differently from an empty one.
+func StateAttestationHash(attestation *StateAttestation) *BlockHash {
+	var data []byte
+	data = append(data, []byte("StateAttestation")...)
+	data = append(data, UintToBuf(attestation.BlockHeight)...)
+	data = append(data, attestation.BlockHash[:]...)
+	data = append(data, EncodeByteArray(attestation.ChecksumBytes)...)
+	data = append(data, UintToBuf(attestation.TimestampNanoSecs)...)
+	data = append(data, UintToBuf(uint64(len(attestation.Records)))...)
+	for _, record := range attestation.Records {
+		data = append(data, EncodeByteArray(record.Key)...)
+		data = append(data, BoolToByte(record.Value != nil))
+		data = append(data, EncodeByteArray(record.Value)...)
+	}
+	return Sha256DoubleHash(data)
+}
+
+// Verify checks that the attestation was signed by SignerPublicKey. It's up to the caller to
+// check that SignerPublicKey belongs to an operator they trust.
+func (attestation *StateAttestation) Verify() error {
+	if attestation.BlockHash == nil {
+		return errors.New("StateAttestation.Verify: missing block hash")
+	}
+	pkObj, err := btcec.ParsePubKey(attestation.SignerPublicKey, btcec.S256())
+	if err != nil {
+		return errors.Wrapf(err, "StateAttestation.Verify: problem parsing signer public key: ")
+	}
+	signature, err := btcec.ParseDERSignature(attestation.Signature, btcec.S256())
+	if err != nil {
+		return errors.Wrapf(err, "StateAttestation.Verify: problem parsing signature: ")
+	}
+	hash := StateAttestationHash(attestation)
+	if !signature.Verify(hash[:], pkObj) {
+		return errors.New("StateAttestation.Verify: invalid signature")
+	}
+	return nil
+}
+
+// GetStateAttestationKeysForPublicKey returns the keys of the records attested for an
+// account: its DESO balance and its profile.
+func GetStateAttestationKeysForPublicKey(txn *badger.Txn, publicKey []byte) [][]byte {
+	keys := [][]byte{_dbKeyForPublicKeyToDeSoBalanceNanos(publicKey)}
+	pkidEntry := DBGetPKIDEntryForPublicKeyWithTxn(txn, nil, publicKey)
+	if pkidEntry != nil && pkidEntry.PKID != nil {
+		keys = append(keys, _dbKeyForPKIDToProfileEntry(pkidEntry.PKID))
+	}
+	return keys
+}
+
+// StateAttestor signs state attestations with the node operator's key. It requires the node's
+// snapshot, since that's what maintains the state checksum.
+type StateAttestor struct {
+	chain      *Blockchain
+	privateKey *btcec.PrivateKey
+}
+
+// NewStateAttestor returns a StateAttestor that signs with the key derived from operatorSeed,
+// which is either a mnemonic or a hex private key prefixed with 0x.
+func NewStateAttestor(chain *Blockchain, operatorSeed string, params *DeSoParams) (*StateAttestor, error) {
+	if chain.Snapshot() == nil {
+		return nil, errors.New("NewStateAttestor: state attestations require the snapshot, " +
+			"which is only maintained by hypersync and archival nodes")
+	}
+	privateKey, err := ParsePrivateKeySeed(operatorSeed, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateAttestor: ")
+	}
+	return &StateAttestor{
+		chain:      chain,
+		privateKey: privateKey,
+	}, nil
+}
+
+// GetSignerPublicKey returns the public key attestations are signed with.
+func (sa *StateAttestor) GetSignerPublicKey() []byte {
+	return sa.privateKey.PubKey().SerializeCompressed()
+}
+
+// CreateStateAttestation signs the state checksum at the committed tip along with the records
+// of the given accounts. Uncommitted blocks aren't flushed, so they aren't part of the checksum.
+func (sa *StateAttestor) CreateStateAttestation(publicKeys [][]byte) (*StateAttestation, error) {
+	for _, publicKey := range publicKeys {
+		if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+			return nil, fmt.Errorf("CreateStateAttestation: invalid public key length %d", len(publicKey))
+		}
+	}
+
+	// Hold the ChainLock so that no block is connected between computing the checksum and
+	// reading the records. Once the snapshot's operations have drained, the checksum covers
+	// every record flushed for the tip.
+	sa.chain.ChainLock.RLock()
+	defer sa.chain.ChainLock.RUnlock()
+
+	snap := sa.chain.Snapshot()
+	snap.WaitForAllOperationsToFinish()
+	checksumBytes, err := snap.Checksum.ToBytes()
+	if err != nil {
+		return nil, errors.Wrapf(err, "CreateStateAttestation: problem getting checksum: ")
+	}
+
+	tipNode, _ := sa.chain.GetCommittedTip()
+	if tipNode == nil {
+		return nil, errors.New("CreateStateAttestation: no committed tip found")
+	}
+	attestation := &StateAttestation{
+		BlockHeight:       uint64(tipNode.Height),
+		BlockHash:         tipNode.Hash.NewBlockHash(),
+		ChecksumBytes:     checksumBytes,
+		TimestampNanoSecs: uint64(time.Now().UnixNano()),
+		SignerPublicKey:   sa.GetSignerPublicKey(),
+	}
+	err = sa.chain.db.View(func(txn *badger.Txn) error {
+		for _, publicKey := range publicKeys {
+			for _, key := range GetStateAttestationKeysForPublicKey(txn, publicKey) {
+				value, err := DBGetWithTxn(txn, nil, key)
+				if err != nil && err != badger.ErrKeyNotFound {
+					return err
+				}
+				attestation.Records = append(attestation.Records, &StateAttestationRecord{
+					Key:   key,
+					Value: value,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "CreateStateAttestation: problem reading records: ")
+	}
+
+	hash := StateAttestationHash(attestation)
+	signature, err := sa.privateKey.Sign(hash[:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "CreateStateAttestation: problem signing attestation: ")
+	}
+	attestation.Signature = signature.Serialize()
+	return attestation, nil
+}
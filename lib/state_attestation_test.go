@@ -0,0 +1,95 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateAttestation(t *testing.T) {
+	require := require.New(t)
+
+	// Balances are only stored as records under the balance model.
+	setBalanceModelBlockHeights(t)
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 3; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+
+	operatorPrivateKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+	attestor, err := NewStateAttestor(chain, "0x"+hex.EncodeToString(operatorPrivateKey.Serialize()), params)
+	require.NoError(err)
+	require.Equal(operatorPrivateKey.PubKey().SerializeCompressed(), attestor.GetSignerPublicKey())
+
+	// Public keys have to be compressed.
+	_, err = attestor.CreateStateAttestation([][]byte{senderPkBytes[:32]})
+	require.Error(err)
+
+	attestation, err := attestor.CreateStateAttestation([][]byte{senderPkBytes, m0PkBytes})
+	require.NoError(err)
+	require.NoError(attestation.Verify())
+	require.Equal(attestor.GetSignerPublicKey(), attestation.SignerPublicKey)
+
+	// The attestation is for the committed tip, and its checksum is the snapshot's.
+	committedTip, _ := chain.GetCommittedTip()
+	require.Equal(uint64(committedTip.Height), attestation.BlockHeight)
+	require.Equal(committedTip.Hash, attestation.BlockHash)
+	chain.Snapshot().WaitForAllOperationsToFinish()
+	checksumBytes, err := chain.Snapshot().Checksum.ToBytes()
+	require.NoError(err)
+	require.Equal(checksumBytes, attestation.ChecksumBytes)
+
+	// Each account has a balance record followed by a profile record. The sender has a balance
+	// but no profile, and m0 has neither. A missing record is attested with a nil value.
+	require.Len(attestation.Records, 4)
+	require.Equal(_dbKeyForPublicKeyToDeSoBalanceNanos(senderPkBytes), attestation.Records[0].Key)
+	require.NoError(chain.db.View(func(txn *badger.Txn) error {
+		senderBalanceBytes, err := DBGetWithTxn(txn, nil, attestation.Records[0].Key)
+		require.NoError(err)
+		require.Equal(senderBalanceBytes, attestation.Records[0].Value)
+		return nil
+	}))
+	require.NotNil(attestation.Records[0].Value)
+	require.Equal(_dbKeyForPKIDToProfileEntry(PublicKeyToPKID(senderPkBytes)), attestation.Records[1].Key)
+	require.Nil(attestation.Records[1].Value)
+	require.Equal(_dbKeyForPublicKeyToDeSoBalanceNanos(m0PkBytes), attestation.Records[2].Key)
+	require.Nil(attestation.Records[2].Value)
+	require.Equal(_dbKeyForPKIDToProfileEntry(PublicKeyToPKID(m0PkBytes)), attestation.Records[3].Key)
+	require.Nil(attestation.Records[3].Value)
+
+	// Changing anything that was signed invalidates the signature.
+	tamperedChecksum := *attestation
+	tamperedChecksum.ChecksumBytes = append([]byte{}, attestation.ChecksumBytes...)
+	tamperedChecksum.ChecksumBytes[0]++
+	require.Error(tamperedChecksum.Verify())
+
+	tamperedRecord := *attestation
+	tamperedRecord.Records = []*StateAttestationRecord{
+		attestation.Records[0],
+		attestation.Records[1],
+		{Key: attestation.Records[2].Key, Value: []byte{}},
+		attestation.Records[3],
+	}
+	require.Error(tamperedRecord.Verify())
+
+	tamperedHeight := *attestation
+	tamperedHeight.BlockHeight++
+	require.Error(tamperedHeight.Verify())
+
+	otherPrivateKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(err)
+	otherSigner := *attestation
+	otherSigner.SignerPublicKey = otherPrivateKey.PubKey().SerializeCompressed()
+	require.Error(otherSigner.Verify())
+}
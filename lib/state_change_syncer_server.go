@@ -0,0 +1,379 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/deso-protocol/go-deadlock"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// The methods below sync the mempool to the state syncer, which needs the server's mempool
+// and blockchain. They're left out of lean builds, which don't include the server.
+
+// SyncMempoolToStateSyncer flushes all mempool transactions to the db, capturing those state changes
+// in the mempool state change file. It also loops through all unconnected transactions and their associated
+// utxo ops and adds them to the mempool state change file.
+func (stateChangeSyncer *StateChangeSyncer) SyncMempoolToStateSyncer(server *Server) (bool, error) {
+	startTime := time.Now()
+	originalCommittedFlushId := stateChangeSyncer.BlockSyncFlushId
+
+	if originalCommittedFlushId == uuid.Nil {
+		return false, nil
+	}
+
+	if !server.GetMempool().IsRunning() {
+		return true, nil
+	}
+
+	blockHeight := uint64(server.blockchain.bestChain[len(server.blockchain.bestChain)-1].Height)
+
+	stateChangeSyncer.MempoolFlushId = originalCommittedFlushId
+
+	stateChangeSyncer.BlockHeight = blockHeight
+
+	mempoolUtxoView, err := server.GetMempool().GetAugmentedUniversalView()
+	if err != nil {
+		return false, errors.Wrapf(err, "StateChangeSyncer.SyncMempoolToStateSyncer: ")
+	}
+
+	// Create a copy of the event manager, assign it to this utxo view.
+	mempoolEventManager := *mempoolUtxoView.EventManager
+
+	// Reset event manager handlers
+	mempoolEventManager.stateSyncerOperationHandlers = nil
+	mempoolEventManager.stateSyncerFlushedHandlers = nil
+	mempoolEventManager.OnStateSyncerOperation(stateChangeSyncer._handleStateSyncerOperation)
+	mempoolEventManager.OnStateSyncerFlushed(stateChangeSyncer._handleStateSyncerFlush)
+
+	mempoolEventManager.isMempoolManager = true
+	mempoolUtxoView.EventManager = &mempoolEventManager
+
+	// Kill the snapshot so that it doesn't affect the original snapshot.
+	mempoolUtxoView.Snapshot = nil
+
+	server.blockchain.ChainLock.RLock()
+	mempoolUtxoView.TipHash = server.blockchain.bestChain[len(server.blockchain.bestChain)-1].Hash
+	server.blockchain.ChainLock.RUnlock()
+
+	// A new transaction is created so that we can simulate writes to the db without actually writing to the db.
+	// Using the transaction here rather than a stubbed badger db allows the process to query the db for any entries
+	// inserted during the flush process. This is necessary to get ancestral records for an entry that is being modified
+	// more than once in the mempool transactions.
+	txn := server.blockchain.db.NewTransaction(true)
+	defer txn.Discard()
+	glog.V(2).Infof("Time since mempool sync start: %v", time.Since(startTime))
+	startTime = time.Now()
+	err = mempoolUtxoView.FlushToDbWithTxn(txn, uint64(server.blockchain.bestChain[len(server.blockchain.bestChain)-1].Height))
+	if err != nil {
+		mempoolUtxoView.EventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+			FlushId:        originalCommittedFlushId,
+			Succeeded:      false,
+			IsMempoolFlush: true,
+		})
+		return false, errors.Wrapf(err, "StateChangeSyncer.SyncMempoolToStateSyncer: FlushToDbWithTxn: ")
+	}
+	glog.V(2).Infof("Time since db flush: %v", time.Since(startTime))
+	mempoolTxUtxoView := NewUtxoViewWithStorageBackend(server.blockchain.db, server.blockchain.params,
+		server.blockchain.postgres, nil, &mempoolEventManager, server.blockchain.storageBackend)
+	glog.V(2).Infof("Time since utxo view: %v", time.Since(startTime))
+
+	// Get the uncommitted blocks from the chain.
+	uncommittedBlocks, err := server.blockchain.GetUncommittedBlocks(mempoolUtxoView.TipHash)
+	if err != nil {
+		mempoolUtxoView.EventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+			FlushId:        originalCommittedFlushId,
+			Succeeded:      false,
+			IsMempoolFlush: true,
+		})
+		glog.V(2).Infof("After the mempool flush: %+v", &StateSyncerFlushedEvent{
+			FlushId:        originalCommittedFlushId,
+			Succeeded:      false,
+			IsMempoolFlush: true,
+		})
+		return false, errors.Wrapf(err, "StateChangeSyncer.SyncMempoolToStateSyncer: ")
+	}
+
+	// TODO: Have Z look at if we need to do some caching in the uncommitted blocks logic.
+	// First connect the uncommitted blocks to the mempool view.
+	for _, uncommittedBlock := range uncommittedBlocks {
+		utxoViewAndOpsAtBlockHash, err := server.blockchain.getUtxoViewAndUtxoOpsAtBlockHash(*uncommittedBlock.Hash)
+		if err != nil {
+			mempoolUtxoView.EventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+				FlushId:        originalCommittedFlushId,
+				Succeeded:      false,
+				IsMempoolFlush: true,
+			})
+			return false, errors.Wrapf(err, "StateChangeSyncer.SyncMempoolToStateSyncer ConnectBlock uncommitted block: ")
+		}
+		// Emit the Block event.
+		blockBytes, err := utxoViewAndOpsAtBlockHash.Block.ToBytes(false)
+		if err != nil {
+			mempoolUtxoView.EventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+				FlushId:        originalCommittedFlushId,
+				Succeeded:      false,
+				IsMempoolFlush: true,
+			})
+			return false, errors.Wrapf(err, "StateChangeSyncer.SyncMempoolToStateSyncer: error converting block to bytes: ")
+		}
+		mempoolUtxoView.EventManager.stateSyncerOperation(&StateSyncerOperationEvent{
+			StateChangeEntry: &StateChangeEntry{
+				OperationType: DbOperationTypeUpsert,
+				KeyBytes:      BlockHashToBlockKey(uncommittedBlock.Hash),
+				EncoderBytes:  blockBytes,
+			},
+			FlushId:      originalCommittedFlushId,
+			IsMempoolTxn: true,
+		})
+		// Emit the UtxoOps event.
+		mempoolUtxoView.EventManager.stateSyncerOperation(&StateSyncerOperationEvent{
+			StateChangeEntry: &StateChangeEntry{
+				OperationType: DbOperationTypeUpsert,
+				KeyBytes:      _DbKeyForUtxoOps(uncommittedBlock.Hash),
+				EncoderBytes: EncodeToBytes(blockHeight, &UtxoOperationBundle{
+					UtxoOpBundle: utxoViewAndOpsAtBlockHash.UtxoOps,
+				}, false),
+			},
+			FlushId:      originalCommittedFlushId,
+			IsMempoolTxn: true,
+		})
+		// getUtxoViewAtBlockHash returns a copy of the view, so we
+		// set the mempoolTxUtxoView to the view at the block hash
+		// and update its event manager to match the mempoolEventManager.
+		mempoolTxUtxoView = utxoViewAndOpsAtBlockHash.UtxoView
+		mempoolTxUtxoView.EventManager = &mempoolEventManager
+	}
+
+	// Loop through all the transactions in the mempool and connect them and their utxo ops to the mempool view.
+	mempoolTxns := server.GetMempool().GetOrderedTransactions()
+	startTime = time.Now()
+	glog.V(2).Infof("Mempool synced len after flush: %d", len(stateChangeSyncer.MempoolSyncedKeyValueMap))
+
+	//Check to see if every txn hash in our cached txns is in the first n txns in the mempool.
+	//N represents the length of our cached txn map.
+	for ii, mempoolTx := range mempoolTxns {
+		if _, ok := stateChangeSyncer.MempoolCachedTxns[mempoolTx.Hash.String()]; !ok {
+			// If any of the transaction hashes in the first n transactions don't line up with our cache map, the mempool
+			// has changed since the last cache, and we need to reset it.
+			stateChangeSyncer.MempoolCachedTxns = make(map[string][]*StateChangeEntry)
+			stateChangeSyncer.MempoolCachedUtxoView = nil
+			glog.V(2).Info("Txn not in cache, resetting\n")
+			break
+		}
+
+		// Once we're past the number of cached txns, we have confirmed that nothing in our cache is out of date and can break.
+		if ii >= len(stateChangeSyncer.MempoolCachedTxns)-1 {
+			if stateChangeSyncer.MempoolCachedUtxoView != nil {
+				// If we know that all our transactions are good, set the state of the utxo view to the cached one, and exit.
+				mempoolUtxoView = stateChangeSyncer.MempoolCachedUtxoView
+			}
+			glog.V(2).Infof("All txns match, continuing: %v\n", ii)
+			break
+		}
+	}
+
+	currentTimestamp := time.Now().UnixNano()
+	for _, mempoolTx := range mempoolTxns {
+		var txnStateChangeEntry *StateChangeEntry
+		var utxoOpStateChangeEntry *StateChangeEntry
+		// Check if the transaction is already in the cache. If so, skip it.
+		txHash := mempoolTx.Hash.String()
+		if stateChangeEntries, ok := stateChangeSyncer.MempoolCachedTxns[txHash]; ok {
+			txnStateChangeEntry = stateChangeEntries[0]
+			utxoOpStateChangeEntry = stateChangeEntries[1]
+		} else {
+			if !mempoolTx.validated {
+				continue
+			}
+			utxoOpsForTxn, _, _, _, err := mempoolTxUtxoView.ConnectTransaction(
+				mempoolTx.Tx, mempoolTx.Hash, uint32(blockHeight+1), currentTimestamp, false, false /*ignoreUtxos*/)
+			if err != nil {
+				mempoolUtxoView.EventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+					FlushId:        originalCommittedFlushId,
+					Succeeded:      false,
+					IsMempoolFlush: true,
+				})
+				stateChangeSyncer.MempoolCachedTxns = make(map[string][]*StateChangeEntry)
+				stateChangeSyncer.MempoolCachedUtxoView = nil
+				return false, errors.Wrapf(err, "StateChangeSyncer.SyncMempoolToStateSyncer ConnectTransaction: ")
+			}
+			txnStateChangeEntry = &StateChangeEntry{
+				OperationType: DbOperationTypeUpsert,
+				KeyBytes:      TxnHashToTxnKey(mempoolTx.Hash),
+				EncoderBytes:  EncodeToBytes(blockHeight, mempoolTx.Tx, false),
+				IsReverted:    false,
+			}
+
+			// Capture the utxo ops for the transaction in a UTXOOp bundle.
+			utxoOpBundle := &UtxoOperationBundle{
+				UtxoOpBundle: [][]*UtxoOperation{},
+			}
+
+			utxoOpBundle.UtxoOpBundle = append(utxoOpBundle.UtxoOpBundle, utxoOpsForTxn)
+
+			utxoOpStateChangeEntry = &StateChangeEntry{
+				OperationType: DbOperationTypeUpsert,
+				KeyBytes:      _DbKeyForTxnUtxoOps(mempoolTx.Hash),
+				EncoderBytes:  EncodeToBytes(blockHeight, utxoOpBundle, false),
+				IsReverted:    false,
+			}
+
+			// Add both state change entries to the mempool sync map.
+			stateChangeSyncer.MempoolCachedTxns[txHash] = []*StateChangeEntry{txnStateChangeEntry, utxoOpStateChangeEntry}
+		}
+
+		// Emit transaction state change.
+		mempoolUtxoView.EventManager.stateSyncerOperation(&StateSyncerOperationEvent{
+			StateChangeEntry: txnStateChangeEntry,
+			FlushId:          originalCommittedFlushId,
+			IsMempoolTxn:     true,
+		})
+
+		// Emit UTXOOp bundle event
+		mempoolUtxoView.EventManager.stateSyncerOperation(&StateSyncerOperationEvent{
+			StateChangeEntry: utxoOpStateChangeEntry,
+			FlushId:          originalCommittedFlushId,
+			IsMempoolTxn:     true,
+		})
+	}
+	// Update the cached utxo view to represent the new cached state.
+	stateChangeSyncer.MempoolCachedUtxoView = mempoolTxUtxoView.CopyUtxoView()
+	glog.V(2).Infof("Time to connect all %d txns: %v", len(mempoolTxns), time.Since(startTime))
+	startTime = time.Now()
+	glog.V(2).Infof("Mempool flushed len: %d", len(stateChangeSyncer.MempoolFlushKeySet))
+	glog.V(2).Infof("Mempool synced len after all: %d", len(stateChangeSyncer.MempoolSyncedKeyValueMap))
+
+	// Before flushing the mempool to the state change file, check if a block has mined. If so, abort the flush.
+	if originalCommittedFlushId != stateChangeSyncer.BlockSyncFlushId {
+		mempoolUtxoView.EventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+			FlushId:        originalCommittedFlushId,
+			Succeeded:      false,
+			IsMempoolFlush: true,
+		})
+		return false, errors.Wrapf(err, "StateChangeSyncer.SyncMempoolToStateSyncer: ")
+	}
+
+	mempoolUtxoView.EventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+		FlushId:          originalCommittedFlushId,
+		Succeeded:        true,
+		IsMempoolFlush:   true,
+		BlockSyncFlushId: originalCommittedFlushId,
+	})
+	glog.V(2).Infof("Time to flush: %v", time.Since(startTime))
+
+	return false, nil
+}
+
+func (stateChangeSyncer *StateChangeSyncer) StartMempoolSyncRoutine(server *Server) {
+	go func() {
+		// Wait for mempool to be initialized.
+		for server.GetMempool() == nil || server.blockchain.chainState() != SyncStateFullyCurrent {
+			time.Sleep(15000 * time.Millisecond)
+			glog.V(2).Infof("Mempool: %v", server.mempool)
+			glog.V(2).Infof("Chain state: %v", server.blockchain.chainState())
+		}
+		if !stateChangeSyncer.BlocksyncCompleteEntriesFlushed && stateChangeSyncer.SyncType == NodeSyncTypeBlockSync {
+			err := stateChangeSyncer.FlushAllEntriesToFile(server)
+			if err != nil {
+				glog.Errorf("StateChangeSyncer.StartMempoolSyncRoutine: Error flushing all entries to file: %v", err)
+			}
+		}
+		mempoolClosed := !server.GetMempool().IsRunning()
+		for !mempoolClosed {
+			// Sleep for a short while to avoid a tight loop.
+			time.Sleep(100 * time.Millisecond)
+			var err error
+			// If the mempool is not empty, sync the mempool to the state syncer.
+			mempoolClosed, err = stateChangeSyncer.SyncMempoolToStateSyncer(server)
+			if err != nil {
+				glog.Errorf("StateChangeSyncer.StartMempoolSyncRoutine: Error syncing mempool to state syncer: %v", err)
+			}
+		}
+	}()
+}
+
+func (stateChangeSyncer *StateChangeSyncer) FlushAllEntriesToFile(server *Server) error {
+	// Check if the state change file already exists and is not empty. If so, return.
+	stateChangeFileInfo, err := stateChangeSyncer.StateChangeFile.Stat()
+	if err == nil {
+		// If the file is non-empty, no need to flush entries to file.
+		if stateChangeFileInfo.Size() > 0 {
+			return nil
+		}
+	}
+
+	// Disable deadlock detection, as the process of flushing entries to file can take a long time and
+	// if it takes longer than the deadlock detection timeout interval, it will cause an error to be thrown.
+	deadlock.Opts.Disable = true
+	defer func() {
+		deadlock.Opts.Disable = false
+	}()
+	// Lock the blockchain so that nothing shifts under our feet while dumping the current state to the state change file.
+	server.blockchain.ChainLock.Lock()
+	defer server.blockchain.ChainLock.Unlock()
+
+	// Allow the state change syncer to flush entries to file.
+	stateChangeSyncer.BlocksyncCompleteEntriesFlushed = true
+
+	// Loop through all prefixes that hold state change entries.
+	for _, prefix := range StatePrefixes.CoreStatePrefixesList {
+		// Start with the first key in the prefix.
+		lastReceivedKey := prefix
+		chunkFull := true
+		var err error
+		var dbBatchEntries []*DBEntry
+
+		// Loop through all the batches of entries for the prefix until we get a non-full chunk.
+		for chunkFull {
+			glog.V(2).Infof("Processing chunk for prefix: %+v\n", prefix)
+			// Create a flush ID for this chunk.
+			dbFlushId := uuid.New()
+			// Fetch the batch from main DB records with a batch size of about snap.BatchSize.
+			dbBatchEntries, chunkFull, err = DBIteratePrefixKeys(server.blockchain.db, prefix, lastReceivedKey, SnapshotBatchSize/10)
+			if err != nil {
+				return errors.Wrapf(err, "StateChangeSyncer.FlushAllEntriesToFile: ")
+			}
+			if len(dbBatchEntries) != 0 {
+				lastReceivedKey = dbBatchEntries[len(dbBatchEntries)-1].Key
+			}
+			for _, dbEntry := range dbBatchEntries {
+				stateChangeEntry := &StateChangeEntry{
+					OperationType: DbOperationTypeInsert,
+					KeyBytes:      dbEntry.Key,
+					EncoderBytes:  dbEntry.Value,
+					IsReverted:    false,
+				}
+
+				// If this prefix is the prefix for UTXO Ops, fetch the transaction for each UTXO Op and attach it to the UTXO Op.
+				if bytes.Equal(prefix, Prefixes.PrefixBlockHashToUtxoOperations) {
+					// Get block hash from the key.
+					blockHashBytes := dbEntry.Key[1:]
+					blockHash := NewBlockHash(blockHashBytes)
+
+					block, err := GetBlock(blockHash, server.blockchain.db, server.blockchain.snapshot)
+					if err != nil {
+						return errors.Wrapf(err, "StateChangeSyncer.FlushAllEntriesToFile: Error fetching block: ")
+					}
+					// Attach the block to the UTXO Op via the ancestral record.
+					stateChangeEntry.Block = block
+				}
+
+				server.eventManager.stateSyncerOperation(&StateSyncerOperationEvent{
+					StateChangeEntry: stateChangeEntry,
+					FlushId:          dbFlushId,
+					IsMempoolTxn:     false,
+				})
+			}
+			server.eventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+				FlushId:        dbFlushId,
+				Succeeded:      true,
+				IsMempoolFlush: false,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1157 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-pg/pg/v10"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// A node that runs with Postgres keeps its block index, its chain tip, and the entries that
+// UtxoView.FlushToDb only writes to badger when Postgres is disabled, like profiles, posts,
+// and balances, in Postgres. Everything else, like block bodies, UtxoOperations, and the
+// PoS entries, stays in badger on both kinds of node. Switching a node from one storage
+// engine to the other used to mean resyncing from genesis. The functions in this file copy
+// the Postgres-backed state from one engine to the other instead, so the node can be
+// restarted on the other engine with the same badger directory.
+//
+// Entries are copied in batches through a UtxoView, so they're written by the same flush code
+// that writes them while syncing: badger entries are set on a view and flushed with
+// Postgres.FlushView, and Postgres rows are set on a view and flushed with FlushToDb. After
+// copying, every prefix is checked by reading it back from both engines and comparing a
+// digest of the entries, encoded with only the fields both engines keep. The node must be
+// stopped while it's migrated, and the destination should be empty, since entries it already
+// has aren't removed.
+//
+// Messages, messaging groups, access groups, new messages, and associations aren't migrated
+// yet, and neither are NFT bids that were accepted, which badger keeps outside of the
+// Postgres-backed state. A migration fails before copying anything if the source has any of
+// them, and nodes that serve them should be resynced instead.
+
+const (
+	// StorageMigrationBatchSize is the number of Postgres rows or block nodes copied per
+	// flush.
+	StorageMigrationBatchSize = 10000
+	// StorageMigrationBatchBytes is the number of bytes of badger entries copied per flush.
+	StorageMigrationBatchBytes = 32 << 20
+)
+
+// StorageMigrationPrefixReport holds what was migrated and found under one prefix.
+type StorageMigrationPrefixReport struct {
+	Name         string
+	BadgerPrefix []byte
+	// NumEntriesMigrated is zero when the prefix was only checked, and for prefixes that are
+	// migrated along with another one.
+	NumEntriesMigrated uint64
+	NumBadgerEntries   uint64
+	NumPostgresEntries uint64
+	// BadgerDigest and PostgresDigest are digests of the entries each engine has under the
+	// prefix. They don't depend on the order the entries are read in.
+	BadgerDigest   BlockHash
+	PostgresDigest BlockHash
+}
+
+// IsConsistent returns true if badger and Postgres have the same entries.
+func (report *StorageMigrationPrefixReport) IsConsistent() bool {
+	return report.NumBadgerEntries == report.NumPostgresEntries && report.BadgerDigest == report.PostgresDigest
+}
+
+func (report *StorageMigrationPrefixReport) String() string {
+	return fmt.Sprintf("< Name: %v, NumEntriesMigrated: %d, NumBadgerEntries: %d, NumPostgresEntries: %d, "+
+		"BadgerDigest: %v, PostgresDigest: %v >", report.Name, report.NumEntriesMigrated, report.NumBadgerEntries,
+		report.NumPostgresEntries, &report.BadgerDigest, &report.PostgresDigest)
+}
+
+// storageMigrationDigest is a digest of a set of encoded entries: the sum of their hashes,
+// modulo 2^256, so that it doesn't depend on the order the entries are added in.
+type storageMigrationDigest struct {
+	sum        *big.Int
+	numEntries uint64
+}
+
+var storageMigrationDigestModulus = new(big.Int).Lsh(big.NewInt(1), 256)
+
+func newStorageMigrationDigest() *storageMigrationDigest {
+	return &storageMigrationDigest{sum: big.NewInt(0)}
+}
+
+func (digest *storageMigrationDigest) add(encodedEntry []byte) {
+	entryHash := Sha256DoubleHash(encodedEntry)
+	digest.sum.Add(digest.sum, new(big.Int).SetBytes(entryHash[:]))
+	digest.sum.Mod(digest.sum, storageMigrationDigestModulus)
+	digest.numEntries++
+}
+
+func (digest *storageMigrationDigest) hash() BlockHash {
+	var hash BlockHash
+	digest.sum.FillBytes(hash[:])
+	return hash
+}
+
+// encodeStorageMigrationFields encodes an entry for a digest. Every field is length-prefixed,
+// so that nil and empty fields are encoded the same way.
+func encodeStorageMigrationFields(fields ...[]byte) []byte {
+	var data []byte
+	for _, field := range fields {
+		data = append(data, EncodeByteArray(field)...)
+	}
+	return data
+}
+
+func storageMigrationHashBytes(hash *BlockHash) []byte {
+	if hash == nil {
+		return nil
+	}
+	return hash[:]
+}
+
+func storageMigrationPKIDBytes(pkid *PKID) []byte {
+	if pkid == nil {
+		return nil
+	}
+	return pkid[:]
+}
+
+func encodeStorageMigrationBalanceEntries(balanceEntries map[BalanceEntryMapKey]*BalanceEntry) [][]byte {
+	var encodedEntries [][]byte
+	for _, balanceEntry := range balanceEntries {
+		encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+			balanceEntry.HODLerPKID[:], balanceEntry.CreatorPKID[:], VariableEncodeUint256(&balanceEntry.BalanceNanos),
+			[]byte{BoolToByte(balanceEntry.HasPurchased)}))
+	}
+	return encodedEntries
+}
+
+// encodeStorageMigrationBlockNode encodes the fields of a block node that Postgres keeps.
+func encodeStorageMigrationBlockNode(blockNode *BlockNode) []byte {
+	var parentHash []byte
+	if blockNode.Parent != nil {
+		parentHash = storageMigrationHashBytes(blockNode.Parent.Hash)
+	}
+	var cumWork []byte
+	if blockNode.CumWork != nil {
+		cumWork = blockNode.CumWork.Bytes()
+	}
+	return encodeStorageMigrationFields(
+		blockNode.Hash[:], UintToBuf(uint64(blockNode.Height)), storageMigrationHashBytes(blockNode.DifficultyTarget),
+		cumWork, UintToBuf(uint64(blockNode.Status)), parentHash,
+		storageMigrationHashBytes(blockNode.Header.TransactionMerkleRoot), UintToBuf(uint64(blockNode.Header.Version)),
+		UintToBuf(uint64(blockNode.Header.TstampNanoSecs)), UintToBuf(blockNode.Header.Nonce),
+		UintToBuf(blockNode.Header.ExtraNonce))
+}
+
+// storageMigrationEntryType describes how one Postgres-backed entry type is read from each
+// engine, set on a view, and encoded to be checked.
+type storageMigrationEntryType struct {
+	name string
+	// badgerPrefix is the prefix the entries are read from in badger.
+	badgerPrefix []byte
+	// isMigratedWithPreviousType is true for types that are copied along with the type before
+	// them, and are only read to be checked.
+	isMigratedWithPreviousType bool
+	// setBadgerEntry decodes an entry stored under badgerPrefix and sets it on the view.
+	setBadgerEntry func(view *UtxoView, key []byte, value []byte) error
+	// setPostgresEntries sets a page of the entries stored in Postgres on the view, and
+	// returns the number of rows in the page.
+	setPostgresEntries func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error)
+	// encodeViewEntries encodes the entries of this type that are set on the view, with only
+	// the fields both engines keep.
+	encodeViewEntries func(view *UtxoView, blockHeight uint64) ([][]byte, error)
+}
+
+// selectStorageMigrationPage selects a page of rows of type T, in a stable order.
+func selectStorageMigrationPage[T any](postgres *Postgres, where string, order string, offset int, limit int) (
+	[]*T, error) {
+
+	var rows []*T
+	query := postgres.db.Model(&rows).OrderExpr(order).Offset(offset).Limit(limit)
+	if where != "" {
+		query = query.Where(where)
+	}
+	if err := query.Select(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func countStorageMigrationRows[T any](postgres *Postgres, where string) (int, error) {
+	query := postgres.db.Model((*T)(nil))
+	if where != "" {
+		query = query.Where(where)
+	}
+	return query.Count()
+}
+
+func decodeStorageMigrationEntry(entry DeSoEncoder, value []byte) error {
+	if exists, err := DecodeFromBytes(entry, bytes.NewReader(value)); err != nil {
+		return err
+	} else if !exists {
+		return errors.New("entry is empty")
+	}
+	return nil
+}
+
+// getStorageMigrationEntryTypes returns the Postgres-backed entry types, in the order they're
+// migrated.
+func getStorageMigrationEntryTypes() []*storageMigrationEntryType {
+	return []*storageMigrationEntryType{
+		{
+			name:         "Utxos",
+			badgerPrefix: Prefixes.PrefixUtxoKeyToUtxoEntry,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				utxoEntry := &UtxoEntry{}
+				if err := decodeStorageMigrationEntry(utxoEntry, value); err != nil {
+					return err
+				}
+				utxoEntry.UtxoKey = _UtxoKeyFromDbKey(key[len(Prefixes.PrefixUtxoKeyToUtxoEntry):])
+				return view._setUtxoMappings(utxoEntry)
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				// Badger deletes spent outputs, so only unspent ones are migrated.
+				outputs, err := selectStorageMigrationPage[PGTransactionOutput](postgres, "spent = false",
+					"output_hash, output_index", offset, limit)
+				for _, output := range outputs {
+					if err = view._setUtxoMappings(output.NewUtxoEntry()); err != nil {
+						return 0, err
+					}
+				}
+				return len(outputs), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, utxoEntry := range view.UtxoKeyToUtxoEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						utxoEntry.UtxoKey.TxID[:], UintToBuf(uint64(utxoEntry.UtxoKey.Index)), utxoEntry.PublicKey,
+						UintToBuf(utxoEntry.AmountNanos), UintToBuf(uint64(utxoEntry.BlockHeight)),
+						[]byte{byte(utxoEntry.UtxoType)}))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			// Postgres keeps a profile row for every PKID, with an empty username when the PKID
+			// has no profile, so PKIDs are migrated along with their profiles.
+			name:         "PKIDs",
+			badgerPrefix: Prefixes.PrefixPublicKeyToPKID,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				pkidEntry := &PKIDEntry{}
+				if err := decodeStorageMigrationEntry(pkidEntry, value); err != nil {
+					return err
+				}
+				pkidEntry.PublicKey = key[len(Prefixes.PrefixPublicKeyToPKID):]
+				view._setPKIDMappings(pkidEntry)
+				if profileEntry := DBGetProfileEntryForPKID(view.Handle, view.Snapshot, pkidEntry.PKID); profileEntry != nil {
+					view.ProfilePKIDToProfileEntry[*pkidEntry.PKID] = profileEntry
+				}
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				profiles, err := selectStorageMigrationPage[PGProfile](postgres, "", "pkid", offset, limit)
+				for _, profile := range profiles {
+					if profile.Empty() {
+						view._setPKIDMappings(&PKIDEntry{PKID: profile.PKID, PublicKey: profile.PublicKey.ToBytes()})
+						continue
+					}
+					view.setProfileMappings(profile)
+				}
+				return len(profiles), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, pkidEntry := range view.PublicKeyToPKIDEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						pkidEntry.PublicKey, pkidEntry.PKID[:]))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:                       "Profiles",
+			badgerPrefix:               Prefixes.PrefixPKIDToProfileEntry,
+			isMigratedWithPreviousType: true,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				profileEntry := &ProfileEntry{}
+				if err := decodeStorageMigrationEntry(profileEntry, value); err != nil {
+					return err
+				}
+				view.ProfilePKIDToProfileEntry[*NewPKID(key[len(Prefixes.PrefixPKIDToProfileEntry):])] = profileEntry
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				profiles, err := selectStorageMigrationPage[PGProfile](postgres, "username != ''", "pkid", offset, limit)
+				for _, profile := range profiles {
+					view.ProfilePKIDToProfileEntry[*profile.PKID] = profile.NewProfileEntry()
+				}
+				return len(profiles), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for pkid, profileEntry := range view.ProfilePKIDToProfileEntry {
+					if profileEntry == nil {
+						continue
+					}
+					pkidBytes := pkid.ToBytes()
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						pkidBytes, profileEntry.PublicKey, profileEntry.Username, profileEntry.Description,
+						profileEntry.ProfilePic, UintToBuf(profileEntry.CreatorCoinEntry.CreatorBasisPoints),
+						UintToBuf(profileEntry.CreatorCoinEntry.DeSoLockedNanos),
+						UintToBuf(profileEntry.CreatorCoinEntry.NumberOfHolders),
+						VariableEncodeUint256(&profileEntry.CreatorCoinEntry.CoinsInCirculationNanos),
+						UintToBuf(profileEntry.CreatorCoinEntry.CoinWatermarkNanos),
+						[]byte{BoolToByte(profileEntry.CreatorCoinEntry.MintingDisabled)},
+						UintToBuf(profileEntry.DAOCoinEntry.NumberOfHolders),
+						VariableEncodeUint256(&profileEntry.DAOCoinEntry.CoinsInCirculationNanos),
+						[]byte{BoolToByte(profileEntry.DAOCoinEntry.MintingDisabled)},
+						[]byte{byte(profileEntry.DAOCoinEntry.TransferRestrictionStatus)},
+						[]byte{profileEntry.DAOCoinEntry.Decimals}, EncodeExtraData(profileEntry.ExtraData)))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "Posts",
+			badgerPrefix: Prefixes.PrefixPostHashToPostEntry,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				postEntry := &PostEntry{}
+				if err := decodeStorageMigrationEntry(postEntry, value); err != nil {
+					return err
+				}
+				view._setPostEntryMappings(postEntry)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				posts, err := selectStorageMigrationPage[PGPost](postgres, "", "post_hash", offset, limit)
+				for _, post := range posts {
+					view._setPostEntryMappings(post.NewPostEntry())
+				}
+				return len(posts), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, postEntry := range view.PostHashToPostEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						postEntry.PostHash[:], postEntry.PosterPublicKey, postEntry.ParentStakeID, postEntry.Body,
+						storageMigrationHashBytes(postEntry.RepostedPostHash), []byte{BoolToByte(postEntry.IsQuotedRepost)},
+						UintToBuf(postEntry.TimestampNanos), []byte{BoolToByte(postEntry.IsHidden)},
+						UintToBuf(postEntry.LikeCount), UintToBuf(postEntry.RepostCount),
+						UintToBuf(postEntry.QuoteRepostCount), UintToBuf(postEntry.DiamondCount),
+						UintToBuf(postEntry.CommentCount), []byte{BoolToByte(postEntry.IsPinned)},
+						[]byte{BoolToByte(postEntry.IsNFT)}, UintToBuf(postEntry.NumNFTCopies),
+						UintToBuf(postEntry.NumNFTCopiesForSale), UintToBuf(postEntry.NumNFTCopiesBurned),
+						[]byte{BoolToByte(postEntry.HasUnlockable)}, UintToBuf(postEntry.NFTRoyaltyToCoinBasisPoints),
+						UintToBuf(postEntry.NFTRoyaltyToCreatorBasisPoints),
+						EncodePKIDuint64Map(postEntry.AdditionalNFTRoyaltiesToCoinsBasisPoints),
+						EncodePKIDuint64Map(postEntry.AdditionalNFTRoyaltiesToCreatorsBasisPoints),
+						EncodeExtraData(postEntry.PostExtraData), []byte{BoolToByte(postEntry.IsFrozen)}))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "Likes",
+			badgerPrefix: Prefixes.PrefixLikerPubKeyToLikedPostHash,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				likeEntry, err := _decodeDbKeyForLikerPubKeyToLikedPostHashMapping(key)
+				if err != nil {
+					return err
+				}
+				view._setLikeEntryMappings(likeEntry)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				likes, err := selectStorageMigrationPage[PGLike](postgres, "", "liker_public_key, liked_post_hash",
+					offset, limit)
+				for _, like := range likes {
+					view._setLikeEntryMappings(like.NewLikeEntry())
+				}
+				return len(likes), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, likeEntry := range view.LikeKeyToLikeEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						likeEntry.LikerPubKey, likeEntry.LikedPostHash[:]))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "Follows",
+			badgerPrefix: Prefixes.PrefixFollowerPKIDToFollowedPKID,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				followEntry, err := _decodeDbKeyForFollowerToFollowedMapping(key)
+				if err != nil {
+					return err
+				}
+				view._setFollowEntryMappings(followEntry)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				follows, err := selectStorageMigrationPage[PGFollow](postgres, "", "follower_pkid, followed_pkid",
+					offset, limit)
+				for _, follow := range follows {
+					view._setFollowEntryMappings(follow.NewFollowEntry())
+				}
+				return len(follows), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, followEntry := range view.FollowKeyToFollowEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						followEntry.FollowerPKID[:], followEntry.FollowedPKID[:]))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "Diamonds",
+			badgerPrefix: Prefixes.PrefixDiamondReceiverPKIDDiamondSenderPKIDPostHash,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				diamondEntry := &DiamondEntry{}
+				if err := decodeStorageMigrationEntry(diamondEntry, value); err != nil {
+					return err
+				}
+				view._setDiamondEntryMappings(diamondEntry)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				diamonds, err := selectStorageMigrationPage[PGDiamond](postgres, "",
+					"sender_pkid, receiver_pkid, diamond_post_hash", offset, limit)
+				for _, diamond := range diamonds {
+					view._setDiamondEntryMappings(&DiamondEntry{
+						SenderPKID:      diamond.SenderPKID,
+						ReceiverPKID:    diamond.ReceiverPKID,
+						DiamondPostHash: diamond.DiamondPostHash,
+						DiamondLevel:    int64(diamond.DiamondLevel),
+					})
+				}
+				return len(diamonds), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, diamondEntry := range view.DiamondKeyToDiamondEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						diamondEntry.SenderPKID[:], diamondEntry.ReceiverPKID[:], diamondEntry.DiamondPostHash[:],
+						UintToBuf(uint64(diamondEntry.DiamondLevel))))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "CreatorCoinBalances",
+			badgerPrefix: Prefixes.PrefixHODLerPKIDCreatorPKIDToBalanceEntry,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				balanceEntry := &BalanceEntry{}
+				if err := decodeStorageMigrationEntry(balanceEntry, value); err != nil {
+					return err
+				}
+				view._setBalanceEntryMappings(balanceEntry, false /*isDAOCoin*/)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				balances, err := selectStorageMigrationPage[PGCreatorCoinBalance](postgres, "",
+					"holder_pkid, creator_pkid", offset, limit)
+				for _, balance := range balances {
+					view._setBalanceEntryMappings(balance.NewBalanceEntry(), false /*isDAOCoin*/)
+				}
+				return len(balances), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				return encodeStorageMigrationBalanceEntries(view.HODLerPKIDCreatorPKIDToBalanceEntry), nil
+			},
+		},
+		{
+			name:         "DAOCoinBalances",
+			badgerPrefix: Prefixes.PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				balanceEntry := &BalanceEntry{}
+				if err := decodeStorageMigrationEntry(balanceEntry, value); err != nil {
+					return err
+				}
+				view._setBalanceEntryMappings(balanceEntry, true /*isDAOCoin*/)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				balances, err := selectStorageMigrationPage[PGDAOCoinBalance](postgres, "",
+					"holder_pkid, creator_pkid", offset, limit)
+				for _, balance := range balances {
+					view._setBalanceEntryMappings(balance.NewBalanceEntry(), true /*isDAOCoin*/)
+				}
+				return len(balances), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				return encodeStorageMigrationBalanceEntries(view.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry), nil
+			},
+		},
+		{
+			name:         "DeSoBalances",
+			badgerPrefix: Prefixes.PrefixPublicKeyToDeSoBalanceNanos,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				publicKey := key[len(Prefixes.PrefixPublicKeyToDeSoBalanceNanos):]
+				view.PublicKeyToDeSoBalanceNanos[*NewPublicKey(publicKey)] = DecodeUint64(value)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				// Badger deletes empty balances, so only non-empty ones are migrated.
+				balances, err := selectStorageMigrationPage[PGBalance](postgres, "balance_nanos > 0", "public_key",
+					offset, limit)
+				for _, balance := range balances {
+					view.PublicKeyToDeSoBalanceNanos[*balance.PublicKey] = balance.BalanceNanos
+				}
+				return len(balances), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for publicKey, balanceNanos := range view.PublicKeyToDeSoBalanceNanos {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						publicKey.ToBytes(), UintToBuf(balanceNanos)))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "ForbiddenKeys",
+			badgerPrefix: Prefixes.PrefixForbiddenBlockSignaturePubKeys,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				publicKey := key[len(Prefixes.PrefixForbiddenBlockSignaturePubKeys):]
+				view.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(publicKey)] = &ForbiddenPubKeyEntry{
+					PubKey: publicKey,
+				}
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				forbiddenKeys, err := selectStorageMigrationPage[PGForbiddenKey](postgres, "", "public_key",
+					offset, limit)
+				for _, forbiddenKey := range forbiddenKeys {
+					publicKey := forbiddenKey.PublicKey.ToBytes()
+					view.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(publicKey)] = &ForbiddenPubKeyEntry{
+						PubKey: publicKey,
+					}
+				}
+				return len(forbiddenKeys), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, forbiddenPubKeyEntry := range view.ForbiddenPubKeyToForbiddenPubKeyEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(forbiddenPubKeyEntry.PubKey))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "NFTs",
+			badgerPrefix: Prefixes.PrefixPostHashSerialNumberToNFTEntry,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				nftEntry := &NFTEntry{}
+				if err := decodeStorageMigrationEntry(nftEntry, value); err != nil {
+					return err
+				}
+				view._setNFTEntryMappings(nftEntry)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				nfts, err := selectStorageMigrationPage[PGNFT](postgres, "", "nft_post_hash, serial_number",
+					offset, limit)
+				for _, nft := range nfts {
+					view._setNFTEntryMappings(nft.NewNFTEntry())
+				}
+				return len(nfts), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, nftEntry := range view.NFTKeyToNFTEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						storageMigrationPKIDBytes(nftEntry.LastOwnerPKID), storageMigrationPKIDBytes(nftEntry.OwnerPKID),
+						nftEntry.NFTPostHash[:], UintToBuf(nftEntry.SerialNumber), []byte{BoolToByte(nftEntry.IsForSale)},
+						UintToBuf(nftEntry.MinBidAmountNanos), nftEntry.UnlockableText,
+						UintToBuf(nftEntry.LastAcceptedBidAmountNanos), []byte{BoolToByte(nftEntry.IsPending)},
+						[]byte{BoolToByte(nftEntry.IsBuyNow)}, UintToBuf(nftEntry.BuyNowPriceNanos),
+						EncodeExtraData(nftEntry.ExtraData)))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			// Only open bids are migrated. Accepted bids aren't migrated yet, see
+			// getStorageMigrationUnsupportedTypes.
+			name:         "NFTBids",
+			badgerPrefix: Prefixes.PrefixBidderPKIDPostHashSerialNumberToBidNanos,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				// The key is the prefix, the bidder's PKID, the NFT's post hash, and its serial number.
+				pkidStartIdx := len(Prefixes.PrefixBidderPKIDPostHashSerialNumberToBidNanos)
+				postHashStartIdx := pkidStartIdx + PublicKeyLenCompressed
+				serialNumberStartIdx := postHashStartIdx + HashSizeBytes
+				if len(key) != serialNumberStartIdx+8 {
+					return fmt.Errorf("key is incorrect length: %v", len(key))
+				}
+				bidderPKID := &PKID{}
+				copy(bidderPKID[:], key[pkidStartIdx:postHashStartIdx])
+				nftPostHash := &BlockHash{}
+				copy(nftPostHash[:], key[postHashStartIdx:serialNumberStartIdx])
+				view._setNFTBidEntryMappings(&NFTBidEntry{
+					BidderPKID:     bidderPKID,
+					NFTPostHash:    nftPostHash,
+					SerialNumber:   DecodeUint64(key[serialNumberStartIdx:]),
+					BidAmountNanos: DecodeUint64(value),
+				})
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				bids, err := selectStorageMigrationPage[PGNFTBid](postgres, "accepted = false",
+					"nft_post_hash, bidder_pkid, serial_number", offset, limit)
+				for _, bid := range bids {
+					view._setNFTBidEntryMappings(bid.NewNFTBidEntry())
+				}
+				return len(bids), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, nftBidEntry := range view.NFTBidKeyToNFTBidEntry {
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						nftBidEntry.BidderPKID[:], nftBidEntry.NFTPostHash[:], UintToBuf(nftBidEntry.SerialNumber),
+						UintToBuf(nftBidEntry.BidAmountNanos)))
+				}
+				return encodedEntries, nil
+			},
+		},
+		{
+			name:         "DerivedKeys",
+			badgerPrefix: Prefixes.PrefixAuthorizeDerivedKey,
+			setBadgerEntry: func(view *UtxoView, key []byte, value []byte) error {
+				derivedKeyEntry := &DerivedKeyEntry{}
+				if err := decodeStorageMigrationEntry(derivedKeyEntry, value); err != nil {
+					return err
+				}
+				view._setDerivedKeyMapping(derivedKeyEntry)
+				return nil
+			},
+			setPostgresEntries: func(postgres *Postgres, view *UtxoView, offset int, limit int) (int, error) {
+				derivedKeys, err := selectStorageMigrationPage[PGDerivedKey](postgres, "",
+					"owner_public_key, derived_public_key", offset, limit)
+				for _, derivedKey := range derivedKeys {
+					derivedKeyEntry := derivedKey.NewDerivedKeyEntry()
+					if derivedKeyEntry == nil {
+						return 0, fmt.Errorf("problem decoding derived key %v",
+							PkToStringBoth(derivedKey.DerivedPublicKey.ToBytes()))
+					}
+					view._setDerivedKeyMapping(derivedKeyEntry)
+				}
+				return len(derivedKeys), err
+			},
+			encodeViewEntries: func(view *UtxoView, blockHeight uint64) ([][]byte, error) {
+				var encodedEntries [][]byte
+				for _, derivedKeyEntry := range view.DerivedKeyToDerivedEntry {
+					var transactionSpendingLimitBytes []byte
+					if derivedKeyEntry.TransactionSpendingLimitTracker != nil {
+						var err error
+						transactionSpendingLimitBytes, err = derivedKeyEntry.TransactionSpendingLimitTracker.ToBytes(
+							blockHeight)
+						if err != nil {
+							return nil, err
+						}
+					}
+					encodedEntries = append(encodedEntries, encodeStorageMigrationFields(
+						derivedKeyEntry.OwnerPublicKey[:], derivedKeyEntry.DerivedPublicKey[:],
+						UintToBuf(derivedKeyEntry.ExpirationBlock), []byte{byte(derivedKeyEntry.OperationType)},
+						EncodeExtraData(derivedKeyEntry.ExtraData), transactionSpendingLimitBytes, derivedKeyEntry.Memo,
+						UintToBuf(derivedKeyEntry.Nonce)))
+				}
+				return encodedEntries, nil
+			},
+		},
+	}
+}
+
+// storageMigrationUnsupportedType is state a Postgres node keeps in Postgres that isn't
+// migrated yet.
+type storageMigrationUnsupportedType struct {
+	name           string
+	badgerPrefixes [][]byte
+	// countPostgresEntries returns the number of rows the state has in Postgres.
+	countPostgresEntries func(postgres *Postgres) (int, error)
+}
+
+// sumStorageMigrationRowCounts returns the sum of the number of rows each count returns.
+func sumStorageMigrationRowCounts(postgres *Postgres, counts ...func(postgres *Postgres) (int, error)) (int, error) {
+	numRows := 0
+	for _, count := range counts {
+		numRowsInTable, err := count(postgres)
+		if err != nil {
+			return 0, err
+		}
+		numRows += numRowsInTable
+	}
+	return numRows, nil
+}
+
+func getStorageMigrationUnsupportedTypes() []*storageMigrationUnsupportedType {
+	return []*storageMigrationUnsupportedType{
+		{
+			name:           "Messages",
+			badgerPrefixes: [][]byte{Prefixes.PrefixPublicKeyTimestampToPrivateMessage},
+			countPostgresEntries: func(postgres *Postgres) (int, error) {
+				return countStorageMigrationRows[PGMessage](postgres, "")
+			},
+		},
+		{
+			name: "MessagingGroups",
+			badgerPrefixes: [][]byte{
+				Prefixes.PrefixMessagingGroupEntriesByOwnerPubKeyAndGroupKeyName,
+				Prefixes.PrefixMessagingGroupMetadataByMemberPubKeyAndGroupMessagingPubKey,
+			},
+			countPostgresEntries: func(postgres *Postgres) (int, error) {
+				return countStorageMigrationRows[PGMessagingGroup](postgres, "")
+			},
+		},
+		{
+			name: "AccessGroups",
+			badgerPrefixes: [][]byte{
+				Prefixes.PrefixAccessGroupEntriesByAccessGroupId,
+				Prefixes.PrefixAccessGroupMembershipIndex,
+				Prefixes.PrefixAccessGroupMemberEnumerationIndex,
+			},
+			countPostgresEntries: func(postgres *Postgres) (int, error) {
+				return sumStorageMigrationRowCounts(postgres,
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGAccessGroupEntry](postgres, "")
+					},
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGAccessGroupMemberEntry](postgres, "")
+					},
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGAccessGroupMemberEnumerationEntry](postgres, "")
+					})
+			},
+		},
+		{
+			name: "NewMessages",
+			badgerPrefixes: [][]byte{
+				Prefixes.PrefixGroupChatMessagesIndex,
+				Prefixes.PrefixDmMessagesIndex,
+				Prefixes.PrefixDmThreadIndex,
+			},
+			countPostgresEntries: func(postgres *Postgres) (int, error) {
+				return sumStorageMigrationRowCounts(postgres,
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGNewMessageDmEntry](postgres, "")
+					},
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGNewMessageGroupChatEntry](postgres, "")
+					},
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGNewMessageDmThreadEntry](postgres, "")
+					},
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGNewMessageGroupChatThreadEntry](postgres, "")
+					})
+			},
+		},
+		{
+			name:           "Associations",
+			badgerPrefixes: [][]byte{Prefixes.PrefixUserAssociationByID, Prefixes.PrefixPostAssociationByID},
+			countPostgresEntries: func(postgres *Postgres) (int, error) {
+				return sumStorageMigrationRowCounts(postgres,
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGUserAssociation](postgres, "")
+					},
+					func(postgres *Postgres) (int, error) {
+						return countStorageMigrationRows[PGPostAssociation](postgres, "")
+					})
+			},
+		},
+		{
+			name:           "AcceptedNFTBids",
+			badgerPrefixes: [][]byte{Prefixes.PrefixPostHashSerialNumberToAcceptedBidEntries},
+			countPostgresEntries: func(postgres *Postgres) (int, error) {
+				return countStorageMigrationRows[PGNFTBid](postgres, "accepted = true")
+			},
+		},
+	}
+}
+
+// checkStorageMigrationBadgerIsSupported returns an error naming the state badger has that
+// isn't migrated yet, if there is any.
+func checkStorageMigrationBadgerIsSupported(handle *badger.DB) error {
+	var unsupportedNames []string
+	for _, unsupportedType := range getStorageMigrationUnsupportedTypes() {
+		for _, badgerPrefix := range unsupportedType.badgerPrefixes {
+			hasKeys, err := hasStorageMigrationKeys(handle, badgerPrefix)
+			if err != nil {
+				return errors.Wrapf(err, "Problem reading %v: ", unsupportedType.name)
+			}
+			if hasKeys {
+				unsupportedNames = append(unsupportedNames, unsupportedType.name)
+				break
+			}
+		}
+	}
+	if len(unsupportedNames) > 0 {
+		return fmt.Errorf("Badger has state that can't be migrated yet: %v", strings.Join(unsupportedNames, ", "))
+	}
+	return nil
+}
+
+// checkStorageMigrationPostgresIsSupported returns an error naming the state Postgres has that
+// isn't migrated yet, if there is any.
+func checkStorageMigrationPostgresIsSupported(postgres *Postgres) error {
+	var unsupportedNames []string
+	for _, unsupportedType := range getStorageMigrationUnsupportedTypes() {
+		numRows, err := unsupportedType.countPostgresEntries(postgres)
+		if err != nil {
+			return errors.Wrapf(err, "Problem counting %v: ", unsupportedType.name)
+		}
+		if numRows > 0 {
+			unsupportedNames = append(unsupportedNames, unsupportedType.name)
+		}
+	}
+	if len(unsupportedNames) > 0 {
+		return fmt.Errorf("Postgres has state that can't be migrated yet: %v", strings.Join(unsupportedNames, ", "))
+	}
+	return nil
+}
+
+// MigrateBadgerToPostgres copies the block index, the chain tip, and the Postgres-backed
+// entries from badger to Postgres, then checks every prefix. blockHeight is the height of
+// the chain tip, which some entries are encoded at. It returns an error without copying
+// anything if badger has state that isn't migrated yet, and an error if a prefix isn't
+// consistent after the migration, along with the reports of every prefix.
+func MigrateBadgerToPostgres(handle *badger.DB, snap *Snapshot, postgres *Postgres, params *DeSoParams,
+	blockHeight uint64) ([]*StorageMigrationPrefixReport, error) {
+
+	if err := checkStorageMigrationBadgerIsSupported(handle); err != nil {
+		return nil, errors.Wrapf(err, "MigrateBadgerToPostgres: ")
+	}
+
+	numBlockNodes, err := migrateBlockIndexToPostgres(handle, snap, postgres, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MigrateBadgerToPostgres: ")
+	}
+	numEntriesMigratedByName := map[string]uint64{storageMigrationBlockIndexName: numBlockNodes}
+
+	for _, entryType := range getStorageMigrationEntryTypes() {
+		if entryType.isMigratedWithPreviousType {
+			continue
+		}
+		numEntriesMigrated := uint64(0)
+		err = iterateStorageMigrationBadgerEntries(handle, entryType.badgerPrefix, func(dbEntries []*DBEntry) error {
+			view := NewUtxoView(handle, params, nil, snap, nil)
+			for _, dbEntry := range dbEntries {
+				if err := entryType.setBadgerEntry(view, dbEntry.Key, dbEntry.Value); err != nil {
+					return errors.Wrapf(err, "Problem decoding %v with key %v: ", entryType.name, dbEntry.Key)
+				}
+				numEntriesMigrated++
+			}
+			if err := postgres.FlushView(view, blockHeight); err != nil {
+				return errors.Wrapf(err, "Problem writing %v: ", entryType.name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "MigrateBadgerToPostgres: ")
+		}
+		glog.Infof("MigrateBadgerToPostgres: Migrated %d %v", numEntriesMigrated, entryType.name)
+		numEntriesMigratedByName[entryType.name] = numEntriesMigrated
+	}
+
+	return checkStorageMigration(handle, postgres, params, blockHeight, numEntriesMigratedByName)
+}
+
+// MigratePostgresToBadger copies the block index, the chain tip, and the Postgres-backed
+// entries from Postgres to badger, then checks every prefix. See MigrateBadgerToPostgres.
+func MigratePostgresToBadger(postgres *Postgres, handle *badger.DB, snap *Snapshot, params *DeSoParams,
+	blockHeight uint64) ([]*StorageMigrationPrefixReport, error) {
+
+	if err := checkStorageMigrationPostgresIsSupported(postgres); err != nil {
+		return nil, errors.Wrapf(err, "MigratePostgresToBadger: ")
+	}
+
+	numBlockNodes, err := migrateBlockIndexToBadger(postgres, handle, snap)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MigratePostgresToBadger: ")
+	}
+	numEntriesMigratedByName := map[string]uint64{storageMigrationBlockIndexName: numBlockNodes}
+
+	for _, entryType := range getStorageMigrationEntryTypes() {
+		if entryType.isMigratedWithPreviousType {
+			continue
+		}
+		numEntriesMigrated := uint64(0)
+		for {
+			view := NewUtxoView(handle, params, nil, snap, nil)
+			numRows, err := entryType.setPostgresEntries(postgres, view, int(numEntriesMigrated), StorageMigrationBatchSize)
+			if err != nil {
+				return nil, errors.Wrapf(err, "MigratePostgresToBadger: Problem reading %v: ", entryType.name)
+			}
+			if err = view.FlushToDb(blockHeight); err != nil {
+				return nil, errors.Wrapf(err, "MigratePostgresToBadger: Problem writing %v: ", entryType.name)
+			}
+			numEntriesMigrated += uint64(numRows)
+			if numRows < StorageMigrationBatchSize {
+				break
+			}
+		}
+		glog.Infof("MigratePostgresToBadger: Migrated %d %v", numEntriesMigrated, entryType.name)
+		numEntriesMigratedByName[entryType.name] = numEntriesMigrated
+	}
+
+	return checkStorageMigration(handle, postgres, params, blockHeight, numEntriesMigratedByName)
+}
+
+// CheckStorageMigration compares the entries badger and Postgres have under every prefix
+// that's migrated, without migrating anything. blockHeight is the height of the chain tip.
+// It returns an error if a prefix isn't consistent, along with the reports of every prefix.
+func CheckStorageMigration(handle *badger.DB, postgres *Postgres, params *DeSoParams, blockHeight uint64) (
+	[]*StorageMigrationPrefixReport, error) {
+
+	return checkStorageMigration(handle, postgres, params, blockHeight, nil)
+}
+
+const storageMigrationBlockIndexName = "BlockIndex"
+
+func checkStorageMigration(handle *badger.DB, postgres *Postgres, params *DeSoParams, blockHeight uint64,
+	numEntriesMigratedByName map[string]uint64) ([]*StorageMigrationPrefixReport, error) {
+
+	newReport := func(name string, badgerPrefix []byte, badgerDigest *storageMigrationDigest,
+		postgresDigest *storageMigrationDigest) *StorageMigrationPrefixReport {
+
+		return &StorageMigrationPrefixReport{
+			Name:               name,
+			BadgerPrefix:       badgerPrefix,
+			NumEntriesMigrated: numEntriesMigratedByName[name],
+			NumBadgerEntries:   badgerDigest.numEntries,
+			NumPostgresEntries: postgresDigest.numEntries,
+			BadgerDigest:       badgerDigest.hash(),
+			PostgresDigest:     postgresDigest.hash(),
+		}
+	}
+
+	badgerBlockIndex, err := GetBlockIndex(handle, false /*bitcoinNodes*/, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CheckStorageMigration: Problem reading block index from badger: ")
+	}
+	postgresBlockIndex, err := postgres.GetBlockIndex()
+	if err != nil {
+		return nil, errors.Wrapf(err, "CheckStorageMigration: Problem reading block index from Postgres: ")
+	}
+	reports := []*StorageMigrationPrefixReport{newReport(storageMigrationBlockIndexName,
+		_heightHashToNodeIndexPrefix(false /*bitcoinNodes*/), digestStorageMigrationBlockIndex(badgerBlockIndex),
+		digestStorageMigrationBlockIndex(postgresBlockIndex))}
+
+	for _, entryType := range getStorageMigrationEntryTypes() {
+		badgerDigest, err := digestStorageMigrationBadgerEntries(handle, params, entryType, blockHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "CheckStorageMigration: Problem reading %v from badger: ", entryType.name)
+		}
+		postgresDigest, err := digestStorageMigrationPostgresEntries(postgres, handle, params, entryType, blockHeight)
+		if err != nil {
+			return nil, errors.Wrapf(err, "CheckStorageMigration: Problem reading %v from Postgres: ", entryType.name)
+		}
+		reports = append(reports, newReport(entryType.name, entryType.badgerPrefix, badgerDigest, postgresDigest))
+	}
+
+	numInconsistent := 0
+	for _, report := range reports {
+		if !report.IsConsistent() {
+			glog.Errorf("CheckStorageMigration: Inconsistent prefix %v", report)
+			numInconsistent++
+		}
+	}
+	if numInconsistent > 0 {
+		return reports, fmt.Errorf("CheckStorageMigration: %d of %d prefixes are inconsistent",
+			numInconsistent, len(reports))
+	}
+	return reports, nil
+}
+
+func digestStorageMigrationBlockIndex(blockIndex map[BlockHash]*BlockNode) *storageMigrationDigest {
+	digest := newStorageMigrationDigest()
+	for _, blockNode := range blockIndex {
+		digest.add(encodeStorageMigrationBlockNode(blockNode))
+	}
+	return digest
+}
+
+// addStorageMigrationViewEntries adds the entries of the type that are set on the view to the
+// digest.
+func addStorageMigrationViewEntries(digest *storageMigrationDigest, entryType *storageMigrationEntryType,
+	view *UtxoView, blockHeight uint64) error {
+
+	encodedEntries, err := entryType.encodeViewEntries(view, blockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "Problem encoding %v: ", entryType.name)
+	}
+	for _, encodedEntry := range encodedEntries {
+		digest.add(encodedEntry)
+	}
+	return nil
+}
+
+func digestStorageMigrationBadgerEntries(handle *badger.DB, params *DeSoParams,
+	entryType *storageMigrationEntryType, blockHeight uint64) (*storageMigrationDigest, error) {
+
+	digest := newStorageMigrationDigest()
+	err := iterateStorageMigrationBadgerEntries(handle, entryType.badgerPrefix, func(dbEntries []*DBEntry) error {
+		view := NewUtxoView(handle, params, nil, nil, nil)
+		for _, dbEntry := range dbEntries {
+			if err := entryType.setBadgerEntry(view, dbEntry.Key, dbEntry.Value); err != nil {
+				return errors.Wrapf(err, "Problem decoding %v with key %v: ", entryType.name, dbEntry.Key)
+			}
+		}
+		return addStorageMigrationViewEntries(digest, entryType, view, blockHeight)
+	})
+	return digest, err
+}
+
+func digestStorageMigrationPostgresEntries(postgres *Postgres, handle *badger.DB, params *DeSoParams,
+	entryType *storageMigrationEntryType, blockHeight uint64) (*storageMigrationDigest, error) {
+
+	digest := newStorageMigrationDigest()
+	for offset := 0; ; offset += StorageMigrationBatchSize {
+		view := NewUtxoView(handle, params, nil, nil, nil)
+		numRows, err := entryType.setPostgresEntries(postgres, view, offset, StorageMigrationBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if err = addStorageMigrationViewEntries(digest, entryType, view, blockHeight); err != nil {
+			return nil, err
+		}
+		if numRows < StorageMigrationBatchSize {
+			break
+		}
+	}
+	return digest, nil
+}
+
+// iterateStorageMigrationBadgerEntries calls handleEntries with every entry under the prefix,
+// in chunks of about StorageMigrationBatchBytes.
+func iterateStorageMigrationBadgerEntries(handle *badger.DB, prefix []byte,
+	handleEntries func(dbEntries []*DBEntry) error) error {
+
+	startKey := prefix
+	for {
+		dbEntries, isChunkFull, err := DBIteratePrefixKeys(handle, prefix, startKey, StorageMigrationBatchBytes)
+		if err != nil {
+			return err
+		}
+		if len(dbEntries) == 0 {
+			return nil
+		}
+		nextStartKey := dbEntries[len(dbEntries)-1].Key
+		// Every chunk after the first starts with the last key of the previous one.
+		if !bytes.Equal(startKey, prefix) && bytes.Equal(dbEntries[0].Key, startKey) {
+			dbEntries = dbEntries[1:]
+		}
+		if err = handleEntries(dbEntries); err != nil {
+			return err
+		}
+		if !isChunkFull {
+			return nil
+		}
+		startKey = nextStartKey
+	}
+}
+
+func hasStorageMigrationKeys(handle *badger.DB, prefix []byte) (bool, error) {
+	hasKeys := false
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		iterator.Seek(prefix)
+		hasKeys = iterator.ValidForPrefix(prefix)
+		return nil
+	})
+	return hasKeys, err
+}
+
+// migrateBlockIndexToPostgres copies every block node in badger to Postgres, along with the
+// tip of the best chain.
+func migrateBlockIndexToPostgres(handle *badger.DB, snap *Snapshot, postgres *Postgres, params *DeSoParams) (
+	uint64, error) {
+
+	blockIndex, err := GetBlockIndex(handle, false /*bitcoinNodes*/, params)
+	if err != nil {
+		return 0, errors.Wrapf(err, "migrateBlockIndexToPostgres: Problem reading block index: ")
+	}
+	blockNodes := make([]*BlockNode, 0, len(blockIndex))
+	for _, blockNode := range blockIndex {
+		blockNodes = append(blockNodes, blockNode)
+	}
+	for startIdx := 0; startIdx < len(blockNodes); startIdx += StorageMigrationBatchSize {
+		endIdx := startIdx + StorageMigrationBatchSize
+		if endIdx > len(blockNodes) {
+			endIdx = len(blockNodes)
+		}
+		err = postgres.db.RunInTransaction(postgres.db.Context(), func(tx *pg.Tx) error {
+			for _, blockNode := range blockNodes[startIdx:endIdx] {
+				if err := postgres.UpsertBlockTx(tx, blockNode); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, errors.Wrapf(err, "migrateBlockIndexToPostgres: Problem writing block nodes: ")
+		}
+	}
+
+	tipHash := DbGetBestHash(handle, snap, ChainTypeDeSoBlock)
+	if tipHash == nil {
+		return 0, errors.New("migrateBlockIndexToPostgres: Badger has no best chain")
+	}
+	if err = postgres.UpsertChain(MAIN_CHAIN, tipHash); err != nil {
+		return 0, errors.Wrapf(err, "migrateBlockIndexToPostgres: Problem writing chain tip: ")
+	}
+	glog.Infof("migrateBlockIndexToPostgres: Migrated %d block nodes with tip %v", len(blockNodes), tipHash)
+	return uint64(len(blockNodes)), nil
+}
+
+// migrateBlockIndexToBadger copies every block node in Postgres to badger, along with the tip
+// of the best chain.
+func migrateBlockIndexToBadger(postgres *Postgres, handle *badger.DB, snap *Snapshot) (uint64, error) {
+	chain := postgres.GetChain(MAIN_CHAIN)
+	if chain == nil || chain.TipHash == nil {
+		return 0, errors.New("migrateBlockIndexToBadger: Postgres has no best chain")
+	}
+	blockIndex, err := postgres.GetBlockIndex()
+	if err != nil {
+		return 0, errors.Wrapf(err, "migrateBlockIndexToBadger: Problem reading block index: ")
+	}
+	blockNodes := make([]*BlockNode, 0, len(blockIndex))
+	for _, blockNode := range blockIndex {
+		blockNodes = append(blockNodes, blockNode)
+	}
+	for startIdx := 0; startIdx < len(blockNodes); startIdx += StorageMigrationBatchSize {
+		endIdx := startIdx + StorageMigrationBatchSize
+		if endIdx > len(blockNodes) {
+			endIdx = len(blockNodes)
+		}
+		err = handle.Update(func(txn *badger.Txn) error {
+			for _, blockNode := range blockNodes[startIdx:endIdx] {
+				if err := PutHeightHashToNodeInfoWithTxn(txn, snap, blockNode, false /*bitcoinNodes*/, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, errors.Wrapf(err, "migrateBlockIndexToBadger: Problem writing block nodes: ")
+		}
+	}
+
+	err = handle.Update(func(txn *badger.Txn) error {
+		return PutBestHashWithTxn(txn, snap, chain.TipHash, ChainTypeDeSoBlock, nil)
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "migrateBlockIndexToBadger: Problem writing chain tip: ")
+	}
+	glog.Infof("migrateBlockIndexToBadger: Migrated %d block nodes with tip %v", len(blockNodes), chain.TipHash)
+	return uint64(len(blockNodes)), nil
+}
@@ -0,0 +1,265 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-pg/pg/v10"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageMigrationDigest(t *testing.T) {
+	require := require.New(t)
+
+	encodedEntries := [][]byte{[]byte("entry 1"), []byte("entry 2"), []byte("entry 3")}
+	digest := newStorageMigrationDigest()
+	for _, encodedEntry := range encodedEntries {
+		digest.add(encodedEntry)
+	}
+	reversedDigest := newStorageMigrationDigest()
+	for ii := len(encodedEntries) - 1; ii >= 0; ii-- {
+		reversedDigest.add(encodedEntries[ii])
+	}
+	require.Equal(uint64(3), digest.numEntries)
+	require.Equal(digest.hash(), reversedDigest.hash())
+
+	// Changing one entry changes the digest, even though the number of entries is the same.
+	changedDigest := newStorageMigrationDigest()
+	changedDigest.add(encodedEntries[0])
+	changedDigest.add(encodedEntries[1])
+	changedDigest.add([]byte("entry 4"))
+	require.Equal(digest.numEntries, changedDigest.numEntries)
+	require.NotEqual(digest.hash(), changedDigest.hash())
+
+	report := &StorageMigrationPrefixReport{
+		NumBadgerEntries:   digest.numEntries,
+		NumPostgresEntries: reversedDigest.numEntries,
+		BadgerDigest:       digest.hash(),
+		PostgresDigest:     reversedDigest.hash(),
+	}
+	require.True(report.IsConsistent())
+	report.PostgresDigest = changedDigest.hash()
+	require.False(report.IsConsistent())
+
+	// Nil and empty fields are encoded the same way, but moving a byte between fields isn't.
+	require.Equal(encodeStorageMigrationFields(nil, []byte{1}), encodeStorageMigrationFields([]byte{}, []byte{1}))
+	require.NotEqual(encodeStorageMigrationFields([]byte{1}, []byte{2}), encodeStorageMigrationFields([]byte{1, 2}, nil))
+}
+
+func TestStorageMigrationPostEncoding(t *testing.T) {
+	require := require.New(t)
+
+	posterPkBytes, _, err := Base58CheckDecode(m0Pub)
+	require.NoError(err)
+	blockHeight := uint64(0)
+	postEntry := &PostEntry{
+		PostHash:                       NewBlockHash(RandomBytes(HashSizeBytes)),
+		PosterPublicKey:                posterPkBytes,
+		ParentStakeID:                  RandomBytes(HashSizeBytes),
+		Body:                           []byte(`{"Body":"storage migration"}`),
+		TimestampNanos:                 1234,
+		LikeCount:                      5,
+		CommentCount:                   2,
+		IsNFT:                          true,
+		NumNFTCopies:                   10,
+		NFTRoyaltyToCoinBasisPoints:    100,
+		NFTRoyaltyToCreatorBasisPoints: 200,
+		AdditionalNFTRoyaltiesToCoinsBasisPoints: map[PKID]uint64{
+			*NewPKID(posterPkBytes): 300,
+		},
+		PostExtraData: map[string][]byte{"key": []byte("value")},
+	}
+	postEntryType := getStorageMigrationEntryTypeForTest(t, "Posts")
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	// Set the post on a view the way it's read from badger.
+	badgerView := NewUtxoView(db, &DeSoTestnetParams, nil, nil, nil)
+	require.NoError(postEntryType.setBadgerEntry(badgerView, _dbKeyForPostEntryHash(postEntry.PostHash),
+		EncodeToBytes(blockHeight, postEntry)))
+	badgerEncodedEntries, err := postEntryType.encodeViewEntries(badgerView, blockHeight)
+	require.NoError(err)
+	require.Len(badgerEncodedEntries, 1)
+
+	// Set the post on a view the way it's read from Postgres.
+	pgPost := &PGPost{
+		PostHash:                  postEntry.PostHash,
+		PosterPublicKey:           postEntry.PosterPublicKey,
+		ParentPostHash:            NewBlockHash(postEntry.ParentStakeID),
+		Body:                      string(postEntry.Body),
+		Timestamp:                 postEntry.TimestampNanos,
+		LikeCount:                 postEntry.LikeCount,
+		CommentCount:              postEntry.CommentCount,
+		NFT:                       postEntry.IsNFT,
+		NumNFTCopies:              postEntry.NumNFTCopies,
+		CoinRoyaltyBasisPoints:    postEntry.NFTRoyaltyToCoinBasisPoints,
+		CreatorRoyaltyBasisPoints: postEntry.NFTRoyaltyToCreatorBasisPoints,
+		// Postgres keys the additional royalties by the hex of the PKID.
+		AdditionalNFTRoyaltiesToCoinsBasisPoints: map[string]uint64{
+			hex.EncodeToString(posterPkBytes): 300,
+		},
+		ExtraData: postEntry.PostExtraData,
+	}
+	postgresView := NewUtxoView(db, &DeSoTestnetParams, nil, nil, nil)
+	postgresView._setPostEntryMappings(pgPost.NewPostEntry())
+	postgresEncodedEntries, err := postEntryType.encodeViewEntries(postgresView, blockHeight)
+	require.NoError(err)
+	require.Equal(badgerEncodedEntries, postgresEncodedEntries)
+
+	// A field Postgres lost shows up as a different encoding.
+	pgPost.LikeCount++
+	postgresView._setPostEntryMappings(pgPost.NewPostEntry())
+	postgresEncodedEntries, err = postEntryType.encodeViewEntries(postgresView, blockHeight)
+	require.NoError(err)
+	require.NotEqual(badgerEncodedEntries, postgresEncodedEntries)
+}
+
+func TestStorageMigrationUnsupportedBadgerState(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	require.NoError(checkStorageMigrationBadgerIsSupported(db))
+
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(append(append([]byte{}, Prefixes.PrefixPostHashSerialNumberToAcceptedBidEntries...),
+			RandomBytes(HashSizeBytes)...), []byte{1}); err != nil {
+			return err
+		}
+		return txn.Set(append(append([]byte{}, Prefixes.PrefixPostAssociationByID...),
+			RandomBytes(HashSizeBytes)...), []byte{1})
+	}))
+	err := checkStorageMigrationBadgerIsSupported(db)
+	require.Error(err)
+	require.Contains(err.Error(), "Associations")
+	require.Contains(err.Error(), "AcceptedNFTBids")
+	require.NotContains(err.Error(), "AccessGroups")
+
+	// The migration fails before anything is written to Postgres.
+	_, err = MigrateBadgerToPostgres(db, nil, nil, &DeSoTestnetParams, 0)
+	require.Error(err)
+	require.Contains(err.Error(), "AcceptedNFTBids")
+}
+
+func TestStorageMigrationRoundTrip(t *testing.T) {
+	// We skip this test in buildkite CI, but include it in GH actions postgres testing.
+	// Comment out this conditional to test locally.
+	if len(os.Getenv("POSTGRES_URI")) == 0 {
+		return
+	}
+	require := require.New(t)
+
+	chain, params, _ := NewLowDifficultyBlockchainWithParamsAndDb(t, &DeSoTestnetParams, false, 0, false)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	for ii := 0; ii < 5; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	blockHeight := uint64(chain.blockTip().Height)
+
+	// Add a few of every Postgres-backed entry type to badger.
+	m0PkBytes, _, err := Base58CheckDecode(m0Pub)
+	require.NoError(err)
+	m1PkBytes, _, err := Base58CheckDecode(m1Pub)
+	require.NoError(err)
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	view := NewUtxoView(chain.db, params, nil, chain.snapshot, nil)
+	view._setPKIDMappings(&PKIDEntry{PKID: m0PKID, PublicKey: m0PkBytes})
+	view._setPKIDMappings(&PKIDEntry{PKID: m1PKID, PublicKey: m1PkBytes})
+	view._setProfileEntryMappings(&ProfileEntry{
+		PublicKey:   m0PkBytes,
+		Username:    []byte("m0"),
+		Description: []byte("storage migration"),
+		CreatorCoinEntry: CoinEntry{
+			CreatorBasisPoints:      1000,
+			DeSoLockedNanos:         100,
+			NumberOfHolders:         1,
+			CoinsInCirculationNanos: *uint256.NewInt().SetUint64(10000),
+			CoinWatermarkNanos:      10000,
+		},
+		DAOCoinEntry: CoinEntry{
+			NumberOfHolders:         1,
+			CoinsInCirculationNanos: *uint256.NewInt().SetUint64(5000),
+		},
+		ExtraData: map[string][]byte{"key": []byte("value")},
+	})
+	postHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	view._setPostEntryMappings(&PostEntry{
+		PostHash:        postHash,
+		PosterPublicKey: m0PkBytes,
+		Body:            []byte(`{"Body":"storage migration"}`),
+		TimestampNanos:  1234,
+		LikeCount:       1,
+		DiamondCount:    1,
+		IsNFT:           true,
+		NumNFTCopies:    1,
+	})
+	view._setLikeEntryMappings(&LikeEntry{LikerPubKey: m1PkBytes, LikedPostHash: postHash})
+	view._setFollowEntryMappings(&FollowEntry{FollowerPKID: m1PKID, FollowedPKID: m0PKID})
+	view._setDiamondEntryMappings(&DiamondEntry{
+		SenderPKID: m1PKID, ReceiverPKID: m0PKID, DiamondPostHash: postHash, DiamondLevel: 1,
+	})
+	view._setBalanceEntryMappings(&BalanceEntry{
+		HODLerPKID: m1PKID, CreatorPKID: m0PKID, BalanceNanos: *uint256.NewInt().SetUint64(10000),
+		HasPurchased: true,
+	}, false /*isDAOCoin*/)
+	view._setBalanceEntryMappings(&BalanceEntry{
+		HODLerPKID: m0PKID, CreatorPKID: m0PKID, BalanceNanos: *uint256.NewInt().SetUint64(5000),
+	}, true /*isDAOCoin*/)
+	view._setNFTEntryMappings(&NFTEntry{
+		OwnerPKID: m0PKID, NFTPostHash: postHash, SerialNumber: 1, IsForSale: true, MinBidAmountNanos: 10,
+	})
+	view._setNFTBidEntryMappings(&NFTBidEntry{
+		BidderPKID: m1PKID, NFTPostHash: postHash, SerialNumber: 1, BidAmountNanos: 20,
+	})
+	require.NoError(view.FlushToDb(blockHeight))
+
+	postgres := NewPostgres(pg.Connect(ParsePostgresURI(os.Getenv("POSTGRES_URI"))))
+	require.NoError(ResetPostgres(postgres))
+
+	// Migrate badger to Postgres.
+	reports, err := MigrateBadgerToPostgres(chain.db, chain.snapshot, postgres, params, blockHeight)
+	require.NoError(err)
+	reportsByName := make(map[string]*StorageMigrationPrefixReport)
+	for _, report := range reports {
+		require.True(report.IsConsistent(), "%v", report)
+		reportsByName[report.Name] = report
+	}
+	require.Equal(uint64(6), reportsByName[storageMigrationBlockIndexName].NumEntriesMigrated)
+	for _, name := range []string{"Utxos", "PKIDs", "Posts", "Likes", "Follows", "Diamonds",
+		"CreatorCoinBalances", "DAOCoinBalances", "DeSoBalances", "NFTs", "NFTBids"} {
+		require.NotZero(reportsByName[name].NumEntriesMigrated, name)
+	}
+	require.Equal(uint64(1), reportsByName["Profiles"].NumPostgresEntries)
+
+	// Migrate Postgres back to a new badger, which ends up with the same entries as the first one.
+	roundTripDb, _ := GetTestBadgerDb()
+	defer CleanUpBadger(roundTripDb)
+	roundTripReports, err := MigratePostgresToBadger(postgres, roundTripDb, nil, params, blockHeight)
+	require.NoError(err)
+	require.Len(roundTripReports, len(reports))
+	for ii, roundTripReport := range roundTripReports {
+		require.True(roundTripReport.IsConsistent(), "%v", roundTripReport)
+		require.Equal(reports[ii].Name, roundTripReport.Name)
+		require.Equal(reports[ii].NumBadgerEntries, roundTripReport.NumBadgerEntries, roundTripReport.Name)
+		require.Equal(reports[ii].BadgerDigest, roundTripReport.BadgerDigest, roundTripReport.Name)
+	}
+	require.Equal(*chain.blockTip().Hash, *DbGetBestHash(roundTripDb, nil, ChainTypeDeSoBlock))
+}
+
+func getStorageMigrationEntryTypeForTest(t *testing.T, name string) *storageMigrationEntryType {
+	for _, entryType := range getStorageMigrationEntryTypes() {
+		if entryType.name == name {
+			return entryType
+		}
+	}
+	require.FailNow(t, "no storage migration entry type named "+name)
+	return nil
+}
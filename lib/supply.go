@@ -1,5 +1,14 @@
 package lib
 
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+)
+
 // supply.go defines all of the logic regarding the DeSo supply schedule. It also
 // defines the Bitcoin <-> DeSo exchange schedule.
 
@@ -121,6 +130,241 @@ func CalcBlockRewardNanos(blockHeight uint32, params *DeSoParams) uint64 {
 	return 0
 }
 
+// EmissionScheduleInterval describes a contiguous range of block heights that all
+// pay the same block reward. EndBlockHeight is exclusive.
+type EmissionScheduleInterval struct {
+	StartBlockHeight uint64
+	EndBlockHeight   uint64
+	BlockRewardNanos uint64
+	NumBlocks        uint64
+
+	// The portion of the interval's rewards that has already been minted as of the
+	// tip, and the portion that is projected to be minted after the tip.
+	HistoricalRewardNanos uint64
+	ProjectedRewardNanos  uint64
+
+	// The total amount minted via block rewards from genesis through the end of
+	// this interval.
+	CumulativeRewardNanos uint64
+
+	// What the interval's blocks through the tip minted as PoS staking rewards, paid
+	// out as creator coin founder rewards, and burned. These come from the
+	// EmissionIndex, so they only cover the blocks it has recorded.
+	StakingRewardNanos uint64
+	FounderRewardNanos uint64
+	BurnedNanos        uint64
+}
+
+// EmissionSchedule is the full block reward schedule for a network, split into
+// what has already been minted and what is projected to be minted, along with the
+// staking rewards, founder rewards, and burns that don't follow a fixed schedule.
+// Creator coin founder rewards transfer existing DESO from buyers to creators
+// rather than minting new DESO, so they're reported alongside emission rather than
+// as part of it.
+type EmissionSchedule struct {
+	TipHeight uint64
+	Intervals []*EmissionScheduleInterval
+
+	TotalHistoricalRewardNanos uint64
+	TotalProjectedRewardNanos  uint64
+	TotalRewardNanos           uint64
+
+	// The staking rewards, founder rewards, and burns of all the intervals. They're
+	// only set if IsEmissionIndexed is, in which case they cover the blocks from
+	// EmissionIndexStartHeight through the tip.
+	TotalStakingRewardNanos  uint64
+	TotalFounderRewardNanos  uint64
+	TotalBurnedNanos         uint64
+	IsEmissionIndexed        bool
+	EmissionIndexStartHeight uint64
+
+	// Staking rewards are projected from the current state as a year of rewards at
+	// the current APY on the stake of the current snapshot validator set.
+	StakingRewardsAPYBasisPoints      uint64
+	SnapshotStakeAmountNanos          *uint256.Int
+	ProjectedAnnualStakingRewardNanos uint64
+
+	// The total DESO created by burning Bitcoin. Unlike block rewards, this can't
+	// be derived from params and comes from the current state.
+	NanosPurchasedViaBitcoinBurn uint64
+}
+
+// GetEmissionSchedule computes the block reward schedule from MiningSupplyIntervals
+// and the PoS cutover height in params. Block rewards stop at the PoS cutover, so
+// every interval after it pays zero. The final interval is open-ended and always
+// pays zero, so its EndBlockHeight is math.MaxUint32. Staking rewards, founder
+// rewards, and burns depend on the state, so they're filled in by
+// UtxoView.GetEmissionSchedule.
+func GetEmissionSchedule(params *DeSoParams, tipHeight uint64, nanosPurchased uint64) (*EmissionSchedule, error) {
+	// Collect every height at which the block reward can change.
+	boundarySet := make(map[uint32]bool)
+	for _, intervalStart := range MiningSupplyIntervals {
+		boundarySet[intervalStart.StartBlockHeight] = true
+	}
+	posCutoverHeight := params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight
+	if posCutoverHeight < MiningSupplyIntervals[len(MiningSupplyIntervals)-1].StartBlockHeight {
+		boundarySet[posCutoverHeight] = true
+	}
+	boundaries := []uint32{}
+	for height := range boundarySet {
+		boundaries = append(boundaries, height)
+	}
+	sort.Slice(boundaries, func(ii, jj int) bool { return boundaries[ii] < boundaries[jj] })
+
+	schedule := &EmissionSchedule{
+		TipHeight:                    tipHeight,
+		NanosPurchasedViaBitcoinBurn: nanosPurchased,
+	}
+	for ii, startHeight := range boundaries {
+		endHeight := uint32(math.MaxUint32)
+		if ii+1 < len(boundaries) {
+			endHeight = boundaries[ii+1]
+		}
+		interval := &EmissionScheduleInterval{
+			StartBlockHeight: uint64(startHeight),
+			EndBlockHeight:   uint64(endHeight),
+			BlockRewardNanos: CalcBlockRewardNanos(startHeight, params),
+			NumBlocks:        uint64(endHeight - startHeight),
+		}
+		// Adjacent intervals that pay the same reward are merged so that the PoS
+		// cutover doesn't produce a run of zero-reward intervals.
+		if len(schedule.Intervals) > 0 {
+			prevInterval := schedule.Intervals[len(schedule.Intervals)-1]
+			if prevInterval.BlockRewardNanos == interval.BlockRewardNanos {
+				prevInterval.EndBlockHeight = interval.EndBlockHeight
+				prevInterval.NumBlocks += interval.NumBlocks
+				continue
+			}
+		}
+		schedule.Intervals = append(schedule.Intervals, interval)
+	}
+	if schedule.Intervals[len(schedule.Intervals)-1].BlockRewardNanos != 0 {
+		return nil, fmt.Errorf("GetEmissionSchedule: Final interval must have a zero block reward")
+	}
+
+	for _, interval := range schedule.Intervals {
+		// Blocks [StartBlockHeight, tipHeight] have already been mined.
+		historicalBlocks := uint64(0)
+		if tipHeight >= interval.StartBlockHeight {
+			historicalBlocks = tipHeight - interval.StartBlockHeight + 1
+			if historicalBlocks > interval.NumBlocks {
+				historicalBlocks = interval.NumBlocks
+			}
+		}
+		var err error
+		interval.HistoricalRewardNanos, err = SafeUint64().Mul(historicalBlocks, interval.BlockRewardNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetEmissionSchedule: Problem computing historical reward")
+		}
+		interval.ProjectedRewardNanos, err = SafeUint64().Mul(interval.NumBlocks-historicalBlocks, interval.BlockRewardNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetEmissionSchedule: Problem computing projected reward")
+		}
+		schedule.TotalHistoricalRewardNanos += interval.HistoricalRewardNanos
+		schedule.TotalProjectedRewardNanos += interval.ProjectedRewardNanos
+		schedule.TotalRewardNanos += interval.HistoricalRewardNanos + interval.ProjectedRewardNanos
+		interval.CumulativeRewardNanos = schedule.TotalRewardNanos
+	}
+	if schedule.TotalRewardNanos > MaxNanos {
+		return nil, fmt.Errorf("GetEmissionSchedule: Total reward %v exceeds MaxNanos %v",
+			schedule.TotalRewardNanos, MaxNanos)
+	}
+	return schedule, nil
+}
+
+// AddEmissionIndexFigures sets the staking rewards, founder rewards, and burns of each
+// interval from the blocks the EmissionIndex has recorded through the tip.
+func (schedule *EmissionSchedule) AddEmissionIndexFigures(emissionIndex *EmissionIndex) error {
+	firstEntry, err := emissionIndex.GetFirstEntry()
+	if err != nil {
+		return errors.Wrapf(err, "AddEmissionIndexFigures: ")
+	}
+	if firstEntry == nil || firstEntry.BlockHeight > schedule.TipHeight {
+		return nil
+	}
+	schedule.IsEmissionIndexed = true
+	schedule.EmissionIndexStartHeight = firstEntry.BlockHeight
+
+	// The figures for an interval are the running totals through its last block
+	// before the tip, less the running totals through the block before it starts.
+	getTotalsThrough := func(height uint64) (*EmissionIndexEntry, error) {
+		entry, err := emissionIndex.GetEntryAtOrBeforeHeight(height)
+		if err != nil || entry != nil {
+			return entry, err
+		}
+		return &EmissionIndexEntry{}, nil
+	}
+	for _, interval := range schedule.Intervals {
+		if interval.StartBlockHeight > schedule.TipHeight {
+			break
+		}
+		endHeight := interval.EndBlockHeight - 1
+		if endHeight > schedule.TipHeight {
+			endHeight = schedule.TipHeight
+		}
+		endTotals, err := getTotalsThrough(endHeight)
+		if err != nil {
+			return errors.Wrapf(err, "AddEmissionIndexFigures: ")
+		}
+		startTotals := &EmissionIndexEntry{}
+		if interval.StartBlockHeight > 0 {
+			if startTotals, err = getTotalsThrough(interval.StartBlockHeight - 1); err != nil {
+				return errors.Wrapf(err, "AddEmissionIndexFigures: ")
+			}
+		}
+		interval.StakingRewardNanos = endTotals.CumulativeStakingRewardNanos - startTotals.CumulativeStakingRewardNanos
+		interval.FounderRewardNanos = endTotals.CumulativeFounderRewardNanos - startTotals.CumulativeFounderRewardNanos
+		interval.BurnedNanos = endTotals.CumulativeBurnedNanos - startTotals.CumulativeBurnedNanos
+		schedule.TotalStakingRewardNanos += interval.StakingRewardNanos
+		schedule.TotalFounderRewardNanos += interval.FounderRewardNanos
+		schedule.TotalBurnedNanos += interval.BurnedNanos
+	}
+	return nil
+}
+
+// GetEmissionSchedule returns the emission schedule as of the given tip, using the
+// view's NanosPurchased for the Bitcoin burn total and its global params and snapshot
+// validator set to project staking rewards. If an EmissionIndex is passed, the staking
+// rewards, founder rewards, and burns of each interval are filled in from it.
+func (bav *UtxoView) GetEmissionSchedule(tipHeight uint64, emissionIndex *EmissionIndex) (*EmissionSchedule, error) {
+	schedule, err := GetEmissionSchedule(bav.Params, tipHeight, bav.NanosPurchased)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.StakingRewardsAPYBasisPoints = bav.GetCurrentGlobalParamsEntry().StakingRewardsAPYBasisPoints
+	snapshotValidatorSet, err := bav.GetAllSnapshotValidatorSetEntriesByStake()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetEmissionSchedule: Problem getting snapshot validator set: ")
+	}
+	schedule.SnapshotStakeAmountNanos = uint256.NewInt()
+	for _, validatorEntry := range snapshotValidatorSet {
+		schedule.SnapshotStakeAmountNanos, err = SafeUint256().Add(
+			schedule.SnapshotStakeAmountNanos, validatorEntry.TotalStakeAmountNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetEmissionSchedule: Problem summing snapshot stake: ")
+		}
+	}
+	if schedule.StakingRewardsAPYBasisPoints > 0 {
+		growthMultiplier := computeGrowthMultiplier(
+			convertAPYBasisPointsToFloat(schedule.StakingRewardsAPYBasisPoints), NewFloat().SetUint64(1))
+		annualRewardNanos := convertBigFloatToBigInt(
+			computeStakingReward(schedule.SnapshotStakeAmountNanos, growthMultiplier))
+		if !annualRewardNanos.IsUint64() {
+			return nil, fmt.Errorf("GetEmissionSchedule: Projected staking reward %v is not a uint64",
+				annualRewardNanos)
+		}
+		schedule.ProjectedAnnualStakingRewardNanos = annualRewardNanos.Uint64()
+	}
+
+	if emissionIndex != nil {
+		if err = schedule.AddEmissionIndexFigures(emissionIndex); err != nil {
+			return nil, errors.Wrapf(err, "GetEmissionSchedule: ")
+		}
+	}
+	return schedule, nil
+}
+
 func GetStartPriceSatoshisPerDeSo(usdCentsPerBitcoinExchangeRate uint64) uint64 {
 	return StartDeSoPriceUSDCents * SatoshisPerBitcoin / usdCentsPerBitcoinExchangeRate
 }
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package lib
 
 import (
@@ -6,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/holiman/uint256"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -66,6 +69,76 @@ func TestCalcBlockReward(t *testing.T) {
 	require.Equal(uint64(0), CalcBlockRewardNanos(math.MaxUint32, &GlobalDeSoParams))
 }
 
+func TestGetEmissionSchedule(t *testing.T) {
+	require := require.New(t)
+
+	// Without a PoS cutover the schedule should match the full mining supply.
+	setPoSBlockHeights(t, math.MaxUint32, math.MaxUint32)
+	schedule, err := GetEmissionSchedule(&GlobalDeSoParams, uint64(DeflationBombBlockRewardAdjustmentBlockHeight-1), 123)
+	require.NoError(err)
+	require.Equal(len(MiningSupplyIntervals), len(schedule.Intervals))
+	require.Equal(uint64(276238800000000), schedule.TotalRewardNanos)
+	require.Equal(uint64(DeflationBombBlockRewardAdjustmentBlockHeight)*NanosPerUnit, schedule.TotalHistoricalRewardNanos)
+	require.Equal(schedule.TotalRewardNanos, schedule.TotalHistoricalRewardNanos+schedule.TotalProjectedRewardNanos)
+	require.Equal(uint64(123), schedule.NanosPurchasedViaBitcoinBurn)
+	require.Equal(schedule.TotalRewardNanos, schedule.Intervals[len(schedule.Intervals)-1].CumulativeRewardNanos)
+	require.Equal(uint64(0), schedule.Intervals[len(schedule.Intervals)-1].BlockRewardNanos)
+
+	// With a PoS cutover, rewards stop at the cutover and the tail collapses into a
+	// single zero-reward interval.
+	posCutoverHeight := 10 * BlocksPerYear
+	setPoSBlockHeights(t, 1, posCutoverHeight)
+	schedule, err = GetEmissionSchedule(&GlobalDeSoParams, math.MaxUint32, 0)
+	require.NoError(err)
+	require.Equal(6+1, len(schedule.Intervals))
+	lastInterval := schedule.Intervals[len(schedule.Intervals)-1]
+	require.Equal(uint64(posCutoverHeight), lastInterval.StartBlockHeight)
+	require.Equal(uint64(0), lastInterval.BlockRewardNanos)
+	expectedTotal := uint64(DeflationBombBlockRewardAdjustmentBlockHeight)*NanosPerUnit +
+		uint64(BlocksPerDay)*(NanosPerUnit*3/4+NanosPerUnit/2+NanosPerUnit/4+NanosPerUnit/8) +
+		uint64(posCutoverHeight-DeflationBombBlockRewardAdjustmentBlockHeight-4*BlocksPerDay)*(NanosPerUnit/10)
+	require.Equal(expectedTotal, schedule.TotalRewardNanos)
+	require.Equal(expectedTotal, schedule.TotalHistoricalRewardNanos)
+	require.Equal(uint64(0), schedule.TotalProjectedRewardNanos)
+}
+
+func TestUtxoViewGetEmissionSchedule(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 10 * BlocksPerYear
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	utxoView.NanosPurchased = 123
+
+	// Without any stake in the snapshot validator set, there are no staking rewards to project.
+	schedule, err := utxoView.GetEmissionSchedule(uint64(params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight), nil)
+	require.NoError(err)
+	require.Equal(uint64(123), schedule.NanosPurchasedViaBitcoinBurn)
+	require.Equal(params.DefaultStakingRewardsAPYBasisPoints, schedule.StakingRewardsAPYBasisPoints)
+	require.True(schedule.SnapshotStakeAmountNanos.IsZero())
+	require.Equal(uint64(0), schedule.ProjectedAnnualStakingRewardNanos)
+	require.False(schedule.IsEmissionIndexed)
+
+	// With 1,000 DESO staked in the snapshot validator set at a 10% APY, a year of continuously
+	// compounded rewards is 1,000 * (e^0.1 - 1) DESO.
+	for ii, publicKey := range [][]byte{m0PkBytes, m1PkBytes} {
+		votingPublicKey, _ := _generateVotingPublicKeyAndAuthorization(t, publicKey)
+		utxoView._setSnapshotValidatorSetEntry(&ValidatorEntry{
+			ValidatorPKID:         NewPKID(publicKey),
+			VotingPublicKey:       votingPublicKey,
+			TotalStakeAmountNanos: uint256.NewInt().SetUint64(uint64(400+200*ii) * NanosPerUnit),
+		}, 0)
+	}
+	utxoView.GlobalParamsEntry = &GlobalParamsEntry{StakingRewardsAPYBasisPoints: 1000}
+	schedule, err = utxoView.GetEmissionSchedule(uint64(params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight), nil)
+	require.NoError(err)
+	require.Equal(uint64(1000), schedule.StakingRewardsAPYBasisPoints)
+	require.Equal(uint256.NewInt().SetUint64(1000*NanosPerUnit), schedule.SnapshotStakeAmountNanos)
+	require.InDelta(1000*(math.Exp(0.1)-1)*float64(NanosPerUnit), float64(schedule.ProjectedAnnualStakingRewardNanos), 1000)
+}
+
 func TestGetPrice(t *testing.T) {
 	oldInitialUSDCentsPerBitcoinExchangeRate := InitialUSDCentsPerBitcoinExchangeRate
 	InitialUSDCentsPerBitcoinExchangeRate = 1350000
@@ -0,0 +1,319 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Telemetry is strictly opt-in. A node only publishes reports when it has been
+// configured with at least one collector URL. Reports never include IP addresses,
+// public keys, or anything else that identifies the operator. Each run of the node
+// generates a fresh random TelemetryNodeID so collectors can de-duplicate reports
+// without being able to link them across restarts.
+
+const DefaultTelemetryIntervalSeconds = 300
+
+// Collectors accept reports via POST on RoutePathTelemetryReport and serve the
+// aggregate of the reports they've received via GET on RoutePathTelemetryNetworkStats.
+const RoutePathTelemetryReport = "/api/v0/telemetry-report"
+const RoutePathTelemetryNetworkStats = "/api/v0/telemetry-network-stats"
+
+// TelemetryReport is the anonymized snapshot of a node's state that is published
+// to telemetry collectors.
+type TelemetryReport struct {
+	TelemetryNodeID string
+	NetworkType     string
+	UserAgent       string
+	ProtocolVersion uint64
+	// LatestEncoderMigration is the name of the most recent encoder migration the
+	// node knows about. It changes with every release that schedules a fork, so it
+	// is a good proxy for whether a node has upgraded.
+	LatestEncoderMigration string
+	BlockTipHeight         uint64
+	HeaderTipHeight        uint64
+	NumPeers               uint64
+	// NextForkName and NextForkHeight describe the first fork above the node's block
+	// tip that the node has scheduled. They are empty if no fork is scheduled.
+	NextForkName   string
+	NextForkHeight uint64
+	TimestampSecs  uint64
+}
+
+// TelemetryNetworkStats is the aggregate feed served by collectors.
+type TelemetryNetworkStats struct {
+	NumNodes                     uint64
+	UserAgentCounts              map[string]uint64
+	ProtocolVersionCounts        map[uint64]uint64
+	LatestEncoderMigrationCounts map[string]uint64
+	// NextForkCounts maps a fork name to the number of nodes that have it scheduled.
+	NextForkCounts       map[string]uint64
+	MedianBlockTipHeight uint64
+	MaxBlockTipHeight    uint64
+	MedianNumPeers       uint64
+	TimestampSecs        uint64
+}
+
+// NewTelemetryReport builds the report for a node with the given tips and peer count.
+func NewTelemetryReport(params *DeSoParams, telemetryNodeID string, blockTipHeight uint64,
+	headerTipHeight uint64, numPeers uint64) (*TelemetryReport, error) {
+
+	report := &TelemetryReport{
+		TelemetryNodeID: telemetryNodeID,
+		NetworkType:     params.NetworkType.String(),
+		UserAgent:       params.UserAgent,
+		ProtocolVersion: params.ProtocolVersion.ToUint64(),
+		BlockTipHeight:  blockTipHeight,
+		HeaderTipHeight: headerTipHeight,
+		NumPeers:        numPeers,
+		TimestampSecs:   uint64(time.Now().Unix()),
+	}
+	if len(params.EncoderMigrationHeightsList) > 0 {
+		report.LatestEncoderMigration = string(
+			params.EncoderMigrationHeightsList[len(params.EncoderMigrationHeightsList)-1].Name)
+	}
+
+	nextFork, err := GetNextScheduledFork(params, blockTipHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewTelemetryReport: ")
+	}
+	if nextFork != nil {
+		report.NextForkName = nextFork.Name
+		report.NextForkHeight = nextFork.Height
+	}
+	return report, nil
+}
+
+// AggregateTelemetryReports computes the TelemetryNetworkStats for a set of reports.
+// Collectors can use it to serve the aggregate feed. If a node sent more than one
+// report, only its latest report is counted.
+func AggregateTelemetryReports(reports []*TelemetryReport) *TelemetryNetworkStats {
+	latestReports := make(map[string]*TelemetryReport)
+	for _, report := range reports {
+		if existingReport, exists := latestReports[report.TelemetryNodeID]; exists &&
+			existingReport.TimestampSecs >= report.TimestampSecs {
+			continue
+		}
+		latestReports[report.TelemetryNodeID] = report
+	}
+
+	stats := &TelemetryNetworkStats{
+		UserAgentCounts:              make(map[string]uint64),
+		ProtocolVersionCounts:        make(map[uint64]uint64),
+		LatestEncoderMigrationCounts: make(map[string]uint64),
+		NextForkCounts:               make(map[string]uint64),
+		TimestampSecs:                uint64(time.Now().Unix()),
+	}
+	var blockTipHeights, numPeers []uint64
+	for _, report := range latestReports {
+		stats.NumNodes++
+		stats.UserAgentCounts[report.UserAgent]++
+		stats.ProtocolVersionCounts[report.ProtocolVersion]++
+		if report.LatestEncoderMigration != "" {
+			stats.LatestEncoderMigrationCounts[report.LatestEncoderMigration]++
+		}
+		if report.NextForkName != "" {
+			stats.NextForkCounts[report.NextForkName]++
+		}
+		if report.BlockTipHeight > stats.MaxBlockTipHeight {
+			stats.MaxBlockTipHeight = report.BlockTipHeight
+		}
+		blockTipHeights = append(blockTipHeights, report.BlockTipHeight)
+		numPeers = append(numPeers, report.NumPeers)
+	}
+	stats.MedianBlockTipHeight = _medianUint64(blockTipHeights)
+	stats.MedianNumPeers = _medianUint64(numPeers)
+	return stats
+}
+
+// ForkReadiness returns the fraction of reporting nodes that have the given fork
+// scheduled. Operators can use it to judge whether enough of the network has
+// upgraded ahead of a fork height.
+func (stats *TelemetryNetworkStats) ForkReadiness(forkName string) float64 {
+	if stats.NumNodes == 0 {
+		return 0
+	}
+	return float64(stats.NextForkCounts[forkName]) / float64(stats.NumNodes)
+}
+
+func _medianUint64(values []uint64) uint64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Slice(values, func(ii, jj int) bool {
+		return values[ii] < values[jj]
+	})
+	return values[len(values)/2]
+}
+
+// TelemetryBeacon periodically publishes a TelemetryReport to each configured
+// collector, and refreshes its view of the network from the collectors' aggregate feeds.
+type TelemetryBeacon struct {
+	srv             *Server
+	params          *DeSoParams
+	collectorURLs   []string
+	interval        time.Duration
+	telemetryNodeID string
+	httpClient      *http.Client
+
+	networkStats     map[string]*TelemetryNetworkStats
+	networkStatsLock sync.RWMutex
+
+	stopChannel chan struct{}
+	waitGroup   sync.WaitGroup
+}
+
+func NewTelemetryBeacon(srv *Server, params *DeSoParams, collectorURLs []string,
+	intervalSeconds uint64) (*TelemetryBeacon, error) {
+
+	if len(collectorURLs) == 0 {
+		return nil, fmt.Errorf("NewTelemetryBeacon: At least one collector URL is required")
+	}
+	if intervalSeconds == 0 {
+		intervalSeconds = DefaultTelemetryIntervalSeconds
+	}
+	telemetryNodeIDBytes := make([]byte, 16)
+	if _, err := rand.Read(telemetryNodeIDBytes); err != nil {
+		return nil, errors.Wrapf(err, "NewTelemetryBeacon: Problem generating telemetry node id: ")
+	}
+	return &TelemetryBeacon{
+		srv:             srv,
+		params:          params,
+		collectorURLs:   collectorURLs,
+		interval:        time.Duration(intervalSeconds) * time.Second,
+		telemetryNodeID: hex.EncodeToString(telemetryNodeIDBytes),
+		httpClient:      &http.Client{Timeout: 30 * time.Second},
+		networkStats:    make(map[string]*TelemetryNetworkStats),
+		stopChannel:     make(chan struct{}),
+	}, nil
+}
+
+func (tb *TelemetryBeacon) Start() {
+	glog.Infof("TelemetryBeacon: Publishing telemetry to %v every %v", tb.collectorURLs, tb.interval)
+
+	tb.waitGroup.Add(1)
+	go func() {
+		defer tb.waitGroup.Done()
+		for {
+			tb.publishAndRefresh()
+			select {
+			case <-tb.stopChannel:
+				return
+			case <-time.After(tb.interval):
+			}
+		}
+	}()
+}
+
+func (tb *TelemetryBeacon) Stop() {
+	glog.Info("TelemetryBeacon: Stopping")
+	close(tb.stopChannel)
+	tb.waitGroup.Wait()
+}
+
+// GetNetworkStats returns the latest aggregate feed fetched from each collector,
+// keyed by collector URL.
+func (tb *TelemetryBeacon) GetNetworkStats() map[string]*TelemetryNetworkStats {
+	tb.networkStatsLock.RLock()
+	defer tb.networkStatsLock.RUnlock()
+
+	networkStats := make(map[string]*TelemetryNetworkStats, len(tb.networkStats))
+	for collectorURL, stats := range tb.networkStats {
+		networkStats[collectorURL] = stats
+	}
+	return networkStats
+}
+
+func (tb *TelemetryBeacon) buildReport() (*TelemetryReport, error) {
+	bc := tb.srv.GetBlockchain()
+	cmgr := tb.srv.GetConnectionManager()
+	numPeers := uint64(cmgr.GetNumInboundPeers()) + uint64(cmgr.GetNumOutboundPeers())
+	return NewTelemetryReport(
+		tb.params, tb.telemetryNodeID, uint64(bc.BlockTip().Height), uint64(bc.HeaderTip().Height), numPeers)
+}
+
+func (tb *TelemetryBeacon) publishAndRefresh() {
+	report, err := tb.buildReport()
+	if err != nil {
+		glog.Errorf("TelemetryBeacon: Problem building report: %v", err)
+		return
+	}
+	for _, collectorURL := range tb.collectorURLs {
+		if err = tb.publishReport(collectorURL, report); err != nil {
+			glog.Errorf("TelemetryBeacon: %v", err)
+		}
+		stats, err := FetchTelemetryNetworkStats(tb.httpClient, collectorURL)
+		if err != nil {
+			glog.Errorf("TelemetryBeacon: %v", err)
+			continue
+		}
+		tb.networkStatsLock.Lock()
+		tb.networkStats[collectorURL] = stats
+		tb.networkStatsLock.Unlock()
+
+		glog.Infof("TelemetryBeacon: Network health from %v: %d nodes, median block height %d, "+
+			"max block height %d, median peers %d", collectorURL, stats.NumNodes,
+			stats.MedianBlockTipHeight, stats.MaxBlockTipHeight, stats.MedianNumPeers)
+		if report.NextForkName != "" {
+			glog.Infof("TelemetryBeacon: %.1f%% of nodes reporting to %v have %v scheduled at height %d",
+				100*stats.ForkReadiness(report.NextForkName), collectorURL, report.NextForkName,
+				report.NextForkHeight)
+		}
+	}
+}
+
+func (tb *TelemetryBeacon) publishReport(collectorURL string, report *TelemetryReport) error {
+	reportBytes, err := json.Marshal(report)
+	if err != nil {
+		return errors.Wrapf(err, "publishReport: Problem encoding report")
+	}
+	url := fmt.Sprintf("%s%s", collectorURL, RoutePathTelemetryReport)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reportBytes))
+	if err != nil {
+		return errors.Wrapf(err, "publishReport: Problem creating HTTP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tb.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "publishReport: Problem sending HTTP request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("publishReport: Collector %v returned status %d", collectorURL, resp.StatusCode)
+	}
+	return nil
+}
+
+// FetchTelemetryNetworkStats fetches the aggregate feed from a telemetry collector.
+func FetchTelemetryNetworkStats(client *http.Client, collectorURL string) (*TelemetryNetworkStats, error) {
+	url := fmt.Sprintf("%s%s", collectorURL, RoutePathTelemetryNetworkStats)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "FetchTelemetryNetworkStats: Problem creating HTTP request")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "FetchTelemetryNetworkStats: Problem sending HTTP request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("FetchTelemetryNetworkStats: Collector %v returned status %d",
+			collectorURL, resp.StatusCode)
+	}
+	stats := &TelemetryNetworkStats{}
+	if err = json.NewDecoder(resp.Body).Decode(stats); err != nil {
+		return nil, errors.Wrapf(err, "FetchTelemetryNetworkStats: Problem decoding response data")
+	}
+	return stats, nil
+}
@@ -0,0 +1,79 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetryReportsAndNetworkStats(t *testing.T) {
+	params := DeSoTestnetParams
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 2000000
+	params.ForkHeights.BlockProducerAttestationBlockHeight = 3000000
+
+	// The next fork is the first scheduled fork above the block tip.
+	report, err := NewTelemetryReport(&params, "node1", 1500000, 1600000, 8)
+	require.NoError(t, err)
+	require.Equal(t, "TESTNET", report.NetworkType)
+	require.Equal(t, params.UserAgent, report.UserAgent)
+	require.Equal(t, uint64(1600000), report.HeaderTipHeight)
+	require.Equal(t, "ProofOfStake2ConsensusCutoverBlockHeight", report.NextForkName)
+	require.Equal(t, uint64(2000000), report.NextForkHeight)
+
+	// Forks that aren't scheduled yet are never reported.
+	params.ForkHeights.BlockProducerAttestationBlockHeight = math.MaxUint32
+	report, err = NewTelemetryReport(&params, "node1", 2500000, 2500000, 8)
+	require.NoError(t, err)
+	require.Empty(t, report.NextForkName)
+	require.Equal(t, uint64(0), report.NextForkHeight)
+
+	reports := []*TelemetryReport{
+		{TelemetryNodeID: "node1", UserAgent: "a", BlockTipHeight: 100, NumPeers: 5, TimestampSecs: 1},
+		{TelemetryNodeID: "node1", UserAgent: "b", BlockTipHeight: 110, NumPeers: 7, NextForkName: "Fork",
+			TimestampSecs: 2},
+		{TelemetryNodeID: "node2", UserAgent: "b", BlockTipHeight: 105, NumPeers: 3, NextForkName: "Fork",
+			TimestampSecs: 1},
+		{TelemetryNodeID: "node3", UserAgent: "a", BlockTipHeight: 90, NumPeers: 9, TimestampSecs: 1},
+		{TelemetryNodeID: "node4", UserAgent: "b", BlockTipHeight: 108, NumPeers: 8, TimestampSecs: 1},
+	}
+
+	// Collectors serve the aggregate of the latest report from each node.
+	var receivedReports []*TelemetryReport
+	collector := httptest.NewServer(http.HandlerFunc(func(ww http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case RoutePathTelemetryReport:
+			receivedReport := &TelemetryReport{}
+			require.NoError(t, json.NewDecoder(req.Body).Decode(receivedReport))
+			receivedReports = append(receivedReports, receivedReport)
+		case RoutePathTelemetryNetworkStats:
+			require.NoError(t, json.NewEncoder(ww).Encode(AggregateTelemetryReports(receivedReports)))
+		default:
+			ww.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer collector.Close()
+
+	beacon, err := NewTelemetryBeacon(nil, &params, []string{collector.URL}, 0)
+	require.NoError(t, err)
+	for _, report := range reports {
+		require.NoError(t, beacon.publishReport(collector.URL, report))
+	}
+	stats, err := FetchTelemetryNetworkStats(beacon.httpClient, collector.URL)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), stats.NumNodes)
+	require.Equal(t, map[string]uint64{"a": 1, "b": 3}, stats.UserAgentCounts)
+	require.Equal(t, uint64(110), stats.MaxBlockTipHeight)
+	require.Equal(t, uint64(108), stats.MedianBlockTipHeight)
+	require.Equal(t, uint64(8), stats.MedianNumPeers)
+	require.Equal(t, 0.5, stats.ForkReadiness("Fork"))
+	require.Equal(t, float64(0), stats.ForkReadiness("OtherFork"))
+
+	_, err = NewTelemetryBeacon(nil, &params, nil, 0)
+	require.Error(t, err)
+}
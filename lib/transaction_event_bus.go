@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Indexers that follow the chain through the EventManager get whole blocks, and have to
+// re-implement the connect logic to figure out what each txn did. The TransactionEventBus
+// turns block and mempool events into one event per txn, with the UtxoOperations the txn
+// produced when they're available, so an indexer can register a single listener instead.
+//
+// Listeners are called synchronously from the goroutine that connected the block or
+// accepted the txn, often while the ChainLock or the mempool's lock is held, so they must
+// return quickly and must not call back into the Blockchain or the mempool. A listener that
+// does real work should queue the events and process them on its own goroutine. Listeners
+// can register and unregister listeners, including themselves, while they're called.
+
+type TransactionEventKind uint8
+
+const (
+	// The txn was connected as part of a block on the best chain.
+	TransactionEventKindConnected TransactionEventKind = 1
+	// The txn was disconnected because its block left the best chain.
+	TransactionEventKindDisconnected TransactionEventKind = 2
+	// The txn was accepted into the mempool, either directly or along with the txn whose
+	// outputs it spends, e.g. when the mempool is loaded from its journal.
+	TransactionEventKindMempoolAccepted TransactionEventKind = 3
+)
+
+func (kind TransactionEventKind) String() string {
+	switch kind {
+	case TransactionEventKindConnected:
+		return "CONNECTED"
+	case TransactionEventKindDisconnected:
+		return "DISCONNECTED"
+	case TransactionEventKindMempoolAccepted:
+		return "MEMPOOL_ACCEPTED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// TypedTransactionEvent is a single event on the TransactionEventBus.
+type TypedTransactionEvent struct {
+	Kind    TransactionEventKind
+	Txn     *MsgDeSoTxn
+	TxnHash *BlockHash
+	TxnType TxnType
+	// AffectedPublicKeys are the public keys the txn touches. See GetPublicKeysTouchedByTxn.
+	AffectedPublicKeys [][]byte
+
+	// The block the txn was connected or disconnected in, and the txn's index in it. They
+	// aren't set for mempool events.
+	BlockHash       *BlockHash
+	BlockHeight     uint64
+	TxnIndexInBlock uint64
+
+	// Optional. UtxoOps are the operations the txn performed, which hold the entries it
+	// changed as they were before it was connected. They're set for connected and
+	// disconnected txns when the block's operations are available. UtxoView is a copy of the
+	// view the block was connected to, which holds the entries after the whole block was
+	// connected. It's shared by the events of the block's txns, so listeners shouldn't
+	// modify it.
+	UtxoOps  []*UtxoOperation
+	UtxoView *UtxoView
+}
+
+type TransactionEventListener func(event *TypedTransactionEvent)
+
+type TransactionEventBus struct {
+	blockchain *Blockchain
+
+	mtx            sync.RWMutex
+	listeners      map[uint64]TransactionEventListener
+	nextListenerID uint64
+}
+
+func NewTransactionEventBus(blockchain *Blockchain) *TransactionEventBus {
+	return &TransactionEventBus{
+		blockchain: blockchain,
+		listeners:  make(map[uint64]TransactionEventListener),
+	}
+}
+
+// RegisterTransactionEventListener registers a listener for every txn event and returns an
+// ID that can be used to unregister it.
+func (bus *TransactionEventBus) RegisterTransactionEventListener(listener TransactionEventListener) uint64 {
+	bus.mtx.Lock()
+	defer bus.mtx.Unlock()
+
+	bus.nextListenerID++
+	bus.listeners[bus.nextListenerID] = listener
+	return bus.nextListenerID
+}
+
+func (bus *TransactionEventBus) UnregisterTransactionEventListener(listenerID uint64) {
+	bus.mtx.Lock()
+	defer bus.mtx.Unlock()
+
+	delete(bus.listeners, listenerID)
+}
+
+func (bus *TransactionEventBus) _hasListeners() bool {
+	bus.mtx.RLock()
+	defer bus.mtx.RUnlock()
+
+	return len(bus.listeners) > 0
+}
+
+func (bus *TransactionEventBus) _emit(event *TypedTransactionEvent) {
+	// Listeners are called without holding the lock, so that they can unregister themselves.
+	bus.mtx.RLock()
+	listeners := make([]TransactionEventListener, 0, len(bus.listeners))
+	for _, listener := range bus.listeners {
+		listeners = append(listeners, listener)
+	}
+	bus.mtx.RUnlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+func (bus *TransactionEventBus) _newEvent(kind TransactionEventKind, txn *MsgDeSoTxn) *TypedTransactionEvent {
+	return &TypedTransactionEvent{
+		Kind:               kind,
+		Txn:                txn,
+		TxnHash:            txn.Hash(),
+		TxnType:            txn.TxnMeta.GetTxnType(),
+		AffectedPublicKeys: GetPublicKeysTouchedByTxn(txn, bus.blockchain.params),
+	}
+}
+
+// HandleBlockConnected is registered with the EventManager for connected blocks. It emits an
+// event for each of the block's txns, in order, starting with the block reward.
+func (bus *TransactionEventBus) HandleBlockConnected(event *BlockEvent) {
+	if !bus._hasListeners() {
+		return
+	}
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		glog.Errorf("TransactionEventBus.HandleBlockConnected: Problem hashing block: %v", err)
+		return
+	}
+
+	// Blocks connected through a reorg don't come with their operations, so look them up.
+	utxoOps := event.UtxoOps
+	if utxoOps == nil {
+		utxoOps, err = GetUtxoOperationsForBlock(bus.blockchain.db, bus.blockchain.snapshot, blockHash)
+		if err != nil {
+			glog.V(1).Infof("TransactionEventBus.HandleBlockConnected: No operations for block %v: %v",
+				blockHash, err)
+		}
+	}
+	if len(utxoOps) != len(event.Block.Txns) {
+		utxoOps = nil
+	}
+	// The view is copied so that listeners can't change the one the block was connected to.
+	var utxoView *UtxoView
+	if event.UtxoView != nil {
+		utxoView = event.UtxoView.CopyUtxoView()
+	}
+
+	for ii, txn := range event.Block.Txns {
+		txnEvent := bus._newEvent(TransactionEventKindConnected, txn)
+		txnEvent.BlockHash = blockHash
+		txnEvent.BlockHeight = event.Block.Header.Height
+		txnEvent.TxnIndexInBlock = uint64(ii)
+		txnEvent.UtxoView = utxoView
+		if utxoOps != nil {
+			txnEvent.UtxoOps = utxoOps[ii]
+		}
+		bus._emit(txnEvent)
+	}
+}
+
+// HandleBlockDisconnected is registered with the EventManager for disconnected blocks. It
+// emits an event for each of the block's txns in the reverse order, which is the order they
+// were disconnected in, with the operations the disconnect reverted when they're available.
+func (bus *TransactionEventBus) HandleBlockDisconnected(event *BlockEvent) {
+	if !bus._hasListeners() {
+		return
+	}
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		glog.Errorf("TransactionEventBus.HandleBlockDisconnected: Problem hashing block: %v", err)
+		return
+	}
+	utxoOps := event.UtxoOps
+	if len(utxoOps) != len(event.Block.Txns) {
+		utxoOps = nil
+	}
+
+	for ii := len(event.Block.Txns) - 1; ii >= 0; ii-- {
+		txnEvent := bus._newEvent(TransactionEventKindDisconnected, event.Block.Txns[ii])
+		txnEvent.BlockHash = blockHash
+		txnEvent.BlockHeight = event.Block.Header.Height
+		txnEvent.TxnIndexInBlock = uint64(ii)
+		if utxoOps != nil {
+			txnEvent.UtxoOps = utxoOps[ii]
+		}
+		bus._emit(txnEvent)
+	}
+}
+
+// NotifyMempoolAccepted should be called whenever a txn is added to the mempool. It does
+// nothing on a nil bus.
+func (bus *TransactionEventBus) NotifyMempoolAccepted(txn *MsgDeSoTxn) {
+	if bus == nil || !bus._hasListeners() {
+		return
+	}
+	bus._emit(bus._newEvent(TransactionEventKindMempoolAccepted, txn))
+}
@@ -0,0 +1,151 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionEventBus(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, _, _ := _setupFiveBlocks(t)
+	bus := NewTransactionEventBus(chain)
+
+	var events []*TypedTransactionEvent
+	listenerID := bus.RegisterTransactionEventListener(func(event *TypedTransactionEvent) {
+		events = append(events, event)
+	})
+
+	// A block with a block reward and two transfers, each with its own operations.
+	blockReward := &MsgDeSoTxn{
+		TxOutputs: []*DeSoOutput{{PublicKey: m0PkBytes, AmountNanos: 1}},
+		TxnMeta:   &BlockRewardMetadataa{ExtraData: []byte{1}},
+	}
+	firstTransfer := &MsgDeSoTxn{PublicKey: m1PkBytes, TxnMeta: &BasicTransferMetadata{}}
+	secondTransfer := &MsgDeSoTxn{PublicKey: m2PkBytes, TxnMeta: &BasicTransferMetadata{}}
+	block := &MsgDeSoBlock{
+		Header: &MsgDeSoHeader{Height: 6},
+		Txns:   []*MsgDeSoTxn{blockReward, firstTransfer, secondTransfer},
+	}
+	blockHash, err := block.Hash()
+	require.NoError(err)
+	utxoOps := [][]*UtxoOperation{
+		{{Type: OperationTypeAddUtxo}},
+		{{Type: OperationTypeSpendUtxo}},
+		{{Type: OperationTypeSpendUtxo}, {Type: OperationTypeAddUtxo}},
+	}
+	utxoView := NewUtxoView(chain.db, params, nil, chain.snapshot, nil)
+
+	// Connected txns are emitted in order with their operations and a copy of the view.
+	bus.HandleBlockConnected(&BlockEvent{Block: block, UtxoView: utxoView, UtxoOps: utxoOps})
+	require.Len(events, 3)
+	for ii, txn := range block.Txns {
+		require.Equal(TransactionEventKindConnected, events[ii].Kind)
+		require.Equal(txn.Hash(), events[ii].TxnHash)
+		require.Equal(blockHash, events[ii].BlockHash)
+		require.Equal(uint64(6), events[ii].BlockHeight)
+		require.Equal(uint64(ii), events[ii].TxnIndexInBlock)
+		require.Equal(utxoOps[ii], events[ii].UtxoOps)
+		require.NotNil(events[ii].UtxoView)
+		require.NotSame(utxoView, events[ii].UtxoView)
+		require.Same(events[0].UtxoView, events[ii].UtxoView)
+	}
+	require.Equal(TxnTypeBlockReward, events[0].TxnType)
+	require.Contains(events[1].AffectedPublicKeys, m1PkBytes)
+
+	// Disconnected txns are emitted in reverse order with their operations.
+	events = nil
+	bus.HandleBlockDisconnected(&BlockEvent{Block: block, UtxoOps: utxoOps})
+	require.Len(events, 3)
+	for ii, event := range events {
+		txnIndex := len(block.Txns) - 1 - ii
+		require.Equal(TransactionEventKindDisconnected, event.Kind)
+		require.Equal(block.Txns[txnIndex].Hash(), event.TxnHash)
+		require.Equal(blockHash, event.BlockHash)
+		require.Equal(uint64(txnIndex), event.TxnIndexInBlock)
+		require.Equal(utxoOps[txnIndex], event.UtxoOps)
+	}
+
+	// Operations that don't match the block's txns aren't passed on.
+	events = nil
+	bus.HandleBlockDisconnected(&BlockEvent{Block: block, UtxoOps: utxoOps[:2]})
+	require.Len(events, 3)
+	for _, event := range events {
+		require.Nil(event.UtxoOps)
+	}
+
+	// Mempool txns have no block.
+	events = nil
+	bus.NotifyMempoolAccepted(firstTransfer)
+	require.Len(events, 1)
+	require.Equal(TransactionEventKindMempoolAccepted, events[0].Kind)
+	require.Equal(firstTransfer.Hash(), events[0].TxnHash)
+	require.Nil(events[0].BlockHash)
+
+	// A nil bus ignores mempool txns.
+	var nilBus *TransactionEventBus
+	nilBus.NotifyMempoolAccepted(firstTransfer)
+
+	// A listener can unregister itself while it's called without deadlocking, and isn't called
+	// again.
+	bus.UnregisterTransactionEventListener(listenerID)
+	events = nil
+	var selfUnregisteringID uint64
+	numSelfUnregisteringCalls := 0
+	selfUnregisteringID = bus.RegisterTransactionEventListener(func(event *TypedTransactionEvent) {
+		numSelfUnregisteringCalls++
+		bus.UnregisterTransactionEventListener(selfUnregisteringID)
+	})
+	bus.HandleBlockConnected(&BlockEvent{Block: block, UtxoOps: utxoOps})
+	require.Equal(1, numSelfUnregisteringCalls)
+	require.Empty(events)
+}
+
+func TestTransactionEventBusMempool(t *testing.T) {
+	require := require.New(t)
+
+	chain, _, _, _ := _setupFiveBlocks(t)
+	bus := NewTransactionEventBus(chain)
+	var acceptedTxnHashes []*BlockHash
+	bus.RegisterTransactionEventListener(func(event *TypedTransactionEvent) {
+		require.Equal(TransactionEventKindMempoolAccepted, event.Kind)
+		acceptedTxnHashes = append(acceptedTxnHashes, event.TxnHash)
+	})
+
+	// The child spends the output the parent sends to the recipient.
+	scratchMempool := NewDeSoMempool(chain, 0, 0, "", true, "", "", true)
+	parentTxn := _assembleBasicTransferTxnFullySigned(t, chain, 1000, 0,
+		senderPkString, recipientPkString, senderPrivString, nil)
+	_, err := scratchMempool.ProcessTransaction(parentTxn, false, false, 0, true)
+	require.NoError(err)
+	childTxn := _assembleBasicTransferTxnFullySigned(t, chain, 10, 0,
+		recipientPkString, senderPkString, recipientPrivString, scratchMempool)
+
+	// An unconnected txn isn't accepted until its parent is, and is then emitted along with it.
+	mempool := NewDeSoMempool(chain, 0, 0, "", true, "", "", true)
+	mempool.SetTransactionEventBus(bus)
+	mempoolTxs, err := mempool.ProcessTransaction(childTxn, true, false, 0, true)
+	require.NoError(err)
+	require.Empty(mempoolTxs)
+	require.Empty(acceptedTxnHashes)
+	mempoolTxs, err = mempool.ProcessTransaction(parentTxn, false, false, 0, true)
+	require.NoError(err)
+	require.Len(mempoolTxs, 2)
+	require.Equal([]*BlockHash{parentTxn.Hash(), childTxn.Hash()}, acceptedTxnHashes)
+
+	// The txns loaded from a journal are emitted too.
+	journal, err := NewMempoolJournal(filepath.Join(t.TempDir(), "mempool_journal"))
+	require.NoError(err)
+	journal.AppendTxn(parentTxn)
+	journal.AppendTxn(childTxn)
+	acceptedTxnHashes = nil
+	replayMempool := NewDeSoMempool(chain, 0, 0, "", true, "", "", true)
+	replayMempool.SetTransactionEventBus(bus)
+	require.NoError(replayMempool.LoadJournal(journal))
+	require.Equal([]*BlockHash{parentTxn.Hash(), childTxn.Hash()}, acceptedTxnHashes)
+	require.NoError(journal.Close())
+}
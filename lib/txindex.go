@@ -119,18 +119,10 @@ func NewTXIndex(coreChain *Blockchain, params *DeSoParams, dataDirectory string)
 		}
 	}
 
-	// Ignore all the notifications from the txindex blockchain object
-	txIndexBlockchainNotificationChan := make(chan *ServerMessage, 1000)
-	go func() {
-		for {
-			<-txIndexBlockchainNotificationChan
-		}
-	}()
-
 	// Note that we *DONT* pass server here because it is already tied to the main blockchain.
 	txIndexChain, err := NewBlockchain(
 		[]string{}, 0, coreChain.MaxSyncBlockHeight, params, chainlib.NewMedianTime(),
-		txIndexDb, nil, nil, nil, false, nil)
+		txIndexDb, nil, nil, nil, nil, false, nil)
 	if err != nil {
 		return nil, fmt.Errorf("NewTXIndex: Error initializing TxIndex: %v", err)
 	}
@@ -162,9 +154,8 @@ func (txi *TXIndex) Start() {
 
 	// Run a loop to continuously update the txindex. Note that this is a noop
 	// except when run the first time or when a new block has arrived.
+	txi.updateWaitGroup.Add(1)
 	go func() {
-		txi.updateWaitGroup.Add(1)
-
 		for {
 			select {
 			case <-txi.stopUpdateChannel:
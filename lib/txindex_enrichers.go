@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// The txindex computes a TransactionMetadata for every txn it connects. The built-in fields
+// of TransactionMetadata are computed by ComputeTransactionMetadata, and after that the txn
+// is passed through a pipeline of TxindexEnrichers. Enrichers let code outside this package
+// attach its own data to a txn's metadata, e.g. a summary of the orders a limit order filled
+// or the price an NFT sold for, without having to fork ComputeTransactionMetadata.
+//
+// Each enricher's output is stored in TransactionMetadata.Enrichments together with the
+// enricher's name and version. Consumers should check the version before decoding an output,
+// since an enricher's format can change between versions and outputs aren't recomputed for
+// txns that were already indexed.
+
+// TxindexEnrichmentContext is everything an enricher has access to when it runs.
+type TxindexEnrichmentContext struct {
+	Txn         *MsgDeSoTxn
+	BlockHash   *BlockHash
+	BlockHeight uint64
+	UtxoOps     []*UtxoOperation
+	// UtxoView is the view after the txn has been connected. Enrichers must not modify it.
+	UtxoView *UtxoView
+	// TxnMeta is the metadata computed so far, including the outputs of the enrichers
+	// that ran before this one. Enrichers must not modify it.
+	TxnMeta *TransactionMetadata
+}
+
+// TxindexEnricher computes extra txindex metadata for a txn.
+type TxindexEnricher interface {
+	// GetName identifies the enricher's output. It must be unique among registered enrichers.
+	GetName() string
+	// GetVersion is stored with the enricher's output so consumers know how to decode it.
+	GetVersion() uint64
+	// GetTxnTypes returns the txn types the enricher runs on. If it's empty, the enricher
+	// runs on every txn.
+	GetTxnTypes() []TxnType
+	// Enrich returns the enricher's output for the txn, or nil if it has nothing to add.
+	Enrich(ctx *TxindexEnrichmentContext) ([]byte, error)
+}
+
+// TxindexEnrichment is the output of a TxindexEnricher for a single txn.
+type TxindexEnrichment struct {
+	Name    string
+	Version uint64
+	Data    []byte
+}
+
+func (enrichment *TxindexEnrichment) Encode() []byte {
+	var data []byte
+	data = append(data, EncodeByteArray([]byte(enrichment.Name))...)
+	data = append(data, UintToBuf(enrichment.Version)...)
+	data = append(data, EncodeByteArray(enrichment.Data)...)
+	return data
+}
+
+func (enrichment *TxindexEnrichment) Decode(rr *bytes.Reader) error {
+	nameBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxindexEnrichment.Decode: Problem reading Name: ")
+	}
+	enrichment.Name = string(nameBytes)
+	if enrichment.Version, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "TxindexEnrichment.Decode: Problem reading Version: ")
+	}
+	if enrichment.Data, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "TxindexEnrichment.Decode: Problem reading Data: ")
+	}
+	return nil
+}
+
+// GetEnrichment returns the output of the enricher with the given name, or nil if it
+// didn't produce one for this txn.
+func (txnMeta *TransactionMetadata) GetEnrichment(name string) *TxindexEnrichment {
+	for _, enrichment := range txnMeta.Enrichments {
+		if enrichment.Name == name {
+			return enrichment
+		}
+	}
+	return nil
+}
+
+var (
+	txindexEnrichersLock sync.RWMutex
+	txindexEnrichers     []TxindexEnricher
+)
+
+// RegisterTxindexEnricher adds an enricher to the end of the pipeline. Enrichers run in the
+// order they're registered, so they should be registered before the node starts.
+func RegisterTxindexEnricher(enricher TxindexEnricher) error {
+	txindexEnrichersLock.Lock()
+	defer txindexEnrichersLock.Unlock()
+
+	for _, existingEnricher := range txindexEnrichers {
+		if existingEnricher.GetName() == enricher.GetName() {
+			return fmt.Errorf("RegisterTxindexEnricher: An enricher named %v is already registered",
+				enricher.GetName())
+		}
+	}
+	txindexEnrichers = append(txindexEnrichers, enricher)
+	return nil
+}
+
+// UnregisterTxindexEnricher removes the enricher with the given name from the pipeline, if
+// there is one.
+func UnregisterTxindexEnricher(name string) {
+	txindexEnrichersLock.Lock()
+	defer txindexEnrichersLock.Unlock()
+
+	for ii, enricher := range txindexEnrichers {
+		if enricher.GetName() == name {
+			txindexEnrichers = append(txindexEnrichers[:ii:ii], txindexEnrichers[ii+1:]...)
+			return
+		}
+	}
+}
+
+// RunTxindexEnrichers runs every registered enricher that applies to the txn and sets their
+// outputs on ctx.TxnMeta. An enricher that fails is logged and skipped so that a buggy
+// enricher can't stop the txindex.
+func RunTxindexEnrichers(ctx *TxindexEnrichmentContext) {
+	txindexEnrichersLock.RLock()
+	defer txindexEnrichersLock.RUnlock()
+
+	txnType := ctx.Txn.TxnMeta.GetTxnType()
+	for _, enricher := range txindexEnrichers {
+		if !_txindexEnricherAppliesToTxnType(enricher, txnType) {
+			continue
+		}
+		data, err := enricher.Enrich(ctx)
+		if err != nil {
+			glog.V(2).Infof("RunTxindexEnrichers: Enricher %v failed on %v txn: %v",
+				enricher.GetName(), txnType, err)
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		ctx.TxnMeta.Enrichments = append(ctx.TxnMeta.Enrichments, &TxindexEnrichment{
+			Name:    enricher.GetName(),
+			Version: enricher.GetVersion(),
+			Data:    data,
+		})
+	}
+}
+
+// _getTxindexEnricherNamesForTxnType returns the names of the registered enrichers that run on
+// the txn type.
+func _getTxindexEnricherNamesForTxnType(txnType TxnType) []string {
+	txindexEnrichersLock.RLock()
+	defer txindexEnrichersLock.RUnlock()
+
+	var names []string
+	for _, enricher := range txindexEnrichers {
+		if _txindexEnricherAppliesToTxnType(enricher, txnType) {
+			names = append(names, enricher.GetName())
+		}
+	}
+	return names
+}
+
+func _txindexEnricherAppliesToTxnType(enricher TxindexEnricher, txnType TxnType) bool {
+	txnTypes := enricher.GetTxnTypes()
+	if len(txnTypes) == 0 {
+		return true
+	}
+	for _, enricherTxnType := range txnTypes {
+		if enricherTxnType == txnType {
+			return true
+		}
+	}
+	return false
+}
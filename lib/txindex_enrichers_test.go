@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testTxindexEnricher struct {
+	name     string
+	txnTypes []TxnType
+	err      error
+}
+
+func (enricher *testTxindexEnricher) GetName() string        { return enricher.name }
+func (enricher *testTxindexEnricher) GetVersion() uint64     { return 2 }
+func (enricher *testTxindexEnricher) GetTxnTypes() []TxnType { return enricher.txnTypes }
+func (enricher *testTxindexEnricher) Enrich(ctx *TxindexEnrichmentContext) ([]byte, error) {
+	if enricher.err != nil {
+		return nil, enricher.err
+	}
+	return []byte(fmt.Sprintf("%s:%d", enricher.name, len(ctx.TxnMeta.Enrichments))), nil
+}
+
+func TestTxindexEnrichers(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.TxindexEnrichmentBlockHeight = 0
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	oldGlobalParams := GlobalDeSoParams
+	GlobalDeSoParams = params
+	defer func() { GlobalDeSoParams = oldGlobalParams }()
+
+	enrichers := []*testTxindexEnricher{
+		{name: "all"},
+		{name: "likes", txnTypes: []TxnType{TxnTypeLike}},
+		{name: "basic", txnTypes: []TxnType{TxnTypeBasicTransfer}},
+		{name: "broken", err: fmt.Errorf("broken")},
+	}
+	for _, enricher := range enrichers {
+		require.NoError(RegisterTxindexEnricher(enricher))
+		defer UnregisterTxindexEnricher(enricher.name)
+	}
+	require.Error(RegisterTxindexEnricher(&testTxindexEnricher{name: "all"}))
+
+	// Only the enrichers for basic transfers run, in order, and the broken one is skipped.
+	txnMeta := &TransactionMetadata{TxnType: TxnTypeBasicTransfer.String()}
+	RunTxindexEnrichers(&TxindexEnrichmentContext{
+		Txn:     &MsgDeSoTxn{TxnMeta: &BasicTransferMetadata{}},
+		TxnMeta: txnMeta,
+	})
+	require.Equal([]*TxindexEnrichment{
+		{Name: "all", Version: 2, Data: []byte("all:0")},
+		{Name: "basic", Version: 2, Data: []byte("basic:1")},
+	}, txnMeta.Enrichments)
+	require.Equal([]byte("basic:1"), txnMeta.GetEnrichment("basic").Data)
+	require.Nil(txnMeta.GetEnrichment("likes"))
+
+	// The enrichments survive encoding.
+	decodedTxnMeta, err := DecodeDeSoEncoder(&TransactionMetadata{}, bytes.NewReader(EncodeToBytes(0, txnMeta)))
+	require.NoError(err)
+	require.Equal(txnMeta.Enrichments, decodedTxnMeta.Enrichments)
+}
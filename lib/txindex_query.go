@@ -0,0 +1,275 @@
+package lib
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// The txindex stores a TransactionMetadata for every txn in the best chain, and maps every
+// public key a txn affects to the txn. The functions below look txns up in the txindex
+// without callers having to know how it's laid out in the db.
+//
+// The metadata of a txn is computed once, when its block is attached to the txindex chain.
+// Txns that were indexed before the txindex knew how to compute the metadata for their type,
+// or before an enricher was registered, are missing that metadata. Looking a txn up with
+// BackfillMissingMetadata recomputes the metadata from the utxo ops stored for its block and
+// saves whatever was missing. The recomputed metadata resolves PKIDs to public keys with the
+// state at the txindex tip, so a txn whose PKIDs have since swapped identities may show the
+// new public keys.
+
+// TxindexTxn is a txn looked up in the txindex.
+type TxindexTxn struct {
+	TxnHash *BlockHash
+	// Txn is nil for the genesis seed txns and seed balances, which aren't part of a block.
+	Txn             *MsgDeSoTxn
+	BlockHash       *BlockHash
+	BlockHeight     uint64
+	TxnIndexInBlock uint64
+	// TransactorPublicKeyBase58Check and AffectedPublicKeys are copied from Metadata for
+	// convenience.
+	TransactorPublicKeyBase58Check string
+	AffectedPublicKeys             []*AffectedPublicKey
+	Metadata                       *TransactionMetadata
+}
+
+// TxindexLookupOptions control how txns are looked up in the txindex.
+type TxindexLookupOptions struct {
+	// BackfillMissingMetadata recomputes and saves the metadata of txns that are missing the
+	// metadata for their type or the output of a registered enricher.
+	BackfillMissingMetadata bool
+}
+
+// HasTxn returns true if the txn is in the txindex.
+func (txi *TXIndex) HasTxn(txnHash *BlockHash) bool {
+	txi.TXIndexLock.RLock()
+	defer txi.TXIndexLock.RUnlock()
+
+	return DbCheckTxnExistence(txi.TXIndexChain.DB(), nil, txnHash)
+}
+
+// GetTxn looks the txn up in the txindex. It returns nil if the txn isn't indexed.
+func (txi *TXIndex) GetTxn(txnHash *BlockHash, opts *TxindexLookupOptions) (*TxindexTxn, error) {
+	txns, err := txi.GetTxns([]*BlockHash{txnHash}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return txns[0], nil
+}
+
+// GetTxns looks the txns up in the txindex. The result has an entry for each hash, in the same
+// order, which is nil if the txn isn't indexed.
+func (txi *TXIndex) GetTxns(txnHashes []*BlockHash, opts *TxindexLookupOptions) ([]*TxindexTxn, error) {
+	backfill := opts != nil && opts.BackfillMissingMetadata
+	// Backfilling writes to the txindex, so it can't run alongside other lookups or an update.
+	if backfill {
+		txi.TXIndexLock.Lock()
+		defer txi.TXIndexLock.Unlock()
+	} else {
+		txi.TXIndexLock.RLock()
+		defer txi.TXIndexLock.RUnlock()
+	}
+
+	// Txns in the same block only need the block to be read once.
+	blocks := make(map[BlockHash]*MsgDeSoBlock)
+	txindexTxns := make([]*TxindexTxn, len(txnHashes))
+	for ii, txnHash := range txnHashes {
+		txindexTxn, err := txi._getTxn(txnHash, blocks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "TXIndex.GetTxns: Problem getting txn %v: ", txnHash)
+		}
+		if txindexTxn != nil && backfill && txindexTxn.Txn != nil &&
+			_txindexMetadataNeedsBackfill(txindexTxn.Txn, txindexTxn.Metadata) {
+
+			if err = txi._backfillTxnMetadata(txindexTxn); err != nil {
+				return nil, errors.Wrapf(err, "TXIndex.GetTxns: Problem backfilling metadata for txn %v: ", txnHash)
+			}
+		}
+		txindexTxns[ii] = txindexTxn
+	}
+	return txindexTxns, nil
+}
+
+// GetTxnHashesForPublicKey returns the hashes of the txns the public key is affected by, in the
+// order they were indexed.
+func (txi *TXIndex) GetTxnHashesForPublicKey(publicKey []byte) []*BlockHash {
+	txi.TXIndexLock.RLock()
+	defer txi.TXIndexLock.RUnlock()
+
+	var txnHashes []*BlockHash
+	txi.TXIndexChain.DB().View(func(txn *badger.Txn) error {
+		txnHashes = DbGetTxindexTxnsForPublicKeyWithTxn(txn, publicKey)
+		return nil
+	})
+	return txnHashes
+}
+
+func (txi *TXIndex) _getTxn(txnHash *BlockHash, blocks map[BlockHash]*MsgDeSoBlock) (*TxindexTxn, error) {
+	txnMeta := DbGetTxindexTransactionRefByTxID(txi.TXIndexChain.DB(), nil, txnHash)
+	if txnMeta == nil {
+		return nil, nil
+	}
+	blockHashBytes, err := hex.DecodeString(txnMeta.BlockHashHex)
+	if err != nil || len(blockHashBytes) != HashSizeBytes {
+		return nil, fmt.Errorf("TXIndex._getTxn: Invalid block hash hex %v", txnMeta.BlockHashHex)
+	}
+	blockHash := NewBlockHash(blockHashBytes)
+	block, exists := blocks[*blockHash]
+	if !exists {
+		block, err = GetBlock(blockHash, txi.TXIndexChain.DB(), nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "TXIndex._getTxn: Problem getting block %v: ", blockHash)
+		}
+		blocks[*blockHash] = block
+	}
+
+	txindexTxn := &TxindexTxn{
+		TxnHash:                        txnHash,
+		BlockHash:                      blockHash,
+		BlockHeight:                    block.Header.Height,
+		TxnIndexInBlock:                txnMeta.TxnIndexInBlock,
+		TransactorPublicKeyBase58Check: txnMeta.TransactorPublicKeyBase58Check,
+		AffectedPublicKeys:             txnMeta.AffectedPublicKeys,
+		Metadata:                       txnMeta,
+	}
+	// The seed txns are indexed under the genesis block, but they aren't part of it.
+	if txnMeta.TxnIndexInBlock < uint64(len(block.Txns)) &&
+		*block.Txns[txnMeta.TxnIndexInBlock].Hash() == *txnHash {
+
+		txindexTxn.Txn = block.Txns[txnMeta.TxnIndexInBlock]
+	}
+	return txindexTxn, nil
+}
+
+// _txindexMetadataNeedsBackfill returns true if the txn's metadata is missing the metadata for
+// its type, or the output of an enricher that runs on its type.
+func _txindexMetadataNeedsBackfill(txn *MsgDeSoTxn, txnMeta *TransactionMetadata) bool {
+	txnType := txn.TxnMeta.GetTxnType()
+	encoder := txnMeta.GetEncoderForTxType(txnType)
+	if encoder == nil || reflect.ValueOf(encoder).IsNil() {
+		return true
+	}
+	for _, enricherName := range _getTxindexEnricherNamesForTxnType(txnType) {
+		if txnMeta.GetEnrichment(enricherName) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// _backfillTxnMetadata recomputes the txn's metadata and saves the parts that were missing,
+// along with mappings for any public keys it affects that weren't indexed before.
+func (txi *TXIndex) _backfillTxnMetadata(txindexTxn *TxindexTxn) error {
+	txnMeta := txindexTxn.Metadata
+	utxoOpsForBlock, err := GetUtxoOperationsForBlock(txi.TXIndexChain.DB(), nil, txindexTxn.BlockHash)
+	if err != nil {
+		return errors.Wrapf(err, "TXIndex._backfillTxnMetadata: Problem getting utxo ops for block %v: ",
+			txindexTxn.BlockHash)
+	}
+	if txindexTxn.TxnIndexInBlock >= uint64(len(utxoOpsForBlock)) {
+		return fmt.Errorf("TXIndex._backfillTxnMetadata: Block %v has utxo ops for %d txns but the txn "+
+			"is at index %d", txindexTxn.BlockHash, len(utxoOpsForBlock), txindexTxn.TxnIndexInBlock)
+	}
+
+	// The totals and fees don't depend on anything we might be missing, so we keep the ones
+	// computed when the txn was indexed.
+	var totalInput, totalOutput, fees uint64
+	if txnMeta.BasicTransferTxindexMetadata != nil {
+		totalInput = txnMeta.BasicTransferTxindexMetadata.TotalInputNanos
+		totalOutput = txnMeta.BasicTransferTxindexMetadata.TotalOutputNanos
+		fees = txnMeta.BasicTransferTxindexMetadata.FeeNanos
+	}
+	utxoView := NewUtxoView(txi.TXIndexChain.DB(), txi.Params, nil, nil, txi.CoreChain.eventManager)
+	recomputedTxnMeta := ComputeTransactionMetadata(txindexTxn.Txn, utxoView, txindexTxn.BlockHash,
+		utxoView.NanosPurchased, utxoView.GetCurrentUSDCentsPerBitcoin(), totalInput, totalOutput, fees,
+		txindexTxn.TxnIndexInBlock, utxoOpsForBlock[txindexTxn.TxnIndexInBlock], txindexTxn.BlockHeight)
+
+	backfilledTxnMeta, changed := _mergeBackfilledTxindexMetadata(
+		txindexTxn.Txn.TxnMeta.GetTxnType(), txnMeta, recomputedTxnMeta)
+	if !changed {
+		return nil
+	}
+
+	oldPublicKeys := _getPublicKeysForTxn(txindexTxn.Txn, txnMeta, txi.Params)
+	newPublicKeys := _getPublicKeysForTxn(txindexTxn.Txn, backfilledTxnMeta, txi.Params)
+	err = txi.TXIndexChain.DB().Update(func(dbTxn *badger.Txn) error {
+		if err := DbPutTxindexTransactionWithTxn(dbTxn, nil, txindexTxn.BlockHeight, txindexTxn.TxnHash,
+			backfilledTxnMeta, txi.CoreChain.eventManager); err != nil {
+			return err
+		}
+		for publicKeyIter := range newPublicKeys {
+			publicKey := publicKeyIter
+			if oldPublicKeys[publicKey] {
+				continue
+			}
+			if err := DbPutTxindexPublicKeyToTxnMappingSingleWithTxn(dbTxn, nil, publicKey[:],
+				txindexTxn.TxnHash, txi.CoreChain.eventManager); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "TXIndex._backfillTxnMetadata: Problem saving backfilled metadata: ")
+	}
+
+	txindexTxn.Metadata = backfilledTxnMeta
+	txindexTxn.TransactorPublicKeyBase58Check = backfilledTxnMeta.TransactorPublicKeyBase58Check
+	txindexTxn.AffectedPublicKeys = backfilledTxnMeta.AffectedPublicKeys
+	return nil
+}
+
+// _mergeBackfilledTxindexMetadata fills in what's missing from the stored metadata with the
+// recomputed metadata. Whatever the stored metadata already has is kept as it is. It returns
+// the merged metadata and whether anything was filled in.
+func _mergeBackfilledTxindexMetadata(txnType TxnType, storedTxnMeta *TransactionMetadata,
+	recomputedTxnMeta *TransactionMetadata) (_mergedTxnMeta *TransactionMetadata, _changed bool) {
+
+	storedEncoder := storedTxnMeta.GetEncoderForTxType(txnType)
+	recomputedEncoder := recomputedTxnMeta.GetEncoderForTxType(txnType)
+	isTypeMetadataMissing := (storedEncoder == nil || reflect.ValueOf(storedEncoder).IsNil()) &&
+		recomputedEncoder != nil && !reflect.ValueOf(recomputedEncoder).IsNil()
+
+	var missingEnrichments []*TxindexEnrichment
+	for _, enrichment := range recomputedTxnMeta.Enrichments {
+		if storedTxnMeta.GetEnrichment(enrichment.Name) == nil {
+			missingEnrichments = append(missingEnrichments, enrichment)
+		}
+	}
+
+	storedAffectedPublicKeys := make(map[string]bool)
+	for _, affectedPublicKey := range storedTxnMeta.AffectedPublicKeys {
+		storedAffectedPublicKeys[affectedPublicKey.PublicKeyBase58Check] = true
+	}
+	var missingAffectedPublicKeys []*AffectedPublicKey
+	for _, affectedPublicKey := range recomputedTxnMeta.AffectedPublicKeys {
+		if !storedAffectedPublicKeys[affectedPublicKey.PublicKeyBase58Check] {
+			storedAffectedPublicKeys[affectedPublicKey.PublicKeyBase58Check] = true
+			missingAffectedPublicKeys = append(missingAffectedPublicKeys, affectedPublicKey)
+		}
+	}
+
+	if !isTypeMetadataMissing && len(missingEnrichments) == 0 && len(missingAffectedPublicKeys) == 0 {
+		return storedTxnMeta, false
+	}
+
+	mergedTxnMeta := *storedTxnMeta
+	if isTypeMetadataMissing {
+		// Each txn type's metadata has its own type, so the field to fill in is the one with the
+		// recomputed metadata's type.
+		mergedTxnMetaValue := reflect.ValueOf(&mergedTxnMeta).Elem()
+		for ii := 0; ii < mergedTxnMetaValue.NumField(); ii++ {
+			if mergedTxnMetaValue.Field(ii).Type() == reflect.TypeOf(recomputedEncoder) {
+				mergedTxnMetaValue.Field(ii).Set(reflect.ValueOf(recomputedEncoder))
+			}
+		}
+	}
+	mergedTxnMeta.AffectedPublicKeys = append(
+		append([]*AffectedPublicKey{}, storedTxnMeta.AffectedPublicKeys...), missingAffectedPublicKeys...)
+	mergedTxnMeta.Enrichments = append(
+		append([]*TxindexEnrichment{}, storedTxnMeta.Enrichments...), missingEnrichments...)
+	return &mergedTxnMeta, true
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxindexBackfillMissingMetadata(t *testing.T) {
+	require := require.New(t)
+
+	require.NoError(RegisterTxindexEnricher(&testTxindexEnricher{
+		name: "orders", txnTypes: []TxnType{TxnTypeDAOCoinLimitOrder}}))
+	defer UnregisterTxindexEnricher("orders")
+
+	// A limit order indexed before its fills were tracked is missing its type metadata and the
+	// enricher's output.
+	txn := &MsgDeSoTxn{TxnMeta: &DAOCoinLimitOrderMetadata{}}
+	storedTxnMeta := &TransactionMetadata{
+		BlockHashHex:                   "00",
+		TxnIndexInBlock:                3,
+		TxnType:                        TxnTypeDAOCoinLimitOrder.String(),
+		TransactorPublicKeyBase58Check: "transactor",
+		AffectedPublicKeys: []*AffectedPublicKey{
+			{PublicKeyBase58Check: "transactor", Metadata: "TransactorPublicKeyBase58Check"},
+		},
+		BasicTransferTxindexMetadata: &BasicTransferTxindexMetadata{FeeNanos: 10},
+	}
+	require.True(_txindexMetadataNeedsBackfill(txn, storedTxnMeta))
+
+	recomputedTxnMeta := &TransactionMetadata{
+		BlockHashHex:                   "00",
+		TxnIndexInBlock:                3,
+		TxnType:                        TxnTypeDAOCoinLimitOrder.String(),
+		TransactorPublicKeyBase58Check: "transactor",
+		AffectedPublicKeys: []*AffectedPublicKey{
+			{PublicKeyBase58Check: "maker", Metadata: "FilledOrderTransactor"},
+			{PublicKeyBase58Check: "transactor", Metadata: "TransactorPublicKeyBase58Check"},
+		},
+		BasicTransferTxindexMetadata: &BasicTransferTxindexMetadata{FeeNanos: 20},
+		DAOCoinLimitOrderTxindexMetadata: &DAOCoinLimitOrderTxindexMetadata{
+			FilledDAOCoinLimitOrdersMetadata: []*FilledDAOCoinLimitOrderMetadata{
+				{TransactorPublicKeyBase58Check: "maker", IsFulfilled: true},
+			},
+		},
+		Enrichments: []*TxindexEnrichment{{Name: "orders", Version: 2, Data: []byte("orders:0")}},
+	}
+
+	// The missing parts are filled in, and the parts that were already stored are kept.
+	mergedTxnMeta, changed := _mergeBackfilledTxindexMetadata(
+		TxnTypeDAOCoinLimitOrder, storedTxnMeta, recomputedTxnMeta)
+	require.True(changed)
+	require.Equal(recomputedTxnMeta.DAOCoinLimitOrderTxindexMetadata, mergedTxnMeta.DAOCoinLimitOrderTxindexMetadata)
+	require.Equal(recomputedTxnMeta.Enrichments, mergedTxnMeta.Enrichments)
+	require.Equal(uint64(10), mergedTxnMeta.BasicTransferTxindexMetadata.FeeNanos)
+	require.Equal([]*AffectedPublicKey{
+		{PublicKeyBase58Check: "transactor", Metadata: "TransactorPublicKeyBase58Check"},
+		{PublicKeyBase58Check: "maker", Metadata: "FilledOrderTransactor"},
+	}, mergedTxnMeta.AffectedPublicKeys)
+	require.False(_txindexMetadataNeedsBackfill(txn, mergedTxnMeta))
+
+	// The stored metadata isn't modified.
+	require.Nil(storedTxnMeta.DAOCoinLimitOrderTxindexMetadata)
+	require.Len(storedTxnMeta.AffectedPublicKeys, 1)
+
+	// Merging again doesn't change anything.
+	_, changed = _mergeBackfilledTxindexMetadata(TxnTypeDAOCoinLimitOrder, mergedTxnMeta, recomputedTxnMeta)
+	require.False(changed)
+}
@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// TxnFeeReceipt records the fee a transaction paid when it was connected. It is
+// stored on the transaction's last UtxoOperation so that fee market analysis, and
+// hints such as how much a wallet overpaid, can be computed from stored data
+// without re-serializing and re-connecting the transaction.
+type TxnFeeReceipt struct {
+	// FeeNanos is the exact fee paid by the transaction.
+	FeeNanos uint64
+	// TxnSizeBytes is the size of the serialized transaction, including its signature.
+	TxnSizeBytes uint64
+	// FeeRateNanosPerKB is the effective fee rate, FeeNanos * 1000 / TxnSizeBytes.
+	FeeRateNanosPerKB uint64
+	// ChangeOutputIndexes are the indexes of the transaction's outputs that pay
+	// back to the transactor's own public key.
+	ChangeOutputIndexes []uint32
+	// ChangeAmountNanos is the sum of the change outputs.
+	ChangeAmountNanos uint64
+}
+
+// NewTxnFeeReceipt computes the TxnFeeReceipt for a transaction that paid feeNanos.
+func NewTxnFeeReceipt(txn *MsgDeSoTxn, txnSizeBytes uint64, feeNanos uint64) (*TxnFeeReceipt, error) {
+	receipt := &TxnFeeReceipt{
+		FeeNanos:     feeNanos,
+		TxnSizeBytes: txnSizeBytes,
+	}
+	if txnSizeBytes != 0 {
+		feeTimesThousand, err := SafeUint64().Mul(feeNanos, 1000)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewTxnFeeReceipt: problem computing fee rate: ")
+		}
+		receipt.FeeRateNanosPerKB = feeTimesThousand / txnSizeBytes
+	}
+	for ii, output := range txn.TxOutputs {
+		if !bytes.Equal(output.PublicKey, txn.PublicKey) {
+			continue
+		}
+		changeAmountNanos, err := SafeUint64().Add(receipt.ChangeAmountNanos, output.AmountNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewTxnFeeReceipt: problem computing change amount: ")
+		}
+		receipt.ChangeOutputIndexes = append(receipt.ChangeOutputIndexes, uint32(ii))
+		receipt.ChangeAmountNanos = changeAmountNanos
+	}
+	return receipt, nil
+}
+
+// OverpaidFeeNanos returns how much more the transaction paid than it would have
+// at the given fee rate. It returns zero if the transaction paid at or below the rate.
+func (receipt *TxnFeeReceipt) OverpaidFeeNanos(feeRateNanosPerKB uint64) uint64 {
+	// Round the minimum fee up, matching how the minimum network fee is enforced.
+	minFeeNanos := (receipt.TxnSizeBytes*feeRateNanosPerKB + 999) / 1000
+	if receipt.FeeNanos <= minFeeNanos {
+		return 0
+	}
+	return receipt.FeeNanos - minFeeNanos
+}
+
+// GetTxnFeeReceipt returns the TxnFeeReceipt stored on a transaction's UtxoOperations,
+// or nil if the transaction was connected before receipts were recorded.
+func GetTxnFeeReceipt(utxoOpsForTxn []*UtxoOperation) *TxnFeeReceipt {
+	for ii := len(utxoOpsForTxn) - 1; ii >= 0; ii-- {
+		if utxoOpsForTxn[ii] != nil && utxoOpsForTxn[ii].FeeReceipt != nil {
+			return utxoOpsForTxn[ii].FeeReceipt
+		}
+	}
+	return nil
+}
+
+func (receipt *TxnFeeReceipt) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(receipt.FeeNanos)...)
+	data = append(data, UintToBuf(receipt.TxnSizeBytes)...)
+	data = append(data, UintToBuf(receipt.FeeRateNanosPerKB)...)
+	data = append(data, UintToBuf(uint64(len(receipt.ChangeOutputIndexes)))...)
+	for _, outputIndex := range receipt.ChangeOutputIndexes {
+		data = append(data, UintToBuf(uint64(outputIndex))...)
+	}
+	data = append(data, UintToBuf(receipt.ChangeAmountNanos)...)
+	return data
+}
+
+func (receipt *TxnFeeReceipt) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// FeeNanos
+	receipt.FeeNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnFeeReceipt.Decode: Problem reading FeeNanos: ")
+	}
+
+	// TxnSizeBytes
+	receipt.TxnSizeBytes, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnFeeReceipt.Decode: Problem reading TxnSizeBytes: ")
+	}
+
+	// FeeRateNanosPerKB
+	receipt.FeeRateNanosPerKB, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnFeeReceipt.Decode: Problem reading FeeRateNanosPerKB: ")
+	}
+
+	// ChangeOutputIndexes
+	numChangeOutputs, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnFeeReceipt.Decode: Problem reading len of ChangeOutputIndexes: ")
+	}
+	if numChangeOutputs > math.MaxUint32 {
+		return errors.Errorf("TxnFeeReceipt.Decode: ChangeOutputIndexes length %d is too large", numChangeOutputs)
+	}
+	receipt.ChangeOutputIndexes = nil
+	for ii := uint64(0); ii < numChangeOutputs; ii++ {
+		outputIndex, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "TxnFeeReceipt.Decode: Problem reading ChangeOutputIndexes[%d]: ", ii)
+		}
+		receipt.ChangeOutputIndexes = append(receipt.ChangeOutputIndexes, uint32(outputIndex))
+	}
+
+	// ChangeAmountNanos
+	receipt.ChangeAmountNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnFeeReceipt.Decode: Problem reading ChangeAmountNanos: ")
+	}
+
+	return nil
+}
+
+func (receipt *TxnFeeReceipt) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (receipt *TxnFeeReceipt) GetEncoderType() EncoderType {
+	return EncoderTypeTxnFeeReceipt
+}
@@ -0,0 +1,49 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnFeeReceipt(t *testing.T) {
+	transactorPublicKey := m0PkBytes
+	recipientPublicKey := m1PkBytes
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxOutputs: []*DeSoOutput{
+			{PublicKey: recipientPublicKey, AmountNanos: 100},
+			{PublicKey: transactorPublicKey, AmountNanos: 40},
+			{PublicKey: transactorPublicKey, AmountNanos: 2},
+		},
+	}
+
+	// A 250 byte txn paying 300 nanos has an effective fee rate of 1200 nanos per KB.
+	receipt, err := NewTxnFeeReceipt(txn, 250, 300)
+	require.NoError(t, err)
+	require.Equal(t, uint64(300), receipt.FeeNanos)
+	require.Equal(t, uint64(250), receipt.TxnSizeBytes)
+	require.Equal(t, uint64(1200), receipt.FeeRateNanosPerKB)
+	require.Equal(t, []uint32{1, 2}, receipt.ChangeOutputIndexes)
+	require.Equal(t, uint64(42), receipt.ChangeAmountNanos)
+
+	// At 1000 nanos per KB the txn needed 250 nanos, so it overpaid by 50.
+	require.Equal(t, uint64(50), receipt.OverpaidFeeNanos(1000))
+	// The minimum fee rounds up: 250 bytes at 1001 nanos per KB needs 251 nanos.
+	require.Equal(t, uint64(49), receipt.OverpaidFeeNanos(1001))
+	require.Equal(t, uint64(0), receipt.OverpaidFeeNanos(1200))
+	require.Equal(t, uint64(0), receipt.OverpaidFeeNanos(5000))
+
+	// The receipt round-trips through the encoder, and can be found on the txn's UtxoOperations.
+	receiptBytes := EncodeToBytes(0, receipt)
+	decodedReceipt, err := DecodeDeSoEncoder(&TxnFeeReceipt{}, bytes.NewReader(receiptBytes))
+	require.NoError(t, err)
+	require.Equal(t, receipt, decodedReceipt)
+
+	utxoOps := []*UtxoOperation{{Type: OperationTypeSpendBalance}, {Type: OperationTypeAddBalance, FeeReceipt: receipt}}
+	require.Equal(t, receipt, GetTxnFeeReceipt(utxoOps))
+	require.Nil(t, GetTxnFeeReceipt(utxoOps[:1]))
+}
@@ -0,0 +1,383 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// The TxnLabelStore keeps an operator's bookkeeping metadata for txns, i.e. a label, a
+// free-form memo and a category, in the chain's db next to the txns they reference. The
+// labels are local to the node and never leave it unless they're exported, so they have
+// nothing to do with consensus and aren't part of the state that's synced between nodes.
+
+const (
+	EncoderTypeTxnLabel EncoderType = 4000000
+)
+
+const (
+	MaxTxnLabelLengthBytes         = 256
+	MaxTxnLabelMemoLengthBytes     = 4096
+	MaxTxnLabelCategoryLengthBytes = 64
+)
+
+//
+// TYPES: TxnLabel
+//
+
+type TxnLabel struct {
+	TxnHash  *BlockHash
+	Label    string
+	Memo     string
+	Category string
+	// When the label was last changed. An import doesn't replace a label with an older one.
+	UpdatedTimestampNanoSecs uint64
+}
+
+func (label *TxnLabel) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, label.TxnHash, skipMetadata...)...)
+	data = append(data, EncodeByteArray([]byte(label.Label))...)
+	data = append(data, EncodeByteArray([]byte(label.Memo))...)
+	data = append(data, EncodeByteArray([]byte(label.Category))...)
+	data = append(data, UintToBuf(label.UpdatedTimestampNanoSecs)...)
+	return data
+}
+
+func (label *TxnLabel) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	label.TxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnLabel.Decode: Problem reading TxnHash: ")
+	}
+	labelBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnLabel.Decode: Problem reading Label: ")
+	}
+	label.Label = string(labelBytes)
+	memoBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnLabel.Decode: Problem reading Memo: ")
+	}
+	label.Memo = string(memoBytes)
+	categoryBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnLabel.Decode: Problem reading Category: ")
+	}
+	label.Category = string(categoryBytes)
+	label.UpdatedTimestampNanoSecs, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnLabel.Decode: Problem reading UpdatedTimestampNanoSecs: ")
+	}
+	return nil
+}
+
+func (label *TxnLabel) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (label *TxnLabel) GetEncoderType() EncoderType {
+	return EncoderTypeTxnLabel
+}
+
+// Validate checks that the label references a txn and that its fields aren't too long.
+func (label *TxnLabel) Validate() error {
+	if label.TxnHash == nil {
+		return fmt.Errorf("TxnLabel.Validate: TxnHash is required")
+	}
+	if len(label.Label) > MaxTxnLabelLengthBytes {
+		return fmt.Errorf("TxnLabel.Validate: Label is %d bytes, more than the max of %d",
+			len(label.Label), MaxTxnLabelLengthBytes)
+	}
+	if len(label.Memo) > MaxTxnLabelMemoLengthBytes {
+		return fmt.Errorf("TxnLabel.Validate: Memo is %d bytes, more than the max of %d",
+			len(label.Memo), MaxTxnLabelMemoLengthBytes)
+	}
+	if len(label.Category) > MaxTxnLabelCategoryLengthBytes {
+		return fmt.Errorf("TxnLabel.Validate: Category is %d bytes, more than the max of %d",
+			len(label.Category), MaxTxnLabelCategoryLengthBytes)
+	}
+	return nil
+}
+
+// ExportedTxnLabel is the JSON form of a TxnLabel used by ExportTxnLabels and
+// ImportTxnLabels.
+type ExportedTxnLabel struct {
+	TxnHashHex               string
+	Label                    string
+	Memo                     string
+	Category                 string
+	UpdatedTimestampNanoSecs uint64
+}
+
+func (label *TxnLabel) ToExportedTxnLabel() *ExportedTxnLabel {
+	return &ExportedTxnLabel{
+		TxnHashHex:               hex.EncodeToString(label.TxnHash[:]),
+		Label:                    label.Label,
+		Memo:                     label.Memo,
+		Category:                 label.Category,
+		UpdatedTimestampNanoSecs: label.UpdatedTimestampNanoSecs,
+	}
+}
+
+func (exportedLabel *ExportedTxnLabel) ToTxnLabel() (*TxnLabel, error) {
+	txnHashBytes, err := hex.DecodeString(exportedLabel.TxnHashHex)
+	if err != nil || len(txnHashBytes) != HashSizeBytes {
+		return nil, fmt.Errorf("ExportedTxnLabel.ToTxnLabel: Invalid TxnHashHex %v", exportedLabel.TxnHashHex)
+	}
+	return &TxnLabel{
+		TxnHash:                  NewBlockHash(txnHashBytes),
+		Label:                    exportedLabel.Label,
+		Memo:                     exportedLabel.Memo,
+		Category:                 exportedLabel.Category,
+		UpdatedTimestampNanoSecs: exportedLabel.UpdatedTimestampNanoSecs,
+	}, nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForTxnLabel(txnHash *BlockHash) []byte {
+	key := append([]byte{}, Prefixes.PrefixTxnLabelByTxnHash...)
+	return append(key, txnHash.ToBytes()...)
+}
+
+func _dbKeyForTxnLabelCategory(category string) []byte {
+	key := append([]byte{}, Prefixes.PrefixTxnLabelTxnHashByCategory...)
+	return append(key, EncodeByteArray([]byte(category))...)
+}
+
+func DBKeyForTxnLabelCategoryTxnHash(category string, txnHash *BlockHash) []byte {
+	return append(_dbKeyForTxnLabelCategory(category), txnHash.ToBytes()...)
+}
+
+// DBGetTxnLabelWithTxn returns the txn's label, or nil if it doesn't have one.
+func DBGetTxnLabelWithTxn(txn *badger.Txn, txnHash *BlockHash) (*TxnLabel, error) {
+	labelBytes, err := DBGetWithTxn(txn, nil, DBKeyForTxnLabel(txnHash))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "DBGetTxnLabelWithTxn: Problem getting label for txn %v: ", txnHash)
+	}
+	label, err := DecodeDeSoEncoder(&TxnLabel{}, bytes.NewReader(labelBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetTxnLabelWithTxn: Problem decoding label for txn %v: ", txnHash)
+	}
+	return label, nil
+}
+
+func DBPutTxnLabelWithTxn(txn *badger.Txn, label *TxnLabel) error {
+	if err := DBDeleteTxnLabelWithTxn(txn, label.TxnHash); err != nil {
+		return errors.Wrapf(err, "DBPutTxnLabelWithTxn: ")
+	}
+	if err := DBSetWithTxn(txn, nil, DBKeyForTxnLabel(label.TxnHash), EncodeToBytes(0, label), nil); err != nil {
+		return errors.Wrapf(err, "DBPutTxnLabelWithTxn: Problem storing label: ")
+	}
+	if label.Category != "" {
+		categoryKey := DBKeyForTxnLabelCategoryTxnHash(label.Category, label.TxnHash)
+		if err := DBSetWithTxn(txn, nil, categoryKey, []byte{}, nil); err != nil {
+			return errors.Wrapf(err, "DBPutTxnLabelWithTxn: Problem storing category index: ")
+		}
+	}
+	return nil
+}
+
+// DBDeleteTxnLabelWithTxn deletes the txn's label and its category index entry, if it has
+// a label.
+func DBDeleteTxnLabelWithTxn(txn *badger.Txn, txnHash *BlockHash) error {
+	prevLabel, err := DBGetTxnLabelWithTxn(txn, txnHash)
+	if err != nil {
+		return errors.Wrapf(err, "DBDeleteTxnLabelWithTxn: ")
+	}
+	if prevLabel == nil {
+		return nil
+	}
+	if err = DBDeleteWithTxn(txn, nil, DBKeyForTxnLabel(txnHash), nil, true); err != nil {
+		return errors.Wrapf(err, "DBDeleteTxnLabelWithTxn: Problem deleting label: ")
+	}
+	if prevLabel.Category != "" {
+		categoryKey := DBKeyForTxnLabelCategoryTxnHash(prevLabel.Category, txnHash)
+		if err = DBDeleteWithTxn(txn, nil, categoryKey, nil, true); err != nil {
+			return errors.Wrapf(err, "DBDeleteTxnLabelWithTxn: Problem deleting category index: ")
+		}
+	}
+	return nil
+}
+
+//
+// TxnLabelStore
+//
+
+// TxnLabelStore reads and writes TxnLabels in the chain's db.
+type TxnLabelStore struct {
+	// mtx serializes writes so that a label and its category index are always updated
+	// together.
+	mtx sync.Mutex
+	db  *badger.DB
+}
+
+func NewTxnLabelStore(db *badger.DB) *TxnLabelStore {
+	return &TxnLabelStore{db: db}
+}
+
+// PutTxnLabel sets the label of label.TxnHash, replacing any label it had.
+func (store *TxnLabelStore) PutTxnLabel(label *TxnLabel) error {
+	if err := label.Validate(); err != nil {
+		return errors.Wrapf(err, "TxnLabelStore.PutTxnLabel: ")
+	}
+
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return DBPutTxnLabelWithTxn(txn, label)
+	})
+}
+
+// GetTxnLabel returns the txn's label, or nil if it doesn't have one.
+func (store *TxnLabelStore) GetTxnLabel(txnHash *BlockHash) (*TxnLabel, error) {
+	var label *TxnLabel
+	err := store.db.View(func(txn *badger.Txn) error {
+		var innerErr error
+		label, innerErr = DBGetTxnLabelWithTxn(txn, txnHash)
+		return innerErr
+	})
+	return label, err
+}
+
+func (store *TxnLabelStore) DeleteTxnLabel(txnHash *BlockHash) error {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return DBDeleteTxnLabelWithTxn(txn, txnHash)
+	})
+}
+
+// GetTxnLabelsForCategory returns the labels in the category, sorted by txn hash.
+func (store *TxnLabelStore) GetTxnLabelsForCategory(category string) ([]*TxnLabel, error) {
+	var labels []*TxnLabel
+	err := store.db.View(func(txn *badger.Txn) error {
+		prefix := _dbKeyForTxnLabelCategory(category)
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			txnHash := NewBlockHash(iterator.Item().KeyCopy(nil)[len(prefix):])
+			label, err := DBGetTxnLabelWithTxn(txn, txnHash)
+			if err != nil {
+				return errors.Wrapf(err, "TxnLabelStore.GetTxnLabelsForCategory: ")
+			}
+			if label != nil {
+				labels = append(labels, label)
+			}
+		}
+		return nil
+	})
+	return labels, err
+}
+
+// GetAllTxnLabels returns every label in the store, sorted by txn hash.
+func (store *TxnLabelStore) GetAllTxnLabels() ([]*TxnLabel, error) {
+	var labels []*TxnLabel
+	err := store.db.View(func(txn *badger.Txn) error {
+		prefix := Prefixes.PrefixTxnLabelByTxnHash
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			labelBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return errors.Wrapf(err, "TxnLabelStore.GetAllTxnLabels: Problem reading label: ")
+			}
+			label, err := DecodeDeSoEncoder(&TxnLabel{}, bytes.NewReader(labelBytes))
+			if err != nil {
+				return errors.Wrapf(err, "TxnLabelStore.GetAllTxnLabels: Problem decoding label: ")
+			}
+			labels = append(labels, label)
+		}
+		return nil
+	})
+	return labels, err
+}
+
+// ExportTxnLabels writes every label in the store to writer as JSON ExportedTxnLabels, one
+// per line.
+func (store *TxnLabelStore) ExportTxnLabels(writer io.Writer) (_numExported int, _err error) {
+	labels, err := store.GetAllTxnLabels()
+	if err != nil {
+		return 0, errors.Wrapf(err, "TxnLabelStore.ExportTxnLabels: ")
+	}
+	encoder := json.NewEncoder(writer)
+	for _, label := range labels {
+		if err = encoder.Encode(label.ToExportedTxnLabel()); err != nil {
+			return 0, errors.Wrapf(err, "TxnLabelStore.ExportTxnLabels: Problem writing label for txn %v: ",
+				label.TxnHash)
+		}
+	}
+	return len(labels), nil
+}
+
+// ImportTxnLabels reads labels written by ExportTxnLabels from reader and stores them. An
+// imported label replaces the txn's label unless the existing one was updated more recently,
+// so exports from several nodes can be merged. The labels are validated before any of them
+// are stored, and they're stored in a single db txn, so a bad file doesn't leave a partial
+// import behind.
+func (store *TxnLabelStore) ImportTxnLabels(reader io.Reader) (_numImported int, _err error) {
+	var labels []*TxnLabel
+	decoder := json.NewDecoder(reader)
+	for {
+		exportedLabel := &ExportedTxnLabel{}
+		if err := decoder.Decode(exportedLabel); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, errors.Wrapf(err, "TxnLabelStore.ImportTxnLabels: Problem decoding label %d: ", len(labels))
+		}
+		label, err := exportedLabel.ToTxnLabel()
+		if err != nil {
+			return 0, errors.Wrapf(err, "TxnLabelStore.ImportTxnLabels: Label %d: ", len(labels))
+		}
+		if err = label.Validate(); err != nil {
+			return 0, errors.Wrapf(err, "TxnLabelStore.ImportTxnLabels: Label %d: ", len(labels))
+		}
+		labels = append(labels, label)
+	}
+
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	numImported := 0
+	err := store.db.Update(func(txn *badger.Txn) error {
+		for _, label := range labels {
+			existingLabel, err := DBGetTxnLabelWithTxn(txn, label.TxnHash)
+			if err != nil {
+				return errors.Wrapf(err, "TxnLabelStore.ImportTxnLabels: ")
+			}
+			if existingLabel != nil && existingLabel.UpdatedTimestampNanoSecs > label.UpdatedTimestampNanoSecs {
+				continue
+			}
+			if err = DBPutTxnLabelWithTxn(txn, label); err != nil {
+				return errors.Wrapf(err, "TxnLabelStore.ImportTxnLabels: ")
+			}
+			numImported++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return numImported, nil
+}
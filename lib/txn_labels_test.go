@@ -0,0 +1,140 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnLabelStore(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	store := NewTxnLabelStore(db)
+
+	txnHash1 := NewBlockHash(append(make([]byte, HashSizeBytes-1), 1))
+	txnHash2 := NewBlockHash(append(make([]byte, HashSizeBytes-1), 2))
+	txnHash3 := NewBlockHash(append(make([]byte, HashSizeBytes-1), 3))
+	requireCategory := func(category string, expectedTxnHashes ...*BlockHash) {
+		labels, err := store.GetTxnLabelsForCategory(category)
+		require.NoError(err)
+		require.Len(labels, len(expectedTxnHashes))
+		for ii, txnHash := range expectedTxnHashes {
+			require.Equal(txnHash, labels[ii].TxnHash)
+			require.Equal(category, labels[ii].Category)
+		}
+	}
+
+	// A txn without a label has no label.
+	label, err := store.GetTxnLabel(txnHash1)
+	require.NoError(err)
+	require.Nil(label)
+
+	// Put a few labels and read them back.
+	label1 := &TxnLabel{TxnHash: txnHash1, Label: "rent", Memo: "march", Category: "expenses",
+		UpdatedTimestampNanoSecs: 100}
+	label2 := &TxnLabel{TxnHash: txnHash2, Label: "salary", Category: "income", UpdatedTimestampNanoSecs: 100}
+	label3 := &TxnLabel{TxnHash: txnHash3, Label: "groceries", Category: "expenses", UpdatedTimestampNanoSecs: 100}
+	for _, label := range []*TxnLabel{label1, label2, label3} {
+		require.NoError(store.PutTxnLabel(label))
+	}
+	label, err = store.GetTxnLabel(txnHash1)
+	require.NoError(err)
+	require.Equal(label1, label)
+	requireCategory("expenses", txnHash1, txnHash3)
+	requireCategory("income", txnHash2)
+	requireCategory("")
+
+	// Replacing a label moves it to its new category.
+	label3 = &TxnLabel{TxnHash: txnHash3, Label: "bonus", Category: "income", UpdatedTimestampNanoSecs: 200}
+	require.NoError(store.PutTxnLabel(label3))
+	label, err = store.GetTxnLabel(txnHash3)
+	require.NoError(err)
+	require.Equal(label3, label)
+	requireCategory("expenses", txnHash1)
+	requireCategory("income", txnHash2, txnHash3)
+
+	// A label without a category isn't in any category.
+	label2 = &TxnLabel{TxnHash: txnHash2, Label: "salary", UpdatedTimestampNanoSecs: 200}
+	require.NoError(store.PutTxnLabel(label2))
+	requireCategory("income", txnHash3)
+
+	// Deleting a label removes it from its category, and deleting it again is a no-op.
+	require.NoError(store.DeleteTxnLabel(txnHash1))
+	require.NoError(store.DeleteTxnLabel(txnHash1))
+	label, err = store.GetTxnLabel(txnHash1)
+	require.NoError(err)
+	require.Nil(label)
+	requireCategory("expenses")
+	labels, err := store.GetAllTxnLabels()
+	require.NoError(err)
+	require.Equal([]*TxnLabel{label2, label3}, labels)
+
+	// Invalid labels are rejected without changing the store.
+	invalidLabels := []*TxnLabel{
+		{Label: "no txn hash"},
+		{TxnHash: txnHash1, Label: strings.Repeat("a", MaxTxnLabelLengthBytes+1)},
+		{TxnHash: txnHash1, Memo: strings.Repeat("a", MaxTxnLabelMemoLengthBytes+1)},
+		{TxnHash: txnHash1, Category: strings.Repeat("a", MaxTxnLabelCategoryLengthBytes+1)},
+	}
+	for _, invalidLabel := range invalidLabels {
+		require.Error(store.PutTxnLabel(invalidLabel))
+	}
+	label, err = store.GetTxnLabel(txnHash1)
+	require.NoError(err)
+	require.Nil(label)
+
+	// Export the labels and import them into an empty store.
+	exportBuffer := &bytes.Buffer{}
+	numExported, err := store.ExportTxnLabels(exportBuffer)
+	require.NoError(err)
+	require.Equal(2, numExported)
+	exportedBytes := exportBuffer.Bytes()
+
+	importDb, _ := GetTestBadgerDb()
+	defer CleanUpBadger(importDb)
+	importStore := NewTxnLabelStore(importDb)
+	numImported, err := importStore.ImportTxnLabels(bytes.NewReader(exportedBytes))
+	require.NoError(err)
+	require.Equal(2, numImported)
+	importedLabels, err := importStore.GetAllTxnLabels()
+	require.NoError(err)
+	require.Equal(labels, importedLabels)
+	importedCategoryLabels, err := importStore.GetTxnLabelsForCategory("income")
+	require.NoError(err)
+	require.Equal([]*TxnLabel{label3}, importedCategoryLabels)
+
+	// Exporting the imported labels gives the same file back.
+	reexportBuffer := &bytes.Buffer{}
+	_, err = importStore.ExportTxnLabels(reexportBuffer)
+	require.NoError(err)
+	require.Equal(exportedBytes, reexportBuffer.Bytes())
+
+	// An import doesn't replace a label that was updated more recently.
+	newerLabel3 := &TxnLabel{TxnHash: txnHash3, Label: "bonus", Memo: "q1", Category: "income",
+		UpdatedTimestampNanoSecs: 300}
+	require.NoError(importStore.PutTxnLabel(newerLabel3))
+	numImported, err = importStore.ImportTxnLabels(bytes.NewReader(exportedBytes))
+	require.NoError(err)
+	require.Equal(1, numImported)
+	label, err = importStore.GetTxnLabel(txnHash3)
+	require.NoError(err)
+	require.Equal(newerLabel3, label)
+
+	// A file with a bad label isn't imported at all.
+	badFile := append(append([]byte{}, exportedBytes...),
+		[]byte(`{"TxnHashHex":"not hex","Label":"bad"}`+"\n")...)
+	importDb2, _ := GetTestBadgerDb()
+	defer CleanUpBadger(importDb2)
+	importStore2 := NewTxnLabelStore(importDb2)
+	_, err = importStore2.ImportTxnLabels(bytes.NewReader(badFile))
+	require.Error(err)
+	labels, err = importStore2.GetAllTxnLabels()
+	require.NoError(err)
+	require.Empty(labels)
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"github.com/pkg/errors"
+)
+
+// A TxnPreview breaks down what a txn built by one of the Create*Txn helpers will cost, so
+// that integrators can show users the size and fee of a txn before asking them to sign it.
+// The helpers only build txns, using a mempool-augmented view to pick the txn's nonce or
+// inputs when they're given a mempool, and never sign or broadcast them. Since almost all
+// of them return the txn, its total input, change, fees, and an error, a preview can be made
+// by passing their results straight to NewTxnPreview:
+//
+//	preview, err := NewTxnPreview(bc.CreateLikeTxn(...))
+//
+// The helpers that return other values, like CreateMaxSpend, can be previewed by passing
+// the corresponding values explicitly.
+type TxnPreview struct {
+	Txn     *MsgDeSoTxn
+	TxnType TxnType
+
+	// UnsignedSizeBytes is the size of the txn without its signature, and MaxSizeBytes is its
+	// size with the largest possible signature, which is what the fee is computed from.
+	UnsignedSizeBytes uint64
+	MaxSizeBytes      uint64
+
+	// FeeNanos is the fee the txn pays, and FeeRateNanosPerKB is the rate it pays at its
+	// MaxSizeBytes. The rate is at least the one requested from the helper, unless the fee
+	// was set explicitly.
+	FeeNanos          uint64
+	FeeRateNanosPerKB uint64
+
+	// TotalInputNanos is the DESO the txn spends from the transactor, including the fee, and
+	// ChangeNanos is the part of it returned to the transactor. Balance model txns don't pay
+	// change, so it's always zero for them. SpendNanos is the DESO spent on anything other
+	// than the fee, like the txn's outputs or the price of what it buys.
+	TotalInputNanos uint64
+	ChangeNanos     uint64
+	SpendNanos      uint64
+
+	// Inputs are the UTXOs selected to fund the txn. They're only set for UTXO model txns.
+	Inputs []*DeSoInput
+	// Nonce is the nonce picked for the txn. It's only set for balance model txns.
+	Nonce *DeSoNonce
+}
+
+// NewTxnPreview returns the preview of a txn built by a Create*Txn helper from the values the
+// helper returned. If the helper returned an error, the error is returned.
+func NewTxnPreview(txn *MsgDeSoTxn, totalInput uint64, changeAmount uint64, fees uint64, err error) (
+	*TxnPreview, error) {
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewTxnPreview: Problem creating txn: ")
+	}
+	if txn == nil || txn.TxnMeta == nil {
+		return nil, errors.New("NewTxnPreview: Txn and its metadata must be set")
+	}
+
+	unsignedTxnBytes, err := txn.ToBytes(true /*preSignature*/)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewTxnPreview: Problem serializing txn: ")
+	}
+	maxSizeBytes := _computeMaxTxSize(txn)
+
+	preview := &TxnPreview{
+		Txn:               txn,
+		TxnType:           txn.TxnMeta.GetTxnType(),
+		UnsignedSizeBytes: uint64(len(unsignedTxnBytes)),
+		MaxSizeBytes:      maxSizeBytes,
+		FeeNanos:          fees,
+		TotalInputNanos:   totalInput,
+		ChangeNanos:       changeAmount,
+		Inputs:            txn.TxInputs,
+		Nonce:             txn.TxnNonce,
+	}
+	if maxSizeBytes > 0 {
+		preview.FeeRateNanosPerKB = fees * BytesPerKB / maxSizeBytes
+	}
+	if totalInput >= changeAmount+fees {
+		preview.SpendNanos = totalInput - changeAmount - fees
+	}
+	return preview, nil
+}
@@ -0,0 +1,112 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalanceModelTxnPreview(t *testing.T) {
+	setBalanceModelBlockHeights(t)
+
+	t.Run("TestTxnPreview", TestTxnPreview)
+}
+
+func TestTxnPreview(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.BlockRewardMaturity = 0
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 3; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	blockHeight := chain.blockTip().Height + 1
+	isBalanceModel := blockHeight >= params.ForkHeights.BalanceModelBlockHeight
+
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	recipientPkBytes, _, err := Base58CheckDecode(recipientPkString)
+	require.NoError(err)
+	// A high fee rate makes a size that's off by even a byte change the fee.
+	feeRateNanosPerKB := uint64(10000)
+
+	// requirePreviewMatchesSignedTxn signs the previewed txn and checks that the preview's size
+	// and fee hold for the txn that's actually connected.
+	requirePreviewMatchesSignedTxn := func(preview *TxnPreview) {
+		txn := preview.Txn
+		unsignedTxnBytes, err := txn.ToBytes(true /*preSignature*/)
+		require.NoError(err)
+		require.Equal(uint64(len(unsignedTxnBytes)), preview.UnsignedSizeBytes)
+		require.Equal(txn.TxnMeta.GetTxnType(), preview.TxnType)
+
+		_signTxn(t, txn, senderPrivString)
+		signedTxnBytes, err := txn.ToBytes(false /*preSignature*/)
+		require.NoError(err)
+		signedSizeBytes := uint64(len(signedTxnBytes))
+		require.Greater(signedSizeBytes, preview.UnsignedSizeBytes)
+		require.LessOrEqual(signedSizeBytes, preview.MaxSizeBytes)
+		// Signing doesn't change the rest of the txn.
+		unsignedTxnBytes, err = txn.ToBytes(true /*preSignature*/)
+		require.NoError(err)
+		require.Equal(uint64(len(unsignedTxnBytes)), preview.UnsignedSizeBytes)
+
+		// The fee pays for the signed txn at the requested rate.
+		require.GreaterOrEqual(preview.FeeRateNanosPerKB, feeRateNanosPerKB)
+		require.GreaterOrEqual(preview.FeeNanos*BytesPerKB/signedSizeBytes, feeRateNanosPerKB)
+
+		// The signed txn connects with the fee and total input from the preview.
+		utxoView := NewUtxoView(chain.db, params, chain.postgres, chain.snapshot, nil)
+		_, totalInput, totalOutput, fees, err := utxoView.ConnectTransaction(
+			txn, txn.Hash(), blockHeight, 0, true, false)
+		require.NoError(err)
+		require.Equal(preview.FeeNanos, fees)
+		require.Equal(preview.TotalInputNanos, totalInput)
+		require.Equal(totalInput, totalOutput+fees)
+
+		if isBalanceModel {
+			require.Equal(txn.TxnFeeNanos, preview.FeeNanos)
+			require.Equal(txn.TxnNonce, preview.Nonce)
+			require.NotNil(preview.Nonce)
+			require.Empty(preview.Inputs)
+			require.Zero(preview.ChangeNanos)
+		} else {
+			require.Nil(preview.Nonce)
+			require.NotEmpty(preview.Inputs)
+			require.Equal(txn.TxInputs, preview.Inputs)
+		}
+	}
+
+	// A txn that only pays a fee.
+	{
+		preview, err := NewTxnPreview(chain.CreateUpdateProfileTxn(
+			senderPkBytes, nil, "sender", "i am the sender", shortPic, 10*100, 1.25*100*100, false, 0, nil,
+			feeRateNanosPerKB, mempool, nil))
+		require.NoError(err)
+		require.Zero(preview.SpendNanos)
+		requirePreviewMatchesSignedTxn(preview)
+	}
+
+	// A txn that also sends DESO, from a helper that doesn't return change.
+	{
+		txn, totalInput, spendAmount, fees, err := chain.CreateMaxSpend(
+			senderPkBytes, recipientPkBytes, nil, feeRateNanosPerKB, mempool, nil)
+		preview, err := NewTxnPreview(txn, totalInput, 0 /*changeAmount*/, fees, err)
+		require.NoError(err)
+		require.NotZero(spendAmount)
+		require.Equal(spendAmount, preview.SpendNanos)
+		require.Equal(totalInput, spendAmount+fees)
+		requirePreviewMatchesSignedTxn(preview)
+	}
+
+	// A helper's error is returned.
+	_, err = NewTxnPreview(nil, 0, 0, 0, errors.New("helper error"))
+	require.Error(err)
+	require.Contains(err.Error(), "helper error")
+}
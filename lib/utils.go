@@ -15,6 +15,7 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/pkg/errors"
+	"github.com/tyler-smith/go-bip39"
 	"github.com/unrolled/secure"
 	"golang.org/x/crypto/sha3"
 )
@@ -67,12 +68,41 @@ func MinUint32(a, b uint32) uint32 {
 	return b
 }
 
+// ParsePrivateKeySeed returns the private key for a seed given on the command line. If the
+// seed begins with 0x, we treat it as a hex private key. Otherwise, we treat it as a seed phrase.
+func ParsePrivateKeySeed(seed string, params *DeSoParams) (*btcec.PrivateKey, error) {
+	if strings.HasPrefix(seed, "0x") {
+		privKeyBytes, err := hex.DecodeString(seed[2:])
+		if err != nil {
+			return nil, fmt.Errorf("ParsePrivateKeySeed: Error decoding hex seed: %+v", err)
+		}
+		privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes)
+		return privKey, nil
+	}
+
+	seedBytes, err := bip39.NewSeedWithErrorChecking(seed, "")
+	if err != nil {
+		return nil, fmt.Errorf("ParsePrivateKeySeed: Error converting mnemonic: %+v", err)
+	}
+	_, privKey, _, err := ComputeKeysFromSeed(seedBytes, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("ParsePrivateKeySeed: Error computing keys from seed: %+v", err)
+	}
+	return privKey, nil
+}
+
 func ComputeKeysFromSeed(seedBytes []byte, index uint32, params *DeSoParams) (_pubKey *btcec.PublicKey, _privKey *btcec.PrivateKey, _btcAddress string, _err error) {
 	isTestnet := params.NetworkType == NetworkType_TESTNET
 	return ComputeKeysFromSeedWithNet(seedBytes, index, isTestnet)
 }
 
 func ComputeKeysFromSeedWithNet(seedBytes []byte, index uint32, isTestnet bool) (_pubKey *btcec.PublicKey, _privKey *btcec.PrivateKey, _btcAddress string, _err error) {
+	return ComputeKeysFromSeedAtPathWithNet(seedBytes, &HDDerivationPath{AddressIndex: index}, isTestnet)
+}
+
+// ComputeKeysFromSeedAtPathWithNet is like ComputeKeysFromSeedWithNet, but it derives the keys
+// at any account, change, and address index rather than only the address index.
+func ComputeKeysFromSeedAtPathWithNet(seedBytes []byte, path *HDDerivationPath, isTestnet bool) (_pubKey *btcec.PublicKey, _privKey *btcec.PrivateKey, _btcAddress string, _err error) {
 	// Get the pubkey and privkey from the seed. We use the Bitcoin parameters
 	// to generate them.
 	// TODO: We should get this from the DeSoParams, not reference them directly.
@@ -88,7 +118,7 @@ func ComputeKeysFromSeedWithNet(seedBytes []byte, index uint32, isTestnet bool)
 	// We follow BIP44 to generate the addresses. Recall it follows the following
 	// semantic hierarchy:
 	// * purpose' / coin_type' / account' / change / address_index
-	// For the derivation path we use: m/44'/0'/0'/0/0. Recall that 0' means we're
+	// By default we use the derivation path: m/44'/0'/0'/0/0. Recall that 0' means we're
 	// computing a "hardened" key, which means the private key is present, and
 	// that 0 (no apostrophe) means we're computing an "unhardened" key which means
 	// the private key is not present.
@@ -100,19 +130,19 @@ func ComputeKeysFromSeedWithNet(seedBytes []byte, index uint32, isTestnet bool)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("ComputeKeyFromSeed: Error encountered generating 'purpose' from seed (%v)", err)
 	}
-	coinTypeKey, err := purpose.Child(hdkeychain.HardenedKeyStart + 0)
+	coinTypeKey, err := purpose.Child(hdkeychain.HardenedKeyStart + DeSoBIP44CoinType)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("ComputeKeyFromSeed: Error encountered generating 'coinType' from seed (%v)", err)
 	}
-	accountKey, err := coinTypeKey.Child(hdkeychain.HardenedKeyStart + 0)
+	accountKey, err := coinTypeKey.Child(hdkeychain.HardenedKeyStart + path.Account)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("ComputeKeyFromSeed: Error encountered generating 'accountKey' from seed (%v)", err)
 	}
-	changeKey, err := accountKey.Child(0)
+	changeKey, err := accountKey.Child(path.Change)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("ComputeKeyFromSeed: Error encountered generating 'changeKey' from seed (%v)", err)
 	}
-	addressKey, err := changeKey.Child(index)
+	addressKey, err := changeKey.Child(path.AddressIndex)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("ComputeKeyFromSeed: Error encountered generating 'addressKey' from seed (%v)", err)
 	}
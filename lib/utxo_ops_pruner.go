@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Every block on the main chain keeps the UtxoOperations it performed, so that it can be
+// disconnected in a reorg. The operations hold the entries the block's txns changed as they
+// were before, including every UTXO the block spent, so they end up taking a large share of
+// the disk of a node that has been synced from genesis, even though only the last few blocks
+// can ever be disconnected. Spent UTXOs are deleted from the state as soon as they're spent,
+// so the operations are the only place they're still kept.
+//
+// API nodes that don't need deep reorg support can opt into pruning them with a PruneMode.
+// The UtxoOpsPruner deletes the operations of blocks that are more than a configurable depth
+// below the tip as blocks are committed, which leaves the node with a pruned UTXO set: the
+// current state, and nothing about the UTXOs spent before the depth. Blocks, headers, the
+// block index, and the current state are all kept, so a pruned node still serves blocks to
+// peers and snapshots to hypersyncing nodes. A pruned node can't reorg more blocks than the
+// depth, and anything that reads the operations of older blocks, like a finalized view with
+// more confirmations than the depth, no longer works.
+//
+// Pruning is local to the node. The operations aren't part of the state checksum, so they're
+// deleted without touching the snapshot or notifying the state syncer.
+
+const (
+	// MinUtxoOpsPruneDepth is the lowest depth operations can be pruned at, so that a node
+	// can still handle ordinary reorgs.
+	MinUtxoOpsPruneDepth = 100
+	// utxoOpsPruneMaxBlocksPerCommit bounds the number of blocks pruned each time a block is
+	// committed, so that a node that just turned pruning on catches up gradually instead of
+	// holding up block processing.
+	utxoOpsPruneMaxBlocksPerCommit = 1000
+)
+
+// PruneMode is what a node keeps of the blocks below its prune depth.
+type PruneMode string
+
+const (
+	// PruneModeNone keeps the UtxoOperations of every block, so the node can reorg any number
+	// of blocks. A node whose operations have already been pruned can't go back to it.
+	PruneModeNone PruneMode = "none"
+	// PruneModePruned prunes the UtxoOperations of blocks below the depth.
+	PruneModePruned PruneMode = "pruned"
+	// PruneModeArchive is a read-only archive node. It prunes UtxoOperations like
+	// PruneModePruned, but keeps and serves every historical block, so it has to sync as an
+	// archival node. Since it can't reorg past the depth, it only follows the chain and never
+	// mines or validates blocks of its own.
+	PruneModeArchive PruneMode = "archive"
+)
+
+// ValidatePruneFlags checks that the prune mode and depth can be used with the node's sync
+// type, and with whether it produces blocks.
+func ValidatePruneFlags(pruneMode PruneMode, depth uint64, syncType NodeSyncType, producesBlocks bool) error {
+	switch pruneMode {
+	case PruneModeNone:
+		if depth != 0 {
+			return fmt.Errorf("ValidatePruneFlags: A prune depth can't be set with prune mode %v", pruneMode)
+		}
+		return nil
+	case PruneModePruned, PruneModeArchive:
+		if depth < MinUtxoOpsPruneDepth {
+			return fmt.Errorf("ValidatePruneFlags: Prune depth %d is less than the minimum of %d",
+				depth, MinUtxoOpsPruneDepth)
+		}
+	default:
+		return fmt.Errorf("ValidatePruneFlags: Unrecognized prune mode %v", pruneMode)
+	}
+	if pruneMode == PruneModeArchive {
+		if !IsNodeArchival(syncType) {
+			return fmt.Errorf("ValidatePruneFlags: Prune mode %v requires an archival sync type, "+
+				"not %v", pruneMode, syncType)
+		}
+		if producesBlocks {
+			return fmt.Errorf("ValidatePruneFlags: Prune mode %v is read-only, so it can't mine "+
+				"or validate blocks", pruneMode)
+		}
+	}
+	return nil
+}
+
+// CheckUtxoOpsNotPruned returns an error if the UtxoOperations in the db have been pruned,
+// since a node that stops pruning would otherwise accept reorgs it can't disconnect.
+func CheckUtxoOpsNotPruned(handle *badger.DB) error {
+	prunedThroughHeight, hasPruned, err := DBGetUtxoOpsPrunedThroughHeight(handle)
+	if err != nil {
+		return errors.Wrapf(err, "CheckUtxoOpsNotPruned: ")
+	}
+	if hasPruned {
+		return fmt.Errorf("CheckUtxoOpsNotPruned: UtxoOperations have been pruned through height "+
+			"%d, so the node has to keep pruning them or resync", prunedThroughHeight)
+	}
+	return nil
+}
+
+type UtxoOpsPruner struct {
+	blockchain *Blockchain
+	depth      uint64
+
+	mtx sync.Mutex
+	// prunedThroughHeight is the height through which operations have been pruned. It's only
+	// meaningful when hasPruned is true.
+	prunedThroughHeight uint64
+	hasPruned           bool
+}
+
+// NewUtxoOpsPruner creates a pruner that keeps the operations of the depth blocks below the
+// tip. It picks up where a previous pruner left off.
+func NewUtxoOpsPruner(blockchain *Blockchain, depth uint64) (*UtxoOpsPruner, error) {
+	if depth < MinUtxoOpsPruneDepth {
+		return nil, fmt.Errorf("NewUtxoOpsPruner: Depth %d is less than the minimum of %d",
+			depth, MinUtxoOpsPruneDepth)
+	}
+	prunedThroughHeight, hasPruned, err := DBGetUtxoOpsPrunedThroughHeight(blockchain.db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewUtxoOpsPruner: ")
+	}
+	return &UtxoOpsPruner{
+		blockchain:          blockchain,
+		depth:               depth,
+		prunedThroughHeight: prunedThroughHeight,
+		hasPruned:           hasPruned,
+	}, nil
+}
+
+func (pruner *UtxoOpsPruner) GetDepth() uint64 {
+	return pruner.depth
+}
+
+// GetPrunedThroughHeight returns the height through which operations have been pruned, and
+// false if none have been pruned yet.
+func (pruner *UtxoOpsPruner) GetPrunedThroughHeight() (uint64, bool) {
+	pruner.mtx.Lock()
+	defer pruner.mtx.Unlock()
+
+	return pruner.prunedThroughHeight, pruner.hasPruned
+}
+
+// HandleBlockCommitted is registered with the EventManager for committed blocks. It's called
+// with the ChainLock held, which keeps the best chain from changing while it's read.
+func (pruner *UtxoOpsPruner) HandleBlockCommitted(event *BlockEvent) {
+	tipHeight := event.Block.Header.Height
+	if tipHeight <= pruner.depth {
+		return
+	}
+	if err := pruner.pruneThroughHeight(tipHeight - pruner.depth - 1); err != nil {
+		glog.Errorf("UtxoOpsPruner.HandleBlockCommitted: %v", err)
+	}
+}
+
+// pruneThroughHeight deletes the operations of the main chain's blocks through the given
+// height, up to utxoOpsPruneMaxBlocksPerCommit at a time.
+func (pruner *UtxoOpsPruner) pruneThroughHeight(targetHeight uint64) error {
+	pruner.mtx.Lock()
+	defer pruner.mtx.Unlock()
+
+	// The genesis block has no operations, so pruning starts at height 1.
+	startHeight := uint64(1)
+	if pruner.hasPruned {
+		startHeight = pruner.prunedThroughHeight + 1
+	}
+	if startHeight > targetHeight {
+		return nil
+	}
+	endHeight := targetHeight
+	if endHeight-startHeight+1 > utxoOpsPruneMaxBlocksPerCommit {
+		endHeight = startHeight + utxoOpsPruneMaxBlocksPerCommit - 1
+	}
+
+	bestChain := pruner.blockchain.bestChain
+	if endHeight >= uint64(len(bestChain)) {
+		return fmt.Errorf("pruneThroughHeight: Height %d is past the best chain's tip", endHeight)
+	}
+	err := pruner.blockchain.db.Update(func(txn *badger.Txn) error {
+		for height := startHeight; height <= endHeight; height++ {
+			// Blocks that were hypersynced past never had operations, in which case there's
+			// nothing to delete. The operations aren't state, so they're deleted without the
+			// snapshot or the event manager.
+			if err := DeleteUtxoOperationsForBlockWithTxn(txn, nil, bestChain[height].Hash, nil, true); err != nil {
+				return errors.Wrapf(err, "Problem deleting operations for block %v at height %d",
+					bestChain[height].Hash, height)
+			}
+		}
+		return DBPutUtxoOpsPrunedThroughHeightWithTxn(txn, endHeight)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "pruneThroughHeight: ")
+	}
+
+	glog.V(1).Infof("UtxoOpsPruner.pruneThroughHeight: Pruned operations for heights %d to %d",
+		startHeight, endHeight)
+	pruner.prunedThroughHeight = endHeight
+	pruner.hasPruned = true
+	return nil
+}
+
+// ==================================================================
+// DB
+// ==================================================================
+
+// DBGetUtxoOpsPrunedThroughHeight returns the height through which operations have been
+// pruned, and false if they never have been.
+func DBGetUtxoOpsPrunedThroughHeight(handle *badger.DB) (_height uint64, _hasPruned bool, _err error) {
+	var heightBytes []byte
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		heightBytes, innerErr = DBGetWithTxn(txn, nil, Prefixes.PrefixUtxoOpsPrunedThroughHeight)
+		return innerErr
+	})
+	if err == badger.ErrKeyNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "DBGetUtxoOpsPrunedThroughHeight: ")
+	}
+	if len(heightBytes) != 8 {
+		return 0, false, fmt.Errorf("DBGetUtxoOpsPrunedThroughHeight: Height has invalid length %d",
+			len(heightBytes))
+	}
+	return DecodeUint64(heightBytes), true, nil
+}
+
+func DBPutUtxoOpsPrunedThroughHeightWithTxn(txn *badger.Txn, height uint64) error {
+	return DBSetWithTxn(txn, nil, Prefixes.PrefixUtxoOpsPrunedThroughHeight, EncodeUint64(height), nil)
+}
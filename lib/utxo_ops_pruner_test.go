@@ -0,0 +1,93 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePruneFlags(t *testing.T) {
+	require := require.New(t)
+
+	// Not pruning doesn't take a depth.
+	require.NoError(ValidatePruneFlags(PruneModeNone, 0, NodeSyncTypeHyperSync, true))
+	require.Error(ValidatePruneFlags(PruneModeNone, MinUtxoOpsPruneDepth, NodeSyncTypeHyperSync, false))
+
+	// Pruning needs a depth of at least the min, and works with any sync type.
+	require.NoError(ValidatePruneFlags(PruneModePruned, MinUtxoOpsPruneDepth, NodeSyncTypeHyperSync, true))
+	require.Error(ValidatePruneFlags(PruneModePruned, MinUtxoOpsPruneDepth-1, NodeSyncTypeHyperSync, false))
+
+	// An archive node also has to sync as an archival node and can't produce blocks.
+	require.NoError(ValidatePruneFlags(PruneModeArchive, MinUtxoOpsPruneDepth, NodeSyncTypeHyperSyncArchival, false))
+	require.Error(ValidatePruneFlags(PruneModeArchive, MinUtxoOpsPruneDepth-1, NodeSyncTypeHyperSyncArchival, false))
+	require.Error(ValidatePruneFlags(PruneModeArchive, MinUtxoOpsPruneDepth, NodeSyncTypeHyperSync, false))
+	require.Error(ValidatePruneFlags(PruneModeArchive, MinUtxoOpsPruneDepth, NodeSyncTypeBlockSync, true))
+
+	require.Error(ValidatePruneFlags("everything", MinUtxoOpsPruneDepth, NodeSyncTypeBlockSync, false))
+}
+
+func TestUtxoOpsPruner(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	// Store UtxoOperations for every block on a best chain of 250 blocks.
+	bc := &Blockchain{db: db}
+	for height := uint32(0); height < 250; height++ {
+		bc.bestChain = append(bc.bestChain, &BlockNode{Hash: NewBlockHash(RandomBytes(HashSizeBytes)), Height: height})
+	}
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		for _, blockNode := range bc.bestChain[1:] {
+			if err := PutUtxoOperationsForBlockWithTxn(
+				txn, nil, uint64(blockNode.Height), blockNode.Hash, [][]*UtxoOperation{}, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	requireHasUtxoOps := func(height int, expected bool) {
+		_, err := GetUtxoOperationsForBlock(db, nil, bc.bestChain[height].Hash)
+		if expected {
+			require.NoError(err)
+		} else {
+			require.Equal(badger.ErrKeyNotFound, err)
+		}
+	}
+
+	_, err := NewUtxoOpsPruner(bc, MinUtxoOpsPruneDepth-1)
+	require.Error(err)
+	pruner, err := NewUtxoOpsPruner(bc, MinUtxoOpsPruneDepth)
+	require.NoError(err)
+	_, hasPruned := pruner.GetPrunedThroughHeight()
+	require.False(hasPruned)
+	require.NoError(CheckUtxoOpsNotPruned(db))
+
+	// Nothing is pruned until the tip is more than the depth above the first block.
+	pruner.HandleBlockCommitted(&BlockEvent{Block: &MsgDeSoBlock{Header: &MsgDeSoHeader{Height: MinUtxoOpsPruneDepth}}})
+	_, hasPruned = pruner.GetPrunedThroughHeight()
+	require.False(hasPruned)
+	requireHasUtxoOps(1, true)
+
+	// Committing the tip prunes every block more than the depth below it.
+	pruner.HandleBlockCommitted(&BlockEvent{Block: &MsgDeSoBlock{Header: &MsgDeSoHeader{Height: 249}}})
+	prunedThroughHeight, hasPruned := pruner.GetPrunedThroughHeight()
+	require.True(hasPruned)
+	require.Equal(uint64(249-MinUtxoOpsPruneDepth-1), prunedThroughHeight)
+	requireHasUtxoOps(1, false)
+	requireHasUtxoOps(int(prunedThroughHeight), false)
+	requireHasUtxoOps(int(prunedThroughHeight)+1, true)
+	requireHasUtxoOps(249, true)
+
+	// The pruned height is persisted, so a new pruner picks up where this one left off, and a
+	// node that stops pruning is refused.
+	pruner, err = NewUtxoOpsPruner(bc, MinUtxoOpsPruneDepth)
+	require.NoError(err)
+	persistedHeight, hasPruned := pruner.GetPrunedThroughHeight()
+	require.True(hasPruned)
+	require.Equal(prunedThroughHeight, persistedHeight)
+	require.Error(CheckUtxoOpsNotPruned(db))
+}
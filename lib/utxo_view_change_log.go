@@ -0,0 +1,278 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Services that mirror the chain's state into their own database, like the postgres data
+// handler, either run a postgres-enabled node or consume the StateChangeSyncer's output,
+// which also carries mempool state and has to be reconciled with it. A UtxoViewChangeLog is a
+// simpler change-data-capture output: an append-only file with one batch per committed
+// UtxoView flush, holding every key the flush set or deleted, in order, along with the value
+// it was set to. A consumer that applies the batches in order ends up with the node's state.
+//
+// Batches come from the flush hooks in block_view_flush_hooks.go, so each one carries the
+// SequenceNumber of the flush's UtxoViewFlushCursor and is only written once the flush has
+// committed. Consumers can resume from the offset after the last batch they applied, and can
+// use the sequence numbers to detect batches that are missing, e.g. because the node crashed
+// after committing a flush but before appending its batch. The log only has the flushes
+// committed while it was enabled, and hypersync doesn't write state through flushes, so a
+// consumer needs the state as of the log's first batch from elsewhere.
+//
+// Each record is the length of the batch's bytes, a CRC32 checksum of them, and the bytes
+// themselves. A record that's cut off at the end of the log is still being written, or was
+// being written when the node crashed, so readers stop before it and the log truncates it
+// when it's reopened. Unlike the mempool journal, a record with a bad checksum is an error,
+// since skipping it would silently drop state changes.
+
+// utxoViewChangeLogRecordHeaderSize is the size of a record's length and checksum.
+const utxoViewChangeLogRecordHeaderSize = 8
+
+// UtxoViewChangeLogBatch holds the mutations of a single committed UtxoView flush.
+type UtxoViewChangeLogBatch struct {
+	SequenceNumber uint64
+	BlockHeight    uint64
+	Mutations      []*UtxoViewFlushMutation
+}
+
+func (batch *UtxoViewChangeLogBatch) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(batch.SequenceNumber)...)
+	data = append(data, UintToBuf(batch.BlockHeight)...)
+	data = append(data, UintToBuf(uint64(len(batch.Mutations)))...)
+	for _, mutation := range batch.Mutations {
+		data = append(data, byte(mutation.OperationType))
+		data = append(data, EncodeByteArray(mutation.KeyBytes)...)
+		data = append(data, EncodeByteArray(mutation.EncoderBytes)...)
+	}
+	return data
+}
+
+func (batch *UtxoViewChangeLogBatch) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	batch.SequenceNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewChangeLogBatch.FromBytes: Problem reading SequenceNumber: ")
+	}
+	batch.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewChangeLogBatch.FromBytes: Problem reading BlockHeight: ")
+	}
+	numMutations, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewChangeLogBatch.FromBytes: Problem reading number of Mutations: ")
+	}
+	batch.Mutations, err = SafeMakeSliceWithLength[*UtxoViewFlushMutation](numMutations)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoViewChangeLogBatch.FromBytes: Problem creating Mutations slice: ")
+	}
+	for ii := range batch.Mutations {
+		mutation := &UtxoViewFlushMutation{}
+		operationType, err := rr.ReadByte()
+		if err != nil {
+			return errors.Wrapf(err, "UtxoViewChangeLogBatch.FromBytes: Problem reading OperationType: ")
+		}
+		mutation.OperationType = StateSyncerOperationType(operationType)
+		if mutation.OperationType != DbOperationTypeUpsert && mutation.OperationType != DbOperationTypeDelete {
+			return errors.Errorf("UtxoViewChangeLogBatch.FromBytes: Invalid OperationType %d", operationType)
+		}
+		mutation.KeyBytes, err = DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "UtxoViewChangeLogBatch.FromBytes: Problem reading KeyBytes: ")
+		}
+		mutation.EncoderBytes, err = DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "UtxoViewChangeLogBatch.FromBytes: Problem reading EncoderBytes: ")
+		}
+		batch.Mutations[ii] = mutation
+	}
+	return nil
+}
+
+// UtxoViewChangeLog appends a batch to a file for every committed UtxoView flush.
+type UtxoViewChangeLog struct {
+	mtx  sync.Mutex
+	path string
+	file *os.File
+	// lastSequenceNumber is the SequenceNumber of the last batch in the log, if hasBatches.
+	lastSequenceNumber uint64
+	hasBatches         bool
+}
+
+// NewUtxoViewChangeLog returns a log that appends to the file at path, creating it if it
+// doesn't exist. A record that was cut off at the end of the file is truncated.
+func NewUtxoViewChangeLog(path string) (*UtxoViewChangeLog, error) {
+	changeLog := &UtxoViewChangeLog{path: path}
+
+	// Find the end of the last complete record and the sequence number of its batch.
+	existingFile, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "NewUtxoViewChangeLog: problem opening %v: ", path)
+	}
+	if err == nil {
+		endOffset := int64(0)
+		reader := bufio.NewReader(existingFile)
+		for {
+			batchBytes, recordSize, err := readUtxoViewChangeLogRecord(reader)
+			if err != nil {
+				existingFile.Close()
+				return nil, errors.Wrapf(err, "NewUtxoViewChangeLog: problem reading record at offset %d of %v: ",
+					endOffset, path)
+			}
+			if batchBytes == nil {
+				break
+			}
+			changeLog.lastSequenceNumber, err = ReadUvarint(bytes.NewReader(batchBytes))
+			if err != nil {
+				existingFile.Close()
+				return nil, errors.Wrapf(err, "NewUtxoViewChangeLog: problem reading batch at offset %d of %v: ",
+					endOffset, path)
+			}
+			changeLog.hasBatches = true
+			endOffset += recordSize
+		}
+		fileInfo, err := existingFile.Stat()
+		existingFile.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewUtxoViewChangeLog: problem reading size of %v: ", path)
+		}
+		if fileInfo.Size() > endOffset {
+			glog.Warningf("NewUtxoViewChangeLog: Truncating cut off record at offset %d of %v", endOffset, path)
+			if err = os.Truncate(path, endOffset); err != nil {
+				return nil, errors.Wrapf(err, "NewUtxoViewChangeLog: problem truncating %v: ", path)
+			}
+		}
+	}
+
+	changeLog.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewUtxoViewChangeLog: problem opening %v: ", path)
+	}
+	return changeLog, nil
+}
+
+// GetLastSequenceNumber returns the SequenceNumber of the last batch in the log, or false if
+// the log is empty.
+func (changeLog *UtxoViewChangeLog) GetLastSequenceNumber() (uint64, bool) {
+	changeLog.mtx.Lock()
+	defer changeLog.mtx.Unlock()
+
+	return changeLog.lastSequenceNumber, changeLog.hasBatches
+}
+
+// HandleUtxoViewFlushed is registered with the EventManager, which must have flush mutations
+// enabled. Errors are logged rather than returned, since the flush has already committed.
+func (changeLog *UtxoViewChangeLog) HandleUtxoViewFlushed(event *UtxoViewFlushedEvent) {
+	changeLog.mtx.Lock()
+	defer changeLog.mtx.Unlock()
+
+	if changeLog.file == nil {
+		return
+	}
+	batch := &UtxoViewChangeLogBatch{
+		SequenceNumber: event.Cursor.SequenceNumber,
+		BlockHeight:    event.Cursor.BlockHeight,
+		Mutations:      event.Mutations,
+	}
+	if changeLog.hasBatches && batch.SequenceNumber != changeLog.lastSequenceNumber+1 {
+		glog.Warningf("UtxoViewChangeLog.HandleUtxoViewFlushed: Flushes %d to %d are missing from the log",
+			changeLog.lastSequenceNumber+1, batch.SequenceNumber)
+	}
+	if _, err := changeLog.file.Write(encodeUtxoViewChangeLogRecord(batch)); err != nil {
+		glog.Errorf("UtxoViewChangeLog.HandleUtxoViewFlushed: problem appending flush %d: %v",
+			batch.SequenceNumber, err)
+		return
+	}
+	changeLog.lastSequenceNumber = batch.SequenceNumber
+	changeLog.hasBatches = true
+}
+
+func (changeLog *UtxoViewChangeLog) Close() error {
+	changeLog.mtx.Lock()
+	defer changeLog.mtx.Unlock()
+
+	if changeLog.file == nil {
+		return nil
+	}
+	err := changeLog.file.Close()
+	changeLog.file = nil
+	return err
+}
+
+func encodeUtxoViewChangeLogRecord(batch *UtxoViewChangeLogBatch) []byte {
+	batchBytes := batch.ToBytes()
+	record := make([]byte, utxoViewChangeLogRecordHeaderSize, utxoViewChangeLogRecordHeaderSize+len(batchBytes))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(batchBytes)))
+	binary.BigEndian.PutUint32(record[4:utxoViewChangeLogRecordHeaderSize], crc32.ChecksumIEEE(batchBytes))
+	return append(record, batchBytes...)
+}
+
+// readUtxoViewChangeLogRecord reads the next record and returns its batch's bytes and the
+// record's size. It returns nil bytes if there's no complete record left.
+func readUtxoViewChangeLogRecord(reader io.Reader) (_batchBytes []byte, _recordSize int64, _err error) {
+	header := make([]byte, utxoViewChangeLogRecordHeaderSize)
+	if _, err := io.ReadFull(reader, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	batchBytes := make([]byte, binary.BigEndian.Uint32(header[:4]))
+	if _, err := io.ReadFull(reader, batchBytes); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(batchBytes) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, errors.New("record has an invalid checksum")
+	}
+	return batchBytes, int64(utxoViewChangeLogRecordHeaderSize + len(batchBytes)), nil
+}
+
+// ReadUtxoViewChangeLog reads up to maxBatches batches from the log at path, starting at
+// offset, which must be zero or an offset returned by a previous call. It returns the
+// batches along with the offset to continue reading from, so a consumer can tail the log by
+// calling it again with that offset. A maxBatches of zero reads every batch.
+func ReadUtxoViewChangeLog(path string, offset int64, maxBatches int) (
+	_batches []*UtxoViewChangeLogBatch, _nextOffset int64, _err error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "ReadUtxoViewChangeLog: problem opening %v: ", path)
+	}
+	defer file.Close()
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, errors.Wrapf(err, "ReadUtxoViewChangeLog: problem seeking to offset %d of %v: ", offset, path)
+	}
+
+	var batches []*UtxoViewChangeLogBatch
+	reader := bufio.NewReader(file)
+	for maxBatches == 0 || len(batches) < maxBatches {
+		batchBytes, recordSize, err := readUtxoViewChangeLogRecord(reader)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "ReadUtxoViewChangeLog: problem reading record at offset %d of %v: ",
+				offset, path)
+		}
+		if batchBytes == nil {
+			break
+		}
+		batch := &UtxoViewChangeLogBatch{}
+		if err = batch.FromBytes(batchBytes); err != nil {
+			return nil, 0, errors.Wrapf(err, "ReadUtxoViewChangeLog: problem decoding batch at offset %d of %v: ",
+				offset, path)
+		}
+		batches = append(batches, batch)
+		offset += recordSize
+	}
+	return batches, offset, nil
+}
@@ -0,0 +1,103 @@
+//go:build !deso_lean
+
+package lib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUtxoViewChangeLog(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := DeSoTestnetParams
+	path := filepath.Join(t.TempDir(), "utxo_view_change_log")
+	// Flushes also write entries like the global params, so only look at the feed entries.
+	feedMutations := func(batch *UtxoViewChangeLogBatch) []*UtxoViewFlushMutation {
+		var mutations []*UtxoViewFlushMutation
+		for _, mutation := range batch.Mutations {
+			if bytes.HasPrefix(mutation.KeyBytes, Prefixes.PrefixExchangeRateFeedEntryByPublicKey) {
+				mutations = append(mutations, mutation)
+			}
+		}
+		return mutations
+	}
+
+	changeLog, err := NewUtxoViewChangeLog(path)
+	require.NoError(err)
+	_, hasBatches := changeLog.GetLastSequenceNumber()
+	require.False(hasBatches)
+	eventManager := NewEventManager()
+	eventManager.EnableUtxoViewFlushMutations()
+	eventManager.OnUtxoViewFlushed(nil, changeLog.HandleUtxoViewFlushed)
+
+	// Each flush appends a batch with its mutations in the order they were written.
+	feedEntry := &ExchangeRateFeedEntry{PublicKey: m0PkBytes}
+	utxoView := NewUtxoView(db, &params, nil, nil, eventManager)
+	utxoView._setExchangeRateFeedEntryMappings(feedEntry)
+	require.NoError(utxoView.FlushToDb(5))
+	utxoView = NewUtxoView(db, &params, nil, nil, eventManager)
+	utxoView._deleteExchangeRateFeedEntryMappings(feedEntry)
+	require.NoError(utxoView.FlushToDb(6))
+
+	batches, nextOffset, err := ReadUtxoViewChangeLog(path, 0, 0)
+	require.NoError(err)
+	require.Len(batches, 2)
+	require.Equal(uint64(0), batches[0].SequenceNumber)
+	require.Equal(uint64(5), batches[0].BlockHeight)
+	require.Len(feedMutations(batches[0]), 1)
+	setMutation := feedMutations(batches[0])[0]
+	require.Equal(DbOperationTypeUpsert, setMutation.OperationType)
+	require.NotEmpty(setMutation.EncoderBytes)
+	require.Equal(uint64(1), batches[1].SequenceNumber)
+	require.Equal(uint64(6), batches[1].BlockHeight)
+	require.Len(feedMutations(batches[1]), 1)
+	deleteMutation := feedMutations(batches[1])[0]
+	require.Equal(DbOperationTypeDelete, deleteMutation.OperationType)
+	require.Equal(setMutation.KeyBytes, deleteMutation.KeyBytes)
+	require.Empty(deleteMutation.EncoderBytes)
+
+	// Reading from the returned offset tails the log.
+	firstBatches, firstOffset, err := ReadUtxoViewChangeLog(path, 0, 1)
+	require.NoError(err)
+	require.Len(firstBatches, 1)
+	batches, offset, err := ReadUtxoViewChangeLog(path, firstOffset, 0)
+	require.NoError(err)
+	require.Len(batches, 1)
+	require.Equal(uint64(1), batches[0].SequenceNumber)
+	require.Equal(nextOffset, offset)
+	require.NoError(changeLog.Close())
+
+	// A record cut off at the end of the log isn't read, and is truncated when the log is
+	// reopened.
+	contents, err := os.ReadFile(path)
+	require.NoError(err)
+	cutOffRecord := encodeUtxoViewChangeLogRecord(&UtxoViewChangeLogBatch{SequenceNumber: 2})
+	require.NoError(os.WriteFile(path, append(contents, cutOffRecord[:len(cutOffRecord)-1]...), 0644))
+	batches, offset, err = ReadUtxoViewChangeLog(path, nextOffset, 0)
+	require.NoError(err)
+	require.Empty(batches)
+	require.Equal(nextOffset, offset)
+
+	changeLog, err = NewUtxoViewChangeLog(path)
+	require.NoError(err)
+	lastSequenceNumber, hasBatches := changeLog.GetLastSequenceNumber()
+	require.True(hasBatches)
+	require.Equal(uint64(1), lastSequenceNumber)
+	fileInfo, err := os.Stat(path)
+	require.NoError(err)
+	require.Equal(nextOffset, fileInfo.Size())
+	require.NoError(changeLog.Close())
+
+	// A corrupted record is an error rather than being skipped.
+	contents[utxoViewChangeLogRecordHeaderSize] ^= 0xff
+	require.NoError(os.WriteFile(path, contents, 0644))
+	_, _, err = ReadUtxoViewChangeLog(path, 0, 0)
+	require.Error(err)
+}
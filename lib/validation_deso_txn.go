@@ -202,9 +202,10 @@ func ValidateDeSoTxnMinimalNetworkFee(txn *MsgDeSoTxn, globalParams *GlobalParam
 	if err != nil {
 		return errors.Wrapf(err, "ValidateDeSoTxnMinimalNetworkFee: Problem computing fee per KB")
 	}
-	if feeNanosPerKb < globalParams.MinimumNetworkFeeNanosPerKB {
+	minNetworkFeeNanosPerKB := globalParams.GetMinimumNetworkFeeNanosPerKBForTxn(txn)
+	if feeNanosPerKb < minNetworkFeeNanosPerKB {
 		return errors.Wrapf(RuleErrorTxnFeeBelowNetworkMinimum, "ValidateDeSoTxnMinimalNetworkFee: Transaction fee "+
-			"per KB %d is less than the network minimum %d", feeNanosPerKb, globalParams.MinimumNetworkFeeNanosPerKB)
+			"per KB %d is less than the network minimum %d", feeNanosPerKb, minNetworkFeeNanosPerKB)
 	}
 	return nil
 }
@@ -1,3 +1,5 @@
+//go:build !deso_lean
+
 package main
 
 import (
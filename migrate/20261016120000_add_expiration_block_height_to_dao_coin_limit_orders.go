@@ -0,0 +1,21 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_dao_coin_limit_orders ADD COLUMN expiration_block_height BIGINT NOT NULL DEFAULT 0;`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_dao_coin_limit_orders DROP COLUMN expiration_block_height;`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016120000_add_expiration_block_height_to_dao_coin_limit_orders", up, down, opts)
+}
@@ -0,0 +1,40 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`
+			CREATE TABLE pg_dao_coin_last_trade_prices (
+				buying_dao_coin_creator_pkid                       BYTEA NOT NULL,
+				selling_dao_coin_creator_pkid                      BYTEA NOT NULL,
+				scaled_exchange_rate_coins_to_sell_per_coin_to_buy TEXT NOT NULL,
+				block_height                                       BIGINT NOT NULL,
+
+				PRIMARY KEY (buying_dao_coin_creator_pkid, selling_dao_coin_creator_pkid)
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`ALTER TABLE pg_dao_coin_limit_orders ADD COLUMN stop_trigger_scaled_price TEXT NOT NULL DEFAULT '';`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`DROP TABLE pg_dao_coin_last_trade_prices;`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`ALTER TABLE pg_dao_coin_limit_orders DROP COLUMN stop_trigger_scaled_price;`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016130000_create_dao_coin_last_trade_prices", up, down, opts)
+}
@@ -0,0 +1,21 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_dao_coin_limit_orders ADD COLUMN min_quantity_to_fill_in_base_units TEXT NOT NULL DEFAULT '';`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_dao_coin_limit_orders DROP COLUMN min_quantity_to_fill_in_base_units;`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016140000_add_min_quantity_to_fill_to_dao_coin_limit_orders", up, down, opts)
+}
@@ -0,0 +1,21 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_dao_coin_limit_orders ADD COLUMN quantity_denomination SMALLINT NOT NULL DEFAULT 0;`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_dao_coin_limit_orders DROP COLUMN quantity_denomination;`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016150000_add_quantity_denomination_to_dao_coin_limit_orders", up, down, opts)
+}
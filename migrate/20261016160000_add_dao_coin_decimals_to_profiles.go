@@ -0,0 +1,21 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_profiles ADD COLUMN dao_coin_decimals SMALLINT NOT NULL DEFAULT 0;`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_profiles DROP COLUMN dao_coin_decimals;`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016160000_add_dao_coin_decimals_to_profiles", up, down, opts)
+}
@@ -0,0 +1,27 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`
+			ALTER TABLE pg_dao_coin_limit_orders ADD COLUMN buying_coin_is_creator_coin BOOLEAN NOT NULL DEFAULT FALSE;
+			ALTER TABLE pg_dao_coin_limit_orders ADD COLUMN selling_coin_is_creator_coin BOOLEAN NOT NULL DEFAULT FALSE;
+		`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`
+			ALTER TABLE pg_dao_coin_limit_orders DROP COLUMN buying_coin_is_creator_coin;
+			ALTER TABLE pg_dao_coin_limit_orders DROP COLUMN selling_coin_is_creator_coin;
+		`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016170000_add_creator_coin_flags_to_dao_coin_limit_orders", up, down, opts)
+}
@@ -0,0 +1,21 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_derived_keys ADD COLUMN nonce BIGINT NOT NULL DEFAULT 0;`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`ALTER TABLE pg_derived_keys DROP COLUMN nonce;`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016180000_add_nonce_to_derived_keys", up, down, opts)
+}
@@ -0,0 +1,36 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`
+			CREATE TABLE pg_locked_balances (
+				hodler_pkid                     BYTEA NOT NULL,
+				profile_pkid                    BYTEA NOT NULL,
+				unlock_timestamp_nano_secs      BIGINT NOT NULL,
+				vesting_end_timestamp_nano_secs BIGINT NOT NULL,
+				balance_base_units              TEXT NOT NULL,
+
+				PRIMARY KEY (hodler_pkid, profile_pkid, unlock_timestamp_nano_secs, vesting_end_timestamp_nano_secs)
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX pg_locked_balances_profile_pkid ON pg_locked_balances (profile_pkid);`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`DROP TABLE pg_locked_balances;`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016190000_create_locked_balances", up, down, opts)
+}
@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`
+			CREATE TABLE pg_proposals (
+				proposal_id             BYTEA PRIMARY KEY,
+				proposer_pkid           BYTEA NOT NULL,
+				profile_pkid            BYTEA NOT NULL,
+				description             TEXT NOT NULL,
+				options                 TEXT[] NOT NULL,
+				snapshot_block_height   BIGINT NOT NULL,
+				voting_end_block_height BIGINT NOT NULL,
+				option_voting_powers    TEXT[] NOT NULL,
+				total_voting_power      TEXT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX pg_proposals_profile_pkid ON pg_proposals (profile_pkid);`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE pg_proposal_votes (
+				proposal_id  BYTEA NOT NULL,
+				voter_pkid   BYTEA NOT NULL,
+				voting_power TEXT NOT NULL,
+				option_index BIGINT NOT NULL,
+
+				PRIMARY KEY (proposal_id, voter_pkid)
+			);
+		`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE pg_proposals;
+			DROP TABLE pg_proposal_votes;
+		`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016200000_create_governance", up, down, opts)
+}
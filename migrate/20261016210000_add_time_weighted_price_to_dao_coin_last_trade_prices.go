@@ -0,0 +1,25 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		_, err := db.Exec(`
+			ALTER TABLE pg_dao_coin_last_trade_prices ADD COLUMN time_weighted_scaled_exchange_rate TEXT NOT NULL DEFAULT '';
+		`)
+		return err
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`
+			ALTER TABLE pg_dao_coin_last_trade_prices DROP COLUMN time_weighted_scaled_exchange_rate;
+		`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20261016210000_add_time_weighted_price_to_dao_coin_last_trade_prices", up, down, opts)
+}